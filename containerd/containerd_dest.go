@@ -0,0 +1,318 @@
+package containerd
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/leases"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/imagedestination/impl"
+	"github.com/containers/image/v5/internal/imagedestination/stubs"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// leaseExpiration is the expiration of the lease protecting the blobs written by a destination from containerd’s garbage collector
+// until the image is committed.  The lease is deleted on Close; the expiration only matters if the process is killed.
+const leaseExpiration = 24 * time.Hour
+
+type containerdImageDestination struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	stubs.NoPutBlobPartialInitialize
+	stubs.NoSignaturesInitialize
+
+	ref       containerdReference
+	client    *containerd.Client
+	namespace string
+	lease     leases.Lease
+	manifest  *imgspecv1.Descriptor // The top-level manifest, set by PutManifest.
+}
+
+// newImageDestination returns an ImageDestination for writing an image to containerd.
+func newImageDestination(ctx context.Context, sys *types.SystemContext, ref containerdReference) (private.ImageDestination, error) {
+	client, namespace, err := newClient(sys)
+	if err != nil {
+		return nil, err
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			client.Close()
+		}
+	}()
+
+	lease, err := client.LeasesService().Create(namespaces.WithNamespace(ctx, namespace),
+		leases.WithRandomID(), leases.WithExpiration(leaseExpiration))
+	if err != nil {
+		return nil, fmt.Errorf("creating a containerd lease: %w", err)
+	}
+
+	d := &containerdImageDestination{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			SupportedManifestMIMETypes: []string{
+				imgspecv1.MediaTypeImageManifest,
+				imgspecv1.MediaTypeImageIndex,
+				manifest.DockerV2Schema2MediaType,
+				manifest.DockerV2ListMediaType,
+			},
+			DesiredLayerCompression:        types.PreserveOriginal,
+			AcceptsForeignLayerURLs:        true,
+			MustMatchRuntimeOS:             false,
+			IgnoresEmbeddedDockerReference: false, // N/A, we only accept manifests which don’t embed a Docker reference.
+			HasThreadSafePutBlob:           true,
+		}),
+		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
+		NoSignaturesInitialize:     stubs.NoSignatures("Storing signatures in containerd is not supported"),
+
+		ref:       ref,
+		client:    client,
+		namespace: namespace,
+		lease:     lease,
+	}
+	d.Compat = impl.AddCompat(d)
+	succeeded = true
+	return d, nil
+}
+
+// Reference returns the reference used to set up this destination.  Note that this should directly correspond to user's intent,
+// e.g. it should use the public hostname instead of the result of resolving CNAMEs or following redirects.
+func (d *containerdImageDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// Close removes resources associated with an initialized ImageDestination, if any.
+func (d *containerdImageDestination) Close() error {
+	// Once the lease is deleted, blobs not referenced by any image are removed by containerd’s garbage collector.
+	err := d.client.LeasesService().Delete(namespaces.WithNamespace(context.Background(), d.namespace), d.lease)
+	if closeErr := d.client.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// leasedContext returns a context for containerd requests, using the namespace and lease of d.
+func (d *containerdImageDestination) leasedContext(ctx context.Context) context.Context {
+	return leases.WithLease(namespaces.WithNamespace(ctx, d.namespace), d.lease.ID)
+}
+
+// PutBlobWithOptions writes contents of stream and returns data representing the result.
+// inputInfo.Digest can be optionally provided if known; if provided, and stream is read to the end without error, the digest MUST match the stream contents.
+// inputInfo.Size is the expected length of stream, if known.
+// inputInfo.MediaType describes the blob format, if known.
+// WARNING: The contents of stream are being verified on the fly.  Until stream.Read() returns io.EOF, the contents of the data SHOULD NOT be available
+// to any other readers for download using the supplied digest.
+// If stream.Read() at any time, ESPECIALLY at end of input, returns an error, PutBlobWithOptions MUST 1) fail, and 2) delete any data stored so far.
+func (d *containerdImageDestination) PutBlobWithOptions(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, options private.PutBlobOptions) (private.UploadedBlob, error) {
+	// containerd’s content store only supports the canonical digest algorithm.
+	if inputInfo.Digest != "" && inputInfo.Digest.Algorithm() != digest.Canonical {
+		return private.UploadedBlob{}, fmt.Errorf("storing blob %s in containerd: only digest algorithm %s is supported", inputInfo.Digest, digest.Canonical)
+	}
+	ctx = d.leasedContext(ctx)
+	store := d.client.ContentStore()
+
+	ref := "containers-image-" + inputInfo.Digest.String()
+	if inputInfo.Digest == "" {
+		r, err := randomIngestRef()
+		if err != nil {
+			return private.UploadedBlob{}, err
+		}
+		ref = r
+	}
+	w, err := content.OpenWriter(ctx, store, content.WithRef(ref), content.WithDescriptor(imgspecv1.Descriptor{
+		MediaType: inputInfo.MediaType,
+		Digest:    inputInfo.Digest,
+		Size:      inputInfo.Size,
+	}))
+	if err != nil {
+		if errdefs.IsAlreadyExists(err) {
+			info, err := store.Info(ctx, inputInfo.Digest)
+			if err != nil {
+				return private.UploadedBlob{}, fmt.Errorf("looking up blob %s in containerd: %w", inputInfo.Digest, err)
+			}
+			return private.UploadedBlob{Digest: info.Digest, Size: info.Size}, nil
+		}
+		return private.UploadedBlob{}, fmt.Errorf("opening a containerd writer for blob %s: %w", inputInfo.Digest, err)
+	}
+	defer w.Close()
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			_ = store.Abort(ctx, ref)
+		}
+	}()
+
+	// Discard any data left by an earlier, interrupted, write of the same blob; stream can’t be resumed at an offset.
+	if err := w.Truncate(0); err != nil {
+		return private.UploadedBlob{}, fmt.Errorf("truncating containerd writer for blob %s: %w", inputInfo.Digest, err)
+	}
+	size, err := io.Copy(w, stream)
+	if err != nil {
+		return private.UploadedBlob{}, fmt.Errorf("storing blob %s in containerd: %w", inputInfo.Digest, err)
+	}
+	if inputInfo.Size != -1 && size != inputInfo.Size {
+		return private.UploadedBlob{}, fmt.Errorf("size mismatch when storing blob %s in containerd: expected %d, got %d", inputInfo.Digest, inputInfo.Size, size)
+	}
+	blobDigest := w.Digest()
+	if err := w.Commit(ctx, size, inputInfo.Digest); err != nil && !errdefs.IsAlreadyExists(err) {
+		return private.UploadedBlob{}, fmt.Errorf("committing blob %s to containerd: %w", blobDigest, err)
+	}
+	succeeded = true
+	return private.UploadedBlob{Digest: blobDigest, Size: size}, nil
+}
+
+// randomIngestRef returns a new containerd ingest reference for a blob with an unknown digest.
+func randomIngestRef() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating a random containerd ingest reference: %w", err)
+	}
+	return "containers-image-" + hex.EncodeToString(b), nil
+}
+
+// TryReusingBlobWithOptions checks whether the transport already contains, or can efficiently reuse, a blob, and if so, applies it to the current destination
+// (e.g. if the blob is a filesystem layer, this signifies that the changes it describes need to be applied again when composing a filesystem tree).
+// info.Digest must not be empty.
+// If the blob has been successfully reused, returns (true, info, nil).
+// If the transport can not reuse the requested blob, TryReusingBlob returns (false, {}, nil); it returns a non-nil error only on an unexpected failure.
+func (d *containerdImageDestination) TryReusingBlobWithOptions(ctx context.Context, info types.BlobInfo, options private.TryReusingBlobOptions) (bool, private.ReusedBlob, error) {
+	if !impl.OriginalBlobMatchesRequiredCompression(options) {
+		return false, private.ReusedBlob{}, nil
+	}
+	if info.Digest == "" {
+		return false, private.ReusedBlob{}, errors.New("Can not check for a blob with unknown digest")
+	}
+	if info.Digest.Algorithm() != digest.Canonical {
+		return false, private.ReusedBlob{}, nil
+	}
+	ctx = d.leasedContext(ctx)
+	blobInfo, err := d.client.ContentStore().Info(ctx, info.Digest)
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return false, private.ReusedBlob{}, nil
+		}
+		return false, private.ReusedBlob{}, fmt.Errorf("looking up blob %s in containerd: %w", info.Digest, err)
+	}
+	// Protect the blob from the garbage collector until the image is committed.
+	if err := d.client.LeasesService().AddResource(ctx, d.lease, leases.Resource{
+		ID:   info.Digest.String(),
+		Type: "content",
+	}); err != nil {
+		return false, private.ReusedBlob{}, fmt.Errorf("adding blob %s to a containerd lease: %w", info.Digest, err)
+	}
+	return true, private.ReusedBlob{Digest: info.Digest, Size: blobInfo.Size}, nil
+}
+
+// PutManifest writes a manifest to the destination.  Per our list of supported manifest MIME types,
+// this should be either an OCI or a Docker schema 2 manifest or index.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to overwrite the manifest for
+// (when the primary manifest is a manifest list); this should always be nil if the primary manifest is not a manifest list.
+// It is expected but not enforced that the instanceDigest, when specified, matches the digest of `manifest` as generated
+// by `manifest.Digest()`.
+// FIXME? This should also receive a MIME type if known, to differentiate between schema versions.
+// If the destination is in principle available, refuses this manifest type (e.g. it does not recognize the schema),
+// but may accept a different manifest type, the returned error must be an ManifestTypeRejectedError.
+func (d *containerdImageDestination) PutManifest(ctx context.Context, m []byte, instanceDigest *digest.Digest) error {
+	mimeType := manifest.GuessMIMEType(m)
+	labels, err := gcLabels(m, mimeType)
+	if err != nil {
+		return err
+	}
+	desc := imgspecv1.Descriptor{
+		MediaType: mimeType,
+		Digest:    digest.FromBytes(m),
+		Size:      int64(len(m)),
+	}
+
+	ctx = d.leasedContext(ctx)
+	store := d.client.ContentStore()
+	if err := content.WriteBlob(ctx, store, "containers-image-"+desc.Digest.String(), bytes.NewReader(m), desc); err != nil {
+		return fmt.Errorf("storing manifest %s in containerd: %w", desc.Digest, err)
+	}
+	// The labels are set separately, because content.WriteBlob does not update an already existing blob.
+	if len(labels) > 0 {
+		fieldPaths := make([]string, 0, len(labels))
+		for key := range labels {
+			fieldPaths = append(fieldPaths, "labels."+key)
+		}
+		if _, err := store.Update(ctx, content.Info{Digest: desc.Digest, Labels: labels}, fieldPaths...); err != nil {
+			return fmt.Errorf("setting garbage collection labels of manifest %s in containerd: %w", desc.Digest, err)
+		}
+	}
+
+	if instanceDigest == nil {
+		d.manifest = &desc
+	}
+	return nil
+}
+
+// gcLabels returns the labels which make containerd’s garbage collector keep the blobs referenced by manifest m,
+// as long as the manifest is kept.
+func gcLabels(m []byte, mimeType string) (map[string]string, error) {
+	labels := map[string]string{}
+	if manifest.MIMETypeIsMultiImage(mimeType) {
+		list, err := manifest.ListFromBlob(m, mimeType)
+		if err != nil {
+			return nil, fmt.Errorf("parsing manifest list: %w", err)
+		}
+		for i, instance := range list.Instances() {
+			labels[fmt.Sprintf("containerd.io/gc.ref.content.m.%d", i)] = instance.String()
+		}
+		return labels, nil
+	}
+	man, err := manifest.FromBlob(m, mimeType)
+	if err != nil {
+		return nil, fmt.Errorf("parsing manifest: %w", err)
+	}
+	labels["containerd.io/gc.ref.content.config"] = man.ConfigInfo().Digest.String()
+	for i, layer := range man.LayerInfos() {
+		labels[fmt.Sprintf("containerd.io/gc.ref.content.l.%d", i)] = layer.Digest.String()
+	}
+	return labels, nil
+}
+
+// Commit marks the process of storing the image as successful and asks for the image to be persisted.
+// unparsedToplevel contains data about the top-level manifest of the source (which may be a single-arch image or a manifest list
+// if PutManifest was only called for the single-arch image with instanceDigest == nil), primarily to allow lookups by the
+// original manifest list digest, if desired.
+// WARNING: This does not have any transactional semantics:
+// - Uploaded data MAY be visible to others before Commit() is called
+// - Uploaded data MAY be removed or MAY remain around if Close() is called without Commit() (i.e. rollback is allowed but not guaranteed)
+func (d *containerdImageDestination) Commit(ctx context.Context, unparsedToplevel types.UnparsedImage) error {
+	if d.manifest == nil {
+		return errors.New("Internal error: Commit called before PutManifest")
+	}
+	if canonical, ok := d.ref.ref.(reference.Canonical); ok && canonical.Digest() != d.manifest.Digest {
+		return fmt.Errorf("manifest digest %s does not match the digest %s in reference %q", d.manifest.Digest, canonical.Digest(), d.ref.imageName())
+	}
+
+	ctx = d.leasedContext(ctx)
+	imageService := d.client.ImageService()
+	img := images.Image{
+		Name:   d.ref.imageName(),
+		Target: *d.manifest,
+	}
+	if _, err := imageService.Create(ctx, img); err != nil {
+		if !errdefs.IsAlreadyExists(err) {
+			return fmt.Errorf("creating containerd image %q: %w", img.Name, err)
+		}
+		if _, err := imageService.Update(ctx, img, "target"); err != nil {
+			return fmt.Errorf("updating containerd image %q: %w", img.Name, err)
+		}
+	}
+	return nil
+}
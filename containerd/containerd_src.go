@@ -0,0 +1,130 @@
+package containerd
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containers/image/v5/internal/imagesource/impl"
+	"github.com/containers/image/v5/internal/imagesource/stubs"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type containerdImageSource struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	impl.NoSignatures
+	impl.DoesNotAffectLayerInfosForCopy
+	stubs.NoGetBlobAtInitialize
+
+	ref       containerdReference
+	client    *containerd.Client
+	namespace string
+	target    imgspecv1.Descriptor // The descriptor of the top-level manifest, as recorded in the containerd image.
+}
+
+// newImageSource returns an ImageSource for reading an image from containerd.
+func newImageSource(ctx context.Context, sys *types.SystemContext, ref containerdReference) (private.ImageSource, error) {
+	client, namespace, err := newClient(sys)
+	if err != nil {
+		return nil, err
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			client.Close()
+		}
+	}()
+
+	ctx = namespaces.WithNamespace(ctx, namespace)
+	img, err := client.ImageService().Get(ctx, ref.imageName())
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return nil, fmt.Errorf("image %q not found in containerd namespace %q: %w", ref.imageName(), namespace, err)
+		}
+		return nil, fmt.Errorf("looking up containerd image %q: %w", ref.imageName(), err)
+	}
+
+	s := &containerdImageSource{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			HasThreadSafeGetBlob: true,
+		}),
+		NoGetBlobAtInitialize: stubs.NoGetBlobAt(ref),
+
+		ref:       ref,
+		client:    client,
+		namespace: namespace,
+		target:    img.Target,
+	}
+	s.Compat = impl.AddCompat(s)
+	succeeded = true
+	return s, nil
+}
+
+// Reference returns the reference used to set up this source.
+func (s *containerdImageSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// Close removes resources associated with an initialized ImageSource, if any.
+func (s *containerdImageSource) Close() error {
+	return s.client.Close()
+}
+
+// GetManifest returns the image's manifest along with its MIME type (which may be empty when it can't be determined but the manifest is available).
+// It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve (when the primary manifest is a manifest list);
+// this never happens if the primary manifest is not a manifest list (e.g. if the source never returns manifest lists).
+func (s *containerdImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	desc := s.target
+	if instanceDigest != nil {
+		desc = imgspecv1.Descriptor{Digest: *instanceDigest, Size: -1}
+	}
+	ra, err := s.client.ContentStore().ReaderAt(namespaces.WithNamespace(ctx, s.namespace), desc)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading manifest %s from containerd: %w", desc.Digest, err)
+	}
+	defer ra.Close()
+	m, err := iolimits.ReadAtMost(io.NewSectionReader(ra, 0, ra.Size()), iolimits.MaxManifestBodySize)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading manifest %s from containerd: %w", desc.Digest, err)
+	}
+	mimeType := desc.MediaType
+	if mimeType == "" {
+		mimeType = manifest.GuessMIMEType(m)
+	}
+	return m, mimeType, nil
+}
+
+// GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
+// The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
+// May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
+func (s *containerdImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	ra, err := s.client.ContentStore().ReaderAt(namespaces.WithNamespace(ctx, s.namespace), imgspecv1.Descriptor{
+		MediaType: info.MediaType,
+		Digest:    info.Digest,
+		Size:      info.Size,
+	})
+	if err != nil {
+		return nil, -1, fmt.Errorf("reading blob %s from containerd: %w", info.Digest, err)
+	}
+	return blobReader{
+		Reader: content.NewReader(ra),
+		Closer: ra,
+	}, ra.Size(), nil
+}
+
+// blobReader is an io.ReadCloser reading a blob from a content.ReaderAt.
+type blobReader struct {
+	io.Reader
+	io.Closer
+}
@@ -0,0 +1,65 @@
+package containerd
+
+import (
+	"testing"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sha256digest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestTransportName(t *testing.T) {
+	assert.Equal(t, "containerd", Transport.Name())
+}
+
+func TestTransportParseReference(t *testing.T) {
+	testParseReference(t, Transport.ParseReference)
+}
+
+func TestParseReference(t *testing.T) {
+	testParseReference(t, ParseReference)
+}
+
+// testParseReference is a test shared for Transport.ParseReference and ParseReference.
+func testParseReference(t *testing.T, fn func(string) (types.ImageReference, error)) {
+	for _, c := range []struct{ input, expected string }{
+		{"UPPERCASEISINVALID", ""},                                               // Invalid reference input
+		{sha256digest, ""},                                                       // Image IDs are not supported
+		{"busybox", "docker.io/library/busybox:latest"},                          // Default tag
+		{"busybox:notlatest", "docker.io/library/busybox:notlatest"},             // Explicit tag
+		{"busybox@" + sha256digest, "docker.io/library/busybox@" + sha256digest}, // Explicit digest
+		{"busybox:latest@" + sha256digest, ""},                                   // Both tag and digest
+		{"example.com/ns/stream:tag", "example.com/ns/stream:tag"},               // Other registry
+	} {
+		ref, err := fn(c.input)
+		if c.expected == "" {
+			assert.Error(t, err, c.input)
+			continue
+		}
+		require.NoError(t, err, c.input)
+		cRef, ok := ref.(containerdReference)
+		require.True(t, ok, c.input)
+		assert.Equal(t, c.expected, cRef.imageName(), c.input)
+		assert.Equal(t, c.expected, cRef.DockerReference().String(), c.input)
+		assert.Equal(t, c.expected, cRef.PolicyConfigurationIdentity(), c.input)
+
+		// StringWithinTransport round-trips.
+		ref2, err := fn(ref.StringWithinTransport())
+		require.NoError(t, err, c.input)
+		assert.Equal(t, ref, ref2, c.input)
+	}
+}
+
+func TestReferencePolicyConfigurationNamespaces(t *testing.T) {
+	ref, err := ParseReference("example.com/ns/stream:tag")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.com/ns/stream", "example.com/ns", "example.com", "*.com"}, ref.PolicyConfigurationNamespaces())
+
+	named, err := reference.ParseNormalizedNamed("busybox")
+	require.NoError(t, err)
+	_, err = NewReference(named)
+	assert.Error(t, err)
+}
@@ -6,10 +6,10 @@ import (
 	"fmt"
 	"io"
 
+	"github.com/containers/image/v5/internal/digests"
 	"github.com/containers/image/v5/internal/private"
 	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
 	"github.com/containers/image/v5/types"
-	"github.com/sirupsen/logrus"
 )
 
 // copyBlobFromStream copies a blob with srcInfo (with known Digest and Annotations and possibly known Size) from srcReader to dest,
@@ -33,6 +33,9 @@ func (ic *imageCopier) copyBlobFromStream(ctx context.Context, srcReader io.Read
 	// Note that for this check we don't use the stronger "validationSucceeded" indicator, because
 	// dest.PutBlob may detect that the layer already exists, in which case we don't
 	// read stream to the end, and validation does not happen.
+	if err := digests.ValidateAlgorithm(ic.c.options.SourceCtx, srcInfo.Digest.Algorithm()); err != nil {
+		return types.BlobInfo{}, fmt.Errorf("verifying blob %s: %w", srcInfo.Digest, err)
+	}
 	digestingReader, err := newDigestingReader(stream.reader, srcInfo.Digest)
 	if err != nil {
 		return types.BlobInfo{}, fmt.Errorf("preparing to verify blob %s: %w", srcInfo.Digest, err)
@@ -50,7 +53,7 @@ func (ic *imageCopier) copyBlobFromStream(ctx context.Context, srcReader io.Read
 
 	// === Detect compression of the input stream.
 	// This requires us to “peek ahead” into the stream to read the initial part, which requires us to chain through another io.Reader returned by DetectCompression.
-	detectedCompression, err := blobPipelineDetectCompressionStep(&stream, srcInfo)
+	detectedCompression, err := blobPipelineDetectCompressionStep(ic.c.logger, &stream, srcInfo)
 	if err != nil {
 		return types.BlobInfo{}, err
 	}
@@ -121,7 +124,7 @@ func (ic *imageCopier) copyBlobFromStream(ctx context.Context, srcReader io.Read
 	// So, read everything from originalLayerReader, which will cause the rest to be
 	// sent there if we are not already at EOF.
 	if getOriginalLayerCopyWriter != nil {
-		logrus.Debugf("Consuming rest of the original blob to satisfy getOriginalLayerCopyWriter")
+		ic.c.logger.Debugf("Consuming rest of the original blob to satisfy getOriginalLayerCopyWriter")
 		_, err := io.Copy(io.Discard, originalLayerReader)
 		if err != nil {
 			return types.BlobInfo{}, fmt.Errorf("reading input blob %s: %w", srcInfo.Digest, err)
@@ -15,16 +15,18 @@ import (
 	"github.com/containers/image/v5/internal/imagesource"
 	internalManifest "github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/tracing"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/blobinfocache"
 	compression "github.com/containers/image/v5/pkg/compression/types"
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/pkg/metrics"
 	"github.com/containers/image/v5/signature"
 	"github.com/containers/image/v5/signature/signer"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
 	encconfig "github.com/containers/ocicrypt/config"
 	digest "github.com/opencontainers/go-digest"
-	"github.com/sirupsen/logrus"
 	"golang.org/x/exp/slices"
 	"golang.org/x/sync/semaphore"
 	"golang.org/x/term"
@@ -70,12 +72,36 @@ const (
 // specific images from the source reference.
 type ImageListSelection int
 
+// ForeignLayerPolicy controls how layers with "nondistributable" media types ("foreign" layers), which typically
+// list external URLs for their contents, are copied.
+type ForeignLayerPolicy int
+
+const (
+	// ForeignLayersDefault copies only the references to foreign layers which list URLs, without their contents,
+	// if the destination accepts such references; otherwise, the contents are copied.
+	// If Options.DownloadForeignLayers is set, this behaves like ForeignLayersDownload.
+	ForeignLayersDefault ForeignLayerPolicy = iota
+	// ForeignLayersSkip never copies contents of foreign layers which list URLs, only the references;
+	// the copy fails if the destination does not accept such references.
+	ForeignLayersSkip
+	// ForeignLayersDownload copies the contents of foreign layers (reading them from their URLs, if the source supports that,
+	// and SystemContext.DisableForeignLayerURLs is not set), and, if the manifest can be modified, converts them to ordinary
+	// layers in the destination manifest.
+	ForeignLayersDownload
+	// ForeignLayersReject fails the copy if the image contains any foreign layers.
+	ForeignLayersReject
+)
+
 // Options allows supplying non-default configuration modifying the behavior of CopyImage.
 type Options struct {
-	RemoveSignatures bool // Remove any pre-existing signatures. Signers and SignBy… will still add a new signature.
+	RemoveSignatures bool // Remove any pre-existing signatures. Signers, SignersWithIdentity and SignBy… will still add a new signature.
 	// Signers to use to add signatures during the copy.
 	// Callers are still responsible for closing these Signer objects; they can be reused for multiple copy.Image operations in a row.
-	Signers                          []*signer.Signer
+	Signers []*signer.Signer
+	// Signers to use to add signatures during the copy, each signing its own identity. All signatures (from these signers,
+	// Signers and SignBy…) are created before any of them are stored, and they are stored in a single operation.
+	// Callers are still responsible for closing these Signer objects; they can be reused for multiple copy.Image operations in a row.
+	SignersWithIdentity              []SignerWithIdentity
 	SignBy                           string          // If non-empty, asks for a signature to be added during the copy, and specifies a key ID, as accepted by signature.NewGPGSigningMechanism().SignDockerManifest(),
 	SignPassphrase                   string          // Passphrase to use when signing with the key ID from `SignBy`.
 	SignBySigstorePrivateKeyFile     string          // If non-empty, asks for a signature to be added during the copy, using a sigstore private key file at the provided path.
@@ -87,6 +113,7 @@ type Options struct {
 	DestinationCtx   *types.SystemContext
 	ProgressInterval time.Duration                 // time to wait between reports to signal the progress channel
 	Progress         chan types.ProgressProperties // Reported to when ProgressInterval has arrived for a single artifact+offset.
+	// Destinations which apply layers locally (e.g. containers-storage) also report applying, and rolling back, layers to Progress.
 
 	// Preserve digests, and fail if we cannot.
 	PreserveDigests bool
@@ -127,6 +154,8 @@ type Options struct {
 	// Download layer contents with "nondistributable" media types ("foreign" layers) and translate the layer media type
 	// to not indicate "nondistributable".
 	DownloadForeignLayers bool
+	// ForeignLayers controls how foreign layers are copied; see ForeignLayerPolicy.
+	ForeignLayers ForeignLayerPolicy
 
 	// Contains slice of OptionCompressionVariant, where copy will ensure that for each platform
 	// in the manifest list, a variant with the requested compression will exist.
@@ -137,6 +166,20 @@ type Options struct {
 	// DestinationCtx.CompressionFormat is used exclusively, and blobs of other
 	// compression algorithms are not reused.
 	ForceCompressionFormat bool
+
+	// ConfigStrictness controls how fields of the image configuration not defined by the OCI or Docker formats
+	// (e.g. vendor extensions) are handled if the configuration needs to be rebuilt, e.g. when converting
+	// a Docker schema2 image to OCI. The default is to drop them.
+	ConfigStrictness types.ConfigStrictness
+
+	// Timeouts limits the duration of individual phases of the copy. By default, only the deadline of the context.Context applies.
+	Timeouts PhaseTimeouts
+}
+
+// SignerWithIdentity is a signer to use during a copy, along with the identity it signs.
+type SignerWithIdentity struct {
+	Signer   *signer.Signer
+	Identity reference.Named // Identity to use when signing; if nil, Options.SignIdentity, or the docker reference of the destination, is used.
 }
 
 // OptionCompressionVariant allows to supply information about
@@ -159,12 +202,30 @@ type copier struct {
 
 	reportWriter   io.Writer
 	progressOutput io.Writer
+	logger         types.Logger
+	metrics        types.Metrics
 
 	unparsedToplevel              *image.UnparsedImage // for rawSource
 	blobInfoCache                 internalblobinfocache.BlobInfoCache2
-	concurrentBlobCopiesSemaphore *semaphore.Weighted // Limits the amount of concurrently copied blobs
-	signers                       []*signer.Signer    // Signers to use to create new signatures for the image
-	signersToClose                []*signer.Signer    // Signers that should be closed when this copier is destroyed.
+	concurrentBlobCopiesSemaphore *semaphore.Weighted  // Limits the amount of concurrently copied blobs
+	signers                       []SignerWithIdentity // Signers to use to create new signatures for the image
+	signersToClose                []*signer.Signer     // Signers that should be closed when this copier is destroyed.
+}
+
+// copyLogger returns the logger to use for a copy with options: the destination’s, if set, or the source’s.
+func copyLogger(options *Options) types.Logger {
+	if options.DestinationCtx != nil && options.DestinationCtx.Logger != nil {
+		return options.DestinationCtx.Logger
+	}
+	return logging.For(options.SourceCtx)
+}
+
+// copyMetrics returns the metrics receiver to use for a copy with options: the destination’s, if set, or the source’s.
+func copyMetrics(options *Options) types.Metrics {
+	if options.DestinationCtx != nil && options.DestinationCtx.Metrics != nil {
+		return options.DestinationCtx.Metrics
+	}
+	return metrics.For(options.SourceCtx)
 }
 
 // Internal function to validate `requireCompressionFormatMatch` for copySingleImageOptions
@@ -179,6 +240,10 @@ func shouldRequireCompressionFormatMatch(options *Options) (bool, error) {
 // source image admissibility.  It returns the manifest which was written to
 // the new copy of the image.
 func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef, srcRef types.ImageReference, options *Options) (copiedManifest []byte, retErr error) {
+	ctx, span := tracing.Start(ctx, "copy.Image",
+		tracing.AttributeSource.String(transports.ImageName(srcRef)), tracing.AttributeDestination.String(transports.ImageName(destRef)))
+	defer func() { tracing.End(span, retErr) }()
+
 	if options == nil {
 		options = &Options{}
 	}
@@ -208,6 +273,20 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		}
 	}()
 
+	if progressDest, ok := dest.(private.ImageDestinationWithCommitProgress); ok {
+		if options.Progress != nil && options.ProgressInterval > 0 {
+			progressDest.SetCommitProgress(options.Progress)
+		}
+		// Remove any layers applied so far if copying fails; this must happen before dest.Close().
+		defer func() {
+			if retErr != nil {
+				if err := progressDest.Rollback(ctx); err != nil {
+					copyLogger(options).Warnf("Error rolling back a partially copied image in %s: %v", transports.ImageName(destRef), err)
+				}
+			}
+		}()
+	}
+
 	publicRawSource, err := srcRef.NewImageSource(ctx, options.SourceCtx)
 	if err != nil {
 		return nil, fmt.Errorf("initializing source %s: %w", transports.ImageName(srcRef), err)
@@ -239,6 +318,8 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 
 		reportWriter:   reportWriter,
 		progressOutput: progressOutput,
+		logger:         copyLogger(options),
+		metrics:        copyMetrics(options),
 
 		unparsedToplevel: image.UnparsedInstance(rawSource, nil),
 		// FIXME? The cache is used for sources and destinations equally, but we only have a SourceCtx and DestinationCtx.
@@ -250,31 +331,17 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 	c.blobInfoCache.Open()
 	defer c.blobInfoCache.Close()
 
-	// Set the concurrentBlobCopiesSemaphore if we can copy layers in parallel.
-	if dest.HasThreadSafePutBlob() && rawSource.HasThreadSafeGetBlob() {
-		c.concurrentBlobCopiesSemaphore = c.options.ConcurrentBlobCopiesSemaphore
-		if c.concurrentBlobCopiesSemaphore == nil {
-			max := c.options.MaxParallelDownloads
-			if max == 0 {
-				max = maxParallelDownloads
-			}
-			c.concurrentBlobCopiesSemaphore = semaphore.NewWeighted(int64(max))
-		}
-	} else {
-		c.concurrentBlobCopiesSemaphore = semaphore.NewWeighted(int64(1))
-		if c.options.ConcurrentBlobCopiesSemaphore != nil {
-			if err := c.options.ConcurrentBlobCopiesSemaphore.Acquire(ctx, 1); err != nil {
-				return nil, fmt.Errorf("acquiring semaphore for concurrent blob copies: %w", err)
-			}
-			defer c.options.ConcurrentBlobCopiesSemaphore.Release(1)
-		}
+	releaseSemaphore, err := c.setupConcurrentBlobCopiesSemaphore(ctx)
+	if err != nil {
+		return nil, err
 	}
+	defer releaseSemaphore()
 
 	if err := c.setupSigners(); err != nil {
 		return nil, err
 	}
 
-	multiImage, err := isMultiImage(ctx, c.unparsedToplevel)
+	multiImage, err := c.resolveIsMultiImage(ctx, c.unparsedToplevel)
 	if err != nil {
 		return nil, fmt.Errorf("determining manifest MIME type for %s: %w", transports.ImageName(srcRef), err)
 	}
@@ -315,7 +382,7 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		if err != nil {
 			return nil, fmt.Errorf("choosing an image from manifest list %s: %w", transports.ImageName(srcRef), err)
 		}
-		logrus.Debugf("Source is a manifest list; copying (only) instance %s for current system", instanceDigest)
+		c.logger.Debugf("Source is a manifest list; copying (only) instance %s for current system", instanceDigest)
 		unparsedInstance := image.UnparsedInstance(rawSource, &instanceDigest)
 		single, err := c.copySingleImage(ctx, unparsedInstance, nil, copySingleImageOptions{requireCompressionFormatMatch: requireCompressionFormatMatch})
 		if err != nil {
@@ -330,9 +397,9 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 		// Copy some or all of the images.
 		switch c.options.ImageListSelection {
 		case CopyAllImages:
-			logrus.Debugf("Source is a manifest list; copying all instances")
+			c.logger.Debugf("Source is a manifest list; copying all instances")
 		case CopySpecificImages:
-			logrus.Debugf("Source is a manifest list; copying some instances")
+			c.logger.Debugf("Source is a manifest list; copying some instances")
 		}
 		if copiedManifest, err = c.copyMultipleImages(ctx); err != nil {
 			return nil, err
@@ -346,6 +413,31 @@ func Image(ctx context.Context, policyContext *signature.PolicyContext, destRef,
 	return copiedManifest, nil
 }
 
+// setupConcurrentBlobCopiesSemaphore sets c.concurrentBlobCopiesSemaphore, for copies from c.rawSource to c.dest.
+// The caller must call the returned function when it is done copying from c.rawSource.
+func (c *copier) setupConcurrentBlobCopiesSemaphore(ctx context.Context) (func(), error) {
+	// Set the concurrentBlobCopiesSemaphore if we can copy layers in parallel.
+	if c.dest.HasThreadSafePutBlob() && c.rawSource.HasThreadSafeGetBlob() {
+		c.concurrentBlobCopiesSemaphore = c.options.ConcurrentBlobCopiesSemaphore
+		if c.concurrentBlobCopiesSemaphore == nil {
+			max := c.options.MaxParallelDownloads
+			if max == 0 {
+				max = maxParallelDownloads
+			}
+			c.concurrentBlobCopiesSemaphore = semaphore.NewWeighted(int64(max))
+		}
+		return func() {}, nil
+	}
+	c.concurrentBlobCopiesSemaphore = semaphore.NewWeighted(int64(1))
+	if c.options.ConcurrentBlobCopiesSemaphore != nil {
+		if err := c.options.ConcurrentBlobCopiesSemaphore.Acquire(ctx, 1); err != nil {
+			return nil, fmt.Errorf("acquiring semaphore for concurrent blob copies: %w", err)
+		}
+		return func() { c.options.ConcurrentBlobCopiesSemaphore.Release(1) }, nil
+	}
+	return func() {}, nil
+}
+
 // Printf writes a formatted string to c.reportWriter.
 // Note that the method name Printf is not entirely arbitrary: (go tool vet)
 // has a built-in list of functions/methods (whatever object they are for)
@@ -359,7 +451,7 @@ func (c *copier) Printf(format string, a ...any) {
 func (c *copier) close() {
 	for i, s := range c.signersToClose {
 		if err := s.Close(); err != nil {
-			logrus.Warnf("Error closing per-copy signer %d: %v", i+1, err)
+			c.logger.Warnf("Error closing per-copy signer %d: %v", i+1, err)
 		}
 	}
 }
@@ -0,0 +1,304 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	internalblobinfocache "github.com/containers/image/v5/internal/blobinfocache"
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/internal/imagedestination"
+	"github.com/containers/image/v5/internal/imagesource"
+	internalManifest "github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/internal/tracing"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// IndexSource is a single-platform image to be included in an index created by Index.
+type IndexSource struct {
+	Reference types.ImageReference
+	// Platform to record for the image in the index. If nil, it is inferred from the image’s configuration.
+	Platform *imgspecv1.Platform
+	// Annotations to record for the image in the index, in addition to the annotations of the copied image’s manifest
+	// (if it is an OCI manifest); if both contain the same key, the value from Annotations is used.
+	Annotations map[string]string
+}
+
+// IndexOptions allows supplying non-default configuration modifying the behavior of Index.
+type IndexOptions struct {
+	// Options used for copying each of the images, and for writing the index.
+	// ImageListSelection, Instances and EnsureCompressionVariantsExist are not supported.
+	Options
+	// Annotations to set on the created index. They are lost if the destination only accepts Docker manifest lists.
+	Annotations map[string]string
+}
+
+// Index copies the single-platform images in sources, which may use different transports, to destRef,
+// using policyContext to validate source image admissibility, and creates a multi-platform index
+// (an OCI image index or a Docker manifest list, depending on what the destination supports) referring to them.
+// It returns the index which was written to destRef.
+func Index(ctx context.Context, policyContext *signature.PolicyContext, destRef types.ImageReference, sources []IndexSource, options *IndexOptions) (copiedIndex []byte, retErr error) {
+	ctx, span := tracing.Start(ctx, "copy.Index", tracing.AttributeDestination.String(transports.ImageName(destRef)))
+	defer func() { tracing.End(span, retErr) }()
+
+	if options == nil {
+		options = &IndexOptions{}
+	}
+	if len(sources) == 0 {
+		return nil, errors.New("creating an index: no images specified")
+	}
+	if options.ImageListSelection != CopySystemImage || len(options.Instances) != 0 || len(options.EnsureCompressionVariantsExist) != 0 {
+		return nil, errors.New("ImageListSelection, Instances and EnsureCompressionVariantsExist are not supported when creating an index")
+	}
+	requireCompressionFormatMatch, err := shouldRequireCompressionFormatMatch(&options.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	reportWriter := io.Discard
+	if options.ReportWriter != nil {
+		reportWriter = options.ReportWriter
+	}
+
+	publicDest, err := destRef.NewImageDestination(ctx, options.DestinationCtx)
+	if err != nil {
+		return nil, fmt.Errorf("initializing destination %s: %w", transports.ImageName(destRef), err)
+	}
+	dest := imagedestination.FromPublic(publicDest)
+	defer func() {
+		if err := dest.Close(); err != nil {
+			if retErr != nil {
+				retErr = fmt.Errorf(" (dest: %v): %w", err, retErr)
+			} else {
+				retErr = fmt.Errorf(" (dest: %v)", err)
+			}
+		}
+	}()
+	if !supportsMultipleImages(dest) {
+		return nil, fmt.Errorf("creating an index: destination transport %q does not support copying multiple images as a group", destRef.Transport().Name())
+	}
+	// The index is created by us, so a digest in the destination reference can't possibly match it.
+	if named := dest.Reference().DockerReference(); named != nil {
+		if _, ok := named.(reference.Digested); ok {
+			return nil, errors.New("creating an index: the destination reference must not specify a digest")
+		}
+	}
+
+	// See the comments in Image() about the choices made here.
+	progressOutput := reportWriter
+	if !isTTY(reportWriter) {
+		progressOutput = io.Discard
+	}
+	c := &copier{
+		policyContext: policyContext,
+		dest:          dest,
+		options:       &options.Options,
+
+		reportWriter:   reportWriter,
+		progressOutput: progressOutput,
+		logger:         copyLogger(&options.Options),
+		metrics:        copyMetrics(&options.Options),
+
+		blobInfoCache: internalblobinfocache.FromBlobInfoCache(blobinfocache.DefaultCache(options.DestinationCtx)),
+	}
+	defer c.close()
+	c.blobInfoCache.Open()
+	defer c.blobInfoCache.Close()
+
+	if err := c.setupSigners(); err != nil {
+		return nil, err
+	}
+
+	instanceEdits := []internalManifest.ListEdit{}
+	for i, source := range sources {
+		c.Printf("Copying image %s (%d/%d)\n", transports.ImageName(source.Reference), i+1, len(sources))
+		edit, err := c.copyIndexInstance(ctx, source, requireCompressionFormatMatch)
+		if err != nil {
+			return nil, fmt.Errorf("copying image %d/%d (%s): %w", i+1, len(sources), transports.ImageName(source.Reference), err)
+		}
+		instanceEdits = append(instanceEdits, edit)
+	}
+	index := internalManifest.OCI1IndexFromComponents(nil, options.Annotations)
+	if err := index.EditInstances(instanceEdits); err != nil {
+		return nil, fmt.Errorf("creating index: %w", err)
+	}
+
+	selectedListType, otherListTypeCandidates, err := c.determineListConversion(index.MIMEType(), dest.SupportedManifestMIMETypes(), forcedListMIMEType(options.ForceManifestMIMEType))
+	if err != nil {
+		return nil, fmt.Errorf("determining index type to write to destination: %w", err)
+	}
+	c.Printf("Writing index to image destination\n")
+	var errs []string
+	for _, thisListType := range append([]string{selectedListType}, otherListTypeCandidates...) {
+		c.logger.Debugf("Trying to use manifest list type %s…", thisListType)
+		list, err := index.ConvertToMIMEType(thisListType)
+		if err != nil {
+			return nil, fmt.Errorf("converting index to list with MIME type %q: %w", thisListType, err)
+		}
+		listBlob, err := list.Serialize()
+		if err != nil {
+			return nil, fmt.Errorf("encoding index: %w", err)
+		}
+		if err := dest.PutManifest(ctx, listBlob, nil); err != nil {
+			c.logger.Debugf("Upload of manifest list type %s failed: %v", thisListType, err)
+			errs = append(errs, fmt.Sprintf("%s(%v)", thisListType, err))
+			continue
+		}
+		errs = nil
+		copiedIndex = listBlob
+		break
+	}
+	if errs != nil {
+		return nil, fmt.Errorf("Uploading index failed, attempted the following formats: %s", strings.Join(errs, ", "))
+	}
+
+	sigs, err := c.createSignatures(ctx, copiedIndex, options.SignIdentity)
+	if err != nil {
+		return nil, err
+	}
+	if len(sigs) > 0 {
+		c.Printf("Storing index signatures\n")
+		if err := dest.PutSignaturesWithFormat(ctx, sigs, nil); err != nil {
+			return nil, fmt.Errorf("writing signatures: %w", err)
+		}
+	}
+
+	if err := dest.Commit(ctx, &assembledIndex{ref: destRef, manifest: copiedIndex}); err != nil {
+		return nil, fmt.Errorf("committing the finished image: %w", err)
+	}
+	return copiedIndex, nil
+}
+
+// copyIndexInstance copies the image from source to c.dest, as an instance of an index being created by Index,
+// and returns an edit adding it to the index.
+func (c *copier) copyIndexInstance(ctx context.Context, source IndexSource, requireCompressionFormatMatch bool) (edit internalManifest.ListEdit, retErr error) {
+	ctx, span := tracing.Start(ctx, "copy.IndexInstance", tracing.AttributeSource.String(transports.ImageName(source.Reference)))
+	defer func() { tracing.End(span, retErr) }()
+
+	publicRawSource, err := source.Reference.NewImageSource(ctx, c.options.SourceCtx)
+	if err != nil {
+		return internalManifest.ListEdit{}, fmt.Errorf("initializing source %s: %w", transports.ImageName(source.Reference), err)
+	}
+	rawSource := imagesource.FromPublic(publicRawSource)
+	defer func() {
+		if err := rawSource.Close(); err != nil {
+			if retErr != nil {
+				retErr = fmt.Errorf(" (src: %v): %w", err, retErr)
+			} else {
+				retErr = fmt.Errorf(" (src: %v)", err)
+			}
+		}
+	}()
+	c.rawSource = rawSource
+	c.unparsedToplevel = image.UnparsedInstance(rawSource, nil)
+	defer func() {
+		c.rawSource = nil
+		c.unparsedToplevel = nil
+	}()
+	releaseSemaphore, err := c.setupConcurrentBlobCopiesSemaphore(ctx)
+	if err != nil {
+		return internalManifest.ListEdit{}, err
+	}
+	defer releaseSemaphore()
+
+	srcManifest, _, err := c.resolveManifest(ctx, c.unparsedToplevel)
+	if err != nil {
+		return internalManifest.ListEdit{}, fmt.Errorf("reading manifest: %w", err)
+	}
+	// copySingleImage only uses the value to decide whether it is copying an instance of a list; it records the
+	// digest of the created manifest instead.
+	srcManifestDigest, err := manifest.Digest(srcManifest)
+	if err != nil {
+		return internalManifest.ListEdit{}, fmt.Errorf("computing manifest digest: %w", err)
+	}
+	copied, err := c.copySingleImage(ctx, c.unparsedToplevel, &srcManifestDigest, copySingleImageOptions{requireCompressionFormatMatch: requireCompressionFormatMatch})
+	if err != nil {
+		return internalManifest.ListEdit{}, err
+	}
+
+	platform := source.Platform
+	if platform == nil {
+		// This happens after copySingleImage has checked the image against the policy.
+		platform, err = imagePlatform(ctx, c.options.SourceCtx, c.unparsedToplevel)
+		if err != nil {
+			return internalManifest.ListEdit{}, err
+		}
+	}
+	var annotations map[string]string
+	if copied.manifestMIMEType == imgspecv1.MediaTypeImageManifest {
+		m, err := manifest.OCI1FromManifest(copied.manifest)
+		if err != nil {
+			return internalManifest.ListEdit{}, fmt.Errorf("parsing copied manifest: %w", err)
+		}
+		annotations = maps.Clone(m.Annotations)
+	}
+	if len(source.Annotations) != 0 {
+		if annotations == nil {
+			annotations = map[string]string{}
+		}
+		maps.Copy(annotations, source.Annotations)
+	}
+	return internalManifest.ListEdit{
+		ListOperation:            internalManifest.ListOpAdd,
+		AddDigest:                copied.manifestDigest,
+		AddSize:                  int64(len(copied.manifest)),
+		AddMediaType:             copied.manifestMIMEType,
+		AddPlatform:              platform,
+		AddAnnotations:           annotations,
+		AddCompressionAlgorithms: copied.compressionAlgorithms,
+	}, nil
+}
+
+// imagePlatform returns the platform of unparsedImage, as recorded in its configuration.
+func imagePlatform(ctx context.Context, sys *types.SystemContext, unparsedImage *image.UnparsedImage) (*imgspecv1.Platform, error) {
+	img, err := image.FromUnparsedImage(ctx, sys, unparsedImage)
+	if err != nil {
+		return nil, fmt.Errorf("initializing image: %w", err)
+	}
+	config, err := img.OCIConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("reading image configuration: %w", err)
+	}
+	if config.OS == "" || config.Architecture == "" {
+		return nil, errors.New("the image configuration does not specify a platform")
+	}
+	return &imgspecv1.Platform{
+		Architecture: config.Architecture,
+		OS:           config.OS,
+		OSVersion:    config.OSVersion,
+		OSFeatures:   slices.Clone(config.OSFeatures),
+		Variant:      config.Variant,
+	}, nil
+}
+
+// assembledIndex is a types.UnparsedImage for an index created by Index, to be passed to types.ImageDestination.Commit.
+type assembledIndex struct {
+	ref      types.ImageReference
+	manifest []byte
+}
+
+// Reference returns the reference used to set up this source, _as specified by the user_
+// (not as the image itself, or its underlying storage, claims).  This can be used e.g. to determine which public keys are trusted for this image.
+func (i *assembledIndex) Reference() types.ImageReference {
+	return i.ref
+}
+
+// Manifest is like ImageSource.GetManifest, but the result is cached; it is OK to call this however often you need.
+func (i *assembledIndex) Manifest(ctx context.Context) ([]byte, string, error) {
+	return i.manifest, manifest.GuessMIMEType(i.manifest), nil
+}
+
+// Signatures is like ImageSource.GetSignatures, but the result is cached; it is OK to call this however often you need.
+func (i *assembledIndex) Signatures(ctx context.Context) ([][]byte, error) {
+	return nil, nil
+}
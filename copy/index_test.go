@@ -0,0 +1,157 @@
+package copy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/internal/imagedestination"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspec "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newIndexTestImage creates a single-layer OCI image for architecture in a new dir: directory, and returns a reference to it.
+func newIndexTestImage(t *testing.T, architecture string, annotations map[string]string) types.ImageReference {
+	ctx := context.Background()
+	layer, err := os.ReadFile("fixtures/Hello.gz")
+	require.NoError(t, err)
+	uncompressed, err := os.ReadFile("fixtures/Hello.uncompressed")
+	require.NoError(t, err)
+	config, err := json.Marshal(imgspecv1.Image{
+		Platform: imgspecv1.Platform{Architecture: architecture, OS: "linux"},
+		RootFS:   imgspecv1.RootFS{Type: "layers", DiffIDs: []digest.Digest{digest.FromBytes(uncompressed)}},
+	})
+	require.NoError(t, err)
+
+	ref, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	publicDest, err := ref.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	dest := imagedestination.FromPublic(publicDest)
+	defer dest.Close()
+	descriptors := []imgspecv1.Descriptor{}
+	for _, blob := range []struct {
+		contents  []byte
+		mediaType string
+		isConfig  bool
+	}{
+		{config, imgspecv1.MediaTypeImageConfig, true},
+		{layer, imgspecv1.MediaTypeImageLayerGzip, false},
+	} {
+		info, err := dest.PutBlob(ctx, bytes.NewReader(blob.contents), types.BlobInfo{Digest: digest.FromBytes(blob.contents), Size: int64(len(blob.contents))}, none.NoCache, blob.isConfig)
+		require.NoError(t, err)
+		descriptors = append(descriptors, imgspecv1.Descriptor{MediaType: blob.mediaType, Digest: info.Digest, Size: info.Size})
+	}
+	manifestBlob, err := json.Marshal(imgspecv1.Manifest{
+		Versioned:   imgspec.Versioned{SchemaVersion: 2},
+		MediaType:   imgspecv1.MediaTypeImageManifest,
+		Config:      descriptors[0],
+		Layers:      descriptors[1:],
+		Annotations: annotations,
+	})
+	require.NoError(t, err)
+	err = dest.PutManifest(ctx, manifestBlob, nil)
+	require.NoError(t, err)
+	err = dest.PutSignatures(ctx, nil, nil)
+	require.NoError(t, err)
+	err = dest.Commit(ctx, nil)
+	require.NoError(t, err)
+	return ref
+}
+
+func TestIndex(t *testing.T) {
+	ctx := context.Background()
+	policyContext, err := signature.NewPolicyContext(&signature.Policy{
+		Default: []signature.PolicyRequirement{signature.NewPRInsecureAcceptAnything()},
+	})
+	require.NoError(t, err)
+	defer func() {
+		err := policyContext.Destroy()
+		require.NoError(t, err)
+	}()
+
+	amd64 := newIndexTestImage(t, "amd64", map[string]string{"a": "manifest", "b": "manifest"})
+	arm64 := newIndexTestImage(t, "arm64", nil)
+	destRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	overriddenPlatform := &imgspecv1.Platform{Architecture: "arm64", OS: "linux", Variant: "v8"}
+	res, err := Index(ctx, policyContext, destRef, []IndexSource{
+		{Reference: amd64, Annotations: map[string]string{"b": "source", "c": "source"}},
+		{Reference: arm64, Platform: overriddenPlatform},
+	}, &IndexOptions{Annotations: map[string]string{"index": "value"}})
+	require.NoError(t, err)
+
+	index, err := manifest.OCI1IndexFromManifest(res)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"index": "value"}, index.Annotations)
+	require.Len(t, index.Manifests, 2)
+	assert.Equal(t, &imgspecv1.Platform{Architecture: "amd64", OS: "linux"}, index.Manifests[0].Platform)
+	assert.Equal(t, "manifest", index.Manifests[0].Annotations["a"])
+	assert.Equal(t, "source", index.Manifests[0].Annotations["b"])
+	assert.Equal(t, "source", index.Manifests[0].Annotations["c"])
+	assert.Equal(t, overriddenPlatform, index.Manifests[1].Platform)
+
+	src, err := destRef.NewImageSource(ctx, nil)
+	require.NoError(t, err)
+	defer src.Close()
+	toplevel, mimeType, err := src.GetManifest(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, res, toplevel)
+	assert.Equal(t, imgspecv1.MediaTypeImageIndex, manifest.NormalizedMIMEType(mimeType))
+	for _, instance := range index.Manifests {
+		instanceManifest, _, err := src.GetManifest(ctx, &instance.Digest)
+		require.NoError(t, err)
+		matches, err := manifest.MatchesDigest(instanceManifest, instance.Digest)
+		require.NoError(t, err)
+		assert.True(t, matches)
+	}
+
+	// Docker manifest lists are created if requested
+	destRef, err = directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	res, err = Index(ctx, policyContext, destRef, []IndexSource{{Reference: amd64}, {Reference: arm64}},
+		&IndexOptions{Options: Options{ForceManifestMIMEType: manifest.DockerV2Schema2MediaType}})
+	require.NoError(t, err)
+	list, err := manifest.Schema2ListFromManifest(res)
+	require.NoError(t, err)
+	require.Len(t, list.Manifests, 2)
+	assert.Equal(t, manifest.DockerV2Schema2MediaType, list.Manifests[0].MediaType)
+	assert.Equal(t, "amd64", list.Manifests[0].Platform.Architecture)
+	assert.Equal(t, "arm64", list.Manifests[1].Platform.Architecture)
+
+	// Invalid inputs
+	for _, c := range []struct {
+		sources []IndexSource
+		options *IndexOptions
+	}{
+		{nil, nil},
+		{[]IndexSource{{Reference: amd64}}, &IndexOptions{Options: Options{ImageListSelection: CopyAllImages}}},
+		{[]IndexSource{{Reference: amd64}}, &IndexOptions{Options: Options{Instances: []digest.Digest{""}}}},
+	} {
+		_, err := Index(ctx, policyContext, destRef, c.sources, c.options)
+		assert.Error(t, err)
+	}
+}
+
+func TestForcedListMIMEType(t *testing.T) {
+	for _, c := range []struct{ input, expected string }{
+		{"", ""},
+		{manifest.DockerV2Schema1SignedMediaType, manifest.DockerV2ListMediaType},
+		{manifest.DockerV2Schema2MediaType, manifest.DockerV2ListMediaType},
+		{manifest.DockerV2ListMediaType, manifest.DockerV2ListMediaType},
+		{imgspecv1.MediaTypeImageManifest, imgspecv1.MediaTypeImageIndex},
+		{imgspecv1.MediaTypeImageIndex, imgspecv1.MediaTypeImageIndex},
+	} {
+		assert.Equal(t, c.expected, forcedListMIMEType(c.input), c.input)
+	}
+}
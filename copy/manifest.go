@@ -12,7 +12,6 @@ import (
 	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
 	"github.com/containers/image/v5/types"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
-	"github.com/sirupsen/logrus"
 	"golang.org/x/exp/slices"
 )
 
@@ -24,6 +23,11 @@ var preferredManifestMIMETypes = []string{manifest.DockerV2Schema2MediaType, man
 // allManifestMIMETypes lists all possible manifest MIME types.
 var allManifestMIMETypes = []string{v1.MediaTypeImageManifest, manifest.DockerV2Schema2MediaType, manifest.DockerV2Schema1SignedMediaType, manifest.DockerV2Schema1MediaType}
 
+// isSchema1MIMEType returns true if mimeType is one of the deprecated Docker schema1 MIME types.
+func isSchema1MIMEType(mimeType string) bool {
+	return mimeType == manifest.DockerV2Schema1SignedMediaType || mimeType == manifest.DockerV2Schema1MediaType
+}
+
 // orderedSet is a list of strings (MIME types or platform descriptors in our case), with each string appearing at most once.
 type orderedSet struct {
 	list     []string
@@ -57,6 +61,10 @@ type determineManifestConversionInputs struct {
 	requestedCompressionFormat *compressiontypes.Algorithm // Compression algorithm to use, if the user _explictily_ requested one.
 	requiresOCIEncryption      bool                        // Restrict to manifest formats that can support OCI encryption
 	cannotModifyManifestReason string                      // The reason the manifest cannot be modified, or an empty string if it can
+	refuseSchema1              bool                        // Do not write deprecated Docker schema1 manifests, converting schema1 sources if necessary
+	// Compression algorithms used by the source layers; formats which can't represent them are only used if there is no other option,
+	// and require recompressing the affected layers.
+	srcLayerCompressionAlgorithms []compressiontypes.Algorithm
 }
 
 // manifestConversionPlan contains the decisions made by determineManifestConversion.
@@ -67,25 +75,43 @@ type manifestConversionPlan struct {
 	preferredMIMEType                string
 	preferredMIMETypeNeedsConversion bool     // True if using preferredMIMEType requires a conversion step.
 	otherMIMETypeCandidates          []string // Other possible alternatives, in order
+	// Names of the source layer compression algorithms which preferredMIMEType can't represent, if any;
+	// layers compressed using them must be recompressed when using preferredMIMEType.
+	preferredMIMETypeCompressionLoss []string
 }
 
-// determineManifestConversion returns a plan for what formats, and possibly conversions, to use based on in.
-func determineManifestConversion(in determineManifestConversionInputs) (manifestConversionPlan, error) {
+// compressionLoss returns names of algorithms in srcLayerCompressionAlgorithms which can't be represented in mimeType.
+func compressionLoss(mimeType string, srcLayerCompressionAlgorithms []compressiontypes.Algorithm) []string {
+	res := []string{}
+	for _, algo := range srcLayerCompressionAlgorithms {
+		if !internalManifest.MIMETypeSupportsCompressionAlgorithm(mimeType, algo) {
+			res = append(res, algo.Name())
+		}
+	}
+	return res
+}
+
+// determineManifestConversion returns a plan for what formats, and possibly conversions, to use based on in, logging using logger.
+func determineManifestConversion(logger types.Logger, in determineManifestConversionInputs) (manifestConversionPlan, error) {
 	srcType := in.srcMIMEType
 	normalizedSrcType := manifest.NormalizedMIMEType(srcType)
 	if srcType != normalizedSrcType {
-		logrus.Debugf("Source manifest MIME type %s, treating it as %s", srcType, normalizedSrcType)
+		logger.Debugf("Source manifest MIME type %s, treating it as %s", srcType, normalizedSrcType)
 		srcType = normalizedSrcType
 	}
 
 	destSupportedManifestMIMETypes := in.destSupportedManifestMIMETypes
 	if in.forceManifestMIMEType != "" {
+		if in.refuseSchema1 && isSchema1MIMEType(in.forceManifestMIMEType) {
+			return manifestConversionPlan{}, fmt.Errorf("format %s required, but writing deprecated Docker schema1 manifests is not enabled", in.forceManifestMIMEType)
+		}
 		destSupportedManifestMIMETypes = []string{in.forceManifestMIMEType}
 	}
 
 	restrictiveCompressionRequired := in.requestedCompressionFormat != nil && !internalManifest.CompressionAlgorithmIsUniversallySupported(*in.requestedCompressionFormat)
 	if len(destSupportedManifestMIMETypes) == 0 {
 		if (!in.requiresOCIEncryption || manifest.MIMETypeSupportsEncryption(srcType)) &&
+			(!in.refuseSchema1 || !isSchema1MIMEType(srcType)) &&
 			(!restrictiveCompressionRequired || internalManifest.MIMETypeSupportsCompressionAlgorithm(srcType, *in.requestedCompressionFormat)) {
 			return manifestConversionPlan{ // Anything goes; just use the original as is, do not try any conversions.
 				preferredMIMEType:       srcType,
@@ -99,6 +125,9 @@ func determineManifestConversion(in determineManifestConversionInputs) (manifest
 		if in.requiresOCIEncryption && !manifest.MIMETypeSupportsEncryption(t) {
 			continue
 		}
+		if in.refuseSchema1 && isSchema1MIMEType(t) {
+			continue
+		}
 		if restrictiveCompressionRequired && !internalManifest.MIMETypeSupportsCompressionAlgorithm(t, *in.requestedCompressionFormat) {
 			continue
 		}
@@ -148,8 +177,11 @@ func determineManifestConversion(in determineManifestConversionInputs) (manifest
 		case restrictiveCompressionRequired:
 			return manifestConversionPlan{}, fmt.Errorf("compression using %s required but the destination only supports MIME types [%s], none of which support it",
 				in.requestedCompressionFormat.Name(), destMIMEList)
-		default: // Coverage: This should never happen, we only filter for in.requiresOCIEncryption || restrictiveCompressionRequired
-			return manifestConversionPlan{}, errors.New("internal error: supportedByDest is empty but destSupportedManifestMIMETypes is not, and we are neither encrypting nor requiring a restrictive compression algorithm")
+		case in.refuseSchema1:
+			return manifestConversionPlan{}, fmt.Errorf("the destination only supports MIME types [%s], but writing deprecated Docker schema1 manifests is not enabled",
+				destMIMEList)
+		default: // Coverage: This should never happen, we only filter for in.requiresOCIEncryption || restrictiveCompressionRequired || in.refuseSchema1
+			return manifestConversionPlan{}, errors.New("internal error: supportedByDest is empty but destSupportedManifestMIMETypes is not, and we are neither encrypting, nor requiring a restrictive compression algorithm, nor refusing schema1")
 		}
 	}
 
@@ -166,11 +198,14 @@ func determineManifestConversion(in determineManifestConversionInputs) (manifest
 		prioritizedTypes.append(srcType)
 	}
 	if in.cannotModifyManifestReason != "" {
+		if in.refuseSchema1 && isSchema1MIMEType(srcType) {
+			return manifestConversionPlan{}, fmt.Errorf("writing deprecated Docker schema1 manifests is not enabled, and the manifest can't be converted: %s", in.cannotModifyManifestReason)
+		}
 		// We could also drop this check and have the caller
 		// make the choice; it is already doing that to an extent, to improve error
 		// messages.  But it is nice to hide the “if we can't modify, do no conversion”
 		// special case in here; the caller can then worry (or not) only about a good UI.
-		logrus.Debugf("We can't modify the manifest, hoping for the best...")
+		logger.Debugf("We can't modify the manifest, hoping for the best...")
 		return manifestConversionPlan{ // Take our chances - FIXME? Or should we fail without trying?
 			preferredMIMEType:       srcType,
 			otherMIMETypeCandidates: []string{},
@@ -191,17 +226,38 @@ func determineManifestConversion(in determineManifestConversionInputs) (manifest
 		}
 	}
 
-	logrus.Debugf("Manifest has MIME type %s, ordered candidate list [%s]", srcType, strings.Join(prioritizedTypes.list, ", "))
-	if len(prioritizedTypes.list) == 0 { // Coverage: destSupportedManifestMIMETypes and supportedByDest, which is a subset, is not empty (or we would have exited above), so this should never happen.
+	candidates := prioritizedTypes.list
+	// If an explicit compression is requested, all layers are going to be recompressed anyway; otherwise,
+	// prefer formats which can represent the compression of the source layers.
+	if in.requestedCompressionFormat == nil && len(in.srcLayerCompressionAlgorithms) != 0 {
+		preserving := []string{}
+		losing := []string{}
+		for _, t := range candidates {
+			if len(compressionLoss(t, in.srcLayerCompressionAlgorithms)) == 0 {
+				preserving = append(preserving, t)
+			} else {
+				losing = append(losing, t)
+			}
+		}
+		candidates = append(preserving, losing...)
+	}
+
+	logger.Debugf("Manifest has MIME type %s, ordered candidate list [%s]", srcType, strings.Join(candidates, ", "))
+	if len(candidates) == 0 { // Coverage: destSupportedManifestMIMETypes and supportedByDest, which is a subset, is not empty (or we would have exited above), so this should never happen.
 		return manifestConversionPlan{}, errors.New("Internal error: no candidate MIME types")
 	}
 	res := manifestConversionPlan{
-		preferredMIMEType:       prioritizedTypes.list[0],
-		otherMIMETypeCandidates: prioritizedTypes.list[1:],
+		preferredMIMEType:       candidates[0],
+		otherMIMETypeCandidates: candidates[1:],
+	}
+	if in.requestedCompressionFormat == nil {
+		if loss := compressionLoss(res.preferredMIMEType, in.srcLayerCompressionAlgorithms); len(loss) != 0 {
+			res.preferredMIMETypeCompressionLoss = loss
+		}
 	}
 	res.preferredMIMETypeNeedsConversion = res.preferredMIMEType != srcType
 	if !res.preferredMIMETypeNeedsConversion {
-		logrus.Debugf("... will first try using the original manifest unmodified")
+		logger.Debugf("... will first try using the original manifest unmodified")
 	}
 	return res, nil
 }
@@ -244,16 +300,16 @@ func (c *copier) determineListConversion(currentListMIMEType string, destSupport
 		}
 	}
 
-	logrus.Debugf("Manifest list has MIME type %s, ordered candidate list [%s]", currentListMIMEType, strings.Join(destSupportedMIMETypes, ", "))
+	c.logger.Debugf("Manifest list has MIME type %s, ordered candidate list [%s]", currentListMIMEType, strings.Join(destSupportedMIMETypes, ", "))
 	if len(prioritizedTypes.list) == 0 {
 		return "", nil, fmt.Errorf("destination does not support any supported manifest list types (%v)", manifest.SupportedListMIMETypes)
 	}
 	selectedType := prioritizedTypes.list[0]
 	otherSupportedTypes := prioritizedTypes.list[1:]
 	if selectedType != currentListMIMEType {
-		logrus.Debugf("... will convert to %s first, and then try %v", selectedType, otherSupportedTypes)
+		c.logger.Debugf("... will convert to %s first, and then try %v", selectedType, otherSupportedTypes)
 	} else {
-		logrus.Debugf("... will use the original manifest list type, and then try %v", otherSupportedTypes)
+		c.logger.Debugf("... will use the original manifest list type, and then try %v", otherSupportedTypes)
 	}
 	// Done.
 	return selectedType, otherSupportedTypes, nil
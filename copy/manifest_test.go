@@ -9,6 +9,8 @@ import (
 	"github.com/containers/image/v5/internal/testing/mocks"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/compression"
+	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
+	"github.com/containers/image/v5/pkg/logging"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -172,7 +174,7 @@ func TestDetermineManifestConversion(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		res, err := determineManifestConversion(determineManifestConversionInputs{
+		res, err := determineManifestConversion(logging.Discard(), determineManifestConversionInputs{
 			srcMIMEType:                    c.sourceType,
 			destSupportedManifestMIMETypes: c.destTypes,
 			forceManifestMIMEType:          "",
@@ -185,7 +187,7 @@ func TestDetermineManifestConversion(t *testing.T) {
 
 	// Whatever the input is, with cannotModifyManifestReason we return "keep the original as is"
 	for _, c := range cases {
-		res, err := determineManifestConversion(determineManifestConversionInputs{
+		res, err := determineManifestConversion(logging.Discard(), determineManifestConversionInputs{
 			srcMIMEType:                    c.sourceType,
 			destSupportedManifestMIMETypes: c.destTypes,
 			forceManifestMIMEType:          "",
@@ -202,7 +204,7 @@ func TestDetermineManifestConversion(t *testing.T) {
 
 	// With forceManifestMIMEType, the output is always the forced manifest type (in this case oci manifest)
 	for _, c := range cases {
-		res, err := determineManifestConversion(determineManifestConversionInputs{
+		res, err := determineManifestConversion(logging.Discard(), determineManifestConversionInputs{
 			srcMIMEType:                    c.sourceType,
 			destSupportedManifestMIMETypes: c.destTypes,
 			forceManifestMIMEType:          v1.MediaTypeImageManifest,
@@ -399,7 +401,7 @@ func TestDetermineManifestConversion(t *testing.T) {
 
 			in := c.in
 			restriction.edit(&in)
-			res, err := determineManifestConversion(in)
+			res, err := determineManifestConversion(logging.Discard(), in)
 			if c.expected.preferredMIMEType != "" {
 				require.NoError(t, err, desc)
 				assert.Equal(t, c.expected, res, desc)
@@ -510,9 +512,209 @@ func TestDetermineManifestConversion(t *testing.T) {
 	} {
 		in := c.in
 		in.requestedCompressionFormat = &compression.Xz
-		_, err := determineManifestConversion(in)
+		_, err := determineManifestConversion(logging.Discard(), in)
 		assert.Error(t, err, c.description)
 	}
+
+	// When writing schema1 is refused, schema1 is never chosen, and schema1 sources are converted
+	for _, c := range []struct {
+		description string
+		in          determineManifestConversionInputs // with refuseSchema1 implied
+		expected    manifestConversionPlan            // Or {} to expect a failure
+	}{
+		{
+			"s1→anything",
+			determineManifestConversionInputs{
+				srcMIMEType:                    manifest.DockerV2Schema1SignedMediaType,
+				destSupportedManifestMIMETypes: nil,
+			},
+			manifestConversionPlan{
+				preferredMIMEType:                manifest.DockerV2Schema2MediaType,
+				preferredMIMETypeNeedsConversion: true,
+				otherMIMETypeCandidates:          []string{v1.MediaTypeImageManifest},
+			},
+		},
+		{
+			"s2→anything",
+			determineManifestConversionInputs{
+				srcMIMEType:                    manifest.DockerV2Schema2MediaType,
+				destSupportedManifestMIMETypes: nil,
+			},
+			manifestConversionPlan{
+				preferredMIMEType:                manifest.DockerV2Schema2MediaType,
+				preferredMIMETypeNeedsConversion: false,
+				otherMIMETypeCandidates:          []string{},
+			},
+		},
+		{
+			"s1→s1s2",
+			determineManifestConversionInputs{
+				srcMIMEType:                    manifest.DockerV2Schema1SignedMediaType,
+				destSupportedManifestMIMETypes: supportS1S2,
+			},
+			manifestConversionPlan{
+				preferredMIMEType:                manifest.DockerV2Schema2MediaType,
+				preferredMIMETypeNeedsConversion: true,
+				otherMIMETypeCandidates:          []string{},
+			},
+		},
+		{
+			"text→s1OCI",
+			determineManifestConversionInputs{
+				srcMIMEType:                    "text/plain",
+				destSupportedManifestMIMETypes: supportS1OCI,
+			},
+			manifestConversionPlan{
+				preferredMIMEType:                v1.MediaTypeImageManifest,
+				preferredMIMETypeNeedsConversion: true,
+				otherMIMETypeCandidates:          []string{},
+			},
+		},
+		{
+			"s2→s1",
+			determineManifestConversionInputs{
+				srcMIMEType:                    manifest.DockerV2Schema2MediaType,
+				destSupportedManifestMIMETypes: supportOnlyS1,
+			},
+			manifestConversionPlan{},
+		},
+		{
+			"s1 cannotModifyManifestReason",
+			determineManifestConversionInputs{
+				srcMIMEType:                    manifest.DockerV2Schema1SignedMediaType,
+				destSupportedManifestMIMETypes: supportS1S2OCI,
+				cannotModifyManifestReason:     "Preserving digests",
+			},
+			manifestConversionPlan{},
+		},
+		{
+			"s2 cannotModifyManifestReason",
+			determineManifestConversionInputs{
+				srcMIMEType:                    manifest.DockerV2Schema2MediaType,
+				destSupportedManifestMIMETypes: supportS1S2OCI,
+				cannotModifyManifestReason:     "Preserving digests",
+			},
+			manifestConversionPlan{
+				preferredMIMEType:                manifest.DockerV2Schema2MediaType,
+				preferredMIMETypeNeedsConversion: false,
+				otherMIMETypeCandidates:          []string{},
+			},
+		},
+		{
+			"s2→s1 forced",
+			determineManifestConversionInputs{
+				srcMIMEType:                    manifest.DockerV2Schema2MediaType,
+				destSupportedManifestMIMETypes: supportS1S2OCI,
+				forceManifestMIMEType:          manifest.DockerV2Schema1SignedMediaType,
+			},
+			manifestConversionPlan{},
+		},
+		{
+			"s1→OCI forced",
+			determineManifestConversionInputs{
+				srcMIMEType:                    manifest.DockerV2Schema1SignedMediaType,
+				destSupportedManifestMIMETypes: supportS1S2OCI,
+				forceManifestMIMEType:          v1.MediaTypeImageManifest,
+			},
+			manifestConversionPlan{
+				preferredMIMEType:                v1.MediaTypeImageManifest,
+				preferredMIMETypeNeedsConversion: true,
+				otherMIMETypeCandidates:          []string{},
+			},
+		},
+	} {
+		in := c.in
+		in.refuseSchema1 = true
+		res, err := determineManifestConversion(logging.Discard(), in)
+		if c.expected.preferredMIMEType != "" {
+			require.NoError(t, err, c.description)
+			assert.Equal(t, c.expected, res, c.description)
+		} else {
+			assert.Error(t, err, c.description)
+		}
+	}
+
+	// Source layers using zstd
+	zstdLayers := []compressiontypes.Algorithm{compression.Gzip, compression.Zstd}
+	for _, c := range []struct {
+		description string
+		in          determineManifestConversionInputs
+		expected    manifestConversionPlan
+	}{
+		{
+			"OCI zstd→anything",
+			determineManifestConversionInputs{
+				srcMIMEType:                    v1.MediaTypeImageManifest,
+				destSupportedManifestMIMETypes: nil,
+				srcLayerCompressionAlgorithms:  zstdLayers,
+			},
+			manifestConversionPlan{
+				preferredMIMEType:                v1.MediaTypeImageManifest,
+				preferredMIMETypeNeedsConversion: false,
+				otherMIMETypeCandidates:          []string{},
+			},
+		},
+		{
+			"OCI zstd→s2OCI",
+			determineManifestConversionInputs{
+				srcMIMEType:                    v1.MediaTypeImageManifest,
+				destSupportedManifestMIMETypes: []string{manifest.DockerV2Schema2MediaType, v1.MediaTypeImageManifest},
+				srcLayerCompressionAlgorithms:  zstdLayers,
+			},
+			manifestConversionPlan{
+				preferredMIMEType:                v1.MediaTypeImageManifest,
+				preferredMIMETypeNeedsConversion: false,
+				otherMIMETypeCandidates:          []string{manifest.DockerV2Schema2MediaType},
+			},
+		},
+		{
+			"s2→s2OCI, with zstd layers (not really possible)", // OCI, which can represent zstd, is preferred to s2
+			determineManifestConversionInputs{
+				srcMIMEType:                    manifest.DockerV2Schema2MediaType,
+				destSupportedManifestMIMETypes: []string{manifest.DockerV2Schema2MediaType, v1.MediaTypeImageManifest},
+				srcLayerCompressionAlgorithms:  zstdLayers,
+			},
+			manifestConversionPlan{
+				preferredMIMEType:                v1.MediaTypeImageManifest,
+				preferredMIMETypeNeedsConversion: true,
+				otherMIMETypeCandidates:          []string{manifest.DockerV2Schema2MediaType},
+			},
+		},
+		{
+			"OCI zstd→s2",
+			determineManifestConversionInputs{
+				srcMIMEType:                    v1.MediaTypeImageManifest,
+				destSupportedManifestMIMETypes: []string{manifest.DockerV2Schema2MediaType},
+				srcLayerCompressionAlgorithms:  zstdLayers,
+			},
+			manifestConversionPlan{
+				preferredMIMEType:                manifest.DockerV2Schema2MediaType,
+				preferredMIMETypeNeedsConversion: true,
+				otherMIMETypeCandidates:          []string{},
+				preferredMIMETypeCompressionLoss: []string{compressiontypes.ZstdAlgorithmName},
+			},
+		},
+		{
+			"OCI zstd→s2 with explicitly requested gzip",
+			determineManifestConversionInputs{
+				srcMIMEType:                    v1.MediaTypeImageManifest,
+				destSupportedManifestMIMETypes: []string{manifest.DockerV2Schema2MediaType},
+				requestedCompressionFormat:     &compression.Gzip,
+				srcLayerCompressionAlgorithms:  zstdLayers,
+			},
+			manifestConversionPlan{
+				preferredMIMEType:                manifest.DockerV2Schema2MediaType,
+				preferredMIMETypeNeedsConversion: true,
+				otherMIMETypeCandidates:          []string{},
+			},
+		},
+	} {
+		in := c.in
+		in.refuseSchema1 = true
+		res, err := determineManifestConversion(logging.Discard(), in)
+		require.NoError(t, err, c.description)
+		assert.Equal(t, c.expected, res, c.description)
+	}
 }
 
 // fakeUnparsedImage is an implementation of types.UnparsedImage which only returns itself as a MIME type in Manifest,
@@ -597,7 +799,7 @@ func TestDetermineManifestListConversion(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		copier := &copier{}
+		copier := &copier{logger: logging.Discard()}
 		preferredMIMEType, otherCandidates, err := copier.determineListConversion(c.sourceType, c.destTypes, "")
 		require.NoError(t, err, c.description)
 		if c.expectedUpdate == "" {
@@ -610,7 +812,7 @@ func TestDetermineManifestListConversion(t *testing.T) {
 
 	// With forceManifestMIMEType, the output is always the forced manifest type (in this case OCI index)
 	for _, c := range cases {
-		copier := &copier{}
+		copier := &copier{logger: logging.Discard()}
 		preferredMIMEType, otherCandidates, err := copier.determineListConversion(c.sourceType, c.destTypes, v1.MediaTypeImageIndex)
 		require.NoError(t, err, c.description)
 		assert.Equal(t, v1.MediaTypeImageIndex, preferredMIMEType, c.description)
@@ -618,7 +820,7 @@ func TestDetermineManifestListConversion(t *testing.T) {
 	}
 
 	// The destination doesn’t support list formats at all
-	copier := &copier{}
+	copier := &copier{logger: logging.Discard()}
 	_, _, err := copier.determineListConversion(v1.MediaTypeImageIndex, supportOnlyS1, "")
 	assert.Error(t, err)
 }
@@ -16,7 +16,6 @@ import (
 	"github.com/containers/image/v5/pkg/compression"
 	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
-	"github.com/sirupsen/logrus"
 	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
 )
@@ -119,7 +118,7 @@ func prepareInstanceCopies(list internalManifest.List, instanceDigests []digest.
 	for i, instanceDigest := range instanceDigests {
 		if options.ImageListSelection == CopySpecificImages &&
 			!slices.Contains(options.Instances, instanceDigest) {
-			logrus.Debugf("Skipping instance %s (%d/%d)", instanceDigest, i+1, len(instanceDigests))
+			copyLogger(options).Debugf("Skipping instance %s (%d/%d)", instanceDigest, i+1, len(instanceDigests))
 			continue
 		}
 		instanceDetails, err := list.Instance(instanceDigest)
@@ -154,6 +153,17 @@ func prepareInstanceCopies(list internalManifest.List, instanceDigests []digest.
 	return res, nil
 }
 
+// forcedListMIMEType returns the list MIME type corresponding to forcedManifestMIMEType, a value of Options.ForceManifestMIMEType.
+func forcedListMIMEType(forcedManifestMIMEType string) string {
+	switch forcedManifestMIMEType {
+	case manifest.DockerV2Schema1MediaType, manifest.DockerV2Schema1SignedMediaType, manifest.DockerV2Schema2MediaType:
+		return manifest.DockerV2ListMediaType
+	case imgspecv1.MediaTypeImageManifest:
+		return imgspecv1.MediaTypeImageIndex
+	}
+	return forcedManifestMIMEType
+}
+
 // copyMultipleImages copies some or all of an image list's instances, using
 // c.policyContext to validate source image admissibility.
 func (c *copier) copyMultipleImages(ctx context.Context) (copiedManifest []byte, retErr error) {
@@ -206,14 +216,7 @@ func (c *copier) copyMultipleImages(ctx context.Context) (copiedManifest []byte,
 	}
 
 	// Determine if we'll need to convert the manifest list to a different format.
-	forceListMIMEType := c.options.ForceManifestMIMEType
-	switch forceListMIMEType {
-	case manifest.DockerV2Schema1MediaType, manifest.DockerV2Schema1SignedMediaType, manifest.DockerV2Schema2MediaType:
-		forceListMIMEType = manifest.DockerV2ListMediaType
-	case imgspecv1.MediaTypeImageManifest:
-		forceListMIMEType = imgspecv1.MediaTypeImageIndex
-	}
-	selectedListType, otherManifestMIMETypeCandidates, err := c.determineListConversion(manifestType, c.dest.SupportedManifestMIMETypes(), forceListMIMEType)
+	selectedListType, otherManifestMIMETypeCandidates, err := c.determineListConversion(manifestType, c.dest.SupportedManifestMIMETypes(), forcedListMIMEType(c.options.ForceManifestMIMEType))
 	if err != nil {
 		return nil, fmt.Errorf("determining manifest list type to write to destination: %w", err)
 	}
@@ -236,7 +239,7 @@ func (c *copier) copyMultipleImages(ctx context.Context) (copiedManifest []byte,
 		// populate necessary fields.
 		switch instance.op {
 		case instanceCopyCopy:
-			logrus.Debugf("Copying instance %s (%d/%d)", instance.sourceDigest, i+1, len(instanceCopyList))
+			c.logger.Debugf("Copying instance %s (%d/%d)", instance.sourceDigest, i+1, len(instanceCopyList))
 			c.Printf("Copying image %s (%d/%d)\n", instance.sourceDigest, i+1, len(instanceCopyList))
 			unparsedInstance := image.UnparsedInstance(c.rawSource, &instanceCopyList[i].sourceDigest)
 			updated, err := c.copySingleImage(ctx, unparsedInstance, &instanceCopyList[i].sourceDigest, copySingleImageOptions{requireCompressionFormatMatch: instance.copyForceCompressionFormat})
@@ -252,7 +255,7 @@ func (c *copier) copyMultipleImages(ctx context.Context) (copiedManifest []byte,
 				UpdateCompressionAlgorithms: updated.compressionAlgorithms,
 				UpdateMediaType:             updated.manifestMIMEType})
 		case instanceCopyClone:
-			logrus.Debugf("Replicating instance %s (%d/%d)", instance.sourceDigest, i+1, len(instanceCopyList))
+			c.logger.Debugf("Replicating instance %s (%d/%d)", instance.sourceDigest, i+1, len(instanceCopyList))
 			c.Printf("Replicating image %s (%d/%d)\n", instance.sourceDigest, i+1, len(instanceCopyList))
 			unparsedInstance := image.UnparsedInstance(c.rawSource, &instanceCopyList[i].sourceDigest)
 			updated, err := c.copySingleImage(ctx, unparsedInstance, &instanceCopyList[i].sourceDigest, copySingleImageOptions{
@@ -288,7 +291,7 @@ func (c *copier) copyMultipleImages(ctx context.Context) (copiedManifest []byte,
 	for _, thisListType := range append([]string{selectedListType}, otherManifestMIMETypeCandidates...) {
 		var attemptedList internalManifest.ListPublic = updatedList
 
-		logrus.Debugf("Trying to use manifest list type %s…", thisListType)
+		c.logger.Debugf("Trying to use manifest list type %s…", thisListType)
 
 		// Perform the list conversion, if we need one.
 		if thisListType != updatedList.MIMEType() {
@@ -314,7 +317,7 @@ func (c *copier) copyMultipleImages(ctx context.Context) (copiedManifest []byte,
 			if cannotModifyManifestListReason != "" {
 				return nil, fmt.Errorf("Manifest list must be converted to type %q to be written to destination, but we cannot modify it: %q", thisListType, cannotModifyManifestListReason)
 			}
-			logrus.Debugf("Manifest list has been updated")
+			c.logger.Debugf("Manifest list has been updated")
 		} else {
 			// We can just use the original value, so use it instead of the one we just rebuilt, so that we don't change the digest.
 			attemptedManifestList = manifestList
@@ -323,7 +326,7 @@ func (c *copier) copyMultipleImages(ctx context.Context) (copiedManifest []byte,
 		// Save the manifest list.
 		err = c.dest.PutManifest(ctx, attemptedManifestList, nil)
 		if err != nil {
-			logrus.Debugf("Upload of manifest list type %s failed: %v", thisListType, err)
+			c.logger.Debugf("Upload of manifest list type %s failed: %v", thisListType, err)
 			errs = append(errs, fmt.Sprintf("%s(%v)", thisListType, err))
 			continue
 		}
@@ -11,12 +11,16 @@ import (
 	"github.com/containers/image/v5/signature/sigstore"
 	"github.com/containers/image/v5/signature/simplesigning"
 	"github.com/containers/image/v5/transports"
+	"golang.org/x/exp/slices"
 )
 
 // setupSigners initializes c.signers.
 func (c *copier) setupSigners() error {
-	c.signers = append(c.signers, c.options.Signers...)
-	// c.signersToClose is intentionally not updated with c.options.Signers.
+	for _, signer := range c.options.Signers {
+		c.signers = append(c.signers, SignerWithIdentity{Signer: signer})
+	}
+	c.signers = append(c.signers, c.options.SignersWithIdentity...)
+	// c.signersToClose is intentionally not updated with c.options.Signers and c.options.SignersWithIdentity.
 
 	// We immediately append created signers to c.signers, and we rely on c.close() to clean them up; so we don’t need
 	// to clean up any created signers on failure.
@@ -32,7 +36,7 @@ func (c *copier) setupSigners() error {
 		if err != nil {
 			return err
 		}
-		c.signers = append(c.signers, signer)
+		c.signers = append(c.signers, SignerWithIdentity{Signer: signer})
 		c.signersToClose = append(c.signersToClose, signer)
 	}
 
@@ -43,7 +47,7 @@ func (c *copier) setupSigners() error {
 		if err != nil {
 			return err
 		}
-		c.signers = append(c.signers, signer)
+		c.signers = append(c.signers, SignerWithIdentity{Signer: signer})
 		c.signersToClose = append(c.signersToClose, signer)
 	}
 
@@ -60,48 +64,77 @@ func (c *copier) sourceSignatures(ctx context.Context, unparsed private.Unparsed
 		sigs = []internalsig.Signature{}
 	} else {
 		c.Printf("%s\n", gettingSignaturesMessage)
-		s, err := unparsed.UntrustedSignatures(ctx)
+		phaseCtx, cancel := withPhaseTimeout(ctx, "reading signatures", c.options.Timeouts.Signatures)
+		defer cancel()
+		s, err := unparsed.UntrustedSignatures(phaseCtx)
 		if err != nil {
-			return nil, fmt.Errorf("reading signatures: %w", err)
+			return nil, fmt.Errorf("reading signatures: %w", phaseCtx.annotateError(err))
 		}
 		sigs = s
 	}
 	if len(sigs) != 0 {
 		c.Printf("%s\n", checkingDestMessage)
 		if err := c.dest.SupportsSignatures(ctx); err != nil {
-			return nil, fmt.Errorf("Can not copy signatures to %s: %w", transports.ImageName(c.dest.Reference()), err)
+			if reporter, ok := c.rawSource.(private.SigstoreAttachmentDiscoveryReporter); ok && reporter.DiscoversSigstoreAttachments() {
+				// The source was not configured to use sigstore signatures; don’t fail the copy just because they can't be preserved.
+				others := slices.DeleteFunc(slices.Clone(sigs), func(sig internalsig.Signature) bool {
+					_, ok := sig.(internalsig.Sigstore)
+					return ok
+				})
+				if len(others) != len(sigs) {
+					c.Printf("Not copying %d discovered sigstore signatures: %v\n", len(sigs)-len(others), err)
+				}
+				sigs = others
+			}
+			if len(sigs) != 0 {
+				return nil, fmt.Errorf("Can not copy signatures to %s: %w", transports.ImageName(c.dest.Reference()), err)
+			}
 		}
 	}
 	return sigs, nil
 }
 
 // createSignatures creates signatures for manifest and an optional identity.
+// identity is used by signers which don’t specify their own identity.
+// Either all signatures are created successfully, or an error is returned.
 func (c *copier) createSignatures(ctx context.Context, manifest []byte, identity reference.Named) ([]internalsig.Signature, error) {
 	if len(c.signers) == 0 {
 		// We must exit early here, otherwise copies with no Docker reference wouldn’t be possible.
 		return nil, nil
 	}
 
-	if identity != nil {
-		if reference.IsNameOnly(identity) {
-			return nil, fmt.Errorf("Sign identity must be a fully specified reference %s", identity.String())
-		}
-	} else {
-		identity = c.dest.Reference().DockerReference()
-		if identity == nil {
-			return nil, fmt.Errorf("Cannot determine canonical Docker reference for destination %s", transports.ImageName(c.dest.Reference()))
+	// Determine all identities before creating any signatures, so that we don’t, e.g., ask for a passphrase and then fail.
+	identities := make([]reference.Named, 0, len(c.signers))
+	var defaultIdentity reference.Named // Set on first use
+	for signerIndex, signer := range c.signers {
+		signerIdentity := signer.Identity
+		switch {
+		case signerIdentity != nil:
+			if reference.IsNameOnly(signerIdentity) {
+				return nil, fmt.Errorf("Sign identity for signer %d must be a fully specified reference %s", signerIndex+1, signerIdentity.String())
+			}
+		case defaultIdentity != nil:
+			signerIdentity = defaultIdentity
+		default:
+			i, err := c.defaultSignIdentity(identity)
+			if err != nil {
+				return nil, err
+			}
+			defaultIdentity = i
+			signerIdentity = i
 		}
+		identities = append(identities, signerIdentity)
 	}
 
 	res := make([]internalsig.Signature, 0, len(c.signers))
 	for signerIndex, signer := range c.signers {
-		msg := internalSigner.ProgressMessage(signer)
+		msg := internalSigner.ProgressMessage(signer.Signer)
 		if len(c.signers) == 1 {
 			c.Printf("Creating signature: %s\n", msg)
 		} else {
 			c.Printf("Creating signature %d: %s\n", signerIndex+1, msg)
 		}
-		newSig, err := internalSigner.SignImageManifest(ctx, signer, manifest, identity)
+		newSig, err := internalSigner.SignImageManifest(ctx, signer.Signer, manifest, identities[signerIndex])
 		if err != nil {
 			if len(c.signers) == 1 {
 				return nil, fmt.Errorf("creating signature: %w", err)
@@ -113,3 +146,19 @@ func (c *copier) createSignatures(ctx context.Context, manifest []byte, identity
 	}
 	return res, nil
 }
+
+// defaultSignIdentity returns the identity to sign for signers which don’t specify their own identity,
+// based on an optional identity.
+func (c *copier) defaultSignIdentity(identity reference.Named) (reference.Named, error) {
+	if identity != nil {
+		if reference.IsNameOnly(identity) {
+			return nil, fmt.Errorf("Sign identity must be a fully specified reference %s", identity.String())
+		}
+		return identity, nil
+	}
+	identity = c.dest.Reference().DockerReference()
+	if identity == nil {
+		return nil, fmt.Errorf("Cannot determine canonical Docker reference for destination %s", transports.ImageName(c.dest.Reference()))
+	}
+	return identity, nil
+}
@@ -4,14 +4,18 @@ import (
 	"context"
 	"errors"
 	"io"
+	"path/filepath"
 	"testing"
 
 	"github.com/containers/image/v5/directory"
 	"github.com/containers/image/v5/docker"
+	"github.com/containers/image/v5/docker/archive"
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/imagedestination"
+	"github.com/containers/image/v5/internal/private"
 	internalsig "github.com/containers/image/v5/internal/signature"
 	internalSigner "github.com/containers/image/v5/internal/signer"
+	"github.com/containers/image/v5/internal/testing/mocks"
 	"github.com/containers/image/v5/signature/signer"
 	"github.com/containers/image/v5/types"
 	"github.com/stretchr/testify/assert"
@@ -161,3 +165,192 @@ func TestCreateSignatures(t *testing.T) {
 		}
 	}
 }
+
+func TestCreateSignaturesWithIdentities(t *testing.T) {
+	stubSigner := internalSigner.NewSigner(&stubSignerImpl{})
+	defer stubSigner.Close()
+
+	manifestBlob := []byte("Something")
+	tempDir := t.TempDir()
+	dirRef, err := directory.NewReference(tempDir)
+	require.NoError(t, err)
+	dirDest, err := dirRef.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dirDest.Close()
+	dockerRef, err := docker.ParseReference("//busybox")
+	require.NoError(t, err)
+	dockerDest, err := dockerRef.NewImageDestination(context.Background(),
+		&types.SystemContext{RegistriesDirPath: "/this/does/not/exist", DockerPerHostCertDirPath: "/this/does/not/exist"})
+	require.NoError(t, err)
+	defer dockerDest.Close()
+
+	identity1, err := reference.ParseNormalizedNamed("myregistry.io/myrepo:tag1")
+	require.NoError(t, err)
+	identity2, err := reference.ParseNormalizedNamed("example.com/other:tag2")
+	require.NoError(t, err)
+	nameOnly, err := reference.ParseNormalizedNamed("myregistry.io/myrepo")
+	require.NoError(t, err)
+
+	for _, cc := range []struct {
+		name               string
+		dest               types.ImageDestination
+		options            *Options
+		identity           reference.Named
+		expectedIdentities []string // nil to expect a failure
+	}{
+		{
+			name: "docker:// with per-signer identities and a default",
+			dest: dockerDest,
+			options: &Options{
+				Signers: []*signer.Signer{stubSigner},
+				SignersWithIdentity: []SignerWithIdentity{
+					{Signer: stubSigner, Identity: identity1},
+					{Signer: stubSigner, Identity: identity2},
+					{Signer: stubSigner},
+				},
+			},
+			expectedIdentities: []string{
+				"docker.io/library/busybox:latest",
+				"myregistry.io/myrepo:tag1",
+				"example.com/other:tag2",
+				"docker.io/library/busybox:latest",
+			},
+		},
+		{
+			name: "dir: with per-signer identities only",
+			dest: dirDest,
+			options: &Options{
+				SignersWithIdentity: []SignerWithIdentity{
+					{Signer: stubSigner, Identity: identity1},
+					{Signer: stubSigner, Identity: identity2},
+				},
+			},
+			expectedIdentities: []string{"myregistry.io/myrepo:tag1", "example.com/other:tag2"},
+		},
+		{
+			name: "dir: with an overridden default identity",
+			dest: dirDest,
+			options: &Options{
+				SignersWithIdentity: []SignerWithIdentity{
+					{Signer: stubSigner},
+					{Signer: stubSigner, Identity: identity2},
+				},
+			},
+			identity:           identity1,
+			expectedIdentities: []string{"myregistry.io/myrepo:tag1", "example.com/other:tag2"},
+		},
+		{
+			name: "dir: with a signer without an identity",
+			dest: dirDest,
+			options: &Options{
+				SignersWithIdentity: []SignerWithIdentity{
+					{Signer: stubSigner, Identity: identity1},
+					{Signer: stubSigner},
+				},
+			},
+		},
+		{
+			name: "per-signer identity not a full reference",
+			dest: dockerDest,
+			options: &Options{
+				SignersWithIdentity: []SignerWithIdentity{{Signer: stubSigner, Identity: nameOnly}},
+			},
+		},
+		{
+			name: "second signing fails",
+			dest: dockerDest,
+			options: &Options{
+				SignersWithIdentity: []SignerWithIdentity{
+					{Signer: stubSigner, Identity: identity1},
+					{Signer: internalSigner.NewSigner(&stubSignerImpl{signingFailure: errors.New("fails")}), Identity: identity2},
+				},
+			},
+		},
+	} {
+		c := &copier{
+			dest:         imagedestination.FromPublic(cc.dest),
+			options:      cc.options,
+			reportWriter: io.Discard,
+		}
+		defer c.close()
+		err := c.setupSigners()
+		require.NoError(t, err, cc.name)
+		sigs, err := c.createSignatures(context.Background(), manifestBlob, cc.identity)
+		if cc.expectedIdentities == nil {
+			assert.Error(t, err, cc.name)
+			assert.Nil(t, sigs, cc.name)
+			continue
+		}
+		require.NoError(t, err, cc.name)
+		require.Len(t, sigs, len(cc.expectedIdentities), cc.name)
+		for i, sig := range sigs {
+			stubSig, ok := sig.(internalsig.Sigstore)
+			require.True(t, ok, cc.name)
+			assert.Equal(t, manifestBlob, stubSig.UntrustedPayload(), cc.name)
+			assert.Equal(t, cc.expectedIdentities[i], stubSig.UntrustedMIMEType(), cc.name)
+		}
+	}
+}
+
+// signaturesUnparsedImage is a private.UnparsedImage which only supports UntrustedSignatures.
+type signaturesUnparsedImage struct {
+	mocks.ForbiddenUnparsedImage
+	sigs []internalsig.Signature
+}
+
+func (f signaturesUnparsedImage) UntrustedSignatures(ctx context.Context) ([]internalsig.Signature, error) {
+	return f.sigs, nil
+}
+
+// discoveringImageSource is a private.ImageSource which only supports DiscoversSigstoreAttachments.
+type discoveringImageSource struct {
+	private.ImageSource
+	discovers bool
+}
+
+func (s discoveringImageSource) DiscoversSigstoreAttachments() bool {
+	return s.discovers
+}
+
+func TestSourceSignatures(t *testing.T) {
+	dirRef, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	dirDest, err := dirRef.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dirDest.Close()
+	archiveRef, err := archive.NewReference(filepath.Join(t.TempDir(), "archive.tar"), nil)
+	require.NoError(t, err)
+	archiveDest, err := archiveRef.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer archiveDest.Close()
+
+	sigstoreSig := internalsig.SigstoreFromComponents(internalsig.SigstoreSignatureMIMEType, []byte("payload"), nil)
+	simpleSig := internalsig.SimpleSigningFromBlob([]byte("simple"))
+	for _, c := range []struct {
+		name      string
+		dest      types.ImageDestination
+		discovers bool
+		sigs      []internalsig.Signature
+		expected  []internalsig.Signature // or nil if an error is expected
+	}{
+		{"supported", dirDest, true, []internalsig.Signature{sigstoreSig, simpleSig}, []internalsig.Signature{sigstoreSig, simpleSig}},
+		{"no signatures", archiveDest, false, []internalsig.Signature{}, []internalsig.Signature{}},
+		{"unsupported", archiveDest, false, []internalsig.Signature{sigstoreSig}, nil},
+		{"unsupported, discovered", archiveDest, true, []internalsig.Signature{sigstoreSig}, []internalsig.Signature{}},
+		{"unsupported, discovered with others", archiveDest, true, []internalsig.Signature{sigstoreSig, simpleSig}, nil},
+	} {
+		c2 := &copier{
+			dest:         imagedestination.FromPublic(c.dest),
+			rawSource:    discoveringImageSource{discovers: c.discovers},
+			options:      &Options{},
+			reportWriter: io.Discard,
+		}
+		res, err := c2.sourceSignatures(context.Background(), signaturesUnparsedImage{sigs: c.sigs}, "getting", "checking")
+		if c.expected == nil {
+			assert.Error(t, err, c.name)
+		} else {
+			require.NoError(t, err, c.name)
+			assert.Equal(t, c.expected, res, c.name)
+		}
+	}
+}
@@ -15,15 +15,16 @@ import (
 	"github.com/containers/image/v5/internal/pkg/platform"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/image/v5/internal/tracing"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/compression"
 	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
+	"github.com/containers/image/v5/pkg/logging"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
 	chunkedToc "github.com/containers/storage/pkg/chunked/toc"
 	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
-	"github.com/sirupsen/logrus"
 	"github.com/vbauerster/mpb/v8"
 	"golang.org/x/exp/slices"
 )
@@ -57,10 +58,13 @@ type copySingleImageResult struct {
 
 // copySingleImage copies a single (non-manifest-list) image unparsedImage, using c.policyContext to validate
 // source image admissibility.
-func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.UnparsedImage, targetInstance *digest.Digest, opts copySingleImageOptions) (copySingleImageResult, error) {
+func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.UnparsedImage, targetInstance *digest.Digest, opts copySingleImageOptions) (_ copySingleImageResult, retErr error) {
+	ctx, span := tracing.Start(ctx, "copy.SingleImage", tracing.AttributeSource.String(transports.ImageName(unparsedImage.Reference())))
+	defer func() { tracing.End(span, retErr) }()
+
 	// The caller is handling manifest lists; this could happen only if a manifest list contains a manifest list.
 	// Make sure we fail cleanly in such cases.
-	multiImage, err := isMultiImage(ctx, unparsedImage)
+	multiImage, err := c.resolveIsMultiImage(ctx, unparsedImage)
 	if err != nil {
 		// FIXME FIXME: How to name a reference for the sub-image?
 		return copySingleImageResult{}, fmt.Errorf("determining manifest MIME type for %s: %w", transports.ImageName(unparsedImage.Reference()), err)
@@ -72,8 +76,8 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 	// Please keep this policy check BEFORE reading any other information about the image.
 	// (The multiImage check above only matches the MIME type, which we have received anyway.
 	// Actual parsing of anything should be deferred.)
-	if allowed, err := c.policyContext.IsRunningImageAllowed(ctx, unparsedImage); !allowed || err != nil { // Be paranoid and fail if either return value indicates so.
-		return copySingleImageResult{}, fmt.Errorf("Source image rejected: %w", err)
+	if err := c.checkPolicy(ctx, unparsedImage); err != nil {
+		return copySingleImageResult{}, err
 	}
 	src, err := image.FromUnparsedImage(ctx, c.options.SourceCtx, unparsedImage)
 	if err != nil {
@@ -133,9 +137,12 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 	}
 
 	ic := imageCopier{
-		c:               c,
-		manifestUpdates: &types.ManifestUpdateOptions{InformationOnly: types.ManifestUpdateInformation{Destination: c.dest}},
-		src:             src,
+		c: c,
+		manifestUpdates: &types.ManifestUpdateOptions{
+			ConfigStrictness: c.options.ConfigStrictness,
+			InformationOnly:  types.ManifestUpdateInformation{Destination: c.dest},
+		},
+		src: src,
 		// diffIDsAreNeeded is computed later
 		cannotModifyManifestReason:    cannotModifyManifestReason,
 		requireCompressionFormatMatch: opts.requireCompressionFormatMatch,
@@ -164,17 +171,31 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 
 	destRequiresOciEncryption := (isEncrypted(src) && ic.c.options.OciDecryptConfig == nil) || c.options.OciEncryptLayers != nil
 
-	manifestConversionPlan, err := determineManifestConversion(determineManifestConversionInputs{
+	parsedSrcManifest, err := manifest.FromBlob(ic.src.ManifestBlob, ic.src.ManifestMIMEType)
+	if err != nil {
+		return copySingleImageResult{}, fmt.Errorf("parsing source manifest: %w", err)
+	}
+	manifestConversionPlan, err := determineManifestConversion(ic.c.logger, determineManifestConversionInputs{
 		srcMIMEType:                    ic.src.ManifestMIMEType,
 		destSupportedManifestMIMETypes: ic.c.dest.SupportedManifestMIMETypes(),
 		forceManifestMIMEType:          c.options.ForceManifestMIMEType,
 		requestedCompressionFormat:     ic.compressionFormat,
 		requiresOCIEncryption:          destRequiresOciEncryption,
 		cannotModifyManifestReason:     ic.cannotModifyManifestReason,
+		refuseSchema1:                  c.options.DestinationCtx == nil || c.options.DestinationCtx.DockerSchema1Mode != types.DockerSchema1Allow,
+		srcLayerCompressionAlgorithms:  manifest.LayerCompressionAlgorithms(parsedSrcManifest),
 	})
 	if err != nil {
 		return copySingleImageResult{}, err
 	}
+	if len(manifestConversionPlan.preferredMIMETypeCompressionLoss) != 0 {
+		// The destination format can't represent the compression of some layers; instead of failing after
+		// copying all the layers, recompress them to something that is universally supported.
+		c.Printf("Manifest format %s does not support %s compression, recompressing affected layers using %s\n",
+			manifestConversionPlan.preferredMIMEType, strings.Join(manifestConversionPlan.preferredMIMETypeCompressionLoss, ", "), defaultCompressionFormat.Name())
+		ic.compressionFormat = defaultCompressionFormat
+		ic.compressionLevel = nil
+	}
 	// We set up this part of ic.manifestUpdates quite early, not just around the
 	// code that calls copyUpdatedConfigAndManifest, so that other parts of the copy code
 	// (e.g. the UpdatedImageNeedsLayerDiffIDs check just below) can make decisions based
@@ -189,13 +210,16 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 	// If enabled, fetch and compare the destination's manifest. And as an optimization skip updating the destination iff equal
 	if c.options.OptimizeDestinationImageAlreadyExists {
 		shouldUpdateSigs := len(sigs) > 0 || len(c.signers) != 0 // TODO: Consider allowing signatures updates only and skipping the image's layers/manifest copy if possible
-		noPendingManifestUpdates := ic.noPendingManifestUpdates()
+		// With ForeignLayersDownload, the destination manifest is expected to differ from the source (and copying the layers
+		// is what updates ic.manifestUpdates), so the destination can't be compared against the unmodified source manifest.
+		noPendingManifestUpdates := ic.noPendingManifestUpdates() &&
+			(c.foreignLayerPolicy() != ForeignLayersDownload || !slices.ContainsFunc(src.LayerInfos(), hasForeignLayerURLs))
 
-		logrus.Debugf("Checking if we can skip copying: has signatures=%t, OCI encryption=%t, no manifest updates=%t, compression match required for resuing blobs=%t", shouldUpdateSigs, destRequiresOciEncryption, noPendingManifestUpdates, opts.requireCompressionFormatMatch)
+		c.logger.Debugf("Checking if we can skip copying: has signatures=%t, OCI encryption=%t, no manifest updates=%t, compression match required for resuing blobs=%t", shouldUpdateSigs, destRequiresOciEncryption, noPendingManifestUpdates, opts.requireCompressionFormatMatch)
 		if !shouldUpdateSigs && !destRequiresOciEncryption && noPendingManifestUpdates && !ic.requireCompressionFormatMatch {
 			matchedResult, err := ic.compareImageDestinationManifestEqual(ctx, targetInstance)
 			if err != nil {
-				logrus.Warnf("Failed to compare destination image manifest: %v", err)
+				c.logger.Warnf("Failed to compare destination image manifest: %v", err)
 				return copySingleImageResult{}, err
 			}
 
@@ -223,7 +247,7 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 		manifestDigest:   manifestDigest,
 	}
 	if err != nil {
-		logrus.Debugf("Writing manifest using preferred type %s failed: %v", manifestConversionPlan.preferredMIMEType, err)
+		c.logger.Debugf("Writing manifest using preferred type %s failed: %v", manifestConversionPlan.preferredMIMEType, err)
 		// … if it fails, and the failure is either because the manifest is rejected by the registry, or
 		// because we failed to create a manifest of the specified type because the specific manifest type
 		// doesn't support the type of compression we're trying to use (e.g. docker v2s2 and zstd), we may
@@ -249,11 +273,11 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 		// errs is a list of errors when trying various manifest types. Also serves as an "upload succeeded" flag when set to nil.
 		errs := []string{fmt.Sprintf("%s(%v)", manifestConversionPlan.preferredMIMEType, err)}
 		for _, manifestMIMEType := range manifestConversionPlan.otherMIMETypeCandidates {
-			logrus.Debugf("Trying to use manifest type %s…", manifestMIMEType)
+			c.logger.Debugf("Trying to use manifest type %s…", manifestMIMEType)
 			ic.manifestUpdates.ManifestMIMEType = manifestMIMEType
 			attemptedManifest, attemptedManifestDigest, err := ic.copyUpdatedConfigAndManifest(ctx, targetInstance)
 			if err != nil {
-				logrus.Debugf("Upload of manifest type %s failed: %v", manifestMIMEType, err)
+				c.logger.Debugf("Upload of manifest type %s failed: %v", manifestMIMEType, err)
 				errs = append(errs, fmt.Sprintf("%s(%v)", manifestMIMEType, err))
 				continue
 			}
@@ -292,6 +316,17 @@ func (c *copier) copySingleImage(ctx context.Context, unparsedImage *image.Unpar
 	return res, nil
 }
 
+// checkPolicy checks unparsedImage against c.policyContext, within c.options.Timeouts.Signatures.
+// The signatures are cached in unparsedImage, so later uses of them are not affected by the timeout.
+func (c *copier) checkPolicy(ctx context.Context, unparsedImage *image.UnparsedImage) error {
+	phaseCtx, cancel := withPhaseTimeout(ctx, "verifying signatures", c.options.Timeouts.Signatures)
+	defer cancel()
+	if allowed, err := c.policyContext.IsRunningImageAllowed(phaseCtx, unparsedImage); !allowed || err != nil { // Be paranoid and fail if either return value indicates so.
+		return fmt.Errorf("Source image rejected: %w", phaseCtx.annotateError(err))
+	}
+	return nil
+}
+
 // checkImageDestinationForCurrentRuntime enforces dest.MustMatchRuntimeOS, if necessary.
 func checkImageDestinationForCurrentRuntime(ctx context.Context, sys *types.SystemContext, src types.Image, dest types.ImageDestination) error {
 	if dest.MustMatchRuntimeOS() {
@@ -317,7 +352,7 @@ func checkImageDestinationForCurrentRuntime(ctx context.Context, sys *types.Syst
 			options.append(fmt.Sprintf("%s+%s+%q", wantedPlatform.OS, wantedPlatform.Architecture, wantedPlatform.Variant))
 		}
 		if !match {
-			logrus.Infof("Image operating system mismatch: image uses OS %q+architecture %q+%q, expecting one of %q",
+			logging.For(sys).Infof("Image operating system mismatch: image uses OS %q+architecture %q+%q, expecting one of %q",
 				c.OS, c.Architecture, c.Variant, strings.Join(options.list, ", "))
 		}
 	}
@@ -346,7 +381,10 @@ func (ic *imageCopier) updateEmbeddedDockerReference() error {
 }
 
 func (ic *imageCopier) noPendingManifestUpdates() bool {
-	return reflect.DeepEqual(*ic.manifestUpdates, types.ManifestUpdateOptions{InformationOnly: ic.manifestUpdates.InformationOnly})
+	return reflect.DeepEqual(*ic.manifestUpdates, types.ManifestUpdateOptions{
+		ConfigStrictness: ic.manifestUpdates.ConfigStrictness,
+		InformationOnly:  ic.manifestUpdates.InformationOnly,
+	})
 }
 
 // compareImageDestinationManifestEqual compares the source and destination image manifests (reading the manifest from the
@@ -359,14 +397,14 @@ func (ic *imageCopier) compareImageDestinationManifestEqual(ctx context.Context,
 
 	destImageSource, err := ic.c.dest.Reference().NewImageSource(ctx, ic.c.options.DestinationCtx)
 	if err != nil {
-		logrus.Debugf("Unable to create destination image %s source: %v", ic.c.dest.Reference(), err)
+		ic.c.logger.Debugf("Unable to create destination image %s source: %v", ic.c.dest.Reference(), err)
 		return nil, nil
 	}
 	defer destImageSource.Close()
 
 	destManifest, destManifestType, err := destImageSource.GetManifest(ctx, targetInstance)
 	if err != nil {
-		logrus.Debugf("Unable to get destination image %s/%s manifest: %v", destImageSource, targetInstance, err)
+		ic.c.logger.Debugf("Unable to get destination image %s/%s manifest: %v", destImageSource, targetInstance, err)
 		return nil, nil
 	}
 
@@ -375,7 +413,7 @@ func (ic *imageCopier) compareImageDestinationManifestEqual(ctx context.Context,
 		return nil, fmt.Errorf("calculating manifest digest: %w", err)
 	}
 
-	logrus.Debugf("Comparing source and destination manifest digests: %v vs. %v", srcManifestDigest, destManifestDigest)
+	ic.c.logger.Debugf("Comparing source and destination manifest digests: %v vs. %v", srcManifestDigest, destManifestDigest)
 	if srcManifestDigest != destManifestDigest {
 		return nil, nil
 	}
@@ -418,6 +456,26 @@ func (ic *imageCopier) copyLayers(ctx context.Context) ([]compressiontypes.Algor
 		srcInfosUpdated = true
 	}
 
+	foreignLayerPolicy := ic.c.foreignLayerPolicy()
+	skipForeignLayers := false
+	switch foreignLayerPolicy {
+	case ForeignLayersDefault:
+		skipForeignLayers = ic.c.dest.AcceptsForeignLayerURLs()
+	case ForeignLayersSkip:
+		if !ic.c.dest.AcceptsForeignLayerURLs() && slices.ContainsFunc(srcInfos, hasForeignLayerURLs) {
+			return nil, fmt.Errorf("the image contains foreign layers, which must not be copied, but %s does not accept references to foreign layers",
+				ic.c.dest.Reference().Transport().Name())
+		}
+		skipForeignLayers = true
+	case ForeignLayersDownload:
+	case ForeignLayersReject:
+		if i := slices.IndexFunc(srcInfos, isForeignLayer); i != -1 {
+			return nil, fmt.Errorf("the image contains a foreign layer %s, which is not allowed", srcInfos[i].Digest)
+		}
+	default:
+		return nil, fmt.Errorf("unknown foreign layer policy %d", foreignLayerPolicy)
+	}
+
 	type copyLayerData struct {
 		destInfo types.BlobInfo
 		diffID   digest.Digest
@@ -440,7 +498,7 @@ func (ic *imageCopier) copyLayers(ctx context.Context) ([]compressiontypes.Algor
 		defer ic.c.concurrentBlobCopiesSemaphore.Release(1)
 		defer copyGroup.Done()
 		cld := copyLayerData{}
-		if !ic.c.options.DownloadForeignLayers && ic.c.dest.AcceptsForeignLayerURLs() && len(srcLayer.URLs) != 0 {
+		if skipForeignLayers && hasForeignLayerURLs(srcLayer) {
 			// DiffIDs are, currently, needed only when converting from schema1.
 			// In which case src.LayerInfos will not have URLs because schema1
 			// does not support them.
@@ -448,7 +506,7 @@ func (ic *imageCopier) copyLayers(ctx context.Context) ([]compressiontypes.Algor
 				cld.err = errors.New("getting DiffID for foreign layers is unimplemented")
 			} else {
 				cld.destInfo = srcLayer
-				logrus.Debugf("Skipping foreign layer %q copy to %s", cld.destInfo.Digest, ic.c.dest.Reference().Transport().Name())
+				ic.c.logger.Debugf("Skipping foreign layer %q copy to %s", cld.destInfo.Digest, ic.c.dest.Reference().Transport().Name())
 			}
 		} else {
 			cld.destInfo, cld.diffID, cld.err = ic.copyLayer(ctx, srcLayer, toEncrypt, pool, index, srcRef, manifestLayerInfos[index].EmptyLayer)
@@ -523,7 +581,8 @@ func (ic *imageCopier) copyLayers(ctx context.Context) ([]compressiontypes.Algor
 	if ic.diffIDsAreNeeded {
 		ic.manifestUpdates.InformationOnly.LayerDiffIDs = diffIDs
 	}
-	if srcInfosUpdated || layerDigestsDiffer(srcInfos, destInfos) {
+	if srcInfosUpdated || layerDigestsDiffer(srcInfos, destInfos) ||
+		(foreignLayerPolicy == ForeignLayersDownload && ic.cannotModifyManifestReason == "" && foreignLayerURLsDropped(srcInfos, destInfos)) {
 		ic.manifestUpdates.LayerInfos = destInfos
 	}
 	algos, err := algorithmsByNames(compressionAlgos.Values())
@@ -533,6 +592,42 @@ func (ic *imageCopier) copyLayers(ctx context.Context) ([]compressiontypes.Algor
 	return algos, nil
 }
 
+// foreignLayerPolicy returns the ForeignLayerPolicy to use, taking into account Options.DownloadForeignLayers.
+func (c *copier) foreignLayerPolicy() ForeignLayerPolicy {
+	if c.options.ForeignLayers == ForeignLayersDefault && c.options.DownloadForeignLayers {
+		return ForeignLayersDownload
+	}
+	return c.options.ForeignLayers
+}
+
+// hasForeignLayerURLs returns true if info lists external URLs for the layer contents.
+func hasForeignLayerURLs(info types.BlobInfo) bool {
+	return len(info.URLs) != 0
+}
+
+// isForeignLayer returns true if info describes a foreign layer, i.e. it lists external URLs or uses a "nondistributable" media type.
+func isForeignLayer(info types.BlobInfo) bool {
+	if hasForeignLayerURLs(info) {
+		return true
+	}
+	switch info.MediaType {
+	case manifest.DockerV2Schema2ForeignLayerMediaType, manifest.DockerV2Schema2ForeignLayerMediaTypeGzip,
+		imgspecv1.MediaTypeImageLayerNonDistributable, imgspecv1.MediaTypeImageLayerNonDistributableGzip, imgspecv1.MediaTypeImageLayerNonDistributableZstd: //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
+		return true
+	}
+	return false
+}
+
+// foreignLayerURLsDropped returns true if any layer in src lists external URLs, and the corresponding layer in dest does not.
+func foreignLayerURLsDropped(src, dest []types.BlobInfo) bool {
+	for i := range src {
+		if hasForeignLayerURLs(src[i]) && i < len(dest) && !hasForeignLayerURLs(dest[i]) {
+			return true
+		}
+	}
+	return false
+}
+
 // layerDigestsDiffer returns true iff the digests in a and b differ (ignoring sizes and possible other fields)
 func layerDigestsDiffer(a, b []types.BlobInfo) bool {
 	return !slices.EqualFunc(a, b, func(a, b types.BlobInfo) bool {
@@ -582,21 +677,27 @@ func (ic *imageCopier) copyUpdatedConfigAndManifest(ctx context.Context, instanc
 		instanceDigest = &manifestDigest
 	}
 	if err := ic.c.dest.PutManifest(ctx, man, instanceDigest); err != nil {
-		logrus.Debugf("Error %v while writing manifest %q", err, string(man))
+		ic.c.logger.Debugf("Error %v while writing manifest %q", err, string(man))
 		return nil, "", fmt.Errorf("writing manifest: %w", err)
 	}
 	return man, manifestDigest, nil
 }
 
 // copyConfig copies config.json, if any, from src to dest.
-func (ic *imageCopier) copyConfig(ctx context.Context, src types.Image) error {
+func (ic *imageCopier) copyConfig(ctx context.Context, src types.Image) (retErr error) {
 	srcInfo := src.ConfigInfo()
 	if srcInfo.Digest != "" {
+		ctx, span := tracing.Start(ctx, "copy.Config", tracing.AttributeDigest.String(srcInfo.Digest.String()))
+		defer func() { tracing.End(span, retErr) }()
+
 		if err := ic.c.concurrentBlobCopiesSemaphore.Acquire(ctx, 1); err != nil {
 			// This can only fail with ctx.Err(), so no need to blame acquiring the semaphore.
 			return fmt.Errorf("copying config: %w", err)
 		}
 		defer ic.c.concurrentBlobCopiesSemaphore.Release(1)
+		phaseCtx, cancel := withPhaseTimeout(ctx, fmt.Sprintf("copying config %s", srcInfo.Digest), ic.c.options.Timeouts.Blob)
+		defer cancel()
+		ctx = phaseCtx
 
 		destInfo, err := func() (types.BlobInfo, error) { // A scope for defer
 			progressPool := ic.c.newProgressPool()
@@ -619,7 +720,7 @@ func (ic *imageCopier) copyConfig(ctx context.Context, src types.Image) error {
 			return destInfo, nil
 		}()
 		if err != nil {
-			return err
+			return phaseCtx.annotateError(err)
 		}
 		if destInfo.Digest != srcInfo.Digest {
 			return fmt.Errorf("Internal error: copying uncompressed config blob %s changed digest to %s", srcInfo.Digest, destInfo.Digest)
@@ -651,7 +752,26 @@ func compressionAlgorithmFromMIMEType(srcInfo types.BlobInfo) *compressiontypes.
 // copyLayer copies a layer with srcInfo (with known Digest and Annotations and possibly known Size) in src to dest, perhaps (de/re/)compressing it,
 // and returns a complete blobInfo of the copied layer, and a value for LayerDiffIDs if diffIDIsNeeded
 // srcRef can be used as an additional hint to the destination during checking whether a layer can be reused but srcRef can be nil.
-func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, toEncrypt bool, pool *mpb.Progress, layerIndex int, srcRef reference.Named, emptyLayer bool) (types.BlobInfo, digest.Digest, error) {
+func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, toEncrypt bool, pool *mpb.Progress, layerIndex int, srcRef reference.Named, emptyLayer bool) (_ types.BlobInfo, _ digest.Digest, retErr error) {
+	logger := ic.c.logger.WithFields(types.LogFields{types.LogFieldDigest: srcInfo.Digest.String()})
+	phaseCtx, cancel := withPhaseTimeout(ctx, fmt.Sprintf("copying blob %s", srcInfo.Digest), ic.c.options.Timeouts.Blob)
+	defer cancel()
+	ctx, span := tracing.Start(phaseCtx, "copy.Layer", tracing.AttributeDigest.String(srcInfo.Digest.String()), tracing.AttributeLayerIndex.Int(layerIndex))
+	layerResult := "" // "reused", "partial" or "copied", once known
+	defer func() {
+		if layerResult != "" {
+			span.SetAttributes(tracing.AttributeLayerResult.String(layerResult))
+			if retErr == nil {
+				ic.c.metrics.AddCounter(types.MetricLayersCopied, types.MetricLabels{
+					types.MetricLabelTransport: ic.c.dest.Reference().Transport().Name(),
+					types.MetricLabelResult:    layerResult,
+				}, 1)
+			}
+		}
+		tracing.End(span, retErr)
+	}()
+	defer func() { retErr = phaseCtx.annotateError(retErr) }()
+
 	// If the srcInfo doesn't contain compression information, try to compute it from the
 	// MediaType, which was either read from a manifest by way of LayerInfos() or constructed
 	// by LayerInfosForCopy(), if it was supplied at all.  If we succeed in copying the blob,
@@ -680,7 +800,7 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, to
 	// Don’t read the layer from the source if we already have the blob, and optimizations are acceptable.
 	if canAvoidProcessingCompleteLayer {
 		canChangeLayerCompression := ic.src.CanChangeLayerCompression(srcInfo.MediaType)
-		logrus.Debugf("Checking if we can reuse blob %s: general substitution = %v, compression for MIME type %q = %v",
+		logger.Debugf("Checking if we can reuse blob %s: general substitution = %v, compression for MIME type %q = %v",
 			srcInfo.Digest, ic.canSubstituteBlobs, srcInfo.MediaType, canChangeLayerCompression)
 		canSubstitute := ic.canSubstituteBlobs && ic.src.CanChangeLayerCompression(srcInfo.MediaType)
 		// TODO: at this point we don't know whether or not a blob we end up reusing is compressed using an algorithm
@@ -702,7 +822,8 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, to
 			return types.BlobInfo{}, "", err
 		}
 
-		reused, reusedBlob, err := ic.c.dest.TryReusingBlobWithOptions(ctx, srcInfo, private.TryReusingBlobOptions{
+		reuseCtx, reuseSpan := tracing.Start(ctx, "copy.TryReusingBlob", tracing.AttributeCanSubstitute.Bool(canSubstitute))
+		reused, reusedBlob, err := ic.c.dest.TryReusingBlobWithOptions(reuseCtx, srcInfo, private.TryReusingBlobOptions{
 			Cache:               ic.c.blobInfoCache,
 			CanSubstitute:       canSubstitute,
 			EmptyLayer:          emptyLayer,
@@ -712,11 +833,16 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, to
 			OriginalCompression: originalCompression,
 			TOCDigest:           tocDigest,
 		})
+		reuseSpan.SetAttributes(tracing.AttributeReused.Bool(reused))
+		if reused {
+			reuseSpan.SetAttributes(tracing.AttributeDigest.String(reusedBlob.Digest.String()))
+		}
+		tracing.End(reuseSpan, err)
 		if err != nil {
 			return types.BlobInfo{}, "", fmt.Errorf("trying to reuse blob %s at destination: %w", srcInfo.Digest, err)
 		}
 		if reused {
-			logrus.Debugf("Skipping blob %s (already present):", srcInfo.Digest)
+			logger.Debugf("Skipping blob %s (already present):", srcInfo.Digest)
 			func() { // A scope for defer
 				bar := ic.c.createProgressBar(pool, false, types.BlobInfo{Digest: reusedBlob.Digest, Size: 0}, "blob", "skipped: already exists")
 				defer bar.Abort(false)
@@ -731,6 +857,7 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, to
 				}
 			}
 
+			layerResult = "reused"
 			return updatedBlobInfoFromReuse(srcInfo, reusedBlob), cachedDiffID, nil
 		}
 	}
@@ -760,17 +887,19 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, to
 				}
 				bar.mark100PercentComplete()
 				hideProgressBar = false
-				logrus.Debugf("Retrieved partial blob %v", srcInfo.Digest)
+				logger.Debugf("Retrieved partial blob %v", srcInfo.Digest)
 				return true, updatedBlobInfoFromUpload(srcInfo, uploadedBlob)
 			}
-			logrus.Debugf("Failed to retrieve partial blob: %v", err)
+			logger.Debugf("Failed to retrieve partial blob: %v", err)
 			return false, types.BlobInfo{}
 		}(); reused {
+			layerResult = "partial"
 			return blobInfo, cachedDiffID, nil
 		}
 	}
 
 	// Fallback: copy the layer, computing the diffID if we need to do so
+	layerResult = "copied"
 	return func() (types.BlobInfo, digest.Digest, error) { // A scope for defer
 		bar := ic.c.createProgressBar(pool, false, srcInfo, "blob", "done")
 		defer bar.Abort(false)
@@ -795,7 +924,7 @@ func (ic *imageCopier) copyLayer(ctx context.Context, srcInfo types.BlobInfo, to
 				if diffIDResult.err != nil {
 					return types.BlobInfo{}, "", fmt.Errorf("computing layer DiffID: %w", diffIDResult.err)
 				}
-				logrus.Debugf("Computed DiffID %s for layer %s", diffIDResult.digest, srcInfo.Digest)
+				logger.Debugf("Computed DiffID %s for layer %s", diffIDResult.digest, srcInfo.Digest)
 				// Don’t record any associations that involve encrypted data. This is a bit crude,
 				// some blob substitutions (replacing pulls of encrypted data with local reuse of known decryption outcomes)
 				// might be safe, but it’s not trivially obvious, so let’s be conservative for now.
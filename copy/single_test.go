@@ -139,3 +139,49 @@ func TestComputeDiffID(t *testing.T) {
 	_, err = computeDiffID(reader, nil)
 	assert.Error(t, err)
 }
+
+func TestForeignLayerPolicy(t *testing.T) {
+	for _, c := range []struct {
+		options  Options
+		expected ForeignLayerPolicy
+	}{
+		{Options{}, ForeignLayersDefault},
+		{Options{DownloadForeignLayers: true}, ForeignLayersDownload},
+		{Options{ForeignLayers: ForeignLayersSkip}, ForeignLayersSkip},
+		{Options{ForeignLayers: ForeignLayersReject, DownloadForeignLayers: true}, ForeignLayersReject},
+	} {
+		c := c
+		res := (&copier{options: &c.options}).foreignLayerPolicy()
+		assert.Equal(t, c.expected, res, fmt.Sprintf("%#v", c.options))
+	}
+}
+
+func TestIsForeignLayer(t *testing.T) {
+	for _, c := range []struct {
+		info     types.BlobInfo
+		expected bool
+	}{
+		{types.BlobInfo{MediaType: imgspecv1.MediaTypeImageLayerGzip}, false},
+		{types.BlobInfo{MediaType: imgspecv1.MediaTypeImageLayerGzip, URLs: []string{"https://example.com"}}, true},
+		{types.BlobInfo{MediaType: imgspecv1.MediaTypeImageLayerNonDistributableGzip}, true}, //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
+		{types.BlobInfo{MediaType: "application/vnd.docker.image.rootfs.foreign.diff.tar.gzip"}, true},
+		{types.BlobInfo{MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip"}, false},
+	} {
+		assert.Equal(t, c.expected, isForeignLayer(c.info), c.info.MediaType)
+	}
+}
+
+func TestForeignLayerURLsDropped(t *testing.T) {
+	urls := []string{"https://example.com"}
+	for _, c := range []struct {
+		src, dest []types.BlobInfo
+		expected  bool
+	}{
+		{[]types.BlobInfo{{}, {}}, []types.BlobInfo{{}, {}}, false},
+		{[]types.BlobInfo{{}, {URLs: urls}}, []types.BlobInfo{{}, {URLs: urls}}, false},
+		{[]types.BlobInfo{{}, {URLs: urls}}, []types.BlobInfo{{}, {}}, true},
+		{[]types.BlobInfo{{}, {}}, []types.BlobInfo{{URLs: urls}, {}}, false},
+	} {
+		assert.Equal(t, c.expected, foreignLayerURLsDropped(c.src, c.dest))
+	}
+}
@@ -0,0 +1,67 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/containers/image/v5/internal/image"
+)
+
+// PhaseTimeouts are limits on the duration of individual phases of a copy, in addition to any deadline of the context.Context
+// passed to Image or Index. This allows e.g. a short limit on reading manifests, and a separate limit on copying each layer,
+// instead of a single deadline which must accommodate the largest image.
+// A zero value means that the phase is not limited.
+type PhaseTimeouts struct {
+	// ManifestResolution limits reading each manifest or manifest list from the source.
+	ManifestResolution time.Duration
+	// Blob limits copying each individual layer or config blob, including checking whether the destination already contains it.
+	Blob time.Duration
+	// Signatures limits reading, and verifying against the signature policy, the signatures of each image from the source.
+	Signatures time.Duration
+}
+
+// phaseContext is a context.Context limited by a PhaseTimeouts value.
+type phaseContext struct {
+	context.Context
+	parent  context.Context
+	phase   string
+	timeout time.Duration
+}
+
+// withPhaseTimeout returns a context derived from ctx, limited by timeout if it is not zero, for a phase described by phase.
+// The caller must call the returned cancel function when the phase is done.
+func withPhaseTimeout(ctx context.Context, phase string, timeout time.Duration) (*phaseContext, context.CancelFunc) {
+	if timeout == 0 {
+		return &phaseContext{Context: ctx, parent: ctx, phase: phase}, func() {}
+	}
+	phaseCtx, cancel := context.WithTimeout(ctx, timeout)
+	return &phaseContext{Context: phaseCtx, parent: ctx, phase: phase, timeout: timeout}, cancel
+}
+
+// annotateError returns err, mentioning the phase timeout if err was caused by it (and not by the deadline of the parent context).
+func (ctx *phaseContext) annotateError(err error) error {
+	if err == nil || ctx.timeout == 0 || !errors.Is(err, context.DeadlineExceeded) ||
+		!errors.Is(ctx.Err(), context.DeadlineExceeded) || ctx.parent.Err() != nil {
+		return err
+	}
+	return fmt.Errorf("%s timed out after %v: %w", ctx.phase, ctx.timeout, err)
+}
+
+// resolveManifest returns the manifest of unparsed, reading it within c.options.Timeouts.ManifestResolution.
+// The manifest is cached in unparsed, so later uses of it are not affected by the timeout.
+func (c *copier) resolveManifest(ctx context.Context, unparsed *image.UnparsedImage) ([]byte, string, error) {
+	phaseCtx, cancel := withPhaseTimeout(ctx, "reading manifest", c.options.Timeouts.ManifestResolution)
+	defer cancel()
+	m, mt, err := unparsed.Manifest(phaseCtx)
+	return m, mt, phaseCtx.annotateError(err)
+}
+
+// resolveIsMultiImage is isMultiImage, reading the manifest using resolveManifest.
+func (c *copier) resolveIsMultiImage(ctx context.Context, unparsed *image.UnparsedImage) (bool, error) {
+	if _, _, err := c.resolveManifest(ctx, unparsed); err != nil {
+		return false, err
+	}
+	return isMultiImage(ctx, unparsed)
+}
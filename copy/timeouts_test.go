@@ -0,0 +1,83 @@
+package copy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/internal/imagesource"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingManifestSource is a types.ImageSource whose GetManifest blocks until the context is done.
+type blockingManifestSource struct {
+	ref types.ImageReference
+}
+
+func (s blockingManifestSource) Reference() types.ImageReference { return s.ref }
+func (blockingManifestSource) Close() error                      { return nil }
+func (blockingManifestSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	<-ctx.Done()
+	return nil, "", ctx.Err()
+}
+func (blockingManifestSource) HasThreadSafeGetBlob() bool { return false }
+func (blockingManifestSource) GetBlob(context.Context, types.BlobInfo, types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	return nil, -1, errors.New("not implemented")
+}
+func (blockingManifestSource) GetSignatures(context.Context, *digest.Digest) ([][]byte, error) {
+	return nil, errors.New("not implemented")
+}
+func (blockingManifestSource) LayerInfosForCopy(context.Context, *digest.Digest) ([]types.BlobInfo, error) {
+	return nil, nil
+}
+
+func TestWithPhaseTimeout(t *testing.T) {
+	// No timeout
+	ctx, cancel := withPhaseTimeout(context.Background(), "phase", 0)
+	_, hasDeadline := ctx.Deadline()
+	assert.False(t, hasDeadline)
+	cancel()
+	assert.NoError(t, ctx.Err())
+	err := ctx.annotateError(context.DeadlineExceeded)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	// The phase timeout expires
+	ctx, cancel = withPhaseTimeout(context.Background(), "phase", time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	err = ctx.annotateError(ctx.Err())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.EqualError(t, err, "phase timed out after 1ms: context deadline exceeded")
+	err = errors.New("unrelated")
+	assert.Equal(t, err, ctx.annotateError(err))
+	assert.NoError(t, ctx.annotateError(nil))
+
+	// The parent deadline expires first
+	parent, parentCancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer parentCancel()
+	ctx, cancel = withPhaseTimeout(parent, "phase", time.Hour)
+	defer cancel()
+	<-ctx.Done()
+	assert.Equal(t, context.DeadlineExceeded, ctx.annotateError(ctx.Err()))
+}
+
+func TestResolveManifestTimeout(t *testing.T) {
+	c := &copier{options: &Options{Timeouts: PhaseTimeouts{ManifestResolution: 10 * time.Millisecond}}}
+	ref, err := directory.NewReference(t.TempDir())
+	require.NoError(t, err)
+	src := imagesource.FromPublic(blockingManifestSource{ref: ref})
+	_, _, err = c.resolveManifest(context.Background(), image.UnparsedInstance(src, nil))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.ErrorContains(t, err, "reading manifest timed out after 10ms")
+
+	_, err = c.resolveIsMultiImage(context.Background(), image.UnparsedInstance(src, nil))
+	require.Error(t, err)
+	assert.ErrorContains(t, err, "reading manifest timed out")
+}
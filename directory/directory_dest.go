@@ -2,18 +2,24 @@ package directory
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sync"
+	"time"
 
+	"github.com/containers/image/v5/internal/digests"
 	"github.com/containers/image/v5/internal/imagedestination/impl"
 	"github.com/containers/image/v5/internal/imagedestination/stubs"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/putblobdigest"
 	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
 	"github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
@@ -31,12 +37,28 @@ type dirImageDestination struct {
 	stubs.NoPutBlobPartialInitialize
 	stubs.AlwaysSupportsSignatures
 
-	ref dirReference
+	ref             dirReference
+	layoutVersion   string
+	digestAlgorithm digest.Algorithm // Used for blob digests we compute.
+
+	blobsLock sync.Mutex                     // Protects blobs
+	blobs     map[digest.Digest]BlobMetadata // Only used in LayoutVersion2
 }
 
 // newImageDestination returns an ImageDestination for writing to a directory.
 func newImageDestination(sys *types.SystemContext, ref dirReference) (private.ImageDestination, error) {
+	layoutVersion := LayoutVersion1
+	if sys != nil && sys.DirLayoutVersion != "" {
+		layoutVersion = sys.DirLayoutVersion
+	}
+	versionContents, err := layoutVersionFile(layoutVersion)
+	if err != nil {
+		return nil, err
+	}
 	desiredLayerCompression := types.PreserveOriginal
+	if layoutVersion == LayoutVersion2 {
+		desiredLayerCompression = types.Compress
+	}
 	if sys != nil {
 		if sys.DirForceCompress {
 			desiredLayerCompression = types.Compress
@@ -64,21 +86,9 @@ func newImageDestination(sys *types.SystemContext, ref dirReference) (private.Im
 		}
 
 		if !isEmpty {
-			versionExists, err := pathExists(ref.versionPath())
-			if err != nil {
-				return nil, fmt.Errorf("checking if path exists %q: %w", ref.versionPath(), err)
-			}
-			if versionExists {
-				contents, err := os.ReadFile(ref.versionPath())
-				if err != nil {
-					return nil, err
-				}
-				// check if contents of version file is what we expect it to be
-				if string(contents) != version {
-					return nil, ErrNotContainerImageDir
-				}
-			} else {
-				return nil, ErrNotContainerImageDir
+			// check that the directory contains an image written by us, in any layout version
+			if _, err := readLayoutVersion(ref); err != nil {
+				return nil, err
 			}
 			// delete directory contents so that only one image is in the directory at a time
 			if err = removeDirContents(ref.resolvedPath); err != nil {
@@ -93,7 +103,7 @@ func newImageDestination(sys *types.SystemContext, ref dirReference) (private.Im
 		}
 	}
 	// create version file
-	err = os.WriteFile(ref.versionPath(), []byte(version), 0644)
+	err = os.WriteFile(ref.versionPath(), []byte(versionContents), 0644)
 	if err != nil {
 		return nil, fmt.Errorf("creating version file %q: %w", ref.versionPath(), err)
 	}
@@ -109,7 +119,12 @@ func newImageDestination(sys *types.SystemContext, ref dirReference) (private.Im
 		}),
 		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
 
-		ref: ref,
+		ref:             ref,
+		layoutVersion:   layoutVersion,
+		digestAlgorithm: digests.Algorithm(sys),
+	}
+	if layoutVersion == LayoutVersion2 {
+		d.blobs = map[digest.Digest]BlobMetadata{}
 	}
 	d.Compat = impl.AddCompat(d)
 	return d, nil
@@ -149,7 +164,18 @@ func (d *dirImageDestination) PutBlobWithOptions(ctx context.Context, stream io.
 		}
 	}()
 
-	digester, stream := putblobdigest.DigestIfCanonicalUnknown(stream, inputInfo)
+	digester, stream := putblobdigest.DigestIfAlgorithmUnknown(stream, inputInfo, d.digestAlgorithm)
+	compressionName := ""
+	if d.blobs != nil {
+		algorithm, decompressor, detectedStream, err := compression.DetectCompressionFormat(stream)
+		if err != nil {
+			return private.UploadedBlob{}, err
+		}
+		if decompressor != nil {
+			compressionName = algorithm.Name()
+		}
+		stream = detectedStream
+	}
 	// TODO: This can take quite some time, and should ideally be cancellable using ctx.Done().
 	size, err := io.Copy(blobFile, stream)
 	if err != nil {
@@ -181,6 +207,11 @@ func (d *dirImageDestination) PutBlobWithOptions(ctx context.Context, stream io.
 		return private.UploadedBlob{}, err
 	}
 	succeeded = true
+	if d.blobs != nil {
+		d.blobsLock.Lock()
+		d.blobs[blobDigest] = BlobMetadata{Size: size, Compression: compressionName}
+		d.blobsLock.Unlock()
+	}
 	return private.UploadedBlob{Digest: blobDigest, Size: size}, nil
 }
 
@@ -243,8 +274,22 @@ func (d *dirImageDestination) PutSignaturesWithFormat(ctx context.Context, signa
 // WARNING: This does not have any transactional semantics:
 // - Uploaded data MAY be visible to others before Commit() is called
 // - Uploaded data MAY be removed or MAY remain around if Close() is called without Commit() (i.e. rollback is allowed but not guaranteed)
-func (d *dirImageDestination) Commit(context.Context, types.UnparsedImage) error {
-	return nil
+func (d *dirImageDestination) Commit(ctx context.Context, unparsedToplevel types.UnparsedImage) error {
+	if d.layoutVersion != LayoutVersion2 {
+		return nil
+	}
+	metadata := Metadata{
+		Created: time.Now().UTC(),
+		Blobs:   d.blobs,
+	}
+	if unparsedToplevel != nil {
+		metadata.OriginalReference = transports.ImageName(unparsedToplevel.Reference())
+	}
+	metadataBytes, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(d.ref.metadataPath(), metadataBytes, 0644)
 }
 
 // returns true if path exists
@@ -0,0 +1,102 @@
+package directory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// LayoutVersion1 is the original layout of the dir transport, which only stores the manifests, blobs and signatures.
+	LayoutVersion1 = "1.1"
+	// LayoutVersion2 is a layout which additionally stores Metadata, and compresses layers by default.
+	LayoutVersion2 = "2.0"
+
+	versionPrefix = "Directory Transport Version: "
+	versionV2     = versionPrefix + LayoutVersion2 + "\n"
+)
+
+// Metadata describes an image stored using LayoutVersion2.
+type Metadata struct {
+	Created           time.Time                      `json:"created"`
+	OriginalReference string                         `json:"originalReference,omitempty"` // The image the copy was made from, in transports.ImageName format, if known.
+	Blobs             map[digest.Digest]BlobMetadata `json:"blobs"`
+}
+
+// BlobMetadata describes a single blob in Metadata.
+type BlobMetadata struct {
+	Size        int64  `json:"size"`
+	Compression string `json:"compression,omitempty"` // The name of the compression algorithm of the blob, or "" if it is not compressed.
+}
+
+// layoutVersionFile returns the contents of the version file for layoutVersion.
+func layoutVersionFile(layoutVersion string) (string, error) {
+	switch layoutVersion {
+	case "", LayoutVersion1:
+		return version, nil
+	case LayoutVersion2:
+		return versionV2, nil
+	default:
+		return "", fmt.Errorf("unsupported dir layout version %q", layoutVersion)
+	}
+}
+
+// readLayoutVersion returns the layout version of the directory at ref, or ErrNotContainerImageDir
+// if the version file does not exist or is not recognized.
+func readLayoutVersion(ref dirReference) (string, error) {
+	contents, err := os.ReadFile(ref.versionPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrNotContainerImageDir
+		}
+		return "", err
+	}
+	switch string(contents) {
+	case version:
+		return LayoutVersion1, nil
+	case versionV2:
+		return LayoutVersion2, nil
+	default:
+		return "", ErrNotContainerImageDir
+	}
+}
+
+// ReadMetadata returns the metadata of an image stored using the dir transport at ref,
+// or nil if the image uses a layout version without metadata.
+func ReadMetadata(ref types.ImageReference) (*Metadata, error) {
+	dirRef, ok := ref.(dirReference)
+	if !ok {
+		return nil, errors.New("not a dir transport reference")
+	}
+	layoutVersion, err := readLayoutVersion(dirRef)
+	if err != nil {
+		if errors.Is(err, ErrNotContainerImageDir) {
+			// Images written by very old versions, or by other tools, might lack the version file; reading them still works.
+			return nil, nil
+		}
+		return nil, err
+	}
+	if layoutVersion != LayoutVersion2 {
+		return nil, nil
+	}
+	f, err := os.Open(dirRef.metadataPath())
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	contents, err := iolimits.ReadAtMost(f, iolimits.MaxTarFileManifestSize)
+	if err != nil {
+		return nil, err
+	}
+	var metadata Metadata
+	if err := json.Unmarshal(contents, &metadata); err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", dirRef.metadataPath(), err)
+	}
+	return &metadata, nil
+}
@@ -2,10 +2,13 @@ package directory
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
 
+	"github.com/containers/image/v5/internal/errclass"
 	"github.com/containers/image/v5/internal/imagesource/impl"
 	"github.com/containers/image/v5/internal/imagesource/stubs"
 	"github.com/containers/image/v5/internal/manifest"
@@ -57,6 +60,9 @@ func (s *dirImageSource) Close() error {
 func (s *dirImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
 	m, err := os.ReadFile(s.ref.manifestPath(instanceDigest))
 	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = errclass.Wrap(err, types.ErrNotFound)
+		}
 		return nil, "", err
 	}
 	return m, manifest.GuessMIMEType(m), err
@@ -68,6 +74,9 @@ func (s *dirImageSource) GetManifest(ctx context.Context, instanceDigest *digest
 func (s *dirImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
 	r, err := os.Open(s.ref.layerPath(info.Digest))
 	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = errclass.Wrap(err, types.ErrBlobUnknown)
+		}
 		return nil, -1, err
 	}
 	fi, err := r.Stat()
@@ -2,6 +2,7 @@ package directory
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"errors"
 	"io"
@@ -59,6 +60,10 @@ func TestGetPutManifest(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, man, m)
 	assert.Equal(t, "", mt)
+
+	missing := digest.FromBytes([]byte("missing"))
+	_, _, err = src.GetManifest(context.Background(), &missing)
+	assert.ErrorIs(t, err, types.ErrNotFound)
 }
 
 func TestGetPutBlob(t *testing.T) {
@@ -101,6 +106,21 @@ func TestGetPutBlob(t *testing.T) {
 		assert.Equal(t, expectedBlob, b)
 		assert.Equal(t, int64(len(expectedBlob)), size)
 	}
+	_, _, err = src.GetBlob(context.Background(), types.BlobInfo{Digest: digest.FromBytes([]byte("missing")), Size: -1}, cache)
+	assert.ErrorIs(t, err, types.ErrBlobUnknown)
+	assert.ErrorIs(t, err, types.ErrNotFound)
+}
+
+func TestPutBlobDigestAlgorithm(t *testing.T) {
+	blob := []byte("test-blob")
+	ref, _ := refToTempDir(t)
+	dest, err := ref.NewImageDestination(context.Background(), &types.SystemContext{DigestAlgorithm: digest.SHA512})
+	require.NoError(t, err)
+	defer dest.Close()
+	// A sha256 digest is not reused, the sha512 digest is computed
+	info, err := dest.PutBlob(context.Background(), bytes.NewReader(blob), types.BlobInfo{Digest: digest.FromBytes(blob), Size: -1}, memory.New(), false)
+	require.NoError(t, err)
+	assert.Equal(t, digest.SHA512.FromBytes(blob), info.Digest)
 }
 
 // readerFromFunc allows implementing Reader by any function, e.g. a closure.
@@ -207,3 +227,82 @@ func TestSourceReference(t *testing.T) {
 	ref2 := src.Reference()
 	assert.Equal(t, tmpDir, ref2.StringWithinTransport())
 }
+
+func TestLayoutVersion2(t *testing.T) {
+	ctx := context.Background()
+	ref, _ := refToTempDir(t)
+	cache := memory.New()
+	var gzipBlob bytes.Buffer
+	gw := gzip.NewWriter(&gzipBlob)
+	_, err := gw.Write([]byte("compressed-blob"))
+	require.NoError(t, err)
+	err = gw.Close()
+	require.NoError(t, err)
+	plainBlob := []byte("uncompressed-blob")
+
+	// A layout written using version 1 can be overwritten using version 2.
+	dest, err := ref.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	err = dest.Close()
+	require.NoError(t, err)
+	metadata, err := ReadMetadata(ref)
+	require.NoError(t, err)
+	assert.Nil(t, metadata)
+
+	_, err = ref.NewImageDestination(ctx, &types.SystemContext{DirLayoutVersion: "3.0"})
+	assert.Error(t, err)
+
+	dest, err = ref.NewImageDestination(ctx, &types.SystemContext{DirLayoutVersion: LayoutVersion2})
+	require.NoError(t, err)
+	defer dest.Close()
+	assert.Equal(t, types.Compress, dest.DesiredLayerCompression())
+	gzipInfo, err := dest.PutBlob(ctx, bytes.NewReader(gzipBlob.Bytes()), types.BlobInfo{Size: -1}, cache, false)
+	require.NoError(t, err)
+	plainInfo, err := dest.PutBlob(ctx, bytes.NewReader(plainBlob), types.BlobInfo{Size: -1}, cache, true)
+	require.NoError(t, err)
+	err = dest.PutManifest(ctx, []byte("test-manifest"), nil)
+	require.NoError(t, err)
+	originalRef, _ := refToTempDir(t)
+	err = dest.Commit(ctx, fakeUnparsedImage{ref: originalRef})
+	require.NoError(t, err)
+
+	versionContents, err := os.ReadFile(ref.(dirReference).versionPath())
+	require.NoError(t, err)
+	assert.Equal(t, "Directory Transport Version: 2.0\n", string(versionContents))
+	metadata, err = ReadMetadata(ref)
+	require.NoError(t, err)
+	require.NotNil(t, metadata)
+	assert.False(t, metadata.Created.IsZero())
+	assert.Equal(t, "dir:"+originalRef.StringWithinTransport(), metadata.OriginalReference)
+	assert.Equal(t, map[digest.Digest]BlobMetadata{
+		gzipInfo.Digest:  {Size: int64(gzipBlob.Len()), Compression: "gzip"},
+		plainInfo.Digest: {Size: int64(len(plainBlob))},
+	}, metadata.Blobs)
+
+	// The image can be read as usual.
+	src, err := ref.NewImageSource(ctx, nil)
+	require.NoError(t, err)
+	defer src.Close()
+	rc, _, err := src.GetBlob(ctx, types.BlobInfo{Digest: gzipInfo.Digest, Size: -1}, cache)
+	require.NoError(t, err)
+	defer rc.Close()
+	contents, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, gzipBlob.Bytes(), contents)
+
+	// DirForceDecompress still applies.
+	dest2, err := ref.NewImageDestination(ctx, &types.SystemContext{DirLayoutVersion: LayoutVersion2, DirForceDecompress: true})
+	require.NoError(t, err)
+	defer dest2.Close()
+	assert.Equal(t, types.Decompress, dest2.DesiredLayerCompression())
+}
+
+// fakeUnparsedImage is a types.UnparsedImage which only implements Reference.
+type fakeUnparsedImage struct {
+	types.UnparsedImage
+	ref types.ImageReference
+}
+
+func (f fakeUnparsedImage) Reference() types.ImageReference {
+	return f.ref
+}
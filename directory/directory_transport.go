@@ -155,9 +155,22 @@ func (ref dirReference) NewImageDestination(ctx context.Context, sys *types.Syst
 	return newImageDestination(sys, ref)
 }
 
-// DeleteImage deletes the named image from the registry, if supported.
+// DeleteImage deletes the image, i.e. the contents of the directory; the directory itself is not removed.
+// It fails if the directory does not contain an image written by this transport.
 func (ref dirReference) DeleteImage(ctx context.Context, sys *types.SystemContext) error {
-	return errors.New("Deleting images not implemented for dir: images")
+	if _, err := readLayoutVersion(ref); err != nil {
+		return fmt.Errorf("deleting image in %q: %w", ref.path, err)
+	}
+	if err := removeDirContents(ref.path); err != nil {
+		return fmt.Errorf("deleting image in %q: %w", ref.path, err)
+	}
+	return nil
+}
+
+// SupportsDeleteImage returns true, DeleteImage is implemented.
+// This implements transports.DeletionSupportReporter.
+func (ref dirReference) SupportsDeleteImage() bool {
+	return true
 }
 
 // manifestPath returns a path for the manifest within a directory using our conventions.
@@ -186,3 +199,8 @@ func (ref dirReference) signaturePath(index int, instanceDigest *digest.Digest)
 func (ref dirReference) versionPath() string {
 	return filepath.Join(ref.path, "version")
 }
+
+// metadataPath returns a path for the metadata file, written in layout version 2.0, within a directory using our conventions.
+func (ref dirReference) metadataPath() string {
+	return filepath.Join(ref.path, "metadata.json")
+}
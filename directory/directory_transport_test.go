@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	_ "github.com/containers/image/v5/internal/testing/explicitfilepath-tmpdir"
+	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
@@ -151,9 +152,13 @@ func TestReferenceNewImage(t *testing.T) {
 	err = dest.Commit(context.Background(), nil) // nil unparsedToplevel is invalid, we don’t currently use the value
 	assert.NoError(t, err)
 
-	img, err := ref.NewImage(context.Background(), nil)
-	assert.NoError(t, err)
+	img, err := ref.NewImage(context.Background(), &types.SystemContext{DockerSchema1Mode: types.DockerSchema1ConvertOnly})
+	require.NoError(t, err)
 	defer img.Close()
+
+	// Schema1 manifests must be explicitly enabled.
+	_, err = ref.NewImage(context.Background(), nil)
+	assert.Error(t, err)
 }
 
 func TestReferenceNewImageNoValidManifest(t *testing.T) {
@@ -186,9 +191,31 @@ func TestReferenceNewImageDestination(t *testing.T) {
 }
 
 func TestReferenceDeleteImage(t *testing.T) {
-	ref, _ := refToTempDir(t)
-	err := ref.DeleteImage(context.Background(), nil)
+	ref, tmpDir := refToTempDir(t)
+	assert.True(t, transports.SupportsDeleteImage(ref))
+	// Directories which do not contain an image are not modified
+	err := os.WriteFile(filepath.Join(tmpDir, "unrelated"), []byte("data"), 0644)
+	require.NoError(t, err)
+	err = ref.DeleteImage(context.Background(), nil)
 	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(tmpDir, "unrelated"))
+	assert.NoError(t, err)
+	err = os.Remove(filepath.Join(tmpDir, "unrelated"))
+	require.NoError(t, err)
+
+	dest, err := ref.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	err = dest.PutManifest(context.Background(), []byte("manifest"), nil)
+	require.NoError(t, err)
+	err = dest.Commit(context.Background(), nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	require.NoError(t, err)
+	dest.Close()
+
+	err = ref.DeleteImage(context.Background(), nil)
+	require.NoError(t, err)
+	entries, err := os.ReadDir(tmpDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
 }
 
 func TestReferenceManifestPath(t *testing.T) {
@@ -228,3 +255,10 @@ func TestReferenceVersionPath(t *testing.T) {
 	require.True(t, ok)
 	assert.Equal(t, tmpDir+"/version", dirRef.versionPath())
 }
+
+func TestReferenceMetadataPath(t *testing.T) {
+	ref, tmpDir := refToTempDir(t)
+	dirRef, ok := ref.(dirReference)
+	require.True(t, ok)
+	assert.Equal(t, tmpDir+"/metadata.json", dirRef.metadataPath())
+}
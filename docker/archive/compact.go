@@ -0,0 +1,24 @@
+package archive
+
+import (
+	"github.com/containers/image/v5/docker/internal/tarfile"
+)
+
+// GarbageReport describes files in an archive which are not used by any image in it.
+type GarbageReport = tarfile.GarbageReport
+
+// PreviewCompaction returns a GarbageReport for the archive at path, describing the files Compact would remove
+// (e.g. files left behind by tools which modified the archive). The archive is not modified.
+// Compressed archives are not supported.
+func PreviewCompaction(path string) (GarbageReport, error) {
+	return tarfile.PreviewCompaction(path)
+}
+
+// Compact rewrites the archive at path so that it no longer contains files not used by any image in it,
+// and returns a GarbageReport describing the removed files.
+// The new archive is written to a temporary file in the same directory, which then atomically replaces the original,
+// so the archive is never left in a partially-written state.
+// Compressed archives are not supported.
+func Compact(path string) (GarbageReport, error) {
+	return tarfile.Compact(path)
+}
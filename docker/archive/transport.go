@@ -12,6 +12,7 @@ import (
 	ctrImage "github.com/containers/image/v5/internal/image"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
+	"golang.org/x/exp/slices"
 )
 
 func init() {
@@ -199,8 +200,49 @@ func (ref archiveReference) NewImageDestination(ctx context.Context, sys *types.
 	return newImageDestination(sys, ref)
 }
 
-// DeleteImage deletes the named image from the registry, if supported.
+// ListTags returns the tags of images in the archive which are in the same repository as the reference.
+// This implements transports.TagLister.
+func (ref archiveReference) ListTags(ctx context.Context, sys *types.SystemContext) ([]string, error) {
+	if ref.ref == nil {
+		return nil, fmt.Errorf("listing tags of %s: the reference does not specify a repository", transports.ImageName(ref))
+	}
+	archive := ref.archiveReader
+	if archive == nil {
+		a, err := tarfile.NewReaderFromFile(sys, ref.path)
+		if err != nil {
+			return nil, err
+		}
+		defer a.Close()
+		archive = a
+	}
+	res := []string{}
+	for _, item := range archive.Manifest {
+		for _, tag := range item.RepoTags {
+			parsedTag, err := reference.ParseNormalizedNamed(tag)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid tag %#v: %w", tag, err)
+			}
+			if nt, ok := parsedTag.(reference.NamedTagged); ok && nt.Name() == ref.ref.Name() && !slices.Contains(res, nt.Tag()) {
+				res = append(res, nt.Tag())
+			}
+		}
+	}
+	return res, nil
+}
+
+// DeleteImage deletes the image from the archive, by rewriting the archive without it.
+// If the reference uses a tag, and the image has other tags, only that tag is removed.
+// Compressed archives are not supported.
 func (ref archiveReference) DeleteImage(ctx context.Context, sys *types.SystemContext) error {
-	// Not really supported, for safety reasons.
-	return errors.New("Deleting images not implemented for docker-archive: images")
+	if !ref.SupportsDeleteImage() {
+		return fmt.Errorf("deleting images using a reference obtained from a docker-archive Reader or Writer is not supported: %s", transports.ImageName(ref))
+	}
+	return tarfile.DeleteImage(ref.path, ref.ref, ref.sourceIndex)
+}
+
+// SupportsDeleteImage returns true if DeleteImage is implemented for this reference.
+// This implements transports.DeletionSupportReporter.
+func (ref archiveReference) SupportsDeleteImage() bool {
+	// Rewriting the archive would invalidate the state of the Reader or Writer.
+	return ref.archiveReader == nil && ref.writer == nil
 }
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -265,6 +266,30 @@ func TestReferenceNewImageDestination(t *testing.T) {
 	defer dest.Close()
 }
 
+func TestReferenceListTags(t *testing.T) {
+	for _, c := range []struct {
+		suffix   string
+		expected []string // nil on error
+	}{
+		{":emptyimage:latest", []string{"latest"}},
+		{":emptyimage:other", []string{"latest"}},
+		{":busybox:latest", []string{}},
+		{"", nil},
+		{":@0", nil},
+	} {
+		ref, err := ParseReference(tarFixture + c.suffix)
+		require.NoError(t, err, c.suffix)
+		require.True(t, transports.SupportsTagListing(ref))
+		tags, err := transports.ListTags(context.Background(), nil, ref)
+		if c.expected == nil {
+			assert.Error(t, err, c.suffix)
+		} else {
+			require.NoError(t, err, c.suffix)
+			assert.Equal(t, c.expected, tags, c.suffix)
+		}
+	}
+}
+
 func TestReferenceDeleteImage(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -281,4 +306,28 @@ func TestReferenceDeleteImage(t *testing.T) {
 		_, err = os.Lstat(testFile)
 		assert.NoError(t, err, suffix)
 	}
+
+	fixture, err := os.ReadFile(tarFixture)
+	require.NoError(t, err)
+	testFile := filepath.Join(tmpDir, "archive.tar")
+	err = os.WriteFile(testFile, fixture, 0644)
+	require.NoError(t, err)
+	ref, err := ParseReference(testFile + ":emptyimage:latest")
+	require.NoError(t, err)
+	assert.True(t, transports.SupportsDeleteImage(ref))
+	err = ref.DeleteImage(context.Background(), nil)
+	require.NoError(t, err)
+	reader, err := NewReader(nil, testFile)
+	require.NoError(t, err)
+	defer reader.Close()
+	refs, err := reader.List()
+	require.NoError(t, err)
+	assert.Empty(t, refs)
+
+	// References bound to a Reader can't be used for deleting images
+	readerRef, err := newReference(testFile, nil, 0, reader.archive, nil)
+	require.NoError(t, err)
+	assert.False(t, transports.SupportsDeleteImage(readerRef))
+	err = readerRef.DeleteImage(context.Background(), nil)
+	assert.Error(t, err)
 }
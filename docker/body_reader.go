@@ -14,7 +14,7 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/sirupsen/logrus"
+	"github.com/containers/image/v5/types"
 )
 
 const (
@@ -29,6 +29,7 @@ const (
 type bodyReader struct {
 	ctx                 context.Context
 	c                   *dockerClient
+	logger              types.Logger
 	path                string   // path to pass to makeRequest to retry
 	logURL              *url.URL // a string to use in error messages
 	firstConnectionTime time.Time
@@ -40,10 +41,10 @@ type bodyReader struct {
 	lastSuccessTime time.Time     // time.Time{} if N/A
 }
 
-// newBodyReader creates a bodyReader for request path in c.
+// newBodyReader creates a bodyReader for request path in c, logging using logger.
 // firstBody is an already correctly opened body for the blob, returning the full blob from the start.
 // If reading from firstBody fails, bodyReader may heuristically decide to resume.
-func newBodyReader(ctx context.Context, c *dockerClient, path string, firstBody io.ReadCloser) (io.ReadCloser, error) {
+func newBodyReader(ctx context.Context, c *dockerClient, logger types.Logger, path string, firstBody io.ReadCloser) (io.ReadCloser, error) {
 	logURL, err := c.resolveRequestURL(path)
 	if err != nil {
 		return nil, err
@@ -51,6 +52,7 @@ func newBodyReader(ctx context.Context, c *dockerClient, path string, firstBody
 	res := &bodyReader{
 		ctx:                 ctx,
 		c:                   c,
+		logger:              logger,
 		path:                path,
 		logURL:              logURL,
 		firstConnectionTime: time.Now(),
@@ -155,7 +157,7 @@ func (br *bodyReader) Read(p []byte) (int, error) {
 		}
 
 		if err := br.body.Close(); err != nil {
-			logrus.Debugf("Error closing blob body: %v", err) // … and ignore err otherwise
+			br.logger.Debugf("Error closing blob body: %v", err) // … and ignore err otherwise
 		}
 		br.body = nil
 		time.Sleep(1*time.Second + time.Duration(rand.Intn(100_000))*time.Microsecond) // Some jitter so that a failure blip doesn’t cause a deterministic stampede
@@ -189,11 +191,11 @@ func (br *bodyReader) Read(p []byte) (int, error) {
 		case http.StatusOK:
 			return n, fmt.Errorf("%w (after reconnecting, server did not process a Range: header, status %d)", originalErr, http.StatusOK)
 		default:
-			err := registryHTTPResponseToError(res)
+			err := registryHTTPResponseToError(br.logger, res)
 			return n, fmt.Errorf("%w (after reconnecting, fetching blob: %v)", originalErr, err)
 		}
 
-		logrus.Debugf("Successfully reconnected to %s", redactedURL)
+		br.logger.Debugf("Successfully reconnected to %s", redactedURL)
 		consumedBody = true
 		br.body = res.Body
 		br.lastRetryOffset = br.offset
@@ -201,7 +203,7 @@ func (br *bodyReader) Read(p []byte) (int, error) {
 		return n, nil
 
 	default:
-		logrus.Debugf("Error reading blob body from %s: %#v", br.logURL.Redacted(), err)
+		br.logger.Debugf("Error reading blob body from %s: %#v", br.logURL.Redacted(), err)
 		return n, err
 	}
 }
@@ -222,22 +224,22 @@ func (br *bodyReader) errorIfNotReconnecting(originalErr error, redactedURL stri
 	msSinceFirstConnection := millisecondsSinceOptional(currentTime, br.firstConnectionTime)
 	msSinceLastRetry := millisecondsSinceOptional(currentTime, br.lastRetryTime)
 	msSinceLastSuccess := millisecondsSinceOptional(currentTime, br.lastSuccessTime)
-	logrus.Debugf("Reading blob body from %s failed (%#v), decision inputs: total %d @%.3f ms, last retry %d @%.3f ms, last progress @%.3f ms",
+	br.logger.Debugf("Reading blob body from %s failed (%#v), decision inputs: total %d @%.3f ms, last retry %d @%.3f ms, last progress @%.3f ms",
 		redactedURL, originalErr, br.offset, msSinceFirstConnection, br.lastRetryOffset, msSinceLastRetry, msSinceLastSuccess)
 	progress := br.offset - br.lastRetryOffset
 	if progress >= bodyReaderMinimumProgress {
-		logrus.Infof("Reading blob body from %s failed (%v), reconnecting after %d bytes…", redactedURL, originalErr, progress)
+		br.logger.Infof("Reading blob body from %s failed (%v), reconnecting after %d bytes…", redactedURL, originalErr, progress)
 		return nil
 	}
 	if br.lastRetryTime == (time.Time{}) {
-		logrus.Infof("Reading blob body from %s failed (%v), reconnecting (first reconnection)…", redactedURL, originalErr)
+		br.logger.Infof("Reading blob body from %s failed (%v), reconnecting (first reconnection)…", redactedURL, originalErr)
 		return nil
 	}
 	if msSinceLastRetry >= bodyReaderMSSinceLastRetry {
-		logrus.Infof("Reading blob body from %s failed (%v), reconnecting after %.3f ms…", redactedURL, originalErr, msSinceLastRetry)
+		br.logger.Infof("Reading blob body from %s failed (%v), reconnecting after %.3f ms…", redactedURL, originalErr, msSinceLastRetry)
 		return nil
 	}
-	logrus.Debugf("Not reconnecting to %s: insufficient progress %d / time since last retry %.3f ms", redactedURL, progress, msSinceLastRetry)
+	br.logger.Debugf("Not reconnecting to %s: insufficient progress %d / time since last retry %.3f ms", redactedURL, progress, msSinceLastRetry)
 	return fmt.Errorf("(heuristic tuning data: total %d @%.3f ms, last retry %d @%.3f ms, last progress @ %.3f ms): %w",
 		br.offset, msSinceFirstConnection, br.lastRetryOffset, msSinceLastRetry, msSinceLastSuccess, originalErr)
 }
@@ -7,7 +7,7 @@ import (
 	"testing"
 	"time"
 
-	"github.com/sirupsen/logrus"
+	"github.com/containers/image/v5/pkg/logging"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -123,13 +123,6 @@ func TestMillisecondsSinceOptional(t *testing.T) {
 }
 
 func TestBodyReaderErrorIfNotReconnecting(t *testing.T) {
-	// Silence logrus.Info logs in the tested method
-	prevLevel := logrus.StandardLogger().Level
-	logrus.StandardLogger().SetLevel(logrus.WarnLevel)
-	t.Cleanup(func() {
-		logrus.StandardLogger().SetLevel(prevLevel)
-	})
-
 	for _, c := range []struct {
 		name            string
 		previousRetry   bool
@@ -174,7 +167,7 @@ func TestBodyReaderErrorIfNotReconnecting(t *testing.T) {
 		},
 	} {
 		tm := time.Now()
-		br := bodyReader{}
+		br := bodyReader{logger: logging.Discard()}
 		if c.previousRetry {
 			br.lastRetryOffset = 2 * bodyReaderMinimumProgress
 			br.offset = br.lastRetryOffset + c.currentOffset
@@ -0,0 +1,176 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// ContentRouter can provide blobs from a source other than the registry, e.g. a peer-to-peer distribution system
+// like Dragonfly or Spegel. Registered content routers are consulted before downloading a blob from a registry.
+//
+// Blobs provided by a ContentRouter are verified against the expected digest. If a ContentRouter does not provide a blob,
+// fails, or provides a blob of an unexpected size, the blob is downloaded from the registry instead; if reading a blob
+// from a ContentRouter fails, the rest of the blob is downloaded from the registry.
+type ContentRouter interface {
+	// GetBlob returns a stream for the blob with info.Digest in repo (a repository name without a tag or digest),
+	// and the blob’s size (or -1 if unknown); or (nil, -1, nil) if the blob is not available from this router.
+	GetBlob(ctx context.Context, repo reference.Named, info types.BlobInfo) (io.ReadCloser, int64, error)
+}
+
+// registeredContentRouters contains ContentRouters registered using RegisterContentRouter, in registration order.
+var registeredContentRouters = struct {
+	mutex   sync.Mutex
+	routers []ContentRouter
+}{}
+
+// RegisterContentRouter registers router to be consulted before downloading blobs from registries,
+// after any previously registered routers.
+// Content routers are not used if SystemContext.DockerDisableContentRouters is set.
+func RegisterContentRouter(router ContentRouter) {
+	registeredContentRouters.mutex.Lock()
+	defer registeredContentRouters.mutex.Unlock()
+	registeredContentRouters.routers = append(registeredContentRouters.routers, router)
+}
+
+// contentRouters returns the registered content routers.
+func contentRouters() []ContentRouter {
+	registeredContentRouters.mutex.Lock()
+	defer registeredContentRouters.mutex.Unlock()
+	return append([]ContentRouter{}, registeredContentRouters.routers...)
+}
+
+// getBlobFromContentRouters returns a stream for the blob described by info in ref, and the blob’s size (or -1 if unknown),
+// from the first registered content router which provides it; or (nil, -1) if no content router provides the blob.
+// path is the registry path of the blob, used if the content router fails.
+func (c *dockerClient) getBlobFromContentRouters(ctx context.Context, ref dockerReference, info types.BlobInfo, path string) (io.ReadCloser, int64) {
+	if (c.sys != nil && c.sys.DockerDisableContentRouters) || info.Digest.Validate() != nil {
+		return nil, -1
+	}
+	repo := reference.TrimNamed(ref.ref)
+	for _, router := range contentRouters() {
+		stream, size, err := router.GetBlob(ctx, repo, info)
+		if err != nil {
+			c.logger.Debugf("Content router %T failed to provide blob %s, ignoring: %v", router, info.Digest, err)
+			continue
+		}
+		if stream == nil {
+			continue
+		}
+		if info.Size != -1 && size != -1 && size != info.Size {
+			c.logger.Debugf("Content router %T provided blob %s with size %d, expected %d, ignoring", router, info.Digest, size, info.Size)
+			stream.Close()
+			continue
+		}
+		c.logger.Debugf("Downloading blob %s using content router %T", info.Digest, router)
+		if size == -1 {
+			size = info.Size
+		}
+		return &contentRouterReader{
+			ctx:      ctx,
+			c:        c,
+			path:     path,
+			router:   router,
+			info:     info,
+			body:     stream,
+			digester: info.Digest.Algorithm().Digester(),
+		}, size
+	}
+	return nil, -1
+}
+
+// contentRouterReader is an io.ReadCloser for a blob provided by a content router, which verifies the blob’s digest,
+// and falls back to reading the rest of the blob from the registry if reading from the router fails.
+type contentRouterReader struct {
+	ctx          context.Context
+	c            *dockerClient
+	path         string
+	router       ContentRouter
+	info         types.BlobInfo
+	body         io.ReadCloser
+	fromRegistry bool // body is reading from the registry
+	digester     digest.Digester
+	offset       int64
+}
+
+func (r *contentRouterReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.digester.Hash().Write(p[:n]) // Never fails
+	r.offset += int64(n)
+	switch {
+	case err == io.EOF:
+		if r.info.Size != -1 && r.offset != r.info.Size {
+			return n, fmt.Errorf("blob %s provided by content router %T has size %d, expected %d", r.info.Digest, r.router, r.offset, r.info.Size)
+		}
+		if actual := r.digester.Digest(); actual != r.info.Digest {
+			return n, fmt.Errorf("blob %s provided by content router %T has digest %s", r.info.Digest, r.router, actual)
+		}
+		return n, io.EOF
+	case err != nil && !r.fromRegistry:
+		r.c.logger.Debugf("Reading blob %s from content router %T failed at offset %d, continuing from the registry: %v", r.info.Digest, r.router, r.offset, err)
+		r.body.Close()
+		body, registryErr := r.openRegistryAt(r.offset)
+		if registryErr != nil {
+			r.body = io.NopCloser(eofReader{})
+			return n, fmt.Errorf("reading blob %s from content router %T: %w (falling back to the registry: %v)", r.info.Digest, r.router, err, registryErr)
+		}
+		r.body = body
+		r.fromRegistry = true
+		return n, nil
+	default:
+		return n, err
+	}
+}
+
+// eofReader is an io.Reader which is always at EOF.
+type eofReader struct{}
+
+func (eofReader) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+// openRegistryAt returns a stream for the blob from the registry, starting at offset.
+func (r *contentRouterReader) openRegistryAt(offset int64) (io.ReadCloser, error) {
+	r.c.logger.Debugf("Downloading %s starting at offset %d", r.path, offset)
+	headers := map[string][]string{}
+	if offset != 0 {
+		headers["Range"] = []string{fmt.Sprintf("bytes=%d-", offset)}
+	}
+	res, err := r.c.makeRequest(r.ctx, http.MethodGet, r.path, headers, nil, v2Auth, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+		// The registry ignored the Range header; skip the data we already have.
+		if _, err := io.CopyN(io.Discard, res.Body, offset); err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+		return res.Body, nil
+	case http.StatusPartialContent:
+		first, _, _, err := parseContentRange(res)
+		if err == nil && first != offset {
+			err = fmt.Errorf("unexpected Content-Range starting at %d, expected %d", first, offset)
+		}
+		if err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+		return res.Body, nil
+	default:
+		err := registryHTTPResponseToError(r.c.logger, res)
+		res.Body.Close()
+		return nil, fmt.Errorf("fetching blob: %w", err)
+	}
+}
+
+func (r *contentRouterReader) Close() error {
+	return r.body.Close()
+}
@@ -0,0 +1,171 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// contentRouterFunc is a ContentRouter implemented by a function.
+type contentRouterFunc func(ctx context.Context, repo reference.Named, info types.BlobInfo) (io.ReadCloser, int64, error)
+
+func (f contentRouterFunc) GetBlob(ctx context.Context, repo reference.Named, info types.BlobInfo) (io.ReadCloser, int64, error) {
+	return f(ctx, repo, info)
+}
+
+// withContentRouters runs fn with only routers registered.
+func withContentRouters(t *testing.T, routers []ContentRouter, fn func()) {
+	registeredContentRouters.mutex.Lock()
+	saved := registeredContentRouters.routers
+	registeredContentRouters.routers = nil
+	registeredContentRouters.mutex.Unlock()
+	defer func() {
+		registeredContentRouters.mutex.Lock()
+		registeredContentRouters.routers = saved
+		registeredContentRouters.mutex.Unlock()
+	}()
+	for _, r := range routers {
+		RegisterContentRouter(r)
+	}
+	fn()
+}
+
+func TestContentRouters(t *testing.T) {
+	blob := []byte(strings.Repeat("blob contents ", 1000))
+	blobDigest := digest.FromBytes(blob)
+	otherBlob := bytes.Repeat([]byte{'x'}, len(blob))
+
+	var registryLock sync.Mutex
+	registryBlobRequests := 0
+	var registryRanges []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/ns/repo/manifests/tag":
+			rw.WriteHeader(http.StatusOK)
+			// Empty body is good enough for this test
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/ns/repo/blobs/"+blobDigest.String():
+			registryLock.Lock()
+			registryBlobRequests++
+			registryRanges = append(registryRanges, r.Header.Get("Range"))
+			registryLock.Unlock()
+			http.ServeContent(rw, r, "", time.Time{}, bytes.NewReader(blob))
+		default:
+			rw.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	registryURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	err = os.WriteFile(registriesConf, []byte{}, 0o600)
+	require.NoError(t, err)
+
+	ref, err := ParseReference("//" + registryURL.Host + "/ns/repo:tag")
+	require.NoError(t, err)
+	info := types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}
+
+	getBlob := func(sys *types.SystemContext) ([]byte, int64, error) {
+		if sys == nil {
+			sys = &types.SystemContext{}
+		}
+		sys.RegistriesDirPath = "/this/does/not/exist"
+		sys.DockerPerHostCertDirPath = "/this/does/not/exist"
+		sys.SystemRegistriesConfPath = registriesConf
+		sys.DockerInsecureSkipTLSVerify = types.OptionalBoolTrue
+		src, err := ref.NewImageSource(context.Background(), sys)
+		require.NoError(t, err)
+		defer src.Close()
+		stream, size, err := src.GetBlob(context.Background(), info, none.NoCache)
+		require.NoError(t, err)
+		defer stream.Close()
+		data, err := io.ReadAll(stream)
+		return data, size, err
+	}
+
+	var seenRepo string
+	serving := func(data []byte, size int64) ContentRouter {
+		return contentRouterFunc(func(ctx context.Context, repo reference.Named, info types.BlobInfo) (io.ReadCloser, int64, error) {
+			seenRepo = repo.String()
+			return io.NopCloser(bytes.NewReader(data)), size, nil
+		})
+	}
+	missing := contentRouterFunc(func(ctx context.Context, repo reference.Named, info types.BlobInfo) (io.ReadCloser, int64, error) {
+		return nil, -1, nil
+	})
+	failing := contentRouterFunc(func(ctx context.Context, repo reference.Named, info types.BlobInfo) (io.ReadCloser, int64, error) {
+		return nil, -1, errors.New("peer unavailable")
+	})
+	failingAfter := func(n int) ContentRouter {
+		return contentRouterFunc(func(ctx context.Context, repo reference.Named, info types.BlobInfo) (io.ReadCloser, int64, error) {
+			return io.NopCloser(io.MultiReader(bytes.NewReader(blob[:n]), iotest.ErrReader(errors.New("peer went away")))), int64(len(blob)), nil
+		})
+	}
+
+	for _, c := range []struct {
+		name              string
+		routers           []ContentRouter
+		sys               *types.SystemContext
+		registryRequests  int
+		registryRange     string
+		expectedReadError bool
+	}{
+		{name: "no routers", routers: nil, registryRequests: 1},
+		{name: "router provides the blob", routers: []ContentRouter{serving(blob, int64(len(blob)))}, registryRequests: 0},
+		{name: "unknown size", routers: []ContentRouter{serving(blob, -1)}, registryRequests: 0},
+		{name: "missing, then found", routers: []ContentRouter{missing, failing, serving(blob, int64(len(blob)))}, registryRequests: 0},
+		{name: "missing everywhere", routers: []ContentRouter{missing, failing}, registryRequests: 1},
+		{name: "size mismatch", routers: []ContentRouter{serving(blob[:10], 10)}, registryRequests: 1},
+		{name: "disabled", routers: []ContentRouter{serving(blob, int64(len(blob)))},
+			sys: &types.SystemContext{DockerDisableContentRouters: true}, registryRequests: 1},
+		{name: "failure mid-stream", routers: []ContentRouter{failingAfter(100)}, registryRequests: 1, registryRange: "bytes=100-"},
+		{name: "failure at start", routers: []ContentRouter{failingAfter(0)}, registryRequests: 1, registryRange: ""},
+		{name: "corrupt blob", routers: []ContentRouter{serving(otherBlob, int64(len(otherBlob)))}, registryRequests: 0,
+			expectedReadError: true},
+	} {
+		withContentRouters(t, c.routers, func() {
+			registryLock.Lock()
+			registryBlobRequests = 0
+			registryRanges = nil
+			registryLock.Unlock()
+			seenRepo = ""
+			data, size, err := getBlob(c.sys)
+			if c.expectedReadError {
+				assert.Error(t, err, c.name)
+			} else {
+				require.NoError(t, err, c.name)
+				assert.Equal(t, blob, data, c.name)
+				assert.Equal(t, int64(len(blob)), size, c.name)
+			}
+			registryLock.Lock()
+			defer registryLock.Unlock()
+			assert.Equal(t, c.registryRequests, registryBlobRequests, c.name)
+			if c.registryRequests != 0 && c.registryRange != "" {
+				assert.Equal(t, []string{c.registryRange}, registryRanges, c.name)
+			}
+			if c.registryRequests == 0 {
+				assert.Equal(t, registryURL.Host+"/ns/repo", seenRepo, c.name)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"path/filepath"
 
+	"github.com/containers/image/v5/pkg/tlsclientconfig"
 	"github.com/containers/image/v5/types"
 	dockerclient "github.com/docker/docker/client"
 	"github.com/docker/go-connections/tlsconfig"
@@ -82,6 +83,9 @@ func tlsConfig(sys *types.SystemContext) (*http.Client, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := tlsclientconfig.SetupPolicy(sys, tlsc); err != nil {
+		return nil, err
+	}
 
 	return &http.Client{
 		Transport: &http.Transport{
@@ -139,6 +139,12 @@ func (ref daemonReference) DockerReference() reference.Named {
 	return ref.ref // May be nil
 }
 
+// MetadataRequiresLayerAccess returns true because the whole image is exported from the daemon when creating an ImageSource.
+// This implements private.MetadataAccessCostReporter.
+func (ref daemonReference) MetadataRequiresLayerAccess() bool {
+	return true
+}
+
 // PolicyConfigurationIdentity returns a string representation of the reference, suitable for policy lookup.
 // This MUST reflect user intent, not e.g. after processing of third-party redirects or aliases;
 // The value SHOULD be fully explicit about its semantics, with no hidden defaults, AND canonical
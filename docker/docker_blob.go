@@ -0,0 +1,79 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/containers/image/v5/internal/blobtransfer"
+	"github.com/containers/image/v5/internal/digests"
+	"github.com/containers/image/v5/types"
+)
+
+// PullBlob returns a stream for the blob with info.Digest in the repository of ref, and its size (or -1 if unknown).
+// Only the repository of ref is used; its tag or digest, if any, is ignored.
+// The contents of the stream are verified against info.Digest; the stream returns an error instead of io.EOF if they don't match.
+// If cache is nil, the default cache for sys is used.
+// The caller must call .Close() on the returned stream.
+// NOTE: Mirror configuration is ignored.
+func PullBlob(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	dr, ok := ref.(dockerReference)
+	if !ok {
+		return nil, 0, errors.New("ref must be a dockerReference")
+	}
+	if err := digests.ValidateAlgorithm(sys, info.Digest.Algorithm()); err != nil {
+		return nil, 0, err
+	}
+
+	registryConfig, err := loadRegistryConfiguration(sys)
+	if err != nil {
+		return nil, 0, err
+	}
+	client, err := newDockerClientFromRef(sys, dr, registryConfig, false, "pull")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to create client: %w", err)
+	}
+	stream, size, err := client.getBlob(ctx, dr, info, blobtransfer.Cache(sys, cache))
+	if err != nil {
+		client.Close()
+		return nil, 0, err
+	}
+	verifier, err := blobtransfer.NewVerifyingReader(&clientClosingReader{ReadCloser: stream, client: client}, info.Digest)
+	if err != nil {
+		stream.Close()
+		client.Close()
+		return nil, 0, err
+	}
+	return verifier, size, nil
+}
+
+// PushBlob uploads stream, which must match info.Digest, to the repository of ref, unless the repository already contains that blob;
+// if cache knows about the blob in another repository of the same registry, the blob may be mounted from there instead.
+// Only the repository of ref is used; its tag or digest, if any, is ignored.
+// If cache is nil, the default cache for sys is used.
+// It returns the digest and size of the blob in the repository.
+func PushBlob(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, stream io.Reader, info types.BlobInfo, cache types.BlobInfoCache) (types.BlobInfo, error) {
+	dr, ok := ref.(dockerReference)
+	if !ok {
+		return types.BlobInfo{}, errors.New("ref must be a dockerReference")
+	}
+	dest, err := newImageDestination(sys, dr)
+	if err != nil {
+		return types.BlobInfo{}, err
+	}
+	defer dest.Close()
+	return blobtransfer.PutBlob(ctx, sys, dest, stream, info, cache)
+}
+
+// clientClosingReader is an io.ReadCloser which also closes client when closed.
+type clientClosingReader struct {
+	io.ReadCloser
+	client *dockerClient
+}
+
+func (r *clientClosingReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.client.Close()
+	return err
+}
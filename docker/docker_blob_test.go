@@ -0,0 +1,199 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blobTestRegistry is a minimal registry which stores blobs, and optionally manifests, in memory, in a single repository, ns/repo.
+type blobTestRegistry struct {
+	mutex     sync.Mutex
+	blobs     map[digest.Digest][]byte
+	upload    []byte
+	uploads   int                         // Number of finished uploads
+	manifests map[string]blobTestManifest // Indexed by tag or digest; nil if manifests are not supported
+	failTag   string                      // If not "", requests for the manifest with this tag fail
+	referrers bool                        // If set, the referrers API is supported
+}
+
+// blobTestManifest is a manifest stored in blobTestRegistry.
+type blobTestManifest struct {
+	mimeType string
+	data     []byte
+}
+
+func (reg *blobTestRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	reg.mutex.Lock()
+	defer reg.mutex.Unlock()
+	const blobsPrefix = "/v2/ns/repo/blobs/"
+	const manifestsPrefix = "/v2/ns/repo/manifests/"
+	const referrersPrefix = "/v2/ns/repo/referrers/"
+	switch {
+	case r.URL.Path == "/v2/":
+		w.WriteHeader(http.StatusOK)
+	case reg.referrers && strings.HasPrefix(r.URL.Path, referrersPrefix) && r.Method == http.MethodGet:
+		subject := digest.Digest(strings.TrimPrefix(r.URL.Path, referrersPrefix))
+		index := imgspecv1.Index{
+			Versioned: imgspecs.Versioned{SchemaVersion: 2},
+			MediaType: imgspecv1.MediaTypeImageIndex,
+			Manifests: []imgspecv1.Descriptor{},
+		}
+		for reference, m := range reg.manifests {
+			d := digest.FromBytes(m.data)
+			var parsed imgspecv1.Manifest
+			if reference != d.String() || json.Unmarshal(m.data, &parsed) != nil ||
+				parsed.Subject == nil || parsed.Subject.Digest != subject {
+				continue
+			}
+			index.Manifests = append(index.Manifests, imgspecv1.Descriptor{
+				MediaType:    m.mimeType,
+				ArtifactType: parsed.ArtifactType,
+				Digest:       d,
+				Size:         int64(len(m.data)),
+			})
+		}
+		w.Header().Set("Content-Type", imgspecv1.MediaTypeImageIndex)
+		w.WriteHeader(http.StatusOK)
+		_ = json.NewEncoder(w).Encode(index)
+	case reg.manifests != nil && strings.HasPrefix(r.URL.Path, manifestsPrefix):
+		reference := strings.TrimPrefix(r.URL.Path, manifestsPrefix)
+		switch {
+		case reference == reg.failTag:
+			w.WriteHeader(http.StatusInternalServerError)
+		case r.Method == http.MethodPut:
+			data, err := io.ReadAll(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			m := blobTestManifest{mimeType: r.Header.Get("Content-Type"), data: data}
+			d := digest.FromBytes(data)
+			reg.manifests[reference] = m
+			reg.manifests[d.String()] = m
+			var parsed imgspecv1.Manifest
+			if reg.referrers && json.Unmarshal(data, &parsed) == nil && parsed.Subject != nil {
+				w.Header().Set("OCI-Subject", parsed.Subject.Digest.String())
+			}
+			w.Header().Set("Docker-Content-Digest", d.String())
+			w.WriteHeader(http.StatusCreated)
+		case r.Method == http.MethodGet || r.Method == http.MethodHead:
+			m, ok := reg.manifests[reference]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", m.mimeType)
+			w.Header().Set("Content-Length", strconv.Itoa(len(m.data)))
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(m.data).String())
+			w.WriteHeader(http.StatusOK)
+			if r.Method == http.MethodGet {
+				_, _ = w.Write(m.data)
+			}
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	case r.URL.Path == blobsPrefix+"uploads/" && r.Method == http.MethodPost:
+		reg.upload = nil
+		w.Header().Set("Location", "/upload")
+		w.WriteHeader(http.StatusAccepted)
+	case r.URL.Path == "/upload" && r.Method == http.MethodPatch:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reg.upload = append(reg.upload, data...)
+		w.Header().Set("Location", "/upload")
+		w.WriteHeader(http.StatusAccepted)
+	case r.URL.Path == "/upload" && r.Method == http.MethodPut:
+		d := digest.Digest(r.URL.Query().Get("digest"))
+		if d != digest.FromBytes(reg.upload) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		reg.blobs[d] = reg.upload
+		reg.uploads++
+		w.WriteHeader(http.StatusCreated)
+	case strings.HasPrefix(r.URL.Path, blobsPrefix) && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		blob, ok := reg.blobs[digest.Digest(strings.TrimPrefix(r.URL.Path, blobsPrefix))]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(blob)))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(blob)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPushPullBlob(t *testing.T) {
+	blob := []byte("artifact contents")
+	info := types.BlobInfo{Digest: digest.FromBytes(blob), Size: int64(len(blob))}
+	cache := memory.New()
+
+	reg := &blobTestRegistry{blobs: map[digest.Digest][]byte{}}
+	s := httptest.NewServer(reg)
+	defer s.Close()
+	registry := strings.TrimPrefix(s.URL, "http://")
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}
+	ref, err := ParseReference("//" + registry + "/ns/repo:latest")
+	require.NoError(t, err)
+
+	res, err := PushBlob(context.Background(), sys, ref, bytes.NewReader(blob), info, cache)
+	require.NoError(t, err)
+	assert.Equal(t, info, res)
+	assert.Equal(t, blob, reg.blobs[info.Digest])
+	assert.Equal(t, 1, reg.uploads)
+
+	// The blob already exists; it is not uploaded again.
+	res, err = PushBlob(context.Background(), sys, ref, bytes.NewReader(nil), info, cache)
+	require.NoError(t, err)
+	assert.Equal(t, info, res)
+	assert.Equal(t, 1, reg.uploads)
+
+	stream, size, err := PullBlob(context.Background(), sys, ref, info, cache)
+	require.NoError(t, err)
+	contents, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	assert.NoError(t, stream.Close())
+	assert.Equal(t, blob, contents)
+	assert.Equal(t, int64(len(blob)), size)
+
+	// Contents not matching the digest
+	other := []byte("other contents")
+	otherInfo := types.BlobInfo{Digest: digest.FromBytes(other), Size: int64(len(other))}
+	reg.blobs[otherInfo.Digest] = blob
+	stream, _, err = PullBlob(context.Background(), sys, ref, otherInfo, cache)
+	require.NoError(t, err)
+	_, err = io.ReadAll(stream)
+	assert.Error(t, err)
+	stream.Close()
+
+	// Missing blobs
+	_, _, err = PullBlob(context.Background(), sys, ref, types.BlobInfo{Digest: digest.FromString("missing"), Size: -1}, cache)
+	assert.ErrorIs(t, err, types.ErrNotFound)
+}
@@ -19,9 +19,12 @@ import (
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/iolimits"
 	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/image/v5/internal/tracing"
 	"github.com/containers/image/v5/internal/useragent"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/pkg/metrics"
 	"github.com/containers/image/v5/pkg/sysregistriesv2"
 	"github.com/containers/image/v5/pkg/tlsclientconfig"
 	"github.com/containers/image/v5/types"
@@ -31,7 +34,8 @@ import (
 	"github.com/docker/go-connections/tlsconfig"
 	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
-	"github.com/sirupsen/logrus"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"golang.org/x/exp/slices"
 )
 
 const (
@@ -48,6 +52,15 @@ const (
 	extensionsSignaturePath = "/extensions/v2/%s/signatures/%s"
 
 	minimumTokenLifetimeSeconds = 60
+	// credentialsRefreshMargin is how long before their expiration credentials are refreshed using
+	// types.SystemContext.DockerCredentialsRefresh, so that they don’t expire while they are being used.
+	credentialsRefreshMargin = 5 * time.Minute
+	// credentialsRefreshMinBackoff and credentialsRefreshMaxBackoff limit how long types.SystemContext.DockerCredentialsRefresh
+	// is not called again after it fails, or returns credentials which also expire within credentialsRefreshMargin.
+	credentialsRefreshMinBackoff = 5 * time.Second
+	credentialsRefreshMaxBackoff = time.Minute
+	// spiffeFetchTimeout is how long to wait for the first X.509-SVID from types.SystemContext.DockerSPIFFEEndpointSocket.
+	spiffeFetchTimeout = 30 * time.Second
 
 	extensionSignatureSchemaVersion = 2        // extensionSignature.Version
 	extensionSignatureTypeAtomic    = "atomic" // extensionSignature.Type
@@ -89,6 +102,7 @@ type bearerToken struct {
 	AccessToken    string    `json:"access_token"`
 	ExpiresIn      int       `json:"expires_in"`
 	IssuedAt       time.Time `json:"issued_at"`
+	RefreshToken   string    `json:"refresh_token"` // Only set by some OAuth2 token endpoints, if the identity token was rotated
 	expirationTime time.Time
 }
 
@@ -98,16 +112,30 @@ type dockerClient struct {
 	sys       *types.SystemContext
 	registry  string
 	userAgent string
+	logger    types.Logger
+	metrics   types.Metrics
+	// rateLimiter is consulted before each request to the registry, or nil.
+	rateLimiter types.RegistryRateLimiter
 
 	// tlsClientConfig is setup by newDockerClient and will be used and updated
 	// by detectProperties(). Callers can edit tlsClientConfig.InsecureSkipVerify in the meantime.
+	// It does not include certificates from the per-host certificate directory; those are in certificates.
 	tlsClientConfig *tls.Config
+	// certificates contains certificates from the per-host certificate directory, which are reloaded if they change.
+	certificates *tlsclientconfig.ReloadingConfig
+	// pinnedPublicKeys is setup by newDockerClient and will be used by detectProperties(), unless overridden
+	// by sys.DockerPinnedPublicKeys. Callers can edit it in the meantime.
+	pinnedPublicKeys []string
 	// The following members are not set by newDockerClient and must be set by callers if needed.
-	auth                   types.DockerAuthConfig
-	registryToken          string
-	signatureBase          lookasideStorageBase
-	useSigstoreAttachments bool
-	scope                  authScope
+	auth                       types.DockerAuthConfig
+	authKey                    string // The credential key rotated identity tokens are persisted for, or "" if they must not be persisted
+	authLookupKey              string // The key auth was looked up for, passed to sys.DockerCredentialsRefresh
+	registryToken              string
+	signatureBase              lookasideStorageBase
+	useSigstoreAttachments     bool
+	discoverSigstoreSignatures bool // If set, useSigstoreAttachments is false but sigstore signatures are read anyway; they are never written.
+	useSigstoreReferrers       bool // If set, useSigstoreAttachments is true, and sigstore signatures are stored as OCI referrers.
+	scope                      authScope
 
 	// The following members are detected registry properties:
 	// They are set after a successful detectProperties(), and never change afterwards.
@@ -118,6 +146,12 @@ type dockerClient struct {
 
 	// Private state for setupRequestAuth (key: string, value: bearerToken)
 	tokenCache sync.Map
+	// Private state protecting auth, which may be rotated or refreshed after the client was created
+	authLock sync.Mutex
+	// Private state for currentAuth, protected by authLock
+	authRefreshDone      chan struct{} // Non-nil while sys.DockerCredentialsRefresh is being called; closed when it returns
+	authRefreshBackoff   time.Duration // The current backoff after unsuccessful refreshes, or 0
+	authRefreshNotBefore time.Time     // Don’t call sys.DockerCredentialsRefresh again before this time
 	// Private state for detectProperties:
 	detectPropertiesOnce  sync.Once // detectPropertiesOnce is used to execute detectProperties() at most once.
 	detectPropertiesError error     // detectPropertiesError caches the initial error.
@@ -145,7 +179,7 @@ const (
 	noAuth
 )
 
-func newBearerTokenFromJSONBlob(blob []byte) (*bearerToken, error) {
+func newBearerTokenFromJSONBlob(logger types.Logger, blob []byte) (*bearerToken, error) {
 	token := new(bearerToken)
 	if err := json.Unmarshal(blob, &token); err != nil {
 		return nil, err
@@ -155,7 +189,7 @@ func newBearerTokenFromJSONBlob(blob []byte) (*bearerToken, error) {
 	}
 	if token.ExpiresIn < minimumTokenLifetimeSeconds {
 		token.ExpiresIn = minimumTokenLifetimeSeconds
-		logrus.Debugf("Increasing token expiration to: %d seconds", token.ExpiresIn)
+		logger.Debugf("Increasing token expiration to: %d seconds", token.ExpiresIn)
 	}
 	if token.IssuedAt.IsZero() {
 		token.IssuedAt = time.Now().UTC()
@@ -164,7 +198,7 @@ func newBearerTokenFromJSONBlob(blob []byte) (*bearerToken, error) {
 	return token, nil
 }
 
-// dockerCertDir returns a path to a directory to be consumed by tlsclientconfig.SetupCertificates() depending on ctx and hostPort.
+// dockerCertDir returns a path to a directory to be consumed by tlsclientconfig.NewReloadingConfig() depending on ctx and hostPort.
 func dockerCertDir(sys *types.SystemContext, hostPort string) (string, error) {
 	if sys != nil && sys.DockerCertPath != "" {
 		return sys.DockerCertPath, nil
@@ -194,7 +228,7 @@ func dockerCertDir(sys *types.SystemContext, hostPort string) (string, error) {
 			continue
 		}
 		if os.IsPermission(err) {
-			logrus.Debugf("error accessing certs directory due to permissions: %v", err)
+			logging.For(sys).Debugf("error accessing certs directory due to permissions: %v", err)
 			continue
 		}
 		return "", err
@@ -207,27 +241,54 @@ func dockerCertDir(sys *types.SystemContext, hostPort string) (string, error) {
 // signatureBase is always set in the return value
 // The caller must call .Close() on the returned client when done.
 func newDockerClientFromRef(sys *types.SystemContext, ref dockerReference, registryConfig *registryConfiguration, write bool, actions string) (*dockerClient, error) {
-	auth, err := config.GetCredentialsForRef(sys, ref.ref)
+	auth, authSource, err := config.GetCredentialsForRefWithSource(sys, ref.ref)
 	if err != nil {
 		return nil, fmt.Errorf("getting username and password: %w", err)
 	}
+	return newDockerClientFromRefWithAuth(sys, ref, auth, authSource, registryConfig, write, actions)
+}
 
-	sigBase, err := registryConfig.lookasideStorageBaseURL(ref, write)
+// newDockerClientFromRefWithAuth is like newDockerClientFromRef, but uses auth, found in authSource, which the caller has already looked up for ref.
+func newDockerClientFromRefWithAuth(sys *types.SystemContext, ref dockerReference, auth types.DockerAuthConfig, authSource config.CredentialsSource,
+	registryConfig *registryConfiguration, write bool, actions string) (*dockerClient, error) {
+	registry := reference.Domain(ref.ref)
+	client, err := newDockerClient(sys, registry, ref.ref.Name())
 	if err != nil {
 		return nil, err
 	}
-
-	registry := reference.Domain(ref.ref)
-	client, err := newDockerClient(sys, registry, ref.ref.Name())
+	sigBase, err := registryConfig.lookasideStorageBaseURL(client.logger, ref, write)
 	if err != nil {
+		client.Close()
 		return nil, err
 	}
+	if auth.ClientCertificatePath != "" {
+		if sys != nil && sys.DockerSPIFFEEndpointSocket != "" {
+			// The X.509-SVIDs would be used instead of the certificate.
+			client.Close()
+			return nil, fmt.Errorf("client certificate %s for %s can not be used with X.509-SVIDs from %s", auth.ClientCertificatePath, ref.ref.Name(), sys.DockerSPIFFEEndpointSocket)
+		}
+		client.logger.Debugf("Using client certificate %s for %s", auth.ClientCertificatePath, ref.ref.Name())
+		cert, err := tlsclientconfig.LoadClientKeyPair(auth.ClientCertificatePath, auth.ClientKeyPath)
+		if err != nil {
+			client.Close()
+			return nil, fmt.Errorf("loading client certificate for %s: %w", ref.ref.Name(), err)
+		}
+		client.tlsClientConfig.Certificates = append(slices.Clone(client.tlsClientConfig.Certificates), cert)
+	}
 	client.auth = auth
+	client.authLookupKey = ref.ref.Name()
+	client.authKey = authSource.AuthFileKey
 	if sys != nil {
 		client.registryToken = sys.DockerBearerRegistryToken
 	}
 	client.signatureBase = sigBase
-	client.useSigstoreAttachments = registryConfig.useSigstoreAttachments(ref)
+	switch useSigstoreAttachments(sys, client.logger, registryConfig, ref) {
+	case types.OptionalBoolTrue:
+		client.useSigstoreAttachments = true
+		client.useSigstoreReferrers = useSigstoreReferrers(sys, client.logger, registryConfig, ref)
+	case types.OptionalBoolUndefined:
+		client.discoverSigstoreSignatures = discoverSigstoreSignatures(sys, client.logger, registryConfig, ref)
+	}
 	client.scope.resourceType = "repository"
 	client.scope.actions = actions
 	client.scope.remoteName = reference.Path(ref.ref)
@@ -259,13 +320,15 @@ func newDockerClient(sys *types.SystemContext, registry, reference string) (*doc
 	if err != nil {
 		return nil, err
 	}
-	if err := tlsclientconfig.SetupCertificates(certDir, tlsClientConfig); err != nil {
+	certificates, err := tlsclientconfig.NewReloadingConfig(sys, certDir, 0)
+	if err != nil {
 		return nil, err
 	}
 
 	// Check if TLS verification shall be skipped (default=false) which can
 	// be specified in the sysregistriesv2 configuration.
 	skipVerify := false
+	var pinnedPublicKeys []string
 	reg, err := sysregistriesv2.FindRegistry(sys, reference)
 	if err != nil {
 		return nil, fmt.Errorf("loading registries: %w", err)
@@ -275,19 +338,46 @@ func newDockerClient(sys *types.SystemContext, registry, reference string) (*doc
 			return nil, fmt.Errorf("registry %s is blocked in %s or %s", reg.Prefix, sysregistriesv2.ConfigPath(sys), sysregistriesv2.ConfigDirPath(sys))
 		}
 		skipVerify = reg.Insecure
+		pinnedPublicKeys = reg.PinnedPublicKeys
 	}
 	tlsClientConfig.InsecureSkipVerify = skipVerify
+	if err := tlsclientconfig.SetupPolicy(sys, tlsClientConfig); err != nil {
+		return nil, err
+	}
+
+	logger := logging.For(sys).WithFields(types.LogFields{types.LogFieldTransport: Transport.Name(), types.LogFieldRegistry: registry})
+	if sys != nil && sys.DockerSPIFFEEndpointSocket != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), spiffeFetchTimeout)
+		defer cancel()
+		if err := tlsclientconfig.SetupSPIFFEClientCertificate(ctx, sys, sys.DockerSPIFFEEndpointSocket, tlsClientConfig); err != nil {
+			return nil, err
+		}
+		// The X.509-SVIDs are used instead of any client certificates in certDir; don’t ignore those silently.
+		certDirConfig := &tls.Config{}
+		if _, err := certificates.SetupCertificates(certDirConfig); err == nil && len(certDirConfig.Certificates) != 0 {
+			logger.Warnf("Ignoring client certificates in %s: using X.509-SVIDs from %s instead", certDir, sys.DockerSPIFFEEndpointSocket)
+		}
+	}
 
 	userAgent := useragent.DefaultUserAgent
 	if sys != nil && sys.DockerRegistryUserAgent != "" {
 		userAgent = sys.DockerRegistryUserAgent
 	}
+	var rateLimiter types.RegistryRateLimiter
+	if sys != nil {
+		rateLimiter = sys.RegistryRateLimiter
+	}
 
 	return &dockerClient{
 		sys:              sys,
 		registry:         registry,
 		userAgent:        userAgent,
+		logger:           logger,
+		metrics:          metrics.For(sys),
+		rateLimiter:      rateLimiter,
 		tlsClientConfig:  tlsClientConfig,
+		certificates:     certificates,
+		pinnedPublicKeys: pinnedPublicKeys,
 		reportedWarnings: set.New[string](),
 	}, nil
 }
@@ -304,6 +394,7 @@ func CheckAuth(ctx context.Context, sys *types.SystemContext, username, password
 		Username: username,
 		Password: password,
 	}
+	client.authLookupKey = registry
 
 	resp, err := client.makeRequest(ctx, http.MethodGet, "/v2/", nil, nil, v2Auth, nil)
 	if err != nil {
@@ -311,7 +402,7 @@ func CheckAuth(ctx context.Context, sys *types.SystemContext, username, password
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
-		err := registryHTTPResponseToError(resp)
+		err := registryHTTPResponseToError(client.logger, resp)
 		if resp.StatusCode == http.StatusUnauthorized {
 			err = ErrUnauthorizedForCredentials{Err: err}
 		}
@@ -376,6 +467,7 @@ func SearchRegistry(ctx context.Context, sys *types.SystemContext, registry, ima
 	}
 	defer client.Close()
 	client.auth = auth
+	client.authLookupKey = registry
 	if sys != nil {
 		client.registryToken = sys.DockerBearerRegistryToken
 	}
@@ -392,14 +484,14 @@ func SearchRegistry(ctx context.Context, sys *types.SystemContext, registry, ima
 		q.Set("n", strconv.Itoa(limit))
 		u.RawQuery = q.Encode()
 
-		logrus.Debugf("trying to talk to v1 search endpoint")
+		client.logger.Debugf("trying to talk to v1 search endpoint")
 		resp, err := client.makeRequest(ctx, http.MethodGet, u.String(), nil, nil, noAuth, nil)
 		if err != nil {
-			logrus.Debugf("error getting search results from v1 endpoint %q: %v", registry, err)
+			client.logger.Debugf("error getting search results from v1 endpoint %q: %v", registry, err)
 		} else {
 			defer resp.Body.Close()
 			if resp.StatusCode != http.StatusOK {
-				logrus.Debugf("error getting search results from v1 endpoint %q: %v", registry, httpResponseToError(resp, ""))
+				client.logger.Debugf("error getting search results from v1 endpoint %q: %v", registry, httpResponseToError(client.logger, resp, ""))
 			} else {
 				if err := json.NewDecoder(resp.Body).Decode(v1Res); err != nil {
 					return nil, err
@@ -409,19 +501,19 @@ func SearchRegistry(ctx context.Context, sys *types.SystemContext, registry, ima
 		}
 	}
 
-	logrus.Debugf("trying to talk to v2 search endpoint")
+	client.logger.Debugf("trying to talk to v2 search endpoint")
 	searchRes := []SearchResult{}
 	path := "/v2/_catalog"
 	for len(searchRes) < limit {
 		resp, err := client.makeRequest(ctx, http.MethodGet, path, nil, nil, v2Auth, nil)
 		if err != nil {
-			logrus.Debugf("error getting search results from v2 endpoint %q: %v", registry, err)
+			client.logger.Debugf("error getting search results from v2 endpoint %q: %v", registry, err)
 			return nil, fmt.Errorf("couldn't search registry %q: %w", registry, err)
 		}
 		defer resp.Body.Close()
 		if resp.StatusCode != http.StatusOK {
-			err := registryHTTPResponseToError(resp)
-			logrus.Errorf("error getting search results from v2 endpoint %q: %v", registry, err)
+			err := registryHTTPResponseToError(client.logger, resp)
+			client.logger.Errorf("error getting search results from v2 endpoint %q: %v", registry, err)
 			return nil, fmt.Errorf("couldn't search registry %q: %w", registry, err)
 		}
 		v2Res := &V2Results{}
@@ -497,7 +589,7 @@ func (c *dockerClient) resolveRequestURL(path string) (*url.URL, error) {
 // Checks if the auth headers in the response contain an indication of a failed
 // authorizdation because of an "insufficient_scope" error. If that's the case,
 // returns the required scope to be used for fetching a new token.
-func needsRetryWithUpdatedScope(err error, res *http.Response) (bool, *authScope) {
+func needsRetryWithUpdatedScope(logger types.Logger, err error, res *http.Response) (bool, *authScope) {
 	if err == nil && res.StatusCode == http.StatusUnauthorized {
 		challenges := parseAuthHeader(res.Header)
 		for _, challenge := range challenges {
@@ -507,11 +599,11 @@ func needsRetryWithUpdatedScope(err error, res *http.Response) (bool, *authScope
 						if newScope, err := parseAuthScope(scope); err == nil {
 							return true, newScope
 						} else {
-							logrus.WithFields(logrus.Fields{
+							logger.WithFields(types.LogFields{
 								"error":     err,
 								"scope":     scope,
 								"challenge": challenge,
-							}).Error("Failed to parse the authentication scope from the given challenge")
+							}).Errorf("Failed to parse the authentication scope from the given challenge")
 						}
 					}
 				}
@@ -521,14 +613,29 @@ func needsRetryWithUpdatedScope(err error, res *http.Response) (bool, *authScope
 	return false, nil
 }
 
+// needsRetryWithRefreshedToken returns true if res indicates that an access token obtained using an identity token
+// was rejected, e.g. because it was revoked or expired earlier than announced, so that the request should be retried
+// once with a newly obtained access token.
+func (c *dockerClient) needsRetryWithRefreshedToken(err error, res *http.Response) bool {
+	if err != nil || res.StatusCode != http.StatusUnauthorized || c.registryToken != "" || c.identityToken() == "" {
+		return false
+	}
+	for _, challenge := range c.challenges {
+		if challenge.Scheme == "bearer" {
+			return true
+		}
+	}
+	return false
+}
+
 // parseRetryAfter determines the delay required by the "Retry-After" header in res and returns it,
 // silently falling back to fallbackDelay if the header is missing or invalid.
-func parseRetryAfter(res *http.Response, fallbackDelay time.Duration) time.Duration {
+func parseRetryAfter(logger types.Logger, res *http.Response, fallbackDelay time.Duration) time.Duration {
 	after := res.Header.Get("Retry-After")
 	if after == "" {
 		return fallbackDelay
 	}
-	logrus.Debugf("Detected 'Retry-After' header %q", after)
+	logger.Debugf("Detected 'Retry-After' header %q", after)
 	// First, check if we have a numerical value.
 	if num, err := strconv.ParseInt(after, 10, 64); err == nil {
 		return time.Duration(num) * time.Second
@@ -540,10 +647,10 @@ func parseRetryAfter(res *http.Response, fallbackDelay time.Duration) time.Durat
 		if delta > 0 {
 			return delta
 		}
-		logrus.Debugf("Retry-After date in the past, ignoring it")
+		logger.Debugf("Retry-After date in the past, ignoring it")
 		return fallbackDelay
 	}
-	logrus.Debugf("Invalid Retry-After format, ignoring it")
+	logger.Debugf("Invalid Retry-After format, ignoring it")
 	return fallbackDelay
 }
 
@@ -558,6 +665,7 @@ func (c *dockerClient) makeRequestToResolvedURL(ctx context.Context, method stri
 	for {
 		res, err := c.makeRequestToResolvedURLOnce(ctx, method, requestURL, headers, stream, streamLen, auth, extraScope)
 		attempts++
+		logger := c.logger.WithFields(types.LogFields{types.LogFieldAttempt: attempts})
 
 		// By default we use pre-defined scopes per operation. In
 		// certain cases, this can fail when our authentication is
@@ -572,13 +680,20 @@ func (c *dockerClient) makeRequestToResolvedURL(ctx context.Context, method stri
 		// We also cannot retry with a body (stream != nil) as stream
 		// was already read
 		if attempts == 1 && stream == nil && auth != noAuth {
-			if retry, newScope := needsRetryWithUpdatedScope(err, res); retry {
-				logrus.Debug("Detected insufficient_scope error, will retry request with updated scope")
+			if retry, newScope := needsRetryWithUpdatedScope(logger, err, res); retry {
+				logger.Debugf("Detected insufficient_scope error, will retry request with updated scope")
+				c.addRetryMetric("insufficient_scope")
 				// Note: This retry ignores extraScope. That’s, strictly speaking, incorrect, but we don’t currently
 				// expect the insufficient_scope errors to happen for those callers. If that changes, we can add support
 				// for more than one extra scope.
 				res, err = c.makeRequestToResolvedURLOnce(ctx, method, requestURL, headers, stream, streamLen, auth, newScope)
 				extraScope = newScope
+			} else if c.needsRetryWithRefreshedToken(err, res) {
+				logger.Debugf("Detected an unauthorized response with an identity token, will retry request with a refreshed access token")
+				c.addRetryMetric("refreshed_token")
+				res.Body.Close()
+				c.tokenCache.Delete(tokenCacheKey(extraScope))
+				res, err = c.makeRequestToResolvedURLOnce(ctx, method, requestURL, headers, stream, streamLen, auth, extraScope)
 			}
 		}
 		if res == nil || res.StatusCode != http.StatusTooManyRequests || // Only retry on StatusTooManyRequests, success or other failure is returned to caller immediately
@@ -589,11 +704,12 @@ func (c *dockerClient) makeRequestToResolvedURL(ctx context.Context, method stri
 		// close response body before retry or context done
 		res.Body.Close()
 
-		delay = parseRetryAfter(res, delay)
+		delay = parseRetryAfter(logger, res, delay)
 		if delay > backoffMaxDelay {
 			delay = backoffMaxDelay
 		}
-		logrus.Debugf("Too many requests to %s: sleeping for %f seconds before next attempt", requestURL.Redacted(), delay.Seconds())
+		logger.Debugf("Too many requests to %s: sleeping for %f seconds before next attempt", requestURL.Redacted(), delay.Seconds())
+		c.addRetryMetric("too_many_requests")
 		select {
 		case <-ctx.Done():
 			return nil, ctx.Err()
@@ -604,11 +720,35 @@ func (c *dockerClient) makeRequestToResolvedURL(ctx context.Context, method stri
 	}
 }
 
+// addRetryMetric records a retry of a request to c.registry, for reason, in c.metrics.
+func (c *dockerClient) addRetryMetric(reason string) {
+	c.metrics.AddCounter(types.MetricRequestRetries, types.MetricLabels{types.MetricLabelRegistry: c.registry, types.MetricLabelReason: reason}, 1)
+}
+
+// waitForRateLimit blocks until c.rateLimiter, if any, allows a request to c.registry.
+func (c *dockerClient) waitForRateLimit(ctx context.Context) error {
+	if c.rateLimiter == nil {
+		return nil
+	}
+	if err := c.rateLimiter.Wait(ctx, c.registry); err != nil {
+		return fmt.Errorf("waiting for rate limit of requests to %s: %w", c.registry, err)
+	}
+	return nil
+}
+
 // makeRequestToResolvedURLOnce creates and executes a http.Request with the specified parameters, adding authentication and TLS options for the Docker client.
 // streamLen, if not -1, specifies the length of the data expected on stream.
 // makeRequest should generally be preferred.
 // Note that no exponential back off is performed when receiving an http 429 status code.
-func (c *dockerClient) makeRequestToResolvedURLOnce(ctx context.Context, method string, resolvedURL *url.URL, headers map[string][]string, stream io.Reader, streamLen int64, auth sendAuth, extraScope *authScope) (*http.Response, error) {
+func (c *dockerClient) makeRequestToResolvedURLOnce(ctx context.Context, method string, resolvedURL *url.URL, headers map[string][]string, stream io.Reader, streamLen int64, auth sendAuth, extraScope *authScope) (_ *http.Response, retErr error) {
+	if err := c.waitForRateLimit(ctx); err != nil {
+		return nil, err
+	}
+	// Note that the span ends when the response headers are received, it does not include reading the response body.
+	ctx, span := tracing.Start(ctx, "docker.Request", semconv.HTTPRequestMethodKey.String(method),
+		semconv.ServerAddressKey.String(resolvedURL.Host), semconv.URLPathKey.String(resolvedURL.Path))
+	defer func() { tracing.End(span, retErr) }()
+
 	req, err := http.NewRequestWithContext(ctx, method, resolvedURL.String(), stream)
 	if err != nil {
 		return nil, err
@@ -623,16 +763,18 @@ func (c *dockerClient) makeRequestToResolvedURLOnce(ctx context.Context, method
 		}
 	}
 	req.Header.Add("User-Agent", c.userAgent)
+	tracing.InjectHTTPHeaders(ctx, req.Header)
 	if auth == v2Auth {
 		if err := c.setupRequestAuth(req, extraScope); err != nil {
 			return nil, err
 		}
 	}
-	logrus.Debugf("%s %s", method, resolvedURL.Redacted())
+	c.logger.Debugf("%s %s", method, resolvedURL.Redacted())
 	res, err := c.client.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	span.SetAttributes(semconv.HTTPResponseStatusCodeKey.Int(res.StatusCode))
 	if warnings := res.Header.Values("Warning"); len(warnings) != 0 {
 		c.logResponseWarnings(res, warnings)
 	}
@@ -647,16 +789,16 @@ func (c *dockerClient) logResponseWarnings(res *http.Response, warningHeaders []
 	for _, header := range warningHeaders {
 		warningString := parseRegistryWarningHeader(header)
 		if warningString == "" {
-			logrus.Debugf("Ignored Warning: header from registry: %q", header)
+			c.logger.Debugf("Ignored Warning: header from registry: %q", header)
 		} else {
 			if !c.reportedWarnings.Contains(warningString) {
 				c.reportedWarnings.Add(warningString)
 				// Note that reportedWarnings is based only on warningString, so that we don’t
 				// repeat the same warning for every request - but the warning includes the URL;
 				// so it may not be specific to that URL.
-				logrus.Warnf("Warning from registry (first encountered at %q): %q", res.Request.URL.Redacted(), warningString)
+				c.logger.Warnf("Warning from registry (first encountered at %q): %q", res.Request.URL.Redacted(), warningString)
 			} else {
-				logrus.Debugf("Repeated warning from registry at %q: %q", res.Request.URL.Redacted(), warningString)
+				c.logger.Debugf("Repeated warning from registry at %q: %q", res.Request.URL.Redacted(), warningString)
 			}
 		}
 	}
@@ -714,24 +856,23 @@ func (c *dockerClient) setupRequestAuth(req *http.Request, extraScope *authScope
 	if len(c.challenges) == 0 {
 		return nil
 	}
+	auth, err := c.currentAuth(req.Context())
+	if err != nil {
+		return err
+	}
 	schemeNames := make([]string, 0, len(c.challenges))
 	for _, challenge := range c.challenges {
 		schemeNames = append(schemeNames, challenge.Scheme)
 		switch challenge.Scheme {
 		case "basic":
-			req.SetBasicAuth(c.auth.Username, c.auth.Password)
+			req.SetBasicAuth(auth.Username, auth.Password)
 			return nil
 		case "bearer":
 			registryToken := c.registryToken
 			if registryToken == "" {
-				cacheKey := ""
+				cacheKey := tokenCacheKey(extraScope)
 				scopes := []authScope{c.scope}
 				if extraScope != nil {
-					// Using ':' as a separator here is unambiguous because getBearerToken below
-					// uses the same separator when formatting a remote request (and because
-					// repository names that we create can't contain colons, and extraScope values
-					// coming from a server come from `parseAuthScope`, which also splits on colons).
-					cacheKey = fmt.Sprintf("%s:%s:%s", extraScope.resourceType, extraScope.remoteName, extraScope.actions)
 					if colonCount := strings.Count(cacheKey, ":"); colonCount != 2 {
 						return fmt.Errorf(
 							"Internal error: there must be exactly 2 colons in the cacheKey ('%s') but got %d",
@@ -751,10 +892,20 @@ func (c *dockerClient) setupRequestAuth(req *http.Request, extraScope *authScope
 						t   *bearerToken
 						err error
 					)
-					if c.auth.IdentityToken != "" {
-						t, err = c.getBearerTokenOAuth2(req.Context(), challenge, scopes)
+					if auth.IdentityToken != "" {
+						// Not deduplicated: the registry may rotate the identity token, and other callers would not learn the new value.
+						t, err = c.getBearerTokenOAuth2(req.Context(), auth, challenge, scopes)
+						c.addTokenFetchMetric(err)
 					} else {
-						t, err = c.getBearerToken(req.Context(), challenge, scopes)
+						var res any
+						res, err = c.deduplicated(req.Context(), func(ctx context.Context) (any, error) {
+							t, err := c.getBearerToken(ctx, auth, challenge, scopes)
+							c.addTokenFetchMetric(err)
+							return t, err
+						}, "token", challenge.Parameters["realm"], challenge.Parameters["service"], cacheKey, c.scope.resourceType, c.scope.remoteName, c.scope.actions)
+						if err == nil {
+							t = res.(*bearerToken)
+						}
 					}
 					if err != nil {
 						return err
@@ -768,14 +919,149 @@ func (c *dockerClient) setupRequestAuth(req *http.Request, extraScope *authScope
 			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", registryToken))
 			return nil
 		default:
-			logrus.Debugf("no handler for %s authentication", challenge.Scheme)
+			c.logger.Debugf("no handler for %s authentication", challenge.Scheme)
 		}
 	}
-	logrus.Infof("None of the challenges sent by server (%s) are supported, trying an unauthenticated request anyway", strings.Join(schemeNames, ", "))
+	c.logger.Infof("None of the challenges sent by server (%s) are supported, trying an unauthenticated request anyway", strings.Join(schemeNames, ", "))
 	return nil
 }
 
-func (c *dockerClient) getBearerTokenOAuth2(ctx context.Context, challenge challenge,
+// addTokenFetchMetric records an attempt to fetch a bearer token, which failed with err if not nil.
+func (c *dockerClient) addTokenFetchMetric(err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	c.metrics.AddCounter(types.MetricTokenFetches, types.MetricLabels{types.MetricLabelRegistry: c.registry, types.MetricLabelResult: result}, 1)
+}
+
+// tokenCacheKey returns the key for c.tokenCache used for requests with extraScope.
+func tokenCacheKey(extraScope *authScope) string {
+	if extraScope == nil {
+		return ""
+	}
+	// Using ':' as a separator here is unambiguous because getBearerToken below
+	// uses the same separator when formatting a remote request (and because
+	// repository names that we create can't contain colons, and extraScope values
+	// coming from a server come from `parseAuthScope`, which also splits on colons).
+	return fmt.Sprintf("%s:%s:%s", extraScope.resourceType, extraScope.remoteName, extraScope.actions)
+}
+
+// identityToken returns the current identity token, which may have been rotated since the client was created.
+func (c *dockerClient) identityToken() string {
+	c.authLock.Lock()
+	defer c.authLock.Unlock()
+	return c.auth.IdentityToken
+}
+
+// refreshingCredentialsKey is a context key marking contexts passed to types.SystemContext.DockerCredentialsRefresh;
+// its value is the *dockerClient refreshing its credentials.
+type refreshingCredentialsKey struct{}
+
+// currentAuth returns the credentials to use for a request.
+// If the credentials have expired, or are about to expire, they are first refreshed using
+// c.sys.DockerCredentialsRefresh, if available.
+// Only one refresh is made at a time; concurrent callers wait for it only if the current credentials have already expired.
+func (c *dockerClient) currentAuth(ctx context.Context) (types.DockerAuthConfig, error) {
+	for {
+		c.authLock.Lock()
+		auth := c.auth
+		if auth.ExpiresAt.IsZero() || time.Until(auth.ExpiresAt) > credentialsRefreshMargin {
+			c.authLock.Unlock()
+			return auth, nil
+		}
+		if c.sys == nil || c.sys.DockerCredentialsRefresh == nil {
+			c.authLock.Unlock()
+			if time.Now().After(auth.ExpiresAt) {
+				c.logger.Warnf("Credentials for %s expired at %s, and no refresh callback is available", c.authLookupKey, auth.ExpiresAt)
+			}
+			return auth, nil
+		}
+		if ctx.Value(refreshingCredentialsKey{}) == c || time.Now().Before(c.authRefreshNotBefore) {
+			// Called by the refresh callback itself, or a recent refresh did not help; use what we have.
+			c.authLock.Unlock()
+			return auth, nil
+		}
+		if done := c.authRefreshDone; done != nil {
+			c.authLock.Unlock()
+			if time.Now().Before(auth.ExpiresAt) {
+				return auth, nil // Still valid, don’t wait for the refresh.
+			}
+			select {
+			case <-done:
+				continue
+			case <-ctx.Done():
+				return types.DockerAuthConfig{}, ctx.Err()
+			}
+		}
+		done := make(chan struct{})
+		c.authRefreshDone = done
+		c.authLock.Unlock()
+
+		c.logger.Debugf("Credentials for %s expire at %s, refreshing", c.authLookupKey, auth.ExpiresAt)
+		newAuth, err := c.sys.DockerCredentialsRefresh(context.WithValue(ctx, refreshingCredentialsKey{}, c), c.authLookupKey, auth)
+
+		c.authLock.Lock()
+		c.authRefreshDone = nil
+		close(done)
+		if err != nil {
+			c.backOffCredentialsRefresh()
+			c.authLock.Unlock()
+			return types.DockerAuthConfig{}, fmt.Errorf("refreshing credentials for %s: %w", c.authLookupKey, err)
+		}
+		c.auth = newAuth
+		if !newAuth.ExpiresAt.IsZero() && time.Until(newAuth.ExpiresAt) <= credentialsRefreshMargin {
+			c.backOffCredentialsRefresh()
+			c.logger.Debugf("Refreshed credentials for %s expire at %s, not refreshing them again for %s", c.authLookupKey, newAuth.ExpiresAt, c.authRefreshBackoff)
+		} else {
+			c.authRefreshBackoff = 0
+		}
+		c.authLock.Unlock()
+		// Access tokens obtained using the old credentials remain valid until they expire; that’s fine.
+		return newAuth, nil
+	}
+}
+
+// backOffCredentialsRefresh prevents calling c.sys.DockerCredentialsRefresh again for an increasing time.
+// The caller must hold c.authLock.
+func (c *dockerClient) backOffCredentialsRefresh() {
+	if c.authRefreshBackoff == 0 {
+		c.authRefreshBackoff = credentialsRefreshMinBackoff
+	} else {
+		c.authRefreshBackoff *= 2
+		if c.authRefreshBackoff > credentialsRefreshMaxBackoff {
+			c.authRefreshBackoff = credentialsRefreshMaxBackoff
+		}
+	}
+	c.authRefreshNotBefore = time.Now().Add(c.authRefreshBackoff)
+}
+
+// rotateIdentityToken records a new identity token returned by the registry’s token endpoint,
+// and, if requested by c.sys, persists it in the users’ credential store.
+// Failures to persist the token are only logged; the token remains usable for the lifetime of c.
+func (c *dockerClient) rotateIdentityToken(newToken string) {
+	c.authLock.Lock()
+	if newToken == c.auth.IdentityToken {
+		c.authLock.Unlock()
+		return
+	}
+	c.auth.IdentityToken = newToken
+	username := c.auth.Username
+	c.authLock.Unlock()
+	c.logger.Debugf("Identity token for %s was rotated by the registry", c.registry)
+
+	if c.sys == nil || !c.sys.DockerPersistRotatedIdentityTokens || c.authKey == "" {
+		return
+	}
+	desc, err := config.SetIdentityToken(c.sys, c.authKey, username, newToken)
+	if err != nil {
+		c.logger.Warnf("Error storing the rotated identity token for %s: %v", c.authKey, err)
+		return
+	}
+	c.logger.Debugf("Stored the rotated identity token for %s in %s", c.authKey, desc)
+}
+
+func (c *dockerClient) getBearerTokenOAuth2(ctx context.Context, auth types.DockerAuthConfig, challenge challenge,
 	scopes []authScope) (*bearerToken, error) {
 	realm, ok := challenge.Parameters["realm"]
 	if !ok {
@@ -800,19 +1086,22 @@ func (c *dockerClient) getBearerTokenOAuth2(ctx context.Context, challenge chall
 		}
 	}
 	params.Add("grant_type", "refresh_token")
-	params.Add("refresh_token", c.auth.IdentityToken)
+	params.Add("refresh_token", auth.IdentityToken)
 	params.Add("client_id", "containers/image")
 
 	authReq.Body = io.NopCloser(strings.NewReader(params.Encode()))
 	authReq.Header.Add("User-Agent", c.userAgent)
 	authReq.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-	logrus.Debugf("%s %s", authReq.Method, authReq.URL.Redacted())
+	if err := c.waitForRateLimit(ctx); err != nil {
+		return nil, err
+	}
+	c.logger.Debugf("%s %s", authReq.Method, authReq.URL.Redacted())
 	res, err := c.client.Do(authReq)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
-	if err := httpResponseToError(res, "Trying to obtain access token"); err != nil {
+	if err := httpResponseToError(c.logger, res, "Trying to obtain access token"); err != nil {
 		return nil, err
 	}
 
@@ -821,10 +1110,17 @@ func (c *dockerClient) getBearerTokenOAuth2(ctx context.Context, challenge chall
 		return nil, err
 	}
 
-	return newBearerTokenFromJSONBlob(tokenBlob)
+	token, err := newBearerTokenFromJSONBlob(c.logger, tokenBlob)
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken != "" {
+		c.rotateIdentityToken(token.RefreshToken)
+	}
+	return token, nil
 }
 
-func (c *dockerClient) getBearerToken(ctx context.Context, challenge challenge,
+func (c *dockerClient) getBearerToken(ctx context.Context, auth types.DockerAuthConfig, challenge challenge,
 	scopes []authScope) (*bearerToken, error) {
 	realm, ok := challenge.Parameters["realm"]
 	if !ok {
@@ -837,8 +1133,8 @@ func (c *dockerClient) getBearerToken(ctx context.Context, challenge challenge,
 	}
 
 	params := authReq.URL.Query()
-	if c.auth.Username != "" {
-		params.Add("account", c.auth.Username)
+	if auth.Username != "" {
+		params.Add("account", auth.Username)
 	}
 
 	if service, ok := challenge.Parameters["service"]; ok && service != "" {
@@ -853,18 +1149,21 @@ func (c *dockerClient) getBearerToken(ctx context.Context, challenge challenge,
 
 	authReq.URL.RawQuery = params.Encode()
 
-	if c.auth.Username != "" && c.auth.Password != "" {
-		authReq.SetBasicAuth(c.auth.Username, c.auth.Password)
+	if auth.Username != "" && auth.Password != "" {
+		authReq.SetBasicAuth(auth.Username, auth.Password)
 	}
 	authReq.Header.Add("User-Agent", c.userAgent)
 
-	logrus.Debugf("%s %s", authReq.Method, authReq.URL.Redacted())
+	if err := c.waitForRateLimit(ctx); err != nil {
+		return nil, err
+	}
+	c.logger.Debugf("%s %s", authReq.Method, authReq.URL.Redacted())
 	res, err := c.client.Do(authReq)
 	if err != nil {
 		return nil, err
 	}
 	defer res.Body.Close()
-	if err := httpResponseToError(res, "Requesting bearer token"); err != nil {
+	if err := httpResponseToError(c.logger, res, "Requesting bearer token"); err != nil {
 		return nil, err
 	}
 	tokenBlob, err := iolimits.ReadAtMost(res.Body, iolimits.MaxAuthTokenBodySize)
@@ -872,7 +1171,7 @@ func (c *dockerClient) getBearerToken(ctx context.Context, challenge challenge,
 		return nil, err
 	}
 
-	return newBearerTokenFromJSONBlob(tokenBlob)
+	return newBearerTokenFromJSONBlob(c.logger, tokenBlob)
 }
 
 // detectPropertiesHelper performs the work of detectProperties which executes
@@ -883,9 +1182,15 @@ func (c *dockerClient) detectPropertiesHelper(ctx context.Context) error {
 	if c.sys != nil && c.sys.DockerInsecureSkipTLSVerify != types.OptionalBoolUndefined {
 		c.tlsClientConfig.InsecureSkipVerify = c.sys.DockerInsecureSkipTLSVerify == types.OptionalBoolTrue
 	}
-	tr := tlsclientconfig.NewTransport()
-	tr.TLSClientConfig = c.tlsClientConfig
-	c.client = &http.Client{Transport: tr}
+	if c.sys != nil && c.sys.DockerPinnedPublicKeys != nil {
+		c.pinnedPublicKeys = c.sys.DockerPinnedPublicKeys
+	}
+	if err := tlsclientconfig.SetupPinnedPublicKeys(c.tlsClientConfig, c.pinnedPublicKeys); err != nil {
+		return err
+	}
+	// Never fall back to HTTP if public keys are pinned, that would make pinning pointless.
+	allowHTTP := c.tlsClientConfig.InsecureSkipVerify && len(c.pinnedPublicKeys) == 0
+	c.client = &http.Client{Transport: tlsclientconfig.NewReloadingTransport(c.tlsClientConfig, c.certificates)}
 
 	ping := func(scheme string) error {
 		pingURL, err := url.Parse(fmt.Sprintf(resolvedPingV2URL, scheme, c.registry))
@@ -894,13 +1199,13 @@ func (c *dockerClient) detectPropertiesHelper(ctx context.Context) error {
 		}
 		resp, err := c.makeRequestToResolvedURL(ctx, http.MethodGet, pingURL, nil, nil, -1, noAuth, nil)
 		if err != nil {
-			logrus.Debugf("Ping %s err %s (%#v)", pingURL.Redacted(), err.Error(), err)
+			c.logger.Debugf("Ping %s err %s (%#v)", pingURL.Redacted(), err.Error(), err)
 			return err
 		}
 		defer resp.Body.Close()
-		logrus.Debugf("Ping %s status %d", pingURL.Redacted(), resp.StatusCode)
+		c.logger.Debugf("Ping %s status %d", pingURL.Redacted(), resp.StatusCode)
 		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
-			return registryHTTPResponseToError(resp)
+			return registryHTTPResponseToError(c.logger, resp)
 		}
 		c.challenges = parseAuthHeader(resp.Header)
 		c.scheme = scheme
@@ -908,7 +1213,7 @@ func (c *dockerClient) detectPropertiesHelper(ctx context.Context) error {
 		return nil
 	}
 	err := ping("https")
-	if err != nil && c.tlsClientConfig.InsecureSkipVerify {
+	if err != nil && allowHTTP {
 		err = ping("http")
 	}
 	if err != nil {
@@ -924,18 +1229,18 @@ func (c *dockerClient) detectPropertiesHelper(ctx context.Context) error {
 			}
 			resp, err := c.makeRequestToResolvedURL(ctx, http.MethodGet, pingURL, nil, nil, -1, noAuth, nil)
 			if err != nil {
-				logrus.Debugf("Ping %s err %s (%#v)", pingURL.Redacted(), err.Error(), err)
+				c.logger.Debugf("Ping %s err %s (%#v)", pingURL.Redacted(), err.Error(), err)
 				return false
 			}
 			defer resp.Body.Close()
-			logrus.Debugf("Ping %s status %d", pingURL.Redacted(), resp.StatusCode)
+			c.logger.Debugf("Ping %s status %d", pingURL.Redacted(), resp.StatusCode)
 			if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnauthorized {
 				return false
 			}
 			return true
 		}
 		isV1 := pingV1("https")
-		if !isV1 && c.tlsClientConfig.InsecureSkipVerify {
+		if !isV1 && allowHTTP {
 			isV1 = pingV1("http")
 		}
 		if isV1 {
@@ -952,26 +1257,66 @@ func (c *dockerClient) detectProperties(ctx context.Context) error {
 	return c.detectPropertiesError
 }
 
+// fetchedManifest is the result of fetchManifestFromRegistry.
+type fetchedManifest struct {
+	manblob  []byte
+	mimeType string // As returned by the registry, before resolveManifestMIMETypeAlias
+}
+
 func (c *dockerClient) fetchManifest(ctx context.Context, ref dockerReference, tagOrDigest string) ([]byte, string, error) {
+	res, err := c.deduplicated(ctx, func(ctx context.Context) (any, error) {
+		return c.fetchManifestFromRegistry(ctx, ref, tagOrDigest)
+	}, "manifest", reference.Path(ref.ref), tagOrDigest)
+	if err != nil {
+		return nil, "", err
+	}
+	m := res.(fetchedManifest)
+	manblob := slices.Clone(m.manblob) // The value may be shared with other callers.
+	return manblob, c.resolveManifestMIMETypeAlias(manblob, m.mimeType), nil
+}
+
+// fetchManifestFromRegistry is fetchManifest, without request deduplication and without applying DockerManifestMIMETypeAliases.
+func (c *dockerClient) fetchManifestFromRegistry(ctx context.Context, ref dockerReference, tagOrDigest string) (fetchedManifest, error) {
 	path := fmt.Sprintf(manifestPath, reference.Path(ref.ref), tagOrDigest)
 	headers := map[string][]string{
 		"Accept": manifest.DefaultRequestedManifestMIMETypes,
 	}
 	res, err := c.makeRequest(ctx, http.MethodGet, path, headers, nil, v2Auth, nil)
 	if err != nil {
-		return nil, "", err
+		return fetchedManifest{}, err
 	}
-	logrus.Debugf("Content-Type from manifest GET is %q", res.Header.Get("Content-Type"))
+	c.logger.Debugf("Content-Type from manifest GET is %q", res.Header.Get("Content-Type"))
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		return nil, "", fmt.Errorf("reading manifest %s in %s: %w", tagOrDigest, ref.ref.Name(), registryHTTPResponseToError(res))
+		return fetchedManifest{}, fmt.Errorf("reading manifest %s in %s: %w", tagOrDigest, ref.ref.Name(), registryHTTPResponseToError(c.logger, res))
 	}
 
-	manblob, err := iolimits.ReadAtMost(res.Body, iolimits.MaxManifestBodySize)
+	manblob, err := iolimits.ReadAtMost(res.Body, iolimits.ManifestSizeLimit(c.sys))
 	if err != nil {
-		return nil, "", err
+		return fetchedManifest{}, err
+	}
+	return fetchedManifest{manblob: manblob, mimeType: simplifyContentType(res.Header.Get("Content-Type"))}, nil
+}
+
+// resolveManifestMIMETypeAlias returns the MIME type to use for manblob, which the registry returned with mimeType,
+// applying c.sys.DockerManifestMIMETypeAliases.
+func (c *dockerClient) resolveManifestMIMETypeAlias(manblob []byte, mimeType string) string {
+	if c.sys == nil {
+		return mimeType
+	}
+	alias, ok := c.sys.DockerManifestMIMETypeAliases[mimeType]
+	if !ok {
+		return mimeType
+	}
+	if alias == "" {
+		alias = manifest.GuessMIMEType(manblob)
+		if alias == "" {
+			c.logger.Debugf("Could not guess the MIME type of a manifest with MIME type %q, using it unmodified", mimeType)
+			return mimeType
+		}
 	}
-	return manblob, simplifyContentType(res.Header.Get("Content-Type")), nil
+	c.logger.Debugf("Treating manifest MIME type %q as %q", mimeType, alias)
+	return alias
 }
 
 // getExternalBlob returns the reader of the first available blob URL from urls, which must not be empty.
@@ -997,7 +1342,7 @@ func (c *dockerClient) getExternalBlob(ctx context.Context, urls []string) (io.R
 		if err == nil {
 			if resp.StatusCode != http.StatusOK {
 				err = fmt.Errorf("error fetching external blob from %q: %d (%s)", u, resp.StatusCode, http.StatusText(resp.StatusCode))
-				logrus.Debug(err)
+				c.logger.Debugf("%v", err)
 				resp.Body.Close()
 				continue
 			}
@@ -1021,11 +1366,27 @@ func getBlobSize(resp *http.Response) int64 {
 	return size
 }
 
+// meteredReadCloser is an io.ReadCloser which adds the number of bytes read to a metric.
+type meteredReadCloser struct {
+	io.ReadCloser
+	metrics types.Metrics
+	name    string
+	labels  types.MetricLabels
+}
+
+func (r *meteredReadCloser) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.metrics.AddCounter(r.name, r.labels, int64(n))
+	}
+	return n, err
+}
+
 // getBlob returns a stream for the specified blob in ref, and the blob’s size (or -1 if unknown).
 // The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
 // May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
 func (c *dockerClient) getBlob(ctx context.Context, ref dockerReference, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
-	if len(info.URLs) != 0 {
+	if len(info.URLs) != 0 && (c.sys == nil || !c.sys.DisableForeignLayerURLs) {
 		r, s, err := c.getExternalBlob(ctx, info.URLs)
 		if err != nil {
 			return nil, 0, err
@@ -1035,25 +1396,34 @@ func (c *dockerClient) getBlob(ctx context.Context, ref dockerReference, info ty
 	}
 
 	path := fmt.Sprintf(blobsPath, reference.Path(ref.ref), info.Digest.String())
-	logrus.Debugf("Downloading %s", path)
+	if r, s := c.getBlobFromContentRouters(ctx, ref, info, path); r != nil {
+		return r, s, nil
+	}
+	logger := c.logger.WithFields(types.LogFields{types.LogFieldDigest: info.Digest.String()})
+	logger.Debugf("Downloading %s", path)
 	res, err := c.makeRequest(ctx, http.MethodGet, path, nil, nil, v2Auth, nil)
 	if err != nil {
 		return nil, 0, err
 	}
 	if res.StatusCode != http.StatusOK {
-		err := registryHTTPResponseToError(res)
+		err := registryHTTPResponseToError(c.logger, res)
 		res.Body.Close()
 		return nil, 0, fmt.Errorf("fetching blob: %w", err)
 	}
 	cache.RecordKnownLocation(ref.Transport(), bicTransportScope(ref), info.Digest, newBICLocationReference(ref))
 	blobSize := getBlobSize(res)
 
-	reconnectingReader, err := newBodyReader(ctx, c, path, res.Body)
+	reconnectingReader, err := newBodyReader(ctx, c, logger, path, res.Body)
 	if err != nil {
 		res.Body.Close()
 		return nil, 0, err
 	}
-	return reconnectingReader, blobSize, nil
+	return &meteredReadCloser{
+		ReadCloser: reconnectingReader,
+		metrics:    c.metrics,
+		name:       types.MetricBytesPulled,
+		labels:     types.MetricLabels{types.MetricLabelRegistry: c.registry},
+	}, blobSize, nil
 }
 
 // getOCIDescriptorContents returns the contents a blob specified by descriptor in ref, which must fit within limit.
@@ -1097,22 +1467,34 @@ func isManifestUnknownError(err error) bool {
 // digest in ref.
 // It returns (nil, nil) if the manifest does not exist.
 func (c *dockerClient) getSigstoreAttachmentManifest(ctx context.Context, ref dockerReference, digest digest.Digest) (*manifest.OCI1, error) {
-	tag := sigstoreAttachmentTag(digest)
+	return c.getSigstoreTaggedManifest(ctx, ref, sigstoreAttachmentTag(digest))
+}
+
+// getSigstoreAttestationManifest loads and parses the manifest for sigstore attestations for
+// digest in ref.
+// It returns (nil, nil) if the manifest does not exist.
+func (c *dockerClient) getSigstoreAttestationManifest(ctx context.Context, ref dockerReference, digest digest.Digest) (*manifest.OCI1, error) {
+	return c.getSigstoreTaggedManifest(ctx, ref, sigstoreAttestationTag(digest))
+}
+
+// getSigstoreTaggedManifest loads and parses a sigstore manifest using tag in ref.
+// It returns (nil, nil) if the manifest does not exist.
+func (c *dockerClient) getSigstoreTaggedManifest(ctx context.Context, ref dockerReference, tag string) (*manifest.OCI1, error) {
 	sigstoreRef, err := reference.WithTag(reference.TrimNamed(ref.ref), tag)
 	if err != nil {
 		return nil, err
 	}
-	logrus.Debugf("Looking for sigstore attachments in %s", sigstoreRef.String())
+	c.logger.Debugf("Looking for sigstore attachments in %s", sigstoreRef.String())
 	manifestBlob, mimeType, err := c.fetchManifest(ctx, ref, tag)
 	if err != nil {
 		// FIXME: Are we going to need better heuristics??
 		// This alone is probably a good enough reason for sigstore to be opt-in only,
 		// otherwise we would just break ordinary copies.
 		if isManifestUnknownError(err) {
-			logrus.Debugf("Fetching sigstore attachment manifest failed, assuming it does not exist: %v", err)
+			c.logger.Debugf("Fetching sigstore attachment manifest failed, assuming it does not exist: %v", err)
 			return nil, nil
 		}
-		logrus.Debugf("Fetching sigstore attachment manifest failed: %v", err)
+		c.logger.Debugf("Fetching sigstore attachment manifest failed: %v", err)
 		return nil, err
 	}
 	if mimeType != imgspecv1.MediaTypeImageManifest {
@@ -1137,7 +1519,7 @@ func (c *dockerClient) getExtensionsSignatures(ctx context.Context, ref dockerRe
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("downloading signatures for %s in %s: %w", manifestDigest, ref.ref.Name(), registryHTTPResponseToError(res))
+		return nil, fmt.Errorf("downloading signatures for %s in %s: %w", manifestDigest, ref.ref.Name(), registryHTTPResponseToError(c.logger, res))
 	}
 
 	body, err := iolimits.ReadAtMost(res.Body, iolimits.MaxSignatureListBodySize)
@@ -1157,6 +1539,11 @@ func sigstoreAttachmentTag(d digest.Digest) string {
 	return strings.Replace(d.String(), ":", "-", 1) + ".sig"
 }
 
+// sigstoreAttestationTag returns a sigstore attestation tag for the specified digest.
+func sigstoreAttestationTag(d digest.Digest) string {
+	return strings.Replace(d.String(), ":", "-", 1) + ".att"
+}
+
 // Close removes resources associated with an initialized dockerClient, if any.
 func (c *dockerClient) Close() error {
 	if c.client != nil {
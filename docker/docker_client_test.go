@@ -6,17 +6,32 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/useragent"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/pkg/metrics"
 	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
 func TestDockerCertDir(t *testing.T) {
@@ -95,7 +110,7 @@ func TestDockerCertDir(t *testing.T) {
 func TestNewBearerTokenFromJsonBlob(t *testing.T) {
 	expected := &bearerToken{Token: "IAmAToken", ExpiresIn: 100, IssuedAt: time.Unix(1514800802, 0)}
 	tokenBlob := []byte(`{"token":"IAmAToken","expires_in":100,"issued_at":"2018-01-01T10:00:02+00:00"}`)
-	token, err := newBearerTokenFromJSONBlob(tokenBlob)
+	token, err := newBearerTokenFromJSONBlob(logging.Discard(), tokenBlob)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -106,7 +121,7 @@ func TestNewBearerTokenFromJsonBlob(t *testing.T) {
 func TestNewBearerAccessTokenFromJsonBlob(t *testing.T) {
 	expected := &bearerToken{Token: "IAmAToken", ExpiresIn: 100, IssuedAt: time.Unix(1514800802, 0)}
 	tokenBlob := []byte(`{"access_token":"IAmAToken","expires_in":100,"issued_at":"2018-01-01T10:00:02+00:00"}`)
-	token, err := newBearerTokenFromJSONBlob(tokenBlob)
+	token, err := newBearerTokenFromJSONBlob(logging.Discard(), tokenBlob)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -114,9 +129,17 @@ func TestNewBearerAccessTokenFromJsonBlob(t *testing.T) {
 	assertBearerTokensEqual(t, expected, token)
 }
 
+func TestNewBearerTokenWithRefreshTokenFromJsonBlob(t *testing.T) {
+	tokenBlob := []byte(`{"access_token":"IAmAToken","expires_in":100,"issued_at":"2018-01-01T10:00:02+00:00","refresh_token":"IAmARefreshToken"}`)
+	token, err := newBearerTokenFromJSONBlob(logging.Discard(), tokenBlob)
+	require.NoError(t, err)
+	assert.Equal(t, "IAmAToken", token.Token)
+	assert.Equal(t, "IAmARefreshToken", token.RefreshToken)
+}
+
 func TestNewBearerTokenFromInvalidJsonBlob(t *testing.T) {
 	tokenBlob := []byte("IAmNotJson")
-	_, err := newBearerTokenFromJSONBlob(tokenBlob)
+	_, err := newBearerTokenFromJSONBlob(logging.Discard(), tokenBlob)
 	if err == nil {
 		t.Fatalf("unexpected an error unmarshaling JSON")
 	}
@@ -125,7 +148,7 @@ func TestNewBearerTokenFromInvalidJsonBlob(t *testing.T) {
 func TestNewBearerTokenSmallExpiryFromJsonBlob(t *testing.T) {
 	expected := &bearerToken{Token: "IAmAToken", ExpiresIn: 60, IssuedAt: time.Unix(1514800802, 0)}
 	tokenBlob := []byte(`{"token":"IAmAToken","expires_in":1,"issued_at":"2018-01-01T10:00:02+00:00"}`)
-	token, err := newBearerTokenFromJSONBlob(tokenBlob)
+	token, err := newBearerTokenFromJSONBlob(logging.Discard(), tokenBlob)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -137,7 +160,7 @@ func TestNewBearerTokenIssuedAtZeroFromJsonBlob(t *testing.T) {
 	zeroTime := time.Time{}.Format(time.RFC3339)
 	now := time.Now()
 	tokenBlob := []byte(fmt.Sprintf(`{"token":"IAmAToken","expires_in":100,"issued_at":"%s"}`, zeroTime))
-	token, err := newBearerTokenFromJSONBlob(tokenBlob)
+	token, err := newBearerTokenFromJSONBlob(logging.Discard(), tokenBlob)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -192,8 +215,311 @@ func TestUserAgent(t *testing.T) {
 	}
 }
 
+func TestRequestTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	origTP := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+	defer otel.SetTracerProvider(origTP)
+	origPropagator := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(origPropagator)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "parent")
+	traceID := parent.SpanContext().TraceID()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.Header.Get("traceparent"), traceID.String())
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	sys := &types.SystemContext{DockerInsecureSkipTLSVerify: types.OptionalBoolTrue}
+	err := CheckAuth(ctx, sys, "", "", strings.TrimPrefix(s.URL, "http://"))
+	require.NoError(t, err)
+	parent.End()
+
+	// With DockerInsecureSkipTLSVerify, an HTTPS attempt fails first; the successful HTTP request is the last one, ended before the parent.
+	spans := exporter.GetSpans()
+	require.True(t, len(spans) >= 2)
+	request := spans[len(spans)-2]
+	assert.Equal(t, "docker.Request", request.Name)
+	assert.Equal(t, traceID, request.SpanContext.TraceID())
+	assert.Equal(t, parent.SpanContext().SpanID(), request.Parent.SpanID())
+	assert.Contains(t, request.Attributes, semconv.HTTPRequestMethodKey.String(http.MethodGet))
+	assert.Contains(t, request.Attributes, semconv.URLPathKey.String("/v2/"))
+	assert.Contains(t, request.Attributes, semconv.HTTPResponseStatusCodeKey.Int(http.StatusOK))
+}
+
+func TestIdentityTokenRotation(t *testing.T) {
+	var serverURL string
+	refreshTokens := []string{}
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			require.NoError(t, r.ParseForm())
+			refreshTokens = append(refreshTokens, r.PostForm.Get("refresh_token"))
+			fmt.Fprintf(w, `{"access_token":"access-%d","refresh_token":"refresh-%d"}`, len(refreshTokens), len(refreshTokens))
+		case "/v2/":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, serverURL))
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			// Reject the first access token, as if it were revoked early.
+			if r.Header.Get("Authorization") != "Bearer access-2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer s.Close()
+	serverURL = s.URL
+	registry := strings.TrimPrefix(s.URL, "http://")
+
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	sys := &types.SystemContext{
+		DockerInsecureSkipTLSVerify:        types.OptionalBoolTrue,
+		AuthFilePath:                       authFile,
+		DockerPersistRotatedIdentityTokens: true,
+	}
+	c, err := newDockerClient(sys, registry, registry)
+	require.NoError(t, err)
+	defer c.Close()
+	c.auth = types.DockerAuthConfig{Username: "user", IdentityToken: "refresh-0"}
+	c.authKey = registry
+
+	res, err := c.makeRequest(context.Background(), http.MethodGet, "/v2/ns/repo/tags/list", nil, nil, v2Auth, nil)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, []string{"refresh-0", "refresh-1"}, refreshTokens)
+	assert.Equal(t, "refresh-2", c.identityToken())
+
+	creds, err := config.GetCredentials(sys, registry)
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{Username: "user", IdentityToken: "refresh-2"}, creds)
+}
+
+func TestNewDockerClientFromRefAuthKey(t *testing.T) {
+	tmpDir := t.TempDir()
+	authFile := filepath.Join(tmpDir, "auth.json")
+	_, err := config.SetCredentials(&types.SystemContext{AuthFilePath: authFile}, "example.org/ns", "user", "password")
+	require.NoError(t, err)
+	registriesConf := filepath.Join(tmpDir, "registries.conf")
+	require.NoError(t, os.WriteFile(registriesConf, []byte{}, 0o600))
+	ref, err := ParseReference("//example.org/ns/repo:tag")
+	require.NoError(t, err)
+	dockerRef, ok := ref.(dockerReference)
+	require.True(t, ok)
+
+	for _, c := range []struct {
+		name     string
+		sys      *types.SystemContext
+		expected string
+	}{
+		{
+			name:     "auth file",
+			sys:      &types.SystemContext{AuthFilePath: authFile, SystemRegistriesConfPath: registriesConf},
+			expected: "example.org/ns", // The key the credentials were found under, not the registry
+		},
+		{
+			name: "DockerAuthConfig",
+			sys: &types.SystemContext{AuthFilePath: authFile, SystemRegistriesConfPath: registriesConf,
+				DockerAuthConfig: &types.DockerAuthConfig{Username: "explicit", Password: "password"}},
+			expected: "",
+		},
+	} {
+		client, err := newDockerClientFromRef(c.sys, dockerRef, &registryConfiguration{}, false, "pull")
+		require.NoError(t, err, c.name)
+		assert.Equal(t, c.expected, client.authKey, c.name)
+		client.Close()
+	}
+}
+
+func TestCredentialsRefresh(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "user" || password != "fresh" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+	registry := strings.TrimPrefix(s.URL, "http://")
+
+	for _, c := range []struct {
+		name               string
+		expiresIn          time.Duration
+		refreshedExpiresIn time.Duration
+		refreshes          int
+		status             int
+	}{
+		{"not expiring", time.Hour, time.Hour, 0, http.StatusUnauthorized},
+		{"about to expire", time.Minute, time.Hour, 1, http.StatusOK},
+		{"expired", -time.Minute, time.Hour, 1, http.StatusOK},
+		// The refresh is not repeated immediately if it did not help
+		{"refreshed also about to expire", time.Minute, 2 * time.Minute, 1, http.StatusOK},
+	} {
+		refreshes := 0
+		sys := &types.SystemContext{
+			DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+			DockerCredentialsRefresh: func(ctx context.Context, key string, expiring types.DockerAuthConfig) (types.DockerAuthConfig, error) {
+				refreshes++
+				assert.Equal(t, registry+"/ns/repo", key)
+				assert.Equal(t, "stale", expiring.Password)
+				return types.DockerAuthConfig{Username: "user", Password: "fresh", ExpiresAt: time.Now().Add(c.refreshedExpiresIn)}, nil
+			},
+		}
+		client, err := newDockerClient(sys, registry, registry)
+		require.NoError(t, err, c.name)
+		client.auth = types.DockerAuthConfig{Username: "user", Password: "stale", ExpiresAt: time.Now().Add(c.expiresIn)}
+		client.authLookupKey = registry + "/ns/repo"
+
+		for i := 0; i < 2; i++ {
+			res, err := client.makeRequest(context.Background(), http.MethodGet, "/v2/ns/repo/tags/list", nil, nil, v2Auth, nil)
+			require.NoError(t, err, c.name)
+			res.Body.Close()
+			assert.Equal(t, c.status, res.StatusCode, c.name)
+		}
+		assert.Equal(t, c.refreshes, refreshes, c.name)
+		client.Close()
+	}
+
+	// The callback is not called with the client locked: it can use the client, and other requests can proceed
+	// while the credentials are still valid.
+	var client *dockerClient
+	refreshStarted := make(chan struct{})
+	releaseRefresh := make(chan struct{})
+	sys := &types.SystemContext{
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+		DockerCredentialsRefresh: func(ctx context.Context, key string, expiring types.DockerAuthConfig) (types.DockerAuthConfig, error) {
+			auth, err := client.currentAuth(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, expiring, auth)
+			close(refreshStarted)
+			<-releaseRefresh
+			return types.DockerAuthConfig{Username: "user", Password: "fresh", ExpiresAt: time.Now().Add(time.Hour)}, nil
+		},
+	}
+	client, err := newDockerClient(sys, registry, registry)
+	require.NoError(t, err)
+	defer client.Close()
+	client.auth = types.DockerAuthConfig{Username: "user", Password: "stale", ExpiresAt: time.Now().Add(time.Minute)}
+	refreshed := make(chan types.DockerAuthConfig)
+	go func() {
+		auth, err := client.currentAuth(context.Background())
+		assert.NoError(t, err)
+		refreshed <- auth
+	}()
+	<-refreshStarted
+	auth, err := client.currentAuth(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "stale", auth.Password)
+	close(releaseRefresh)
+	assert.Equal(t, "fresh", (<-refreshed).Password)
+}
+
+func TestFetchManifestMIMETypeAliases(t *testing.T) {
+	const vendorMIMEType = "application/vnd.example.manifest.v1+json"
+	manifestBlob := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+		`"config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4","size":32},"layers":[]}`)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/ns/repo/manifests/tag" {
+			w.Header().Set("Content-Type", vendorMIMEType+"; charset=utf-8")
+			_, err := w.Write(manifestBlob)
+			assert.NoError(t, err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+	registry := strings.TrimPrefix(s.URL, "http://")
+	named, err := reference.ParseNormalizedNamed(registry + "/ns/repo:tag")
+	require.NoError(t, err)
+	ref, err := newReference(named, false)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		aliases  map[string]string
+		expected string
+	}{
+		{nil, vendorMIMEType},
+		{map[string]string{"application/vnd.example.other+json": imgspecv1.MediaTypeImageIndex}, vendorMIMEType},
+		{map[string]string{vendorMIMEType: imgspecv1.MediaTypeImageManifest}, imgspecv1.MediaTypeImageManifest},
+		{map[string]string{vendorMIMEType: ""}, imgspecv1.MediaTypeImageManifest},
+	} {
+		sys := &types.SystemContext{
+			DockerInsecureSkipTLSVerify:   types.OptionalBoolTrue,
+			DockerManifestMIMETypeAliases: c.aliases,
+		}
+		client, err := newDockerClient(sys, registry, registry)
+		require.NoError(t, err)
+		blob, mimeType, err := client.fetchManifest(context.Background(), ref, "tag")
+		require.NoError(t, err)
+		assert.Equal(t, manifestBlob, blob)
+		assert.Equal(t, c.expected, mimeType)
+		client.Close()
+	}
+
+	// If the MIME type can’t be guessed, it is used unmodified
+	client, err := newDockerClient(&types.SystemContext{DockerManifestMIMETypeAliases: map[string]string{vendorMIMEType: ""}}, registry, registry)
+	require.NoError(t, err)
+	defer client.Close()
+	assert.Equal(t, vendorMIMEType, client.resolveManifestMIMETypeAlias([]byte("not a manifest"), vendorMIMEType))
+}
+
+func TestClientMetrics(t *testing.T) {
+	const blobDigest = "sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	var serverURL string
+	blobRequests := 0
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/token":
+			fmt.Fprint(w, `{"token":"access"}`)
+		case "/v2/":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, serverURL))
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/v2/ns/repo/blobs/" + blobDigest:
+			blobRequests++
+			if blobRequests == 1 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			_, err := w.Write([]byte("blob contents"))
+			assert.NoError(t, err)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+	serverURL = s.URL
+	registry := strings.TrimPrefix(s.URL, "http://")
+	named, err := reference.ParseNormalizedNamed(registry + "/ns/repo:tag")
+	require.NoError(t, err)
+	ref, err := newReference(named, false)
+	require.NoError(t, err)
+
+	counters := metrics.NewCounters()
+	sys := &types.SystemContext{DockerInsecureSkipTLSVerify: types.OptionalBoolTrue, Metrics: counters}
+	c, err := newDockerClient(sys, registry, registry)
+	require.NoError(t, err)
+	defer c.Close()
+
+	reader, _, err := c.getBlob(context.Background(), ref, types.BlobInfo{Digest: blobDigest, Size: -1}, none.NoCache)
+	require.NoError(t, err)
+	_, err = io.Copy(io.Discard, reader)
+	require.NoError(t, err)
+	reader.Close()
+
+	registryLabels := types.MetricLabels{types.MetricLabelRegistry: registry}
+	assert.Equal(t, int64(len("blob contents")), counters.Get(types.MetricBytesPulled, registryLabels))
+	assert.Equal(t, int64(1), counters.Get(types.MetricRequestRetries, types.MetricLabels{types.MetricLabelRegistry: registry, types.MetricLabelReason: "too_many_requests"}))
+	assert.Equal(t, int64(1), counters.Get(types.MetricTokenFetches, types.MetricLabels{types.MetricLabelRegistry: registry, types.MetricLabelResult: "success"}))
+	assert.Equal(t, int64(0), counters.Get(types.MetricTokenFetches, types.MetricLabels{types.MetricLabelRegistry: registry, types.MetricLabelResult: "failure"}))
+}
+
 func TestNeedsRetryOnError(t *testing.T) {
-	needsRetry, _ := needsRetryWithUpdatedScope(errors.New("generic"), nil)
+	needsRetry, _ := needsRetryWithUpdatedScope(logging.Discard(), errors.New("generic"), nil)
 	if needsRetry {
 		t.Fatal("Got needRetry for a connection that included an error")
 	}
@@ -227,7 +553,7 @@ func TestNeedsRetryOnInsuficientScope(t *testing.T) {
 		actions:      "*",
 	}
 
-	needsRetry, scope := needsRetryWithUpdatedScope(nil, &resp)
+	needsRetry, scope := needsRetryWithUpdatedScope(logging.Discard(), nil, &resp)
 
 	if !needsRetry {
 		t.Fatal("Expected needing to retry")
@@ -242,7 +568,7 @@ func TestNeedsRetryNoRetryWhenNoAuthHeader(t *testing.T) {
 	resp := registrySuseComResp
 	delete(resp.Header, "Www-Authenticate")
 
-	needsRetry, _ := needsRetryWithUpdatedScope(nil, &resp)
+	needsRetry, _ := needsRetryWithUpdatedScope(logging.Discard(), nil, &resp)
 
 	if needsRetry {
 		t.Fatal("Expected no need to retry, as no Authentication headers are present")
@@ -255,7 +581,7 @@ func TestNeedsRetryNoRetryWhenNoBearerAuthHeader(t *testing.T) {
 		`OAuth2 realm="https://registry.suse.com/auth",service="SUSE Linux Docker Registry",scope="registry:catalog:*"`,
 	}
 
-	needsRetry, _ := needsRetryWithUpdatedScope(nil, &resp)
+	needsRetry, _ := needsRetryWithUpdatedScope(logging.Discard(), nil, &resp)
 
 	if needsRetry {
 		t.Fatal("Expected no need to retry, as no bearer authentication header is present")
@@ -268,7 +594,7 @@ func TestNeedsRetryNoRetryWhenNoErrorInBearer(t *testing.T) {
 		`Bearer realm="https://registry.suse.com/auth",service="SUSE Linux Docker Registry",scope="registry:catalog:*"`,
 	}
 
-	needsRetry, _ := needsRetryWithUpdatedScope(nil, &resp)
+	needsRetry, _ := needsRetryWithUpdatedScope(logging.Discard(), nil, &resp)
 
 	if needsRetry {
 		t.Fatal("Expected no need to retry, as no insufficient error is present in the authentication header")
@@ -281,7 +607,7 @@ func TestNeedsRetryNoRetryWhenInvalidErrorInBearer(t *testing.T) {
 		`Bearer realm="https://registry.suse.com/auth",service="SUSE Linux Docker Registry",scope="registry:catalog:*,error="random_error"`,
 	}
 
-	needsRetry, _ := needsRetryWithUpdatedScope(nil, &resp)
+	needsRetry, _ := needsRetryWithUpdatedScope(logging.Discard(), nil, &resp)
 
 	if needsRetry {
 		t.Fatal("Expected no need to retry, as no insufficient_error is present in the authentication header")
@@ -294,7 +620,7 @@ func TestNeedsRetryNoRetryWhenInvalidScope(t *testing.T) {
 		`Bearer realm="https://registry.suse.com/auth",service="SUSE Linux Docker Registry",scope="foo:bar",error="insufficient_scope"`,
 	}
 
-	needsRetry, _ := needsRetryWithUpdatedScope(nil, &resp)
+	needsRetry, _ := needsRetryWithUpdatedScope(logging.Discard(), nil, &resp)
 
 	if needsRetry {
 		t.Fatal("Expected no need to retry, as no insufficient_error is present in the authentication header")
@@ -326,7 +652,7 @@ func TestNeedsNoRetry(t *testing.T) {
 		},
 	}
 
-	needsRetry, _ := needsRetryWithUpdatedScope(nil, &resp)
+	needsRetry, _ := needsRetryWithUpdatedScope(logging.Discard(), nil, &resp)
 	if needsRetry {
 		t.Fatal("Got the need to retry, but none should be required")
 	}
@@ -404,9 +730,115 @@ func TestIsManifestUnknownError(t *testing.T) {
 		resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader([]byte(c.response))), nil)
 		require.NoError(t, err, c.name)
 		defer resp.Body.Close()
-		err = fmt.Errorf("wrapped: %w", registryHTTPResponseToError(resp))
+		err = fmt.Errorf("wrapped: %w", registryHTTPResponseToError(logging.Discard(), resp))
 
 		res := isManifestUnknownError(err)
 		assert.True(t, res, "%#v", err, c.name)
 	}
 }
+
+// recordingRateLimiter is a types.RegistryRateLimiter which records all calls, and fails them if err is set.
+type recordingRateLimiter struct {
+	mutex      sync.Mutex
+	registries []string
+	err        error
+}
+
+func (l *recordingRateLimiter) Wait(ctx context.Context, registry string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.registries = append(l.registries, registry)
+	return l.err
+}
+
+func TestClientRateLimiter(t *testing.T) {
+	var serverURL string
+	var requests atomic.Int32
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/token":
+			fmt.Fprint(w, `{"token":"access"}`)
+		case "/v2/":
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, serverURL))
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+	serverURL = s.URL
+	registry := strings.TrimPrefix(s.URL, "http://")
+	named, err := reference.ParseNormalizedNamed(registry + "/ns/repo:tag")
+	require.NoError(t, err)
+	ref, err := newReference(named, false)
+	require.NoError(t, err)
+
+	limiter := &recordingRateLimiter{}
+	sys := &types.SystemContext{DockerInsecureSkipTLSVerify: types.OptionalBoolTrue, RegistryRateLimiter: limiter}
+	c, err := newDockerClient(sys, registry, registry)
+	require.NoError(t, err)
+	defer c.Close()
+	_, _, err = c.fetchManifest(context.Background(), ref, "tag")
+	assert.ErrorIs(t, err, types.ErrNotFound)
+	// Every request to the server, including the token request, was preceded by a Wait call; the failed HTTPS attempt was counted as well.
+	assert.Equal(t, int(requests.Load())+1, len(limiter.registries))
+	for _, r := range limiter.registries {
+		assert.Equal(t, registry, r)
+	}
+
+	// If the limiter fails, no request is sent.
+	requests.Store(0)
+	limiter = &recordingRateLimiter{err: context.DeadlineExceeded}
+	sys = &types.SystemContext{DockerInsecureSkipTLSVerify: types.OptionalBoolTrue, RegistryRateLimiter: limiter}
+	c2, err := newDockerClient(sys, registry, registry)
+	require.NoError(t, err)
+	defer c2.Close()
+	_, _, err = c2.fetchManifest(context.Background(), ref, "tag")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int32(0), requests.Load())
+}
+
+func TestFetchManifestSizeLimit(t *testing.T) {
+	manifestBody := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/ns/repo/manifests/tag":
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			fmt.Fprint(w, manifestBody)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+	registry := strings.TrimPrefix(s.URL, "http://")
+	named, err := reference.ParseNormalizedNamed(registry + "/ns/repo:tag")
+	require.NoError(t, err)
+	ref, err := newReference(named, false)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		limit   int64
+		success bool
+	}{
+		{0, true},
+		{int64(len(manifestBody)), true},
+		{int64(len(manifestBody)) - 1, false},
+	} {
+		sys := &types.SystemContext{DockerInsecureSkipTLSVerify: types.OptionalBoolTrue, MaxManifestSize: c.limit}
+		client, err := newDockerClient(sys, registry, registry)
+		require.NoError(t, err)
+		defer client.Close()
+		m, _, err := client.fetchManifest(context.Background(), ref, "tag")
+		if c.success {
+			require.NoError(t, err)
+			assert.Equal(t, []byte(manifestBody), m)
+		} else {
+			var limitErr types.SizeLimitExceededError
+			require.ErrorAs(t, err, &limitErr)
+			assert.Equal(t, c.limit, limitErr.Limit)
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/image"
 	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/logging"
 	"github.com/containers/image/v5/types"
 	"github.com/opencontainers/go-digest"
 )
@@ -79,7 +80,7 @@ func GetRepositoryTags(ctx context.Context, sys *types.SystemContext, ref types.
 		}
 		defer res.Body.Close()
 		if res.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("fetching tags list: %w", registryHTTPResponseToError(res))
+			return nil, fmt.Errorf("fetching tags list: %w", registryHTTPResponseToError(client.logger, res))
 		}
 
 		var tagsHolder struct {
@@ -131,30 +132,13 @@ func GetDigest(ctx context.Context, sys *types.SystemContext, ref types.ImageRef
 	if err != nil {
 		return "", err
 	}
-
-	registryConfig, err := loadRegistryConfiguration(sys)
+	res, err := headManifest(ctx, sys, dr, tagOrDigest)
 	if err != nil {
 		return "", err
 	}
-	client, err := newDockerClientFromRef(sys, dr, registryConfig, false, "pull")
-	if err != nil {
-		return "", fmt.Errorf("failed to create client: %w", err)
-	}
-	defer client.Close()
-
-	path := fmt.Sprintf(manifestPath, reference.Path(dr.ref), tagOrDigest)
-	headers := map[string][]string{
-		"Accept": manifest.DefaultRequestedManifestMIMETypes,
-	}
-
-	res, err := client.makeRequest(ctx, http.MethodHead, path, headers, nil, v2Auth, nil)
-	if err != nil {
-		return "", err
-	}
-
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("reading digest %s in %s: %w", tagOrDigest, dr.ref.Name(), registryHTTPResponseToError(res))
+		return "", fmt.Errorf("reading digest %s in %s: %w", tagOrDigest, dr.ref.Name(), registryHTTPResponseToError(logging.For(sys), res))
 	}
 
 	dig, err := digest.Parse(res.Header.Get("Docker-Content-Digest"))
@@ -164,3 +148,25 @@ func GetDigest(ctx context.Context, sys *types.SystemContext, ref types.ImageRef
 
 	return dig, nil
 }
+
+// headManifest performs a HEAD request for the manifest tagOrDigest in the repository of ref, and returns the response.
+// The caller must close the response body.
+// NOTE: Like GetDigest, this ignores mirror configuration.
+func headManifest(ctx context.Context, sys *types.SystemContext, ref dockerReference, tagOrDigest string) (*http.Response, error) {
+	registryConfig, err := loadRegistryConfiguration(sys)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newDockerClientFromRef(sys, ref, registryConfig, false, "pull")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+	defer client.Close()
+
+	path := fmt.Sprintf(manifestPath, reference.Path(ref.ref), tagOrDigest)
+	headers := map[string][]string{
+		"Accept": manifest.DefaultRequestedManifestMIMETypes,
+	}
+
+	return client.makeRequest(ctx, http.MethodHead, path, headers, nil, v2Auth, nil)
+}
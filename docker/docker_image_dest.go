@@ -10,12 +10,11 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
 	"strings"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/blobinfocache"
+	"github.com/containers/image/v5/internal/digests"
 	"github.com/containers/image/v5/internal/imagedestination/impl"
 	"github.com/containers/image/v5/internal/imagedestination/stubs"
 	"github.com/containers/image/v5/internal/iolimits"
@@ -32,7 +31,6 @@ import (
 	v2 "github.com/docker/distribution/registry/api/v2"
 	"github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
-	"github.com/sirupsen/logrus"
 	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
 )
@@ -64,7 +62,7 @@ func newImageDestination(sys *types.SystemContext, ref dockerReference) (private
 		imgspecv1.MediaTypeImageIndex,
 		manifest.DockerV2ListMediaType,
 	}
-	if c.sys == nil || !c.sys.DockerDisableDestSchema1MIMETypes {
+	if c.sys != nil && c.sys.DockerSchema1Mode == types.DockerSchema1Allow && !c.sys.DockerDisableDestSchema1MIMETypes {
 		mimeTypes = append(mimeTypes, manifest.DockerV2Schema1SignedMediaType, manifest.DockerV2Schema1MediaType)
 	}
 
@@ -138,7 +136,7 @@ func (d *dockerImageDestination) PutBlobWithOptions(ctx context.Context, stream
 	// This functionality is particularly useful when BlobInfoCache has not been populated with compressed digests,
 	// the source blob is uncompressed, and the destination blob is being compressed "on the fly".
 	if inputInfo.Digest == "" && d.c.sys != nil && d.c.sys.DockerRegistryPushPrecomputeDigests {
-		logrus.Debugf("Precomputing digest layer for %s", reference.Path(d.ref.ref))
+		d.c.logger.Debugf("Precomputing digest layer for %s", reference.Path(d.ref.ref))
 		streamCopy, cleanup, err := streamdigest.ComputeBlobInfo(d.c.sys, stream, &inputInfo)
 		if err != nil {
 			return private.UploadedBlob{}, err
@@ -161,22 +159,22 @@ func (d *dockerImageDestination) PutBlobWithOptions(ctx context.Context, stream
 
 	// FIXME? Chunked upload, progress reporting, etc.
 	uploadPath := fmt.Sprintf(blobUploadPath, reference.Path(d.ref.ref))
-	logrus.Debugf("Uploading %s", uploadPath)
+	d.c.logger.Debugf("Uploading %s", uploadPath)
 	res, err := d.c.makeRequest(ctx, http.MethodPost, uploadPath, nil, nil, v2Auth, nil)
 	if err != nil {
 		return private.UploadedBlob{}, err
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusAccepted {
-		logrus.Debugf("Error initiating layer upload, response %#v", *res)
-		return private.UploadedBlob{}, fmt.Errorf("initiating layer upload to %s in %s: %w", uploadPath, d.c.registry, registryHTTPResponseToError(res))
+		d.c.logger.Debugf("Error initiating layer upload, response %#v", *res)
+		return private.UploadedBlob{}, fmt.Errorf("initiating layer upload to %s in %s: %w", uploadPath, d.c.registry, registryHTTPResponseToError(d.c.logger, res))
 	}
 	uploadLocation, err := res.Location()
 	if err != nil {
 		return private.UploadedBlob{}, fmt.Errorf("determining upload URL: %w", err)
 	}
 
-	digester, stream := putblobdigest.DigestIfCanonicalUnknown(stream, inputInfo)
+	digester, stream := putblobdigest.DigestIfAlgorithmUnknown(stream, inputInfo, digests.Algorithm(d.c.sys))
 	sizeCounter := &sizeCounter{}
 	stream = io.TeeReader(stream, sizeCounter)
 
@@ -187,12 +185,12 @@ func (d *dockerImageDestination) PutBlobWithOptions(ctx context.Context, stream
 		defer uploadReader.Terminate(errors.New("Reading data from an already terminated upload"))
 		res, err = d.c.makeRequestToResolvedURL(ctx, http.MethodPatch, uploadLocation, map[string][]string{"Content-Type": {"application/octet-stream"}}, uploadReader, inputInfo.Size, v2Auth, nil)
 		if err != nil {
-			logrus.Debugf("Error uploading layer chunked %v", err)
+			d.c.logger.Debugf("Error uploading layer chunked %v", err)
 			return nil, err
 		}
 		defer res.Body.Close()
 		if !successStatus(res.StatusCode) {
-			return nil, fmt.Errorf("uploading layer chunked: %w", registryHTTPResponseToError(res))
+			return nil, fmt.Errorf("uploading layer chunked: %w", registryHTTPResponseToError(d.c.logger, res))
 		}
 		uploadLocation, err := res.Location()
 		if err != nil {
@@ -200,6 +198,7 @@ func (d *dockerImageDestination) PutBlobWithOptions(ctx context.Context, stream
 		}
 		return uploadLocation, nil
 	}()
+	d.c.metrics.AddCounter(types.MetricBytesPushed, types.MetricLabels{types.MetricLabelRegistry: d.c.registry}, sizeCounter.size)
 	if err != nil {
 		return private.UploadedBlob{}, err
 	}
@@ -216,11 +215,11 @@ func (d *dockerImageDestination) PutBlobWithOptions(ctx context.Context, stream
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusCreated {
-		logrus.Debugf("Error uploading layer, response %#v", *res)
-		return private.UploadedBlob{}, fmt.Errorf("uploading layer to %s: %w", uploadLocation, registryHTTPResponseToError(res))
+		d.c.logger.Debugf("Error uploading layer, response %#v", *res)
+		return private.UploadedBlob{}, fmt.Errorf("uploading layer to %s: %w", uploadLocation, registryHTTPResponseToError(d.c.logger, res))
 	}
 
-	logrus.Debugf("Upload of layer %s complete", blobDigest)
+	d.c.logger.Debugf("Upload of layer %s complete", blobDigest)
 	options.Cache.RecordKnownLocation(d.ref.Transport(), bicTransportScope(d.ref), blobDigest, newBICLocationReference(d.ref))
 	return private.UploadedBlob{Digest: blobDigest, Size: sizeCounter.size}, nil
 }
@@ -230,7 +229,7 @@ func (d *dockerImageDestination) PutBlobWithOptions(ctx context.Context, stream
 // it returns a non-nil error only on an unexpected failure.
 func (d *dockerImageDestination) blobExists(ctx context.Context, repo reference.Named, digest digest.Digest, extraScope *authScope) (bool, int64, error) {
 	checkPath := fmt.Sprintf(blobsPath, reference.Path(repo), digest.String())
-	logrus.Debugf("Checking %s", checkPath)
+	d.c.logger.Debugf("Checking %s", checkPath)
 	res, err := d.c.makeRequest(ctx, http.MethodHead, checkPath, nil, nil, v2Auth, extraScope)
 	if err != nil {
 		return false, -1, err
@@ -238,16 +237,16 @@ func (d *dockerImageDestination) blobExists(ctx context.Context, repo reference.
 	defer res.Body.Close()
 	switch res.StatusCode {
 	case http.StatusOK:
-		logrus.Debugf("... already exists")
+		d.c.logger.Debugf("... already exists")
 		return true, getBlobSize(res), nil
 	case http.StatusUnauthorized:
-		logrus.Debugf("... not authorized")
-		return false, -1, fmt.Errorf("checking whether a blob %s exists in %s: %w", digest, repo.Name(), registryHTTPResponseToError(res))
+		d.c.logger.Debugf("... not authorized")
+		return false, -1, fmt.Errorf("checking whether a blob %s exists in %s: %w", digest, repo.Name(), registryHTTPResponseToError(d.c.logger, res))
 	case http.StatusNotFound:
-		logrus.Debugf("... not present")
+		d.c.logger.Debugf("... not present")
 		return false, -1, nil
 	default:
-		return false, -1, fmt.Errorf("checking whether a blob %s exists in %s: %w", digest, repo.Name(), registryHTTPResponseToError(res))
+		return false, -1, fmt.Errorf("checking whether a blob %s exists in %s: %w", digest, repo.Name(), registryHTTPResponseToError(d.c.logger, res))
 	}
 }
 
@@ -260,7 +259,7 @@ func (d *dockerImageDestination) mountBlob(ctx context.Context, srcRepo referenc
 			"from":  {reference.Path(srcRepo)},
 		}.Encode(),
 	}
-	logrus.Debugf("Trying to mount %s", u.Redacted())
+	d.c.logger.Debugf("Trying to mount %s", u.Redacted())
 	res, err := d.c.makeRequest(ctx, http.MethodPost, u.String(), nil, nil, v2Auth, extraScope)
 	if err != nil {
 		return err
@@ -268,7 +267,7 @@ func (d *dockerImageDestination) mountBlob(ctx context.Context, srcRepo referenc
 	defer res.Body.Close()
 	switch res.StatusCode {
 	case http.StatusCreated:
-		logrus.Debugf("... mount OK")
+		d.c.logger.Debugf("... mount OK")
 		return nil
 	case http.StatusAccepted:
 		// Oops, the mount was ignored - either the registry does not support that yet, or the blob does not exist; the registry has started an ordinary upload process.
@@ -278,21 +277,21 @@ func (d *dockerImageDestination) mountBlob(ctx context.Context, srcRepo referenc
 		if err != nil {
 			return fmt.Errorf("determining upload URL after a mount attempt: %w", err)
 		}
-		logrus.Debugf("... started an upload instead of mounting, trying to cancel at %s", uploadLocation.Redacted())
+		d.c.logger.Debugf("... started an upload instead of mounting, trying to cancel at %s", uploadLocation.Redacted())
 		res2, err := d.c.makeRequestToResolvedURL(ctx, http.MethodDelete, uploadLocation, nil, nil, -1, v2Auth, extraScope)
 		if err != nil {
-			logrus.Debugf("Error trying to cancel an inadvertent upload: %s", err)
+			d.c.logger.Debugf("Error trying to cancel an inadvertent upload: %s", err)
 		} else {
 			defer res2.Body.Close()
 			if res2.StatusCode != http.StatusNoContent {
-				logrus.Debugf("Error trying to cancel an inadvertent upload, status %s", http.StatusText(res.StatusCode))
+				d.c.logger.Debugf("Error trying to cancel an inadvertent upload, status %s", http.StatusText(res.StatusCode))
 			}
 		}
 		// Anyway, if canceling the upload fails, ignore it and return the more important error:
 		return fmt.Errorf("Mounting %s from %s to %s started an upload instead", srcDigest, srcRepo.Name(), d.ref.ref.Name())
 	default:
-		logrus.Debugf("Error mounting, response %#v", *res)
-		return fmt.Errorf("mounting %s from %s to %s: %w", srcDigest, srcRepo.Name(), d.ref.ref.Name(), registryHTTPResponseToError(res))
+		d.c.logger.Debugf("Error mounting, response %#v", *res)
+		return fmt.Errorf("mounting %s from %s to %s: %w", srcDigest, srcRepo.Name(), d.ref.ref.Name(), registryHTTPResponseToError(d.c.logger, res))
 	}
 }
 
@@ -335,7 +334,7 @@ func (d *dockerImageDestination) TryReusingBlobWithOptions(ctx context.Context,
 		if options.OriginalCompression != nil {
 			requiredCompression = options.OriginalCompression.Name()
 		}
-		logrus.Debugf("Ignoring exact blob match case due to compression mismatch ( %s vs %s )", options.RequiredCompression.Name(), requiredCompression)
+		d.c.logger.Debugf("Ignoring exact blob match case due to compression mismatch ( %s vs %s )", options.RequiredCompression.Name(), requiredCompression)
 	}
 
 	// Then try reusing blobs from other locations.
@@ -344,14 +343,14 @@ func (d *dockerImageDestination) TryReusingBlobWithOptions(ctx context.Context,
 		var err error
 		compressionOperation, compressionAlgorithm, err := blobinfocache.OperationAndAlgorithmForCompressor(candidate.CompressorName)
 		if err != nil {
-			logrus.Debugf("OperationAndAlgorithmForCompressor Failed: %v", err)
+			d.c.logger.Debugf("OperationAndAlgorithmForCompressor Failed: %v", err)
 			continue
 		}
 		var candidateRepo reference.Named
 		if !candidate.UnknownLocation {
 			candidateRepo, err = parseBICLocationReference(candidate.Location)
 			if err != nil {
-				logrus.Debugf("Error parsing BlobInfoCache location reference: %s", err)
+				d.c.logger.Debugf("Error parsing BlobInfoCache location reference: %s", err)
 				continue
 			}
 		}
@@ -361,17 +360,17 @@ func (d *dockerImageDestination) TryReusingBlobWithOptions(ctx context.Context,
 				requiredCompression = compressionAlgorithm.Name()
 			}
 			if !candidate.UnknownLocation {
-				logrus.Debugf("Ignoring candidate blob %s as reuse candidate due to compression mismatch ( %s vs %s ) in %s", candidate.Digest.String(), options.RequiredCompression.Name(), requiredCompression, candidateRepo.Name())
+				d.c.logger.Debugf("Ignoring candidate blob %s as reuse candidate due to compression mismatch ( %s vs %s ) in %s", candidate.Digest.String(), options.RequiredCompression.Name(), requiredCompression, candidateRepo.Name())
 			} else {
-				logrus.Debugf("Ignoring candidate blob %s as reuse candidate due to compression mismatch ( %s vs %s ) with no location match, checking current repo", candidate.Digest.String(), options.RequiredCompression.Name(), requiredCompression)
+				d.c.logger.Debugf("Ignoring candidate blob %s as reuse candidate due to compression mismatch ( %s vs %s ) with no location match, checking current repo", candidate.Digest.String(), options.RequiredCompression.Name(), requiredCompression)
 			}
 			continue
 		}
 		if !candidate.UnknownLocation {
 			if candidate.CompressorName != blobinfocache.Uncompressed {
-				logrus.Debugf("Trying to reuse blob with cached digest %s compressed with %s in destination repo %s", candidate.Digest.String(), candidate.CompressorName, candidateRepo.Name())
+				d.c.logger.Debugf("Trying to reuse blob with cached digest %s compressed with %s in destination repo %s", candidate.Digest.String(), candidate.CompressorName, candidateRepo.Name())
 			} else {
-				logrus.Debugf("Trying to reuse blob with cached digest %s in destination repo %s", candidate.Digest.String(), candidateRepo.Name())
+				d.c.logger.Debugf("Trying to reuse blob with cached digest %s in destination repo %s", candidate.Digest.String(), candidateRepo.Name())
 			}
 			// Sanity checks:
 			if reference.Domain(candidateRepo) != reference.Domain(d.ref.ref) {
@@ -380,14 +379,14 @@ func (d *dockerImageDestination) TryReusingBlobWithOptions(ctx context.Context,
 				//
 				// OTOH that would mean we can’t do the “blobExists” check, and if there is no match
 				// we could get an upload request that we would have to cancel.
-				logrus.Debugf("... Internal error: domain %s does not match destination %s", reference.Domain(candidateRepo), reference.Domain(d.ref.ref))
+				d.c.logger.Debugf("... Internal error: domain %s does not match destination %s", reference.Domain(candidateRepo), reference.Domain(d.ref.ref))
 				continue
 			}
 		} else {
 			if candidate.CompressorName != blobinfocache.Uncompressed {
-				logrus.Debugf("Trying to reuse blob with cached digest %s compressed with %s with no location match, checking current repo", candidate.Digest.String(), candidate.CompressorName)
+				d.c.logger.Debugf("Trying to reuse blob with cached digest %s compressed with %s with no location match, checking current repo", candidate.Digest.String(), candidate.CompressorName)
 			} else {
-				logrus.Debugf("Trying to reuse blob with cached digest %s in destination repo with no location match, checking current repo", candidate.Digest.String())
+				d.c.logger.Debugf("Trying to reuse blob with cached digest %s in destination repo with no location match, checking current repo", candidate.Digest.String())
 			}
 			// This digest is a known variant of this blob but we don’t
 			// have a recorded location in this registry, let’s try looking
@@ -395,7 +394,7 @@ func (d *dockerImageDestination) TryReusingBlobWithOptions(ctx context.Context,
 			candidateRepo = reference.TrimNamed(d.ref.ref)
 		}
 		if candidateRepo.Name() == d.ref.ref.Name() && candidate.Digest == info.Digest {
-			logrus.Debug("... Already tried the primary destination")
+			d.c.logger.Debugf("... Already tried the primary destination")
 			continue
 		}
 
@@ -417,16 +416,16 @@ func (d *dockerImageDestination) TryReusingBlobWithOptions(ctx context.Context,
 		// so, be a nice client and don't create unnecessary upload sessions on the server.
 		exists, size, err := d.blobExists(ctx, candidateRepo, candidate.Digest, extraScope)
 		if err != nil {
-			logrus.Debugf("... Failed: %v", err)
+			d.c.logger.Debugf("... Failed: %v", err)
 			continue
 		}
 		if !exists {
 			// FIXME? Should we drop the blob from cache here (and elsewhere?)?
-			continue // logrus.Debug() already happened in blobExists
+			continue // Debug logging already happened in blobExists
 		}
 		if candidateRepo.Name() != d.ref.ref.Name() {
 			if err := d.mountBlob(ctx, candidateRepo, candidate.Digest, extraScope); err != nil {
-				logrus.Debugf("... Mount failed: %v", err)
+				d.c.logger.Debugf("... Mount failed: %v", err)
 				continue
 			}
 		}
@@ -451,6 +450,10 @@ func (d *dockerImageDestination) TryReusingBlobWithOptions(ctx context.Context,
 // If the destination is in principle available, refuses this manifest type (e.g. it does not recognize the schema),
 // but may accept a different manifest type, the returned error must be an ManifestTypeRejectedError.
 func (d *dockerImageDestination) PutManifest(ctx context.Context, m []byte, instanceDigest *digest.Digest) error {
+	if mimeType := manifest.GuessMIMEType(m); (mimeType == manifest.DockerV2Schema1SignedMediaType || mimeType == manifest.DockerV2Schema1MediaType) &&
+		(d.c.sys == nil || d.c.sys.DockerSchema1Mode != types.DockerSchema1Allow) {
+		return types.ManifestTypeRejectedError{Err: fmt.Errorf("refusing to push a deprecated Docker schema1 manifest to %s; set DockerSchema1Mode in SystemContext to allow it", d.ref.ref.Name())}
+	}
 	var refTail string
 	// If d.ref.isUnknownDigest=true, then we push without a tag, so get the
 	// digest that will be used
@@ -466,16 +469,8 @@ func (d *dockerImageDestination) PutManifest(ctx context.Context, m []byte, inst
 		// particular instance.
 		refTail = instanceDigest.String()
 		// Double-check that the manifest we've been given matches the digest we've been given.
-		matches, err := manifest.MatchesDigest(m, *instanceDigest)
-		if err != nil {
-			return fmt.Errorf("digesting manifest in PutManifest: %w", err)
-		}
-		if !matches {
-			manifestDigest, merr := manifest.Digest(m)
-			if merr != nil {
-				return fmt.Errorf("Attempted to PutManifest using an explicitly specified digest (%q) that didn't match the manifest's digest: %w", instanceDigest.String(), merr)
-			}
-			return fmt.Errorf("Attempted to PutManifest using an explicitly specified digest (%q) that didn't match the manifest's digest (%q)", instanceDigest.String(), manifestDigest.String())
+		if _, err := manifest.VerifyManifestDigest(m, "", *instanceDigest); err != nil {
+			return fmt.Errorf("PutManifest using an explicitly specified digest: %w", err)
 		}
 	} else {
 		// Compute the digest of the main manifest, or the list if it's a list, so that we
@@ -493,11 +488,12 @@ func (d *dockerImageDestination) PutManifest(ctx context.Context, m []byte, inst
 		}
 	}
 
-	return d.uploadManifest(ctx, m, refTail)
+	_, err := d.uploadManifest(ctx, m, refTail)
+	return err
 }
 
-// uploadManifest writes manifest to tagOrDigest.
-func (d *dockerImageDestination) uploadManifest(ctx context.Context, m []byte, tagOrDigest string) error {
+// uploadManifest writes manifest to tagOrDigest, and returns the headers of the registry’s response.
+func (d *dockerImageDestination) uploadManifest(ctx context.Context, m []byte, tagOrDigest string) (http.Header, error) {
 	path := fmt.Sprintf(manifestPath, reference.Path(d.ref.ref), tagOrDigest)
 
 	headers := map[string][]string{}
@@ -507,16 +503,16 @@ func (d *dockerImageDestination) uploadManifest(ctx context.Context, m []byte, t
 	}
 	res, err := d.c.makeRequest(ctx, http.MethodPut, path, headers, bytes.NewReader(m), v2Auth, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer res.Body.Close()
 	if !successStatus(res.StatusCode) {
-		rawErr := registryHTTPResponseToError(res)
+		rawErr := registryHTTPResponseToError(d.c.logger, res)
 		err := fmt.Errorf("uploading manifest %s to %s: %w", tagOrDigest, d.ref.ref.Name(), rawErr)
 		if isManifestInvalidError(rawErr) {
 			err = types.ManifestTypeRejectedError{Err: err}
 		}
-		return err
+		return nil, err
 	}
 	// A HTTP server may not be a registry at all, and just return 200 OK to everything
 	// (in particular that can fairly easily happen after tearing down a website and
@@ -528,9 +524,9 @@ func (d *dockerImageDestination) uploadManifest(ctx context.Context, m []byte, t
 	// https://github.com/opencontainers/distribution-spec/blob/ec90a2af85fe4d612cf801e1815b95bfa40ae72b/spec.md#legacy-docker-support-http-headers
 	// So, just note the missing header in a debug log.
 	if v := res.Header.Values("Docker-Content-Digest"); len(v) == 0 {
-		logrus.Debugf("Manifest upload response didn’t contain a Docker-Content-Digest header, it might not be a container registry")
+		d.c.logger.Debugf("Manifest upload response didn’t contain a Docker-Content-Digest header, it might not be a container registry")
 	}
-	return nil
+	return res.Header, nil
 }
 
 // successStatus returns true if the argument is a successful HTTP response
@@ -608,7 +604,7 @@ func (d *dockerImageDestination) PutSignaturesWithFormat(ctx context.Context, si
 				return err
 			}
 		case d.c.signatureBase != nil:
-			if err := d.putSignaturesToLookaside(signatures, *instanceDigest); err != nil {
+			if err := d.putSignaturesToLookaside(ctx, signatures, *instanceDigest); err != nil {
 				return err
 			}
 		default:
@@ -621,7 +617,7 @@ func (d *dockerImageDestination) PutSignaturesWithFormat(ctx context.Context, si
 
 // putSignaturesToLookaside implements PutSignaturesWithFormat() from the lookaside location configured in s.c.signatureBase,
 // which is not nil, for a manifest with manifestDigest.
-func (d *dockerImageDestination) putSignaturesToLookaside(signatures []signature.Signature, manifestDigest digest.Digest) error {
+func (d *dockerImageDestination) putSignaturesToLookaside(ctx context.Context, signatures []signature.Signature, manifestDigest digest.Digest) error {
 	// FIXME? This overwrites files one at a time, definitely not atomic.
 	// A failure when updating signatures with a reordered copy could lose some of them.
 
@@ -633,7 +629,7 @@ func (d *dockerImageDestination) putSignaturesToLookaside(signatures []signature
 	// NOTE: Keep this in sync with docs/signature-protocols.md!
 	for i, signature := range signatures {
 		sigURL := lookasideStorageURL(d.c.signatureBase, manifestDigest, i)
-		err := d.putOneSignature(sigURL, signature)
+		err := d.putOneSignature(ctx, sigURL, signature)
 		if err != nil {
 			return err
 		}
@@ -645,7 +641,7 @@ func (d *dockerImageDestination) putSignaturesToLookaside(signatures []signature
 	// is sufficient.
 	for i := len(signatures); ; i++ {
 		sigURL := lookasideStorageURL(d.c.signatureBase, manifestDigest, i)
-		missing, err := d.c.deleteOneSignature(sigURL)
+		missing, err := d.c.deleteOneSignature(ctx, sigURL)
 		if err != nil {
 			return err
 		}
@@ -659,35 +655,25 @@ func (d *dockerImageDestination) putSignaturesToLookaside(signatures []signature
 
 // putOneSignature stores sig to sigURL.
 // NOTE: Keep this in sync with docs/signature-protocols.md!
-func (d *dockerImageDestination) putOneSignature(sigURL *url.URL, sig signature.Signature) error {
-	switch sigURL.Scheme {
-	case "file":
-		logrus.Debugf("Writing to %s", sigURL.Path)
-		err := os.MkdirAll(filepath.Dir(sigURL.Path), 0755)
-		if err != nil {
-			return err
-		}
-		blob, err := signature.Blob(sig)
-		if err != nil {
-			return err
-		}
-		err = os.WriteFile(sigURL.Path, blob, 0644)
-		if err != nil {
-			return err
-		}
-		return nil
-
-	case "http", "https":
-		return fmt.Errorf("Writing directly to a %s lookaside %s is not supported. Configure a lookaside-staging: location", sigURL.Scheme, sigURL.Redacted())
-	default:
-		return fmt.Errorf("Unsupported scheme when writing signature to %s", sigURL.Redacted())
+func (d *dockerImageDestination) putOneSignature(ctx context.Context, sigURL *url.URL, sig signature.Signature) error {
+	writer, err := d.c.lookasideWriter(sigURL)
+	if err != nil {
+		return err
 	}
+	blob, err := signature.Blob(sig)
+	if err != nil {
+		return err
+	}
+	return writer.PutSignature(ctx, sigURL, blob)
 }
 
 func (d *dockerImageDestination) putSignaturesToSigstoreAttachments(ctx context.Context, signatures []signature.Sigstore, manifestDigest digest.Digest) error {
 	if !d.c.useSigstoreAttachments {
 		return errors.New("writing sigstore attachments is disabled by configuration")
 	}
+	if d.c.useSigstoreReferrers {
+		return d.putSignaturesAsReferrers(ctx, signatures, manifestDigest)
+	}
 
 	ociManifest, err := d.c.getSigstoreAttachmentManifest(ctx, d.ref, manifestDigest)
 	if err != nil {
@@ -702,9 +688,9 @@ func (d *dockerImageDestination) putSignaturesToSigstoreAttachments(ctx context.
 		}, nil)
 		ociConfig.RootFS.Type = "layers"
 	} else {
-		logrus.Debugf("Fetching sigstore attachment config %s", ociManifest.Config.Digest.String())
+		d.c.logger.Debugf("Fetching sigstore attachment config %s", ociManifest.Config.Digest.String())
 		// We don’t benefit from a real BlobInfoCache here because we never try to reuse/mount configs.
-		configBlob, err := d.c.getOCIDescriptorContents(ctx, d.ref, ociManifest.Config, iolimits.MaxConfigBodySize,
+		configBlob, err := d.c.getOCIDescriptorContents(ctx, d.ref, ociManifest.Config, iolimits.ConfigSizeLimit(d.c.sys),
 			none.NoCache)
 		if err != nil {
 			return err
@@ -727,7 +713,7 @@ func (d *dockerImageDestination) putSignaturesToSigstoreAttachments(ctx context.
 		alreadyOnRegistry := false
 		for _, layer := range ociManifest.Layers {
 			if layerMatchesSigstoreSignature(layer, mimeType, payloadBlob, annotations) {
-				logrus.Debugf("Signature with digest %s already exists on the registry", layer.Digest.String())
+				d.c.logger.Debugf("Signature with digest %s already exists on the registry", layer.Digest.String())
 				alreadyOnRegistry = true
 				break
 			}
@@ -751,14 +737,14 @@ func (d *dockerImageDestination) putSignaturesToSigstoreAttachments(ctx context.
 		sigDesc.Annotations = annotations
 		ociManifest.Layers = append(ociManifest.Layers, sigDesc)
 		ociConfig.RootFS.DiffIDs = append(ociConfig.RootFS.DiffIDs, sigDesc.Digest)
-		logrus.Debugf("Adding new signature, digest %s", sigDesc.Digest.String())
+		d.c.logger.Debugf("Adding new signature, digest %s", sigDesc.Digest.String())
 	}
 
 	configBlob, err := json.Marshal(ociConfig)
 	if err != nil {
 		return err
 	}
-	logrus.Debugf("Uploading updated sigstore attachment config")
+	d.c.logger.Debugf("Uploading updated sigstore attachment config")
 	// We don’t benefit from a real BlobInfoCache here because we never try to reuse/mount configs.
 	configDesc, err := d.putBlobBytesAsOCI(ctx, configBlob, imgspecv1.MediaTypeImageConfig, private.PutBlobOptions{
 		Cache:      none.NoCache,
@@ -775,8 +761,9 @@ func (d *dockerImageDestination) putSignaturesToSigstoreAttachments(ctx context.
 	if err != nil {
 		return err
 	}
-	logrus.Debugf("Uploading sigstore attachment manifest")
-	return d.uploadManifest(ctx, manifestBlob, sigstoreAttachmentTag(manifestDigest))
+	d.c.logger.Debugf("Uploading sigstore attachment manifest")
+	_, err = d.uploadManifest(ctx, manifestBlob, sigstoreAttachmentTag(manifestDigest))
+	return err
 }
 
 func layerMatchesSigstoreSignature(layer imgspecv1.Descriptor, mimeType string,
@@ -817,21 +804,12 @@ func (d *dockerImageDestination) putBlobBytesAsOCI(ctx context.Context, contents
 // deleteOneSignature deletes a signature from sigURL, if it exists.
 // If it successfully determines that the signature does not exist, returns (true, nil)
 // NOTE: Keep this in sync with docs/signature-protocols.md!
-func (c *dockerClient) deleteOneSignature(sigURL *url.URL) (missing bool, err error) {
-	switch sigURL.Scheme {
-	case "file":
-		logrus.Debugf("Deleting %s", sigURL.Path)
-		err := os.Remove(sigURL.Path)
-		if err != nil && os.IsNotExist(err) {
-			return true, nil
-		}
+func (c *dockerClient) deleteOneSignature(ctx context.Context, sigURL *url.URL) (missing bool, err error) {
+	writer, err := c.lookasideWriter(sigURL)
+	if err != nil {
 		return false, err
-
-	case "http", "https":
-		return false, fmt.Errorf("Writing directly to a %s lookaside %s is not supported. Configure a lookaside-staging: location", sigURL.Scheme, sigURL.Redacted())
-	default:
-		return false, fmt.Errorf("Unsupported scheme when deleting signature from %s", sigURL.Redacted())
 	}
+	return writer.DeleteSignature(ctx, sigURL)
 }
 
 // putSignaturesToAPIExtension implements PutSignaturesWithFormat() using the X-Registry-Supports-Signatures API extension,
@@ -899,8 +877,8 @@ func (d *dockerImageDestination) putSignaturesToAPIExtension(ctx context.Context
 		}
 		defer res.Body.Close()
 		if res.StatusCode != http.StatusCreated {
-			logrus.Debugf("Error uploading signature, status %d, %#v", res.StatusCode, res)
-			return fmt.Errorf("uploading signature to %s in %s: %w", path, d.c.registry, registryHTTPResponseToError(res))
+			d.c.logger.Debugf("Error uploading signature, status %d, %#v", res.StatusCode, res)
+			return fmt.Errorf("uploading signature to %s in %s: %w", path, d.c.registry, registryHTTPResponseToError(d.c.logger, res))
 		}
 	}
 
@@ -7,6 +7,7 @@ import (
 	"testing"
 
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/pkg/logging"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -29,7 +30,7 @@ func TestIsManifestInvalidError(t *testing.T) {
 	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader([]byte(response))), nil)
 	require.NoError(t, err)
 	defer resp.Body.Close()
-	err = registryHTTPResponseToError(resp)
+	err = registryHTTPResponseToError(logging.Discard(), resp)
 
 	res := isManifestInvalidError(err)
 	assert.True(t, res, "%#v", err)
@@ -14,18 +14,23 @@ import (
 	"sync"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/errclass"
 	"github.com/containers/image/v5/internal/imagesource/impl"
 	"github.com/containers/image/v5/internal/imagesource/stubs"
 	"github.com/containers/image/v5/internal/iolimits"
+	internalManifest "github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/pkg/docker/config"
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/pkg/metrics"
 	"github.com/containers/image/v5/pkg/sysregistriesv2"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage/pkg/regexp"
 	digest "github.com/opencontainers/go-digest"
-	"github.com/sirupsen/logrus"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // maxLookasideSignatures is an arbitrary limit for the total number of signatures we would try to read from a lookaside server,
@@ -58,27 +63,12 @@ func newImageSource(ctx context.Context, sys *types.SystemContext, ref dockerRef
 	if err != nil {
 		return nil, err
 	}
-	registry, err := sysregistriesv2.FindRegistry(sys, ref.ref.Name())
-	if err != nil {
-		return nil, fmt.Errorf("loading registries configuration: %w", err)
-	}
-	if registry == nil {
-		// No configuration was found for the provided reference, so use the
-		// equivalent of a default configuration.
-		registry = &sysregistriesv2.Registry{
-			Endpoint: sysregistriesv2.Endpoint{
-				Location: ref.ref.String(),
-			},
-			Prefix: ref.ref.String(),
-		}
-	}
-
 	// Check all endpoints for the manifest availability. If we find one that does
 	// contain the image, it will be used for all future pull actions.  Always try the
 	// non-mirror original location last; this both transparently handles the case
 	// of no mirrors configured, and ensures we return the error encountered when
 	// accessing the upstream location if all endpoints fail.
-	pullSources, err := registry.PullSourcesFromReference(ref.ref)
+	pullSources, err := config.GetPullSources(sys, ref.ref)
 	if err != nil {
 		return nil, err
 	}
@@ -87,17 +77,23 @@ func newImageSource(ctx context.Context, sys *types.SystemContext, ref dockerRef
 		err error
 	}
 	attempts := []attempt{}
-	for _, pullSource := range pullSources {
+	for i, pullSource := range pullSources {
 		if sys != nil && sys.DockerLogMirrorChoice {
-			logrus.Infof("Trying to access %q", pullSource.Reference)
+			logging.For(sys).Infof("Trying to access %q", pullSource.Reference)
 		} else {
-			logrus.Debugf("Trying to access %q", pullSource.Reference)
+			logging.For(sys).Debugf("Trying to access %q", pullSource.Reference)
 		}
 		s, err := newImageSourceAttempt(ctx, sys, ref, pullSource, registryConfig)
 		if err == nil {
 			return s, nil
 		}
-		logrus.Debugf("Accessing %q failed: %v", pullSource.Reference, err)
+		logging.For(sys).Debugf("Accessing %q failed: %v", pullSource.Reference, err)
+		if i < len(pullSources)-1 { // The primary location is always last
+			metrics.For(sys).AddCounter(types.MetricMirrorFallbacks, types.MetricLabels{
+				types.MetricLabelRegistry: reference.Domain(ref.ref),
+				types.MetricLabelMirror:   reference.Domain(pullSource.Reference),
+			}, 1)
+		}
 		attempts = append(attempts, attempt{
 			ref: pullSource.Reference,
 			err: err,
@@ -121,6 +117,37 @@ func newImageSource(ctx context.Context, sys *types.SystemContext, ref dockerRef
 	}
 }
 
+// NewImageSourceFromDescriptor returns an ImageSource for the manifest described by desc (e.g. as returned by a referrers listing,
+// or listed in an index) in the repository of ref, without resolving the tag of ref, if any.
+// The manifest must match desc.Digest, and desc.Size if set; desc.MediaType, if set, is reported as the MIME type of the manifest.
+// The returned ImageSource refers to the manifest using its digest.
+// The caller must call .Close() on the returned ImageSource.
+func NewImageSourceFromDescriptor(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, desc imgspecv1.Descriptor) (types.ImageSource, error) {
+	dr, ok := ref.(dockerReference)
+	if !ok {
+		return nil, errors.New("ref must be a dockerReference")
+	}
+	named, err := reference.WithDigest(reference.TrimNamed(dr.ref), desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	digestedRef, err := newReference(named, false)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newImageSource(ctx, sys, digestedRef)
+	if err != nil {
+		return nil, err
+	}
+	m, err := internalManifest.VerifyManifestDescriptor(s.cachedManifest, s.cachedManifestMIMEType, desc)
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("reading manifest %s in %s: %w", desc.Digest, named.Name(), err)
+	}
+	s.cachedManifestMIMEType = m.MIMEType()
+	return s, nil
+}
+
 // newImageSourceAttempt is an internal helper for newImageSource. Everyone else must call newImageSource.
 // Given a logicalReference and a pullSource, return a dockerImageSource if it is reachable.
 // The caller must call .Close() on the returned ImageSource.
@@ -130,9 +157,16 @@ func newImageSourceAttempt(ctx context.Context, sys *types.SystemContext, logica
 	if err != nil {
 		return nil, err
 	}
+	// Look up credentials only for the endpoint we are actually trying, so that a failure for one mirror
+	// does not prevent using the others.
+	creds, credsSource, err := config.GetCredentialsForPullSource(sys, logicalRef.ref, pullSource)
+	if err != nil {
+		return nil, err
+	}
 
 	endpointSys := sys
 	// sys.DockerAuthConfig does not explicitly specify a registry; we must not blindly send the credentials intended for the primary endpoint to mirrors.
+	// (creds already accounts for that, but newDockerClientFromRefWithAuth also consults these fields.)
 	if endpointSys != nil && endpointSys.DockerAuthConfig != nil && reference.Domain(physicalRef.ref) != reference.Domain(logicalRef.ref) {
 		copy := *endpointSys
 		copy.DockerAuthConfig = nil
@@ -140,11 +174,12 @@ func newImageSourceAttempt(ctx context.Context, sys *types.SystemContext, logica
 		endpointSys = &copy
 	}
 
-	client, err := newDockerClientFromRef(endpointSys, physicalRef, registryConfig, false, "pull")
+	client, err := newDockerClientFromRefWithAuth(endpointSys, physicalRef, creds, credsSource, registryConfig, false, "pull")
 	if err != nil {
 		return nil, err
 	}
 	client.tlsClientConfig.InsecureSkipVerify = pullSource.Endpoint.Insecure
+	client.pinnedPublicKeys = pullSource.Endpoint.PinnedPublicKeys
 
 	s := &dockerImageSource{
 		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
@@ -333,12 +368,43 @@ func parseMediaType(contentType string) (string, map[string]string, error) {
 	return mediaType, params, err
 }
 
-// GetBlobAt returns a sequential channel of readers that contain data for the requested
-// blob chunks, and a channel that might get a single error value.
-// The specified chunks must be not overlapping and sorted by their offset.
-// The readers must be fully consumed, in the order they are returned, before blocking
-// to read the next chunk.
-func (s *dockerImageSource) GetBlobAt(ctx context.Context, info types.BlobInfo, chunks []private.ImageSourceChunk) (chan io.ReadCloser, chan error, error) {
+// maxRangeHeaderLength is the maximum length of the value of the Range header in a single GetBlobAt request.
+// Registries and proxies commonly reject requests with very large headers, so if there are many chunks,
+// they are fetched using several requests.
+const maxRangeHeaderLength = 4096
+
+// splitChunksByRangeHeader splits chunks, in order, into batches which can each be requested using a Range header
+// with a value of at most maxLength bytes; every batch contains at least one chunk.
+func splitChunksByRangeHeader(chunks []private.ImageSourceChunk, maxLength int) [][]private.ImageSourceChunk {
+	res := [][]private.ImageSourceChunk{}
+	batchStart := 0
+	length := len("bytes=")
+	for i, c := range chunks {
+		rangeLength := len(fmt.Sprintf("%d-%d", c.Offset, c.Offset+c.Length-1))
+		if i > batchStart {
+			rangeLength++ // The separating comma
+			if length+rangeLength > maxLength {
+				res = append(res, chunks[batchStart:i])
+				batchStart = i
+				length = len("bytes=")
+				rangeLength--
+			}
+		}
+		length += rangeLength
+	}
+	return append(res, chunks[batchStart:])
+}
+
+// blobAtResponse is a successful response to a request for chunks of a blob.
+type blobAtResponse struct {
+	body      io.ReadCloser
+	full      bool // The server ignored the Range header, and body contains the full blob.
+	mediaType string
+	params    map[string]string
+}
+
+// getBlobRanges requests chunks of the blob described by info.
+func (s *dockerImageSource) getBlobRanges(ctx context.Context, info types.BlobInfo, chunks []private.ImageSourceChunk) (blobAtResponse, error) {
 	headers := make(map[string][]string)
 
 	rangeVals := make([]string, 0, len(chunks))
@@ -348,44 +414,114 @@ func (s *dockerImageSource) GetBlobAt(ctx context.Context, info types.BlobInfo,
 
 	headers["Range"] = []string{fmt.Sprintf("bytes=%s", strings.Join(rangeVals, ","))}
 
-	if len(info.URLs) != 0 {
-		return nil, nil, fmt.Errorf("external URLs not supported with GetBlobAt")
-	}
-
 	path := fmt.Sprintf(blobsPath, reference.Path(s.physicalRef.ref), info.Digest.String())
-	logrus.Debugf("Downloading %s", path)
+	s.c.logger.Debugf("Downloading %s", path)
 	res, err := s.c.makeRequest(ctx, http.MethodGet, path, headers, nil, v2Auth, nil)
 	if err != nil {
-		return nil, nil, err
+		return blobAtResponse{}, err
 	}
 
 	switch res.StatusCode {
 	case http.StatusOK:
-		// if the server replied with a 200 status code, convert the full body response to a series of
-		// streams as it would have been done with 206.
-		streams := make(chan io.ReadCloser)
-		errs := make(chan error)
-		go splitHTTP200ResponseToPartial(streams, errs, res.Body, chunks)
-		return streams, errs, nil
+		return blobAtResponse{body: res.Body, full: true}, nil
 	case http.StatusPartialContent:
 		mediaType, params, err := parseMediaType(res.Header.Get("Content-Type"))
 		if err != nil {
-			return nil, nil, err
+			res.Body.Close()
+			return blobAtResponse{}, err
 		}
-
-		streams := make(chan io.ReadCloser)
-		errs := make(chan error)
-
-		go handle206Response(streams, errs, res.Body, chunks, mediaType, params)
-		return streams, errs, nil
+		return blobAtResponse{body: res.Body, mediaType: mediaType, params: params}, nil
 	case http.StatusBadRequest:
 		res.Body.Close()
-		return nil, nil, private.BadPartialRequestError{Status: res.Status}
+		return blobAtResponse{}, private.BadPartialRequestError{Status: res.Status}
 	default:
-		err := registryHTTPResponseToError(res)
+		err := registryHTTPResponseToError(s.c.logger, res)
 		res.Body.Close()
-		return nil, nil, fmt.Errorf("fetching partial blob: %w", err)
+		return blobAtResponse{}, fmt.Errorf("fetching partial blob: %w", err)
+	}
+}
+
+// handle sends the parts of r, which contain chunks, as separate ReadClosers to the streams chan,
+// and closes streams and errs when done.
+func (r blobAtResponse) handle(streams chan io.ReadCloser, errs chan error, chunks []private.ImageSourceChunk) {
+	if r.full {
+		// if the server replied with a 200 status code, convert the full body response to a series of
+		// streams as it would have been done with 206.
+		splitHTTP200ResponseToPartial(streams, errs, r.body, chunks)
+		return
+	}
+	handle206Response(streams, errs, r.body, chunks, r.mediaType, r.params)
+}
+
+// forwardBlobAtStreams forwards all values from batchStreams and batchErrs to streams and errs, until both are closed,
+// and returns false if any error was forwarded.
+func forwardBlobAtStreams(streams chan<- io.ReadCloser, errs chan<- error, batchStreams <-chan io.ReadCloser, batchErrs <-chan error) bool {
+	succeeded := true
+	for batchStreams != nil || batchErrs != nil {
+		select {
+		case s, ok := <-batchStreams:
+			if !ok {
+				batchStreams = nil
+				continue
+			}
+			streams <- s
+		case err, ok := <-batchErrs:
+			if !ok {
+				batchErrs = nil
+				continue
+			}
+			errs <- err
+			succeeded = false
+		}
+	}
+	return succeeded
+}
+
+// GetBlobAt returns a sequential channel of readers that contain data for the requested
+// blob chunks, and a channel that might get a single error value.
+// The specified chunks must be not overlapping and sorted by their offset.
+// The readers must be fully consumed, in the order they are returned, before blocking
+// to read the next chunk.
+func (s *dockerImageSource) GetBlobAt(ctx context.Context, info types.BlobInfo, chunks []private.ImageSourceChunk) (chan io.ReadCloser, chan error, error) {
+	if len(info.URLs) != 0 {
+		return nil, nil, fmt.Errorf("external URLs not supported with GetBlobAt")
+	}
+
+	batches := splitChunksByRangeHeader(chunks, maxRangeHeaderLength)
+	// The first request is made synchronously, so that its failures, notably BadPartialRequestError,
+	// are reported directly and the caller can fall back to reading the full blob.
+	res, err := s.getBlobRanges(ctx, info, batches[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	streams := make(chan io.ReadCloser)
+	errs := make(chan error)
+	if res.full || len(batches) == 1 {
+		// If the server ignored the Range header, the response contains all chunks; don't download the full blob again for every batch.
+		go res.handle(streams, errs, chunks)
+		return streams, errs, nil
 	}
+
+	go func() {
+		defer close(streams)
+		defer close(errs)
+		for i, batch := range batches {
+			if i > 0 {
+				res, err = s.getBlobRanges(ctx, info, batch)
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+			batchStreams := make(chan io.ReadCloser)
+			batchErrs := make(chan error)
+			go res.handle(batchStreams, batchErrs, batch)
+			if !forwardBlobAtStreams(streams, errs, batchStreams, batchErrs) {
+				return
+			}
+		}
+	}()
+	return streams, errs, nil
 }
 
 // GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
@@ -481,7 +617,7 @@ func (s *dockerImageSource) getSignaturesFromLookaside(ctx context.Context, inst
 func (s *dockerImageSource) getOneSignature(ctx context.Context, sigURL *url.URL) (signature.Signature, bool, error) {
 	switch sigURL.Scheme {
 	case "file":
-		logrus.Debugf("Reading %s", sigURL.Path)
+		s.c.logger.Debugf("Reading %s", sigURL.Path)
 		sigBlob, err := os.ReadFile(sigURL.Path)
 		if err != nil {
 			if os.IsNotExist(err) {
@@ -496,7 +632,7 @@ func (s *dockerImageSource) getOneSignature(ctx context.Context, sigURL *url.URL
 		return sig, false, nil
 
 	case "http", "https":
-		logrus.Debugf("GET %s", sigURL.Redacted())
+		s.c.logger.Debugf("GET %s", sigURL.Redacted())
 		req, err := http.NewRequestWithContext(ctx, http.MethodGet, sigURL.String(), nil)
 		if err != nil {
 			return nil, false, err
@@ -507,7 +643,7 @@ func (s *dockerImageSource) getOneSignature(ctx context.Context, sigURL *url.URL
 		}
 		defer res.Body.Close()
 		if res.StatusCode == http.StatusNotFound {
-			logrus.Debugf("... got status 404, as expected = end of signatures")
+			s.c.logger.Debugf("... got status 404, as expected = end of signatures")
 			return nil, true, nil
 		} else if res.StatusCode != http.StatusOK {
 			return nil, false, fmt.Errorf("reading signature from %s: status %d (%s)", sigURL.Redacted(), res.StatusCode, http.StatusText(res.StatusCode))
@@ -515,12 +651,12 @@ func (s *dockerImageSource) getOneSignature(ctx context.Context, sigURL *url.URL
 
 		contentType := res.Header.Get("Content-Type")
 		if mimeType := simplifyContentType(contentType); mimeType == "text/html" {
-			logrus.Warnf("Signature %q has Content-Type %q, unexpected for a signature", sigURL.Redacted(), contentType)
+			s.c.logger.Warnf("Signature %q has Content-Type %q, unexpected for a signature", sigURL.Redacted(), contentType)
 			// Don’t immediately fail; the lookaside spec does not place any requirements on Content-Type.
 			// If the content really is HTML, it’s going to fail in signature.FromBlob.
 		}
 
-		sigBlob, err := iolimits.ReadAtMost(res.Body, iolimits.MaxSignatureBodySize)
+		sigBlob, err := iolimits.ReadAtMost(res.Body, iolimits.SignatureSizeLimit(s.c.sys))
 		if err != nil {
 			return nil, false, err
 		}
@@ -556,9 +692,16 @@ func (s *dockerImageSource) getSignaturesFromAPIExtension(ctx context.Context, i
 	return sigs, nil
 }
 
+// DiscoversSigstoreAttachments returns true if sigstore signatures returned by GetSignaturesWithFormat are discovered
+// in sigstore attachments, without the use of sigstore attachments being configured.
+// This implements private.SigstoreAttachmentDiscoveryReporter.
+func (s *dockerImageSource) DiscoversSigstoreAttachments() bool {
+	return s.c.discoverSigstoreSignatures
+}
+
 func (s *dockerImageSource) getSignaturesFromSigstoreAttachments(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Signature, error) {
-	if !s.c.useSigstoreAttachments {
-		logrus.Debugf("Not looking for sigstore attachments: disabled by configuration")
+	if !s.c.useSigstoreAttachments && !s.c.discoverSigstoreSignatures {
+		s.c.logger.Debugf("Not looking for sigstore attachments: disabled by configuration")
 		return nil, nil
 	}
 
@@ -567,24 +710,69 @@ func (s *dockerImageSource) getSignaturesFromSigstoreAttachments(ctx context.Con
 		return nil, err
 	}
 
+	res := []signature.Signature{}
+	if s.c.useSigstoreReferrers {
+		referrerSigs, err := s.getSignaturesFromReferrers(ctx, manifestDigest)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, referrerSigs...)
+	}
+
 	ociManifest, err := s.c.getSigstoreAttachmentManifest(ctx, s.physicalRef, manifestDigest)
 	if err != nil {
 		return nil, err
 	}
 	if ociManifest == nil {
-		return nil, nil
+		return res, nil
 	}
 
-	logrus.Debugf("Found a sigstore attachment manifest with %d layers", len(ociManifest.Layers))
-	res := []signature.Signature{}
+	s.c.logger.Debugf("Found a sigstore attachment manifest with %d layers", len(ociManifest.Layers))
 	for layerIndex, layer := range ociManifest.Layers {
 		// Note that this copies all kinds of attachments: attestations, and whatever else is there,
 		// not just signatures. We leave the signature consumers to decide based on the MIME type.
-		logrus.Debugf("Fetching sigstore attachment %d/%d: %s", layerIndex+1, len(ociManifest.Layers), layer.Digest.String())
+		s.c.logger.Debugf("Fetching sigstore attachment %d/%d: %s", layerIndex+1, len(ociManifest.Layers), layer.Digest.String())
 		// We don’t benefit from a real BlobInfoCache here because we never try to reuse/mount attachment payloads.
 		// That might eventually need to change if payloads grow to be not just signatures, but something
 		// significantly large.
-		payload, err := s.c.getOCIDescriptorContents(ctx, s.physicalRef, layer, iolimits.MaxSignatureBodySize,
+		payload, err := s.c.getOCIDescriptorContents(ctx, s.physicalRef, layer, iolimits.SignatureSizeLimit(s.c.sys),
+			none.NoCache)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, signature.SigstoreFromComponents(layer.MediaType, payload, layer.Annotations))
+	}
+	return res, nil
+}
+
+// GetAttestations returns the image's attestations, using the sigstore attachment format. It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve attestations for
+// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+// (e.g. if the source never returns manifest lists).
+func (s *dockerImageSource) GetAttestations(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Sigstore, error) {
+	if !s.c.useSigstoreAttachments {
+		s.c.logger.Debugf("Not looking for sigstore attestations: disabled by configuration")
+		return nil, nil
+	}
+
+	manifestDigest, err := s.manifestDigest(ctx, instanceDigest)
+	if err != nil {
+		return nil, err
+	}
+
+	ociManifest, err := s.c.getSigstoreAttestationManifest(ctx, s.physicalRef, manifestDigest)
+	if err != nil {
+		return nil, err
+	}
+	if ociManifest == nil {
+		return nil, nil
+	}
+
+	s.c.logger.Debugf("Found a sigstore attestation manifest with %d layers", len(ociManifest.Layers))
+	res := []signature.Sigstore{}
+	for layerIndex, layer := range ociManifest.Layers {
+		s.c.logger.Debugf("Fetching sigstore attestation %d/%d: %s", layerIndex+1, len(ociManifest.Layers), layer.Digest.String())
+		payload, err := s.c.getOCIDescriptorContents(ctx, s.physicalRef, layer, iolimits.SignatureSizeLimit(s.c.sys),
 			none.NoCache)
 		if err != nil {
 			return nil, err
@@ -633,11 +821,11 @@ func deleteImage(ctx context.Context, sys *types.SystemContext, ref dockerRefere
 	switch get.StatusCode {
 	case http.StatusOK:
 	case http.StatusNotFound:
-		return fmt.Errorf("Unable to delete %v. Image may not exist or is not stored with a v2 Schema in a v2 registry", ref.ref)
+		return errclass.Wrap(fmt.Errorf("Unable to delete %v. Image may not exist or is not stored with a v2 Schema in a v2 registry", ref.ref), types.ErrNotFound)
 	default:
-		return fmt.Errorf("deleting %v: %w", ref.ref, registryHTTPResponseToError(get))
+		return fmt.Errorf("deleting %v: %w", ref.ref, registryHTTPResponseToError(c.logger, get))
 	}
-	manifestBody, err := iolimits.ReadAtMost(get.Body, iolimits.MaxManifestBodySize)
+	manifestBody, err := iolimits.ReadAtMost(get.Body, iolimits.ManifestSizeLimit(c.sys))
 	if err != nil {
 		return err
 	}
@@ -656,12 +844,12 @@ func deleteImage(ctx context.Context, sys *types.SystemContext, ref dockerRefere
 	}
 	defer delete.Body.Close()
 	if delete.StatusCode != http.StatusAccepted {
-		return fmt.Errorf("deleting %v: %w", ref.ref, registryHTTPResponseToError(delete))
+		return fmt.Errorf("deleting %v: %w", ref.ref, registryHTTPResponseToError(c.logger, delete))
 	}
 
 	for i := 0; ; i++ {
 		sigURL := lookasideStorageURL(c.signatureBase, manifestDigest, i)
-		missing, err := c.deleteOneSignature(sigURL)
+		missing, err := c.deleteOneSignature(ctx, sigURL)
 		if err != nil {
 			return err
 		}
@@ -3,6 +3,7 @@ package docker
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -13,7 +14,11 @@ import (
 	"testing"
 
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -84,6 +89,60 @@ location = "@REGISTRY@/with-mirror"
 	}
 }
 
+func TestNewImageSourceFromDescriptor(t *testing.T) {
+	manifestBlob := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","artifactType":"application/example"}`)
+	desc := imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Digest:    digest.FromBytes(manifestBlob),
+		Size:      int64(len(manifestBlob)),
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/":
+			rw.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodGet && r.URL.Path == "/v2/ns/repo/manifests/"+desc.Digest.String():
+			rw.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = rw.Write(manifestBlob)
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v2/ns/repo/manifests/"):
+			rw.WriteHeader(http.StatusNotFound)
+		default:
+			require.FailNowf(t, "Unexpected request", "%v %v", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "http://")
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}
+	// The tag of the reference is never resolved.
+	ref, err := ParseReference("//" + registry + "/ns/repo:tag")
+	require.NoError(t, err)
+
+	src, err := NewImageSourceFromDescriptor(context.Background(), sys, ref, desc)
+	require.NoError(t, err)
+	defer src.Close()
+	assert.Equal(t, "//"+registry+"/ns/repo@"+desc.Digest.String(), src.Reference().StringWithinTransport())
+	m, mimeType, err := src.GetManifest(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, manifestBlob, m)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, mimeType)
+
+	// Descriptor not matching the manifest
+	badSize := desc
+	badSize.Size++
+	_, err = NewImageSourceFromDescriptor(context.Background(), sys, ref, badSize)
+	assert.Error(t, err)
+
+	// Missing manifest
+	missing := desc
+	missing.Digest = digest.FromString("missing")
+	_, err = NewImageSourceFromDescriptor(context.Background(), sys, ref, missing)
+	assert.ErrorIs(t, err, types.ErrNotFound)
+}
+
 func TestSimplifyContentType(t *testing.T) {
 	for _, c := range []struct{ input, expected string }{
 		{"", ""},
@@ -185,6 +244,72 @@ func TestHandle206Response(t *testing.T) {
 	verifyGetBlobAtOutput(t, streams, errs, expected)
 }
 
+func TestSplitChunksByRangeHeader(t *testing.T) {
+	chunks := []private.ImageSourceChunk{
+		{Offset: 0, Length: 10},   // "0-9"
+		{Offset: 20, Length: 10},  // "20-29"
+		{Offset: 100, Length: 10}, // "100-109"
+	}
+	for _, c := range []struct {
+		maxLength int
+		expected  [][]private.ImageSourceChunk
+	}{
+		{100, [][]private.ImageSourceChunk{chunks}},
+		{len("bytes=0-9,20-29,100-109"), [][]private.ImageSourceChunk{chunks}},
+		{len("bytes=0-9,20-29,100-109") - 1, [][]private.ImageSourceChunk{chunks[:2], chunks[2:]}},
+		{len("bytes=0-9,20-29"), [][]private.ImageSourceChunk{chunks[:2], chunks[2:]}},
+		{len("bytes=0-9,20-29") - 1, [][]private.ImageSourceChunk{chunks[:1], chunks[1:2], chunks[2:]}},
+		// Every batch contains at least one chunk, even if it is too long.
+		{1, [][]private.ImageSourceChunk{chunks[:1], chunks[1:2], chunks[2:]}},
+	} {
+		res := splitChunksByRangeHeader(chunks, c.maxLength)
+		assert.Equal(t, c.expected, res, c.maxLength)
+	}
+	assert.Equal(t, [][]private.ImageSourceChunk{{}}, splitChunksByRangeHeader([]private.ImageSourceChunk{}, 100))
+}
+
+func TestForwardBlobAtStreams(t *testing.T) {
+	streams := make(chan io.ReadCloser)
+	errs := make(chan error)
+	go func() {
+		defer close(streams)
+		defer close(errs)
+		for _, data := range []string{"123456789", "abcdef"} {
+			batchStreams := make(chan io.ReadCloser)
+			batchErrs := make(chan error)
+			go splitHTTP200ResponseToPartial(batchStreams, batchErrs, io.NopCloser(bytes.NewReader([]byte(data))),
+				[]private.ImageSourceChunk{{Offset: 1, Length: 2}, {Offset: 4, Length: 1}})
+			ok := forwardBlobAtStreams(streams, errs, batchStreams, batchErrs)
+			assert.True(t, ok)
+		}
+	}()
+	verifyGetBlobAtOutput(t, streams, errs, []verifyGetBlobAtData{
+		{[]byte("23"), nil},
+		{[]byte("5"), nil},
+		{[]byte("bc"), nil},
+		{[]byte("e"), nil},
+		{[]byte(nil), nil},
+	})
+
+	// Errors are forwarded and reported.
+	streams = make(chan io.ReadCloser)
+	errs = make(chan error)
+	batchStreams := make(chan io.ReadCloser)
+	batchErrs := make(chan error)
+	go splitHTTP200ResponseToPartial(batchStreams, batchErrs, io.NopCloser(bytes.NewReader([]byte("123456789"))),
+		[]private.ImageSourceChunk{{Offset: 4, Length: 1}, {Offset: 1, Length: 2}})
+	result := make(chan bool, 1)
+	go func() {
+		result <- forwardBlobAtStreams(streams, errs, batchStreams, batchErrs)
+	}()
+	data, err := readNextStream(streams, errs)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("5"), data)
+	_, err = readNextStream(streams, errs)
+	assert.Error(t, err)
+	assert.False(t, <-result)
+}
+
 func TestParseMediaType(t *testing.T) {
 	mediaType, params, err := parseMediaType("multipart/byteranges; boundary=CloudFront:3F750DE0752BEDE3882F7DBE80010D31")
 	require.NoError(t, err)
@@ -211,3 +336,123 @@ func TestParseMediaType(t *testing.T) {
 	_, _, err = parseMediaType("multipart/byteranges; boundary=@")
 	require.Error(t, err)
 }
+
+func TestSigstoreAttachmentDiscovery(t *testing.T) {
+	ctx := context.Background()
+	imageManifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":2},"layers":[]}`)
+	imageDigest := digest.FromBytes(imageManifest)
+	payload := []byte(`{"critical":{}}`)
+	annotations := map[string]string{signature.SigstoreSignatureAnnotationKey: "c2lnbmF0dXJl"}
+	sigConfig := []byte("{}")
+	sigManifest, err := json.Marshal(imgspecv1.Manifest{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Config:    imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageConfig, Digest: digest.FromBytes(sigConfig), Size: int64(len(sigConfig))},
+		Layers: []imgspecv1.Descriptor{{
+			MediaType:   signature.SigstoreSignatureMIMEType,
+			Digest:      digest.FromBytes(payload),
+			Size:        int64(len(payload)),
+			Annotations: annotations,
+		}},
+	})
+	require.NoError(t, err)
+	sigTag := sigstoreAttachmentTag(imageDigest)
+
+	newRegistry := func() (*blobTestRegistry, string) {
+		reg := &blobTestRegistry{
+			blobs:     map[digest.Digest][]byte{},
+			manifests: map[string]blobTestManifest{},
+		}
+		server := httptest.NewServer(reg)
+		t.Cleanup(server.Close)
+		return reg, strings.TrimPrefix(server.URL, "http://")
+	}
+	newSys := func(useSigstoreAttachments, discoverSigstoreSignatures types.OptionalBool) *types.SystemContext {
+		return &types.SystemContext{
+			RegistriesDirPath:                "/this/does/not/exist",
+			DockerPerHostCertDirPath:         "/this/does/not/exist",
+			DockerInsecureSkipTLSVerify:      types.OptionalBoolTrue,
+			DockerUseSigstoreAttachments:     useSigstoreAttachments,
+			DockerDiscoverSigstoreSignatures: discoverSigstoreSignatures,
+		}
+	}
+	sigstoreSignatures := func(registry string, sys *types.SystemContext) ([]signature.Signature, error) {
+		ref, err := ParseReference("//" + registry + "/ns/repo@" + imageDigest.String())
+		require.NoError(t, err)
+		src, err := newImageSource(ctx, sys, ref.(dockerReference))
+		require.NoError(t, err)
+		defer src.Close()
+		return src.getSignaturesFromSigstoreAttachments(ctx, nil)
+	}
+
+	source, sourceRegistry := newRegistry()
+	source.manifests[imageDigest.String()] = blobTestManifest{mimeType: imgspecv1.MediaTypeImageManifest, data: imageManifest}
+	source.manifests[sigTag] = blobTestManifest{mimeType: imgspecv1.MediaTypeImageManifest, data: sigManifest}
+	source.blobs[digest.FromBytes(sigConfig)] = sigConfig
+	source.blobs[digest.FromBytes(payload)] = payload
+
+	// Signatures are only read if enabled, or if discovery is enabled and the use of attachments is not configured
+	for _, c := range []struct {
+		use, discover types.OptionalBool
+		found         bool
+	}{
+		{types.OptionalBoolUndefined, types.OptionalBoolUndefined, false},
+		{types.OptionalBoolUndefined, types.OptionalBoolFalse, false},
+		{types.OptionalBoolUndefined, types.OptionalBoolTrue, true},
+		{types.OptionalBoolTrue, types.OptionalBoolUndefined, true},
+		{types.OptionalBoolFalse, types.OptionalBoolTrue, false},
+	} {
+		sigs, err := sigstoreSignatures(sourceRegistry, newSys(c.use, c.discover))
+		require.NoError(t, err)
+		if !c.found {
+			assert.Empty(t, sigs)
+			continue
+		}
+		require.Len(t, sigs, 1)
+		sig, ok := sigs[0].(signature.Sigstore)
+		require.True(t, ok)
+		assert.Equal(t, payload, sig.UntrustedPayload())
+		assert.Equal(t, annotations, sig.UntrustedAnnotations())
+	}
+
+	sigs, err := sigstoreSignatures(sourceRegistry, newSys(types.OptionalBoolUndefined, types.OptionalBoolTrue))
+	require.NoError(t, err)
+
+	// Discovered signatures are only written to a destination if enabled
+	for _, c := range []struct {
+		use, discover types.OptionalBool
+		success       bool
+	}{
+		{types.OptionalBoolUndefined, types.OptionalBoolUndefined, false},
+		{types.OptionalBoolUndefined, types.OptionalBoolTrue, false},
+		{types.OptionalBoolTrue, types.OptionalBoolUndefined, true},
+		{types.OptionalBoolFalse, types.OptionalBoolUndefined, false},
+	} {
+		dest, destRegistry := newRegistry()
+		ref, err := ParseReference("//" + destRegistry + "/ns/repo:tag")
+		require.NoError(t, err)
+		imageDest, err := newImageDestination(newSys(c.use, c.discover), ref.(dockerReference))
+		require.NoError(t, err)
+		err = imageDest.PutManifest(ctx, imageManifest, nil)
+		require.NoError(t, err)
+		err = imageDest.PutSignaturesWithFormat(ctx, sigs, nil)
+		imageDest.Close()
+		if !c.success {
+			assert.Error(t, err)
+			assert.NotContains(t, dest.manifests, sigTag)
+			continue
+		}
+		require.NoError(t, err)
+		assert.Contains(t, dest.manifests, sigTag)
+		replicated, err := sigstoreSignatures(destRegistry, newSys(types.OptionalBoolTrue, types.OptionalBoolUndefined))
+		require.NoError(t, err)
+		assert.Equal(t, sigs, replicated)
+	}
+
+	// Failures to discover signatures are reported
+	source.failTag = sigTag
+	_, err = sigstoreSignatures(sourceRegistry, newSys(types.OptionalBoolUndefined, types.OptionalBoolTrue))
+	assert.Error(t, err)
+	_, err = sigstoreSignatures(sourceRegistry, newSys(types.OptionalBoolTrue, types.OptionalBoolUndefined))
+	assert.Error(t, err)
+}
@@ -0,0 +1,249 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	digest "github.com/opencontainers/go-digest"
+	imgspec "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/exp/slices"
+)
+
+// If enabled by the use-sigstore-referrers option, sigstore signatures are stored as OCI referrers
+// (manifests with a subject, as defined by the OCI distribution-spec 1.1) instead of in "sha256-<digest>.sig" tags.
+// Each signature is stored in a separate referrer manifest, the way cosign does with the referrers format.
+// On registries which don't support the referrers API, the referrers are listed in an index
+// using the “referrers tag schema” (see manifest.ReferrersFallbackTag).
+
+const (
+	referrersPath = "/v2/%s/referrers/%s"
+	// ociSubjectHeader is set by registries which support the referrers API in responses to uploads of manifests with a subject.
+	ociSubjectHeader = "OCI-Subject"
+)
+
+// getReferrers returns an index listing the referrers of the manifest with subjectDigest in ref.
+// If the registry doesn't support the referrers API, it returns the index using the referrers tag schema
+// (or an empty index if it does not exist), and usesFallbackTag = true.
+func (c *dockerClient) getReferrers(ctx context.Context, ref dockerReference, subjectDigest digest.Digest) (index *imgspecv1.Index, usesFallbackTag bool, err error) {
+	if err := subjectDigest.Validate(); err != nil { // Make sure subjectDigest.String() can't contain any unexpected characters
+		return nil, false, err
+	}
+	path := fmt.Sprintf(referrersPath, reference.Path(ref.ref), subjectDigest.String())
+	headers := map[string][]string{
+		"Accept": {imgspecv1.MediaTypeImageIndex},
+	}
+	res, err := c.makeRequest(ctx, http.MethodGet, path, headers, nil, v2Auth, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		// FIXME: This ignores pagination (a Link header); that should not matter for the small number of signatures we expect.
+		body, err := iolimits.ReadAtMost(res.Body, iolimits.ManifestSizeLimit(c.sys))
+		if err != nil {
+			return nil, false, err
+		}
+		index := imgspecv1.Index{}
+		if err := json.Unmarshal(body, &index); err != nil {
+			return nil, false, fmt.Errorf("parsing referrers of %s in %s: %w", subjectDigest.String(), ref.ref.Name(), err)
+		}
+		return &index, false, nil
+	case http.StatusNotFound:
+		c.logger.Debugf("Registry does not support the referrers API, using the referrers tag schema")
+		index, err := c.getReferrersFallbackIndex(ctx, ref, subjectDigest)
+		if err != nil {
+			return nil, false, err
+		}
+		return index, true, nil
+	default:
+		return nil, false, fmt.Errorf("reading referrers of %s in %s: %w", subjectDigest.String(), ref.ref.Name(), registryHTTPResponseToError(c.logger, res))
+	}
+}
+
+// getReferrersFallbackIndex returns the index listing the referrers of the manifest with subjectDigest in ref,
+// using the referrers tag schema, or an empty index if it does not exist.
+func (c *dockerClient) getReferrersFallbackIndex(ctx context.Context, ref dockerReference, subjectDigest digest.Digest) (*imgspecv1.Index, error) {
+	tag, err := manifest.ReferrersFallbackTag(subjectDigest)
+	if err != nil {
+		return nil, err
+	}
+	manifestBlob, mimeType, err := c.fetchManifest(ctx, ref, tag)
+	if err != nil {
+		if isManifestUnknownError(err) {
+			c.logger.Debugf("Fetching referrers index %s failed, assuming it does not exist: %v", tag, err)
+			return &imgspecv1.Index{
+				Versioned: imgspec.Versioned{SchemaVersion: 2},
+				MediaType: imgspecv1.MediaTypeImageIndex,
+				Manifests: []imgspecv1.Descriptor{},
+			}, nil
+		}
+		return nil, err
+	}
+	if mimeType != imgspecv1.MediaTypeImageIndex {
+		return nil, fmt.Errorf("unexpected MIME type for referrers index %s in %s: %q", tag, ref.ref.Name(), mimeType)
+	}
+	index := imgspecv1.Index{}
+	if err := json.Unmarshal(manifestBlob, &index); err != nil {
+		return nil, fmt.Errorf("parsing referrers index %s in %s: %w", tag, ref.ref.Name(), err)
+	}
+	return &index, nil
+}
+
+// getSignaturesFromReferrers returns the sigstore signatures stored as referrers of the manifest with manifestDigest.
+func (s *dockerImageSource) getSignaturesFromReferrers(ctx context.Context, manifestDigest digest.Digest) ([]signature.Signature, error) {
+	index, _, err := s.c.getReferrers(ctx, s.physicalRef, manifestDigest)
+	if err != nil {
+		return nil, err
+	}
+	res := []signature.Signature{}
+	for _, md := range index.Manifests {
+		if md.MediaType != imgspecv1.MediaTypeImageManifest || md.ArtifactType != signature.SigstoreSignatureArtifactType {
+			continue
+		}
+		s.c.logger.Debugf("Fetching sigstore signature referrer %s", md.Digest.String())
+		manifestBlob, _, err := s.c.fetchManifest(ctx, s.physicalRef, md.Digest.String())
+		if err != nil {
+			return nil, err
+		}
+		if matches, err := manifest.MatchesDigest(manifestBlob, md.Digest); err != nil || !matches {
+			return nil, fmt.Errorf("referrer manifest %s in %s does not match its digest", md.Digest.String(), s.physicalRef.ref.Name())
+		}
+		referrer, err := manifest.OCI1FromManifest(manifestBlob)
+		if err != nil {
+			return nil, fmt.Errorf("parsing referrer manifest %s in %s: %w", md.Digest.String(), s.physicalRef.ref.Name(), err)
+		}
+		if referrer.Subject == nil || referrer.Subject.Digest != manifestDigest {
+			continue
+		}
+		for _, layer := range referrer.Layers {
+			// We don’t benefit from a real BlobInfoCache here because we never try to reuse/mount signature payloads.
+			payload, err := s.c.getOCIDescriptorContents(ctx, s.physicalRef, layer, iolimits.SignatureSizeLimit(s.c.sys),
+				none.NoCache)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, signature.SigstoreFromComponents(layer.MediaType, payload, layer.Annotations))
+		}
+	}
+	return res, nil
+}
+
+// putSignaturesAsReferrers stores signatures as referrers of the manifest with manifestDigest,
+// which must already exist on the registry.
+func (d *dockerImageDestination) putSignaturesAsReferrers(ctx context.Context, signatures []signature.Sigstore, manifestDigest digest.Digest) error {
+	subjectBlob, subjectMIMEType, err := d.c.fetchManifest(ctx, d.ref, manifestDigest.String())
+	if err != nil {
+		return err
+	}
+	subject, err := manifest.SubjectDescriptor(subjectBlob, subjectMIMEType)
+	if err != nil {
+		return err
+	}
+	if subject.Digest != manifestDigest {
+		return fmt.Errorf("manifest %s in %s does not match its digest", manifestDigest.String(), d.ref.ref.Name())
+	}
+
+	index, usesFallbackTag, err := d.c.getReferrers(ctx, d.ref, manifestDigest)
+	if err != nil {
+		return err
+	}
+	configUploaded := false
+	configDesc := imgspecv1.DescriptorEmptyJSON
+	unindexed := []imgspecv1.Descriptor{} // Referrers the registry did not add to the referrers API
+	for _, sig := range signatures {
+		payloadBlob := sig.UntrustedPayload()
+		payloadDesc := imgspecv1.Descriptor{
+			MediaType:   sig.UntrustedMIMEType(),
+			Digest:      digest.FromBytes(payloadBlob),
+			Size:        int64(len(payloadBlob)),
+			Annotations: sig.UntrustedAnnotations(),
+		}
+		referrerBlob, err := json.Marshal(imgspecv1.Manifest{
+			Versioned:    imgspec.Versioned{SchemaVersion: 2},
+			MediaType:    imgspecv1.MediaTypeImageManifest,
+			ArtifactType: signature.SigstoreSignatureArtifactType,
+			Config:       configDesc,
+			Layers:       []imgspecv1.Descriptor{payloadDesc},
+			Subject:      &subject,
+		})
+		if err != nil {
+			return err
+		}
+		referrerDesc := imgspecv1.Descriptor{
+			MediaType:    imgspecv1.MediaTypeImageManifest,
+			ArtifactType: signature.SigstoreSignatureArtifactType,
+			Digest:       digest.FromBytes(referrerBlob),
+			Size:         int64(len(referrerBlob)),
+		}
+		if slices.ContainsFunc(index.Manifests, func(md imgspecv1.Descriptor) bool { return md.Digest == referrerDesc.Digest }) {
+			d.c.logger.Debugf("Signature referrer %s already exists on the registry", referrerDesc.Digest.String())
+			continue
+		}
+
+		if !configUploaded {
+			// We don’t benefit from a real BlobInfoCache here because we never try to reuse/mount configs.
+			if _, err := d.putBlobBytesAsOCI(ctx, imgspecv1.DescriptorEmptyJSON.Data, configDesc.MediaType, private.PutBlobOptions{
+				Cache:    none.NoCache,
+				IsConfig: true,
+			}); err != nil {
+				return err
+			}
+			configUploaded = true
+		}
+		// We don’t benefit from a real BlobInfoCache here because we never try to reuse/mount signature payloads.
+		if _, err := d.putBlobBytesAsOCI(ctx, payloadBlob, payloadDesc.MediaType, private.PutBlobOptions{
+			Cache: none.NoCache,
+		}); err != nil {
+			return err
+		}
+		d.c.logger.Debugf("Uploading signature referrer %s", referrerDesc.Digest.String())
+		headers, err := d.uploadManifest(ctx, referrerBlob, referrerDesc.Digest.String())
+		if err != nil {
+			return err
+		}
+		if usesFallbackTag || headers.Get(ociSubjectHeader) != manifestDigest.String() {
+			unindexed = append(unindexed, referrerDesc)
+		}
+	}
+	if len(unindexed) == 0 {
+		return nil
+	}
+
+	if !usesFallbackTag {
+		// The registry supports the referrers API, but did not process the subject of our manifests;
+		// the OCI distribution-spec requires us to use the referrers tag schema.
+		d.c.logger.Debugf("Registry did not confirm processing the subject of signature referrers, using the referrers tag schema")
+		index, err = d.c.getReferrersFallbackIndex(ctx, d.ref, manifestDigest)
+		if err != nil {
+			return err
+		}
+	}
+	// To make sure we can safely append to index.Manifests, without adding a remote dependency on the code that creates it.
+	index.Manifests = slices.Clone(index.Manifests)
+	for _, desc := range unindexed {
+		if !slices.ContainsFunc(index.Manifests, func(md imgspecv1.Descriptor) bool { return md.Digest == desc.Digest }) {
+			index.Manifests = append(index.Manifests, desc)
+		}
+	}
+	indexBlob, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	tag, err := manifest.ReferrersFallbackTag(manifestDigest)
+	if err != nil {
+		return err
+	}
+	d.c.logger.Debugf("Uploading referrers index %s", tag)
+	_, err = d.uploadManifest(ctx, indexBlob, tag)
+	return err
+}
@@ -0,0 +1,85 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSigstoreReferrers(t *testing.T) {
+	ctx := context.Background()
+	imageManifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":2},"layers":[]}`)
+	imageDigest := digest.FromBytes(imageManifest)
+	fallbackTag, err := manifest.ReferrersFallbackTag(imageDigest)
+	require.NoError(t, err)
+	sigs := []signature.Signature{
+		signature.SigstoreFromComponents(signature.SigstoreSignatureMIMEType, []byte(`{"critical":{"1":1}}`),
+			map[string]string{signature.SigstoreSignatureAnnotationKey: "c2lnbmF0dXJlMQ=="}),
+		signature.SigstoreFromComponents(signature.SigstoreSignatureMIMEType, []byte(`{"critical":{"2":2}}`),
+			map[string]string{signature.SigstoreSignatureAnnotationKey: "c2lnbmF0dXJlMg=="}),
+	}
+	sys := &types.SystemContext{
+		RegistriesDirPath:            "/this/does/not/exist",
+		DockerPerHostCertDirPath:     "/this/does/not/exist",
+		DockerInsecureSkipTLSVerify:  types.OptionalBoolTrue,
+		DockerUseSigstoreAttachments: types.OptionalBoolTrue,
+		DockerUseSigstoreReferrers:   types.OptionalBoolTrue,
+	}
+
+	for _, referrersAPI := range []bool{false, true} {
+		reg := &blobTestRegistry{
+			blobs:     map[digest.Digest][]byte{},
+			manifests: map[string]blobTestManifest{},
+			referrers: referrersAPI,
+		}
+		server := httptest.NewServer(reg)
+		defer server.Close()
+		registry := strings.TrimPrefix(server.URL, "http://")
+
+		ref, err := ParseReference("//" + registry + "/ns/repo:tag")
+		require.NoError(t, err)
+		dest, err := newImageDestination(sys, ref.(dockerReference))
+		require.NoError(t, err)
+		err = dest.PutManifest(ctx, imageManifest, nil)
+		require.NoError(t, err)
+		// Writing the same signatures again does not create duplicates
+		for i := 0; i < 2; i++ {
+			err = dest.PutSignaturesWithFormat(ctx, sigs, nil)
+			require.NoError(t, err)
+		}
+		dest.Close()
+
+		assert.NotContains(t, reg.manifests, sigstoreAttachmentTag(imageDigest))
+		if referrersAPI {
+			assert.NotContains(t, reg.manifests, fallbackTag)
+		} else {
+			require.Contains(t, reg.manifests, fallbackTag)
+			var index imgspecv1.Index
+			err = json.Unmarshal(reg.manifests[fallbackTag].data, &index)
+			require.NoError(t, err)
+			require.Len(t, index.Manifests, len(sigs))
+			for _, md := range index.Manifests {
+				assert.Equal(t, signature.SigstoreSignatureArtifactType, md.ArtifactType)
+			}
+		}
+
+		ref, err = ParseReference("//" + registry + "/ns/repo@" + imageDigest.String())
+		require.NoError(t, err)
+		src, err := newImageSource(ctx, sys, ref.(dockerReference))
+		require.NoError(t, err)
+		read, err := src.getSignaturesFromSigstoreAttachments(ctx, nil)
+		src.Close()
+		require.NoError(t, err)
+		assert.ElementsMatch(t, sigs, read)
+	}
+}
@@ -4,12 +4,16 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/containers/image/v5/docker/policyconfiguration"
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/pkg/logging"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 // UnknownDigestSuffix can be appended to a reference when the caller
@@ -198,6 +202,62 @@ func (ref dockerReference) DeleteImage(ctx context.Context, sys *types.SystemCon
 	return deleteImage(ctx, sys, ref)
 }
 
+// SupportsDeleteImage returns true, DeleteImage is implemented.
+// This implements transports.DeletionSupportReporter.
+func (ref dockerReference) SupportsDeleteImage() bool {
+	return true
+}
+
+// ListTags returns the tags of the repository in the registry.
+// This implements transports.TagLister.
+func (ref dockerReference) ListTags(ctx context.Context, sys *types.SystemContext) ([]string, error) {
+	return GetRepositoryTags(ctx, sys, ref)
+}
+
+// ImageExists returns true if the manifest the reference refers to exists in the registry, using a HEAD request.
+// This implements transports.ExistenceChecker.
+func (ref dockerReference) ImageExists(ctx context.Context, sys *types.SystemContext) (bool, *imgspecv1.Descriptor, error) {
+	if ref.isUnknownDigest {
+		return false, nil, fmt.Errorf("docker: reference %q is for unknown digest case; cannot check for existence", ref.StringWithinTransport())
+	}
+	tagOrDigest, err := ref.tagOrDigest()
+	if err != nil {
+		return false, nil, err
+	}
+	res, err := headManifest(ctx, sys, ref, tagOrDigest)
+	if err != nil {
+		return false, nil, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return false, nil, nil
+	default:
+		return false, nil, fmt.Errorf("checking for manifest %s in %s: %w", tagOrDigest, ref.ref.Name(), registryHTTPResponseToError(logging.For(sys), res))
+	}
+
+	var dig digest.Digest
+	if h := res.Header.Get("Docker-Content-Digest"); h != "" {
+		dig, err = digest.Parse(h)
+		if err != nil {
+			return false, nil, err
+		}
+	} else if canonical, ok := ref.ref.(reference.Canonical); ok {
+		dig = canonical.Digest()
+	} else {
+		return true, nil, nil
+	}
+	desc := imgspecv1.Descriptor{
+		MediaType: simplifyContentType(res.Header.Get("Content-Type")),
+		Digest:    dig,
+	}
+	if res.ContentLength > 0 {
+		desc.Size = res.ContentLength
+	}
+	return true, &desc, nil
+}
+
 // tagOrDigest returns a tag or digest from the reference.
 func (ref dockerReference) tagOrDigest() (string, error) {
 	if ref, ok := ref.ref.(reference.Canonical); ok {
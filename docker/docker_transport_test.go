@@ -2,11 +2,16 @@ package docker
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -243,6 +248,84 @@ func TestReferenceNewImageSource(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestReferenceListTags(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case r.URL.Path == "/v2/ns/repo/tags/list" && r.URL.RawQuery == "":
+			w.Header().Set("Link", `</v2/ns/repo/tags/list?last=b>; rel="next"`)
+			fmt.Fprint(w, `{"name":"ns/repo","tags":["a","b"]}`)
+		case r.URL.Path == "/v2/ns/repo/tags/list" && r.URL.RawQuery == "last=b":
+			fmt.Fprint(w, `{"name":"ns/repo","tags":["c"]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+	registry := strings.TrimPrefix(s.URL, "http://")
+
+	ref, err := ParseReference("//" + registry + "/ns/repo:a")
+	require.NoError(t, err)
+	require.True(t, transports.SupportsTagListing(ref))
+	tags, err := transports.ListTags(context.Background(), &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}, ref)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, tags)
+}
+
+func TestReferenceImageExists(t *testing.T) {
+	const manifestDigest = "sha256:" + sha256digestHex
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodHead && r.URL.Path == "/v2/ns/repo/manifests/present":
+			w.Header().Set("Content-Type", imgspecv1.MediaTypeImageManifest)
+			w.Header().Set("Content-Length", "1234")
+			w.Header().Set("Docker-Content-Digest", manifestDigest)
+			w.WriteHeader(http.StatusOK)
+		case r.Method == http.MethodHead && r.URL.Path == "/v2/ns/repo/manifests/forbidden":
+			w.WriteHeader(http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+	registry := strings.TrimPrefix(s.URL, "http://")
+	sys := &types.SystemContext{
+		RegistriesDirPath:           "/this/does/not/exist",
+		DockerPerHostCertDirPath:    "/this/does/not/exist",
+		DockerInsecureSkipTLSVerify: types.OptionalBoolTrue,
+	}
+
+	ref, err := ParseReference("//" + registry + "/ns/repo:present")
+	require.NoError(t, err)
+	exists, desc, err := ref.(transports.ExistenceChecker).ImageExists(context.Background(), sys)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, &imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Digest:    manifestDigest,
+		Size:      1234,
+	}, desc)
+
+	ref, err = ParseReference("//" + registry + "/ns/repo:missing")
+	require.NoError(t, err)
+	exists, desc, err = ref.(transports.ExistenceChecker).ImageExists(context.Background(), sys)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	assert.Nil(t, desc)
+
+	ref, err = ParseReference("//" + registry + "/ns/repo:forbidden")
+	require.NoError(t, err)
+	_, _, err = ref.(transports.ExistenceChecker).ImageExists(context.Background(), sys)
+	assert.ErrorIs(t, err, types.ErrUnauthorized)
+}
+
 func TestReferenceNewImageDestination(t *testing.T) {
 	ref, err := ParseReference("//quay.io/libpod/busybox")
 	require.NoError(t, err)
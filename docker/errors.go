@@ -5,19 +5,23 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/containers/image/v5/internal/errclass"
+	"github.com/containers/image/v5/types"
 	"github.com/docker/distribution/registry/api/errcode"
-	"github.com/sirupsen/logrus"
+	v2 "github.com/docker/distribution/registry/api/v2"
 )
 
 var (
 	// ErrV1NotSupported is returned when we're trying to talk to a
 	// docker V1 registry.
 	ErrV1NotSupported = errors.New("can't talk to a V1 container registry")
-	// ErrTooManyRequests is returned when the status code returned is 429
-	ErrTooManyRequests = errors.New("too many requests to registry")
+	// ErrTooManyRequests is returned when the status code returned is 429.
+	// It is classified as types.ErrTooManyRequests.
+	ErrTooManyRequests = errclass.Wrap(errors.New("too many requests to registry"), types.ErrTooManyRequests)
 )
 
-// ErrUnauthorizedForCredentials is returned when the status code returned is 401
+// ErrUnauthorizedForCredentials is returned when the status code returned is 401.
+// It is classified as types.ErrUnauthorized.
 type ErrUnauthorizedForCredentials struct { // We only use a struct to allow a type assertion, without limiting the contents of the error otherwise.
 	Err error
 }
@@ -26,34 +30,41 @@ func (e ErrUnauthorizedForCredentials) Error() string {
 	return fmt.Sprintf("unable to retrieve auth token: invalid username/password: %s", e.Err.Error())
 }
 
+// Is allows errors.Is(e, types.ErrUnauthorized) to succeed.
+func (e ErrUnauthorizedForCredentials) Is(target error) bool {
+	return target == types.ErrUnauthorized
+}
+
 // httpResponseToError translates the https.Response into an error, possibly prefixing it with the supplied context. It returns
 // nil if the response is not considered an error.
 // NOTE: Almost all callers in this package should use registryHTTPResponseToError instead.
-func httpResponseToError(res *http.Response, context string) error {
+func httpResponseToError(logger types.Logger, res *http.Response, context string) error {
 	switch res.StatusCode {
 	case http.StatusOK:
 		return nil
 	case http.StatusTooManyRequests:
 		return ErrTooManyRequests
 	case http.StatusUnauthorized:
-		err := registryHTTPResponseToError(res)
+		err := registryHTTPResponseToError(logger, res)
 		return ErrUnauthorizedForCredentials{Err: err}
 	default:
 		if context != "" {
 			context += ": "
 		}
-		return fmt.Errorf("%sinvalid status code from registry %d (%s)", context, res.StatusCode, http.StatusText(res.StatusCode))
+		err := fmt.Errorf("%sinvalid status code from registry %d (%s)", context, res.StatusCode, http.StatusText(res.StatusCode))
+		return errclass.Wrap(err, registryErrorKinds(res.StatusCode, nil)...)
 	}
 }
 
 // registryHTTPResponseToError creates a Go error from an HTTP error response of a docker/distribution
-// registry.
+// registry, logging any discarded secondary errors to logger.
+// The error is classified (via errors.Is) as types.ErrNotFound, types.ErrUnauthorized etc., where applicable.
 //
 // WARNING: The OCI distribution spec says
 // “A `4XX` response code from the registry MAY return a body in any format.”; but if it is
 // JSON, it MUST use the errcode.Error structure.
 // So, callers should primarily decide based on HTTP StatusCode, not based on error type here.
-func registryHTTPResponseToError(res *http.Response) error {
+func registryHTTPResponseToError(logger types.Logger, res *http.Response) error {
 	err := handleErrorResponse(res)
 	// len(errs) == 0 should never be returned by handleErrorResponse; if it does, we don't modify it and let the caller report it as is.
 	if errs, ok := err.(errcode.Errors); ok && len(errs) > 0 {
@@ -74,9 +85,9 @@ func registryHTTPResponseToError(res *http.Response) error {
 		// Also, docker/docker similarly only logs the other errors and returns the
 		// first one.
 		if len(errs) > 1 {
-			logrus.Debugf("Discarding non-primary errors:")
+			logger.Debugf("Discarding non-primary errors:")
 			for _, err := range errs[1:] {
-				logrus.Debugf("  %s", err.Error())
+				logger.Debugf("  %s", err.Error())
 			}
 		}
 		err = errs[0]
@@ -97,5 +108,27 @@ func registryHTTPResponseToError(res *http.Response) error {
 			err = fmt.Errorf("%s%.0w", e.Message, e)
 		}
 	}
-	return err
+	return errclass.Wrap(err, registryErrorKinds(res.StatusCode, err)...)
+}
+
+// registryErrorKinds returns the types.Err* values err, created from a HTTP response with statusCode, should be classified as.
+func registryErrorKinds(statusCode int, err error) []error {
+	var kinds []error
+	var ec errcode.ErrorCoder
+	if errors.As(err, &ec) {
+		switch ec.ErrorCode() {
+		case v2.ErrorCodeBlobUnknown, v2.ErrorCodeManifestBlobUnknown:
+			kinds = append(kinds, types.ErrBlobUnknown)
+		case v2.ErrorCodeManifestUnknown, v2.ErrorCodeNameUnknown:
+			kinds = append(kinds, types.ErrNotFound)
+		case v2.ErrorCodeManifestInvalid, v2.ErrorCodeManifestUnverified, v2.ErrorCodeTagInvalid:
+			kinds = append(kinds, types.ErrManifestInvalid)
+		case errcode.ErrorCodeUnauthorized, errcode.ErrorCodeDenied:
+			kinds = append(kinds, types.ErrUnauthorized)
+		case errcode.ErrorCodeTooManyRequests:
+			kinds = append(kinds, types.ErrTooManyRequests)
+		}
+	}
+	// The OCI distribution spec does not require the errcode.Error payloads to be used, so also classify based on the status code.
+	return append(kinds, errclass.HTTPStatusKinds(statusCode)...)
 }
@@ -4,9 +4,12 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
+	"io"
 	"net/http"
 	"testing"
 
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/types"
 	"github.com/docker/distribution/registry/api/errcode"
 	v2 "github.com/docker/distribution/registry/api/v2"
 	"github.com/stretchr/testify/assert"
@@ -26,6 +29,7 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 		errorType         any                           // A value of the same type as the expected error, or nil
 		unwrappedErrorPtr any                           // A pointer to a value expected to be reachable using errors.As, or nil
 		errorCode         *errcode.ErrorCode            // A matching ErrorCode, or nil
+		kinds             []error                       // types.Err* values the error is expected to be classified as
 		fn                func(t *testing.T, err error) // A more specialized test, or nil
 	}{
 		{
@@ -57,6 +61,7 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 			errorType:         nil,
 			unwrappedErrorPtr: &unwrappedErrcodeError,
 			errorCode:         &errcode.ErrorCodeUnauthorized,
+			kinds:             []error{types.ErrUnauthorized},
 		},
 		{ // docker.io when an image is not found
 			name: "GET https://registry-1.docker.io/v2/library/this-does-not-exist/manifests/latest",
@@ -74,6 +79,7 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 			errorType:         nil,
 			unwrappedErrorPtr: &unwrappedErrcodeError,
 			errorCode:         &errcode.ErrorCodeDenied,
+			kinds:             []error{types.ErrUnauthorized},
 		},
 		{ // docker.io when a tag is not found
 			name: "GET https://registry-1.docker.io/v2/library/busybox/manifests/this-does-not-exist",
@@ -92,6 +98,7 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 			errorType:         nil,
 			unwrappedErrorPtr: &unwrappedErrcodeError,
 			errorCode:         &v2.ErrorCodeManifestUnknown,
+			kinds:             []error{types.ErrNotFound},
 		},
 		{ // public.ecr.aws does not implement tag list
 			name: "GET https://public.ecr.aws/v2/nginx/nginx/tags/list",
@@ -107,6 +114,7 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 			errorType:         nil,
 			unwrappedErrorPtr: &unwrappedErrcodeError,
 			errorCode:         &errcode.ErrorCodeUnknown,
+			kinds:             []error{types.ErrNotFound},
 			fn: func(t *testing.T, err error) {
 				var e errcode.Error
 				ok := errors.As(err, &e)
@@ -135,9 +143,10 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 				"\r\n" +
 				"{\"errors\": [{\"code\": \"404\", \"message\": \"Not Found\"}]}\r\n",
 			errorString:       "unknown: Not Found",
-			errorType:         errcode.Error{},
+			errorType:         nil,
 			unwrappedErrorPtr: &unwrappedErrcodeError,
 			errorCode:         &errcode.ErrorCodeUnknown,
+			kinds:             []error{types.ErrNotFound},
 			fn: func(t *testing.T, err error) {
 				var e errcode.Error
 				ok := errors.As(err, &e)
@@ -164,6 +173,7 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 			errorString:       `StatusCode: 404, "Not found\r"`,
 			errorType:         nil,
 			unwrappedErrorPtr: &unwrappedUnexpectedHTTPResponseError,
+			kinds:             []error{types.ErrNotFound},
 			fn: func(t *testing.T, err error) {
 				var e *unexpectedHTTPResponseError
 				ok := errors.As(err, &e)
@@ -173,12 +183,43 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 				assert.Equal(t, []byte("Not found\r"), e.Response)
 			},
 		},
+		{
+			name: "blob unknown",
+			response: "HTTP/1.1 404 Not Found\r\n" +
+				"Content-Type: application/json\r\n" +
+				"\r\n" +
+				"{\"errors\":[{\"code\":\"BLOB_UNKNOWN\",\"message\":\"blob unknown to registry\"}]}\n",
+			errorString: "blob unknown",
+			errorCode:   &v2.ErrorCodeBlobUnknown,
+			kinds:       []error{types.ErrBlobUnknown, types.ErrNotFound},
+		},
+		{
+			name: "manifest invalid",
+			response: "HTTP/1.1 400 Bad Request\r\n" +
+				"Content-Type: application/json\r\n" +
+				"\r\n" +
+				"{\"errors\":[{\"code\":\"MANIFEST_INVALID\",\"message\":\"manifest invalid\"}]}\n",
+			errorString: "manifest invalid",
+			errorCode:   &v2.ErrorCodeManifestInvalid,
+			kinds:       []error{types.ErrManifestInvalid},
+		},
+		{
+			name: "too many requests",
+			response: "HTTP/1.1 429 Too Many Requests\r\n" +
+				"Content-Type: application/json\r\n" +
+				"\r\n" +
+				"{\"errors\":[{\"code\":\"TOOMANYREQUESTS\",\"message\":\"You have reached your pull rate limit.\"}]}\n",
+			errorString:       "toomanyrequests: You have reached your pull rate limit.",
+			unwrappedErrorPtr: &unwrappedErrcodeError,
+			errorCode:         &errcode.ErrorCodeTooManyRequests,
+			kinds:             []error{types.ErrTooManyRequests},
+		},
 	} {
 		res, err := http.ReadResponse(bufio.NewReader(bytes.NewReader([]byte(c.response))), nil)
 		require.NoError(t, err, c.name)
 		defer res.Body.Close()
 
-		err = registryHTTPResponseToError(res)
+		err = registryHTTPResponseToError(logging.Discard(), res)
 		assert.Equal(t, c.errorString, err.Error(), c.name)
 		if c.errorType != nil {
 			assert.IsType(t, c.errorType, err, c.name)
@@ -196,5 +237,35 @@ func TestRegistryHTTPResponseToError(t *testing.T) {
 		if c.fn != nil {
 			c.fn(t, err)
 		}
+		for _, kind := range c.kinds {
+			assert.ErrorIs(t, err, kind, c.name)
+		}
+		for _, kind := range []error{types.ErrNotFound, types.ErrUnauthorized, types.ErrTooManyRequests, types.ErrBlobUnknown, types.ErrManifestInvalid} {
+			if !errors.Is(err, kind) {
+				continue
+			}
+			found := false
+			for _, expected := range c.kinds {
+				found = found || expected == kind
+			}
+			assert.True(t, found, "%s: unexpectedly classified as %v", c.name, kind)
+		}
+	}
+}
+
+func TestHTTPResponseToError(t *testing.T) {
+	for _, c := range []struct {
+		statusCode int
+		kind       error
+	}{
+		{http.StatusTooManyRequests, types.ErrTooManyRequests},
+		{http.StatusUnauthorized, types.ErrUnauthorized},
+		{http.StatusNotFound, types.ErrNotFound},
+	} {
+		res := &http.Response{StatusCode: c.statusCode, Body: io.NopCloser(bytes.NewReader(nil))}
+		err := httpResponseToError(logging.Discard(), res, "context")
+		assert.ErrorIs(t, err, c.kind)
 	}
+	assert.ErrorIs(t, httpResponseToError(logging.Discard(), &http.Response{StatusCode: http.StatusTooManyRequests}, ""), ErrTooManyRequests)
+	assert.NoError(t, httpResponseToError(logging.Discard(), &http.Response{StatusCode: http.StatusOK}, ""))
 }
@@ -0,0 +1,110 @@
+package tarfile
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+
+	"github.com/containers/image/v5/internal/set"
+)
+
+// GarbageReport describes files in an archive which are not used by any image in it.
+// This is publicly visible as c/image/docker/archive.GarbageReport.
+type GarbageReport struct {
+	Paths []string // Paths of the unused files within the archive, sorted.
+	Size  int64    // Total size of the unused files, in bytes.
+}
+
+// PreviewCompaction returns a GarbageReport for the archive at archivePath, describing the files Compact would remove.
+// The archive is not modified.
+//
+// Compressed archives are not supported.
+func PreviewCompaction(archivePath string) (GarbageReport, error) {
+	if err := ensureUncompressed(archivePath); err != nil {
+		return GarbageReport{}, err
+	}
+	r, err := newReader(archivePath, false)
+	if err != nil {
+		return GarbageReport{}, err
+	}
+	defer r.Close()
+	return findGarbage(archivePath, r.Manifest)
+}
+
+// Compact rewrites the archive at archivePath so that it no longer contains files not used by any image in it,
+// and returns a GarbageReport describing the removed files.
+// The new archive is written to a temporary file, which then atomically replaces the original; if there is nothing
+// to remove, the archive is not modified.
+//
+// Compressed archives are not supported.
+func Compact(archivePath string) (GarbageReport, error) {
+	if err := ensureUncompressed(archivePath); err != nil {
+		return GarbageReport{}, err
+	}
+	r, err := newReader(archivePath, false)
+	if err != nil {
+		return GarbageReport{}, err
+	}
+	defer r.Close()
+	report, err := findGarbage(archivePath, r.Manifest)
+	if err != nil {
+		return GarbageReport{}, err
+	}
+	if len(report.Paths) == 0 {
+		return report, nil
+	}
+	repositories, err := r.readRepositories()
+	if err != nil {
+		return GarbageReport{}, err
+	}
+	used, usedDirs := usedPaths(r.Manifest)
+	if err := rewriteArchive(archivePath, func(name string) bool {
+		return !isUsedPath(name, used, usedDirs)
+	}, r.Manifest, repositories); err != nil {
+		return GarbageReport{}, err
+	}
+	return report, nil
+}
+
+// findGarbage returns a GarbageReport for the uncompressed archive at archivePath, which contains manifest.
+func findGarbage(archivePath string, manifest []ManifestItem) (GarbageReport, error) {
+	used, usedDirs := usedPaths(manifest)
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return GarbageReport{}, fmt.Errorf("opening file %q: %w", archivePath, err)
+	}
+	defer file.Close()
+
+	report := GarbageReport{Paths: []string{}}
+	tr := tar.NewReader(file)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return GarbageReport{}, fmt.Errorf("reading %q: %w", archivePath, err)
+		}
+		name := path.Clean(h.Name)
+		if h.Typeflag == tar.TypeDir || isUsedPath(name, used, usedDirs) {
+			continue
+		}
+		report.Paths = append(report.Paths, name)
+		report.Size += h.Size
+	}
+	sort.Strings(report.Paths)
+	return report, nil
+}
+
+// isUsedPath returns true if the archive entry name (after path.Clean) should be kept in the archive,
+// given the paths, and the directories of legacy per-layer files, used by images, as returned by usedPaths.
+func isUsedPath(name string, used, usedDirs *set.Set[string]) bool {
+	if name == manifestFileName || name == legacyRepositoriesFileName || used.Contains(name) || usedDirs.Contains(name) {
+		return true
+	}
+	dir := path.Dir(name)
+	return dir != "." && usedDirs.Contains(dir)
+}
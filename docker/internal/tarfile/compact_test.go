@@ -0,0 +1,50 @@
+package tarfile
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompact(t *testing.T) {
+	manifest := []ManifestItem{{
+		Config:   "config.json",
+		RepoTags: []string{"example.com/a:latest"},
+		Layers:   []string{"layer1.tar", "legacy/layer.tar"},
+	}}
+	repositories := map[string]map[string]string{"example.com/a": {"latest": "legacy"}}
+	path := writeTestArchive(t, manifest, repositories, []string{
+		"config.json", "layer1.tar", "legacy/", "legacy/layer.tar", "legacy/json",
+		"garbage.tar", "olddir/", "olddir/layer.tar",
+	})
+
+	expected := GarbageReport{
+		Paths: []string{"garbage.tar", "olddir/layer.tar"},
+		Size:  int64(len("garbage.tar") + len("olddir/layer.tar")),
+	}
+	report, err := PreviewCompaction(path)
+	require.NoError(t, err)
+	assert.Equal(t, expected, report)
+	names, _, _ := readTestArchive(t, path)
+	assert.Contains(t, names, "garbage.tar")
+
+	report, err = Compact(path)
+	require.NoError(t, err)
+	assert.Equal(t, expected, report)
+	names, newManifest, newRepositories := readTestArchive(t, path)
+	assert.Equal(t, []string{"config.json", "layer1.tar", "legacy/", "legacy/layer.tar", "legacy/json"}, names)
+	assert.Equal(t, manifest, newManifest)
+	assert.Equal(t, repositories, newRepositories)
+
+	// Nothing left to remove
+	fi, err := os.Stat(path)
+	require.NoError(t, err)
+	report, err = Compact(path)
+	require.NoError(t, err)
+	assert.Equal(t, GarbageReport{Paths: []string{}}, report)
+	fi2, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, fi.ModTime(), fi2.ModTime())
+}
@@ -0,0 +1,271 @@
+package tarfile
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/image/v5/pkg/compression"
+	"golang.org/x/exp/slices"
+)
+
+// DeleteImage rewrites the archive at archivePath so that it no longer contains the image matching (ref, sourceIndex),
+// as selected by Reader.ChooseManifestItem.
+// If the image is selected by ref and it has other tags, only that tag is removed, and the image is kept.
+// Files only used by the deleted image are removed from the archive.
+//
+// Compressed archives are not supported.
+func DeleteImage(archivePath string, ref reference.NamedTagged, sourceIndex int) error {
+	if err := ensureUncompressed(archivePath); err != nil {
+		return err
+	}
+	r, err := newReader(archivePath, false)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	item, tagIndex, err := r.ChooseManifestItem(ref, sourceIndex)
+	if err != nil {
+		return err
+	}
+
+	var removedTags []string
+	var newManifest []ManifestItem
+	if tagIndex != -1 && len(item.RepoTags) > 1 {
+		removedTags = []string{item.RepoTags[tagIndex]}
+		for i := range r.Manifest {
+			m := r.Manifest[i]
+			if &r.Manifest[i] == item {
+				m.RepoTags = slices.Delete(slices.Clone(m.RepoTags), tagIndex, tagIndex+1)
+			}
+			newManifest = append(newManifest, m)
+		}
+	} else {
+		removedTags = item.RepoTags
+		for i := range r.Manifest {
+			if &r.Manifest[i] != item {
+				newManifest = append(newManifest, r.Manifest[i])
+			}
+		}
+	}
+	if newManifest == nil {
+		newManifest = []ManifestItem{}
+	}
+	removedPaths, removedDirs := unusedPaths(item, newManifest)
+
+	repositories, err := r.readRepositories()
+	if err != nil {
+		return err
+	}
+	if repositories != nil {
+		if err := removeTagsFromRepositories(repositories, removedTags); err != nil {
+			return err
+		}
+	}
+
+	return rewriteArchive(archivePath, func(name string) bool {
+		if removedPaths.Contains(name) {
+			return true
+		}
+		for _, dir := range removedDirs.Values() {
+			if name == dir || strings.HasPrefix(name, dir+"/") {
+				return true
+			}
+		}
+		return false
+	}, newManifest, repositories)
+}
+
+// ensureUncompressed returns an error if the file at archivePath is compressed.
+func ensureUncompressed(archivePath string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("opening file %q: %w", archivePath, err)
+	}
+	defer file.Close()
+	_, decompressor, _, err := compression.DetectCompressionFormat(file)
+	if err != nil {
+		return fmt.Errorf("detecting compression for file %q: %w", archivePath, err)
+	}
+	if decompressor != nil {
+		return fmt.Errorf("deleting images from compressed archive %q is not supported", archivePath)
+	}
+	return nil
+}
+
+// unusedPaths returns the paths, and the directories of legacy per-layer files, used by deleted and not by any item of remaining.
+func unusedPaths(deleted *ManifestItem, remaining []ManifestItem) (*set.Set[string], *set.Set[string]) {
+	used, usedDirs := usedPaths(remaining)
+	removedPaths := set.New[string]()
+	removedDirs := set.New[string]()
+	for _, p := range append([]string{deleted.Config}, deleted.Layers...) {
+		p = path.Clean(p)
+		if used.Contains(p) {
+			continue
+		}
+		removedPaths.Add(p)
+		if dir := path.Dir(p); dir != "." && !usedDirs.Contains(dir) {
+			removedDirs.Add(dir)
+		}
+	}
+	return removedPaths, removedDirs
+}
+
+// usedPaths returns the paths, and the directories of legacy per-layer files, used by items.
+func usedPaths(items []ManifestItem) (*set.Set[string], *set.Set[string]) {
+	used := set.New[string]()
+	usedDirs := set.New[string]()
+	for _, m := range items {
+		for _, p := range append([]string{m.Config}, m.Layers...) {
+			p = path.Clean(p)
+			used.Add(p)
+			if dir := path.Dir(p); dir != "." {
+				usedDirs.Add(dir)
+			}
+		}
+	}
+	return used, usedDirs
+}
+
+// readRepositories returns the contents of the legacy repositories file, or nil if the archive does not contain one.
+func (r *Reader) readRepositories() (map[string]map[string]string, error) {
+	bytes, err := r.readTarComponent(legacyRepositoriesFileName, iolimits.MaxTarFileManifestSize)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	repositories := map[string]map[string]string{}
+	if err := json.Unmarshal(bytes, &repositories); err != nil {
+		return nil, fmt.Errorf("decoding tar %s: %w", legacyRepositoriesFileName, err)
+	}
+	return repositories, nil
+}
+
+// removeTagsFromRepositories removes tags, as used in ManifestItem.RepoTags, from repositories.
+func removeTagsFromRepositories(repositories map[string]map[string]string, tags []string) error {
+	for _, tag := range tags {
+		parsedTag, err := reference.ParseNormalizedNamed(tag)
+		if err != nil {
+			return fmt.Errorf("Invalid tag %#v: %w", tag, err)
+		}
+		nt, ok := parsedTag.(reference.NamedTagged)
+		if !ok {
+			continue
+		}
+		for repo, repoTags := range repositories {
+			named, err := reference.ParseNormalizedNamed(repo)
+			if err != nil || named.Name() != nt.Name() {
+				continue
+			}
+			delete(repoTags, nt.Tag())
+			if len(repoTags) == 0 {
+				delete(repositories, repo)
+			}
+		}
+	}
+	return nil
+}
+
+// rewriteArchive atomically replaces the archive at archivePath with a copy which does not contain files for which
+// remove returns true, and uses manifest and repositories (if not nil) as the contents of the respective files.
+func rewriteArchive(archivePath string, remove func(name string) bool, manifest []ManifestItem,
+	repositories map[string]map[string]string) error {
+	manifestBytes, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	var repositoriesBytes []byte
+	if repositories != nil {
+		repositoriesBytes, err = json.Marshal(repositories)
+		if err != nil {
+			return fmt.Errorf("marshaling repositories: %w", err)
+		}
+	}
+
+	input, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("opening file %q: %w", archivePath, err)
+	}
+	defer input.Close()
+	fi, err := input.Stat()
+	if err != nil {
+		return err
+	}
+	output, err := os.CreateTemp(filepath.Dir(archivePath), "."+filepath.Base(archivePath)+"-")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+	succeeded := false
+	defer func() {
+		output.Close()
+		if !succeeded {
+			os.Remove(output.Name())
+		}
+	}()
+
+	tr := tar.NewReader(input)
+	tw := tar.NewWriter(output)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading %q: %w", archivePath, err)
+		}
+		name := path.Clean(h.Name)
+		var replacement []byte
+		switch {
+		case name == manifestFileName:
+			replacement = manifestBytes
+		case name == legacyRepositoriesFileName && repositoriesBytes != nil:
+			replacement = repositoriesBytes
+		case remove(name):
+			continue
+		}
+		if replacement != nil {
+			h.Size = int64(len(replacement))
+			if err := tw.WriteHeader(h); err != nil {
+				return err
+			}
+			if _, err := tw.Write(replacement); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return fmt.Errorf("copying %q: %w", h.Name, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := output.Chmod(fi.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := output.Sync(); err != nil {
+		return err
+	}
+	if err := output.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(output.Name(), archivePath); err != nil {
+		return err
+	}
+	succeeded = true
+	return nil
+}
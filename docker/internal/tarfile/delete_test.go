@@ -0,0 +1,155 @@
+package tarfile
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestArchive writes an archive with files and a manifest.json file with manifest to a new file, and returns its path.
+func writeTestArchive(t *testing.T, manifest []ManifestItem, repositories map[string]map[string]string, files []string) string {
+	path := filepath.Join(t.TempDir(), "archive.tar")
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	add := func(name string, contents []byte) {
+		err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(contents)), Typeflag: tar.TypeReg})
+		require.NoError(t, err)
+		_, err = tw.Write(contents)
+		require.NoError(t, err)
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file, "/") {
+			err := tw.WriteHeader(&tar.Header{Name: file, Mode: 0755, Typeflag: tar.TypeDir})
+			require.NoError(t, err)
+		} else {
+			add(file, []byte(file))
+		}
+	}
+	manifestBytes, err := json.Marshal(manifest)
+	require.NoError(t, err)
+	add(manifestFileName, manifestBytes)
+	if repositories != nil {
+		repositoriesBytes, err := json.Marshal(repositories)
+		require.NoError(t, err)
+		add(legacyRepositoriesFileName, repositoriesBytes)
+	}
+	require.NoError(t, tw.Close())
+	return path
+}
+
+// readTestArchive returns the names of files in the archive at path, and the contents of its manifest.json and repositories files.
+func readTestArchive(t *testing.T, path string) ([]string, []ManifestItem, map[string]map[string]string) {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	names := []string{}
+	var manifest []ManifestItem
+	var repositories map[string]map[string]string
+	tr := tar.NewReader(f)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		contents, err := io.ReadAll(tr)
+		require.NoError(t, err)
+		switch h.Name {
+		case manifestFileName:
+			require.NoError(t, json.Unmarshal(contents, &manifest))
+		case legacyRepositoriesFileName:
+			require.NoError(t, json.Unmarshal(contents, &repositories))
+		default:
+			if h.Typeflag == tar.TypeReg {
+				assert.Equal(t, h.Name, string(contents))
+			}
+			names = append(names, h.Name)
+		}
+	}
+	return names, manifest, repositories
+}
+
+func TestDeleteImage(t *testing.T) {
+	manifest := []ManifestItem{
+		{Config: "c1.json", RepoTags: []string{"busybox:latest", "busybox:1"}, Layers: []string{"l1/layer.tar", "shared/layer.tar"}},
+		{Config: "c2.json", RepoTags: []string{"example.com/other:v2"}, Layers: []string{"l2/layer.tar", "shared/layer.tar"}},
+	}
+	repositories := map[string]map[string]string{
+		"busybox":           {"latest": "l1", "1": "l1"},
+		"example.com/other": {"v2": "l2"},
+	}
+	files := []string{"c1.json", "c2.json", "l1/", "l1/layer.tar", "l1/json", "l2/", "l2/layer.tar", "l2/VERSION", "shared/", "shared/layer.tar"}
+	allFiles := func(except ...string) []string {
+		res := []string{}
+		for _, f := range files {
+			excluded := false
+			for _, e := range except {
+				if f == e {
+					excluded = true
+				}
+			}
+			if !excluded {
+				res = append(res, f)
+			}
+		}
+		return res
+	}
+	parseTag := func(tag string) reference.NamedTagged {
+		named, err := reference.ParseNormalizedNamed(tag)
+		require.NoError(t, err)
+		nt, ok := named.(reference.NamedTagged)
+		require.True(t, ok)
+		return nt
+	}
+
+	// Removing one of several tags keeps the image
+	path := writeTestArchive(t, manifest, repositories, files)
+	err := DeleteImage(path, parseTag("docker.io/library/busybox:1"), -1)
+	require.NoError(t, err)
+	names, newManifest, newRepositories := readTestArchive(t, path)
+	assert.Equal(t, allFiles(), names)
+	assert.Equal(t, []string{"busybox:latest"}, newManifest[0].RepoTags)
+	assert.Equal(t, manifest[1], newManifest[1])
+	assert.Equal(t, map[string]map[string]string{"busybox": {"latest": "l1"}, "example.com/other": {"v2": "l2"}}, newRepositories)
+
+	// Removing the last tag removes the image, and the files only it uses
+	path = writeTestArchive(t, manifest, repositories, files)
+	err = DeleteImage(path, parseTag("example.com/other:v2"), -1)
+	require.NoError(t, err)
+	names, newManifest, newRepositories = readTestArchive(t, path)
+	assert.Equal(t, allFiles("c2.json", "l2/", "l2/layer.tar", "l2/VERSION"), names)
+	assert.Equal(t, manifest[:1], newManifest)
+	assert.Equal(t, map[string]map[string]string{"busybox": {"latest": "l1", "1": "l1"}}, newRepositories)
+
+	// Removing by index removes the image with all its tags
+	path = writeTestArchive(t, manifest, nil, files)
+	err = DeleteImage(path, nil, 0)
+	require.NoError(t, err)
+	names, newManifest, newRepositories = readTestArchive(t, path)
+	assert.Equal(t, allFiles("c1.json", "l1/", "l1/layer.tar", "l1/json"), names)
+	assert.Equal(t, manifest[1:], newManifest)
+	assert.Nil(t, newRepositories)
+
+	// Unknown tags and indexes are rejected, and the archive is not modified
+	path = writeTestArchive(t, manifest, repositories, files)
+	original, err := os.ReadFile(path)
+	require.NoError(t, err)
+	err = DeleteImage(path, parseTag("busybox:unknown"), -1)
+	assert.Error(t, err)
+	err = DeleteImage(path, nil, 2)
+	assert.Error(t, err)
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.True(t, bytes.Equal(original, current))
+}
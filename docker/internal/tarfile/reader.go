@@ -10,6 +10,7 @@ import (
 	"path"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/errclass"
 	"github.com/containers/image/v5/internal/iolimits"
 	"github.com/containers/image/v5/internal/tmpdir"
 	"github.com/containers/image/v5/pkg/compression"
@@ -157,7 +158,7 @@ func (r *Reader) ChooseManifestItem(ref reference.NamedTagged, sourceIndex int)
 				}
 			}
 		}
-		return nil, -1, fmt.Errorf("Tag %#v not found", refString)
+		return nil, -1, errclass.Wrap(fmt.Errorf("Tag %#v not found", refString), types.ErrNotFound)
 
 	case sourceIndex != -1:
 		if sourceIndex >= len(r.Manifest) {
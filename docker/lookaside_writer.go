@@ -0,0 +1,189 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/containers/image/v5/types"
+)
+
+// LookasideWriter writes signatures to a lookaside signature storage, typically configured as a
+// `lookaside-staging` URL in registries.d.
+// NOTE: Keep the built-in implementations in sync with docs/signature-protocols.md!
+type LookasideWriter interface {
+	// PutSignature stores sigBlob as the signature at sigURL, replacing any existing signature.
+	PutSignature(ctx context.Context, sigURL *url.URL, sigBlob []byte) error
+	// DeleteSignature deletes the signature at sigURL, if it exists.
+	// If it successfully determines that the signature does not exist, returns (true, nil).
+	DeleteSignature(ctx context.Context, sigURL *url.URL) (missing bool, err error)
+}
+
+// registeredLookasideWriters contains LookasideWriters registered using RegisterLookasideWriter, indexed by URL scheme.
+var registeredLookasideWriters = struct {
+	mutex   sync.Mutex
+	writers map[string]LookasideWriter
+}{writers: map[string]LookasideWriter{}}
+
+// RegisterLookasideWriter registers writer to be used for writing signatures to lookaside URLs using scheme.
+// This allows writing to storage not supported by the built-in implementations; a registered writer also
+// takes precedence over a built-in one for the same scheme.
+func RegisterLookasideWriter(scheme string, writer LookasideWriter) {
+	registeredLookasideWriters.mutex.Lock()
+	defer registeredLookasideWriters.mutex.Unlock()
+	registeredLookasideWriters.writers[scheme] = writer
+}
+
+// lookasideWriter returns a LookasideWriter for sigURL.
+// NOTE: Keep this in sync with docs/signature-protocols.md!
+func (c *dockerClient) lookasideWriter(sigURL *url.URL) (LookasideWriter, error) {
+	registeredLookasideWriters.mutex.Lock()
+	writer, ok := registeredLookasideWriters.writers[sigURL.Scheme]
+	registeredLookasideWriters.mutex.Unlock()
+	if ok {
+		return writer, nil
+	}
+
+	switch sigURL.Scheme {
+	case "file":
+		return fileLookasideWriter{logger: c.logger}, nil
+	case "dav", "davs":
+		return webDAVLookasideWriter{client: c.client, logger: c.logger}, nil
+	case "s3":
+		return newS3LookasideWriter(c.client, c.logger), nil
+	case "http", "https":
+		return nil, fmt.Errorf("Writing directly to a %s lookaside %s is not supported. Configure a lookaside-staging: location", sigURL.Scheme, sigURL.Redacted())
+	default:
+		return nil, fmt.Errorf("Unsupported scheme when writing signature to %s", sigURL.Redacted())
+	}
+}
+
+// fileLookasideWriter is a LookasideWriter for file:// URLs.
+type fileLookasideWriter struct {
+	logger types.Logger
+}
+
+func (w fileLookasideWriter) PutSignature(ctx context.Context, sigURL *url.URL, sigBlob []byte) error {
+	w.logger.Debugf("Writing to %s", sigURL.Path)
+	err := os.MkdirAll(filepath.Dir(sigURL.Path), 0755)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sigURL.Path, sigBlob, 0644)
+}
+
+func (w fileLookasideWriter) DeleteSignature(ctx context.Context, sigURL *url.URL) (bool, error) {
+	w.logger.Debugf("Deleting %s", sigURL.Path)
+	err := os.Remove(sigURL.Path)
+	if err != nil && os.IsNotExist(err) {
+		return true, nil
+	}
+	return false, err
+}
+
+// webDAVLookasideWriter is a LookasideWriter for dav:// and davs:// URLs, which use WebDAV over http:// and https://,
+// respectively. Credentials for HTTP basic authentication can be included in the URL.
+type webDAVLookasideWriter struct {
+	client *http.Client
+	logger types.Logger
+}
+
+// webDAVHTTPURL returns the http:// or https:// URL corresponding to a dav:// or davs:// davURL.
+func webDAVHTTPURL(davURL *url.URL) *url.URL {
+	res := *davURL
+	if res.Scheme == "davs" {
+		res.Scheme = "https"
+	} else {
+		res.Scheme = "http"
+	}
+	return &res
+}
+
+// do performs a WebDAV request, and returns the response status code.
+func (w webDAVLookasideWriter) do(ctx context.Context, method string, u *url.URL, body []byte) (int, error) {
+	w.logger.Debugf("%s %s", method, u.Redacted())
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		req.SetBasicAuth(u.User.Username(), password)
+	}
+	res, err := w.client.Do(req)
+	if err != nil {
+		return -1, err
+	}
+	defer res.Body.Close()
+	return res.StatusCode, nil
+}
+
+// mkcolAll creates the WebDAV collection at u, and its parents, if they don’t exist.
+func (w webDAVLookasideWriter) mkcolAll(ctx context.Context, u *url.URL) error {
+	status, err := w.do(ctx, "MKCOL", u, nil)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case http.StatusCreated, http.StatusMethodNotAllowed: // 405 means the collection already exists.
+		return nil
+	case http.StatusConflict: // A parent collection does not exist.
+		parent := *u
+		parent.Path = path.Dir(u.Path)
+		if parent.Path == u.Path {
+			break
+		}
+		if err := w.mkcolAll(ctx, &parent); err != nil {
+			return err
+		}
+		return w.mkcolAll(ctx, u)
+	}
+	return fmt.Errorf("creating WebDAV collection %s: status %d (%s)", u.Redacted(), status, http.StatusText(status))
+}
+
+func (w webDAVLookasideWriter) PutSignature(ctx context.Context, sigURL *url.URL, sigBlob []byte) error {
+	u := webDAVHTTPURL(sigURL)
+	status, err := w.do(ctx, http.MethodPut, u, sigBlob)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusConflict { // The parent collection does not exist.
+		parent := *u
+		parent.Path = path.Dir(u.Path)
+		if err := w.mkcolAll(ctx, &parent); err != nil {
+			return err
+		}
+		status, err = w.do(ctx, http.MethodPut, u, sigBlob)
+		if err != nil {
+			return err
+		}
+	}
+	switch status {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+		return nil
+	default:
+		return fmt.Errorf("writing signature to %s: status %d (%s)", u.Redacted(), status, http.StatusText(status))
+	}
+}
+
+func (w webDAVLookasideWriter) DeleteSignature(ctx context.Context, sigURL *url.URL) (bool, error) {
+	u := webDAVHTTPURL(sigURL)
+	status, err := w.do(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent:
+		return false, nil
+	case http.StatusNotFound:
+		return true, nil
+	default:
+		return false, fmt.Errorf("deleting signature %s: status %d (%s)", u.Redacted(), status, http.StatusText(status))
+	}
+}
@@ -0,0 +1,231 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containers/image/v5/types"
+)
+
+// s3LookasideWriter is a LookasideWriter for s3://bucket/path URLs, using S3-compatible object storage.
+// The credentials, region and an optional endpoint for non-AWS services are read from the usual AWS environment variables.
+type s3LookasideWriter struct {
+	client *http.Client
+	logger types.Logger
+	getenv func(string) string // os.Getenv, can be overridden for tests
+	now    func() time.Time    // time.Now, can be overridden for tests
+}
+
+func newS3LookasideWriter(client *http.Client, logger types.Logger) s3LookasideWriter {
+	return s3LookasideWriter{
+		client: client,
+		logger: logger,
+		getenv: os.Getenv,
+		now:    time.Now,
+	}
+}
+
+// s3Credentials are credentials used for signing S3 requests.
+type s3Credentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string // may be ""
+}
+
+// firstEnv returns the value of the first of names which is set to a non-empty value, or "".
+func (w s3LookasideWriter) firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := w.getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// credentials returns the configured S3 credentials.
+func (w s3LookasideWriter) credentials() (s3Credentials, error) {
+	res := s3Credentials{
+		accessKeyID:     w.getenv("AWS_ACCESS_KEY_ID"),
+		secretAccessKey: w.getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken:    w.getenv("AWS_SESSION_TOKEN"),
+	}
+	if res.accessKeyID == "" || res.secretAccessKey == "" {
+		return s3Credentials{}, errors.New("writing signatures to S3 requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY to be set")
+	}
+	return res, nil
+}
+
+// region returns the configured S3 region.
+func (w s3LookasideWriter) region() string {
+	if region := w.firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"); region != "" {
+		return region
+	}
+	return "us-east-1"
+}
+
+// s3EscapePath escapes p as required by S3 (and by the AWS signature version 4 canonical URI).
+func s3EscapePath(p string) string {
+	res := strings.Builder{}
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		if (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') ||
+			c == '-' || c == '_' || c == '.' || c == '~' || c == '/' {
+			res.WriteByte(c)
+		} else {
+			fmt.Fprintf(&res, "%%%02X", c)
+		}
+	}
+	return res.String()
+}
+
+// objectURL returns the HTTP URL of the object for sigURL.
+func (w s3LookasideWriter) objectURL(sigURL *url.URL) (*url.URL, error) {
+	bucket := sigURL.Host
+	if bucket == "" {
+		return nil, fmt.Errorf("S3 lookaside URL %s does not specify a bucket", sigURL.Redacted())
+	}
+	key := strings.TrimPrefix(sigURL.Path, "/")
+	if endpoint := w.firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"); endpoint != "" {
+		// Use path-style requests for custom endpoints, which are typically not set up for virtual-hosted buckets.
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("parsing S3 endpoint %q: %w", endpoint, err)
+		}
+		p := strings.TrimSuffix(u.Path, "/") + "/" + bucket + "/" + key
+		return &url.URL{Scheme: u.Scheme, Host: u.Host, Path: p, RawPath: s3EscapePath(p)}, nil
+	}
+	p := "/" + key
+	return &url.URL{Scheme: "https", Host: fmt.Sprintf("%s.s3.%s.amazonaws.com", bucket, w.region()), Path: p, RawPath: s3EscapePath(p)}, nil
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data using key.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// signS3Request signs req, with body, using AWS signature version 4 at time now.
+// All headers already set in req are signed.
+func signS3Request(req *http.Request, body []byte, creds s3Credentials, region string, now time.Time) {
+	const service = "s3"
+	bodyHash := sha256.Sum256(body)
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(bodyHash[:]))
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	headerNames := make([]string, 0, len(headers))
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	canonicalHeaders := strings.Builder{}
+	for _, name := range headerNames {
+		fmt.Fprintf(&canonicalHeaders, "%s:%s\n", name, headers[name])
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, region, service)
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+creds.secretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		creds.accessKeyID, scope, signedHeaders, signature))
+}
+
+// do performs a signed S3 request for the object for sigURL, and returns the response status code.
+func (w s3LookasideWriter) do(ctx context.Context, method string, sigURL *url.URL, body []byte) (int, error) {
+	creds, err := w.credentials()
+	if err != nil {
+		return -1, err
+	}
+	u, err := w.objectURL(sigURL)
+	if err != nil {
+		return -1, err
+	}
+	w.logger.Debugf("%s %s", method, u.Redacted())
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return -1, err
+	}
+	signS3Request(req, body, creds, w.region(), w.now())
+	res, err := w.client.Do(req)
+	if err != nil {
+		return -1, err
+	}
+	defer res.Body.Close()
+	return res.StatusCode, nil
+}
+
+func (w s3LookasideWriter) PutSignature(ctx context.Context, sigURL *url.URL, sigBlob []byte) error {
+	status, err := w.do(ctx, http.MethodPut, sigURL, sigBlob)
+	if err != nil {
+		return err
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("writing signature to %s: status %d (%s)", sigURL.Redacted(), status, http.StatusText(status))
+	}
+	return nil
+}
+
+func (w s3LookasideWriter) DeleteSignature(ctx context.Context, sigURL *url.URL) (bool, error) {
+	// S3 reports success when deleting an object which does not exist, so check for existence first.
+	status, err := w.do(ctx, http.MethodHead, sigURL, nil)
+	if err != nil {
+		return false, err
+	}
+	switch status {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return true, nil
+	default:
+		return false, fmt.Errorf("checking for signature %s: status %d (%s)", sigURL.Redacted(), status, http.StatusText(status))
+	}
+
+	status, err = w.do(ctx, http.MethodDelete, sigURL, nil)
+	if err != nil {
+		return false, err
+	}
+	if status != http.StatusOK && status != http.StatusNoContent {
+		return false, fmt.Errorf("deleting signature %s: status %d (%s)", sigURL.Redacted(), status, http.StatusText(status))
+	}
+	return false, nil
+}
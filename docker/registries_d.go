@@ -11,10 +11,10 @@ import (
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/rootless"
+	"github.com/containers/image/v5/pkg/logging"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage/pkg/homedir"
 	"github.com/opencontainers/go-digest"
-	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 )
 
@@ -46,11 +46,13 @@ type registryConfiguration struct {
 
 // registryNamespace defines lookaside locations for a single namespace.
 type registryNamespace struct {
-	Lookaside              string `yaml:"lookaside"`         // For reading, and if LookasideStaging is not present, for writing.
-	LookasideStaging       string `yaml:"lookaside-staging"` // For writing only.
-	SigStore               string `yaml:"sigstore"`          // For compatibility, deprecated in favor of Lookaside.
-	SigStoreStaging        string `yaml:"sigstore-staging"`  // For compatibility, deprecated in favor of LookasideStaging.
-	UseSigstoreAttachments *bool  `yaml:"use-sigstore-attachments,omitempty"`
+	Lookaside                  string `yaml:"lookaside"`         // For reading, and if LookasideStaging is not present, for writing.
+	LookasideStaging           string `yaml:"lookaside-staging"` // For writing only.
+	SigStore                   string `yaml:"sigstore"`          // For compatibility, deprecated in favor of Lookaside.
+	SigStoreStaging            string `yaml:"sigstore-staging"`  // For compatibility, deprecated in favor of LookasideStaging.
+	UseSigstoreAttachments     *bool  `yaml:"use-sigstore-attachments,omitempty"`
+	DiscoverSigstoreSignatures *bool  `yaml:"discover-sigstore-signatures,omitempty"` // Only used if UseSigstoreAttachments is not set.
+	UseSigstoreReferrers       *bool  `yaml:"use-sigstore-referrers,omitempty"`       // Only used if UseSigstoreAttachments is set.
 }
 
 // lookasideStorageBase is an "opaque" type representing a lookaside Docker signature storage.
@@ -71,13 +73,13 @@ func SignatureStorageBaseURL(sys *types.SystemContext, ref types.ImageReference,
 		return nil, err
 	}
 
-	return config.lookasideStorageBaseURL(dr, write)
+	return config.lookasideStorageBaseURL(logging.For(sys), dr, write)
 }
 
 // loadRegistryConfiguration returns a registryConfiguration appropriate for sys.
 func loadRegistryConfiguration(sys *types.SystemContext) (*registryConfiguration, error) {
 	dirPath := registriesDirPath(sys)
-	logrus.Debugf(`Using registries.d directory %s`, dirPath)
+	logging.For(sys).Debugf(`Using registries.d directory %s`, dirPath)
 	return loadAndMergeConfig(dirPath)
 }
 
@@ -161,8 +163,8 @@ func loadAndMergeConfig(dirPath string) (*registryConfiguration, error) {
 
 // lookasideStorageBaseURL returns an appropriate signature storage URL for ref, for write access if “write”.
 // the usage of the BaseURL is defined under docker/distribution registries—separate storage of docs/signature-protocols.md
-func (config *registryConfiguration) lookasideStorageBaseURL(dr dockerReference, write bool) (*url.URL, error) {
-	topLevel := config.signatureTopLevel(dr, write)
+func (config *registryConfiguration) lookasideStorageBaseURL(logger types.Logger, dr dockerReference, write bool) (*url.URL, error) {
+	topLevel := config.signatureTopLevel(logger, dr, write)
 	var baseURL *url.URL
 	if topLevel != "" {
 		u, err := url.Parse(topLevel)
@@ -173,7 +175,7 @@ func (config *registryConfiguration) lookasideStorageBaseURL(dr dockerReference,
 	} else {
 		// returns default directory if no lookaside specified in configuration file
 		baseURL = builtinDefaultLookasideStorageDir(rootless.GetRootlessEUID())
-		logrus.Debugf(" No signature storage configuration found for %s, using built-in default %s", dr.PolicyConfigurationIdentity(), baseURL.Redacted())
+		logger.Debugf(" No signature storage configuration found for %s, using built-in default %s", dr.PolicyConfigurationIdentity(), baseURL.Redacted())
 	}
 	// NOTE: Keep this in sync with docs/signature-protocols.md!
 	// FIXME? Restrict to explicitly supported schemes?
@@ -195,13 +197,13 @@ func builtinDefaultLookasideStorageDir(euid int) *url.URL {
 
 // config.signatureTopLevel returns an URL string configured in config for ref, for write access if “write”.
 // (the top level of the storage, namespaced by repo.FullName etc.), or "" if nothing has been configured.
-func (config *registryConfiguration) signatureTopLevel(ref dockerReference, write bool) string {
+func (config *registryConfiguration) signatureTopLevel(logger types.Logger, ref dockerReference, write bool) string {
 	if config.Docker != nil {
 		// Look for a full match.
 		identity := ref.PolicyConfigurationIdentity()
 		if ns, ok := config.Docker[identity]; ok {
-			logrus.Debugf(` Lookaside configuration: using "docker" namespace %s`, identity)
-			if ret := ns.signatureTopLevel(write); ret != "" {
+			logger.Debugf(` Lookaside configuration: using "docker" namespace %s`, identity)
+			if ret := ns.signatureTopLevel(logger, write); ret != "" {
 				return ret
 			}
 		}
@@ -209,8 +211,8 @@ func (config *registryConfiguration) signatureTopLevel(ref dockerReference, writ
 		// Look for a match of the possible parent namespaces.
 		for _, name := range ref.PolicyConfigurationNamespaces() {
 			if ns, ok := config.Docker[name]; ok {
-				logrus.Debugf(` Lookaside configuration: using "docker" namespace %s`, name)
-				if ret := ns.signatureTopLevel(write); ret != "" {
+				logger.Debugf(` Lookaside configuration: using "docker" namespace %s`, name)
+				if ret := ns.signatureTopLevel(logger, write); ret != "" {
 					return ret
 				}
 			}
@@ -218,66 +220,99 @@ func (config *registryConfiguration) signatureTopLevel(ref dockerReference, writ
 	}
 	// Look for a default location
 	if config.DefaultDocker != nil {
-		logrus.Debugf(` Lookaside configuration: using "default-docker" configuration`)
-		if ret := config.DefaultDocker.signatureTopLevel(write); ret != "" {
+		logger.Debugf(` Lookaside configuration: using "default-docker" configuration`)
+		if ret := config.DefaultDocker.signatureTopLevel(logger, write); ret != "" {
 			return ret
 		}
 	}
 	return ""
 }
 
+// useSigstoreAttachments returns whether we should look for and write sigstore attachments for ref,
+// using sys.DockerUseSigstoreAttachments if set, and config otherwise; or OptionalBoolUndefined if neither configures it.
+func useSigstoreAttachments(sys *types.SystemContext, logger types.Logger, config *registryConfiguration, ref dockerReference) types.OptionalBool {
+	if sys != nil && sys.DockerUseSigstoreAttachments != types.OptionalBoolUndefined {
+		return sys.DockerUseSigstoreAttachments
+	}
+	return config.useSigstoreAttachments(logger, ref)
+}
+
 // config.useSigstoreAttachments returns whether we should look for and write sigstore attachments.
-// for ref.
-func (config *registryConfiguration) useSigstoreAttachments(ref dockerReference) bool {
+// for ref, or OptionalBoolUndefined if that is not configured.
+func (config *registryConfiguration) useSigstoreAttachments(logger types.Logger, ref dockerReference) types.OptionalBool {
+	return config.sigstoreOption(logger, ref, func(ns *registryNamespace) *bool { return ns.UseSigstoreAttachments })
+}
+
+// discoverSigstoreSignatures returns whether we should look for sigstore signatures for ref even if the use
+// of sigstore attachments is not configured, using sys.DockerDiscoverSigstoreSignatures if set, and config otherwise.
+func discoverSigstoreSignatures(sys *types.SystemContext, logger types.Logger, config *registryConfiguration, ref dockerReference) bool {
+	if sys != nil && sys.DockerDiscoverSigstoreSignatures != types.OptionalBoolUndefined {
+		return sys.DockerDiscoverSigstoreSignatures == types.OptionalBoolTrue
+	}
+	return config.sigstoreOption(logger, ref, func(ns *registryNamespace) *bool { return ns.DiscoverSigstoreSignatures }) == types.OptionalBoolTrue
+}
+
+// useSigstoreReferrers returns whether sigstore signatures for ref should be stored as OCI referrers instead of in sigstore attachment tags,
+// using sys.DockerUseSigstoreReferrers if set, and config otherwise.
+func useSigstoreReferrers(sys *types.SystemContext, logger types.Logger, config *registryConfiguration, ref dockerReference) bool {
+	if sys != nil && sys.DockerUseSigstoreReferrers != types.OptionalBoolUndefined {
+		return sys.DockerUseSigstoreReferrers == types.OptionalBoolTrue
+	}
+	return config.sigstoreOption(logger, ref, func(ns *registryNamespace) *bool { return ns.UseSigstoreReferrers }) == types.OptionalBoolTrue
+}
+
+// config.sigstoreOption returns the value of the sigstore-related option selected by option for ref,
+// or OptionalBoolUndefined if that is not configured.
+func (config *registryConfiguration) sigstoreOption(logger types.Logger, ref dockerReference, option func(*registryNamespace) *bool) types.OptionalBool {
 	if config.Docker != nil {
 		// Look for a full match.
 		identity := ref.PolicyConfigurationIdentity()
 		if ns, ok := config.Docker[identity]; ok {
-			logrus.Debugf(` Sigstore attachments: using "docker" namespace %s`, identity)
-			if ns.UseSigstoreAttachments != nil {
-				return *ns.UseSigstoreAttachments
+			logger.Debugf(` Sigstore attachments: using "docker" namespace %s`, identity)
+			if v := option(&ns); v != nil {
+				return types.NewOptionalBool(*v)
 			}
 		}
 
 		// Look for a match of the possible parent namespaces.
 		for _, name := range ref.PolicyConfigurationNamespaces() {
 			if ns, ok := config.Docker[name]; ok {
-				logrus.Debugf(` Sigstore attachments: using "docker" namespace %s`, name)
-				if ns.UseSigstoreAttachments != nil {
-					return *ns.UseSigstoreAttachments
+				logger.Debugf(` Sigstore attachments: using "docker" namespace %s`, name)
+				if v := option(&ns); v != nil {
+					return types.NewOptionalBool(*v)
 				}
 			}
 		}
 	}
 	// Look for a default location
 	if config.DefaultDocker != nil {
-		logrus.Debugf(` Sigstore attachments: using "default-docker" configuration`)
-		if config.DefaultDocker.UseSigstoreAttachments != nil {
-			return *config.DefaultDocker.UseSigstoreAttachments
+		logger.Debugf(` Sigstore attachments: using "default-docker" configuration`)
+		if v := option(config.DefaultDocker); v != nil {
+			return types.NewOptionalBool(*v)
 		}
 	}
-	return false
+	return types.OptionalBoolUndefined
 }
 
 // ns.signatureTopLevel returns an URL string configured in ns for ref, for write access if “write”.
 // or "" if nothing has been configured.
-func (ns registryNamespace) signatureTopLevel(write bool) string {
+func (ns registryNamespace) signatureTopLevel(logger types.Logger, write bool) string {
 	if write {
 		if ns.LookasideStaging != "" {
-			logrus.Debugf(`  Using "lookaside-staging" %s`, ns.LookasideStaging)
+			logger.Debugf(`  Using "lookaside-staging" %s`, ns.LookasideStaging)
 			return ns.LookasideStaging
 		}
 		if ns.SigStoreStaging != "" {
-			logrus.Debugf(`  Using "sigstore-staging" %s`, ns.SigStoreStaging)
+			logger.Debugf(`  Using "sigstore-staging" %s`, ns.SigStoreStaging)
 			return ns.SigStoreStaging
 		}
 	}
 	if ns.Lookaside != "" {
-		logrus.Debugf(`  Using "lookaside" %s`, ns.Lookaside)
+		logger.Debugf(`  Using "lookaside" %s`, ns.Lookaside)
 		return ns.Lookaside
 	}
 	if ns.SigStore != "" {
-		logrus.Debugf(`  Using "sigstore" %s`, ns.SigStore)
+		logger.Debugf(`  Using "sigstore" %s`, ns.SigStore)
 		return ns.SigStore
 	}
 	return ""
@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/containers/image/v5/pkg/logging"
 	"github.com/containers/image/v5/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -252,9 +253,9 @@ func TestRegistryConfigurationSignatureTopLevel(t *testing.T) {
 	} {
 		dr := dockerRefFromString(t, "//"+c.input)
 
-		res := config.signatureTopLevel(dr, false)
+		res := config.signatureTopLevel(logging.Discard(), dr, false)
 		assert.Equal(t, c.expected, res, c.input)
-		res = config.signatureTopLevel(dr, true) // test that forWriting is correctly propagated
+		res = config.signatureTopLevel(logging.Discard(), dr, true) // test that forWriting is correctly propagated
 		assert.Equal(t, c.expected+"+w", res, c.input)
 	}
 
@@ -264,12 +265,126 @@ func TestRegistryConfigurationSignatureTopLevel(t *testing.T) {
 		},
 	}
 	dr := dockerRefFromString(t, "//thisisnotmatched")
-	res := config.signatureTopLevel(dr, false)
+	res := config.signatureTopLevel(logging.Discard(), dr, false)
 	assert.Equal(t, "", res)
-	res = config.signatureTopLevel(dr, true)
+	res = config.signatureTopLevel(logging.Discard(), dr, true)
 	assert.Equal(t, "", res)
 }
 
+func TestRegistryConfigurationUseSigstoreAttachments(t *testing.T) {
+	yes, no := true, false
+	config := registryConfiguration{
+		DefaultDocker: &registryNamespace{UseSigstoreAttachments: &yes},
+		Docker: map[string]registryNamespace{
+			"example.com":           {UseSigstoreAttachments: &no},
+			"example.com/ns1":       {Lookaside: "a"}, // Does not set UseSigstoreAttachments
+			"example.com/ns1/ns2":   {UseSigstoreAttachments: &yes},
+			"example.com/ns1/other": {UseSigstoreAttachments: &no},
+		},
+	}
+	for _, c := range []struct {
+		input    string
+		expected types.OptionalBool
+	}{
+		{"example.com/ns1/ns2/repo:notlatest", types.OptionalBoolTrue},
+		{"example.com/ns1/other/repo", types.OptionalBoolFalse},
+		{"example.com/ns1/repo", types.OptionalBoolFalse},
+		{"example.com/repo", types.OptionalBoolFalse},
+		{"unknown.example.com/busybox", types.OptionalBoolTrue},
+	} {
+		dr := dockerRefFromString(t, "//"+c.input)
+		res := config.useSigstoreAttachments(logging.Discard(), dr)
+		assert.Equal(t, c.expected, res, c.input)
+	}
+
+	config = registryConfiguration{}
+	res := config.useSigstoreAttachments(logging.Discard(), dockerRefFromString(t, "//example.com/repo"))
+	assert.Equal(t, types.OptionalBoolUndefined, res)
+}
+
+func TestUseSigstoreAttachments(t *testing.T) {
+	yes, no := true, false
+	enabled := &registryConfiguration{DefaultDocker: &registryNamespace{UseSigstoreAttachments: &yes}}
+	disabled := &registryConfiguration{DefaultDocker: &registryNamespace{UseSigstoreAttachments: &no}}
+	unset := &registryConfiguration{DefaultDocker: &registryNamespace{}}
+	dr := dockerRefFromString(t, "//example.com/repo")
+	for _, c := range []struct {
+		sys      *types.SystemContext
+		config   *registryConfiguration
+		expected types.OptionalBool
+	}{
+		{nil, enabled, types.OptionalBoolTrue},
+		{nil, disabled, types.OptionalBoolFalse},
+		{nil, unset, types.OptionalBoolUndefined},
+		{&types.SystemContext{}, enabled, types.OptionalBoolTrue},
+		{&types.SystemContext{}, disabled, types.OptionalBoolFalse},
+		{&types.SystemContext{}, unset, types.OptionalBoolUndefined},
+		{&types.SystemContext{DockerUseSigstoreAttachments: types.OptionalBoolTrue}, disabled, types.OptionalBoolTrue},
+		{&types.SystemContext{DockerUseSigstoreAttachments: types.OptionalBoolTrue}, enabled, types.OptionalBoolTrue},
+		{&types.SystemContext{DockerUseSigstoreAttachments: types.OptionalBoolTrue}, unset, types.OptionalBoolTrue},
+		{&types.SystemContext{DockerUseSigstoreAttachments: types.OptionalBoolFalse}, enabled, types.OptionalBoolFalse},
+		{&types.SystemContext{DockerUseSigstoreAttachments: types.OptionalBoolFalse}, disabled, types.OptionalBoolFalse},
+		{&types.SystemContext{DockerUseSigstoreAttachments: types.OptionalBoolFalse}, unset, types.OptionalBoolFalse},
+	} {
+		res := useSigstoreAttachments(c.sys, logging.Discard(), c.config, dr)
+		assert.Equal(t, c.expected, res, fmt.Sprintf("%#v %#v", c.sys, c.config.DefaultDocker))
+	}
+}
+
+func TestDiscoverSigstoreSignatures(t *testing.T) {
+	yes, no := true, false
+	enabled := &registryConfiguration{DefaultDocker: &registryNamespace{DiscoverSigstoreSignatures: &yes}}
+	disabled := &registryConfiguration{DefaultDocker: &registryNamespace{DiscoverSigstoreSignatures: &no}}
+	unset := &registryConfiguration{DefaultDocker: &registryNamespace{}}
+	nsEnabled := &registryConfiguration{
+		DefaultDocker: &registryNamespace{DiscoverSigstoreSignatures: &no},
+		Docker: map[string]registryNamespace{
+			"example.com": {DiscoverSigstoreSignatures: &yes},
+		},
+	}
+	dr := dockerRefFromString(t, "//example.com/repo")
+	for _, c := range []struct {
+		sys      *types.SystemContext
+		config   *registryConfiguration
+		expected bool
+	}{
+		{nil, enabled, true},
+		{nil, disabled, false},
+		{nil, unset, false},
+		{nil, nsEnabled, true},
+		{&types.SystemContext{}, enabled, true},
+		{&types.SystemContext{}, unset, false},
+		{&types.SystemContext{DockerDiscoverSigstoreSignatures: types.OptionalBoolTrue}, disabled, true},
+		{&types.SystemContext{DockerDiscoverSigstoreSignatures: types.OptionalBoolTrue}, unset, true},
+		{&types.SystemContext{DockerDiscoverSigstoreSignatures: types.OptionalBoolFalse}, enabled, false},
+	} {
+		res := discoverSigstoreSignatures(c.sys, logging.Discard(), c.config, dr)
+		assert.Equal(t, c.expected, res, fmt.Sprintf("%#v %#v", c.sys, c.config.DefaultDocker))
+	}
+}
+
+func TestUseSigstoreReferrers(t *testing.T) {
+	yes, no := true, false
+	enabled := &registryConfiguration{DefaultDocker: &registryNamespace{UseSigstoreReferrers: &yes}}
+	disabled := &registryConfiguration{DefaultDocker: &registryNamespace{UseSigstoreReferrers: &no}}
+	unset := &registryConfiguration{DefaultDocker: &registryNamespace{}}
+	dr := dockerRefFromString(t, "//example.com/repo")
+	for _, c := range []struct {
+		sys      *types.SystemContext
+		config   *registryConfiguration
+		expected bool
+	}{
+		{nil, enabled, true},
+		{nil, disabled, false},
+		{nil, unset, false},
+		{&types.SystemContext{DockerUseSigstoreReferrers: types.OptionalBoolTrue}, unset, true},
+		{&types.SystemContext{DockerUseSigstoreReferrers: types.OptionalBoolFalse}, enabled, false},
+	} {
+		res := useSigstoreReferrers(c.sys, logging.Discard(), c.config, dr)
+		assert.Equal(t, c.expected, res, fmt.Sprintf("%#v %#v", c.sys, c.config.DefaultDocker))
+	}
+}
+
 func TestRegistryNamespaceSignatureTopLevel(t *testing.T) {
 	for _, c := range []struct {
 		ns         registryNamespace
@@ -295,7 +410,7 @@ func TestRegistryNamespaceSignatureTopLevel(t *testing.T) {
 		{registryNamespace{Lookaside: "b", SigStore: "d"}, false, "b"},
 		{registryNamespace{SigStore: "d"}, false, "d"},
 	} {
-		res := c.ns.signatureTopLevel(c.forWriting)
+		res := c.ns.signatureTopLevel(logging.Discard(), c.forWriting)
 		assert.Equal(t, c.expected, res, fmt.Sprintf("%#v %v", c.ns, c.forWriting))
 	}
 }
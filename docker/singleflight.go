@@ -0,0 +1,96 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/sync/singleflight"
+)
+
+// inFlightRequests deduplicates identical concurrent requests made by all dockerClients in this process,
+// if enabled by types.SystemContext.DockerDeduplicateRequests.
+var inFlightRequests singleflight.Group
+
+// deduplicated calls fn, unless c.sys.DockerDeduplicateRequests is set and an identical call is already in progress
+// (possibly in a different dockerClient), in which case it returns the result of that call instead.
+// keyParts must identify the request to c.registry, apart from the credentials and the TLS configuration, which are added automatically.
+// The result of fn must not be modified by callers.
+func (c *dockerClient) deduplicated(ctx context.Context, fn func(ctx context.Context) (any, error), keyParts ...string) (any, error) {
+	if c.sys == nil || !c.sys.DockerDeduplicateRequests {
+		return fn(ctx)
+	}
+	credentials, err := c.credentialsKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.Join(append([]string{c.registry, credentials, c.tlsKey()}, keyParts...), "\x00")
+	ch := inFlightRequests.DoChan(key, func() (any, error) {
+		return fn(ctx)
+	})
+	select {
+	case res := <-ch:
+		if res.Shared && res.Err != nil && ctx.Err() == nil &&
+			(errors.Is(res.Err, context.Canceled) || errors.Is(res.Err, context.DeadlineExceeded)) {
+			// The call was made using the context of a different caller, which was canceled; try again on our own.
+			c.logger.Debugf("Deduplicated request was canceled by another caller, retrying")
+			return fn(ctx)
+		}
+		return res.Val, res.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// credentialsKey returns a value identifying the credentials c uses for requests, for use in deduplicated keys.
+func (c *dockerClient) credentialsKey(ctx context.Context) (string, error) {
+	auth, err := c.currentAuth(ctx)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	for _, v := range []string{auth.Username, auth.Password, auth.IdentityToken, c.registryToken} {
+		b.WriteString(v)
+		b.WriteByte(0)
+	}
+	return digest.FromBytes(b.Bytes()).Encoded(), nil
+}
+
+// tlsKey returns a value identifying the TLS configuration c uses for requests (trusted CAs, client certificates,
+// pinned keys and verification settings), for use in deduplicated keys.
+func (c *dockerClient) tlsKey() string {
+	var b bytes.Buffer
+	write := func(v string) {
+		b.WriteString(v)
+		b.WriteByte(0)
+	}
+	// The per-host certificate directory contains both trusted CAs and client certificates.
+	write(c.certificates.Dir())
+	write(strconv.FormatBool(c.tlsClientConfig.InsecureSkipVerify))
+	write(strconv.Itoa(int(c.sys.DockerInsecureSkipTLSVerify)))
+	write(strconv.Itoa(int(c.tlsClientConfig.MinVersion)))
+	for _, suite := range c.tlsClientConfig.CipherSuites {
+		write(strconv.Itoa(int(suite)))
+	}
+	write("")
+	pinnedPublicKeys := c.pinnedPublicKeys
+	if c.sys.DockerPinnedPublicKeys != nil {
+		pinnedPublicKeys = c.sys.DockerPinnedPublicKeys
+	}
+	for _, key := range pinnedPublicKeys {
+		write(key)
+	}
+	write("")
+	// Client certificates from credentials; X.509-SVIDs are identified by the SPIFFE endpoint providing them.
+	for _, cert := range c.tlsClientConfig.Certificates {
+		for _, der := range cert.Certificate {
+			write(string(der))
+		}
+		write("")
+	}
+	write(c.sys.DockerSPIFFEEndpointSocket)
+	return digest.FromBytes(b.Bytes()).Encoded()
+}
@@ -0,0 +1,176 @@
+package docker
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/pkg/tlsclientconfig"
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeduplicated(t *testing.T) {
+	certificates, err := tlsclientconfig.NewReloadingConfig(nil, t.TempDir(), 0)
+	require.NoError(t, err)
+	newClient := func(dedup bool, username string) *dockerClient {
+		return &dockerClient{
+			sys:             &types.SystemContext{DockerDeduplicateRequests: dedup},
+			registry:        "registry.example",
+			logger:          logging.Discard(),
+			tlsClientConfig: &tls.Config{},
+			certificates:    certificates,
+			auth:            types.DockerAuthConfig{Username: username},
+		}
+	}
+	insecureClient := newClient(true, "user")
+	insecureClient.tlsClientConfig.InsecureSkipVerify = true
+	clientCertClient := newClient(true, "user")
+	clientCertClient.tlsClientConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{[]byte("not really DER")}}}
+	var calls atomic.Int32
+	release := make(chan struct{})
+	blockingFn := func(ctx context.Context) (any, error) {
+		calls.Add(1)
+		select {
+		case <-release:
+			return "result", nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// Concurrent identical calls with the same credentials and TLS configuration are deduplicated;
+	// calls with different keys, credentials or TLS configuration are not.
+	var wg sync.WaitGroup
+	results := make([]any, 6)
+	for i, c := range []struct {
+		client *dockerClient
+		key    string
+	}{
+		{newClient(true, "user"), "a"},
+		{newClient(true, "user"), "a"},
+		{newClient(true, "user"), "b"},
+		{newClient(true, "other-user"), "a"},
+		{insecureClient, "a"},
+		{clientCertClient, "a"},
+	} {
+		i, c := i, c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := c.client.deduplicated(context.Background(), blockingFn, c.key)
+			assert.NoError(t, err)
+			results[i] = res
+		}()
+	}
+	time.Sleep(100 * time.Millisecond) // Allow all goroutines to start their calls.
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(5), calls.Load())
+	assert.Equal(t, []any{"result", "result", "result", "result", "result", "result"}, results)
+
+	// Without DockerDeduplicateRequests, fn is always called
+	calls.Store(0)
+	for i := 0; i < 2; i++ {
+		res, err := newClient(false, "user").deduplicated(context.Background(), blockingFn, "a")
+		require.NoError(t, err)
+		assert.Equal(t, "result", res)
+	}
+	assert.Equal(t, int32(2), calls.Load())
+
+	// If the call is canceled by another caller, it is retried
+	calls.Store(0)
+	started := make(chan struct{})
+	leaderCtx, cancelLeader := context.WithCancel(context.Background())
+	firstCall := true
+	fn := func(ctx context.Context) (any, error) {
+		calls.Add(1)
+		if firstCall {
+			firstCall = false
+			close(started)
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return "retried", nil
+	}
+	leaderDone := make(chan error)
+	go func() {
+		_, err := newClient(true, "user").deduplicated(leaderCtx, fn, "c")
+		leaderDone <- err
+	}()
+	<-started
+	followerDone := make(chan any)
+	go func() {
+		res, err := newClient(true, "user").deduplicated(context.Background(), fn, "c")
+		assert.NoError(t, err)
+		followerDone <- res
+	}()
+	time.Sleep(100 * time.Millisecond) // Allow the follower to join the call.
+	cancelLeader()
+	assert.ErrorIs(t, <-leaderDone, context.Canceled)
+	assert.Equal(t, "retried", <-followerDone)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestFetchManifestDeduplication(t *testing.T) {
+	var manifestRequests atomic.Int32
+	release := make(chan struct{})
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case "/v2/ns/repo/manifests/tag":
+			manifestRequests.Add(1)
+			<-release
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			fmt.Fprint(w, `{"schemaVersion":2}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer s.Close()
+	registry := strings.TrimPrefix(s.URL, "http://")
+	named, err := reference.ParseNormalizedNamed(registry + "/ns/repo:tag")
+	require.NoError(t, err)
+	ref, err := newReference(named, false)
+	require.NoError(t, err)
+
+	const clients = 5
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		sys := &types.SystemContext{DockerInsecureSkipTLSVerify: types.OptionalBoolTrue, DockerDeduplicateRequests: true}
+		if i == 0 {
+			sys.DockerManifestMIMETypeAliases = map[string]string{"application/vnd.oci.image.manifest.v1+json": "application/x-alias"}
+		}
+		c, err := newDockerClient(sys, registry, registry)
+		require.NoError(t, err)
+		defer c.Close()
+		require.NoError(t, c.detectProperties(context.Background()))
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m, mimeType, err := c.fetchManifest(context.Background(), ref, "tag")
+			assert.NoError(t, err)
+			assert.Equal(t, []byte(`{"schemaVersion":2}`), m)
+			if i == 0 { // The aliases of each client are applied
+				assert.Equal(t, "application/x-alias", mimeType)
+			} else {
+				assert.Equal(t, "application/vnd.oci.image.manifest.v1+json", mimeType)
+			}
+		}(i)
+	}
+	time.Sleep(100 * time.Millisecond) // Allow all goroutines to start their requests.
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), manifestRequests.Load())
+}
@@ -16,6 +16,9 @@ fi
 
 echo "Executing go vet"
 GO111MODULE="on" go vet -tags="$BUILDTAGS" ./...
+for m in $SUBMODULES; do
+    (cd "$m" && GO111MODULE="on" go vet -tags="$BUILDTAGS" ./...)
+done
 
 echo "Executing gofmt"
 OUTPUT=$(gofmt -s -l . | sed -e '/^vendor/d')
@@ -0,0 +1,24 @@
+package image
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/types"
+)
+
+// ConfigEdit describes changes to the runtime configuration of an image, for EditConfig.
+// The zero value does not change anything.
+type ConfigEdit = image.ConfigEdit
+
+// EditedImage is the result of EditConfig: an updated manifest and configuration, with their digests.
+type EditedImage = image.EditedImage
+
+// EditConfig returns a manifest and a configuration for img, which must be a single image (not a manifest list),
+// with the runtime configuration changed as described by edit. The layers are not changed.
+// Only OCI and Docker schema2 images are supported.
+//
+// The caller is responsible for storing the returned configuration blob and manifest, e.g. using types.ImageDestination.
+func EditConfig(ctx context.Context, img types.Image, edit ConfigEdit) (*EditedImage, error) {
+	return image.EditConfig(ctx, img, edit)
+}
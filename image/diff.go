@@ -0,0 +1,33 @@
+package image
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/types"
+)
+
+// DiffLayer describes a layer of an image, as reported by Diff.
+type DiffLayer = image.DiffLayer
+
+// LayerChange describes a layer present in both images compared by Diff, with the same contents (DiffID),
+// but a different blob (e.g. due to a different compression).
+type LayerChange = image.LayerChange
+
+// KeyValueChange describes a change of a single environment variable or label.
+type KeyValueChange = image.KeyValueChange
+
+// StringSliceChange describes a change of a list-valued configuration field, like the entrypoint.
+type StringSliceChange = image.StringSliceChange
+
+// ImageDiff is the result of Diff.
+type ImageDiff = image.ImageDiff
+
+// Diff compares oldImg and newImg, which may come from different transports, and reports
+// the differences in their layers (identified by the uncompressed digests, i.e. DiffIDs),
+// in their environment, labels, entrypoint and default arguments, and in their sizes.
+// Only the manifests and configurations are read, not the layers; so, images which don’t record
+// the DiffIDs in their configuration (Docker schema1) are not supported.
+func Diff(ctx context.Context, oldImg, newImg types.Image) (*ImageDiff, error) {
+	return image.Diff(ctx, oldImg, newImg)
+}
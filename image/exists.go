@@ -0,0 +1,21 @@
+package image
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Exists returns true if the image ref refers to exists, and false if it does not.
+// If the image exists, it also returns the descriptor of its manifest, if known; fields of the descriptor
+// which can't be determined cheaply (e.g. MediaType for some transports) may be left empty.
+//
+// This uses the cheapest check available for the transport (e.g. a manifest HEAD request for registries,
+// or an index lookup for OCI layouts and containers-storage), and only reads the manifest if there is no such check.
+// It is more efficient than creating an ImageSource and calling GetManifest, unless the caller is going to use
+// an ImageSource anyway.
+func Exists(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) (bool, *imgspecv1.Descriptor, error) {
+	return image.Exists(ctx, sys, ref)
+}
@@ -0,0 +1,23 @@
+package image
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/types"
+)
+
+// ErrMetadataRequiresLayerAccess is returned by InspectMetadata if the transport can't provide
+// the manifest and config of an image without reading or processing its layers.
+var ErrMetadataRequiresLayerAccess = image.ErrMetadataRequiresLayerAccess
+
+// InspectMetadata returns information about the image at ref, including descriptors of its layers,
+// reading only its manifest and config (never any layers).
+// If ref refers to a manifest list, the instance most appropriate for sys is inspected.
+//
+// If the transport of ref can't read the manifest and config without processing layer data
+// (e.g. oci-archive:, which extracts the whole archive), it fails with an error wrapping ErrMetadataRequiresLayerAccess,
+// without opening the image.
+func InspectMetadata(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) (*types.ImageInspectInfo, error) {
+	return image.InspectMetadata(ctx, sys, ref)
+}
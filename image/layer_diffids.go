@@ -0,0 +1,22 @@
+package image
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/types"
+)
+
+// LayerDiffID pairs the digest of a layer blob with the digest of its uncompressed contents (the “DiffID”).
+type LayerDiffID = image.LayerDiffID
+
+// LayerDiffIDs returns the DiffIDs of the layers of img, in order (the root layer first), without reading the layers.
+// The DiffIDs are primarily read from the image configuration; if it does not record them (e.g. for Docker schema1 images),
+// they are looked up in cache, and left empty if not known.
+// If cache is not nil, DiffIDs read from the configuration are recorded in it, so that later users
+// (possibly of other images sharing the layers) don't need to decompress the layers to compute them.
+//
+// cache is typically obtained using blobinfocache.DefaultCache.
+func LayerDiffIDs(ctx context.Context, img types.Image, cache types.BlobInfoCache) ([]LayerDiffID, error) {
+	return image.LayerDiffIDs(ctx, img, cache)
+}
@@ -0,0 +1,26 @@
+package image
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/types"
+)
+
+// ManifestList is a manifest list (or an image index) read from an ImageSource, which allows enumerating its instances,
+// and reading only the instances the caller is interested in.
+// The list is fetched and parsed only once; images of instances are created on demand, and cached.
+//
+// A ManifestList is not safe for concurrent use.
+type ManifestList = image.ManifestList
+
+// ManifestListFromSource returns a ManifestList for the default instance of src, which must be a manifest list.
+// sys is used for choosing instances in ChooseImage, and for creating the instance images.
+//
+// The ManifestList, and images it returns, must not be used after src is Close()d.
+//
+// NOTE: If any kind of signature verification should happen, verify the manifest list using an UnparsedImage
+// built from src first; the instance images are verified against the digests in the list.
+func ManifestListFromSource(ctx context.Context, sys *types.SystemContext, src types.ImageSource) (*ManifestList, error) {
+	return image.ManifestListFromSource(ctx, sys, src)
+}
@@ -0,0 +1,111 @@
+// Package blobtransfer implements uploading and downloading single blobs, outside of an image copy.
+package blobtransfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/containers/image/v5/internal/blobinfocache"
+	"github.com/containers/image/v5/internal/digests"
+	"github.com/containers/image/v5/internal/private"
+	pkgblobinfocache "github.com/containers/image/v5/pkg/blobinfocache"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// Cache returns cache, or the default cache per sys if cache is nil.
+func Cache(sys *types.SystemContext, cache types.BlobInfoCache) types.BlobInfoCache {
+	if cache == nil {
+		return pkgblobinfocache.DefaultCache(sys)
+	}
+	return cache
+}
+
+// PutBlob uploads stream, which must match info.Digest, to dest, unless dest already contains that blob,
+// possibly after using cache to find it elsewhere in the destination (e.g. in a different repository in the same registry).
+// The contents of stream are verified against info.Digest before the upload is finished.
+// It returns the digest and size of the blob in dest.
+func PutBlob(ctx context.Context, sys *types.SystemContext, dest private.ImageDestination, stream io.Reader, info types.BlobInfo,
+	cache types.BlobInfoCache) (types.BlobInfo, error) {
+	if info.Digest == "" {
+		return types.BlobInfo{}, errors.New("uploading a blob with an unknown digest is not supported")
+	}
+	if err := digests.ValidateAlgorithm(sys, info.Digest.Algorithm()); err != nil {
+		return types.BlobInfo{}, err
+	}
+	bic := blobinfocache.FromBlobInfoCache(Cache(sys, cache))
+
+	reused, reusedBlob, err := dest.TryReusingBlobWithOptions(ctx, info, private.TryReusingBlobOptions{
+		Cache:         bic,
+		CanSubstitute: false,
+	})
+	if err != nil {
+		return types.BlobInfo{}, fmt.Errorf("checking whether blob %s exists: %w", info.Digest, err)
+	}
+	if reused {
+		size := reusedBlob.Size
+		if size == -1 {
+			size = info.Size
+		}
+		return types.BlobInfo{Digest: reusedBlob.Digest, Size: size}, nil
+	}
+
+	verifier, err := NewVerifyingReader(io.NopCloser(stream), info.Digest)
+	if err != nil {
+		return types.BlobInfo{}, err
+	}
+	uploaded, err := dest.PutBlobWithOptions(ctx, verifier, info, private.PutBlobOptions{
+		Cache:    bic,
+		IsConfig: false,
+	})
+	if err != nil {
+		return types.BlobInfo{}, fmt.Errorf("uploading blob %s: %w", info.Digest, err)
+	}
+	if uploaded.Digest != info.Digest {
+		return types.BlobInfo{}, fmt.Errorf("internal error: uploaded blob %s, expected %s", uploaded.Digest, info.Digest)
+	}
+	return types.BlobInfo{Digest: uploaded.Digest, Size: uploaded.Size}, nil
+}
+
+// verifyingReader is an io.ReadCloser which fails at EOF if the contents of the source do not match expectedDigest.
+type verifyingReader struct {
+	source         io.ReadCloser
+	hash           hash.Hash
+	digester       digest.Digester
+	expectedDigest digest.Digest
+}
+
+// NewVerifyingReader returns an io.ReadCloser with the contents of source, which returns an error instead of io.EOF
+// if the contents do not match expectedDigest. Closing it closes source.
+func NewVerifyingReader(source io.ReadCloser, expectedDigest digest.Digest) (io.ReadCloser, error) {
+	if err := expectedDigest.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid digest %q: %w", expectedDigest, err)
+	}
+	digester := expectedDigest.Algorithm().Digester()
+	return &verifyingReader{
+		source:         source,
+		hash:           digester.Hash(),
+		digester:       digester,
+		expectedDigest: expectedDigest,
+	}, nil
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.source.Read(p)
+	if n > 0 {
+		r.hash.Write(p[:n]) // Never fails
+	}
+	if err == io.EOF {
+		if actualDigest := r.digester.Digest(); actualDigest != r.expectedDigest {
+			return 0, fmt.Errorf("digest did not match, expected %s, got %s", r.expectedDigest, actualDigest)
+		}
+	}
+	return n, err
+}
+
+func (r *verifyingReader) Close() error {
+	return r.source.Close()
+}
@@ -0,0 +1,32 @@
+package blobtransfer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyingReader(t *testing.T) {
+	blob := []byte("blob contents")
+
+	r, err := NewVerifyingReader(io.NopCloser(bytes.NewReader(blob)), digest.FromBytes(blob))
+	require.NoError(t, err)
+	contents, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, blob, contents)
+	assert.NoError(t, r.Close())
+
+	r, err = NewVerifyingReader(io.NopCloser(bytes.NewReader(blob)), digest.FromString("something else"))
+	require.NoError(t, err)
+	_, err = io.ReadAll(r)
+	assert.Error(t, err)
+
+	for _, d := range []digest.Digest{"", "sha256:invalid", "unknown:0123"} {
+		_, err := NewVerifyingReader(io.NopCloser(bytes.NewReader(blob)), d)
+		assert.Error(t, err, d)
+	}
+}
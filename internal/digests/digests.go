@@ -0,0 +1,81 @@
+// Package digests implements the digest algorithm policy configured in types.SystemContext.
+package digests
+
+import (
+	_ "crypto/sha256" // Ensure the algorithms we accept are available.
+	_ "crypto/sha512"
+	"fmt"
+
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/exp/slices"
+)
+
+// defaultAccepted are the algorithms accepted if SystemContext.AcceptedDigestAlgorithms is not set.
+var defaultAccepted = []digest.Algorithm{digest.SHA256, digest.SHA384, digest.SHA512}
+
+// fipsApproved are the algorithms approved for FIPS 140.
+var fipsApproved = []digest.Algorithm{digest.SHA256, digest.SHA384, digest.SHA512}
+
+// Algorithm returns the algorithm to use for newly computed blob digests, per sys.
+func Algorithm(sys *types.SystemContext) digest.Algorithm {
+	if sys != nil && sys.DigestAlgorithm != "" {
+		return sys.DigestAlgorithm
+	}
+	return digest.Canonical
+}
+
+// Accepted returns the algorithms accepted for blobs read from a source, per sys.
+func Accepted(sys *types.SystemContext) []digest.Algorithm {
+	accepted := defaultAccepted
+	if sys != nil && sys.AcceptedDigestAlgorithms != nil {
+		accepted = sys.AcceptedDigestAlgorithms
+	}
+	if sys != nil && sys.TLSFIPSMode {
+		res := []digest.Algorithm{}
+		for _, a := range accepted {
+			if slices.Contains(fipsApproved, a) {
+				res = append(res, a)
+			}
+		}
+		accepted = res
+	}
+	return accepted
+}
+
+// ValidateAlgorithm returns an error if algorithm is not accepted for blobs read from a source, per sys.
+func ValidateAlgorithm(sys *types.SystemContext, algorithm digest.Algorithm) error {
+	if !algorithm.Available() {
+		return fmt.Errorf("unsupported digest algorithm %q", algorithm)
+	}
+	if !slices.Contains(Accepted(sys), algorithm) {
+		return fmt.Errorf("digest algorithm %q is not accepted by policy", algorithm)
+	}
+	return nil
+}
+
+// ValidatePolicy returns an error if the digest algorithm settings in sys are invalid.
+func ValidatePolicy(sys *types.SystemContext) error {
+	if sys == nil {
+		return nil
+	}
+	if sys.DigestAlgorithm != "" {
+		if !slices.Contains(defaultAccepted, sys.DigestAlgorithm) || !sys.DigestAlgorithm.Available() {
+			return fmt.Errorf("unsupported DigestAlgorithm %q", sys.DigestAlgorithm)
+		}
+		if sys.TLSFIPSMode && !slices.Contains(fipsApproved, sys.DigestAlgorithm) {
+			return fmt.Errorf("DigestAlgorithm %q is not approved for FIPS 140", sys.DigestAlgorithm)
+		}
+	}
+	if sys.AcceptedDigestAlgorithms != nil {
+		if len(Accepted(sys)) == 0 {
+			return fmt.Errorf("AcceptedDigestAlgorithms %v does not allow any usable algorithm", sys.AcceptedDigestAlgorithms)
+		}
+		for _, a := range sys.AcceptedDigestAlgorithms {
+			if !a.Available() {
+				return fmt.Errorf("unsupported digest algorithm %q in AcceptedDigestAlgorithms", a)
+			}
+		}
+	}
+	return nil
+}
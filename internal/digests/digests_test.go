@@ -0,0 +1,59 @@
+package digests
+
+import (
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAlgorithm(t *testing.T) {
+	assert.Equal(t, digest.SHA256, Algorithm(nil))
+	assert.Equal(t, digest.SHA256, Algorithm(&types.SystemContext{}))
+	assert.Equal(t, digest.SHA512, Algorithm(&types.SystemContext{DigestAlgorithm: digest.SHA512}))
+}
+
+func TestValidateAlgorithm(t *testing.T) {
+	for _, c := range []struct {
+		sys       *types.SystemContext
+		algorithm digest.Algorithm
+		ok        bool
+	}{
+		{nil, digest.SHA256, true},
+		{nil, digest.SHA384, true},
+		{nil, digest.SHA512, true},
+		{nil, "crc32", false},
+		{nil, "", false},
+		{&types.SystemContext{AcceptedDigestAlgorithms: []digest.Algorithm{digest.SHA512}}, digest.SHA512, true},
+		{&types.SystemContext{AcceptedDigestAlgorithms: []digest.Algorithm{digest.SHA512}}, digest.SHA256, false},
+		{&types.SystemContext{TLSFIPSMode: true}, digest.SHA256, true},
+		{&types.SystemContext{TLSFIPSMode: true}, digest.SHA512, true},
+	} {
+		err := ValidateAlgorithm(c.sys, c.algorithm)
+		if c.ok {
+			assert.NoError(t, err, c.algorithm)
+		} else {
+			assert.Error(t, err, c.algorithm)
+		}
+	}
+}
+
+func TestValidatePolicy(t *testing.T) {
+	for _, sys := range []*types.SystemContext{
+		nil,
+		{},
+		{DigestAlgorithm: digest.SHA384},
+		{DigestAlgorithm: digest.SHA512, TLSFIPSMode: true},
+		{AcceptedDigestAlgorithms: []digest.Algorithm{digest.SHA256, digest.SHA512}},
+	} {
+		assert.NoError(t, ValidatePolicy(sys))
+	}
+	for _, sys := range []*types.SystemContext{
+		{DigestAlgorithm: "md5"},
+		{AcceptedDigestAlgorithms: []digest.Algorithm{}},
+		{AcceptedDigestAlgorithms: []digest.Algorithm{digest.SHA256, "crc32"}},
+	} {
+		assert.Error(t, ValidatePolicy(sys))
+	}
+}
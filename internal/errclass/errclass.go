@@ -0,0 +1,70 @@
+// Package errclass allows classifying errors as one or more of the sentinel values in types (e.g. types.ErrNotFound),
+// without changing their text or hiding their underlying types from errors.As.
+package errclass
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/containers/image/v5/types"
+)
+
+// classifiedError is err, classified as kinds.
+type classifiedError struct {
+	err   error
+	kinds []error
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+// Is allows errors.Is(e, kind) to succeed for all kinds e has been classified as.
+func (e *classifiedError) Is(target error) bool {
+	for _, kind := range e.kinds {
+		if target == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Wrap returns an error with the same text as err, which is also classified as all of kinds (via errors.Is).
+// types.ErrBlobUnknown automatically implies types.ErrNotFound.
+// If err is nil, or there are no kinds to add, Wrap returns err unmodified.
+func Wrap(err error, kinds ...error) error {
+	if err == nil {
+		return nil
+	}
+	newKinds := make([]error, 0, len(kinds)+1)
+	for _, kind := range kinds {
+		if !errors.Is(err, kind) {
+			newKinds = append(newKinds, kind)
+		}
+		if kind == types.ErrBlobUnknown && !errors.Is(err, types.ErrNotFound) {
+			newKinds = append(newKinds, types.ErrNotFound)
+		}
+	}
+	if len(newKinds) == 0 {
+		return err
+	}
+	return &classifiedError{err: err, kinds: newKinds}
+}
+
+// HTTPStatusKinds returns the kinds an error caused by a HTTP response with statusCode should be classified as.
+func HTTPStatusKinds(statusCode int) []error {
+	switch statusCode {
+	case http.StatusNotFound:
+		return []error{types.ErrNotFound}
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return []error{types.ErrUnauthorized}
+	case http.StatusTooManyRequests:
+		return []error{types.ErrTooManyRequests}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,37 @@
+package errclass
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrap(t *testing.T) {
+	assert.NoError(t, Wrap(nil, types.ErrNotFound))
+
+	base := fmt.Errorf("opening blob: %w", os.ErrNotExist)
+	err := Wrap(base, types.ErrBlobUnknown)
+	assert.Equal(t, base.Error(), err.Error())
+	assert.ErrorIs(t, err, types.ErrBlobUnknown)
+	assert.ErrorIs(t, err, types.ErrNotFound)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.NotErrorIs(t, err, types.ErrUnauthorized)
+
+	// Wrapping again is visible through further wrapping
+	wrapped := fmt.Errorf("copying: %w", Wrap(err, types.ErrNotFound, types.ErrUnauthorized))
+	assert.ErrorIs(t, wrapped, types.ErrBlobUnknown)
+	assert.ErrorIs(t, wrapped, types.ErrUnauthorized)
+
+	// No new kinds
+	assert.Same(t, err, Wrap(err, types.ErrNotFound))
+	assert.Equal(t, base, Wrap(base))
+
+	// Classified sentinels remain usable with errors.Is
+	sentinel := Wrap(errors.New("too many requests to registry"), types.ErrTooManyRequests)
+	assert.ErrorIs(t, fmt.Errorf("x: %w", sentinel), sentinel)
+	assert.ErrorIs(t, sentinel, types.ErrTooManyRequests)
+}
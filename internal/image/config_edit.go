@@ -0,0 +1,197 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/exp/slices"
+)
+
+// ConfigEdit describes changes to the runtime configuration of an image, for EditConfig.
+// The zero value does not change anything.
+// This is publicly visible as c/image/image.ConfigEdit.
+type ConfigEdit struct {
+	SetLabels    map[string]string // Labels to add, or to replace if they already exist.
+	RemoveLabels []string          // Labels to remove, if they exist. This is applied before SetLabels.
+	Env          []string          // If not nil, replaces the environment variables, in the VARNAME=VARVALUE format.
+	Entrypoint   []string          // If not nil, replaces the entrypoint; an empty slice removes it.
+	Cmd          []string          // If not nil, replaces the default arguments to the entrypoint; an empty slice removes them.
+	ExposedPorts []string          // If not nil, replaces the exposed ports, in the port/protocol format, e.g. "8080/tcp".
+	User         *string           // If not nil, replaces the user (and possibly group) the image runs as.
+}
+
+// EditedImage is the result of EditConfig.
+// This is publicly visible as c/image/image.EditedImage.
+type EditedImage struct {
+	Manifest         []byte // The updated manifest, referring to Config, and to the original layers.
+	ManifestMIMEType string
+	ManifestDigest   digest.Digest
+	Config           []byte // The updated image configuration, which must be stored along with the manifest.
+	ConfigDigest     digest.Digest
+}
+
+// EditConfig returns a manifest and a configuration for img, which must be a single image (not a manifest list),
+// with the runtime configuration changed as described by edit. The layers are not changed.
+// Fields of the configuration which are not affected by edit, including fields not defined
+// in the OCI image specification, are preserved.
+// Only OCI and Docker schema2 images are supported.
+// This is publicly visible as c/image/image.EditConfig.
+func EditConfig(ctx context.Context, img types.Image, edit ConfigEdit) (*EditedImage, error) {
+	manifestBlob, mimeType, err := img.Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mimeType = manifest.NormalizedMIMEType(mimeType)
+	var setConfigDescriptor func(m manifest.Manifest, configDigest digest.Digest, size int64)
+	switch mimeType {
+	case imgspecv1.MediaTypeImageManifest:
+		setConfigDescriptor = func(m manifest.Manifest, configDigest digest.Digest, size int64) {
+			ociManifest := m.(*manifest.OCI1)
+			ociManifest.Config.Digest = configDigest
+			ociManifest.Config.Size = size
+		}
+	case manifest.DockerV2Schema2MediaType:
+		setConfigDescriptor = func(m manifest.Manifest, configDigest digest.Digest, size int64) {
+			schema2Manifest := m.(*manifest.Schema2)
+			schema2Manifest.ConfigDescriptor.Digest = configDigest
+			schema2Manifest.ConfigDescriptor.Size = size
+		}
+	default:
+		return nil, fmt.Errorf("editing the configuration of images with manifest type %q is not supported", mimeType)
+	}
+	m, err := manifest.FromBlob(manifestBlob, mimeType)
+	if err != nil {
+		return nil, err
+	}
+
+	originalConfig, err := img.ConfigBlob(ctx)
+	if err != nil {
+		return nil, err
+	}
+	config, err := editConfigBlob(originalConfig, edit)
+	if err != nil {
+		return nil, err
+	}
+	configDigest := digest.FromBytes(config)
+	setConfigDescriptor(m, configDigest, int64(len(config)))
+	updatedManifest, err := m.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	manifestDigest, err := manifest.Digest(updatedManifest)
+	if err != nil {
+		return nil, err
+	}
+	return &EditedImage{
+		Manifest:         updatedManifest,
+		ManifestMIMEType: mimeType,
+		ManifestDigest:   manifestDigest,
+		Config:           config,
+		ConfigDigest:     configDigest,
+	}, nil
+}
+
+// editConfigBlob returns configBlob, an OCI or Docker schema2 image configuration, modified as described by edit.
+// Unrecognized fields of configBlob are preserved.
+func editConfigBlob(configBlob []byte, edit ConfigEdit) ([]byte, error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(configBlob, &top); err != nil {
+		return nil, fmt.Errorf("parsing image configuration: %w", err)
+	}
+	if top == nil {
+		return nil, errors.New("parsing image configuration: not a JSON object")
+	}
+	runtimeConfig := map[string]json.RawMessage{}
+	if raw, ok := top["config"]; ok {
+		if err := json.Unmarshal(raw, &runtimeConfig); err != nil {
+			return nil, fmt.Errorf("parsing runtime configuration: %w", err)
+		}
+		if runtimeConfig == nil { // "config": null
+			runtimeConfig = map[string]json.RawMessage{}
+		}
+	}
+
+	set := func(key string, value any) error {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("encoding %s: %w", key, err)
+		}
+		runtimeConfig[key] = raw
+		return nil
+	}
+	if len(edit.RemoveLabels) != 0 || len(edit.SetLabels) != 0 {
+		labels := map[string]string{}
+		if raw, ok := runtimeConfig["Labels"]; ok {
+			if err := json.Unmarshal(raw, &labels); err != nil {
+				return nil, fmt.Errorf("parsing labels: %w", err)
+			}
+			if labels == nil {
+				labels = map[string]string{}
+			}
+		}
+		for _, label := range edit.RemoveLabels {
+			delete(labels, label)
+		}
+		for label, value := range edit.SetLabels {
+			labels[label] = value
+		}
+		if err := set("Labels", labels); err != nil {
+			return nil, err
+		}
+	}
+	for _, field := range []struct {
+		key   string
+		value []string
+	}{
+		{"Env", edit.Env},
+		{"Entrypoint", edit.Entrypoint},
+		{"Cmd", edit.Cmd},
+	} {
+		if field.value == nil {
+			continue
+		}
+		if len(field.value) == 0 {
+			delete(runtimeConfig, field.key)
+			continue
+		}
+		if err := set(field.key, slices.Clone(field.value)); err != nil {
+			return nil, err
+		}
+	}
+	if edit.ExposedPorts != nil {
+		ports := map[string]struct{}{}
+		for _, port := range edit.ExposedPorts {
+			ports[port] = struct{}{}
+		}
+		if err := set("ExposedPorts", ports); err != nil {
+			return nil, err
+		}
+	}
+	if edit.User != nil {
+		if err := set("User", *edit.User); err != nil {
+			return nil, err
+		}
+	}
+
+	rawRuntimeConfig, err := json.Marshal(runtimeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("encoding runtime configuration: %w", err)
+	}
+	top["config"] = rawRuntimeConfig
+	res, err := json.Marshal(top)
+	if err != nil {
+		return nil, fmt.Errorf("encoding image configuration: %w", err)
+	}
+	// Make sure the result is still a valid configuration.
+	var parsed imgspecv1.Image
+	if err := json.Unmarshal(res, &parsed); err != nil {
+		return nil, fmt.Errorf("validating edited image configuration: %w", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,94 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEditConfig(t *testing.T) {
+	user := "nobody:nobody"
+	edit := ConfigEdit{
+		SetLabels:    map[string]string{"org.example.new": "value"},
+		RemoveLabels: []string{"does-not-exist"},
+		Env:          []string{"A=B"},
+		Entrypoint:   []string{"/bin/sh", "-c"},
+		Cmd:          []string{},
+		ExposedPorts: []string{"8080/tcp", "53/udp"},
+		User:         &user,
+	}
+
+	for _, c := range []struct {
+		name     string
+		img      types.Image
+		mimeType string
+	}{
+		{
+			name:     "OCI",
+			img:      memoryImageFromManifest(manifestOCI1FromFixture(t, newOCI1ImageSource(t, "oci1-config.json", "httpd:latest"), "oci1.json")),
+			mimeType: imgspecv1.MediaTypeImageManifest,
+		},
+		{
+			name:     "schema2",
+			img:      memoryImageFromManifest(manifestSchema2FromFixture(t, newSchema2ImageSource(t, "httpd:latest"), "schema2.json", false)),
+			mimeType: manifest.DockerV2Schema2MediaType,
+		},
+	} {
+		originalManifest, _, err := c.img.Manifest(context.Background())
+		require.NoError(t, err, c.name)
+		originalConfig, err := c.img.OCIConfig(context.Background())
+		require.NoError(t, err, c.name)
+
+		res, err := EditConfig(context.Background(), c.img, edit)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, c.mimeType, res.ManifestMIMEType, c.name)
+		assert.Equal(t, digest.FromBytes(res.Config), res.ConfigDigest, c.name)
+		assert.Equal(t, digest.FromBytes(res.Manifest), res.ManifestDigest, c.name)
+
+		m, err := manifest.FromBlob(res.Manifest, res.ManifestMIMEType)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, res.ConfigDigest, m.ConfigInfo().Digest, c.name)
+		assert.Equal(t, int64(len(res.Config)), m.ConfigInfo().Size, c.name)
+		origM, err := manifest.FromBlob(originalManifest, c.mimeType)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, origM.LayerInfos(), m.LayerInfos(), c.name)
+
+		var config imgspecv1.Image
+		err = json.Unmarshal(res.Config, &config)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, "value", config.Config.Labels["org.example.new"], c.name)
+		assert.Equal(t, []string{"A=B"}, config.Config.Env, c.name)
+		assert.Equal(t, []string{"/bin/sh", "-c"}, config.Config.Entrypoint, c.name)
+		assert.Nil(t, config.Config.Cmd, c.name)
+		assert.Equal(t, map[string]struct{}{"8080/tcp": {}, "53/udp": {}}, config.Config.ExposedPorts, c.name)
+		assert.Equal(t, user, config.Config.User, c.name)
+		assert.Equal(t, originalConfig.RootFS, config.RootFS, c.name)
+		assert.Equal(t, originalConfig.History, config.History, c.name)
+		assert.Equal(t, originalConfig.Config.WorkingDir, config.Config.WorkingDir, c.name)
+	}
+
+	// Fields not defined in the OCI specification are preserved
+	src := newOCI1ImageSource(t, "oci1-config-extra-fields.json", "httpd:latest")
+	img := memoryImageFromManifest(manifestOCI1FromComponents(imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageConfig,
+		Digest:    src.expectedDigest,
+	}, src, nil, layerDescriptorsLikeFixture))
+	res, err := EditConfig(context.Background(), img, ConfigEdit{User: &user})
+	require.NoError(t, err)
+	var raw map[string]any
+	err = json.Unmarshal(res.Config, &raw)
+	require.NoError(t, err)
+	assert.Equal(t, "string", raw["extra-string-field"])
+	assert.Equal(t, map[string]any{"foo": "bar"}, raw["extra-object"])
+
+	// Schema1 is not supported
+	_, err = EditConfig(context.Background(), memoryImageFromManifest(manifestSchema1FromFixture(t, "schema1.json")), edit)
+	assert.Error(t, err)
+}
@@ -0,0 +1,138 @@
+package image
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+var (
+	// knownConfigFields and knownRuntimeConfigFields contain lower-cased names of fields defined by the OCI or Docker schema2
+	// formats, for the top-level configuration object and for the nested "config" object, respectively.
+	// (encoding/json matches field names case-insensitively.)
+	knownConfigFields        = jsonFieldNames(reflect.TypeOf(imgspecv1.Image{}), reflect.TypeOf(manifest.Schema2Image{}))
+	knownRuntimeConfigFields = jsonFieldNames(reflect.TypeOf(imgspecv1.ImageConfig{}), reflect.TypeOf(manifest.Schema2Config{}))
+)
+
+// jsonFieldNames returns lower-cased names of JSON fields of the struct types.
+func jsonFieldNames(types ...reflect.Type) *set.Set[string] {
+	res := set.New[string]()
+	for _, t := range types {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			name, _, _ := strings.Cut(tag, ",")
+			switch {
+			case name == "-":
+				continue
+			case name == "" && field.Anonymous && field.Type.Kind() == reflect.Struct:
+				res.AddSlice(jsonFieldNames(field.Type).Values())
+				continue
+			case name == "":
+				name = field.Name
+			}
+			res.Add(strings.ToLower(name))
+		}
+	}
+	return res
+}
+
+// unknownConfigFields returns the fields of configBlob not defined by the OCI or Docker schema2 formats:
+// top-level fields, and fields of the nested "config" object.
+func unknownConfigFields(configBlob []byte) (map[string]json.RawMessage, map[string]json.RawMessage, error) {
+	var top map[string]json.RawMessage
+	if err := json.Unmarshal(configBlob, &top); err != nil {
+		return nil, nil, fmt.Errorf("parsing image configuration: %w", err)
+	}
+	unknownTop := map[string]json.RawMessage{}
+	for k, v := range top {
+		if !knownConfigFields.Contains(strings.ToLower(k)) {
+			unknownTop[k] = v
+		}
+	}
+	unknownRuntime := map[string]json.RawMessage{}
+	if raw, ok := top["config"]; ok {
+		var runtimeConfig map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &runtimeConfig); err != nil {
+			return nil, nil, fmt.Errorf("parsing runtime configuration: %w", err)
+		}
+		for k, v := range runtimeConfig {
+			if !knownRuntimeConfigFields.Contains(strings.ToLower(k)) {
+				unknownRuntime[k] = v
+			}
+		}
+	}
+	return unknownTop, unknownRuntime, nil
+}
+
+// applyConfigStrictness returns rebuilt, a configuration rebuilt from original, handling fields of original
+// not defined by the OCI or Docker schema2 formats as specified by strictness.
+func applyConfigStrictness(original, rebuilt []byte, strictness types.ConfigStrictness) ([]byte, error) {
+	switch strictness {
+	case types.ConfigStrictnessDropUnknownFields:
+		return rebuilt, nil
+	case types.ConfigStrictnessPreserveUnknownFields, types.ConfigStrictnessRejectUnknownFields:
+	default:
+		return nil, fmt.Errorf("unknown image configuration strictness %d", strictness)
+	}
+	unknownTop, unknownRuntime, err := unknownConfigFields(original)
+	if err != nil {
+		return nil, err
+	}
+	if len(unknownTop) == 0 && len(unknownRuntime) == 0 {
+		return rebuilt, nil
+	}
+
+	switch strictness {
+	case types.ConfigStrictnessRejectUnknownFields:
+		names := []string{}
+		for k := range unknownTop {
+			names = append(names, k)
+		}
+		for k := range unknownRuntime {
+			names = append(names, "config."+k)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("image configuration contains fields which would be lost when rebuilding it: %s", strings.Join(names, ", "))
+
+	case types.ConfigStrictnessPreserveUnknownFields:
+		var top map[string]json.RawMessage
+		if err := json.Unmarshal(rebuilt, &top); err != nil {
+			return nil, fmt.Errorf("parsing rebuilt image configuration: %w", err)
+		}
+		for k, v := range unknownTop {
+			top[k] = v
+		}
+		if len(unknownRuntime) != 0 {
+			runtimeConfig := map[string]json.RawMessage{}
+			if raw, ok := top["config"]; ok {
+				if err := json.Unmarshal(raw, &runtimeConfig); err != nil {
+					return nil, fmt.Errorf("parsing rebuilt runtime configuration: %w", err)
+				}
+			}
+			for k, v := range unknownRuntime {
+				runtimeConfig[k] = v
+			}
+			raw, err := json.Marshal(runtimeConfig)
+			if err != nil {
+				return nil, fmt.Errorf("encoding runtime configuration: %w", err)
+			}
+			top["config"] = raw
+		}
+		res, err := json.Marshal(top)
+		if err != nil {
+			return nil, fmt.Errorf("encoding image configuration: %w", err)
+		}
+		return res, nil
+
+	default: // This should not be reachable, we have checked strictness above.
+		return nil, fmt.Errorf("internal error: unexpected image configuration strictness %d", strictness)
+	}
+}
@@ -0,0 +1,201 @@
+package image
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/exp/slices"
+)
+
+// DiffLayer describes a layer of an image, as reported by Diff.
+// This is publicly visible as c/image/image.DiffLayer.
+type DiffLayer struct {
+	DiffID digest.Digest // The digest of the uncompressed layer contents.
+	Digest digest.Digest // The digest of the layer blob, as referenced by the manifest.
+	Size   int64         // The size of the layer blob, or -1 if unknown.
+}
+
+// LayerChange describes a layer present in both images compared by Diff, with the same contents (DiffID),
+// but a different blob (e.g. due to a different compression).
+// This is publicly visible as c/image/image.LayerChange.
+type LayerChange struct {
+	Old, New DiffLayer
+}
+
+// KeyValueChange describes a change of a single environment variable or label.
+// This is publicly visible as c/image/image.KeyValueChange.
+type KeyValueChange struct {
+	Key      string
+	OldValue *string // nil if the key is not present in the old image.
+	NewValue *string // nil if the key is not present in the new image.
+}
+
+// StringSliceChange describes a change of a list-valued configuration field, like the entrypoint.
+// This is publicly visible as c/image/image.StringSliceChange.
+type StringSliceChange struct {
+	Old, New []string
+}
+
+// ImageDiff is the result of Diff.
+// This is publicly visible as c/image/image.ImageDiff.
+type ImageDiff struct {
+	AddedLayers   []DiffLayer   // Layers of the new image with contents not present in the old image, in order.
+	RemovedLayers []DiffLayer   // Layers of the old image with contents not present in the new image, in order.
+	ChangedLayers []LayerChange // Layers with the same contents, but a different blob.
+
+	Env        []KeyValueChange   // Changed environment variables, sorted by name.
+	Labels     []KeyValueChange   // Changed labels, sorted by name.
+	Entrypoint *StringSliceChange // nil if the entrypoint is unchanged.
+	Cmd        *StringSliceChange // nil if the default arguments are unchanged.
+
+	// OldSize and NewSize are the total sizes of the config and layer blobs of the images, or -1 if unknown.
+	OldSize, NewSize int64
+	// SizeDelta is NewSize - OldSize, valid only if both sizes are known.
+	SizeDelta int64
+}
+
+// diffImageData contains the data of a single image relevant to Diff.
+type diffImageData struct {
+	layers []DiffLayer
+	config *imgspecv1.Image
+	size   int64
+}
+
+// diffImageDataFromImage collects data for Diff from img.
+func diffImageDataFromImage(ctx context.Context, img types.Image) (*diffImageData, error) {
+	config, err := img.OCIConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res := diffImageData{config: config}
+	configInfo := img.ConfigInfo()
+	res.size = configInfo.Size
+	if configInfo.Digest == "" { // No separate config blob, e.g. in schema1
+		res.size = 0
+	}
+	layers := img.LayerInfos()
+	diffIDs := config.RootFS.DiffIDs
+	if len(diffIDs) != len(layers) {
+		// This also happens with schema1 images, where the DiffIDs are not known without reading the layers.
+		return nil, fmt.Errorf("image configuration records %d layer digests, but the manifest has %d layers", len(diffIDs), len(layers))
+	}
+	for i, layer := range layers {
+		if res.size != -1 {
+			if layer.Size < 0 {
+				res.size = -1
+			} else {
+				res.size += layer.Size
+			}
+		}
+		res.layers = append(res.layers, DiffLayer{DiffID: diffIDs[i], Digest: layer.Digest, Size: layer.Size})
+	}
+	return &res, nil
+}
+
+// Diff compares oldImg and newImg, which may come from different transports, and reports
+// the differences in their layers (identified by the uncompressed digests, i.e. DiffIDs),
+// in selected fields of their configuration, and in their sizes.
+// Only the manifests and configurations are read, not the layers; so, images which don’t record
+// the DiffIDs in their configuration (Docker schema1) are not supported.
+// This is publicly visible as c/image/image.Diff.
+func Diff(ctx context.Context, oldImg, newImg types.Image) (*ImageDiff, error) {
+	oldData, err := diffImageDataFromImage(ctx, oldImg)
+	if err != nil {
+		return nil, fmt.Errorf("reading the old image: %w", err)
+	}
+	newData, err := diffImageDataFromImage(ctx, newImg)
+	if err != nil {
+		return nil, fmt.Errorf("reading the new image: %w", err)
+	}
+
+	res := ImageDiff{
+		AddedLayers:   []DiffLayer{},
+		RemovedLayers: []DiffLayer{},
+		ChangedLayers: []LayerChange{},
+		OldSize:       oldData.size,
+		NewSize:       newData.size,
+	}
+	// Match layers with the same DiffID; if a DiffID is present multiple times, match occurrences in order.
+	unmatchedNew := map[digest.Digest][]DiffLayer{}
+	for _, layer := range newData.layers {
+		unmatchedNew[layer.DiffID] = append(unmatchedNew[layer.DiffID], layer)
+	}
+	matchedNew := map[digest.Digest]int{}
+	for _, oldLayer := range oldData.layers {
+		candidates := unmatchedNew[oldLayer.DiffID]
+		if len(candidates) == 0 {
+			res.RemovedLayers = append(res.RemovedLayers, oldLayer)
+			continue
+		}
+		newLayer := candidates[0]
+		unmatchedNew[oldLayer.DiffID] = candidates[1:]
+		matchedNew[oldLayer.DiffID]++
+		if newLayer.Digest != oldLayer.Digest || newLayer.Size != oldLayer.Size {
+			res.ChangedLayers = append(res.ChangedLayers, LayerChange{Old: oldLayer, New: newLayer})
+		}
+	}
+	for _, layer := range newData.layers {
+		if matchedNew[layer.DiffID] > 0 {
+			matchedNew[layer.DiffID]--
+			continue
+		}
+		res.AddedLayers = append(res.AddedLayers, layer)
+	}
+
+	res.Env = diffKeyValues(envToMap(oldData.config.Config.Env), envToMap(newData.config.Config.Env))
+	res.Labels = diffKeyValues(oldData.config.Config.Labels, newData.config.Config.Labels)
+	res.Entrypoint = diffStringSlices(oldData.config.Config.Entrypoint, newData.config.Config.Entrypoint)
+	res.Cmd = diffStringSlices(oldData.config.Config.Cmd, newData.config.Config.Cmd)
+
+	if res.OldSize != -1 && res.NewSize != -1 {
+		res.SizeDelta = res.NewSize - res.OldSize
+	}
+	return &res, nil
+}
+
+// envToMap converts env, in the VARNAME=VARVALUE format, to a map.
+func envToMap(env []string) map[string]string {
+	res := map[string]string{}
+	for _, e := range env {
+		name, value, _ := strings.Cut(e, "=")
+		res[name] = value
+	}
+	return res
+}
+
+// diffKeyValues returns the differences between oldValues and newValues, sorted by key.
+func diffKeyValues(oldValues, newValues map[string]string) []KeyValueChange {
+	res := []KeyValueChange{}
+	for key, oldValue := range oldValues {
+		oldValue := oldValue
+		if newValue, ok := newValues[key]; !ok {
+			res = append(res, KeyValueChange{Key: key, OldValue: &oldValue})
+		} else if newValue != oldValue {
+			res = append(res, KeyValueChange{Key: key, OldValue: &oldValue, NewValue: &newValue})
+		}
+	}
+	for key, newValue := range newValues {
+		newValue := newValue
+		if _, ok := oldValues[key]; !ok {
+			res = append(res, KeyValueChange{Key: key, NewValue: &newValue})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Key < res[j].Key
+	})
+	return res
+}
+
+// diffStringSlices returns a StringSliceChange if oldValue and newValue differ, or nil.
+// An empty slice is considered equal to a nil one.
+func diffStringSlices(oldValue, newValue []string) *StringSliceChange {
+	if slices.Equal(oldValue, newValue) {
+		return nil
+	}
+	return &StringSliceChange{Old: slices.Clone(oldValue), New: slices.Clone(newValue)}
+}
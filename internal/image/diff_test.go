@@ -0,0 +1,112 @@
+package image
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// diffTestImage returns an OCI image with config and layers.
+func diffTestImage(t *testing.T, config imgspecv1.Image, layers []imgspecv1.Descriptor) types.Image {
+	configBlob, err := json.Marshal(config)
+	require.NoError(t, err)
+	return memoryImageFromManifest(manifestOCI1FromComponents(imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageConfig,
+		Digest:    digest.FromBytes(configBlob),
+		Size:      int64(len(configBlob)),
+	}, nil, configBlob, layers))
+}
+
+func TestDiff(t *testing.T) {
+	const (
+		diffID1 = digest.Digest("sha256:1111111111111111111111111111111111111111111111111111111111111111")
+		diffID2 = digest.Digest("sha256:2222222222222222222222222222222222222222222222222222222222222222")
+		diffID3 = digest.Digest("sha256:3333333333333333333333333333333333333333333333333333333333333333")
+		diffID4 = digest.Digest("sha256:4444444444444444444444444444444444444444444444444444444444444444")
+	)
+	layers := layerDescriptorsLikeFixture[:3]
+	oldImg := diffTestImage(t, imgspecv1.Image{
+		Config: imgspecv1.ImageConfig{
+			Env:        []string{"PATH=/bin", "REMOVED=1", "CHANGED=old"},
+			Labels:     map[string]string{"unchanged": "1", "removed": "1"},
+			Entrypoint: []string{"/bin/sh"},
+			Cmd:        []string{"-c", "true"},
+		},
+		RootFS: imgspecv1.RootFS{Type: "layers", DiffIDs: []digest.Digest{diffID1, diffID2, diffID3}},
+	}, layers)
+
+	// Comparing an image with itself
+	res, err := Diff(context.Background(), oldImg, oldImg)
+	require.NoError(t, err)
+	assert.Equal(t, &ImageDiff{
+		AddedLayers:   []DiffLayer{},
+		RemovedLayers: []DiffLayer{},
+		ChangedLayers: []LayerChange{},
+		Env:           []KeyValueChange{},
+		Labels:        []KeyValueChange{},
+		OldSize:       res.OldSize,
+		NewSize:       res.OldSize,
+	}, res)
+	assert.NotEqual(t, int64(-1), res.OldSize)
+
+	// Various changes
+	recompressed := layers[0]
+	recompressed.Digest = "sha256:5555555555555555555555555555555555555555555555555555555555555555"
+	recompressed.Size = 100
+	added := layers[2]
+	added.Digest = "sha256:6666666666666666666666666666666666666666666666666666666666666666"
+	added.Size = 200
+	newImg := diffTestImage(t, imgspecv1.Image{
+		Config: imgspecv1.ImageConfig{
+			Env:        []string{"PATH=/bin", "CHANGED=new", "ADDED"},
+			Labels:     map[string]string{"unchanged": "1", "added": "2"},
+			Entrypoint: []string{"/bin/sh"},
+		},
+		RootFS: imgspecv1.RootFS{Type: "layers", DiffIDs: []digest.Digest{diffID1, diffID3, diffID4}},
+	}, []imgspecv1.Descriptor{recompressed, layers[2], added})
+	res, err = Diff(context.Background(), oldImg, newImg)
+	require.NoError(t, err)
+	assert.Equal(t, []DiffLayer{{DiffID: diffID4, Digest: added.Digest, Size: added.Size}}, res.AddedLayers)
+	assert.Equal(t, []DiffLayer{{DiffID: diffID2, Digest: layers[1].Digest, Size: layers[1].Size}}, res.RemovedLayers)
+	assert.Equal(t, []LayerChange{{
+		Old: DiffLayer{DiffID: diffID1, Digest: layers[0].Digest, Size: layers[0].Size},
+		New: DiffLayer{DiffID: diffID1, Digest: recompressed.Digest, Size: recompressed.Size},
+	}}, res.ChangedLayers)
+	str := func(s string) *string { return &s }
+	assert.Equal(t, []KeyValueChange{
+		{Key: "ADDED", NewValue: str("")},
+		{Key: "CHANGED", OldValue: str("old"), NewValue: str("new")},
+		{Key: "REMOVED", OldValue: str("1")},
+	}, res.Env)
+	assert.Equal(t, []KeyValueChange{
+		{Key: "added", NewValue: str("2")},
+		{Key: "removed", OldValue: str("1")},
+	}, res.Labels)
+	assert.Nil(t, res.Entrypoint)
+	assert.Equal(t, &StringSliceChange{Old: []string{"-c", "true"}}, res.Cmd)
+	assert.Equal(t, res.NewSize-res.OldSize, res.SizeDelta)
+
+	// Unknown sizes
+	unknownSize := layers[0]
+	unknownSize.Size = -1
+	newImg = diffTestImage(t, imgspecv1.Image{
+		RootFS: imgspecv1.RootFS{Type: "layers", DiffIDs: []digest.Digest{diffID1}},
+	}, []imgspecv1.Descriptor{unknownSize})
+	res, err = Diff(context.Background(), oldImg, newImg)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), res.NewSize)
+	assert.Equal(t, int64(0), res.SizeDelta)
+
+	// DiffIDs inconsistent with the manifest
+	newImg = diffTestImage(t, imgspecv1.Image{
+		RootFS: imgspecv1.RootFS{Type: "layers", DiffIDs: []digest.Digest{diffID1}},
+	}, layers)
+	_, err = Diff(context.Background(), oldImg, newImg)
+	assert.Error(t, err)
+}
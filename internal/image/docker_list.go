@@ -22,13 +22,10 @@ func manifestSchema2FromManifestList(ctx context.Context, sys *types.SystemConte
 		return nil, fmt.Errorf("fetching target platform image selected from manifest list: %w", err)
 	}
 
-	matches, err := manifest.MatchesDigest(manblob, targetManifestDigest)
+	digested, err := manifest.VerifyManifestDigest(manblob, mt, targetManifestDigest)
 	if err != nil {
-		return nil, fmt.Errorf("computing manifest digest: %w", err)
-	}
-	if !matches {
-		return nil, fmt.Errorf("Image manifest does not match selected manifest digest %s", targetManifestDigest)
+		return nil, fmt.Errorf("verifying image manifest selected from manifest list: %w", err)
 	}
 
-	return manifestInstanceFromBlob(ctx, sys, src, manblob, mt)
+	return manifestInstanceFromBlob(ctx, sys, src, digested.Blob(), digested.MIMEType())
 }
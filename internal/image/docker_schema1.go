@@ -125,6 +125,9 @@ func (m *manifestSchema1) UpdatedImage(ctx context.Context, options types.Manife
 	}
 
 	// No conversion required, update manifest
+	if options.Annotations != nil {
+		return nil, fmt.Errorf("annotations are not supported in %s manifests", manifest.DockerV2Schema1SignedMediaType)
+	}
 	if options.LayerInfos != nil {
 		if err := copy.m.UpdateLayerInfos(options.LayerInfos); err != nil {
 			return nil, err
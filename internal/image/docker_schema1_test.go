@@ -478,7 +478,7 @@ func TestManifestSchema1ConvertToSchema2(t *testing.T) {
 	assert.Equal(t, manifest.DockerV2Schema2MediaType, mt)
 	// Layers have been updated as expected
 	originalSrc := newSchema2ImageSource(t, "httpd:latest")
-	s2Manifest, err := manifestSchema2FromManifest(originalSrc, convertedJSON)
+	s2Manifest, err := manifestSchema2FromManifest(nil, originalSrc, convertedJSON)
 	require.NoError(t, err)
 	assert.Equal(t, []types.BlobInfo{
 		{
@@ -565,7 +565,7 @@ func TestManifestSchema1ConvertToManifestOCI1(t *testing.T) {
 	assert.Equal(t, imgspecv1.MediaTypeImageManifest, mt)
 	// Layers have been updated as expected
 	originalSrc := newSchema2ImageSource(t, "httpd:latest")
-	ociManifest, err := manifestOCI1FromManifest(originalSrc, convertedJSON)
+	ociManifest, err := manifestOCI1FromManifest(nil, originalSrc, convertedJSON)
 	require.NoError(t, err)
 	assert.Equal(t, []types.BlobInfo{
 		{
@@ -610,7 +610,7 @@ func TestManifestSchema1ConvertToManifestOCI1(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, imgspecv1.MediaTypeImageManifest, mt)
 	// Layers have been updated as expected
-	ociManifest, err = manifestOCI1FromManifest(originalSrc, convertedJSON)
+	ociManifest, err = manifestOCI1FromManifest(nil, originalSrc, convertedJSON)
 	require.NoError(t, err)
 	assert.Equal(t, []types.BlobInfo{
 		{
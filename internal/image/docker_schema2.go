@@ -37,19 +37,21 @@ var GzippedEmptyLayer = []byte{
 const GzippedEmptyLayerDigest = digest.Digest("sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4")
 
 type manifestSchema2 struct {
-	src        types.ImageSource // May be nil if configBlob is not nil
-	configBlob []byte            // If set, corresponds to contents of ConfigDescriptor.
-	m          *manifest.Schema2
+	src             types.ImageSource // May be nil if configBlob is not nil
+	configBlob      []byte            // If set, corresponds to contents of ConfigDescriptor.
+	configSizeLimit int               // The maximum size of the config read from src, or 0 for iolimits.MaxConfigBodySize.
+	m               *manifest.Schema2
 }
 
-func manifestSchema2FromManifest(src types.ImageSource, manifestBlob []byte) (genericManifest, error) {
+func manifestSchema2FromManifest(sys *types.SystemContext, src types.ImageSource, manifestBlob []byte) (genericManifest, error) {
 	m, err := manifest.Schema2FromManifest(manifestBlob)
 	if err != nil {
 		return nil, err
 	}
 	return &manifestSchema2{
-		src: src,
-		m:   m,
+		src:             src,
+		configSizeLimit: iolimits.ConfigSizeLimit(sys),
+		m:               m,
 	}, nil
 }
 
@@ -106,7 +108,7 @@ func (m *manifestSchema2) ConfigBlob(ctx context.Context) ([]byte, error) {
 			return nil, err
 		}
 		defer stream.Close()
-		blob, err := iolimits.ReadAtMost(stream, iolimits.MaxConfigBodySize)
+		blob, err := iolimits.ReadAtMost(stream, configSizeLimit(m.configSizeLimit))
 		if err != nil {
 			return nil, err
 		}
@@ -182,6 +184,9 @@ func (m *manifestSchema2) UpdatedImage(ctx context.Context, options types.Manife
 	}
 
 	// No conversion required, update manifest
+	if options.Annotations != nil {
+		return nil, fmt.Errorf("annotations are not supported in %s manifests", manifest.DockerV2Schema2MediaType)
+	}
 	if options.LayerInfos != nil {
 		if err := copy.m.UpdateLayerInfos(options.LayerInfos); err != nil {
 			return nil, err
@@ -205,7 +210,7 @@ func oci1DescriptorFromSchema2Descriptor(d manifest.Schema2Descriptor) imgspecv1
 // It may use options.InformationOnly and also adjust *options to be appropriate for editing the returned
 // value.
 // This does not change the state of the original manifestSchema2 object.
-func (m *manifestSchema2) convertToManifestOCI1(ctx context.Context, _ *types.ManifestUpdateOptions) (genericManifest, error) {
+func (m *manifestSchema2) convertToManifestOCI1(ctx context.Context, options *types.ManifestUpdateOptions) (genericManifest, error) {
 	configOCI, err := m.OCIConfig(ctx)
 	if err != nil {
 		return nil, err
@@ -214,6 +219,16 @@ func (m *manifestSchema2) convertToManifestOCI1(ctx context.Context, _ *types.Ma
 	if err != nil {
 		return nil, err
 	}
+	if options.ConfigStrictness != types.ConfigStrictnessDropUnknownFields {
+		originalConfig, err := m.ConfigBlob(ctx)
+		if err != nil {
+			return nil, err
+		}
+		configOCIBytes, err = applyConfigStrictness(originalConfig, configOCIBytes, options.ConfigStrictness)
+		if err != nil {
+			return nil, err
+		}
+	}
 
 	config := imgspecv1.Descriptor{
 		MediaType: imgspecv1.MediaTypeImageConfig,
@@ -238,7 +253,9 @@ func (m *manifestSchema2) convertToManifestOCI1(ctx context.Context, _ *types.Ma
 		}
 	}
 
-	return manifestOCI1FromComponents(config, m.src, configOCIBytes, layers), nil
+	res := manifestOCI1FromComponents(config, m.src, configOCIBytes, layers)
+	res.configSizeLimit = m.configSizeLimit
+	return res, nil
 }
 
 // convertToManifestSchema1 returns a genericManifest implementation converted to manifest.DockerV2Schema1{Signed,}MediaType.
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"io"
 	"os"
@@ -28,7 +29,7 @@ func manifestSchema2FromFixture(t *testing.T, src types.ImageSource, fixture str
 	manifest, err := os.ReadFile(filepath.Join("fixtures", fixture))
 	require.NoError(t, err)
 
-	m, err := manifestSchema2FromManifest(src, manifest)
+	m, err := manifestSchema2FromManifest(nil, src, manifest)
 	if mustFail {
 		require.Error(t, err)
 	} else {
@@ -76,7 +77,7 @@ func TestManifestSchema2FromManifest(t *testing.T) {
 	// values are correctly returned in tests for the individual getter methods.
 	_ = manifestSchema2FromFixture(t, mocks.ForbiddenImageSource{}, "schema2.json", false)
 
-	_, err := manifestSchema2FromManifest(nil, []byte{})
+	_, err := manifestSchema2FromManifest(nil, nil, []byte{})
 	assert.Error(t, err)
 }
 
@@ -496,6 +497,25 @@ func TestManifestSchema2UpdatedImage(t *testing.T) {
 		assert.Error(t, err, mime)
 	}
 
+	// Annotations:
+	// … are not supported in schema2
+	annotations := map[string]string{"org.opencontainers.image.title": "updated"}
+	_, err = original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+		Annotations: annotations,
+	})
+	assert.Error(t, err)
+	// … but can be set when converting to OCI
+	res, err = original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+		Annotations:      annotations,
+		ManifestMIMEType: imgspecv1.MediaTypeImageManifest,
+	})
+	require.NoError(t, err)
+	manifestBlob, _, err := res.Manifest(context.Background())
+	require.NoError(t, err)
+	ociManifest, err := manifest.OCI1FromManifest(manifestBlob)
+	require.NoError(t, err)
+	assert.Equal(t, annotations, ociManifest.Annotations)
+
 	// m hasn’t been changed:
 	m2 := manifestSchema2FromFixture(t, originalSrc, "schema2.json", false)
 	typedOriginal, ok := original.(*manifestSchema2)
@@ -532,7 +552,7 @@ func TestConvertToManifestOCI(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, imgspecv1.MediaTypeImageManifest, mt)
 	// Layers have been updated as expected
-	ociManifest, err := manifestOCI1FromManifest(originalSrc, convertedJSON)
+	ociManifest, err := manifestOCI1FromManifest(nil, originalSrc, convertedJSON)
 	require.NoError(t, err)
 	assert.Equal(t, []types.BlobInfo{
 		{
@@ -563,6 +583,71 @@ func TestConvertToManifestOCI(t *testing.T) {
 	}, ociManifest.LayerInfos())
 }
 
+func TestConvertToManifestOCIConfigStrictness(t *testing.T) {
+	// A config using only fields defined by the Docker format is converted the same way with all strictness values.
+	originalSrc := newSchema2ImageSource(t, "httpd-copy:latest")
+	original := manifestSchema2FromFixture(t, originalSrc, "schema2.json", false)
+	for _, strictness := range []types.ConfigStrictness{
+		types.ConfigStrictnessDropUnknownFields,
+		types.ConfigStrictnessPreserveUnknownFields,
+		types.ConfigStrictnessRejectUnknownFields,
+	} {
+		res, err := original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+			ManifestMIMEType: imgspecv1.MediaTypeImageManifest,
+			ConfigStrictness: strictness,
+		})
+		require.NoError(t, err, strictness)
+		convertedConfig, err := res.ConfigBlob(context.Background())
+		require.NoError(t, err, strictness)
+		assertJSONEqualsFixture(t, convertedConfig, "schema2-to-oci1-config.json")
+	}
+
+	// A config with vendor extensions
+	configJSON, err := os.ReadFile("fixtures/schema2-config.json")
+	require.NoError(t, err)
+	var config map[string]any
+	err = json.Unmarshal(configJSON, &config)
+	require.NoError(t, err)
+	config["com.example.vendor"] = map[string]any{"key": "value"}
+	config["config"].(map[string]any)["com.example.runtime"] = "extension"
+	configJSON, err = json.Marshal(config)
+	require.NoError(t, err)
+	original = manifestSchema2FromComponentsLikeFixture(configJSON)
+
+	res, err := original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+		ManifestMIMEType: imgspecv1.MediaTypeImageManifest,
+	})
+	require.NoError(t, err)
+	convertedConfig, err := res.ConfigBlob(context.Background())
+	require.NoError(t, err)
+	assertJSONEqualsFixture(t, convertedConfig, "schema2-to-oci1-config.json")
+
+	res, err = original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+		ManifestMIMEType: imgspecv1.MediaTypeImageManifest,
+		ConfigStrictness: types.ConfigStrictnessPreserveUnknownFields,
+	})
+	require.NoError(t, err)
+	convertedConfig, err = res.ConfigBlob(context.Background())
+	require.NoError(t, err)
+	var converted map[string]any
+	err = json.Unmarshal(convertedConfig, &converted)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"key": "value"}, converted["com.example.vendor"])
+	assert.Equal(t, "extension", converted["config"].(map[string]any)["com.example.runtime"])
+	assert.NotContains(t, converted, "container_config") // Fields defined by the Docker format are still dropped
+	manifestBlob, _, err := res.Manifest(context.Background())
+	require.NoError(t, err)
+	ociManifest, err := manifest.OCI1FromManifest(manifestBlob)
+	require.NoError(t, err)
+	assert.Equal(t, digest.FromBytes(convertedConfig), ociManifest.Config.Digest)
+
+	_, err = original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+		ManifestMIMEType: imgspecv1.MediaTypeImageManifest,
+		ConfigStrictness: types.ConfigStrictnessRejectUnknownFields,
+	})
+	assert.ErrorContains(t, err, "com.example.vendor, config.com.example.runtime")
+}
+
 func TestConvertToManifestOCIAllMediaTypes(t *testing.T) {
 	originalSrc := newSchema2ImageSource(t, "httpd-copy:latest")
 	original := manifestSchema2FromFixture(t, originalSrc, "schema2-all-media-types.json", false)
@@ -0,0 +1,50 @@
+package image
+
+import (
+	"context"
+	"errors"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Exists returns true if the image ref refers to exists, and false if it does not.
+// If the image exists, it also returns the descriptor of its manifest, if known; fields of the descriptor
+// which can't be determined cheaply (e.g. MediaType for some transports) may be left empty.
+//
+// Transports implementing transports.ExistenceChecker use their cheapest available check (e.g. a HEAD request);
+// for other transports, the manifest is read.
+//
+// This is publicly visible as c/image/image.Exists.
+func Exists(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) (bool, *imgspecv1.Descriptor, error) {
+	if checker, ok := ref.(transports.ExistenceChecker); ok {
+		return checker.ImageExists(ctx, sys)
+	}
+
+	src, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		if errors.Is(err, types.ErrNotFound) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	defer src.Close()
+	manifestBlob, mimeType, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		if errors.Is(err, types.ErrNotFound) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	manifestDigest, err := manifest.Digest(manifestBlob)
+	if err != nil {
+		return false, nil, err
+	}
+	return true, &imgspecv1.Descriptor{
+		MediaType: mimeType,
+		Digest:    manifestDigest,
+		Size:      int64(len(manifestBlob)),
+	}, nil
+}
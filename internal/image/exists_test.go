@@ -0,0 +1,90 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/containers/image/v5/internal/errclass"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// existsTestReference is a types.ImageReference which only implements NewImageSource.
+type existsTestReference struct {
+	types.ImageReference
+	manifest []byte
+	err      error // Returned by NewImageSource
+}
+
+func (ref existsTestReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	if ref.err != nil {
+		return nil, ref.err
+	}
+	return existsTestImageSource{manifest: ref.manifest}, nil
+}
+
+// existsTestImageSource is a types.ImageSource which only implements GetManifest and Close.
+type existsTestImageSource struct {
+	types.ImageSource
+	manifest []byte // nil if the manifest does not exist
+}
+
+func (src existsTestImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	if src.manifest == nil {
+		return nil, "", errclass.Wrap(errors.New("manifest unknown"), types.ErrNotFound)
+	}
+	return src.manifest, imgspecv1.MediaTypeImageManifest, nil
+}
+
+func (src existsTestImageSource) Close() error {
+	return nil
+}
+
+// existenceCheckingReference is a types.ImageReference implementing transports.ExistenceChecker.
+type existenceCheckingReference struct {
+	types.ImageReference
+	exists bool
+}
+
+func (ref existenceCheckingReference) ImageExists(ctx context.Context, sys *types.SystemContext) (bool, *imgspecv1.Descriptor, error) {
+	return ref.exists, nil, nil
+}
+
+func TestExists(t *testing.T) {
+	manifestBlob := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json"}`)
+
+	// Transports implementing transports.ExistenceChecker
+	for _, v := range []bool{true, false} {
+		exists, desc, err := Exists(context.Background(), nil, existenceCheckingReference{exists: v})
+		require.NoError(t, err)
+		assert.Equal(t, v, exists)
+		assert.Nil(t, desc)
+	}
+
+	// Fallback to reading the manifest
+	exists, desc, err := Exists(context.Background(), nil, existsTestReference{manifest: manifestBlob})
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, &imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Digest:    digest.FromBytes(manifestBlob),
+		Size:      int64(len(manifestBlob)),
+	}, desc)
+
+	for _, ref := range []existsTestReference{
+		{manifest: nil},
+		{err: errclass.Wrap(errors.New("no such image"), types.ErrNotFound)},
+	} {
+		exists, desc, err := Exists(context.Background(), nil, ref)
+		require.NoError(t, err)
+		assert.False(t, exists)
+		assert.Nil(t, desc)
+	}
+
+	_, _, err = Exists(context.Background(), nil, existsTestReference{err: errors.New("some other failure")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,37 @@
+package image
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+)
+
+// ErrMetadataRequiresLayerAccess is returned by InspectMetadata if the transport can't provide
+// the manifest and config of an image without reading or processing its layers.
+// This is publicly visible as c/image/image.ErrMetadataRequiresLayerAccess.
+var ErrMetadataRequiresLayerAccess = errors.New("reading image metadata requires access to layer data")
+
+// InspectMetadata returns information about the image at ref, reading only its manifest and config (never any layers).
+// If ref refers to a manifest list, the instance most appropriate for sys is inspected.
+// If the transport of ref can't read the manifest and config without processing layer data,
+// it fails with an error wrapping ErrMetadataRequiresLayerAccess, without opening the image.
+// This is publicly visible as c/image/image.InspectMetadata.
+func InspectMetadata(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) (*types.ImageInspectInfo, error) {
+	if reporter, ok := ref.(private.MetadataAccessCostReporter); ok && reporter.MetadataRequiresLayerAccess() {
+		return nil, fmt.Errorf("inspecting %s: %w", transports.ImageName(ref), ErrMetadataRequiresLayerAccess)
+	}
+	src, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	img, err := FromUnparsedImage(ctx, sys, UnparsedInstance(src, nil))
+	if err != nil {
+		return nil, err
+	}
+	return img.Inspect(ctx)
+}
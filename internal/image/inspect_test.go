@@ -0,0 +1,93 @@
+package image
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/testing/mocks"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// inspectTestSource is an OCI image source which provides the manifest and config, but panics if asked for layers.
+type inspectTestSource struct {
+	*oci1ImageSource
+	manifest []byte
+	closed   bool
+}
+
+func (s *inspectTestSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	if instanceDigest != nil {
+		panic("Unexpected instanceDigest")
+	}
+	return s.manifest, imgspecv1.MediaTypeImageManifest, nil
+}
+
+func (s *inspectTestSource) Reference() types.ImageReference {
+	return inspectTestReference{src: s}
+}
+
+func (s *inspectTestSource) Close() error {
+	s.closed = true
+	return nil
+}
+
+// inspectTestReference is a types.ImageReference which returns a fixed ImageSource,
+// and optionally claims that reading metadata requires layer access.
+type inspectTestReference struct {
+	mocks.ForbiddenImageReference // We inherit almost all of the methods, which just panic()
+	src                           *inspectTestSource
+	expensive                     bool
+}
+
+func (ref inspectTestReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	return ref.src, nil
+}
+
+func (ref inspectTestReference) MetadataRequiresLayerAccess() bool {
+	return ref.expensive
+}
+
+func (ref inspectTestReference) Transport() types.ImageTransport {
+	return mocks.NameImageTransport("==mock")
+}
+
+func (ref inspectTestReference) DockerReference() reference.Named {
+	return nil
+}
+
+func (ref inspectTestReference) StringWithinTransport() string {
+	return "inspect-test"
+}
+
+func TestInspectMetadata(t *testing.T) {
+	manifest, err := os.ReadFile(filepath.Join("fixtures", "oci1.json"))
+	require.NoError(t, err)
+	src := &inspectTestSource{
+		oci1ImageSource: newOCI1ImageSource(t, "oci1-config.json", "httpd:latest"),
+		manifest:        manifest,
+	}
+
+	info, err := InspectMetadata(context.Background(), nil, inspectTestReference{src: src})
+	require.NoError(t, err)
+	assert.True(t, src.closed)
+	assert.Equal(t, "amd64", info.Architecture)
+	require.Len(t, info.LayersData, len(layerDescriptorsLikeFixture))
+	for i, layer := range layerDescriptorsLikeFixture {
+		assert.Equal(t, layer.Digest, info.LayersData[i].Digest)
+		assert.Equal(t, layer.Size, info.LayersData[i].Size)
+		assert.Equal(t, layer.MediaType, info.LayersData[i].MIMEType)
+	}
+
+	// The image is not opened at all if the transport can't read metadata cheaply
+	src.closed = false
+	_, err = InspectMetadata(context.Background(), nil, inspectTestReference{src: src, expensive: true})
+	assert.ErrorIs(t, err, ErrMetadataRequiresLayerAccess)
+	assert.False(t, src.closed)
+}
@@ -0,0 +1,63 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// LayerDiffID pairs the digest of a layer blob with the digest of its uncompressed contents (the “DiffID”).
+// This is publicly visible as c/image/image.LayerDiffID.
+type LayerDiffID struct {
+	Digest digest.Digest // The digest of the layer blob, as referenced by the manifest.
+	DiffID digest.Digest // The digest of the uncompressed layer contents, or "" if unknown.
+}
+
+// LayerDiffIDs returns the DiffIDs of the layers of img, in order (the root layer first), without reading the layers.
+// The DiffIDs are primarily read from the image configuration; if it does not record them (e.g. for Docker schema1 images),
+// they are looked up in cache, and left empty if not known.
+// If cache is not nil, DiffIDs read from the configuration are recorded in it, so that later users
+// (possibly of other images sharing the layers) don't need to decompress the layers to compute them.
+// This is publicly visible as c/image/image.LayerDiffIDs.
+func LayerDiffIDs(ctx context.Context, img types.Image, cache types.BlobInfoCache) ([]LayerDiffID, error) {
+	config, err := img.OCIConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	layers := img.LayerInfos()
+	diffIDs := config.RootFS.DiffIDs
+	if len(diffIDs) != 0 && len(diffIDs) != len(layers) {
+		return nil, fmt.Errorf("image configuration records %d layer digests, but the manifest has %d layers", len(diffIDs), len(layers))
+	}
+
+	res := make([]LayerDiffID, len(layers))
+	for i, layer := range layers {
+		res[i].Digest = layer.Digest
+		switch {
+		case len(diffIDs) != 0:
+			res[i].DiffID = diffIDs[i]
+			if cache != nil {
+				cache.RecordDigestUncompressedPair(layer.Digest, diffIDs[i])
+			}
+		case isUncompressedLayerMIMEType(layer.MediaType):
+			res[i].DiffID = layer.Digest
+		case cache != nil:
+			res[i].DiffID = cache.UncompressedDigest(layer.Digest)
+		}
+	}
+	return res, nil
+}
+
+// isUncompressedLayerMIMEType returns true if mimeType is a layer MIME type which implies that the layer is not compressed.
+func isUncompressedLayerMIMEType(mimeType string) bool {
+	switch mimeType {
+	case manifest.DockerV2SchemaLayerMediaTypeUncompressed, imgspecv1.MediaTypeImageLayer:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,56 @@
+package image
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayerDiffIDs(t *testing.T) {
+	const (
+		diffID1 = digest.Digest("sha256:1111111111111111111111111111111111111111111111111111111111111111")
+		diffID2 = digest.Digest("sha256:2222222222222222222222222222222222222222222222222222222222222222")
+	)
+	layers := []imgspecv1.Descriptor{layerDescriptorsLikeFixture[0], layerDescriptorsLikeFixture[1]}
+	layers[1].MediaType = imgspecv1.MediaTypeImageLayer
+	img := diffTestImage(t, imgspecv1.Image{
+		RootFS: imgspecv1.RootFS{Type: "layers", DiffIDs: []digest.Digest{diffID1, diffID2}},
+	}, layers)
+
+	// DiffIDs from the config are returned, and recorded in the cache
+	cache := memory.New()
+	res, err := LayerDiffIDs(context.Background(), img, cache)
+	require.NoError(t, err)
+	assert.Equal(t, []LayerDiffID{
+		{Digest: layers[0].Digest, DiffID: diffID1},
+		{Digest: layers[1].Digest, DiffID: diffID2},
+	}, res)
+	assert.Equal(t, diffID1, cache.UncompressedDigest(layers[0].Digest))
+	res, err = LayerDiffIDs(context.Background(), img, nil)
+	require.NoError(t, err)
+	assert.Equal(t, diffID1, res[0].DiffID)
+
+	// Without DiffIDs in the config, the cache and layer MIME types are used
+	img = diffTestImage(t, imgspecv1.Image{}, layers)
+	res, err = LayerDiffIDs(context.Background(), img, cache)
+	require.NoError(t, err)
+	assert.Equal(t, []LayerDiffID{
+		{Digest: layers[0].Digest, DiffID: diffID1},
+		{Digest: layers[1].Digest, DiffID: layers[1].Digest},
+	}, res)
+	res, err = LayerDiffIDs(context.Background(), img, memory.New())
+	require.NoError(t, err)
+	assert.Equal(t, digest.Digest(""), res[0].DiffID)
+
+	// DiffIDs inconsistent with the manifest
+	img = diffTestImage(t, imgspecv1.Image{
+		RootFS: imgspecv1.RootFS{Type: "layers", DiffIDs: []digest.Digest{diffID1}},
+	}, layers)
+	_, err = LayerDiffIDs(context.Background(), img, nil)
+	assert.Error(t, err)
+}
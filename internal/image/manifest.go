@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/iolimits"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/types"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
@@ -66,11 +67,14 @@ type genericManifest interface {
 func manifestInstanceFromBlob(ctx context.Context, sys *types.SystemContext, src types.ImageSource, manblob []byte, mt string) (genericManifest, error) {
 	switch manifest.NormalizedMIMEType(mt) {
 	case manifest.DockerV2Schema1MediaType, manifest.DockerV2Schema1SignedMediaType:
+		if sys == nil || sys.DockerSchema1Mode == types.DockerSchema1Refuse {
+			return nil, fmt.Errorf("refusing to parse a deprecated Docker schema1 manifest (MIME type %q); set DockerSchema1Mode in SystemContext to allow converting it", mt)
+		}
 		return manifestSchema1FromManifest(manblob)
 	case imgspecv1.MediaTypeImageManifest:
-		return manifestOCI1FromManifest(src, manblob)
+		return manifestOCI1FromManifest(sys, src, manblob)
 	case manifest.DockerV2Schema2MediaType:
-		return manifestSchema2FromManifest(src, manblob)
+		return manifestSchema2FromManifest(sys, src, manblob)
 	case manifest.DockerV2ListMediaType:
 		return manifestSchema2FromManifestList(ctx, sys, src, manblob)
 	case imgspecv1.MediaTypeImageIndex:
@@ -80,6 +84,14 @@ func manifestInstanceFromBlob(ctx context.Context, sys *types.SystemContext, src
 	}
 }
 
+// configSizeLimit returns the limit to use when reading a config, given a configSizeLimit field value.
+func configSizeLimit(fieldValue int) int {
+	if fieldValue == 0 {
+		return iolimits.MaxConfigBodySize
+	}
+	return fieldValue
+}
+
 // manifestLayerInfosToBlobInfos extracts a []types.BlobInfo from a []manifest.LayerInfo.
 func manifestLayerInfosToBlobInfos(layers []manifest.LayerInfo) []types.BlobInfo {
 	blobs := make([]types.BlobInfo, len(layers))
@@ -0,0 +1,105 @@
+package image
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ManifestList is a manifest list (or an image index) read from an ImageSource, which allows enumerating its instances,
+// and reading only the instances the caller is interested in.
+// The list is fetched and parsed only once; images of instances are created on demand, and cached.
+//
+// A ManifestList is not safe for concurrent use.
+// This is publicly visible as c/image/image.ManifestList.
+type ManifestList struct {
+	src          types.ImageSource
+	sys          *types.SystemContext
+	manifestBlob []byte
+	mimeType     string
+	list         manifest.List
+	images       map[digest.Digest]*SourcedImage // A private cache of images of instances.
+}
+
+// ManifestListFromSource returns a ManifestList for the default instance of src, which must be a manifest list.
+// sys is used for choosing instances in ChooseImage, and for creating the instance images.
+//
+// The ManifestList, and images it returns, must not be used after src is Close()d.
+// This is publicly visible as c/image/image.ManifestListFromSource.
+func ManifestListFromSource(ctx context.Context, sys *types.SystemContext, src types.ImageSource) (*ManifestList, error) {
+	manifestBlob, mimeType, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if normalized := manifest.NormalizedMIMEType(mimeType); normalized != manifest.DockerV2ListMediaType && normalized != imgspecv1.MediaTypeImageIndex {
+		return nil, fmt.Errorf("%s is not a manifest list, but %q", transports.ImageName(src.Reference()), mimeType)
+	}
+	list, err := manifest.ListFromBlob(manifestBlob, mimeType)
+	if err != nil {
+		return nil, fmt.Errorf("parsing manifest list: %w", err)
+	}
+	return &ManifestList{
+		src:          src,
+		sys:          sys,
+		manifestBlob: manifestBlob,
+		mimeType:     mimeType,
+		list:         list,
+		images:       map[digest.Digest]*SourcedImage{},
+	}, nil
+}
+
+// Manifest returns the manifest list blob, and its MIME type.
+func (l *ManifestList) Manifest() ([]byte, string) {
+	return l.manifestBlob, l.mimeType
+}
+
+// Instances returns the digests of all instances in the list, in order.
+func (l *ManifestList) Instances() []digest.Digest {
+	return l.list.Instances()
+}
+
+// Instance returns the size, MIME type, and read-only data (e.g. the platform) of the instance with instanceDigest.
+func (l *ManifestList) Instance(instanceDigest digest.Digest) (manifest.ListUpdate, error) {
+	return l.list.Instance(instanceDigest)
+}
+
+// Image returns an image for the instance with instanceDigest, reading its manifest if it was not read before.
+func (l *ManifestList) Image(ctx context.Context, instanceDigest digest.Digest) (types.Image, error) {
+	if img, ok := l.images[instanceDigest]; ok {
+		return img, nil
+	}
+	if _, err := l.list.Instance(instanceDigest); err != nil {
+		return nil, err
+	}
+	d := instanceDigest
+	img, err := FromUnparsedImage(ctx, l.sys, UnparsedInstance(l.src, &d))
+	if err != nil {
+		return nil, fmt.Errorf("reading instance %s: %w", instanceDigest, err)
+	}
+	l.images[instanceDigest] = img
+	return img, nil
+}
+
+// ChooseImage returns an image for the instance most appropriate for the platform described by the SystemContext
+// used to create l, or for the current platform if the SystemContext doesn't specify any details.
+func (l *ManifestList) ChooseImage(ctx context.Context) (types.Image, error) {
+	instanceDigest, err := l.list.ChooseInstance(l.sys)
+	if err != nil {
+		return nil, fmt.Errorf("choosing image instance: %w", err)
+	}
+	return l.Image(ctx, instanceDigest)
+}
+
+// ChooseImageMatching returns an image for the instance most preferred by matcher.
+func (l *ManifestList) ChooseImageMatching(ctx context.Context, matcher manifest.PlatformMatcher) (types.Image, error) {
+	instanceDigest, err := l.list.ChooseInstanceMatching(matcher)
+	if err != nil {
+		return nil, fmt.Errorf("choosing image instance: %w", err)
+	}
+	return l.Image(ctx, instanceDigest)
+}
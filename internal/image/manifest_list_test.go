@@ -0,0 +1,117 @@
+package image
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// manifestListImageSource is an ImageSource containing an OCI index, and instances referring to the oci1-config.json config.
+type manifestListImageSource struct {
+	*oci1ImageSource
+	manifests        map[digest.Digest][]byte // Instance manifests; the "" key is the top-level manifest.
+	getManifestCalls map[digest.Digest]int
+	topLevelMIMEType string
+}
+
+func (s *manifestListImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	key := digest.Digest("")
+	mimeType := s.topLevelMIMEType
+	if instanceDigest != nil {
+		key = *instanceDigest
+		mimeType = imgspecv1.MediaTypeImageManifest
+	}
+	s.getManifestCalls[key]++
+	return s.manifests[key], mimeType, nil
+}
+
+func (s *manifestListImageSource) Reference() types.ImageReference {
+	return inspectTestReference{}
+}
+
+func newManifestListImageSource(t *testing.T) (*manifestListImageSource, []digest.Digest) {
+	amd64Manifest, err := os.ReadFile(filepath.Join("fixtures", "oci1.json"))
+	require.NoError(t, err)
+	m, err := manifest.OCI1FromManifest(amd64Manifest)
+	require.NoError(t, err)
+	m.Annotations = map[string]string{"platform": "arm64"}
+	arm64Manifest, err := m.Serialize()
+	require.NoError(t, err)
+
+	amd64Digest, arm64Digest := digest.FromBytes(amd64Manifest), digest.FromBytes(arm64Manifest)
+	index, err := manifest.OCI1IndexFromComponents([]imgspecv1.Descriptor{
+		{
+			MediaType: imgspecv1.MediaTypeImageManifest,
+			Digest:    amd64Digest,
+			Size:      int64(len(amd64Manifest)),
+			Platform:  &imgspecv1.Platform{OS: "linux", Architecture: "amd64"},
+		},
+		{
+			MediaType: imgspecv1.MediaTypeImageManifest,
+			Digest:    arm64Digest,
+			Size:      int64(len(arm64Manifest)),
+			Platform:  &imgspecv1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+		},
+	}, nil).Serialize()
+	require.NoError(t, err)
+
+	return &manifestListImageSource{
+		oci1ImageSource: newOCI1ImageSource(t, "oci1-config.json", "httpd:latest"),
+		manifests: map[digest.Digest][]byte{
+			"":          index,
+			amd64Digest: amd64Manifest,
+			arm64Digest: arm64Manifest,
+		},
+		getManifestCalls: map[digest.Digest]int{},
+		topLevelMIMEType: imgspecv1.MediaTypeImageIndex,
+	}, []digest.Digest{amd64Digest, arm64Digest}
+}
+
+func TestManifestList(t *testing.T) {
+	src, instances := newManifestListImageSource(t)
+	list, err := ManifestListFromSource(context.Background(), &types.SystemContext{OSChoice: "linux", ArchitectureChoice: "arm64"}, src)
+	require.NoError(t, err)
+	blob, mimeType := list.Manifest()
+	assert.Equal(t, src.manifests[""], blob)
+	assert.Equal(t, imgspecv1.MediaTypeImageIndex, mimeType)
+	assert.Equal(t, instances, list.Instances())
+	instance, err := list.Instance(instances[1])
+	require.NoError(t, err)
+	assert.Equal(t, "arm64", instance.ReadOnly.Platform.Architecture)
+
+	// Instances are only read when needed, and only once
+	assert.Equal(t, map[digest.Digest]int{"": 1}, src.getManifestCalls)
+	img, err := list.ChooseImage(context.Background())
+	require.NoError(t, err)
+	manifestBlob, _, err := img.Manifest(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, src.manifests[instances[1]], manifestBlob)
+	img2, err := list.Image(context.Background(), instances[1])
+	require.NoError(t, err)
+	assert.Same(t, img, img2)
+	img, err = list.ChooseImageMatching(context.Background(), func(p imgspecv1.Platform) (int, bool) {
+		return 0, p.Architecture == "amd64"
+	})
+	require.NoError(t, err)
+	manifestBlob, _, err = img.Manifest(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, src.manifests[instances[0]], manifestBlob)
+	assert.Equal(t, map[digest.Digest]int{"": 1, instances[0]: 1, instances[1]: 1}, src.getManifestCalls)
+
+	// Instances not in the list
+	_, err = list.Image(context.Background(), digest.FromString("not in the list"))
+	assert.Error(t, err)
+
+	// Not a manifest list
+	src.topLevelMIMEType = imgspecv1.MediaTypeImageManifest
+	_, err = ManifestListFromSource(context.Background(), nil, src)
+	assert.Error(t, err)
+}
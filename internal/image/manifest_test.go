@@ -1,13 +1,43 @@
 package image
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/types"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func TestManifestInstanceFromBlobSchema1Mode(t *testing.T) {
+	manifestBlob, err := os.ReadFile(filepath.Join("fixtures", "schema1.json"))
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		sys     *types.SystemContext
+		success bool
+	}{
+		{nil, false},
+		{&types.SystemContext{}, false},
+		{&types.SystemContext{DockerSchema1Mode: types.DockerSchema1Refuse}, false},
+		{&types.SystemContext{DockerSchema1Mode: types.DockerSchema1ConvertOnly}, true},
+		{&types.SystemContext{DockerSchema1Mode: types.DockerSchema1Allow}, true},
+	} {
+		for _, mt := range []string{manifest.DockerV2Schema1SignedMediaType, manifest.DockerV2Schema1MediaType} {
+			m, err := manifestInstanceFromBlob(context.Background(), c.sys, nil, manifestBlob, mt)
+			if c.success {
+				require.NoError(t, err)
+				assert.IsType(t, &manifestSchema1{}, m)
+			} else {
+				assert.Error(t, err)
+			}
+		}
+	}
+}
+
 func TestManifestLayerInfosToBlobInfos(t *testing.T) {
 	blobs := manifestLayerInfosToBlobInfos([]manifest.LayerInfo{})
 	assert.Equal(t, []types.BlobInfo{}, blobs)
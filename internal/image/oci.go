@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/iolimits"
@@ -15,28 +16,32 @@ import (
 	ociencspec "github.com/containers/ocicrypt/spec"
 	"github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
 )
 
 type manifestOCI1 struct {
-	src        types.ImageSource // May be nil if configBlob is not nil
-	configBlob []byte            // If set, corresponds to contents of m.Config.
-	m          *manifest.OCI1
+	src             types.ImageSource // May be nil if configBlob is not nil
+	configBlob      []byte            // If set, corresponds to contents of m.Config.
+	configSizeLimit int               // The maximum size of the config read from src, or 0 for iolimits.MaxConfigBodySize.
+	m               *manifest.OCI1
 }
 
-func manifestOCI1FromManifest(src types.ImageSource, manifestBlob []byte) (genericManifest, error) {
+func manifestOCI1FromManifest(sys *types.SystemContext, src types.ImageSource, manifestBlob []byte) (genericManifest, error) {
 	m, err := manifest.OCI1FromManifest(manifestBlob)
 	if err != nil {
 		return nil, err
 	}
 	return &manifestOCI1{
-		src: src,
-		m:   m,
+		src:             src,
+		configSizeLimit: iolimits.ConfigSizeLimit(sys),
+		m:               m,
 	}, nil
 }
 
 // manifestOCI1FromComponents builds a new manifestOCI1 from the supplied data:
-func manifestOCI1FromComponents(config imgspecv1.Descriptor, src types.ImageSource, configBlob []byte, layers []imgspecv1.Descriptor) genericManifest {
+func manifestOCI1FromComponents(config imgspecv1.Descriptor, src types.ImageSource, configBlob []byte, layers []imgspecv1.Descriptor) *manifestOCI1 {
 	return &manifestOCI1{
 		src:        src,
 		configBlob: configBlob,
@@ -70,7 +75,7 @@ func (m *manifestOCI1) ConfigBlob(ctx context.Context) ([]byte, error) {
 			return nil, err
 		}
 		defer stream.Close()
-		blob, err := iolimits.ReadAtMost(stream, iolimits.MaxConfigBodySize)
+		blob, err := iolimits.ReadAtMost(stream, configSizeLimit(m.configSizeLimit))
 		if err != nil {
 			return nil, err
 		}
@@ -171,6 +176,9 @@ func (m *manifestOCI1) UpdatedImage(ctx context.Context, options types.ManifestU
 			return nil, err
 		}
 	}
+	if options.Annotations != nil {
+		copy.m.Annotations = maps.Clone(options.Annotations)
+	}
 	// Ignore options.EmbeddedDockerReference: it may be set when converting from schema1, but we really don't care.
 
 	return memoryImageFromManifest(&copy), nil
@@ -185,6 +193,24 @@ func schema2DescriptorFromOCI1Descriptor(d imgspecv1.Descriptor) manifest.Schema
 	}
 }
 
+// oci1FieldsDroppedInSchema2 returns descriptions of the non-empty fields of m which are lost when converting it to schema2.
+func oci1FieldsDroppedInSchema2(m *manifest.OCI1) []string {
+	res := []string{}
+	if len(m.Annotations) != 0 {
+		res = append(res, "manifest annotations")
+	}
+	if len(m.Config.Annotations) != 0 {
+		res = append(res, "config annotations")
+	}
+	if slices.ContainsFunc(m.Layers, func(l imgspecv1.Descriptor) bool { return len(l.Annotations) != 0 }) {
+		res = append(res, "layer annotations")
+	}
+	if m.Subject != nil {
+		res = append(res, "the subject")
+	}
+	return res
+}
+
 // convertToManifestSchema2Generic returns a genericManifest implementation converted to manifest.DockerV2Schema2MediaType.
 // It may use options.InformationOnly and also adjust *options to be appropriate for editing the returned
 // value.
@@ -265,6 +291,10 @@ func (m *manifestOCI1) convertToManifestSchema2(_ context.Context, options *type
 		}
 	}
 
+	if dropped := oci1FieldsDroppedInSchema2(ociManifest); len(dropped) != 0 {
+		logrus.Warnf("Converting an OCI manifest to %s drops %s, which can't be represented", manifest.DockerV2Schema2MediaType, strings.Join(dropped, ", "))
+	}
+
 	// Create a copy of the descriptor.
 	config := schema2DescriptorFromOCI1Descriptor(ociManifest.Config)
 
@@ -300,7 +330,9 @@ func (m *manifestOCI1) convertToManifestSchema2(_ context.Context, options *type
 	// Rather than copying the ConfigBlob now, we just pass m.src to the
 	// translated manifest, since the only difference is the mediatype of
 	// descriptors there is no change to any blob stored in m.src.
-	return manifestSchema2FromComponents(config, m.src, nil, layers), nil
+	res := manifestSchema2FromComponents(config, m.src, nil, layers)
+	res.configSizeLimit = m.configSizeLimit
+	return res, nil
 }
 
 // convertToManifestSchema1 returns a genericManifest implementation converted to manifest.DockerV2Schema1{Signed,}MediaType.
@@ -28,7 +28,7 @@ func manifestOCI1FromFixture(t *testing.T, src types.ImageSource, fixture string
 	manifest, err := os.ReadFile(filepath.Join("fixtures", fixture))
 	require.NoError(t, err)
 
-	m, err := manifestOCI1FromManifest(src, manifest)
+	m, err := manifestOCI1FromManifest(nil, src, manifest)
 	require.NoError(t, err)
 	return m
 }
@@ -96,7 +96,7 @@ func TestManifestOCI1FromManifest(t *testing.T) {
 	// values are correctly returned in tests for the individual getter methods.
 	_ = manifestOCI1FromFixture(t, mocks.ForbiddenImageSource{}, "oci1.json")
 
-	_, err := manifestOCI1FromManifest(nil, []byte{})
+	_, err := manifestOCI1FromManifest(nil, nil, []byte{})
 	assert.Error(t, err)
 }
 
@@ -192,6 +192,27 @@ func TestManifestOCI1ConfigBlob(t *testing.T) {
 		}
 	}
 
+	// The config size limit from SystemContext is enforced
+	manifestBlob, err := os.ReadFile(filepath.Join("fixtures", "oci1.json"))
+	require.NoError(t, err)
+	src := configBlobImageSource{
+		expectedDigest: commonFixtureConfigDigest,
+		f: func() (io.ReadCloser, int64, error) {
+			return io.NopCloser(bytes.NewReader(realConfigJSON)), int64(len(realConfigJSON)), nil
+		},
+	}
+	limited, err := manifestOCI1FromManifest(&types.SystemContext{MaxConfigSize: int64(len(realConfigJSON) - 1)}, src, manifestBlob)
+	require.NoError(t, err)
+	_, err = limited.ConfigBlob(context.Background())
+	var limitErr types.SizeLimitExceededError
+	require.ErrorAs(t, err, &limitErr)
+	assert.Equal(t, int64(len(realConfigJSON)-1), limitErr.Limit)
+	// … and preserved when converting the manifest
+	s2, err := limited.(*manifestOCI1).convertToManifestSchema2Generic(context.Background(), &types.ManifestUpdateOptions{})
+	require.NoError(t, err)
+	_, err = s2.ConfigBlob(context.Background())
+	assert.ErrorAs(t, err, &limitErr)
+
 	// Generally configBlob should match ConfigInfo; we don’t quite need it to, and this will
 	// guarantee that the returned object is returning the original contents instead
 	// of reading an object from elsewhere.
@@ -443,6 +464,27 @@ func TestManifestOCI1UpdatedImage(t *testing.T) {
 	conflicts := res.EmbeddedDockerReferenceConflicts(nonEmbeddedRef)
 	assert.False(t, conflicts)
 
+	// Annotations:
+	annotations := map[string]string{"org.opencontainers.image.title": "updated"}
+	res, err = original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+		Annotations: annotations,
+	})
+	require.NoError(t, err)
+	manifestBlob, _, err := res.Manifest(context.Background())
+	require.NoError(t, err)
+	updatedManifest, err := manifest.OCI1FromManifest(manifestBlob)
+	require.NoError(t, err)
+	assert.Equal(t, annotations, updatedManifest.Annotations)
+	// … but annotations can't be set when converting to schema2
+	_, err = original.UpdatedImage(context.Background(), types.ManifestUpdateOptions{
+		Annotations:      annotations,
+		ManifestMIMEType: manifest.DockerV2Schema2MediaType,
+		InformationOnly: types.ManifestUpdateInformation{
+			Destination: &memoryImageDest{ref: originalSrc.ref},
+		},
+	})
+	assert.Error(t, err)
+
 	// ManifestMIMEType:
 	// Only smoke-test the valid conversions, detailed tests are below. (This also verifies that “original” is not affected.)
 	for _, mime := range []string{
@@ -672,6 +714,30 @@ func TestManifestOCI1ConvertToManifestSchema1(t *testing.T) {
 	// FIXME? Test also the other failure cases, if only to see that we don't crash?
 }
 
+func TestOCI1FieldsDroppedInSchema2(t *testing.T) {
+	originalSrc := newOCI1ImageSource(t, "oci1-config.json", "httpd-copy:latest")
+	original := manifestOCI1FromFixture(t, originalSrc, "oci1.json")
+	typed, ok := original.(*manifestOCI1)
+	require.True(t, ok)
+	m := manifest.OCI1Clone(typed.m)
+	m.Annotations = nil
+	m.Config.Annotations = nil
+	for i := range m.Layers {
+		m.Layers[i].Annotations = nil
+	}
+	assert.Equal(t, []string{}, oci1FieldsDroppedInSchema2(m))
+
+	m.Annotations = map[string]string{"a": "b"}
+	m.Config.Annotations = map[string]string{"a": "b"}
+	m.Layers[0].Annotations = map[string]string{"a": "b"}
+	m.Subject = &imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Digest:    "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270",
+		Size:      7682,
+	}
+	assert.Equal(t, []string{"manifest annotations", "config annotations", "layer annotations", "the subject"}, oci1FieldsDroppedInSchema2(m))
+}
+
 func TestConvertToManifestSchema2(t *testing.T) {
 	originalSrc := newOCI1ImageSource(t, "oci1-config.json", "httpd-copy:latest")
 	original := manifestOCI1FromFixture(t, originalSrc, "oci1.json")
@@ -723,7 +789,7 @@ func TestConvertToManifestSchema2(t *testing.T) {
 	convertedJSON, mt, err = res.Manifest(context.Background())
 	require.NoError(t, err)
 	assert.Equal(t, manifest.DockerV2Schema2MediaType, mt)
-	s2Manifest, err := manifestSchema2FromManifest(originalSrc, convertedJSON)
+	s2Manifest, err := manifestSchema2FromManifest(nil, originalSrc, convertedJSON)
 	require.NoError(t, err)
 	assert.Equal(t, []types.BlobInfo{
 		{
@@ -777,7 +843,7 @@ func TestConvertToManifestSchema2(t *testing.T) {
 	convertedJSON, mt, err = res.Manifest(context.Background())
 	require.NoError(t, err)
 	assert.Equal(t, manifest.DockerV2Schema2MediaType, mt)
-	s2Manifest, err = manifestSchema2FromManifest(mixedSrc, convertedJSON)
+	s2Manifest, err = manifestSchema2FromManifest(nil, mixedSrc, convertedJSON)
 	require.NoError(t, err)
 	assert.Equal(t, []types.BlobInfo{
 		{
@@ -826,7 +892,7 @@ func TestConvertToManifestSchema2(t *testing.T) {
 	convertedJSON, mt, err = res.Manifest(context.Background())
 	require.NoError(t, err)
 	assert.Equal(t, manifest.DockerV2Schema2MediaType, mt)
-	s2Manifest, err = manifestSchema2FromManifest(mixedSrc, convertedJSON)
+	s2Manifest, err = manifestSchema2FromManifest(nil, mixedSrc, convertedJSON)
 	require.NoError(t, err)
 	assert.Equal(t, []types.BlobInfo{
 		{
@@ -872,7 +938,7 @@ func TestConvertToV2S2WithInvalidMIMEType(t *testing.T) {
 	manifest, err := os.ReadFile(filepath.Join("fixtures", "oci1-invalid-media-type.json"))
 	require.NoError(t, err)
 
-	_, err = manifestOCI1FromManifest(originalSrc, manifest)
+	_, err = manifestOCI1FromManifest(nil, originalSrc, manifest)
 	require.NoError(t, err)
 }
 
@@ -6,9 +6,11 @@ import (
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/imagesource"
+	"github.com/containers/image/v5/internal/iolimits"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
 	"github.com/containers/image/v5/types"
 	"github.com/opencontainers/go-digest"
 )
@@ -25,6 +27,8 @@ type UnparsedImage struct {
 	// Valid iff cachedManifest is not nil.
 	cachedManifestMIMEType string
 	cachedSignatures       []signature.Signature // A private cache for Signatures(); nil if not yet known.
+	cachedConfigBlob       []byte                // A private cache for UntrustedConfigBlob(); nil if not yet known.
+	cachedAttestations     []signature.Sigstore  // A private cache for UntrustedAttestations(); nil if not yet known.
 }
 
 // UnparsedInstance returns a types.UnparsedImage implementation for (source, instanceDigest).
@@ -58,13 +62,11 @@ func (i *UnparsedImage) Manifest(ctx context.Context) ([]byte, string, error) {
 		// ImageSource.GetManifest does not do digest verification, but we do;
 		// this immediately protects also any user of types.Image.
 		if digest, haveDigest := i.expectedManifestDigest(); haveDigest {
-			matches, err := manifest.MatchesDigest(m, digest)
+			digested, err := manifest.VerifyManifestDigest(m, mt, digest)
 			if err != nil {
-				return nil, "", fmt.Errorf("computing manifest digest: %w", err)
-			}
-			if !matches {
-				return nil, "", fmt.Errorf("Manifest does not match provided manifest digest %s", digest)
+				return nil, "", err
 			}
+			m, mt = digested.Blob(), digested.MIMEType()
 		}
 
 		i.cachedManifest = m
@@ -117,3 +119,62 @@ func (i *UnparsedImage) UntrustedSignatures(ctx context.Context) ([]signature.Si
 	}
 	return i.cachedSignatures, nil
 }
+
+// UntrustedAttestations returns the image's attestations if the underlying ImageSource implements AttestationAccessor,
+// or an empty list otherwise. The result is cached; it is OK to call this however often you need.
+func (i *UnparsedImage) UntrustedAttestations(ctx context.Context) ([]signature.Sigstore, error) {
+	if i.cachedAttestations == nil {
+		accessor, ok := i.src.(private.AttestationAccessor)
+		if !ok {
+			return []signature.Sigstore{}, nil
+		}
+		attestations, err := accessor.GetAttestations(ctx, i.instanceDigest)
+		if err != nil {
+			return nil, err
+		}
+		if attestations == nil {
+			attestations = []signature.Sigstore{}
+		}
+		i.cachedAttestations = attestations
+	}
+	return i.cachedAttestations, nil
+}
+
+// UntrustedConfigBlob returns the config blob of a single image instance, as referenced by Manifest(), or nil if the manifest
+// does not refer to a separate config blob (e.g. for schema1 manifests and manifest lists).
+// The blob is verified to match the digest in the manifest, but the manifest itself may not have been verified yet.
+// The result is cached; it is OK to call this however often you need.
+func (i *UnparsedImage) UntrustedConfigBlob(ctx context.Context) ([]byte, error) {
+	if i.cachedConfigBlob == nil {
+		m, mt, err := i.Manifest(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if manifest.MIMETypeIsMultiImage(mt) {
+			return nil, nil
+		}
+		parsed, err := manifest.FromBlob(m, mt)
+		if err != nil {
+			return nil, err
+		}
+		info := parsed.ConfigInfo()
+		if info.Digest == "" {
+			return nil, nil
+		}
+		stream, _, err := i.src.GetBlob(ctx, info, none.NoCache)
+		if err != nil {
+			return nil, err
+		}
+		defer stream.Close()
+		blob, err := iolimits.ReadAtMost(stream, iolimits.MaxConfigBodySize)
+		if err != nil {
+			return nil, err
+		}
+		computedDigest := digest.FromBytes(blob)
+		if computedDigest != info.Digest {
+			return nil, fmt.Errorf("Download config.json digest %s does not match expected %s", computedDigest, info.Digest)
+		}
+		i.cachedConfigBlob = blob
+	}
+	return i.cachedConfigBlob, nil
+}
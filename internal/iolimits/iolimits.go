@@ -1,8 +1,10 @@
 package iolimits
 
 import (
-	"fmt"
 	"io"
+	"math"
+
+	"github.com/containers/image/v5/types"
 )
 
 // All constants below are intended to be used as limits for `ReadAtMost`. The
@@ -39,11 +41,54 @@ const (
 	// MaxTarFileManifestSize is the maximum allowed size of a (docker save)-like manifest (which may contain multiple images)
 	// The limit of 1 MB is considered to be greatly sufficient.
 	MaxTarFileManifestSize = megaByte
+	// MaxPolicyBodySize is the maximum allowed size of a signature policy, or of a signature of a policy.
+	// The limit of 4 MB is considered to be greatly sufficient.
+	MaxPolicyBodySize = 4 * megaByte
+	// MaxOCSPResponseBodySize is the maximum allowed size of an OCSP response.
+	// The limit of 1 MB is considered to be greatly sufficient.
+	MaxOCSPResponseBodySize = megaByte
+	// MaxTUFFileBodySize is the maximum allowed size of a TUF metadata or target file.
+	// The limit of 4 MB is considered to be greatly sufficient.
+	MaxTUFFileBodySize = 4 * megaByte
 )
 
+// ManifestSizeLimit returns the maximum size of a manifest to use with sys.
+func ManifestSizeLimit(sys *types.SystemContext) int {
+	return limitFromSystemContext(sys, func(sys *types.SystemContext) int64 { return sys.MaxManifestSize }, MaxManifestBodySize)
+}
+
+// ConfigSizeLimit returns the maximum size of an image config to use with sys.
+func ConfigSizeLimit(sys *types.SystemContext) int {
+	return limitFromSystemContext(sys, func(sys *types.SystemContext) int64 { return sys.MaxConfigSize }, MaxConfigBodySize)
+}
+
+// SignatureSizeLimit returns the maximum size of a signature to use with sys.
+func SignatureSizeLimit(sys *types.SystemContext) int {
+	return limitFromSystemContext(sys, func(sys *types.SystemContext) int64 { return sys.MaxSignatureSize }, MaxSignatureBodySize)
+}
+
+// limitFromSystemContext returns the value of field in sys, if set, or defaultLimit.
+// The value is clamped so that it can be used with ReadAtMost.
+func limitFromSystemContext(sys *types.SystemContext, field func(sys *types.SystemContext) int64, defaultLimit int) int {
+	if sys != nil {
+		if v := field(sys); v > 0 {
+			if v > math.MaxInt-1 {
+				return math.MaxInt - 1 // ReadAtMost reads up to limit+1 bytes
+			}
+			return int(v)
+		}
+	}
+	return defaultLimit
+}
+
 // ReadAtMost reads from reader and errors out if the specified limit (in bytes) is exceeded.
+// If the limit is exceeded, the returned error is a types.SizeLimitExceededError.
 func ReadAtMost(reader io.Reader, limit int) ([]byte, error) {
-	limitedReader := io.LimitReader(reader, int64(limit+1))
+	readLimit := int64(limit) + 1
+	if readLimit <= 0 { // limit == math.MaxInt64
+		readLimit = math.MaxInt64
+	}
+	limitedReader := io.LimitReader(reader, readLimit)
 
 	res, err := io.ReadAll(limitedReader)
 	if err != nil {
@@ -51,7 +96,7 @@ func ReadAtMost(reader io.Reader, limit int) ([]byte, error) {
 	}
 
 	if len(res) > limit {
-		return nil, fmt.Errorf("exceeded maximum allowed size of %d bytes", limit)
+		return nil, types.SizeLimitExceededError{Limit: int64(limit)}
 	}
 
 	return res, nil
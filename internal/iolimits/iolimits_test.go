@@ -2,9 +2,11 @@ package iolimits
 
 import (
 	"bytes"
+	"math"
 	"math/rand"
 	"testing"
 
+	"github.com/containers/image/v5/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -22,6 +24,7 @@ func TestReadAtMost(t *testing.T) {
 		{bytes.MinRead*5 - 1, bytes.MinRead * 5, true},
 		{bytes.MinRead * 5, bytes.MinRead * 5, true},
 		{bytes.MinRead*5 + 1, bytes.MinRead * 5, false},
+		{bytes.MinRead * 5, math.MaxInt, true},
 	} {
 		input := make([]byte, c.input)
 		_, err := rng.Read(input)
@@ -31,7 +34,38 @@ func TestReadAtMost(t *testing.T) {
 			assert.NoError(t, err)
 			assert.Equal(t, result, input)
 		} else {
-			assert.Error(t, err)
+			var limitErr types.SizeLimitExceededError
+			require.ErrorAs(t, err, &limitErr)
+			assert.Equal(t, int64(c.limit), limitErr.Limit)
 		}
 	}
 }
+
+func TestSizeLimits(t *testing.T) {
+	for _, c := range []struct {
+		fn           func(*types.SystemContext) int
+		set          func(*types.SystemContext, int64)
+		defaultLimit int
+	}{
+		{ManifestSizeLimit, func(sys *types.SystemContext, v int64) { sys.MaxManifestSize = v }, MaxManifestBodySize},
+		{ConfigSizeLimit, func(sys *types.SystemContext, v int64) { sys.MaxConfigSize = v }, MaxConfigBodySize},
+		{SignatureSizeLimit, func(sys *types.SystemContext, v int64) { sys.MaxSignatureSize = v }, MaxSignatureBodySize},
+	} {
+		assert.Equal(t, c.defaultLimit, c.fn(nil))
+		sys := &types.SystemContext{}
+		assert.Equal(t, c.defaultLimit, c.fn(sys))
+		c.set(sys, 1234)
+		assert.Equal(t, 1234, c.fn(sys))
+		c.set(sys, -1)
+		assert.Equal(t, c.defaultLimit, c.fn(sys))
+
+		// Very large values must remain usable with ReadAtMost
+		c.set(sys, math.MaxInt64)
+		limit := c.fn(sys)
+		assert.Equal(t, math.MaxInt-1, limit)
+		input := []byte("data")
+		res, err := ReadAtMost(bytes.NewReader(input), limit)
+		require.NoError(t, err)
+		assert.Equal(t, input, res)
+	}
+}
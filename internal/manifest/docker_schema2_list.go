@@ -2,6 +2,7 @@ package manifest
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 
 	platform "github.com/containers/image/v5/internal/pkg/platform"
@@ -144,6 +145,61 @@ func (index *Schema2List) EditInstances(editInstances []ListEdit) error {
 	return index.editInstances(editInstances)
 }
 
+// schema2ManifestDescriptorDigest returns the digest of d.
+func schema2ManifestDescriptorDigest(d Schema2ManifestDescriptor) digest.Digest {
+	return d.Digest
+}
+
+// AddInstance adds a copy of instance to the end of the list.
+func (list *Schema2ListPublic) AddInstance(instance Schema2ManifestDescriptor) error {
+	if err := validateListInstance(instance.Digest, instance.Size, instance.MediaType); err != nil {
+		return fmt.Errorf("Schema2List.AddInstance: %w", err)
+	}
+	if slices.ContainsFunc(list.Manifests, func(m Schema2ManifestDescriptor) bool { return m.Digest == instance.Digest }) {
+		return fmt.Errorf("Schema2List.AddInstance: instance %s is already present", instance.Digest)
+	}
+	// slices.Clone() here to ensure a private backing array;
+	// an external caller could have manually created Schema2ListPublic with a slice with extra capacity.
+	list.Manifests = append(slices.Clone(list.Manifests), schema2ManifestDescriptorClone(instance))
+	return nil
+}
+
+// RemoveInstance removes the instance with instanceDigest from the list.
+func (list *Schema2ListPublic) RemoveInstance(instanceDigest digest.Digest) error {
+	i, err := listInstanceIndex(list.Manifests, schema2ManifestDescriptorDigest, instanceDigest)
+	if err != nil {
+		return fmt.Errorf("Schema2List.RemoveInstance: %w", err)
+	}
+	list.Manifests = slices.Delete(slices.Clone(list.Manifests), i, i+1)
+	return nil
+}
+
+// ReplaceInstance replaces the instance with instanceDigest by a copy of instance, at the same position in the list.
+func (list *Schema2ListPublic) ReplaceInstance(instanceDigest digest.Digest, instance Schema2ManifestDescriptor) error {
+	if err := validateListInstance(instance.Digest, instance.Size, instance.MediaType); err != nil {
+		return fmt.Errorf("Schema2List.ReplaceInstance: %w", err)
+	}
+	i, err := listInstanceIndex(list.Manifests, schema2ManifestDescriptorDigest, instanceDigest)
+	if err != nil {
+		return fmt.Errorf("Schema2List.ReplaceInstance: %w", err)
+	}
+	if instance.Digest != instanceDigest && slices.ContainsFunc(list.Manifests, func(m Schema2ManifestDescriptor) bool { return m.Digest == instance.Digest }) {
+		return fmt.Errorf("Schema2List.ReplaceInstance: instance %s is already present", instance.Digest)
+	}
+	list.Manifests[i] = schema2ManifestDescriptorClone(instance)
+	return nil
+}
+
+// ReorderInstances reorders the instances of the list to match order, which must contain the digest of every instance exactly once.
+func (list *Schema2ListPublic) ReorderInstances(order []digest.Digest) error {
+	manifests, err := reorderedListInstances(list.Manifests, schema2ManifestDescriptorDigest, order)
+	if err != nil {
+		return fmt.Errorf("Schema2List.ReorderInstances: %w", err)
+	}
+	list.Manifests = manifests
+	return nil
+}
+
 func (list *Schema2ListPublic) ChooseInstanceByCompression(ctx *types.SystemContext, preferGzip types.OptionalBool) (digest.Digest, error) {
 	// ChooseInstanceByCompression is same as ChooseInstance for schema2 manifest list.
 	return list.ChooseInstance(ctx)
@@ -156,17 +212,35 @@ func (list *Schema2ListPublic) ChooseInstance(ctx *types.SystemContext) (digest.
 	if err != nil {
 		return "", fmt.Errorf("getting platform information %#v: %w", ctx, err)
 	}
-	for _, wantedPlatform := range wantedPlatforms {
-		for _, d := range list.Manifests {
-			imagePlatform := ociPlatformFromSchema2PlatformSpec(d.Platform)
-			if platform.MatchesPlatform(imagePlatform, wantedPlatform) {
-				return d.Digest, nil
-			}
-		}
+	if d, ok := list.chooseInstanceMatching(PlatformMatcherFromWanted(wantedPlatforms)); ok {
+		return d, nil
 	}
 	return "", fmt.Errorf("no image found in manifest list for architecture %s, variant %q, OS %s", wantedPlatforms[0].Architecture, wantedPlatforms[0].Variant, wantedPlatforms[0].OS)
 }
 
+// chooseInstanceMatching returns the digest of the instance most preferred by matcher, and true,
+// or "", false if matcher does not accept any instance.
+func (list *Schema2ListPublic) chooseInstanceMatching(matcher PlatformMatcher) (digest.Digest, bool) {
+	var bestDigest digest.Digest
+	bestScore, found := 0, false
+	for _, d := range list.Manifests {
+		score, ok := matcher(ociPlatformFromSchema2PlatformSpec(d.Platform))
+		if ok && (!found || score < bestScore) {
+			bestDigest, bestScore, found = d.Digest, score, true
+		}
+	}
+	return bestDigest, found
+}
+
+// ChooseInstanceMatching returns the digest of the instance most preferred by matcher, which allows callers
+// to customize platform matching compared to ChooseInstance.
+func (list *Schema2ListPublic) ChooseInstanceMatching(matcher PlatformMatcher) (digest.Digest, error) {
+	if d, ok := list.chooseInstanceMatching(matcher); ok {
+		return d, nil
+	}
+	return "", errors.New("no image found in manifest list matching the platform requirements")
+}
+
 // Serialize returns the list in a blob format.
 // NOTE: Serialize() does not in general reproduce the original blob if this object was loaded from one, even if no modifications were made!
 func (list *Schema2ListPublic) Serialize() ([]byte, error) {
@@ -187,27 +261,31 @@ func Schema2ListPublicFromComponents(components []Schema2ManifestDescriptor) *Sc
 		Manifests:     make([]Schema2ManifestDescriptor, len(components)),
 	}
 	for i, component := range components {
-		m := Schema2ManifestDescriptor{
-			Schema2Descriptor{
-				MediaType: component.MediaType,
-				Size:      component.Size,
-				Digest:    component.Digest,
-				URLs:      slices.Clone(component.URLs),
-			},
-			Schema2PlatformSpec{
-				Architecture: component.Platform.Architecture,
-				OS:           component.Platform.OS,
-				OSVersion:    component.Platform.OSVersion,
-				OSFeatures:   slices.Clone(component.Platform.OSFeatures),
-				Variant:      component.Platform.Variant,
-				Features:     slices.Clone(component.Platform.Features),
-			},
-		}
-		list.Manifests[i] = m
+		list.Manifests[i] = schema2ManifestDescriptorClone(component)
 	}
 	return &list
 }
 
+// schema2ManifestDescriptorClone returns a deep copy of d.
+func schema2ManifestDescriptorClone(d Schema2ManifestDescriptor) Schema2ManifestDescriptor {
+	return Schema2ManifestDescriptor{
+		Schema2Descriptor{
+			MediaType: d.MediaType,
+			Size:      d.Size,
+			Digest:    d.Digest,
+			URLs:      slices.Clone(d.URLs),
+		},
+		Schema2PlatformSpec{
+			Architecture: d.Platform.Architecture,
+			OS:           d.Platform.OS,
+			OSVersion:    d.Platform.OSVersion,
+			OSFeatures:   slices.Clone(d.Platform.OSFeatures),
+			Variant:      d.Platform.Variant,
+			Features:     slices.Clone(d.Platform.Features),
+		},
+	}
+}
+
 // Schema2ListPublicClone creates a deep copy of the passed-in list.
 // This is publicly visible as c/image/manifest.Schema2ListClone.
 func Schema2ListPublicClone(list *Schema2ListPublic) *Schema2ListPublic {
@@ -250,6 +328,9 @@ func Schema2ListPublicFromManifest(manifest []byte) (*Schema2ListPublic, error)
 		AllowedFieldManifests); err != nil {
 		return nil, err
 	}
+	if err := ValidateDescriptorCount("manifests in a manifest list", len(list.Manifests)); err != nil {
+		return nil, err
+	}
 	return &list, nil
 }
 
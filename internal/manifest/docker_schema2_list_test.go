@@ -107,3 +107,71 @@ func TestSchema2ListFromManifest(t *testing.T) {
 	// Extra fields are rejected
 	testValidManifestWithExtraFieldsIsRejected(t, parser, validManifest, []string{"config", "fsLayers", "history", "layers"})
 }
+
+func TestSchema2ListInstanceEditing(t *testing.T) {
+	validManifest, err := os.ReadFile(filepath.Join("testdata", "v2list.manifest.json"))
+	require.NoError(t, err)
+	list, err := Schema2ListPublicFromManifest(validManifest)
+	require.NoError(t, err)
+	original := list.Instances()
+	require.True(t, len(original) >= 2)
+	newDigest := digest.Digest("sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	otherDigest := digest.Digest("sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc")
+	newInstance := Schema2ManifestDescriptor{
+		Schema2Descriptor: Schema2Descriptor{MediaType: DockerV2Schema2MediaType, Size: 32, Digest: newDigest},
+		Platform:          Schema2PlatformSpec{Architecture: "arm64", OS: "linux", Features: []string{"f"}},
+	}
+
+	// AddInstance
+	err = list.AddInstance(newInstance)
+	require.NoError(t, err)
+	assert.Equal(t, append(slices.Clone(original), newDigest), list.Instances())
+	assert.Equal(t, newInstance, list.Manifests[len(original)])
+	newInstance.Platform.Features[0] = "modified" // The list contains a copy
+	assert.Equal(t, []string{"f"}, list.Manifests[len(original)].Platform.Features)
+	for _, invalid := range []Schema2Descriptor{
+		{MediaType: DockerV2Schema2MediaType, Size: 1, Digest: newDigest},    // Duplicate
+		{MediaType: DockerV2Schema2MediaType, Size: 1, Digest: "invalid"},    // Invalid digest
+		{MediaType: DockerV2Schema2MediaType, Size: -1, Digest: otherDigest}, // Invalid size
+		{MediaType: "", Size: 1, Digest: otherDigest},                        // No media type
+	} {
+		err := list.AddInstance(Schema2ManifestDescriptor{Schema2Descriptor: invalid})
+		assert.Error(t, err)
+	}
+	assert.Len(t, list.Manifests, len(original)+1)
+
+	// ReorderInstances
+	reversed := slices.Clone(list.Instances())
+	slices.Reverse(reversed)
+	err = list.ReorderInstances(reversed)
+	require.NoError(t, err)
+	assert.Equal(t, reversed, list.Instances())
+	err = list.ReorderInstances(reversed[1:])
+	assert.Error(t, err)
+	err = list.ReorderInstances(append([]digest.Digest{reversed[1]}, reversed[1:]...))
+	assert.Error(t, err)
+	assert.Equal(t, reversed, list.Instances())
+
+	// ReplaceInstance
+	err = list.ReplaceInstance(newDigest, Schema2ManifestDescriptor{
+		Schema2Descriptor: Schema2Descriptor{MediaType: DockerV2Schema2MediaType, Size: 2, Digest: otherDigest},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, otherDigest, list.Manifests[0].Digest)
+	err = list.ReplaceInstance(otherDigest, Schema2ManifestDescriptor{
+		Schema2Descriptor: Schema2Descriptor{MediaType: DockerV2Schema2MediaType, Size: 2, Digest: original[0]}, // Would be a duplicate
+	})
+	assert.Error(t, err)
+	err = list.ReplaceInstance(newDigest, Schema2ManifestDescriptor{
+		Schema2Descriptor: Schema2Descriptor{MediaType: DockerV2Schema2MediaType, Size: 2, Digest: newDigest}, // Not present
+	})
+	assert.Error(t, err)
+
+	// RemoveInstance
+	err = list.RemoveInstance(otherDigest)
+	require.NoError(t, err)
+	assert.Len(t, list.Manifests, len(original))
+	assert.False(t, slices.Contains(list.Instances(), otherDigest))
+	err = list.RemoveInstance(otherDigest)
+	assert.Error(t, err)
+}
@@ -0,0 +1,93 @@
+package manifest
+
+import (
+	"fmt"
+
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Limits on the contents of parsed manifests and image configurations, so that hostile input can't
+// cause consumers to make pathologically large allocations (e.g. one per layer or per platform).
+// They are far above the values used by any legitimate image.
+const (
+	// MaxDescriptors is the maximum number of layers in a manifest, or of manifests in an index or a manifest list.
+	MaxDescriptors = 10000
+	// MaxHistoryEntries is the maximum number of history entries in an image configuration, or in a schema1 manifest.
+	MaxHistoryEntries = 10000
+	// MaxAnnotationsSize is the maximum total size, in bytes, of keys and values in a single annotations map.
+	MaxAnnotationsSize = 256 * 1024
+)
+
+// LimitExceededError (detected via errors.As) is returned when parsed data exceeds one of the limits above.
+// It also matches types.ErrManifestInvalid via errors.Is.
+//
+// This is publicly visible as c/image/manifest.LimitExceededError.
+type LimitExceededError struct {
+	What  string // A description of the limited value, e.g. "manifests in an index"
+	Value int
+	Limit int
+}
+
+func (e LimitExceededError) Error() string {
+	return fmt.Sprintf("too many %s: %d, at most %d allowed", e.What, e.Value, e.Limit)
+}
+
+// Is allows matching LimitExceededError against types.ErrManifestInvalid using errors.Is.
+func (e LimitExceededError) Is(target error) bool {
+	return target == types.ErrManifestInvalid
+}
+
+// ValidateDescriptorCount returns a LimitExceededError if count of what exceeds MaxDescriptors.
+func ValidateDescriptorCount(what string, count int) error {
+	if count > MaxDescriptors {
+		return LimitExceededError{What: what, Value: count, Limit: MaxDescriptors}
+	}
+	return nil
+}
+
+// ValidateHistoryCount returns a LimitExceededError if count exceeds MaxHistoryEntries.
+func ValidateHistoryCount(count int) error {
+	if count > MaxHistoryEntries {
+		return LimitExceededError{What: "history entries", Value: count, Limit: MaxHistoryEntries}
+	}
+	return nil
+}
+
+// ValidateAnnotations returns a LimitExceededError if annotations are larger than MaxAnnotationsSize.
+func ValidateAnnotations(annotations map[string]string) error {
+	size := 0
+	for k, v := range annotations {
+		size += len(k) + len(v)
+	}
+	if size > MaxAnnotationsSize {
+		return LimitExceededError{What: "bytes of annotations", Value: size, Limit: MaxAnnotationsSize}
+	}
+	return nil
+}
+
+// ValidateDescriptorAnnotations returns a LimitExceededError if the annotations of any of descriptors are too large.
+func ValidateDescriptorAnnotations(descriptors ...imgspecv1.Descriptor) error {
+	for _, d := range descriptors {
+		if err := ValidateAnnotations(d.Annotations); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateIndexLimits returns a LimitExceededError if index exceeds the limits above.
+func ValidateIndexLimits(index *imgspecv1.Index) error {
+	if err := ValidateDescriptorCount("manifests in an index", len(index.Manifests)); err != nil {
+		return err
+	}
+	if err := ValidateAnnotations(index.Annotations); err != nil {
+		return err
+	}
+	if index.Subject != nil {
+		if err := ValidateDescriptorAnnotations(*index.Subject); err != nil {
+			return err
+		}
+	}
+	return ValidateDescriptorAnnotations(index.Manifests...)
+}
@@ -0,0 +1,82 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimitExceededError(t *testing.T) {
+	err := ValidateDescriptorCount("layers in a manifest", MaxDescriptors+1)
+	var e LimitExceededError
+	require.True(t, errors.As(err, &e))
+	assert.Equal(t, LimitExceededError{What: "layers in a manifest", Value: MaxDescriptors + 1, Limit: MaxDescriptors}, e)
+	assert.ErrorIs(t, err, types.ErrManifestInvalid)
+	assert.NotErrorIs(t, err, types.ErrNotFound)
+}
+
+func TestValidateLimits(t *testing.T) {
+	assert.NoError(t, ValidateDescriptorCount("manifests", MaxDescriptors))
+	assert.Error(t, ValidateDescriptorCount("manifests", MaxDescriptors+1))
+	assert.NoError(t, ValidateHistoryCount(MaxHistoryEntries))
+	assert.Error(t, ValidateHistoryCount(MaxHistoryEntries+1))
+
+	assert.NoError(t, ValidateAnnotations(nil))
+	assert.NoError(t, ValidateAnnotations(map[string]string{"k": strings.Repeat("v", MaxAnnotationsSize-1)}))
+	assert.Error(t, ValidateAnnotations(map[string]string{"k": strings.Repeat("v", MaxAnnotationsSize)}))
+	large := map[string]string{}
+	for i := 0; i < 3; i++ {
+		large[fmt.Sprintf("%d", i)] = strings.Repeat("v", MaxAnnotationsSize/3)
+	}
+	assert.Error(t, ValidateAnnotations(large))
+}
+
+func TestOCI1IndexLimits(t *testing.T) {
+	desc := imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageManifest, Digest: digest.FromString("m"), Size: 1}
+	largeAnnotations := map[string]string{"k": strings.Repeat("v", MaxAnnotationsSize)}
+	for _, c := range []struct {
+		name  string
+		index func(*imgspecv1.Index)
+	}{
+		{"too many manifests", func(i *imgspecv1.Index) {
+			i.Manifests = make([]imgspecv1.Descriptor, MaxDescriptors+1)
+			for j := range i.Manifests {
+				i.Manifests[j] = desc
+			}
+		}},
+		{"index annotations", func(i *imgspecv1.Index) { i.Annotations = largeAnnotations }},
+		{"descriptor annotations", func(i *imgspecv1.Index) {
+			d := desc
+			d.Annotations = largeAnnotations
+			i.Manifests = []imgspecv1.Descriptor{desc, d}
+		}},
+		{"subject annotations", func(i *imgspecv1.Index) {
+			d := desc
+			d.Annotations = largeAnnotations
+			i.Subject = &d
+		}},
+	} {
+		index := OCI1IndexPublicFromComponents([]imgspecv1.Descriptor{desc}, nil)
+		require.NoError(t, ValidateIndexLimits(&index.Index), c.name)
+		c.index(&index.Index)
+		blob, err := index.Serialize()
+		require.NoError(t, err, c.name)
+		_, err = OCI1IndexPublicFromManifest(blob)
+		var e LimitExceededError
+		assert.ErrorAs(t, err, &e, c.name)
+	}
+
+	list := Schema2ListPublicFromComponents(make([]Schema2ManifestDescriptor, MaxDescriptors+1))
+	blob, err := list.Serialize()
+	require.NoError(t, err)
+	_, err = Schema2ListPublicFromManifest(blob)
+	var e LimitExceededError
+	assert.ErrorAs(t, err, &e)
+}
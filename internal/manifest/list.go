@@ -3,6 +3,7 @@ package manifest
 import (
 	"fmt"
 
+	"github.com/containers/image/v5/internal/set"
 	compression "github.com/containers/image/v5/pkg/compression/types"
 	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
@@ -56,6 +57,9 @@ type List interface {
 	// SystemContext ( or for the current platform if the SystemContext doesn't specify any detail ) and preferGzip for compression which
 	// when configured to OptionalBoolTrue and chooses best available compression when it is OptionalBoolFalse or left OptionalBoolUndefined.
 	ChooseInstanceByCompression(ctx *types.SystemContext, preferGzip types.OptionalBool) (digest.Digest, error)
+	// ChooseInstanceMatching selects the manifest most preferred by matcher, allowing the caller to customize
+	// platform matching compared to ChooseInstance.
+	ChooseInstanceMatching(matcher PlatformMatcher) (digest.Digest, error)
 	// Edit information about the list's instances. Contains Slice of ListEdit where each element
 	// is responsible for either Modifying or Adding a new instance to the Manifest. Operation is
 	// selected on the basis of configured ListOperation field.
@@ -129,3 +133,57 @@ func ListFromBlob(manifest []byte, manifestMIMEType string) (List, error) {
 	}
 	return nil, fmt.Errorf("Unimplemented manifest list MIME type %s (normalized as %s)", manifestMIMEType, normalized)
 }
+
+// validateListInstance validates the fields common to all descriptors of list instances.
+func validateListInstance(instanceDigest digest.Digest, size int64, mediaType string) error {
+	if err := instanceDigest.Validate(); err != nil {
+		return fmt.Errorf("instance %s has an invalid digest: %w", instanceDigest, err)
+	}
+	if size < 0 {
+		return fmt.Errorf("instance %s has an invalid size (%d)", instanceDigest, size)
+	}
+	if mediaType == "" {
+		return fmt.Errorf("instance %s has no media type", instanceDigest)
+	}
+	return nil
+}
+
+// listInstanceIndex returns the index of the only instance in instances with instanceDigest,
+// using getDigest to obtain the digest of an instance.
+func listInstanceIndex[T any](instances []T, getDigest func(T) digest.Digest, instanceDigest digest.Digest) (int, error) {
+	res := -1
+	for i, instance := range instances {
+		if getDigest(instance) == instanceDigest {
+			if res != -1 {
+				return -1, fmt.Errorf("instance %s is present more than once", instanceDigest)
+			}
+			res = i
+		}
+	}
+	if res == -1 {
+		return -1, fmt.Errorf("instance %s not found", instanceDigest)
+	}
+	return res, nil
+}
+
+// reorderedListInstances returns a copy of instances, ordered as in order, which must contain the digest of every instance exactly once.
+// getDigest is used to obtain the digest of an instance.
+func reorderedListInstances[T any](instances []T, getDigest func(T) digest.Digest, order []digest.Digest) ([]T, error) {
+	if len(order) != len(instances) {
+		return nil, fmt.Errorf("new order contains %d instances, but the list contains %d", len(order), len(instances))
+	}
+	res := make([]T, 0, len(instances))
+	seen := set.New[digest.Digest]()
+	for _, instanceDigest := range order {
+		if seen.Contains(instanceDigest) {
+			return nil, fmt.Errorf("instance %s is present in the new order more than once", instanceDigest)
+		}
+		seen.Add(instanceDigest)
+		i, err := listInstanceIndex(instances, getDigest, instanceDigest)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, instances[i])
+	}
+	return res, nil
+}
@@ -159,3 +159,113 @@ func TestChooseInstance(t *testing.T) {
 		}
 	}
 }
+
+func TestChooseInstanceMatching(t *testing.T) {
+	for _, c := range []struct {
+		listFile                          string
+		defaultArmV7, armNoVariant, amd64 digest.Digest
+	}{
+		{
+			listFile:     "schema2list-variants.json",
+			defaultArmV7: "sha256:f365626a556e58189fc21d099fc64603db0f440bff07f77c740989515c544a39",
+			armNoVariant: "sha256:c84b0a3a07b628bc4d62e5047d0f8dff80f7c00979e1e28a821a033ecda8fe53",
+			amd64:        "sha256:59eec8837a4d942cc19a52b8c09ea75121acc38114a2c68b98983ce9356b8610",
+		},
+		{
+			listFile:     "ocilist-variants.json",
+			defaultArmV7: "sha256:eeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeeee",
+			armNoVariant: "sha256:c84b0a3a07b628bc4d62e5047d0f8dff80f7c00979e1e28a821a033ecda8fe53",
+			amd64:        "sha256:59eec8837a4d942cc19a52b8c09ea75121acc38114a2c68b98983ce9356b8610",
+		},
+	} {
+		rawManifest, err := os.ReadFile(filepath.Join("testdata", c.listFile))
+		require.NoError(t, err)
+		list, err := ListFromBlob(rawManifest, GuessMIMEType(rawManifest))
+		require.NoError(t, err)
+
+		// The default matching
+		sys := &types.SystemContext{ArchitectureChoice: "arm", VariantChoice: "v7", OSChoice: "linux"}
+		wanted, err := WantedPlatforms(sys)
+		require.NoError(t, err)
+		d, err := list.ChooseInstanceMatching(PlatformMatcherFromWanted(wanted))
+		require.NoError(t, err, c.listFile)
+		assert.Equal(t, c.defaultArmV7, d, c.listFile)
+		expected, err := list.ChooseInstance(sys)
+		require.NoError(t, err, c.listFile)
+		assert.Equal(t, expected, d, c.listFile)
+
+		// Reordered preferences
+		d, err = list.ChooseInstanceMatching(PlatformMatcherFromWanted([]imgspecv1.Platform{
+			{OS: "linux", Architecture: "arm", Variant: ""},
+			{OS: "linux", Architecture: "arm", Variant: "v6"},
+		}))
+		require.NoError(t, err, c.listFile)
+		assert.Equal(t, c.armNoVariant, d, c.listFile)
+
+		// A fallback to an emulated architecture
+		d, err = list.ChooseInstanceMatching(func(p imgspecv1.Platform) (int, bool) {
+			switch p.Architecture {
+			case "s390x":
+				return 0, true
+			case "amd64":
+				return 1, true
+			default:
+				return 0, false
+			}
+		})
+		require.NoError(t, err, c.listFile)
+		assert.Equal(t, c.amd64, d, c.listFile)
+
+		// Nothing is accepted
+		_, err = list.ChooseInstanceMatching(func(p imgspecv1.Platform) (int, bool) { return 0, false })
+		assert.Error(t, err, c.listFile)
+	}
+}
+
+func TestChooseInstanceOSVersion(t *testing.T) {
+	const (
+		ltsc2019Old = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+		ltsc2019New = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+		ltsc2022    = "sha256:3333333333333333333333333333333333333333333333333333333333333333"
+		noVersion   = "sha256:4444444444444444444444444444444444444444444444444444444444444444"
+	)
+	instances := []struct {
+		digest    digest.Digest
+		osVersion string
+	}{
+		{ltsc2022, "10.0.20348.2227"},
+		{noVersion, ""},
+		{ltsc2019Old, "10.0.17763.1879"},
+		{ltsc2019New, "10.0.17763.5329"},
+	}
+	schema2 := Schema2ListPublicFromComponents(nil)
+	oci := OCI1IndexPublicFromComponents(nil, nil)
+	for _, i := range instances {
+		schema2.Manifests = append(schema2.Manifests, Schema2ManifestDescriptor{
+			Schema2Descriptor: Schema2Descriptor{MediaType: DockerV2Schema2MediaType, Size: 1, Digest: i.digest},
+			Platform:          Schema2PlatformSpec{Architecture: "amd64", OS: "windows", OSVersion: i.osVersion},
+		})
+		oci.Manifests = append(oci.Manifests, imgspecv1.Descriptor{
+			MediaType: imgspecv1.MediaTypeImageManifest, Size: 1, Digest: i.digest,
+			Platform: &imgspecv1.Platform{Architecture: "amd64", OS: "windows", OSVersion: i.osVersion},
+		})
+	}
+
+	for _, list := range []ListPublic{schema2, oci} {
+		for _, c := range []struct {
+			osVersion string
+			expected  digest.Digest
+		}{
+			{"10.0.17763.5329", ltsc2019Old}, // The revision is ignored; instances of the same build are ordered as in the list
+			{"10.0.17763", ltsc2019Old},      // No revision
+			{"10.0.20348.1000", ltsc2022},    // A different instance
+			{"10.0.25398.643", noVersion},    // No exact match, prefer an instance without a version
+			{"", ltsc2022},                   // No version preference: the first instance
+		} {
+			sys := &types.SystemContext{ArchitectureChoice: "amd64", OSChoice: "windows", OSVersionChoice: c.osVersion}
+			d, err := list.ChooseInstance(sys)
+			require.NoError(t, err, c.osVersion)
+			assert.Equal(t, c.expected, d, c.osVersion)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package manifest
 
 import (
 	"encoding/json"
+	"fmt"
 
 	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
 	"github.com/containers/libtrust"
@@ -69,12 +70,13 @@ func GuessMIMEType(manifest []byte) string {
 			Config struct {
 				MediaType string `json:"mediaType"`
 			} `json:"config"`
+			Layers json.RawMessage `json:"layers"`
 		}{}
 		if err := json.Unmarshal(manifest, &ociMan); err != nil {
 			return ""
 		}
 		switch ociMan.Config.MediaType {
-		case imgspecv1.MediaTypeImageConfig:
+		case imgspecv1.MediaTypeImageConfig, imgspecv1.MediaTypeEmptyJSON: // An image, or an OCI 1.1 artifact with an empty config.
 			return imgspecv1.MediaTypeImageManifest
 		case DockerV2Schema2ConfigMediaType:
 			// This case should not happen since a Docker image
@@ -84,17 +86,24 @@ func GuessMIMEType(manifest []byte) string {
 		}
 		// Maybe an image index or an OCI artifact.
 		ociIndex := struct {
-			Manifests []imgspecv1.Descriptor `json:"manifests"`
+			Manifests *[]imgspecv1.Descriptor `json:"manifests"`
 		}{}
 		if err := json.Unmarshal(manifest, &ociIndex); err != nil {
 			return ""
 		}
-		if len(ociIndex.Manifests) != 0 {
-			if ociMan.Config.MediaType == "" {
-				return imgspecv1.MediaTypeImageIndex
+		if ociIndex.Manifests != nil {
+			if len(*ociIndex.Manifests) == 0 {
+				// An empty index (e.g. an OCI 1.1 artifact index with an artifactType), as long as this doesn’t look like a manifest.
+				if ociMan.Config.MediaType == "" && ociMan.Layers == nil {
+					return imgspecv1.MediaTypeImageIndex
+				}
+			} else {
+				if ociMan.Config.MediaType == "" {
+					return imgspecv1.MediaTypeImageIndex
+				}
+				// FIXME: this is mixing media types of manifests and configs.
+				return ociMan.Config.MediaType
 			}
-			// FIXME: this is mixing media types of manifests and configs.
-			return ociMan.Config.MediaType
 		}
 		// It's most likely an OCI artifact with a custom config media
 		// type which is not (and cannot) be covered by the media-type
@@ -137,6 +146,63 @@ func MatchesDigest(manifest []byte, expectedDigest digest.Digest) (bool, error)
 	return expectedDigest == actualDigest, nil
 }
 
+// DigestedManifest is a manifest, together with its MIME type, which has been verified to match a digest.
+// Values can only be created by VerifyManifestDigest (the zero value is not valid), so holding a DigestedManifest
+// is proof that the verification has been done.
+// This is publicly visible as c/image/manifest.DigestedManifest.
+type DigestedManifest struct {
+	blob     []byte
+	mimeType string
+	digest   digest.Digest
+}
+
+// VerifyManifestDigest returns a DigestedManifest for manifest with mimeType, or an error if it does not match expectedDigest.
+// The same caveats as for MatchesDigest apply.
+// This is publicly visible as c/image/manifest.VerifyManifestDigest.
+func VerifyManifestDigest(manifest []byte, mimeType string, expectedDigest digest.Digest) (DigestedManifest, error) {
+	actualDigest, err := Digest(manifest)
+	if err != nil {
+		return DigestedManifest{}, fmt.Errorf("computing manifest digest: %w", err)
+	}
+	if actualDigest != expectedDigest {
+		return DigestedManifest{}, fmt.Errorf("manifest digest %s does not match expected digest %s", actualDigest, expectedDigest)
+	}
+	return DigestedManifest{
+		blob:     manifest,
+		mimeType: mimeType,
+		digest:   expectedDigest,
+	}, nil
+}
+
+// VerifyManifestDescriptor returns a DigestedManifest for manifest, or an error if it does not match desc
+// (its digest, and its size if desc.Size is set).
+// The MIME type of the result is desc.MediaType if set, otherwise mimeType.
+func VerifyManifestDescriptor(manifest []byte, mimeType string, desc imgspecv1.Descriptor) (DigestedManifest, error) {
+	if desc.Size > 0 && int64(len(manifest)) != desc.Size {
+		return DigestedManifest{}, fmt.Errorf("manifest size %d does not match expected size %d", len(manifest), desc.Size)
+	}
+	if desc.MediaType != "" {
+		mimeType = desc.MediaType
+	}
+	return VerifyManifestDigest(manifest, mimeType, desc.Digest)
+}
+
+// Blob returns the verified manifest.
+// The caller must not modify the returned value.
+func (m DigestedManifest) Blob() []byte {
+	return m.blob
+}
+
+// MIMEType returns the MIME type of the manifest, as provided to VerifyManifestDigest (it has not been verified).
+func (m DigestedManifest) MIMEType() string {
+	return m.mimeType
+}
+
+// Digest returns the digest the manifest has been verified to match.
+func (m DigestedManifest) Digest() digest.Digest {
+	return m.digest
+}
+
 // NormalizedMIMEType returns the effective MIME type of a manifest MIME type returned by a server,
 // centralizing various workarounds.
 // This is publicly visible as c/image/manifest.NormalizedMIMEType.
@@ -36,6 +36,9 @@ func TestGuessMIMEType(t *testing.T) {
 		{"ociv1nomime.manifest.json", imgspecv1.MediaTypeImageManifest},
 		{"ociv1nomime.artifact.json", imgspecv1.MediaTypeImageManifest},
 		{"ociv1nomime.image.index.json", imgspecv1.MediaTypeImageIndex},
+		{"ociv1nomime.artifact-empty-config.json", imgspecv1.MediaTypeImageManifest},
+		{"ociv1nomime.artifact-no-config.json", imgspecv1.MediaTypeImageManifest},
+		{"ociv1nomime.artifact.index.json", imgspecv1.MediaTypeImageIndex},
 	}
 
 	for _, c := range cases {
@@ -112,6 +115,68 @@ func TestMatchesDigest(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestVerifyManifestDigest(t *testing.T) {
+	for _, c := range []struct {
+		path           string
+		mimeType       string
+		expectedDigest digest.Digest
+	}{
+		{"v2s2.manifest.json", DockerV2Schema2MediaType, TestDockerV2S2ManifestDigest},
+		{"v2s1.manifest.json", DockerV2Schema1SignedMediaType, TestDockerV2S1ManifestDigest},
+	} {
+		manifest, err := os.ReadFile(filepath.Join("testdata", c.path))
+		require.NoError(t, err)
+		res, err := VerifyManifestDigest(manifest, c.mimeType, c.expectedDigest)
+		require.NoError(t, err, c.path)
+		assert.Equal(t, manifest, res.Blob(), c.path)
+		assert.Equal(t, c.mimeType, res.MIMEType(), c.path)
+		assert.Equal(t, c.expectedDigest, res.Digest(), c.path)
+	}
+
+	manifest, err := os.ReadFile(filepath.Join("testdata", "v2s2.manifest.json"))
+	require.NoError(t, err)
+	for _, d := range []digest.Digest{
+		TestDockerV2S1ManifestDigest,
+		digest.Digest("md5:2872f31c5c1f62a694fbd20c1e85257c"),
+		digest.Digest(""),
+	} {
+		_, err := VerifyManifestDigest(manifest, DockerV2Schema2MediaType, d)
+		assert.Error(t, err, d)
+	}
+
+	manifest, err = os.ReadFile("testdata/v2s1-invalid-signatures.manifest.json")
+	require.NoError(t, err)
+	_, err = VerifyManifestDigest(manifest, DockerV2Schema1SignedMediaType, digest.FromBytes(manifest))
+	assert.Error(t, err)
+}
+
+func TestVerifyManifestDescriptor(t *testing.T) {
+	manifest, err := os.ReadFile(filepath.Join("testdata", "v2s2.manifest.json"))
+	require.NoError(t, err)
+	size := int64(len(manifest))
+
+	for _, c := range []struct {
+		desc             imgspecv1.Descriptor
+		expectedMIMEType string // "" if an error is expected
+	}{
+		{imgspecv1.Descriptor{Digest: TestDockerV2S2ManifestDigest, Size: size, MediaType: DockerV2Schema2MediaType}, DockerV2Schema2MediaType},
+		{imgspecv1.Descriptor{Digest: TestDockerV2S2ManifestDigest, Size: size}, "text/plain"},
+		{imgspecv1.Descriptor{Digest: TestDockerV2S2ManifestDigest}, "text/plain"},
+		{imgspecv1.Descriptor{Digest: TestDockerV2S2ManifestDigest, Size: size + 1}, ""},
+		{imgspecv1.Descriptor{Digest: TestDockerV2S1ManifestDigest, Size: size}, ""},
+	} {
+		res, err := VerifyManifestDescriptor(manifest, "text/plain", c.desc)
+		if c.expectedMIMEType == "" {
+			assert.Error(t, err, c.desc)
+		} else {
+			require.NoError(t, err, c.desc)
+			assert.Equal(t, manifest, res.Blob(), c.desc)
+			assert.Equal(t, c.expectedMIMEType, res.MIMEType(), c.desc)
+			assert.Equal(t, c.desc.Digest, res.Digest(), c.desc)
+		}
+	}
+}
+
 func TestNormalizedMIMEType(t *testing.T) {
 	for _, c := range []string{ // Valid MIME types, normalized to themselves
 		DockerV2Schema1MediaType,
@@ -2,9 +2,12 @@ package manifest
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
+	"mime"
 	"runtime"
+	"strings"
 
 	platform "github.com/containers/image/v5/internal/pkg/platform"
 	compression "github.com/containers/image/v5/pkg/compression/types"
@@ -12,6 +15,7 @@ import (
 	"github.com/opencontainers/go-digest"
 	imgspec "github.com/opencontainers/image-spec/specs-go"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/exp/maps"
 	"golang.org/x/exp/slices"
 )
@@ -194,6 +198,140 @@ func (index *OCI1Index) EditInstances(editInstances []ListEdit) error {
 	return index.editInstances(editInstances)
 }
 
+// OCI1SubjectClone validates subject, a descriptor of the subject of an OCI1 manifest or index, and returns a deep copy of it.
+// This is used by SetSubject of both OCI1IndexPublic and c/image/manifest.OCI1.
+func OCI1SubjectClone(subject imgspecv1.Descriptor) (*imgspecv1.Descriptor, error) {
+	if err := subject.Digest.Validate(); err != nil {
+		return nil, fmt.Errorf("subject has an invalid digest %q: %w", subject.Digest, err)
+	}
+	if subject.Size < 0 {
+		return nil, fmt.Errorf("subject %s has an invalid size %d", subject.Digest, subject.Size)
+	}
+	if subject.MediaType == "" {
+		return nil, fmt.Errorf("subject %s has no media type", subject.Digest)
+	}
+	res := oci1IndexDescriptorClone(subject)
+	return &res, nil
+}
+
+// SetSubject sets the subject of the index, making it a referrer of the manifest described by subject.
+// If subject is nil, the index will have no subject.
+func (index *OCI1IndexPublic) SetSubject(subject *imgspecv1.Descriptor) error {
+	if subject == nil {
+		index.Subject = nil
+		return nil
+	}
+	s, err := OCI1SubjectClone(*subject)
+	if err != nil {
+		return fmt.Errorf("OCI1Index.SetSubject: %w", err)
+	}
+	index.Subject = s
+	return nil
+}
+
+// oci1IndexDescriptorDigest returns the digest of d.
+func oci1IndexDescriptorDigest(d imgspecv1.Descriptor) digest.Digest {
+	return d.Digest
+}
+
+// AddInstance adds a copy of instance to the end of the index.
+func (index *OCI1IndexPublic) AddInstance(instance imgspecv1.Descriptor) error {
+	if err := validateOCI1IndexInstance(instance); err != nil {
+		return fmt.Errorf("OCI1Index.AddInstance: %w", err)
+	}
+	if slices.ContainsFunc(index.Manifests, func(m imgspecv1.Descriptor) bool { return m.Digest == instance.Digest }) {
+		return fmt.Errorf("OCI1Index.AddInstance: instance %s is already present", instance.Digest)
+	}
+	// slices.Clone() here to ensure the slice uses a private backing array;
+	// an external caller could have manually created OCI1IndexPublic with a slice with extra capacity.
+	index.Manifests = append(slices.Clone(index.Manifests), oci1IndexDescriptorClone(instance))
+	return nil
+}
+
+// RemoveInstance removes the instance with instanceDigest from the index.
+func (index *OCI1IndexPublic) RemoveInstance(instanceDigest digest.Digest) error {
+	i, err := listInstanceIndex(index.Manifests, oci1IndexDescriptorDigest, instanceDigest)
+	if err != nil {
+		return fmt.Errorf("OCI1Index.RemoveInstance: %w", err)
+	}
+	index.Manifests = slices.Delete(slices.Clone(index.Manifests), i, i+1)
+	return nil
+}
+
+// ReplaceInstance replaces the instance with instanceDigest by a copy of instance, at the same position in the index.
+func (index *OCI1IndexPublic) ReplaceInstance(instanceDigest digest.Digest, instance imgspecv1.Descriptor) error {
+	if err := validateOCI1IndexInstance(instance); err != nil {
+		return fmt.Errorf("OCI1Index.ReplaceInstance: %w", err)
+	}
+	i, err := listInstanceIndex(index.Manifests, oci1IndexDescriptorDigest, instanceDigest)
+	if err != nil {
+		return fmt.Errorf("OCI1Index.ReplaceInstance: %w", err)
+	}
+	if instance.Digest != instanceDigest && slices.ContainsFunc(index.Manifests, func(m imgspecv1.Descriptor) bool { return m.Digest == instance.Digest }) {
+		return fmt.Errorf("OCI1Index.ReplaceInstance: instance %s is already present", instance.Digest)
+	}
+	index.Manifests[i] = oci1IndexDescriptorClone(instance)
+	return nil
+}
+
+// ReorderInstances reorders the instances of the index to match order, which must contain the digest of every instance exactly once.
+func (index *OCI1IndexPublic) ReorderInstances(order []digest.Digest) error {
+	manifests, err := reorderedListInstances(index.Manifests, oci1IndexDescriptorDigest, order)
+	if err != nil {
+		return fmt.Errorf("OCI1Index.ReorderInstances: %w", err)
+	}
+	index.Manifests = manifests
+	return nil
+}
+
+// SetInstanceAnnotations replaces all annotations of the instance with instanceDigest by a copy of annotations.
+// If annotations is empty, the instance will have no annotations.
+func (index *OCI1IndexPublic) SetInstanceAnnotations(instanceDigest digest.Digest, annotations map[string]string) error {
+	i, err := listInstanceIndex(index.Manifests, oci1IndexDescriptorDigest, instanceDigest)
+	if err != nil {
+		return fmt.Errorf("OCI1Index.SetInstanceAnnotations: %w", err)
+	}
+	if len(annotations) == 0 {
+		index.Manifests[i].Annotations = nil
+	} else {
+		index.Manifests[i].Annotations = maps.Clone(annotations)
+	}
+	return nil
+}
+
+// SetInstanceArtifactType sets the artifact type of the instance with instanceDigest.
+// If artifactType is "", the instance will have no artifact type.
+func (index *OCI1IndexPublic) SetInstanceArtifactType(instanceDigest digest.Digest, artifactType string) error {
+	if err := validateOCI1ArtifactType(artifactType); err != nil {
+		return fmt.Errorf("OCI1Index.SetInstanceArtifactType: %w", err)
+	}
+	i, err := listInstanceIndex(index.Manifests, oci1IndexDescriptorDigest, instanceDigest)
+	if err != nil {
+		return fmt.Errorf("OCI1Index.SetInstanceArtifactType: %w", err)
+	}
+	index.Manifests[i].ArtifactType = artifactType
+	return nil
+}
+
+// validateOCI1IndexInstance validates instance, a descriptor of an OCI1 index instance.
+func validateOCI1IndexInstance(instance imgspecv1.Descriptor) error {
+	if err := validateListInstance(instance.Digest, instance.Size, instance.MediaType); err != nil {
+		return err
+	}
+	return validateOCI1ArtifactType(instance.ArtifactType)
+}
+
+// validateOCI1ArtifactType validates artifactType, which may be "" if not set.
+func validateOCI1ArtifactType(artifactType string) error {
+	if artifactType == "" {
+		return nil
+	}
+	if _, _, err := mime.ParseMediaType(artifactType); err != nil {
+		return fmt.Errorf("invalid artifact type %q: %w", artifactType, err)
+	}
+	return nil
+}
+
 // instanceIsZstd returns true if instance is a zstd instance otherwise false.
 func instanceIsZstd(manifest imgspecv1.Descriptor) bool {
 	if value, ok := manifest.Annotations[OCI1InstanceAnnotationCompressionZSTD]; ok && value == "true" {
@@ -203,7 +341,7 @@ func instanceIsZstd(manifest imgspecv1.Descriptor) bool {
 }
 
 type instanceCandidate struct {
-	platformIndex    int           // Index of the candidate in platform.WantedPlatforms: lower numbers are preferred; or math.maxInt if the candidate doesn’t have a platform
+	platformScore    int           // Score of the candidate’s platform, as returned by a PlatformMatcher: lower numbers are preferred; or math.maxInt if the candidate doesn’t have a platform
 	isZstd           bool          // tells if particular instance if zstd instance
 	manifestPosition int           // A zero-based index of the instance in the manifest list
 	digest           digest.Digest // Instance digest
@@ -211,8 +349,8 @@ type instanceCandidate struct {
 
 func (ic instanceCandidate) isPreferredOver(other *instanceCandidate, preferGzip bool) bool {
 	switch {
-	case ic.platformIndex != other.platformIndex:
-		return ic.platformIndex < other.platformIndex
+	case ic.platformScore != other.platformScore:
+		return ic.platformScore < other.platformScore
 	case ic.isZstd != other.isZstd:
 		if !preferGzip {
 			return ic.isZstd
@@ -228,36 +366,37 @@ func (ic instanceCandidate) isPreferredOver(other *instanceCandidate, preferGzip
 // chooseInstance is a private equivalent to ChooseInstanceByCompression,
 // shared by ChooseInstance and ChooseInstanceByCompression.
 func (index *OCI1IndexPublic) chooseInstance(ctx *types.SystemContext, preferGzip types.OptionalBool) (digest.Digest, error) {
-	didPreferGzip := false
-	if preferGzip == types.OptionalBoolTrue {
-		didPreferGzip = true
-	}
 	wantedPlatforms, err := platform.WantedPlatforms(ctx)
 	if err != nil {
 		return "", fmt.Errorf("getting platform information %#v: %w", ctx, err)
 	}
+	if d, ok := index.chooseInstanceMatching(PlatformMatcherFromWanted(wantedPlatforms), preferGzip == types.OptionalBoolTrue); ok {
+		return d, nil
+	}
+	return "", fmt.Errorf("no image found in image index for architecture %s, variant %q, OS %s", wantedPlatforms[0].Architecture, wantedPlatforms[0].Variant, wantedPlatforms[0].OS)
+}
+
+// chooseInstanceMatching returns the digest of the instance most preferred by matcher, and true,
+// or "", false if matcher does not accept any instance.
+func (index *OCI1IndexPublic) chooseInstanceMatching(matcher PlatformMatcher, preferGzip bool) (digest.Digest, bool) {
 	var bestMatch *instanceCandidate
-	bestMatch = nil
 	for manifestIndex, d := range index.Manifests {
-		candidate := instanceCandidate{platformIndex: math.MaxInt, manifestPosition: manifestIndex, isZstd: instanceIsZstd(d), digest: d.Digest}
+		candidate := instanceCandidate{platformScore: math.MaxInt, manifestPosition: manifestIndex, isZstd: instanceIsZstd(d), digest: d.Digest}
 		if d.Platform != nil {
-			imagePlatform := ociPlatformClone(*d.Platform)
-			platformIndex := slices.IndexFunc(wantedPlatforms, func(wantedPlatform imgspecv1.Platform) bool {
-				return platform.MatchesPlatform(imagePlatform, wantedPlatform)
-			})
-			if platformIndex == -1 {
+			score, ok := matcher(ociPlatformClone(*d.Platform))
+			if !ok {
 				continue
 			}
-			candidate.platformIndex = platformIndex
+			candidate.platformScore = score
 		}
-		if bestMatch == nil || candidate.isPreferredOver(bestMatch, didPreferGzip) {
+		if bestMatch == nil || candidate.isPreferredOver(bestMatch, preferGzip) {
 			bestMatch = &candidate
 		}
 	}
-	if bestMatch != nil {
-		return bestMatch.digest, nil
+	if bestMatch == nil {
+		return "", false
 	}
-	return "", fmt.Errorf("no image found in image index for architecture %s, variant %q, OS %s", wantedPlatforms[0].Architecture, wantedPlatforms[0].Variant, wantedPlatforms[0].OS)
+	return bestMatch.digest, true
 }
 
 func (index *OCI1Index) ChooseInstanceByCompression(ctx *types.SystemContext, preferGzip types.OptionalBool) (digest.Digest, error) {
@@ -270,6 +409,16 @@ func (index *OCI1IndexPublic) ChooseInstance(ctx *types.SystemContext) (digest.D
 	return index.chooseInstance(ctx, types.OptionalBoolFalse)
 }
 
+// ChooseInstanceMatching returns the digest of the instance most preferred by matcher, which allows callers
+// to customize platform matching compared to ChooseInstance.
+// Instances which don’t specify a platform are acceptable, but less preferred than any instance accepted by matcher.
+func (index *OCI1IndexPublic) ChooseInstanceMatching(matcher PlatformMatcher) (digest.Digest, error) {
+	if d, ok := index.chooseInstanceMatching(matcher, false); ok {
+		return d, nil
+	}
+	return "", errors.New("no image found in image index matching the platform requirements")
+}
+
 // Serialize returns the index in a blob format.
 // NOTE: Serialize() does not in general reproduce the original blob if this object was loaded from one, even if no modifications were made!
 func (index *OCI1IndexPublic) Serialize() ([]byte, error) {
@@ -293,28 +442,39 @@ func OCI1IndexPublicFromComponents(components []imgspecv1.Descriptor, annotation
 		},
 	}
 	for i, component := range components {
-		var platform *imgspecv1.Platform
-		if component.Platform != nil {
-			platformCopy := ociPlatformClone(*component.Platform)
-			platform = &platformCopy
-		}
-		m := imgspecv1.Descriptor{
-			MediaType:   component.MediaType,
-			Size:        component.Size,
-			Digest:      component.Digest,
-			URLs:        slices.Clone(component.URLs),
-			Annotations: maps.Clone(component.Annotations),
-			Platform:    platform,
-		}
-		index.Manifests[i] = m
+		index.Manifests[i] = oci1IndexDescriptorClone(component)
 	}
 	return &index
 }
 
+// oci1IndexDescriptorClone returns a deep copy of d, a descriptor of an OCI1 index instance.
+func oci1IndexDescriptorClone(d imgspecv1.Descriptor) imgspecv1.Descriptor {
+	var platform *imgspecv1.Platform
+	if d.Platform != nil {
+		platformCopy := ociPlatformClone(*d.Platform)
+		platform = &platformCopy
+	}
+	return imgspecv1.Descriptor{
+		MediaType:    d.MediaType,
+		Size:         d.Size,
+		Digest:       d.Digest,
+		URLs:         slices.Clone(d.URLs),
+		Annotations:  maps.Clone(d.Annotations),
+		Platform:     platform,
+		ArtifactType: d.ArtifactType,
+	}
+}
+
 // OCI1IndexPublicClone creates a deep copy of the passed-in index.
 // This is publicly visible as c/image/manifest.OCI1IndexClone.
 func OCI1IndexPublicClone(index *OCI1IndexPublic) *OCI1IndexPublic {
-	return OCI1IndexPublicFromComponents(index.Manifests, index.Annotations)
+	res := OCI1IndexPublicFromComponents(index.Manifests, index.Annotations)
+	res.ArtifactType = index.ArtifactType
+	if index.Subject != nil {
+		subject := oci1IndexDescriptorClone(*index.Subject)
+		res.Subject = &subject
+	}
+	return res
 }
 
 // ToOCI1Index returns the index encoded as an OCI1 index.
@@ -324,6 +484,9 @@ func (index *OCI1IndexPublic) ToOCI1Index() (*OCI1IndexPublic, error) {
 
 // ToSchema2List returns the index encoded as a Schema2 list.
 func (index *OCI1IndexPublic) ToSchema2List() (*Schema2ListPublic, error) {
+	if dropped := index.fieldsDroppedInSchema2List(); len(dropped) != 0 {
+		logrus.Warnf("Converting an OCI index to %s drops %s, which can't be represented", DockerV2ListMediaType, strings.Join(dropped, ", "))
+	}
 	components := make([]Schema2ManifestDescriptor, 0, len(index.Manifests))
 	for _, manifest := range index.Manifests {
 		platform := manifest.Platform
@@ -347,6 +510,24 @@ func (index *OCI1IndexPublic) ToSchema2List() (*Schema2ListPublic, error) {
 	return s2, nil
 }
 
+// fieldsDroppedInSchema2List returns descriptions of the non-empty fields of index which are lost when converting it to a schema2 list.
+func (index *OCI1IndexPublic) fieldsDroppedInSchema2List() []string {
+	res := []string{}
+	if len(index.Annotations) != 0 {
+		res = append(res, "index annotations")
+	}
+	if index.ArtifactType != "" {
+		res = append(res, "the artifact type")
+	}
+	if index.Subject != nil {
+		res = append(res, "the subject")
+	}
+	if slices.ContainsFunc(index.Manifests, func(m imgspecv1.Descriptor) bool { return len(m.Annotations) != 0 || m.ArtifactType != "" }) {
+		res = append(res, "instance annotations and artifact types")
+	}
+	return res
+}
+
 // OCI1IndexPublicFromManifest creates an OCI1 manifest index instance from marshalled
 // JSON, presumably generated by encoding a OCI1 manifest index.
 // This is publicly visible as c/image/manifest.OCI1IndexFromManifest.
@@ -366,6 +547,9 @@ func OCI1IndexPublicFromManifest(manifest []byte) (*OCI1IndexPublic, error) {
 		AllowedFieldManifests); err != nil {
 		return nil, err
 	}
+	if err := ValidateIndexLimits(&index.Index); err != nil {
+		return nil, err
+	}
 	return &index, nil
 }
 
@@ -406,6 +590,11 @@ func (index *OCI1Index) Clone() ListPublic {
 	return index.CloneInternal()
 }
 
+// OCI1IndexFromComponents creates an OCI1 image index instance from the supplied data.
+func OCI1IndexFromComponents(components []imgspecv1.Descriptor, annotations map[string]string) *OCI1Index {
+	return oci1IndexFromPublic(OCI1IndexPublicFromComponents(components, annotations))
+}
+
 // OCI1IndexFromManifest creates a OCI1 manifest list instance from marshalled
 // JSON, presumably generated by encoding a OCI1 manifest list.
 func OCI1IndexFromManifest(manifest []byte) (*OCI1Index, error) {
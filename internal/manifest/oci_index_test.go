@@ -263,3 +263,157 @@ func TestOCI1IndexChooseInstanceByCompression(t *testing.T) {
 		}
 	}
 }
+
+func TestOCI1IndexInstanceEditing(t *testing.T) {
+	validManifest, err := os.ReadFile(filepath.Join("testdata", "ociv1.image.index.json"))
+	require.NoError(t, err)
+	index, err := OCI1IndexPublicFromManifest(validManifest)
+	require.NoError(t, err)
+	original := index.Instances()
+	require.Len(t, original, 2)
+	newDigest := digest.Digest("sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb")
+	otherDigest := digest.Digest("sha256:cccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccccc")
+	newInstance := imgspecv1.Descriptor{
+		MediaType:    imgspecv1.MediaTypeImageManifest,
+		Size:         32,
+		Digest:       newDigest,
+		Platform:     &imgspecv1.Platform{Architecture: "arm64", OS: "linux"},
+		ArtifactType: "application/vnd.example+type",
+	}
+
+	// AddInstance
+	err = index.AddInstance(newInstance)
+	require.NoError(t, err)
+	assert.Equal(t, []digest.Digest{original[0], original[1], newDigest}, index.Instances())
+	assert.Equal(t, newInstance, index.Manifests[2])
+	newInstance.Platform.Architecture = "s390x" // The index contains a copy
+	assert.Equal(t, "arm64", index.Manifests[2].Platform.Architecture)
+	for _, invalid := range []imgspecv1.Descriptor{
+		{MediaType: imgspecv1.MediaTypeImageManifest, Size: 1, Digest: newDigest},    // Duplicate
+		{MediaType: imgspecv1.MediaTypeImageManifest, Size: 1, Digest: "invalid"},    // Invalid digest
+		{MediaType: imgspecv1.MediaTypeImageManifest, Size: -1, Digest: otherDigest}, // Invalid size
+		{MediaType: "", Size: 1, Digest: otherDigest},                                // No media type
+		{MediaType: imgspecv1.MediaTypeImageManifest, Size: 1, Digest: otherDigest, ArtifactType: "not a MIME type"},
+	} {
+		err := index.AddInstance(invalid)
+		assert.Error(t, err)
+	}
+	assert.Len(t, index.Manifests, 3)
+
+	// SetInstanceAnnotations
+	err = index.SetInstanceAnnotations(newDigest, map[string]string{"a": "b"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "b"}, index.Manifests[2].Annotations)
+	err = index.SetInstanceAnnotations(newDigest, map[string]string{})
+	require.NoError(t, err)
+	assert.Nil(t, index.Manifests[2].Annotations)
+	err = index.SetInstanceAnnotations(otherDigest, map[string]string{"a": "b"})
+	assert.Error(t, err)
+
+	// SetInstanceArtifactType
+	err = index.SetInstanceArtifactType(newDigest, "application/vnd.other+type")
+	require.NoError(t, err)
+	assert.Equal(t, "application/vnd.other+type", index.Manifests[2].ArtifactType)
+	err = index.SetInstanceArtifactType(newDigest, "")
+	require.NoError(t, err)
+	assert.Equal(t, "", index.Manifests[2].ArtifactType)
+	err = index.SetInstanceArtifactType(newDigest, "not a MIME type")
+	assert.Error(t, err)
+	err = index.SetInstanceArtifactType(otherDigest, "application/vnd.other+type")
+	assert.Error(t, err)
+
+	// ReorderInstances
+	err = index.ReorderInstances([]digest.Digest{newDigest, original[1], original[0]})
+	require.NoError(t, err)
+	assert.Equal(t, []digest.Digest{newDigest, original[1], original[0]}, index.Instances())
+	for _, invalid := range [][]digest.Digest{
+		{newDigest, original[1]},                           // Missing an instance
+		{newDigest, original[1], original[1]},              // Duplicate
+		{newDigest, original[1], original[0], otherDigest}, // Extra instance
+		{newDigest, original[1], otherDigest},              // Unknown instance
+	} {
+		err := index.ReorderInstances(invalid)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, []digest.Digest{newDigest, original[1], original[0]}, index.Instances())
+
+	// ReplaceInstance
+	err = index.ReplaceInstance(original[1], imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageManifest, Size: 2, Digest: otherDigest})
+	require.NoError(t, err)
+	assert.Equal(t, []digest.Digest{newDigest, otherDigest, original[0]}, index.Instances())
+	err = index.ReplaceInstance(otherDigest, imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageManifest, Size: 2, Digest: newDigest}) // Would be a duplicate
+	assert.Error(t, err)
+	err = index.ReplaceInstance(original[1], imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageManifest, Size: 2, Digest: original[1]}) // Not present
+	assert.Error(t, err)
+	err = index.ReplaceInstance(otherDigest, imgspecv1.Descriptor{MediaType: "", Size: 2, Digest: otherDigest}) // Invalid
+	assert.Error(t, err)
+
+	// RemoveInstance
+	err = index.RemoveInstance(otherDigest)
+	require.NoError(t, err)
+	assert.Equal(t, []digest.Digest{newDigest, original[0]}, index.Instances())
+	err = index.RemoveInstance(otherDigest)
+	assert.Error(t, err)
+
+	// Operations on an ambiguous digest fail
+	index.Manifests = append(index.Manifests, index.Manifests[0])
+	err = index.RemoveInstance(newDigest)
+	assert.Error(t, err)
+
+	// Serialization is deterministic
+	index.Manifests = index.Manifests[:2]
+	serialized1, err := index.Serialize()
+	require.NoError(t, err)
+	clone := OCI1IndexPublicClone(index)
+	serialized2, err := clone.Serialize()
+	require.NoError(t, err)
+	assert.Equal(t, serialized1, serialized2)
+}
+
+func TestOCI1IndexSetSubject(t *testing.T) {
+	validManifest, err := os.ReadFile(filepath.Join("testdata", "ociv1.image.index.json"))
+	require.NoError(t, err)
+	index, err := OCI1IndexPublicFromManifest(validManifest)
+	require.NoError(t, err)
+
+	subject := imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Digest:    "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270",
+		Size:      7682,
+	}
+	err = index.SetSubject(&subject)
+	require.NoError(t, err)
+	assert.Equal(t, &subject, index.Subject)
+	assert.Equal(t, &subject, OCI1IndexPublicClone(index).Subject)
+
+	err = index.SetSubject(&imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageIndex, Digest: "invalid", Size: 1})
+	assert.Error(t, err)
+	assert.Equal(t, &subject, index.Subject)
+
+	err = index.SetSubject(nil)
+	require.NoError(t, err)
+	assert.Nil(t, index.Subject)
+}
+
+func TestOCI1IndexFieldsDroppedInSchema2List(t *testing.T) {
+	validManifest, err := os.ReadFile(filepath.Join("testdata", "ociv1.image.index.json"))
+	require.NoError(t, err)
+	index, err := OCI1IndexPublicFromManifest(validManifest)
+	require.NoError(t, err)
+	index.Annotations = nil
+	for i := range index.Manifests {
+		index.Manifests[i].Annotations = nil
+	}
+	assert.Equal(t, []string{}, index.fieldsDroppedInSchema2List())
+
+	index.Annotations = map[string]string{"a": "b"}
+	index.ArtifactType = "application/x-test"
+	index.Subject = &imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageIndex,
+		Digest:    "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270",
+		Size:      7682,
+	}
+	index.Manifests[0].ArtifactType = "application/x-test"
+	assert.Equal(t, []string{"index annotations", "the artifact type", "the subject", "instance annotations and artifact types"},
+		index.fieldsDroppedInSchema2List())
+}
@@ -0,0 +1,40 @@
+package manifest
+
+import (
+	"github.com/containers/image/v5/internal/pkg/platform"
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/exp/slices"
+)
+
+// PlatformMatcher decides whether an instance of a manifest list, with the specified platform, is acceptable,
+// and how much it is preferred: if ok, instances with lower score values are preferred.
+// Instances with equal scores are ordered as they appear in the manifest list.
+// This is publicly visible as c/image/manifest.PlatformMatcher.
+type PlatformMatcher func(p imgspecv1.Platform) (score int, ok bool)
+
+// WantedPlatforms returns all platforms compatible with the platform described by ctx, or with the current platform
+// if ctx does not specify any details; the most preferred platform is first.
+// This is publicly visible as c/image/manifest.WantedPlatforms.
+func WantedPlatforms(ctx *types.SystemContext) ([]imgspecv1.Platform, error) {
+	return platform.WantedPlatforms(ctx)
+}
+
+// PlatformMatcherFromWanted returns a PlatformMatcher which accepts instances matching an item of wanted
+// (comparing the OS, architecture and variant), preferring earlier items.
+// If the matching item specifies an OS version, instances with the same major.minor.build OS version are preferred,
+// then instances which don’t specify an OS version, then instances with other OS versions.
+// This is the matching ChooseInstance uses, with wanted set to the return value of WantedPlatforms.
+// This is publicly visible as c/image/manifest.PlatformMatcherFromWanted.
+func PlatformMatcherFromWanted(wanted []imgspecv1.Platform) PlatformMatcher {
+	wanted = slices.Clone(wanted)
+	return func(p imgspecv1.Platform) (int, bool) {
+		i := slices.IndexFunc(wanted, func(wantedPlatform imgspecv1.Platform) bool {
+			return platform.MatchesPlatform(p, wantedPlatform)
+		})
+		if i == -1 {
+			return -1, false
+		}
+		return i*platform.OSVersionPreferences + platform.OSVersionPreference(p.OSVersion, wanted[i].OSVersion), true
+	}
+}
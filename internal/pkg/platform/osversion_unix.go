@@ -0,0 +1,9 @@
+//go:build !windows
+
+package platform
+
+// hostOSVersion returns the version of the host OS, in the format used by the os.version field of platforms,
+// or "" if it is not relevant for choosing images on this OS.
+func hostOSVersion() string {
+	return ""
+}
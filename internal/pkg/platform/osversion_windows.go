@@ -0,0 +1,15 @@
+//go:build windows
+
+package platform
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// hostOSVersion returns the major.minor.build version of the host OS, in the format used by the os.version field of platforms.
+func hostOSVersion() string {
+	v := windows.RtlGetVersion()
+	return fmt.Sprintf("%d.%d.%d", v.MajorVersion, v.MinorVersion, v.BuildNumber)
+}
@@ -154,7 +154,8 @@ var compatibility = map[string][]string{
 // the most compatible platform is first.
 // If some option (arch, os, variant) is not present, a value from current platform is detected.
 func WantedPlatforms(ctx *types.SystemContext) ([]imgspecv1.Platform, error) {
-	// Note that this does not use Platform.OSFeatures and Platform.OSVersion at all.
+	// Note that this does not use Platform.OSFeatures at all, and only sets Platform.OSVersion
+	// (to be used as a preference by OSVersionPreference, not a requirement).
 	// The fields are not specified by the OCI specification, as of version 1.1, usefully enough
 	// to be interoperable, anyway.
 
@@ -179,6 +180,13 @@ func WantedPlatforms(ctx *types.SystemContext) ([]imgspecv1.Platform, error) {
 		wantedOS = ctx.OSChoice
 	}
 
+	wantedOSVersion := ""
+	if ctx != nil && ctx.OSVersionChoice != "" {
+		wantedOSVersion = ctx.OSVersionChoice
+	} else if wantedOS == runtime.GOOS {
+		wantedOSVersion = hostOSVersion()
+	}
+
 	var variants []string = nil
 	if wantedVariant != "" {
 		// If the user requested a specific variant, we'll walk down
@@ -209,6 +217,7 @@ func WantedPlatforms(ctx *types.SystemContext) ([]imgspecv1.Platform, error) {
 			OS:           wantedOS,
 			Architecture: wantedArch,
 			Variant:      v,
+			OSVersion:    wantedOSVersion,
 		})
 	}
 	return res, nil
@@ -221,3 +230,34 @@ func MatchesPlatform(image imgspecv1.Platform, wanted imgspecv1.Platform) bool {
 		image.OS == wanted.OS &&
 		image.Variant == wanted.Variant
 }
+
+// OSVersionPreferences is the number of distinct values returned by OSVersionPreference.
+const OSVersionPreferences = 3
+
+// OSVersionPreference returns how much an image with OS version imageOSVersion is preferred when wantedOSVersion is wanted;
+// lower values are preferred, and all values are smaller than OSVersionPreferences.
+// Versions are compared using only their major.minor.build prefix, as is relevant for Windows (where images must match
+// the build of the host to run with process isolation, but the revision does not matter).
+// Images with the same build are preferred, then images which don’t specify a version, then all other images.
+// If wantedOSVersion is "", all images are equally preferred.
+func OSVersionPreference(imageOSVersion, wantedOSVersion string) int {
+	switch {
+	case wantedOSVersion == "":
+		return 0
+	case imageOSVersion != "" && osVersionBuild(imageOSVersion) == osVersionBuild(wantedOSVersion):
+		return 0
+	case imageOSVersion == "":
+		return 1
+	default:
+		return 2
+	}
+}
+
+// osVersionBuild returns the major.minor.build prefix of version.
+func osVersionBuild(version string) string {
+	parts := strings.SplitN(version, ".", 4)
+	if len(parts) > 3 {
+		parts = parts[:3]
+	}
+	return strings.Join(parts, ".")
+}
@@ -45,6 +45,12 @@ func TestWantedPlatforms(t *testing.T) {
 				{OS: "linux", Architecture: "arm64", Variant: "v8"},
 			},
 		},
+		{ // Windows with an OS version
+			types.SystemContext{ArchitectureChoice: "amd64", OSChoice: "windows", OSVersionChoice: "10.0.17763.1879"},
+			[]imgspecv1.Platform{
+				{OS: "windows", Architecture: "amd64", Variant: "", OSVersion: "10.0.17763.1879"},
+			},
+		},
 		{ // Custom (completely unrecognized data)
 			types.SystemContext{ArchitectureChoice: "armel", OSChoice: "freeBSD", VariantChoice: "custom"},
 			[]imgspecv1.Platform{
@@ -59,3 +65,24 @@ func TestWantedPlatforms(t *testing.T) {
 		assert.Equal(t, c.expected, platforms, testName)
 	}
 }
+
+func TestOSVersionPreference(t *testing.T) {
+	for _, c := range []struct {
+		image, wanted string
+		expected      int
+	}{
+		{"10.0.17763.1879", "10.0.17763.1879", 0},
+		{"10.0.17763.5329", "10.0.17763.1879", 0},
+		{"10.0.17763", "10.0.17763.1879", 0},
+		{"10.0.17763.1879", "10.0.17763", 0},
+		{"", "10.0.17763.1879", 1},
+		{"10.0.20348.2227", "10.0.17763.1879", 2},
+		{"10.0.1776", "10.0.17763", 2},
+		{"10.0.20348.2227", "", 0},
+		{"", "", 0},
+	} {
+		res := OSVersionPreference(c.image, c.wanted)
+		assert.Equal(t, c.expected, res, fmt.Sprintf("%q/%q", c.image, c.wanted))
+		assert.Less(t, res, OSVersionPreferences)
+	}
+}
@@ -78,6 +78,18 @@ type ImageDestination interface {
 	ImageDestinationInternalOnly
 }
 
+// ImageDestinationWithCommitProgress is an optional extension of ImageDestination, implemented by
+// destinations which apply layers (a potentially slow operation) before the image is committed.
+type ImageDestinationWithCommitProgress interface {
+	// SetCommitProgress sets a channel to send types.ProgressEventApplying, types.ProgressEventApplied and
+	// types.ProgressEventRolledBack events to.  It must be called before any blobs are written.
+	SetCommitProgress(channel chan<- types.ProgressProperties)
+
+	// Rollback removes the layers applied by this destination, as far as they are not used by any other image.
+	// It is intended to be called when copying an image fails; it must not be called after a successful Commit.
+	Rollback(ctx context.Context) error
+}
+
 // UploadedBlob is information about a blob written to a destination.
 // It is the subset of types.BlobInfo fields the transport is responsible for setting; all fields must be provided.
 type UploadedBlob struct {
@@ -148,6 +160,38 @@ type BlobChunkAccessor interface {
 	GetBlobAt(ctx context.Context, info types.BlobInfo, chunks []ImageSourceChunk) (chan io.ReadCloser, chan error, error)
 }
 
+// AttestationAccessor allows reading attestations attached to an image, e.g. in-toto statements in DSSE envelopes.
+type AttestationAccessor interface {
+	// GetAttestations returns the image's attestations, using the sigstore attachment format. It may use a remote (= slow) service.
+	// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve attestations for
+	// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+	// (e.g. if the source never returns manifest lists).
+	GetAttestations(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Sigstore, error)
+}
+
+// ImageNameAccessor is an optional interface of types.ImageReference, for transports which refer to an image
+// within a collection using a transport-specific name (e.g. the image part of an oci: reference).
+type ImageNameAccessor interface {
+	// ImageName returns the transport-specific name of the image, or "" if the reference does not specify one.
+	ImageName() string
+}
+
+// MetadataAccessCostReporter is an optional interface of types.ImageReference, for transports where reading
+// the manifest and config of an image may require reading or processing the layers.
+type MetadataAccessCostReporter interface {
+	// MetadataRequiresLayerAccess returns true if creating an ImageSource for the reference, and reading the manifest
+	// and config through it, requires reading or processing layer data (e.g. extracting an archive).
+	MetadataRequiresLayerAccess() bool
+}
+
+// SigstoreAttachmentDiscoveryReporter is an optional interface of ImageSource, for sources which may return sigstore signatures
+// they were not configured to use (e.g. cosign signatures stored in "sha256-<digest>.sig" tags, discovered in a registry).
+type SigstoreAttachmentDiscoveryReporter interface {
+	// DiscoversSigstoreAttachments returns true if sigstore signatures returned by GetSignaturesWithFormat were discovered
+	// that way; copies should not fail only because such signatures can't be preserved.
+	DiscoversSigstoreAttachments() bool
+}
+
 // BadPartialRequestError is returned by BlobChunkAccessor.GetBlobAt on an invalid request.
 type BadPartialRequestError struct {
 	Status string
@@ -162,4 +206,12 @@ type UnparsedImage interface {
 	types.UnparsedImage
 	// UntrustedSignatures is like ImageSource.GetSignaturesWithFormat, but the result is cached; it is OK to call this however often you need.
 	UntrustedSignatures(ctx context.Context) ([]signature.Signature, error)
+	// UntrustedConfigBlob returns the config blob of a single image instance, as referenced by Manifest(), or nil if the manifest
+	// does not refer to a separate config blob (e.g. for schema1 manifests and manifest lists).
+	// The blob is verified to match the digest in the manifest, but the manifest itself may not have been verified yet.
+	// The result is cached; it is OK to call this however often you need.
+	UntrustedConfigBlob(ctx context.Context) ([]byte, error)
+	// UntrustedAttestations returns the image's attestations if the underlying ImageSource implements AttestationAccessor,
+	// or an empty list otherwise. The result is cached; it is OK to call this however often you need.
+	UntrustedAttestations(ctx context.Context) ([]signature.Sigstore, error)
 }
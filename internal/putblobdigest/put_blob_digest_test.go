@@ -2,6 +2,7 @@ package putblobdigest
 
 import (
 	"bytes"
+	_ "crypto/sha512"
 	"io"
 	"testing"
 
@@ -72,3 +73,25 @@ func TestDigestIfCanonicalUnknown(t *testing.T) {
 		},
 	})
 }
+
+func TestDigestIfAlgorithmUnknown(t *testing.T) {
+	testDigester(t, func(stream io.Reader, blobInfo types.BlobInfo) (Digester, io.Reader) {
+		return DigestIfAlgorithmUnknown(stream, blobInfo, digest.SHA512)
+	}, []testCase{
+		{
+			inputDigest:    digest.Digest("sha512:uninspected-value"),
+			computesDigest: false,
+			expectedDigest: digest.Digest("sha512:uninspected-value"),
+		},
+		{
+			inputDigest:    digest.Digest("sha256:uninspected-value"),
+			computesDigest: true,
+			expectedDigest: digest.SHA512.FromBytes(testData),
+		},
+		{
+			inputDigest:    "",
+			computesDigest: true,
+			expectedDigest: digest.SHA512.FromBytes(testData),
+		},
+	})
+}
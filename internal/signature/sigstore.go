@@ -18,6 +18,13 @@ const (
 	SigstoreCertificateAnnotationKey = "dev.sigstore.cosign/certificate"
 	// from sigstore/cosign/pkg/oci/static.ChainAnnotationKey
 	SigstoreIntermediateCertificateChainAnnotationKey = "dev.sigstore.cosign/chain"
+	// Not defined by cosign; contains a Rekor API InclusionProof JSON for the entry recorded in SigstoreSETAnnotationKey,
+	// allowing the inclusion to be verified without contacting the log.
+	SigstoreRekorInclusionProofAnnotationKey = "io.github.containers.sigstore.rekor-inclusion-proof"
+	// from sigstore/cosign/pkg/types.DssePayloadType; used for attestations
+	SigstoreDSSEMIMEType = "application/vnd.dsse.envelope.v1+json"
+	// from sigstore/cosign/pkg/oci/experimental.ArtifactType("sig"); the artifact type of signatures stored as OCI referrers
+	SigstoreSignatureArtifactType = "application/vnd.dev.cosign.artifact.sig.v1+json"
 )
 
 // Sigstore is a github.com/cosign/cosign signature.
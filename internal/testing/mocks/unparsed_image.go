@@ -25,6 +25,16 @@ func (ref ForbiddenUnparsedImage) Signatures(context.Context) ([][]byte, error)
 	panic("unexpected call to a mock function")
 }
 
+// UntrustedConfigBlob is a mock that panics.
+func (ref ForbiddenUnparsedImage) UntrustedConfigBlob(ctx context.Context) ([]byte, error) {
+	panic("unexpected call to a mock function")
+}
+
+// UntrustedAttestations is a mock that panics.
+func (ref ForbiddenUnparsedImage) UntrustedAttestations(ctx context.Context) ([]signature.Sigstore, error) {
+	panic("unexpected call to a mock function")
+}
+
 // UntrustedSignatures is a mock that panics.
 func (ref ForbiddenUnparsedImage) UntrustedSignatures(ctx context.Context) ([]signature.Signature, error) {
 	panic("unexpected call to a mock function")
@@ -0,0 +1,54 @@
+// Package tracing creates OpenTelemetry spans for operations of this library.
+//
+// Spans are created using the global OpenTelemetry TracerProvider and TextMapPropagator
+// (see go.opentelemetry.io/otel.SetTracerProvider and SetTextMapPropagator), as children of any span
+// in the caller-provided context.Context. Unless the caller configures a TracerProvider, no spans are recorded.
+package tracing
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope name of spans created by this library.
+const tracerName = "github.com/containers/image/v5"
+
+// Attribute keys used by spans created by this library.
+const (
+	AttributeSource        = attribute.Key("containers_image.source")         // A transports.ImageName of the source
+	AttributeDestination   = attribute.Key("containers_image.destination")    // A transports.ImageName of the destination
+	AttributeImage         = attribute.Key("containers_image.image")          // An image identity, in a transport-specific format
+	AttributeDigest        = attribute.Key("containers_image.digest")         // A blob or manifest digest
+	AttributeLayerIndex    = attribute.Key("containers_image.layer_index")    // An index of a layer in the manifest
+	AttributeLayerResult   = attribute.Key("containers_image.layer_result")   // How a layer was copied: "reused", "partial" or "copied"
+	AttributeCanSubstitute = attribute.Key("containers_image.can_substitute") // Whether a blob reuse may substitute a different blob
+	AttributeReused        = attribute.Key("containers_image.reused")         // Whether a blob was reused
+	AttributeRequirement   = attribute.Key("containers_image.requirement")    // A signature policy requirement type
+	AttributeAllowed       = attribute.Key("containers_image.allowed")        // Whether an image was allowed by a signature policy
+)
+
+// Start creates a span named name with attrs, as a child of any span in ctx.
+// The caller must end the span, typically using End.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err, if not nil, as the outcome of span, and ends span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// InjectHTTPHeaders adds headers propagating the span context in ctx to header.
+func InjectHTTPHeaders(ctx context.Context, header http.Header) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+}
@@ -0,0 +1,64 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStartEnd(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	origTP := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(origTP)
+
+	ctx, parent := Start(context.Background(), "parent", AttributeSource.String("docker://busybox"))
+	_, child := Start(ctx, "child")
+	End(child, errors.New("child failed"))
+	End(parent, nil)
+
+	spans := exporter.GetSpans()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "child", spans[0].Name)
+	assert.Equal(t, spans[1].SpanContext.SpanID(), spans[0].Parent.SpanID())
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Equal(t, "child failed", spans[0].Status.Description)
+	require.Len(t, spans[0].Events, 1)
+	assert.Equal(t, "exception", spans[0].Events[0].Name)
+	assert.Equal(t, "parent", spans[1].Name)
+	assert.Equal(t, codes.Unset, spans[1].Status.Code)
+	assert.Contains(t, spans[1].Attributes, AttributeSource.String("docker://busybox"))
+	assert.Equal(t, tracerName, spans[1].InstrumentationLibrary.Name)
+}
+
+func TestInjectHTTPHeaders(t *testing.T) {
+	tp := sdktrace.NewTracerProvider()
+	origTP := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	defer otel.SetTracerProvider(origTP)
+	origPropagator := otel.GetTextMapPropagator()
+	defer otel.SetTextMapPropagator(origPropagator)
+
+	ctx, span := Start(context.Background(), "request")
+	defer span.End()
+
+	// With the default no-op propagator, nothing is added.
+	header := http.Header{}
+	InjectHTTPHeaders(ctx, header)
+	assert.Empty(t, header)
+
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	header = http.Header{}
+	InjectHTTPHeaders(ctx, header)
+	assert.Contains(t, header.Get("traceparent"), span.SpanContext().TraceID().String())
+}
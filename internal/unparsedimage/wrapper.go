@@ -2,6 +2,7 @@ package unparsedimage
 
 import (
 	"context"
+	"errors"
 
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/signature"
@@ -24,6 +25,20 @@ func FromPublic(unparsed types.UnparsedImage) private.UnparsedImage {
 	}
 }
 
+// UntrustedConfigBlob returns the config blob of a single image instance, as referenced by Manifest(), or nil if the manifest
+// does not refer to a separate config blob (e.g. for schema1 manifests and manifest lists).
+// The blob is verified to match the digest in the manifest, but the manifest itself may not have been verified yet.
+func (w *wrapped) UntrustedConfigBlob(ctx context.Context) ([]byte, error) {
+	return nil, errors.New("reading the config blob is not supported by this UnparsedImage implementation")
+}
+
+// UntrustedAttestations returns the image's attestations if the underlying ImageSource implements AttestationAccessor,
+// or an empty list otherwise.
+func (w *wrapped) UntrustedAttestations(ctx context.Context) ([]signature.Sigstore, error) {
+	// A types.UnparsedImage provides no way to read attestations.
+	return []signature.Sigstore{}, nil
+}
+
 // UntrustedSignatures is like ImageSource.GetSignaturesWithFormat, but the result is cached; it is OK to call this however often you need.
 func (w *wrapped) UntrustedSignatures(ctx context.Context) ([]signature.Signature, error) {
 	sigs, err := w.Signatures(ctx)
@@ -0,0 +1,58 @@
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// canonicalJSONIndent is the indentation used by CanonicalJSON, matching the output of docker/distribution.
+const canonicalJSONIndent = "   "
+
+// CanonicalJSON returns jsonBlob, a manifest, an index, an image configuration, or any other JSON document,
+// re-serialized in a canonical form: object keys sorted, indented using three spaces, without HTML escaping,
+// and without any trailing whitespace. Numbers are preserved as they are written in jsonBlob.
+//
+// This allows independently generated documents with identical content to have identical digests.
+// Note that the result in general differs from jsonBlob, and therefore has a different digest;
+// in particular, canonicalizing a manifest which has already been pushed or signed breaks references to it.
+//
+// Docker schema1 manifests are rejected, because their embedded signatures cover the original formatting.
+func CanonicalJSON(jsonBlob []byte) ([]byte, error) {
+	if GuessMIMEType(jsonBlob) == DockerV2Schema1SignedMediaType {
+		return nil, errors.New("canonical serialization of signed Docker schema1 manifests is not supported")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonBlob))
+	decoder.UseNumber()
+	var contents any
+	if err := decoder.Decode(&contents); err != nil {
+		return nil, fmt.Errorf("parsing JSON for canonical serialization: %w", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New("parsing JSON for canonical serialization: unexpected data after the JSON value")
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", canonicalJSONIndent)
+	if err := encoder.Encode(contents); err != nil { // Map keys are sorted by encoding/json.
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// SerializeCanonical returns m, which is typically a Manifest or a List, serialized as by its Serialize method,
+// and then converted to the canonical form described in CanonicalJSON.
+func SerializeCanonical(m interface{ Serialize() ([]byte, error) }) ([]byte, error) {
+	if _, ok := m.(*Schema1); ok {
+		return nil, errors.New("canonical serialization of Docker schema1 manifests is not supported")
+	}
+	blob, err := m.Serialize()
+	if err != nil {
+		return nil, err
+	}
+	return CanonicalJSON(blob)
+}
@@ -0,0 +1,92 @@
+package manifest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalJSON(t *testing.T) {
+	for _, c := range []struct{ input, expected string }{
+		{`{}`, `{}`},
+		{`  {"b":1,  "a":{"d":[1,2,"x"],"c":null}}` + "\n\n", "{\n   \"a\": {\n      \"c\": null,\n      \"d\": [\n         1,\n         2,\n         \"x\"\n      ]\n   },\n   \"b\": 1\n}"},
+		{`{"n":12345678901234567890,"f":1.50}`, "{\n   \"f\": 1.50,\n   \"n\": 12345678901234567890\n}"},
+		{`{"s":"<a&b>"}`, "{\n   \"s\": \"<a&b>\"\n}"},
+	} {
+		res, err := CanonicalJSON([]byte(c.input))
+		require.NoError(t, err, c.input)
+		assert.Equal(t, c.expected, string(res), c.input)
+		// Canonicalization is idempotent
+		again, err := CanonicalJSON(res)
+		require.NoError(t, err, c.input)
+		assert.Equal(t, res, again, c.input)
+	}
+
+	for _, input := range []string{
+		``,
+		`{`,
+		`{} {}`,
+		`{}x`,
+	} {
+		_, err := CanonicalJSON([]byte(input))
+		assert.Error(t, err, input)
+	}
+
+	// Manifests with the same contents, formatted differently, have the same canonical form
+	for _, fixture := range []string{"v2s2.manifest.json", "v2list.manifest.json", "ociv1.manifest.json", "ociv1.image.index.json", "ociv1.artifact.json", "v2s1-unsigned.manifest.json"} {
+		original, err := os.ReadFile(filepath.Join("fixtures", fixture))
+		require.NoError(t, err)
+		var contents any
+		err = json.Unmarshal(original, &contents)
+		require.NoError(t, err)
+		compact, err := json.Marshal(contents)
+		require.NoError(t, err)
+		c1, err := CanonicalJSON(original)
+		require.NoError(t, err, fixture)
+		c2, err := CanonicalJSON(compact)
+		require.NoError(t, err, fixture)
+		assert.Equal(t, c1, c2, fixture)
+		assert.JSONEq(t, string(original), string(c1), fixture)
+	}
+
+	// Signed schema1 is rejected
+	signed, err := os.ReadFile(filepath.Join("fixtures", "v2s1.manifest.json"))
+	require.NoError(t, err)
+	_, err = CanonicalJSON(signed)
+	assert.Error(t, err)
+}
+
+func TestSerializeCanonical(t *testing.T) {
+	for _, c := range []struct {
+		fixture string
+		parse   func([]byte) (interface{ Serialize() ([]byte, error) }, error)
+	}{
+		{"v2s2.manifest.json", func(b []byte) (interface{ Serialize() ([]byte, error) }, error) { return Schema2FromManifest(b) }},
+		{"ociv1.manifest.json", func(b []byte) (interface{ Serialize() ([]byte, error) }, error) { return OCI1FromManifest(b) }},
+		{"v2list.manifest.json", func(b []byte) (interface{ Serialize() ([]byte, error) }, error) { return Schema2ListFromManifest(b) }},
+		{"ociv1.image.index.json", func(b []byte) (interface{ Serialize() ([]byte, error) }, error) { return OCI1IndexFromManifest(b) }},
+	} {
+		original, err := os.ReadFile(filepath.Join("fixtures", c.fixture))
+		require.NoError(t, err)
+		m, err := c.parse(original)
+		require.NoError(t, err, c.fixture)
+		res, err := SerializeCanonical(m)
+		require.NoError(t, err, c.fixture)
+		serialized, err := m.Serialize()
+		require.NoError(t, err, c.fixture)
+		expected, err := CanonicalJSON(serialized)
+		require.NoError(t, err, c.fixture)
+		assert.Equal(t, expected, res, c.fixture)
+	}
+
+	unsigned, err := os.ReadFile(filepath.Join("fixtures", "v2s1-unsigned.manifest.json"))
+	require.NoError(t, err)
+	s1, err := Schema1FromManifest(unsigned)
+	require.NoError(t, err)
+	_, err = SerializeCanonical(s1)
+	assert.Error(t, err)
+}
@@ -117,6 +117,23 @@ func updatedMIMEType(variantTable []compressionMIMETypeSet, mimeType string, upd
 	}
 }
 
+// distributableMIMEType returns the MIME type in distributable which corresponds to mimeType in nonDistributable
+// (i.e. uses the same compression), or mimeType if it is not a value in nonDistributable.
+// This is used for "foreign" layers when their contents are stored with the image, instead of only at external URLs.
+func distributableMIMEType(nonDistributable, distributable compressionMIMETypeSet, mimeType string) string {
+	if mimeType == mtsUnsupportedMIMEType { // Prevent matching against the {algo:mtsUnsupportedMIMEType} entries
+		return mimeType
+	}
+	for name, mt := range nonDistributable {
+		if mt == mimeType {
+			if res, ok := distributable[name]; ok && res != mtsUnsupportedMIMEType {
+				return res
+			}
+		}
+	}
+	return mimeType
+}
+
 // ManifestLayerCompressionIncompatibilityError indicates that a specified compression algorithm
 // could not be applied to a layer MIME type.  A caller that receives this should either retry
 // the call with a different compression algorithm, or attempt to use a different manifest type.
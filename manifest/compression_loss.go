@@ -0,0 +1,70 @@
+package manifest
+
+import (
+	"github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/image/v5/pkg/compression"
+	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
+	chunkedToc "github.com/containers/storage/pkg/chunked/toc"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// CompressionLoss describes layers of a manifest which use a compression algorithm that can't be represented
+// in a different manifest format; converting the manifest to that format requires recompressing them.
+type CompressionLoss struct {
+	LayerIndices []int    // Indices of the affected layers, as returned by Manifest.LayerInfos.
+	Algorithms   []string // Names of the compression algorithms which can't be represented, without duplicates.
+}
+
+// layerCompressionAlgorithm returns the compression algorithm of layer, as far as it can be determined from the manifest,
+// or nil if it is unknown or the layer is not compressed.
+func layerCompressionAlgorithm(layer LayerInfo) *compressiontypes.Algorithm {
+	switch layer.MediaType {
+	case DockerV2Schema2LayerMediaType, DockerV2Schema2ForeignLayerMediaTypeGzip,
+		imgspecv1.MediaTypeImageLayerGzip, imgspecv1.MediaTypeImageLayerNonDistributableGzip: //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
+		return &compression.Gzip
+	case imgspecv1.MediaTypeImageLayerZstd, imgspecv1.MediaTypeImageLayerNonDistributableZstd: //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
+		if tocDigest, err := chunkedToc.GetTOCDigest(layer.Annotations); err == nil && tocDigest != nil {
+			return &compression.ZstdChunked
+		}
+		return &compression.Zstd
+	default:
+		return nil
+	}
+}
+
+// LayerCompressionAlgorithms returns the compression algorithms used by layers of m, without duplicates,
+// as far as they can be determined from the manifest.
+func LayerCompressionAlgorithms(m Manifest) []compressiontypes.Algorithm {
+	res := []compressiontypes.Algorithm{}
+	seen := set.New[string]()
+	for _, layer := range m.LayerInfos() {
+		if algo := layerCompressionAlgorithm(layer); algo != nil && !seen.Contains(algo.Name()) {
+			seen.Add(algo.Name())
+			res = append(res, *algo)
+		}
+	}
+	return res
+}
+
+// ConversionCompressionLoss returns the layers of m which, using their current compression, can't be represented
+// in a manifest of targetMIMEType, or nil if there are none.
+func ConversionCompressionLoss(m Manifest, targetMIMEType string) *CompressionLoss {
+	var res *CompressionLoss
+	lost := set.New[string]()
+	for i, layer := range m.LayerInfos() {
+		algo := layerCompressionAlgorithm(layer)
+		if algo == nil || manifest.MIMETypeSupportsCompressionAlgorithm(targetMIMEType, *algo) {
+			continue
+		}
+		if res == nil {
+			res = &CompressionLoss{LayerIndices: []int{}, Algorithms: []string{}}
+		}
+		res.LayerIndices = append(res.LayerIndices, i)
+		if !lost.Contains(algo.Name()) {
+			lost.Add(algo.Name())
+			res.Algorithms = append(res.Algorithms, algo.Name())
+		}
+	}
+	return res
+}
@@ -0,0 +1,64 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/pkg/compression"
+	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayerCompressionAlgorithms(t *testing.T) {
+	for _, c := range []struct {
+		fixture  string
+		expected []string
+	}{
+		{"v2s2.manifest.json", []string{compressiontypes.GzipAlgorithmName}},
+		{"ociv1.manifest.json", []string{compressiontypes.GzipAlgorithmName}},
+		{"ociv1.zstd.manifest.json", []string{compressiontypes.ZstdAlgorithmName}},
+		{"ociv1.uncompressed.manifest.json", []string{}},
+	} {
+		manifestBlob, err := os.ReadFile(filepath.Join("fixtures", c.fixture))
+		require.NoError(t, err)
+		m, err := FromBlob(manifestBlob, GuessMIMEType(manifestBlob))
+		require.NoError(t, err, c.fixture)
+		names := []string{}
+		for _, algo := range LayerCompressionAlgorithms(m) {
+			names = append(names, algo.Name())
+		}
+		assert.Equal(t, c.expected, names, c.fixture)
+	}
+}
+
+func TestConversionCompressionLoss(t *testing.T) {
+	manifestBlob, err := os.ReadFile(filepath.Join("fixtures", "ociv1.zstd.manifest.json"))
+	require.NoError(t, err)
+	m, err := OCI1FromManifest(manifestBlob)
+	require.NoError(t, err)
+
+	assert.Nil(t, ConversionCompressionLoss(m, imgspecv1.MediaTypeImageManifest))
+	assert.Equal(t, &CompressionLoss{
+		LayerIndices: []int{0, 1, 2},
+		Algorithms:   []string{compressiontypes.ZstdAlgorithmName},
+	}, ConversionCompressionLoss(m, DockerV2Schema2MediaType))
+
+	// Only affected layers are reported, and zstd:chunked is recognized
+	m.Layers[0].MediaType = imgspecv1.MediaTypeImageLayerGzip
+	m.Layers[2].Annotations = map[string]string{"io.github.containers.zstd-chunked.manifest-checksum": "sha256:9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"}
+	assert.Equal(t, &CompressionLoss{
+		LayerIndices: []int{1, 2},
+		Algorithms:   []string{compressiontypes.ZstdAlgorithmName, compression.ZstdChunked.Name()},
+	}, ConversionCompressionLoss(m, DockerV2Schema2MediaType))
+
+	// Docker manifests never lose compression
+	s2Blob, err := os.ReadFile(filepath.Join("fixtures", "v2s2.manifest.json"))
+	require.NoError(t, err)
+	s2, err := Schema2FromManifest(s2Blob)
+	require.NoError(t, err)
+	assert.Nil(t, ConversionCompressionLoss(s2, imgspecv1.MediaTypeImageManifest))
+	assert.Nil(t, ConversionCompressionLoss(s2, DockerV2Schema2MediaType))
+}
@@ -69,6 +69,12 @@ func Schema1FromManifest(manifestBlob []byte) (*Schema1, error) {
 		manifest.AllowedFieldFSLayers|manifest.AllowedFieldHistory); err != nil {
 		return nil, err
 	}
+	if err := manifest.ValidateDescriptorCount("layers in a manifest", len(s1.FSLayers)); err != nil {
+		return nil, err
+	}
+	if err := manifest.ValidateHistoryCount(len(s1.History)); err != nil {
+		return nil, err
+	}
 	if err := s1.initialize(); err != nil {
 		return nil, err
 	}
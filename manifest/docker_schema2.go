@@ -164,6 +164,9 @@ func Schema2FromManifest(manifestBlob []byte) (*Schema2, error) {
 		manifest.AllowedFieldConfig|manifest.AllowedFieldLayers); err != nil {
 		return nil, err
 	}
+	if err := manifest.ValidateDescriptorCount("layers in a manifest", len(s2.LayersDescriptors)); err != nil {
+		return nil, err
+	}
 	// Check manifest's and layers' media types.
 	if err := SupportedSchema2MediaType(s2.MediaType); err != nil {
 		return nil, err
@@ -211,22 +214,25 @@ func (m *Schema2) LayerInfos() []LayerInfo {
 	return blobs
 }
 
-var schema2CompressionMIMETypeSets = []compressionMIMETypeSet{
-	{
+var (
+	schema2ForeignLayerMIMETypeSet = compressionMIMETypeSet{
 		mtsUncompressed:                    DockerV2Schema2ForeignLayerMediaType,
 		compressiontypes.GzipAlgorithmName: DockerV2Schema2ForeignLayerMediaTypeGzip,
 		compressiontypes.ZstdAlgorithmName: mtsUnsupportedMIMEType,
-	},
-	{
+	}
+	schema2LayerMIMETypeSet = compressionMIMETypeSet{
 		mtsUncompressed:                    DockerV2SchemaLayerMediaTypeUncompressed,
 		compressiontypes.GzipAlgorithmName: DockerV2Schema2LayerMediaType,
 		compressiontypes.ZstdAlgorithmName: mtsUnsupportedMIMEType,
-	},
-}
+	}
+	schema2CompressionMIMETypeSets = []compressionMIMETypeSet{schema2ForeignLayerMIMETypeSet, schema2LayerMIMETypeSet}
+)
 
 // UpdateLayerInfos replaces the original layers with the specified BlobInfos (size+digest+urls), in order (the root layer first, and then successive layered layers)
 // The returned error will be a manifest.ManifestLayerCompressionIncompatibilityError if any of the layerInfos includes a combination of CompressionOperation and
 // CompressionAlgorithm that would result in anything other than gzip compression.
+// If a foreign layer had URLs, and the replacement has none, the layer is converted to the corresponding non-foreign MIME type,
+// because its contents are now expected to be stored with the image.
 func (m *Schema2) UpdateLayerInfos(layerInfos []types.BlobInfo) error {
 	if len(m.LayersDescriptors) != len(layerInfos) {
 		return fmt.Errorf("Error preparing updated manifest: layer count changed from %d to %d", len(m.LayersDescriptors), len(layerInfos))
@@ -239,6 +245,9 @@ func (m *Schema2) UpdateLayerInfos(layerInfos []types.BlobInfo) error {
 		if err := SupportedSchema2MediaType(mimeType); err != nil {
 			return fmt.Errorf("Error preparing updated manifest: unknown media type of original layer %q: %q", info.Digest, mimeType)
 		}
+		if len(original[i].URLs) != 0 && len(info.URLs) == 0 {
+			mimeType = distributableMIMEType(schema2ForeignLayerMIMETypeSet, schema2LayerMIMETypeSet, mimeType)
+		}
 		mimeType, err := updatedMIMEType(schema2CompressionMIMETypeSets, mimeType, info)
 		if err != nil {
 			return fmt.Errorf("preparing updated manifest, layer %q: %w", info.Digest, err)
@@ -270,6 +279,9 @@ func (m *Schema2) Inspect(configGetter func(types.BlobInfo) ([]byte, error)) (*t
 	if err := json.Unmarshal(config, s2); err != nil {
 		return nil, err
 	}
+	if err := manifest.ValidateHistoryCount(len(s2.History)); err != nil {
+		return nil, err
+	}
 	layerInfos := m.LayerInfos()
 	i := &types.ImageInspectInfo{
 		Tag:           "",
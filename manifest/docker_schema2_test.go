@@ -262,6 +262,31 @@ func TestSchema2UpdateLayerInfos(t *testing.T) {
 	}
 }
 
+func TestSchema2UpdateLayerInfosForeignLayers(t *testing.T) {
+	const (
+		layer1 = digest.Digest("sha256:1111111111111111111111111111111111111111111111111111111111111111")
+		layer2 = digest.Digest("sha256:2222222222222222222222222222222222222222222222222222222222222222")
+		layer3 = digest.Digest("sha256:3333333333333333333333333333333333333333333333333333333333333333")
+	)
+	urls := []string{"https://example.com/layer"}
+	m := Schema2FromComponents(Schema2Descriptor{MediaType: DockerV2Schema2ConfigMediaType}, []Schema2Descriptor{
+		{MediaType: DockerV2Schema2ForeignLayerMediaTypeGzip, Digest: layer1, Size: 1, URLs: urls},
+		{MediaType: DockerV2Schema2ForeignLayerMediaType, Digest: layer2, Size: 2, URLs: urls},
+		{MediaType: DockerV2Schema2ForeignLayerMediaType, Digest: layer3, Size: 3, URLs: urls},
+	})
+	err := m.UpdateLayerInfos([]types.BlobInfo{
+		{Digest: layer1, Size: 1},             // URLs dropped: converted
+		{Digest: layer2, Size: 2},             // URLs dropped: converted
+		{Digest: layer3, Size: 3, URLs: urls}, // URLs preserved: unchanged
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []Schema2Descriptor{
+		{MediaType: DockerV2Schema2LayerMediaType, Digest: layer1, Size: 1},
+		{MediaType: DockerV2SchemaLayerMediaTypeUncompressed, Digest: layer2, Size: 2},
+		{MediaType: DockerV2Schema2ForeignLayerMediaType, Digest: layer3, Size: 3, URLs: urls},
+	}, m.LayersDescriptors)
+}
+
 func TestSchema2ImageID(t *testing.T) {
 	m := manifestSchema2FromFixture(t, "v2s2.manifest.json")
 	// These are not the real DiffID values, but they don’t actually matter in our implementation.
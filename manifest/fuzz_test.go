@@ -0,0 +1,77 @@
+package manifest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// addFixturesToCorpus adds all files in the fixtures directory to the seed corpus of f.
+func addFixturesToCorpus(f *testing.F) {
+	entries, err := os.ReadDir("fixtures")
+	require.NoError(f, err)
+	for _, e := range entries {
+		blob, err := os.ReadFile(filepath.Join("fixtures", e.Name()))
+		require.NoError(f, err)
+		f.Add(blob)
+	}
+}
+
+// assertLimitError fails if err is a LimitExceededError which does not match types.ErrManifestInvalid.
+func assertLimitError(t *testing.T, err error) {
+	var e LimitExceededError
+	if errors.As(err, &e) {
+		assert.ErrorIs(t, err, types.ErrManifestInvalid)
+	}
+}
+
+func FuzzFromBlob(f *testing.F) {
+	addFixturesToCorpus(f)
+	f.Fuzz(func(t *testing.T, blob []byte) {
+		mimeType := GuessMIMEType(blob)
+		if MIMETypeIsMultiImage(mimeType) {
+			list, err := ListFromBlob(blob, mimeType)
+			if err != nil {
+				assertLimitError(t, err)
+				return
+			}
+			assert.LessOrEqual(t, len(list.Instances()), manifest.MaxDescriptors)
+			_, err = list.Serialize()
+			assert.NoError(t, err)
+			return
+		}
+		m, err := FromBlob(blob, mimeType)
+		if err != nil {
+			assertLimitError(t, err)
+			return
+		}
+		assert.LessOrEqual(t, len(m.LayerInfos()), manifest.MaxDescriptors)
+		_ = m.ConfigInfo()
+		_, _ = m.Serialize()
+	})
+}
+
+func FuzzInspect(f *testing.F) {
+	f.Add([]byte(`{"architecture":"amd64","os":"linux","history":[{},{"empty_layer":true}],"config":{"Labels":{"a":"b"}}}`))
+	f.Add([]byte(`{}`))
+
+	oci1Blob, err := os.ReadFile("fixtures/ociv1.manifest.json")
+	require.NoError(f, err)
+	s2Blob, err := os.ReadFile("fixtures/v2s2.manifest.json")
+	require.NoError(f, err)
+	f.Fuzz(func(t *testing.T, config []byte) {
+		configGetter := func(types.BlobInfo) ([]byte, error) { return config, nil }
+		for _, blob := range [][]byte{oci1Blob, s2Blob} {
+			m, err := FromBlob(blob, GuessMIMEType(blob))
+			require.NoError(t, err)
+			_, err = m.Inspect(configGetter)
+			assertLimitError(t, err)
+		}
+	})
+}
@@ -0,0 +1,75 @@
+package manifest
+
+import (
+	"fmt"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// LayerHistory associates a layer of an image with the entries of the image configuration’s history which describe it.
+type LayerHistory struct {
+	// Layer is the layer, as returned by Manifest.LayerInfos.
+	Layer LayerInfo
+	// History is the history entry which created the layer, or nil if the image configuration does not record any history.
+	// If Layer.EmptyLayer is set (only possible with Docker schema1), this is an entry with EmptyLayer set.
+	History *imgspecv1.History
+	// EmptyLayerHistory contains the history entries which did not create a layer (e.g. for ENV or LABEL instructions),
+	// recorded after the previous layer and before History, in order.
+	EmptyLayerHistory []imgspecv1.History
+}
+
+// CreatedBy returns the CreatedBy values of all history entries associated with the layer, in order,
+// i.e. those of EmptyLayerHistory followed by that of History. Entries without a CreatedBy value are skipped.
+func (lh LayerHistory) CreatedBy() []string {
+	res := []string{}
+	for _, h := range lh.EmptyLayerHistory {
+		if h.CreatedBy != "" {
+			res = append(res, h.CreatedBy)
+		}
+	}
+	if lh.History != nil && lh.History.CreatedBy != "" {
+		res = append(res, lh.History.CreatedBy)
+	}
+	return res
+}
+
+// LayerHistories returns the layers of m, in order (the root layer first), each with the entries of config.History
+// which describe it, and separately the history entries which did not create a layer, recorded after the last layer.
+// config would typically be obtained from types.Image.OCIConfig.
+//
+// The image configuration may not record any history, in which case no layers have associated history entries;
+// otherwise, the history entries which created layers must correspond one-to-one to the layers of m.
+func LayerHistories(m Manifest, config *imgspecv1.Image) ([]LayerHistory, []imgspecv1.History, error) {
+	layers := m.LayerInfos()
+	res := make([]LayerHistory, len(layers))
+	for i, layer := range layers {
+		res[i].Layer = layer
+	}
+	if len(config.History) == 0 {
+		return res, []imgspecv1.History{}, nil
+	}
+
+	layerIndex := 0
+	emptyLayerHistory := []imgspecv1.History{}
+	for i := range config.History {
+		h := config.History[i] // A copy, so that the result does not alias config.
+		if h.EmptyLayer && (layerIndex >= len(layers) || !layers[layerIndex].EmptyLayer) {
+			emptyLayerHistory = append(emptyLayerHistory, h)
+			continue
+		}
+		if layerIndex >= len(layers) {
+			return nil, nil, fmt.Errorf("image configuration records history for more than the %d layers of the manifest", len(layers))
+		}
+		if layers[layerIndex].EmptyLayer != h.EmptyLayer {
+			return nil, nil, fmt.Errorf("history entry %d does not match the empty layer status of layer %d (%s)", i, layerIndex, layers[layerIndex].Digest)
+		}
+		res[layerIndex].History = &h
+		res[layerIndex].EmptyLayerHistory = emptyLayerHistory
+		emptyLayerHistory = []imgspecv1.History{}
+		layerIndex++
+	}
+	if layerIndex != len(layers) {
+		return nil, nil, fmt.Errorf("image configuration records history for %d layers, but the manifest has %d layers", layerIndex, len(layers))
+	}
+	return res, emptyLayerHistory, nil
+}
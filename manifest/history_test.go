@@ -0,0 +1,86 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayerHistories(t *testing.T) {
+	manifestBlob, err := os.ReadFile(filepath.Join("fixtures", "v2s2.manifest.json"))
+	require.NoError(t, err)
+	m, err := Schema2FromManifest(manifestBlob)
+	require.NoError(t, err)
+	layers := m.LayerInfos()
+	require.Len(t, layers, 3)
+
+	// No history recorded
+	res, trailing, err := LayerHistories(m, &imgspecv1.Image{})
+	require.NoError(t, err)
+	assert.Equal(t, []LayerHistory{{Layer: layers[0]}, {Layer: layers[1]}, {Layer: layers[2]}}, res)
+	assert.Empty(t, trailing)
+	assert.Equal(t, []string{}, res[0].CreatedBy())
+
+	// History with empty layers interleaved and trailing
+	config := &imgspecv1.Image{History: []imgspecv1.History{
+		{CreatedBy: "ADD file:0 in /"},
+		{CreatedBy: "ENV A=1", EmptyLayer: true},
+		{Comment: "no CreatedBy", EmptyLayer: true},
+		{CreatedBy: "RUN make"},
+		{CreatedBy: "RUN make install"},
+		{CreatedBy: "CMD [\"/bin/sh\"]", EmptyLayer: true},
+	}}
+	res, trailing, err = LayerHistories(m, config)
+	require.NoError(t, err)
+	assert.Equal(t, []LayerHistory{
+		{Layer: layers[0], History: &config.History[0], EmptyLayerHistory: []imgspecv1.History{}},
+		{Layer: layers[1], History: &config.History[3], EmptyLayerHistory: []imgspecv1.History{config.History[1], config.History[2]}},
+		{Layer: layers[2], History: &config.History[4], EmptyLayerHistory: []imgspecv1.History{}},
+	}, res)
+	assert.Equal(t, []imgspecv1.History{config.History[5]}, trailing)
+	assert.Equal(t, []string{"ENV A=1", "RUN make"}, res[1].CreatedBy())
+	// The result does not alias config
+	res[0].History.CreatedBy = "modified"
+	assert.Equal(t, "ADD file:0 in /", config.History[0].CreatedBy)
+
+	// History inconsistent with the manifest
+	for _, history := range [][]imgspecv1.History{
+		{{CreatedBy: "1"}, {CreatedBy: "2"}},
+		{{CreatedBy: "1"}, {CreatedBy: "2"}, {CreatedBy: "3", EmptyLayer: true}},
+		{{CreatedBy: "1"}, {CreatedBy: "2"}, {CreatedBy: "3"}, {CreatedBy: "4"}},
+	} {
+		_, _, err := LayerHistories(m, &imgspecv1.Image{History: history})
+		assert.Error(t, err)
+	}
+
+	// Schema1 throwaway layers are associated with the corresponding empty history entries
+	s1, err := Schema1FromComponents(nil, []Schema1FSLayers{
+		{BlobSum: digest.Digest("sha256:a3ed95caeb02ffe68cdd9fd84406680ae93d633cb16422d00e8a7c22955b46d4")},
+		{BlobSum: digest.Digest("sha256:bbd6b22eb11afce63cc76f6bc41042d99f10d6024c96b655dafba930b8d25909")},
+	}, []Schema1History{
+		{V1Compatibility: `{"id":"2","parent":"1","throwaway":true}`},
+		{V1Compatibility: `{"id":"1"}`},
+	}, "amd64")
+	require.NoError(t, err)
+	s1Layers := s1.LayerInfos()
+	require.Len(t, s1Layers, 2)
+	require.True(t, s1Layers[1].EmptyLayer)
+	s1Config := &imgspecv1.Image{History: []imgspecv1.History{
+		{CreatedBy: "ADD file:0 in /"},
+		{CreatedBy: "ENV A=1", EmptyLayer: true},
+	}}
+	res, trailing, err = LayerHistories(s1, s1Config)
+	require.NoError(t, err)
+	assert.Equal(t, []LayerHistory{
+		{Layer: s1Layers[0], History: &s1Config.History[0], EmptyLayerHistory: []imgspecv1.History{}},
+		{Layer: s1Layers[1], History: &s1Config.History[1], EmptyLayerHistory: []imgspecv1.History{}},
+	}, res)
+	assert.Empty(t, trailing)
+	_, _, err = LayerHistories(s1, &imgspecv1.Image{History: []imgspecv1.History{{CreatedBy: "1"}, {CreatedBy: "2"}}})
+	assert.Error(t, err)
+}
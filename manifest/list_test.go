@@ -139,3 +139,27 @@ func TestChooseInstance(t *testing.T) {
 		}
 	}
 }
+
+func TestChooseInstanceMatching(t *testing.T) {
+	rawManifest, err := os.ReadFile(filepath.Join("..", "internal", "manifest", "testdata", "schema2list-variants.json"))
+	require.NoError(t, err)
+	list, err := ListFromBlob(rawManifest, GuessMIMEType(rawManifest))
+	require.NoError(t, err)
+
+	// Prefer the unrecognized variant over anything else
+	d, err := ChooseInstanceMatching(list, func(p imgspecv1.Platform) (int, bool) {
+		switch {
+		case p.Architecture != "arm":
+			return 0, false
+		case p.Variant == "unrecognized-present":
+			return 0, true
+		default:
+			return 1, true
+		}
+	})
+	require.NoError(t, err)
+	assert.Equal(t, digest.Digest("sha256:bcf9771c0b505e68c65440474179592ffdfa98790eb54ffbf129969c5e429990"), d)
+
+	_, err = ChooseInstanceMatching(list, PlatformMatcherFromWanted([]imgspecv1.Platform{{OS: "linux", Architecture: "unmatched"}}))
+	assert.Error(t, err)
+}
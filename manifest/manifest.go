@@ -38,6 +38,10 @@ const (
 // on an object which is not a “container image” in the standard sense (e.g. an OCI artifact)
 type NonImageArtifactError = manifest.NonImageArtifactError
 
+// LimitExceededError (detected via errors.As) is returned when a parsed manifest or image configuration
+// exceeds a limit on its contents, e.g. contains an unreasonably large number of layers.
+type LimitExceededError = manifest.LimitExceededError
+
 // SupportedSchema2MediaType checks if the specified string is a supported Docker v2s2 media type.
 func SupportedSchema2MediaType(m string) error {
 	switch m {
@@ -118,6 +122,17 @@ func MatchesDigest(manifestBlob []byte, expectedDigest digest.Digest) (bool, err
 	return manifest.MatchesDigest(manifestBlob, expectedDigest)
 }
 
+// DigestedManifest is a manifest, together with its MIME type, which has been verified to match a digest.
+// Values can only be created by VerifyManifestDigest (the zero value is not valid), so holding a DigestedManifest
+// is proof that the verification has been done.
+type DigestedManifest = manifest.DigestedManifest
+
+// VerifyManifestDigest returns a DigestedManifest for manifestBlob with mimeType, or an error if it does not match expectedDigest.
+// The same caveats as for MatchesDigest apply.
+func VerifyManifestDigest(manifestBlob []byte, mimeType string, expectedDigest digest.Digest) (DigestedManifest, error) {
+	return manifest.VerifyManifestDigest(manifestBlob, mimeType, expectedDigest)
+}
+
 // AddDummyV2S1Signature adds an JWS signature with a temporary key (i.e. useless) to a v2s1 manifest.
 // This is useful to make the manifest acceptable to a docker/distribution registry (even though nothing needs or wants the JWS signature).
 func AddDummyV2S1Signature(manifest []byte) ([]byte, error) {
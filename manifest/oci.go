@@ -2,7 +2,9 @@ package manifest
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"mime"
 	"strings"
 
 	"github.com/containers/image/v5/internal/manifest"
@@ -65,9 +67,52 @@ func OCI1FromManifest(manifestBlob []byte) (*OCI1, error) {
 		manifest.AllowedFieldConfig|manifest.AllowedFieldLayers); err != nil {
 		return nil, err
 	}
+	if err := validateOCI1Artifact(&oci1.Manifest); err != nil {
+		return nil, err
+	}
+	if err := validateOCI1Limits(&oci1.Manifest); err != nil {
+		return nil, err
+	}
 	return &oci1, nil
 }
 
+// validateOCI1Limits returns a LimitExceededError if m exceeds the limits on parsed manifests.
+func validateOCI1Limits(m *imgspecv1.Manifest) error {
+	if err := manifest.ValidateDescriptorCount("layers in a manifest", len(m.Layers)); err != nil {
+		return err
+	}
+	if err := manifest.ValidateAnnotations(m.Annotations); err != nil {
+		return err
+	}
+	if err := manifest.ValidateDescriptorAnnotations(m.Config); err != nil {
+		return err
+	}
+	if m.Subject != nil {
+		if err := manifest.ValidateDescriptorAnnotations(*m.Subject); err != nil {
+			return err
+		}
+	}
+	return manifest.ValidateDescriptorAnnotations(m.Layers...)
+}
+
+// validateOCI1Artifact validates the artifact-related fields of m, as defined by OCI image-spec 1.1.
+func validateOCI1Artifact(m *imgspecv1.Manifest) error {
+	if m.ArtifactType != "" {
+		if _, _, err := mime.ParseMediaType(m.ArtifactType); err != nil {
+			return fmt.Errorf("invalid artifactType %q: %w", m.ArtifactType, err)
+		}
+	}
+	// The specification also requires artifactType to be set when the config is empty; that is enforced only by Validate,
+	// because producers of existing artifacts (e.g. policy images, see signature.NewPolicyFromImage) do not set it.
+	if m.Config.MediaType == imgspecv1.MediaTypeEmptyJSON {
+		if m.Config.Digest != imgspecv1.DescriptorEmptyJSON.Digest || m.Config.Size != imgspecv1.DescriptorEmptyJSON.Size {
+			return fmt.Errorf("config with media type %q has unexpected digest %q and size %d", imgspecv1.MediaTypeEmptyJSON,
+				m.Config.Digest, m.Config.Size)
+		}
+	}
+	return nil
+}
+
 // OCI1FromComponents creates an OCI1 manifest instance from the supplied data.
 func OCI1FromComponents(config imgspecv1.Descriptor, layers []imgspecv1.Descriptor) *OCI1 {
 	return &OCI1{
@@ -80,6 +125,27 @@ func OCI1FromComponents(config imgspecv1.Descriptor, layers []imgspecv1.Descript
 	}
 }
 
+// OCI1ArtifactFromComponents creates an OCI1 manifest instance for an artifact of artifactType from the supplied data,
+// as defined by OCI image-spec 1.1.
+// If config is nil, the artifact uses the empty config descriptor, imgspecv1.DescriptorEmptyJSON.
+func OCI1ArtifactFromComponents(artifactType string, config *imgspecv1.Descriptor, layers []imgspecv1.Descriptor) (*OCI1, error) {
+	if artifactType == "" {
+		return nil, errors.New("artifactType must be set for an artifact manifest")
+	}
+	if config == nil {
+		config = &imgspecv1.DescriptorEmptyJSON
+	}
+	if layers == nil {
+		layers = []imgspecv1.Descriptor{} // The layers field is required, so don’t serialize it as null.
+	}
+	res := OCI1FromComponents(*config, layers)
+	res.ArtifactType = artifactType
+	if err := validateOCI1Artifact(&res.Manifest); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
 // OCI1Clone creates a copy of the supplied OCI1 manifest.
 func OCI1Clone(src *OCI1) *OCI1 {
 	return &OCI1{
@@ -87,6 +153,33 @@ func OCI1Clone(src *OCI1) *OCI1 {
 	}
 }
 
+// ArtifactMIMEType returns the type of the artifact described by m, or "" if m describes a container image.
+// This is m.ArtifactType if set, and the config media type otherwise.
+func (m *OCI1) ArtifactMIMEType() string {
+	if m.ArtifactType != "" {
+		return m.ArtifactType
+	}
+	if m.Config.MediaType == imgspecv1.MediaTypeImageConfig {
+		return ""
+	}
+	return m.Config.MediaType
+}
+
+// SetSubject sets the subject of m, making it a referrer of the manifest described by subject.
+// If subject is nil, m will have no subject.
+func (m *OCI1) SetSubject(subject *imgspecv1.Descriptor) error {
+	if subject == nil {
+		m.Subject = nil
+		return nil
+	}
+	s, err := manifest.OCI1SubjectClone(*subject)
+	if err != nil {
+		return fmt.Errorf("setting subject of OCI1 manifest: %w", err)
+	}
+	m.Subject = s
+	return nil
+}
+
 // ConfigInfo returns a complete BlobInfo for the separate config object, or a BlobInfo{Digest:""} if there isn't a separate object.
 func (m *OCI1) ConfigInfo() types.BlobInfo {
 	return BlobInfoFromOCI1Descriptor(m.Config)
@@ -106,22 +199,25 @@ func (m *OCI1) LayerInfos() []LayerInfo {
 	return blobs
 }
 
-var oci1CompressionMIMETypeSets = []compressionMIMETypeSet{
-	{
+var (
+	oci1NonDistributableMIMETypeSet = compressionMIMETypeSet{
 		mtsUncompressed:                    imgspecv1.MediaTypeImageLayerNonDistributable,     //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
 		compressiontypes.GzipAlgorithmName: imgspecv1.MediaTypeImageLayerNonDistributableGzip, //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
 		compressiontypes.ZstdAlgorithmName: imgspecv1.MediaTypeImageLayerNonDistributableZstd, //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
-	},
-	{
+	}
+	oci1LayerMIMETypeSet = compressionMIMETypeSet{
 		mtsUncompressed:                    imgspecv1.MediaTypeImageLayer,
 		compressiontypes.GzipAlgorithmName: imgspecv1.MediaTypeImageLayerGzip,
 		compressiontypes.ZstdAlgorithmName: imgspecv1.MediaTypeImageLayerZstd,
-	},
-}
+	}
+	oci1CompressionMIMETypeSets = []compressionMIMETypeSet{oci1NonDistributableMIMETypeSet, oci1LayerMIMETypeSet}
+)
 
 // UpdateLayerInfos replaces the original layers with the specified BlobInfos (size+digest+urls+mediatype), in order (the root layer first, and then successive layered layers)
 // The returned error will be a manifest.ManifestLayerCompressionIncompatibilityError if any of the layerInfos includes a combination of CompressionOperation and
 // CompressionAlgorithm that isn't supported by OCI.
+// If a layer with a non-distributable ("foreign") MIME type had URLs, and the replacement has none, the layer is converted to the
+// corresponding distributable MIME type, because its contents are now expected to be stored with the image.
 //
 // It’s generally the caller’s responsibility to determine whether a particular edit is acceptable, rather than relying on
 // failures of this function, because the layer is typically created _before_ UpdateLayerInfos is called, because UpdateLayerInfos needs
@@ -136,6 +232,9 @@ func (m *OCI1) UpdateLayerInfos(layerInfos []types.BlobInfo) error {
 	m.Layers = make([]imgspecv1.Descriptor, len(layerInfos))
 	for i, info := range layerInfos {
 		mimeType := original[i].MediaType
+		if len(original[i].URLs) != 0 && len(info.URLs) == 0 {
+			mimeType = distributableMIMEType(oci1NonDistributableMIMETypeSet, oci1LayerMIMETypeSet, mimeType)
+		}
 		if info.CryptoOperation == types.Decrypt {
 			decMimeType, err := getDecryptedMediaType(mimeType)
 			if err != nil {
@@ -193,6 +292,14 @@ func getDecryptedMediaType(mediatype string) (string, error) {
 // Serialize returns the manifest in a blob format.
 // NOTE: Serialize() does not in general reproduce the original blob if this object was loaded from one, even if no modifications were made!
 func (m *OCI1) Serialize() ([]byte, error) {
+	if m.Config.MediaType == "" && m.Config.Digest == "" && m.Config.Size == 0 {
+		// An artifact without a config; don’t record a meaningless config descriptor.
+		// The shallower Config field hides m.Manifest.Config, and is omitted because it is nil.
+		return json.Marshal(struct {
+			imgspecv1.Manifest
+			Config *imgspecv1.Descriptor `json:"config,omitempty"`
+		}{Manifest: m.Manifest})
+	}
 	return json.Marshal(*m)
 }
 
@@ -214,6 +321,9 @@ func (m *OCI1) Inspect(configGetter func(types.BlobInfo) ([]byte, error)) (*type
 	if err := json.Unmarshal(config, v1); err != nil {
 		return nil, err
 	}
+	if err := manifest.ValidateHistoryCount(len(v1.History)); err != nil {
+		return nil, err
+	}
 	d1 := &Schema2V1Image{}
 	if err := json.Unmarshal(config, d1); err != nil {
 		return nil, err
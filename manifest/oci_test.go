@@ -3,8 +3,10 @@ package manifest
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/pkg/compression"
 	"github.com/containers/image/v5/types"
 	"github.com/opencontainers/go-digest"
@@ -67,6 +69,122 @@ func TestOCI1FromManifest(t *testing.T) {
 	})
 	// Extra fields are rejected
 	testValidManifestWithExtraFieldsIsRejected(t, parser, validManifest, []string{"fsLayers", "history", "manifests"})
+
+	// OCI 1.1 artifacts
+	for _, c := range []struct {
+		name     string
+		manifest string
+		valid    bool
+	}{
+		{
+			name: "empty config",
+			manifest: `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","artifactType":"application/vnd.example+type",` +
+				`"config":{"mediaType":"application/vnd.oci.empty.v1+json","digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":2},"layers":[]}`,
+			valid: true,
+		},
+		{
+			name:     "absent config",
+			manifest: `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","artifactType":"application/vnd.example+type","layers":[]}`,
+			valid:    true,
+		},
+		{
+			name: "empty config without artifactType",
+			manifest: `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json",` +
+				`"config":{"mediaType":"application/vnd.oci.empty.v1+json","digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":2},"layers":[]}`,
+			valid: true, // Required by the specification, but only enforced by Validate
+		},
+		{
+			name: "empty config with an unexpected digest",
+			manifest: `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","artifactType":"application/vnd.example+type",` +
+				`"config":{"mediaType":"application/vnd.oci.empty.v1+json","digest":"sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270","size":2},"layers":[]}`,
+			valid: false,
+		},
+		{
+			name:     "invalid artifactType",
+			manifest: `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","artifactType":"not a MIME type","layers":[]}`,
+			valid:    false,
+		},
+	} {
+		err := parser([]byte(c.manifest))
+		if c.valid {
+			assert.NoError(t, err, c.name)
+		} else {
+			assert.Error(t, err, c.name)
+		}
+	}
+
+	// Limits on the contents are enforced
+	tooManyLayers := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[` +
+		strings.Repeat(`{},`, manifest.MaxDescriptors) + `{}]}`
+	err = parser([]byte(tooManyLayers))
+	var limitErr LimitExceededError
+	assert.ErrorAs(t, err, &limitErr)
+	assert.ErrorIs(t, err, types.ErrManifestInvalid)
+	largeAnnotations := `{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[],"annotations":{"a":"` +
+		strings.Repeat("x", manifest.MaxAnnotationsSize) + `"}}`
+	err = parser([]byte(largeAnnotations))
+	assert.ErrorAs(t, err, &limitErr)
+}
+
+func TestOCI1ArtifactFromComponents(t *testing.T) {
+	layers := []imgspecv1.Descriptor{{
+		MediaType: "application/vnd.example.sbom.v1+json",
+		Digest:    "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270",
+		Size:      32654,
+	}}
+
+	// Default empty config
+	m, err := OCI1ArtifactFromComponents("application/vnd.example.sbom.v1+json", nil, layers)
+	require.NoError(t, err)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, m.MediaType)
+	assert.Equal(t, "application/vnd.example.sbom.v1+json", m.ArtifactType)
+	assert.Equal(t, imgspecv1.DescriptorEmptyJSON, m.Config)
+	assert.Equal(t, layers, m.Layers)
+	serialized, err := m.Serialize()
+	require.NoError(t, err)
+	parsed, err := OCI1FromManifest(serialized)
+	require.NoError(t, err)
+	assert.Equal(t, m, parsed)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, GuessMIMEType(serialized))
+
+	// Explicit config
+	config := imgspecv1.Descriptor{
+		MediaType: "application/vnd.example.config.v1+json",
+		Digest:    "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a",
+		Size:      2,
+	}
+	m, err = OCI1ArtifactFromComponents("application/vnd.example.sbom.v1+json", &config, nil)
+	require.NoError(t, err)
+	assert.Equal(t, config, m.Config)
+	assert.Equal(t, []imgspecv1.Descriptor{}, m.Layers)
+
+	// Invalid artifact types
+	for _, artifactType := range []string{"", "not a MIME type"} {
+		_, err = OCI1ArtifactFromComponents(artifactType, nil, layers)
+		assert.Error(t, err, artifactType)
+	}
+}
+
+func TestOCI1ArtifactMIMEType(t *testing.T) {
+	m := manifestOCI1FromFixture(t, "ociv1.manifest.json")
+	assert.Equal(t, "", m.ArtifactMIMEType())
+
+	m = manifestOCI1FromFixture(t, "ociv1.artifact.json")
+	assert.Equal(t, "application/vnd.oci.custom.artifact.config.v1+json", m.ArtifactMIMEType())
+
+	m, err := OCI1ArtifactFromComponents("application/vnd.example.sbom.v1+json", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "application/vnd.example.sbom.v1+json", m.ArtifactMIMEType())
+}
+
+func TestOCI1SerializeWithoutConfig(t *testing.T) {
+	original := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","artifactType":"application/vnd.example+type","layers":[]}`)
+	m, err := OCI1FromManifest(original)
+	require.NoError(t, err)
+	assert.Equal(t, types.BlobInfo{}, m.ConfigInfo())
+	serialized, err := m.Serialize()
+	require.NoError(t, err)
+	assert.JSONEq(t, string(original), string(serialized))
 }
 
 func TestOCI1UpdateLayerInfos(t *testing.T) {
@@ -364,6 +482,31 @@ func TestOCI1UpdateLayerInfos(t *testing.T) {
 	}
 }
 
+func TestOCI1UpdateLayerInfosForeignLayers(t *testing.T) {
+	const (
+		layer1 = digest.Digest("sha256:1111111111111111111111111111111111111111111111111111111111111111")
+		layer2 = digest.Digest("sha256:2222222222222222222222222222222222222222222222222222222222222222")
+		layer3 = digest.Digest("sha256:3333333333333333333333333333333333333333333333333333333333333333")
+	)
+	urls := []string{"https://example.com/layer"}
+	m := OCI1FromComponents(imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageConfig}, []imgspecv1.Descriptor{
+		{MediaType: imgspecv1.MediaTypeImageLayerNonDistributableGzip, Digest: layer1, Size: 1, URLs: urls}, //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
+		{MediaType: imgspecv1.MediaTypeImageLayerNonDistributable, Digest: layer2, Size: 2, URLs: urls},     //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
+		{MediaType: imgspecv1.MediaTypeImageLayerNonDistributableZstd, Digest: layer3, Size: 3},             //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
+	})
+	err := m.UpdateLayerInfos([]types.BlobInfo{
+		{Digest: layer1, Size: 1},             // URLs dropped: converted
+		{Digest: layer2, Size: 2, URLs: urls}, // URLs preserved: unchanged
+		{Digest: layer3, Size: 3},             // No URLs originally: unchanged
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []imgspecv1.Descriptor{
+		{MediaType: imgspecv1.MediaTypeImageLayerGzip, Digest: layer1, Size: 1},
+		{MediaType: imgspecv1.MediaTypeImageLayerNonDistributable, Digest: layer2, Size: 2, URLs: urls}, //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
+		{MediaType: imgspecv1.MediaTypeImageLayerNonDistributableZstd, Digest: layer3, Size: 3},         //nolint:staticcheck // NonDistributable layers are deprecated, but we want to continue to support manipulating pre-existing images.
+	}, m.Layers)
+}
+
 func TestOCI1Inspect(t *testing.T) {
 	// Success is tested in image.TestManifestOCI1Inspect .
 	m := manifestOCI1FromFixture(t, "ociv1.artifact.json")
@@ -404,3 +547,38 @@ func TestOCI1CanChangeLayerCompression(t *testing.T) {
 	artifact := manifestOCI1FromFixture(t, "ociv1.artifact.json")
 	assert.False(t, artifact.CanChangeLayerCompression(imgspecv1.MediaTypeImageLayerGzip))
 }
+
+func TestOCI1SetSubject(t *testing.T) {
+	m := manifestOCI1FromFixture(t, "ociv1.manifest.json")
+	subject := imgspecv1.Descriptor{
+		MediaType:   imgspecv1.MediaTypeImageManifest,
+		Digest:      "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270",
+		Size:        7682,
+		Annotations: map[string]string{"a": "b"},
+	}
+	err := m.SetSubject(&subject)
+	require.NoError(t, err)
+	assert.Equal(t, &subject, m.Subject)
+	subject.Annotations["a"] = "modified" // m contains a copy
+	assert.Equal(t, "b", m.Subject.Annotations["a"])
+
+	serialized, err := m.Serialize()
+	require.NoError(t, err)
+	parsed, err := OCI1FromManifest(serialized)
+	require.NoError(t, err)
+	assert.Equal(t, m.Subject, parsed.Subject)
+
+	for _, invalid := range []imgspecv1.Descriptor{
+		{MediaType: imgspecv1.MediaTypeImageManifest, Digest: "sha256:invalid", Size: 1},
+		{MediaType: imgspecv1.MediaTypeImageManifest, Digest: "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270", Size: -1},
+		{MediaType: "", Digest: "sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270", Size: 1},
+	} {
+		err := m.SetSubject(&invalid)
+		assert.Error(t, err)
+	}
+	assert.Equal(t, "b", m.Subject.Annotations["a"])
+
+	err = m.SetSubject(nil)
+	require.NoError(t, err)
+	assert.Nil(t, m.Subject)
+}
@@ -0,0 +1,45 @@
+package manifest
+
+import (
+	"fmt"
+
+	"github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// PlatformMatcher decides whether an instance of a manifest list, with the specified platform, is acceptable,
+// and how much it is preferred: if ok, instances with lower score values are preferred.
+// Instances with equal scores are ordered as they appear in the manifest list.
+//
+// A PlatformMatcher can be used to customize instance selection compared to List.ChooseInstance,
+// e.g. to prefer some variants over others, or to accept other architectures which can be emulated.
+type PlatformMatcher = manifest.PlatformMatcher
+
+// WantedPlatforms returns all platforms compatible with the platform described by ctx, or with the current platform
+// if ctx does not specify any details; the most preferred platform is first.
+func WantedPlatforms(ctx *types.SystemContext) ([]imgspecv1.Platform, error) {
+	return manifest.WantedPlatforms(ctx)
+}
+
+// PlatformMatcherFromWanted returns a PlatformMatcher which accepts instances matching an item of wanted
+// (comparing the OS, architecture and variant), preferring earlier items.
+// If the matching item specifies an OS version, instances with the same major.minor.build OS version are preferred,
+// then instances which don’t specify an OS version, then instances with other OS versions.
+// This is the matching List.ChooseInstance uses, with wanted set to the return value of WantedPlatforms;
+// callers can reorder or extend that value before calling PlatformMatcherFromWanted.
+func PlatformMatcherFromWanted(wanted []imgspecv1.Platform) PlatformMatcher {
+	return manifest.PlatformMatcherFromWanted(wanted)
+}
+
+// ChooseInstanceMatching returns the digest of the instance of list most preferred by matcher.
+func ChooseInstanceMatching(list List, matcher PlatformMatcher) (digest.Digest, error) {
+	l, ok := list.(interface {
+		ChooseInstanceMatching(matcher PlatformMatcher) (digest.Digest, error)
+	})
+	if !ok {
+		return "", fmt.Errorf("choosing an instance using a custom platform matcher is not supported for manifest list type %T", list)
+	}
+	return l.ChooseInstanceMatching(matcher)
+}
@@ -0,0 +1,60 @@
+package manifest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// SubjectDescriptor returns a descriptor of manifestBlob, a manifest of manifestMIMEType,
+// suitable for use as the subject of a referrer (e.g. using OCI1.SetSubject).
+// If manifestMIMEType is "", it is guessed from manifestBlob.
+func SubjectDescriptor(manifestBlob []byte, manifestMIMEType string) (imgspecv1.Descriptor, error) {
+	mimeType := manifestMIMEType
+	if mimeType == "" {
+		mimeType = GuessMIMEType(manifestBlob)
+		if mimeType == "" {
+			return imgspecv1.Descriptor{}, errors.New("unrecognized manifest format")
+		}
+	}
+	mimeType = NormalizedMIMEType(mimeType)
+	manifestDigest, err := Digest(manifestBlob)
+	if err != nil {
+		return imgspecv1.Descriptor{}, fmt.Errorf("computing manifest digest: %w", err)
+	}
+	return imgspecv1.Descriptor{
+		MediaType: mimeType,
+		Digest:    manifestDigest,
+		Size:      int64(len(manifestBlob)),
+	}, nil
+}
+
+// ReferrersFallbackTag returns the tag which lists the referrers of the manifest with subjectDigest
+// on registries which don't support the referrers API, as defined by the “referrers tag schema”
+// of the OCI distribution-spec 1.1.
+func ReferrersFallbackTag(subjectDigest digest.Digest) (string, error) {
+	if err := subjectDigest.Validate(); err != nil {
+		return "", fmt.Errorf("invalid subject digest %q: %w", subjectDigest, err)
+	}
+	algorithm := referrersTagComponent(subjectDigest.Algorithm().String(), 32)
+	encoded := referrersTagComponent(subjectDigest.Encoded(), 64)
+	return algorithm + "-" + encoded, nil
+}
+
+// referrersTagComponent returns s, truncated to maxLen characters, with characters not valid in a tag replaced by '-'.
+func referrersTagComponent(s string, maxLen int) string {
+	if len(s) > maxLen {
+		s = s[:maxLen]
+	}
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '.', r == '-':
+			return r
+		default:
+			return '-'
+		}
+	}, s)
+}
@@ -0,0 +1,84 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubjectDescriptor(t *testing.T) {
+	for _, c := range []struct {
+		fixture, mimeType, expectedMIMEType string
+		expectedDigest                      digest.Digest
+	}{
+		{"v2s2.manifest.json", DockerV2Schema2MediaType, DockerV2Schema2MediaType, TestDockerV2S2ManifestDigest},
+		{"v2s2.manifest.json", "", DockerV2Schema2MediaType, TestDockerV2S2ManifestDigest},
+		{"v2s1.manifest.json", "", DockerV2Schema1SignedMediaType, TestDockerV2S1ManifestDigest},
+	} {
+		manifest, err := os.ReadFile(filepath.Join("fixtures", c.fixture))
+		require.NoError(t, err)
+		desc, err := SubjectDescriptor(manifest, c.mimeType)
+		require.NoError(t, err, c.fixture)
+		assert.Equal(t, imgspecv1.Descriptor{
+			MediaType: c.expectedMIMEType,
+			Digest:    c.expectedDigest,
+			Size:      int64(len(manifest)),
+		}, desc, c.fixture)
+	}
+
+	manifest, err := os.ReadFile(filepath.Join("fixtures", "ociv1.manifest.json"))
+	require.NoError(t, err)
+	desc, err := SubjectDescriptor(manifest, imgspecv1.MediaTypeImageManifest)
+	require.NoError(t, err)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, desc.MediaType)
+	assert.Equal(t, digest.FromBytes(manifest), desc.Digest)
+
+	_, err = SubjectDescriptor([]byte("not a manifest"), "")
+	assert.Error(t, err)
+}
+
+func TestReferrersFallbackTag(t *testing.T) {
+	for _, c := range []struct {
+		input    digest.Digest
+		expected string
+	}{
+		{
+			"sha256:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270",
+			"sha256-5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270",
+		},
+		{ // The encoded value is truncated to 64 characters
+			"sha512:00000000000000000000000000000000000000000000000000000000000000001111111111111111111111111111111111111111111111111111111111111111",
+			"sha512-0000000000000000000000000000000000000000000000000000000000000000",
+		},
+	} {
+		res, err := ReferrersFallbackTag(c.input)
+		require.NoError(t, err, c.input)
+		assert.Equal(t, c.expected, res, c.input)
+	}
+
+	for _, input := range []digest.Digest{"", "sha256:abc", "unknown:5b0bcabd1ed22e9fb1310cf6c2dec7cdef19f0ad69efa1f392e94a4333501270"} {
+		_, err := ReferrersFallbackTag(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestReferrersTagComponent(t *testing.T) {
+	for _, c := range []struct {
+		input    string
+		maxLen   int
+		expected string
+	}{
+		{"sha256", 32, "sha256"},
+		{"a+b:c/d", 32, "a-b-c-d"},
+		{"abcdef", 3, "abc"},
+		{"A_b.C-1", 32, "A_b.C-1"},
+	} {
+		res := referrersTagComponent(c.input, c.maxLen)
+		assert.Equal(t, c.expected, res, c.input)
+	}
+}
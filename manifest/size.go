@@ -0,0 +1,94 @@
+package manifest
+
+import (
+	"fmt"
+
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// LayerSize describes the sizes of a layer of an image, as far as they are known without reading the layer.
+type LayerSize struct {
+	// Digest and Size are the values recorded in the manifest; Size is -1 if unknown (e.g. in Docker schema1 manifests).
+	Digest digest.Digest
+	Size   int64
+	// UncompressedDigest is the digest of the uncompressed layer contents (the “DiffID”), or "" if unknown.
+	UncompressedDigest digest.Digest
+	// UncompressedSize is the size of the uncompressed layer contents, or -1 if unknown.
+	// The uncompressed size is not recorded in manifests or image configurations, so it is known only if the layer is not compressed.
+	UncompressedSize int64
+}
+
+// isUncompressedLayerMIMEType returns true if mimeType is a layer MIME type which implies that the layer is not compressed.
+func isUncompressedLayerMIMEType(mimeType string) bool {
+	switch mimeType {
+	case DockerV2SchemaLayerMediaTypeUncompressed, DockerV2Schema2ForeignLayerMediaType, imgspecv1.MediaTypeImageLayer:
+		return true
+	default:
+		return false
+	}
+}
+
+// LayerSizes returns the sizes of the layers of m, in order (the root layer first).
+// config, typically obtained from types.Image.OCIConfig, is used to determine the uncompressed digests of the layers;
+// it may be nil.
+// If cache is not nil, it is consulted for uncompressed digests not recorded in config.
+func LayerSizes(m Manifest, config *imgspecv1.Image, cache types.BlobInfoCache) ([]LayerSize, error) {
+	layers := m.LayerInfos()
+	var diffIDs []digest.Digest
+	if config != nil && len(config.RootFS.DiffIDs) != 0 {
+		diffIDs = config.RootFS.DiffIDs
+		nonEmptyLayers := 0
+		for _, layer := range layers {
+			if !layer.EmptyLayer {
+				nonEmptyLayers++
+			}
+		}
+		if len(diffIDs) != nonEmptyLayers {
+			return nil, fmt.Errorf("image configuration records %d layer digests, but the manifest has %d non-empty layers", len(diffIDs), nonEmptyLayers)
+		}
+	}
+
+	res := make([]LayerSize, len(layers))
+	diffIDIndex := 0
+	for i, layer := range layers {
+		res[i] = LayerSize{
+			Digest:           layer.Digest,
+			Size:             layer.Size,
+			UncompressedSize: -1,
+		}
+		if !layer.EmptyLayer && diffIDs != nil {
+			res[i].UncompressedDigest = diffIDs[diffIDIndex]
+			diffIDIndex++
+		} else if cache != nil {
+			res[i].UncompressedDigest = cache.UncompressedDigest(layer.Digest)
+		}
+		if isUncompressedLayerMIMEType(layer.MediaType) || (res[i].UncompressedDigest != "" && res[i].UncompressedDigest == layer.Digest) {
+			res[i].UncompressedDigest = layer.Digest
+			res[i].UncompressedSize = layer.Size
+		}
+	}
+	return res, nil
+}
+
+// TotalSize returns the total size of the blobs referenced by m, i.e. the config and all layers, as recorded in the manifest;
+// this is the amount of data to be transferred when pulling the image without any reuse of blobs.
+// The size of the manifest itself is not included.
+// It returns -1 if the size of any of the blobs is not known (e.g. for Docker schema1 manifests).
+func TotalSize(m Manifest) int64 {
+	total := int64(0)
+	if config := m.ConfigInfo(); config.Digest != "" {
+		if config.Size < 0 {
+			return -1
+		}
+		total += config.Size
+	}
+	for _, layer := range m.LayerInfos() {
+		if layer.Size < 0 {
+			return -1
+		}
+		total += layer.Size
+	}
+	return total
+}
@@ -0,0 +1,97 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// uncompressedDigestCache is a types.BlobInfoCache which only knows a fixed set of uncompressed digests.
+type uncompressedDigestCache map[digest.Digest]digest.Digest
+
+func (c uncompressedDigestCache) UncompressedDigest(anyDigest digest.Digest) digest.Digest {
+	return c[anyDigest]
+}
+
+func (c uncompressedDigestCache) RecordDigestUncompressedPair(anyDigest digest.Digest, uncompressed digest.Digest) {
+}
+
+func (c uncompressedDigestCache) RecordKnownLocation(transport types.ImageTransport, scope types.BICTransportScope, blobDigest digest.Digest, location types.BICLocationReference) {
+}
+
+func (c uncompressedDigestCache) CandidateLocations(transport types.ImageTransport, scope types.BICTransportScope, blobDigest digest.Digest, canSubstitute bool) []types.BICReplacementCandidate {
+	return nil
+}
+
+func TestLayerSizes(t *testing.T) {
+	const (
+		diffID1 = digest.Digest("sha256:1111111111111111111111111111111111111111111111111111111111111111")
+		diffID2 = digest.Digest("sha256:2222222222222222222222222222222222222222222222222222222222222222")
+		diffID3 = digest.Digest("sha256:3333333333333333333333333333333333333333333333333333333333333333")
+	)
+	manifestBlob, err := os.ReadFile(filepath.Join("fixtures", "v2s2.manifest.json"))
+	require.NoError(t, err)
+	m, err := Schema2FromManifest(manifestBlob)
+	require.NoError(t, err)
+	layers := m.LayerInfos()
+	require.Len(t, layers, 3)
+
+	// Nothing known about uncompressed data
+	res, err := LayerSizes(m, nil, nil)
+	require.NoError(t, err)
+	for i, layer := range layers {
+		assert.Equal(t, LayerSize{Digest: layer.Digest, Size: layer.Size, UncompressedSize: -1}, res[i])
+	}
+
+	// Uncompressed digests from config, and from the cache
+	config := &imgspecv1.Image{RootFS: imgspecv1.RootFS{Type: "layers", DiffIDs: []digest.Digest{diffID1, diffID2, diffID3}}}
+	res, err = LayerSizes(m, config, uncompressedDigestCache{layers[0].Digest: "sha256:0000000000000000000000000000000000000000000000000000000000000000"})
+	require.NoError(t, err)
+	assert.Equal(t, []digest.Digest{diffID1, diffID2, diffID3}, []digest.Digest{res[0].UncompressedDigest, res[1].UncompressedDigest, res[2].UncompressedDigest})
+	res, err = LayerSizes(m, nil, uncompressedDigestCache{layers[1].Digest: diffID2, layers[2].Digest: layers[2].Digest})
+	require.NoError(t, err)
+	assert.Equal(t, LayerSize{Digest: layers[0].Digest, Size: layers[0].Size, UncompressedSize: -1}, res[0])
+	assert.Equal(t, LayerSize{Digest: layers[1].Digest, Size: layers[1].Size, UncompressedDigest: diffID2, UncompressedSize: -1}, res[1])
+	// The cache says the layer is not compressed
+	assert.Equal(t, LayerSize{Digest: layers[2].Digest, Size: layers[2].Size, UncompressedDigest: layers[2].Digest, UncompressedSize: layers[2].Size}, res[2])
+
+	// Config inconsistent with the manifest
+	_, err = LayerSizes(m, &imgspecv1.Image{RootFS: imgspecv1.RootFS{Type: "layers", DiffIDs: []digest.Digest{diffID1}}}, nil)
+	assert.Error(t, err)
+
+	// Uncompressed layers
+	manifestBlob, err = os.ReadFile(filepath.Join("fixtures", "ociv1.uncompressed.manifest.json"))
+	require.NoError(t, err)
+	oci, err := OCI1FromManifest(manifestBlob)
+	require.NoError(t, err)
+	res, err = LayerSizes(oci, nil, nil)
+	require.NoError(t, err)
+	for i, layer := range oci.LayerInfos() {
+		assert.Equal(t, LayerSize{Digest: layer.Digest, Size: layer.Size, UncompressedDigest: layer.Digest, UncompressedSize: layer.Size}, res[i])
+	}
+}
+
+func TestTotalSize(t *testing.T) {
+	for _, c := range []struct {
+		fixture  string
+		parse    func([]byte) (Manifest, error)
+		expected int64
+	}{
+		{"v2s2.manifest.json", func(b []byte) (Manifest, error) { return Schema2FromManifest(b) }, 7023 + 32654 + 16724 + 73109},
+		{"ociv1.manifest.json", func(b []byte) (Manifest, error) { return OCI1FromManifest(b) }, 7023 + 32654 + 16724 + 73109},
+		// Schema1 does not record sizes
+		{"v2s1.manifest.json", func(b []byte) (Manifest, error) { return Schema1FromManifest(b) }, -1},
+	} {
+		manifestBlob, err := os.ReadFile(filepath.Join("fixtures", c.fixture))
+		require.NoError(t, err)
+		m, err := c.parse(manifestBlob)
+		require.NoError(t, err, c.fixture)
+		assert.Equal(t, c.expected, TotalSize(m), c.fixture)
+	}
+}
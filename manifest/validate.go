@@ -0,0 +1,345 @@
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Validate checks that manifestBlob structurally conforms to the specification of manifestMIMEType:
+// that required fields are present, digests are well-formed, media types are consistent, and descriptor sizes are sane.
+// If manifestMIMEType is "", it is guessed from manifestBlob.
+//
+// This is stricter than parsing the manifest (using FromBlob or ListFromBlob), which tolerates various
+// deviations from the specifications; it is intended for callers which want to reject malformed content early,
+// e.g. before storing it. It does not check that the referenced blobs or manifests exist, or match their descriptors.
+func Validate(manifestBlob []byte, manifestMIMEType string) error {
+	if len(manifestBlob) > iolimits.MaxManifestBodySize {
+		return fmt.Errorf("manifest is too large (%d bytes, at most %d allowed)", len(manifestBlob), iolimits.MaxManifestBodySize)
+	}
+	mimeType := manifestMIMEType
+	if mimeType == "" {
+		mimeType = GuessMIMEType(manifestBlob)
+		if mimeType == "" {
+			return errors.New("unrecognized manifest format")
+		}
+	}
+	mimeType = NormalizedMIMEType(mimeType)
+	if guessed := GuessMIMEType(manifestBlob); guessed != mimeType {
+		return fmt.Errorf("manifest of type %s does not match the expected type %s", guessed, mimeType)
+	}
+
+	var err error
+	switch mimeType {
+	case DockerV2Schema1MediaType, DockerV2Schema1SignedMediaType:
+		err = validateSchema1(manifestBlob)
+	case DockerV2Schema2MediaType:
+		err = validateSchema2(manifestBlob)
+	case DockerV2ListMediaType:
+		err = validateSchema2List(manifestBlob)
+	case imgspecv1.MediaTypeImageManifest:
+		err = validateOCI1(manifestBlob)
+	case imgspecv1.MediaTypeImageIndex:
+		err = validateOCI1Index(manifestBlob)
+	default: // Coverage: NormalizedMIMEType only returns the values above.
+		return fmt.Errorf("validating manifests of type %s is not supported", mimeType)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s manifest: %w", mimeType, err)
+	}
+	return nil
+}
+
+// validatedDescriptor is a descriptor, as used by all manifest formats, decoded so that missing fields can be detected.
+type validatedDescriptor struct {
+	MediaType    *string            `json:"mediaType"`
+	Digest       *string            `json:"digest"`
+	Size         *int64             `json:"size"`
+	URLs         []string           `json:"urls"`
+	Data         []byte             `json:"data"`
+	ArtifactType string             `json:"artifactType"`
+	Platform     *validatedPlatform `json:"platform"`
+}
+
+// validatedPlatform is a platform of a manifest list instance, decoded so that missing fields can be detected.
+type validatedPlatform struct {
+	Architecture string `json:"architecture"`
+	OS           string `json:"os"`
+}
+
+// validateDescriptor validates d, identified by name in error messages.
+// If maxSize is not -1, it is the largest sane size of the described object.
+func validateDescriptor(name string, d *validatedDescriptor, maxSize int64) error {
+	if d == nil {
+		return fmt.Errorf("%s is missing", name)
+	}
+	if d.MediaType == nil || *d.MediaType == "" {
+		return fmt.Errorf("%s has no media type", name)
+	}
+	if err := validateMediaType(*d.MediaType); err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if d.Digest == nil {
+		return fmt.Errorf("%s has no digest", name)
+	}
+	dgst, err := digest.Parse(*d.Digest)
+	if err != nil {
+		return fmt.Errorf("%s has an invalid digest %q: %w", name, *d.Digest, err)
+	}
+	if d.Size == nil {
+		return fmt.Errorf("%s has no size", name)
+	}
+	if *d.Size < 0 {
+		return fmt.Errorf("%s has an invalid size %d", name, *d.Size)
+	}
+	if maxSize != -1 && *d.Size > maxSize {
+		return fmt.Errorf("%s is unrealistically large (%d bytes, at most %d expected)", name, *d.Size, maxSize)
+	}
+	for _, u := range d.URLs {
+		parsed, err := url.Parse(u)
+		if err != nil {
+			return fmt.Errorf("%s has an invalid URL %q: %w", name, u, err)
+		}
+		if parsed.Scheme == "" || parsed.Host == "" {
+			return fmt.Errorf("%s has a URL %q which is not absolute", name, u)
+		}
+	}
+	if d.Data != nil {
+		if int64(len(d.Data)) != *d.Size {
+			return fmt.Errorf("%s has embedded data of size %d, but size %d", name, len(d.Data), *d.Size)
+		}
+		if actual := dgst.Algorithm().FromBytes(d.Data); actual != dgst {
+			return fmt.Errorf("%s has embedded data with digest %s, but digest %s", name, actual, dgst)
+		}
+	}
+	if d.ArtifactType != "" {
+		if err := validateMediaType(d.ArtifactType); err != nil {
+			return fmt.Errorf("%s has an invalid artifact type: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// validateListPlatform validates p, the platform of a list instance identified by name in error messages.
+func validateListPlatform(name string, p *validatedPlatform) error {
+	if p == nil {
+		return fmt.Errorf("%s has no platform", name)
+	}
+	if p.Architecture == "" {
+		return fmt.Errorf("%s has a platform with no architecture", name)
+	}
+	if p.OS == "" {
+		return fmt.Errorf("%s has a platform with no OS", name)
+	}
+	return nil
+}
+
+// validateMediaType validates the syntax of mediaType.
+func validateMediaType(mediaType string) error {
+	if _, _, err := mime.ParseMediaType(mediaType); err != nil {
+		return fmt.Errorf("invalid media type %q: %w", mediaType, err)
+	}
+	return nil
+}
+
+// validateSchemaVersion validates a schemaVersion field, which is required.
+func validateSchemaVersion(schemaVersion *int, expected int) error {
+	if schemaVersion == nil {
+		return errors.New("schemaVersion is missing")
+	}
+	if *schemaVersion != expected {
+		return fmt.Errorf("unexpected schemaVersion %d", *schemaVersion)
+	}
+	return nil
+}
+
+func validateSchema1(manifestBlob []byte) error {
+	if _, err := Schema1FromManifest(manifestBlob); err != nil {
+		return err
+	}
+	var m struct {
+		Name     string `json:"name"`
+		FSLayers []struct {
+			BlobSum *string `json:"blobSum"`
+		} `json:"fsLayers"`
+	}
+	if err := json.Unmarshal(manifestBlob, &m); err != nil {
+		return err
+	}
+	if m.Name == "" {
+		return errors.New("name is missing")
+	}
+	for i, layer := range m.FSLayers {
+		if layer.BlobSum == nil {
+			return fmt.Errorf("fsLayers[%d] has no blobSum", i)
+		}
+		if _, err := digest.Parse(*layer.BlobSum); err != nil {
+			return fmt.Errorf("fsLayers[%d] has an invalid blobSum %q: %w", i, *layer.BlobSum, err)
+		}
+	}
+	return nil
+}
+
+func validateSchema2(manifestBlob []byte) error {
+	if _, err := Schema2FromManifest(manifestBlob); err != nil {
+		return err
+	}
+	var m struct {
+		SchemaVersion *int                   `json:"schemaVersion"`
+		MediaType     string                 `json:"mediaType"`
+		Config        *validatedDescriptor   `json:"config"`
+		Layers        *[]validatedDescriptor `json:"layers"`
+	}
+	if err := json.Unmarshal(manifestBlob, &m); err != nil {
+		return err
+	}
+	if err := validateSchemaVersion(m.SchemaVersion, 2); err != nil {
+		return err
+	}
+	if m.MediaType != DockerV2Schema2MediaType {
+		return fmt.Errorf("unexpected mediaType %q", m.MediaType)
+	}
+	if err := validateDescriptor("config", m.Config, iolimits.MaxConfigBodySize); err != nil {
+		return err
+	}
+	if m.Layers == nil {
+		return errors.New("layers are missing")
+	}
+	for i := range *m.Layers {
+		if err := validateDescriptor(fmt.Sprintf("layers[%d]", i), &(*m.Layers)[i], -1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateSchema2List(manifestBlob []byte) error {
+	if _, err := Schema2ListFromManifest(manifestBlob); err != nil {
+		return err
+	}
+	var m struct {
+		SchemaVersion *int                   `json:"schemaVersion"`
+		MediaType     string                 `json:"mediaType"`
+		Manifests     *[]validatedDescriptor `json:"manifests"`
+	}
+	if err := json.Unmarshal(manifestBlob, &m); err != nil {
+		return err
+	}
+	if err := validateSchemaVersion(m.SchemaVersion, 2); err != nil {
+		return err
+	}
+	if m.MediaType != DockerV2ListMediaType {
+		return fmt.Errorf("unexpected mediaType %q", m.MediaType)
+	}
+	if m.Manifests == nil {
+		return errors.New("manifests are missing")
+	}
+	for i := range *m.Manifests {
+		name := fmt.Sprintf("manifests[%d]", i)
+		d := &(*m.Manifests)[i]
+		if err := validateDescriptor(name, d, iolimits.MaxManifestBodySize); err != nil {
+			return err
+		}
+		if err := validateListPlatform(name, d.Platform); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateOCI1(manifestBlob []byte) error {
+	if _, err := OCI1FromManifest(manifestBlob); err != nil {
+		return err
+	}
+	var m struct {
+		SchemaVersion *int                   `json:"schemaVersion"`
+		MediaType     string                 `json:"mediaType"`
+		ArtifactType  string                 `json:"artifactType"`
+		Config        *validatedDescriptor   `json:"config"`
+		Layers        *[]validatedDescriptor `json:"layers"`
+		Subject       *validatedDescriptor   `json:"subject"`
+	}
+	if err := json.Unmarshal(manifestBlob, &m); err != nil {
+		return err
+	}
+	if err := validateSchemaVersion(m.SchemaVersion, 2); err != nil {
+		return err
+	}
+	if m.MediaType != "" && m.MediaType != imgspecv1.MediaTypeImageManifest {
+		return fmt.Errorf("unexpected mediaType %q", m.MediaType)
+	}
+	if err := validateDescriptor("config", m.Config, iolimits.MaxConfigBodySize); err != nil {
+		return err
+	}
+	if *m.Config.MediaType == imgspecv1.MediaTypeEmptyJSON && m.ArtifactType == "" {
+		return fmt.Errorf("artifactType is missing, but required with a config of type %s", imgspecv1.MediaTypeEmptyJSON)
+	}
+	if m.Layers == nil {
+		return errors.New("layers are missing")
+	}
+	for i := range *m.Layers {
+		if err := validateDescriptor(fmt.Sprintf("layers[%d]", i), &(*m.Layers)[i], -1); err != nil {
+			return err
+		}
+	}
+	if m.Subject != nil {
+		if err := validateDescriptor("subject", m.Subject, iolimits.MaxManifestBodySize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateOCI1Index(manifestBlob []byte) error {
+	if _, err := OCI1IndexFromManifest(manifestBlob); err != nil {
+		return err
+	}
+	var m struct {
+		SchemaVersion *int                   `json:"schemaVersion"`
+		MediaType     string                 `json:"mediaType"`
+		ArtifactType  string                 `json:"artifactType"`
+		Manifests     *[]validatedDescriptor `json:"manifests"`
+		Subject       *validatedDescriptor   `json:"subject"`
+	}
+	if err := json.Unmarshal(manifestBlob, &m); err != nil {
+		return err
+	}
+	if err := validateSchemaVersion(m.SchemaVersion, 2); err != nil {
+		return err
+	}
+	if m.MediaType != "" && m.MediaType != imgspecv1.MediaTypeImageIndex {
+		return fmt.Errorf("unexpected mediaType %q", m.MediaType)
+	}
+	if m.ArtifactType != "" {
+		if err := validateMediaType(m.ArtifactType); err != nil {
+			return fmt.Errorf("invalid artifactType: %w", err)
+		}
+	}
+	if m.Manifests == nil {
+		return errors.New("manifests are missing")
+	}
+	for i := range *m.Manifests {
+		name := fmt.Sprintf("manifests[%d]", i)
+		d := &(*m.Manifests)[i]
+		if err := validateDescriptor(name, d, iolimits.MaxManifestBodySize); err != nil {
+			return err
+		}
+		if d.Platform != nil { // Optional in OCI, but if present, it must be complete.
+			if err := validateListPlatform(name, d.Platform); err != nil {
+				return err
+			}
+		}
+	}
+	if m.Subject != nil {
+		if err := validateDescriptor("subject", m.Subject, iolimits.MaxManifestBodySize); err != nil {
+			return err
+		}
+	}
+	return nil
+}
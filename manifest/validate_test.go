@@ -0,0 +1,160 @@
+package manifest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	// Valid manifests
+	for _, c := range []struct{ fixture, mimeType string }{
+		{"v2s1.manifest.json", DockerV2Schema1SignedMediaType},
+		{"v2s1-unsigned.manifest.json", DockerV2Schema1MediaType},
+		{"v2s2.manifest.json", DockerV2Schema2MediaType},
+		{"v2list.manifest.json", DockerV2ListMediaType},
+		{"ociv1.manifest.json", imgspecv1.MediaTypeImageManifest},
+		{"ociv1nomime.manifest.json", imgspecv1.MediaTypeImageManifest},
+		{"ociv1.encrypted.manifest.json", imgspecv1.MediaTypeImageManifest},
+		{"ociv1.image.index.json", imgspecv1.MediaTypeImageIndex},
+		{"ociv1nomime.image.index.json", imgspecv1.MediaTypeImageIndex},
+	} {
+		manifest, err := os.ReadFile(filepath.Join("fixtures", c.fixture))
+		require.NoError(t, err)
+		err = Validate(manifest, c.mimeType)
+		assert.NoError(t, err, c.fixture)
+		err = Validate(manifest, "")
+		assert.NoError(t, err, c.fixture)
+	}
+
+	// Unrecognized or mismatching formats
+	for _, c := range []struct{ fixture, mimeType string }{
+		{"non-json.manifest.json", ""},
+		{"unknown-version.manifest.json", ""},
+		{"v2s2.manifest.json", imgspecv1.MediaTypeImageManifest},
+		{"ociv1.manifest.json", DockerV2Schema2MediaType},
+		{"ociv1.image.index.json", DockerV2ListMediaType},
+		{"v2s1-unsigned.manifest.json", DockerV2Schema1SignedMediaType},
+		{"v2s2nomime.manifest.json", DockerV2Schema2MediaType},
+		{"ociv1.artifact.json", imgspecv1.MediaTypeImageManifest}, // A config with an empty digest
+	} {
+		manifest, err := os.ReadFile(filepath.Join("fixtures", c.fixture))
+		require.NoError(t, err)
+		err = Validate(manifest, c.mimeType)
+		assert.Error(t, err, c.fixture)
+	}
+
+	// Structural errors in otherwise valid manifests
+	for _, c := range []struct {
+		name, fixture, mimeType string
+		edit                    func(m map[string]any)
+	}{
+		{"v2s1 without name", "v2s1-unsigned.manifest.json", DockerV2Schema1MediaType, func(m map[string]any) {
+			delete(m, "name")
+		}},
+		{"v2s1 with invalid blobSum", "v2s1-unsigned.manifest.json", DockerV2Schema1MediaType, func(m map[string]any) {
+			descriptorAt(m, "fsLayers", 0)["blobSum"] = "sha256:invalid"
+		}},
+		{"v2s2 without schemaVersion", "v2s2.manifest.json", DockerV2Schema2MediaType, func(m map[string]any) {
+			delete(m, "schemaVersion")
+		}},
+		{"v2s2 without config", "v2s2.manifest.json", DockerV2Schema2MediaType, func(m map[string]any) {
+			delete(m, "config")
+		}},
+		{"v2s2 config without digest", "v2s2.manifest.json", DockerV2Schema2MediaType, func(m map[string]any) {
+			delete(m["config"].(map[string]any), "digest")
+		}},
+		{"v2s2 config too large", "v2s2.manifest.json", DockerV2Schema2MediaType, func(m map[string]any) {
+			m["config"].(map[string]any)["size"] = 1 << 40
+		}},
+		{"v2s2 without layers", "v2s2.manifest.json", DockerV2Schema2MediaType, func(m map[string]any) {
+			delete(m, "layers")
+		}},
+		{"v2s2 layer without size", "v2s2.manifest.json", DockerV2Schema2MediaType, func(m map[string]any) {
+			delete(descriptorAt(m, "layers", 0), "size")
+		}},
+		{"v2s2 layer with negative size", "v2s2.manifest.json", DockerV2Schema2MediaType, func(m map[string]any) {
+			descriptorAt(m, "layers", 0)["size"] = -1
+		}},
+		{"v2s2 layer with invalid media type", "v2s2.manifest.json", DockerV2Schema2MediaType, func(m map[string]any) {
+			descriptorAt(m, "layers", 0)["mediaType"] = "not a media type"
+		}},
+		{"v2s2 layer with relative URL", "v2s2.manifest.json", DockerV2Schema2MediaType, func(m map[string]any) {
+			descriptorAt(m, "layers", 0)["urls"] = []string{"/relative"}
+		}},
+		{"v2list without manifests", "v2list.manifest.json", DockerV2ListMediaType, func(m map[string]any) {
+			delete(m, "manifests")
+		}},
+		{"v2list instance without platform", "v2list.manifest.json", DockerV2ListMediaType, func(m map[string]any) {
+			delete(descriptorAt(m, "manifests", 0), "platform")
+		}},
+		{"v2list instance without OS", "v2list.manifest.json", DockerV2ListMediaType, func(m map[string]any) {
+			delete(descriptorAt(m, "manifests", 0)["platform"].(map[string]any), "os")
+		}},
+		{"v2list instance too large", "v2list.manifest.json", DockerV2ListMediaType, func(m map[string]any) {
+			descriptorAt(m, "manifests", 0)["size"] = 1 << 40
+		}},
+		{"OCI without config", "ociv1.manifest.json", imgspecv1.MediaTypeImageManifest, func(m map[string]any) {
+			delete(m, "config")
+		}},
+		{"OCI with wrong schemaVersion", "ociv1.manifest.json", imgspecv1.MediaTypeImageManifest, func(m map[string]any) {
+			m["schemaVersion"] = 3
+		}},
+		{"OCI layer with invalid digest", "ociv1.manifest.json", imgspecv1.MediaTypeImageManifest, func(m map[string]any) {
+			descriptorAt(m, "layers", 0)["digest"] = "sha256:abc"
+		}},
+		{"OCI layer with mismatched data", "ociv1.manifest.json", imgspecv1.MediaTypeImageManifest, func(m map[string]any) {
+			descriptorAt(m, "layers", 0)["data"] = []byte("{}")
+		}},
+		{"OCI with an empty config without artifactType", "ociv1.manifest.json", imgspecv1.MediaTypeImageManifest, func(m map[string]any) {
+			m["config"] = imgspecv1.DescriptorEmptyJSON
+		}},
+		{"OCI with invalid subject", "ociv1.manifest.json", imgspecv1.MediaTypeImageManifest, func(m map[string]any) {
+			m["subject"] = map[string]any{"mediaType": imgspecv1.MediaTypeImageManifest}
+		}},
+		{"OCI index without manifests", "ociv1.image.index.json", imgspecv1.MediaTypeImageIndex, func(m map[string]any) {
+			delete(m, "manifests")
+			m["mediaType"] = imgspecv1.MediaTypeImageIndex
+		}},
+		{"OCI index instance with incomplete platform", "ociv1.image.index.json", imgspecv1.MediaTypeImageIndex, func(m map[string]any) {
+			delete(descriptorAt(m, "manifests", 0)["platform"].(map[string]any), "architecture")
+		}},
+		{"OCI index with invalid artifactType", "ociv1.image.index.json", imgspecv1.MediaTypeImageIndex, func(m map[string]any) {
+			m["artifactType"] = "not a media type"
+		}},
+	} {
+		manifest, err := os.ReadFile(filepath.Join("fixtures", c.fixture))
+		require.NoError(t, err)
+		var m map[string]any
+		err = json.Unmarshal(manifest, &m)
+		require.NoError(t, err, c.name)
+		c.edit(m)
+		edited, err := json.Marshal(m)
+		require.NoError(t, err, c.name)
+		err = Validate(edited, c.mimeType)
+		assert.Error(t, err, c.name)
+	}
+
+	// Embedded data matching the descriptor is accepted
+	manifest, err := os.ReadFile(filepath.Join("fixtures", "ociv1.manifest.json"))
+	require.NoError(t, err)
+	var m map[string]any
+	err = json.Unmarshal(manifest, &m)
+	require.NoError(t, err)
+	m["config"] = imgspecv1.DescriptorEmptyJSON
+	m["artifactType"] = "application/vnd.example+type"
+	edited, err := json.Marshal(m)
+	require.NoError(t, err)
+	err = Validate(edited, imgspecv1.MediaTypeImageManifest)
+	assert.NoError(t, err)
+}
+
+// descriptorAt returns the i-th element of the m[field] array, which must be a JSON object.
+func descriptorAt(m map[string]any, field string, i int) map[string]any {
+	return m[field].([]any)[i].(map[string]any)
+}
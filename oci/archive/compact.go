@@ -0,0 +1,156 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	ocilayout "github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/types"
+)
+
+// GarbageReport describes files in an archive which are not used by any image in it.
+type GarbageReport struct {
+	Paths []string // Paths of the unused files within the archive, sorted.
+	Size  int64    // Total size of the unused files, in bytes (before compression, if the archive is compressed).
+}
+
+// PreviewCompaction returns a GarbageReport for the archive at path, describing the blobs Compact would remove
+// (e.g. blobs of images which were deleted or replaced). The archive is not modified.
+// If SystemContext.BigFilesTemporaryDir not "", overrides the temporary directory to use for extracting the archive.
+func PreviewCompaction(sys *types.SystemContext, path string) (GarbageReport, error) {
+	ref, err := archiveReferenceForCompaction(path)
+	if err != nil {
+		return GarbageReport{}, err
+	}
+	tempDirRef, err := createUntarTempDir(sys, ref)
+	if err != nil {
+		return GarbageReport{}, fmt.Errorf("extracting archive: %w", err)
+	}
+	defer func() {
+		_ = tempDirRef.deleteTempDir()
+	}()
+	return garbageReport(sys, tempDirRef.tempDirectory)
+}
+
+// Compact rewrites the archive at path so that it no longer contains blobs not used by any image in it,
+// and returns a GarbageReport describing the removed blobs.
+// The new archive uses the same compression as the original. It is written to a temporary file in the same directory,
+// which then atomically replaces the original, so the archive is never left in a partially-written state.
+// If there is nothing to remove, the archive is not modified.
+// Archives split into volumes are not supported.
+// If SystemContext.BigFilesTemporaryDir not "", overrides the temporary directory to use for extracting the archive.
+func Compact(sys *types.SystemContext, path string) (GarbageReport, error) {
+	ref, err := archiveReferenceForCompaction(path)
+	if err != nil {
+		return GarbageReport{}, err
+	}
+	fi, err := os.Stat(ref.resolvedFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			if _, err2 := os.Stat(ref.resolvedFile + volumesDescriptionSuffix); err2 == nil {
+				return GarbageReport{}, fmt.Errorf("compacting archive %q split into volumes is not supported", path)
+			}
+		}
+		return GarbageReport{}, err
+	}
+	compressionFormat, err := detectArchiveCompression(ref.resolvedFile)
+	if err != nil {
+		return GarbageReport{}, err
+	}
+
+	tempDirRef, err := createUntarTempDir(sys, ref)
+	if err != nil {
+		return GarbageReport{}, fmt.Errorf("extracting archive: %w", err)
+	}
+	defer func() {
+		_ = tempDirRef.deleteTempDir()
+	}()
+	report, err := garbageReport(sys, tempDirRef.tempDirectory)
+	if err != nil {
+		return GarbageReport{}, err
+	}
+	if len(report.Paths) == 0 {
+		return report, nil
+	}
+	// The extracted layout is private to us, so waiting for its locks can't block.
+	if _, err := ocilayout.GarbageCollect(context.Background(), sys, tempDirRef.tempDirectory); err != nil {
+		return GarbageReport{}, err
+	}
+	if err := replaceArchive(tempDirRef.tempDirectory, ref.resolvedFile, fi.Mode().Perm(), compressionFormat); err != nil {
+		return GarbageReport{}, err
+	}
+	return report, nil
+}
+
+// archiveReferenceForCompaction returns a reference for the archive at path.
+func archiveReferenceForCompaction(path string) (ociArchiveReference, error) {
+	ref, err := NewReference(path, "")
+	if err != nil {
+		return ociArchiveReference{}, err
+	}
+	return ref.(ociArchiveReference), nil
+}
+
+// garbageReport returns a GarbageReport for the OCI layout in dir, which must be private to the caller.
+func garbageReport(sys *types.SystemContext, dir string) (GarbageReport, error) {
+	digests, size, err := ocilayout.UnreferencedBlobs(context.Background(), sys, dir)
+	if err != nil {
+		return GarbageReport{}, err
+	}
+	paths := make([]string, 0, len(digests))
+	for _, d := range digests {
+		paths = append(paths, blobPathInArchive(d))
+	}
+	return GarbageReport{Paths: paths, Size: size}, nil
+}
+
+// detectArchiveCompression returns the compression algorithm of the archive at path, or nil if it is not compressed.
+func detectArchiveCompression(path string) (*compression.Algorithm, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	algo, decompressor, _, err := compression.DetectCompressionFormat(file)
+	if err != nil {
+		return nil, fmt.Errorf("detecting compression for file %q: %w", path, err)
+	}
+	if decompressor == nil {
+		return nil, nil
+	}
+	return &algo, nil
+}
+
+// replaceArchive atomically replaces the archive at dst with an archive of the OCI layout in src,
+// with permissions perm, compressed using compressionFormat if not nil.
+func replaceArchive(src, dst string, perm fs.FileMode, compressionFormat *compression.Algorithm) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+"-")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+	tempPath := tempFile.Name()
+	tempFile.Close()
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			os.Remove(tempPath)
+		}
+	}()
+
+	if err := tarDirectory(src, tempPath, compressionFormat, 0); err != nil {
+		return err
+	}
+	if err := os.Chmod(tempPath, perm); err != nil {
+		return err
+	}
+	if err := os.Rename(tempPath, dst); err != nil {
+		return err
+	}
+	succeeded = true
+	return nil
+}
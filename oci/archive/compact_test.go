@@ -0,0 +1,89 @@
+package archive
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	ocilayout "github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/pkg/compression"
+	cp "github.com/otiai10/copy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompact(t *testing.T) {
+	layoutDir := t.TempDir()
+	err := cp.Copy("../layout/fixtures/delete_image_multiple_images/", layoutDir)
+	require.NoError(t, err)
+	err = ocilayout.RemoveEntry(context.Background(), nil, layoutDir, "3.17.5")
+	require.NoError(t, err)
+
+	expectedPaths := []string{
+		"blobs/sha256/5b2aba4d3c27bc6493633d0ec446b25c8d0a5c9cfe99894bcdff0aee80813805",
+		"blobs/sha256/986315a0e599fac2b80eb31db2124dab8d3de04d7ca98b254999bd913c1f73fe",
+		"blobs/sha256/df11bc189adeb50dadb3291a3a7f2c34b36e0efdba0df70f2c8a2d761b215cde",
+	}
+	expectedSize := int64(0)
+	for _, p := range expectedPaths {
+		fi, err := os.Stat(filepath.Join(layoutDir, p))
+		require.NoError(t, err)
+		expectedSize += fi.Size()
+	}
+
+	for _, c := range []struct {
+		name        string
+		compression *compression.Algorithm
+	}{
+		{"uncompressed", nil},
+		{"gzip", &compression.Gzip},
+	} {
+		path := filepath.Join(t.TempDir(), "archive.tar")
+		err := tarDirectory(layoutDir, path, c.compression, 0)
+		require.NoError(t, err, c.name)
+		original, err := os.ReadFile(path)
+		require.NoError(t, err, c.name)
+
+		report, err := PreviewCompaction(nil, path)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, GarbageReport{Paths: expectedPaths, Size: expectedSize}, report, c.name)
+		afterPreview, err := os.ReadFile(path)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, original, afterPreview, c.name)
+
+		report, err = Compact(nil, path)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, GarbageReport{Paths: expectedPaths, Size: expectedSize}, report, c.name)
+		compressionFormat, err := detectArchiveCompression(path)
+		require.NoError(t, err, c.name)
+		if c.compression == nil {
+			assert.Nil(t, compressionFormat, c.name)
+		} else {
+			require.NotNil(t, compressionFormat, c.name)
+			assert.Equal(t, c.compression.Name(), compressionFormat.Name(), c.name)
+		}
+		report, err = PreviewCompaction(nil, path)
+		require.NoError(t, err, c.name)
+		assert.Empty(t, report.Paths, c.name)
+
+		// The remaining image is still usable
+		ref, err := NewReference(path, "3.18")
+		require.NoError(t, err, c.name)
+		src, err := ref.NewImageSource(context.Background(), nil)
+		require.NoError(t, err, c.name)
+		_, _, err = src.GetManifest(context.Background(), nil)
+		assert.NoError(t, err, c.name)
+		src.Close()
+
+		// Nothing to do on a second run
+		compacted, err := os.ReadFile(path)
+		require.NoError(t, err, c.name)
+		report, err = Compact(nil, path)
+		require.NoError(t, err, c.name)
+		assert.Empty(t, report.Paths, c.name)
+		afterSecondRun, err := os.ReadFile(path)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, compacted, afterSecondRun, c.name)
+	}
+}
@@ -11,23 +11,41 @@ import (
 	"github.com/containers/image/v5/internal/imagedestination/impl"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/oci/internal"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/pkg/logging"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage/pkg/archive"
 	"github.com/containers/storage/pkg/idtools"
 	digest "github.com/opencontainers/go-digest"
-	"github.com/sirupsen/logrus"
 )
 
 type ociArchiveImageDestination struct {
 	impl.Compat
 
-	ref          ociArchiveReference
-	unpackedDest private.ImageDestination
-	tempDirRef   tempDirOCIRef
+	ref               ociArchiveReference
+	unpackedDest      private.ImageDestination
+	tempDirRef        tempDirOCIRef
+	compressionFormat *compression.Algorithm // If not nil, the archive is compressed using this algorithm.
+	volumeSize        int64                  // If not 0, the archive is split into volumes of this size.
+	logger            types.Logger
 }
 
 // newImageDestination returns an ImageDestination for writing to an existing directory.
 func newImageDestination(ctx context.Context, sys *types.SystemContext, ref ociArchiveReference) (private.ImageDestination, error) {
+	var compressionFormat *compression.Algorithm
+	var volumeSize int64
+	if sys != nil {
+		compressionFormat = sys.OCIArchiveCompressionFormat
+		volumeSize = sys.OCIArchiveVolumeSize
+	}
+	if compressionFormat != nil && compressionFormat.Name() == compression.ZstdChunked.Name() {
+		return nil, fmt.Errorf("compressing oci-archive archives using %s is not supported", compressionFormat.Name())
+	}
+	if volumeSize < 0 {
+		return nil, fmt.Errorf("invalid oci-archive volume size %d", volumeSize)
+	}
+
 	tempDirRef, err := createOCIRef(sys, ref.image)
 	if err != nil {
 		return nil, fmt.Errorf("creating oci reference: %w", err)
@@ -40,9 +58,12 @@ func newImageDestination(ctx context.Context, sys *types.SystemContext, ref ociA
 		return nil, err
 	}
 	d := &ociArchiveImageDestination{
-		ref:          ref,
-		unpackedDest: imagedestination.FromPublic(unpackedDest),
-		tempDirRef:   tempDirRef,
+		ref:               ref,
+		unpackedDest:      imagedestination.FromPublic(unpackedDest),
+		tempDirRef:        tempDirRef,
+		compressionFormat: compressionFormat,
+		volumeSize:        volumeSize,
+		logger:            logging.For(sys),
 	}
 	d.Compat = impl.AddCompat(d)
 	return d, nil
@@ -58,7 +79,7 @@ func (d *ociArchiveImageDestination) Reference() types.ImageReference {
 func (d *ociArchiveImageDestination) Close() error {
 	defer func() {
 		err := d.tempDirRef.deleteTempDir()
-		logrus.Debugf("Error deleting temporary directory: %v", err)
+		d.logger.Debugf("Error deleting temporary directory: %v", err)
 	}()
 	return d.unpackedDest.Close()
 }
@@ -164,14 +185,17 @@ func (d *ociArchiveImageDestination) Commit(ctx context.Context, unparsedTopleve
 	src := d.tempDirRef.tempDirectory
 	// path to save tarred up file
 	dst := d.ref.resolvedFile
-	return tarDirectory(src, dst)
+	return tarDirectory(src, dst, d.compressionFormat, d.volumeSize)
 }
 
-// tar converts the directory at src and saves it to dst
-func tarDirectory(src, dst string) error {
+// tar converts the directory at src and saves it to dst,
+// compressed using compressionFormat if not nil, and split into volumes of volumeSize if not 0.
+func tarDirectory(src, dst string, compressionFormat *compression.Algorithm, volumeSize int64) error {
 	// input is a stream of bytes from the archive of the directory at path
 	input, err := archive.TarWithOptions(src, &archive.TarOptions{
 		Compression: archive.Uncompressed,
+		// The lock files of the layout are not a part of the image.
+		ExcludePatterns: []string{internal.BlobsLockFileName, internal.IndexLockFileName},
 		// Don’t include the data about the user account this code is running under.
 		ChownOpts: &idtools.IDPair{UID: 0, GID: 0},
 	})
@@ -181,15 +205,46 @@ func tarDirectory(src, dst string) error {
 	defer input.Close()
 
 	// creates the tar file
-	outFile, err := os.Create(dst)
+	var outFile io.WriteCloser
+	if volumeSize != 0 {
+		compressionName := ""
+		if compressionFormat != nil {
+			compressionName = compressionFormat.Name()
+		}
+		outFile, err = newVolumeWriter(dst, volumeSize, compressionName)
+	} else {
+		// Remove any description of volumes previously stored at dst, so that it is not confused with this archive.
+		if err := os.Remove(dst + volumesDescriptionSuffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		outFile, err = os.Create(dst)
+	}
 	if err != nil {
 		return fmt.Errorf("creating tar file %q: %w", dst, err)
 	}
-	defer outFile.Close()
 
 	// copies the contents of the directory to the tar file
 	// TODO: This can take quite some time, and should ideally be cancellable using a context.Context.
-	_, err = io.Copy(outFile, input)
+	if err := copyToArchive(outFile, input, compressionFormat); err != nil {
+		outFile.Close()
+		return err
+	}
+	return outFile.Close()
+}
 
-	return err
+// copyToArchive copies input to dest, compressing it using compressionFormat if not nil.
+func copyToArchive(dest io.Writer, input io.Reader, compressionFormat *compression.Algorithm) error {
+	if compressionFormat == nil {
+		_, err := io.Copy(dest, input)
+		return err
+	}
+	compressor, err := compression.CompressStream(dest, *compressionFormat, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(compressor, input); err != nil {
+		compressor.Close()
+		return err
+	}
+	return compressor.Close()
 }
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/oci/internal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -18,9 +19,12 @@ func TestTarDirectory(t *testing.T) {
 	srcDir := t.TempDir()
 	err := os.WriteFile(filepath.Join(srcDir, "regular"), []byte("contents"), 0o600)
 	require.NoError(t, err)
+	// Lock files of the layout are not included.
+	err = os.WriteFile(filepath.Join(srcDir, internal.IndexLockFileName), []byte{}, 0o600)
+	require.NoError(t, err)
 
 	dest := filepath.Join(t.TempDir(), "file.tar")
-	err = tarDirectory(srcDir, dest)
+	err = tarDirectory(srcDir, dest, nil, 0)
 	require.NoError(t, err)
 
 	f, err := os.Open(dest)
@@ -11,10 +11,10 @@ import (
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/signature"
 	ocilayout "github.com/containers/image/v5/oci/layout"
+	"github.com/containers/image/v5/pkg/logging"
 	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
-	"github.com/sirupsen/logrus"
 )
 
 // ImageNotFoundError is used when the OCI structure, in principle, exists and seems valid enough,
@@ -28,6 +28,11 @@ func (e ImageNotFoundError) Error() string {
 	return fmt.Sprintf("no descriptor found for reference %q", e.ref.image)
 }
 
+// Is allows errors.Is(e, types.ErrNotFound) to succeed.
+func (e ImageNotFoundError) Is(target error) bool {
+	return target == types.ErrNotFound
+}
+
 // ArchiveFileNotFoundError occurs when the archive file does not exist.
 type ArchiveFileNotFoundError struct {
 	// ref is the image reference
@@ -46,6 +51,7 @@ type ociArchiveImageSource struct {
 	ref         ociArchiveReference
 	unpackedSrc private.ImageSource
 	tempDirRef  tempDirOCIRef
+	logger      types.Logger
 }
 
 // newImageSource returns an ImageSource for reading from an existing directory.
@@ -71,6 +77,7 @@ func newImageSource(ctx context.Context, sys *types.SystemContext, ref ociArchiv
 		ref:         ref,
 		unpackedSrc: imagesource.FromPublic(unpackedSrc),
 		tempDirRef:  tempDirRef,
+		logger:      logging.For(sys),
 	}
 	s.Compat = impl.AddCompat(s)
 	return s, nil
@@ -94,7 +101,7 @@ func LoadManifestDescriptorWithContext(sys *types.SystemContext, imgRef types.Im
 	}
 	defer func() {
 		err := tempDirRef.deleteTempDir()
-		logrus.Debugf("Error deleting temporary directory: %v", err)
+		logging.For(sys).Debugf("Error deleting temporary directory: %v", err)
 	}()
 
 	descriptor, err := ocilayout.LoadManifestDescriptor(tempDirRef.ociRefExtracted)
@@ -114,7 +121,7 @@ func (s *ociArchiveImageSource) Reference() types.ImageReference {
 func (s *ociArchiveImageSource) Close() error {
 	defer func() {
 		err := s.tempDirRef.deleteTempDir()
-		logrus.Debugf("error deleting tmp dir: %v", err)
+		s.logger.Debugf("error deleting tmp dir: %v", err)
 	}()
 	return s.unpackedSrc.Close()
 }
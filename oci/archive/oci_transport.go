@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"strings"
@@ -35,6 +36,10 @@ type ociArchiveReference struct {
 	file         string
 	resolvedFile string
 	image        string
+	// If not nil, the reference refers to an image written to, or read from, this streamed archive;
+	// file and resolvedFile are "" in that case.
+	archiveWriter *Writer
+	archiveReader *Reader
 }
 
 func (t ociArchiveTransport) Name() string {
@@ -69,7 +74,7 @@ func NewReference(file, image string) (types.ImageReference, error) {
 		return nil, err
 	}
 
-	if err := internal.ValidateImageName(image); err != nil {
+	if _, err := internal.ParseImageSelector(image); err != nil {
 		return nil, err
 	}
 
@@ -91,6 +96,19 @@ func (ref ociArchiveReference) DockerReference() reference.Named {
 	return nil
 }
 
+// ImageName returns the name of the image within the OCI layout, as specified by the user, or "" if not specified.
+// This implements private.ImageNameAccessor.
+func (ref ociArchiveReference) ImageName() string {
+	return ref.image
+}
+
+// MetadataRequiresLayerAccess returns true because the whole archive is extracted when creating an ImageSource,
+// unless the reference was created by a Reader.
+// This implements private.MetadataAccessCostReporter.
+func (ref ociArchiveReference) MetadataRequiresLayerAccess() bool {
+	return ref.archiveReader == nil
+}
+
 // PolicyConfigurationIdentity returns a string representation of the reference, suitable for policy lookup.
 func (ref ociArchiveReference) PolicyConfigurationIdentity() string {
 	// NOTE: ref.image is not a part of the image identity, because "$dir:$someimage" and "$dir:" may mean the
@@ -129,12 +147,24 @@ func (ref ociArchiveReference) NewImage(ctx context.Context, sys *types.SystemCo
 // NewImageSource returns a types.ImageSource for this reference.
 // The caller must call .Close() on the returned ImageSource.
 func (ref ociArchiveReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	if ref.archiveReader != nil {
+		return newStreamImageSource(ref)
+	}
+	if ref.archiveWriter != nil {
+		return nil, errors.New("Reading images from an oci-archive Writer is not supported")
+	}
 	return newImageSource(ctx, sys, ref)
 }
 
 // NewImageDestination returns a types.ImageDestination for this reference.
 // The caller must call .Close() on the returned ImageDestination.
 func (ref ociArchiveReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	if ref.archiveWriter != nil {
+		return newStreamImageDestination(sys, ref)
+	}
+	if ref.archiveReader != nil {
+		return nil, errors.New("Writing images to an oci-archive Reader is not supported")
+	}
 	return newImageDestination(ctx, sys, ref)
 }
 
@@ -173,7 +203,12 @@ func createOCIRef(sys *types.SystemContext, image string) (tempDirOCIRef, error)
 // creates the temporary directory and copies the tarred content to it
 func createUntarTempDir(sys *types.SystemContext, ref ociArchiveReference) (tempDirOCIRef, error) {
 	src := ref.resolvedFile
+	var arch io.ReadCloser
 	arch, err := os.Open(src)
+	if errors.Is(err, fs.ErrNotExist) {
+		// The archive might have been split into volumes.
+		arch, err = openVolumes(src)
+	}
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
 			return tempDirOCIRef{}, ArchiveFileNotFoundError{ref: ref, path: src}
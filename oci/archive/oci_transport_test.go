@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/containers/image/v5/internal/private"
 	_ "github.com/containers/image/v5/internal/testing/explicitfilepath-tmpdir"
 	"github.com/containers/image/v5/types"
 	"github.com/stretchr/testify/assert"
@@ -163,7 +164,7 @@ func refToTempOCIArchive(t *testing.T) (ref types.ImageReference, tmpTarFile str
 	require.NoError(t, err)
 	tarFile, err := os.CreateTemp("", "oci-transport-test.tar")
 	require.NoError(t, err)
-	err = tarDirectory(tmpDir, tarFile.Name())
+	err = tarDirectory(tmpDir, tarFile.Name(), nil, 0)
 	require.NoError(t, err)
 	ref, err = NewReference(tarFile.Name(), "")
 	require.NoError(t, err)
@@ -199,6 +200,17 @@ func TestReferenceDockerReference(t *testing.T) {
 	assert.Nil(t, ref.DockerReference())
 }
 
+func TestReferenceImageName(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, image := range []string{"", "image", "example.com/repo:tag"} {
+		ref, err := NewReference(tmpDir, image)
+		require.NoError(t, err)
+		accessor, ok := ref.(private.ImageNameAccessor)
+		require.True(t, ok)
+		assert.Equal(t, image, accessor.ImageName())
+	}
+}
+
 func TestReferencePolicyConfigurationIdentity(t *testing.T) {
 	ref, tmpDir := refToTempOCI(t)
 
@@ -0,0 +1,140 @@
+package archive
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/oci/internal"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// Reader reads images from an OCI archive directly, using random access to the archive,
+// without extracting it into a temporary directory first.
+// This works e.g. with an *os.File, or with a ranged reader of an object in object storage.
+type Reader struct {
+	archive io.ReaderAt
+	// The following state is read once in NewReader and not modified afterwards.
+	files map[string]archiveFile // Regular files in the archive, indexed by their cleaned path.
+	index imgspecv1.Index
+}
+
+// archiveFile is the location of a regular file within an archive.
+type archiveFile struct {
+	offset int64
+	size   int64
+}
+
+// NewReader returns a Reader for an uncompressed OCI archive of size bytes, available in archive.
+// This reads all tar headers of the archive, but does not read the contents of the blobs.
+// The caller must keep archive usable as long as the Reader, or images obtained from it, are being used;
+// the Reader does not need to be closed.
+func NewReader(archive io.ReaderAt, size int64) (*Reader, error) {
+	r := &Reader{
+		archive: archive,
+		files:   map[string]archiveFile{},
+	}
+	// Using the io.SectionReader directly, which implements io.Seeker, allows tar.Reader to seek over file contents,
+	// and to report the offset of file contents without buffering.
+	stream := io.NewSectionReader(archive, 0, size)
+	tarReader := tar.NewReader(stream)
+	for {
+		hdr, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading OCI archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		offset, err := stream.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+		r.files[archivePath(hdr.Name)] = archiveFile{offset: offset, size: hdr.Size}
+	}
+
+	indexFile, ok := r.files[imgspecv1.ImageIndexFile]
+	if !ok {
+		return nil, fmt.Errorf("invalid OCI archive: %s not found", imgspecv1.ImageIndexFile)
+	}
+	indexBytes, err := iolimits.ReadAtMost(r.section(indexFile), iolimits.MaxManifestBodySize)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", imgspecv1.ImageIndexFile, err)
+	}
+	if err := json.Unmarshal(indexBytes, &r.index); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", imgspecv1.ImageIndexFile, err)
+	}
+	return r, nil
+}
+
+// List returns the entries of the index of the archive, in order.
+// The name of an entry, if any, is the value of its imgspecv1.AnnotationRefName annotation.
+func (r *Reader) List() []imgspecv1.Descriptor {
+	return r.index.Manifests
+}
+
+// NewReference returns an ImageReference for an image in Reader,
+// with an optional image name or other image selector (as in the oci-archive:path:image syntax).
+// The returned reference does not refer to a file, so it can not be round-tripped through
+// StringWithinTransport() and ParseReference.
+func (r *Reader) NewReference(image string) (types.ImageReference, error) {
+	if _, err := internal.ParseImageSelector(image); err != nil {
+		return nil, err
+	}
+	return ociArchiveReference{image: image, archiveReader: r}, nil
+}
+
+// manifestDescriptor returns the descriptor of the image selected by ref.image.
+func (r *Reader) manifestDescriptor(ref ociArchiveReference) (imgspecv1.Descriptor, error) {
+	desc, _, err := internal.ChooseManifestDescriptor(&r.index, ref.image, func(desc imgspecv1.Descriptor) (*imgspecv1.Index, error) {
+		stream, _, err := r.openBlob(desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		blob, err := iolimits.ReadAtMost(stream, iolimits.MaxManifestBodySize)
+		if err != nil {
+			return nil, err
+		}
+		index := imgspecv1.Index{}
+		if err := json.Unmarshal(blob, &index); err != nil {
+			return nil, err
+		}
+		return &index, nil
+	})
+	if errors.Is(err, internal.ErrImageNotFound) {
+		return imgspecv1.Descriptor{}, ImageNotFoundError{ref: ref}
+	}
+	return desc, err
+}
+
+// openBlob returns a reader for a blob with blobDigest, and its size.
+func (r *Reader) openBlob(blobDigest digest.Digest) (*io.SectionReader, int64, error) {
+	if err := blobDigest.Validate(); err != nil {
+		return nil, -1, fmt.Errorf("unexpected digest reference %s: %w", blobDigest, err)
+	}
+	file, ok := r.files[blobPathInArchive(blobDigest)]
+	if !ok {
+		return nil, -1, fmt.Errorf("blob %s not found in OCI archive", blobDigest)
+	}
+	return r.section(file), file.size, nil
+}
+
+// section returns a reader for file.
+func (r *Reader) section(file archiveFile) *io.SectionReader {
+	return io.NewSectionReader(r.archive, file.offset, file.size)
+}
+
+// archivePath returns a canonical form of a path within the archive, so that e.g. "./index.json" and "index.json" match.
+func archivePath(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
@@ -0,0 +1,206 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/containers/image/v5/internal/imagedestination/impl"
+	"github.com/containers/image/v5/internal/imagedestination/stubs"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/streamdigest"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// streamImageDestination is an ImageDestination writing directly to an oci-archive Writer.
+type streamImageDestination struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	stubs.NoPutBlobPartialInitialize
+	stubs.NoSignaturesInitialize
+
+	ref     ociArchiveReference
+	archive *Writer
+	sys     *types.SystemContext
+	// The top-level manifest, added to the index of the archive on Commit; nil if PutManifest was not called yet.
+	manifestDescriptor *imgspecv1.Descriptor
+}
+
+// newStreamImageDestination returns an ImageDestination for adding an image to ref.archiveWriter.
+func newStreamImageDestination(sys *types.SystemContext, ref ociArchiveReference) (private.ImageDestination, error) {
+	desiredLayerCompression := types.Compress
+	if sys != nil && sys.OCIAcceptUncompressedLayers {
+		desiredLayerCompression = types.PreserveOriginal
+	}
+	d := &streamImageDestination{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			SupportedManifestMIMETypes: []string{
+				imgspecv1.MediaTypeImageManifest,
+				imgspecv1.MediaTypeImageIndex,
+			},
+			DesiredLayerCompression: desiredLayerCompression,
+			// Unlike the oci/layout transport, the archive is not expected to be readable with access to the network,
+			// and the image source for streamed archives does not support external blobs.
+			AcceptsForeignLayerURLs:        false,
+			MustMatchRuntimeOS:             false,
+			IgnoresEmbeddedDockerReference: false, // N/A, DockerReference() returns nil.
+			// Blobs are written to the archive one at a time, so there is little benefit from concurrency.
+			HasThreadSafePutBlob: false,
+		}),
+		NoPutBlobPartialInitialize: stubs.NoPutBlobPartialRaw(ref.Transport().Name()),
+		NoSignaturesInitialize:     stubs.NoSignatures("Pushing signatures for OCI images is not supported"),
+
+		ref:     ref,
+		archive: ref.archiveWriter,
+		sys:     sys,
+	}
+	d.Compat = impl.AddCompat(d)
+	return d, nil
+}
+
+// Reference returns the reference used to set up this destination.  Note that this should directly correspond to user's intent,
+// e.g. it should use the public hostname instead of the result of resolving CNAMEs or following redirects.
+func (d *streamImageDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// Close removes resources associated with an initialized ImageDestination, if any.
+// The Writer is not closed, that is the responsibility of the caller that created it.
+func (d *streamImageDestination) Close() error {
+	return nil
+}
+
+// PutBlobWithOptions writes contents of stream and returns data representing the result.
+// inputInfo.Digest can be optionally provided if known; if provided, and stream is read to the end without error, the digest MUST match the stream contents.
+// inputInfo.Size is the expected length of stream, if known.
+// inputInfo.MediaType describes the blob format, if known.
+// WARNING: The contents of stream are being verified on the fly.  Until stream.Read() returns io.EOF, the contents of the data SHOULD NOT be available
+// to any other readers for download using the supplied digest.
+// If stream.Read() at any time, ESPECIALLY at end of input, returns an error, PutBlobWithOptions MUST 1) fail, and 2) delete any data stored so far.
+func (d *streamImageDestination) PutBlobWithOptions(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, options private.PutBlobOptions) (private.UploadedBlob, error) {
+	// The tar header must contain the size, and the path contains the digest, so if either is unknown
+	// (notably when compressing layers on the fly), we need to stream the blob into a temporary file first.
+	if inputInfo.Size == -1 || inputInfo.Digest == "" {
+		logging.For(d.sys).Debugf("oci-archive: input with unknown size, streaming to disk first ...")
+		streamCopy, cleanup, err := streamdigest.ComputeBlobInfo(d.sys, stream, &inputInfo)
+		if err != nil {
+			return private.UploadedBlob{}, err
+		}
+		defer cleanup()
+		stream = streamCopy
+		logging.For(d.sys).Debugf("... streaming done")
+	}
+
+	if err := d.archive.lock(); err != nil {
+		return private.UploadedBlob{}, err
+	}
+	defer d.archive.unlock()
+
+	if size, ok := d.archive.blobSizeLocked(inputInfo.Digest); ok {
+		return private.UploadedBlob{Digest: inputInfo.Digest, Size: size}, nil
+	}
+	if err := d.archive.sendBlobLocked(inputInfo.Digest, inputInfo.Size, stream); err != nil {
+		return private.UploadedBlob{}, err
+	}
+	return private.UploadedBlob{Digest: inputInfo.Digest, Size: inputInfo.Size}, nil
+}
+
+// TryReusingBlobWithOptions checks whether the transport already contains, or can efficiently reuse, a blob, and if so, applies it to the current destination
+// (e.g. if the blob is a filesystem layer, this signifies that the changes it describes need to be applied again when composing a filesystem tree).
+// info.Digest must not be empty.
+// If the blob has been successfully reused, returns (true, info, nil).
+// If the transport can not reuse the requested blob, TryReusingBlob returns (false, {}, nil); it returns a non-nil error only on an unexpected failure.
+func (d *streamImageDestination) TryReusingBlobWithOptions(ctx context.Context, info types.BlobInfo, options private.TryReusingBlobOptions) (bool, private.ReusedBlob, error) {
+	if !impl.OriginalBlobMatchesRequiredCompression(options) {
+		return false, private.ReusedBlob{}, nil
+	}
+	if info.Digest == "" {
+		return false, private.ReusedBlob{}, errors.New("Can not check for a blob with unknown digest")
+	}
+	if err := d.archive.lock(); err != nil {
+		return false, private.ReusedBlob{}, err
+	}
+	defer d.archive.unlock()
+
+	size, ok := d.archive.blobSizeLocked(info.Digest)
+	if !ok {
+		return false, private.ReusedBlob{}, nil
+	}
+	return true, private.ReusedBlob{Digest: info.Digest, Size: size}, nil
+}
+
+// PutManifest writes a manifest to the destination.  Per our list of supported manifest MIME types,
+// this should be either an OCI manifest (possibly converted to this format by the caller) or index,
+// neither of which we'll need to modify further.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to overwrite the manifest for (when
+// the primary manifest is a manifest list); this should always be nil if the primary manifest is not a manifest list.
+// It is expected but not enforced that the instanceDigest, when specified, matches the digest of `manifest` as generated
+// by `manifest.Digest()`.
+// FIXME? This should also receive a MIME type if known, to differentiate between schema versions.
+// If the destination is in principle available, refuses this manifest type (e.g. it does not recognize the schema),
+// but may accept a different manifest type, the returned error must be an ManifestTypeRejectedError.
+func (d *streamImageDestination) PutManifest(ctx context.Context, m []byte, instanceDigest *digest.Digest) error {
+	var manifestDigest digest.Digest
+	if instanceDigest != nil {
+		manifestDigest = *instanceDigest
+	} else {
+		var err error
+		manifestDigest, err = manifest.Digest(m)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := d.archive.lock(); err != nil {
+		return err
+	}
+	defer d.archive.unlock()
+
+	if _, ok := d.archive.blobSizeLocked(manifestDigest); !ok {
+		if err := d.archive.sendBlobLocked(manifestDigest, int64(len(m)), bytes.NewReader(m)); err != nil {
+			return err
+		}
+	}
+
+	if instanceDigest == nil {
+		desc := imgspecv1.Descriptor{
+			// If we knew the MIME type, we wouldn't have to guess here.
+			MediaType: manifest.GuessMIMEType(m),
+			Digest:    manifestDigest,
+			Size:      int64(len(m)),
+		}
+		if d.ref.image != "" {
+			desc.Annotations = map[string]string{
+				imgspecv1.AnnotationRefName: d.ref.image,
+			}
+		}
+		d.manifestDescriptor = &desc
+	}
+	return nil
+}
+
+// Commit marks the process of storing the image as successful and asks for the image to be persisted.
+// unparsedToplevel contains data about the top-level manifest of the source (which may be a single-arch image or a manifest list
+// if PutManifest was only called for the single-arch image with instanceDigest == nil), primarily to allow lookups by the
+// original manifest list digest, if desired.
+// The image is added to the index of the archive, which is written when the Writer is closed.
+// WARNING: This does not have any transactional semantics:
+// - Uploaded data MAY be visible to others before Commit() is called
+// - Uploaded data MAY be removed or MAY remain around if Close() is called without Commit() (i.e. rollback is allowed but not guaranteed)
+func (d *streamImageDestination) Commit(ctx context.Context, unparsedToplevel types.UnparsedImage) error {
+	if d.manifestDescriptor == nil {
+		return errors.New("Internal error: Commit called before PutManifest")
+	}
+	if err := d.archive.lock(); err != nil {
+		return err
+	}
+	defer d.archive.unlock()
+
+	d.archive.addManifestLocked(*d.manifestDescriptor)
+	return nil
+}
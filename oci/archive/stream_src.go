@@ -0,0 +1,104 @@
+package archive
+
+import (
+	"context"
+	"io"
+
+	"github.com/containers/image/v5/internal/imagesource/impl"
+	"github.com/containers/image/v5/internal/imagesource/stubs"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// streamImageSource is an ImageSource reading an image directly from an oci-archive Reader.
+type streamImageSource struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	impl.NoSignatures
+	impl.DoesNotAffectLayerInfosForCopy
+	stubs.NoGetBlobAtInitialize
+
+	ref        ociArchiveReference
+	archive    *Reader
+	descriptor imgspecv1.Descriptor
+}
+
+// newStreamImageSource returns an ImageSource for reading an image from ref.archiveReader.
+func newStreamImageSource(ref ociArchiveReference) (private.ImageSource, error) {
+	descriptor, err := ref.archiveReader.manifestDescriptor(ref)
+	if err != nil {
+		return nil, err
+	}
+	s := &streamImageSource{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			HasThreadSafeGetBlob: true, // io.ReaderAt allows parallel reads.
+		}),
+		NoGetBlobAtInitialize: stubs.NoGetBlobAtRaw(ref.Transport().Name()),
+
+		ref:        ref,
+		archive:    ref.archiveReader,
+		descriptor: descriptor,
+	}
+	s.Compat = impl.AddCompat(s)
+	return s, nil
+}
+
+// Reference returns the reference used to set up this source.
+func (s *streamImageSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// Close removes resources associated with an initialized ImageSource, if any.
+// The Reader is not closed, that is the responsibility of the caller that created it.
+func (s *streamImageSource) Close() error {
+	return nil
+}
+
+// GetManifest returns the image's manifest along with its MIME type (which may be empty when it can't be determined but the manifest is available).
+// It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve (when the primary manifest is a manifest list);
+// this never happens if the primary manifest is not a manifest list (e.g. if the source never returns manifest lists).
+func (s *streamImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	var dig digest.Digest
+	var mimeType string
+	if instanceDigest == nil {
+		dig = s.descriptor.Digest
+		mimeType = s.descriptor.MediaType
+	} else {
+		dig = *instanceDigest
+		for _, md := range s.archive.index.Manifests {
+			if md.Digest == dig {
+				mimeType = md.MediaType
+				break
+			}
+		}
+	}
+
+	stream, _, err := s.archive.openBlob(dig)
+	if err != nil {
+		return nil, "", err
+	}
+	m, err := iolimits.ReadAtMost(stream, iolimits.MaxManifestBodySize)
+	if err != nil {
+		return nil, "", err
+	}
+	if mimeType == "" {
+		mimeType = manifest.GuessMIMEType(m)
+	}
+	return m, mimeType, nil
+}
+
+// GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
+// The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
+// May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
+func (s *streamImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	stream, size, err := s.archive.openBlob(info.Digest)
+	if err != nil {
+		return nil, 0, err
+	}
+	return io.NopCloser(stream), size, nil
+}
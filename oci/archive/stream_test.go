@@ -0,0 +1,183 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspec "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var _ private.ImageDestination = (*streamImageDestination)(nil)
+var _ private.ImageSource = (*streamImageSource)(nil)
+
+// putTestImage writes an image with the specified config and layer contents to ref, using sys, and returns its manifest.
+func putTestImage(t *testing.T, ref types.ImageReference, sys *types.SystemContext, config, layer []byte) []byte {
+	ctx := context.Background()
+	dest, err := ref.NewImageDestination(ctx, sys)
+	require.NoError(t, err)
+	defer dest.Close()
+
+	cache := memory.New()
+	configInfo, err := dest.PutBlob(ctx, bytes.NewReader(config), types.BlobInfo{Digest: digest.FromBytes(config), Size: int64(len(config))}, cache, true)
+	require.NoError(t, err)
+	// Unknown digest and size, as if the layer were compressed on the fly.
+	layerInfo, err := dest.PutBlob(ctx, bytes.NewReader(layer), types.BlobInfo{Size: -1}, cache, false)
+	require.NoError(t, err)
+	assert.Equal(t, digest.FromBytes(layer), layerInfo.Digest)
+	assert.Equal(t, int64(len(layer)), layerInfo.Size)
+
+	m, err := json.Marshal(imgspecv1.Manifest{
+		Versioned: imgspec.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Config:    imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageConfig, Digest: configInfo.Digest, Size: configInfo.Size},
+		Layers:    []imgspecv1.Descriptor{{MediaType: imgspecv1.MediaTypeImageLayer, Digest: layerInfo.Digest, Size: layerInfo.Size}},
+	})
+	require.NoError(t, err)
+	err = dest.PutManifest(ctx, m, nil)
+	require.NoError(t, err)
+	err = dest.Commit(ctx, nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	require.NoError(t, err)
+	return m
+}
+
+func TestStreamedArchive(t *testing.T) {
+	ctx := context.Background()
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)
+	sharedLayer := []byte("shared layer contents")
+	otherLayer := []byte("other layer contents")
+
+	var buf bytes.Buffer
+	writer := NewWriter(&buf)
+	ref1, err := writer.NewReference("first")
+	require.NoError(t, err)
+	manifest1 := putTestImage(t, ref1, nil, config, sharedLayer)
+	ref2, err := writer.NewReference("second")
+	require.NoError(t, err)
+	manifest2 := putTestImage(t, ref2, nil, config, otherLayer)
+	// The config is shared by both images, so it is only reused, not written again.
+	reused, _, err := func() (bool, types.BlobInfo, error) {
+		dest, err := ref2.NewImageDestination(ctx, nil)
+		require.NoError(t, err)
+		defer dest.Close()
+		return dest.TryReusingBlob(ctx, types.BlobInfo{Digest: digest.FromBytes(config)}, memory.New(), false)
+	}()
+	require.NoError(t, err)
+	assert.True(t, reused)
+	err = writer.Close()
+	require.NoError(t, err)
+	err = writer.Close() // Closing the Writer twice fails.
+	assert.Error(t, err)
+
+	// Each file is included only once, and does not contain data about the current user.
+	tarReader := tar.NewReader(bytes.NewReader(buf.Bytes()))
+	names := []string{}
+	for {
+		hdr, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		assert.Equal(t, 0, hdr.Uid)
+		assert.Equal(t, 0, hdr.Gid)
+		assert.Empty(t, hdr.Uname)
+		assert.Empty(t, hdr.Gname)
+		names = append(names, hdr.Name)
+	}
+	assert.ElementsMatch(t, []string{
+		blobPathInArchive(digest.FromBytes(config)),
+		blobPathInArchive(digest.FromBytes(sharedLayer)),
+		blobPathInArchive(digest.FromBytes(manifest1)),
+		blobPathInArchive(digest.FromBytes(otherLayer)),
+		blobPathInArchive(digest.FromBytes(manifest2)),
+		imgspecv1.ImageLayoutFile,
+		imgspecv1.ImageIndexFile,
+	}, names)
+
+	reader, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	require.NoError(t, err)
+	entries := reader.List()
+	require.Len(t, entries, 2)
+	assert.Equal(t, "first", entries[0].Annotations[imgspecv1.AnnotationRefName])
+	assert.Equal(t, "second", entries[1].Annotations[imgspecv1.AnnotationRefName])
+
+	for _, c := range []struct {
+		image    string
+		manifest []byte
+		layer    []byte
+	}{
+		{"first", manifest1, sharedLayer},
+		{"second", manifest2, otherLayer},
+	} {
+		ref, err := reader.NewReference(c.image)
+		require.NoError(t, err)
+		src, err := ref.NewImageSource(ctx, nil)
+		require.NoError(t, err)
+		defer src.Close()
+		m, mimeType, err := src.GetManifest(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, c.manifest, m)
+		assert.Equal(t, imgspecv1.MediaTypeImageManifest, mimeType)
+		for _, expected := range [][]byte{config, c.layer} {
+			stream, size, err := src.GetBlob(ctx, types.BlobInfo{Digest: digest.FromBytes(expected), Size: -1}, memory.New())
+			require.NoError(t, err)
+			contents, err := io.ReadAll(stream)
+			require.NoError(t, err)
+			stream.Close()
+			assert.Equal(t, expected, contents)
+			assert.Equal(t, int64(len(expected)), size)
+		}
+		_, _, err = src.GetBlob(ctx, types.BlobInfo{Digest: digest.FromBytes([]byte("missing")), Size: -1}, memory.New())
+		assert.Error(t, err)
+	}
+
+	// An image name must be provided if there is more than one image.
+	ref, err := reader.NewReference("")
+	require.NoError(t, err)
+	_, err = ref.NewImageSource(ctx, nil)
+	assert.Error(t, err)
+	// Images can be selected by digest or by annotation.
+	for _, image := range []string{digest.FromBytes(manifest2).String(), imgspecv1.AnnotationRefName + "=second"} {
+		ref, err = reader.NewReference(image)
+		require.NoError(t, err)
+		src, err := ref.NewImageSource(ctx, nil)
+		require.NoError(t, err)
+		m, _, err := src.GetManifest(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, manifest2, m)
+		src.Close()
+	}
+	// Unknown image names are reported.
+	ref, err = reader.NewReference("unknown")
+	require.NoError(t, err)
+	_, err = ref.NewImageSource(ctx, nil)
+	var notFound ImageNotFoundError
+	assert.ErrorAs(t, err, &notFound)
+	// Readers can't be written to.
+	_, err = ref.NewImageDestination(ctx, nil)
+	assert.Error(t, err)
+}
+
+func TestNewReaderInvalidArchive(t *testing.T) {
+	var buf bytes.Buffer
+	tarWriter := tar.NewWriter(&buf)
+	err := tarWriter.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: "unrelated", Size: 0})
+	require.NoError(t, err)
+	err = tarWriter.Close()
+	require.NoError(t, err)
+	_, err = NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	assert.Error(t, err)
+
+	_, err = NewReader(bytes.NewReader([]byte("not a tar file at all, padded to some length")), 44)
+	assert.Error(t, err)
+}
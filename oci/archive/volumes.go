@@ -0,0 +1,230 @@
+package archive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/containers/image/v5/internal/iolimits"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// volumesDescriptionSuffix is appended to the path of an archive to form the path of the description of its volumes.
+const volumesDescriptionSuffix = ".volumes.json"
+
+// volumeSet is the description of an archive split into volumes, stored as JSON.
+type volumeSet struct {
+	Compression string   `json:"compression,omitempty"` // The name of the compression algorithm of the archive, or "" if it is not compressed.
+	Size        int64    `json:"size"`                  // The total size of all volumes.
+	Volumes     []volume `json:"volumes"`
+}
+
+// volume is a single part of an archive split into volumes.
+type volume struct {
+	Name   string        `json:"name"` // The file name of the volume, in the same directory as the description.
+	Size   int64         `json:"size"`
+	Digest digest.Digest `json:"digest"`
+}
+
+// volumeFileName returns the path of volume number i (starting at 1) of an archive at path.
+func volumeFileName(path string, i int) string {
+	return fmt.Sprintf("%s.%03d", path, i)
+}
+
+// volumeWriter is an io.WriteCloser which splits its input into volumes of an archive.
+type volumeWriter struct {
+	path       string // The path of the archive.
+	volumeSize int64
+	set        volumeSet
+	current    *os.File // The volume being written, or nil.
+	digester   digest.Digester
+	written    int64 // The number of bytes written to current.
+}
+
+// newVolumeWriter returns a writer which stores an archive at path as volumes of at most volumeSize bytes,
+// and, when closed, writes a description of the volumes.
+// compressionName is the name of the compression algorithm used for the archive, or "".
+func newVolumeWriter(path string, volumeSize int64, compressionName string) (*volumeWriter, error) {
+	if volumeSize <= 0 {
+		return nil, fmt.Errorf("invalid volume size %d", volumeSize)
+	}
+	// Remove any archive previously stored at path, so that it is not used instead of the volumes when reading.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return &volumeWriter{
+		path:       path,
+		volumeSize: volumeSize,
+		set: volumeSet{
+			Compression: compressionName,
+			Volumes:     []volume{},
+		},
+	}, nil
+}
+
+// Write implements io.Writer.
+func (w *volumeWriter) Write(p []byte) (int, error) {
+	total := 0
+	for len(p) > 0 {
+		if w.current == nil || w.written == w.volumeSize {
+			if err := w.startVolume(); err != nil {
+				return total, err
+			}
+		}
+		chunk := p
+		if remaining := w.volumeSize - w.written; int64(len(chunk)) > remaining {
+			chunk = chunk[:remaining]
+		}
+		n, err := w.current.Write(chunk)
+		w.digester.Hash().Write(chunk[:n])
+		w.written += int64(n)
+		total += n
+		if err != nil {
+			return total, err
+		}
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// startVolume finishes the current volume, if any, and starts a new one.
+func (w *volumeWriter) startVolume() error {
+	if err := w.finishVolume(); err != nil {
+		return err
+	}
+	f, err := os.Create(volumeFileName(w.path, len(w.set.Volumes)+1))
+	if err != nil {
+		return err
+	}
+	w.current = f
+	w.digester = digest.Canonical.Digester()
+	w.written = 0
+	return nil
+}
+
+// finishVolume closes the current volume, if any, and records it in w.set.
+func (w *volumeWriter) finishVolume() error {
+	if w.current == nil {
+		return nil
+	}
+	f := w.current
+	w.current = nil
+	if err := f.Close(); err != nil {
+		return err
+	}
+	w.set.Volumes = append(w.set.Volumes, volume{
+		Name:   filepath.Base(f.Name()),
+		Size:   w.written,
+		Digest: w.digester.Digest(),
+	})
+	w.set.Size += w.written
+	return nil
+}
+
+// Close finishes the last volume, and writes the description of the volumes.
+func (w *volumeWriter) Close() error {
+	if err := w.finishVolume(); err != nil {
+		return err
+	}
+	description, err := json.Marshal(w.set)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(w.path+volumesDescriptionSuffix, description, 0644)
+}
+
+// openVolumes returns a reader of an archive at path split into volumes, verifying the contents of every volume
+// as it is read, or an error satisfying errors.Is(err, fs.ErrNotExist) if there is no description of volumes for path.
+func openVolumes(path string) (io.ReadCloser, error) {
+	descriptionFile, err := os.Open(path + volumesDescriptionSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer descriptionFile.Close()
+	description, err := iolimits.ReadAtMost(descriptionFile, iolimits.MaxTarFileManifestSize)
+	if err != nil {
+		return nil, err
+	}
+	var set volumeSet
+	if err := json.Unmarshal(description, &set); err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", descriptionFile.Name(), err)
+	}
+	if len(set.Volumes) == 0 {
+		return nil, fmt.Errorf("%q does not list any volumes", descriptionFile.Name())
+	}
+	for _, v := range set.Volumes {
+		if v.Name == "" || filepath.Base(v.Name) != v.Name {
+			return nil, fmt.Errorf("invalid volume name %q in %q", v.Name, descriptionFile.Name())
+		}
+		if err := v.Digest.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid digest of volume %q in %q: %w", v.Name, descriptionFile.Name(), err)
+		}
+	}
+	return &volumeReader{
+		dir:     filepath.Dir(path),
+		volumes: set.Volumes,
+	}, nil
+}
+
+// volumeReader is an io.ReadCloser which reads the volumes of an archive in order.
+type volumeReader struct {
+	dir      string
+	volumes  []volume // Volumes not finished yet, starting with the one being read.
+	current  *os.File // The volume being read, or nil.
+	verifier digest.Verifier
+	read     int64 // The number of bytes read from current.
+}
+
+// Read implements io.Reader.
+func (r *volumeReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.volumes) == 0 {
+				return 0, io.EOF
+			}
+			f, err := os.Open(filepath.Join(r.dir, r.volumes[0].Name))
+			if err != nil {
+				return 0, err
+			}
+			r.current = f
+			r.verifier = r.volumes[0].Digest.Verifier()
+			r.read = 0
+		}
+
+		n, err := r.current.Read(p)
+		r.verifier.Write(p[:n])
+		r.read += int64(n)
+		if err == io.EOF {
+			v := r.volumes[0]
+			closeErr := r.current.Close()
+			r.current = nil
+			r.volumes = r.volumes[1:]
+			if r.read != v.Size {
+				return n, fmt.Errorf("volume %q has %d bytes, expected %d", v.Name, r.read, v.Size)
+			}
+			if !r.verifier.Verified() {
+				return n, fmt.Errorf("volume %q does not match its digest %s", v.Name, v.Digest.String())
+			}
+			if closeErr != nil {
+				return n, closeErr
+			}
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+// Close implements io.Closer.
+func (r *volumeReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
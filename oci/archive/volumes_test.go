@@ -0,0 +1,123 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVolumes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.tar")
+	err := os.WriteFile(path, []byte("a stale archive"), 0o600)
+	require.NoError(t, err)
+
+	data := bytes.Repeat([]byte("0123456789"), 250)
+	w, err := newVolumeWriter(path, 1000, "zstd")
+	require.NoError(t, err)
+	for _, chunk := range [][]byte{data[:10], data[10:1990], data[1990:]} {
+		n, err := w.Write(chunk)
+		require.NoError(t, err)
+		assert.Equal(t, len(chunk), n)
+	}
+	err = w.Close()
+	require.NoError(t, err)
+
+	// The stale archive is removed, so that it is not used instead of the volumes.
+	_, err = os.Stat(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	descriptionBytes, err := os.ReadFile(path + volumesDescriptionSuffix)
+	require.NoError(t, err)
+	var description volumeSet
+	err = json.Unmarshal(descriptionBytes, &description)
+	require.NoError(t, err)
+	assert.Equal(t, volumeSet{
+		Compression: "zstd",
+		Size:        int64(len(data)),
+		Volumes: []volume{
+			{Name: "archive.tar.001", Size: 1000, Digest: digest.FromBytes(data[:1000])},
+			{Name: "archive.tar.002", Size: 1000, Digest: digest.FromBytes(data[1000:2000])},
+			{Name: "archive.tar.003", Size: 500, Digest: digest.FromBytes(data[2000:])},
+		},
+	}, description)
+
+	r, err := openVolumes(path)
+	require.NoError(t, err)
+	contents, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, data, contents)
+	err = r.Close()
+	require.NoError(t, err)
+
+	// Modified volumes are detected.
+	err = os.WriteFile(volumeFileName(path, 2), bytes.Repeat([]byte("x"), 1000), 0o600)
+	require.NoError(t, err)
+	r, err = openVolumes(path)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r)
+	assert.Error(t, err)
+	r.Close()
+	err = os.WriteFile(volumeFileName(path, 2), data[1000:1999], 0o600)
+	require.NoError(t, err)
+	r, err = openVolumes(path)
+	require.NoError(t, err)
+	_, err = io.ReadAll(r)
+	assert.Error(t, err)
+	r.Close()
+
+	// Missing descriptions are reported as such.
+	_, err = openVolumes(filepath.Join(t.TempDir(), "this-does-not-exist"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	// Volume names can't refer to other directories.
+	invalidPath := filepath.Join(t.TempDir(), "invalid.tar")
+	err = os.WriteFile(invalidPath+volumesDescriptionSuffix, []byte(`{"size":1,"volumes":[{"name":"../archive.tar.001","size":1,"digest":"`+digest.FromString("").String()+`"}]}`), 0o600)
+	require.NoError(t, err)
+	_, err = openVolumes(invalidPath)
+	assert.Error(t, err)
+}
+
+func TestCompressedVolumesRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	config := []byte(`{"architecture":"amd64","os":"linux","rootfs":{"type":"layers","diff_ids":[]}}`)
+	layer := bytes.Repeat([]byte("layer contents"), 1000)
+	path := filepath.Join(t.TempDir(), "archive.tar")
+	ref, err := NewReference(path, "")
+	require.NoError(t, err)
+
+	_, err = ref.NewImageDestination(ctx, &types.SystemContext{OCIArchiveCompressionFormat: &compression.ZstdChunked})
+	assert.Error(t, err)
+
+	m := putTestImage(t, ref, &types.SystemContext{
+		OCIArchiveCompressionFormat: &compression.Zstd,
+		OCIArchiveVolumeSize:        200,
+	}, config, layer)
+	firstVolume, err := os.ReadFile(volumeFileName(path, 1))
+	require.NoError(t, err)
+	assert.Len(t, firstVolume, 200)
+	assert.Equal(t, []byte{0x28, 0xb5, 0x2f, 0xfd}, firstVolume[:4]) // zstd magic
+	_, err = os.Stat(volumeFileName(path, 2))
+	require.NoError(t, err)
+
+	src, err := ref.NewImageSource(ctx, nil)
+	require.NoError(t, err)
+	defer src.Close()
+	manifest, _, err := src.GetManifest(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, m, manifest)
+
+	// Writing the archive again, as a single file, removes the description of the volumes.
+	putTestImage(t, ref, nil, config, layer)
+	_, err = os.Stat(path + volumesDescriptionSuffix)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(path)
+	require.NoError(t, err)
+}
@@ -0,0 +1,194 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/containers/image/v5/oci/internal"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspec "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+// Writer writes an OCI archive directly to an io.Writer, as images are added to it,
+// without creating a complete OCI layout in a temporary directory first.
+// This allows sending large images e.g. to a pipe, with disk usage bounded by the size of a single blob.
+type Writer struct {
+	mutex sync.Mutex
+	// ALL of the following members can only be accessed with the mutex held.
+	// Use Writer.lock() to obtain the mutex.
+	tar   *tar.Writer // nil if the Writer has already been closed.
+	blobs map[digest.Digest]int64
+	index imgspecv1.Index
+}
+
+// NewWriter returns a Writer for dest.
+// The caller must eventually call .Close() on the returned object to create a valid archive;
+// dest itself is not closed by the Writer.
+func NewWriter(dest io.Writer) *Writer {
+	return &Writer{
+		tar:   tar.NewWriter(dest),
+		blobs: map[digest.Digest]int64{},
+		index: imgspecv1.Index{
+			Versioned: imgspec.Versioned{
+				SchemaVersion: 2,
+			},
+			MediaType:   imgspecv1.MediaTypeImageIndex,
+			Annotations: map[string]string{},
+		},
+	}
+}
+
+// NewReference returns an ImageReference that allows adding an image to Writer,
+// with an optional image name (as in the oci-archive:path:image syntax).
+// The returned reference does not refer to a file, so it can not be round-tripped through
+// StringWithinTransport() and ParseReference.
+func (w *Writer) NewReference(image string) (types.ImageReference, error) {
+	if err := internal.ValidateImageName(image); err != nil {
+		return nil, err
+	}
+	return ociArchiveReference{image: image, archiveWriter: w}, nil
+}
+
+// Close writes the index of all images added to the archive, and finishes writing data
+// to the underlying io.Writer.
+// No more images can be added after this is called.
+func (w *Writer) Close() error {
+	if err := w.lock(); err != nil {
+		return err
+	}
+	defer w.unlock()
+
+	layoutBytes, err := json.Marshal(imgspecv1.ImageLayout{
+		Version: imgspecv1.ImageLayoutVersion,
+	})
+	if err != nil {
+		return err
+	}
+	if err := w.sendBytesLocked(imgspecv1.ImageLayoutFile, layoutBytes); err != nil {
+		return err
+	}
+	indexBytes, err := json.Marshal(w.index)
+	if err != nil {
+		return err
+	}
+	if err := w.sendBytesLocked(imgspecv1.ImageIndexFile, indexBytes); err != nil {
+		return err
+	}
+
+	if err := w.tar.Close(); err != nil {
+		return err
+	}
+	w.tar = nil // Mark the Writer as closed.
+	return nil
+}
+
+// lock does some sanity checks and locks the Writer.
+// If this function succeeds, the caller must call w.unlock.
+// Do not use Writer.mutex directly.
+func (w *Writer) lock() error {
+	w.mutex.Lock()
+	if w.tar == nil {
+		w.mutex.Unlock()
+		return errors.New("Internal error: trying to use an already closed oci-archive Writer")
+	}
+	return nil
+}
+
+// unlock releases the lock obtained by Writer.lock
+// Do not use Writer.mutex directly.
+func (w *Writer) unlock() {
+	w.mutex.Unlock()
+}
+
+// blobSizeLocked returns the size of a blob with blobDigest, and true, if it has already been written to the archive.
+// The caller must have locked the Writer.
+func (w *Writer) blobSizeLocked(blobDigest digest.Digest) (int64, bool) {
+	size, ok := w.blobs[blobDigest]
+	return size, ok
+}
+
+// sendBlobLocked writes a blob with the specified digest and size, read from stream, to the archive.
+// The caller must have locked the Writer.
+// If reading stream fails, the archive is left incomplete and the Writer can not be successfully used any more.
+func (w *Writer) sendBlobLocked(blobDigest digest.Digest, size int64, stream io.Reader) error {
+	if err := blobDigest.Validate(); err != nil {
+		return fmt.Errorf("unexpected digest reference %s: %w", blobDigest, err)
+	}
+	if err := w.sendFileLocked(blobPathInArchive(blobDigest), size, stream); err != nil {
+		return err
+	}
+	w.blobs[blobDigest] = size
+	return nil
+}
+
+// addManifestLocked adds desc to the index of the archive.
+// The caller must have locked the Writer.
+func (w *Writer) addManifestLocked(desc imgspecv1.Descriptor) {
+	// This follows the same rules as the oci/layout transport, which is used by the other oci-archive destination.
+	// If the new entry has a name, remove the name from any older entries that have the same one.
+	if name := desc.Annotations[imgspecv1.AnnotationRefName]; name != "" {
+		for i, manifest := range w.index.Manifests {
+			if manifest.Annotations[imgspecv1.AnnotationRefName] == name {
+				delete(w.index.Manifests[i].Annotations, imgspecv1.AnnotationRefName)
+				break
+			}
+		}
+	}
+	for i, manifest := range w.index.Manifests {
+		if manifest.Digest == desc.Digest && manifest.Annotations[imgspecv1.AnnotationRefName] == "" {
+			w.index.Manifests[i] = desc
+			return
+		}
+	}
+	w.index.Manifests = append(slices.Clone(w.index.Manifests), desc)
+}
+
+// sendBytesLocked sends a path into the tar stream.
+// The caller must have locked the Writer.
+func (w *Writer) sendBytesLocked(path string, b []byte) error {
+	return w.sendFileLocked(path, int64(len(b)), bytes.NewReader(b))
+}
+
+// sendFileLocked sends a file into the tar stream.
+// The caller must have locked the Writer.
+func (w *Writer) sendFileLocked(path string, expectedSize int64, stream io.Reader) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path,
+		Size:     expectedSize,
+		Mode:     0644,
+		ModTime:  time.Unix(0, 0),
+		// Don’t include the data about the user account this code is running under.
+		Uid: 0,
+		Gid: 0,
+	}
+	logrus.Debugf("Sending as tar file %s", path)
+	if err := w.tar.WriteHeader(hdr); err != nil {
+		return err
+	}
+	// TODO: This can take quite some time, and should ideally be cancellable using a context.Context.
+	size, err := io.Copy(w.tar, stream)
+	if err != nil {
+		return err
+	}
+	if size != expectedSize {
+		return fmt.Errorf("Size mismatch when copying %s, expected %d, got %d", path, expectedSize, size)
+	}
+	return nil
+}
+
+// blobPathInArchive returns the path of a blob with blobDigest within an OCI archive.
+func blobPathInArchive(blobDigest digest.Digest) string {
+	return path.Join(imgspecv1.ImageBlobsDir, blobDigest.Algorithm().String(), blobDigest.Encoded())
+}
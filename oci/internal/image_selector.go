@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ErrMoreThanOneImage is returned when an image is not specified, and the index contains more than one image.
+var ErrMoreThanOneImage = errors.New("more than one image in oci, choose an image")
+
+// ErrImageNotFound is returned by ChooseManifestDescriptor if no image matches the selector.
+var ErrImageNotFound = errors.New("no matching image found")
+
+// ImageSelector identifies an image within an OCI layout or archive, as parsed from the image part of a reference:
+//   - "" selects the only image in the index;
+//   - "@os/architecture[/variant]" selects the image for a platform;
+//   - "key=value" selects the image with an annotation key set to value;
+//   - any other value is an image name, i.e. a value of the org.opencontainers.image.ref.name annotation.
+//     If no image has that name, and the value is a digest, it selects the image with that digest.
+type ImageSelector struct {
+	Name            string
+	Digest          digest.Digest       // Set along with Name if Name is a valid digest.
+	Platform        *imgspecv1.Platform // Variant may be "", in which case it is not compared.
+	AnnotationKey   string
+	AnnotationValue string
+}
+
+// ParseImageSelector parses the image part of an OCI reference.
+func ParseImageSelector(image string) (ImageSelector, error) {
+	switch {
+	case strings.HasPrefix(image, "@"):
+		parts := strings.Split(image[1:], "/")
+		if (len(parts) != 2 && len(parts) != 3) || parts[0] == "" || parts[1] == "" || (len(parts) == 3 && parts[2] == "") {
+			return ImageSelector{}, fmt.Errorf("Invalid platform %q, expected @os/architecture[/variant]", image)
+		}
+		platform := imgspecv1.Platform{OS: parts[0], Architecture: parts[1]}
+		if len(parts) == 3 {
+			platform.Variant = parts[2]
+		}
+		return ImageSelector{Platform: &platform}, nil
+	case strings.Contains(image, "="):
+		key, value, _ := strings.Cut(image, "=")
+		if key == "" {
+			return ImageSelector{}, fmt.Errorf("Invalid annotation selector %q, the annotation key is empty", image)
+		}
+		return ImageSelector{AnnotationKey: key, AnnotationValue: value}, nil
+	default:
+		if err := ValidateImageName(image); err != nil {
+			return ImageSelector{}, err
+		}
+		res := ImageSelector{Name: image}
+		if d, err := digest.Parse(image); err == nil {
+			res.Digest = d
+		}
+		return res, nil
+	}
+}
+
+// IsName returns true if s selects an image by name (or if it is empty), i.e. if s is usable for naming an image in a destination.
+func (s ImageSelector) IsName() bool {
+	return s.Platform == nil && s.AnnotationKey == ""
+}
+
+// ChooseManifestDescriptor returns the descriptor of the image selected by image from index, and its index in index.Manifests.
+// If the image is selected by platform or by digest, and no entry in index matches, images listed in image indexes referenced
+// from index are considered as well, using readIndex to read them; such images are returned with an index of -1.
+// Returns ErrImageNotFound if no image matches.
+func ChooseManifestDescriptor(index *imgspecv1.Index, image string, readIndex func(imgspecv1.Descriptor) (*imgspecv1.Index, error)) (imgspecv1.Descriptor, int, error) {
+	selector, err := ParseImageSelector(image)
+	if err != nil {
+		return imgspecv1.Descriptor{}, -1, err
+	}
+
+	switch {
+	case image == "":
+		// return manifest if only one image is in the oci directory
+		if len(index.Manifests) == 1 {
+			return index.Manifests[0], 0, nil
+		}
+		// Otherwise, ignore artifacts, e.g. signatures stored as referrers of the image.
+		resIndex := -1
+		for i, md := range index.Manifests {
+			if md.ArtifactType != "" {
+				continue
+			}
+			if resIndex != -1 {
+				// ask user to choose image when more than one image in the oci directory
+				return imgspecv1.Descriptor{}, -1, ErrMoreThanOneImage
+			}
+			resIndex = i
+		}
+		if resIndex == -1 {
+			return imgspecv1.Descriptor{}, -1, ErrMoreThanOneImage
+		}
+		return index.Manifests[resIndex], resIndex, nil
+
+	case selector.Name != "":
+		// look through all manifests for a name match
+		var unsupportedMIMETypes []string
+		for i, md := range index.Manifests {
+			if refName, ok := md.Annotations[imgspecv1.AnnotationRefName]; ok && refName == selector.Name {
+				if md.MediaType == imgspecv1.MediaTypeImageManifest || md.MediaType == imgspecv1.MediaTypeImageIndex {
+					return md, i, nil
+				}
+				unsupportedMIMETypes = append(unsupportedMIMETypes, md.MediaType)
+			}
+		}
+		if len(unsupportedMIMETypes) != 0 {
+			return imgspecv1.Descriptor{}, -1, fmt.Errorf("reference %q matches unsupported manifest MIME types %q", selector.Name, unsupportedMIMETypes)
+		}
+		if selector.Digest == "" {
+			return imgspecv1.Descriptor{}, -1, ErrImageNotFound
+		}
+		return chooseUnique(index, image, readIndex, func(md imgspecv1.Descriptor) bool {
+			return md.Digest == selector.Digest
+		})
+
+	case selector.Platform != nil:
+		return chooseUnique(index, image, readIndex, func(md imgspecv1.Descriptor) bool {
+			return md.Platform != nil && md.Platform.OS == selector.Platform.OS && md.Platform.Architecture == selector.Platform.Architecture &&
+				(selector.Platform.Variant == "" || md.Platform.Variant == selector.Platform.Variant)
+		})
+
+	default: // selector.AnnotationKey != ""
+		return chooseUnique(index, image, nil, func(md imgspecv1.Descriptor) bool {
+			value, ok := md.Annotations[selector.AnnotationKey]
+			return ok && value == selector.AnnotationValue
+		})
+	}
+}
+
+// chooseUnique returns the only image in index matching matches, along with its index in index.Manifests.
+// If none matches and readIndex is not nil, it looks for the only matching image within image indexes referenced by index.
+func chooseUnique(index *imgspecv1.Index, image string, readIndex func(imgspecv1.Descriptor) (*imgspecv1.Index, error),
+	matches func(md imgspecv1.Descriptor) bool) (imgspecv1.Descriptor, int, error) {
+	var res imgspecv1.Descriptor
+	resIndex := -1
+	found := false
+	for i, md := range index.Manifests {
+		if (md.MediaType == imgspecv1.MediaTypeImageManifest || md.MediaType == imgspecv1.MediaTypeImageIndex) && matches(md) {
+			if found && md.Digest != res.Digest {
+				return imgspecv1.Descriptor{}, -1, fmt.Errorf("reference %q matches more than one image", image)
+			}
+			if !found {
+				res, resIndex, found = md, i, true
+			}
+		}
+	}
+	if found {
+		return res, resIndex, nil
+	}
+	if readIndex == nil {
+		return imgspecv1.Descriptor{}, -1, ErrImageNotFound
+	}
+
+	for _, md := range index.Manifests {
+		if md.MediaType != imgspecv1.MediaTypeImageIndex {
+			continue
+		}
+		nested, err := readIndex(md)
+		if err != nil {
+			return imgspecv1.Descriptor{}, -1, err
+		}
+		for _, instance := range nested.Manifests {
+			if instance.MediaType == imgspecv1.MediaTypeImageManifest && matches(instance) {
+				if found && instance.Digest != res.Digest {
+					return imgspecv1.Descriptor{}, -1, fmt.Errorf("reference %q matches more than one image", image)
+				}
+				res, found = instance, true
+			}
+		}
+	}
+	if !found {
+		return imgspecv1.Descriptor{}, -1, ErrImageNotFound
+	}
+	return res, -1, nil
+}
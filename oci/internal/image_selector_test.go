@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImageSelector(t *testing.T) {
+	const digestValue = "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	for _, c := range []struct {
+		input    string
+		expected *ImageSelector // nil if a failure is expected
+	}{
+		{"", &ImageSelector{}},
+		{"busybox:latest", &ImageSelector{Name: "busybox:latest"}},
+		{digestValue, &ImageSelector{Name: digestValue, Digest: digestValue}},
+		{"@linux/arm64", &ImageSelector{Platform: &imgspecv1.Platform{OS: "linux", Architecture: "arm64"}}},
+		{"@linux/arm/v7", &ImageSelector{Platform: &imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}}},
+		{"@linux", nil},
+		{"@linux/", nil},
+		{"@/arm64", nil},
+		{"@linux/arm/", nil},
+		{"@linux/arm/v7/extra", nil},
+		{"org.example.key=value", &ImageSelector{AnnotationKey: "org.example.key", AnnotationValue: "value"}},
+		{"org.example.key=", &ImageSelector{AnnotationKey: "org.example.key"}},
+		{"=value", nil},
+		{"invalid'image!value@", nil},
+	} {
+		res, err := ParseImageSelector(c.input)
+		if c.expected == nil {
+			assert.Error(t, err, c.input)
+		} else {
+			require.NoError(t, err, c.input)
+			assert.Equal(t, *c.expected, res, c.input)
+		}
+	}
+}
+
+func TestChooseManifestDescriptor(t *testing.T) {
+	amd64 := imgspecv1.Descriptor{
+		MediaType:   imgspecv1.MediaTypeImageManifest,
+		Digest:      digest.FromString("amd64"),
+		Platform:    &imgspecv1.Platform{OS: "linux", Architecture: "amd64"},
+		Annotations: map[string]string{imgspecv1.AnnotationRefName: "amd64", "org.example.role": "base"},
+	}
+	armV7 := imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Digest:    digest.FromString("arm/v7"),
+		Platform:  &imgspecv1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+	}
+	arm64 := imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Digest:    digest.FromString("arm64"),
+		Platform:  &imgspecv1.Platform{OS: "linux", Architecture: "arm64"},
+	}
+	list := imgspecv1.Descriptor{
+		MediaType:   imgspecv1.MediaTypeImageIndex,
+		Digest:      digest.FromString("list"),
+		Annotations: map[string]string{imgspecv1.AnnotationRefName: "list", "org.example.role": "multi"},
+	}
+	index := &imgspecv1.Index{Manifests: []imgspecv1.Descriptor{amd64, armV7, list}}
+	nestedIndexes := map[digest.Digest]*imgspecv1.Index{
+		list.Digest: {Manifests: []imgspecv1.Descriptor{arm64, armV7}},
+	}
+	readIndex := func(desc imgspecv1.Descriptor) (*imgspecv1.Index, error) {
+		res, ok := nestedIndexes[desc.Digest]
+		if !ok {
+			return nil, errors.New("unexpected index")
+		}
+		return res, nil
+	}
+
+	for _, c := range []struct {
+		image         string
+		expected      *imgspecv1.Descriptor // nil if a failure is expected
+		expectedIndex int
+		errorIs       error
+	}{
+		{"", nil, -1, ErrMoreThanOneImage},
+		{"amd64", &amd64, 0, nil},
+		{"list", &list, 2, nil},
+		{"unknown", nil, -1, ErrImageNotFound},
+		{armV7.Digest.String(), &armV7, 1, nil},
+		{arm64.Digest.String(), &arm64, -1, nil}, // Found in the nested index
+		{digest.FromString("unknown").String(), nil, -1, ErrImageNotFound},
+		{"@linux/amd64", &amd64, 0, nil},
+		{"@linux/arm/v7", &armV7, 1, nil}, // Matches both at the top level and in the nested index
+		{"@linux/arm", &armV7, 1, nil},    // Variant not specified
+		{"@linux/arm/v6", nil, -1, ErrImageNotFound},
+		{"@linux/arm64", &arm64, -1, nil}, // Found in the nested index
+		{"@windows/amd64", nil, -1, ErrImageNotFound},
+		{"org.example.role=base", &amd64, 0, nil},
+		{"org.example.role=multi", &list, 2, nil},
+		{"org.example.role=other", nil, -1, ErrImageNotFound},
+		{"org.example.missing=", nil, -1, ErrImageNotFound},
+		{"invalid'image!value@", nil, -1, nil},
+	} {
+		res, i, err := ChooseManifestDescriptor(index, c.image, readIndex)
+		if c.expected == nil {
+			require.Error(t, err, c.image)
+			if c.errorIs != nil {
+				assert.ErrorIs(t, err, c.errorIs, c.image)
+			}
+		} else {
+			require.NoError(t, err, c.image)
+			assert.Equal(t, *c.expected, res, c.image)
+			assert.Equal(t, c.expectedIndex, i, c.image)
+		}
+	}
+
+	// A selector matching more than one distinct image is rejected.
+	amd64Copy := amd64
+	amd64Copy.Digest = digest.FromString("another amd64")
+	amd64Copy.Annotations = nil
+	ambiguous := &imgspecv1.Index{Manifests: []imgspecv1.Descriptor{amd64, amd64Copy}}
+	_, _, err := ChooseManifestDescriptor(ambiguous, "@linux/amd64", readIndex)
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrImageNotFound)
+	// … but the same image listed twice is not ambiguous.
+	duplicate := &imgspecv1.Index{Manifests: []imgspecv1.Descriptor{amd64, amd64}}
+	res, i, err := ChooseManifestDescriptor(duplicate, "@linux/amd64", readIndex)
+	require.NoError(t, err)
+	assert.Equal(t, amd64, res)
+	assert.Equal(t, 0, i)
+
+	// Artifacts, e.g. referrers of the image, are ignored when choosing the only image…
+	referrer := imgspecv1.Descriptor{
+		MediaType:    imgspecv1.MediaTypeImageManifest,
+		ArtifactType: "application/vnd.example.signature",
+		Digest:       digest.FromString("referrer"),
+	}
+	withReferrer := &imgspecv1.Index{Manifests: []imgspecv1.Descriptor{referrer, amd64}}
+	res, i, err = ChooseManifestDescriptor(withReferrer, "", readIndex)
+	require.NoError(t, err)
+	assert.Equal(t, amd64, res)
+	assert.Equal(t, 1, i)
+	// … unless the artifact is the only entry.
+	res, i, err = ChooseManifestDescriptor(&imgspecv1.Index{Manifests: []imgspecv1.Descriptor{referrer}}, "", readIndex)
+	require.NoError(t, err)
+	assert.Equal(t, referrer, res)
+	assert.Equal(t, 0, i)
+	_, _, err = ChooseManifestDescriptor(&imgspecv1.Index{Manifests: []imgspecv1.Descriptor{referrer, referrer}}, "", readIndex)
+	assert.ErrorIs(t, err, ErrMoreThanOneImage)
+
+	// Annotation selectors don't look into nested indexes.
+	nestedIndexes[list.Digest] = &imgspecv1.Index{Manifests: []imgspecv1.Descriptor{{
+		MediaType:   imgspecv1.MediaTypeImageManifest,
+		Digest:      digest.FromString("nested"),
+		Annotations: map[string]string{"org.example.role": "nested"},
+	}}}
+	_, _, err = ChooseManifestDescriptor(index, "org.example.role=nested", readIndex)
+	assert.ErrorIs(t, err, ErrImageNotFound)
+}
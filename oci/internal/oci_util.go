@@ -7,6 +7,9 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/exp/slices"
 )
 
 // annotation spex from https://github.com/opencontainers/image-spec/blob/master/annotations.md#pre-defined-annotation-keys
@@ -16,6 +19,16 @@ const (
 	component = `(?:` + alphanum + `(?:` + separator + alphanum + `)*)`
 )
 
+// Lock files within an OCI layout directory, used to coordinate concurrent users of the layout.
+// They are not a part of the OCI image layout specification, and should not be copied when packaging a layout.
+const (
+	// BlobsLockFileName is locked shared by writers for as long as they might add blobs not yet referenced from the index,
+	// and exclusively by operations deleting unreferenced blobs.
+	BlobsLockFileName = ".blobs.lock"
+	// IndexLockFileName is locked exclusively while the index of the layout is being updated.
+	IndexLockFileName = ".index.lock"
+)
+
 var refRegexp = regexp.MustCompile(`^` + component + `(?:/` + component + `)*$`)
 var windowsRefRegexp = regexp.MustCompile(`^([a-zA-Z]:\\.+?):(.*)$`)
 
@@ -119,3 +132,32 @@ func validateScopeNonWindows(scope string) error {
 
 	return nil
 }
+
+// AddManifest adds desc to index.
+// If desc has a name, the name is removed from any other entry; if index already contains an unnamed entry with the same digest,
+// that entry is replaced.
+func AddManifest(index *imgspecv1.Index, desc *imgspecv1.Descriptor) {
+	// If the new entry has a name, remove any conflicting names which we already have.
+	if desc.Annotations != nil && desc.Annotations[imgspecv1.AnnotationRefName] != "" {
+		// The name is being set on a new entry, so remove any older ones that had the same name.
+		// We might be storing an index and all of its component images, and we'll want to attach
+		// the name to the last one, which is the index.
+		for i, manifest := range index.Manifests {
+			if manifest.Annotations[imgspecv1.AnnotationRefName] == desc.Annotations[imgspecv1.AnnotationRefName] {
+				delete(index.Manifests[i].Annotations, imgspecv1.AnnotationRefName)
+				break
+			}
+		}
+	}
+	// If it has the same digest as another entry in the index, we already overwrote the file,
+	// so just pick up the other information.
+	for i, manifest := range index.Manifests {
+		if manifest.Digest == desc.Digest && manifest.Annotations[imgspecv1.AnnotationRefName] == "" {
+			// Replace it completely.
+			index.Manifests[i] = *desc
+			return
+		}
+	}
+	// It's a new entry to be added to the index. Use slices.Clone() to avoid a remote dependency on how index was created.
+	index.Manifests = append(slices.Clone(index.Manifests), *desc)
+}
@@ -0,0 +1,73 @@
+package layout
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+
+	"github.com/containers/image/v5/internal/blobtransfer"
+	"github.com/containers/image/v5/internal/digests"
+	"github.com/containers/image/v5/internal/errclass"
+	"github.com/containers/image/v5/types"
+)
+
+// PullBlob returns a stream for the blob with info.Digest in the OCI layout of ref, and its size.
+// Only the directory of ref is used; the image name in ref, if any, is ignored.
+// The contents of the stream are verified against info.Digest; the stream returns an error instead of io.EOF if they don't match.
+// The caller must call .Close() on the returned stream.
+func PullBlob(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, info types.BlobInfo) (io.ReadCloser, int64, error) {
+	ociRef, ok := ref.(ociReference)
+	if !ok {
+		return nil, 0, errors.New("error typecasting, need type ociRef")
+	}
+	if err := digests.ValidateAlgorithm(sys, info.Digest.Algorithm()); err != nil {
+		return nil, 0, err
+	}
+	sharedBlobDir := ""
+	if sys != nil {
+		sharedBlobDir = sys.OCISharedBlobDirPath
+	}
+	path, err := ociRef.blobPath(info.Digest, sharedBlobDir)
+	if err != nil {
+		return nil, 0, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = errclass.Wrap(err, types.ErrBlobUnknown)
+		}
+		return nil, 0, err
+	}
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	verifier, err := blobtransfer.NewVerifyingReader(file, info.Digest)
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return verifier, fi.Size(), nil
+}
+
+// PushBlob writes stream, which must match info.Digest, to the OCI layout of ref, creating its directory if necessary,
+// unless the layout already contains that blob.
+// Only the directory of ref is used; the image name in ref, if any, is ignored, and the index of the layout is not modified.
+// If cache is nil, the default cache for sys is used.
+// It returns the digest and size of the blob in the layout.
+func PushBlob(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, stream io.Reader, info types.BlobInfo, cache types.BlobInfoCache) (types.BlobInfo, error) {
+	ociRef, ok := ref.(ociReference)
+	if !ok {
+		return types.BlobInfo{}, errors.New("error typecasting, need type ociRef")
+	}
+	ociRef.image = ""
+	dest, err := newImageDestination(ctx, sys, ociRef)
+	if err != nil {
+		return types.BlobInfo{}, err
+	}
+	defer dest.Close()
+	return blobtransfer.PutBlob(ctx, sys, dest, stream, info, cache)
+}
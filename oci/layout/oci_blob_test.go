@@ -0,0 +1,61 @@
+package layout
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPushPullBlob(t *testing.T) {
+	blob := []byte("artifact contents")
+	info := types.BlobInfo{Digest: digest.FromBytes(blob), Size: int64(len(blob))}
+	cache := memory.New()
+
+	dir := filepath.Join(t.TempDir(), "layout")
+	ref, err := NewReference(dir, "")
+	require.NoError(t, err)
+
+	res, err := PushBlob(context.Background(), nil, ref, bytes.NewReader(blob), info, cache)
+	require.NoError(t, err)
+	assert.Equal(t, info, res)
+	stored, err := os.ReadFile(filepath.Join(dir, "blobs", "sha256", info.Digest.Encoded()))
+	require.NoError(t, err)
+	assert.Equal(t, blob, stored)
+
+	// The blob already exists; the stream is not read.
+	res, err = PushBlob(context.Background(), nil, ref, bytes.NewReader(nil), info, cache)
+	require.NoError(t, err)
+	assert.Equal(t, info, res)
+
+	stream, size, err := PullBlob(context.Background(), nil, ref, info)
+	require.NoError(t, err)
+	contents, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	assert.NoError(t, stream.Close())
+	assert.Equal(t, blob, contents)
+	assert.Equal(t, int64(len(blob)), size)
+
+	// Contents not matching the digest
+	other := []byte("other contents")
+	otherInfo := types.BlobInfo{Digest: digest.FromBytes(other), Size: int64(len(other))}
+	_, err = PushBlob(context.Background(), nil, ref, bytes.NewReader(blob), otherInfo, cache)
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(dir, "blobs", "sha256", otherInfo.Digest.Encoded()))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	// Missing blobs
+	_, _, err = PullBlob(context.Background(), nil, ref, otherInfo)
+	assert.ErrorIs(t, err, types.ErrBlobUnknown)
+	// Unknown digest
+	_, err = PushBlob(context.Background(), nil, ref, bytes.NewReader(blob), types.BlobInfo{Size: -1}, cache)
+	assert.Error(t, err)
+}
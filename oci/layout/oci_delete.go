@@ -8,10 +8,10 @@ import (
 	"os"
 
 	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/image/v5/pkg/logging"
 	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
-	"github.com/sirupsen/logrus"
 	"golang.org/x/exp/slices"
 )
 
@@ -22,10 +22,25 @@ func (ref ociReference) DeleteImage(ctx context.Context, sys *types.SystemContex
 		sharedBlobsDir = sys.OCISharedBlobDirPath
 	}
 
-	descriptor, descriptorIndex, err := ref.getManifestDescriptor()
+	// Other writers might be using the blobs of this image, and not referring to them from the index yet.
+	blobsLock, err := ref.lockBlobs(ctx, true, lockTimeout(sys))
 	if err != nil {
 		return err
 	}
+	defer blobsLock.unlock()
+	indexLock, err := ref.lockIndex(ctx, lockTimeout(sys))
+	if err != nil {
+		return err
+	}
+	defer indexLock.unlock()
+
+	descriptor, descriptorIndex, err := ref.getManifestDescriptor(sharedBlobsDir)
+	if err != nil {
+		return err
+	}
+	if descriptorIndex == -1 {
+		return fmt.Errorf("image %q is a part of a multi-platform image, and can not be deleted separately", ref.image)
+	}
 
 	var blobsUsedByImage map[digest.Digest]int
 
@@ -46,7 +61,7 @@ func (ref ociReference) DeleteImage(ctx context.Context, sys *types.SystemContex
 		return err
 	}
 
-	err = ref.deleteBlobs(blobsToDelete)
+	err = ref.deleteBlobs(logging.For(sys), blobsToDelete)
 	if err != nil {
 		return err
 	}
@@ -54,6 +69,12 @@ func (ref ociReference) DeleteImage(ctx context.Context, sys *types.SystemContex
 	return ref.deleteReferenceFromIndex(descriptorIndex)
 }
 
+// SupportsDeleteImage returns true, DeleteImage is implemented.
+// This implements transports.DeletionSupportReporter.
+func (ref ociReference) SupportsDeleteImage() bool {
+	return true
+}
+
 func (ref ociReference) getBlobsUsedInSingleImage(descriptor *imgspecv1.Descriptor, sharedBlobsDir string) (map[digest.Digest]int, error) {
 	manifest, err := ref.getManifest(descriptor, sharedBlobsDir)
 	if err != nil {
@@ -165,13 +186,13 @@ func (ref ociReference) getBlobsToDelete(blobsUsedByDescriptorToDelete map[diges
 // check for local blobs (but we should make no noise if the blobs are actually in the shared directory).
 //
 // So, NOTE: the blobPath() call below hard-codes "" even in calls where OCISharedBlobDirPath is set
-func (ref ociReference) deleteBlobs(blobsToDelete *set.Set[digest.Digest]) error {
+func (ref ociReference) deleteBlobs(logger types.Logger, blobsToDelete *set.Set[digest.Digest]) error {
 	for _, digest := range blobsToDelete.Values() {
 		blobPath, err := ref.blobPath(digest, "") //Only delete in the local directory, see comment above
 		if err != nil {
 			return err
 		}
-		err = deleteBlob(blobPath)
+		err = deleteBlob(logger, blobPath)
 		if err != nil {
 			return err
 		}
@@ -180,8 +201,8 @@ func (ref ociReference) deleteBlobs(blobsToDelete *set.Set[digest.Digest]) error
 	return nil
 }
 
-func deleteBlob(blobPath string) error {
-	logrus.Debug(fmt.Sprintf("Deleting blob at %q", blobPath))
+func deleteBlob(logger types.Logger, blobPath string) error {
+	logger.Debugf("Deleting blob at %q", blobPath)
 
 	err := os.Remove(blobPath)
 	if err != nil && !os.IsNotExist(err) {
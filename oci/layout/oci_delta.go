@@ -0,0 +1,291 @@
+package layout
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// A delta is a tar archive which updates a base layout to contain the images of a newer layout.
+// It contains deltaManifestFileName, describing the delta, as the first entry, followed by all blobs
+// of the newer layout which are missing from the base layout, stored in the same paths as in a layout.
+
+// deltaManifestFileName is the name of the file describing a delta.
+const deltaManifestFileName = "delta.json"
+
+// deltaManifest describes a delta, stored as JSON.
+type deltaManifest struct {
+	Manifests []imgspecv1.Descriptor `json:"manifests"` // Entries to add to the index of the layout the delta is applied to.
+	Blobs     []digest.Digest        `json:"blobs"`     // Blobs included in the delta.
+	BaseBlobs []digest.Digest        `json:"baseBlobs"` // Blobs not included in the delta, which must exist in the layout the delta is applied to.
+}
+
+// ExportDelta writes to dest a delta which updates the OCI layout in baseDir to contain all images of the OCI layout in dir:
+// the delta contains all blobs referenced, directly or indirectly, from the index of the layout in dir which do not exist in baseDir,
+// and the entries of that index. The delta can be applied, using ApplyDelta, to a copy of the layout in baseDir,
+// e.g. on the other side of an air gap.
+// sys.OCISharedBlobDirPath, if set, applies to the layout in dir.
+func ExportDelta(ctx context.Context, sys *types.SystemContext, baseDir, dir string, dest io.Writer) error {
+	baseRef, err := layoutReference(baseDir)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(baseRef.indexPath()); err != nil {
+		return fmt.Errorf("reading the base layout: %w", err)
+	}
+	ref, err := layoutReference(dir)
+	if err != nil {
+		return err
+	}
+	sharedBlobDir := ""
+	if sys != nil {
+		sharedBlobDir = sys.OCISharedBlobDirPath
+	}
+	// Prevent blobs which stop being referenced from being deleted while we read them.
+	blobsLock, err := ref.lockBlobs(ctx, false, lockTimeout(sys))
+	if err != nil {
+		return err
+	}
+	defer blobsLock.unlock()
+
+	index, err := ref.getIndex()
+	if err != nil {
+		return err
+	}
+	delta := deltaManifest{
+		Manifests: index.Manifests,
+		Blobs:     []digest.Digest{},
+		BaseBlobs: []digest.Digest{},
+	}
+	blobs, err := referencedBlobs(ref, sharedBlobDir, index.Manifests)
+	if err != nil {
+		return err
+	}
+	for _, d := range blobs {
+		basePath, err := baseRef.blobPath(d, "")
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(basePath); err == nil {
+			delta.BaseBlobs = append(delta.BaseBlobs, d)
+			continue
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+		if d.Algorithm() != digest.Canonical {
+			return fmt.Errorf("blob %s uses an unsupported digest algorithm, only %s is supported", d.String(), digest.Canonical.String())
+		}
+		delta.Blobs = append(delta.Blobs, d)
+	}
+
+	deltaBytes, err := json.Marshal(delta)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(dest)
+	if err := writeDeltaEntry(tw, deltaManifestFileName, int64(len(deltaBytes))); err != nil {
+		return err
+	}
+	if _, err := tw.Write(deltaBytes); err != nil {
+		return err
+	}
+	for _, d := range delta.Blobs {
+		if err := copyBlobToDelta(tw, ref, sharedBlobDir, d); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// referencedBlobs returns the digests of all blobs referenced from descriptors, directly or indirectly, in the order they are found.
+// Layers with URLs (“foreign layers”) which do not exist in the layout are not included.
+func referencedBlobs(ref ociReference, sharedBlobDir string, descriptors []imgspecv1.Descriptor) ([]digest.Digest, error) {
+	res := []digest.Digest{}
+	seen := set.New[digest.Digest]()
+	var add func(descriptors []imgspecv1.Descriptor) error
+	add = func(descriptors []imgspecv1.Descriptor) error {
+		for _, desc := range descriptors {
+			if seen.Contains(desc.Digest) {
+				continue
+			}
+			seen.Add(desc.Digest)
+			blobPath, err := ref.blobPath(desc.Digest, sharedBlobDir)
+			if err != nil {
+				return err
+			}
+			if _, err := os.Stat(blobPath); err != nil {
+				if os.IsNotExist(err) && len(desc.URLs) != 0 {
+					continue
+				}
+				return err
+			}
+			res = append(res, desc.Digest)
+
+			switch desc.MediaType {
+			case imgspecv1.MediaTypeImageIndex:
+				blob, err := readBlob(ref, sharedBlobDir, desc.Digest, iolimits.MaxManifestBodySize)
+				if err != nil {
+					return err
+				}
+				var index imgspecv1.Index
+				if err := json.Unmarshal(blob, &index); err != nil {
+					return fmt.Errorf("parsing image index %s: %w", desc.Digest.String(), err)
+				}
+				if err := add(index.Manifests); err != nil {
+					return err
+				}
+			case imgspecv1.MediaTypeImageManifest:
+				blob, err := readBlob(ref, sharedBlobDir, desc.Digest, iolimits.MaxManifestBodySize)
+				if err != nil {
+					return err
+				}
+				var m imgspecv1.Manifest
+				if err := json.Unmarshal(blob, &m); err != nil {
+					return fmt.Errorf("parsing manifest %s: %w", desc.Digest.String(), err)
+				}
+				if err := add(append([]imgspecv1.Descriptor{m.Config}, m.Layers...)); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := add(descriptors); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// writeDeltaEntry writes a tar header for a file at path, of size bytes.
+func writeDeltaEntry(tw *tar.Writer, path string, size int64) error {
+	return tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     path,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  time.Unix(0, 0),
+		Format:   tar.FormatPAX,
+	})
+}
+
+// copyBlobToDelta writes the blob with d in the layout at ref to tw.
+func copyBlobToDelta(tw *tar.Writer, ref ociReference, sharedBlobDir string, d digest.Digest) error {
+	blobPath, err := ref.blobPath(d, sharedBlobDir)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(blobPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := writeDeltaEntry(tw, relativeBlobPath(d), fi.Size()); err != nil {
+		return err
+	}
+	n, err := io.Copy(tw, f)
+	if err != nil {
+		return fmt.Errorf("copying blob %s: %w", d.String(), err)
+	}
+	if n != fi.Size() {
+		return fmt.Errorf("blob %s changed while it was being copied", d.String())
+	}
+	return nil
+}
+
+// ApplyDelta applies a delta, written by ExportDelta, to the OCI layout in dir, which must contain all blobs of the base layout
+// the delta was created from that are still referenced from the newer layout.
+// The contents of every blob in the delta are verified; the entries of the index of the newer layout are added to the index
+// only after all blobs were stored, replacing existing entries with the same names.
+func ApplyDelta(ctx context.Context, sys *types.SystemContext, dir string, delta io.Reader) (retErr error) {
+	ref, err := layoutReference(dir)
+	if err != nil {
+		return err
+	}
+	dest, err := newImageDestination(ctx, sys, ref)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := dest.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+	d, ok := dest.(*ociImageDestination)
+	if !ok {
+		return errors.New("internal error: unexpected destination type")
+	}
+
+	tr := tar.NewReader(delta)
+	hdr, err := tr.Next()
+	if err != nil {
+		return fmt.Errorf("reading the delta: %w", err)
+	}
+	if hdr.Name != deltaManifestFileName {
+		return fmt.Errorf("invalid delta: the first entry is %q, expected %q", hdr.Name, deltaManifestFileName)
+	}
+	deltaBytes, err := iolimits.ReadAtMost(tr, iolimits.MaxTarFileManifestSize)
+	if err != nil {
+		return err
+	}
+	var manifest deltaManifest
+	if err := json.Unmarshal(deltaBytes, &manifest); err != nil {
+		return fmt.Errorf("parsing %s: %w", deltaManifestFileName, err)
+	}
+	for _, blobDigest := range manifest.BaseBlobs {
+		blobPath, err := ref.blobPath(blobDigest, d.sharedBlobDir)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(blobPath); err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("blob %s, expected to exist in %q, is missing; the delta was created from a different base layout", blobDigest.String(), dir)
+			}
+			return err
+		}
+	}
+
+	missing := set.NewWithValues(manifest.Blobs...)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("reading the delta: %w", err)
+		}
+		blobDigest, ok := digestFromRelativeBlobPath(hdr.Name)
+		if !ok || !missing.Contains(blobDigest) {
+			return fmt.Errorf("invalid delta: unexpected entry %q", hdr.Name)
+		}
+		uploaded, err := d.PutBlobWithOptions(ctx, tr, types.BlobInfo{Size: hdr.Size}, private.PutBlobOptions{})
+		if err != nil {
+			return err
+		}
+		if uploaded.Digest != blobDigest {
+			return fmt.Errorf("invalid delta: the contents of %q do not match its digest, actual digest %s", hdr.Name, uploaded.Digest.String())
+		}
+		missing.Delete(blobDigest)
+	}
+	if !missing.Empty() {
+		return fmt.Errorf("invalid delta: blobs %v are missing", missing.Values())
+	}
+
+	d.manifests = manifest.Manifests
+	return d.Commit(ctx, nil)
+}
@@ -0,0 +1,129 @@
+package layout
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// putDeltaTestImage writes an image with a single layer, and a config shared by all such images, to an image in dir,
+// and returns the digest of the layer.
+func putDeltaTestImage(t *testing.T, dir, image string, layer []byte) digest.Digest {
+	ctx := context.Background()
+	ref, err := NewReference(dir, image)
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	cache := memory.New()
+	configInfo, err := dest.PutBlob(ctx, bytes.NewReader([]byte("{}")), types.BlobInfo{Size: -1}, cache, true)
+	require.NoError(t, err)
+	layerInfo, err := dest.PutBlob(ctx, bytes.NewReader(layer), types.BlobInfo{Size: -1}, cache, false)
+	require.NoError(t, err)
+	m := fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"%s","size":%d},`+
+		`"layers":[{"mediaType":"application/vnd.oci.image.layer.v1.tar","digest":"%s","size":%d}]}`,
+		configInfo.Digest, configInfo.Size, layerInfo.Digest, layerInfo.Size)
+	err = dest.PutManifest(ctx, []byte(m), nil)
+	require.NoError(t, err)
+	err = dest.Commit(ctx, nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	require.NoError(t, err)
+	return layerInfo.Digest
+}
+
+// deltaEntries returns the names of all entries of delta, and the parsed delta manifest.
+func deltaEntries(t *testing.T, delta []byte) ([]string, deltaManifest) {
+	names := []string{}
+	var manifest deltaManifest
+	tr := tar.NewReader(bytes.NewReader(delta))
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+		if hdr.Name == deltaManifestFileName {
+			err = json.NewDecoder(tr).Decode(&manifest)
+			require.NoError(t, err)
+		}
+	}
+	return names, manifest
+}
+
+func TestDelta(t *testing.T) {
+	ctx := context.Background()
+	newBase := func() string {
+		dir := t.TempDir()
+		putDeltaTestImage(t, dir, "1.0.0", []byte("base layer"))
+		return dir
+	}
+	baseDir := newBase()
+	newerDir := newBase()
+	layerDigest := putDeltaTestImage(t, newerDir, "2.0.0", []byte("new layer"))
+	newerEntries, err := ListEntries(newerDir)
+	require.NoError(t, err)
+	require.Len(t, newerEntries, 2)
+
+	var delta bytes.Buffer
+	err = ExportDelta(context.Background(), nil, baseDir, newerDir, &delta)
+	require.NoError(t, err)
+	names, manifest := deltaEntries(t, delta.Bytes())
+	// Only the new manifest and layer are included; the config already exists in the base layout.
+	assert.Equal(t, []string{deltaManifestFileName, relativeBlobPath(newerEntries[1].Digest), relativeBlobPath(layerDigest)}, names)
+	assert.Equal(t, newerEntries, manifest.Manifests)
+	assert.Equal(t, []digest.Digest{newerEntries[1].Digest, layerDigest}, manifest.Blobs)
+	assert.Len(t, manifest.BaseBlobs, 3)
+
+	// Applying the delta to a copy of the base layout results in the same images as in the newer layout.
+	err = ApplyDelta(ctx, nil, baseDir, bytes.NewReader(delta.Bytes()))
+	require.NoError(t, err)
+	entries, err := ListEntries(baseDir)
+	require.NoError(t, err)
+	assert.Equal(t, newerEntries, entries)
+	report, err := Verify(baseDir)
+	require.NoError(t, err)
+	assert.Empty(t, report.Problems)
+	// Applying it again does not change anything.
+	err = ApplyDelta(ctx, nil, baseDir, bytes.NewReader(delta.Bytes()))
+	require.NoError(t, err)
+	entries, err = ListEntries(baseDir)
+	require.NoError(t, err)
+	assert.Equal(t, newerEntries, entries)
+
+	// A delta can't be applied to a layout without the base blobs.
+	err = ApplyDelta(ctx, nil, filepath.Join(t.TempDir(), "empty"), bytes.NewReader(delta.Bytes()))
+	assert.Error(t, err)
+
+	// Modified blobs are rejected, and the index is not modified.
+	modified := bytes.Replace(delta.Bytes(), []byte("new layer"), []byte("bad layer"), 1)
+	require.NotEqual(t, delta.Bytes(), modified)
+	targetDir := newBase()
+	err = ApplyDelta(ctx, nil, targetDir, bytes.NewReader(modified))
+	assert.Error(t, err)
+	entries, err = ListEntries(targetDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// The base layout must exist.
+	err = ExportDelta(context.Background(), nil, filepath.Join(t.TempDir(), "this-does-not-exist"), newerDir, &delta)
+	assert.Error(t, err)
+	// A delta of a layout against itself contains no blobs.
+	delta.Reset()
+	err = ExportDelta(context.Background(), nil, newerDir, newerDir, &delta)
+	require.NoError(t, err)
+	names, manifest = deltaEntries(t, delta.Bytes())
+	assert.Equal(t, []string{deltaManifestFileName}, names)
+	assert.Empty(t, manifest.Blobs)
+	assert.Equal(t, newerEntries, manifest.Manifests)
+}
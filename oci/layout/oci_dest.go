@@ -9,48 +9,47 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"time"
 
+	"github.com/containers/image/v5/internal/digests"
 	"github.com/containers/image/v5/internal/imagedestination/impl"
 	"github.com/containers/image/v5/internal/imagedestination/stubs"
 	"github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/putblobdigest"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/oci/internal"
 	"github.com/containers/image/v5/types"
 	digest "github.com/opencontainers/go-digest"
 	imgspec "github.com/opencontainers/image-spec/specs-go"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
-	"golang.org/x/exp/slices"
 )
 
 type ociImageDestination struct {
 	impl.Compat
 	impl.PropertyMethodsInitialize
 	stubs.NoPutBlobPartialInitialize
-	stubs.NoSignaturesInitialize
+	stubs.AlwaysSupportsSignatures
 
-	ref           ociReference
-	index         imgspecv1.Index
-	sharedBlobDir string
+	ref             ociReference
+	manifests       []imgspecv1.Descriptor // Entries to add to the index on Commit, in order.
+	manifestDigest  digest.Digest          // Digest of the top-level manifest, set by PutManifest.
+	sharedBlobDir   string
+	lockTimeout     time.Duration
+	blobsLock       *layoutLock                 // Held shared until Close, so that our blobs are not garbage-collected before Commit.
+	linkMode        types.OCISharedBlobLinkMode // How blobs in sharedBlobDir are linked into the layout; only relevant if sharedBlobDir != "".
+	digestAlgorithm digest.Algorithm            // Used for blob digests we compute.
 }
 
 // newImageDestination returns an ImageDestination for writing to an existing directory.
-func newImageDestination(sys *types.SystemContext, ref ociReference) (private.ImageDestination, error) {
-	var index *imgspecv1.Index
-	if indexExists(ref) {
-		var err error
-		index, err = ref.getIndex()
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		index = &imgspecv1.Index{
-			Versioned: imgspec.Versioned{
-				SchemaVersion: 2,
-			},
-			Annotations: make(map[string]string),
-		}
+func newImageDestination(ctx context.Context, sys *types.SystemContext, ref ociReference) (private.ImageDestination, error) {
+	selector, err := internal.ParseImageSelector(ref.image)
+	if err != nil {
+		return nil, err
+	}
+	if !selector.IsName() {
+		return nil, fmt.Errorf("can not write to an image selected by platform or annotation, %q; use an image name instead", ref.image)
 	}
-
 	desiredLayerCompression := types.Compress
 	if sys != nil && sys.OCIAcceptUncompressedLayers {
 		desiredLayerCompression = types.PreserveOriginal
@@ -69,14 +68,15 @@ func newImageDestination(sys *types.SystemContext, ref ociReference) (private.Im
 			HasThreadSafePutBlob:           true,
 		}),
 		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
-		NoSignaturesInitialize:     stubs.NoSignatures("Pushing signatures for OCI images is not supported"),
 
-		ref:   ref,
-		index: *index,
+		ref:             ref,
+		lockTimeout:     lockTimeout(sys),
+		digestAlgorithm: digests.Algorithm(sys),
 	}
 	d.Compat = impl.AddCompat(d)
 	if sys != nil {
 		d.sharedBlobDir = sys.OCISharedBlobDirPath
+		d.linkMode = sys.OCISharedBlobDirLinkMode
 	}
 
 	if err := ensureDirectoryExists(d.ref.dir); err != nil {
@@ -88,6 +88,11 @@ func newImageDestination(sys *types.SystemContext, ref ociReference) (private.Im
 	if err := ensureDirectoryExists(filepath.Join(d.ref.dir, imgspecv1.ImageBlobsDir)); err != nil {
 		return nil, err
 	}
+	blobsLock, err := d.ref.lockBlobs(ctx, false, d.lockTimeout)
+	if err != nil {
+		return nil, err
+	}
+	d.blobsLock = blobsLock
 	return d, nil
 }
 
@@ -99,7 +104,12 @@ func (d *ociImageDestination) Reference() types.ImageReference {
 
 // Close removes resources associated with an initialized ImageDestination, if any.
 func (d *ociImageDestination) Close() error {
-	return nil
+	if d.blobsLock == nil {
+		return nil
+	}
+	err := d.blobsLock.unlock()
+	d.blobsLock = nil
+	return err
 }
 
 // PutBlobWithOptions writes contents of stream and returns data representing the result.
@@ -125,7 +135,7 @@ func (d *ociImageDestination) PutBlobWithOptions(ctx context.Context, stream io.
 		}
 	}()
 
-	digester, stream := putblobdigest.DigestIfCanonicalUnknown(stream, inputInfo)
+	digester, stream := putblobdigest.DigestIfAlgorithmUnknown(stream, inputInfo, d.digestAlgorithm)
 	// TODO: This can take quite some time, and should ideally be cancellable using ctx.Done().
 	size, err := io.Copy(blobFile, stream)
 	if err != nil {
@@ -164,6 +174,9 @@ func (d *ociImageDestination) PutBlobWithOptions(ctx context.Context, stream io.
 		return private.UploadedBlob{}, err
 	}
 	succeeded = true
+	if err := d.linkSharedBlob(blobDigest); err != nil {
+		return private.UploadedBlob{}, err
+	}
 	return private.UploadedBlob{Digest: blobDigest, Size: size}, nil
 }
 
@@ -190,6 +203,9 @@ func (d *ociImageDestination) TryReusingBlobWithOptions(ctx context.Context, inf
 	if err != nil {
 		return false, private.ReusedBlob{}, err
 	}
+	if err := d.linkSharedBlob(info.Digest); err != nil {
+		return false, private.ReusedBlob{}, err
+	}
 
 	return true, private.ReusedBlob{Digest: info.Digest, Size: finfo.Size()}, nil
 }
@@ -226,6 +242,9 @@ func (d *ociImageDestination) PutManifest(ctx context.Context, m []byte, instanc
 	if err := os.WriteFile(blobPath, m, 0644); err != nil {
 		return err
 	}
+	if err := d.linkSharedBlob(digest); err != nil {
+		return err
+	}
 
 	if instanceDigest != nil {
 		return nil
@@ -237,43 +256,56 @@ func (d *ociImageDestination) PutManifest(ctx context.Context, m []byte, instanc
 	desc := imgspecv1.Descriptor{}
 	desc.Digest = digest
 	desc.Size = int64(len(m))
+	// If we knew the MIME type, we wouldn't have to guess here.
+	desc.MediaType = manifest.GuessMIMEType(m)
+	if err := setReferrerFields(&desc, m); err != nil {
+		return err
+	}
 	if d.ref.image != "" {
-		desc.Annotations = make(map[string]string)
+		if desc.Annotations == nil {
+			desc.Annotations = make(map[string]string)
+		}
 		desc.Annotations[imgspecv1.AnnotationRefName] = d.ref.image
 	}
 
-	// If we knew the MIME type, we wouldn't have to guess here.
-	desc.MediaType = manifest.GuessMIMEType(m)
-
-	d.addManifest(&desc)
+	d.manifests = append(d.manifests, desc)
+	d.manifestDigest = digest
 
 	return nil
 }
 
-func (d *ociImageDestination) addManifest(desc *imgspecv1.Descriptor) {
-	// If the new entry has a name, remove any conflicting names which we already have.
-	if desc.Annotations != nil && desc.Annotations[imgspecv1.AnnotationRefName] != "" {
-		// The name is being set on a new entry, so remove any older ones that had the same name.
-		// We might be storing an index and all of its component images, and we'll want to attach
-		// the name to the last one, which is the index.
-		for i, manifest := range d.index.Manifests {
-			if manifest.Annotations[imgspecv1.AnnotationRefName] == desc.Annotations[imgspecv1.AnnotationRefName] {
-				delete(d.index.Manifests[i].Annotations, imgspecv1.AnnotationRefName)
-				break
-			}
+// PutSignaturesWithFormat writes a set of signatures to the destination.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to write or overwrite the signatures for
+// (when the primary manifest is a manifest list); this should always be nil if the primary manifest is not a manifest list.
+// MUST be called after PutManifest (signatures may reference manifest contents).
+// Only sigstore signatures are supported; they are stored as referrers of the manifest, the way cosign stores them in registries.
+func (d *ociImageDestination) PutSignaturesWithFormat(ctx context.Context, signatures []signature.Signature, instanceDigest *digest.Digest) error {
+	if len(signatures) == 0 {
+		return nil
+	}
+	if instanceDigest == nil {
+		if d.manifestDigest == "" {
+			// This shouldn’t happen, ImageDestination users are required to call PutManifest before PutSignatures
+			return errors.New("Unknown manifest digest, can't add signatures")
 		}
+		instanceDigest = &d.manifestDigest
+	}
+	subject, err := subjectDescriptor(d.ref, d.sharedBlobDir, *instanceDigest)
+	if err != nil {
+		return err
 	}
-	// If it has the same digest as another entry in the index, we already overwrote the file,
-	// so just pick up the other information.
-	for i, manifest := range d.index.Manifests {
-		if manifest.Digest == desc.Digest && manifest.Annotations[imgspecv1.AnnotationRefName] == "" {
-			// Replace it completely.
-			d.index.Manifests[i] = *desc
-			return
+	for _, sig := range signatures {
+		sigstoreSig, ok := sig.(signature.Sigstore)
+		if !ok {
+			return fmt.Errorf("Storing %s signatures in OCI layouts is not supported, only sigstore signatures can be stored", sig.FormatID())
 		}
+		desc, err := d.putSigstoreReferrer(ctx, sigstoreSig, subject)
+		if err != nil {
+			return err
+		}
+		d.manifests = append(d.manifests, desc)
 	}
-	// It's a new entry to be added to the index. Use slices.Clone() to avoid a remote dependency on how d.index was created.
-	d.index.Manifests = append(slices.Clone(d.index.Manifests), *desc)
+	return nil
 }
 
 // Commit marks the process of storing the image as successful and asks for the image to be persisted.
@@ -283,7 +315,32 @@ func (d *ociImageDestination) addManifest(desc *imgspecv1.Descriptor) {
 // WARNING: This does not have any transactional semantics:
 // - Uploaded data MAY be visible to others before Commit() is called
 // - Uploaded data MAY be removed or MAY remain around if Close() is called without Commit() (i.e. rollback is allowed but not guaranteed)
-func (d *ociImageDestination) Commit(context.Context, types.UnparsedImage) error {
+func (d *ociImageDestination) Commit(ctx context.Context, _ types.UnparsedImage) error {
+	indexLock, err := d.ref.lockIndex(ctx, d.lockTimeout)
+	if err != nil {
+		return err
+	}
+	defer indexLock.unlock()
+
+	// Other processes might have modified the index since we were created, so only read it now, while holding the lock.
+	var index *imgspecv1.Index
+	if indexExists(d.ref) {
+		index, err = d.ref.getIndex()
+		if err != nil {
+			return err
+		}
+	} else {
+		index = &imgspecv1.Index{
+			Versioned: imgspec.Versioned{
+				SchemaVersion: 2,
+			},
+			Annotations: make(map[string]string),
+		}
+	}
+	for i := range d.manifests {
+		internal.AddManifest(index, &d.manifests[i])
+	}
+
 	layoutBytes, err := json.Marshal(imgspecv1.ImageLayout{
 		Version: imgspecv1.ImageLayoutVersion,
 	})
@@ -293,7 +350,7 @@ func (d *ociImageDestination) Commit(context.Context, types.UnparsedImage) error
 	if err := os.WriteFile(d.ref.ociLayoutPath(), layoutBytes, 0644); err != nil {
 		return err
 	}
-	indexJSON, err := json.Marshal(d.index)
+	indexJSON, err := json.Marshal(index)
 	if err != nil {
 		return err
 	}
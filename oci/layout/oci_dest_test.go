@@ -134,7 +134,7 @@ func TestPutTwoDifferentTags(t *testing.T) {
 func putTestConfig(t *testing.T, ociRef ociReference, tmpDir string) {
 	data, err := os.ReadFile("../../internal/image/fixtures/oci1-config.json")
 	assert.NoError(t, err)
-	imageDest, err := newImageDestination(nil, ociRef)
+	imageDest, err := newImageDestination(context.Background(), nil, ociRef)
 	assert.NoError(t, err)
 
 	cache := memory.New()
@@ -159,7 +159,7 @@ func putTestConfig(t *testing.T, ociRef ociReference, tmpDir string) {
 func putTestManifest(t *testing.T, ociRef ociReference, tmpDir string) {
 	data, err := os.ReadFile("../../internal/image/fixtures/oci1.json")
 	assert.NoError(t, err)
-	imageDest, err := newImageDestination(nil, ociRef)
+	imageDest, err := newImageDestination(context.Background(), nil, ociRef)
 	assert.NoError(t, err)
 
 	err = imageDest.PutManifest(context.Background(), data, nil)
@@ -0,0 +1,294 @@
+package layout
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/containers/image/v5/oci/internal"
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// layoutReference returns an ociReference for the layout in dir, not referring to any specific image.
+func layoutReference(dir string) (ociReference, error) {
+	ref, err := NewReference(dir, "")
+	if err != nil {
+		return ociReference{}, err
+	}
+	return ref.(ociReference), nil
+}
+
+// ListEntries returns the entries of the index of the OCI layout in dir, in order.
+// The name of an entry, if any, is the value of its imgspecv1.AnnotationRefName annotation.
+func ListEntries(dir string) ([]imgspecv1.Descriptor, error) {
+	ref, err := layoutReference(dir)
+	if err != nil {
+		return nil, err
+	}
+	index, err := ref.getIndex()
+	if err != nil {
+		return nil, err
+	}
+	return index.Manifests, nil
+}
+
+// AddEntry adds desc, which must refer to a manifest or an image index already stored in the OCI layout in dir,
+// to the index of the layout.
+// If name is not "", it is set as the name of the new entry, replacing any entries with the same name.
+// Locks of the layout are waited for as configured by sys.OCILayoutLockTimeout, or until ctx is done.
+func AddEntry(ctx context.Context, sys *types.SystemContext, dir string, desc imgspecv1.Descriptor, name string) error {
+	if desc.MediaType != imgspecv1.MediaTypeImageManifest && desc.MediaType != imgspecv1.MediaTypeImageIndex {
+		return fmt.Errorf("unsupported mediaType for an index entry: %q", desc.MediaType)
+	}
+	ref, err := layoutReference(dir)
+	if err != nil {
+		return err
+	}
+	// Make sure the blob is not garbage-collected between checking for it, and adding it to the index.
+	blobsLock, err := ref.lockBlobs(ctx, false, lockTimeout(sys))
+	if err != nil {
+		return err
+	}
+	defer blobsLock.unlock()
+	blobPath, err := ref.blobPath(desc.Digest, "")
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(blobPath); err != nil {
+		return fmt.Errorf("checking that %s exists in the layout: %w", desc.Digest, err)
+	}
+	indexLock, err := ref.lockIndex(ctx, lockTimeout(sys))
+	if err != nil {
+		return err
+	}
+	defer indexLock.unlock()
+	return ref.addIndexEntry(desc, name)
+}
+
+// Tag adds an entry to the index of the OCI layout in dir, named newName, referring to the same manifest
+// as the entry named existingName; any other entries named newName are removed.
+// Locks of the layout are waited for as configured by sys.OCILayoutLockTimeout, or until ctx is done.
+func Tag(ctx context.Context, sys *types.SystemContext, dir, existingName, newName string) error {
+	return updateNames(ctx, sys, dir, existingName, newName, false)
+}
+
+// Retag renames the entry named oldName in the index of the OCI layout in dir to newName;
+// any other entries named newName are removed.
+// Locks of the layout are waited for as configured by sys.OCILayoutLockTimeout, or until ctx is done.
+func Retag(ctx context.Context, sys *types.SystemContext, dir, oldName, newName string) error {
+	return updateNames(ctx, sys, dir, oldName, newName, oldName != newName)
+}
+
+// updateNames implements Tag and Retag: it adds an entry named newName referring to the same manifest as existingName,
+// and if removeExisting, removes the entry named existingName.
+func updateNames(ctx context.Context, sys *types.SystemContext, dir, existingName, newName string, removeExisting bool) error {
+	if existingName == "" || newName == "" {
+		return errors.New("both the existing and the new name must be specified")
+	}
+	ref, err := layoutReference(dir)
+	if err != nil {
+		return err
+	}
+	indexLock, err := ref.lockIndex(ctx, lockTimeout(sys))
+	if err != nil {
+		return err
+	}
+	defer indexLock.unlock()
+
+	ref.image = existingName
+	desc, _, err := ref.getManifestDescriptor("")
+	if err != nil {
+		return err
+	}
+	if err := ref.addIndexEntry(desc, newName); err != nil {
+		return err
+	}
+	if !removeExisting {
+		return nil
+	}
+	_, i, err := ref.getManifestDescriptor("")
+	if err != nil {
+		return err
+	}
+	return ref.deleteReferenceFromIndex(i)
+}
+
+// RemoveEntry removes the entry named name from the index of the OCI layout in dir.
+// Unlike types.ImageReference.DeleteImage, this does not delete any blobs; use GarbageCollect for that.
+// Locks of the layout are waited for as configured by sys.OCILayoutLockTimeout, or until ctx is done.
+func RemoveEntry(ctx context.Context, sys *types.SystemContext, dir, name string) error {
+	if name == "" {
+		return errors.New("the name of the entry to remove must be specified")
+	}
+	ref, err := layoutReference(dir)
+	if err != nil {
+		return err
+	}
+	indexLock, err := ref.lockIndex(ctx, lockTimeout(sys))
+	if err != nil {
+		return err
+	}
+	defer indexLock.unlock()
+
+	ref.image = name
+	_, i, err := ref.getManifestDescriptor("")
+	if err != nil {
+		return err
+	}
+	return ref.deleteReferenceFromIndex(i)
+}
+
+// addIndexEntry adds desc, named name if not "", to the index of the layout.
+// The caller must have locked the index.
+func (ref ociReference) addIndexEntry(desc imgspecv1.Descriptor, name string) error {
+	if err := internal.ValidateImageName(name); err != nil {
+		return err
+	}
+	index, err := ref.getIndex()
+	if err != nil {
+		return err
+	}
+	desc.Annotations = maps.Clone(desc.Annotations)
+	if name != "" {
+		if desc.Annotations == nil {
+			desc.Annotations = map[string]string{}
+		}
+		desc.Annotations[imgspecv1.AnnotationRefName] = name
+		index.Manifests = slices.DeleteFunc(index.Manifests, func(d imgspecv1.Descriptor) bool {
+			return d.Annotations[imgspecv1.AnnotationRefName] == name
+		})
+	} else {
+		delete(desc.Annotations, imgspecv1.AnnotationRefName)
+	}
+	index.Manifests = append(index.Manifests, desc)
+	return saveJSON(ref.indexPath(), index)
+}
+
+// GarbageCollect deletes blobs of the OCI layout in dir which are not referenced, directly or indirectly,
+// from the index of the layout, and returns their digests.
+// Only the blobs directory of the layout is considered, blobs in a shared blob directory
+// (types.SystemContext.OCISharedBlobDirPath) are never deleted.
+// This waits until all writers to the layout which have not committed their images yet are closed,
+// as configured by sys.OCILayoutLockTimeout, or until ctx is done.
+func GarbageCollect(ctx context.Context, sys *types.SystemContext, dir string) ([]digest.Digest, error) {
+	logger := logging.For(sys)
+	deleted := []digest.Digest{}
+	err := walkUnreferencedBlobs(ctx, sys, dir, func(d digest.Digest, path string, _ fs.DirEntry) error {
+		if err := deleteBlob(logger, path); err != nil {
+			return err
+		}
+		deleted = append(deleted, d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(deleted, func(i, j int) bool {
+		return deleted[i] < deleted[j]
+	})
+	return deleted, nil
+}
+
+// UnreferencedBlobs returns the digests of blobs of the OCI layout in dir which GarbageCollect would delete, and their total size.
+// The layout is not modified.
+// This waits until all writers to the layout which have not committed their images yet are closed,
+// as configured by sys.OCILayoutLockTimeout, or until ctx is done.
+func UnreferencedBlobs(ctx context.Context, sys *types.SystemContext, dir string) ([]digest.Digest, int64, error) {
+	res := []digest.Digest{}
+	size := int64(0)
+	err := walkUnreferencedBlobs(ctx, sys, dir, func(d digest.Digest, _ string, entry fs.DirEntry) error {
+		fi, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		res = append(res, d)
+		size += fi.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, -1, err
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i] < res[j]
+	})
+	return res, size, nil
+}
+
+// walkUnreferencedBlobs calls fn for every blob of the OCI layout in dir which is not referenced, directly or indirectly,
+// from the index of the layout, while holding the locks necessary to delete them.
+func walkUnreferencedBlobs(ctx context.Context, sys *types.SystemContext, dir string, fn func(d digest.Digest, path string, entry fs.DirEntry) error) error {
+	ref, err := layoutReference(dir)
+	if err != nil {
+		return err
+	}
+	blobsLock, err := ref.lockBlobs(ctx, true, lockTimeout(sys))
+	if err != nil {
+		return err
+	}
+	defer blobsLock.unlock()
+	indexLock, err := ref.lockIndex(ctx, lockTimeout(sys))
+	if err != nil {
+		return err
+	}
+	defer indexLock.unlock()
+
+	index, err := ref.getIndex()
+	if err != nil {
+		return err
+	}
+	blobsUsed := map[digest.Digest]int{}
+	if err := ref.addBlobsUsedInIndex(blobsUsed, index, ""); err != nil {
+		return fmt.Errorf("determining blobs in use: %w", err)
+	}
+
+	return walkBlobs(filepath.Join(ref.dir, imgspecv1.ImageBlobsDir), func(d digest.Digest, path string, entry fs.DirEntry) error {
+		if blobsUsed[d] != 0 {
+			return nil
+		}
+		return fn(d, path, entry)
+	})
+}
+
+// walkBlobs calls fn for every blob stored in blobsDir, using the blobs/<alg>/<encoded> layout.
+// Files which do not have a valid digest as a name are ignored.
+// It is not an error if blobsDir does not exist.
+func walkBlobs(blobsDir string, fn func(d digest.Digest, path string, entry fs.DirEntry) error) error {
+	algorithms, err := os.ReadDir(blobsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, algorithm := range algorithms {
+		if !algorithm.IsDir() {
+			continue
+		}
+		blobs, err := os.ReadDir(filepath.Join(blobsDir, algorithm.Name()))
+		if err != nil {
+			return err
+		}
+		for _, blob := range blobs {
+			if !blob.Type().IsRegular() {
+				continue
+			}
+			d := digest.NewDigestFromEncoded(digest.Algorithm(algorithm.Name()), blob.Name())
+			if d.Validate() != nil { // Not a blob stored by us, or by any other conforming implementation; leave it alone.
+				continue
+			}
+			if err := fn(d, filepath.Join(blobsDir, algorithm.Name(), blob.Name()), blob); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
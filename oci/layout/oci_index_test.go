@@ -0,0 +1,140 @@
+package layout
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// entryNames returns the names of entries in the index of the layout in dir, mapped to their digests.
+func entryNames(t *testing.T, dir string) map[string]digest.Digest {
+	entries, err := ListEntries(dir)
+	require.NoError(t, err)
+	res := map[string]digest.Digest{}
+	for _, e := range entries {
+		res[e.Annotations[imgspecv1.AnnotationRefName]] = e.Digest
+	}
+	return res
+}
+
+func TestListEntries(t *testing.T) {
+	tmpDir := loadFixture(t, "delete_image_multiple_images")
+	entries, err := ListEntries(tmpDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 7)
+	assert.Equal(t, "latest", entries[0].Annotations[imgspecv1.AnnotationRefName])
+	assert.Equal(t, imgspecv1.MediaTypeImageIndex, entries[0].MediaType)
+
+	_, err = ListEntries(filepath.Join(tmpDir, "does-not-exist"))
+	assert.Error(t, err)
+}
+
+func TestAddEntry(t *testing.T) {
+	tmpDir := loadFixture(t, "delete_image_multiple_images")
+	desc := imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Digest:    "sha256:5b2aba4d3c27bc6493633d0ec446b25c8d0a5c9cfe99894bcdff0aee80813805",
+		Size:      525,
+	}
+	err := AddEntry(context.Background(), nil, tmpDir, desc, "added")
+	require.NoError(t, err)
+	// Replacing an existing name
+	err = AddEntry(context.Background(), nil, tmpDir, desc, "latest")
+	require.NoError(t, err)
+	names := entryNames(t, tmpDir)
+	assert.Len(t, names, 8)
+	assert.Equal(t, desc.Digest, names["added"])
+	assert.Equal(t, desc.Digest, names["latest"])
+
+	// A blob which is not present
+	desc.Digest = "sha256:0000000000000000000000000000000000000000000000000000000000000000"
+	err = AddEntry(context.Background(), nil, tmpDir, desc, "missing")
+	assert.Error(t, err)
+	// Not a manifest
+	desc.Digest = "sha256:df11bc189adeb50dadb3291a3a7f2c34b36e0efdba0df70f2c8a2d761b215cde"
+	desc.MediaType = imgspecv1.MediaTypeImageConfig
+	err = AddEntry(context.Background(), nil, tmpDir, desc, "config")
+	assert.Error(t, err)
+}
+
+func TestTagRetagRemoveEntry(t *testing.T) {
+	tmpDir := loadFixture(t, "delete_image_multiple_images")
+	original := entryNames(t, tmpDir)
+
+	err := Tag(context.Background(), nil, tmpDir, "3.17.5", "stable")
+	require.NoError(t, err)
+	names := entryNames(t, tmpDir)
+	assert.Equal(t, original["3.17.5"], names["stable"])
+	assert.Equal(t, original["3.17.5"], names["3.17.5"])
+
+	err = Retag(context.Background(), nil, tmpDir, "stable", "3.18")
+	require.NoError(t, err)
+	names = entryNames(t, tmpDir)
+	assert.NotContains(t, names, "stable")
+	assert.Equal(t, original["3.17.5"], names["3.18"])
+	assert.Len(t, names, len(original))
+
+	err = RemoveEntry(context.Background(), nil, tmpDir, "3.18")
+	require.NoError(t, err)
+	names = entryNames(t, tmpDir)
+	assert.NotContains(t, names, "3.18")
+	assert.Len(t, names, len(original)-1)
+	// Blobs are not deleted
+	assertBlobExists(t, filepath.Join(tmpDir, "blobs"), "sha256:5b2aba4d3c27bc6493633d0ec446b25c8d0a5c9cfe99894bcdff0aee80813805")
+
+	err = Tag(context.Background(), nil, tmpDir, "does-not-exist", "new")
+	assert.Error(t, err)
+	err = RemoveEntry(context.Background(), nil, tmpDir, "does-not-exist")
+	assert.Error(t, err)
+	err = Tag(context.Background(), nil, tmpDir, "3", "")
+	assert.Error(t, err)
+}
+
+func TestGarbageCollect(t *testing.T) {
+	tmpDir := loadFixture(t, "delete_image_multiple_images")
+	blobsDir := filepath.Join(tmpDir, "blobs")
+
+	// Nothing to collect
+	deleted, err := GarbageCollect(context.Background(), nil, tmpDir)
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	err = RemoveEntry(context.Background(), nil, tmpDir, "3.17.5")
+	require.NoError(t, err)
+	// A file which is not a blob is ignored
+	err = os.WriteFile(filepath.Join(blobsDir, "sha256", "not-a-digest"), []byte{}, 0o644)
+	require.NoError(t, err)
+
+	expected := []digest.Digest{
+		"sha256:5b2aba4d3c27bc6493633d0ec446b25c8d0a5c9cfe99894bcdff0aee80813805",
+		"sha256:986315a0e599fac2b80eb31db2124dab8d3de04d7ca98b254999bd913c1f73fe",
+		"sha256:df11bc189adeb50dadb3291a3a7f2c34b36e0efdba0df70f2c8a2d761b215cde",
+	}
+	unreferenced, size, err := UnreferencedBlobs(context.Background(), nil, tmpDir)
+	require.NoError(t, err)
+	assert.Equal(t, expected, unreferenced)
+	expectedSize := int64(0)
+	for _, d := range expected {
+		assertBlobExists(t, blobsDir, d.String())
+		fi, err := os.Stat(filepath.Join(blobsDir, d.Algorithm().String(), d.Encoded()))
+		require.NoError(t, err)
+		expectedSize += fi.Size()
+	}
+	assert.Equal(t, expectedSize, size)
+
+	deleted, err = GarbageCollect(context.Background(), nil, tmpDir)
+	require.NoError(t, err)
+	assert.Equal(t, expected, deleted)
+	for _, d := range deleted {
+		assertBlobDoesNotExist(t, blobsDir, d.String())
+	}
+	assertBlobExists(t, blobsDir, "sha256:93cbd11a4f41467a0409b975499ae711bc6f8222de38d9f1b5a4097583195ad5")
+	_, err = os.Stat(filepath.Join(blobsDir, "sha256", "not-a-digest"))
+	assert.NoError(t, err)
+}
@@ -0,0 +1,88 @@
+package layout
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containers/image/v5/oci/internal"
+	"github.com/containers/image/v5/types"
+)
+
+const (
+	lockPollInitialInterval = 10 * time.Millisecond
+	lockPollMaxInterval     = 500 * time.Millisecond
+)
+
+// layoutLock is an advisory lock held on a lock file within an OCI layout.
+type layoutLock struct {
+	file *os.File
+}
+
+// lockTimeout returns the lock timeout configured in sys, or 0 to wait indefinitely.
+func lockTimeout(sys *types.SystemContext) time.Duration {
+	if sys != nil {
+		return sys.OCILayoutLockTimeout
+	}
+	return 0
+}
+
+// lockBlobs locks the blobs of the layout, shared if exclusive is false.
+// Writers lock the blobs shared for as long as they might create blobs not yet referenced from the index;
+// anything deleting unreferenced blobs must lock them exclusively.
+// The blobs must be locked before the index, if both are locked.
+func (ref ociReference) lockBlobs(ctx context.Context, exclusive bool, timeout time.Duration) (*layoutLock, error) {
+	return acquireLayoutLock(ctx, filepath.Join(ref.dir, internal.BlobsLockFileName), exclusive, timeout)
+}
+
+// lockIndex exclusively locks the index of the layout, for a read-modify-write update.
+func (ref ociReference) lockIndex(ctx context.Context, timeout time.Duration) (*layoutLock, error) {
+	return acquireLayoutLock(ctx, filepath.Join(ref.dir, internal.IndexLockFileName), true, timeout)
+}
+
+// acquireLayoutLock locks path, creating it if necessary, waiting at most timeout (or until ctx is done, if timeout is 0).
+func acquireLayoutLock(ctx context.Context, path string, exclusive bool, timeout time.Duration) (*layoutLock, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("opening lock file: %w", err)
+	}
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	interval := lockPollInitialInterval
+	for {
+		locked, err := tryLockFile(f, exclusive)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("locking %q: %w", path, err)
+		}
+		if locked {
+			return &layoutLock{file: f}, nil
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("timed out after %v waiting for lock %q", timeout, path)
+		}
+		select {
+		case <-ctx.Done():
+			f.Close()
+			return nil, fmt.Errorf("waiting for lock %q: %w", path, ctx.Err())
+		case <-time.After(interval):
+		}
+		if interval < lockPollMaxInterval {
+			interval *= 2
+		}
+	}
+}
+
+// unlock releases the lock.
+func (l *layoutLock) unlock() error {
+	err := unlockFile(l.file)
+	if err2 := l.file.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
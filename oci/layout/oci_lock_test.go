@@ -0,0 +1,104 @@
+package layout
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrentCommits(t *testing.T) {
+	tmpDir := t.TempDir()
+	const images = 5
+
+	// Create all destinations first, so that none of them sees an index written by the others at creation time.
+	dests := []types.ImageDestination{}
+	for i := 0; i < images; i++ {
+		ref, err := NewReference(tmpDir, fmt.Sprintf("image%d", i))
+		require.NoError(t, err)
+		dest, err := ref.NewImageDestination(context.Background(), nil)
+		require.NoError(t, err)
+		defer dest.Close()
+		dests = append(dests, dest)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, images)
+	for i, dest := range dests {
+		wg.Add(1)
+		go func(i int, dest types.ImageDestination) {
+			defer wg.Done()
+			m := []byte(fmt.Sprintf(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:%064d","size":%d},"layers":[]}`, i, i))
+			if err := dest.PutManifest(context.Background(), m, nil); err != nil {
+				errs[i] = err
+				return
+			}
+			errs[i] = dest.Commit(context.Background(), nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+		}(i, dest)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		require.NoError(t, err)
+	}
+
+	entries, err := ListEntries(tmpDir)
+	require.NoError(t, err)
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Annotations[imgspecv1.AnnotationRefName])
+	}
+	assert.ElementsMatch(t, []string{"image0", "image1", "image2", "image3", "image4"}, names)
+}
+
+func TestLockTimeout(t *testing.T) {
+	tmpDir := loadFixture(t, "delete_image_only_one_image")
+	ref, err := NewReference(tmpDir, "latest")
+	require.NoError(t, err)
+	sys := &types.SystemContext{OCILayoutLockTimeout: 50 * time.Millisecond}
+
+	// An open destination prevents deleting blobs.
+	writerRef, err := NewReference(tmpDir, "other")
+	require.NoError(t, err)
+	dest, err := writerRef.NewImageDestination(context.Background(), sys)
+	require.NoError(t, err)
+	err = ref.DeleteImage(context.Background(), sys)
+	assert.ErrorContains(t, err, "timed out")
+	entries, err := ListEntries(tmpDir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// Multiple writers can exist at the same time.
+	dest2, err := writerRef.NewImageDestination(context.Background(), sys)
+	require.NoError(t, err)
+	err = dest2.Close()
+	require.NoError(t, err)
+
+	// Garbage collection and index updates use the timeout as well.
+	_, err = GarbageCollect(context.Background(), sys, tmpDir)
+	assert.ErrorContains(t, err, "timed out")
+	indexLock, err := ref.(ociReference).lockIndex(context.Background(), 0)
+	require.NoError(t, err)
+	err = Tag(context.Background(), sys, tmpDir, "latest", "other")
+	assert.ErrorContains(t, err, "timed out")
+	// Without a timeout, waiting ends when the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = Tag(ctx, nil, tmpDir, "latest", "other")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	err = indexLock.unlock()
+	require.NoError(t, err)
+
+	err = dest.Close()
+	require.NoError(t, err)
+	err = ref.DeleteImage(context.Background(), sys)
+	require.NoError(t, err)
+	entries, err = ListEntries(tmpDir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
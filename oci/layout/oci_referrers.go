@@ -0,0 +1,168 @@
+package layout
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	imgspec "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/exp/maps"
+)
+
+// Referrers (manifests with a subject, e.g. signatures or SBOMs) are stored in a layout like any other manifest,
+// and listed in the index without a name. Their descriptors in the index carry the artifact type and annotations of the referrer,
+// the same way as a response of the referrers API of the OCI distribution-spec does, so that tools copying the contents
+// of the layout to a registry can find, and push, the referrers of an image.
+
+// setReferrerFields sets the artifact type and annotations of desc, a descriptor of manifestBlob, if manifestBlob is a referrer.
+func setReferrerFields(desc *imgspecv1.Descriptor, manifestBlob []byte) error {
+	// This works for both imgspecv1.Manifest and imgspecv1.Index; the latter has no config.
+	var parsed struct {
+		ArtifactType string                `json:"artifactType"`
+		Config       *imgspecv1.Descriptor `json:"config"`
+		Subject      *imgspecv1.Descriptor `json:"subject"`
+		Annotations  map[string]string     `json:"annotations"`
+	}
+	if err := json.Unmarshal(manifestBlob, &parsed); err != nil {
+		return fmt.Errorf("parsing manifest: %w", err)
+	}
+	if parsed.Subject == nil {
+		return nil
+	}
+	desc.ArtifactType = parsed.ArtifactType
+	if desc.ArtifactType == "" && parsed.Config != nil {
+		desc.ArtifactType = parsed.Config.MediaType
+	}
+	desc.Annotations = maps.Clone(parsed.Annotations)
+	return nil
+}
+
+// putSigstoreReferrer stores sig as a referrer of subject, in the format used by cosign, and returns a descriptor of the referrer manifest.
+func (d *ociImageDestination) putSigstoreReferrer(ctx context.Context, sig signature.Sigstore, subject imgspecv1.Descriptor) (imgspecv1.Descriptor, error) {
+	configDesc, err := d.putBlobBytes(ctx, imgspecv1.DescriptorEmptyJSON.Data, imgspecv1.MediaTypeEmptyJSON, true)
+	if err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	payloadDesc, err := d.putBlobBytes(ctx, sig.UntrustedPayload(), sig.UntrustedMIMEType(), false)
+	if err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	payloadDesc.Annotations = sig.UntrustedAnnotations()
+
+	manifestBlob, err := json.Marshal(imgspecv1.Manifest{
+		Versioned:    imgspec.Versioned{SchemaVersion: 2},
+		MediaType:    imgspecv1.MediaTypeImageManifest,
+		ArtifactType: signature.SigstoreSignatureArtifactType,
+		Config:       configDesc,
+		Layers:       []imgspecv1.Descriptor{payloadDesc},
+		Subject:      &subject,
+	})
+	if err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	manifestDigest := digest.FromBytes(manifestBlob)
+	if err := d.PutManifest(ctx, manifestBlob, &manifestDigest); err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	desc := imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Digest:    manifestDigest,
+		Size:      int64(len(manifestBlob)),
+	}
+	if err := setReferrerFields(&desc, manifestBlob); err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	return desc, nil
+}
+
+// putBlobBytes stores a blob with the specified contents, and returns an appropriate descriptor.
+func (d *ociImageDestination) putBlobBytes(ctx context.Context, contents []byte, mimeType string, isConfig bool) (imgspecv1.Descriptor, error) {
+	blobDigest := digest.FromBytes(contents)
+	info, err := d.PutBlobWithOptions(ctx, bytes.NewReader(contents), types.BlobInfo{
+		Digest:    blobDigest,
+		Size:      int64(len(contents)),
+		MediaType: mimeType,
+	}, private.PutBlobOptions{
+		Cache:    none.NoCache,
+		IsConfig: isConfig,
+	})
+	if err != nil {
+		return imgspecv1.Descriptor{}, fmt.Errorf("writing blob %s: %w", blobDigest.String(), err)
+	}
+	return imgspecv1.Descriptor{
+		MediaType: mimeType,
+		Digest:    info.Digest,
+		Size:      info.Size,
+	}, nil
+}
+
+// subjectDescriptor returns a descriptor of the manifest with manifestDigest, already stored in the layout,
+// suitable for use as the subject of a referrer.
+func subjectDescriptor(ref ociReference, sharedBlobDir string, manifestDigest digest.Digest) (imgspecv1.Descriptor, error) {
+	manifestBlob, err := readBlob(ref, sharedBlobDir, manifestDigest, iolimits.MaxManifestBodySize)
+	if err != nil {
+		return imgspecv1.Descriptor{}, err
+	}
+	return manifest.SubjectDescriptor(manifestBlob, "")
+}
+
+// sigstoreReferrers returns the sigstore signatures stored as referrers of the manifest with manifestDigest,
+// looking for them in index.
+func sigstoreReferrers(ref ociReference, sharedBlobDir string, index *imgspecv1.Index, manifestDigest digest.Digest) ([]signature.Signature, error) {
+	res := []signature.Signature{}
+	for _, md := range index.Manifests {
+		if md.MediaType != imgspecv1.MediaTypeImageManifest || md.ArtifactType != signature.SigstoreSignatureArtifactType {
+			continue
+		}
+		manifestBlob, err := readBlob(ref, sharedBlobDir, md.Digest, iolimits.MaxManifestBodySize)
+		if err != nil {
+			return nil, err
+		}
+		var referrer imgspecv1.Manifest
+		if err := json.Unmarshal(manifestBlob, &referrer); err != nil {
+			return nil, fmt.Errorf("parsing referrer manifest %s: %w", md.Digest.String(), err)
+		}
+		if referrer.Subject == nil || referrer.Subject.Digest != manifestDigest {
+			continue
+		}
+		for _, layer := range referrer.Layers {
+			payload, err := readBlob(ref, sharedBlobDir, layer.Digest, iolimits.MaxSignatureBodySize)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, signature.SigstoreFromComponents(layer.MediaType, payload, layer.Annotations))
+		}
+	}
+	return res, nil
+}
+
+// readBlob returns the contents of a blob with blobDigest, of at most limit bytes, verifying that they match the digest.
+func readBlob(ref ociReference, sharedBlobDir string, blobDigest digest.Digest, limit int) ([]byte, error) {
+	blobPath, err := ref.blobPath(blobDigest, sharedBlobDir)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(blobPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	contents, err := iolimits.ReadAtMost(f, limit)
+	if err != nil {
+		return nil, fmt.Errorf("reading blob %s: %w", blobDigest.String(), err)
+	}
+	if actual := blobDigest.Algorithm().FromBytes(contents); actual != blobDigest {
+		return nil, fmt.Errorf("blob %s does not match its digest, actual digest %s", blobDigest.String(), actual.String())
+	}
+	return contents, nil
+}
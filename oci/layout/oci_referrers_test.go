@@ -0,0 +1,128 @@
+package layout
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// putSignedImage writes a manifest with sigs to an image in dir, and returns the manifest digest.
+func putSignedImage(t *testing.T, dir, image string, m []byte, sigs []signature.Signature) digest.Digest {
+	ctx := context.Background()
+	ref, err := NewReference(dir, image)
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	privateDest, ok := dest.(private.ImageDestination)
+	require.True(t, ok)
+	err = privateDest.SupportsSignatures(ctx)
+	require.NoError(t, err)
+	err = privateDest.PutManifest(ctx, m, nil)
+	require.NoError(t, err)
+	err = privateDest.PutSignaturesWithFormat(ctx, sigs, nil)
+	require.NoError(t, err)
+	err = privateDest.Commit(ctx, nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	require.NoError(t, err)
+	return digest.FromBytes(m)
+}
+
+func TestSigstoreReferrers(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	m := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:0000000000000000000000000000000000000000000000000000000000000000","size":0},"layers":[]}`)
+	sig := signature.SigstoreFromComponents(signature.SigstoreSignatureMIMEType, []byte("payload"), map[string]string{"a": "b"})
+
+	manifestDigest := putSignedImage(t, tmpDir, "", m, []signature.Signature{sig})
+	// Writing the same signature again does not add another referrer.
+	putSignedImage(t, tmpDir, "", m, []signature.Signature{sig})
+
+	entries, err := ListEntries(tmpDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, manifestDigest, entries[0].Digest)
+	assert.Empty(t, entries[0].ArtifactType)
+	referrerDesc := entries[1]
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, referrerDesc.MediaType)
+	assert.Equal(t, signature.SigstoreSignatureArtifactType, referrerDesc.ArtifactType)
+	assert.NotContains(t, referrerDesc.Annotations, imgspecv1.AnnotationRefName)
+
+	ref, err := NewReference(tmpDir, "")
+	require.NoError(t, err)
+	referrerBlob, err := readBlob(ref.(ociReference), "", referrerDesc.Digest, 1<<20)
+	require.NoError(t, err)
+	var referrer imgspecv1.Manifest
+	err = json.Unmarshal(referrerBlob, &referrer)
+	require.NoError(t, err)
+	assert.Equal(t, &imgspecv1.Descriptor{
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Digest:    manifestDigest,
+		Size:      int64(len(m)),
+	}, referrer.Subject)
+	assert.Equal(t, imgspecv1.MediaTypeEmptyJSON, referrer.Config.MediaType)
+	require.Len(t, referrer.Layers, 1)
+	assert.Equal(t, signature.SigstoreSignatureMIMEType, referrer.Layers[0].MediaType)
+	assert.Equal(t, map[string]string{"a": "b"}, referrer.Layers[0].Annotations)
+
+	// The referrer is not considered an image when choosing the only image in the layout,
+	// and the signature can be read back.
+	src, err := ref.NewImageSource(ctx, nil)
+	require.NoError(t, err)
+	defer src.Close()
+	sigs, err := src.(private.ImageSource).GetSignaturesWithFormat(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []signature.Signature{sig}, sigs)
+	otherDigest := digest.FromString("other")
+	sigs, err = src.(private.ImageSource).GetSignaturesWithFormat(ctx, &otherDigest)
+	require.NoError(t, err)
+	assert.Empty(t, sigs)
+
+	// Only sigstore signatures are supported.
+	dest, err := ref.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	err = dest.PutManifest(ctx, m, nil)
+	require.NoError(t, err)
+	err = dest.(private.ImageDestination).PutSignaturesWithFormat(ctx, []signature.Signature{signature.SimpleSigningFromBlob([]byte("sig"))}, nil)
+	assert.Error(t, err)
+}
+
+func TestPutManifestReferrer(t *testing.T) {
+	ctx := context.Background()
+	tmpDir := t.TempDir()
+	subjectDigest := putSignedImage(t, tmpDir, "image", []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.oci.image.config.v1+json","digest":"sha256:0000000000000000000000000000000000000000000000000000000000000000","size":0},"layers":[]}`), nil)
+
+	// A referrer copied into the layout is listed with its artifact type and annotations.
+	sbom := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","config":{"mediaType":"application/vnd.example.sbom","digest":"sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a","size":2},"layers":[],` +
+		`"subject":{"mediaType":"application/vnd.oci.image.manifest.v1+json","digest":"` + subjectDigest.String() + `","size":1},"annotations":{"org.example":"value"}}`)
+	ref, err := NewReference(tmpDir, "sbom")
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	err = dest.PutManifest(ctx, sbom, nil)
+	require.NoError(t, err)
+	err = dest.Commit(ctx, nil) // nil unparsedToplevel is invalid, we don’t currently use the value
+	require.NoError(t, err)
+
+	entries, err := ListEntries(tmpDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, imgspecv1.Descriptor{
+		MediaType:    imgspecv1.MediaTypeImageManifest,
+		ArtifactType: "application/vnd.example.sbom",
+		Digest:       digest.FromBytes(sbom),
+		Size:         int64(len(sbom)),
+		Annotations: map[string]string{
+			"org.example":               "value",
+			imgspecv1.AnnotationRefName: "sbom",
+		},
+	}, entries[1])
+}
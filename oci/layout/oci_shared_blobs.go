@@ -0,0 +1,118 @@
+package layout
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// linkSharedBlob makes the blob with digest, already stored in d.sharedBlobDir, also available in the blobs
+// directory of the layout, as configured by d.linkMode.
+// It does nothing if there is no shared blob directory, if linking is not enabled, or if the layout already contains the blob.
+func (d *ociImageDestination) linkSharedBlob(blobDigest digest.Digest) error {
+	if d.sharedBlobDir == "" || d.linkMode == types.OCISharedBlobLinkNone {
+		return nil
+	}
+	sharedPath, err := d.ref.blobPath(blobDigest, d.sharedBlobDir)
+	if err != nil {
+		return err
+	}
+	localPath, err := d.ref.blobPath(blobDigest, "")
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(localPath); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err := ensureParentDirectoryExists(localPath); err != nil {
+		return err
+	}
+
+	switch d.linkMode {
+	case types.OCISharedBlobLinkHardlink:
+		err = os.Link(sharedPath, localPath)
+	case types.OCISharedBlobLinkReflink:
+		err = reflinkBlob(sharedPath, localPath)
+	default:
+		return fmt.Errorf("unknown shared blob link mode %d", d.linkMode)
+	}
+	if err != nil {
+		if os.IsExist(err) { // Another goroutine or process has linked the blob concurrently.
+			return nil
+		}
+		return fmt.Errorf("linking blob %s from the shared blob directory: %w", blobDigest, err)
+	}
+	return nil
+}
+
+// reflinkBlob creates dest as a copy-on-write clone of src.
+func reflinkBlob(src, dest string) (retErr error) {
+	srcFile, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	destFile, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := destFile.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+		if retErr != nil {
+			_ = os.Remove(dest)
+		}
+	}()
+	return cloneFile(destFile, srcFile)
+}
+
+// GarbageCollectSharedBlobDir deletes blobs in the shared blob directory sharedBlobDir
+// (see types.SystemContext.OCISharedBlobDirPath) which are not hard-linked into any OCI layout,
+// and returns their digests.
+//
+// The shared blob directory does not record which layouts use it; this relies on the hard link count
+// of the blob files instead. It is only safe to use if every layout using sharedBlobDir has been written
+// with types.SystemContext.OCISharedBlobDirLinkMode set to types.OCISharedBlobLinkHardlink
+// (reflinked copies are independent files, and blobs used without linking are not tracked at all),
+// and if the blobs of each layout are garbage-collected (e.g. using GarbageCollect) before
+// the shared directory.
+// This is not supported on Windows.
+func GarbageCollectSharedBlobDir(sharedBlobDir string) ([]digest.Digest, error) {
+	deleted := []digest.Digest{}
+	err := walkBlobs(sharedBlobDir, func(d digest.Digest, path string, entry fs.DirEntry) error {
+		info, err := entry.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		links, err := fileLinkCount(info)
+		if err != nil {
+			return err
+		}
+		if links > 1 {
+			return nil
+		}
+		if err := deleteBlob(logging.For(nil), path); err != nil {
+			return err
+		}
+		deleted = append(deleted, d)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(deleted, func(i, j int) bool {
+		return deleted[i] < deleted[j]
+	})
+	return deleted, nil
+}
@@ -0,0 +1,128 @@
+package layout
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSharedBlobDirLinking(t *testing.T) {
+	blob := []byte("shared blob contents")
+	blobDigest := digest.FromBytes(blob)
+	sharedDir := t.TempDir()
+	sharedPath := filepath.Join(sharedDir, blobDigest.Algorithm().String(), blobDigest.Encoded())
+
+	for _, c := range []struct {
+		mode      types.OCISharedBlobLinkMode
+		linked    bool
+		hardlinks bool
+	}{
+		{types.OCISharedBlobLinkNone, false, false},
+		{types.OCISharedBlobLinkHardlink, true, true},
+	} {
+		sys := &types.SystemContext{
+			OCISharedBlobDirPath:     sharedDir,
+			OCISharedBlobDirLinkMode: c.mode,
+		}
+		// One layout writes the blob, another one reuses it.
+		writerRef, err := NewReference(t.TempDir(), "")
+		require.NoError(t, err)
+		writer, err := newImageDestination(context.Background(), sys, writerRef.(ociReference))
+		require.NoError(t, err)
+		_, err = writer.PutBlob(context.Background(), bytes.NewReader(blob), types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}, memory.New(), false)
+		require.NoError(t, err)
+
+		readerRef, err := NewReference(t.TempDir(), "")
+		require.NoError(t, err)
+		reader, err := newImageDestination(context.Background(), sys, readerRef.(ociReference))
+		require.NoError(t, err)
+		reused, _, err := reader.TryReusingBlob(context.Background(), types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}, memory.New(), false)
+		require.NoError(t, err)
+		assert.True(t, reused)
+
+		sharedInfo, err := os.Stat(sharedPath)
+		require.NoError(t, err)
+		for _, ref := range []ociReference{writerRef.(ociReference), readerRef.(ociReference)} {
+			localPath, err := ref.blobPath(blobDigest, "")
+			require.NoError(t, err)
+			if !c.linked {
+				_, err := os.Lstat(localPath)
+				assert.True(t, os.IsNotExist(err))
+				continue
+			}
+			contents, err := os.ReadFile(localPath)
+			require.NoError(t, err)
+			assert.Equal(t, blob, contents)
+			if c.hardlinks {
+				localInfo, err := os.Stat(localPath)
+				require.NoError(t, err)
+				assert.True(t, os.SameFile(sharedInfo, localInfo))
+			}
+		}
+	}
+}
+
+func TestGarbageCollectSharedBlobDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hard link counts are not supported on Windows")
+	}
+	sharedDir := t.TempDir()
+	sys := &types.SystemContext{
+		OCISharedBlobDirPath:     sharedDir,
+		OCISharedBlobDirLinkMode: types.OCISharedBlobLinkHardlink,
+	}
+	layoutDir := t.TempDir()
+	ref, err := NewReference(layoutDir, "")
+	require.NoError(t, err)
+	dest, err := newImageDestination(context.Background(), sys, ref.(ociReference))
+	require.NoError(t, err)
+	blobs := map[digest.Digest][]byte{}
+	for _, contents := range []string{"blob 1", "blob 2"} {
+		blob := []byte(contents)
+		blobDigest := digest.FromBytes(blob)
+		blobs[blobDigest] = blob
+		_, err = dest.PutBlob(context.Background(), bytes.NewReader(blob), types.BlobInfo{Digest: blobDigest, Size: int64(len(blob))}, memory.New(), false)
+		require.NoError(t, err)
+	}
+	// A file which is not named after a digest is ignored.
+	err = os.WriteFile(filepath.Join(sharedDir, "sha256", "not-a-digest"), []byte{}, 0644)
+	require.NoError(t, err)
+
+	// All blobs are in use.
+	deleted, err := GarbageCollectSharedBlobDir(sharedDir)
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+
+	// Remove one blob from the layout, only that one is deleted from the shared directory.
+	unused := digest.FromBytes([]byte("blob 1"))
+	localPath, err := ref.(ociReference).blobPath(unused, "")
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(localPath))
+	deleted, err = GarbageCollectSharedBlobDir(sharedDir)
+	require.NoError(t, err)
+	assert.Equal(t, []digest.Digest{unused}, deleted)
+	for blobDigest := range blobs {
+		_, err := os.Stat(filepath.Join(sharedDir, blobDigest.Algorithm().String(), blobDigest.Encoded()))
+		if blobDigest == unused {
+			assert.True(t, os.IsNotExist(err))
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+	_, err = os.Stat(filepath.Join(sharedDir, "sha256", "not-a-digest"))
+	assert.NoError(t, err)
+
+	// A missing shared directory is not an error.
+	deleted, err = GarbageCollectSharedBlobDir(filepath.Join(sharedDir, "does-not-exist"))
+	require.NoError(t, err)
+	assert.Empty(t, deleted)
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package layout
+
+import (
+	"fmt"
+	"io/fs"
+	"syscall"
+)
+
+// fileLinkCount returns the number of hard links to the file described by info.
+func fileLinkCount(info fs.FileInfo) (uint64, error) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("unexpected file information type %T for %q", info.Sys(), info.Name())
+	}
+	return uint64(st.Nlink), nil //nolint:unconvert // The type of Nlink differs between platforms.
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package layout
+
+import (
+	"errors"
+	"os"
+)
+
+// cloneFile makes dest a copy-on-write clone of src, if supported by the filesystem.
+func cloneFile(dest, src *os.File) error {
+	return errors.New("reflinks are not supported on this platform")
+}
@@ -0,0 +1,11 @@
+package layout
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// fileLinkCount returns the number of hard links to the file described by info.
+func fileLinkCount(info fs.FileInfo) (uint64, error) {
+	return 0, errors.New("counting hard links is not supported on Windows")
+}
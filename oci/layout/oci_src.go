@@ -5,15 +5,18 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"net/url"
 	"os"
 	"strconv"
 
+	"github.com/containers/image/v5/internal/errclass"
 	"github.com/containers/image/v5/internal/imagesource/impl"
 	"github.com/containers/image/v5/internal/imagesource/stubs"
 	"github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/pkg/tlsclientconfig"
 	"github.com/containers/image/v5/types"
 	"github.com/docker/go-connections/tlsconfig"
@@ -32,10 +35,14 @@ func (e ImageNotFoundError) Error() string {
 	return fmt.Sprintf("no descriptor found for reference %q", e.ref.image)
 }
 
+// Is allows errors.Is(e, types.ErrNotFound) to succeed.
+func (e ImageNotFoundError) Is(target error) bool {
+	return target == types.ErrNotFound
+}
+
 type ociImageSource struct {
 	impl.Compat
 	impl.PropertyMethodsInitialize
-	impl.NoSignatures
 	impl.DoesNotAffectLayerInfosForCopy
 	stubs.NoGetBlobAtInitialize
 
@@ -44,10 +51,52 @@ type ociImageSource struct {
 	descriptor    imgspecv1.Descriptor
 	client        *http.Client
 	sharedBlobDir string
+	// disableForeignLayerURLs is true if blobs should never be read from the URLs of foreign layers.
+	disableForeignLayerURLs bool
 }
 
 // newImageSource returns an ImageSource for reading from an existing directory.
 func newImageSource(sys *types.SystemContext, ref ociReference) (private.ImageSource, error) {
+	return newImageSourceWithDescriptor(sys, ref, nil)
+}
+
+// NewImageSourceFromDescriptor returns an ImageSource for the manifest described by desc (e.g. as returned by a referrers listing,
+// or listed in a nested index) in the OCI layout of ref, even if the manifest is not listed in the index of the layout.
+// The manifest must match desc.Digest, and desc.Size if set; desc.MediaType, if set, is reported as the MIME type of the manifest.
+// The returned ImageSource refers to the manifest using its digest.
+// The caller must call .Close() on the returned ImageSource.
+func NewImageSourceFromDescriptor(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, desc imgspecv1.Descriptor) (types.ImageSource, error) {
+	ociRef, ok := ref.(ociReference)
+	if !ok {
+		return nil, errors.New("error typecasting, need type ociRef")
+	}
+	sharedBlobDir := ""
+	if sys != nil {
+		sharedBlobDir = sys.OCISharedBlobDirPath
+	}
+	path, err := ociRef.blobPath(desc.Digest, sharedBlobDir)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = errclass.Wrap(err, types.ErrNotFound)
+		}
+		return nil, err
+	}
+	m, err := manifest.VerifyManifestDescriptor(blob, manifest.GuessMIMEType(blob), desc)
+	if err != nil {
+		return nil, fmt.Errorf("reading manifest %s in %s: %w", desc.Digest, ociRef.dir, err)
+	}
+	desc.MediaType = m.MIMEType()
+	ociRef.image = desc.Digest.String()
+	return newImageSourceWithDescriptor(sys, ociRef, &desc)
+}
+
+// newImageSourceWithDescriptor returns an ImageSource for reading the manifest described by descriptor from an existing directory.
+// If descriptor is nil, the manifest is selected from the index using ref.
+func newImageSourceWithDescriptor(sys *types.SystemContext, ref ociReference, descriptor *imgspecv1.Descriptor) (private.ImageSource, error) {
 	tr := tlsclientconfig.NewTransport()
 	tr.TLSClientConfig = tlsconfig.ServerDefault()
 
@@ -57,12 +106,22 @@ func newImageSource(sys *types.SystemContext, ref ociReference) (private.ImageSo
 		}
 		tr.TLSClientConfig.InsecureSkipVerify = sys.OCIInsecureSkipTLSVerify
 	}
+	if err := tlsclientconfig.SetupPolicy(sys, tr.TLSClientConfig); err != nil {
+		return nil, err
+	}
 
 	client := &http.Client{}
 	client.Transport = tr
-	descriptor, _, err := ref.getManifestDescriptor()
-	if err != nil {
-		return nil, err
+	sharedBlobDir := ""
+	if sys != nil {
+		sharedBlobDir = sys.OCISharedBlobDirPath
+	}
+	if descriptor == nil {
+		desc, _, err := ref.getManifestDescriptor(sharedBlobDir)
+		if err != nil {
+			return nil, err
+		}
+		descriptor = &desc
 	}
 	index, err := ref.getIndex()
 	if err != nil {
@@ -76,12 +135,13 @@ func newImageSource(sys *types.SystemContext, ref ociReference) (private.ImageSo
 
 		ref:        ref,
 		index:      index,
-		descriptor: descriptor,
+		descriptor: *descriptor,
 		client:     client,
 	}
+	// TODO(jonboulle): check dir existence?
+	s.sharedBlobDir = sharedBlobDir
 	if sys != nil {
-		// TODO(jonboulle): check dir existence?
-		s.sharedBlobDir = sys.OCISharedBlobDirPath
+		s.disableForeignLayerURLs = sys.DisableForeignLayerURLs
 	}
 	s.Compat = impl.AddCompat(s)
 	return s, nil
@@ -136,11 +196,24 @@ func (s *ociImageSource) GetManifest(ctx context.Context, instanceDigest *digest
 	return m, mimeType, nil
 }
 
+// GetSignaturesWithFormat returns the image's signatures.  It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve signatures for
+// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+// (e.g. if the source never returns manifest lists).
+// This returns sigstore signatures stored as referrers of the manifest, listed in the index of the layout.
+func (s *ociImageSource) GetSignaturesWithFormat(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Signature, error) {
+	manifestDigest := s.descriptor.Digest
+	if instanceDigest != nil {
+		manifestDigest = *instanceDigest
+	}
+	return sigstoreReferrers(s.ref, s.sharedBlobDir, s.index, manifestDigest)
+}
+
 // GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
 // The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
 // May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
 func (s *ociImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
-	if len(info.URLs) != 0 {
+	if len(info.URLs) != 0 && !s.disableForeignLayerURLs {
 		r, s, err := s.getExternalBlob(ctx, info.URLs)
 		if err != nil {
 			return nil, 0, err
@@ -156,6 +229,9 @@ func (s *ociImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache
 
 	r, err := os.Open(path)
 	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = errclass.Wrap(err, types.ErrBlobUnknown)
+		}
 		return nil, 0, err
 	}
 	fi, err := r.Stat()
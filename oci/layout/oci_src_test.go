@@ -66,6 +66,29 @@ func TestGetBlobForRemoteLayers(t *testing.T) {
 	assert.Contains(t, string(data), "Hello world")
 }
 
+func TestGetBlobForRemoteLayersDisabled(t *testing.T) {
+	requested := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+		fmt.Fprintln(w, "Hello world")
+	}))
+	defer ts.Close()
+	cache := memory.New()
+
+	imageSource := createImageSource(t, &types.SystemContext{DisableForeignLayerURLs: true})
+	defer imageSource.Close()
+	layerInfo := types.BlobInfo{
+		Digest: digest.FromBytes([]byte("Hello world")),
+		Size:   -1,
+		URLs:   []string{ts.URL},
+	}
+
+	// The blob is not in the layout, and the URL must not be used.
+	_, _, err := imageSource.GetBlob(context.Background(), layerInfo, cache)
+	assert.ErrorIs(t, err, types.ErrBlobUnknown)
+	assert.False(t, requested)
+}
+
 func TestGetBlobForRemoteLayersWithTLS(t *testing.T) {
 	imageSource := createImageSource(t, &types.SystemContext{
 		OCICertPath: "fixtures/accepted_certs",
@@ -141,3 +164,31 @@ func createImageSource(t *testing.T, sys *types.SystemContext) types.ImageSource
 	require.NoError(t, err)
 	return imageSource
 }
+
+func TestNewImageSourceFromDescriptor(t *testing.T) {
+	ref, err := NewReference("fixtures/delete_image_multiple_images", "3.18")
+	require.NoError(t, err)
+	desc, err := LoadManifestDescriptor(ref)
+	require.NoError(t, err)
+
+	src, err := NewImageSourceFromDescriptor(context.Background(), nil, ref, desc)
+	require.NoError(t, err)
+	defer src.Close()
+	assert.Equal(t, "fixtures/delete_image_multiple_images:"+desc.Digest.String(), src.Reference().StringWithinTransport())
+	m, mimeType, err := src.GetManifest(context.Background(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, desc.Digest, digest.FromBytes(m))
+	assert.Equal(t, desc.MediaType, mimeType)
+
+	// Descriptor not matching the manifest
+	badSize := desc
+	badSize.Size++
+	_, err = NewImageSourceFromDescriptor(context.Background(), nil, ref, badSize)
+	assert.Error(t, err)
+
+	// Missing manifest
+	missing := desc
+	missing.Digest = digest.FromString("missing")
+	_, err = NewImageSourceFromDescriptor(context.Background(), nil, ref, missing)
+	assert.ErrorIs(t, err, types.ErrNotFound)
+}
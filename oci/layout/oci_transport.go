@@ -12,11 +12,13 @@ import (
 	"github.com/containers/image/v5/directory/explicitfilepath"
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/oci/internal"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
 	"github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/exp/slices"
 )
 
 func init() {
@@ -29,7 +31,7 @@ var (
 
 	// ErrMoreThanOneImage is an error returned when the manifest includes
 	// more than one image and the user should choose which one to use.
-	ErrMoreThanOneImage = errors.New("more than one image in oci, choose an image")
+	ErrMoreThanOneImage = internal.ErrMoreThanOneImage
 )
 
 type ociTransport struct{}
@@ -86,7 +88,7 @@ func NewReference(dir, image string) (types.ImageReference, error) {
 		return nil, err
 	}
 
-	if err = internal.ValidateImageName(image); err != nil {
+	if _, err = internal.ParseImageSelector(image); err != nil {
 		return nil, err
 	}
 
@@ -113,6 +115,46 @@ func (ref ociReference) DockerReference() reference.Named {
 	return nil
 }
 
+// ImageName returns the name of the image within the OCI layout, as specified by the user, or "" if not specified.
+// This implements private.ImageNameAccessor.
+func (ref ociReference) ImageName() string {
+	return ref.image
+}
+
+// ListTags returns the names of the images in the index of the OCI layout, in order.
+// This implements transports.TagLister.
+func (ref ociReference) ListTags(ctx context.Context, sys *types.SystemContext) ([]string, error) {
+	index, err := ref.getIndex()
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, desc := range index.Manifests {
+		if name := desc.Annotations[imgspecv1.AnnotationRefName]; name != "" && !slices.Contains(res, name) {
+			res = append(res, name)
+		}
+	}
+	return res, nil
+}
+
+// ImageExists returns true if the index of the OCI layout contains the image the reference refers to,
+// and the descriptor of its manifest.
+// This implements transports.ExistenceChecker.
+func (ref ociReference) ImageExists(ctx context.Context, sys *types.SystemContext) (bool, *imgspecv1.Descriptor, error) {
+	sharedBlobDir := ""
+	if sys != nil {
+		sharedBlobDir = sys.OCISharedBlobDirPath
+	}
+	desc, _, err := ref.getManifestDescriptor(sharedBlobDir)
+	if err != nil {
+		if errors.Is(err, types.ErrNotFound) || errors.Is(err, os.ErrNotExist) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	return true, &desc, nil
+}
+
 // PolicyConfigurationIdentity returns a string representation of the reference, suitable for policy lookup.
 // This MUST reflect user intent, not e.g. after processing of third-party redirects or aliases;
 // The value SHOULD be fully explicit about its semantics, with no hidden defaults, AND canonical
@@ -164,7 +206,14 @@ func (ref ociReference) getIndex() (*imgspecv1.Index, error) {
 }
 
 func parseIndex(path string) (*imgspecv1.Index, error) {
-	return parseJSON[imgspecv1.Index](path)
+	index, err := parseJSON[imgspecv1.Index](path)
+	if err != nil {
+		return nil, err
+	}
+	if err := manifest.ValidateIndexLimits(index); err != nil {
+		return nil, fmt.Errorf("parsing %q: %w", path, err)
+	}
+	return index, nil
 }
 
 func parseJSON[T any](path string) (*T, error) {
@@ -181,35 +230,25 @@ func parseJSON[T any](path string) (*T, error) {
 	return obj, nil
 }
 
-func (ref ociReference) getManifestDescriptor() (imgspecv1.Descriptor, int, error) {
+// getManifestDescriptor returns the descriptor of the image selected by ref.image, and its index in the index of the layout.
+// If the image was found within a nested image index, the returned index is -1.
+// sharedBlobDir is used for reading nested image indexes, if not "".
+func (ref ociReference) getManifestDescriptor(sharedBlobDir string) (imgspecv1.Descriptor, int, error) {
 	index, err := ref.getIndex()
 	if err != nil {
 		return imgspecv1.Descriptor{}, -1, err
 	}
-
-	if ref.image == "" {
-		// return manifest if only one image is in the oci directory
-		if len(index.Manifests) != 1 {
-			// ask user to choose image when more than one image in the oci directory
-			return imgspecv1.Descriptor{}, -1, ErrMoreThanOneImage
-		}
-		return index.Manifests[0], 0, nil
-	} else {
-		// if image specified, look through all manifests for a match
-		var unsupportedMIMETypes []string
-		for i, md := range index.Manifests {
-			if refName, ok := md.Annotations[imgspecv1.AnnotationRefName]; ok && refName == ref.image {
-				if md.MediaType == imgspecv1.MediaTypeImageManifest || md.MediaType == imgspecv1.MediaTypeImageIndex {
-					return md, i, nil
-				}
-				unsupportedMIMETypes = append(unsupportedMIMETypes, md.MediaType)
-			}
-		}
-		if len(unsupportedMIMETypes) != 0 {
-			return imgspecv1.Descriptor{}, -1, fmt.Errorf("reference %q matches unsupported manifest MIME types %q", ref.image, unsupportedMIMETypes)
+	desc, i, err := internal.ChooseManifestDescriptor(index, ref.image, func(desc imgspecv1.Descriptor) (*imgspecv1.Index, error) {
+		path, err := ref.blobPath(desc.Digest, sharedBlobDir)
+		if err != nil {
+			return nil, err
 		}
+		return parseIndex(path)
+	})
+	if errors.Is(err, internal.ErrImageNotFound) {
+		return imgspecv1.Descriptor{}, -1, ImageNotFoundError{ref}
 	}
-	return imgspecv1.Descriptor{}, -1, ImageNotFoundError{ref}
+	return desc, i, err
 }
 
 // LoadManifestDescriptor loads the manifest descriptor to be used to retrieve the image name
@@ -219,7 +258,7 @@ func LoadManifestDescriptor(imgRef types.ImageReference) (imgspecv1.Descriptor,
 	if !ok {
 		return imgspecv1.Descriptor{}, errors.New("error typecasting, need type ociRef")
 	}
-	md, _, err := ociRef.getManifestDescriptor()
+	md, _, err := ociRef.getManifestDescriptor("")
 	return md, err
 }
 
@@ -232,7 +271,7 @@ func (ref ociReference) NewImageSource(ctx context.Context, sys *types.SystemCon
 // NewImageDestination returns a types.ImageDestination for this reference.
 // The caller must call .Close() on the returned ImageDestination.
 func (ref ociReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
-	return newImageDestination(sys, ref)
+	return newImageDestination(ctx, sys, ref)
 }
 
 // ociLayoutPath returns a path for the oci-layout within a directory using OCI conventions.
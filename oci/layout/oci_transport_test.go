@@ -6,7 +6,9 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/containers/image/v5/internal/private"
 	_ "github.com/containers/image/v5/internal/testing/explicitfilepath-tmpdir"
+	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
@@ -71,10 +73,55 @@ func TestGetManifestDescriptor(t *testing.T) {
 			},
 			expectedIndex: 1,
 		},
+		{ // A reference by digest
+			dir:   "fixtures/name_lookups",
+			image: "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+			expectedDescriptor: &imgspecv1.Descriptor{
+				MediaType:   "application/vnd.oci.image.manifest.v1+json",
+				Digest:      "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb",
+				Size:        2,
+				Annotations: map[string]string{"org.opencontainers.image.ref.name": "b"},
+			},
+			expectedIndex: 1,
+		},
+		{ // A reference by platform
+			dir:   "fixtures/manifest",
+			image: "@linux/amd64",
+			expectedDescriptor: &imgspecv1.Descriptor{
+				MediaType:   "application/vnd.oci.image.manifest.v1+json",
+				Digest:      "sha256:84afb6189c4d69f2d040c5f1dc4e0a16fed9b539ce9cfb4ac2526ae4e0576cc0",
+				Size:        496,
+				Annotations: map[string]string{"org.opencontainers.image.ref.name": "v0.1.1"},
+				Platform: &imgspecv1.Platform{
+					Architecture: "amd64",
+					OS:           "linux",
+				},
+			},
+			expectedIndex: 0,
+		},
+		{ // A reference by annotation
+			dir:   "fixtures/name_lookups",
+			image: "org.opencontainers.image.ref.name=a",
+			expectedDescriptor: &imgspecv1.Descriptor{
+				MediaType:   "application/vnd.oci.image.manifest.v1+json",
+				Digest:      "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa",
+				Size:        1,
+				Annotations: map[string]string{"org.opencontainers.image.ref.name": "a"},
+			},
+			expectedIndex: 0,
+		},
+		{ // No platform match
+			dir:                "fixtures/manifest",
+			image:              "@linux/arm64",
+			expectedDescriptor: nil,
+			errorIs:            types.ErrNotFound,
+			errorAs:            &ImageNotFoundError{},
+		},
 		{ // No entry found
 			dir:                "fixtures/name_lookups",
 			image:              "this-does-not-exist",
 			expectedDescriptor: nil,
+			errorIs:            types.ErrNotFound,
 			errorAs:            &ImageNotFoundError{},
 		},
 		{ // Entries with invalid MIME types found
@@ -86,7 +133,7 @@ func TestGetManifestDescriptor(t *testing.T) {
 		ref, err := NewReference(c.dir, c.image)
 		require.NoError(t, err)
 
-		res, i, err := ref.(ociReference).getManifestDescriptor()
+		res, i, err := ref.(ociReference).getManifestDescriptor("")
 		if c.expectedDescriptor != nil {
 			require.NoError(t, err)
 			assert.Equal(t, c.expectedIndex, i)
@@ -196,6 +243,17 @@ func TestNewReference(t *testing.T) {
 	_, err = NewReference(tmpDir, "invalid'image!value@")
 	assert.Error(t, err)
 
+	for _, selector := range []string{"@linux/arm64", "org.example.key=value"} {
+		ref, err = NewReference(tmpDir, selector)
+		require.NoError(t, err, selector)
+		assert.Equal(t, selector, ref.(ociReference).image)
+		// Such selectors can only be used for reading images.
+		_, err = ref.NewImageDestination(context.Background(), nil)
+		assert.Error(t, err, selector)
+	}
+	_, err = NewReference(tmpDir, "@linux")
+	assert.Error(t, err)
+
 	_, err = NewReference(tmpDir+"/has:colon", imageValue)
 	assert.Error(t, err)
 }
@@ -257,6 +315,17 @@ func TestReferenceDockerReference(t *testing.T) {
 	assert.Nil(t, ref.DockerReference())
 }
 
+func TestReferenceImageName(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, image := range []string{"", "image", "example.com/repo:tag"} {
+		ref, err := NewReference(tmpDir, image)
+		require.NoError(t, err)
+		accessor, ok := ref.(private.ImageNameAccessor)
+		require.True(t, ok)
+		assert.Equal(t, image, accessor.ImageName())
+	}
+}
+
 func TestReferencePolicyConfigurationIdentity(t *testing.T) {
 	ref, tmpDir := refToTempOCI(t)
 
@@ -324,6 +393,48 @@ func TestReferenceNewImageDestination(t *testing.T) {
 	defer dest.Close()
 }
 
+func TestReferenceListTags(t *testing.T) {
+	ref, err := NewReference("fixtures/delete_image_multiple_images", "latest")
+	require.NoError(t, err)
+	tags, err := transports.ListTags(context.Background(), nil, ref)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"latest", "3.18.3", "3", "3.18", "3.17.5", "3.16.7", "1.0.0"}, tags)
+
+	ref, _ = refToTempOCI(t)
+	tags, err = transports.ListTags(context.Background(), nil, ref)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"imageValue"}, tags)
+
+	ref, err = NewReference(filepath.Join(t.TempDir(), "does-not-exist"), "")
+	require.NoError(t, err)
+	_, err = transports.ListTags(context.Background(), nil, ref)
+	assert.Error(t, err)
+}
+
+func TestReferenceImageExists(t *testing.T) {
+	ref, err := NewReference("fixtures/delete_image_multiple_images", "3.18")
+	require.NoError(t, err)
+	exists, desc, err := ref.(transports.ExistenceChecker).ImageExists(context.Background(), nil)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	expected, err := LoadManifestDescriptor(ref)
+	require.NoError(t, err)
+	assert.Equal(t, &expected, desc)
+
+	ref, err = NewReference("fixtures/delete_image_multiple_images", "does-not-exist")
+	require.NoError(t, err)
+	exists, desc, err = ref.(transports.ExistenceChecker).ImageExists(context.Background(), nil)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	assert.Nil(t, desc)
+
+	ref, err = NewReference(filepath.Join(t.TempDir(), "does-not-exist"), "")
+	require.NoError(t, err)
+	exists, _, err = ref.(transports.ExistenceChecker).ImageExists(context.Background(), nil)
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
 func TestReferenceOCILayoutPath(t *testing.T) {
 	ref, tmpDir := refToTempOCI(t)
 	ociRef, ok := ref.(ociReference)
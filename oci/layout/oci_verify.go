@@ -0,0 +1,302 @@
+package layout
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/image/v5/internal/iolimits"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// VerificationProblemKind identifies the kind of a VerificationProblem.
+type VerificationProblemKind string
+
+const (
+	// VerificationInvalidLayout means that the oci-layout file is missing or invalid.
+	VerificationInvalidLayout VerificationProblemKind = "invalid-layout"
+	// VerificationInvalidIndex means that index.json, or a manifest or an image index referenced from it, can not be parsed,
+	// or that it contains an invalid descriptor.
+	VerificationInvalidIndex VerificationProblemKind = "invalid-index"
+	// VerificationMissingBlob means that a blob referenced from the index, or from a manifest, does not exist.
+	VerificationMissingBlob VerificationProblemKind = "missing-blob"
+	// VerificationDigestMismatch means that the contents of a blob do not match its digest.
+	VerificationDigestMismatch VerificationProblemKind = "digest-mismatch"
+	// VerificationSizeMismatch means that the size of a blob does not match the size in a descriptor referring to it.
+	VerificationSizeMismatch VerificationProblemKind = "size-mismatch"
+	// VerificationOrphanedFile means that a file in the layout is not referenced, directly or indirectly, from the index,
+	// e.g. a blob of a deleted image, or a temporary file left over by an interrupted copy.
+	VerificationOrphanedFile VerificationProblemKind = "orphaned-file"
+)
+
+// VerificationProblem is a single problem found by Verify.
+type VerificationProblem struct {
+	Kind    VerificationProblemKind
+	Path    string        // The path of the affected file, relative to the layout directory, using slashes.
+	Digest  digest.Digest // The digest of the affected blob, or "" if not applicable.
+	Message string        // A human-readable description of the problem.
+}
+
+func (p VerificationProblem) String() string {
+	return fmt.Sprintf("%s: %s: %s", p.Kind, p.Path, p.Message)
+}
+
+// VerificationReport is the result of Verify.
+type VerificationReport struct {
+	VerifiedBlobs int                   // The number of blobs whose contents were found to match their digest.
+	Problems      []VerificationProblem // All problems found, in the order they were found.
+}
+
+// OK returns true if no problems were found.
+func (r *VerificationReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// layoutVerifier holds the state of a single Verify call.
+type layoutVerifier struct {
+	ref       ociReference
+	report    *VerificationReport
+	blobs     map[digest.Digest]int64 // Sizes of all referenced blobs found to exist, or -1 if they don't exist or are invalid.
+	parsed    map[digest.Digest]bool  // Manifests and image indexes which have already been checked.
+	reachable map[digest.Digest]bool  // All blobs referenced from the index, directly or indirectly.
+}
+
+// Verify checks the integrity of the OCI layout in dir, and returns a report of all problems found:
+// it verifies the digest of every blob, the sizes in all descriptors in the index and in manifests and image indexes referenced from it,
+// that all referenced blobs exist, and that there are no orphaned files.
+// Blobs in a shared blob directory (types.SystemContext.OCISharedBlobDirPath) are not considered; layers with URLs
+// (“foreign layers”) may be missing.
+// Verify does not lock the layout, so that it can be used on read-only media; the layout should not be modified concurrently.
+// An error is returned only if verification could not be completed, e.g. if dir can not be read.
+func Verify(dir string) (*VerificationReport, error) {
+	ref, err := layoutReference(dir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(ref.dir); err != nil {
+		return nil, err
+	}
+	v := layoutVerifier{
+		ref:       ref,
+		report:    &VerificationReport{Problems: []VerificationProblem{}},
+		blobs:     map[digest.Digest]int64{},
+		parsed:    map[digest.Digest]bool{},
+		reachable: map[digest.Digest]bool{},
+	}
+
+	if err := v.verifyLayoutFile(); err != nil {
+		return nil, err
+	}
+	indexBytes, err := os.ReadFile(ref.indexPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		v.addProblem(VerificationInvalidIndex, imgspecv1.ImageIndexFile, "", "the index does not exist")
+		return v.report, nil
+	}
+	var index imgspecv1.Index
+	if err := json.Unmarshal(indexBytes, &index); err != nil {
+		v.addProblem(VerificationInvalidIndex, imgspecv1.ImageIndexFile, "", fmt.Sprintf("parsing the index: %v", err))
+		// Without the index, every blob would be reported as orphaned, which is not useful.
+		return v.report, nil
+	}
+	if err := v.verifyDescriptors(index.Manifests, imgspecv1.ImageIndexFile); err != nil {
+		return nil, err
+	}
+	if err := v.findOrphanedFiles(); err != nil {
+		return nil, err
+	}
+	return v.report, nil
+}
+
+// addProblem records a problem in the report.
+func (v *layoutVerifier) addProblem(kind VerificationProblemKind, path string, d digest.Digest, message string) {
+	v.report.Problems = append(v.report.Problems, VerificationProblem{
+		Kind:    kind,
+		Path:    path,
+		Digest:  d,
+		Message: message,
+	})
+}
+
+// verifyLayoutFile checks the oci-layout file.
+func (v *layoutVerifier) verifyLayoutFile() error {
+	layoutBytes, err := os.ReadFile(v.ref.ociLayoutPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		v.addProblem(VerificationInvalidLayout, imgspecv1.ImageLayoutFile, "", "the file does not exist")
+		return nil
+	}
+	var layout imgspecv1.ImageLayout
+	if err := json.Unmarshal(layoutBytes, &layout); err != nil {
+		v.addProblem(VerificationInvalidLayout, imgspecv1.ImageLayoutFile, "", fmt.Sprintf("parsing the file: %v", err))
+		return nil
+	}
+	if layout.Version == "" {
+		v.addProblem(VerificationInvalidLayout, imgspecv1.ImageLayoutFile, "", "the imageLayoutVersion field is missing")
+	}
+	return nil
+}
+
+// verifyDescriptors verifies descriptors, listed in the file at parent, and everything they refer to.
+func (v *layoutVerifier) verifyDescriptors(descriptors []imgspecv1.Descriptor, parent string) error {
+	for _, desc := range descriptors {
+		if err := v.verifyDescriptor(desc, parent); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verifyDescriptor verifies the blob desc refers to, listed in the file at parent, and if it is a manifest or an image index,
+// everything it refers to.
+func (v *layoutVerifier) verifyDescriptor(desc imgspecv1.Descriptor, parent string) error {
+	if err := desc.Digest.Validate(); err != nil {
+		v.addProblem(VerificationInvalidIndex, parent, "", fmt.Sprintf("invalid digest %q: %v", desc.Digest, err))
+		return nil
+	}
+	v.reachable[desc.Digest] = true
+	size, known := v.blobs[desc.Digest]
+	if !known {
+		var err error
+		size, err = v.verifyBlob(desc, parent)
+		if err != nil {
+			return err
+		}
+		v.blobs[desc.Digest] = size
+	}
+	if size == -1 {
+		return nil
+	}
+	path := relativeBlobPath(desc.Digest)
+	if desc.Size != size {
+		v.addProblem(VerificationSizeMismatch, path, desc.Digest,
+			fmt.Sprintf("the size in a descriptor in %s is %d, the blob has %d bytes", parent, desc.Size, size))
+	}
+
+	if v.parsed[desc.Digest] {
+		return nil
+	}
+	switch desc.MediaType {
+	case imgspecv1.MediaTypeImageManifest, imgspecv1.MediaTypeImageIndex:
+	default: // Not a format we understand, so we can't check what it refers to.
+		return nil
+	}
+	v.parsed[desc.Digest] = true
+	blob, err := readBlob(v.ref, "", desc.Digest, iolimits.MaxManifestBodySize)
+	if err != nil {
+		v.addProblem(VerificationInvalidIndex, path, desc.Digest, err.Error())
+		return nil
+	}
+	if desc.MediaType == imgspecv1.MediaTypeImageIndex {
+		var index imgspecv1.Index
+		if err := json.Unmarshal(blob, &index); err != nil {
+			v.addProblem(VerificationInvalidIndex, path, desc.Digest, fmt.Sprintf("parsing the image index: %v", err))
+			return nil
+		}
+		return v.verifyDescriptors(index.Manifests, path)
+	}
+	var m imgspecv1.Manifest
+	if err := json.Unmarshal(blob, &m); err != nil {
+		v.addProblem(VerificationInvalidIndex, path, desc.Digest, fmt.Sprintf("parsing the manifest: %v", err))
+		return nil
+	}
+	// The subject of a referrer does not need to exist, so it is not checked.
+	return v.verifyDescriptors(append([]imgspecv1.Descriptor{m.Config}, m.Layers...), path)
+}
+
+// verifyBlob checks that the blob desc refers to, listed in the file at parent, exists and matches its digest, and returns its size.
+// Returns -1 if the blob does not exist or does not match.
+func (v *layoutVerifier) verifyBlob(desc imgspecv1.Descriptor, parent string) (int64, error) {
+	path := relativeBlobPath(desc.Digest)
+	f, err := os.Open(filepath.Join(v.ref.dir, filepath.FromSlash(path)))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return -1, err
+		}
+		if len(desc.URLs) == 0 {
+			v.addProblem(VerificationMissingBlob, path, desc.Digest, fmt.Sprintf("the blob, referenced from %s, does not exist", parent))
+		}
+		return -1, nil
+	}
+	defer f.Close()
+	verifier := desc.Digest.Verifier()
+	size, err := io.Copy(verifier, f)
+	if err != nil {
+		return -1, fmt.Errorf("reading %s: %w", path, err)
+	}
+	if !verifier.Verified() {
+		v.addProblem(VerificationDigestMismatch, path, desc.Digest, "the contents of the blob do not match its digest")
+		return -1, nil
+	}
+	v.report.VerifiedBlobs++
+	return size, nil
+}
+
+// findOrphanedFiles reports all files in the blobs directory which are not referenced from the index,
+// and temporary files left over by interrupted copies.
+func (v *layoutVerifier) findOrphanedFiles() error {
+	entries, err := os.ReadDir(v.ref.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "oci-put-blob") { // See ociImageDestination.PutBlobWithOptions.
+			v.addProblem(VerificationOrphanedFile, entry.Name(), "", "a temporary file left over by an interrupted copy")
+		}
+	}
+
+	blobsDir := filepath.Join(v.ref.dir, imgspecv1.ImageBlobsDir)
+	err = filepath.WalkDir(blobsDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == blobsDir && os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		relPath, err := filepath.Rel(v.ref.dir, path)
+		if err != nil {
+			return err
+		}
+		relPath = filepath.ToSlash(relPath)
+		d, ok := digestFromRelativeBlobPath(relPath)
+		switch {
+		case !ok:
+			v.addProblem(VerificationOrphanedFile, relPath, "", "the file is not a blob")
+		case !v.reachable[d]:
+			v.addProblem(VerificationOrphanedFile, relPath, d, "the blob is not referenced from the index")
+		}
+		return nil
+	})
+	return err
+}
+
+// relativeBlobPath returns the path of a blob with d, relative to the layout directory, using slashes.
+func relativeBlobPath(d digest.Digest) string {
+	return strings.Join([]string{imgspecv1.ImageBlobsDir, d.Algorithm().String(), d.Encoded()}, "/")
+}
+
+// digestFromRelativeBlobPath returns the digest of a blob at relPath, relative to the layout directory, using slashes,
+// and false if relPath is not a valid path of a blob.
+func digestFromRelativeBlobPath(relPath string) (digest.Digest, bool) {
+	parts := strings.Split(relPath, "/")
+	if len(parts) != 3 || parts[0] != imgspecv1.ImageBlobsDir {
+		return "", false
+	}
+	d := digest.NewDigestFromEncoded(digest.Algorithm(parts[1]), parts[2])
+	if d.Validate() != nil {
+		return "", false
+	}
+	return d, true
+}
@@ -0,0 +1,119 @@
+package layout
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/oci/internal"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	const (
+		manifestDigest = "sha256:49d1584496c6e196f512c4a9f52b17b187642269d84c044538523c5b69a660b3"
+		layerDigest    = "sha256:0c8b263642b51b5c1dc40fe402ae2e97119c6007b6e52146419985ec1f0092dc"
+	)
+	blobPath := func(dir string, d digest.Digest) string {
+		return filepath.Join(dir, imgspecv1.ImageBlobsDir, d.Algorithm().String(), d.Encoded())
+	}
+
+	// A consistent layout
+	dir := loadFixture(t, "delete_image_two_identical_references")
+	report, err := Verify(dir)
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+	assert.Empty(t, report.Problems)
+	assert.Equal(t, 6, report.VerifiedBlobs)
+
+	for _, c := range []struct {
+		name     string
+		modify   func(t *testing.T, dir string)
+		expected []VerificationProblem
+	}{
+		{
+			name: "missing blob",
+			modify: func(t *testing.T, dir string) {
+				err := os.Remove(blobPath(dir, layerDigest))
+				require.NoError(t, err)
+			},
+			expected: []VerificationProblem{{Kind: VerificationMissingBlob, Path: "blobs/sha256/0c8b263642b51b5c1dc40fe402ae2e97119c6007b6e52146419985ec1f0092dc", Digest: layerDigest}},
+		},
+		{
+			name: "modified blob",
+			modify: func(t *testing.T, dir string) {
+				err := os.WriteFile(blobPath(dir, layerDigest), []byte("modified"), 0o644)
+				require.NoError(t, err)
+			},
+			expected: []VerificationProblem{{Kind: VerificationDigestMismatch, Path: "blobs/sha256/0c8b263642b51b5c1dc40fe402ae2e97119c6007b6e52146419985ec1f0092dc", Digest: layerDigest}},
+		},
+		{
+			name: "size mismatch",
+			modify: func(t *testing.T, dir string) {
+				index, err := parseIndex(filepath.Join(dir, imgspecv1.ImageIndexFile))
+				require.NoError(t, err)
+				index.Manifests[0].Size++
+				err = saveJSON(filepath.Join(dir, imgspecv1.ImageIndexFile), index)
+				require.NoError(t, err)
+			},
+			expected: []VerificationProblem{{Kind: VerificationSizeMismatch, Path: "blobs/sha256/49d1584496c6e196f512c4a9f52b17b187642269d84c044538523c5b69a660b3", Digest: manifestDigest}},
+		},
+		{
+			name: "orphaned files",
+			modify: func(t *testing.T, dir string) {
+				err := os.WriteFile(blobPath(dir, digest.FromString("orphan")), []byte("orphan"), 0o644)
+				require.NoError(t, err)
+				err = os.WriteFile(filepath.Join(dir, imgspecv1.ImageBlobsDir, "sha256", "not-a-digest"), nil, 0o644)
+				require.NoError(t, err)
+				err = os.WriteFile(filepath.Join(dir, "oci-put-blob12345"), nil, 0o644)
+				require.NoError(t, err)
+				// Lock files are not orphaned.
+				l, err := acquireLayoutLock(context.Background(), filepath.Join(dir, internal.IndexLockFileName), true, 0)
+				require.NoError(t, err)
+				err = l.unlock()
+				require.NoError(t, err)
+			},
+			expected: []VerificationProblem{
+				{Kind: VerificationOrphanedFile, Path: "oci-put-blob12345"},
+				{Kind: VerificationOrphanedFile, Path: "blobs/sha256/" + digest.FromString("orphan").Encoded(), Digest: digest.FromString("orphan")},
+				{Kind: VerificationOrphanedFile, Path: "blobs/sha256/not-a-digest"},
+			},
+		},
+		{
+			name: "invalid oci-layout",
+			modify: func(t *testing.T, dir string) {
+				err := os.WriteFile(filepath.Join(dir, imgspecv1.ImageLayoutFile), []byte("{}"), 0o644)
+				require.NoError(t, err)
+			},
+			expected: []VerificationProblem{{Kind: VerificationInvalidLayout, Path: imgspecv1.ImageLayoutFile}},
+		},
+		{
+			name: "invalid index",
+			modify: func(t *testing.T, dir string) {
+				err := os.WriteFile(filepath.Join(dir, imgspecv1.ImageIndexFile), []byte("invalid"), 0o644)
+				require.NoError(t, err)
+			},
+			expected: []VerificationProblem{{Kind: VerificationInvalidIndex, Path: imgspecv1.ImageIndexFile}},
+		},
+	} {
+		dir := loadFixture(t, "delete_image_two_identical_references")
+		c.modify(t, dir)
+		report, err := Verify(dir)
+		require.NoError(t, err, c.name)
+		assert.False(t, report.OK(), c.name)
+		problems := []VerificationProblem{}
+		for _, p := range report.Problems {
+			assert.NotEmpty(t, p.Message, c.name)
+			p.Message = ""
+			problems = append(problems, p)
+		}
+		assert.ElementsMatch(t, c.expected, problems, c.name)
+	}
+
+	_, err = Verify(filepath.Join(t.TempDir(), "this-does-not-exist"))
+	assert.Error(t, err)
+}
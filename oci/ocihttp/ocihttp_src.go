@@ -0,0 +1,295 @@
+package ocihttp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/containers/image/v5/internal/errclass"
+	"github.com/containers/image/v5/internal/imagesource/impl"
+	"github.com/containers/image/v5/internal/imagesource/stubs"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/useragent"
+	"github.com/containers/image/v5/oci/internal"
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/pkg/tlsclientconfig"
+	"github.com/containers/image/v5/types"
+	"github.com/docker/go-connections/tlsconfig"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type ociHTTPImageSource struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	impl.NoSignatures
+	impl.DoesNotAffectLayerInfosForCopy
+	stubs.ImplementsGetBlobAt
+
+	ref        ociHTTPReference
+	client     *layoutClient
+	index      *imgspecv1.Index
+	descriptor imgspecv1.Descriptor
+}
+
+// newImageSource returns an ImageSource for reading an image from a layout served over HTTP(S).
+func newImageSource(ctx context.Context, sys *types.SystemContext, ref ociHTTPReference) (private.ImageSource, error) {
+	client, err := newHTTPClient(sys)
+	if err != nil {
+		return nil, err
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			client.http.CloseIdleConnections()
+		}
+	}()
+
+	index, err := getIndex(ctx, client, ref)
+	if err != nil {
+		return nil, err
+	}
+	descriptor, _, err := internal.ChooseManifestDescriptor(index, ref.image, func(desc imgspecv1.Descriptor) (*imgspecv1.Index, error) {
+		blob, err := getJSONBlob(ctx, client, ref, desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		var nested imgspecv1.Index
+		if err := json.Unmarshal(blob, &nested); err != nil {
+			return nil, fmt.Errorf("parsing image index %s: %w", desc.Digest, err)
+		}
+		return &nested, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("choosing an image in ocihttp:%s: %w", ref.StringWithinTransport(), err)
+	}
+
+	s := &ociHTTPImageSource{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			HasThreadSafeGetBlob: true,
+		}),
+
+		ref:        ref,
+		client:     client,
+		index:      index,
+		descriptor: descriptor,
+	}
+	s.Compat = impl.AddCompat(s)
+	succeeded = true
+	return s, nil
+}
+
+// layoutClient is an HTTP client for reading a layout.
+type layoutClient struct {
+	http              *http.Client
+	logger            types.Logger
+	manifestSizeLimit int // Maximum size of manifests and indexes
+}
+
+// newHTTPClient returns a client for reading a layout, configured using sys.
+func newHTTPClient(sys *types.SystemContext) (*layoutClient, error) {
+	tr := tlsclientconfig.NewTransport()
+	tr.TLSClientConfig = tlsconfig.ServerDefault()
+	if sys != nil {
+		if sys.OCIHTTPCertPath != "" {
+			if err := tlsclientconfig.SetupCertificates(sys.OCIHTTPCertPath, tr.TLSClientConfig); err != nil {
+				return nil, err
+			}
+		}
+		tr.TLSClientConfig.InsecureSkipVerify = sys.OCIHTTPInsecureSkipTLSVerify
+	}
+	if err := tlsclientconfig.SetupPolicy(sys, tr.TLSClientConfig); err != nil {
+		return nil, err
+	}
+	return &layoutClient{
+		http:              &http.Client{Transport: tr},
+		logger:            logging.For(sys),
+		manifestSizeLimit: iolimits.ManifestSizeLimit(sys),
+	}, nil
+}
+
+// get sends a GET request for url, with an optional Range header value, and returns the response.
+// The caller must close the response body.
+func get(ctx context.Context, client *layoutClient, url string, byteRange string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", useragent.DefaultUserAgent)
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	client.logger.Debugf("GET %s", req.URL.Redacted())
+	return client.http.Do(req)
+}
+
+// getFile returns the contents of the file at url, and its size (or -1 if unknown).
+// The caller must close the returned stream.
+func getFile(ctx context.Context, client *layoutClient, url string) (io.ReadCloser, int64, error) {
+	res, err := get(ctx, client, url, "")
+	if err != nil {
+		return nil, -1, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, -1, errclass.Wrap(fmt.Errorf("fetching %s: %s", url, res.Status), errclass.HTTPStatusKinds(res.StatusCode)...)
+	}
+	return res.Body, res.ContentLength, nil
+}
+
+// getIndex returns the index of the layout at ref.
+func getIndex(ctx context.Context, client *layoutClient, ref ociHTTPReference) (*imgspecv1.Index, error) {
+	stream, _, err := getFile(ctx, client, ref.indexURL())
+	if err != nil {
+		return nil, fmt.Errorf("reading index of ocihttp:%s: %w", ref.StringWithinTransport(), err)
+	}
+	defer stream.Close()
+	blob, err := iolimits.ReadAtMost(stream, client.manifestSizeLimit)
+	if err != nil {
+		return nil, fmt.Errorf("reading index of ocihttp:%s: %w", ref.StringWithinTransport(), err)
+	}
+	var index imgspecv1.Index
+	if err := json.Unmarshal(blob, &index); err != nil {
+		return nil, fmt.Errorf("parsing index of ocihttp:%s: %w", ref.StringWithinTransport(), err)
+	}
+	return &index, nil
+}
+
+// getJSONBlob returns the contents of a manifest-sized blob at ref, e.g. a manifest.
+func getJSONBlob(ctx context.Context, client *layoutClient, ref ociHTTPReference, d digest.Digest) ([]byte, error) {
+	url, err := ref.blobURL(d)
+	if err != nil {
+		return nil, err
+	}
+	stream, _, err := getFile(ctx, client, url)
+	if err != nil {
+		return nil, fmt.Errorf("reading blob %s: %w", d, err)
+	}
+	defer stream.Close()
+	blob, err := iolimits.ReadAtMost(stream, client.manifestSizeLimit)
+	if err != nil {
+		return nil, fmt.Errorf("reading blob %s: %w", d, err)
+	}
+	return blob, nil
+}
+
+// Reference returns the reference used to set up this source.
+func (s *ociHTTPImageSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// Close removes resources associated with an initialized ImageSource, if any.
+func (s *ociHTTPImageSource) Close() error {
+	s.client.http.CloseIdleConnections()
+	return nil
+}
+
+// GetManifest returns the image's manifest along with its MIME type (which may be empty when it can't be determined but the manifest is available).
+// It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve (when the primary manifest is a manifest list);
+// this never happens if the primary manifest is not a manifest list (e.g. if the source never returns manifest lists).
+func (s *ociHTTPImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	var dig digest.Digest
+	var mimeType string
+	if instanceDigest == nil {
+		dig = s.descriptor.Digest
+		mimeType = s.descriptor.MediaType
+	} else {
+		dig = *instanceDigest
+		for _, md := range s.index.Manifests {
+			if md.Digest == dig {
+				mimeType = md.MediaType
+				break
+			}
+		}
+	}
+
+	m, err := getJSONBlob(ctx, s.client, s.ref, dig)
+	if err != nil {
+		return nil, "", err
+	}
+	if mimeType == "" {
+		mimeType = manifest.GuessMIMEType(m)
+	}
+	return m, mimeType, nil
+}
+
+// GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
+// The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
+// May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
+func (s *ociHTTPImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	url, err := s.ref.blobURL(info.Digest)
+	if err != nil {
+		return nil, -1, err
+	}
+	stream, size, err := getFile(ctx, s.client, url)
+	if err != nil {
+		return nil, -1, fmt.Errorf("reading blob %s: %w", info.Digest, err)
+	}
+	return stream, size, nil
+}
+
+// getChunk returns a stream containing chunk of the blob at url.
+// The caller must close the returned stream.
+func (s *ociHTTPImageSource) getChunk(ctx context.Context, url string, chunk private.ImageSourceChunk) (io.ReadCloser, error) {
+	res, err := get(ctx, s.client, url, fmt.Sprintf("bytes=%d-%d", chunk.Offset, chunk.Offset+chunk.Length-1))
+	if err != nil {
+		return nil, err
+	}
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		return res.Body, nil
+	case http.StatusOK, http.StatusBadRequest, http.StatusRequestedRangeNotSatisfiable:
+		// http.StatusOK means that the server ignored the Range header; don't download the full blob for every chunk,
+		// let the caller fall back to GetBlob instead.
+		res.Body.Close()
+		return nil, private.BadPartialRequestError{Status: res.Status}
+	default:
+		res.Body.Close()
+		return nil, errclass.Wrap(fmt.Errorf("fetching partial blob: %s", res.Status), errclass.HTTPStatusKinds(res.StatusCode)...)
+	}
+}
+
+// GetBlobAt returns a sequential channel of readers that contain data for the requested
+// blob chunks, and a channel that might get a single error value.
+// The specified chunks must be not overlapping and sorted by their offset.
+// The readers must be fully consumed, in the order they are returned, before blocking
+// to read the next chunk.
+func (s *ociHTTPImageSource) GetBlobAt(ctx context.Context, info types.BlobInfo, chunks []private.ImageSourceChunk) (chan io.ReadCloser, chan error, error) {
+	url, err := s.ref.blobURL(info.Digest)
+	if err != nil {
+		return nil, nil, err
+	}
+	streams := make(chan io.ReadCloser)
+	errs := make(chan error)
+	if len(chunks) == 0 {
+		close(streams)
+		close(errs)
+		return streams, errs, nil
+	}
+	// Static web servers and CDNs often don't support multiple ranges in a single request, so every chunk is requested separately.
+	// The first request is made synchronously, so that its failures, notably BadPartialRequestError,
+	// are reported directly and the caller can fall back to reading the full blob.
+	first, err := s.getChunk(ctx, url, chunks[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	go func() {
+		defer close(streams)
+		defer close(errs)
+		streams <- first
+		for _, c := range chunks[1:] {
+			stream, err := s.getChunk(ctx, url, c)
+			if err != nil {
+				errs <- err
+				return
+			}
+			streams <- stream
+		}
+	}()
+	return streams, errs, nil
+}
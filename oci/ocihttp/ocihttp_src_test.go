@@ -0,0 +1,144 @@
+package ocihttp
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspec "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeBlob writes contents as a blob of the layout at dir, and returns its digest.
+func writeBlob(t *testing.T, dir string, contents []byte) digest.Digest {
+	d := digest.FromBytes(contents)
+	blobDir := filepath.Join(dir, "blobs", d.Algorithm().String())
+	require.NoError(t, os.MkdirAll(blobDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(blobDir, d.Encoded()), contents, 0o644))
+	return d
+}
+
+// newTestLayout creates a layout containing a single image named "img" in a subdirectory of a new test server,
+// and returns the URL of the layout, the image's manifest, and its layer.
+func newTestLayout(t *testing.T) (string, []byte, []byte) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "layouts", "test")
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+
+	layer := []byte("this is a layer, not really a tarball")
+	layerDigest := writeBlob(t, dir, layer)
+	config := []byte("{}")
+	configDigest := writeBlob(t, dir, config)
+	manifest, err := json.Marshal(imgspecv1.Manifest{
+		Versioned: imgspec.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Config:    imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageConfig, Digest: configDigest, Size: int64(len(config))},
+		Layers:    []imgspecv1.Descriptor{{MediaType: imgspecv1.MediaTypeImageLayer, Digest: layerDigest, Size: int64(len(layer))}},
+	})
+	require.NoError(t, err)
+	manifestDigest := writeBlob(t, dir, manifest)
+	index, err := json.Marshal(imgspecv1.Index{
+		Versioned: imgspec.Versioned{SchemaVersion: 2},
+		Manifests: []imgspecv1.Descriptor{{
+			MediaType:   imgspecv1.MediaTypeImageManifest,
+			Digest:      manifestDigest,
+			Size:        int64(len(manifest)),
+			Annotations: map[string]string{imgspecv1.AnnotationRefName: "img"},
+		}},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "index.json"), index, 0o644))
+
+	server := httptest.NewServer(http.FileServer(http.Dir(root)))
+	t.Cleanup(server.Close)
+	return server.URL + "/layouts/test", manifest, layer
+}
+
+func TestImageSource(t *testing.T) {
+	ctx := context.Background()
+	location, manifest, layer := newTestLayout(t)
+
+	for _, image := range []string{"", "img"} {
+		ref, err := NewReference(location, image)
+		require.NoError(t, err)
+		src, err := ref.NewImageSource(ctx, nil)
+		require.NoError(t, err, image)
+		defer src.Close()
+
+		m, mimeType, err := src.GetManifest(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, manifest, m)
+		assert.Equal(t, imgspecv1.MediaTypeImageManifest, mimeType)
+
+		stream, size, err := src.GetBlob(ctx, types.BlobInfo{Digest: digest.FromBytes(layer), Size: -1}, none.NoCache)
+		require.NoError(t, err)
+		contents, err := io.ReadAll(stream)
+		stream.Close()
+		require.NoError(t, err)
+		assert.Equal(t, layer, contents)
+		assert.Equal(t, int64(len(layer)), size)
+
+		_, _, err = src.GetBlob(ctx, types.BlobInfo{Digest: digest.FromString("missing"), Size: -1}, none.NoCache)
+		assert.Error(t, err)
+	}
+
+	ref, err := NewReference(location, "missing")
+	require.NoError(t, err)
+	_, err = ref.NewImageSource(ctx, nil)
+	assert.Error(t, err)
+
+	ref, err = NewReference(location+"/missing", "")
+	require.NoError(t, err)
+	_, err = ref.NewImageSource(ctx, nil)
+	assert.Error(t, err)
+
+	// The index is larger than MaxManifestSize
+	ref, err = NewReference(location, "img")
+	require.NoError(t, err)
+	_, err = ref.NewImageSource(ctx, &types.SystemContext{MaxManifestSize: 10})
+	var sizeErr types.SizeLimitExceededError
+	assert.ErrorAs(t, err, &sizeErr)
+}
+
+func TestImageSourceGetBlobAt(t *testing.T) {
+	ctx := context.Background()
+	location, _, layer := newTestLayout(t)
+	ref, err := NewReference(location, "img")
+	require.NoError(t, err)
+	src, err := ref.NewImageSource(ctx, nil)
+	require.NoError(t, err)
+	defer src.Close()
+	blobAtSrc, ok := src.(private.ImageSource)
+	require.True(t, ok)
+	require.True(t, blobAtSrc.SupportsGetBlobAt())
+
+	info := types.BlobInfo{Digest: digest.FromBytes(layer), Size: int64(len(layer))}
+	chunks := []private.ImageSourceChunk{{Offset: 0, Length: 4}, {Offset: 5, Length: 2}, {Offset: 10, Length: 5}}
+	streams, errs, err := blobAtSrc.GetBlobAt(ctx, info, chunks)
+	require.NoError(t, err)
+	var res []string
+	for stream := range streams {
+		contents, err := io.ReadAll(stream)
+		stream.Close()
+		require.NoError(t, err)
+		res = append(res, string(contents))
+	}
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"this", "is", "layer"}, res)
+
+	_, _, err = blobAtSrc.GetBlobAt(ctx, info, []private.ImageSourceChunk{{Offset: 1000, Length: 1}})
+	assert.ErrorAs(t, err, &private.BadPartialRequestError{})
+}
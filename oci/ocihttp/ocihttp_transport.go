@@ -0,0 +1,227 @@
+package ocihttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/oci/internal"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+func init() {
+	transports.Register(Transport)
+}
+
+// Transport is an ImageTransport for OCI layouts served by a plain HTTP(S) server, e.g. a static web server or a CDN.
+var Transport = ociHTTPTransport{}
+
+type ociHTTPTransport struct{}
+
+// Name returns the name of the transport, which must be unique among other transports.
+func (t ociHTTPTransport) Name() string {
+	return "ocihttp"
+}
+
+// ParseReference converts a string, which should not start with the ImageTransport.Name prefix, into an ImageReference.
+func (t ociHTTPTransport) ParseReference(reference string) (types.ImageReference, error) {
+	return ParseReference(reference)
+}
+
+// ValidatePolicyConfigurationScope checks that scope is a valid name for a signature.PolicyTransportScopes keys
+// (i.e. a valid PolicyConfigurationIdentity() or PolicyConfigurationNamespaces() return value).
+// It is acceptable to allow an invalid value which will never be matched, it can "only" cause user confusion.
+// scope passed to this function will not be "", that value is always allowed.
+func (t ociHTTPTransport) ValidatePolicyConfigurationScope(scope string) error {
+	if _, err := parseLocation(scope); err != nil {
+		return fmt.Errorf("Invalid scope %q: %w", scope, err)
+	}
+	return nil
+}
+
+// ociHTTPReference is an ImageReference for an OCI layout served over HTTP(S).
+type ociHTTPReference struct {
+	// location is the URL of the layout directory, without a trailing slash, in the form returned by parseLocation.
+	location string
+	// If image=="", it means the "only image" in the index.json is used.
+	image string
+}
+
+// ParseReference converts a string, which should not start with the ImageTransport.Name prefix, into an ocihttp ImageReference.
+// The expected format is {http,https}://host[:port][/path][:image]; to specify an image of a layout at the root
+// of the server, use {http,https}://host[:port]/:image.
+func ParseReference(reference string) (types.ImageReference, error) {
+	scheme, rest, ok := strings.Cut(reference, "://")
+	if !ok {
+		return nil, fmt.Errorf("ocihttp: reference %q is not an http:// or https:// URL", reference)
+	}
+	host, urlPath, hasPath := strings.Cut(rest, "/")
+	var image string
+	if hasPath {
+		urlPath, image, _ = strings.Cut(urlPath, ":")
+	}
+	location := scheme + "://" + host
+	if urlPath != "" {
+		location += "/" + urlPath
+	}
+	return NewReference(location, image)
+}
+
+// NewReference returns an ocihttp reference for a layout at location, an http:// or https:// URL, and an image.
+func NewReference(location, image string) (types.ImageReference, error) {
+	location, err := parseLocation(location)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := internal.ParseImageSelector(image); err != nil {
+		return nil, err
+	}
+	return ociHTTPReference{location: location, image: image}, nil
+}
+
+// parseLocation validates location, the URL of a layout directory, and returns it in a canonical form without a trailing slash.
+func parseLocation(location string) (string, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return "", fmt.Errorf("Invalid layout URL %q: %w", location, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("Invalid layout URL %q: expected an http:// or https:// URL", location)
+	}
+	if u.Host == "" || u.User != nil || u.Opaque != "" || u.RawQuery != "" || u.ForceQuery || u.Fragment != "" {
+		return "", fmt.Errorf("Invalid layout URL %q: expected only a host and a path", location)
+	}
+	urlPath := strings.TrimPrefix(u.EscapedPath(), "/")
+	if urlPath != "" {
+		if strings.Contains(urlPath, ":") {
+			return "", fmt.Errorf("Invalid layout URL %q: the path must not contain ':'", location)
+		}
+		for _, component := range strings.Split(urlPath, "/") {
+			if component == "" || component == "." || component == ".." {
+				return "", fmt.Errorf("Invalid layout URL %q: the path must be a sequence of non-empty components other than . and ..", location)
+			}
+		}
+		return u.Scheme + "://" + u.Host + "/" + urlPath, nil
+	}
+	return u.Scheme + "://" + u.Host, nil
+}
+
+func (ref ociHTTPReference) Transport() types.ImageTransport {
+	return Transport
+}
+
+// StringWithinTransport returns a string representation of the reference, which MUST be such that
+// reference.Transport().ParseReference(reference.StringWithinTransport()) returns an equivalent reference.
+// NOTE: The returned string is not promised to be equal to the original input to ParseReference;
+// e.g. default attribute values omitted by the user may be filled in the return value, or vice versa.
+// WARNING: Do not use the return value in the UI to describe an image, it does not contain the Transport().Name() prefix.
+func (ref ociHTTPReference) StringWithinTransport() string {
+	if ref.image == "" {
+		return ref.location
+	}
+	if !ref.hasPath() {
+		// Without the slash, the image would be parsed as a port number.
+		return ref.location + "/:" + ref.image
+	}
+	return ref.location + ":" + ref.image
+}
+
+// DockerReference returns a Docker reference associated with this reference
+// (fully explicit, i.e. !reference.IsNameOnly, but reflecting user intent,
+// not e.g. after redirect or alias processing), or nil if unknown/not applicable.
+func (ref ociHTTPReference) DockerReference() reference.Named {
+	return nil
+}
+
+// ImageName returns the name of the image within the OCI layout, as specified by the user, or "" if not specified.
+// This implements private.ImageNameAccessor.
+func (ref ociHTTPReference) ImageName() string {
+	return ref.image
+}
+
+// PolicyConfigurationIdentity returns a string representation of the reference, suitable for policy lookup.
+// This MUST reflect user intent, not e.g. after processing of third-party redirects or aliases;
+// The value SHOULD be fully explicit about its semantics, with no hidden defaults, AND canonical
+// (i.e. various references with exactly the same semantics should return the same configuration identity)
+// It is fine for the return value to be equal to StringWithinTransport(), and it is desirable but
+// not required/guaranteed that it will be a valid input to Transport().ParseReference().
+// Returns "" if configuration identities for these references are not supported.
+func (ref ociHTTPReference) PolicyConfigurationIdentity() string {
+	// NOTE: ref.image is not a part of the image identity, for the same reasons as in the oci: transport.
+	return ref.location
+}
+
+// PolicyConfigurationNamespaces returns a list of other policy configuration namespaces to search
+// for if explicit configuration for PolicyConfigurationIdentity() is not set.  The list will be processed
+// in order, terminating on first match, and an implicit "" is always checked at the end.
+// It is STRONGLY recommended for the first element, if any, to be a prefix of PolicyConfigurationIdentity(),
+// and each following element to be a prefix of the element preceding it.
+func (ref ociHTTPReference) PolicyConfigurationNamespaces() []string {
+	scheme, location, _ := strings.Cut(ref.location, "://")
+	res := []string{}
+	for {
+		res = append(res, scheme+"://"+location)
+		lastSlash := strings.LastIndex(location, "/")
+		if lastSlash == -1 {
+			break
+		}
+		location = location[:lastSlash]
+	}
+	return res
+}
+
+// NewImage returns a types.ImageCloser for this reference, possibly specialized for this ImageTransport.
+// The caller must call .Close() on the returned ImageCloser.
+// NOTE: If any kind of signature verification should happen, build an UnparsedImage from the value returned by NewImageSource,
+// verify that UnparsedImage, and convert it into a real Image via image.FromUnparsedImage.
+// WARNING: This may not do the right thing for a manifest list, see image.FromSource for details.
+func (ref ociHTTPReference) NewImage(ctx context.Context, sys *types.SystemContext) (types.ImageCloser, error) {
+	return image.FromReference(ctx, sys, ref)
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref ociHTTPReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	return newImageSource(ctx, sys, ref)
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref ociHTTPReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	return nil, errors.New("Writing images to an ocihttp: layout is not supported; copy the image to an oci: layout and publish the directory instead")
+}
+
+// DeleteImage deletes the named image from the registry, if supported.
+func (ref ociHTTPReference) DeleteImage(ctx context.Context, sys *types.SystemContext) error {
+	return errors.New("Deleting images not implemented for ocihttp: images")
+}
+
+// hasPath returns true if the layout is not at the root of the server.
+func (ref ociHTTPReference) hasPath() bool {
+	_, location, _ := strings.Cut(ref.location, "://")
+	return strings.Contains(location, "/")
+}
+
+// fileURL returns the URL of a file at relativePath within the layout.
+func (ref ociHTTPReference) fileURL(relativePath string) string {
+	return ref.location + "/" + relativePath
+}
+
+// indexURL returns the URL of the index.json file of the layout.
+func (ref ociHTTPReference) indexURL() string {
+	return ref.fileURL("index.json")
+}
+
+// blobURL returns the URL of the blob with digest d.
+func (ref ociHTTPReference) blobURL(d digest.Digest) (string, error) {
+	if err := d.Validate(); err != nil {
+		return "", fmt.Errorf("unexpected digest reference %s: %w", d, err)
+	}
+	return ref.fileURL("blobs/" + d.Algorithm().String() + "/" + d.Encoded()), nil
+}
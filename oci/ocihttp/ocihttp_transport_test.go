@@ -0,0 +1,104 @@
+package ocihttp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportName(t *testing.T) {
+	assert.Equal(t, "ocihttp", Transport.Name())
+}
+
+func TestTransportValidatePolicyConfigurationScope(t *testing.T) {
+	for _, scope := range []string{
+		"https://example.com",
+		"http://example.com:8080",
+		"https://example.com/a/b/c",
+	} {
+		err := Transport.ValidatePolicyConfigurationScope(scope)
+		assert.NoError(t, err, scope)
+	}
+
+	for _, scope := range []string{
+		"example.com",
+		"ftp://example.com",
+		"https://",
+		"https://example.com/a/",
+		"https://example.com//a",
+		"https://example.com/a/../b",
+		"https://example.com/a?b",
+		"https://example.com/a#b",
+		"https://user@example.com/a",
+	} {
+		err := Transport.ValidatePolicyConfigurationScope(scope)
+		assert.Error(t, err, scope)
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	for _, c := range []struct{ input, location, image, roundtrip string }{
+		{"https://example.com", "https://example.com", "", "https://example.com"},
+		{"https://example.com/", "https://example.com", "", "https://example.com"},
+		{"http://example.com:8080/a/b", "http://example.com:8080/a/b", "", "http://example.com:8080/a/b"},
+		{"https://example.com/a/b:img", "https://example.com/a/b", "img", "https://example.com/a/b:img"},
+		{"https://example.com:8443/a:img:tag", "https://example.com:8443/a", "img:tag", "https://example.com:8443/a:img:tag"},
+		{"https://example.com/:img", "https://example.com", "img", "https://example.com/:img"},
+		{"https://example.com/a:@linux/amd64", "https://example.com/a", "@linux/amd64", "https://example.com/a:@linux/amd64"},
+		{"example.com/a", "", "", ""},                // Missing scheme
+		{"ftp://example.com/a", "", "", ""},          // Unsupported scheme
+		{"https://example.com/a/", "", "", ""},       // Empty path component
+		{"https://example.com/../a", "", "", ""},     // .. path component
+		{"https://example.com/a?x=1", "", "", ""},    // Query
+		{"https://example.com/a:@linux", "", "", ""}, // Invalid platform selector
+	} {
+		ref, err := ParseReference(c.input)
+		if c.location == "" {
+			assert.Error(t, err, c.input)
+			continue
+		}
+		require.NoError(t, err, c.input)
+		httpRef, ok := ref.(ociHTTPReference)
+		require.True(t, ok, c.input)
+		assert.Equal(t, c.location, httpRef.location, c.input)
+		assert.Equal(t, c.image, httpRef.image, c.input)
+		assert.Equal(t, c.roundtrip, ref.StringWithinTransport(), c.input)
+		assert.Nil(t, ref.DockerReference(), c.input)
+	}
+}
+
+func TestReferencePolicyConfiguration(t *testing.T) {
+	ref, err := ParseReference("https://example.com/a/b:img")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/a/b", ref.PolicyConfigurationIdentity())
+	assert.Equal(t, []string{"https://example.com/a/b", "https://example.com/a", "https://example.com"}, ref.PolicyConfigurationNamespaces())
+	for _, ns := range ref.PolicyConfigurationNamespaces() {
+		assert.NoError(t, Transport.ValidatePolicyConfigurationScope(ns), ns)
+	}
+
+	ref, err = ParseReference("http://example.com:8080")
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com:8080", ref.PolicyConfigurationIdentity())
+	assert.Equal(t, []string{"http://example.com:8080"}, ref.PolicyConfigurationNamespaces())
+}
+
+func TestReferenceURLs(t *testing.T) {
+	ref, err := ParseReference("https://example.com/a/b:img")
+	require.NoError(t, err)
+	httpRef := ref.(ociHTTPReference)
+	assert.Equal(t, "https://example.com/a/b/index.json", httpRef.indexURL())
+	u, err := httpRef.blobURL("sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/a/b/blobs/sha256/0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", u)
+	_, err = httpRef.blobURL("sha256:../../index.json")
+	assert.Error(t, err)
+
+	ref, err = ParseReference("https://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/index.json", ref.(ociHTTPReference).indexURL())
+
+	_, err = ref.NewImageDestination(context.Background(), nil)
+	assert.Error(t, err)
+}
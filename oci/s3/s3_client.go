@@ -0,0 +1,584 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/containers/image/v5/internal/errclass"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/useragent"
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/pkg/tlsclientconfig"
+	"github.com/containers/image/v5/types"
+	"github.com/docker/go-connections/tlsconfig"
+)
+
+const (
+	defaultRegion = "us-east-1"
+	// emptyPayloadHash is the SHA-256 of an empty request body.
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	// maxErrorBodySize is the maximum size of an error response body we read.
+	maxErrorBodySize = 64 * 1024
+)
+
+// multipartPartSize is the default size of parts of multipart uploads; objects smaller than this are uploaded in a single request.
+// Amazon S3 requires parts other than the last one to be at least 5 MiB.
+// This is a variable only to allow tests to use smaller parts.
+var multipartPartSize = 16 * 1024 * 1024
+
+// maxMultipartParts is the maximum number of parts of a multipart upload allowed by Amazon S3.
+// This is a variable only to allow tests to use a smaller limit.
+var maxMultipartParts = 10000
+
+// maxMultipartPartSize is the maximum size of a part of a multipart upload allowed by Amazon S3.
+const maxMultipartPartSize = 5 * 1024 * 1024 * 1024
+
+// s3Client is a minimal client for the S3 REST API, sufficient for reading and writing the objects of an OCI layout in a bucket.
+type s3Client struct {
+	httpClient        *http.Client
+	endpoint          *url.URL // nil to use Amazon S3 with virtual-hosted-style URLs
+	region            string
+	credentials       *types.S3Credentials // Static credentials, or nil
+	remoteCredentials *remoteCredentials   // Used if credentials is nil; if both are nil, requests are sent anonymously
+	bucket            string
+	sse               string // Value of the x-amz-server-side-encryption header, or ""
+	sseKMSKeyID       string // Value of the x-amz-server-side-encryption-aws-kms-key-id header, or ""
+	logger            types.Logger
+	manifestSizeLimit int // Maximum size of manifests and indexes
+}
+
+// newS3Client returns a client for bucket, configured using sys.
+func newS3Client(sys *types.SystemContext, bucket string) (*s3Client, error) {
+	tr := tlsclientconfig.NewTransport()
+	tr.TLSClientConfig = tlsconfig.ServerDefault()
+	c := &s3Client{
+		httpClient:        &http.Client{Transport: tr},
+		bucket:            bucket,
+		logger:            logging.For(sys),
+		manifestSizeLimit: iolimits.ManifestSizeLimit(sys),
+	}
+	if sys != nil {
+		if sys.S3Endpoint != "" {
+			endpoint, err := url.Parse(sys.S3Endpoint)
+			if err != nil {
+				return nil, fmt.Errorf("parsing S3 endpoint %q: %w", sys.S3Endpoint, err)
+			}
+			if (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" || endpoint.RawQuery != "" {
+				return nil, fmt.Errorf("invalid S3 endpoint %q, expected an http:// or https:// URL", sys.S3Endpoint)
+			}
+			c.endpoint = endpoint
+		}
+		c.region = sys.S3Region
+		c.credentials = sys.S3Credentials
+		switch sys.S3ServerSideEncryption {
+		case "", "AES256", "aws:kms":
+			c.sse = sys.S3ServerSideEncryption
+		default:
+			return nil, fmt.Errorf(`unsupported S3 server-side encryption %q, expected "AES256" or "aws:kms"`, sys.S3ServerSideEncryption)
+		}
+		if sys.S3ServerSideEncryptionKMSKeyID != "" {
+			if c.sse != "aws:kms" {
+				return nil, errors.New(`an S3 KMS key can only be used with server-side encryption "aws:kms"`)
+			}
+			c.sseKMSKeyID = sys.S3ServerSideEncryptionKMSKeyID
+		}
+	}
+	if err := tlsclientconfig.SetupPolicy(sys, tr.TLSClientConfig); err != nil {
+		return nil, err
+	}
+	if err := c.setDefaultConfiguration(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// setDefaultConfiguration sets the region and credentials of c, if they were not set explicitly, the way AWS tools do:
+// from environment variables, the AWS shared configuration files, the container credentials provider,
+// or the EC2 instance metadata service.
+func (c *s3Client) setDefaultConfiguration() error {
+	if c.credentials == nil {
+		if accessKeyID, secretAccessKey := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); accessKeyID != "" && secretAccessKey != "" {
+			c.credentials = &types.S3Credentials{
+				AccessKeyID:     accessKeyID,
+				SecretAccessKey: secretAccessKey,
+				SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			}
+		}
+	}
+	if c.region == "" {
+		c.region = os.Getenv("AWS_REGION")
+	}
+	if c.region == "" {
+		c.region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if c.credentials == nil || c.region == "" {
+		shared, err := loadSharedConfig()
+		if err != nil {
+			return err
+		}
+		if c.credentials == nil {
+			c.credentials = shared.credentials
+		}
+		if c.region == "" {
+			c.region = shared.region
+		}
+	}
+	if c.credentials == nil {
+		c.remoteCredentials = containerCredentials()
+		if c.remoteCredentials == nil {
+			c.remoteCredentials = instanceCredentials()
+		}
+	}
+	if c.region == "" {
+		c.region = defaultRegion
+	}
+	return nil
+}
+
+// getCredentials returns the credentials to use for a request, or nil to send an anonymous request.
+func (c *s3Client) getCredentials(ctx context.Context) (*types.S3Credentials, error) {
+	if c.credentials != nil || c.remoteCredentials == nil {
+		return c.credentials, nil
+	}
+	return c.remoteCredentials.get(ctx, c.logger)
+}
+
+// close releases resources associated with c.
+func (c *s3Client) close() {
+	c.httpClient.CloseIdleConnections()
+}
+
+// s3Error is an error response from the object storage service.
+type s3Error struct {
+	statusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+}
+
+func (e *s3Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("S3 request failed with status %d (%s)", e.statusCode, http.StatusText(e.statusCode))
+	}
+	return fmt.Sprintf("S3 request failed with status %d: %s: %s", e.statusCode, e.Code, e.Message)
+}
+
+// Is allows classifying e using errors.Is(e, types.ErrNotFound) and the like.
+func (e *s3Error) Is(target error) bool {
+	if e.Code == "SlowDown" && target == types.ErrTooManyRequests {
+		return true
+	}
+	for _, kind := range errclass.HTTPStatusKinds(e.statusCode) {
+		if target == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// isNotFound returns true if err reports that an object does not exist.
+func isNotFound(err error) bool {
+	var e *s3Error
+	return errors.As(err, &e) && e.statusCode == http.StatusNotFound
+}
+
+// isPreconditionFailed returns true if err reports that a conditional write failed because the object was modified concurrently.
+func isPreconditionFailed(err error) bool {
+	var e *s3Error
+	return errors.As(err, &e) && (e.statusCode == http.StatusPreconditionFailed || e.statusCode == http.StatusConflict)
+}
+
+// objectURL returns the URL of the object with key, with query parameters.
+func (c *s3Client) objectURL(key string, query url.Values) *url.URL {
+	var u url.URL
+	if c.endpoint != nil {
+		u = *c.endpoint
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + c.bucket + "/" + key
+	} else {
+		u = url.URL{
+			Scheme: "https",
+			Host:   fmt.Sprintf("%s.s3.%s.amazonaws.com", c.bucket, c.region),
+			Path:   "/" + key,
+		}
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+	return &u
+}
+
+// request sends a request for the object with key, and returns the response if it is successful.
+// The caller must close the response body.
+func (c *s3Client) request(ctx context.Context, method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.objectURL(key, query).String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("User-Agent", useragent.DefaultUserAgent)
+	creds, err := c.getCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if creds != nil {
+		payloadHash := emptyPayloadHash
+		if len(body) != 0 {
+			sum := sha256.Sum256(body)
+			payloadHash = hex.EncodeToString(sum[:])
+		}
+		c.sign(req, creds, payloadHash, time.Now())
+	}
+
+	c.logger.Debugf("%s %s", method, req.URL.Redacted())
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer res.Body.Close()
+		return nil, parseErrorResponse(res)
+	}
+	return res, nil
+}
+
+// parseErrorResponse returns an *s3Error describing an unsuccessful response.
+func parseErrorResponse(res *http.Response) error {
+	e := &s3Error{statusCode: res.StatusCode}
+	if body, err := iolimits.ReadAtMost(res.Body, maxErrorBodySize); err == nil && len(body) != 0 {
+		_ = xml.Unmarshal(body, e) // The body is informative only; ignore responses which are not S3 error documents.
+	}
+	return e
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req, using creds, for a request body with payloadHash sent at now.
+func (c *s3Client) sign(req *http.Request, creds *types.S3Credentials, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	scope := amzDate[:8] + "/" + c.region + "/s3/aws4_request"
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	headers := map[string]string{"host": host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "user-agent" {
+			continue // Often modified by proxies, and not useful to sign.
+		}
+		trimmed := make([]string, 0, len(values))
+		for _, v := range values {
+			trimmed = append(trimmed, strings.Join(strings.Fields(v), " "))
+		}
+		headers[name] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), amzDate[:8])
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode encodes s as required by AWS Signature Version 4: all bytes except for unreserved characters are percent-encoded,
+// and so is '/' if encodeSlash.
+func uriEncode(s string, encodeSlash bool) string {
+	var res strings.Builder
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		switch {
+		case (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || b == '-' || b == '.' || b == '_' || b == '~':
+			res.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			res.WriteByte(b)
+		default:
+			fmt.Fprintf(&res, "%%%02X", b)
+		}
+	}
+	return res.String()
+}
+
+// canonicalQuery returns query in the canonical form used by AWS Signature Version 4.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := []string{}
+	for _, k := range keys {
+		values := append([]string{}, query[k]...)
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// objectHeader returns the headers to use when creating an object.
+func (c *s3Client) objectHeader() http.Header {
+	header := http.Header{}
+	if c.sse != "" {
+		header.Set("X-Amz-Server-Side-Encryption", c.sse)
+	}
+	if c.sseKMSKeyID != "" {
+		header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", c.sseKMSKeyID)
+	}
+	return header
+}
+
+// headObject returns the size of the object with key.
+func (c *s3Client) headObject(ctx context.Context, key string) (int64, error) {
+	res, err := c.request(ctx, http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return -1, err
+	}
+	res.Body.Close()
+	return res.ContentLength, nil
+}
+
+// getObject returns the contents of the object with key, its size (or -1 if unknown) and its ETag.
+// The caller must close the returned stream.
+func (c *s3Client) getObject(ctx context.Context, key string) (io.ReadCloser, int64, string, error) {
+	res, err := c.request(ctx, http.MethodGet, key, nil, nil, nil)
+	if err != nil {
+		return nil, -1, "", err
+	}
+	return res.Body, res.ContentLength, res.Header.Get("ETag"), nil
+}
+
+// putObject creates or replaces the object with key.
+// If ifMatch is not "", the object is only replaced if its ETag matches; "*" requires the object not to exist.
+func (c *s3Client) putObject(ctx context.Context, key string, data []byte, contentType, ifMatch string) error {
+	header := c.objectHeader()
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	switch ifMatch {
+	case "":
+	case "*":
+		header.Set("If-None-Match", "*")
+	default:
+		header.Set("If-Match", ifMatch)
+	}
+	res, err := c.request(ctx, http.MethodPut, key, nil, header, data)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// completedPart describes an uploaded part of a multipart upload.
+type completedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// putObjectFromStream creates or replaces the object with key, with the contents of stream, and returns its size.
+// expectedSize is the size of stream, or -1 if unknown; it is used to choose a part size large enough for a multipart upload
+// of the object, otherwise objects are limited to maxMultipartParts parts of multipartPartSize.
+// Objects larger than one part are uploaded using a multipart upload.
+// verify is called with the size of the data after stream is read to the end, before the object is created;
+// if it fails, the object is not created (or modified).
+func (c *s3Client) putObjectFromStream(ctx context.Context, key string, stream io.Reader, expectedSize int64, verify func(size int64) error) (int64, error) {
+	partSize := int64(multipartPartSize)
+	if expectedSize > partSize*int64(maxMultipartParts) {
+		partSize = (expectedSize + int64(maxMultipartParts) - 1) / int64(maxMultipartParts)
+		if partSize > maxMultipartPartSize {
+			return -1, fmt.Errorf("%q is too large to be uploaded, %d bytes", key, expectedSize)
+		}
+	}
+	buf := make([]byte, partSize)
+	n, err := io.ReadFull(stream, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		if err := verify(int64(n)); err != nil {
+			return -1, err
+		}
+		if err := c.putObject(ctx, key, buf[:n], "", ""); err != nil {
+			return -1, err
+		}
+		return int64(n), nil
+	}
+	if err != nil {
+		return -1, err
+	}
+
+	uploadID, err := c.createMultipartUpload(ctx, key)
+	if err != nil {
+		return -1, err
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			// Use a separate context, ctx may have been canceled.
+			if err := c.abortMultipartUpload(context.Background(), key, uploadID); err != nil {
+				c.logger.Debugf("Error aborting multipart upload of %q: %v", key, err)
+			}
+		}
+	}()
+	parts := []completedPart{}
+	size := int64(0)
+	eof := false
+	for {
+		if n > 0 {
+			if len(parts) == maxMultipartParts {
+				return -1, fmt.Errorf("%q is too large to be uploaded in %d parts of %d bytes", key, maxMultipartParts, partSize)
+			}
+			etag, err := c.uploadPart(ctx, key, uploadID, len(parts)+1, buf[:n])
+			if err != nil {
+				return -1, err
+			}
+			parts = append(parts, completedPart{PartNumber: len(parts) + 1, ETag: etag})
+			size += int64(n)
+		}
+		if eof {
+			break
+		}
+		n, err = io.ReadFull(stream, buf)
+		eof = err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !eof {
+			return -1, err
+		}
+	}
+	if err := verify(size); err != nil {
+		return -1, err
+	}
+	if err := c.completeMultipartUpload(ctx, key, uploadID, parts); err != nil {
+		return -1, err
+	}
+	succeeded = true
+	return size, nil
+}
+
+// createMultipartUpload starts a multipart upload of the object with key, and returns its ID.
+func (c *s3Client) createMultipartUpload(ctx context.Context, key string) (string, error) {
+	res, err := c.request(ctx, http.MethodPost, key, url.Values{"uploads": {""}}, c.objectHeader(), nil)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	body, err := iolimits.ReadAtMost(res.Body, maxErrorBodySize)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("parsing response to creating a multipart upload of %q: %w", key, err)
+	}
+	if result.UploadID == "" {
+		return "", fmt.Errorf("response to creating a multipart upload of %q does not contain an upload ID", key)
+	}
+	return result.UploadID, nil
+}
+
+// uploadPart uploads a part of a multipart upload, and returns its ETag.
+func (c *s3Client) uploadPart(ctx context.Context, key, uploadID string, partNumber int, data []byte) (string, error) {
+	res, err := c.request(ctx, http.MethodPut, key, url.Values{
+		"partNumber": {strconv.Itoa(partNumber)},
+		"uploadId":   {uploadID},
+	}, nil, data)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+	etag := res.Header.Get("ETag")
+	if etag == "" {
+		return "", fmt.Errorf("response to uploading part %d of %q does not contain an ETag", partNumber, key)
+	}
+	return etag, nil
+}
+
+// completeMultipartUpload creates the object with key from the uploaded parts.
+func (c *s3Client) completeMultipartUpload(ctx context.Context, key, uploadID string, parts []completedPart) error {
+	body, err := xml.Marshal(struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}{Parts: parts})
+	if err != nil {
+		return err
+	}
+	res, err := c.request(ctx, http.MethodPost, key, url.Values{"uploadId": {uploadID}}, http.Header{"Content-Type": {"application/xml"}}, body)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	// The request can fail even if the response status is 200 OK; in that case, the body contains an error document.
+	resBody, err := iolimits.ReadAtMost(res.Body, maxErrorBodySize)
+	if err != nil {
+		return err
+	}
+	var e s3Error
+	if xml.Unmarshal(resBody, &e) == nil && e.Code != "" {
+		e.statusCode = res.StatusCode
+		return &e
+	}
+	return nil
+}
+
+// abortMultipartUpload aborts a multipart upload, deleting the uploaded parts.
+func (c *s3Client) abortMultipartUpload(ctx context.Context, key, uploadID string) error {
+	res, err := c.request(ctx, http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
@@ -0,0 +1,311 @@
+package s3
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/types"
+	"github.com/containers/storage/pkg/homedir"
+)
+
+const (
+	defaultProfile = "default"
+	// containerCredentialsHost is the host used with $AWS_CONTAINER_CREDENTIALS_RELATIVE_URI, e.g. by Amazon ECS.
+	containerCredentialsHost = "http://169.254.170.2"
+	// defaultInstanceMetadataEndpoint is the endpoint of the EC2 instance metadata service.
+	defaultInstanceMetadataEndpoint = "http://169.254.169.254"
+	// instanceMetadataTimeout limits how long we wait for the instance metadata service, which does not exist outside of EC2.
+	instanceMetadataTimeout = 2 * time.Second
+	// credentialsRefreshMargin is how long before their expiration temporary credentials are refreshed.
+	credentialsRefreshMargin = 5 * time.Minute
+	// maxCredentialsResponseSize is the maximum size of a response from a credentials service.
+	maxCredentialsResponseSize = 64 * 1024
+)
+
+// sharedConfig is the configuration of a profile read from the AWS shared configuration and credentials files.
+type sharedConfig struct {
+	credentials *types.S3Credentials // nil if not configured
+	region      string               // "" if not configured
+}
+
+// loadSharedConfig returns the configuration of the profile selected by $AWS_PROFILE (or the default profile)
+// in the AWS shared credentials file ($AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials)
+// and configuration file ($AWS_CONFIG_FILE or ~/.aws/config).
+// Credentials in the credentials file take precedence over credentials in the configuration file.
+func loadSharedConfig() (sharedConfig, error) {
+	profile := os.Getenv("AWS_PROFILE")
+	explicitProfile := profile != ""
+	if !explicitProfile {
+		profile = defaultProfile
+	}
+	credentialsPath := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if credentialsPath == "" {
+		credentialsPath = filepath.Join(homedir.Get(), ".aws", "credentials")
+	}
+	configPath := os.Getenv("AWS_CONFIG_FILE")
+	if configPath == "" {
+		configPath = filepath.Join(homedir.Get(), ".aws", "config")
+	}
+
+	credentialsSection, credentialsFound, err := readSharedConfigSection(credentialsPath, profile)
+	if err != nil {
+		return sharedConfig{}, err
+	}
+	// The configuration file uses "[profile name]" sections, except for the default profile.
+	configSectionName := "profile " + profile
+	if profile == defaultProfile {
+		configSectionName = defaultProfile
+	}
+	configSection, configFound, err := readSharedConfigSection(configPath, configSectionName)
+	if err != nil {
+		return sharedConfig{}, err
+	}
+	if explicitProfile && !credentialsFound && !configFound {
+		return sharedConfig{}, fmt.Errorf("AWS profile %q not found in %q or %q", profile, credentialsPath, configPath)
+	}
+
+	res := sharedConfig{region: configSection["region"]}
+	for _, section := range []map[string]string{credentialsSection, configSection} {
+		if section["aws_access_key_id"] != "" && section["aws_secret_access_key"] != "" {
+			res.credentials = &types.S3Credentials{
+				AccessKeyID:     section["aws_access_key_id"],
+				SecretAccessKey: section["aws_secret_access_key"],
+				SessionToken:    section["aws_session_token"],
+			}
+			return res, nil
+		}
+	}
+	for _, section := range []map[string]string{credentialsSection, configSection} {
+		for _, key := range []string{"role_arn", "credential_process", "sso_session", "sso_start_url", "web_identity_token_file"} {
+			if section[key] != "" {
+				return sharedConfig{}, fmt.Errorf("AWS profile %q uses %s, which is not supported", profile, key)
+			}
+		}
+	}
+	return res, nil
+}
+
+// readSharedConfigSection returns the keys and values in section of the INI-formatted file at path,
+// and whether the section exists. A missing file is treated as empty.
+func readSharedConfigSection(path, section string) (map[string]string, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	defer f.Close()
+
+	res := map[string]string{}
+	found := false
+	inSection := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := strings.Join(strings.Fields(line[1:len(line)-1]), " ")
+			inSection = name == section
+			found = found || inSection
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue // E.g. a nested value of a key we don't use, like "s3 =" followed by indented lines.
+		}
+		res[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, false, fmt.Errorf("reading %q: %w", path, err)
+	}
+	return res, found, nil
+}
+
+// remoteCredentials are temporary credentials obtained from a service, e.g. the container credentials provider
+// or the EC2 instance metadata service, and refreshed before they expire.
+type remoteCredentials struct {
+	// fetch returns credentials and their expiration time (or the zero time if they don't expire).
+	fetch func(ctx context.Context) (*types.S3Credentials, time.Time, error)
+	// If optional, a failure to fetch the first credentials means that requests are sent anonymously.
+	optional bool
+
+	mu          sync.Mutex
+	cached      *types.S3Credentials
+	expiration  time.Time
+	unavailable bool // optional is set, and the first fetch failed
+}
+
+// get returns the current credentials, or nil if requests should be sent anonymously.
+func (r *remoteCredentials) get(ctx context.Context, logger types.Logger) (*types.S3Credentials, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.unavailable {
+		return nil, nil
+	}
+	if r.cached != nil && (r.expiration.IsZero() || time.Now().Add(credentialsRefreshMargin).Before(r.expiration)) {
+		return r.cached, nil
+	}
+	creds, expiration, err := r.fetch(ctx)
+	if err != nil {
+		if r.optional && r.cached == nil && ctx.Err() == nil {
+			logger.Debugf("No AWS credentials available, sending anonymous requests: %v", err)
+			r.unavailable = true
+			return nil, nil
+		}
+		return nil, fmt.Errorf("obtaining AWS credentials: %w", err)
+	}
+	r.cached, r.expiration = creds, expiration
+	return creds, nil
+}
+
+// credentialsResponse is the response of the container credentials provider and the EC2 instance metadata service.
+type credentialsResponse struct {
+	Code            string `json:"Code"` // Only returned by the instance metadata service
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+	Expiration      string `json:"Expiration"`
+}
+
+// credentialsHTTPClient is used to access credentials services on link-local addresses, which must not use a proxy.
+var credentialsHTTPClient = &http.Client{
+	Transport: &http.Transport{Proxy: nil},
+	Timeout:   instanceMetadataTimeout,
+}
+
+// credentialsServiceRequest sends a request to a credentials service, and returns the response body.
+func credentialsServiceRequest(ctx context.Context, method, url string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	res, err := credentialsHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s %s returned status %d (%s)", method, url, res.StatusCode, http.StatusText(res.StatusCode))
+	}
+	return iolimits.ReadAtMost(res.Body, maxCredentialsResponseSize)
+}
+
+// parseCredentialsResponse parses a response of a credentials service.
+func parseCredentialsResponse(body []byte) (*types.S3Credentials, time.Time, error) {
+	var res credentialsResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, time.Time{}, fmt.Errorf("parsing AWS credentials: %w", err)
+	}
+	if res.Code != "" && res.Code != "Success" {
+		return nil, time.Time{}, fmt.Errorf("AWS credentials not available: %s", res.Code)
+	}
+	if res.AccessKeyID == "" || res.SecretAccessKey == "" {
+		return nil, time.Time{}, errors.New("AWS credentials response does not contain a key")
+	}
+	var expiration time.Time
+	if res.Expiration != "" {
+		t, err := time.Parse(time.RFC3339, res.Expiration)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("parsing expiration of AWS credentials: %w", err)
+		}
+		expiration = t
+	}
+	return &types.S3Credentials{
+		AccessKeyID:     res.AccessKeyID,
+		SecretAccessKey: res.SecretAccessKey,
+		SessionToken:    res.Token,
+	}, expiration, nil
+}
+
+// containerCredentials returns remoteCredentials using the container credentials provider (e.g. of Amazon ECS or EKS Pod Identity),
+// or nil if it is not configured.
+func containerCredentials() *remoteCredentials {
+	url := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI")
+	if relativeURI := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relativeURI != "" {
+		url = containerCredentialsHost + relativeURI
+	}
+	if url == "" {
+		return nil
+	}
+	return &remoteCredentials{
+		fetch: func(ctx context.Context) (*types.S3Credentials, time.Time, error) {
+			header := http.Header{}
+			token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+			if tokenFile := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"); tokenFile != "" {
+				// Read the file every time, it may be rotated.
+				contents, err := os.ReadFile(tokenFile)
+				if err != nil {
+					return nil, time.Time{}, err
+				}
+				token = strings.TrimSpace(string(contents))
+			}
+			if token != "" {
+				header.Set("Authorization", token)
+			}
+			body, err := credentialsServiceRequest(ctx, http.MethodGet, url, header)
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			return parseCredentialsResponse(body)
+		},
+	}
+}
+
+// instanceCredentials returns remoteCredentials using the role of the EC2 instance, via the instance metadata service (IMDSv2),
+// or nil if that has been disabled using $AWS_EC2_METADATA_DISABLED.
+// If the service is not available, e.g. outside of EC2, requests are sent anonymously.
+func instanceCredentials() *remoteCredentials {
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return nil
+	}
+	endpoint := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+	if endpoint == "" {
+		endpoint = defaultInstanceMetadataEndpoint
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	return &remoteCredentials{
+		fetch: func(ctx context.Context) (*types.S3Credentials, time.Time, error) {
+			token, err := credentialsServiceRequest(ctx, http.MethodPut, endpoint+"/latest/api/token", http.Header{
+				"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {"300"},
+			})
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			header := http.Header{"X-Aws-Ec2-Metadata-Token": {string(token)}}
+			roles, err := credentialsServiceRequest(ctx, http.MethodGet, endpoint+"/latest/meta-data/iam/security-credentials/", header)
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			role, _, _ := strings.Cut(strings.TrimSpace(string(roles)), "\n")
+			if role == "" {
+				return nil, time.Time{}, errors.New("the EC2 instance has no IAM role")
+			}
+			body, err := credentialsServiceRequest(ctx, http.MethodGet, endpoint+"/latest/meta-data/iam/security-credentials/"+role, header)
+			if err != nil {
+				return nil, time.Time{}, err
+			}
+			return parseCredentialsResponse(body)
+		},
+		optional: true,
+	}
+}
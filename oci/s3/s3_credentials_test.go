@@ -0,0 +1,185 @@
+package s3
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSharedConfig(t *testing.T) {
+	isolateAWSEnvironment(t)
+	credentialsPath, configPath := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"), os.Getenv("AWS_CONFIG_FILE")
+
+	// No files
+	shared, err := loadSharedConfig()
+	require.NoError(t, err)
+	assert.Equal(t, sharedConfig{}, shared)
+
+	err = os.WriteFile(credentialsPath, []byte(`# A comment
+[default]
+aws_access_key_id = id
+aws_secret_access_key = secret
+
+[ other ]
+aws_access_key_id=id2
+aws_secret_access_key=secret2
+aws_session_token=token2
+`), 0o600)
+	require.NoError(t, err)
+	err = os.WriteFile(configPath, []byte(`[default]
+region = eu-west-1
+s3 =
+    max_concurrent_requests = 20
+
+[profile other]
+region = eu-north-1
+aws_access_key_id = ignored
+aws_secret_access_key = ignored
+
+[profile config-only]
+aws_access_key_id = id3
+aws_secret_access_key = secret3
+
+[profile assumed]
+role_arn = arn:aws:iam::123456789012:role/role
+source_profile = default
+`), 0o600)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		profile  string
+		expected sharedConfig
+	}{
+		{"", sharedConfig{credentials: &types.S3Credentials{AccessKeyID: "id", SecretAccessKey: "secret"}, region: "eu-west-1"}},
+		{"other", sharedConfig{credentials: &types.S3Credentials{AccessKeyID: "id2", SecretAccessKey: "secret2", SessionToken: "token2"}, region: "eu-north-1"}},
+		{"config-only", sharedConfig{credentials: &types.S3Credentials{AccessKeyID: "id3", SecretAccessKey: "secret3"}}},
+	} {
+		t.Setenv("AWS_PROFILE", c.profile)
+		shared, err := loadSharedConfig()
+		require.NoError(t, err, c.profile)
+		assert.Equal(t, c.expected, shared, c.profile)
+	}
+
+	// Unsupported or missing profiles
+	for _, profile := range []string{"assumed", "missing"} {
+		t.Setenv("AWS_PROFILE", profile)
+		_, err := loadSharedConfig()
+		assert.Error(t, err, profile)
+	}
+
+	// The shared configuration is used by newS3Client, unless overridden
+	t.Setenv("AWS_PROFILE", "other")
+	c, err := newS3Client(nil, "bucket")
+	require.NoError(t, err)
+	assert.Equal(t, "eu-north-1", c.region)
+	assert.Equal(t, &types.S3Credentials{AccessKeyID: "id2", SecretAccessKey: "secret2", SessionToken: "token2"}, c.credentials)
+	t.Setenv("AWS_REGION", "us-west-2")
+	t.Setenv("AWS_ACCESS_KEY_ID", "envID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "envSecret")
+	c, err = newS3Client(nil, "bucket")
+	require.NoError(t, err)
+	assert.Equal(t, "us-west-2", c.region)
+	assert.Equal(t, &types.S3Credentials{AccessKeyID: "envID", SecretAccessKey: "envSecret"}, c.credentials)
+}
+
+func TestContainerCredentials(t *testing.T) {
+	isolateAWSEnvironment(t)
+	requests := 0
+	expiration := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/creds" || r.Header.Get("Authorization") != "secret-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`{"AccessKeyId":"id","SecretAccessKey":"secret","Token":"token","Expiration":"` + expiration + `"}`))
+	}))
+	defer server.Close()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	err := os.WriteFile(tokenFile, []byte("secret-token\n"), 0o600)
+	require.NoError(t, err)
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", server.URL+"/creds")
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE", tokenFile)
+
+	c, err := newS3Client(nil, "bucket")
+	require.NoError(t, err)
+	assert.Nil(t, c.credentials)
+	require.NotNil(t, c.remoteCredentials)
+	for i := 0; i < 2; i++ { // The credentials are cached
+		creds, err := c.getCredentials(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, &types.S3Credentials{AccessKeyID: "id", SecretAccessKey: "secret", SessionToken: "token"}, creds)
+	}
+	assert.Equal(t, 1, requests)
+
+	// Credentials which are about to expire are refreshed
+	c.remoteCredentials.expiration = time.Now().Add(time.Minute)
+	_, err = c.getCredentials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests)
+
+	// A failure of an explicitly configured provider is reported
+	t.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE", "")
+	c, err = newS3Client(nil, "bucket")
+	require.NoError(t, err)
+	_, err = c.getCredentials(context.Background())
+	assert.Error(t, err)
+}
+
+func TestInstanceCredentials(t *testing.T) {
+	isolateAWSEnvironment(t)
+	hasRole := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut && r.URL.Path == "/latest/api/token" {
+			_, _ = w.Write([]byte("imds-token"))
+			return
+		}
+		if r.Method != http.MethodGet || r.Header.Get("X-Aws-Ec2-Metadata-Token") != "imds-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/" && hasRole:
+			_, _ = w.Write([]byte("role\n"))
+		case r.URL.Path == "/latest/meta-data/iam/security-credentials/role" && hasRole:
+			_, _ = w.Write([]byte(`{"Code":"Success","AccessKeyId":"id","SecretAccessKey":"secret","Token":"token","Expiration":"2100-01-01T00:00:00Z"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "")
+	t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", server.URL+"/")
+
+	c, err := newS3Client(nil, "bucket")
+	require.NoError(t, err)
+	creds, err := c.getCredentials(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, &types.S3Credentials{AccessKeyID: "id", SecretAccessKey: "secret", SessionToken: "token"}, creds)
+
+	// If the instance has no role, requests are anonymous
+	hasRole = false
+	c, err = newS3Client(nil, "bucket")
+	require.NoError(t, err)
+	creds, err = c.getCredentials(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, creds)
+
+	// The instance metadata service is not used if disabled, or if other credentials are available
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	c, err = newS3Client(nil, "bucket")
+	require.NoError(t, err)
+	assert.Nil(t, c.remoteCredentials)
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "")
+	c, err = newS3Client(&types.SystemContext{S3Credentials: &types.S3Credentials{AccessKeyID: "id2", SecretAccessKey: "secret2"}}, "bucket")
+	require.NoError(t, err)
+	assert.Nil(t, c.remoteCredentials)
+}
@@ -0,0 +1,262 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/containers/image/v5/internal/imagedestination/impl"
+	"github.com/containers/image/v5/internal/imagedestination/stubs"
+	"github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/streamdigest"
+	"github.com/containers/image/v5/oci/internal"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspec "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/exp/maps"
+)
+
+// maxIndexUpdateAttempts is the number of times Commit tries to update the index, if it is concurrently modified by other writers.
+const maxIndexUpdateAttempts = 5
+
+type s3ImageDestination struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	stubs.NoPutBlobPartialInitialize
+	stubs.NoSignaturesInitialize
+
+	ref       s3Reference
+	sys       *types.SystemContext
+	client    *s3Client
+	manifests []imgspecv1.Descriptor // Entries to add to the index on Commit, in order.
+}
+
+// newImageDestination returns an ImageDestination for writing an image to a layout in a bucket.
+// The layout is created if it does not exist.
+func newImageDestination(sys *types.SystemContext, ref s3Reference) (private.ImageDestination, error) {
+	selector, err := internal.ParseImageSelector(ref.image)
+	if err != nil {
+		return nil, err
+	}
+	if !selector.IsName() {
+		return nil, fmt.Errorf("can not write to an image selected by platform or annotation, %q; use an image name instead", ref.image)
+	}
+	client, err := newS3Client(sys, ref.bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &s3ImageDestination{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			SupportedManifestMIMETypes: []string{
+				imgspecv1.MediaTypeImageManifest,
+				imgspecv1.MediaTypeImageIndex,
+			},
+			DesiredLayerCompression:        types.Compress,
+			AcceptsForeignLayerURLs:        true,
+			MustMatchRuntimeOS:             false,
+			IgnoresEmbeddedDockerReference: false, // N/A, DockerReference() returns nil.
+			HasThreadSafePutBlob:           true,
+		}),
+		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
+		NoSignaturesInitialize:     stubs.NoSignatures("Storing signatures in s3: layouts is not supported"),
+
+		ref:    ref,
+		sys:    sys,
+		client: client,
+	}
+	d.Compat = impl.AddCompat(d)
+	return d, nil
+}
+
+// Reference returns the reference used to set up this destination.  Note that this should directly correspond to user's intent,
+// e.g. it should use the public hostname instead of the result of resolving CNAMEs or following redirects.
+func (d *s3ImageDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// Close removes resources associated with an initialized ImageDestination, if any.
+func (d *s3ImageDestination) Close() error {
+	d.client.close()
+	return nil
+}
+
+// PutBlobWithOptions writes contents of stream and returns data representing the result.
+// inputInfo.Digest can be optionally provided if known; if provided, and stream is read to the end without error, the digest MUST match the stream contents.
+// inputInfo.Size is the expected length of stream, if known.
+// inputInfo.MediaType describes the blob format, if known.
+// WARNING: The contents of stream are being verified on the fly.  Until stream.Read() returns io.EOF, the contents of the data SHOULD NOT be available
+// to any other readers for download using the supplied digest.
+// If stream.Read() at any time, ESPECIALLY at end of input, returns an error, PutBlobWithOptions MUST 1) fail, and 2) delete any data stored so far.
+func (d *s3ImageDestination) PutBlobWithOptions(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, options private.PutBlobOptions) (private.UploadedBlob, error) {
+	// The object key depends on the digest, so if it is not known, compute it first.
+	if inputInfo.Digest == "" {
+		d.client.logger.Debugf("s3: input with unknown digest, streaming to disk first ...")
+		streamCopy, cleanup, err := streamdigest.ComputeBlobInfo(d.sys, stream, &inputInfo)
+		if err != nil {
+			return private.UploadedBlob{}, err
+		}
+		defer cleanup()
+		stream = streamCopy
+		d.client.logger.Debugf("... streaming done")
+	}
+	key, err := d.ref.blobKey(inputInfo.Digest)
+	if err != nil {
+		return private.UploadedBlob{}, err
+	}
+
+	// The object only becomes visible after the digest is verified.
+	digester := inputInfo.Digest.Algorithm().Digester()
+	size, err := d.client.putObjectFromStream(ctx, key, io.TeeReader(stream, digester.Hash()), inputInfo.Size, func(size int64) error {
+		if inputInfo.Size != -1 && size != inputInfo.Size {
+			return fmt.Errorf("Size mismatch when copying %s, expected %d, got %d", inputInfo.Digest, inputInfo.Size, size)
+		}
+		if digester.Digest() != inputInfo.Digest {
+			return fmt.Errorf("Digest mismatch when copying %s, got %s", inputInfo.Digest, digester.Digest())
+		}
+		return nil
+	})
+	if err != nil {
+		return private.UploadedBlob{}, fmt.Errorf("writing blob %s to s3:%s: %w", inputInfo.Digest, d.ref.StringWithinTransport(), err)
+	}
+	return private.UploadedBlob{Digest: inputInfo.Digest, Size: size}, nil
+}
+
+// TryReusingBlobWithOptions checks whether the transport already contains, or can efficiently reuse, a blob, and if so, applies it to the current destination
+// (e.g. if the blob is a filesystem layer, this signifies that the changes it describes need to be applied again when composing a filesystem tree).
+// info.Digest must not be empty.
+// If the blob has been successfully reused, returns (true, info, nil).
+// If the transport can not reuse the requested blob, TryReusingBlob returns (false, {}, nil); it returns a non-nil error only on an unexpected failure.
+func (d *s3ImageDestination) TryReusingBlobWithOptions(ctx context.Context, info types.BlobInfo, options private.TryReusingBlobOptions) (bool, private.ReusedBlob, error) {
+	if !impl.OriginalBlobMatchesRequiredCompression(options) {
+		return false, private.ReusedBlob{}, nil
+	}
+	if info.Digest == "" {
+		return false, private.ReusedBlob{}, errors.New("Can not check for a blob with unknown digest")
+	}
+	key, err := d.ref.blobKey(info.Digest)
+	if err != nil {
+		return false, private.ReusedBlob{}, err
+	}
+	size, err := d.client.headObject(ctx, key)
+	if err != nil {
+		if isNotFound(err) {
+			return false, private.ReusedBlob{}, nil
+		}
+		return false, private.ReusedBlob{}, fmt.Errorf("checking for blob %s in s3:%s: %w", info.Digest, d.ref.StringWithinTransport(), err)
+	}
+	return true, private.ReusedBlob{Digest: info.Digest, Size: size}, nil
+}
+
+// PutManifest writes a manifest to the destination.  Per our list of supported manifest MIME types,
+// this should be either an OCI manifest (possibly converted to this format by the caller) or index,
+// neither of which we'll need to modify further.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to overwrite the manifest for
+// (when the primary manifest is a manifest list); this should always be nil if the primary manifest is not a manifest list.
+// It is expected but not enforced that the instanceDigest, when specified, matches the digest of `manifest` as generated
+// by `manifest.Digest()`.
+// FIXME? This should also receive a MIME type if known, to differentiate between schema versions.
+// If the destination is in principle available, refuses this manifest type (e.g. it does not recognize the schema),
+// but may accept a different manifest type, the returned error must be an ManifestTypeRejectedError.
+func (d *s3ImageDestination) PutManifest(ctx context.Context, m []byte, instanceDigest *digest.Digest) error {
+	var manifestDigest digest.Digest
+	if instanceDigest != nil {
+		manifestDigest = *instanceDigest
+	} else {
+		var err error
+		manifestDigest, err = manifest.Digest(m)
+		if err != nil {
+			return err
+		}
+	}
+	mimeType := manifest.GuessMIMEType(m)
+
+	key, err := d.ref.blobKey(manifestDigest)
+	if err != nil {
+		return err
+	}
+	if err := d.client.putObject(ctx, key, m, mimeType, ""); err != nil {
+		return fmt.Errorf("writing manifest %s to s3:%s: %w", manifestDigest, d.ref.StringWithinTransport(), err)
+	}
+
+	if instanceDigest != nil {
+		return nil
+	}
+	desc := imgspecv1.Descriptor{
+		MediaType: mimeType,
+		Digest:    manifestDigest,
+		Size:      int64(len(m)),
+	}
+	if d.ref.image != "" {
+		desc.Annotations = map[string]string{imgspecv1.AnnotationRefName: d.ref.image}
+	}
+	d.manifests = append(d.manifests, desc)
+	return nil
+}
+
+// Commit marks the process of storing the image as successful and asks for the image to be persisted.
+// unparsedToplevel contains data about the top-level manifest of the source (which may be a single-arch image or a manifest list
+// if PutManifest was only called for the single-arch image with instanceDigest == nil), primarily to allow lookups by the
+// original manifest list digest, if desired.
+// WARNING: This does not have any transactional semantics:
+// - Uploaded data MAY be visible to others before Commit() is called
+// - Uploaded data MAY be removed or MAY remain around if Close() is called without Commit() (i.e. rollback is allowed but not guaranteed)
+func (d *s3ImageDestination) Commit(ctx context.Context, unparsedToplevel types.UnparsedImage) error {
+	// Object storage has no locks; use conditional writes to detect concurrent updates of the index, and retry.
+	for attempt := 1; ; attempt++ {
+		err := d.updateIndex(ctx)
+		if err == nil {
+			return nil
+		}
+		if !isPreconditionFailed(err) || attempt >= maxIndexUpdateAttempts {
+			return err
+		}
+		d.client.logger.Debugf("Index of s3:%s was modified concurrently, retrying: %v", d.ref.StringWithinTransport(), err)
+	}
+}
+
+// updateIndex adds d.manifests to the index of the layout, creating the layout if it does not exist.
+func (d *s3ImageDestination) updateIndex(ctx context.Context) error {
+	index, etag, err := getIndex(ctx, d.client, d.ref)
+	ifMatch := etag // If the server does not return ETags, the index is updated unconditionally.
+	if err != nil {
+		if !isNotFound(err) {
+			return err
+		}
+		index = &imgspecv1.Index{
+			Versioned: imgspec.Versioned{
+				SchemaVersion: 2,
+			},
+			MediaType:   imgspecv1.MediaTypeImageIndex,
+			Annotations: make(map[string]string),
+		}
+		ifMatch = "*"
+
+		layoutBytes, err := json.Marshal(imgspecv1.ImageLayout{
+			Version: imgspecv1.ImageLayoutVersion,
+		})
+		if err != nil {
+			return err
+		}
+		if err := d.client.putObject(ctx, d.ref.ociLayoutKey(), layoutBytes, "", ""); err != nil {
+			return fmt.Errorf("writing oci-layout of s3:%s: %w", d.ref.StringWithinTransport(), err)
+		}
+	}
+	for _, desc := range d.manifests {
+		// AddManifest may modify annotations of entries already in the index, so don’t let it modify d.manifests, which we might need to retry.
+		desc.Annotations = maps.Clone(desc.Annotations)
+		internal.AddManifest(index, &desc)
+	}
+	indexJSON, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err := d.client.putObject(ctx, d.ref.indexKey(), indexJSON, imgspecv1.MediaTypeImageIndex, ifMatch); err != nil {
+		return fmt.Errorf("writing index of s3:%s: %w", d.ref.StringWithinTransport(), err)
+	}
+	return nil
+}
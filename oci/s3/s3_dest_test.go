@@ -0,0 +1,330 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspec "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 is an in-memory implementation of the subset of the S3 API used by this transport.
+type fakeS3 struct {
+	mu               sync.Mutex
+	objects          map[string][]byte         // Keyed by bucket/key
+	encryption       map[string]string         // Value of the server-side encryption header used when creating an object
+	uploads          map[string]map[int][]byte // Parts of multipart uploads in progress, keyed by upload ID
+	nextUploadID     int
+	failConditionals int // Number of conditional writes which should fail, simulating a concurrent modification
+}
+
+func newFakeS3() *fakeS3 {
+	return &fakeS3{
+		objects:    map[string][]byte{},
+		encryption: map[string]string{},
+		uploads:    map[string]map[int][]byte{},
+	}
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		writeS3Error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, "/")
+	query := r.URL.Query()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeS3Error(w, http.StatusBadRequest, "IncompleteBody")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := strconv.Itoa(f.nextUploadID)
+		f.nextUploadID++
+		f.uploads[id] = map[int][]byte{}
+		f.encryption[key] = r.Header.Get("X-Amz-Server-Side-Encryption")
+		fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		parts, ok := f.uploads[query.Get("uploadId")]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		partNumber, err := strconv.Atoi(query.Get("partNumber"))
+		if err != nil {
+			writeS3Error(w, http.StatusBadRequest, "InvalidArgument")
+			return
+		}
+		parts[partNumber] = body
+		w.Header().Set("ETag", etag(body))
+
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		id := query.Get("uploadId")
+		parts, ok := f.uploads[id]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchUpload")
+			return
+		}
+		var complete struct {
+			Parts []completedPart `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &complete); err != nil {
+			writeS3Error(w, http.StatusBadRequest, "MalformedXML")
+			return
+		}
+		data := []byte{}
+		for i, part := range complete.Parts {
+			if part.PartNumber != i+1 || part.ETag != etag(parts[part.PartNumber]) {
+				// Amazon S3 reports some errors in a 200 OK response.
+				fmt.Fprint(w, "<Error><Code>InvalidPart</Code><Message>InvalidPart</Message></Error>")
+				return
+			}
+			data = append(data, parts[part.PartNumber]...)
+		}
+		f.objects[key] = data
+		delete(f.uploads, id)
+		fmt.Fprint(w, "<CompleteMultipartUploadResult></CompleteMultipartUploadResult>")
+
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+
+	case r.Method == http.MethodPut:
+		existing, exists := f.objects[key]
+		ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+		if ifMatch != "" || ifNoneMatch != "" {
+			if f.failConditionals > 0 {
+				f.failConditionals--
+				writeS3Error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+				return
+			}
+			if (ifMatch != "" && (!exists || ifMatch != etag(existing))) || (ifNoneMatch == "*" && exists) {
+				writeS3Error(w, http.StatusPreconditionFailed, "PreconditionFailed")
+				return
+			}
+		}
+		f.objects[key] = body
+		f.encryption[key] = r.Header.Get("X-Amz-Server-Side-Encryption")
+		w.Header().Set("ETag", etag(body))
+
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		data, ok := f.objects[key]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("ETag", etag(data))
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(data)
+		}
+
+	default:
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// withSmallParts makes multipart uploads use small parts for the duration of the test.
+func withSmallParts(t *testing.T) {
+	saved := multipartPartSize
+	multipartPartSize = 1024
+	t.Cleanup(func() { multipartPartSize = saved })
+}
+
+func randomBlob(t *testing.T, size int) ([]byte, digest.Digest) {
+	data := make([]byte, size)
+	_, err := rand.Read(data)
+	require.NoError(t, err)
+	return data, digest.FromBytes(data)
+}
+
+func TestS3RoundTrip(t *testing.T) {
+	isolateAWSEnvironment(t)
+	withSmallParts(t)
+	ctx := context.Background()
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	sys := &types.SystemContext{
+		S3Endpoint:             server.URL,
+		S3Credentials:          &types.S3Credentials{AccessKeyID: "id", SecretAccessKey: "secret"},
+		S3ServerSideEncryption: "AES256",
+	}
+
+	ref, err := ParseReference("//bucket/layout:img")
+	require.NoError(t, err)
+	dest, err := ref.NewImageDestination(ctx, sys)
+	require.NoError(t, err)
+	defer dest.Close()
+
+	// A small blob, and a blob uploaded using a multipart upload.
+	config := []byte(`{"architecture":"amd64","os":"linux"}`)
+	configDigest := digest.FromBytes(config)
+	info, err := dest.PutBlob(ctx, bytes.NewReader(config), types.BlobInfo{Digest: configDigest, Size: int64(len(config))}, none.NoCache, true)
+	require.NoError(t, err)
+	assert.Equal(t, types.BlobInfo{Digest: configDigest, Size: int64(len(config))}, info)
+	layer, layerDigest := randomBlob(t, 2*multipartPartSize+100)
+	info, err = dest.PutBlob(ctx, bytes.NewReader(layer), types.BlobInfo{Digest: layerDigest, Size: -1}, none.NoCache, false)
+	require.NoError(t, err)
+	assert.Equal(t, types.BlobInfo{Digest: layerDigest, Size: int64(len(layer))}, info)
+	assert.Equal(t, layer, fake.objects["bucket/layout/blobs/sha256/"+layerDigest.Encoded()])
+	assert.Equal(t, "AES256", fake.encryption["bucket/layout/blobs/sha256/"+layerDigest.Encoded()])
+
+	// A blob with an unknown digest.
+	unknown, unknownDigest := randomBlob(t, multipartPartSize+1)
+	info, err = dest.PutBlob(ctx, bytes.NewReader(unknown), types.BlobInfo{Digest: "", Size: -1}, none.NoCache, false)
+	require.NoError(t, err)
+	assert.Equal(t, types.BlobInfo{Digest: unknownDigest, Size: int64(len(unknown))}, info)
+
+	// Blobs with an unexpected digest or size are not stored, and multipart uploads are aborted.
+	_, wrongDigest := randomBlob(t, 10)
+	for _, c := range []struct {
+		data []byte
+		info types.BlobInfo
+	}{
+		{config, types.BlobInfo{Digest: wrongDigest, Size: -1}},
+		{layer, types.BlobInfo{Digest: wrongDigest, Size: -1}},
+		{layer, types.BlobInfo{Digest: layerDigest, Size: 1}},
+	} {
+		_, err = dest.PutBlob(ctx, bytes.NewReader(c.data), c.info, none.NoCache, false)
+		assert.Error(t, err)
+	}
+	assert.NotContains(t, fake.objects, "bucket/layout/blobs/sha256/"+wrongDigest.Encoded())
+	assert.Empty(t, fake.uploads)
+
+	reused, reusedInfo, err := dest.TryReusingBlob(ctx, types.BlobInfo{Digest: layerDigest, Size: -1}, none.NoCache, false)
+	require.NoError(t, err)
+	assert.True(t, reused)
+	assert.Equal(t, types.BlobInfo{Digest: layerDigest, Size: int64(len(layer))}, reusedInfo)
+	reused, _, err = dest.TryReusingBlob(ctx, types.BlobInfo{Digest: wrongDigest, Size: -1}, none.NoCache, false)
+	require.NoError(t, err)
+	assert.False(t, reused)
+
+	man := imgspecv1.Manifest{
+		Versioned: imgspec.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Config:    imgspecv1.Descriptor{MediaType: imgspecv1.MediaTypeImageConfig, Digest: configDigest, Size: int64(len(config))},
+		Layers:    []imgspecv1.Descriptor{{MediaType: imgspecv1.MediaTypeImageLayerGzip, Digest: layerDigest, Size: int64(len(layer))}},
+	}
+	manifestBlob, err := json.Marshal(man)
+	require.NoError(t, err)
+	err = dest.PutManifest(ctx, manifestBlob, nil)
+	require.NoError(t, err)
+	err = dest.Commit(ctx, nil)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"imageLayoutVersion":"1.0.0"}`, string(fake.objects["bucket/layout/oci-layout"]))
+
+	src, err := ref.NewImageSource(ctx, sys)
+	require.NoError(t, err)
+	defer src.Close()
+	m, mimeType, err := src.GetManifest(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, manifestBlob, m)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, mimeType)
+	stream, size, err := src.GetBlob(ctx, types.BlobInfo{Digest: layerDigest, Size: -1}, none.NoCache)
+	require.NoError(t, err)
+	data, err := io.ReadAll(stream)
+	stream.Close()
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(layer)), size)
+	assert.Equal(t, layer, data)
+	_, _, err = src.GetBlob(ctx, types.BlobInfo{Digest: wrongDigest, Size: -1}, none.NoCache)
+	assert.Error(t, err)
+
+	// Another image is added to the index, even if the index is modified concurrently.
+	ref2, err := ParseReference("//bucket/layout:img2")
+	require.NoError(t, err)
+	dest2, err := ref2.NewImageDestination(ctx, sys)
+	require.NoError(t, err)
+	defer dest2.Close()
+	err = dest2.PutManifest(ctx, manifestBlob, nil)
+	require.NoError(t, err)
+	fake.failConditionals = 2
+	err = dest2.Commit(ctx, nil)
+	require.NoError(t, err)
+	var index imgspecv1.Index
+	err = json.Unmarshal(fake.objects["bucket/layout/index.json"], &index)
+	require.NoError(t, err)
+	require.Len(t, index.Manifests, 2)
+	assert.Equal(t, "img", index.Manifests[0].Annotations[imgspecv1.AnnotationRefName])
+	assert.Equal(t, "img2", index.Manifests[1].Annotations[imgspecv1.AnnotationRefName])
+
+	// Commit fails if the index is modified concurrently too often.
+	fake.failConditionals = maxIndexUpdateAttempts
+	err = dest2.Commit(ctx, nil)
+	assert.Error(t, err)
+	fake.failConditionals = 0
+
+	// Reading a nonexistent layout fails.
+	ref3, err := ParseReference("//bucket/other")
+	require.NoError(t, err)
+	_, err = ref3.NewImageSource(ctx, sys)
+	assert.Error(t, err)
+}
+
+func TestPutObjectFromStreamPartLimit(t *testing.T) {
+	isolateAWSEnvironment(t)
+	withSmallParts(t)
+	saved := maxMultipartParts
+	maxMultipartParts = 2
+	t.Cleanup(func() { maxMultipartParts = saved })
+	ctx := context.Background()
+	fake := newFakeS3()
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	c, err := newS3Client(&types.SystemContext{
+		S3Endpoint:    server.URL,
+		S3Credentials: &types.S3Credentials{AccessKeyID: "id", SecretAccessKey: "secret"},
+	}, "bucket")
+	require.NoError(t, err)
+	noVerify := func(size int64) error { return nil }
+
+	data, _ := randomBlob(t, 3*multipartPartSize)
+	// With an unknown size, the default part size is used, and the upload fails.
+	_, err = c.putObjectFromStream(ctx, "unknown", bytes.NewReader(data), -1, noVerify)
+	assert.Error(t, err)
+	assert.NotContains(t, fake.objects, "bucket/unknown")
+	assert.Empty(t, fake.uploads)
+	// With a known size, large enough parts are used.
+	size, err := c.putObjectFromStream(ctx, "known", bytes.NewReader(data), int64(len(data)), noVerify)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(data)), size)
+	assert.Equal(t, data, fake.objects["bucket/known"])
+	// Objects which can't be uploaded even using the largest parts are rejected early.
+	_, err = c.putObjectFromStream(ctx, "huge", bytes.NewReader(data), 2*maxMultipartPartSize+1, noVerify)
+	assert.Error(t, err)
+}
@@ -0,0 +1,171 @@
+package s3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/containers/image/v5/internal/imagesource/impl"
+	"github.com/containers/image/v5/internal/imagesource/stubs"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/oci/internal"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type s3ImageSource struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	impl.NoSignatures
+	impl.DoesNotAffectLayerInfosForCopy
+	stubs.NoGetBlobAtInitialize
+
+	ref        s3Reference
+	client     *s3Client
+	index      *imgspecv1.Index
+	descriptor imgspecv1.Descriptor
+}
+
+// newImageSource returns an ImageSource for reading an image from a layout in a bucket.
+func newImageSource(ctx context.Context, sys *types.SystemContext, ref s3Reference) (private.ImageSource, error) {
+	client, err := newS3Client(sys, ref.bucket)
+	if err != nil {
+		return nil, err
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			client.close()
+		}
+	}()
+
+	index, _, err := getIndex(ctx, client, ref)
+	if err != nil {
+		return nil, err
+	}
+	descriptor, _, err := internal.ChooseManifestDescriptor(index, ref.image, func(desc imgspecv1.Descriptor) (*imgspecv1.Index, error) {
+		blob, err := getJSONBlob(ctx, client, ref, desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+		var nested imgspecv1.Index
+		if err := json.Unmarshal(blob, &nested); err != nil {
+			return nil, fmt.Errorf("parsing image index %s: %w", desc.Digest, err)
+		}
+		return &nested, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("choosing an image in s3:%s: %w", ref.StringWithinTransport(), err)
+	}
+
+	s := &s3ImageSource{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			HasThreadSafeGetBlob: true,
+		}),
+		NoGetBlobAtInitialize: stubs.NoGetBlobAt(ref),
+
+		ref:        ref,
+		client:     client,
+		index:      index,
+		descriptor: descriptor,
+	}
+	s.Compat = impl.AddCompat(s)
+	succeeded = true
+	return s, nil
+}
+
+// getIndex returns the index of the layout at ref, and its ETag.
+func getIndex(ctx context.Context, client *s3Client, ref s3Reference) (*imgspecv1.Index, string, error) {
+	stream, _, etag, err := client.getObject(ctx, ref.indexKey())
+	if err != nil {
+		return nil, "", fmt.Errorf("reading index of s3:%s: %w", ref.StringWithinTransport(), err)
+	}
+	defer stream.Close()
+	blob, err := iolimits.ReadAtMost(stream, client.manifestSizeLimit)
+	if err != nil {
+		return nil, "", fmt.Errorf("reading index of s3:%s: %w", ref.StringWithinTransport(), err)
+	}
+	var index imgspecv1.Index
+	if err := json.Unmarshal(blob, &index); err != nil {
+		return nil, "", fmt.Errorf("parsing index of s3:%s: %w", ref.StringWithinTransport(), err)
+	}
+	return &index, etag, nil
+}
+
+// getJSONBlob returns the contents of a manifest-sized blob at ref, e.g. a manifest.
+func getJSONBlob(ctx context.Context, client *s3Client, ref s3Reference, d digest.Digest) ([]byte, error) {
+	key, err := ref.blobKey(d)
+	if err != nil {
+		return nil, err
+	}
+	stream, _, _, err := client.getObject(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("reading blob %s: %w", d, err)
+	}
+	defer stream.Close()
+	blob, err := iolimits.ReadAtMost(stream, client.manifestSizeLimit)
+	if err != nil {
+		return nil, fmt.Errorf("reading blob %s: %w", d, err)
+	}
+	return blob, nil
+}
+
+// Reference returns the reference used to set up this source.
+func (s *s3ImageSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// Close removes resources associated with an initialized ImageSource, if any.
+func (s *s3ImageSource) Close() error {
+	s.client.close()
+	return nil
+}
+
+// GetManifest returns the image's manifest along with its MIME type (which may be empty when it can't be determined but the manifest is available).
+// It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve (when the primary manifest is a manifest list);
+// this never happens if the primary manifest is not a manifest list (e.g. if the source never returns manifest lists).
+func (s *s3ImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	var dig digest.Digest
+	var mimeType string
+	if instanceDigest == nil {
+		dig = s.descriptor.Digest
+		mimeType = s.descriptor.MediaType
+	} else {
+		dig = *instanceDigest
+		for _, md := range s.index.Manifests {
+			if md.Digest == dig {
+				mimeType = md.MediaType
+				break
+			}
+		}
+	}
+
+	m, err := getJSONBlob(ctx, s.client, s.ref, dig)
+	if err != nil {
+		return nil, "", err
+	}
+	if mimeType == "" {
+		mimeType = manifest.GuessMIMEType(m)
+	}
+	return m, mimeType, nil
+}
+
+// GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
+// The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
+// May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
+func (s *s3ImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	key, err := s.ref.blobKey(info.Digest)
+	if err != nil {
+		return nil, -1, err
+	}
+	stream, size, _, err := s.client.getObject(ctx, key)
+	if err != nil {
+		return nil, -1, fmt.Errorf("reading blob %s: %w", info.Digest, err)
+	}
+	return stream, size, nil
+}
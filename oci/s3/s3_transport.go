@@ -0,0 +1,240 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/oci/internal"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+func init() {
+	transports.Register(Transport)
+}
+
+// Transport is an ImageTransport for OCI layouts stored in an S3-compatible object storage bucket.
+// Other object storage services can be used only if they implement the S3 API, e.g. Google Cloud Storage.
+var Transport = s3Transport{}
+
+type s3Transport struct{}
+
+// Name returns the name of the transport, which must be unique among other transports.
+func (t s3Transport) Name() string {
+	return "s3"
+}
+
+// ParseReference converts a string, which should not start with the ImageTransport.Name prefix, into an ImageReference.
+func (t s3Transport) ParseReference(reference string) (types.ImageReference, error) {
+	return ParseReference(reference)
+}
+
+// ValidatePolicyConfigurationScope checks that scope is a valid name for a signature.PolicyTransportScopes keys
+// (i.e. a valid PolicyConfigurationIdentity() or PolicyConfigurationNamespaces() return value).
+// It is acceptable to allow an invalid value which will never be matched, it can "only" cause user confusion.
+// scope passed to this function will not be "", that value is always allowed.
+func (t s3Transport) ValidatePolicyConfigurationScope(scope string) error {
+	bucket, prefix, hasPrefix := strings.Cut(scope, "/")
+	if err := validateBucket(bucket); err != nil {
+		return fmt.Errorf("Invalid scope %q: %w", scope, err)
+	}
+	if hasPrefix && prefix == "" {
+		return fmt.Errorf("Invalid scope %q: must not end with /", scope)
+	}
+	if err := validatePrefix(prefix); err != nil {
+		return fmt.Errorf("Invalid scope %q: %w", scope, err)
+	}
+	return nil
+}
+
+// s3Reference is an ImageReference for an OCI layout stored in an object storage bucket.
+type s3Reference struct {
+	bucket string
+	prefix string // The key prefix of the layout within bucket, without leading or trailing slashes; "" if the layout is at the root of the bucket.
+	// If image=="", it means the "only image" in the index.json is used in the case it is a source
+	// for destinations, the image name annotation "image.ref.name" is not added to the index.json
+	image string
+}
+
+// ParseReference converts a string, which should not start with the ImageTransport.Name prefix, into an s3 ImageReference.
+// The expected format is //bucket[/prefix][:image].
+func ParseReference(reference string) (types.ImageReference, error) {
+	if !strings.HasPrefix(reference, "//") {
+		return nil, fmt.Errorf("s3: reference %q does not start with //", reference)
+	}
+	location, image, _ := strings.Cut(strings.TrimPrefix(reference, "//"), ":")
+	bucket, prefix, hasPrefix := strings.Cut(location, "/")
+	if hasPrefix && prefix == "" {
+		return nil, fmt.Errorf("s3: reference %q: the layout location must not end with /", reference)
+	}
+	return NewReference(bucket, prefix, image)
+}
+
+// NewReference returns an s3 reference for a layout at prefix in bucket (or at the root of bucket, if prefix is ""), and an image.
+func NewReference(bucket, prefix, image string) (types.ImageReference, error) {
+	if err := validateBucket(bucket); err != nil {
+		return nil, err
+	}
+	if err := validatePrefix(prefix); err != nil {
+		return nil, err
+	}
+	if _, err := internal.ParseImageSelector(image); err != nil {
+		return nil, err
+	}
+	return s3Reference{bucket: bucket, prefix: prefix, image: image}, nil
+}
+
+// bucketRegexp matches valid bucket names; this is a bit more permissive than Amazon S3, to allow for other implementations.
+var bucketRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{1,61}[a-z0-9]$`)
+
+// validateBucket returns an error if bucket is not a valid bucket name.
+func validateBucket(bucket string) error {
+	if !bucketRegexp.MatchString(bucket) {
+		return fmt.Errorf("Invalid bucket name %q", bucket)
+	}
+	return nil
+}
+
+// validatePrefix returns an error if prefix is not a valid location of a layout within a bucket.
+func validatePrefix(prefix string) error {
+	if prefix == "" {
+		return nil
+	}
+	if strings.Contains(prefix, ":") {
+		return fmt.Errorf("Invalid layout location %q: must not contain ':'", prefix)
+	}
+	for _, component := range strings.Split(prefix, "/") {
+		if component == "" || component == "." || component == ".." {
+			return fmt.Errorf("Invalid layout location %q: must be a sequence of non-empty path components other than . and ..", prefix)
+		}
+	}
+	return nil
+}
+
+func (ref s3Reference) Transport() types.ImageTransport {
+	return Transport
+}
+
+// StringWithinTransport returns a string representation of the reference, which MUST be such that
+// reference.Transport().ParseReference(reference.StringWithinTransport()) returns an equivalent reference.
+// NOTE: The returned string is not promised to be equal to the original input to ParseReference;
+// e.g. default attribute values omitted by the user may be filled in the return value, or vice versa.
+// WARNING: Do not use the return value in the UI to describe an image, it does not contain the Transport().Name() prefix.
+func (ref s3Reference) StringWithinTransport() string {
+	res := "//" + ref.location()
+	if ref.image != "" {
+		res += ":" + ref.image
+	}
+	return res
+}
+
+// DockerReference returns a Docker reference associated with this reference
+// (fully explicit, i.e. !reference.IsNameOnly, but reflecting user intent,
+// not e.g. after redirect or alias processing), or nil if unknown/not applicable.
+func (ref s3Reference) DockerReference() reference.Named {
+	return nil
+}
+
+// ImageName returns the name of the image within the OCI layout, as specified by the user, or "" if not specified.
+// This implements private.ImageNameAccessor.
+func (ref s3Reference) ImageName() string {
+	return ref.image
+}
+
+// PolicyConfigurationIdentity returns a string representation of the reference, suitable for policy lookup.
+// This MUST reflect user intent, not e.g. after processing of third-party redirects or aliases;
+// The value SHOULD be fully explicit about its semantics, with no hidden defaults, AND canonical
+// (i.e. various references with exactly the same semantics should return the same configuration identity)
+// It is fine for the return value to be equal to StringWithinTransport(), and it is desirable but
+// not required/guaranteed that it will be a valid input to Transport().ParseReference().
+// Returns "" if configuration identities for these references are not supported.
+func (ref s3Reference) PolicyConfigurationIdentity() string {
+	// NOTE: ref.image is not a part of the image identity, for the same reasons as in the oci: transport.
+	return ref.location()
+}
+
+// PolicyConfigurationNamespaces returns a list of other policy configuration namespaces to search
+// for if explicit configuration for PolicyConfigurationIdentity() is not set.  The list will be processed
+// in order, terminating on first match, and an implicit "" is always checked at the end.
+// It is STRONGLY recommended for the first element, if any, to be a prefix of PolicyConfigurationIdentity(),
+// and each following element to be a prefix of the element preceding it.
+func (ref s3Reference) PolicyConfigurationNamespaces() []string {
+	res := []string{}
+	location := ref.location()
+	for {
+		res = append(res, location)
+		lastSlash := strings.LastIndex(location, "/")
+		if lastSlash == -1 {
+			break
+		}
+		location = location[:lastSlash]
+	}
+	return res
+}
+
+// NewImage returns a types.ImageCloser for this reference, possibly specialized for this ImageTransport.
+// The caller must call .Close() on the returned ImageCloser.
+// NOTE: If any kind of signature verification should happen, build an UnparsedImage from the value returned by NewImageSource,
+// verify that UnparsedImage, and convert it into a real Image via image.FromUnparsedImage.
+// WARNING: This may not do the right thing for a manifest list, see image.FromSource for details.
+func (ref s3Reference) NewImage(ctx context.Context, sys *types.SystemContext) (types.ImageCloser, error) {
+	return image.FromReference(ctx, sys, ref)
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref s3Reference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	return newImageSource(ctx, sys, ref)
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref s3Reference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	return newImageDestination(sys, ref)
+}
+
+// DeleteImage deletes the named image from the registry, if supported.
+func (ref s3Reference) DeleteImage(ctx context.Context, sys *types.SystemContext) error {
+	return errors.New("Deleting images not implemented for s3: images")
+}
+
+// location returns the bucket and prefix of the layout, in the bucket[/prefix] format.
+func (ref s3Reference) location() string {
+	if ref.prefix == "" {
+		return ref.bucket
+	}
+	return ref.bucket + "/" + ref.prefix
+}
+
+// objectKey returns the key of an object at relativePath within the layout.
+func (ref s3Reference) objectKey(relativePath string) string {
+	if ref.prefix == "" {
+		return relativePath
+	}
+	return path.Join(ref.prefix, relativePath)
+}
+
+// indexKey returns the key of the index.json object of the layout.
+func (ref s3Reference) indexKey() string {
+	return ref.objectKey("index.json")
+}
+
+// ociLayoutKey returns the key of the oci-layout object of the layout.
+func (ref s3Reference) ociLayoutKey() string {
+	return ref.objectKey("oci-layout")
+}
+
+// blobKey returns the key of the object containing the blob with digest d.
+func (ref s3Reference) blobKey(d digest.Digest) (string, error) {
+	if err := d.Validate(); err != nil {
+		return "", fmt.Errorf("unexpected digest reference %s: %w", d, err)
+	}
+	return ref.objectKey(path.Join("blobs", d.Algorithm().String(), d.Encoded())), nil
+}
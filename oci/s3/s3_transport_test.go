@@ -0,0 +1,96 @@
+package s3
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportName(t *testing.T) {
+	assert.Equal(t, "s3", Transport.Name())
+}
+
+func TestTransportValidatePolicyConfigurationScope(t *testing.T) {
+	for _, scope := range []string{
+		"bucket",
+		"bucket/prefix",
+		"my.bucket-1/a/b/c",
+	} {
+		err := Transport.ValidatePolicyConfigurationScope(scope)
+		assert.NoError(t, err, scope)
+	}
+
+	for _, scope := range []string{
+		"b",
+		"Bucket",
+		"bucket/",
+		"bucket//a",
+		"bucket/a/../b",
+		"bucket/a:b",
+	} {
+		err := Transport.ValidatePolicyConfigurationScope(scope)
+		assert.Error(t, err, scope)
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	for _, c := range []struct{ input, bucket, prefix, image, roundtrip string }{
+		{"//bucket", "bucket", "", "", "//bucket"},
+		{"//bucket/a/b", "bucket", "a/b", "", "//bucket/a/b"},
+		{"//bucket/a/b:img", "bucket", "a/b", "img", "//bucket/a/b:img"},
+		{"//bucket:img:tag", "bucket", "", "img:tag", "//bucket:img:tag"},
+		{"//bucket/a:@linux/amd64", "bucket", "a", "@linux/amd64", "//bucket/a:@linux/amd64"},
+		{"bucket", "", "", "", ""},          // Missing //
+		{"//Bucket", "", "", "", ""},        // Invalid bucket name
+		{"//bucket/", "", "", "", ""},       // Empty path component
+		{"//bucket/../a", "", "", "", ""},   // .. path component
+		{"//bucket:@linux", "", "", "", ""}, // Invalid platform selector
+	} {
+		ref, err := ParseReference(c.input)
+		if c.bucket == "" {
+			assert.Error(t, err, c.input)
+			continue
+		}
+		require.NoError(t, err, c.input)
+		s3Ref, ok := ref.(s3Reference)
+		require.True(t, ok, c.input)
+		assert.Equal(t, c.bucket, s3Ref.bucket, c.input)
+		assert.Equal(t, c.prefix, s3Ref.prefix, c.input)
+		assert.Equal(t, c.image, s3Ref.image, c.input)
+		assert.Equal(t, c.roundtrip, ref.StringWithinTransport(), c.input)
+		assert.Nil(t, ref.DockerReference(), c.input)
+	}
+}
+
+func TestReferencePolicyConfiguration(t *testing.T) {
+	ref, err := ParseReference("//bucket/a/b:img")
+	require.NoError(t, err)
+	assert.Equal(t, "bucket/a/b", ref.PolicyConfigurationIdentity())
+	assert.Equal(t, []string{"bucket/a/b", "bucket/a", "bucket"}, ref.PolicyConfigurationNamespaces())
+	for _, ns := range ref.PolicyConfigurationNamespaces() {
+		assert.NoError(t, Transport.ValidatePolicyConfigurationScope(ns), ns)
+	}
+
+	ref, err = ParseReference("//bucket")
+	require.NoError(t, err)
+	assert.Equal(t, "bucket", ref.PolicyConfigurationIdentity())
+	assert.Equal(t, []string{"bucket"}, ref.PolicyConfigurationNamespaces())
+}
+
+func TestReferenceKeys(t *testing.T) {
+	ref, err := ParseReference("//bucket/a/b:img")
+	require.NoError(t, err)
+	s3Ref := ref.(s3Reference)
+	assert.Equal(t, "a/b/index.json", s3Ref.indexKey())
+	assert.Equal(t, "a/b/oci-layout", s3Ref.ociLayoutKey())
+	key, err := s3Ref.blobKey("sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef")
+	require.NoError(t, err)
+	assert.Equal(t, "a/b/blobs/sha256/0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", key)
+	_, err = s3Ref.blobKey("sha256:../../index.json")
+	assert.Error(t, err)
+
+	ref, err = ParseReference("//bucket")
+	require.NoError(t, err)
+	assert.Equal(t, "index.json", ref.(s3Reference).indexKey())
+}
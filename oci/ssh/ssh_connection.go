@@ -0,0 +1,610 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/types"
+	"github.com/containers/storage/pkg/homedir"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/sync/semaphore"
+)
+
+const (
+	// defaultMaxSessions is the default limit on concurrent sessions on a connection.
+	defaultMaxSessions = 8
+	// notFoundExitStatus is the exit status used by our remote commands to report that a file does not exist.
+	notFoundExitStatus = 100
+	// maxStderrSize is the maximum size of the standard error output of a remote command we keep.
+	maxStderrSize = 4096
+)
+
+var (
+	connectionsLock sync.Mutex                       // Protects connections
+	connections     = map[string]*sharedConnection{} // Open connections, keyed by connectionKey
+)
+
+// sharedConnection is an SSH connection to a remote host, shared by all sources and destinations with the same configuration.
+type sharedConnection struct {
+	key        string
+	client     *ssh.Client
+	jumpClient *ssh.Client // nil if not connected through a jump host
+	sessions   *semaphore.Weighted
+	refCount   int // Protected by connectionsLock
+}
+
+// connection is a reference to a sharedConnection, used by a single source or destination.
+type connection struct {
+	*sharedConnection
+	logger             types.Logger
+	manifestSizeLimit  int // Maximum size of manifests and indexes read using this connection
+	signatureSizeLimit int // Maximum size of signatures read using this connection
+}
+
+// connectionConfig is the configuration of a connection, derived from a reference and a SystemContext.
+type connectionConfig struct {
+	user                  string
+	address               string // host:port
+	identityFile          string
+	knownHostsFile        string
+	insecureSkipHostKey   bool
+	jumpUser, jumpAddress string // jumpAddress is "" if not using a jump host
+	maxSessions           int
+	// Not a part of connectionKey:
+	logger             types.Logger
+	manifestSizeLimit  int
+	signatureSizeLimit int
+}
+
+// newConnectionConfig returns the configuration of a connection for ref, using sys.
+func newConnectionConfig(sys *types.SystemContext, ref sshReference) (connectionConfig, error) {
+	c := connectionConfig{
+		user:               ref.user,
+		address:            net.JoinHostPort(ref.host, strconv.Itoa(ref.port)),
+		maxSessions:        defaultMaxSessions,
+		logger:             logging.For(sys),
+		manifestSizeLimit:  iolimits.ManifestSizeLimit(sys),
+		signatureSizeLimit: iolimits.SignatureSizeLimit(sys),
+	}
+	if sys != nil {
+		c.identityFile = sys.SSHIdentityFile
+		c.knownHostsFile = sys.SSHKnownHostsFile
+		c.insecureSkipHostKey = sys.SSHInsecureSkipHostKeyVerify
+		if sys.SSHJumpHost != "" {
+			jumpUser, jumpHostPort, hasUser := strings.Cut(sys.SSHJumpHost, "@")
+			if !hasUser {
+				jumpUser, jumpHostPort = "", sys.SSHJumpHost
+			}
+			host, port, err := parseHostPort(jumpHostPort)
+			if err != nil {
+				return connectionConfig{}, fmt.Errorf("parsing SSH jump host %q: %w", sys.SSHJumpHost, err)
+			}
+			c.jumpUser = jumpUser
+			c.jumpAddress = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		if sys.SSHMaxSessions < 0 {
+			return connectionConfig{}, fmt.Errorf("invalid maximum number of SSH sessions %d", sys.SSHMaxSessions)
+		}
+		if sys.SSHMaxSessions != 0 {
+			c.maxSessions = sys.SSHMaxSessions
+		}
+	}
+	if c.user == "" || (c.jumpAddress != "" && c.jumpUser == "") {
+		u, err := user.Current()
+		if err != nil {
+			return connectionConfig{}, fmt.Errorf("determining the SSH user name: %w", err)
+		}
+		if c.user == "" {
+			c.user = u.Username
+		}
+		if c.jumpAddress != "" && c.jumpUser == "" {
+			c.jumpUser = u.Username
+		}
+	}
+	return c, nil
+}
+
+// connectionKey returns a key identifying connections with configuration c.
+func (c connectionConfig) connectionKey() string {
+	return fmt.Sprintf("%q %q %q %q %t %q %q %d", c.user, c.address, c.identityFile, c.knownHostsFile, c.insecureSkipHostKey,
+		c.jumpUser, c.jumpAddress, c.maxSessions)
+}
+
+// getConnection returns a connection for ref, configured using sys, reusing an existing one if possible.
+// The caller must call .release() on the returned connection.
+func getConnection(ctx context.Context, sys *types.SystemContext, ref sshReference) (*connection, error) {
+	config, err := newConnectionConfig(sys, ref)
+	if err != nil {
+		return nil, err
+	}
+	key := config.connectionKey()
+
+	connectionsLock.Lock()
+	if c, ok := connections[key]; ok {
+		c.refCount++
+		connectionsLock.Unlock()
+		return config.connection(c), nil
+	}
+	connectionsLock.Unlock()
+
+	// Don't hold connectionsLock while connecting, that would block unrelated callers.
+	c, err := dial(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	connectionsLock.Lock()
+	defer connectionsLock.Unlock()
+	if existing, ok := connections[key]; ok {
+		// Another caller connected in the meantime; use that connection.
+		c.close()
+		existing.refCount++
+		return config.connection(existing), nil
+	}
+	c.key = key
+	c.refCount = 1
+	connections[key] = c
+	go func() {
+		// Don't reuse connections which have been closed, e.g. by the remote host.
+		_ = c.client.Wait()
+		connectionsLock.Lock()
+		defer connectionsLock.Unlock()
+		if connections[key] == c {
+			delete(connections, key)
+		}
+	}()
+	return config.connection(c), nil
+}
+
+// connection returns a per-user handle of c, using config.
+func (config connectionConfig) connection(c *sharedConnection) *connection {
+	return &connection{
+		sharedConnection:   c,
+		logger:             config.logger,
+		manifestSizeLimit:  config.manifestSizeLimit,
+		signatureSizeLimit: config.signatureSizeLimit,
+	}
+}
+
+// release releases a reference to c, and closes it if it is no longer used.
+func (c *connection) release() {
+	connectionsLock.Lock()
+	defer connectionsLock.Unlock()
+	c.refCount--
+	if c.refCount > 0 {
+		return
+	}
+	if connections[c.key] == c.sharedConnection {
+		delete(connections, c.key)
+	}
+	c.close()
+}
+
+// close closes the SSH clients of c.
+func (c *sharedConnection) close() {
+	c.client.Close()
+	if c.jumpClient != nil {
+		c.jumpClient.Close()
+	}
+}
+
+// dial connects to the remote host described by config.
+func dial(ctx context.Context, config connectionConfig) (*sharedConnection, error) {
+	auth, closeAgent, err := authMethods(config.logger, config.identityFile)
+	if err != nil {
+		return nil, err
+	}
+	// Authentication only happens while connecting, so the agent is not needed afterwards.
+	defer closeAgent()
+	hostKeyCallback, err := hostKeyCallback(config.knownHostsFile, config.insecureSkipHostKey)
+	if err != nil {
+		return nil, err
+	}
+	clientConfig := func(user string) *ssh.ClientConfig {
+		return &ssh.ClientConfig{
+			User:            user,
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+		}
+	}
+
+	res := &sharedConnection{sessions: semaphore.NewWeighted(int64(config.maxSessions))}
+	var netConn net.Conn
+	if config.jumpAddress != "" {
+		config.logger.Debugf("Connecting to SSH jump host %s@%s", config.jumpUser, config.jumpAddress)
+		res.jumpClient, err = newClient(ctx, nil, config.jumpAddress, clientConfig(config.jumpUser))
+		if err != nil {
+			return nil, fmt.Errorf("connecting to SSH jump host %s: %w", config.jumpAddress, err)
+		}
+		netConn, err = res.jumpClient.Dial("tcp", config.address)
+		if err != nil {
+			res.jumpClient.Close()
+			return nil, fmt.Errorf("connecting to %s through SSH jump host %s: %w", config.address, config.jumpAddress, err)
+		}
+	}
+	config.logger.Debugf("Connecting to SSH host %s@%s", config.user, config.address)
+	res.client, err = newClient(ctx, netConn, config.address, clientConfig(config.user))
+	if err != nil {
+		if res.jumpClient != nil {
+			res.jumpClient.Close()
+		}
+		return nil, fmt.Errorf("connecting to SSH host %s: %w", config.address, err)
+	}
+	return res, nil
+}
+
+// newClient returns an SSH client using config over netConn, or over a new connection to address if netConn is nil.
+func newClient(ctx context.Context, netConn net.Conn, address string, config *ssh.ClientConfig) (*ssh.Client, error) {
+	if netConn == nil {
+		var err error
+		netConn, err = (&net.Dialer{}).DialContext(ctx, "tcp", address)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Abort the handshake if ctx is canceled.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			netConn.Close()
+		case <-done:
+		}
+	}()
+	conn, chans, reqs, err := ssh.NewClientConn(netConn, address, config)
+	if err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	return ssh.NewClient(conn, chans, reqs), nil
+}
+
+// authMethods returns the authentication methods to use: keys from identityFile if not "", otherwise keys from an SSH agent
+// and the default key files.
+// The caller must call the returned function, closing the connection to the agent, when done authenticating.
+func authMethods(logger types.Logger, identityFile string) ([]ssh.AuthMethod, func(), error) {
+	if identityFile != "" {
+		signer, err := loadKey(identityFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, func() {}, nil
+	}
+
+	res := []ssh.AuthMethod{}
+	closeAgent := func() {}
+	if socket := os.Getenv("SSH_AUTH_SOCK"); socket != "" {
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			logger.Debugf("Ignoring SSH agent at %s: %v", socket, err)
+		} else {
+			res = append(res, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+			closeAgent = func() { conn.Close() }
+		}
+	}
+	signers := []ssh.Signer{}
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		signer, err := loadKey(filepath.Join(homedir.Get(), ".ssh", name))
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				logger.Debugf("Ignoring SSH key: %v", err)
+			}
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	if len(signers) != 0 {
+		res = append(res, ssh.PublicKeys(signers...))
+	}
+	return res, closeAgent, nil
+}
+
+// loadKey returns a signer using the private key in path.
+func loadKey(path string) (ssh.Signer, error) {
+	keyBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(keyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing SSH private key %s: %w", path, err)
+	}
+	return signer, nil
+}
+
+// hostKeyCallback returns a callback verifying host keys using knownHostsFile, or ~/.ssh/known_hosts if knownHostsFile is "".
+func hostKeyCallback(knownHostsFile string, insecureSkipVerify bool) (ssh.HostKeyCallback, error) {
+	if insecureSkipVerify {
+		return ssh.InsecureIgnoreHostKey(), nil // #nosec G106 -- explicitly requested by the user.
+	}
+	if knownHostsFile == "" {
+		knownHostsFile = filepath.Join(homedir.Get(), ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading SSH known hosts: %w", err)
+	}
+	return callback, nil
+}
+
+// shellQuote returns s quoted for use as a single word in a POSIX shell command.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// remoteCommandError is returned when a remote command fails.
+type remoteCommandError struct {
+	command    string
+	exitStatus int
+	stderr     string
+}
+
+func (e *remoteCommandError) Error() string {
+	if e.stderr == "" {
+		return fmt.Sprintf("remote command %q failed with exit status %d", e.command, e.exitStatus)
+	}
+	return fmt.Sprintf("remote command %q failed with exit status %d: %s", e.command, e.exitStatus, e.stderr)
+}
+
+// Is allows errors.Is(err, fs.ErrNotExist) and errors.Is(err, types.ErrNotFound) to detect missing files.
+func (e *remoteCommandError) Is(target error) bool {
+	return (target == fs.ErrNotExist || target == types.ErrNotFound) && e.exitStatus == notFoundExitStatus
+}
+
+// commandError converts an error returned by ssh.Session.Run or ssh.Session.Wait for command to a more useful error.
+func commandError(command string, err error, stderr *limitedBuffer) error {
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return &remoteCommandError{
+			command:    command,
+			exitStatus: exitErr.ExitStatus(),
+			stderr:     strings.TrimSpace(stderr.String()),
+		}
+	}
+	return err
+}
+
+// limitedBuffer is an io.Writer which keeps at most maxStderrSize bytes of its input.
+type limitedBuffer struct {
+	buf bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := maxStderrSize - b.buf.Len(); remaining > 0 {
+		if len(p) > remaining {
+			b.buf.Write(p[:remaining])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	return b.buf.String()
+}
+
+// newSession returns a new session on c, after waiting for a free session slot.
+// The caller must call the returned cleanup function when done with the session.
+func (c *sharedConnection) newSession(ctx context.Context) (*ssh.Session, func(), error) {
+	if err := c.sessions.Acquire(ctx, 1); err != nil {
+		return nil, nil, err
+	}
+	session, err := c.client.NewSession()
+	if err != nil {
+		c.sessions.Release(1)
+		return nil, nil, err
+	}
+	// Terminate the remote command if ctx is canceled.
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-done:
+		}
+	}()
+	return session, func() {
+		close(done)
+		session.Close()
+		c.sessions.Release(1)
+	}, nil
+}
+
+// run runs command on the remote host, with stdin (if not nil) as its standard input and stdout (if not nil) receiving its standard output.
+func (c *connection) run(ctx context.Context, command string, stdin io.Reader, stdout io.Writer) error {
+	session, cleanup, err := c.newSession(ctx)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+	stderr := &limitedBuffer{}
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+	c.logger.Debugf("Running remote command %q", command)
+	if err := session.Run(command); err != nil {
+		return commandError(command, err, stderr)
+	}
+	return nil
+}
+
+// fileCommand returns a command which runs command, a shell command using "$f" to refer to filePath, if filePath is a regular file,
+// or fails with notFoundExitStatus.
+func fileCommand(filePath, command string) string {
+	return fmt.Sprintf("f=%s; test -f \"$f\" || exit %d; %s", shellQuote(filePath), notFoundExitStatus, command)
+}
+
+// errTooLarge is returned by readFile when a file is larger than the requested limit.
+var errTooLarge = errors.New("file is too large")
+
+// maxSizeWriter is an io.Writer which fails if more than limit bytes are written.
+// (It does not embed bytes.Buffer, so that io.Copy can't bypass Write by using bytes.Buffer.ReadFrom.)
+type maxSizeWriter struct {
+	buf   bytes.Buffer
+	limit int
+}
+
+func (w *maxSizeWriter) Write(p []byte) (int, error) {
+	if w.buf.Len()+len(p) > w.limit {
+		return 0, errTooLarge
+	}
+	return w.buf.Write(p)
+}
+
+// readFile returns the contents of filePath, which must be at most limit bytes long.
+// If the file does not exist, the returned error satisfies errors.Is(err, fs.ErrNotExist).
+func (c *connection) readFile(ctx context.Context, filePath string, limit int) ([]byte, error) {
+	buf := &maxSizeWriter{limit: limit}
+	if err := c.run(ctx, fileCommand(filePath, `exec cat -- "$f"`), nil, buf); err != nil {
+		if errors.Is(err, errTooLarge) {
+			return nil, fmt.Errorf("reading %s: %w, exceeding the limit of %d bytes", filePath, errTooLarge, limit)
+		}
+		return nil, err
+	}
+	return buf.buf.Bytes(), nil
+}
+
+// fileSize returns the size of filePath.
+// If the file does not exist, the returned error satisfies errors.Is(err, fs.ErrNotExist).
+func (c *connection) fileSize(ctx context.Context, filePath string) (int64, error) {
+	var stdout bytes.Buffer
+	if err := c.run(ctx, fileCommand(filePath, `exec wc -c < "$f"`), nil, &stdout); err != nil {
+		return -1, err
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(stdout.String()), 10, 64)
+	if err != nil {
+		return -1, fmt.Errorf("parsing size of %s: %w", filePath, err)
+	}
+	return size, nil
+}
+
+// remoteFileReader is an io.ReadCloser reading the standard output of a remote command.
+type remoteFileReader struct {
+	command string
+	session *ssh.Session
+	stdout  io.Reader
+	stderr  *limitedBuffer
+	cleanup func()
+	waitErr error // The result of session.Wait, valid if waited
+	waited  bool
+	closed  bool
+}
+
+func (r *remoteFileReader) Read(p []byte) (int, error) {
+	n, err := r.stdout.Read(p)
+	if err == io.EOF {
+		// Only report EOF if the command succeeded, i.e. the file was read completely.
+		if !r.waited {
+			r.waitErr = r.session.Wait()
+			r.waited = true
+		}
+		if r.waitErr != nil {
+			return n, commandError(r.command, r.waitErr, r.stderr)
+		}
+	}
+	return n, err
+}
+
+func (r *remoteFileReader) Close() error {
+	if !r.closed {
+		r.closed = true
+		r.cleanup()
+	}
+	return nil
+}
+
+// openFile returns a stream reading filePath.
+// The caller must close the returned stream.
+func (c *connection) openFile(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	session, cleanup, err := c.newSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		cleanup()
+		return nil, err
+	}
+	stderr := &limitedBuffer{}
+	session.Stderr = stderr
+	command := fileCommand(filePath, `exec cat -- "$f"`)
+	c.logger.Debugf("Running remote command %q", command)
+	if err := session.Start(command); err != nil {
+		cleanup()
+		return nil, err
+	}
+	return &remoteFileReader{command: command, session: session, stdout: stdout, stderr: stderr, cleanup: cleanup}, nil
+}
+
+// countingReader is an io.Reader which counts the bytes read from it.
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+// putFile creates or replaces filePath with the contents of stream, creating parent directories if necessary, and returns its size.
+// The file only becomes visible if verify, if not nil, succeeds after stream has been read to the end.
+func (c *connection) putFile(ctx context.Context, filePath string, stream io.Reader, verify func(size int64) error) (int64, error) {
+	var suffix [8]byte
+	if _, err := rand.Read(suffix[:]); err != nil {
+		return -1, err
+	}
+	dir := path.Dir(filePath)
+	tempPath := path.Join(dir, ".ssh-put-"+hex.EncodeToString(suffix[:]))
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			// Use a new context, the original one may have been canceled.
+			if err := c.run(context.Background(), "rm -f -- "+shellQuote(tempPath), nil, nil); err != nil {
+				c.logger.Debugf("Error removing temporary file %s: %v", tempPath, err)
+			}
+		}
+	}()
+
+	counter := &countingReader{reader: stream}
+	if err := c.run(ctx, fmt.Sprintf("mkdir -p -- %s && cat > %s", shellQuote(dir), shellQuote(tempPath)), counter, nil); err != nil {
+		return -1, err
+	}
+	if verify != nil {
+		if err := verify(counter.count); err != nil {
+			return -1, err
+		}
+	}
+	if err := c.run(ctx, fmt.Sprintf("chmod 0644 -- %s && mv -f -- %s %s", shellQuote(tempPath), shellQuote(tempPath), shellQuote(filePath)), nil, nil); err != nil {
+		return -1, err
+	}
+	succeeded = true
+	return counter.count, nil
+}
+
+// writeFile creates or replaces filePath with data, creating parent directories if necessary.
+func (c *connection) writeFile(ctx context.Context, filePath string, data []byte) error {
+	_, err := c.putFile(ctx, filePath, bytes.NewReader(data), nil)
+	return err
+}
@@ -0,0 +1,406 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testServer is an SSH server which runs exec requests using the local /bin/sh.
+type testServer struct {
+	listener net.Listener
+	config   *ssh.ServerConfig
+
+	mu          sync.Mutex
+	connections int // Number of accepted connections
+	sessions    int // Number of currently open sessions
+	maxSessions int // Maximum value of sessions observed
+}
+
+// newTestServer starts a test server, and returns it and a SystemContext configured to connect to it.
+func newTestServer(t *testing.T) (*testServer, *types.SystemContext) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh is not available")
+	}
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	require.NoError(t, err)
+	clientPublicKey, clientKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	authorizedKey, err := ssh.NewPublicKey(clientPublicKey)
+	require.NoError(t, err)
+
+	s := &testServer{
+		config: &ssh.ServerConfig{
+			PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+				if conn.User() != "tester" || !bytes.Equal(key.Marshal(), authorizedKey.Marshal()) {
+					return nil, errors.New("unauthorized")
+				}
+				return nil, nil
+			},
+		},
+	}
+	s.config.AddHostKey(hostSigner)
+	s.listener, err = net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { s.listener.Close() })
+	go s.serve()
+
+	dir := t.TempDir()
+	pemBlock, err := ssh.MarshalPrivateKey(clientKey, "")
+	require.NoError(t, err)
+	identityFile := filepath.Join(dir, "id_ed25519")
+	require.NoError(t, os.WriteFile(identityFile, pem.EncodeToMemory(pemBlock), 0o600))
+	knownHostsFile := filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.listener.Addr().String())}, hostSigner.PublicKey())
+	require.NoError(t, os.WriteFile(knownHostsFile, []byte(line+"\n"), 0o600))
+
+	return s, &types.SystemContext{
+		SSHIdentityFile:   identityFile,
+		SSHKnownHostsFile: knownHostsFile,
+	}
+}
+
+// reference returns a reference for a layout at path on s.
+func (s *testServer) reference(t *testing.T, format, path, image string) sshReference {
+	port := s.listener.Addr().(*net.TCPAddr).Port
+	ref, err := NewReference(format, "tester", "127.0.0.1", port, path, image)
+	require.NoError(t, err)
+	return ref.(sshReference)
+}
+
+func (s *testServer) serve() {
+	for {
+		netConn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			_, chans, reqs, err := ssh.NewServerConn(netConn, s.config)
+			if err != nil {
+				netConn.Close()
+				return
+			}
+			s.mu.Lock()
+			s.connections++
+			s.mu.Unlock()
+			go ssh.DiscardRequests(reqs)
+			for newChannel := range chans {
+				if newChannel.ChannelType() != "session" {
+					_ = newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+					continue
+				}
+				channel, requests, err := newChannel.Accept()
+				if err != nil {
+					continue
+				}
+				go s.handleSession(channel, requests)
+			}
+		}()
+	}
+}
+
+func (s *testServer) handleSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	s.mu.Lock()
+	s.sessions++
+	if s.sessions > s.maxSessions {
+		s.maxSessions = s.sessions
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.sessions--
+		s.mu.Unlock()
+		channel.Close()
+	}()
+
+	for req := range requests {
+		if req.Type != "exec" || len(req.Payload) < 4 {
+			_ = req.Reply(false, nil)
+			continue
+		}
+		_ = req.Reply(true, nil)
+		command := string(req.Payload[4 : 4+binary.BigEndian.Uint32(req.Payload)])
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Stdin = channel
+		cmd.Stdout = channel
+		cmd.Stderr = channel.Stderr()
+		exitStatus := 0
+		if err := cmd.Run(); err != nil {
+			exitStatus = 255
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				exitStatus = exitErr.ExitCode()
+			}
+		}
+		_, _ = channel.SendRequest("exit-status", false, binary.BigEndian.AppendUint32(nil, uint32(exitStatus)))
+		return
+	}
+}
+
+func TestConnectionFiles(t *testing.T) {
+	ctx := context.Background()
+	s, sys := newTestServer(t)
+	dir := t.TempDir()
+	ref := s.reference(t, formatOCI, dir, "")
+	conn, err := getConnection(ctx, sys, ref)
+	require.NoError(t, err)
+	defer conn.release()
+
+	filePath := filepath.Join(dir, "a b", "it's")
+	_, err = conn.readFile(ctx, filePath, 100)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	_, err = conn.fileSize(ctx, filePath)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	err = conn.writeFile(ctx, filePath, []byte("contents"))
+	require.NoError(t, err)
+	contents, err := conn.readFile(ctx, filePath, 100)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("contents"), contents)
+	_, err = conn.readFile(ctx, filePath, 4)
+	assert.ErrorIs(t, err, errTooLarge)
+	size, err := conn.fileSize(ctx, filePath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(8), size)
+	stream, err := conn.openFile(ctx, filePath)
+	require.NoError(t, err)
+	contents, err = io.ReadAll(stream)
+	stream.Close()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("contents"), contents)
+
+	// A failed verification leaves no files behind.
+	_, err = conn.putFile(ctx, filepath.Join(dir, "rejected"), bytes.NewReader([]byte("data")), func(size int64) error {
+		assert.Equal(t, int64(4), size)
+		return errors.New("rejected")
+	})
+	assert.Error(t, err)
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "a b", entries[0].Name())
+}
+
+func TestConnectionReuse(t *testing.T) {
+	ctx := context.Background()
+	s, sys := newTestServer(t)
+	dir := t.TempDir()
+	sys.SSHMaxSessions = 2
+
+	conn1, err := getConnection(ctx, sys, s.reference(t, formatOCI, dir, ""))
+	require.NoError(t, err)
+	conn2, err := getConnection(ctx, sys, s.reference(t, formatDir, dir, ""))
+	require.NoError(t, err)
+	assert.Same(t, conn1.sharedConnection, conn2.sharedConnection)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := conn1.run(ctx, "sleep 0.1", nil, nil)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	conn1.release()
+	conn2.release()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	assert.Equal(t, 1, s.connections)
+	assert.LessOrEqual(t, s.maxSessions, 2)
+}
+
+func TestConcurrentGetConnection(t *testing.T) {
+	ctx := context.Background()
+	s, sys := newTestServer(t)
+	ref := s.reference(t, formatOCI, t.TempDir(), "")
+
+	// Concurrent callers connect independently, but all of them end up using the same connection.
+	conns := make([]*connection, 4)
+	var wg sync.WaitGroup
+	for i := range conns {
+		i := i
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn, err := getConnection(ctx, sys, ref)
+			assert.NoError(t, err)
+			conns[i] = conn
+		}()
+	}
+	wg.Wait()
+	for _, conn := range conns {
+		require.NotNil(t, conn)
+		assert.Same(t, conns[0].sharedConnection, conn.sharedConnection)
+	}
+	err := conns[0].run(ctx, "true", nil, nil)
+	assert.NoError(t, err)
+	for _, conn := range conns {
+		conn.release()
+	}
+}
+
+func TestConnectionUnknownHostKey(t *testing.T) {
+	ctx := context.Background()
+	s, sys := newTestServer(t)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(sys.SSHKnownHostsFile, []byte{}, 0o600))
+
+	_, err := getConnection(ctx, sys, s.reference(t, formatOCI, dir, ""))
+	assert.Error(t, err)
+
+	sys.SSHInsecureSkipHostKeyVerify = true
+	conn, err := getConnection(ctx, sys, s.reference(t, formatOCI, dir, ""))
+	require.NoError(t, err)
+	conn.release()
+}
+
+// putTestImage writes an image with a single layer using dest, and returns the manifest and the layer.
+func putTestImage(t *testing.T, dest private.ImageDestination) ([]byte, []byte) {
+	ctx := context.Background()
+	layer := []byte("this is a layer, not really a tarball")
+	layerDigest := digest.FromBytes(layer)
+	config := []byte("{}")
+	for _, blob := range [][]byte{layer, config} {
+		_, err := dest.PutBlobWithOptions(ctx, bytes.NewReader(blob), types.BlobInfo{Digest: digest.FromBytes(blob), Size: int64(len(blob))},
+			private.PutBlobOptions{Cache: none.NoCache})
+		require.NoError(t, err)
+	}
+	reused, _, err := dest.TryReusingBlobWithOptions(ctx, types.BlobInfo{Digest: layerDigest, Size: -1}, private.TryReusingBlobOptions{Cache: none.NoCache})
+	require.NoError(t, err)
+	assert.True(t, reused)
+	_, err = dest.PutBlobWithOptions(ctx, bytes.NewReader(layer), types.BlobInfo{Digest: digest.FromString("wrong"), Size: -1},
+		private.PutBlobOptions{Cache: none.NoCache})
+	assert.Error(t, err)
+
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"` + imgspecv1.MediaTypeImageManifest + `",` +
+		`"config":{"mediaType":"` + imgspecv1.MediaTypeImageConfig + `","digest":"` + digest.FromBytes(config).String() + `","size":2},` +
+		`"layers":[{"mediaType":"` + imgspecv1.MediaTypeImageLayer + `","digest":"` + layerDigest.String() + `","size":` + strconv.Itoa(len(layer)) + `}]}`)
+	require.NoError(t, dest.PutManifest(ctx, manifest, nil))
+	return manifest, layer
+}
+
+// checkTestImage verifies that src contains the image written by putTestImage.
+func checkTestImage(t *testing.T, src private.ImageSource, manifest, layer []byte) {
+	ctx := context.Background()
+	m, mimeType, err := src.GetManifest(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, manifest, m)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, mimeType)
+	stream, size, err := src.GetBlob(ctx, types.BlobInfo{Digest: digest.FromBytes(layer), Size: -1}, none.NoCache)
+	require.NoError(t, err)
+	contents, err := io.ReadAll(stream)
+	stream.Close()
+	require.NoError(t, err)
+	assert.Equal(t, layer, contents)
+	assert.Equal(t, int64(len(layer)), size)
+	_, _, err = src.GetBlob(ctx, types.BlobInfo{Digest: digest.FromString("missing"), Size: -1}, none.NoCache)
+	assert.Error(t, err)
+}
+
+func TestOCILayout(t *testing.T) {
+	ctx := context.Background()
+	s, sys := newTestServer(t)
+	dir := filepath.Join(t.TempDir(), "layout")
+
+	dest, err := s.reference(t, formatOCI, dir, "img").NewImageDestination(ctx, sys)
+	require.NoError(t, err)
+	defer dest.Close()
+	privateDest := dest.(private.ImageDestination)
+	assert.Error(t, privateDest.SupportsSignatures(ctx))
+	manifest, layer := putTestImage(t, privateDest)
+	require.NoError(t, dest.Commit(ctx, nil))
+
+	_, err = os.Stat(filepath.Join(dir, imgspecv1.ImageLayoutFile))
+	require.NoError(t, err)
+	indexBytes, err := os.ReadFile(filepath.Join(dir, "index.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(indexBytes), `"`+imgspecv1.AnnotationRefName+`":"img"`)
+
+	for _, image := range []string{"", "img"} {
+		src, err := s.reference(t, formatOCI, dir, image).NewImageSource(ctx, sys)
+		require.NoError(t, err, image)
+		checkTestImage(t, src.(private.ImageSource), manifest, layer)
+		sigs, err := src.(private.ImageSource).GetSignaturesWithFormat(ctx, nil)
+		require.NoError(t, err)
+		assert.Empty(t, sigs)
+		src.Close()
+	}
+
+	_, err = s.reference(t, formatOCI, dir, "missing").NewImageSource(ctx, sys)
+	assert.Error(t, err)
+	_, err = s.reference(t, formatOCI, dir+"-missing", "").NewImageSource(ctx, sys)
+	assert.Error(t, err)
+}
+
+func TestDirLayout(t *testing.T) {
+	ctx := context.Background()
+	s, sys := newTestServer(t)
+	dir := filepath.Join(t.TempDir(), "dir")
+	ref := s.reference(t, formatDir, dir, "")
+
+	for i := 0; i < 2; i++ { // The second iteration overwrites the image written by the first one.
+		dest, err := ref.NewImageDestination(ctx, sys)
+		require.NoError(t, err)
+		privateDest := dest.(private.ImageDestination)
+		require.NoError(t, privateDest.SupportsSignatures(ctx))
+		manifest, layer := putTestImage(t, privateDest)
+		sig := signature.SigstoreFromComponents("application/vnd.dev.cosign.simplesigning.v1+json", []byte("payload"), nil)
+		require.NoError(t, privateDest.PutSignaturesWithFormat(ctx, []signature.Signature{sig}, nil))
+		require.NoError(t, dest.Commit(ctx, nil))
+		dest.Close()
+
+		version, err := os.ReadFile(filepath.Join(dir, "version"))
+		require.NoError(t, err)
+		assert.Equal(t, dirVersion, string(version))
+
+		src, err := ref.NewImageSource(ctx, sys)
+		require.NoError(t, err)
+		checkTestImage(t, src.(private.ImageSource), manifest, layer)
+		sigs, err := src.(private.ImageSource).GetSignaturesWithFormat(ctx, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []signature.Signature{sig}, sigs)
+		src.Close()
+	}
+
+	// A directory which does not contain an image is not overwritten.
+	other := filepath.Join(t.TempDir(), "other")
+	require.NoError(t, os.MkdirAll(other, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(other, "important"), []byte{}, 0o644))
+	_, err := s.reference(t, formatDir, other, "").NewImageDestination(ctx, sys)
+	assert.ErrorIs(t, err, directory.ErrNotContainerImageDir)
+	_, err = os.Stat(filepath.Join(other, "important"))
+	assert.NoError(t, err)
+
+	_, err = ref.NewImageDestination(ctx, &types.SystemContext{DirLayoutVersion: directory.LayoutVersion2})
+	assert.Error(t, err)
+}
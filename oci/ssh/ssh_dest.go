@@ -0,0 +1,345 @@
+package ssh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/internal/imagedestination/impl"
+	"github.com/containers/image/v5/internal/imagedestination/stubs"
+	"github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/internal/streamdigest"
+	"github.com/containers/image/v5/oci/internal"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspec "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// dirVersion is the contents of the version file of dir layouts written by this transport; it must match the dir: transport.
+const dirVersion = "Directory Transport Version: " + directory.LayoutVersion1 + "\n"
+
+type sshImageDestination struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	stubs.NoPutBlobPartialInitialize
+
+	ref       sshReference
+	sys       *types.SystemContext
+	conn      *connection
+	manifests []imgspecv1.Descriptor // Entries to add to the index on Commit, in order; only used for formatOCI.
+}
+
+// newImageDestination returns an ImageDestination for writing an image to a layout on a remote host.
+// An OCI layout is created if it does not exist; a dir layout replaces any image already in the directory.
+func newImageDestination(ctx context.Context, sys *types.SystemContext, ref sshReference) (private.ImageDestination, error) {
+	var supportedManifestMIMETypes []string
+	desiredLayerCompression := types.PreserveOriginal
+	switch ref.format {
+	case formatOCI:
+		selector, err := internal.ParseImageSelector(ref.image)
+		if err != nil {
+			return nil, err
+		}
+		if !selector.IsName() {
+			return nil, fmt.Errorf("can not write to an image selected by platform or annotation, %q; use an image name instead", ref.image)
+		}
+		supportedManifestMIMETypes = []string{
+			imgspecv1.MediaTypeImageManifest,
+			imgspecv1.MediaTypeImageIndex,
+		}
+		desiredLayerCompression = types.Compress
+	case formatDir:
+		if sys != nil {
+			if sys.DirLayoutVersion != "" && sys.DirLayoutVersion != directory.LayoutVersion1 {
+				return nil, fmt.Errorf("dir layout version %q is not supported by the ssh: transport", sys.DirLayoutVersion)
+			}
+			if sys.DirForceCompress {
+				desiredLayerCompression = types.Compress
+
+				if sys.DirForceDecompress {
+					return nil, fmt.Errorf("Cannot compress and decompress at the same time")
+				}
+			}
+			if sys.DirForceDecompress {
+				desiredLayerCompression = types.Decompress
+			}
+		}
+	}
+
+	conn, err := getConnection(ctx, sys, ref)
+	if err != nil {
+		return nil, err
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			conn.release()
+		}
+	}()
+	if ref.format == formatDir {
+		if err := prepareDirLayout(ctx, conn, ref); err != nil {
+			return nil, err
+		}
+	}
+
+	d := &sshImageDestination{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			SupportedManifestMIMETypes:     supportedManifestMIMETypes,
+			DesiredLayerCompression:        desiredLayerCompression,
+			AcceptsForeignLayerURLs:        ref.format == formatOCI,
+			MustMatchRuntimeOS:             false,
+			IgnoresEmbeddedDockerReference: false, // N/A, DockerReference() returns nil.
+			HasThreadSafePutBlob:           true,
+		}),
+		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
+
+		ref:  ref,
+		sys:  sys,
+		conn: conn,
+	}
+	d.Compat = impl.AddCompat(d)
+	succeeded = true
+	return d, nil
+}
+
+// prepareDirLayout creates the dir layout at ref, or removes the image in it if it already exists,
+// refusing to overwrite directories which don't contain an image.
+func prepareDirLayout(ctx context.Context, conn *connection, ref sshReference) error {
+	// Like the dir: transport, accept directories written using any layout version.
+	command := fmt.Sprintf(`d=%s
+if [ -d "$d" ] && [ -n "$(ls -A -- "$d")" ]; then
+	case "$(cat -- "$d/version" 2>/dev/null)" in
+	%s*) ;;
+	*) exit %d ;;
+	esac
+	find "$d" -mindepth 1 -maxdepth 1 -exec rm -rf -- {} +
+fi
+mkdir -p -- "$d"`, shellQuote(ref.path), shellQuote("Directory Transport Version: "), notFoundExitStatus)
+	if err := conn.run(ctx, command, nil, nil); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("ssh:%s: %w", ref.StringWithinTransport(), directory.ErrNotContainerImageDir)
+		}
+		return fmt.Errorf("preparing ssh:%s: %w", ref.StringWithinTransport(), err)
+	}
+	if err := conn.writeFile(ctx, ref.filePath("version"), []byte(dirVersion)); err != nil {
+		return fmt.Errorf("creating version file of ssh:%s: %w", ref.StringWithinTransport(), err)
+	}
+	conn.logger.Debugf("Prepared container image directory ssh:%s", ref.StringWithinTransport())
+	return nil
+}
+
+// Reference returns the reference used to set up this destination.  Note that this should directly correspond to user's intent,
+// e.g. it should use the public hostname instead of the result of resolving CNAMEs or following redirects.
+func (d *sshImageDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// Close removes resources associated with an initialized ImageDestination, if any.
+func (d *sshImageDestination) Close() error {
+	d.conn.release()
+	return nil
+}
+
+// PutBlobWithOptions writes contents of stream and returns data representing the result.
+// inputInfo.Digest can be optionally provided if known; if provided, and stream is read to the end without error, the digest MUST match the stream contents.
+// inputInfo.Size is the expected length of stream, if known.
+// inputInfo.MediaType describes the blob format, if known.
+// WARNING: The contents of stream are being verified on the fly.  Until stream.Read() returns io.EOF, the contents of the data SHOULD NOT be available
+// to any other readers for download using the supplied digest.
+// If stream.Read() at any time, ESPECIALLY at end of input, returns an error, PutBlobWithOptions MUST 1) fail, and 2) delete any data stored so far.
+func (d *sshImageDestination) PutBlobWithOptions(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, options private.PutBlobOptions) (private.UploadedBlob, error) {
+	// The file name depends on the digest, so if it is not known, compute it first.
+	if inputInfo.Digest == "" {
+		d.conn.logger.Debugf("ssh: input with unknown digest, streaming to disk first ...")
+		streamCopy, cleanup, err := streamdigest.ComputeBlobInfo(d.sys, stream, &inputInfo)
+		if err != nil {
+			return private.UploadedBlob{}, err
+		}
+		defer cleanup()
+		stream = streamCopy
+		d.conn.logger.Debugf("... streaming done")
+	}
+	blobPath, err := d.ref.blobPath(inputInfo.Digest)
+	if err != nil {
+		return private.UploadedBlob{}, err
+	}
+
+	// The file only becomes visible after the digest is verified.
+	digester := inputInfo.Digest.Algorithm().Digester()
+	size, err := d.conn.putFile(ctx, blobPath, io.TeeReader(stream, digester.Hash()), func(size int64) error {
+		if inputInfo.Size != -1 && size != inputInfo.Size {
+			return fmt.Errorf("Size mismatch when copying %s, expected %d, got %d", inputInfo.Digest, inputInfo.Size, size)
+		}
+		if digester.Digest() != inputInfo.Digest {
+			return fmt.Errorf("Digest mismatch when copying %s, got %s", inputInfo.Digest, digester.Digest())
+		}
+		return nil
+	})
+	if err != nil {
+		return private.UploadedBlob{}, fmt.Errorf("writing blob %s to ssh:%s: %w", inputInfo.Digest, d.ref.StringWithinTransport(), err)
+	}
+	return private.UploadedBlob{Digest: inputInfo.Digest, Size: size}, nil
+}
+
+// TryReusingBlobWithOptions checks whether the transport already contains, or can efficiently reuse, a blob, and if so, applies it to the current destination
+// (e.g. if the blob is a filesystem layer, this signifies that the changes it describes need to be applied again when composing a filesystem tree).
+// info.Digest must not be empty.
+// If the blob has been successfully reused, returns (true, info, nil).
+// If the transport can not reuse the requested blob, TryReusingBlob returns (false, {}, nil); it returns a non-nil error only on an unexpected failure.
+func (d *sshImageDestination) TryReusingBlobWithOptions(ctx context.Context, info types.BlobInfo, options private.TryReusingBlobOptions) (bool, private.ReusedBlob, error) {
+	if !impl.OriginalBlobMatchesRequiredCompression(options) {
+		return false, private.ReusedBlob{}, nil
+	}
+	if info.Digest == "" {
+		return false, private.ReusedBlob{}, errors.New("Can not check for a blob with unknown digest")
+	}
+	blobPath, err := d.ref.blobPath(info.Digest)
+	if err != nil {
+		return false, private.ReusedBlob{}, err
+	}
+	size, err := d.conn.fileSize(ctx, blobPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, private.ReusedBlob{}, nil
+		}
+		return false, private.ReusedBlob{}, fmt.Errorf("checking for blob %s in ssh:%s: %w", info.Digest, d.ref.StringWithinTransport(), err)
+	}
+	return true, private.ReusedBlob{Digest: info.Digest, Size: size}, nil
+}
+
+// PutManifest writes a manifest to the destination.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to overwrite the manifest for
+// (when the primary manifest is a manifest list); this should always be nil if the primary manifest is not a manifest list.
+// It is expected but not enforced that the instanceDigest, when specified, matches the digest of `manifest` as generated
+// by `manifest.Digest()`.
+// FIXME? This should also receive a MIME type if known, to differentiate between schema versions.
+// If the destination is in principle available, refuses this manifest type (e.g. it does not recognize the schema),
+// but may accept a different manifest type, the returned error must be an ManifestTypeRejectedError.
+func (d *sshImageDestination) PutManifest(ctx context.Context, m []byte, instanceDigest *digest.Digest) error {
+	if d.ref.format == formatDir {
+		if err := d.conn.writeFile(ctx, d.ref.dirManifestPath(instanceDigest), m); err != nil {
+			return fmt.Errorf("writing manifest to ssh:%s: %w", d.ref.StringWithinTransport(), err)
+		}
+		return nil
+	}
+
+	var manifestDigest digest.Digest
+	if instanceDigest != nil {
+		manifestDigest = *instanceDigest
+	} else {
+		var err error
+		manifestDigest, err = manifest.Digest(m)
+		if err != nil {
+			return err
+		}
+	}
+	blobPath, err := d.ref.blobPath(manifestDigest)
+	if err != nil {
+		return err
+	}
+	if err := d.conn.writeFile(ctx, blobPath, m); err != nil {
+		return fmt.Errorf("writing manifest %s to ssh:%s: %w", manifestDigest, d.ref.StringWithinTransport(), err)
+	}
+
+	if instanceDigest != nil {
+		return nil
+	}
+	desc := imgspecv1.Descriptor{
+		MediaType: manifest.GuessMIMEType(m),
+		Digest:    manifestDigest,
+		Size:      int64(len(m)),
+	}
+	if d.ref.image != "" {
+		desc.Annotations = map[string]string{imgspecv1.AnnotationRefName: d.ref.image}
+	}
+	d.manifests = append(d.manifests, desc)
+	return nil
+}
+
+// SupportsSignatures returns an error (to be displayed to the user) if the destination certainly can't store signatures.
+// Note: It is still possible for PutSignatures to fail if SupportsSignatures returns nil.
+func (d *sshImageDestination) SupportsSignatures(ctx context.Context) error {
+	if d.ref.format != formatDir {
+		return errors.New("Storing signatures in ssh: OCI layouts is not supported")
+	}
+	return nil
+}
+
+// PutSignaturesWithFormat writes a set of signatures to the destination.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to write or overwrite the signatures for
+// (when the primary manifest is a manifest list); this should always be nil if the primary manifest is not a manifest list.
+// MUST be called after PutManifest (signatures may reference manifest contents).
+func (d *sshImageDestination) PutSignaturesWithFormat(ctx context.Context, signatures []signature.Signature, instanceDigest *digest.Digest) error {
+	if len(signatures) == 0 {
+		return nil
+	}
+	if err := d.SupportsSignatures(ctx); err != nil {
+		return err
+	}
+	for i, sig := range signatures {
+		blob, err := signature.Blob(sig)
+		if err != nil {
+			return err
+		}
+		if err := d.conn.writeFile(ctx, d.ref.dirSignaturePath(i, instanceDigest), blob); err != nil {
+			return fmt.Errorf("writing signature to ssh:%s: %w", d.ref.StringWithinTransport(), err)
+		}
+	}
+	return nil
+}
+
+// Commit marks the process of storing the image as successful and asks for the image to be persisted.
+// unparsedToplevel contains data about the top-level manifest of the source (which may be a single-arch image or a manifest list
+// if PutManifest was only called for the single-arch image with instanceDigest == nil), primarily to allow lookups by the
+// original manifest list digest, if desired.
+// WARNING: This does not have any transactional semantics:
+// - Uploaded data MAY be visible to others before Commit() is called
+// - Uploaded data MAY be removed or MAY remain around if Close() is called without Commit() (i.e. rollback is allowed but not guaranteed)
+func (d *sshImageDestination) Commit(ctx context.Context, unparsedToplevel types.UnparsedImage) error {
+	if d.ref.format == formatDir {
+		return nil
+	}
+
+	// NOTE: The index is not locked; concurrent writers to the same layout may lose each other's updates.
+	index, err := getIndex(ctx, d.conn, d.ref)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		index = &imgspecv1.Index{
+			Versioned: imgspec.Versioned{
+				SchemaVersion: 2,
+			},
+			MediaType:   imgspecv1.MediaTypeImageIndex,
+			Annotations: make(map[string]string),
+		}
+
+		layoutBytes, err := json.Marshal(imgspecv1.ImageLayout{
+			Version: imgspecv1.ImageLayoutVersion,
+		})
+		if err != nil {
+			return err
+		}
+		if err := d.conn.writeFile(ctx, d.ref.filePath(imgspecv1.ImageLayoutFile), layoutBytes); err != nil {
+			return fmt.Errorf("writing oci-layout of ssh:%s: %w", d.ref.StringWithinTransport(), err)
+		}
+	}
+	for i := range d.manifests {
+		internal.AddManifest(index, &d.manifests[i])
+	}
+	indexJSON, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	if err := d.conn.writeFile(ctx, d.ref.filePath("index.json"), indexJSON); err != nil {
+		return fmt.Errorf("writing index of ssh:%s: %w", d.ref.StringWithinTransport(), err)
+	}
+	return nil
+}
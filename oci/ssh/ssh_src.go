@@ -0,0 +1,204 @@
+package ssh
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+
+	"github.com/containers/image/v5/internal/imagesource/impl"
+	"github.com/containers/image/v5/internal/imagesource/stubs"
+	"github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/oci/internal"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type sshImageSource struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	impl.DoesNotAffectLayerInfosForCopy
+	stubs.NoGetBlobAtInitialize
+
+	ref  sshReference
+	conn *connection
+	// The following are only set for formatOCI
+	index      *imgspecv1.Index
+	descriptor imgspecv1.Descriptor
+}
+
+// newImageSource returns an ImageSource for reading an image from a layout on a remote host.
+func newImageSource(ctx context.Context, sys *types.SystemContext, ref sshReference) (private.ImageSource, error) {
+	conn, err := getConnection(ctx, sys, ref)
+	if err != nil {
+		return nil, err
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			conn.release()
+		}
+	}()
+
+	s := &sshImageSource{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			HasThreadSafeGetBlob: true,
+		}),
+		NoGetBlobAtInitialize: stubs.NoGetBlobAt(ref),
+
+		ref:  ref,
+		conn: conn,
+	}
+	if ref.format == formatOCI {
+		index, err := getIndex(ctx, conn, ref)
+		if err != nil {
+			return nil, err
+		}
+		descriptor, _, err := internal.ChooseManifestDescriptor(index, ref.image, func(desc imgspecv1.Descriptor) (*imgspecv1.Index, error) {
+			blob, err := getJSONBlob(ctx, conn, ref, desc.Digest)
+			if err != nil {
+				return nil, err
+			}
+			var nested imgspecv1.Index
+			if err := json.Unmarshal(blob, &nested); err != nil {
+				return nil, fmt.Errorf("parsing image index %s: %w", desc.Digest, err)
+			}
+			return &nested, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("choosing an image in ssh:%s: %w", ref.StringWithinTransport(), err)
+		}
+		s.index = index
+		s.descriptor = descriptor
+	}
+	s.Compat = impl.AddCompat(s)
+	succeeded = true
+	return s, nil
+}
+
+// getIndex returns the index of the OCI layout at ref.
+// If the index does not exist, the returned error satisfies errors.Is(err, fs.ErrNotExist).
+func getIndex(ctx context.Context, conn *connection, ref sshReference) (*imgspecv1.Index, error) {
+	blob, err := conn.readFile(ctx, ref.filePath("index.json"), conn.manifestSizeLimit)
+	if err != nil {
+		return nil, fmt.Errorf("reading index of ssh:%s: %w", ref.StringWithinTransport(), err)
+	}
+	var index imgspecv1.Index
+	if err := json.Unmarshal(blob, &index); err != nil {
+		return nil, fmt.Errorf("parsing index of ssh:%s: %w", ref.StringWithinTransport(), err)
+	}
+	return &index, nil
+}
+
+// getJSONBlob returns the contents of a manifest-sized blob at ref, e.g. a manifest.
+func getJSONBlob(ctx context.Context, conn *connection, ref sshReference, d digest.Digest) ([]byte, error) {
+	blobPath, err := ref.blobPath(d)
+	if err != nil {
+		return nil, err
+	}
+	blob, err := conn.readFile(ctx, blobPath, conn.manifestSizeLimit)
+	if err != nil {
+		return nil, fmt.Errorf("reading blob %s: %w", d, err)
+	}
+	return blob, nil
+}
+
+// Reference returns the reference used to set up this source.
+func (s *sshImageSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// Close removes resources associated with an initialized ImageSource, if any.
+func (s *sshImageSource) Close() error {
+	s.conn.release()
+	return nil
+}
+
+// GetManifest returns the image's manifest along with its MIME type (which may be empty when it can't be determined but the manifest is available).
+// It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve (when the primary manifest is a manifest list);
+// this never happens if the primary manifest is not a manifest list (e.g. if the source never returns manifest lists).
+func (s *sshImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	if s.ref.format == formatDir {
+		m, err := s.conn.readFile(ctx, s.ref.dirManifestPath(instanceDigest), s.conn.manifestSizeLimit)
+		if err != nil {
+			return nil, "", err
+		}
+		return m, manifest.GuessMIMEType(m), nil
+	}
+
+	var dig digest.Digest
+	var mimeType string
+	if instanceDigest == nil {
+		dig = s.descriptor.Digest
+		mimeType = s.descriptor.MediaType
+	} else {
+		dig = *instanceDigest
+		for _, md := range s.index.Manifests {
+			if md.Digest == dig {
+				mimeType = md.MediaType
+				break
+			}
+		}
+	}
+
+	m, err := getJSONBlob(ctx, s.conn, s.ref, dig)
+	if err != nil {
+		return nil, "", err
+	}
+	if mimeType == "" {
+		mimeType = manifest.GuessMIMEType(m)
+	}
+	return m, mimeType, nil
+}
+
+// GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
+// The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
+// May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
+func (s *sshImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	blobPath, err := s.ref.blobPath(info.Digest)
+	if err != nil {
+		return nil, -1, err
+	}
+	size, err := s.conn.fileSize(ctx, blobPath)
+	if err != nil {
+		return nil, -1, fmt.Errorf("reading blob %s: %w", info.Digest, err)
+	}
+	stream, err := s.conn.openFile(ctx, blobPath)
+	if err != nil {
+		return nil, -1, fmt.Errorf("reading blob %s: %w", info.Digest, err)
+	}
+	return stream, size, nil
+}
+
+// GetSignaturesWithFormat returns the image's signatures.  It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve signatures for
+// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+// (e.g. if the source never returns manifest lists).
+func (s *sshImageSource) GetSignaturesWithFormat(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Signature, error) {
+	if s.ref.format != formatDir {
+		return nil, nil
+	}
+	signatures := []signature.Signature{}
+	for i := 0; ; i++ {
+		path := s.ref.dirSignaturePath(i, instanceDigest)
+		sigBlob, err := s.conn.readFile(ctx, path, s.conn.signatureSizeLimit)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				break
+			}
+			return nil, err
+		}
+		signature, err := signature.FromBlob(sigBlob)
+		if err != nil {
+			return nil, fmt.Errorf("parsing signature %q: %w", path, err)
+		}
+		signatures = append(signatures, signature)
+	}
+	return signatures, nil
+}
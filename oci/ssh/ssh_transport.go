@@ -0,0 +1,301 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/oci/internal"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+func init() {
+	transports.Register(Transport)
+}
+
+// Transport is an ImageTransport for dir: or oci: layouts on a remote host, accessed over SSH.
+var Transport = sshTransport{}
+
+type sshTransport struct{}
+
+// Name returns the name of the transport, which must be unique among other transports.
+func (t sshTransport) Name() string {
+	return "ssh"
+}
+
+// ParseReference converts a string, which should not start with the ImageTransport.Name prefix, into an ImageReference.
+func (t sshTransport) ParseReference(reference string) (types.ImageReference, error) {
+	return ParseReference(reference)
+}
+
+// ValidatePolicyConfigurationScope checks that scope is a valid name for a signature.PolicyTransportScopes keys
+// (i.e. a valid PolicyConfigurationIdentity() or PolicyConfigurationNamespaces() return value).
+// It is acceptable to allow an invalid value which will never be matched, it can "only" cause user confusion.
+// scope passed to this function will not be "", that value is always allowed.
+func (t sshTransport) ValidatePolicyConfigurationScope(scope string) error {
+	hostPort, remotePath, hasPath := strings.Cut(scope, "/")
+	host, port, err := parseHostPort(hostPort)
+	if err != nil {
+		return fmt.Errorf("Invalid scope %q: %w", scope, err)
+	}
+	if joinHostPort(host, port) != hostPort {
+		return fmt.Errorf("Invalid scope %q: the host is not in canonical form", scope)
+	}
+	if hasPath {
+		if err := validatePath("/" + remotePath); err != nil {
+			return fmt.Errorf("Invalid scope %q: %w", scope, err)
+		}
+	}
+	return nil
+}
+
+// Layout formats supported by this transport.
+const (
+	formatDir = "dir" // A directory in the format used by the dir: transport
+	formatOCI = "oci" // An OCI layout, as used by the oci: transport
+)
+
+// defaultPort is the port used if the reference does not specify one.
+const defaultPort = 22
+
+// sshReference is an ImageReference for a layout on a remote host.
+type sshReference struct {
+	format string // formatDir or formatOCI
+	user   string // "" to use the name of the current user
+	host   string
+	port   int
+	path   string // The absolute path of the layout directory on the remote host.
+	// If image=="", it means the "only image" in the index.json is used in the case it is a source
+	// for destinations, the image name annotation "image.ref.name" is not added to the index.json.
+	// Always "" if format == formatDir.
+	image string
+}
+
+// ParseReference converts a string, which should not start with the ImageTransport.Name prefix, into an ssh ImageReference.
+// The expected format is {dir,oci}://[user@]host[:port]/path, followed by [:image] for oci layouts.
+func ParseReference(reference string) (types.ImageReference, error) {
+	format, rest, ok := strings.Cut(reference, "://")
+	if !ok {
+		return nil, fmt.Errorf("ssh: reference %q does not start with dir:// or oci://", reference)
+	}
+	userHostPort, remotePath, ok := strings.Cut(rest, "/")
+	if !ok {
+		return nil, fmt.Errorf("ssh: reference %q does not contain a path", reference)
+	}
+	remotePath = "/" + remotePath
+	var image string
+	if format == formatOCI {
+		remotePath, image, _ = strings.Cut(remotePath, ":")
+	}
+	user, hostPort, hasUser := strings.Cut(userHostPort, "@")
+	if !hasUser {
+		user, hostPort = "", userHostPort
+	} else if user == "" {
+		return nil, fmt.Errorf("ssh: reference %q contains an empty user name", reference)
+	}
+	host, port, err := parseHostPort(hostPort)
+	if err != nil {
+		return nil, fmt.Errorf("ssh: reference %q: %w", reference, err)
+	}
+	return NewReference(format, user, host, port, remotePath, image)
+}
+
+// NewReference returns an ssh reference for a layout in format ("dir" or "oci") at path on host:port, accessed as user
+// (or as the current user, if user is ""), and an image, which must be "" for the "dir" format.
+func NewReference(format, user, host string, port int, path, image string) (types.ImageReference, error) {
+	switch format {
+	case formatDir:
+		if image != "" {
+			return nil, fmt.Errorf("ssh: an image name can not be specified for a dir layout")
+		}
+	case formatOCI:
+		if _, err := internal.ParseImageSelector(image); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("ssh: unsupported layout format %q, expected dir or oci", format)
+	}
+	if strings.ContainsAny(user, "@:/") {
+		return nil, fmt.Errorf("ssh: invalid user name %q", user)
+	}
+	if host == "" || strings.ContainsAny(host, "@/") {
+		return nil, fmt.Errorf("ssh: invalid host name %q", host)
+	}
+	if port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("ssh: invalid port %d", port)
+	}
+	if err := validatePath(path); err != nil {
+		return nil, err
+	}
+	return sshReference{format: format, user: user, host: host, port: port, path: path, image: image}, nil
+}
+
+// parseHostPort parses a host[:port] value, with IPv6 addresses enclosed in brackets.
+func parseHostPort(hostPort string) (string, int, error) {
+	u, err := url.Parse("ssh://" + hostPort)
+	if err != nil || u.Host != hostPort || u.User != nil || u.Hostname() == "" {
+		return "", -1, fmt.Errorf("invalid host %q", hostPort)
+	}
+	port := defaultPort
+	if p := u.Port(); p != "" {
+		port, err = strconv.Atoi(p)
+		if err != nil || port <= 0 || port > 65535 {
+			return "", -1, fmt.Errorf("invalid port in %q", hostPort)
+		}
+	}
+	return u.Hostname(), port, nil
+}
+
+// joinHostPort returns the canonical host[:port] form of host and port, omitting the default port.
+func joinHostPort(host string, port int) string {
+	if port == defaultPort {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+// validatePath returns an error if remotePath is not a valid location of a layout on the remote host.
+func validatePath(remotePath string) error {
+	if !strings.HasPrefix(remotePath, "/") {
+		return fmt.Errorf("Invalid remote path %q: must be absolute", remotePath)
+	}
+	if remotePath == "/" || path.Clean(remotePath) != remotePath {
+		return fmt.Errorf("Invalid remote path %q: must be a clean path other than /", remotePath)
+	}
+	if strings.Contains(remotePath, ":") {
+		return fmt.Errorf("Invalid remote path %q: must not contain ':'", remotePath)
+	}
+	return nil
+}
+
+func (ref sshReference) Transport() types.ImageTransport {
+	return Transport
+}
+
+// StringWithinTransport returns a string representation of the reference, which MUST be such that
+// reference.Transport().ParseReference(reference.StringWithinTransport()) returns an equivalent reference.
+// NOTE: The returned string is not promised to be equal to the original input to ParseReference;
+// e.g. default attribute values omitted by the user may be filled in the return value, or vice versa.
+// WARNING: Do not use the return value in the UI to describe an image, it does not contain the Transport().Name() prefix.
+func (ref sshReference) StringWithinTransport() string {
+	res := ref.format + "://"
+	if ref.user != "" {
+		res += ref.user + "@"
+	}
+	res += joinHostPort(ref.host, ref.port) + ref.path
+	if ref.image != "" {
+		res += ":" + ref.image
+	}
+	return res
+}
+
+// DockerReference returns a Docker reference associated with this reference
+// (fully explicit, i.e. !reference.IsNameOnly, but reflecting user intent,
+// not e.g. after redirect or alias processing), or nil if unknown/not applicable.
+func (ref sshReference) DockerReference() reference.Named {
+	return nil
+}
+
+// ImageName returns the name of the image within the OCI layout, as specified by the user, or "" if not specified.
+// This implements private.ImageNameAccessor.
+func (ref sshReference) ImageName() string {
+	return ref.image
+}
+
+// PolicyConfigurationIdentity returns a string representation of the reference, suitable for policy lookup.
+// This MUST reflect user intent, not e.g. after processing of third-party redirects or aliases;
+// The value SHOULD be fully explicit about its semantics, with no hidden defaults, AND canonical
+// (i.e. various references with exactly the same semantics should return the same configuration identity)
+// It is fine for the return value to be equal to StringWithinTransport(), and it is desirable but
+// not required/guaranteed that it will be a valid input to Transport().ParseReference().
+// Returns "" if configuration identities for these references are not supported.
+func (ref sshReference) PolicyConfigurationIdentity() string {
+	// NOTE: The user and ref.image are not a part of the image identity, for the same reasons as in the oci: transport.
+	return joinHostPort(ref.host, ref.port) + ref.path
+}
+
+// PolicyConfigurationNamespaces returns a list of other policy configuration namespaces to search
+// for if explicit configuration for PolicyConfigurationIdentity() is not set.  The list will be processed
+// in order, terminating on first match, and an implicit "" is always checked at the end.
+// It is STRONGLY recommended for the first element, if any, to be a prefix of PolicyConfigurationIdentity(),
+// and each following element to be a prefix of the element preceding it.
+func (ref sshReference) PolicyConfigurationNamespaces() []string {
+	hostPort := joinHostPort(ref.host, ref.port)
+	res := []string{}
+	remotePath := ref.path
+	for remotePath != "/" {
+		res = append(res, hostPort+remotePath)
+		remotePath = path.Dir(remotePath)
+	}
+	return append(res, hostPort)
+}
+
+// NewImage returns a types.ImageCloser for this reference, possibly specialized for this ImageTransport.
+// The caller must call .Close() on the returned ImageCloser.
+// NOTE: If any kind of signature verification should happen, build an UnparsedImage from the value returned by NewImageSource,
+// verify that UnparsedImage, and convert it into a real Image via image.FromUnparsedImage.
+// WARNING: This may not do the right thing for a manifest list, see image.FromSource for details.
+func (ref sshReference) NewImage(ctx context.Context, sys *types.SystemContext) (types.ImageCloser, error) {
+	return image.FromReference(ctx, sys, ref)
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref sshReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	return newImageSource(ctx, sys, ref)
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref sshReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	return newImageDestination(ctx, sys, ref)
+}
+
+// DeleteImage deletes the named image from the registry, if supported.
+func (ref sshReference) DeleteImage(ctx context.Context, sys *types.SystemContext) error {
+	return errors.New("Deleting images not implemented for ssh: images")
+}
+
+// filePath returns the path of a file at relativePath within the layout.
+func (ref sshReference) filePath(relativePath string) string {
+	return path.Join(ref.path, relativePath)
+}
+
+// blobPath returns the path of the file containing the blob with digest d.
+func (ref sshReference) blobPath(d digest.Digest) (string, error) {
+	if err := d.Validate(); err != nil {
+		return "", fmt.Errorf("unexpected digest reference %s: %w", d, err)
+	}
+	if ref.format == formatDir {
+		return ref.filePath(d.Encoded()), nil
+	}
+	return ref.filePath(path.Join("blobs", d.Algorithm().String(), d.Encoded())), nil
+}
+
+// dirManifestPath returns the path of a manifest within a dir layout.
+func (ref sshReference) dirManifestPath(instanceDigest *digest.Digest) string {
+	if instanceDigest != nil {
+		return ref.filePath(instanceDigest.Encoded() + ".manifest.json")
+	}
+	return ref.filePath("manifest.json")
+}
+
+// dirSignaturePath returns the path of a signature within a dir layout.
+func (ref sshReference) dirSignaturePath(index int, instanceDigest *digest.Digest) string {
+	if instanceDigest != nil {
+		return ref.filePath(fmt.Sprintf("%s.signature-%d", instanceDigest.Encoded(), index+1))
+	}
+	return ref.filePath(fmt.Sprintf("signature-%d", index+1))
+}
@@ -0,0 +1,118 @@
+package ssh
+
+import (
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransportName(t *testing.T) {
+	assert.Equal(t, "ssh", Transport.Name())
+}
+
+func TestTransportValidatePolicyConfigurationScope(t *testing.T) {
+	for _, scope := range []string{
+		"example.com",
+		"example.com:2222",
+		"example.com/srv/images",
+		"[::1]:2222/srv",
+	} {
+		err := Transport.ValidatePolicyConfigurationScope(scope)
+		assert.NoError(t, err, scope)
+	}
+
+	for _, scope := range []string{
+		"example.com:22",
+		"user@example.com/srv",
+		"example.com/",
+		"example.com/srv/",
+		"example.com/srv/../a",
+		"example.com/srv:a",
+		"example.com:x/srv",
+	} {
+		err := Transport.ValidatePolicyConfigurationScope(scope)
+		assert.Error(t, err, scope)
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	for _, c := range []struct {
+		input, format, user, host string
+		port                      int
+		path, image, roundtrip    string
+	}{
+		{"dir://example.com/srv/img", "dir", "", "example.com", 22, "/srv/img", "", "dir://example.com/srv/img"},
+		{"dir://user@example.com:22/srv/img", "dir", "user", "example.com", 22, "/srv/img", "", "dir://user@example.com/srv/img"},
+		{"oci://example.com:2222/srv/layout", "oci", "", "example.com", 2222, "/srv/layout", "", "oci://example.com:2222/srv/layout"},
+		{"oci://user@example.com/srv/layout:img:tag", "oci", "user", "example.com", 22, "/srv/layout", "img:tag", "oci://user@example.com/srv/layout:img:tag"},
+		{"oci://[::1]:2222/srv/layout:img", "oci", "", "::1", 2222, "/srv/layout", "img", "oci://[::1]:2222/srv/layout:img"},
+		{"oci://example.com/srv/layout:@linux/amd64", "oci", "", "example.com", 22, "/srv/layout", "@linux/amd64", "oci://example.com/srv/layout:@linux/amd64"},
+		{"example.com/srv/img", "", "", "", 0, "", "", ""},          // Missing format
+		{"tar://example.com/srv/img", "", "", "", 0, "", "", ""},    // Unsupported format
+		{"dir://example.com", "", "", "", 0, "", "", ""},            // Missing path
+		{"dir://example.com/", "", "", "", 0, "", "", ""},           // Path is /
+		{"dir://example.com/srv/", "", "", "", 0, "", "", ""},       // Unclean path
+		{"dir://example.com/srv:img", "", "", "", 0, "", "", ""},    // Image with a dir layout
+		{"dir://@example.com/srv", "", "", "", 0, "", "", ""},       // Empty user
+		{"dir://example.com:0/srv", "", "", "", 0, "", "", ""},      // Invalid port
+		{"oci://example.com/srv:@linux", "", "", "", 0, "", "", ""}, // Invalid platform selector
+	} {
+		ref, err := ParseReference(c.input)
+		if c.format == "" {
+			assert.Error(t, err, c.input)
+			continue
+		}
+		require.NoError(t, err, c.input)
+		sshRef, ok := ref.(sshReference)
+		require.True(t, ok, c.input)
+		assert.Equal(t, c.format, sshRef.format, c.input)
+		assert.Equal(t, c.user, sshRef.user, c.input)
+		assert.Equal(t, c.host, sshRef.host, c.input)
+		assert.Equal(t, c.port, sshRef.port, c.input)
+		assert.Equal(t, c.path, sshRef.path, c.input)
+		assert.Equal(t, c.image, sshRef.image, c.input)
+		assert.Equal(t, c.roundtrip, ref.StringWithinTransport(), c.input)
+		assert.Nil(t, ref.DockerReference(), c.input)
+	}
+}
+
+func TestReferencePolicyConfiguration(t *testing.T) {
+	ref, err := ParseReference("oci://user@example.com:2222/srv/layouts/a:img")
+	require.NoError(t, err)
+	assert.Equal(t, "example.com:2222/srv/layouts/a", ref.PolicyConfigurationIdentity())
+	assert.Equal(t, []string{"example.com:2222/srv/layouts/a", "example.com:2222/srv/layouts", "example.com:2222/srv", "example.com:2222"},
+		ref.PolicyConfigurationNamespaces())
+	for _, ns := range ref.PolicyConfigurationNamespaces() {
+		assert.NoError(t, Transport.ValidatePolicyConfigurationScope(ns), ns)
+	}
+}
+
+func TestReferencePaths(t *testing.T) {
+	const d = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	ref, err := ParseReference("oci://example.com/srv/layout")
+	require.NoError(t, err)
+	blobPath, err := ref.(sshReference).blobPath(d)
+	require.NoError(t, err)
+	assert.Equal(t, "/srv/layout/blobs/sha256/0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", blobPath)
+	_, err = ref.(sshReference).blobPath("sha256:../../index.json")
+	assert.Error(t, err)
+
+	ref, err = ParseReference("dir://example.com/srv/dir")
+	require.NoError(t, err)
+	dirRef := ref.(sshReference)
+	blobPath, err = dirRef.blobPath(d)
+	require.NoError(t, err)
+	assert.Equal(t, "/srv/dir/0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef", blobPath)
+	assert.Equal(t, "/srv/dir/manifest.json", dirRef.dirManifestPath(nil))
+	instance := digest.Digest(d)
+	assert.Equal(t, "/srv/dir/0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef.manifest.json", dirRef.dirManifestPath(&instance))
+	assert.Equal(t, "/srv/dir/signature-1", dirRef.dirSignaturePath(0, nil))
+}
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, `'/a b'`, shellQuote("/a b"))
+	assert.Equal(t, `'it'\''s'`, shellQuote("it's"))
+}
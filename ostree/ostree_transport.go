@@ -23,6 +23,10 @@ import (
 const defaultOSTreeRepo = "/ostree/repo"
 
 // Transport is an ImageTransport for ostree paths.
+//
+// Deprecated: The transport uses a layout specific to this package, and does not support the OSTree native container
+// format, where OSTree commits are encapsulated in ordinary OCI images; such images can be copied using any other transport,
+// and converted to or from OSTree commits using ostree-rs-ext.
 var Transport = ostreeTransport{}
 
 type ostreeTransport struct{}
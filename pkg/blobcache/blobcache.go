@@ -77,6 +77,12 @@ func (b *BlobCache) DeleteImage(ctx context.Context, sys *types.SystemContext) e
 	return b.reference.DeleteImage(ctx, sys)
 }
 
+// SupportsDeleteImage returns true if the underlying reference supports DeleteImage.
+// This implements transports.DeletionSupportReporter.
+func (b *BlobCache) SupportsDeleteImage() bool {
+	return transports.SupportsDeleteImage(b.reference)
+}
+
 // blobPath returns the path appropriate for storing a blob with digest.
 func (b *BlobCache) blobPath(digest digest.Digest, isConfig bool) string {
 	baseName := digest.String()
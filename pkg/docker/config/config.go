@@ -11,9 +11,11 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/image/v5/pkg/logging"
 	"github.com/containers/image/v5/pkg/sysregistriesv2"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage/pkg/homedir"
@@ -21,19 +23,28 @@ import (
 	helperclient "github.com/docker/docker-credential-helpers/client"
 	"github.com/docker/docker-credential-helpers/credentials"
 	"github.com/hashicorp/go-multierror"
-	"github.com/sirupsen/logrus"
 )
 
 type dockerAuthConfig struct {
-	Auth          string `json:"auth,omitempty"`
-	IdentityToken string `json:"identitytoken,omitempty"`
+	Auth          string     `json:"auth,omitempty"`
+	IdentityToken string     `json:"identitytoken,omitempty"`
+	ExpiresAt     *time.Time `json:"expiresAt,omitempty"` // An extension, not used by Docker
+	// Extensions, not used by Docker: absolute paths to a TLS client certificate and key for the registry.
+	ClientCertificate string `json:"clientCertificate,omitempty"`
+	ClientKey         string `json:"clientKey,omitempty"`
 }
 
 type dockerConfigFile struct {
 	AuthConfigs map[string]dockerAuthConfig `json:"auths"`
 	CredHelpers map[string]string           `json:"credHelpers,omitempty"`
+	// CredsStore, if set, is the default credential helper for registries without a CredHelpers entry,
+	// as used by docker/cli.
+	CredsStore string `json:"credsStore,omitempty"`
 }
 
+// dockerIOServerURL is the key used for docker.io credentials by docker/cli.
+const dockerIOServerURL = "https://index.docker.io/v1/"
+
 var (
 	defaultPerUIDPathFormat = filepath.FromSlash("/run/containers/%d/auth.json")
 	xdgConfigHomePath       = filepath.FromSlash("containers/auth.json")
@@ -50,11 +61,12 @@ var (
 )
 
 // authPath combines a path to a file with container registry credentials,
-// along with expected properties of that path (currently just whether it's
-// legacy format or not).
+// along with expected properties of that path (whether it's legacy format or not,
+// and the key to use if the file is encrypted).
 type authPath struct {
-	path         string
-	legacyFormat bool
+	path          string
+	legacyFormat  bool
+	encryptionKey []byte // nil if not set by the user
 }
 
 // newAuthPathDefault constructs an authPath in non-legacy format.
@@ -65,6 +77,7 @@ func newAuthPathDefault(path string) authPath {
 // GetAllCredentials returns the registry credentials for all registries stored
 // in any of the configured credential helpers.
 func GetAllCredentials(sys *types.SystemContext) (map[string]types.DockerAuthConfig, error) {
+	logger := logging.For(sys)
 	// To keep things simple, let's first extract all registries from all
 	// possible sources, and then call `GetCredentials` on them.  That
 	// prevents us from having to reverse engineer the logic in
@@ -75,6 +88,17 @@ func GetAllCredentials(sys *types.SystemContext) (map[string]types.DockerAuthCon
 	// While we're at it, we’ll also canonicalize docker.io to the standard format.
 	normalizedDockerIORegistry := normalizeRegistry("docker.io")
 
+	envKeys, err := envCredentialKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range envKeys {
+		if key == normalizedDockerIORegistry {
+			key = "docker.io"
+		}
+		allKeys.Add(key)
+	}
+
 	helpers, err := sysregistriesv2.CredentialHelpers(sys)
 	if err != nil {
 		return nil, err
@@ -83,7 +107,11 @@ func GetAllCredentials(sys *types.SystemContext) (map[string]types.DockerAuthCon
 		switch helper {
 		// Special-case the built-in helper for auth files.
 		case sysregistriesv2.AuthenticationFileHelper:
-			for _, path := range getAuthFilePaths(sys, homedir.Get()) {
+			paths, err := getAuthFilePaths(sys, homedir.Get())
+			if err != nil {
+				return nil, err
+			}
+			for _, path := range paths {
 				// parse returns an empty map in case the path doesn't exist.
 				fileContents, err := path.parse()
 				if err != nil {
@@ -95,6 +123,22 @@ func GetAllCredentials(sys *types.SystemContext) (map[string]types.DockerAuthCon
 				for registry := range fileContents.CredHelpers {
 					allKeys.Add(registry)
 				}
+				if fileContents.CredsStore != "" {
+					creds, err := listCredsInCredHelper(fileContents.CredsStore)
+					if err != nil {
+						logger.Debugf("Error listing credentials stored in credential helper %s: %v", fileContents.CredsStore, err)
+						if !errors.Is(err, exec.ErrNotFound) {
+							return nil, err
+						}
+					}
+					for registry := range creds {
+						key := normalizeAuthFileKey(registry, false)
+						if key == normalizedDockerIORegistry {
+							key = "docker.io"
+						}
+						allKeys.Add(key)
+					}
+				}
 				for key := range fileContents.AuthConfigs {
 					key := normalizeAuthFileKey(key, path.legacyFormat)
 					if key == normalizedDockerIORegistry {
@@ -107,7 +151,7 @@ func GetAllCredentials(sys *types.SystemContext) (map[string]types.DockerAuthCon
 		default:
 			creds, err := listCredsInCredHelper(helper)
 			if err != nil {
-				logrus.Debugf("Error listing credentials stored in credential helper %s: %v", helper, err)
+				logger.Debugf("Error listing credentials stored in credential helper %s: %v", helper, err)
 				if errors.Is(err, exec.ErrNotFound) {
 					creds = nil // It's okay if the helper doesn't exist.
 				} else {
@@ -141,16 +185,21 @@ func GetAllCredentials(sys *types.SystemContext) (map[string]types.DockerAuthCon
 // in the order they should be searched. Note that some paths may not exist.
 // The homeDir parameter should always be homedir.Get(), and is only intended to be overridden
 // by tests.
-func getAuthFilePaths(sys *types.SystemContext, homeDir string) []authPath {
+func getAuthFilePaths(sys *types.SystemContext, homeDir string) ([]authPath, error) {
+	logger := logging.For(sys)
 	paths := []authPath{}
-	pathToAuth, userSpecifiedPath, err := getPathToAuth(sys)
+	pathToAuth, userSpecifiedPath, err := getPathToAuthWithOS(sys, runtime.GOOS)
 	if err == nil {
+		pathToAuth.encryptionKey, err = authFileEncryptionKey(sys)
+		if err != nil {
+			return nil, err
+		}
 		paths = append(paths, pathToAuth)
 	} else {
 		// Error means that the path set for XDG_RUNTIME_DIR does not exist
 		// but we don't want to completely fail in the case that the user is pulling a public image
 		// Logging the error as a warning instead and moving on to pulling the image
-		logrus.Warnf("%v: Trying to pull image in the event that it is a public image.", err)
+		logger.Warnf("%v: Trying to pull image in the event that it is a public image.", err)
 	}
 	if !userSpecifiedPath {
 		xdgCfgHome := os.Getenv("XDG_CONFIG_HOME")
@@ -169,7 +218,7 @@ func getAuthFilePaths(sys *types.SystemContext, homeDir string) []authPath {
 			authPath{path: filepath.Join(homeDir, dockerLegacyHomePath), legacyFormat: true},
 		)
 	}
-	return paths
+	return paths, nil
 }
 
 // GetCredentials returns the registry credentials matching key, appropriate for
@@ -190,18 +239,81 @@ func GetCredentialsForRef(sys *types.SystemContext, ref reference.Named) (types.
 	return getCredentialsWithHomeDir(sys, ref.Name(), homedir.Get())
 }
 
+// CredentialsSource describes where credentials returned by GetCredentialsForRefWithSource
+// or GetCredentialsForPullSource were found.
+type CredentialsSource struct {
+	// AuthFileKey is set if the credentials were read from the auth file that SetCredentials and SetIdentityToken
+	// write to; it is the key the credentials are stored under, so that updated credentials can replace them.
+	// It is "" if the credentials were found elsewhere, e.g. in sys.DockerAuthConfig, environment variables,
+	// a credential helper, or a read-only auth file.
+	AuthFileKey string
+}
+
+// GetCredentialsForRefWithSource is like GetCredentialsForRef, but also returns where the credentials were found.
+func GetCredentialsForRefWithSource(sys *types.SystemContext, ref reference.Named) (types.DockerAuthConfig, CredentialsSource, error) {
+	return getCredentialsAndSourceWithHomeDir(sys, ref.Name(), homedir.Get())
+}
+
+// GetPullSources returns the locations ref may be pulled from (mirrors first,
+// then the primary location), as configured in registries.conf and appropriate for sys.
+// Use GetCredentialsForPullSource to look up credentials for each of them, only when they are actually needed.
+func GetPullSources(sys *types.SystemContext, ref reference.Named) ([]sysregistriesv2.PullSource, error) {
+	registry, err := sysregistriesv2.FindRegistry(sys, ref.Name())
+	if err != nil {
+		return nil, fmt.Errorf("loading registries configuration: %w", err)
+	}
+	if registry == nil {
+		// No configuration was found for the provided reference, so use the
+		// equivalent of a default configuration.
+		registry = &sysregistriesv2.Registry{
+			Endpoint: sysregistriesv2.Endpoint{
+				Location: ref.String(),
+			},
+			Prefix: ref.String(),
+		}
+	}
+	return registry.PullSourcesFromReference(ref)
+}
+
+// GetCredentialsForPullSource returns the registry credentials necessary for accessing
+// pullSource (as returned by GetPullSources for ref), appropriate for sys and the users’ configuration.
+// If an entry is not found, an empty struct is returned.
+// It also returns where the credentials were found.
+//
+// Note that sys.DockerAuthConfig does not specify a registry; it is only used for locations
+// on the same registry as ref, never for mirrors on other registries.
+func GetCredentialsForPullSource(sys *types.SystemContext, ref reference.Named, pullSource sysregistriesv2.PullSource) (types.DockerAuthConfig, CredentialsSource, error) {
+	if sys != nil && sys.DockerAuthConfig != nil && reference.Domain(pullSource.Reference) != reference.Domain(ref) {
+		copy := *sys
+		copy.DockerAuthConfig = nil
+		sys = &copy
+	}
+	creds, source, err := getCredentialsAndSourceWithHomeDir(sys, pullSource.Reference.Name(), homedir.Get())
+	if err != nil {
+		return types.DockerAuthConfig{}, CredentialsSource{}, fmt.Errorf("getting credentials for %s: %w", pullSource.Reference.Name(), err)
+	}
+	return creds, source, nil
+}
+
 // getCredentialsWithHomeDir is an internal implementation detail of
 // GetCredentialsForRef and GetCredentials. It exists only to allow testing it
 // with an artificial home directory.
 func getCredentialsWithHomeDir(sys *types.SystemContext, key, homeDir string) (types.DockerAuthConfig, error) {
+	creds, _, err := getCredentialsAndSourceWithHomeDir(sys, key, homeDir)
+	return creds, err
+}
+
+// getCredentialsAndSourceWithHomeDir is like getCredentialsWithHomeDir, but also returns where the credentials were found.
+func getCredentialsAndSourceWithHomeDir(sys *types.SystemContext, key, homeDir string) (types.DockerAuthConfig, CredentialsSource, error) {
+	logger := logging.For(sys)
 	_, err := validateKey(key)
 	if err != nil {
-		return types.DockerAuthConfig{}, err
+		return types.DockerAuthConfig{}, CredentialsSource{}, err
 	}
 
 	if sys != nil && sys.DockerAuthConfig != nil {
-		logrus.Debugf("Returning credentials for %s from DockerAuthConfig", key)
-		return *sys.DockerAuthConfig, nil
+		logger.Debugf("Returning credentials for %s from DockerAuthConfig", key)
+		return *sys.DockerAuthConfig, CredentialsSource{}, nil
 	}
 
 	var registry string // We compute this once because it is used in several places.
@@ -211,30 +323,67 @@ func getCredentialsWithHomeDir(sys *types.SystemContext, key, homeDir string) (t
 		registry = key
 	}
 
+	// Environment variables take precedence over all credential helpers and auth files.
+	creds, envVar, err := getCredentialsFromEnv(logger, key, registry)
+	if err != nil {
+		return types.DockerAuthConfig{}, CredentialsSource{}, err
+	}
+	// Client certificate settings found in entries without credentials; they are used with credentials
+	// found in any later source, and returned on their own if there are no such credentials.
+	var certOnly types.DockerAuthConfig
+	if isClientCertificateOnly(creds) {
+		logger.Debugf("Found a client certificate for %s in environment variable %s, looking for credentials elsewhere", key, envVar)
+		certOnly = creds
+	} else if creds != (types.DockerAuthConfig{}) {
+		logger.Debugf("Returning credentials for %s from environment variable %s", key, envVar)
+		return creds, CredentialsSource{}, nil
+	}
+
+	helpers, err := sysregistriesv2.CredentialHelpers(sys)
+	if err != nil {
+		return types.DockerAuthConfig{}, CredentialsSource{}, err
+	}
+	// The auth file setCredentials would modify, if any: it uses only the first helper which succeeds.
+	writableAuthFile := ""
+	if (len(helpers) != 0 && helpers[0] == sysregistriesv2.AuthenticationFileHelper) || (sys != nil && sys.DockerCompatAuthFilePath != "") {
+		if path, _, err := getPathToAuth(sys); err == nil && !path.legacyFormat {
+			writableAuthFile = path.path
+		}
+	}
+
 	// Anonymous function to query credentials from auth files.
-	getCredentialsFromAuthFiles := func() (types.DockerAuthConfig, string, error) {
-		for _, path := range getAuthFilePaths(sys, homeDir) {
-			creds, err := findCredentialsInFile(key, registry, path)
+	getCredentialsFromAuthFiles := func() (types.DockerAuthConfig, string, CredentialsSource, error) {
+		paths, err := getAuthFilePaths(sys, homeDir)
+		if err != nil {
+			return types.DockerAuthConfig{}, "", CredentialsSource{}, err
+		}
+		for _, path := range paths {
+			creds, authFileKey, err := findCredentialsInFile(logger, key, registry, path)
 			if err != nil {
-				return types.DockerAuthConfig{}, "", err
+				return types.DockerAuthConfig{}, "", CredentialsSource{}, err
 			}
 
+			if isClientCertificateOnly(creds) {
+				logger.Debugf("Found a client certificate for %s in %s, looking for credentials elsewhere", key, path.path)
+				certOnly = withClientCertificate(certOnly, creds)
+				continue
+			}
 			if creds != (types.DockerAuthConfig{}) {
-				return creds, path.path, nil
+				source := CredentialsSource{}
+				if path.path == writableAuthFile && !path.legacyFormat {
+					source.AuthFileKey = authFileKey
+				}
+				return creds, path.path, source, nil
 			}
 		}
-		return types.DockerAuthConfig{}, "", nil
-	}
-
-	helpers, err := sysregistriesv2.CredentialHelpers(sys)
-	if err != nil {
-		return types.DockerAuthConfig{}, err
+		return types.DockerAuthConfig{}, "", CredentialsSource{}, nil
 	}
 
 	var multiErr error
 	for _, helper := range helpers {
 		var (
 			creds          types.DockerAuthConfig
+			source         CredentialsSource
 			helperKey      string
 			credHelperPath string
 			err            error
@@ -243,16 +392,16 @@ func getCredentialsWithHomeDir(sys *types.SystemContext, key, homeDir string) (t
 		// Special-case the built-in helper for auth files.
 		case sysregistriesv2.AuthenticationFileHelper:
 			helperKey = key
-			creds, credHelperPath, err = getCredentialsFromAuthFiles()
+			creds, credHelperPath, source, err = getCredentialsFromAuthFiles()
 		// External helpers.
 		default:
 			// This intentionally uses "registry", not "key"; we don't support namespaced
 			// credentials in helpers, but a "registry" is a valid parent of "key".
 			helperKey = registry
-			creds, err = getCredsFromCredHelper(helper, registry)
+			creds, err = getCredsFromCredHelper(logger, helper, registry)
 		}
 		if err != nil {
-			logrus.Debugf("Error looking up credentials for %s in credential helper %s: %v", helperKey, helper, err)
+			logger.Debugf("Error looking up credentials for %s in credential helper %s: %v", helperKey, helper, err)
 			multiErr = multierror.Append(multiErr, err)
 			continue
 		}
@@ -261,16 +410,35 @@ func getCredentialsWithHomeDir(sys *types.SystemContext, key, homeDir string) (t
 			if credHelperPath != "" {
 				msg = fmt.Sprintf("%s in file %s", msg, credHelperPath)
 			}
-			logrus.Debug(msg)
-			return creds, nil
+			logger.Debugf("%s", msg)
+			return withClientCertificate(creds, certOnly), source, nil
 		}
 	}
 	if multiErr != nil {
-		return types.DockerAuthConfig{}, multiErr
+		return types.DockerAuthConfig{}, CredentialsSource{}, multiErr
 	}
 
-	logrus.Debugf("No credentials for %s found", key)
-	return types.DockerAuthConfig{}, nil
+	if certOnly != (types.DockerAuthConfig{}) {
+		logger.Debugf("No credentials for %s found, using only a client certificate", key)
+		return certOnly, CredentialsSource{}, nil
+	}
+	logger.Debugf("No credentials for %s found", key)
+	return types.DockerAuthConfig{}, CredentialsSource{}, nil
+}
+
+// isClientCertificateOnly returns true if creds only specifies a client certificate, without any credentials.
+func isClientCertificateOnly(creds types.DockerAuthConfig) bool {
+	return creds.Username == "" && creds.Password == "" && creds.IdentityToken == "" &&
+		(creds.ClientCertificatePath != "" || creds.ClientKeyPath != "")
+}
+
+// withClientCertificate returns creds, using the client certificate from cert if creds does not specify one.
+func withClientCertificate(creds, cert types.DockerAuthConfig) types.DockerAuthConfig {
+	if creds.ClientCertificatePath == "" && creds.ClientKeyPath == "" {
+		creds.ClientCertificatePath = cert.ClientCertificatePath
+		creds.ClientKeyPath = cert.ClientKeyPath
+	}
+	return creds
 }
 
 // GetAuthentication returns the registry credentials matching key, appropriate for
@@ -307,6 +475,32 @@ func getAuthenticationWithHomeDir(sys *types.SystemContext, key, homeDir string)
 // NOTE: The return value is only intended to be read by humans; its form is not an API,
 // it may change (or new forms can be added) any time.
 func SetCredentials(sys *types.SystemContext, key, username, password string) (string, error) {
+	return setCredentials(sys, key, types.DockerAuthConfig{Username: username, Password: password})
+}
+
+// SetIdentityToken stores an OAuth2 identity token (a refresh token, e.g. one rotated by the registry’s
+// token endpoint) for username in a location appropriate for sys and the users’ configuration,
+// replacing any credentials previously stored for key.
+// See the documentation of SetCredentials for format of "key" and of the return value.
+func SetIdentityToken(sys *types.SystemContext, key, username, identityToken string) (string, error) {
+	if identityToken == "" {
+		return "", errors.New("an empty identity token can not be stored")
+	}
+	return setCredentials(sys, key, types.DockerAuthConfig{Username: username, IdentityToken: identityToken})
+}
+
+// SetCredentialsWithExpiry is like SetCredentials, but also records that the credentials expire at expiresAt.
+// The expiration time is returned by GetCredentials in types.DockerAuthConfig.ExpiresAt, and can be used to refresh
+// the credentials before they expire, see types.SystemContext.DockerCredentialsRefresh.
+// Note that the expiration time is not recorded if the credentials are stored in a credential helper.
+func SetCredentialsWithExpiry(sys *types.SystemContext, key, username, password string, expiresAt time.Time) (string, error) {
+	return setCredentials(sys, key, types.DockerAuthConfig{Username: username, Password: password, ExpiresAt: expiresAt})
+}
+
+// setCredentials is the shared implementation of SetCredentials, SetCredentialsWithExpiry and SetIdentityToken.
+// If creds.IdentityToken is set, creds.Password is ignored.
+func setCredentials(sys *types.SystemContext, key string, creds types.DockerAuthConfig) (string, error) {
+	logger := logging.For(sys)
 	helpers, jsonEditor, key, isNamespaced, err := prepareForEdit(sys, key, true)
 	if err != nil {
 		return "", err
@@ -321,18 +515,32 @@ func SetCredentials(sys *types.SystemContext, key, username, password string) (s
 		// Special-case the built-in helpers for auth files.
 		case sysregistriesv2.AuthenticationFileHelper:
 			desc, err = jsonEditor(sys, func(fileContents *dockerConfigFile) (bool, string, error) {
+				// A namespaced key is only passed to a credential helper if the user has explicitly
+				// configured a credHelpers entry for that namespace.
 				if ch, exists := fileContents.CredHelpers[key]; exists {
-					if isNamespaced {
-						return false, "", unsupportedNamespaceErr(ch)
-					}
-					desc, err := setCredsInCredHelper(ch, key, username, password)
+					desc, err := setCredsInCredHelper(ch, key, creds)
 					if err != nil {
 						return false, "", err
 					}
 					return false, desc, nil
 				}
-				creds := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
-				newCreds := dockerAuthConfig{Auth: creds}
+				if fileContents.CredsStore != "" && !isNamespaced {
+					desc, err := setCredsInCredHelper(fileContents.CredsStore, credsStoreServerURL(key), creds)
+					if err != nil {
+						return false, "", err
+					}
+					// Like docker/cli, record an entry without credentials so that the registry is listed as logged in.
+					// Preserve the client certificate configuration, which is not a part of the login.
+					fileContents.AuthConfigs[key] = dockerAuthConfig{
+						ClientCertificate: fileContents.AuthConfigs[key].ClientCertificate,
+						ClientKey:         fileContents.AuthConfigs[key].ClientKey,
+					}
+					return true, desc, nil
+				}
+				newCreds := encodeDockerAuth(creds)
+				// Preserve the client certificate configuration, which is not a part of the login.
+				newCreds.ClientCertificate = fileContents.AuthConfigs[key].ClientCertificate
+				newCreds.ClientKey = fileContents.AuthConfigs[key].ClientKey
 				fileContents.AuthConfigs[key] = newCreds
 				return true, "", nil
 			})
@@ -341,20 +549,60 @@ func SetCredentials(sys *types.SystemContext, key, username, password string) (s
 			if isNamespaced {
 				err = unsupportedNamespaceErr(helper)
 			} else {
-				desc, err = setCredsInCredHelper(helper, key, username, password)
+				desc, err = setCredsInCredHelper(helper, key, creds)
 			}
 		}
 		if err != nil {
 			multiErr = multierror.Append(multiErr, err)
-			logrus.Debugf("Error storing credentials for %s in credential helper %s: %v", key, helper, err)
+			logger.Debugf("Error storing credentials for %s in credential helper %s: %v", key, helper, err)
 			continue
 		}
-		logrus.Debugf("Stored credentials for %s in credential helper %s", key, helper)
+		logger.Debugf("Stored credentials for %s in credential helper %s", key, helper)
 		return desc, nil
 	}
 	return "", multiErr
 }
 
+// SetClientCertificate records, in the auth file appropriate for sys and the users’ configuration,
+// that the TLS client certificate at certPath with the private key at keyPath should be used
+// for registries matching key. Both paths must be absolute.
+// If certPath and keyPath are both "", the client certificate configuration for key is removed.
+// See the documentation of SetCredentials for format of "key" and of the return value.
+func SetClientCertificate(sys *types.SystemContext, key, certPath, keyPath string) (string, error) {
+	if err := validateClientCertificatePaths(certPath, keyPath); err != nil {
+		return "", err
+	}
+	_, jsonEditor, key, _, err := prepareForEdit(sys, key, true)
+	if err != nil {
+		return "", err
+	}
+	return jsonEditor(sys, func(fileContents *dockerConfigFile) (bool, string, error) {
+		entry := fileContents.AuthConfigs[key]
+		entry.ClientCertificate = certPath
+		entry.ClientKey = keyPath
+		if entry == (dockerAuthConfig{}) {
+			delete(fileContents.AuthConfigs, key)
+		} else {
+			fileContents.AuthConfigs[key] = entry
+		}
+		return true, "", nil
+	})
+}
+
+// validateClientCertificatePaths verifies that certPath and keyPath are either both "", or both absolute paths.
+func validateClientCertificatePaths(certPath, keyPath string) error {
+	if certPath == "" && keyPath == "" {
+		return nil
+	}
+	if certPath == "" || keyPath == "" {
+		return errors.New("a client certificate and a private key must be specified together")
+	}
+	if !filepath.IsAbs(certPath) || !filepath.IsAbs(keyPath) {
+		return fmt.Errorf("client certificate path %q and private key path %q must be absolute", certPath, keyPath)
+	}
+	return nil
+}
+
 func unsupportedNamespaceErr(helper string) error {
 	return fmt.Errorf("namespaced key is not supported for credential helper %s", helper)
 }
@@ -371,6 +619,7 @@ func SetAuthentication(sys *types.SystemContext, key, username, password string)
 // A valid key is a repository, a namespace within a registry, or a registry hostname;
 // using forms other than just a registry may fail depending on configuration.
 func RemoveAuthentication(sys *types.SystemContext, key string) error {
+	logger := logging.For(sys)
 	helpers, jsonEditor, key, isNamespaced, err := prepareForEdit(sys, key, true)
 	if err != nil {
 		return err
@@ -379,19 +628,21 @@ func RemoveAuthentication(sys *types.SystemContext, key string) error {
 	var multiErr error
 	isLoggedIn := false
 
-	removeFromCredHelper := func(helper string) {
-		if isNamespaced {
-			logrus.Debugf("Not removing credentials because namespaced keys are not supported for the credential helper: %s", helper)
+	// explicitNamespace is true if the auth file contains a credHelpers entry for a namespaced key.
+	// serverURL is the key used in the credential helper.
+	removeFromCredHelper := func(helper string, explicitNamespace bool, serverURL string) {
+		if isNamespaced && !explicitNamespace {
+			logger.Debugf("Not removing credentials because namespaced keys are not supported for the credential helper: %s", helper)
 			return
 		}
-		err := deleteCredsFromCredHelper(helper, key)
+		err := deleteCredsFromCredHelper(helper, serverURL)
 		if err == nil {
-			logrus.Debugf("Credentials for %q were deleted from credential helper %s", key, helper)
+			logger.Debugf("Credentials for %q were deleted from credential helper %s", key, helper)
 			isLoggedIn = true
 			return
 		}
 		if credentials.IsErrCredentialsNotFoundMessage(err.Error()) {
-			logrus.Debugf("Not logged in to %s with credential helper %s", key, helper)
+			logger.Debugf("Not logged in to %s with credential helper %s", key, helper)
 			return
 		}
 		multiErr = multierror.Append(multiErr, fmt.Errorf("removing credentials for %s from credential helper %s: %w", key, helper, err))
@@ -404,11 +655,18 @@ func RemoveAuthentication(sys *types.SystemContext, key string) error {
 		case sysregistriesv2.AuthenticationFileHelper:
 			_, err = jsonEditor(sys, func(fileContents *dockerConfigFile) (bool, string, error) {
 				if innerHelper, exists := fileContents.CredHelpers[key]; exists {
-					removeFromCredHelper(innerHelper)
+					removeFromCredHelper(innerHelper, true, key)
+				} else if fileContents.CredsStore != "" {
+					removeFromCredHelper(fileContents.CredsStore, false, credsStoreServerURL(key))
 				}
-				if _, ok := fileContents.AuthConfigs[key]; ok {
+				if entry, ok := fileContents.AuthConfigs[key]; ok {
 					isLoggedIn = true
-					delete(fileContents.AuthConfigs, key)
+					if entry.ClientCertificate != "" || entry.ClientKey != "" {
+						// Preserve the client certificate configuration, which is not a part of the login.
+						fileContents.AuthConfigs[key] = dockerAuthConfig{ClientCertificate: entry.ClientCertificate, ClientKey: entry.ClientKey}
+					} else {
+						delete(fileContents.AuthConfigs, key)
+					}
 				}
 				return true, "", multiErr
 			})
@@ -417,7 +675,7 @@ func RemoveAuthentication(sys *types.SystemContext, key string) error {
 			}
 		// External helpers.
 		default:
-			removeFromCredHelper(helper)
+			removeFromCredHelper(helper, false, key)
 		}
 	}
 
@@ -434,6 +692,7 @@ func RemoveAuthentication(sys *types.SystemContext, key string) error {
 // RemoveAllAuthentication deletes all the credentials stored in credential
 // helpers and auth files.
 func RemoveAllAuthentication(sys *types.SystemContext) error {
+	logger := logging.For(sys)
 	helpers, jsonEditor, _, _, err := prepareForEdit(sys, "", false)
 	if err != nil {
 		return err
@@ -454,6 +713,19 @@ func RemoveAllAuthentication(sys *types.SystemContext) error {
 						return false, "", err
 					}
 				}
+				if fileContents.CredsStore != "" {
+					// The credsStore may be shared with other tools; only erase credentials
+					// recorded in the way setCredentials records them.
+					for registry, entry := range fileContents.AuthConfigs {
+						if _, exists := fileContents.CredHelpers[registry]; exists || !isCredsStoreEntry(registry, entry) {
+							continue
+						}
+						err := deleteCredsFromCredHelper(fileContents.CredsStore, credsStoreServerURL(registry))
+						if err != nil && !credentials.IsErrCredentialsNotFoundMessage(err.Error()) {
+							return false, "", err
+						}
+					}
+				}
 				fileContents.CredHelpers = make(map[string]string)
 				fileContents.AuthConfigs = make(map[string]dockerAuthConfig)
 				return true, "", nil
@@ -478,11 +750,11 @@ func RemoveAllAuthentication(sys *types.SystemContext) error {
 			}
 		}
 		if err != nil {
-			logrus.Debugf("Error removing credentials from credential helper %s: %v", helper, err)
+			logger.Debugf("Error removing credentials from credential helper %s: %v", helper, err)
 			multiErr = multierror.Append(multiErr, err)
 			continue
 		}
-		logrus.Debugf("All credentials removed from credential helper %s", helper)
+		logger.Debugf("All credentials removed from credential helper %s", helper)
 	}
 
 	return multiErr
@@ -507,12 +779,15 @@ func prepareForEdit(sys *types.SystemContext, key string, keyRelevant bool) ([]s
 		if sys.AuthFilePath != "" {
 			return nil, nil, "", false, errors.New("AuthFilePath and DockerCompatAuthFilePath can not be set simultaneously")
 		}
+		if sys.AuthFileEncryptionKey != nil || sys.AuthFileEncryptionKeyringKey != "" {
+			return nil, nil, "", false, errors.New("Docker-compatible credential files can not be encrypted")
+		}
 		if keyRelevant {
 			if isNamespaced {
 				return nil, nil, "", false, fmt.Errorf("Credentials cannot be recorded in Docker-compatible format with namespaced key %q", key)
 			}
 			if key == "docker.io" {
-				key = "https://index.docker.io/v1/"
+				key = dockerIOServerURL
 			}
 		}
 
@@ -537,7 +812,11 @@ func listCredsInCredHelper(credHelper string) (map[string]string, error) {
 // getPathToAuth gets the path of the auth.json file used for reading and writing credentials,
 // and a boolean indicating whether the return value came from an explicit user choice (i.e. not defaults)
 func getPathToAuth(sys *types.SystemContext) (authPath, bool, error) {
-	return getPathToAuthWithOS(sys, runtime.GOOS)
+	path, userSpecified, err := getPathToAuthWithOS(sys, runtime.GOOS)
+	if err == nil {
+		path.encryptionKey, err = authFileEncryptionKey(sys)
+	}
+	return path, userSpecified, err
 }
 
 // getPathToAuthWithOS is an internal implementation detail of getPathToAuth,
@@ -587,26 +866,42 @@ func getPathToAuthWithOS(sys *types.SystemContext, goOS string) (authPath, bool,
 // or returns an empty dockerConfigFile data structure if auth.json does not exist
 // if the file exists and is empty, this function returns an error.
 func (path authPath) parse() (dockerConfigFile, error) {
+	fileContents, _, err := path.parseAllowingUnencrypted(false)
+	return fileContents, err
+}
+
+// parseAllowingUnencrypted is parse, but if allowUnencrypted, it also accepts an unencrypted file
+// when an encryption key is set, and returns needsEncryption = true in that case.
+func (path authPath) parseAllowingUnencrypted(allowUnencrypted bool) (_ dockerConfigFile, needsEncryption bool, _ error) {
 	var fileContents dockerConfigFile
 
 	raw, err := os.ReadFile(path.path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			fileContents.AuthConfigs = map[string]dockerAuthConfig{}
-			return fileContents, nil
+			return fileContents, false, nil
 		}
-		return dockerConfigFile{}, err
+		return dockerConfigFile{}, false, err
 	}
 
 	if path.legacyFormat {
 		if err = json.Unmarshal(raw, &fileContents.AuthConfigs); err != nil {
-			return dockerConfigFile{}, fmt.Errorf("unmarshaling JSON at %q: %w", path.path, err)
+			return dockerConfigFile{}, false, fmt.Errorf("unmarshaling JSON at %q: %w", path.path, err)
 		}
-		return fileContents, nil
+		return fileContents, false, nil
+	}
+
+	raw, encrypted, err := decryptAuthFileIfEncrypted(path.encryptionKey, raw)
+	if err != nil {
+		return dockerConfigFile{}, false, fmt.Errorf("reading %q: %w", path.path, err)
+	}
+	needsEncryption = path.encryptionKey != nil && !encrypted
+	if needsEncryption && !allowUnencrypted {
+		return dockerConfigFile{}, false, fmt.Errorf("%q is not encrypted, but an encryption key was provided; it is encrypted when credentials are next stored", path.path)
 	}
 
 	if err = json.Unmarshal(raw, &fileContents); err != nil {
-		return dockerConfigFile{}, fmt.Errorf("unmarshaling JSON at %q: %w", path.path, err)
+		return dockerConfigFile{}, false, fmt.Errorf("unmarshaling JSON at %q: %w", path.path, err)
 	}
 
 	if fileContents.AuthConfigs == nil {
@@ -616,11 +911,11 @@ func (path authPath) parse() (dockerConfigFile, error) {
 		fileContents.CredHelpers = make(map[string]string)
 	}
 
-	return fileContents, nil
+	return fileContents, needsEncryption, nil
 }
 
 // modifyJSON finds an auth.json file, calls editor on the contents, and
-// writes it back if editor returns true.
+// writes it back if editor returns true, or if the file needs to be encrypted.
 // Returns a human-readable description of the file, to be returned by SetCredentials.
 //
 // The editor may also return a human-readable description of the updated location; if it is "",
@@ -639,7 +934,8 @@ func modifyJSON(sys *types.SystemContext, editor func(fileContents *dockerConfig
 		return "", err
 	}
 
-	fileContents, err := path.parse()
+	// An unencrypted file is accepted here, so that it can be encrypted.
+	fileContents, needsEncryption, err := path.parseAllowingUnencrypted(true)
 	if err != nil {
 		return "", fmt.Errorf("reading JSON file %q: %w", path.path, err)
 	}
@@ -648,11 +944,17 @@ func modifyJSON(sys *types.SystemContext, editor func(fileContents *dockerConfig
 	if err != nil {
 		return "", fmt.Errorf("updating %q: %w", path.path, err)
 	}
-	if updated {
+	if updated || needsEncryption {
 		newData, err := json.MarshalIndent(fileContents, "", "\t")
 		if err != nil {
 			return "", fmt.Errorf("marshaling JSON %q: %w", path.path, err)
 		}
+		if path.encryptionKey != nil {
+			newData, err = encryptAuthFile(path.encryptionKey, newData)
+			if err != nil {
+				return "", fmt.Errorf("encrypting %q: %w", path.path, err)
+			}
+		}
 
 		if err = ioutils.AtomicWriteFile(path.path, newData, 0600); err != nil {
 			return "", fmt.Errorf("writing to file %q: %w", path.path, err)
@@ -717,6 +1019,11 @@ func modifyDockerConfigJSON(sys *types.SystemContext, editor func(fileContents *
 
 		}
 	}
+	if rawCS, ok := rawContents["credsStore"]; ok {
+		if err := json.Unmarshal(rawCS, &syntheticContents.CredsStore); err != nil {
+			return "", fmt.Errorf(`unmarshaling "credsStore" in JSON at %q: %w`, path, err)
+		}
+	}
 
 	updated, description, err := editor(&syntheticContents)
 	if err != nil {
@@ -728,7 +1035,7 @@ func modifyDockerConfigJSON(sys *types.SystemContext, editor func(fileContents *
 			return "", fmt.Errorf("marshaling JSON %q: %w", path, err)
 		}
 		rawContents["auths"] = rawAuths
-		// We never modify syntheticContents.CredHelpers, so we don’t need to update it.
+		// We never modify syntheticContents.CredHelpers or syntheticContents.CredsStore, so we don’t need to update them.
 		newData, err := json.MarshalIndent(rawContents, "", "\t")
 		if err != nil {
 			return "", fmt.Errorf("marshaling JSON %q: %w", path, err)
@@ -745,13 +1052,13 @@ func modifyDockerConfigJSON(sys *types.SystemContext, editor func(fileContents *
 	return description, nil
 }
 
-func getCredsFromCredHelper(credHelper, registry string) (types.DockerAuthConfig, error) {
+func getCredsFromCredHelper(logger types.Logger, credHelper, registry string) (types.DockerAuthConfig, error) {
 	helperName := fmt.Sprintf("docker-credential-%s", credHelper)
 	p := helperclient.NewShellProgramFunc(helperName)
 	creds, err := helperclient.Get(p, registry)
 	if err != nil {
 		if credentials.IsErrCredentialsNotFoundMessage(err.Error()) {
-			logrus.Debugf("Not logged in to %s with credential helper %s", registry, credHelper)
+			logger.Debugf("Not logged in to %s with credential helper %s", registry, credHelper)
 			err = nil
 		}
 		return types.DockerAuthConfig{}, err
@@ -770,22 +1077,50 @@ func getCredsFromCredHelper(credHelper, registry string) (types.DockerAuthConfig
 	}
 }
 
-// setCredsInCredHelper stores (username, password) for registry in credHelper.
+// setCredsInCredHelper stores creds for registry in credHelper.
+// Identity tokens are stored using the "<token>" username convention understood by getCredsFromCredHelper.
 // Returns a human-readable description of the destination, to be returned by SetCredentials.
-func setCredsInCredHelper(credHelper, registry, username, password string) (string, error) {
+func setCredsInCredHelper(credHelper, registry string, creds types.DockerAuthConfig) (string, error) {
 	helperName := fmt.Sprintf("docker-credential-%s", credHelper)
 	p := helperclient.NewShellProgramFunc(helperName)
-	creds := &credentials.Credentials{
+	helperCreds := &credentials.Credentials{
 		ServerURL: registry,
-		Username:  username,
-		Secret:    password,
+		Username:  creds.Username,
+		Secret:    creds.Password,
+	}
+	if creds.IdentityToken != "" {
+		helperCreds.Username = "<token>"
+		helperCreds.Secret = creds.IdentityToken
 	}
-	if err := helperclient.Store(p, creds); err != nil {
+	if err := helperclient.Store(p, helperCreds); err != nil {
 		return "", err
 	}
 	return fmt.Sprintf("credential helper: %s", credHelper), nil
 }
 
+// credsStoreServerURL returns the server URL used for key in the default credsStore credential helper.
+// Like docker/cli, credentials for docker.io are stored using "https://index.docker.io/v1/".
+func credsStoreServerURL(key string) string {
+	if normalizeRegistry(key) == normalizeRegistry("docker.io") {
+		return dockerIOServerURL
+	}
+	return key
+}
+
+// isCredsStoreEntry returns true if entry, the "auths" entry for key, records that credentials for key
+// are stored in the default credsStore credential helper, as done by setCredentials.
+func isCredsStoreEntry(key string, entry dockerAuthConfig) bool {
+	if entry.Auth != "" || entry.IdentityToken != "" {
+		return false
+	}
+	if key == dockerIOServerURL {
+		return true
+	}
+	// Namespaced keys are never stored in credsStore.
+	isNamespaced, err := validateKey(key)
+	return err == nil && !isNamespaced
+}
+
 func deleteCredsFromCredHelper(credHelper, registry string) error {
 	helperName := fmt.Sprintf("docker-credential-%s", credHelper)
 	p := helperclient.NewShellProgramFunc(helperName)
@@ -794,25 +1129,27 @@ func deleteCredsFromCredHelper(credHelper, registry string) error {
 
 // findCredentialsInFile looks for credentials matching "key"
 // (which is "registry" or a namespace in "registry") in "path".
-func findCredentialsInFile(key, registry string, path authPath) (types.DockerAuthConfig, error) {
+// See findCredentialsInConfig for the meaning of the returned string.
+func findCredentialsInFile(logger types.Logger, key, registry string, path authPath) (types.DockerAuthConfig, string, error) {
 	fileContents, err := path.parse()
 	if err != nil {
-		return types.DockerAuthConfig{}, fmt.Errorf("reading JSON file %q: %w", path.path, err)
-	}
-
-	// First try cred helpers. They should always be normalized.
-	// This intentionally uses "registry", not "key"; we don't support namespaced
-	// credentials in helpers.
-	if ch, exists := fileContents.CredHelpers[registry]; exists {
-		logrus.Debugf("Looking up in credential helper %s based on credHelpers entry in %s", ch, path.path)
-		return getCredsFromCredHelper(ch, registry)
+		return types.DockerAuthConfig{}, "", fmt.Errorf("reading JSON file %q: %w", path.path, err)
 	}
+	return findCredentialsInConfig(logger, key, registry, fileContents, path.path, path.legacyFormat)
+}
 
-	// Support sub-registry namespaces in auth.
+// findCredentialsInConfig looks for credentials matching "key"
+// (which is "registry" or a namespace in "registry") in fileContents,
+// which was read from source (a human-readable description, typically a path), in legacyFormat if set.
+// It also returns the key of the "auths" entry containing the credentials, if they were found in such an entry
+// which can be updated using that key; otherwise (e.g. if the credentials are stored in a credential helper) "".
+func findCredentialsInConfig(logger types.Logger, key, registry string, fileContents dockerConfigFile, source string, legacyFormat bool) (types.DockerAuthConfig, string, error) {
+	// Support sub-registry namespaces in auth and in credHelpers, using the
+	// longest matching prefix.
 	// (This is not a feature of ~/.docker/config.json; we support it even for
 	// those files as an extension.)
 	var keys []string
-	if !path.legacyFormat {
+	if !legacyFormat {
 		keys = authKeysForKey(key)
 	} else {
 		keys = []string{registry}
@@ -820,9 +1157,32 @@ func findCredentialsInFile(key, registry string, path authPath) (types.DockerAut
 
 	// Repo or namespace keys are only supported as exact matches. For registry
 	// keys we prefer exact matches as well.
+	// For each key, cred helpers take precedence; their keys should always be normalized.
+	// A namespaced cred helper entry is queried using the namespace as the server URL,
+	// so that it can hold credentials distinct from those for the whole registry.
+	// The default credsStore, if any, is only used for the registry itself, like a registry-level credHelpers entry.
+	// Entries which only specify a client certificate don't end the search; the certificate is used
+	// with credentials from a less specific entry, if any.
+	var certOnly types.DockerAuthConfig
 	for _, key := range keys {
+		if ch, exists := fileContents.CredHelpers[key]; exists {
+			logger.Debugf("Looking up %s in credential helper %s based on credHelpers entry in %s", key, ch, source)
+			creds, err := getCredsFromCredHelper(logger, ch, key)
+			return withClientCertificate(creds, certOnly), "", err
+		}
+		if key == registry && fileContents.CredsStore != "" {
+			logger.Debugf("Looking up %s in credential helper %s based on credsStore in %s", key, fileContents.CredsStore, source)
+			creds, err := getCredsFromCredHelper(logger, fileContents.CredsStore, credsStoreServerURL(key))
+			if err != nil || creds != (types.DockerAuthConfig{}) {
+				return withClientCertificate(creds, certOnly), "", err
+			}
+		}
 		if val, exists := fileContents.AuthConfigs[key]; exists {
-			return decodeDockerAuth(path.path, key, val)
+			creds, err := decodeDockerAuth(logger, source, key, val)
+			if err != nil || !isClientCertificateOnly(creds) {
+				return withClientCertificate(creds, certOnly), key, err
+			}
+			certOnly = withClientCertificate(certOnly, creds)
 		}
 	}
 
@@ -836,15 +1196,22 @@ func findCredentialsInFile(key, registry string, path authPath) (types.DockerAut
 	// so account for that as well.
 	registry = normalizeRegistry(registry)
 	for k, v := range fileContents.AuthConfigs {
-		if normalizeAuthFileKey(k, path.legacyFormat) == registry {
-			return decodeDockerAuth(path.path, k, v)
+		if normalizeAuthFileKey(k, legacyFormat) == registry {
+			creds, err := decodeDockerAuth(logger, source, k, v)
+			if err != nil || !isClientCertificateOnly(creds) {
+				// k is not normalized, and may not be usable as a key for updating the entry.
+				return withClientCertificate(creds, certOnly), "", err
+			}
+			certOnly = withClientCertificate(certOnly, creds)
 		}
 	}
 
 	// Only log this if we found nothing; getCredentialsWithHomeDir logs the
 	// source of found data.
-	logrus.Debugf("No credentials matching %s found in %s", key, path.path)
-	return types.DockerAuthConfig{}, nil
+	if certOnly == (types.DockerAuthConfig{}) {
+		logger.Debugf("No credentials matching %s found in %s", key, source)
+	}
+	return certOnly, "", nil
 }
 
 // authKeysForKey returns the keys matching a provided auth file key, in order
@@ -868,9 +1235,36 @@ func authKeysForKey(key string) (res []string) {
 	return res
 }
 
+// encodeDockerAuth converts creds into an auth file entry.
+// Like docker/cli, an identity token is stored along with the username and an empty password.
+func encodeDockerAuth(creds types.DockerAuthConfig) dockerAuthConfig {
+	var res dockerAuthConfig
+	if creds.IdentityToken != "" {
+		res = dockerAuthConfig{
+			Auth:          base64.StdEncoding.EncodeToString([]byte(creds.Username + ":")),
+			IdentityToken: creds.IdentityToken,
+		}
+	} else {
+		res = dockerAuthConfig{Auth: base64.StdEncoding.EncodeToString([]byte(creds.Username + ":" + creds.Password))}
+	}
+	if !creds.ExpiresAt.IsZero() {
+		expiresAt := creds.ExpiresAt.UTC()
+		res.ExpiresAt = &expiresAt
+	}
+	return res
+}
+
 // decodeDockerAuth decodes the username and password from conf,
 // which is entry key in path.
-func decodeDockerAuth(path, key string, conf dockerAuthConfig) (types.DockerAuthConfig, error) {
+func decodeDockerAuth(logger types.Logger, path, key string, conf dockerAuthConfig) (types.DockerAuthConfig, error) {
+	if err := validateClientCertificatePaths(conf.ClientCertificate, conf.ClientKey); err != nil {
+		return types.DockerAuthConfig{}, fmt.Errorf("invalid credential entry %q in %q: %w", key, path, err)
+	}
+	certOnly := types.DockerAuthConfig{
+		ClientCertificatePath: conf.ClientCertificate,
+		ClientKeyPath:         conf.ClientKey,
+	}
+
 	decoded, err := base64.StdEncoding.DecodeString(conf.Auth)
 	if err != nil {
 		return types.DockerAuthConfig{}, err
@@ -880,19 +1274,25 @@ func decodeDockerAuth(path, key string, conf dockerAuthConfig) (types.DockerAuth
 	if !valid {
 		// if it's invalid just skip, as docker does
 		if len(decoded) > 0 { // Docker writes "auths": { "$host": {} } entries if a credential helper is used, don’t warn about those
-			logrus.Warnf(`Error parsing the "auth" field of a credential entry %q in %q, missing semicolon`, key, path) // Don’t include the text of decoded, because that might put secrets into a log.
+			logger.Warnf(`Error parsing the "auth" field of a credential entry %q in %q, missing semicolon`, key, path) // Don’t include the text of decoded, because that might put secrets into a log.
 		} else {
-			logrus.Debugf("Found an empty credential entry %q in %q (an unhandled credential helper marker?), moving on", key, path)
+			logger.Debugf("Found an empty credential entry %q in %q (an unhandled credential helper marker?), moving on", key, path)
 		}
-		return types.DockerAuthConfig{}, nil
+		return certOnly, nil
 	}
 
 	password := strings.Trim(passwordPart, "\x00")
-	return types.DockerAuthConfig{
-		Username:      user,
-		Password:      password,
-		IdentityToken: conf.IdentityToken,
-	}, nil
+	res := types.DockerAuthConfig{
+		Username:              user,
+		Password:              password,
+		IdentityToken:         conf.IdentityToken,
+		ClientCertificatePath: conf.ClientCertificate,
+		ClientKeyPath:         conf.ClientKey,
+	}
+	if conf.ExpiresAt != nil {
+		res.ExpiresAt = *conf.ExpiresAt
+	}
+	return res, nil
 }
 
 // normalizeAuthFileKey takes a key, converts it to a host name and normalizes
@@ -1,12 +1,15 @@
 package config
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/types"
@@ -274,6 +277,36 @@ func TestGetAuth(t *testing.T) {
 				path:     filepath.Join("testdata", "refpath.json"),
 				expected: types.DockerAuthConfig{Username: "top", Password: "level"},
 			},
+			{
+				name:     "namespaced auth match",
+				key:      "registry-a.com/team-a/image",
+				path:     filepath.Join("testdata", "namespaced.json"),
+				expected: types.DockerAuthConfig{Username: "team-a", Password: "robot"},
+			},
+			{
+				name:     "namespaced credhelper match",
+				key:      "registry-a.com/team-b/image",
+				path:     filepath.Join("testdata", "namespaced.json"),
+				expected: types.DockerAuthConfig{Username: "team-b", Password: "robot"},
+			},
+			{
+				name:     "credsStore match",
+				key:      "registry-a.com/repo",
+				path:     filepath.Join("testdata", "creds-store.json"),
+				expected: types.DockerAuthConfig{Username: "foo", Password: "bar"},
+			},
+			{
+				name:     "credsStore no match",
+				key:      "registry-c.com/repo",
+				path:     filepath.Join("testdata", "creds-store.json"),
+				expected: types.DockerAuthConfig{},
+			},
+			{
+				name:     "namespaced fallback to registry",
+				key:      "registry-a.com/team-c/image",
+				path:     filepath.Join("testdata", "namespaced.json"),
+				expected: types.DockerAuthConfig{Username: "registry", Password: "wide"},
+			},
 		} {
 			t.Run(tc.name, func(t *testing.T) {
 				if err := os.RemoveAll(configPath); err != nil {
@@ -519,6 +552,73 @@ func TestGetCredentialsInteroperability(t *testing.T) {
 	}
 }
 
+func TestGetCredentialsForPullSource(t *testing.T) {
+	tmpDir := t.TempDir()
+	authFile := filepath.Join(tmpDir, "auth.json")
+	require.NoError(t, os.WriteFile(authFile, []byte(`{"auths":{
+		"primary.example.org":{"auth":"cHJpbWFyeTpwYXNzd29yZA=="},
+		"mirror.example.com/ns":{"auth":"bWlycm9yOnBhc3N3b3Jk"}
+	}}`), 0600))
+	registriesConf := filepath.Join(tmpDir, "registries.conf")
+	require.NoError(t, os.WriteFile(registriesConf, []byte(`
+[[registry]]
+location = "primary.example.org"
+mirror = [
+	{ location = "mirror.example.com/ns" },
+	{ location = "primary.example.org/mirrored" },
+]
+`), 0600))
+
+	ref, err := reference.ParseNormalizedNamed("primary.example.org/repo:tag")
+	require.NoError(t, err)
+	sys := &types.SystemContext{
+		AuthFilePath:                authFile,
+		SystemRegistriesConfPath:    registriesConf,
+		SystemRegistriesConfDirPath: filepath.Join("testdata", "IdoNotExist"),
+	}
+
+	sources, err := GetPullSources(sys, ref)
+	require.NoError(t, err)
+	res := map[string]types.DockerAuthConfig{}
+	for _, s := range sources {
+		creds, _, err := GetCredentialsForPullSource(sys, ref, s)
+		require.NoError(t, err)
+		res[s.Reference.String()] = creds
+	}
+	assert.Equal(t, map[string]types.DockerAuthConfig{
+		"mirror.example.com/ns/repo:tag":        {Username: "mirror", Password: "password"},
+		"primary.example.org/mirrored/repo:tag": {Username: "primary", Password: "password"},
+		"primary.example.org/repo:tag":          {Username: "primary", Password: "password"},
+	}, res)
+	require.Len(t, sources, 3)
+	assert.Equal(t, "primary.example.org/repo:tag", sources[2].Reference.String()) // The primary location is last
+
+	// sys.DockerAuthConfig is only used for locations on the primary registry.
+	sys.DockerAuthConfig = &types.DockerAuthConfig{Username: "explicit", Password: "password"}
+	res = map[string]types.DockerAuthConfig{}
+	for _, s := range sources {
+		creds, _, err := GetCredentialsForPullSource(sys, ref, s)
+		require.NoError(t, err)
+		res[s.Reference.String()] = creds
+	}
+	assert.Equal(t, map[string]types.DockerAuthConfig{
+		"mirror.example.com/ns/repo:tag":        {Username: "mirror", Password: "password"},
+		"primary.example.org/mirrored/repo:tag": {Username: "explicit", Password: "password"},
+		"primary.example.org/repo:tag":          {Username: "explicit", Password: "password"},
+	}, res)
+
+	// Without any registries.conf configuration, only the primary location is used.
+	otherRef, err := reference.ParseNormalizedNamed("other.example.org/repo")
+	require.NoError(t, err)
+	sources, err = GetPullSources(sys, otherRef)
+	require.NoError(t, err)
+	require.Len(t, sources, 1)
+	assert.Equal(t, "other.example.org/repo", sources[0].Reference.String())
+	creds, _, err := GetCredentialsForPullSource(sys, otherRef, sources[0])
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{Username: "explicit", Password: "password"}, creds)
+}
+
 func TestGetAllCredentials(t *testing.T) {
 	// Create a temporary authentication file.
 	tmpFile, err := os.CreateTemp("", "auth.json.")
@@ -764,6 +864,272 @@ func TestSetCredentials(t *testing.T) {
 	}
 }
 
+func TestSetIdentityToken(t *testing.T) {
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	sys := &types.SystemContext{AuthFilePath: authFile}
+
+	_, err := SetCredentials(sys, "example.org", "user", "password")
+	require.NoError(t, err)
+	_, err = SetIdentityToken(sys, "example.org", "user", "rotated-token")
+	require.NoError(t, err)
+
+	auth, err := newAuthPathDefault(authFile).parse()
+	require.NoError(t, err)
+	assert.Equal(t, dockerAuthConfig{Auth: "dXNlcjo=", IdentityToken: "rotated-token"}, auth.AuthConfigs["example.org"])
+
+	creds, err := GetCredentials(sys, "example.org")
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{Username: "user", IdentityToken: "rotated-token"}, creds)
+
+	_, err = SetIdentityToken(sys, "example.org", "user", "")
+	assert.Error(t, err)
+}
+
+func TestSetCredentialsWithExpiry(t *testing.T) {
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	sys := &types.SystemContext{AuthFilePath: authFile}
+	expiresAt := time.Date(2023, 4, 5, 6, 7, 8, 0, time.UTC)
+
+	_, err := SetCredentialsWithExpiry(sys, "example.org", "user", "password", expiresAt)
+	require.NoError(t, err)
+	creds, err := GetCredentials(sys, "example.org")
+	require.NoError(t, err)
+	assert.Equal(t, "user", creds.Username)
+	assert.Equal(t, "password", creds.Password)
+	assert.True(t, expiresAt.Equal(creds.ExpiresAt))
+
+	// SetCredentials drops the expiration time.
+	_, err = SetCredentials(sys, "example.org", "user", "password")
+	require.NoError(t, err)
+	creds, err = GetCredentials(sys, "example.org")
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{Username: "user", Password: "password"}, creds)
+}
+
+func TestSetClientCertificate(t *testing.T) {
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	sys := &types.SystemContext{AuthFilePath: authFile}
+	certPath, keyPath := filepath.FromSlash("/etc/pki/client.cert"), filepath.FromSlash("/etc/pki/client.key")
+
+	// Certificate without credentials
+	_, err := SetClientCertificate(sys, "example.org/ns", certPath, keyPath)
+	require.NoError(t, err)
+	creds, err := GetCredentials(sys, "example.org/ns/repo")
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{ClientCertificatePath: certPath, ClientKeyPath: keyPath}, creds)
+
+	// Logging in and out preserves the certificate
+	_, err = SetCredentials(sys, "example.org/ns", "user", "password")
+	require.NoError(t, err)
+	creds, err = GetCredentials(sys, "example.org/ns/repo")
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{Username: "user", Password: "password", ClientCertificatePath: certPath, ClientKeyPath: keyPath}, creds)
+	err = RemoveAuthentication(sys, "example.org/ns")
+	require.NoError(t, err)
+	creds, err = GetCredentials(sys, "example.org/ns/repo")
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{ClientCertificatePath: certPath, ClientKeyPath: keyPath}, creds)
+
+	// Removing the certificate removes the entry
+	_, err = SetClientCertificate(sys, "example.org/ns", "", "")
+	require.NoError(t, err)
+	auth, err := newAuthPathDefault(authFile).parse()
+	require.NoError(t, err)
+	assert.NotContains(t, auth.AuthConfigs, "example.org/ns")
+
+	// Invalid paths
+	for _, paths := range [][2]string{
+		{certPath, ""},
+		{"", keyPath},
+		{"client.cert", keyPath},
+		{certPath, "client.key"},
+	} {
+		_, err = SetClientCertificate(sys, "example.org", paths[0], paths[1])
+		assert.Error(t, err, paths)
+	}
+	require.NoError(t, os.WriteFile(authFile, []byte(`{"auths":{"example.org":{"clientCertificate":"client.cert","clientKey":"client.key"}}}`), 0600))
+	_, err = GetCredentials(sys, "example.org")
+	assert.Error(t, err)
+}
+
+func TestGetCredentialsClientCertificateOnly(t *testing.T) {
+	tmpHomeDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("DOCKER_CONFIG", "")
+	certPath, keyPath := filepath.FromSlash("/etc/pki/client.cert"), filepath.FromSlash("/etc/pki/client.key")
+	auth := base64.StdEncoding.EncodeToString([]byte("user:password"))
+
+	// A certificate-only entry in one file, and credentials in a second file
+	certFile := filepath.Join(tmpHomeDir, ".config", "containers", "auth.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(certFile), 0o700))
+	require.NoError(t, os.WriteFile(certFile, []byte(`{"auths":{"example.org/ns":{"clientCertificate":"`+certPath+`","clientKey":"`+keyPath+`"}}}`), 0o600))
+	credsFile := filepath.Join(tmpHomeDir, ".docker", "config.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(credsFile), 0o700))
+	require.NoError(t, os.WriteFile(credsFile, []byte(`{"auths":{"example.org":{"auth":"`+auth+`"}}}`), 0o600))
+
+	creds, err := getCredentialsWithHomeDir(nil, "example.org/ns/repo", tmpHomeDir)
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{Username: "user", Password: "password", ClientCertificatePath: certPath, ClientKeyPath: keyPath}, creds)
+	// The certificate is only used within its namespace
+	creds, err = getCredentialsWithHomeDir(nil, "example.org/other/repo", tmpHomeDir)
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{Username: "user", Password: "password"}, creds)
+
+	// A certificate-only entry, and credentials for a less specific key in the same file
+	require.NoError(t, os.Remove(credsFile))
+	require.NoError(t, os.WriteFile(certFile, []byte(`{"auths":{`+
+		`"example.org/ns":{"clientCertificate":"`+certPath+`","clientKey":"`+keyPath+`"},`+
+		`"example.org":{"auth":"`+auth+`","identitytoken":"token"}}}`), 0o600))
+	creds, err = getCredentialsWithHomeDir(nil, "example.org/ns/repo", tmpHomeDir)
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{Username: "user", Password: "password", IdentityToken: "token",
+		ClientCertificatePath: certPath, ClientKeyPath: keyPath}, creds)
+
+	// Only a certificate
+	require.NoError(t, os.WriteFile(certFile, []byte(`{"auths":{"example.org/ns":{"clientCertificate":"`+certPath+`","clientKey":"`+keyPath+`"}}}`), 0o600))
+	creds, err = getCredentialsWithHomeDir(nil, "example.org/ns/repo", tmpHomeDir)
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{ClientCertificatePath: certPath, ClientKeyPath: keyPath}, creds)
+}
+
+func TestGetCredentialsSource(t *testing.T) {
+	// override PATH for executing credHelper
+	curtDir, err := os.Getwd()
+	require.NoError(t, err)
+	t.Setenv("PATH", fmt.Sprintf("%s:%s", filepath.Join(curtDir, "testdata"), os.Getenv("PATH")))
+	tmpHomeDir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("DOCKER_CONFIG", "")
+	auth := base64.StdEncoding.EncodeToString([]byte("user:password"))
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	require.NoError(t, os.WriteFile(authFile, []byte(`{"auths":{"example.org/ns":{"auth":"`+auth+`"},"https://other.example.org/v1/":{"auth":"`+auth+`"}},`+
+		`"credHelpers":{"registry-a.com":"helper-registry"}}`), 0o600))
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	require.NoError(t, os.WriteFile(registriesConf, []byte{}, 0o600))
+	helperFirstConf := filepath.Join(t.TempDir(), "registries.conf")
+	require.NoError(t, os.WriteFile(helperFirstConf, []byte(`credential-helpers = [ "helper-registry", "containers-auth.json" ]`), 0o600))
+	noRegistriesConf := filepath.Join("testdata", "IdoNotExist")
+
+	for _, c := range []struct {
+		name, key string
+		sys       *types.SystemContext
+		expected  CredentialsSource
+	}{
+		{
+			name:     "writable auth file",
+			key:      "example.org/ns/repo",
+			sys:      &types.SystemContext{AuthFilePath: authFile, SystemRegistriesConfPath: registriesConf, SystemRegistriesConfDirPath: noRegistriesConf},
+			expected: CredentialsSource{AuthFileKey: "example.org/ns"},
+		},
+		{
+			name: "non-normalized key",
+			key:  "other.example.org/repo",
+			sys:  &types.SystemContext{AuthFilePath: authFile, SystemRegistriesConfPath: registriesConf, SystemRegistriesConfDirPath: noRegistriesConf},
+		},
+		{
+			name: "credHelpers entry",
+			key:  "registry-a.com/repo",
+			sys:  &types.SystemContext{AuthFilePath: authFile, SystemRegistriesConfPath: registriesConf, SystemRegistriesConfDirPath: noRegistriesConf},
+		},
+		{
+			name: "DockerAuthConfig",
+			key:  "example.org/ns/repo",
+			sys: &types.SystemContext{AuthFilePath: authFile, SystemRegistriesConfPath: registriesConf, SystemRegistriesConfDirPath: noRegistriesConf,
+				DockerAuthConfig: &types.DockerAuthConfig{Username: "explicit", Password: "password"}},
+		},
+		{
+			name: "credential helper preferred for writing",
+			key:  "example.org/ns/repo",
+			sys:  &types.SystemContext{AuthFilePath: authFile, SystemRegistriesConfPath: helperFirstConf, SystemRegistriesConfDirPath: noRegistriesConf},
+		},
+	} {
+		creds, source, err := getCredentialsAndSourceWithHomeDir(c.sys, c.key, tmpHomeDir)
+		require.NoError(t, err, c.name)
+		assert.NotEqual(t, types.DockerAuthConfig{}, creds, c.name)
+		assert.Equal(t, c.expected, source, c.name)
+	}
+
+	// Credentials in a file which is only read, never written
+	dockerConfig := filepath.Join(tmpHomeDir, ".docker", "config.json")
+	require.NoError(t, os.MkdirAll(filepath.Dir(dockerConfig), 0o700))
+	require.NoError(t, os.WriteFile(dockerConfig, []byte(`{"auths":{"example.org":{"auth":"`+auth+`"}}}`), 0o600))
+	sys := &types.SystemContext{SystemRegistriesConfPath: registriesConf, SystemRegistriesConfDirPath: noRegistriesConf}
+	creds, source, err := getCredentialsAndSourceWithHomeDir(sys, "example.org/repo", tmpHomeDir)
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{Username: "user", Password: "password"}, creds)
+	assert.Equal(t, CredentialsSource{}, source)
+
+	// Environment variables
+	t.Setenv(EnvAuthHost, "example.org")
+	t.Setenv(EnvAuthUsername, "env-user")
+	t.Setenv(EnvAuthPassword, "env-password")
+	creds, source, err = getCredentialsAndSourceWithHomeDir(&types.SystemContext{AuthFilePath: authFile}, "example.org/ns/repo", tmpHomeDir)
+	require.NoError(t, err)
+	assert.Equal(t, "env-user", creds.Username)
+	assert.Equal(t, CredentialsSource{}, source)
+}
+
+func TestSetCredentialsWithCredsStore(t *testing.T) {
+	// override PATH for executing credHelper
+	curtDir, err := os.Getwd()
+	require.NoError(t, err)
+	t.Setenv("PATH", fmt.Sprintf("%s:%s", filepath.Join(curtDir, "testdata"), os.Getenv("PATH")))
+
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	contents, err := os.ReadFile(filepath.Join("testdata", "creds-store.json"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(authFile, contents, 0600))
+	sys := &types.SystemContext{AuthFilePath: authFile}
+
+	desc, err := SetCredentials(sys, "registry-c.com", "user", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "credential helper: helper-registry", desc)
+	auth, err := newAuthPathDefault(authFile).parse()
+	require.NoError(t, err)
+	assert.Equal(t, "helper-registry", auth.CredsStore)
+	assert.Equal(t, map[string]dockerAuthConfig{"registry-a.com": {}, "registry-c.com": {}}, auth.AuthConfigs)
+
+	// Namespaced keys are not passed to credsStore.
+	_, err = SetCredentials(sys, "registry-c.com/ns", "user", "password")
+	require.NoError(t, err)
+	auth, err = newAuthPathDefault(authFile).parse()
+	require.NoError(t, err)
+	assert.NotEmpty(t, auth.AuthConfigs["registry-c.com/ns"].Auth)
+
+	err = RemoveAuthentication(sys, "registry-c.com")
+	require.NoError(t, err)
+	auth, err = newAuthPathDefault(authFile).parse()
+	require.NoError(t, err)
+	assert.NotContains(t, auth.AuthConfigs, "registry-c.com")
+	assert.Equal(t, "helper-registry", auth.CredsStore)
+
+	// docker.io credentials use the same server URL as docker/cli.
+	eraseLog := filepath.Join(t.TempDir(), "erase.log")
+	t.Setenv("HELPER_REGISTRY_ERASE_LOG", eraseLog)
+	_, err = SetCredentials(sys, "docker.io", "user", "password")
+	require.NoError(t, err)
+	err = RemoveAuthentication(sys, "docker.io")
+	require.NoError(t, err)
+	erased, err := os.ReadFile(eraseLog)
+	require.NoError(t, err)
+	assert.Equal(t, "https://index.docker.io/v1/\n", string(erased))
+
+	// Only credentials recorded by SetCredentials are erased from credsStore.
+	require.NoError(t, os.Remove(eraseLog))
+	_, err = SetCredentials(sys, "registry-d.com", "user", "password")
+	require.NoError(t, err)
+	err = RemoveAllAuthentication(sys)
+	require.NoError(t, err)
+	erased, err = os.ReadFile(eraseLog)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"registry-a.com", "registry-d.com"}, strings.Fields(string(erased)))
+	auth, err = newAuthPathDefault(authFile).parse()
+	require.NoError(t, err)
+	assert.Empty(t, auth.AuthConfigs)
+}
+
 func TestRemoveAuthentication(t *testing.T) {
 	testAuth := dockerAuthConfig{Auth: "ZXhhbXBsZTpvcmc="}
 	for _, tc := range []struct {
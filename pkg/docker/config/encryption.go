@@ -0,0 +1,103 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/types"
+)
+
+const (
+	// encryptionAlgorithmAES256GCM is the only currently supported value of encryptedAuthFile.Algorithm.
+	encryptionAlgorithmAES256GCM = "AES-256-GCM"
+	// encryptionAdditionalData is authenticated along with the ciphertext, to prevent reusing the ciphertext in other contexts.
+	encryptionAdditionalData = "containers-auth.json"
+)
+
+// encryptedAuthFileEnvelope is the on-disk format of an encrypted auth file.
+type encryptedAuthFileEnvelope struct {
+	Encrypted *encryptedAuthFile `json:"encrypted"`
+}
+
+// encryptedAuthFile contains the encrypted contents of an auth file.
+type encryptedAuthFile struct {
+	Algorithm  string `json:"algorithm"`
+	Nonce      []byte `json:"nonce"`      // base64-encoded in JSON
+	Ciphertext []byte `json:"ciphertext"` // base64-encoded in JSON
+}
+
+// newAuthFileAEAD returns an AEAD for key, which must be a 32-byte AES-256 key.
+func newAuthFileAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("auth file encryption key must be 32 bytes long, not %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptAuthFile returns an encrypted representation of the auth file contents in plaintext, using key.
+func encryptAuthFile(key []byte, plaintext []byte) ([]byte, error) {
+	aead, err := newAuthFileAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generating a nonce: %w", err)
+	}
+	return json.MarshalIndent(encryptedAuthFileEnvelope{
+		Encrypted: &encryptedAuthFile{
+			Algorithm:  encryptionAlgorithmAES256GCM,
+			Nonce:      nonce,
+			Ciphertext: aead.Seal(nil, nonce, plaintext, []byte(encryptionAdditionalData)),
+		},
+	}, "", "\t")
+}
+
+// authFileEncryptionKey returns the key used to encrypt the primary auth file, as configured in sys, or nil if not configured.
+func authFileEncryptionKey(sys *types.SystemContext) ([]byte, error) {
+	if sys == nil {
+		return nil, nil
+	}
+	if sys.AuthFileEncryptionKeyringKey != "" {
+		if sys.AuthFileEncryptionKey != nil {
+			return nil, errors.New("AuthFileEncryptionKey and AuthFileEncryptionKeyringKey can not be set simultaneously")
+		}
+		return readKeyringKey(sys.AuthFileEncryptionKeyringKey)
+	}
+	return sys.AuthFileEncryptionKey, nil
+}
+
+// decryptAuthFileIfEncrypted returns the plaintext contents of an auth file with raw contents,
+// decrypting it using key if it is encrypted, and whether the file was encrypted.
+func decryptAuthFileIfEncrypted(key []byte, raw []byte) ([]byte, bool, error) {
+	var envelope encryptedAuthFileEnvelope
+	if err := json.Unmarshal(raw, &envelope); err != nil || envelope.Encrypted == nil {
+		return raw, false, nil // Not encrypted; parse errors, if any, will be reported by the caller.
+	}
+	if key == nil {
+		return nil, false, errors.New("the file is encrypted, but no encryption key was provided")
+	}
+	if envelope.Encrypted.Algorithm != encryptionAlgorithmAES256GCM {
+		return nil, false, fmt.Errorf("unsupported encryption algorithm %q", envelope.Encrypted.Algorithm)
+	}
+	aead, err := newAuthFileAEAD(key)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(envelope.Encrypted.Nonce) != aead.NonceSize() {
+		return nil, false, fmt.Errorf("invalid nonce length %d", len(envelope.Encrypted.Nonce))
+	}
+	plaintext, err := aead.Open(nil, envelope.Encrypted.Nonce, envelope.Encrypted.Ciphertext, []byte(encryptionAdditionalData))
+	if err != nil {
+		return nil, false, fmt.Errorf("decrypting: %w", err)
+	}
+	return plaintext, true, nil
+}
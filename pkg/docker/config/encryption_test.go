@@ -0,0 +1,54 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedAuthFile(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	sys := &types.SystemContext{AuthFilePath: authFile, AuthFileEncryptionKey: key}
+
+	_, err := SetCredentials(sys, "example.org", "user", "password")
+	require.NoError(t, err)
+	raw, err := os.ReadFile(authFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "example.org")
+	assert.Contains(t, string(raw), encryptionAlgorithmAES256GCM)
+
+	creds, err := GetCredentials(sys, "example.org")
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{Username: "user", Password: "password"}, creds)
+
+	// Without a key, or with a wrong key, the file can not be read.
+	_, err = GetCredentials(&types.SystemContext{AuthFilePath: authFile}, "example.org")
+	assert.Error(t, err)
+	_, err = GetCredentials(&types.SystemContext{AuthFilePath: authFile, AuthFileEncryptionKey: bytes.Repeat([]byte{0x43}, 32)}, "example.org")
+	assert.Error(t, err)
+	_, err = GetCredentials(&types.SystemContext{AuthFilePath: authFile, AuthFileEncryptionKey: []byte("short")}, "example.org")
+	assert.Error(t, err)
+
+	// Unencrypted files are not read with a key set, and are encrypted on the next write.
+	require.NoError(t, os.WriteFile(authFile, []byte(`{"auths":{"example.org":{"auth":"ZXhhbXBsZTpvcmc="}}}`), 0600))
+	_, err = GetCredentials(sys, "example.org")
+	assert.Error(t, err)
+	_, err = SetCredentials(sys, "example.com", "user", "password")
+	require.NoError(t, err)
+	raw, err = os.ReadFile(authFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "example.org")
+	creds, err = GetCredentials(sys, "example.org")
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{Username: "example", Password: "org"}, creds)
+
+	// Docker-compatible files are never encrypted.
+	_, err = SetCredentials(&types.SystemContext{DockerCompatAuthFilePath: authFile, AuthFileEncryptionKey: key}, "example.org", "user", "password")
+	assert.Error(t, err)
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/containers/image/v5/types"
+)
+
+const (
+	// EnvAuthJSON is the name of an environment variable which, if set, contains credentials
+	// in the format of an auth.json file (see containers-auth.json(5)).
+	EnvAuthJSON = "REGISTRY_AUTH"
+	// EnvAuthHost, EnvAuthUsername and EnvAuthPassword are names of environment variables which,
+	// if EnvAuthHost is set, contain credentials for a single registry or namespace.
+	EnvAuthHost     = "REGISTRY_AUTH_HOST"
+	EnvAuthUsername = "REGISTRY_AUTH_USERNAME"
+	EnvAuthPassword = "REGISTRY_AUTH_PASSWORD"
+)
+
+// getCredentialsFromEnv looks for credentials matching "key" (which is "registry"
+// or a namespace in "registry") in the environment variables.
+// The single-registry form (EnvAuthHost) takes precedence over EnvAuthJSON.
+// Returns the credentials, and the name of the environment variable they were found in, if any.
+//
+// Note that neither the values of the variables nor the returned credentials may be logged.
+func getCredentialsFromEnv(logger types.Logger, key, registry string) (types.DockerAuthConfig, string, error) {
+	if host := os.Getenv(EnvAuthHost); host != "" {
+		if _, err := validateKey(host); err != nil {
+			return types.DockerAuthConfig{}, "", fmt.Errorf("invalid $%s: %w", EnvAuthHost, err)
+		}
+		for _, k := range authKeysForKey(key) {
+			if k == host {
+				return types.DockerAuthConfig{
+					Username: os.Getenv(EnvAuthUsername),
+					Password: os.Getenv(EnvAuthPassword),
+				}, EnvAuthHost, nil
+			}
+		}
+	}
+
+	contents, err := parseEnvAuthJSON()
+	if err != nil {
+		return types.DockerAuthConfig{}, "", err
+	}
+	if contents == nil {
+		return types.DockerAuthConfig{}, "", nil
+	}
+	creds, _, err := findCredentialsInConfig(logger, key, registry, *contents, "$"+EnvAuthJSON, false)
+	if err != nil {
+		return types.DockerAuthConfig{}, "", err
+	}
+	return creds, EnvAuthJSON, nil
+}
+
+// envCredentialKeys returns all keys for which credentials are set in environment variables.
+func envCredentialKeys() ([]string, error) {
+	res := []string{}
+	if host := os.Getenv(EnvAuthHost); host != "" {
+		res = append(res, host)
+	}
+	contents, err := parseEnvAuthJSON()
+	if err != nil {
+		return nil, err
+	}
+	if contents != nil {
+		for key := range contents.CredHelpers {
+			res = append(res, key)
+		}
+		for key := range contents.AuthConfigs {
+			res = append(res, normalizeAuthFileKey(key, false))
+		}
+	}
+	return res, nil
+}
+
+// parseEnvAuthJSON returns the contents of EnvAuthJSON, or nil if it is not set.
+func parseEnvAuthJSON() (*dockerConfigFile, error) {
+	raw := os.Getenv(EnvAuthJSON)
+	if raw == "" {
+		return nil, nil
+	}
+	var contents dockerConfigFile
+	if err := json.Unmarshal([]byte(raw), &contents); err != nil {
+		// Don’t include err, it might contain parts of the (secret) input.
+		return nil, fmt.Errorf("parsing $%s: invalid JSON", EnvAuthJSON)
+	}
+	return &contents, nil
+}
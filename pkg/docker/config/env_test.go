@@ -0,0 +1,109 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetCredentialsFromEnv(t *testing.T) {
+	sys := &types.SystemContext{AuthFilePath: filepath.Join("testdata", "example.json")}
+
+	for _, c := range []struct {
+		name, host, authJSON, key string
+		expected                  types.DockerAuthConfig
+	}{
+		{
+			name:     "no environment",
+			key:      "example.org/repo",
+			expected: types.DockerAuthConfig{Username: "example", Password: "org"},
+		},
+		{
+			name:     "single registry",
+			host:     "example.org",
+			key:      "example.org/repo",
+			expected: types.DockerAuthConfig{Username: "env-user", Password: "env-password"},
+		},
+		{
+			name:     "single namespace",
+			host:     "example.org/ns",
+			key:      "example.org/ns/repo",
+			expected: types.DockerAuthConfig{Username: "env-user", Password: "env-password"},
+		},
+		{
+			name:     "single namespace, other repository",
+			host:     "example.org/ns",
+			key:      "example.org/other/repo",
+			expected: types.DockerAuthConfig{Username: "example", Password: "org"},
+		},
+		{
+			name:     "JSON",
+			authJSON: `{"auths":{"example.org/ns":{"auth":"anNvbjp1c2Vy"}}}`,
+			key:      "example.org/ns/repo",
+			expected: types.DockerAuthConfig{Username: "json", Password: "user"},
+		},
+		{
+			name:     "single registry takes precedence over JSON",
+			host:     "example.org",
+			authJSON: `{"auths":{"example.org":{"auth":"anNvbjp1c2Vy"}}}`,
+			key:      "example.org/repo",
+			expected: types.DockerAuthConfig{Username: "env-user", Password: "env-password"},
+		},
+		{
+			name:     "JSON without a match",
+			authJSON: `{"auths":{"example.com":{"auth":"anNvbjp1c2Vy"}}}`,
+			key:      "example.org/repo",
+			expected: types.DockerAuthConfig{Username: "example", Password: "org"},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv(EnvAuthHost, c.host)
+			t.Setenv(EnvAuthUsername, "env-user")
+			t.Setenv(EnvAuthPassword, "env-password")
+			t.Setenv(EnvAuthJSON, c.authJSON)
+
+			creds, err := GetCredentials(sys, c.key)
+			require.NoError(t, err)
+			assert.Equal(t, c.expected, creds)
+		})
+	}
+
+	t.Run("invalid JSON", func(t *testing.T) {
+		t.Setenv(EnvAuthJSON, `{"auths":secret`)
+		_, err := GetCredentials(sys, "example.org")
+		require.Error(t, err)
+		assert.NotContains(t, err.Error(), "secret")
+	})
+
+	t.Run("invalid host", func(t *testing.T) {
+		t.Setenv(EnvAuthHost, "https://example.org")
+		_, err := GetCredentials(sys, "example.org")
+		assert.Error(t, err)
+	})
+}
+
+func TestGetAllCredentialsFromEnv(t *testing.T) {
+	t.Setenv(EnvAuthHost, "example.com/ns")
+	t.Setenv(EnvAuthUsername, "env-user")
+	t.Setenv(EnvAuthPassword, "env-password")
+	t.Setenv(EnvAuthJSON, `{"auths":{"https://index.docker.io/v1/":{"auth":"anNvbjp1c2Vy"}}}`)
+
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	require.NoError(t, os.WriteFile(registriesConf, []byte{}, 0600))
+	sys := &types.SystemContext{
+		AuthFilePath:                filepath.Join("testdata", "example.json"),
+		SystemRegistriesConfPath:    registriesConf,
+		SystemRegistriesConfDirPath: filepath.Join("testdata", "IdoNotExist"),
+	}
+	creds, err := GetAllCredentials(sys)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]types.DockerAuthConfig{
+		"example.org":    {Username: "example", Password: "org"},
+		"example.com/ns": {Username: "env-user", Password: "env-password"},
+		"docker.io":      {Username: "json", Password: "user"},
+	}, creds)
+}
@@ -0,0 +1,24 @@
+package config
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// readKeyringKey returns the contents of the "user" key with description in the kernel keyrings of the user.
+func readKeyringKey(description string) ([]byte, error) {
+	id, err := unix.KeyctlSearch(unix.KEY_SPEC_USER_KEYRING, "user", description, 0)
+	if err != nil {
+		return nil, fmt.Errorf("looking up key %q in the kernel keyring: %w", description, err)
+	}
+	buf := make([]byte, 64) // Larger than any valid key, so that we can detect invalid ones.
+	size, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0)
+	if err != nil {
+		return nil, fmt.Errorf("reading key %q from the kernel keyring: %w", description, err)
+	}
+	if size > len(buf) {
+		return nil, fmt.Errorf("key %q in the kernel keyring is too long (%d bytes)", description, size)
+	}
+	return buf[:size], nil
+}
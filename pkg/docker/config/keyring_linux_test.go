@@ -0,0 +1,36 @@
+package config
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+func TestEncryptedAuthFileWithKeyringKey(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	description := "containers-image-test-" + filepath.Base(t.TempDir())
+	id, err := unix.AddKey("user", description, key, unix.KEY_SPEC_USER_KEYRING)
+	if err != nil {
+		t.Skipf("Can not add a key to the kernel keyring: %v", err)
+	}
+	defer func() {
+		_, err := unix.KeyctlInt(unix.KEYCTL_UNLINK, id, unix.KEY_SPEC_USER_KEYRING, 0, 0)
+		assert.NoError(t, err)
+	}()
+
+	authFile := filepath.Join(t.TempDir(), "auth.json")
+	_, err = SetCredentials(&types.SystemContext{AuthFilePath: authFile, AuthFileEncryptionKeyringKey: description}, "example.org", "user", "password")
+	require.NoError(t, err)
+	// The file can be read using the key itself.
+	creds, err := GetCredentials(&types.SystemContext{AuthFilePath: authFile, AuthFileEncryptionKey: key}, "example.org")
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{Username: "user", Password: "password"}, creds)
+
+	_, err = GetCredentials(&types.SystemContext{AuthFilePath: authFile, AuthFileEncryptionKeyringKey: description + "-missing"}, "example.org")
+	assert.Error(t, err)
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package config
+
+import "errors"
+
+// readKeyringKey returns the contents of the "user" key with description in the kernel keyrings of the user.
+func readKeyringKey(description string) ([]byte, error) {
+	return nil, errors.New("reading keys from the kernel keyring is only supported on Linux")
+}
@@ -0,0 +1,153 @@
+package config
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/containers/image/v5/types"
+)
+
+// kubernetesDockerConfigJSON is the format of the .dockerconfigjson key of a kubernetes.io/dockerconfigjson Secret.
+type kubernetesDockerConfigJSON struct {
+	Auths map[string]kubernetesDockerConfigEntry `json:"auths"`
+}
+
+// kubernetesDockerConfigEntry is a single entry of kubernetesDockerConfigJSON, or of a legacy .dockercfg file.
+type kubernetesDockerConfigEntry struct {
+	Username      string `json:"username,omitempty"`
+	Password      string `json:"password,omitempty"`
+	Auth          string `json:"auth,omitempty"`
+	Email         string `json:"email,omitempty"`
+	IdentityToken string `json:"identitytoken,omitempty"`
+}
+
+// ExportKubernetesDockerConfigJSON returns all credentials available through GetAllCredentials,
+// in the format of the .dockerconfigjson key of a kubernetes.io/dockerconfigjson Secret,
+// or, if legacyFormat, of the .dockercfg key of a kubernetes.io/dockercfg Secret.
+//
+// Note that the returned data contains secrets in plain text.
+func ExportKubernetesDockerConfigJSON(sys *types.SystemContext, legacyFormat bool) ([]byte, error) {
+	allCreds, err := GetAllCredentials(sys)
+	if err != nil {
+		return nil, err
+	}
+
+	auths := map[string]kubernetesDockerConfigEntry{}
+	for key, creds := range allCreds {
+		if key == "docker.io" {
+			key = dockerIOServerURL // The only form of docker.io recognized by all consumers
+		}
+		entry := kubernetesDockerConfigEntry{
+			Username:      creds.Username,
+			Password:      creds.Password,
+			IdentityToken: creds.IdentityToken,
+		}
+		if creds.Username != "" || creds.Password != "" {
+			entry.Auth = base64.StdEncoding.EncodeToString([]byte(creds.Username + ":" + creds.Password))
+		}
+		auths[key] = entry
+	}
+
+	if legacyFormat {
+		return json.Marshal(auths)
+	}
+	return json.Marshal(kubernetesDockerConfigJSON{Auths: auths})
+}
+
+// ImportKubernetesDockerConfigJSON stores credentials from data, which is in the format of the .dockerconfigjson key
+// of a kubernetes.io/dockerconfigjson Secret, or of the .dockercfg key of a kubernetes.io/dockercfg Secret,
+// in a location appropriate for sys and the users’ configuration, as SetCredentials would.
+// Existing credentials for registries and namespaces not present in data are preserved.
+// Returns the keys of the imported credentials.
+func ImportKubernetesDockerConfigJSON(sys *types.SystemContext, data []byte) ([]string, error) {
+	auths, legacyFormat, err := parseKubernetesDockerConfigJSON(data)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(auths))
+	for rawKey := range auths {
+		keys = append(keys, rawKey)
+	}
+	sort.Strings(keys) // For deterministic behavior if several entries normalize to the same key.
+
+	res := []string{}
+	for _, rawKey := range keys {
+		entry := auths[rawKey]
+		key := kubernetesAuthKey(rawKey, legacyFormat)
+		creds, err := decodeKubernetesDockerConfigEntry(entry)
+		if err != nil {
+			return res, fmt.Errorf("decoding credentials for %q: %w", rawKey, err)
+		}
+		if creds.IdentityToken != "" {
+			_, err = SetIdentityToken(sys, key, creds.Username, creds.IdentityToken)
+		} else {
+			_, err = SetCredentials(sys, key, creds.Username, creds.Password)
+		}
+		if err != nil {
+			return res, fmt.Errorf("storing credentials for %q: %w", key, err)
+		}
+		res = append(res, key)
+	}
+	return res, nil
+}
+
+// parseKubernetesDockerConfigJSON parses data as a .dockerconfigjson value, or, if it has no "auths" field,
+// as a legacy .dockercfg value, and returns the contained entries and whether the legacy format was used.
+func parseKubernetesDockerConfigJSON(data []byte) (map[string]kubernetesDockerConfigEntry, bool, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, false, fmt.Errorf("parsing Docker configuration: %w", err)
+	}
+	if rawAuths, ok := raw["auths"]; ok {
+		var auths map[string]kubernetesDockerConfigEntry
+		if err := json.Unmarshal(rawAuths, &auths); err != nil {
+			return nil, false, fmt.Errorf(`parsing "auths" in Docker configuration: %w`, err)
+		}
+		return auths, false, nil
+	}
+	var auths map[string]kubernetesDockerConfigEntry
+	if err := json.Unmarshal(data, &auths); err != nil {
+		return nil, false, fmt.Errorf("parsing legacy Docker configuration: %w", err)
+	}
+	return auths, true, nil
+}
+
+// kubernetesAuthKey converts a key in a Kubernetes Docker configuration (which may be a URL) into
+// a key usable with SetCredentials.
+func kubernetesAuthKey(rawKey string, legacyFormat bool) string {
+	key := rawKey
+	if legacyFormat || strings.HasPrefix(key, "http://") || strings.HasPrefix(key, "https://") {
+		key = normalizeAuthFileKey(key, legacyFormat)
+	}
+	if normalizeRegistry(key) == normalizeRegistry("docker.io") {
+		key = "docker.io"
+	}
+	return key
+}
+
+// decodeKubernetesDockerConfigEntry returns the credentials in entry, preferring the "auth" field if it is set.
+func decodeKubernetesDockerConfigEntry(entry kubernetesDockerConfigEntry) (types.DockerAuthConfig, error) {
+	res := types.DockerAuthConfig{
+		Username:      entry.Username,
+		Password:      entry.Password,
+		IdentityToken: entry.IdentityToken,
+	}
+	if entry.Auth != "" {
+		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+		if err != nil {
+			return types.DockerAuthConfig{}, err
+		}
+		user, password, ok := strings.Cut(string(decoded), ":")
+		if !ok {
+			return types.DockerAuthConfig{}, errors.New(`invalid "auth" field, missing colon`)
+		}
+		res.Username = user
+		res.Password = strings.Trim(password, "\x00")
+	}
+	return res, nil
+}
@@ -0,0 +1,110 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestImportKubernetesDockerConfigJSON(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		data     string
+		expected map[string]types.DockerAuthConfig
+	}{
+		{
+			name: "dockerconfigjson",
+			data: `{"auths":{"https://index.docker.io/v1/":{"auth":"dXNlcjpwYXNz"},"quay.io/ns":{"username":"robot","password":"secret"}}}`,
+			expected: map[string]types.DockerAuthConfig{
+				"example.org": {Username: "example", Password: "org"},
+				"docker.io":   {Username: "user", Password: "pass"},
+				"quay.io/ns":  {Username: "robot", Password: "secret"},
+			},
+		},
+		{
+			name: "legacy dockercfg",
+			data: `{"https://registry.example.com/v1/":{"auth":"dXNlcjpwYXNz","email":"user@example.com"}}`,
+			expected: map[string]types.DockerAuthConfig{
+				"example.org":          {Username: "example", Password: "org"},
+				"registry.example.com": {Username: "user", Password: "pass"},
+			},
+		},
+		{
+			name: "overwriting an existing entry",
+			data: `{"auths":{"example.org":{"username":"new","password":"password"}}}`,
+			expected: map[string]types.DockerAuthConfig{
+				"example.org": {Username: "new", Password: "password"},
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			authFile := filepath.Join(t.TempDir(), "auth.json")
+			contents, err := os.ReadFile(filepath.Join("testdata", "example.json"))
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(authFile, contents, 0600))
+			sys := &types.SystemContext{AuthFilePath: authFile}
+
+			_, err = ImportKubernetesDockerConfigJSON(sys, []byte(c.data))
+			require.NoError(t, err)
+			for key, expected := range c.expected {
+				creds, err := GetCredentials(sys, key)
+				require.NoError(t, err)
+				assert.Equal(t, expected, creds, key)
+			}
+		})
+	}
+
+	sys := &types.SystemContext{AuthFilePath: filepath.Join(t.TempDir(), "auth.json")}
+	for _, invalid := range []string{
+		`not JSON`,
+		`{"auths":[]}`,
+		`{"auths":{"example.org":{"auth":"not base64"}}}`,
+		`{"auths":{"example.org":{"auth":"bm8gY29sb24="}}}`,
+	} {
+		_, err := ImportKubernetesDockerConfigJSON(sys, []byte(invalid))
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestExportKubernetesDockerConfigJSON(t *testing.T) {
+	registriesConf := filepath.Join(t.TempDir(), "registries.conf")
+	require.NoError(t, os.WriteFile(registriesConf, []byte{}, 0600))
+	sys := &types.SystemContext{
+		AuthFilePath:                filepath.Join(t.TempDir(), "auth.json"),
+		SystemRegistriesConfPath:    registriesConf,
+		SystemRegistriesConfDirPath: filepath.Join("testdata", "IdoNotExist"),
+	}
+	_, err := SetCredentials(sys, "docker.io", "user", "pass")
+	require.NoError(t, err)
+	_, err = SetCredentials(sys, "quay.io/ns", "robot", "secret")
+	require.NoError(t, err)
+
+	data, err := ExportKubernetesDockerConfigJSON(sys, false)
+	require.NoError(t, err)
+	var parsed kubernetesDockerConfigJSON
+	require.NoError(t, json.Unmarshal(data, &parsed))
+	assert.Equal(t, map[string]kubernetesDockerConfigEntry{
+		"https://index.docker.io/v1/": {Username: "user", Password: "pass", Auth: "dXNlcjpwYXNz"},
+		"quay.io/ns":                  {Username: "robot", Password: "secret", Auth: "cm9ib3Q6c2VjcmV0"},
+	}, parsed.Auths)
+
+	legacyData, err := ExportKubernetesDockerConfigJSON(sys, true)
+	require.NoError(t, err)
+	var legacyParsed map[string]kubernetesDockerConfigEntry
+	require.NoError(t, json.Unmarshal(legacyData, &legacyParsed))
+	assert.Equal(t, parsed.Auths, legacyParsed)
+
+	// Round trip
+	sys2 := &types.SystemContext{AuthFilePath: filepath.Join(t.TempDir(), "auth.json")}
+	keys, err := ImportKubernetesDockerConfigJSON(sys2, data)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"docker.io", "quay.io/ns"}, keys)
+	creds, err := GetCredentials(sys2, "docker.io")
+	require.NoError(t, err)
+	assert.Equal(t, types.DockerAuthConfig{Username: "user", Password: "pass"}, creds)
+}
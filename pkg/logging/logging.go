@@ -0,0 +1,68 @@
+// Package logging provides implementations of types.Logger, and the logger selection used by this library.
+package logging
+
+import (
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+)
+
+// For returns the logger to use with sys: sys.Logger if set, or a logger using the standard logrus logger otherwise.
+func For(sys *types.SystemContext) types.Logger {
+	if sys != nil && sys.Logger != nil {
+		return sys.Logger
+	}
+	return defaultLogger
+}
+
+// defaultLogger is the logger used if types.SystemContext.Logger is not set.
+var defaultLogger = Logrus(logrus.NewEntry(logrus.StandardLogger()))
+
+// logrusLogger is a types.Logger using a logrus logger.
+type logrusLogger struct {
+	entry *logrus.Entry
+}
+
+// Logrus returns a types.Logger which logs using entry, with its fields.
+func Logrus(entry *logrus.Entry) types.Logger {
+	return logrusLogger{entry: entry}
+}
+
+func (l logrusLogger) Debugf(format string, args ...any) {
+	l.entry.Debugf(format, args...)
+}
+
+func (l logrusLogger) Infof(format string, args ...any) {
+	l.entry.Infof(format, args...)
+}
+
+func (l logrusLogger) Warnf(format string, args ...any) {
+	l.entry.Warnf(format, args...)
+}
+
+func (l logrusLogger) Errorf(format string, args ...any) {
+	l.entry.Errorf(format, args...)
+}
+
+func (l logrusLogger) WithFields(fields types.LogFields) types.Logger {
+	return logrusLogger{entry: l.entry.WithFields(logrus.Fields(fields))}
+}
+
+// discardLogger is a types.Logger which discards all messages.
+type discardLogger struct{}
+
+// Discard returns a types.Logger which discards all messages.
+func Discard() types.Logger {
+	return discardLogger{}
+}
+
+func (discardLogger) Debugf(format string, args ...any) {}
+
+func (discardLogger) Infof(format string, args ...any) {}
+
+func (discardLogger) Warnf(format string, args ...any) {}
+
+func (discardLogger) Errorf(format string, args ...any) {}
+
+func (l discardLogger) WithFields(fields types.LogFields) types.Logger {
+	return l
+}
@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFor(t *testing.T) {
+	assert.Equal(t, defaultLogger, For(nil))
+	assert.Equal(t, defaultLogger, For(&types.SystemContext{}))
+	logger := Discard()
+	assert.Equal(t, logger, For(&types.SystemContext{Logger: logger}))
+}
+
+func TestLogrus(t *testing.T) {
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.SetOutput(&buf)
+	l.SetLevel(logrus.InfoLevel)
+	l.SetFormatter(&logrus.TextFormatter{DisableTimestamp: true, DisableQuote: true})
+
+	logger := Logrus(logrus.NewEntry(l))
+	logger.Debugf("not logged %d", 1)
+	assert.Equal(t, "", buf.String())
+
+	logger = logger.WithFields(types.LogFields{types.LogFieldRegistry: "registry.example"})
+	logger.WithFields(types.LogFields{types.LogFieldAttempt: 2}).Warnf("message %d", 1)
+	assert.Equal(t, "level=warning msg=message 1 attempt=2 registry=registry.example\n", buf.String())
+	buf.Reset()
+	logger.Infof("other")
+	assert.Equal(t, "level=info msg=other registry=registry.example\n", buf.String())
+}
+
+func TestDiscard(t *testing.T) {
+	logger := Discard()
+	logger.Errorf("ignored %d", 1)
+	assert.Equal(t, logger, logger.WithFields(types.LogFields{types.LogFieldDigest: "sha256:0"}))
+}
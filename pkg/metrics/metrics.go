@@ -0,0 +1,82 @@
+// Package metrics provides implementations of types.Metrics, and the metrics selection used by this library.
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/containers/image/v5/types"
+)
+
+// For returns the metrics receiver to use with sys: sys.Metrics if set, or one discarding all metrics otherwise.
+func For(sys *types.SystemContext) types.Metrics {
+	if sys != nil && sys.Metrics != nil {
+		return sys.Metrics
+	}
+	return Discard()
+}
+
+// discardMetrics is a types.Metrics which discards all metrics.
+type discardMetrics struct{}
+
+// Discard returns a types.Metrics which discards all metrics.
+func Discard() types.Metrics {
+	return discardMetrics{}
+}
+
+func (discardMetrics) AddCounter(name string, labels types.MetricLabels, delta int64) {}
+
+// Counters is a types.Metrics which keeps the values of all counters in memory.
+// It can be used as a simple aggregator, e.g. for tests, or to be periodically exported by the caller.
+type Counters struct {
+	mutex  sync.Mutex
+	values map[string]int64 // Keyed by counterKey
+}
+
+// NewCounters returns an empty Counters.
+func NewCounters() *Counters {
+	return &Counters{values: map[string]int64{}}
+}
+
+// AddCounter implements types.Metrics.
+func (c *Counters) AddCounter(name string, labels types.MetricLabels, delta int64) {
+	key := counterKey(name, labels)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.values[key] += delta
+}
+
+// Get returns the value of the counter name with exactly labels, or 0 if it was never added to.
+func (c *Counters) Get(name string, labels types.MetricLabels) int64 {
+	key := counterKey(name, labels)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.values[key]
+}
+
+// labelValueEscaper escapes label values as in the Prometheus text format.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// counterKey returns a string uniquely identifying name with labels, in the Prometheus text format, e.g. name{a="1",b="2"}.
+func counterKey(name string, labels types.MetricLabels) string {
+	names := make([]string, 0, len(labels))
+	for n := range labels {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString(name)
+	b.WriteByte('{')
+	for i, n := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(n)
+		b.WriteString(`="`)
+		b.WriteString(labelValueEscaper.Replace(labels[n]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFor(t *testing.T) {
+	assert.Equal(t, Discard(), For(nil))
+	assert.Equal(t, Discard(), For(&types.SystemContext{}))
+	counters := NewCounters()
+	assert.Equal(t, counters, For(&types.SystemContext{Metrics: counters}))
+}
+
+func TestCounters(t *testing.T) {
+	c := NewCounters()
+	labels := types.MetricLabels{types.MetricLabelRegistry: "registry.example", types.MetricLabelResult: "success"}
+	assert.Equal(t, int64(0), c.Get(types.MetricTokenFetches, labels))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.AddCounter(types.MetricTokenFetches, types.MetricLabels{types.MetricLabelResult: "success", types.MetricLabelRegistry: "registry.example"}, 2)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(20), c.Get(types.MetricTokenFetches, labels))
+
+	// Labels must match exactly
+	assert.Equal(t, int64(0), c.Get(types.MetricTokenFetches, types.MetricLabels{types.MetricLabelRegistry: "registry.example"}))
+	assert.Equal(t, int64(0), c.Get(types.MetricTokenFetches, nil))
+	assert.Equal(t, int64(0), c.Get(types.MetricBytesPulled, labels))
+}
+
+func TestCounterKey(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		labels   types.MetricLabels
+		expected string
+	}{
+		{"m", nil, "m{}"},
+		{"m", types.MetricLabels{"b": "2", "a": "1"}, `m{a="1",b="2"}`},
+		{"m", types.MetricLabels{"a": `x"y\z` + "\n"}, `m{a="x\"y\\z\n"}`},
+		// Values containing separators must not collide with other label sets
+		{"m", types.MetricLabels{"a": `1",b="2`}, `m{a="1\",b=\"2"}`},
+	} {
+		assert.Equal(t, c.expected, counterKey(c.name, c.labels))
+	}
+}
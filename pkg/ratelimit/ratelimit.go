@@ -0,0 +1,168 @@
+// Package ratelimit provides a token bucket implementation of types.RegistryRateLimiter.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/containers/image/v5/types"
+)
+
+// Limit is a rate limit: on average at most RequestsPerSecond requests are allowed,
+// with at most Burst requests allowed at once after a period of inactivity.
+type Limit struct {
+	RequestsPerSecond float64 // If <= 0, there is no limit.
+	Burst             int     // Values < 1 are treated as 1.
+}
+
+// Option configures a Limiter created by New.
+type Option func(*Limiter)
+
+// WithGlobalLimit limits the rate of requests to all registries combined.
+func WithGlobalLimit(limit Limit) Option {
+	return func(l *Limiter) {
+		l.global = newBucket(limit)
+	}
+}
+
+// WithRegistryLimit limits the rate of requests to registry (a host[:port] value, e.g. "registry-1.docker.io" for docker.io).
+// This overrides WithDefaultRegistryLimit for that registry.
+func WithRegistryLimit(registry string, limit Limit) Option {
+	return func(l *Limiter) {
+		l.registryLimits[registry] = limit
+	}
+}
+
+// WithDefaultRegistryLimit limits the rate of requests to each registry not configured using WithRegistryLimit, separately for each registry.
+func WithDefaultRegistryLimit(limit Limit) Option {
+	return func(l *Limiter) {
+		l.defaultRegistryLimit = &limit
+	}
+}
+
+// Limiter is a types.RegistryRateLimiter using token buckets, with an optional global limit, and optional per-registry limits.
+// A request must be allowed by both the global and the per-registry limit.
+type Limiter struct {
+	global               *bucket // nil if not limited
+	registryLimits       map[string]Limit
+	defaultRegistryLimit *Limit // nil if not limited
+
+	mutex   sync.Mutex
+	buckets map[string]*bucket // Created on demand; a nil value means that the registry is not limited.
+}
+
+var _ types.RegistryRateLimiter = (*Limiter)(nil)
+
+// New returns a Limiter configured by options. Without any options, it does not limit requests.
+func New(options ...Option) *Limiter {
+	l := &Limiter{
+		registryLimits: map[string]Limit{},
+		buckets:        map[string]*bucket{},
+	}
+	for _, o := range options {
+		o(l)
+	}
+	return l
+}
+
+// Wait implements types.RegistryRateLimiter.
+func (l *Limiter) Wait(ctx context.Context, registry string) error {
+	buckets := []*bucket{}
+	if b := l.registryBucket(registry); b != nil {
+		buckets = append(buckets, b)
+	}
+	if l.global != nil {
+		buckets = append(buckets, l.global)
+	}
+	if len(buckets) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	delay := time.Duration(0)
+	for _, b := range buckets {
+		if d := b.reserve(now); d > delay {
+			delay = d
+		}
+	}
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// The request is not going to be sent, make the reserved tokens available to others.
+		for _, b := range buckets {
+			b.cancel()
+		}
+		return ctx.Err()
+	}
+}
+
+// registryBucket returns the bucket to use for registry, or nil if it is not limited.
+func (l *Limiter) registryBucket(registry string) *bucket {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if b, ok := l.buckets[registry]; ok {
+		return b
+	}
+	var b *bucket
+	if limit, ok := l.registryLimits[registry]; ok {
+		b = newBucket(limit)
+	} else if l.defaultRegistryLimit != nil {
+		b = newBucket(*l.defaultRegistryLimit)
+	}
+	l.buckets[registry] = b
+	return b
+}
+
+// bucket is a single token bucket.
+type bucket struct {
+	rate  float64 // Tokens per second
+	burst float64
+
+	mutex  sync.Mutex
+	tokens float64 // May be negative if tokens have been reserved for future requests
+	last   time.Time
+}
+
+// newBucket returns a full bucket for limit, or nil if limit does not limit anything.
+func newBucket(limit Limit) *bucket {
+	if limit.RequestsPerSecond <= 0 {
+		return nil
+	}
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	return &bucket{rate: limit.RequestsPerSecond, burst: burst, tokens: burst}
+}
+
+// reserve takes a token from the bucket at now, and returns how long the caller must wait before using it.
+func (b *bucket) reserve(now time.Time) time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns a token obtained by reserve, which will not be used.
+func (b *bucket) cancel() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+}
@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBucket(t *testing.T) {
+	assert.Nil(t, newBucket(Limit{}))
+	assert.Nil(t, newBucket(Limit{RequestsPerSecond: -1, Burst: 10}))
+
+	now := time.Now()
+	b := newBucket(Limit{RequestsPerSecond: 10, Burst: 2})
+	require.NotNil(t, b)
+	// The burst is available immediately
+	assert.Equal(t, time.Duration(0), b.reserve(now))
+	assert.Equal(t, time.Duration(0), b.reserve(now))
+	// Further requests must wait, accumulating
+	assert.Equal(t, 100*time.Millisecond, b.reserve(now))
+	assert.Equal(t, 200*time.Millisecond, b.reserve(now))
+	// Cancelled reservations are returned
+	b.cancel()
+	assert.Equal(t, 200*time.Millisecond, b.reserve(now))
+	// Tokens are refilled over time, up to the burst size
+	assert.Equal(t, time.Duration(0), b.reserve(now.Add(time.Hour)))
+	assert.Equal(t, time.Duration(0), b.reserve(now.Add(time.Hour)))
+	assert.Equal(t, 100*time.Millisecond, b.reserve(now.Add(time.Hour)))
+
+	// Burst < 1 is treated as 1
+	b = newBucket(Limit{RequestsPerSecond: 1})
+	require.NotNil(t, b)
+	assert.Equal(t, time.Duration(0), b.reserve(now))
+	assert.Equal(t, time.Second, b.reserve(now))
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+
+	// No limits
+	l := New()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, l.Wait(ctx, "registry.example"))
+	}
+
+	// Per-registry limits; a Limit of 1 request per hour can't be satisfied within the test
+	slow := Limit{RequestsPerSecond: 1.0 / 3600, Burst: 1}
+	l = New(WithDefaultRegistryLimit(slow), WithRegistryLimit("fast.example", Limit{}))
+	for _, registry := range []string{"a.example", "b.example"} {
+		require.NoError(t, l.Wait(ctx, registry))
+		timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		err := l.Wait(timeoutCtx, registry)
+		cancel()
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	}
+	for i := 0; i < 100; i++ {
+		require.NoError(t, l.Wait(ctx, "fast.example"))
+	}
+
+	// A global limit applies to all registries combined
+	l = New(WithGlobalLimit(slow))
+	require.NoError(t, l.Wait(ctx, "a.example"))
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, l.Wait(timeoutCtx, "b.example"), context.DeadlineExceeded)
+
+	// Requests wait for the next available token
+	l = New(WithGlobalLimit(Limit{RequestsPerSecond: 50, Burst: 1}))
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		require.NoError(t, l.Wait(ctx, "a.example"))
+	}
+	assert.GreaterOrEqual(t, time.Since(start), 35*time.Millisecond)
+}
@@ -1,6 +1,8 @@
 package sysregistriesv2
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
 	"io/fs"
 	"os"
@@ -68,6 +70,21 @@ type Endpoint struct {
 	// This can only be set in a registry's Mirror field, not in the registry's primary Endpoint.
 	// This per-mirror setting is allowed only when mirror-by-digest-only is not configured for the primary registry.
 	PullFromMirror string `toml:"pull-from-mirror,omitempty"`
+	// If not empty, TLS connections to the endpoint are only accepted if the server’s certificate chain contains
+	// one of these public keys, in the format "sha256/" followed by the base64-encoded SHA-256 digest of a SubjectPublicKeyInfo
+	// (see tlsclientconfig.PublicKeyPin), even if the chain is otherwise trusted.
+	PinnedPublicKeys []string `toml:"pinned-public-keys,omitempty"`
+}
+
+// validatePinnedPublicKeys returns an error if e.PinnedPublicKeys contains values in an invalid format.
+func (e *Endpoint) validatePinnedPublicKeys() error {
+	for _, pin := range e.PinnedPublicKeys {
+		digest, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, "sha256/"))
+		if !strings.HasPrefix(pin, "sha256/") || err != nil || len(digest) != sha256.Size {
+			return &InvalidRegistries{s: fmt.Sprintf("invalid pinned-public-keys value %q for %q, expected sha256/ followed by a base64-encoded SHA-256 digest", pin, e.Location)}
+		}
+	}
+	return nil
 }
 
 // userRegistriesFile is the path to the per user registry configuration file.
@@ -418,6 +435,10 @@ func (config *V2RegistriesConf) postProcessRegistries() error {
 			}
 		}
 
+		if err := reg.validatePinnedPublicKeys(); err != nil {
+			return err
+		}
+
 		// validate the mirror usage settings does not apply to primary registry
 		if reg.PullFromMirror != "" {
 			return fmt.Errorf("pull-from-mirror must not be set for a non-mirror registry %q", reg.Prefix)
@@ -435,6 +456,9 @@ func (config *V2RegistriesConf) postProcessRegistries() error {
 			if mir.Location == "" {
 				return &InvalidRegistries{s: "invalid condition: mirror location is unset"}
 			}
+			if err := mir.validatePinnedPublicKeys(); err != nil {
+				return err
+			}
 
 			if reg.MirrorByDigestOnly && mir.PullFromMirror != "" {
 				return &InvalidRegistries{s: fmt.Sprintf("cannot set mirror usage mirror-by-digest-only for the registry (%q) and pull-from-mirror for per-mirror (%q) at the same time", reg.Prefix, mir.Location)}
@@ -142,8 +142,10 @@ func TestMirrors(t *testing.T) {
 	assert.Equal(t, 2, len(reg.Mirrors))
 	assert.Equal(t, "mirror-1.registry.com", reg.Mirrors[0].Location)
 	assert.False(t, reg.Mirrors[0].Insecure)
+	assert.Equal(t, []string{"sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=", "sha256/LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564="}, reg.Mirrors[0].PinnedPublicKeys)
 	assert.Equal(t, "mirror-2.registry.com", reg.Mirrors[1].Location)
 	assert.True(t, reg.Mirrors[1].Insecure)
+	assert.Nil(t, reg.Mirrors[1].PinnedPublicKeys)
 }
 
 func TestRefMatchingSubdomainPrefix(t *testing.T) {
@@ -439,6 +441,8 @@ func TestInvalidV2Configs(t *testing.T) {
 		{"testdata/blocked-conflicts.conf", "registry 'registry.com' is defined multiple times with conflicting 'blocked' setting"},
 		{"testdata/missing-mirror-location.conf", "invalid condition: mirror location is unset"},
 		{"testdata/invalid-prefix.conf", "invalid location"},
+		{"testdata/invalid-pinned-public-keys.conf", `invalid pinned-public-keys value "sha256:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="`},
+		{"testdata/invalid-pinned-public-keys-mirror.conf", `invalid pinned-public-keys value "sha256/AAAA"`},
 		{"testdata/this-does-not-exist.conf", "no such file or directory"},
 	} {
 		_, err := GetRegistries(&types.SystemContext{SystemRegistriesConfPath: c.path})
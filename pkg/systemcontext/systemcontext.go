@@ -0,0 +1,383 @@
+// Package systemcontext builds validated, immutable types.SystemContext values.
+//
+// types.SystemContext is a plain struct which is usually filled by direct assignment; that makes it easy to
+// combine settings which conflict (so that some of them are silently ignored), and to accidentally modify a
+// SystemContext shared by concurrent operations. New validates the settings, and returns an Immutable value
+// which can only be read as a copy, or used to Derive other values with different settings.
+package systemcontext
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/digests"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/pkg/tlsclientconfig"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
+)
+
+// Option modifies a types.SystemContext being built by New or Immutable.Derive.
+type Option func(sys *types.SystemContext) error
+
+// Immutable is a validated types.SystemContext which can not be modified.
+type Immutable struct {
+	sys types.SystemContext // Never modified, and never shared with callers
+}
+
+// New returns an Immutable built by applying opts, in order, to an empty types.SystemContext.
+func New(opts ...Option) (*Immutable, error) {
+	return build(&types.SystemContext{}, opts)
+}
+
+// FromSystemContext returns an Immutable with the settings of sys, modified by opts.
+// Later modifications of sys do not affect the returned value.
+func FromSystemContext(sys *types.SystemContext, opts ...Option) (*Immutable, error) {
+	if sys == nil {
+		return New(opts...)
+	}
+	return build(clone(sys), opts)
+}
+
+// Derive returns a new Immutable with the settings of i, modified by opts. i is not modified.
+func (i *Immutable) Derive(opts ...Option) (*Immutable, error) {
+	return build(clone(&i.sys), opts)
+}
+
+// SystemContext returns a copy of the settings of i, which can be passed to the rest of this library.
+// Each call returns a separate copy, so modifying it does not affect i or other copies.
+func (i *Immutable) SystemContext() *types.SystemContext {
+	return clone(&i.sys)
+}
+
+// build applies opts to sys, which must not be shared with anyone else, validates it, and returns it as an Immutable.
+func build(sys *types.SystemContext, opts []Option) (*Immutable, error) {
+	for _, opt := range opts {
+		if err := opt(sys); err != nil {
+			return nil, err
+		}
+	}
+	if err := Validate(sys); err != nil {
+		return nil, err
+	}
+	return &Immutable{sys: *sys}, nil
+}
+
+// Validate returns an error if sys contains conflicting or invalid settings.
+// It is OK to pass nil.
+func Validate(sys *types.SystemContext) error {
+	if sys == nil {
+		return nil
+	}
+	if sys.AuthFilePath != "" && sys.DockerCompatAuthFilePath != "" {
+		return errors.New("AuthFilePath and DockerCompatAuthFilePath can not be set at the same time")
+	}
+	if sys.AuthFileEncryptionKey != nil {
+		if len(sys.AuthFileEncryptionKey) != 32 {
+			return fmt.Errorf("AuthFileEncryptionKey must be 32 bytes long, not %d", len(sys.AuthFileEncryptionKey))
+		}
+		if sys.DockerCompatAuthFilePath != "" {
+			return errors.New("AuthFileEncryptionKey can not be used with DockerCompatAuthFilePath")
+		}
+	}
+	if sys.AuthFileEncryptionKeyringKey != "" {
+		if sys.AuthFileEncryptionKey != nil {
+			return errors.New("AuthFileEncryptionKey and AuthFileEncryptionKeyringKey can not be set at the same time")
+		}
+		if sys.DockerCompatAuthFilePath != "" {
+			return errors.New("AuthFileEncryptionKeyringKey can not be used with DockerCompatAuthFilePath")
+		}
+	}
+	for name, v := range map[string]int64{"MaxManifestSize": sys.MaxManifestSize, "MaxConfigSize": sys.MaxConfigSize, "MaxSignatureSize": sys.MaxSignatureSize} {
+		if v < 0 {
+			return fmt.Errorf("invalid %s %d", name, v)
+		}
+	}
+	if err := digests.ValidatePolicy(sys); err != nil {
+		return err
+	}
+	if err := tlsclientconfig.SetupPolicy(sys, &tls.Config{}); err != nil {
+		return err
+	}
+	if sys.OCIInsecureSkipTLSVerify && sys.OCICertPath != "" {
+		return errors.New("OCICertPath can not be used with OCIInsecureSkipTLSVerify")
+	}
+	if sys.OCIHTTPInsecureSkipTLSVerify && sys.OCIHTTPCertPath != "" {
+		return errors.New("OCIHTTPCertPath can not be used with OCIHTTPInsecureSkipTLSVerify")
+	}
+	if sys.OCISharedBlobDirLinkMode != types.OCISharedBlobLinkNone && sys.OCISharedBlobDirPath == "" {
+		return errors.New("OCISharedBlobDirLinkMode requires OCISharedBlobDirPath")
+	}
+	if sys.OCILayoutLockTimeout < 0 {
+		return fmt.Errorf("invalid OCILayoutLockTimeout %v", sys.OCILayoutLockTimeout)
+	}
+	if sys.OCIArchiveVolumeSize < 0 {
+		return fmt.Errorf("invalid OCIArchiveVolumeSize %d", sys.OCIArchiveVolumeSize)
+	}
+	if sys.DockerCertPath != "" && sys.DockerPerHostCertDirPath != "" {
+		return errors.New("DockerCertPath and DockerPerHostCertDirPath can not be set at the same time")
+	}
+	if sys.DockerAuthConfig != nil && sys.DockerBearerRegistryToken != "" {
+		return errors.New("DockerAuthConfig and DockerBearerRegistryToken can not be set at the same time")
+	}
+	if sys.DockerAuthConfig != nil && sys.DockerAuthConfig.ClientCertificatePath != "" && sys.DockerSPIFFEEndpointSocket != "" {
+		return errors.New("DockerAuthConfig.ClientCertificatePath can not be used with DockerSPIFFEEndpointSocket")
+	}
+	if sys.DockerAuthConfig != nil && sys.DockerPersistRotatedIdentityTokens {
+		return errors.New("DockerPersistRotatedIdentityTokens can not be used with DockerAuthConfig")
+	}
+	if sys.DockerDaemonInsecureSkipTLSVerify && sys.DockerDaemonCertPath == "" {
+		return errors.New("DockerDaemonInsecureSkipTLSVerify requires DockerDaemonCertPath")
+	}
+	if sys.S3ServerSideEncryptionKMSKeyID != "" && sys.S3ServerSideEncryption != "aws:kms" {
+		return errors.New(`S3ServerSideEncryptionKMSKeyID requires S3ServerSideEncryption "aws:kms"`)
+	}
+	if sys.SSHMaxSessions < 0 {
+		return fmt.Errorf("invalid SSHMaxSessions %d", sys.SSHMaxSessions)
+	}
+	if sys.DirForceCompress && sys.DirForceDecompress {
+		return errors.New("DirForceCompress and DirForceDecompress can not be set at the same time")
+	}
+	return nil
+}
+
+// clone returns a deep copy of sys, sharing only values which are immutable or
+// which are not data (types.Logger, types.Metrics, types.RegistryRateLimiter, DockerCredentialsRefresh).
+func clone(sys *types.SystemContext) *types.SystemContext {
+	res := *sys
+	if sys.ShortNameMode != nil {
+		v := *sys.ShortNameMode
+		res.ShortNameMode = &v
+	}
+	res.AuthFileEncryptionKey = slices.Clone(sys.AuthFileEncryptionKey)
+	res.DockerArchiveAdditionalTags = slices.Clone(sys.DockerArchiveAdditionalTags) // reference.NamedTagged values are immutable
+	res.AcceptedDigestAlgorithms = slices.Clone(sys.AcceptedDigestAlgorithms)
+	res.TLSCipherSuites = slices.Clone(sys.TLSCipherSuites)
+	if sys.OCIArchiveCompressionFormat != nil {
+		v := *sys.OCIArchiveCompressionFormat
+		res.OCIArchiveCompressionFormat = &v
+	}
+	res.DockerPinnedPublicKeys = slices.Clone(sys.DockerPinnedPublicKeys)
+	if sys.DockerAuthConfig != nil {
+		v := *sys.DockerAuthConfig
+		res.DockerAuthConfig = &v
+	}
+	if sys.DockerManifestMIMETypeAliases != nil {
+		res.DockerManifestMIMETypeAliases = maps.Clone(sys.DockerManifestMIMETypeAliases)
+	}
+	if sys.S3Credentials != nil {
+		v := *sys.S3Credentials
+		res.S3Credentials = &v
+	}
+	if sys.CompressionFormat != nil {
+		v := *sys.CompressionFormat
+		res.CompressionFormat = &v
+	}
+	if sys.CompressionLevel != nil {
+		v := *sys.CompressionLevel
+		res.CompressionLevel = &v
+	}
+	return &res
+}
+
+// With returns an Option which calls fn to modify settings without a more specific Option.
+func With(fn func(sys *types.SystemContext)) Option {
+	return func(sys *types.SystemContext) error {
+		fn(sys)
+		return nil
+	}
+}
+
+// WithRootForImplicitAbsolutePaths sets types.SystemContext.RootForImplicitAbsolutePaths.
+func WithRootForImplicitAbsolutePaths(path string) Option {
+	return With(func(sys *types.SystemContext) { sys.RootForImplicitAbsolutePaths = path })
+}
+
+// WithSignaturePolicyPath sets types.SystemContext.SignaturePolicyPath.
+func WithSignaturePolicyPath(path string) Option {
+	return With(func(sys *types.SystemContext) { sys.SignaturePolicyPath = path })
+}
+
+// WithRegistriesConf sets types.SystemContext.SystemRegistriesConfPath and SystemRegistriesConfDirPath.
+func WithRegistriesConf(path, dirPath string) Option {
+	return With(func(sys *types.SystemContext) {
+		sys.SystemRegistriesConfPath = path
+		sys.SystemRegistriesConfDirPath = dirPath
+	})
+}
+
+// WithRegistriesDirPath sets types.SystemContext.RegistriesDirPath.
+func WithRegistriesDirPath(path string) Option {
+	return With(func(sys *types.SystemContext) { sys.RegistriesDirPath = path })
+}
+
+// WithAuthFile sets types.SystemContext.AuthFilePath.
+func WithAuthFile(path string) Option {
+	return With(func(sys *types.SystemContext) { sys.AuthFilePath = path })
+}
+
+// WithAuthFileEncryptionKey sets types.SystemContext.AuthFileEncryptionKey.
+func WithAuthFileEncryptionKey(key []byte) Option {
+	return With(func(sys *types.SystemContext) { sys.AuthFileEncryptionKey = slices.Clone(key) })
+}
+
+// WithAuthFileEncryptionKeyringKey sets types.SystemContext.AuthFileEncryptionKeyringKey.
+func WithAuthFileEncryptionKeyringKey(description string) Option {
+	return With(func(sys *types.SystemContext) { sys.AuthFileEncryptionKeyringKey = description })
+}
+
+// WithPlatform sets types.SystemContext.OSChoice, ArchitectureChoice and VariantChoice.
+func WithPlatform(os, architecture, variant string) Option {
+	return With(func(sys *types.SystemContext) {
+		sys.OSChoice = os
+		sys.ArchitectureChoice = architecture
+		sys.VariantChoice = variant
+	})
+}
+
+// WithOSVersion sets types.SystemContext.OSVersionChoice.
+func WithOSVersion(version string) Option {
+	return With(func(sys *types.SystemContext) { sys.OSVersionChoice = version })
+}
+
+// WithDisableForeignLayerURLs sets types.SystemContext.DisableForeignLayerURLs.
+func WithDisableForeignLayerURLs(disable bool) Option {
+	return With(func(sys *types.SystemContext) { sys.DisableForeignLayerURLs = disable })
+}
+
+// WithBigFilesTemporaryDir sets types.SystemContext.BigFilesTemporaryDir.
+func WithBigFilesTemporaryDir(path string) Option {
+	return With(func(sys *types.SystemContext) { sys.BigFilesTemporaryDir = path })
+}
+
+// WithBlobInfoCacheDir sets types.SystemContext.BlobInfoCacheDir.
+func WithBlobInfoCacheDir(path string) Option {
+	return With(func(sys *types.SystemContext) { sys.BlobInfoCacheDir = path })
+}
+
+// WithDockerArchiveAdditionalTags sets types.SystemContext.DockerArchiveAdditionalTags.
+func WithDockerArchiveAdditionalTags(tags ...reference.NamedTagged) Option {
+	return With(func(sys *types.SystemContext) { sys.DockerArchiveAdditionalTags = slices.Clone(tags) })
+}
+
+// WithLogger sets types.SystemContext.Logger.
+func WithLogger(logger types.Logger) Option {
+	return With(func(sys *types.SystemContext) { sys.Logger = logger })
+}
+
+// WithMetrics sets types.SystemContext.Metrics.
+func WithMetrics(metrics types.Metrics) Option {
+	return With(func(sys *types.SystemContext) { sys.Metrics = metrics })
+}
+
+// WithRegistryRateLimiter sets types.SystemContext.RegistryRateLimiter.
+func WithRegistryRateLimiter(limiter types.RegistryRateLimiter) Option {
+	return With(func(sys *types.SystemContext) { sys.RegistryRateLimiter = limiter })
+}
+
+// WithDigestAlgorithm sets types.SystemContext.DigestAlgorithm.
+func WithDigestAlgorithm(algorithm digest.Algorithm) Option {
+	return With(func(sys *types.SystemContext) { sys.DigestAlgorithm = algorithm })
+}
+
+// WithAcceptedDigestAlgorithms sets types.SystemContext.AcceptedDigestAlgorithms.
+func WithAcceptedDigestAlgorithms(algorithms ...digest.Algorithm) Option {
+	return With(func(sys *types.SystemContext) { sys.AcceptedDigestAlgorithms = slices.Clone(algorithms) })
+}
+
+// WithTLSMinVersion sets types.SystemContext.TLSMinVersion.
+func WithTLSMinVersion(version uint16) Option {
+	return With(func(sys *types.SystemContext) { sys.TLSMinVersion = version })
+}
+
+// WithTLSCipherSuites sets types.SystemContext.TLSCipherSuites.
+func WithTLSCipherSuites(suites ...uint16) Option {
+	return With(func(sys *types.SystemContext) { sys.TLSCipherSuites = slices.Clone(suites) })
+}
+
+// WithTLSFIPSMode sets types.SystemContext.TLSFIPSMode.
+func WithTLSFIPSMode(enabled bool) Option {
+	return With(func(sys *types.SystemContext) { sys.TLSFIPSMode = enabled })
+}
+
+// WithOCICertPath sets types.SystemContext.OCICertPath.
+func WithOCICertPath(path string) Option {
+	return With(func(sys *types.SystemContext) { sys.OCICertPath = path })
+}
+
+// WithOCIInsecureSkipTLSVerify sets types.SystemContext.OCIInsecureSkipTLSVerify.
+func WithOCIInsecureSkipTLSVerify(insecure bool) Option {
+	return With(func(sys *types.SystemContext) { sys.OCIInsecureSkipTLSVerify = insecure })
+}
+
+// WithOCIHTTPCertPath sets types.SystemContext.OCIHTTPCertPath.
+func WithOCIHTTPCertPath(path string) Option {
+	return With(func(sys *types.SystemContext) { sys.OCIHTTPCertPath = path })
+}
+
+// WithOCIHTTPInsecureSkipTLSVerify sets types.SystemContext.OCIHTTPInsecureSkipTLSVerify.
+func WithOCIHTTPInsecureSkipTLSVerify(insecure bool) Option {
+	return With(func(sys *types.SystemContext) { sys.OCIHTTPInsecureSkipTLSVerify = insecure })
+}
+
+// WithDockerCertPath sets types.SystemContext.DockerCertPath.
+func WithDockerCertPath(path string) Option {
+	return With(func(sys *types.SystemContext) { sys.DockerCertPath = path })
+}
+
+// WithDockerPerHostCertDirPath sets types.SystemContext.DockerPerHostCertDirPath.
+func WithDockerPerHostCertDirPath(path string) Option {
+	return With(func(sys *types.SystemContext) { sys.DockerPerHostCertDirPath = path })
+}
+
+// WithDockerInsecureSkipTLSVerify sets types.SystemContext.DockerInsecureSkipTLSVerify.
+func WithDockerInsecureSkipTLSVerify(insecure bool) Option {
+	return With(func(sys *types.SystemContext) { sys.DockerInsecureSkipTLSVerify = types.NewOptionalBool(insecure) })
+}
+
+// WithDockerAuth sets types.SystemContext.DockerAuthConfig.
+func WithDockerAuth(auth types.DockerAuthConfig) Option {
+	return With(func(sys *types.SystemContext) { sys.DockerAuthConfig = &auth })
+}
+
+// WithDockerBearerRegistryToken sets types.SystemContext.DockerBearerRegistryToken.
+func WithDockerBearerRegistryToken(token string) Option {
+	return With(func(sys *types.SystemContext) { sys.DockerBearerRegistryToken = token })
+}
+
+// WithDockerRegistryUserAgent sets types.SystemContext.DockerRegistryUserAgent.
+func WithDockerRegistryUserAgent(userAgent string) Option {
+	return With(func(sys *types.SystemContext) { sys.DockerRegistryUserAgent = userAgent })
+}
+
+// WithDockerDaemon sets types.SystemContext.DockerDaemonHost, DockerDaemonCertPath and DockerDaemonInsecureSkipTLSVerify.
+func WithDockerDaemon(host, certPath string, insecureSkipTLSVerify bool) Option {
+	return With(func(sys *types.SystemContext) {
+		sys.DockerDaemonHost = host
+		sys.DockerDaemonCertPath = certPath
+		sys.DockerDaemonInsecureSkipTLSVerify = insecureSkipTLSVerify
+	})
+}
+
+// WithCompression sets types.SystemContext.CompressionFormat to the algorithm named format (as in compression.AlgorithmByName),
+// and CompressionLevel to level, which may be nil to use the default.
+func WithCompression(format string, level *int) Option {
+	return func(sys *types.SystemContext) error {
+		algo, err := compression.AlgorithmByName(format)
+		if err != nil {
+			return err
+		}
+		sys.CompressionFormat = &algo
+		if level != nil {
+			l := *level
+			sys.CompressionLevel = &l
+		} else {
+			sys.CompressionLevel = nil
+		}
+		return nil
+	}
+}
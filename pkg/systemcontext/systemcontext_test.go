@@ -0,0 +1,188 @@
+package systemcontext
+
+import (
+	"crypto/tls"
+	"reflect"
+	"testing"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/pkg/compression"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	i, err := New()
+	require.NoError(t, err)
+	assert.Equal(t, &types.SystemContext{}, i.SystemContext())
+
+	level := 5
+	i, err = New(
+		WithAuthFile("/auth.json"),
+		WithPlatform("linux", "arm64", "v8"),
+		WithDockerCertPath("/certs"),
+		WithDockerInsecureSkipTLSVerify(true),
+		WithDockerAuth(types.DockerAuthConfig{Username: "user", Password: "pass"}),
+		WithTLSMinVersion(tls.VersionTLS12),
+		WithCompression("zstd", &level),
+		With(func(sys *types.SystemContext) { sys.DockerLogMirrorChoice = true }),
+	)
+	require.NoError(t, err)
+	sys := i.SystemContext()
+	assert.Equal(t, "/auth.json", sys.AuthFilePath)
+	assert.Equal(t, "linux", sys.OSChoice)
+	assert.Equal(t, "arm64", sys.ArchitectureChoice)
+	assert.Equal(t, "v8", sys.VariantChoice)
+	assert.Equal(t, "/certs", sys.DockerCertPath)
+	assert.Equal(t, types.OptionalBoolTrue, sys.DockerInsecureSkipTLSVerify)
+	assert.Equal(t, &types.DockerAuthConfig{Username: "user", Password: "pass"}, sys.DockerAuthConfig)
+	assert.Equal(t, uint16(tls.VersionTLS12), sys.TLSMinVersion)
+	require.NotNil(t, sys.CompressionFormat)
+	assert.Equal(t, compression.Zstd.Name(), sys.CompressionFormat.Name())
+	assert.Equal(t, &level, sys.CompressionLevel)
+	assert.True(t, sys.DockerLogMirrorChoice)
+
+	_, err = New(WithCompression("this is not a compression algorithm", nil))
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	for i, opts := range [][]Option{
+		{WithAuthFile("/a"), With(func(sys *types.SystemContext) { sys.DockerCompatAuthFilePath = "/b" })},
+		{WithAuthFileEncryptionKey([]byte("too short"))},
+		{WithAuthFileEncryptionKey(make([]byte, 32)), With(func(sys *types.SystemContext) { sys.DockerCompatAuthFilePath = "/b" })},
+		{WithAuthFileEncryptionKey(make([]byte, 32)), WithAuthFileEncryptionKeyringKey("key")},
+		{WithAuthFileEncryptionKeyringKey("key"), With(func(sys *types.SystemContext) { sys.DockerCompatAuthFilePath = "/b" })},
+		{WithTLSMinVersion(0x0200)},
+		{WithOCICertPath("/certs"), WithOCIInsecureSkipTLSVerify(true)},
+		{WithOCIHTTPCertPath("/certs"), WithOCIHTTPInsecureSkipTLSVerify(true)},
+		{With(func(sys *types.SystemContext) { sys.OCISharedBlobDirLinkMode = types.OCISharedBlobLinkHardlink })},
+		{With(func(sys *types.SystemContext) { sys.OCILayoutLockTimeout = -1 })},
+		{With(func(sys *types.SystemContext) { sys.OCIArchiveVolumeSize = -1 })},
+		{WithDockerCertPath("/a"), WithDockerPerHostCertDirPath("/b")},
+		{WithDockerAuth(types.DockerAuthConfig{Username: "user"}), WithDockerBearerRegistryToken("token")},
+		{WithDockerAuth(types.DockerAuthConfig{Username: "user"}), With(func(sys *types.SystemContext) { sys.DockerPersistRotatedIdentityTokens = true })},
+		{WithDockerAuth(types.DockerAuthConfig{ClientCertificatePath: "/cert.pem", ClientKeyPath: "/key.pem"}), With(func(sys *types.SystemContext) { sys.DockerSPIFFEEndpointSocket = "unix:///agent.sock" })},
+		{WithDockerDaemon("tcp://localhost:2376", "", true)},
+		{With(func(sys *types.SystemContext) { sys.S3ServerSideEncryptionKMSKeyID = "key" })},
+		{With(func(sys *types.SystemContext) { sys.SSHMaxSessions = -1 })},
+		{With(func(sys *types.SystemContext) { sys.MaxManifestSize = -1 })},
+		{With(func(sys *types.SystemContext) { sys.MaxConfigSize = -1 })},
+		{With(func(sys *types.SystemContext) { sys.MaxSignatureSize = -1 })},
+		{With(func(sys *types.SystemContext) { sys.DirForceCompress = true; sys.DirForceDecompress = true })},
+		{WithDigestAlgorithm("md5")},
+		{WithAcceptedDigestAlgorithms(digest.SHA256, "crc32")},
+	} {
+		_, err := New(opts...)
+		assert.Error(t, err, i)
+
+		sys := &types.SystemContext{}
+		for _, opt := range opts {
+			require.NoError(t, opt(sys))
+		}
+		assert.Error(t, Validate(sys), i)
+	}
+
+	for _, opts := range [][]Option{
+		{WithAuthFileEncryptionKey(make([]byte, 32)), WithAuthFile("/a")},
+		{WithAuthFileEncryptionKeyringKey("key"), WithAuthFile("/a")},
+		{WithOCICertPath("/certs")},
+		{WithOCIInsecureSkipTLSVerify(true)},
+		{WithDockerCertPath("/certs"), WithDockerInsecureSkipTLSVerify(true)},
+		{WithDockerAuth(types.DockerAuthConfig{Username: "user"}), With(func(sys *types.SystemContext) { sys.DockerSPIFFEEndpointSocket = "unix:///agent.sock" })},
+		{WithDockerDaemon("tcp://localhost:2376", "/certs", true)},
+		{WithDigestAlgorithm(digest.SHA512), WithAcceptedDigestAlgorithms(digest.SHA512), WithTLSFIPSMode(true)},
+		{With(func(sys *types.SystemContext) {
+			sys.S3ServerSideEncryption = "aws:kms"
+			sys.S3ServerSideEncryptionKMSKeyID = "key"
+		})},
+	} {
+		_, err := New(opts...)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, Validate(nil))
+}
+
+func TestImmutable(t *testing.T) {
+	tag, err := reference.ParseNormalizedNamed("busybox:latest")
+	require.NoError(t, err)
+	i, err := New(
+		WithDockerAuth(types.DockerAuthConfig{Username: "user"}),
+		WithTLSCipherSuites(tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256),
+		WithDockerArchiveAdditionalTags(tag.(reference.NamedTagged)),
+		With(func(sys *types.SystemContext) { sys.DockerManifestMIMETypeAliases = map[string]string{"a": "b"} }),
+	)
+	require.NoError(t, err)
+
+	// Modifying a returned copy does not affect i
+	sys := i.SystemContext()
+	sys.DockerAuthConfig.Username = "modified"
+	sys.TLSCipherSuites[0] = 0
+	sys.DockerArchiveAdditionalTags[0] = nil
+	sys.DockerManifestMIMETypeAliases["a"] = "modified"
+	sys.AuthFilePath = "/modified"
+	sys2 := i.SystemContext()
+	assert.Equal(t, "user", sys2.DockerAuthConfig.Username)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, sys2.TLSCipherSuites)
+	assert.Equal(t, tag, sys2.DockerArchiveAdditionalTags[0])
+	assert.Equal(t, map[string]string{"a": "b"}, sys2.DockerManifestMIMETypeAliases)
+	assert.Equal(t, "", sys2.AuthFilePath)
+
+	// Modifying the input of FromSystemContext does not affect the result
+	input := &types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{Username: "user"}}
+	i2, err := FromSystemContext(input, WithAuthFile("/auth.json"))
+	require.NoError(t, err)
+	input.DockerAuthConfig.Username = "modified"
+	assert.Equal(t, &types.SystemContext{DockerAuthConfig: &types.DockerAuthConfig{Username: "user"}, AuthFilePath: "/auth.json"}, i2.SystemContext())
+	assert.Equal(t, "", input.AuthFilePath)
+
+	// Derive
+	child, err := i.Derive(WithAuthFile("/auth.json"), WithDockerAuth(types.DockerAuthConfig{Username: "child"}))
+	require.NoError(t, err)
+	assert.Equal(t, "/auth.json", child.SystemContext().AuthFilePath)
+	assert.Equal(t, "child", child.SystemContext().DockerAuthConfig.Username)
+	assert.Equal(t, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}, child.SystemContext().TLSCipherSuites)
+	assert.Equal(t, "", i.SystemContext().AuthFilePath)
+	assert.Equal(t, "user", i.SystemContext().DockerAuthConfig.Username)
+	// Derived values are validated
+	_, err = i.Derive(WithDockerBearerRegistryToken("token"))
+	assert.Error(t, err)
+}
+
+func TestCloneHandlesAllFields(t *testing.T) {
+	// If this fails, a field of a reference type was added to types.SystemContext; update clone(), and this list.
+	shared := map[string]struct{}{ // Fields which clone() intentionally does not copy deeply
+		"Logger":                   {},
+		"Metrics":                  {},
+		"RegistryRateLimiter":      {},
+		"DockerCredentialsRefresh": {},
+	}
+	cloned := map[string]struct{}{
+		"ShortNameMode":                 {},
+		"AuthFileEncryptionKey":         {},
+		"DockerArchiveAdditionalTags":   {},
+		"AcceptedDigestAlgorithms":      {},
+		"TLSCipherSuites":               {},
+		"OCIArchiveCompressionFormat":   {},
+		"DockerPinnedPublicKeys":        {},
+		"DockerAuthConfig":              {},
+		"DockerManifestMIMETypeAliases": {},
+		"S3Credentials":                 {},
+		"CompressionFormat":             {},
+		"CompressionLevel":              {},
+	}
+	typ := reflect.TypeOf(types.SystemContext{})
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		switch f.Type.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Map:
+			_, ok := cloned[f.Name]
+			assert.True(t, ok, f.Name)
+		case reflect.Interface, reflect.Func:
+			_, ok := shared[f.Name]
+			assert.True(t, ok, f.Name)
+		}
+	}
+}
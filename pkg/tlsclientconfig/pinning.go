@@ -0,0 +1,85 @@
+package tlsclientconfig
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// publicKeyPinPrefix is the prefix of public key pins, followed by a base64-encoded SHA-256 digest.
+const publicKeyPinPrefix = "sha256/"
+
+// PublicKeyPin returns the pin of the public key of cert, in the format accepted by SetupPinnedPublicKeys:
+// "sha256/" followed by the base64-encoded SHA-256 digest of the certificate’s SubjectPublicKeyInfo
+// (the format used by HTTP Public Key Pinning and e.g. curl --pinnedpubkey).
+func PublicKeyPin(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return publicKeyPinPrefix + base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// ValidatePublicKeyPin returns an error if pin is not in the format returned by PublicKeyPin.
+func ValidatePublicKeyPin(pin string) error {
+	_, err := parsePublicKeyPin(pin)
+	return err
+}
+
+// parsePublicKeyPin returns the SHA-256 digest in pin.
+func parsePublicKeyPin(pin string) ([]byte, error) {
+	if !strings.HasPrefix(pin, publicKeyPinPrefix) {
+		return nil, fmt.Errorf("invalid public key pin %q, expected %s followed by a base64-encoded SHA-256 digest", pin, publicKeyPinPrefix)
+	}
+	digest, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, publicKeyPinPrefix))
+	if err != nil || len(digest) != sha256.Size {
+		return nil, fmt.Errorf("invalid public key pin %q, expected %s followed by a base64-encoded SHA-256 digest", pin, publicKeyPinPrefix)
+	}
+	return digest, nil
+}
+
+// SetupPinnedPublicKeys configures tlsc to only accept servers with a certificate chain containing a public key
+// matching one of pins (in the format returned by PublicKeyPin), in addition to the usual verification.
+// This allows rejecting certificates issued by a compromised, but otherwise trusted, certificate authority.
+//
+// Pins can match the server’s certificate, or any other certificate of a verified chain, typically an intermediate or root CA.
+// If tlsc.InsecureSkipVerify is set, no chains are verified, and only the server’s own certificate is checked.
+// If pins is empty, tlsc is not modified.
+func SetupPinnedPublicKeys(tlsc *tls.Config, pins []string) error {
+	if len(pins) == 0 {
+		return nil
+	}
+	digests := make([][]byte, 0, len(pins))
+	for _, pin := range pins {
+		digest, err := parsePublicKeyPin(pin)
+		if err != nil {
+			return err
+		}
+		digests = append(digests, digest)
+	}
+	tlsc.VerifyConnection = func(state tls.ConnectionState) error {
+		var candidates []*x509.Certificate
+		for _, chain := range state.VerifiedChains {
+			candidates = append(candidates, chain...)
+		}
+		if len(state.VerifiedChains) == 0 && len(state.PeerCertificates) > 0 {
+			// Without verification, other certificates sent by the peer prove nothing; only accept a pinned key actually used by the server.
+			candidates = state.PeerCertificates[:1]
+		}
+		for _, cert := range candidates {
+			certDigest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+			for _, digest := range digests {
+				if subtle.ConstantTimeCompare(certDigest[:], digest) == 1 {
+					return nil
+				}
+			}
+		}
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("server did not provide a certificate to match against pinned public keys")
+		}
+		return fmt.Errorf("certificate of %q (public key %s) does not match any pinned public key", state.ServerName, PublicKeyPin(state.PeerCertificates[0]))
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package tlsclientconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePublicKeyPin(t *testing.T) {
+	for _, pin := range []string{
+		"sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+		"sha256/LCa0a2j/xo/5m0U8HTBBNBNCLXBkg7+g+YpeiGJm564=",
+	} {
+		err := ValidatePublicKeyPin(pin)
+		assert.NoError(t, err, pin)
+	}
+	for _, pin := range []string{
+		"",
+		"sha256/",
+		"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+		"sha256:47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+		"sha512/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=",
+		"sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU",  // Missing padding
+		"sha256/47DEQpj8HBSa-_TImW-5JCeuQeRkm5NMpJWZG3hSuFU=", // base64url
+		"sha256/AAAA", // Too short
+		"sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFUAAAA=", // Too long
+	} {
+		err := ValidatePublicKeyPin(pin)
+		assert.Error(t, err, pin)
+	}
+}
+
+func TestSetupPinnedPublicKeys(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	serverPin := PublicKeyPin(server.Certificate())
+	otherPin := "sha256/47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+
+	get := func(tlsc *tls.Config) error {
+		tr := NewTransport()
+		tr.TLSClientConfig = tlsc
+		defer tr.CloseIdleConnections()
+		resp, err := (&http.Client{Transport: tr}).Get(server.URL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+	newConfig := func() *tls.Config {
+		pool := x509.NewCertPool()
+		pool.AddCert(server.Certificate())
+		return &tls.Config{RootCAs: pool}
+	}
+
+	// No pins
+	tlsc := newConfig()
+	err := SetupPinnedPublicKeys(tlsc, nil)
+	require.NoError(t, err)
+	assert.Nil(t, tlsc.VerifyConnection)
+	err = get(tlsc)
+	assert.NoError(t, err)
+
+	// A matching pin
+	tlsc = newConfig()
+	err = SetupPinnedPublicKeys(tlsc, []string{otherPin, serverPin})
+	require.NoError(t, err)
+	err = get(tlsc)
+	assert.NoError(t, err)
+
+	// A trusted certificate which does not match the pins
+	tlsc = newConfig()
+	err = SetupPinnedPublicKeys(tlsc, []string{otherPin})
+	require.NoError(t, err)
+	err = get(tlsc)
+	assert.ErrorContains(t, err, "does not match any pinned public key")
+
+	// Pins are enforced even without verification
+	tlsc = &tls.Config{InsecureSkipVerify: true}
+	err = SetupPinnedPublicKeys(tlsc, []string{serverPin})
+	require.NoError(t, err)
+	err = get(tlsc)
+	assert.NoError(t, err)
+	tlsc = &tls.Config{InsecureSkipVerify: true}
+	err = SetupPinnedPublicKeys(tlsc, []string{otherPin})
+	require.NoError(t, err)
+	err = get(tlsc)
+	assert.Error(t, err)
+
+	// Invalid pins
+	tlsc = newConfig()
+	err = SetupPinnedPublicKeys(tlsc, []string{serverPin, "invalid"})
+	assert.Error(t, err)
+}
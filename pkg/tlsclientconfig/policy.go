@@ -0,0 +1,88 @@
+package tlsclientconfig
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/types"
+	"golang.org/x/exp/slices"
+)
+
+// fipsCipherSuites are the cipher suites allowed with types.SystemContext.TLSFIPSMode,
+// the TLS 1.2 cipher suites approved for FIPS 140 (as in crypto/tls/fipsonly).
+var fipsCipherSuites = []uint16{
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+}
+
+// fipsCurves are the key exchange curves allowed with types.SystemContext.TLSFIPSMode.
+var fipsCurves = []tls.CurveID{tls.CurveP256, tls.CurveP384}
+
+// SetupPolicy applies the TLS policy settings in sys (TLSMinVersion, TLSCipherSuites and TLSFIPSMode) to tlsc.
+// It must be called after other settings of tlsc are set up, because it may override MinVersion, MaxVersion,
+// CipherSuites and CurvePreferences.
+func SetupPolicy(sys *types.SystemContext, tlsc *tls.Config) error {
+	if sys == nil {
+		return nil
+	}
+	if sys.TLSMinVersion != 0 {
+		switch sys.TLSMinVersion {
+		case tls.VersionTLS10, tls.VersionTLS11, tls.VersionTLS12, tls.VersionTLS13:
+		default:
+			return fmt.Errorf("unknown minimum TLS version 0x%04x", sys.TLSMinVersion)
+		}
+		tlsc.MinVersion = sys.TLSMinVersion
+	}
+	if sys.TLSCipherSuites != nil {
+		if len(sys.TLSCipherSuites) == 0 {
+			return errors.New("no TLS cipher suites are allowed")
+		}
+		for _, id := range sys.TLSCipherSuites {
+			if !isConfigurableCipherSuite(id) {
+				return fmt.Errorf("unknown TLS cipher suite 0x%04x; only TLS 1.0–1.2 cipher suites can be configured", id)
+			}
+			if sys.TLSFIPSMode && !slices.Contains(fipsCipherSuites, id) {
+				return fmt.Errorf("TLS cipher suite %s is not allowed in FIPS mode", tls.CipherSuiteName(id))
+			}
+		}
+		tlsc.CipherSuites = slices.Clone(sys.TLSCipherSuites)
+	}
+	if sys.TLSFIPSMode {
+		if tlsc.MinVersion > tls.VersionTLS12 {
+			return errors.New("TLS versions above 1.2 are not supported in FIPS mode")
+		}
+		tlsc.MinVersion = tls.VersionTLS12
+		tlsc.MaxVersion = tls.VersionTLS12
+		suites := fipsCipherSuites
+		if len(tlsc.CipherSuites) != 0 {
+			suites = []uint16{}
+			for _, id := range tlsc.CipherSuites {
+				if slices.Contains(fipsCipherSuites, id) {
+					suites = append(suites, id)
+				}
+			}
+			if len(suites) == 0 {
+				return errors.New("none of the configured TLS cipher suites are allowed in FIPS mode")
+			}
+		}
+		tlsc.CipherSuites = slices.Clone(suites)
+		tlsc.CurvePreferences = slices.Clone(fipsCurves)
+	}
+	return nil
+}
+
+// isConfigurableCipherSuite returns true if id is a cipher suite known to crypto/tls, which can be used in tls.Config.CipherSuites,
+// i.e. is not a TLS 1.3 cipher suite.
+func isConfigurableCipherSuite(id uint16) bool {
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+		for _, s := range suites {
+			if s.ID == id {
+				return slices.ContainsFunc(s.SupportedVersions, func(v uint16) bool { return v < tls.VersionTLS13 })
+			}
+		}
+	}
+	return false
+}
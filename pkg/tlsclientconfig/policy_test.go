@@ -0,0 +1,98 @@
+package tlsclientconfig
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetupPolicy(t *testing.T) {
+	defaultSuites := []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256}
+
+	for _, c := range []struct {
+		name string
+		sys  *types.SystemContext
+		// Expected values; if suites is nil, defaultSuites are expected.
+		minVersion, maxVersion uint16
+		suites                 []uint16
+		curves                 []tls.CurveID
+	}{
+		{name: "nil", sys: nil},
+		{name: "empty", sys: &types.SystemContext{}},
+		{
+			name:       "min version",
+			sys:        &types.SystemContext{TLSMinVersion: tls.VersionTLS13},
+			minVersion: tls.VersionTLS13,
+		},
+		{
+			name:   "cipher suites",
+			sys:    &types.SystemContext{TLSCipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384}},
+			suites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384},
+		},
+		{
+			name:       "FIPS, filtering default suites",
+			sys:        &types.SystemContext{TLSFIPSMode: true},
+			minVersion: tls.VersionTLS12,
+			maxVersion: tls.VersionTLS12,
+			suites:     []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256},
+			curves:     []tls.CurveID{tls.CurveP256, tls.CurveP384},
+		},
+		{
+			name: "FIPS with cipher suites",
+			sys: &types.SystemContext{
+				TLSMinVersion:   tls.VersionTLS12,
+				TLSCipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+				TLSFIPSMode:     true,
+			},
+			minVersion: tls.VersionTLS12,
+			maxVersion: tls.VersionTLS12,
+			suites:     []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+			curves:     []tls.CurveID{tls.CurveP256, tls.CurveP384},
+		},
+	} {
+		tlsc := &tls.Config{CipherSuites: defaultSuites}
+		err := SetupPolicy(c.sys, tlsc)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, c.minVersion, tlsc.MinVersion, c.name)
+		assert.Equal(t, c.maxVersion, tlsc.MaxVersion, c.name)
+		expectedSuites := c.suites
+		if expectedSuites == nil {
+			expectedSuites = defaultSuites
+		}
+		assert.Equal(t, expectedSuites, tlsc.CipherSuites, c.name)
+		assert.Equal(t, c.curves, tlsc.CurvePreferences, c.name)
+	}
+
+	// FIPS mode without preconfigured cipher suites
+	tlsc := &tls.Config{}
+	err := SetupPolicy(&types.SystemContext{TLSFIPSMode: true}, tlsc)
+	require.NoError(t, err)
+	assert.Equal(t, fipsCipherSuites, tlsc.CipherSuites)
+
+	for _, c := range []struct {
+		name string
+		sys  *types.SystemContext
+	}{
+		{"invalid version", &types.SystemContext{TLSMinVersion: 0x0200}},
+		{"no suites", &types.SystemContext{TLSCipherSuites: []uint16{}}},
+		{"unknown suite", &types.SystemContext{TLSCipherSuites: []uint16{0xFFFF}}},
+		{"TLS 1.3 suite", &types.SystemContext{TLSCipherSuites: []uint16{tls.TLS_AES_128_GCM_SHA256}}},
+		{"FIPS with TLS 1.3", &types.SystemContext{TLSMinVersion: tls.VersionTLS13, TLSFIPSMode: true}},
+		{"FIPS with a non-approved suite", &types.SystemContext{
+			TLSCipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256},
+			TLSFIPSMode:     true,
+		}},
+	} {
+		tlsc := &tls.Config{}
+		err := SetupPolicy(c.sys, tlsc)
+		assert.Error(t, err, c.name)
+	}
+
+	// FIPS mode with only non-approved preconfigured suites
+	tlsc = &tls.Config{CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256}}
+	err = SetupPolicy(&types.SystemContext{TLSFIPSMode: true}, tlsc)
+	assert.Error(t, err)
+}
@@ -0,0 +1,203 @@
+package tlsclientconfig
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/types"
+)
+
+// DefaultReloadCheckInterval is the default interval between checks for changes of certificates used by ReloadingConfig.
+const DefaultReloadCheckInterval = 10 * time.Second
+
+// ReloadingConfig loads certificates and private keys from a directory, like SetupCertificates,
+// and reloads them when the .crt, .cert, and .key files in the directory change, e.g. when they are rotated.
+//
+// Changes are detected by comparing the names, sizes and modification times of the files (following symbolic links,
+// so that e.g. Kubernetes secret volumes are handled), at most once per check interval; the system certificate pool is not reloaded.
+// If reloading fails, e.g. because a certificate was replaced but its private key wasn't yet, the previously loaded
+// certificates continue to be used, until the files change again.
+type ReloadingConfig struct {
+	dir           string
+	checkInterval time.Duration
+	logger        types.Logger
+
+	mutex      sync.Mutex // Protects the members below
+	lastCheck  time.Time
+	state      string // Describes the files which certs were loaded from; compared to detect changes
+	certs      *certificates
+	generation uint64
+}
+
+// NewReloadingConfig returns a ReloadingConfig for certificates in dir, checking for changes at most once per checkInterval
+// (or DefaultReloadCheckInterval, if checkInterval is 0), and logging using sys.
+// It fails if loading the certificates fails.
+func NewReloadingConfig(sys *types.SystemContext, dir string, checkInterval time.Duration) (*ReloadingConfig, error) {
+	logger := logging.For(sys)
+	if checkInterval == 0 {
+		checkInterval = DefaultReloadCheckInterval
+	}
+	state, err := certificateFilesState(dir)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := loadCertificates(logger, dir)
+	if err != nil {
+		return nil, err
+	}
+	return &ReloadingConfig{
+		dir:           dir,
+		checkInterval: checkInterval,
+		logger:        logger,
+		lastCheck:     time.Now(),
+		state:         state,
+		certs:         certs,
+	}, nil
+}
+
+// Dir returns the directory r loads certificates from.
+func (r *ReloadingConfig) Dir() string {
+	return r.dir
+}
+
+// certificateFilesState returns a string describing the .crt, .cert, and .key files in dir, which changes when the files change.
+func certificateFilesState(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) || os.IsPermission(err) { // Treated as an empty directory by loadCertificates
+			return "", nil
+		}
+		return "", err
+	}
+	var state strings.Builder
+	for _, e := range entries {
+		name := e.Name()
+		if !strings.HasSuffix(name, ".crt") && !strings.HasSuffix(name, ".cert") && !strings.HasSuffix(name, ".key") {
+			continue
+		}
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			fmt.Fprintf(&state, "%q: %v\n", name, err)
+			continue
+		}
+		fmt.Fprintf(&state, "%q: %d %d\n", name, fi.Size(), fi.ModTime().UnixNano())
+	}
+	return state.String(), nil
+}
+
+// Generation returns a number which changes whenever the certificates are reloaded, checking for changes first
+// if the check interval has passed since the previous check.
+func (r *ReloadingConfig) Generation() uint64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.checkLocked()
+	return r.generation
+}
+
+// checkLocked reloads the certificates if the check interval has passed since the previous check, and the files have changed.
+// The caller must hold r.mutex.
+func (r *ReloadingConfig) checkLocked() {
+	now := time.Now()
+	if now.Sub(r.lastCheck) < r.checkInterval {
+		return
+	}
+	r.lastCheck = now
+	state, err := certificateFilesState(r.dir)
+	if err != nil {
+		r.logger.Warnf("Checking TLS certificates in %s for changes: %v", r.dir, err)
+		return
+	}
+	if state == r.state {
+		return
+	}
+	r.state = state
+	certs, err := loadCertificates(r.logger, r.dir)
+	if err != nil {
+		r.logger.Warnf("Reloading TLS certificates in %s failed, continuing to use previously loaded certificates: %v", r.dir, err)
+		return
+	}
+	r.logger.Debugf("Reloaded TLS certificates in %s", r.dir)
+	r.certs = certs
+	r.generation++
+}
+
+// SetupCertificates appends / loads the current certs and key pairs to tlsc, like the SetupCertificates function,
+// and returns the Generation of the certificates.
+func (r *ReloadingConfig) SetupCertificates(tlsc *tls.Config) (uint64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.checkLocked()
+	if err := r.certs.apply(tlsc); err != nil {
+		return 0, err
+	}
+	return r.generation, nil
+}
+
+// ReloadingTransport is an http.RoundTripper which uses certificates from a ReloadingConfig:
+// it sends requests using an *http.Transport created by NewTransport, and replaces that transport when the certificates are reloaded.
+type ReloadingTransport struct {
+	base  *tls.Config
+	certs *ReloadingConfig
+
+	mutex      sync.Mutex // Protects the members below
+	transport  *http.Transport
+	generation uint64
+}
+
+// NewReloadingTransport returns a ReloadingTransport using certs, and a clone of base for other TLS settings.
+// base is cloned whenever the certificates are reloaded, so modifications of base made before the first request are used.
+func NewReloadingTransport(base *tls.Config, certs *ReloadingConfig) *ReloadingTransport {
+	return &ReloadingTransport{
+		base:  base,
+		certs: certs,
+	}
+}
+
+// currentTransport returns the transport to use for a request, creating it if necessary.
+func (t *ReloadingTransport) currentTransport() (*http.Transport, error) {
+	generation := t.certs.Generation()
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.transport != nil && t.generation == generation {
+		return t.transport, nil
+	}
+	tlsc := t.base.Clone()
+	generation, err := t.certs.SetupCertificates(tlsc)
+	if err != nil {
+		return nil, err
+	}
+	tr := NewTransport()
+	tr.TLSClientConfig = tlsc
+	if t.transport != nil {
+		t.certs.logger.Debugf("Using reloaded TLS certificates from %s", t.certs.dir)
+		t.transport.CloseIdleConnections()
+	}
+	t.transport = tr
+	t.generation = generation
+	return tr, nil
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *ReloadingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tr, err := t.currentTransport()
+	if err != nil {
+		return nil, err
+	}
+	return tr.RoundTrip(req)
+}
+
+// CloseIdleConnections closes idle connections, as used by http.Client.CloseIdleConnections.
+func (t *ReloadingTransport) CloseIdleConnections() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.transport != nil {
+		t.transport.CloseIdleConnections()
+	}
+}
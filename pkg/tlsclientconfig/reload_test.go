@@ -0,0 +1,101 @@
+package tlsclientconfig
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// copyTestFile copies name from testdata/full to dir.
+func copyTestFile(t *testing.T, dir, name string) {
+	data, err := os.ReadFile(filepath.Join("testdata/full", name))
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, name), data, 0o600)
+	require.NoError(t, err)
+}
+
+func TestReloadingConfig(t *testing.T) {
+	dir := t.TempDir()
+	copyTestFile(t, dir, "ca-cert-1.crt")
+
+	r, err := NewReloadingConfig(nil, dir, time.Nanosecond)
+	require.NoError(t, err)
+	tlsc := tls.Config{}
+	generation, err := r.SetupCertificates(&tlsc)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), generation)
+	assert.NotNil(t, tlsc.RootCAs)
+	assert.Len(t, tlsc.Certificates, 0)
+
+	// An incomplete key pair is not used
+	copyTestFile(t, dir, "client-cert-1.cert")
+	time.Sleep(time.Millisecond)
+	assert.Equal(t, uint64(0), r.Generation())
+	// … until it is completed
+	copyTestFile(t, dir, "client-cert-1.key")
+	time.Sleep(time.Millisecond)
+	assert.Equal(t, uint64(1), r.Generation())
+	tlsc = tls.Config{}
+	generation, err = r.SetupCertificates(&tlsc)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), generation)
+	assert.Len(t, tlsc.Certificates, 1)
+	// No changes
+	time.Sleep(time.Millisecond)
+	assert.Equal(t, uint64(1), r.Generation())
+
+	// Changes are not checked for before the check interval passes
+	r, err = NewReloadingConfig(nil, dir, time.Hour)
+	require.NoError(t, err)
+	err = os.Remove(filepath.Join(dir, "client-cert-1.cert"))
+	require.NoError(t, err)
+	err = os.Remove(filepath.Join(dir, "client-cert-1.key"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), r.Generation())
+
+	// Loading failures are reported on creation
+	_, err = NewReloadingConfig(nil, "testdata/missing-key", 0)
+	assert.Error(t, err)
+	// A missing directory is accepted
+	r, err = NewReloadingConfig(nil, filepath.Join(dir, "this/does/not/exist"), 0)
+	require.NoError(t, err)
+	tlsc = tls.Config{}
+	_, err = r.SetupCertificates(&tlsc)
+	require.NoError(t, err)
+	assert.Nil(t, tlsc.RootCAs)
+}
+
+func TestReloadingTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	r, err := NewReloadingConfig(nil, dir, time.Nanosecond)
+	require.NoError(t, err)
+	base := &tls.Config{}
+	client := &http.Client{Transport: NewReloadingTransport(base, r)}
+	defer client.CloseIdleConnections()
+
+	// The server’s certificate is not trusted
+	_, err = client.Get(server.URL)
+	assert.Error(t, err)
+
+	// Trust the server’s certificate
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	err = os.WriteFile(filepath.Join(dir, "ca.crt"), caPEM, 0o600)
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Nil(t, base.RootCAs) // base is not modified
+}
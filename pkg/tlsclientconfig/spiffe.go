@@ -0,0 +1,317 @@
+//go:build !containers_image_spiffe_stub
+// +build !containers_image_spiffe_stub
+
+package tlsclientconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const (
+	// spiffeFetchX509SVIDMethod is the gRPC method of the SPIFFE Workload API which streams X.509-SVIDs.
+	spiffeFetchX509SVIDMethod = "/SpiffeWorkloadAPI/FetchX509SVID"
+	// spiffeMaxBackoff is the maximum delay between reconnection attempts to the Workload API.
+	spiffeMaxBackoff = 30 * time.Second
+	// spiffeStableStream is how long a stream from the Workload API must last for reconnection attempts to start
+	// with the minimum delay again.
+	spiffeStableStream = time.Minute
+)
+
+// SPIFFESource provides X.509-SVIDs obtained from a SPIFFE Workload API endpoint (e.g. a SPIRE agent) as TLS client certificates.
+// The SVIDs are updated whenever the Workload API provides new ones, e.g. when they are renewed.
+type SPIFFESource struct {
+	logger types.Logger
+	conn   *grpc.ClientConn
+	cancel context.CancelFunc
+	done   chan struct{} // Closed when the background goroutine exits
+
+	mutex sync.Mutex // Protects the members below
+	svid  *tls.Certificate
+}
+
+// NewSPIFFESource connects to the SPIFFE Workload API at endpoint ("unix:///path" or "tcp://ip:port", as in $SPIFFE_ENDPOINT_SOCKET),
+// and waits until it provides an X.509-SVID, or until ctx is done.
+// Failures to receive updated X.509-SVIDs are logged using sys.
+// The caller must call Close on the returned SPIFFESource when done.
+func NewSPIFFESource(ctx context.Context, sys *types.SystemContext, endpoint string) (*SPIFFESource, error) {
+	var target string
+	switch {
+	case strings.HasPrefix(endpoint, "unix:"):
+		target = endpoint
+	case strings.HasPrefix(endpoint, "tcp://"):
+		target = strings.TrimPrefix(endpoint, "tcp://")
+	default:
+		return nil, fmt.Errorf("invalid SPIFFE Workload API endpoint %q, expected unix:///path or tcp://ip:port", endpoint)
+	}
+	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to SPIFFE Workload API %q: %w", endpoint, err)
+	}
+	runCtx, cancel := context.WithCancel(context.Background())
+	s := &SPIFFESource{
+		logger: logging.For(sys),
+		conn:   conn,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	firstUpdate := make(chan error, 1)
+	go s.run(runCtx, endpoint, firstUpdate)
+
+	select {
+	case err = <-firstUpdate:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("fetching X.509-SVID from SPIFFE Workload API %q: %w", endpoint, err)
+	}
+	return s, nil
+}
+
+// run receives X.509-SVIDs until ctx is done, reconnecting as necessary.
+// The outcome of the first attempt to receive an X.509-SVID is sent to firstUpdate.
+func (s *SPIFFESource) run(ctx context.Context, endpoint string, firstUpdate chan<- error) {
+	defer close(s.done)
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := s.watch(ctx, firstUpdate)
+		if ctx.Err() != nil {
+			return
+		}
+		if firstUpdate != nil {
+			firstUpdate <- err
+			firstUpdate = nil
+		}
+		if time.Since(start) >= spiffeStableStream {
+			// Don’t reset the backoff just because a stream has provided an X.509-SVID; the Workload API
+			// may be failing right afterwards.
+			backoff = time.Second
+		}
+		s.logger.Warnf("Receiving X.509-SVIDs from SPIFFE Workload API %q failed, retrying in %s: %v", endpoint, backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > spiffeMaxBackoff {
+			backoff = spiffeMaxBackoff
+		}
+	}
+}
+
+// watch receives X.509-SVIDs from a single stream, until it fails.
+// If firstUpdate is not nil, nil is sent to it after receiving the first X.509-SVID.
+func (s *SPIFFESource) watch(ctx context.Context, firstUpdate chan<- error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "workload.spiffe.io", "true")
+	stream, err := s.conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, spiffeFetchX509SVIDMethod, grpc.ForceCodec(rawCodec{}))
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg([]byte{}); err != nil { // An empty X509SVIDRequest
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	for {
+		var msg []byte
+		if err := stream.RecvMsg(&msg); err != nil {
+			return err
+		}
+		svid, err := parseX509SVIDResponse(msg)
+		if err != nil {
+			return err
+		}
+		s.mutex.Lock()
+		s.svid = svid
+		s.mutex.Unlock()
+		s.logger.Debugf("Received X.509-SVID for %s, valid until %s", svid.Leaf.URIs, svid.Leaf.NotAfter)
+		if firstUpdate != nil {
+			firstUpdate <- nil
+			firstUpdate = nil
+		}
+	}
+}
+
+// GetClientCertificate returns the current X.509-SVID; it is suitable for use as tls.Config.GetClientCertificate.
+func (s *SPIFFESource) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.svid == nil {
+		return nil, errors.New("no X.509-SVID available")
+	}
+	return s.svid, nil
+}
+
+// SetupClientCertificate configures tlsc to use the current X.509-SVID as a client certificate.
+// This overrides any client certificates in tlsc.Certificates.
+func (s *SPIFFESource) SetupClientCertificate(tlsc *tls.Config) {
+	tlsc.GetClientCertificate = s.GetClientCertificate
+}
+
+// Close disconnects from the Workload API.  The most recently received X.509-SVID continues to be provided.
+func (s *SPIFFESource) Close() error {
+	s.cancel()
+	err := s.conn.Close()
+	<-s.done
+	return err
+}
+
+// sharedSPIFFESources contains SPIFFESources used by SetupSPIFFEClientCertificate, by endpoint.
+var sharedSPIFFESources = struct {
+	mutex   sync.Mutex
+	sources map[string]*SPIFFESource
+}{sources: map[string]*SPIFFESource{}}
+
+// SetupSPIFFEClientCertificate configures tlsc to use X.509-SVIDs from the SPIFFE Workload API at endpoint as client certificates,
+// like SPIFFESource.SetupClientCertificate.
+// The connection to the Workload API is shared by all callers using the same endpoint, and remains open until the process exits;
+// failures to receive updated X.509-SVIDs are logged using the sys of the caller which opened it.
+func SetupSPIFFEClientCertificate(ctx context.Context, sys *types.SystemContext, endpoint string, tlsc *tls.Config) error {
+	sharedSPIFFESources.mutex.Lock()
+	s, ok := sharedSPIFFESources.sources[endpoint]
+	sharedSPIFFESources.mutex.Unlock()
+	if !ok {
+		// Don’t hold the mutex while connecting, that would block callers using other endpoints.
+		newSource, err := NewSPIFFESource(ctx, sys, endpoint)
+		if err != nil {
+			return err
+		}
+		sharedSPIFFESources.mutex.Lock()
+		s, ok = sharedSPIFFESources.sources[endpoint]
+		if !ok {
+			s = newSource
+			sharedSPIFFESources.sources[endpoint] = s
+		}
+		sharedSPIFFESources.mutex.Unlock()
+		if ok {
+			// Another caller connected in the meantime; use that source.
+			newSource.Close()
+		}
+	}
+	s.SetupClientCertificate(tlsc)
+	return nil
+}
+
+// rawCodec is a grpc encoding.Codec which passes protobuf messages through as []byte values,
+// so that the Workload API can be used without generated code.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v any) ([]byte, error) {
+	b, ok := v.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+	return b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v any) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+	*b = append([]byte(nil), data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto" // The Workload API uses protobuf; this is only a different implementation.
+}
+
+// protobufFields calls fn for each field with the “bytes” wire type (strings, bytes, and embedded messages) in msg;
+// other fields are ignored.
+func protobufFields(msg []byte, fn func(num protowire.Number, value []byte) error) error {
+	for len(msg) > 0 {
+		num, typ, n := protowire.ConsumeTag(msg)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		msg = msg[n:]
+		if typ != protowire.BytesType {
+			n = protowire.ConsumeFieldValue(num, typ, msg)
+			if n < 0 {
+				return protowire.ParseError(n)
+			}
+			msg = msg[n:]
+			continue
+		}
+		value, n := protowire.ConsumeBytes(msg)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		msg = msg[n:]
+		if err := fn(num, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseX509SVIDResponse returns the default (first) X.509-SVID in a X509SVIDResponse message.
+func parseX509SVIDResponse(msg []byte) (*tls.Certificate, error) {
+	var svidMsg []byte
+	found := false
+	if err := protobufFields(msg, func(num protowire.Number, value []byte) error {
+		if num == 1 && !found { // repeated X509SVID svids = 1
+			svidMsg = value
+			found = true
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("parsing X509SVIDResponse: %w", err)
+	}
+	if !found {
+		return nil, errors.New("the Workload API response does not contain any X.509-SVIDs")
+	}
+
+	var certsDER, keyDER []byte
+	if err := protobufFields(svidMsg, func(num protowire.Number, value []byte) error {
+		switch num {
+		case 2: // bytes x509_svid = 2
+			certsDER = value
+		case 3: // bytes x509_svid_key = 3
+			keyDER = value
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("parsing X509SVID: %w", err)
+	}
+	certs, err := x509.ParseCertificates(certsDER)
+	if err != nil {
+		return nil, fmt.Errorf("parsing X.509-SVID certificates: %w", err)
+	}
+	if len(certs) == 0 {
+		return nil, errors.New("the X.509-SVID does not contain any certificates")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyDER)
+	if err != nil {
+		return nil, fmt.Errorf("parsing X.509-SVID private key: %w", err)
+	}
+	res := &tls.Certificate{
+		PrivateKey: key,
+		Leaf:       certs[0],
+	}
+	for _, c := range certs {
+		res.Certificate = append(res.Certificate, c.Raw)
+	}
+	return res, nil
+}
@@ -0,0 +1,41 @@
+//go:build containers_image_spiffe_stub
+// +build containers_image_spiffe_stub
+
+package tlsclientconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+
+	"github.com/containers/image/v5/types"
+)
+
+// SPIFFESource provides X.509-SVIDs obtained from a SPIFFE Workload API endpoint (e.g. a SPIRE agent) as TLS client certificates.
+type SPIFFESource struct{}
+
+// NewSPIFFESource connects to the SPIFFE Workload API at endpoint ("unix:///path" or "tcp://ip:port", as in $SPIFFE_ENDPOINT_SOCKET),
+// and waits until it provides an X.509-SVID, or until ctx is done.
+func NewSPIFFESource(ctx context.Context, sys *types.SystemContext, endpoint string) (*SPIFFESource, error) {
+	return nil, errors.New("SPIFFE support disabled at compile time")
+}
+
+// GetClientCertificate returns the current X.509-SVID; it is suitable for use as tls.Config.GetClientCertificate.
+func (s *SPIFFESource) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return nil, errors.New("SPIFFE support disabled at compile time")
+}
+
+// SetupClientCertificate configures tlsc to use the current X.509-SVID as a client certificate.
+func (s *SPIFFESource) SetupClientCertificate(tlsc *tls.Config) {
+	tlsc.GetClientCertificate = s.GetClientCertificate
+}
+
+// Close disconnects from the Workload API.
+func (s *SPIFFESource) Close() error {
+	return nil
+}
+
+// SetupSPIFFEClientCertificate configures tlsc to use X.509-SVIDs from the SPIFFE Workload API at endpoint as client certificates.
+func SetupSPIFFEClientCertificate(ctx context.Context, sys *types.SystemContext, endpoint string, tlsc *tls.Config) error {
+	return errors.New("SPIFFE support disabled at compile time")
+}
@@ -0,0 +1,203 @@
+//go:build !containers_image_spiffe_stub
+// +build !containers_image_spiffe_stub
+
+package tlsclientconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"net/url"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// newTestX509SVIDResponse returns a X509SVIDResponse message with a newly generated X.509-SVID for spiffeID.
+func newTestX509SVIDResponse(t *testing.T, spiffeID string) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	id, err := url.Parse(spiffeID)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		URIs:         []*url.URL{id},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	var svid []byte
+	svid = protowire.AppendTag(svid, 1, protowire.BytesType)
+	svid = protowire.AppendString(svid, spiffeID)
+	svid = protowire.AppendTag(svid, 2, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, certDER)
+	svid = protowire.AppendTag(svid, 3, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, keyDER)
+	svid = protowire.AppendTag(svid, 4, protowire.BytesType)
+	svid = protowire.AppendBytes(svid, certDER)
+	var res []byte
+	res = protowire.AppendTag(res, 1, protowire.BytesType)
+	res = protowire.AppendBytes(res, svid)
+	res = protowire.AppendTag(res, 2, protowire.VarintType) // An unknown field
+	res = protowire.AppendVarint(res, 42)
+	return res
+}
+
+// startTestWorkloadAPI starts a Workload API server which sends the values received from responses, and returns its endpoint.
+func startTestWorkloadAPI(t *testing.T, responses <-chan []byte) string {
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	server := grpc.NewServer(grpc.ForceServerCodec(rawCodec{}), grpc.UnknownServiceHandler(func(_ any, stream grpc.ServerStream) error {
+		method, _ := grpc.MethodFromServerStream(stream)
+		assert.Equal(t, spiffeFetchX509SVIDMethod, method)
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		assert.Equal(t, []string{"true"}, md.Get("workload.spiffe.io"))
+		var req []byte
+		if err := stream.RecvMsg(&req); err != nil {
+			return err
+		}
+		for {
+			select {
+			case <-stream.Context().Done():
+				return stream.Context().Err()
+			case res := <-responses:
+				if err := stream.SendMsg(res); err != nil {
+					return err
+				}
+			}
+		}
+	}))
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+	return "unix://" + socket
+}
+
+func TestSPIFFESource(t *testing.T) {
+	responses := make(chan []byte, 1)
+	endpoint := startTestWorkloadAPI(t, responses)
+
+	responses <- newTestX509SVIDResponse(t, "spiffe://example.org/first")
+	s, err := NewSPIFFESource(context.Background(), nil, endpoint)
+	require.NoError(t, err)
+	defer s.Close()
+	tlsc := tls.Config{}
+	s.SetupClientCertificate(&tlsc)
+	cert, err := tlsc.GetClientCertificate(&tls.CertificateRequestInfo{})
+	require.NoError(t, err)
+	require.Len(t, cert.Certificate, 1)
+	assert.Equal(t, "spiffe://example.org/first", cert.Leaf.URIs[0].String())
+	assert.IsType(t, &ecdsa.PrivateKey{}, cert.PrivateKey)
+
+	// A renewed SVID is used
+	responses <- newTestX509SVIDResponse(t, "spiffe://example.org/second")
+	require.Eventually(t, func() bool {
+		cert, err := tlsc.GetClientCertificate(&tls.CertificateRequestInfo{})
+		return err == nil && cert.Leaf.URIs[0].String() == "spiffe://example.org/second"
+	}, 10*time.Second, 10*time.Millisecond)
+
+	// The last SVID is still provided after closing
+	err = s.Close()
+	require.NoError(t, err)
+	cert, err = s.GetClientCertificate(&tls.CertificateRequestInfo{})
+	require.NoError(t, err)
+	assert.Equal(t, "spiffe://example.org/second", cert.Leaf.URIs[0].String())
+}
+
+func TestNewSPIFFESourceErrors(t *testing.T) {
+	// Invalid endpoints
+	for _, endpoint := range []string{"", "/path/to/socket", "http://example.com"} {
+		_, err := NewSPIFFESource(context.Background(), nil, endpoint)
+		assert.Error(t, err, endpoint)
+	}
+
+	// Invalid responses
+	responses := make(chan []byte, 1)
+	endpoint := startTestWorkloadAPI(t, responses)
+	responses <- []byte{}
+	_, err := NewSPIFFESource(context.Background(), nil, endpoint)
+	assert.Error(t, err)
+
+	// No response
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = NewSPIFFESource(ctx, nil, endpoint)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestSetupSPIFFEClientCertificate(t *testing.T) {
+	responses := make(chan []byte)
+	endpoint := startTestWorkloadAPI(t, responses)
+	response := newTestX509SVIDResponse(t, "spiffe://example.org/workload")
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case responses <- response:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	// Concurrent callers all end up using the same source.
+	configs := make([]*tls.Config, 3)
+	var wg sync.WaitGroup
+	for i := range configs {
+		i := i
+		configs[i] = &tls.Config{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := SetupSPIFFEClientCertificate(context.Background(), nil, endpoint, configs[i])
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	sharedSPIFFESources.mutex.Lock()
+	s := sharedSPIFFESources.sources[endpoint]
+	sharedSPIFFESources.mutex.Unlock()
+	require.NotNil(t, s)
+	for _, tlsc := range configs {
+		cert, err := tlsc.GetClientCertificate(&tls.CertificateRequestInfo{})
+		require.NoError(t, err)
+		assert.Equal(t, "spiffe://example.org/workload", cert.Leaf.URIs[0].String())
+	}
+}
+
+func TestParseX509SVIDResponse(t *testing.T) {
+	svid, err := parseX509SVIDResponse(newTestX509SVIDResponse(t, "spiffe://example.org/workload"))
+	require.NoError(t, err)
+	assert.Equal(t, "spiffe://example.org/workload", svid.Leaf.URIs[0].String())
+
+	for _, msg := range [][]byte{
+		{},           // No SVIDs
+		{0x0a, 0x05}, // Truncated
+		protowire.AppendBytes([]byte{0x0a}, // SVID without a certificate
+			protowire.AppendString([]byte{0x0a}, "spiffe://example.org/workload")),
+	} {
+		_, err := parseX509SVIDResponse(msg)
+		assert.Error(t, err)
+	}
+}
@@ -8,32 +8,50 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 
-	"github.com/sirupsen/logrus"
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/types"
 	"golang.org/x/exp/slices"
 )
 
 // SetupCertificates opens all .crt, .cert, and .key files in dir and appends / loads certs and key pairs as appropriate to tlsc
 func SetupCertificates(dir string, tlsc *tls.Config) error {
-	logrus.Debugf("Looking for TLS certificates and private keys in %s", dir)
+	certs, err := loadCertificates(logging.For(nil), dir)
+	if err != nil {
+		return err
+	}
+	return certs.apply(tlsc)
+}
+
+// certificates contains the contents of a directory used by SetupCertificates.
+type certificates struct {
+	caPEMs      [][]byte          // Contents of .crt files
+	clientCerts []tls.Certificate // Key pairs from .cert and .key files
+}
+
+// loadCertificates loads all .crt, .cert, and .key files in dir.
+func loadCertificates(logger types.Logger, dir string) (*certificates, error) {
+	res := &certificates{}
+	logger.Debugf("Looking for TLS certificates and private keys in %s", dir)
 	fs, err := os.ReadDir(dir)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil
+			return res, nil
 		}
 		if os.IsPermission(err) {
-			logrus.Debugf("Skipping scan of %s due to permission error: %v", dir, err)
-			return nil
+			logger.Debugf("Skipping scan of %s due to permission error: %v", dir, err)
+			return res, nil
 		}
-		return err
+		return nil, err
 	}
 
 	for _, f := range fs {
 		fullPath := filepath.Join(dir, f.Name())
 		if strings.HasSuffix(f.Name(), ".crt") {
-			logrus.Debugf(" crt: %s", fullPath)
+			logger.Debugf(" crt: %s", fullPath)
 			data, err := os.ReadFile(fullPath)
 			if err != nil {
 				if os.IsNotExist(err) {
@@ -41,45 +59,72 @@ func SetupCertificates(dir string, tlsc *tls.Config) error {
 					// Race with someone who deleted the
 					// file after we read the directory's
 					// list of contents?
-					logrus.Warnf("error reading certificate %q: %v", fullPath, err)
+					logger.Warnf("error reading certificate %q: %v", fullPath, err)
 					continue
 				}
-				return err
-			}
-			if tlsc.RootCAs == nil {
-				systemPool, err := x509.SystemCertPool()
-				if err != nil {
-					return fmt.Errorf("unable to get system cert pool: %w", err)
-				}
-				tlsc.RootCAs = systemPool
+				return nil, err
 			}
-			tlsc.RootCAs.AppendCertsFromPEM(data)
+			res.caPEMs = append(res.caPEMs, data)
 		}
 		if strings.HasSuffix(f.Name(), ".cert") {
 			certName := f.Name()
 			keyName := certName[:len(certName)-5] + ".key"
-			logrus.Debugf(" cert: %s", fullPath)
+			logger.Debugf(" cert: %s", fullPath)
 			if !hasFile(fs, keyName) {
-				return fmt.Errorf("missing key %s for client certificate %s. Note that CA certificates should use the extension .crt", keyName, certName)
+				return nil, fmt.Errorf("missing key %s for client certificate %s. Note that CA certificates should use the extension .crt", keyName, certName)
 			}
 			cert, err := tls.LoadX509KeyPair(filepath.Join(dir, certName), filepath.Join(dir, keyName))
 			if err != nil {
-				return err
+				return nil, err
 			}
-			tlsc.Certificates = append(slices.Clone(tlsc.Certificates), cert)
+			res.clientCerts = append(res.clientCerts, cert)
 		}
 		if strings.HasSuffix(f.Name(), ".key") {
 			keyName := f.Name()
 			certName := keyName[:len(keyName)-4] + ".cert"
-			logrus.Debugf(" key: %s", fullPath)
+			logger.Debugf(" key: %s", fullPath)
 			if !hasFile(fs, certName) {
-				return fmt.Errorf("missing client certificate %s for key %s", certName, keyName)
+				return nil, fmt.Errorf("missing client certificate %s for key %s", certName, keyName)
 			}
 		}
 	}
+	return res, nil
+}
+
+// apply appends / loads certs and key pairs in c to tlsc.
+func (c *certificates) apply(tlsc *tls.Config) error {
+	if len(c.caPEMs) != 0 {
+		if tlsc.RootCAs == nil {
+			systemPool, err := x509.SystemCertPool()
+			if err != nil {
+				return fmt.Errorf("unable to get system cert pool: %w", err)
+			}
+			tlsc.RootCAs = systemPool
+		}
+		for _, data := range c.caPEMs {
+			tlsc.RootCAs.AppendCertsFromPEM(data)
+		}
+	}
+	if len(c.clientCerts) != 0 {
+		tlsc.Certificates = append(slices.Clone(tlsc.Certificates), c.clientCerts...)
+	}
 	return nil
 }
 
+// LoadClientKeyPair loads a TLS client certificate from certPath, and its private key from keyPath,
+// after verifying that the private key is not accessible to other users.
+func LoadClientKeyPair(certPath, keyPath string) (tls.Certificate, error) {
+	fi, err := os.Stat(keyPath)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	// File permissions are not meaningful in this sense on Windows.
+	if runtime.GOOS != "windows" && fi.Mode().Perm()&0o077 != 0 {
+		return tls.Certificate{}, fmt.Errorf("private key %s is accessible to other users (mode %#o), refusing to use it", keyPath, fi.Mode().Perm())
+	}
+	return tls.LoadX509KeyPair(certPath, keyPath)
+}
+
 func hasFile(files []os.DirEntry, name string) bool {
 	return slices.ContainsFunc(files, func(f os.DirEntry) bool {
 		return f.Name() == name
@@ -6,6 +6,8 @@ import (
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"os"
+	"path/filepath"
+	"runtime"
 	"testing"
 
 	"github.com/containers/image/v5/internal/set"
@@ -132,3 +134,30 @@ func TestSetupCertificates(t *testing.T) {
 	err = SetupCertificates("testdata/unreadable-cert", &tlsc)
 	assert.Error(t, err)
 }
+
+func TestLoadClientKeyPair(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"client-cert-1.cert", "client-cert-1.key"} {
+		contents, err := os.ReadFile(filepath.Join("testdata/full", name))
+		require.NoError(t, err)
+		err = os.WriteFile(filepath.Join(dir, name), contents, 0o600)
+		require.NoError(t, err)
+	}
+	certPath, keyPath := filepath.Join(dir, "client-cert-1.cert"), filepath.Join(dir, "client-cert-1.key")
+
+	cert, err := LoadClientKeyPair(certPath, keyPath)
+	require.NoError(t, err)
+	assert.NotEmpty(t, cert.Certificate)
+
+	// A key readable by other users is rejected
+	if runtime.GOOS != "windows" {
+		err = os.Chmod(keyPath, 0o644)
+		require.NoError(t, err)
+		_, err = LoadClientKeyPair(certPath, keyPath)
+		assert.Error(t, err)
+	}
+
+	// A missing key
+	_, err = LoadClientKeyPair(certPath, filepath.Join(dir, "missing.key"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,238 @@
+package sif
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/containers/image/v5/internal/imagedestination/impl"
+	"github.com/containers/image/v5/internal/imagedestination/stubs"
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/putblobdigest"
+	"github.com/containers/image/v5/internal/tmpdir"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type sifImageDestination struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	stubs.NoPutBlobPartialInitialize
+	stubs.NoSignaturesInitialize
+
+	ref      sifReference
+	workDir  string
+	manifest []byte
+}
+
+// newImageDestination returns an ImageDestination for writing a SIF file.
+// The image is only converted, and the file written, on Commit; this requires the fakeroot and mksquashfs programs.
+func newImageDestination(sys *types.SystemContext, ref sifReference) (private.ImageDestination, error) {
+	workDir, err := tmpdir.MkDirBigFileTemp(sys, "sif")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp directory: %w", err)
+	}
+	d := &sifImageDestination{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			SupportedManifestMIMETypes: []string{
+				imgspecv1.MediaTypeImageManifest,
+				manifest.DockerV2Schema2MediaType,
+			},
+			DesiredLayerCompression:        types.Decompress,
+			AcceptsForeignLayerURLs:        false,
+			MustMatchRuntimeOS:             false,
+			IgnoresEmbeddedDockerReference: false, // N/A, DockerReference() returns nil.
+			HasThreadSafePutBlob:           true,
+		}),
+		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
+		NoSignaturesInitialize:     stubs.NoSignatures("Storing signatures for SIF files is not supported"),
+
+		ref:     ref,
+		workDir: workDir,
+	}
+	d.Compat = impl.AddCompat(d)
+	return d, nil
+}
+
+// Reference returns the reference used to set up this destination.  Note that this should directly correspond to user's intent,
+// e.g. it should use the public hostname instead of the result of resolving CNAMEs or following redirects.
+func (d *sifImageDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// Close removes resources associated with an initialized ImageDestination, if any.
+func (d *sifImageDestination) Close() error {
+	return os.RemoveAll(d.workDir)
+}
+
+// blobPath returns the path of a blob with blobDigest within the work directory.
+func (d *sifImageDestination) blobPath(blobDigest digest.Digest) string {
+	return filepath.Join(d.workDir, "blob-"+blobDigest.Encoded())
+}
+
+// PutBlobWithOptions writes contents of stream and returns data representing the result.
+// inputInfo.Digest can be optionally provided if known; if provided, and stream is read to the end without error, the digest MUST match the stream contents.
+// inputInfo.Size is the expected length of stream, if known.
+// inputInfo.MediaType describes the blob format, if known.
+// WARNING: The contents of stream are being verified on the fly.  Until stream.Read() returns io.EOF, the contents of the data SHOULD NOT be available
+// to any other readers for download using the supplied digest.
+// If stream.Read() at any time, ESPECIALLY at end of input, returns an error, PutBlobWithOptions MUST 1) fail, and 2) delete any data stored so far.
+func (d *sifImageDestination) PutBlobWithOptions(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, options private.PutBlobOptions) (private.UploadedBlob, error) {
+	blobFile, err := os.CreateTemp(d.workDir, "sif-put-blob")
+	if err != nil {
+		return private.UploadedBlob{}, err
+	}
+	succeeded := false
+	explicitClosed := false
+	defer func() {
+		if !explicitClosed {
+			blobFile.Close()
+		}
+		if !succeeded {
+			os.Remove(blobFile.Name())
+		}
+	}()
+
+	digester, stream := putblobdigest.DigestIfCanonicalUnknown(stream, inputInfo)
+	// TODO: This can take quite some time, and should ideally be cancellable using ctx.Done().
+	size, err := io.Copy(blobFile, stream)
+	if err != nil {
+		return private.UploadedBlob{}, err
+	}
+	blobDigest := digester.Digest()
+	if inputInfo.Size != -1 && size != inputInfo.Size {
+		return private.UploadedBlob{}, fmt.Errorf("Size mismatch when copying %s, expected %d, got %d", blobDigest, inputInfo.Size, size)
+	}
+	// need to explicitly close the file, since a rename won't otherwise not work on Windows
+	blobFile.Close()
+	explicitClosed = true
+	if err := os.Rename(blobFile.Name(), d.blobPath(blobDigest)); err != nil {
+		return private.UploadedBlob{}, err
+	}
+	succeeded = true
+	return private.UploadedBlob{Digest: blobDigest, Size: size}, nil
+}
+
+// TryReusingBlobWithOptions checks whether the transport already contains, or can efficiently reuse, a blob, and if so, applies it to the current destination
+// (e.g. if the blob is a filesystem layer, this signifies that the changes it describes need to be applied again when composing a filesystem tree).
+// info.Digest must not be empty.
+// If the blob has been successfully reused, returns (true, info, nil).
+// If the transport can not reuse the requested blob, TryReusingBlob returns (false, {}, nil); it returns a non-nil error only on an unexpected failure.
+func (d *sifImageDestination) TryReusingBlobWithOptions(ctx context.Context, info types.BlobInfo, options private.TryReusingBlobOptions) (bool, private.ReusedBlob, error) {
+	if !impl.OriginalBlobMatchesRequiredCompression(options) {
+		return false, private.ReusedBlob{}, nil
+	}
+	if info.Digest == "" {
+		return false, private.ReusedBlob{}, errors.New("Can not check for a blob with unknown digest")
+	}
+	fi, err := os.Stat(d.blobPath(info.Digest))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, private.ReusedBlob{}, nil
+		}
+		return false, private.ReusedBlob{}, err
+	}
+	return true, private.ReusedBlob{Digest: info.Digest, Size: fi.Size()}, nil
+}
+
+// PutManifest writes manifest to the destination.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to write the manifest for (when
+// the primary manifest is a manifest list); this should always be nil if the primary manifest is not a manifest list.
+// It is expected but not enforced that the instanceDigest, when specified, matches the digest of `manifest` as generated
+// by `manifest.Digest()`.
+// FIXME? This should also receive a MIME type if known, to differentiate between schema versions.
+// If the destination is in principle available, refuses this manifest type (e.g. it does not recognize the schema),
+// but may accept a different manifest type, the returned error must be an ManifestTypeRejectedError.
+func (d *sifImageDestination) PutManifest(ctx context.Context, m []byte, instanceDigest *digest.Digest) error {
+	if instanceDigest != nil {
+		return errors.New("manifest lists are not supported by the sif transport")
+	}
+	d.manifest = m
+	return nil
+}
+
+// Commit marks the process of storing the image as successful and asks for the image to be persisted.
+// unparsedToplevel contains data about the top-level manifest of the source (which may be a single-arch image or a manifest list
+// if PutManifest was only called for the single-arch image with instanceDigest == nil), primarily to allow lookups by the
+// original manifest list digest, if desired.
+// WARNING: This does not have any transactional semantics:
+// - Uploaded data MAY be visible to others before Commit() is called
+// - Uploaded data MAY be removed or MAY remain around if Close() is called without Commit() (i.e. rollback is allowed but not guaranteed)
+func (d *sifImageDestination) Commit(ctx context.Context, unparsedToplevel types.UnparsedImage) error {
+	if d.manifest == nil {
+		return errors.New("no manifest was written to the sif transport")
+	}
+	m, err := manifest.FromBlob(d.manifest, manifest.GuessMIMEType(d.manifest))
+	if err != nil {
+		return fmt.Errorf("parsing manifest: %w", err)
+	}
+	config, err := d.readConfig(m.ConfigInfo())
+	if err != nil {
+		return err
+	}
+	if config.OS != "" && config.OS != "linux" {
+		return fmt.Errorf("only Linux images can be stored in SIF files, not %q", config.OS)
+	}
+
+	// We could allocate unique names for all of these using os.{CreateTemp,MkdirTemp}, but workDir is exclusive,
+	// so we can just hard-code a set of unique values here; blobs use the "blob-" prefix.
+	layerPaths := []string{}
+	whiteouts := []layerWhiteouts{}
+	for i, layer := range m.LayerInfos() {
+		if layer.EmptyLayer {
+			continue
+		}
+		layerPath := filepath.Join(d.workDir, fmt.Sprintf("layer-%d.tar", i))
+		defer os.Remove(layerPath)
+		w, err := decompressLayer(d.blobPath(layer.Digest), layerPath)
+		if err != nil {
+			return err
+		}
+		// The compressed version is no longer necessary; remove it as soon as possible to save space.
+		if err := os.Remove(d.blobPath(layer.Digest)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		layerPaths = append(layerPaths, layerPath)
+		whiteouts = append(whiteouts, w)
+	}
+	squashFSPath := filepath.Join(d.workDir, "rootfs.squashfs")
+	defer os.Remove(squashFSPath)
+	if err := createSquashFSFromLayers(ctx, squashFSPath, layerPaths, whiteouts,
+		filepath.Join(d.workDir, "rootfs"), filepath.Join(d.workDir, "fakeroot-state"), filepath.Join(d.workDir, "script")); err != nil {
+		return fmt.Errorf("converting layers to SquashFS: %w", err)
+	}
+
+	// Write to a temporary file first, so that an existing file is not destroyed if writing fails.
+	tmpPath := d.ref.file + ".tmp"
+	defer os.Remove(tmpPath)
+	if err := writeSIFFile(tmpPath, squashFSPath, config); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, d.ref.file)
+}
+
+// readConfig reads and parses the config blob described by info.
+func (d *sifImageDestination) readConfig(info types.BlobInfo) (*imgspecv1.Image, error) {
+	f, err := os.Open(d.blobPath(info.Digest))
+	if err != nil {
+		return nil, fmt.Errorf("opening config: %w", err)
+	}
+	defer f.Close()
+	configBytes, err := iolimits.ReadAtMost(f, iolimits.MaxConfigBodySize)
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+	// The fields we use have the same format in Docker schema2 configs as in OCI configs.
+	var config imgspecv1.Image
+	if err := json.Unmarshal(configBytes, &config); err != nil {
+		return nil, fmt.Errorf("parsing config: %w", err)
+	}
+	return &config, nil
+}
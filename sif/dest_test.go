@@ -0,0 +1,5 @@
+package sif
+
+import "github.com/containers/image/v5/internal/private"
+
+var _ private.ImageDestination = (*sifImageDestination)(nil)
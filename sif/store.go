@@ -0,0 +1,276 @@
+package sif
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/image/v5/pkg/compression"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/sylabs/sif/v2/pkg/sif"
+)
+
+const (
+	whiteoutPrefix = ".wh."
+	whiteoutOpaque = whiteoutPrefix + whiteoutPrefix + ".opq"
+)
+
+// shellQuote returns s quoted for use as a single word in a POSIX shell script.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// generateDefFile generates a SIF definition file, with %environment and %runscript sections
+// based on config, and returns it; the result can be parsed by parseDefFile.
+func generateDefFile(config *imgspecv1.ImageConfig) []byte {
+	var b bytes.Buffer
+	b.WriteString("Bootstrap: scratch\n")
+	if len(config.Env) > 0 {
+		b.WriteString("%environment\n")
+		for _, env := range config.Env {
+			name, value, _ := strings.Cut(env, "=")
+			fmt.Fprintf(&b, "    export %s=%s\n", name, shellQuote(value))
+		}
+	}
+	command := append(append([]string{}, config.Entrypoint...), config.Cmd...)
+	if len(command) > 0 {
+		quoted := make([]string, 0, len(command))
+		for _, arg := range command {
+			quoted = append(quoted, shellQuote(arg))
+		}
+		b.WriteString("%runscript\n")
+		if config.WorkingDir != "" {
+			fmt.Fprintf(&b, "    cd %s\n", shellQuote(config.WorkingDir))
+		}
+		fmt.Fprintf(&b, "    exec %s\n", strings.Join(quoted, " "))
+	}
+	return b.Bytes()
+}
+
+// layerWhiteouts describes the whiteouts in a layer.
+type layerWhiteouts struct {
+	removed []string // Paths, relative to the root, removed by the layer.
+	opaque  []string // Directories, relative to the root, whose contents from lower layers are removed by the layer.
+}
+
+// decompressLayer writes an uncompressed version of the layer at srcPath to destPath, and returns the whiteouts it contains.
+func decompressLayer(srcPath, destPath string) (layerWhiteouts, error) {
+	res := layerWhiteouts{}
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return res, err
+	}
+	defer src.Close()
+	uncompressed, _, err := compression.AutoDecompress(src)
+	if err != nil {
+		return res, fmt.Errorf("decompressing %q: %w", srcPath, err)
+	}
+	defer uncompressed.Close()
+	dest, err := os.Create(destPath)
+	if err != nil {
+		return res, err
+	}
+	defer dest.Close()
+
+	tee := io.TeeReader(uncompressed, dest)
+	tr := tar.NewReader(tee)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, fmt.Errorf("reading layer %q: %w", srcPath, err)
+		}
+		dir, base := path.Split(path.Clean("/" + hdr.Name))
+		switch {
+		case base == whiteoutOpaque:
+			res.opaque = append(res.opaque, dir)
+		case strings.HasPrefix(base, whiteoutPrefix):
+			res.removed = append(res.removed, path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+		}
+	}
+	// Copy any padding after the end of the archive as well.
+	if _, err := io.Copy(io.Discard, tee); err != nil {
+		return res, fmt.Errorf("reading layer %q: %w", srcPath, err)
+	}
+	return res, dest.Close()
+}
+
+// pathInRoot returns the path of relPath, a path relative to the root using slashes, within root,
+// refusing to follow any symbolic links in the parent directories of relPath.
+func pathInRoot(root, relPath string) (string, error) {
+	cleaned := path.Clean("/" + relPath)
+	res := root
+	components := strings.Split(strings.TrimPrefix(cleaned, "/"), "/")
+	for i, c := range components {
+		if c == "" {
+			continue
+		}
+		res = filepath.Join(res, c)
+		if i == len(components)-1 {
+			break
+		}
+		fi, err := os.Lstat(res)
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			return "", fmt.Errorf("refusing to follow symbolic link %q in %q", path.Join(components[:i+1]...), relPath)
+		}
+	}
+	return res, nil
+}
+
+// applyWhiteouts removes the paths whiteouts refers to from the root filesystem at root.
+func applyWhiteouts(root string, whiteouts layerWhiteouts) error {
+	for _, relPath := range whiteouts.removed {
+		if path.Clean("/"+relPath) == "/" { // A whiteout for the root itself is invalid, don't remove everything.
+			continue
+		}
+		p, err := pathInRoot(root, relPath)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+	}
+	for _, relPath := range whiteouts.opaque {
+		p, err := pathInRoot(root, relPath)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		fi, err := os.Lstat(p)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return err
+		}
+		if !fi.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := os.RemoveAll(filepath.Join(p, e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// runFakeroot runs the shell script conversionCommand using fakeroot, storing the fakeroot state in statePath
+// so that file ownership and permissions are preserved across runs.
+// scriptPath is allocated for its exclusive use.
+func runFakeroot(ctx context.Context, conversionCommand, statePath, scriptPath string) error {
+	script := "#!/bin/sh\nset -e\n" + conversionCommand + "\n"
+	if err := os.WriteFile(scriptPath, []byte(script), 0755); err != nil {
+		return err
+	}
+	defer os.Remove(scriptPath)
+
+	args := []string{"-s", statePath}
+	if _, err := os.Stat(statePath); err == nil {
+		args = append(args, "-i", statePath)
+	}
+	args = append(args, "--", scriptPath)
+	logrus.Debugf("Running in fakeroot: %s ...", conversionCommand)
+	cmd := exec.CommandContext(ctx, "fakeroot", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("converting image: %w, output: %s", err, string(output))
+	}
+	logrus.Debugf("... finished running in fakeroot")
+	return nil
+}
+
+// createSquashFSFromLayers applies the uncompressed layers at layerPaths, with whiteouts, in order, and creates
+// a squashfs image of the result at squashFSPath.
+// It uses extractedRootPath, statePath and scriptPath, which are allocated for its exclusive use.
+func createSquashFSFromLayers(ctx context.Context, squashFSPath string, layerPaths []string, whiteouts []layerWhiteouts, extractedRootPath, statePath, scriptPath string) error {
+	// It's safe for the Remove calls to happen even before we create the files, because the paths are exclusive
+	// for our use.
+	defer os.RemoveAll(extractedRootPath)
+	defer os.Remove(statePath)
+
+	if err := os.Mkdir(extractedRootPath, 0755); err != nil {
+		return err
+	}
+	for i, layerPath := range layerPaths {
+		// Whiteouts refer to contents of lower layers, so they must be applied before extracting the layer.
+		if err := applyWhiteouts(extractedRootPath, whiteouts[i]); err != nil {
+			return fmt.Errorf("applying whiteouts of layer %d: %w", i+1, err)
+		}
+		if err := runFakeroot(ctx, fmt.Sprintf("tar --acls --xattrs -C %s --exclude=%s -xpf %s",
+			shellQuote(extractedRootPath), shellQuote(whiteoutPrefix+"*"), shellQuote(layerPath)), statePath, scriptPath); err != nil {
+			return err
+		}
+	}
+	return runFakeroot(ctx, fmt.Sprintf("mksquashfs %s %s -noappend",
+		shellQuote(extractedRootPath), shellQuote(squashFSPath)), statePath, scriptPath)
+}
+
+// writeSIFFile writes a SIF file at path, containing the squashfs image at squashFSPath as the primary partition
+// for the architecture in config, a definition file based on config, and its labels.
+func writeSIFFile(path string, squashFSPath string, config *imgspecv1.Image) error {
+	squashFS, err := os.Open(squashFSPath)
+	if err != nil {
+		return err
+	}
+	defer squashFS.Close()
+
+	defFile, err := sif.NewDescriptorInput(sif.DataDeffile, bytes.NewReader(generateDefFile(&config.Config)))
+	if err != nil {
+		return err
+	}
+	inputs := []sif.DescriptorInput{defFile}
+	if len(config.Config.Labels) > 0 {
+		labels, err := json.Marshal(config.Config.Labels)
+		if err != nil {
+			return err
+		}
+		labelsInput, err := sif.NewDescriptorInput(sif.DataLabels, bytes.NewReader(labels))
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, labelsInput)
+	}
+	partition, err := sif.NewDescriptorInput(sif.DataPartition, squashFS,
+		sif.OptPartitionMetadata(sif.FsSquash, sif.PartPrimSys, config.Architecture))
+	if err != nil {
+		return fmt.Errorf("creating the SIF partition: %w", err)
+	}
+	inputs = append(inputs, partition)
+
+	opts := []sif.CreateOpt{sif.OptCreateWithDescriptors(inputs...)}
+	if config.Created != nil {
+		opts = append(opts, sif.OptCreateWithTime(*config.Created))
+	}
+	img, err := sif.CreateContainerAtPath(path, opts...)
+	if err != nil {
+		return fmt.Errorf("creating SIF file: %w", err)
+	}
+	return img.UnloadContainer()
+}
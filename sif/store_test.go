@@ -0,0 +1,128 @@
+package sif
+
+import (
+	"archive/tar"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/pkg/compression"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateDefFile(t *testing.T) {
+	res := generateDefFile(&imgspecv1.ImageConfig{
+		Env:        []string{"FOO=world", "BAR=it's"},
+		Entrypoint: []string{"/bin/sh", "-c"},
+		Cmd:        []string{`echo "Hello $FOO"`},
+		WorkingDir: "/work",
+	})
+	assert.Equal(t, "Bootstrap: scratch\n"+
+		"%environment\n"+
+		"    export FOO='world'\n"+
+		`    export BAR='it'\''s'`+"\n"+
+		"%runscript\n"+
+		"    cd '/work'\n"+
+		`    exec '/bin/sh' '-c' 'echo "Hello $FOO"'`+"\n", string(res))
+
+	env, rs, err := parseDefFile(bytes.NewReader(res))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"export FOO='world'", `export BAR='it'\''s'`}, env)
+	assert.Equal(t, []string{"cd '/work'", `exec '/bin/sh' '-c' 'echo "Hello $FOO"'`}, rs)
+
+	// Without an environment or a command, nothing needs to be injected when reading the image.
+	res = generateDefFile(&imgspecv1.ImageConfig{})
+	env, rs, err = parseDefFile(bytes.NewReader(res))
+	require.NoError(t, err)
+	assert.Empty(t, env)
+	assert.Empty(t, rs)
+}
+
+func TestDecompressLayer(t *testing.T) {
+	var layer bytes.Buffer
+	w, err := compression.CompressStream(&layer, compression.Gzip, nil)
+	require.NoError(t, err)
+	tw := tar.NewWriter(w)
+	for _, name := range []string{"a/file", "a/.wh.removed", "b/.wh..wh..opq", "./.wh.top"} {
+		err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0o644})
+		require.NoError(t, err)
+	}
+	err = tw.Close()
+	require.NoError(t, err)
+	err = w.Close()
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	srcPath := filepath.Join(dir, "layer.tar.gz")
+	err = os.WriteFile(srcPath, layer.Bytes(), 0o644)
+	require.NoError(t, err)
+	destPath := filepath.Join(dir, "layer.tar")
+	whiteouts, err := decompressLayer(srcPath, destPath)
+	require.NoError(t, err)
+	assert.Equal(t, layerWhiteouts{
+		removed: []string{"/a/removed", "/top"},
+		opaque:  []string{"/b/"},
+	}, whiteouts)
+
+	// The result is a valid uncompressed tar file.
+	f, err := os.Open(destPath)
+	require.NoError(t, err)
+	defer f.Close()
+	tr := tar.NewReader(f)
+	hdr, err := tr.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "a/file", hdr.Name)
+}
+
+func TestApplyWhiteouts(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	for _, dir := range []string{"a", "b/sub", "c"} {
+		err := os.MkdirAll(filepath.Join(root, dir), 0o755)
+		require.NoError(t, err)
+	}
+	for _, file := range []string{"a/removed", "a/kept", "b/file", "b/.hidden", "c/kept"} {
+		err := os.WriteFile(filepath.Join(root, file), nil, 0o644)
+		require.NoError(t, err)
+	}
+	err := os.WriteFile(filepath.Join(outside, "file"), nil, 0o644)
+	require.NoError(t, err)
+	err = os.Symlink(outside, filepath.Join(root, "link"))
+	require.NoError(t, err)
+
+	err = applyWhiteouts(root, layerWhiteouts{
+		removed: []string{"/a/removed", "/does/not/exist", "/"},
+		opaque:  []string{"/b/", "/missing/"},
+	})
+	require.NoError(t, err)
+	for path, exists := range map[string]bool{
+		"a/removed": false,
+		"a/kept":    true,
+		"b":         true,
+		"b/sub":     false,
+		"b/file":    false,
+		"b/.hidden": false,
+		"c/kept":    true,
+	} {
+		_, err := os.Lstat(filepath.Join(root, path))
+		if exists {
+			assert.NoError(t, err, path)
+		} else {
+			assert.ErrorIs(t, err, os.ErrNotExist, path)
+		}
+	}
+
+	// Symbolic links are not followed.
+	err = applyWhiteouts(root, layerWhiteouts{removed: []string{"/link/file"}})
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(outside, "file"))
+	assert.NoError(t, err)
+	// Removing the link itself is fine.
+	err = applyWhiteouts(root, layerWhiteouts{removed: []string{"/link"}})
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(outside, "file"))
+	assert.NoError(t, err)
+}
@@ -101,6 +101,12 @@ func (ref sifReference) DockerReference() reference.Named {
 	return nil
 }
 
+// MetadataRequiresLayerAccess returns true because the SIF root filesystem is converted into a layer when creating an ImageSource.
+// This implements private.MetadataAccessCostReporter.
+func (ref sifReference) MetadataRequiresLayerAccess() bool {
+	return true
+}
+
 // PolicyConfigurationIdentity returns a string representation of the reference, suitable for policy lookup.
 // This MUST reflect user intent, not e.g. after processing of third-party redirects or aliases;
 // The value SHOULD be fully explicit about its semantics, with no hidden defaults, AND canonical
@@ -151,7 +157,7 @@ func (ref sifReference) NewImageSource(ctx context.Context, sys *types.SystemCon
 // NewImageDestination returns a types.ImageDestination for this reference.
 // The caller must call .Close() on the returned ImageDestination.
 func (ref sifReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
-	return nil, errors.New(`"sif:" locations can only be read from, not written to`)
+	return newImageDestination(sys, ref)
 }
 
 // DeleteImage deletes the named image from the registry, if supported.
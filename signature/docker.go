@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/manifest"
@@ -18,6 +19,8 @@ import (
 type SignOptions struct {
 	// Passphare to use when signing with the key identity.
 	Passphrase string
+	// Expiry, if not zero, is the time after which the signature is no longer accepted by verifiers.
+	Expiry time.Time
 }
 
 // SignDockerManifest returns a signature for manifest as the specified dockerReference,
@@ -31,6 +34,10 @@ func SignDockerManifestWithOptions(m []byte, dockerReference string, mech Signin
 
 	var passphrase string
 	if options != nil {
+		if !options.Expiry.IsZero() {
+			expiry := options.Expiry.Unix()
+			sig.untrustedExpiry = &expiry
+		}
 		passphrase = options.Passphrase
 		// The gpgme implementation can’t use passphrase with \n; reject it here for consistent behavior.
 		if strings.Contains(passphrase, "\n") {
@@ -10,6 +10,7 @@ import (
 	"encoding/asn1"
 	"errors"
 	"fmt"
+	"regexp"
 	"time"
 
 	"github.com/containers/image/v5/signature/internal"
@@ -22,20 +23,50 @@ import (
 // Users should call validate() on the policy before using it.
 type fulcioTrustRoot struct {
 	caCertificates *x509.CertPool
-	oidcIssuer     string
-	subjectEmail   string
+	// Exactly one of oidcIssuer and oidcIssuerRegexp must be set.
+	oidcIssuer       string
+	oidcIssuerRegexp *regexp.Regexp
+	// Exactly one of subjectEmail, subjectEmailRegexp, subjectURI and subjectURIRegexp must be set.
+	subjectEmail       string
+	subjectEmailRegexp *regexp.Regexp
+	subjectURI         string
+	subjectURIRegexp   *regexp.Regexp
+	// Revocation checking; all of these may be empty. See fulcio_revocation.go.
+	crls               []*x509.RevocationList
+	ocsp               bool
+	revocationSoftFail bool
+	// ocspRequester, if not nil, is used instead of HTTP POST to send OCSP requests; it is intended for tests.
+	ocspRequester func(server string, request []byte) ([]byte, error)
 }
 
 func (f *fulcioTrustRoot) validate() error {
-	if f.oidcIssuer == "" {
-		return errors.New("Internal inconsistency: Fulcio use set up without OIDC issuer")
+	if (f.oidcIssuer == "") == (f.oidcIssuerRegexp == nil) {
+		return errors.New("Internal inconsistency: Fulcio use set up without exactly one OIDC issuer criterion")
 	}
-	if f.subjectEmail == "" {
-		return errors.New("Internal inconsistency: Fulcio use set up without subject email")
+	subjects := 0
+	if f.subjectEmail != "" {
+		subjects++
+	}
+	if f.subjectEmailRegexp != nil {
+		subjects++
+	}
+	if f.subjectURI != "" {
+		subjects++
+	}
+	if f.subjectURIRegexp != nil {
+		subjects++
+	}
+	if subjects != 1 {
+		return errors.New("Internal inconsistency: Fulcio use set up without exactly one subject criterion")
 	}
 	return nil
 }
 
+// compileFulcioRegexp compiles a regexp used for matching Fulcio certificate values; the regexp must match the whole value.
+func compileFulcioRegexp(re string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + re + ")$")
+}
+
 // fulcioIssuerInCertificate returns the OIDC issuer recorded by Fulcio in unutrustedCertificate;
 // it fails if the extension is not present in the certificate, or on any inconsistency.
 func fulcioIssuerInCertificate(untrustedCertificate *x509.Certificate) (string, error) {
@@ -88,7 +119,13 @@ func fulcioIssuerInCertificate(untrustedCertificate *x509.Certificate) (string,
 	}
 }
 
-func (f *fulcioTrustRoot) verifyFulcioCertificateAtTime(relevantTime time.Time, untrustedCertificateBytes []byte, untrustedIntermediateChainBytes []byte) (crypto.PublicKey, error) {
+// fulcioSignerIdentity is the signer identity recorded in a Fulcio certificate accepted by a fulcioTrustRoot.
+type fulcioSignerIdentity struct {
+	oidcIssuer string
+	subject    string // The email address or URI accepted by the fulcioTrustRoot
+}
+
+func (f *fulcioTrustRoot) verifyFulcioCertificateAtTime(relevantTime time.Time, untrustedCertificateBytes []byte, untrustedIntermediateChainBytes []byte) (crypto.PublicKey, fulcioSignerIdentity, error) {
 	// == Verify the certificate is correctly signed
 	var untrustedIntermediatePool *x509.CertPool // = nil
 	// untrustedCertificateChainPool.AppendCertsFromPEM does something broadly similar,
@@ -98,7 +135,7 @@ func (f *fulcioTrustRoot) verifyFulcioCertificateAtTime(relevantTime time.Time,
 	if len(untrustedIntermediateChainBytes) > 0 {
 		untrustedIntermediateChain, err := cryptoutils.UnmarshalCertificatesFromPEM(untrustedIntermediateChainBytes)
 		if err != nil {
-			return nil, internal.NewInvalidSignatureError(fmt.Sprintf("loading certificate chain: %v", err))
+			return nil, fulcioSignerIdentity{}, internal.NewInvalidSignatureError(fmt.Sprintf("loading certificate chain: %v", err))
 		}
 		untrustedIntermediatePool = x509.NewCertPool()
 		if len(untrustedIntermediateChain) > 1 {
@@ -110,15 +147,15 @@ func (f *fulcioTrustRoot) verifyFulcioCertificateAtTime(relevantTime time.Time,
 
 	untrustedLeafCerts, err := cryptoutils.UnmarshalCertificatesFromPEM(untrustedCertificateBytes)
 	if err != nil {
-		return nil, internal.NewInvalidSignatureError(fmt.Sprintf("parsing leaf certificate: %v", err))
+		return nil, fulcioSignerIdentity{}, internal.NewInvalidSignatureError(fmt.Sprintf("parsing leaf certificate: %v", err))
 	}
 	switch len(untrustedLeafCerts) {
 	case 0:
-		return nil, internal.NewInvalidSignatureError("no certificate found in signature certificate data")
+		return nil, fulcioSignerIdentity{}, internal.NewInvalidSignatureError("no certificate found in signature certificate data")
 	case 1:
 		break // OK
 	default:
-		return nil, internal.NewInvalidSignatureError("unexpected multiple certificates present in signature certificate data")
+		return nil, fulcioSignerIdentity{}, internal.NewInvalidSignatureError("unexpected multiple certificates present in signature certificate data")
 	}
 	untrustedCertificate := untrustedLeafCerts[0]
 
@@ -134,7 +171,7 @@ func (f *fulcioTrustRoot) verifyFulcioCertificateAtTime(relevantTime time.Time,
 		untrustedCertificate.UnhandledCriticalExtensions = remaining
 	}
 
-	if _, err := untrustedCertificate.Verify(x509.VerifyOptions{
+	untrustedChains, err := untrustedCertificate.Verify(x509.VerifyOptions{
 		Intermediates: untrustedIntermediatePool,
 		Roots:         f.caCertificates,
 		// NOTE: Cosign uses untrustedCertificate.NotBefore here (i.e. uses _that_ time for intermediate certificate validation),
@@ -143,8 +180,19 @@ func (f *fulcioTrustRoot) verifyFulcioCertificateAtTime(relevantTime time.Time,
 		// Assuming the certificate is fulcio-generated and very short-lived, that should make little difference.
 		CurrentTime: relevantTime,
 		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
-	}); err != nil {
-		return nil, internal.NewInvalidSignatureError(fmt.Sprintf("veryfing leaf certificate failed: %v", err))
+	})
+	if err != nil {
+		verificationErr := internal.NewInvalidSignatureError(fmt.Sprintf("veryfing leaf certificate failed: %v", err))
+		var certErr x509.CertificateInvalidError
+		if errors.As(err, &certErr) && certErr.Reason == x509.Expired {
+			return nil, fulcioSignerIdentity{}, ExpiredCertificateError{err: verificationErr}
+		}
+		return nil, fulcioSignerIdentity{}, verificationErr
+	}
+	// NOTE: Revocation is checked as of now, not as of relevantTime: a certificate revoked after the signature was created
+	// (e.g. because its key was compromised) can’t be trusted to have created the signature at the claimed time.
+	if err := f.verifyRevocation(time.Now(), untrustedChains); err != nil {
+		return nil, fulcioSignerIdentity{}, err
 	}
 
 	// Cosign verifies a SCT of the certificate (either embedded, or even, probably irrelevant, externally-supplied).
@@ -170,38 +218,84 @@ func (f *fulcioTrustRoot) verifyFulcioCertificateAtTime(relevantTime time.Time,
 	// == Validate the recorded OIDC issuer
 	oidcIssuer, err := fulcioIssuerInCertificate(untrustedCertificate)
 	if err != nil {
-		return nil, err
+		return nil, fulcioSignerIdentity{}, err
 	}
-	if oidcIssuer != f.oidcIssuer {
-		return nil, internal.NewInvalidSignatureError(fmt.Sprintf("Unexpected Fulcio OIDC issuer %q", oidcIssuer))
+	if f.oidcIssuerRegexp != nil {
+		if !f.oidcIssuerRegexp.MatchString(oidcIssuer) {
+			return nil, fulcioSignerIdentity{}, IdentityMismatchError{err: internal.NewInvalidSignatureError(fmt.Sprintf("Unexpected Fulcio OIDC issuer %q", oidcIssuer))}
+		}
+	} else if oidcIssuer != f.oidcIssuer {
+		return nil, fulcioSignerIdentity{}, IdentityMismatchError{err: internal.NewInvalidSignatureError(fmt.Sprintf("Unexpected Fulcio OIDC issuer %q", oidcIssuer))}
 	}
 
 	// == Validate the OIDC subject
-	if !slices.Contains(untrustedCertificate.EmailAddresses, f.subjectEmail) {
-		return nil, internal.NewInvalidSignatureError(fmt.Sprintf("Required email %s not found (got %#v)",
-			f.subjectEmail,
-			untrustedCertificate.EmailAddresses))
+	subject, err := f.verifySubject(untrustedCertificate)
+	if err != nil {
+		return nil, fulcioSignerIdentity{}, err
 	}
 	// FIXME: Match more subject types? Cosign does:
 	// - .DNSNames (can’t be issued by Fulcio)
 	// - .IPAddresses (can’t be issued by Fulcio)
-	// - .URIs (CAN be issued by Fulcio)
 	// - OtherName values in SAN (CAN be issued by Fulcio)
 	// - Various values about GitHub workflows (CAN be issued by Fulcio)
 	// What does it… mean to get an OAuth2 identity for an IP address?
-	// FIXME: How far into Turing-completeness for the issuer/subject do we need to get? Simultaneously accepted alternatives, for
-	// issuers and/or subjects and/or combinations? Regexps? More?
 
-	return untrustedCertificate.PublicKey, nil
+	return untrustedCertificate.PublicKey, fulcioSignerIdentity{oidcIssuer: oidcIssuer, subject: subject}, nil
 }
 
-func verifyRekorFulcio(rekorPublicKey *ecdsa.PublicKey, fulcioTrustRoot *fulcioTrustRoot, untrustedRekorSET []byte,
+// verifySubject verifies that untrustedCertificate contains a subject accepted by f, and returns that subject.
+func (f *fulcioTrustRoot) verifySubject(untrustedCertificate *x509.Certificate) (string, error) {
+	switch {
+	case f.subjectEmail != "":
+		if !slices.Contains(untrustedCertificate.EmailAddresses, f.subjectEmail) {
+			return "", IdentityMismatchError{err: internal.NewInvalidSignatureError(fmt.Sprintf("Required email %s not found (got %#v)",
+				f.subjectEmail,
+				untrustedCertificate.EmailAddresses))}
+		}
+		return f.subjectEmail, nil
+	case f.subjectEmailRegexp != nil:
+		i := slices.IndexFunc(untrustedCertificate.EmailAddresses, f.subjectEmailRegexp.MatchString)
+		if i == -1 {
+			return "", IdentityMismatchError{err: internal.NewInvalidSignatureError(fmt.Sprintf("No email matching %q found (got %#v)",
+				f.subjectEmailRegexp.String(),
+				untrustedCertificate.EmailAddresses))}
+		}
+		return untrustedCertificate.EmailAddresses[i], nil
+	case f.subjectURI != "" || f.subjectURIRegexp != nil:
+		uris := make([]string, 0, len(untrustedCertificate.URIs))
+		for _, u := range untrustedCertificate.URIs {
+			uris = append(uris, u.String())
+		}
+		var i int
+		if f.subjectURI != "" {
+			i = slices.Index(uris, f.subjectURI)
+		} else {
+			i = slices.IndexFunc(uris, f.subjectURIRegexp.MatchString)
+		}
+		if i == -1 {
+			expected := f.subjectURI
+			if f.subjectURIRegexp != nil {
+				expected = f.subjectURIRegexp.String()
+			}
+			return "", IdentityMismatchError{err: internal.NewInvalidSignatureError(fmt.Sprintf("Required URI %s not found (got %#v)", expected, uris))}
+		}
+		return uris[i], nil
+	default: // Coverage: This should never happen, validate() rejects such trust roots.
+		return "", errors.New("Internal inconsistency: Fulcio use set up without a subject criterion")
+	}
+}
+
+func verifyRekorFulcio(rekorPublicKeys []*ecdsa.PublicKey, fulcioTrustRoot *fulcioTrustRoot, untrustedRekorSET []byte,
 	untrustedCertificateBytes []byte, untrustedIntermediateChainBytes []byte, untrustedBase64Signature string,
-	untrustedPayloadBytes []byte) (crypto.PublicKey, error) {
-	rekorSETTime, err := internal.VerifyRekorSET(rekorPublicKey, untrustedRekorSET, untrustedCertificateBytes,
+	untrustedPayloadBytes []byte) (crypto.PublicKey, fulcioSignerIdentity, internal.VerifiedRekorSETEntry, error) {
+	rekorEntry, err := verifyRekorSETEntry(rekorPublicKeys, untrustedRekorSET, untrustedCertificateBytes,
 		untrustedBase64Signature, untrustedPayloadBytes)
 	if err != nil {
-		return nil, err
+		return nil, fulcioSignerIdentity{}, internal.VerifiedRekorSETEntry{}, err
+	}
+	pk, identity, err := fulcioTrustRoot.verifyFulcioCertificateAtTime(rekorEntry.IntegratedTime, untrustedCertificateBytes, untrustedIntermediateChainBytes)
+	if err != nil {
+		return nil, fulcioSignerIdentity{}, internal.VerifiedRekorSETEntry{}, err
 	}
-	return fulcioTrustRoot.verifyFulcioCertificateAtTime(rekorSETTime, untrustedCertificateBytes, untrustedIntermediateChainBytes)
+	return pk, identity, rekorEntry, nil
 }
@@ -8,21 +8,41 @@ import (
 	"crypto/ecdsa"
 	"crypto/x509"
 	"errors"
+	"regexp"
+
+	"github.com/containers/image/v5/signature/internal"
 )
 
 type fulcioTrustRoot struct {
-	caCertificates *x509.CertPool
-	oidcIssuer     string
-	subjectEmail   string
+	caCertificates     *x509.CertPool
+	oidcIssuer         string
+	oidcIssuerRegexp   *regexp.Regexp
+	subjectEmail       string
+	subjectEmailRegexp *regexp.Regexp
+	subjectURI         string
+	subjectURIRegexp   *regexp.Regexp
+	crls               []*x509.RevocationList
+	ocsp               bool
+	revocationSoftFail bool
+}
+
+func compileFulcioRegexp(re string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + re + ")$")
 }
 
 func (f *fulcioTrustRoot) validate() error {
 	return errors.New("fulcio disabled at compile-time")
 }
 
-func verifyRekorFulcio(rekorPublicKey *ecdsa.PublicKey, fulcioTrustRoot *fulcioTrustRoot, untrustedRekorSET []byte,
+// fulcioSignerIdentity is the signer identity recorded in a Fulcio certificate accepted by a fulcioTrustRoot.
+type fulcioSignerIdentity struct {
+	oidcIssuer string
+	subject    string // The email address or URI accepted by the fulcioTrustRoot
+}
+
+func verifyRekorFulcio(rekorPublicKeys []*ecdsa.PublicKey, fulcioTrustRoot *fulcioTrustRoot, untrustedRekorSET []byte,
 	untrustedCertificateBytes []byte, untrustedIntermediateChainBytes []byte, untrustedBase64Signature string,
-	untrustedPayloadBytes []byte) (crypto.PublicKey, error) {
-	return nil, errors.New("fulcio disabled at compile-time")
+	untrustedPayloadBytes []byte) (crypto.PublicKey, fulcioSignerIdentity, internal.VerifiedRekorSETEntry, error) {
+	return nil, fulcioSignerIdentity{}, internal.VerifiedRekorSETEntry{}, errors.New("fulcio disabled at compile-time")
 
 }
@@ -13,7 +13,9 @@ import (
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/pem"
+	"net/url"
 	"os"
+	"regexp"
 	"testing"
 	"time"
 
@@ -51,11 +53,44 @@ func TestFulcioTrustRootValidate(t *testing.T) {
 			oidcIssuer:     "issuer",
 			subjectEmail:   "",
 		},
+		{
+			caCertificates:   certs,
+			oidcIssuer:       "issuer",
+			oidcIssuerRegexp: regexp.MustCompile("issuer"),
+			subjectEmail:     "email",
+		},
+		{
+			caCertificates: certs,
+			oidcIssuer:     "issuer",
+			subjectEmail:   "email",
+			subjectURI:     "https://example.com",
+		},
 	} {
 		err := tr.validate()
 		assert.Error(t, err)
 	}
 
+	for _, tr := range []fulcioTrustRoot{
+		{
+			caCertificates:     certs,
+			oidcIssuerRegexp:   regexp.MustCompile("issuer"),
+			subjectEmailRegexp: regexp.MustCompile("email"),
+		},
+		{
+			caCertificates: certs,
+			oidcIssuer:     "issuer",
+			subjectURI:     "https://example.com",
+		},
+		{
+			caCertificates:   certs,
+			oidcIssuer:       "issuer",
+			subjectURIRegexp: regexp.MustCompile("https://example.com/.*"),
+		},
+	} {
+		err := tr.validate()
+		assert.NoError(t, err)
+	}
+
 	tr := fulcioTrustRoot{
 		caCertificates: certs,
 		oidcIssuer:     "issuer",
@@ -231,17 +266,18 @@ func TestFulcioTrustRootVerifyFulcioCertificateAtTime(t *testing.T) {
 		oidcIssuer:     "https://github.com/login/oauth",
 		subjectEmail:   "mitr@redhat.com",
 	}
-	pk, err := tr.verifyFulcioCertificateAtTime(time.Unix(1670870899, 0), fulcioCertBytes, fulcioChainBytes)
+	pk, identity, err := tr.verifyFulcioCertificateAtTime(time.Unix(1670870899, 0), fulcioCertBytes, fulcioChainBytes)
 	require.NoError(t, err)
 	assertPublicKeyMatchesCert(t, fulcioCertBytes, pk)
+	assert.Equal(t, fulcioSignerIdentity{oidcIssuer: "https://github.com/login/oauth", subject: "mitr@redhat.com"}, identity)
 
 	// Invalid intermediate certificates
-	pk, err = tr.verifyFulcioCertificateAtTime(time.Unix(1670870899, 0), fulcioCertBytes, []byte("not a certificate"))
+	pk, _, err = tr.verifyFulcioCertificateAtTime(time.Unix(1670870899, 0), fulcioCertBytes, []byte("not a certificate"))
 	assert.Error(t, err)
 	assert.Nil(t, pk)
 
 	// No intermediate certificates: verification fails as is …
-	pk, err = tr.verifyFulcioCertificateAtTime(time.Unix(1670870899, 0), fulcioCertBytes, []byte{})
+	pk, _, err = tr.verifyFulcioCertificateAtTime(time.Unix(1670870899, 0), fulcioCertBytes, []byte{})
 	assert.Error(t, err)
 	assert.Nil(t, pk)
 	// … but succeeds if we add the intermediate certificates to the root of trust
@@ -253,7 +289,7 @@ func TestFulcioTrustRootVerifyFulcioCertificateAtTime(t *testing.T) {
 		oidcIssuer:     "https://github.com/login/oauth",
 		subjectEmail:   "mitr@redhat.com",
 	}
-	pk, err = trWithIntermediates.verifyFulcioCertificateAtTime(time.Unix(1670870899, 0), fulcioCertBytes, []byte{})
+	pk, _, err = trWithIntermediates.verifyFulcioCertificateAtTime(time.Unix(1670870899, 0), fulcioCertBytes, []byte{})
 	require.NoError(t, err)
 	assertPublicKeyMatchesCert(t, fulcioCertBytes, pk)
 
@@ -263,7 +299,7 @@ func TestFulcioTrustRootVerifyFulcioCertificateAtTime(t *testing.T) {
 		{},                               // Empty
 		bytes.Repeat(fulcioCertBytes, 2), // More than one certificate
 	} {
-		pk, err := tr.verifyFulcioCertificateAtTime(time.Unix(1670870899, 0), c, fulcioChainBytes)
+		pk, _, err := tr.verifyFulcioCertificateAtTime(time.Unix(1670870899, 0), c, fulcioChainBytes)
 		assert.Error(t, err)
 		assert.Nil(t, pk)
 	}
@@ -273,8 +309,9 @@ func TestFulcioTrustRootVerifyFulcioCertificateAtTime(t *testing.T) {
 		time.Date(2022, time.December, 12, 18, 48, 17, 0, time.UTC),
 		time.Date(2022, time.December, 12, 18, 58, 19, 0, time.UTC),
 	} {
-		pk, err := tr.verifyFulcioCertificateAtTime(tm, fulcioCertBytes, fulcioChainBytes)
-		assert.Error(t, err)
+		pk, _, err := tr.verifyFulcioCertificateAtTime(tm, fulcioCertBytes, fulcioChainBytes)
+		var expiredErr ExpiredCertificateError
+		assert.ErrorAs(t, err, &expiredErr)
 		assert.Nil(t, pk)
 	}
 
@@ -302,6 +339,7 @@ func TestFulcioTrustRootVerifyFulcioCertificateAtTime(t *testing.T) {
 	for _, c := range []struct {
 		name          string
 		fn            func(cert *x509.Certificate)
+		trFn          func(tr *fulcioTrustRoot) // If set, modifies the default trust root
 		errorFragment string
 	}{
 		{
@@ -391,6 +429,87 @@ func TestFulcioTrustRootVerifyFulcioCertificateAtTime(t *testing.T) {
 			},
 			errorFragment: "Required email test-user@example.com not found",
 		},
+		{
+			name: "Issuer regexp matches",
+			fn:   func(cert *x509.Certificate) {},
+			trFn: func(tr *fulcioTrustRoot) {
+				tr.oidcIssuer = ""
+				tr.oidcIssuerRegexp = mustCompileFulcioRegexp(t, `https://github\.com/.*`)
+			},
+			errorFragment: "",
+		},
+		{
+			name: "Issuer regexp mismatch",
+			fn:   func(cert *x509.Certificate) {},
+			trFn: func(tr *fulcioTrustRoot) {
+				tr.oidcIssuer = ""
+				tr.oidcIssuerRegexp = mustCompileFulcioRegexp(t, `github\.com`) // Must match the whole value
+			},
+			errorFragment: "Unexpected Fulcio OIDC issuer",
+		},
+		{
+			name: "Email regexp matches",
+			fn: func(cert *x509.Certificate) {
+				cert.EmailAddresses = []string{"a@example.org", "b@example.com"}
+			},
+			trFn: func(tr *fulcioTrustRoot) {
+				tr.subjectEmail = ""
+				tr.subjectEmailRegexp = mustCompileFulcioRegexp(t, `.*@example\.com`)
+			},
+			errorFragment: "",
+		},
+		{
+			name: "Email regexp mismatch",
+			fn:   func(cert *x509.Certificate) {},
+			trFn: func(tr *fulcioTrustRoot) {
+				tr.subjectEmail = ""
+				tr.subjectEmailRegexp = mustCompileFulcioRegexp(t, `.*@example\.org`)
+			},
+			errorFragment: "No email matching",
+		},
+		{
+			name: "URI matches",
+			fn: func(cert *x509.Certificate) {
+				cert.EmailAddresses = nil
+				cert.URIs = []*url.URL{{Scheme: "https", Host: "github.com", Path: "/org/repo/.github/workflows/release.yml"}}
+			},
+			trFn: func(tr *fulcioTrustRoot) {
+				tr.subjectEmail = ""
+				tr.subjectURI = "https://github.com/org/repo/.github/workflows/release.yml"
+			},
+			errorFragment: "",
+		},
+		{
+			name: "URI mismatch",
+			fn: func(cert *x509.Certificate) {
+				cert.URIs = []*url.URL{{Scheme: "https", Host: "github.com", Path: "/org/other/.github/workflows/release.yml"}}
+			},
+			trFn: func(tr *fulcioTrustRoot) {
+				tr.subjectEmail = ""
+				tr.subjectURI = "https://github.com/org/repo/.github/workflows/release.yml"
+			},
+			errorFragment: "Required URI https://github.com/org/repo/.github/workflows/release.yml not found",
+		},
+		{
+			name: "URI regexp matches",
+			fn: func(cert *x509.Certificate) {
+				cert.URIs = []*url.URL{{Scheme: "https", Host: "github.com", Path: "/org/repo/.github/workflows/release.yml"}}
+			},
+			trFn: func(tr *fulcioTrustRoot) {
+				tr.subjectEmail = ""
+				tr.subjectURIRegexp = mustCompileFulcioRegexp(t, `https://github\.com/org/[^/]+/\.github/workflows/.*`)
+			},
+			errorFragment: "",
+		},
+		{
+			name: "URI regexp without URIs",
+			fn:   func(cert *x509.Certificate) {},
+			trFn: func(tr *fulcioTrustRoot) {
+				tr.subjectEmail = ""
+				tr.subjectURIRegexp = mustCompileFulcioRegexp(t, `.*`)
+			},
+			errorFragment: "Required URI",
+		},
 	} {
 		testLeafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
 		require.NoError(t, err, c.name)
@@ -412,14 +531,20 @@ func TestFulcioTrustRootVerifyFulcioCertificateAtTime(t *testing.T) {
 			oidcIssuer:     "https://github.com/login/oauth",
 			subjectEmail:   "test-user@example.com",
 		}
+		if c.trFn != nil {
+			c.trFn(&tr)
+		}
+		require.NoError(t, tr.validate(), c.name)
 		testLeafPEM := pem.EncodeToMemory(&pem.Block{
 			Type:  "CERTIFICATE",
 			Bytes: testLeafCert,
 		})
-		pk, err := tr.verifyFulcioCertificateAtTime(referenceTime, testLeafPEM, []byte{})
+		pk, identity, err := tr.verifyFulcioCertificateAtTime(referenceTime, testLeafPEM, []byte{})
 		if c.errorFragment == "" {
 			require.NoError(t, err, c.name)
 			assertPublicKeyMatchesCert(t, testLeafPEM, pk)
+			assert.Equal(t, "https://github.com/login/oauth", identity.oidcIssuer, c.name)
+			assert.NotEmpty(t, identity.subject, c.name)
 		} else {
 			assert.ErrorContains(t, err, c.errorFragment, c.name)
 			assert.Nil(t, pk, c.name)
@@ -427,6 +552,13 @@ func TestFulcioTrustRootVerifyFulcioCertificateAtTime(t *testing.T) {
 	}
 }
 
+// mustCompileFulcioRegexp is compileFulcioRegexp that must not fail
+func mustCompileFulcioRegexp(t *testing.T, re string) *regexp.Regexp {
+	res, err := compileFulcioRegexp(re)
+	require.NoError(t, err)
+	return res
+}
+
 func TestVerifyRekorFulcio(t *testing.T) {
 	caCertificates := x509.NewCertPool()
 	fulcioCABundlePEM, err := os.ReadFile("fixtures/fulcio_v1.crt.pem")
@@ -451,16 +583,18 @@ func TestVerifyRekorFulcio(t *testing.T) {
 	require.NoError(t, err)
 
 	// Success
-	pk, err := verifyRekorFulcio(rekorKeyECDSA, &fulcioTrustRoot{
+	pk, identity, rekorEntry, err := verifyRekorFulcio([]*ecdsa.PublicKey{rekorKeyECDSA}, &fulcioTrustRoot{
 		caCertificates: caCertificates,
 		oidcIssuer:     "https://github.com/login/oauth",
 		subjectEmail:   "mitr@redhat.com",
 	}, setBytes, certBytes, chainBytes, string(sigBase64), payloadBytes)
 	require.NoError(t, err)
 	assertPublicKeyMatchesCert(t, certBytes, pk)
+	assert.Equal(t, fulcioSignerIdentity{oidcIssuer: "https://github.com/login/oauth", subject: "mitr@redhat.com"}, identity)
+	assert.Equal(t, int64(8949589), rekorEntry.LogIndex)
 
 	// Rekor failure
-	pk, err = verifyRekorFulcio(rekorKeyECDSA, &fulcioTrustRoot{
+	pk, _, _, err = verifyRekorFulcio([]*ecdsa.PublicKey{rekorKeyECDSA}, &fulcioTrustRoot{
 		caCertificates: caCertificates,
 		oidcIssuer:     "https://github.com/login/oauth",
 		subjectEmail:   "mitr@redhat.com",
@@ -469,7 +603,7 @@ func TestVerifyRekorFulcio(t *testing.T) {
 	assert.Nil(t, pk)
 
 	// Fulcio failure
-	pk, err = verifyRekorFulcio(rekorKeyECDSA, &fulcioTrustRoot{
+	pk, _, _, err = verifyRekorFulcio([]*ecdsa.PublicKey{rekorKeyECDSA}, &fulcioTrustRoot{
 		caCertificates: caCertificates,
 		oidcIssuer:     "https://github.com/login/oauth",
 		subjectEmail:   "this-does-not-match@example.com",
@@ -0,0 +1,201 @@
+//go:build !containers_image_fulcio_stub
+// +build !containers_image_fulcio_stub
+
+package signature
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/signature/internal"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ocsp"
+)
+
+// ocspRequestTimeout is the maximum time we spend waiting for a single OCSP responder.
+const ocspRequestTimeout = 10 * time.Second
+
+// revocationStatus is the revocation status of a single certificate.
+type revocationStatus int
+
+const (
+	revocationStatusUnknown revocationStatus = iota
+	revocationStatusGood
+	revocationStatusRevoked
+)
+
+// verifyRevocation checks the revocation status of certificates in untrustedChains, as returned by x509.Certificate.Verify,
+// as of now. It succeeds if at least one of the chains contains no revoked certificates, and, unless f.revocationSoftFail,
+// no certificates with an unknown revocation status.
+func (f *fulcioTrustRoot) verifyRevocation(now time.Time, untrustedChains [][]*x509.Certificate) error {
+	if len(f.crls) == 0 && !f.ocsp {
+		return nil
+	}
+	if len(untrustedChains) == 0 {
+		return internal.NewInvalidSignatureError("no certificate chain to check for revocation")
+	}
+	var firstErr error
+	for _, chain := range untrustedChains {
+		err := f.verifyChainRevocation(now, chain)
+		if err == nil {
+			return nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// verifyChainRevocation checks the revocation status of all certificates in untrustedChain, except for the trusted root.
+func (f *fulcioTrustRoot) verifyChainRevocation(now time.Time, untrustedChain []*x509.Certificate) error {
+	for i := 0; i+1 < len(untrustedChain); i++ {
+		cert, issuer := untrustedChain[i], untrustedChain[i+1]
+		description := fmt.Sprintf("certificate with serial number %s issued by %q", cert.SerialNumber.String(), issuer.Subject.String())
+		switch status, err := f.certificateRevocationStatus(now, cert, issuer); status {
+		case revocationStatusGood:
+			// OK
+		case revocationStatusRevoked:
+			return internal.NewInvalidSignatureError(fmt.Sprintf("%s has been revoked", description))
+		default:
+			msg := fmt.Sprintf("revocation status of %s can’t be determined: %v", description, err)
+			if !f.revocationSoftFail {
+				return internal.NewInvalidSignatureError(msg)
+			}
+			logrus.Warnf("Accepting certificate because of soft-fail revocation checking: %s", msg)
+		}
+	}
+	return nil
+}
+
+// certificateRevocationStatus returns the revocation status of cert, issued by issuer, using all configured sources.
+// A certificate is revoked if any source says so, and good if it is not revoked and at least one source says so.
+// If the status is revocationStatusUnknown, the returned error describes why.
+func (f *fulcioTrustRoot) certificateRevocationStatus(now time.Time, cert, issuer *x509.Certificate) (revocationStatus, error) {
+	results := []revocationStatus{}
+	reasons := []string{}
+	if len(f.crls) != 0 {
+		status, err := crlRevocationStatus(f.crls, now, cert, issuer)
+		if status == revocationStatusRevoked {
+			return status, nil
+		}
+		results = append(results, status)
+		if err != nil {
+			reasons = append(reasons, err.Error())
+		}
+	}
+	if f.ocsp {
+		status, err := f.ocspRevocationStatus(now, cert, issuer)
+		if status == revocationStatusRevoked {
+			return status, nil
+		}
+		results = append(results, status)
+		if err != nil {
+			reasons = append(reasons, err.Error())
+		}
+	}
+	for _, status := range results {
+		if status == revocationStatusGood {
+			return revocationStatusGood, nil
+		}
+	}
+	return revocationStatusUnknown, errors.New(strings.Join(reasons, "; "))
+}
+
+// crlRevocationStatus returns the revocation status of cert, issued by issuer, according to crls.
+// If the status is revocationStatusUnknown, the returned error describes why.
+func crlRevocationStatus(crls []*x509.RevocationList, now time.Time, cert, issuer *x509.Certificate) (revocationStatus, error) {
+	current := false
+	for _, crl := range crls {
+		if !bytes.Equal(crl.RawIssuer, issuer.RawSubject) {
+			continue
+		}
+		if err := crl.CheckSignatureFrom(issuer); err != nil {
+			logrus.Debugf("Ignoring certificate revocation list with an invalid signature: %v", err)
+			continue
+		}
+		// A revoked certificate is revoked even if the CRL is outdated.
+		for _, revoked := range crl.RevokedCertificates { //nolint:staticcheck // RevokedCertificateEntries requires Go 1.21.
+			if revoked.SerialNumber != nil && revoked.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+				return revocationStatusRevoked, nil
+			}
+		}
+		if !now.Before(crl.ThisUpdate) && (crl.NextUpdate.IsZero() || now.Before(crl.NextUpdate)) {
+			current = true
+		}
+	}
+	if !current {
+		return revocationStatusUnknown, fmt.Errorf("no current certificate revocation list for issuer %q", issuer.Subject.String())
+	}
+	return revocationStatusGood, nil
+}
+
+// ocspRevocationStatus returns the revocation status of cert, issued by issuer, according to the OCSP responders listed in cert.
+// If the status is revocationStatusUnknown, the returned error describes why.
+func (f *fulcioTrustRoot) ocspRevocationStatus(now time.Time, cert, issuer *x509.Certificate) (revocationStatus, error) {
+	if len(cert.OCSPServer) == 0 {
+		return revocationStatusUnknown, errors.New("the certificate does not list any OCSP responders")
+	}
+	request, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return revocationStatusUnknown, fmt.Errorf("creating OCSP request: %w", err)
+	}
+	requester := f.ocspRequester
+	if requester == nil {
+		requester = sendOCSPRequest
+	}
+	reasons := []string{}
+	for _, server := range cert.OCSPServer {
+		responseBytes, err := requester(server, request)
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("OCSP responder %s: %v", server, err))
+			continue
+		}
+		// ParseResponseForCert verifies that the response is signed by issuer, or by a responder certificate issued by issuer.
+		response, err := ocsp.ParseResponseForCert(responseBytes, cert, issuer)
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("OCSP responder %s: invalid response: %v", server, err))
+			continue
+		}
+		if now.Before(response.ThisUpdate) || (!response.NextUpdate.IsZero() && !now.Before(response.NextUpdate)) {
+			reasons = append(reasons, fmt.Sprintf("OCSP responder %s: response is not current", server))
+			continue
+		}
+		switch response.Status {
+		case ocsp.Good:
+			return revocationStatusGood, nil
+		case ocsp.Revoked:
+			return revocationStatusRevoked, nil
+		default:
+			reasons = append(reasons, fmt.Sprintf("OCSP responder %s: status unknown", server))
+		}
+	}
+	return revocationStatusUnknown, errors.New(strings.Join(reasons, "; "))
+}
+
+// sendOCSPRequest sends an OCSP request to server using HTTP POST, and returns the response.
+func sendOCSPRequest(server string, request []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ocspRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(request))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/ocsp-request")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d (%s)", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+	return iolimits.ReadAtMost(res.Body, iolimits.MaxOCSPResponseBodySize)
+}
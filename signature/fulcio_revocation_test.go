@@ -0,0 +1,280 @@
+//go:build !containers_image_fulcio_stub
+// +build !containers_image_fulcio_stub
+
+package signature
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ocsp"
+)
+
+// revocationTestCA is a CA used for revocation tests.
+type revocationTestCA struct {
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+}
+
+// newRevocationTestCA returns a new self-signed revocationTestCA.
+func newRevocationTestCA(t *testing.T, name string, now time.Time) revocationTestCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             now.Add(-1 * time.Hour),
+		NotAfter:              now.Add(1 * time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, key.Public(), key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return revocationTestCA{key: key, cert: cert}
+}
+
+// issue returns a new leaf certificate with serialNumber issued by ca.
+func (ca revocationTestCA) issue(t *testing.T, serialNumber int64, ocspServers []string, now time.Time) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(serialNumber),
+		NotBefore:    now.Add(-1 * time.Minute),
+		NotAfter:     now.Add(10 * time.Minute),
+		OCSPServer:   ocspServers,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, ca.cert, key.Public(), ca.key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert
+}
+
+// crl returns a DER-encoded CRL issued by ca, valid from thisUpdate to nextUpdate, listing revokedSerialNumbers.
+func (ca revocationTestCA) crl(t *testing.T, thisUpdate, nextUpdate time.Time, revokedSerialNumbers ...int64) []byte {
+	revoked := []pkix.RevokedCertificate{}
+	for _, sn := range revokedSerialNumbers {
+		revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: big.NewInt(sn), RevocationTime: thisUpdate})
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:              big.NewInt(1),
+		ThisUpdate:          thisUpdate,
+		NextUpdate:          nextUpdate,
+		RevokedCertificates: revoked, //nolint:staticcheck // RevokedCertificateEntries requires Go 1.21.
+	}, ca.cert, ca.key)
+	require.NoError(t, err)
+	return der
+}
+
+// parsedCRL is crl, parsed.
+func (ca revocationTestCA) parsedCRL(t *testing.T, thisUpdate, nextUpdate time.Time, revokedSerialNumbers ...int64) *x509.RevocationList {
+	crl, err := x509.ParseRevocationList(ca.crl(t, thisUpdate, nextUpdate, revokedSerialNumbers...))
+	require.NoError(t, err)
+	return crl
+}
+
+// ocspResponse returns an OCSP response for cert with status, signed by ca.
+func (ca revocationTestCA) ocspResponse(t *testing.T, cert *x509.Certificate, status int, thisUpdate, nextUpdate time.Time) []byte {
+	res, err := ocsp.CreateResponse(ca.cert, ca.cert, ocsp.Response{
+		Status:           status,
+		SerialNumber:     cert.SerialNumber,
+		ThisUpdate:       thisUpdate,
+		NextUpdate:       nextUpdate,
+		RevokedAt:        thisUpdate,
+		RevocationReason: ocsp.Unspecified,
+	}, ca.key)
+	require.NoError(t, err)
+	return res
+}
+
+func TestFulcioTrustRootVerifyRevocation(t *testing.T) {
+	now := time.Now()
+	ca := newRevocationTestCA(t, "CA", now)
+	otherCA := newRevocationTestCA(t, "CA", now) // Same name, different key
+	unrelatedCA := newRevocationTestCA(t, "unrelated CA", now)
+	const ocspServer = "http://ocsp.example.com"
+	leaf := ca.issue(t, 10, []string{ocspServer}, now)
+	revokedLeaf := ca.issue(t, 11, []string{ocspServer}, now)
+	noOCSPLeaf := ca.issue(t, 12, nil, now)
+	past, future := now.Add(-30*time.Minute), now.Add(30*time.Minute)
+
+	ocspReturning := func(response []byte, err error) func(string, []byte) ([]byte, error) {
+		return func(server string, request []byte) ([]byte, error) {
+			assert.Equal(t, ocspServer, server)
+			return response, err
+		}
+	}
+
+	// No revocation checking configured
+	tr := fulcioTrustRoot{}
+	err := tr.verifyRevocation(now, [][]*x509.Certificate{{revokedLeaf, ca.cert}})
+	assert.NoError(t, err)
+
+	for _, c := range []struct {
+		name       string
+		leaf       *x509.Certificate
+		crls       []*x509.RevocationList
+		ocsp       func(string, []byte) ([]byte, error) // If set, OCSP is enabled
+		hardResult revocationStatus
+	}{
+		{"CRL, good", leaf, []*x509.RevocationList{ca.parsedCRL(t, past, future, 11)}, nil, revocationStatusGood},
+		{"CRL, revoked", revokedLeaf, []*x509.RevocationList{ca.parsedCRL(t, past, future, 11)}, nil, revocationStatusRevoked},
+		{"Multiple CRLs", revokedLeaf, []*x509.RevocationList{
+			unrelatedCA.parsedCRL(t, past, future),
+			ca.parsedCRL(t, past, future),
+			ca.parsedCRL(t, past.Add(-time.Hour), past, 11),
+		}, nil, revocationStatusRevoked},
+		{"Outdated CRL", leaf, []*x509.RevocationList{ca.parsedCRL(t, past.Add(-time.Hour), past, 11)}, nil, revocationStatusUnknown},
+		{"Future CRL", leaf, []*x509.RevocationList{ca.parsedCRL(t, future, future.Add(time.Hour), 11)}, nil, revocationStatusUnknown},
+		{"Outdated CRL, revoked", revokedLeaf, []*x509.RevocationList{ca.parsedCRL(t, past.Add(-time.Hour), past, 11)}, nil, revocationStatusRevoked},
+		{"CRL by a different issuer", revokedLeaf, []*x509.RevocationList{unrelatedCA.parsedCRL(t, past, future, 11)}, nil, revocationStatusUnknown},
+		{"CRL with an invalid signature", revokedLeaf, []*x509.RevocationList{otherCA.parsedCRL(t, past, future, 11)}, nil, revocationStatusUnknown},
+
+		{"OCSP, good", leaf, nil, ocspReturning(ca.ocspResponse(t, leaf, ocsp.Good, past, future), nil), revocationStatusGood},
+		{"OCSP, revoked", revokedLeaf, nil, ocspReturning(ca.ocspResponse(t, revokedLeaf, ocsp.Revoked, past, future), nil), revocationStatusRevoked},
+		{"OCSP, unknown", leaf, nil, ocspReturning(ca.ocspResponse(t, leaf, ocsp.Unknown, past, future), nil), revocationStatusUnknown},
+		{"OCSP without nextUpdate", leaf, nil, ocspReturning(ca.ocspResponse(t, leaf, ocsp.Good, past, time.Time{}), nil), revocationStatusGood},
+		{"OCSP, outdated", leaf, nil, ocspReturning(ca.ocspResponse(t, leaf, ocsp.Good, past.Add(-time.Hour), past), nil), revocationStatusUnknown},
+		{"OCSP, future", leaf, nil, ocspReturning(ca.ocspResponse(t, leaf, ocsp.Good, future, future.Add(time.Hour)), nil), revocationStatusUnknown},
+		{"OCSP, responder failure", leaf, nil, ocspReturning(nil, errors.New("connection refused")), revocationStatusUnknown},
+		{"OCSP, invalid response", leaf, nil, ocspReturning([]byte("invalid"), nil), revocationStatusUnknown},
+		{"OCSP, response for a different certificate", leaf, nil, ocspReturning(ca.ocspResponse(t, revokedLeaf, ocsp.Good, past, future), nil), revocationStatusUnknown},
+		{"OCSP, response signed by a different key", leaf, nil, ocspReturning(otherCA.ocspResponse(t, leaf, ocsp.Good, past, future), nil), revocationStatusUnknown},
+		{"OCSP, no responder", noOCSPLeaf, nil, ocspReturning(nil, errors.New("unexpected OCSP request")), revocationStatusUnknown},
+
+		{"CRL good, OCSP failure", leaf, []*x509.RevocationList{ca.parsedCRL(t, past, future)},
+			ocspReturning(nil, errors.New("connection refused")), revocationStatusGood},
+		{"CRL unknown, OCSP good", leaf, []*x509.RevocationList{unrelatedCA.parsedCRL(t, past, future)},
+			ocspReturning(ca.ocspResponse(t, leaf, ocsp.Good, past, future), nil), revocationStatusGood},
+		{"CRL good, OCSP revoked", revokedLeaf, []*x509.RevocationList{ca.parsedCRL(t, past, future)},
+			ocspReturning(ca.ocspResponse(t, revokedLeaf, ocsp.Revoked, past, future), nil), revocationStatusRevoked},
+		{"CRL revoked, OCSP good", revokedLeaf, []*x509.RevocationList{ca.parsedCRL(t, past, future, 11)},
+			ocspReturning(ca.ocspResponse(t, revokedLeaf, ocsp.Good, past, future), nil), revocationStatusRevoked},
+	} {
+		for _, softFail := range []bool{false, true} {
+			tr := fulcioTrustRoot{
+				crls:               c.crls,
+				ocsp:               c.ocsp != nil,
+				revocationSoftFail: softFail,
+				ocspRequester:      c.ocsp,
+			}
+			status, _ := tr.certificateRevocationStatus(now, c.leaf, ca.cert)
+			assert.Equal(t, c.hardResult, status, c.name)
+
+			err := tr.verifyRevocation(now, [][]*x509.Certificate{{c.leaf, ca.cert}})
+			if c.hardResult == revocationStatusGood || (softFail && c.hardResult == revocationStatusUnknown) {
+				assert.NoError(t, err, "%s, soft fail %v", c.name, softFail)
+			} else {
+				assert.Error(t, err, "%s, soft fail %v", c.name, softFail)
+			}
+		}
+	}
+
+	// Multiple chains: one acceptable chain is enough
+	intermediateCA := newRevocationTestCA(t, "intermediate", now)
+	tr = fulcioTrustRoot{
+		crls: []*x509.RevocationList{
+			ca.parsedCRL(t, past, future),
+			intermediateCA.parsedCRL(t, past, future, 11),
+		},
+	}
+	err = tr.verifyRevocation(now, [][]*x509.Certificate{{revokedLeaf, intermediateCA.cert}, {revokedLeaf, ca.cert}})
+	assert.NoError(t, err)
+	err = tr.verifyRevocation(now, [][]*x509.Certificate{{revokedLeaf, intermediateCA.cert}})
+	assert.Error(t, err)
+	// No chains at all
+	err = tr.verifyRevocation(now, [][]*x509.Certificate{})
+	assert.Error(t, err)
+}
+
+func TestFulcioTrustRootVerifyFulcioCertificateAtTimeRevocation(t *testing.T) {
+	fulcioCACertificates := x509.NewCertPool()
+	fulcioCABundlePEM, err := os.ReadFile("fixtures/fulcio_v1.crt.pem")
+	require.NoError(t, err)
+	ok := fulcioCACertificates.AppendCertsFromPEM(fulcioCABundlePEM)
+	require.True(t, ok)
+	fulcioCertBytes, err := os.ReadFile("fixtures/fulcio-cert")
+	require.NoError(t, err)
+	fulcioChainBytes, err := os.ReadFile("fixtures/fulcio-chain")
+	require.NoError(t, err)
+	unrelatedCA := newRevocationTestCA(t, "unrelated CA", time.Now())
+
+	// The fixtures have no CRLs and no OCSP responders, so the revocation status is unknown.
+	for _, softFail := range []bool{false, true} {
+		tr := fulcioTrustRoot{
+			caCertificates:     fulcioCACertificates,
+			oidcIssuer:         "https://github.com/login/oauth",
+			subjectEmail:       "mitr@redhat.com",
+			crls:               []*x509.RevocationList{unrelatedCA.parsedCRL(t, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))},
+			revocationSoftFail: softFail,
+		}
+		pk, _, err := tr.verifyFulcioCertificateAtTime(time.Unix(1670870899, 0), fulcioCertBytes, fulcioChainBytes)
+		if softFail {
+			require.NoError(t, err)
+			assertPublicKeyMatchesCert(t, fulcioCertBytes, pk)
+		} else {
+			assert.Error(t, err)
+			assert.Nil(t, pk)
+		}
+	}
+}
+
+func TestLoadCRLs(t *testing.T) {
+	now := time.Now()
+	ca := newRevocationTestCA(t, "CA", now)
+	crl1 := ca.crl(t, now, now.Add(time.Hour), 1)
+	crl2 := ca.crl(t, now, now.Add(time.Hour), 2)
+	dir := t.TempDir()
+
+	// DER
+	derPath := filepath.Join(dir, "crl.der")
+	err := os.WriteFile(derPath, crl1, 0o644)
+	require.NoError(t, err)
+	crls, err := loadCRLs(derPath)
+	require.NoError(t, err)
+	require.Len(t, crls, 1)
+	assert.Equal(t, crl1, crls[0].Raw)
+
+	// PEM, with multiple CRLs and other data
+	pemPath := filepath.Join(dir, "crl.pem")
+	pemData := append([]byte("Some text\n"), pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl1})...)
+	pemData = append(pemData, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})...)
+	pemData = append(pemData, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl2})...)
+	err = os.WriteFile(pemPath, pemData, 0o644)
+	require.NoError(t, err)
+	crls, err = loadCRLs(pemPath)
+	require.NoError(t, err)
+	require.Len(t, crls, 2)
+	assert.Equal(t, crl1, crls[0].Raw)
+	assert.Equal(t, crl2, crls[1].Raw)
+
+	// Failures
+	for _, c := range []struct{ name, contents string }{
+		{"invalid-der", "this is not a CRL"},
+		{"invalid-pem", string(pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: []byte("this is not a CRL")}))},
+		{"no-crls", string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw}))},
+	} {
+		path := filepath.Join(dir, c.name)
+		err := os.WriteFile(path, []byte(c.contents), 0o644)
+		require.NoError(t, err)
+		_, err = loadCRLs(path)
+		assert.Error(t, err, c.name)
+	}
+	_, err = loadCRLs(filepath.Join(dir, "this/does/not/exist"))
+	assert.Error(t, err)
+}
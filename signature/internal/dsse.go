@@ -0,0 +1,115 @@
+package internal
+
+import (
+	"bytes"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+
+	sigstoreSignature "github.com/sigstore/sigstore/pkg/signature"
+)
+
+// InTotoPayloadType is the DSSE payload type of in-toto statements.
+const InTotoPayloadType = "application/vnd.in-toto+json"
+
+// DSSEEnvelope is a DSSE envelope, per https://github.com/secure-systems-lab/dsse/blob/master/envelope.md .
+type DSSEEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"` // base64-encoded
+	Signatures  []DSSESignature `json:"signatures"`
+}
+
+// DSSESignature is a single signature in a DSSEEnvelope.
+type DSSESignature struct {
+	KeyID string `json:"keyid,omitempty"`
+	Sig   string `json:"sig"` // base64-encoded
+}
+
+// DSSEPreAuthenticationEncoding returns the data which is actually signed in a DSSE envelope
+// for payloadType and payload.
+func DSSEPreAuthenticationEncoding(payloadType string, payload []byte) []byte {
+	res := bytes.Buffer{}
+	fmt.Fprintf(&res, "DSSEv1 %d %s %d ", len(payloadType), payloadType, len(payload))
+	res.Write(payload)
+	return res.Bytes()
+}
+
+// VerifyDSSEEnvelope verifies that unverifiedEnvelope is a DSSE envelope with payload type expectedPayloadType,
+// signed by publicKey, and returns the verified payload.
+func VerifyDSSEEnvelope(publicKey crypto.PublicKey, unverifiedEnvelope []byte, expectedPayloadType string) ([]byte, error) {
+	verifier, err := sigstoreSignature.LoadVerifier(publicKey, sigstoreHarcodedHashAlgorithm)
+	if err != nil {
+		return nil, fmt.Errorf("creating verifier: %w", err)
+	}
+
+	var envelope DSSEEnvelope
+	if err := json.Unmarshal(unverifiedEnvelope, &envelope); err != nil {
+		return nil, NewInvalidSignatureError(fmt.Sprintf("parsing DSSE envelope: %v", err))
+	}
+	if envelope.PayloadType != expectedPayloadType {
+		return nil, NewInvalidSignatureError(fmt.Sprintf("unexpected DSSE payload type %q, expected %q", envelope.PayloadType, expectedPayloadType))
+	}
+	unverifiedPayload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return nil, NewInvalidSignatureError(fmt.Sprintf("base64 decoding DSSE payload: %v", err))
+	}
+	if len(envelope.Signatures) == 0 {
+		return nil, NewInvalidSignatureError("DSSE envelope contains no signatures")
+	}
+
+	pae := DSSEPreAuthenticationEncoding(envelope.PayloadType, unverifiedPayload)
+	var lastErr error
+	for _, sig := range envelope.Signatures {
+		unverifiedSignature, err := base64.StdEncoding.DecodeString(sig.Sig)
+		if err != nil {
+			lastErr = NewInvalidSignatureError(fmt.Sprintf("base64 decoding DSSE signature: %v", err))
+			continue
+		}
+		if err := verifier.VerifySignature(bytes.NewReader(unverifiedSignature), bytes.NewReader(pae)); err != nil {
+			lastErr = NewInvalidSignatureError(fmt.Sprintf("cryptographic signature verification failed: %v", err))
+			continue
+		}
+		return unverifiedPayload, nil // Now verified.
+	}
+	return nil, lastErr
+}
+
+// UntrustedInTotoStatement is a parsed in-toto statement, per https://github.com/in-toto/attestation/blob/main/spec/v1/statement.md .
+type UntrustedInTotoStatement struct {
+	Type          string                   `json:"_type"`
+	Subject       []UntrustedInTotoSubject `json:"subject"`
+	PredicateType string                   `json:"predicateType"`
+	Predicate     json.RawMessage          `json:"predicate"`
+}
+
+// UntrustedInTotoSubject is a single subject of an UntrustedInTotoStatement.
+type UntrustedInTotoSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"` // Algorithm name → hex-encoded value
+}
+
+// inTotoStatementTypes are the recognized values of UntrustedInTotoStatement.Type.
+var inTotoStatementTypes = []string{
+	"https://in-toto.io/Statement/v0.1",
+	"https://in-toto.io/Statement/v1",
+}
+
+// ParseInTotoStatement parses an in-toto statement, typically returned by VerifyDSSEEnvelope.
+func ParseInTotoStatement(payload []byte) (*UntrustedInTotoStatement, error) {
+	var res UntrustedInTotoStatement
+	if err := json.Unmarshal(payload, &res); err != nil {
+		return nil, NewInvalidSignatureError(fmt.Sprintf("parsing in-toto statement: %v", err))
+	}
+	recognized := false
+	for _, t := range inTotoStatementTypes {
+		if res.Type == t {
+			recognized = true
+			break
+		}
+	}
+	if !recognized {
+		return nil, NewInvalidSignatureError(fmt.Sprintf("unrecognized in-toto statement type %q", res.Type))
+	}
+	return &res, nil
+}
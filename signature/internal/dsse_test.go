@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	sigstoreSignature "github.com/sigstore/sigstore/pkg/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dsseSign returns a DSSE envelope of payload with payloadType, signed by signer.
+func dsseSign(t *testing.T, signer sigstoreSignature.Signer, payloadType string, payload []byte) []byte {
+	sig, err := signer.SignMessage(bytes.NewReader(DSSEPreAuthenticationEncoding(payloadType, payload)))
+	require.NoError(t, err)
+	res, err := json.Marshal(DSSEEnvelope{
+		PayloadType: payloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []DSSESignature{{Sig: base64.StdEncoding.EncodeToString(sig)}},
+	})
+	require.NoError(t, err)
+	return res
+}
+
+func TestDSSEPreAuthenticationEncoding(t *testing.T) {
+	// The example from https://github.com/secure-systems-lab/dsse/blob/master/protocol.md#test-vectors
+	assert.Equal(t, []byte("DSSEv1 29 http://example.com/HelloWorld 11 hello world"),
+		DSSEPreAuthenticationEncoding("http://example.com/HelloWorld", []byte("hello world")))
+}
+
+func TestVerifyDSSEEnvelope(t *testing.T) {
+	const payloadType = "http://example.com/HelloWorld"
+	payload := []byte("hello world")
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := sigstoreSignature.LoadECDSASigner(key, crypto.SHA256)
+	require.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherSigner, err := sigstoreSignature.LoadECDSASigner(otherKey, crypto.SHA256)
+	require.NoError(t, err)
+
+	// Success
+	envelope := dsseSign(t, signer, payloadType, payload)
+	res, err := VerifyDSSEEnvelope(&key.PublicKey, envelope, payloadType)
+	require.NoError(t, err)
+	assert.Equal(t, payload, res)
+
+	// Success with one of several signatures
+	var parsed, other DSSEEnvelope
+	require.NoError(t, json.Unmarshal(envelope, &parsed))
+	require.NoError(t, json.Unmarshal(dsseSign(t, otherSigner, payloadType, payload), &other))
+	parsed.Signatures = append(other.Signatures, parsed.Signatures...)
+	multiple, err := json.Marshal(parsed)
+	require.NoError(t, err)
+	res, err = VerifyDSSEEnvelope(&key.PublicKey, multiple, payloadType)
+	require.NoError(t, err)
+	assert.Equal(t, payload, res)
+
+	// Unusable public key
+	_, err = VerifyDSSEEnvelope(nil, envelope, payloadType)
+	assert.Error(t, err)
+
+	for _, c := range []struct {
+		name     string
+		envelope []byte
+	}{
+		{"invalid JSON", []byte("{")},
+		{"signed by another key", dsseSign(t, otherSigner, payloadType, payload)},
+		{"unexpected payload type", dsseSign(t, signer, "text/plain", payload)},
+		{"invalid payload base64", []byte(`{"payloadType":"` + payloadType + `","payload":"&","signatures":[]}`)},
+		{"no signatures", []byte(`{"payloadType":"` + payloadType + `","payload":"","signatures":[]}`)},
+		{"invalid signature base64", []byte(`{"payloadType":"` + payloadType + `","payload":"","signatures":[{"sig":"&"}]}`)},
+	} {
+		_, err := VerifyDSSEEnvelope(&key.PublicKey, c.envelope, payloadType)
+		assert.Error(t, err, c.name)
+		assert.IsType(t, InvalidSignatureError{}, err, c.name)
+	}
+
+	// Payload modified after signing
+	require.NoError(t, json.Unmarshal(envelope, &parsed))
+	parsed.Payload = base64.StdEncoding.EncodeToString([]byte("hello world!"))
+	modified, err := json.Marshal(parsed)
+	require.NoError(t, err)
+	_, err = VerifyDSSEEnvelope(&key.PublicKey, modified, payloadType)
+	assert.Error(t, err)
+}
+
+func TestParseInTotoStatement(t *testing.T) {
+	// Success
+	for _, statementType := range []string{"https://in-toto.io/Statement/v0.1", "https://in-toto.io/Statement/v1"} {
+		res, err := ParseInTotoStatement([]byte(`{"_type":"` + statementType + `",` +
+			`"subject":[{"name":"example.com/a","digest":{"sha256":"0123"}}],` +
+			`"predicateType":"https://example.com/predicate","predicate":{"a":1}}`))
+		require.NoError(t, err)
+		assert.Equal(t, &UntrustedInTotoStatement{
+			Type:          statementType,
+			Subject:       []UntrustedInTotoSubject{{Name: "example.com/a", Digest: map[string]string{"sha256": "0123"}}},
+			PredicateType: "https://example.com/predicate",
+			Predicate:     json.RawMessage(`{"a":1}`),
+		}, res)
+	}
+
+	// Failures
+	for _, payload := range []string{
+		"{",
+		`{"_type":"https://example.com/unknown"}`,
+		`{"_type":1}`,
+	} {
+		_, err := ParseInTotoStatement([]byte(payload))
+		assert.Error(t, err, payload)
+		assert.IsType(t, InvalidSignatureError{}, err, payload)
+	}
+}
@@ -0,0 +1,226 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// UntrustedRekorInclusionProof is a parsed content of a Rekor inclusion proof, in the format used by the Rekor API
+// (github.com/sigstore/rekor/pkg/generated/models.InclusionProof); we impose a stricter decoder.
+type UntrustedRekorInclusionProof struct {
+	UntrustedLogIndex   int64    // The index of the entry in the log tree (not necessarily the same as the index in a Rekor SET)
+	UntrustedRootHash   string   // Hex-encoded
+	UntrustedTreeSize   int64    // The size of the log tree
+	UntrustedHashes     []string // Hex-encoded, from the leaf towards the root
+	UntrustedCheckpoint string   // A signed note committing to UntrustedTreeSize and UntrustedRootHash
+}
+
+// A compile-time check that UntrustedRekorInclusionProof implements json.Unmarshaler
+var _ json.Unmarshaler = (*UntrustedRekorInclusionProof)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface
+func (p *UntrustedRekorInclusionProof) UnmarshalJSON(data []byte) error {
+	err := p.strictUnmarshalJSON(data)
+	if err != nil {
+		if formatErr, ok := err.(JSONFormatError); ok {
+			err = NewInvalidSignatureError(formatErr.Error())
+		}
+	}
+	return err
+}
+
+// strictUnmarshalJSON is UnmarshalJSON, except that it may return the internal JSONFormatError error type.
+// Splitting it into a separate function allows us to do the JSONFormatError → InvalidSignatureError in a single place, the caller.
+func (p *UntrustedRekorInclusionProof) strictUnmarshalJSON(data []byte) error {
+	return ParanoidUnmarshalJSONObjectExactFields(data, map[string]any{
+		"logIndex":   &p.UntrustedLogIndex,
+		"rootHash":   &p.UntrustedRootHash,
+		"treeSize":   &p.UntrustedTreeSize,
+		"hashes":     &p.UntrustedHashes,
+		"checkpoint": &p.UntrustedCheckpoint,
+	})
+}
+
+// A compile-time check that UntrustedRekorInclusionProof and *UntrustedRekorInclusionProof implements json.Marshaler
+var _ json.Marshaler = UntrustedRekorInclusionProof{}
+var _ json.Marshaler = (*UntrustedRekorInclusionProof)(nil)
+
+// MarshalJSON implements the json.Marshaler interface.
+func (p UntrustedRekorInclusionProof) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"logIndex":   p.UntrustedLogIndex,
+		"rootHash":   p.UntrustedRootHash,
+		"treeSize":   p.UntrustedTreeSize,
+		"hashes":     p.UntrustedHashes,
+		"checkpoint": p.UntrustedCheckpoint,
+	})
+}
+
+// VerifyRekorInclusionProof verifies, without contacting the log, that unverifiedProof proves that an entry with entryBody
+// (as recorded in a Rekor SET, see VerifiedRekorSETEntry.Body) is included in a Rekor log tree,
+// and that the state of the tree is committed to by a checkpoint signed by publicKey.
+func VerifyRekorInclusionProof(publicKey *ecdsa.PublicKey, unverifiedProof []byte, entryBody []byte) error {
+	var untrustedProof UntrustedRekorInclusionProof
+	if err := json.Unmarshal(unverifiedProof, &untrustedProof); err != nil {
+		return NewInvalidSignatureError(fmt.Sprintf("parsing Rekor inclusion proof: %v", err))
+	}
+
+	// == Verify the checkpoint, and that it matches the proof
+	checkpointTreeSize, checkpointRootHash, err := verifyRekorCheckpoint(publicKey, untrustedProof.UntrustedCheckpoint)
+	if err != nil {
+		return err
+	}
+	if untrustedProof.UntrustedTreeSize < 0 || uint64(untrustedProof.UntrustedTreeSize) != checkpointTreeSize {
+		return NewInvalidSignatureError(fmt.Sprintf("Rekor inclusion proof tree size %d does not match the checkpoint tree size %d",
+			untrustedProof.UntrustedTreeSize, checkpointTreeSize))
+	}
+	rootHash, err := hex.DecodeString(untrustedProof.UntrustedRootHash)
+	if err != nil {
+		return NewInvalidSignatureError(fmt.Sprintf("invalid Rekor inclusion proof root hash: %v", err))
+	}
+	if !bytes.Equal(rootHash, checkpointRootHash) {
+		return NewInvalidSignatureError("Rekor inclusion proof root hash does not match the checkpoint")
+	}
+
+	// == Verify the inclusion proof itself
+	if untrustedProof.UntrustedLogIndex < 0 {
+		return NewInvalidSignatureError(fmt.Sprintf("invalid Rekor inclusion proof log index %d", untrustedProof.UntrustedLogIndex))
+	}
+	hashes := make([][]byte, 0, len(untrustedProof.UntrustedHashes))
+	for _, h := range untrustedProof.UntrustedHashes {
+		hash, err := hex.DecodeString(h)
+		if err != nil {
+			return NewInvalidSignatureError(fmt.Sprintf("invalid hash in Rekor inclusion proof: %v", err))
+		}
+		hashes = append(hashes, hash)
+	}
+	return verifyMerkleInclusion(uint64(untrustedProof.UntrustedLogIndex), checkpointTreeSize,
+		merkleLeafHash(entryBody), hashes, checkpointRootHash)
+}
+
+// verifyRekorCheckpoint verifies that unverifiedCheckpoint is a signed note, as used by Rekor (and by Go’s sumdb),
+// signed by publicKey, and returns the tree size and root hash it commits to.
+func verifyRekorCheckpoint(publicKey *ecdsa.PublicKey, unverifiedCheckpoint string) (uint64, []byte, error) {
+	// The format is:
+	//	origin\n
+	//	tree size\n
+	//	base64-encoded root hash\n
+	//	[other lines\n]
+	//	\n
+	//	— signer name base64(key hint || signature)\n
+	//	[more signature lines]
+	sep := strings.Index(unverifiedCheckpoint, "\n\n")
+	if sep == -1 {
+		return 0, nil, NewInvalidSignatureError("Rekor checkpoint has no signatures")
+	}
+	untrustedText := unverifiedCheckpoint[:sep+1]
+	untrustedSignatures := unverifiedCheckpoint[sep+2:]
+
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return 0, nil, fmt.Errorf("marshaling Rekor public key: %w", err)
+	}
+	publicKeyHash := sha256.Sum256(publicKeyDER)
+	keyHint := publicKeyHash[:4]
+	textHash := sha256.Sum256([]byte(untrustedText))
+	verified := false
+	for _, line := range strings.Split(strings.TrimSuffix(untrustedSignatures, "\n"), "\n") {
+		if !strings.HasPrefix(line, "— ") {
+			return 0, nil, NewInvalidSignatureError(fmt.Sprintf("invalid Rekor checkpoint signature line %q", line))
+		}
+		rest := strings.TrimPrefix(line, "— ")
+		spaceIndex := strings.LastIndex(rest, " ")
+		if spaceIndex == -1 {
+			return 0, nil, NewInvalidSignatureError(fmt.Sprintf("invalid Rekor checkpoint signature line %q", line))
+		}
+		sig, err := base64.StdEncoding.DecodeString(rest[spaceIndex+1:])
+		if err != nil || len(sig) < len(keyHint) {
+			return 0, nil, NewInvalidSignatureError(fmt.Sprintf("invalid Rekor checkpoint signature line %q", line))
+		}
+		if !bytes.Equal(sig[:len(keyHint)], keyHint) {
+			continue // A signature by some other key, e.g. a witness
+		}
+		if ecdsa.VerifyASN1(publicKey, textHash[:], sig[len(keyHint):]) {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return 0, nil, NewInvalidSignatureError("Rekor checkpoint is not signed by the Rekor public key")
+	}
+
+	// == Parse the now-verified text
+	lines := strings.Split(strings.TrimSuffix(untrustedText, "\n"), "\n")
+	if len(lines) < 3 {
+		return 0, nil, NewInvalidSignatureError("Rekor checkpoint is missing required lines")
+	}
+	treeSize, err := strconv.ParseUint(lines[1], 10, 64)
+	if err != nil {
+		return 0, nil, NewInvalidSignatureError(fmt.Sprintf("invalid Rekor checkpoint tree size: %v", err))
+	}
+	rootHash, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil {
+		return 0, nil, NewInvalidSignatureError(fmt.Sprintf("invalid Rekor checkpoint root hash: %v", err))
+	}
+	return treeSize, rootHash, nil
+}
+
+// merkleLeafHash returns the RFC 6962 hash of a leaf with data.
+func merkleLeafHash(data []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{0})
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// merkleNodeHash returns the RFC 6962 hash of an interior node with children left and right.
+func merkleNodeHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{1})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// verifyMerkleInclusion verifies that proof is a valid proof that a leaf with leafHash at index is included in a tree of size
+// with rootHash, using the algorithm of RFC 9162 section 2.1.3.2.
+func verifyMerkleInclusion(index, size uint64, leafHash []byte, proof [][]byte, rootHash []byte) error {
+	if index >= size {
+		return NewInvalidSignatureError(fmt.Sprintf("Rekor inclusion proof log index %d is outside of the tree of size %d", index, size))
+	}
+	fn, sn := index, size-1
+	r := leafHash
+	for _, p := range proof {
+		if sn == 0 {
+			return NewInvalidSignatureError("Rekor inclusion proof is too long")
+		}
+		if fn&1 == 1 || fn == sn {
+			r = merkleNodeHash(p, r)
+			if fn&1 == 0 {
+				for fn&1 == 0 && fn != 0 {
+					fn >>= 1
+					sn >>= 1
+				}
+			}
+		} else {
+			r = merkleNodeHash(r, p)
+		}
+		fn >>= 1
+		sn >>= 1
+	}
+	if sn != 0 {
+		return NewInvalidSignatureError("Rekor inclusion proof is too short")
+	}
+	if !bytes.Equal(r, rootHash) {
+		return NewInvalidSignatureError("Rekor inclusion proof does not match the root hash")
+	}
+	return nil
+}
@@ -0,0 +1,222 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testMerkleRoot returns the RFC 6962 MTH of leaves.
+func testMerkleRoot(leaves [][]byte) []byte {
+	switch len(leaves) {
+	case 0:
+		h := sha256.Sum256(nil)
+		return h[:]
+	case 1:
+		return merkleLeafHash(leaves[0])
+	}
+	k := testMerkleSplit(len(leaves))
+	return merkleNodeHash(testMerkleRoot(leaves[:k]), testMerkleRoot(leaves[k:]))
+}
+
+// testMerkleSplit returns the largest power of 2 smaller than n.
+func testMerkleSplit(n int) int {
+	k := 1
+	for k*2 < n {
+		k *= 2
+	}
+	return k
+}
+
+// testMerklePath returns the RFC 6962 PATH(index, leaves).
+func testMerklePath(index int, leaves [][]byte) [][]byte {
+	if len(leaves) <= 1 {
+		return nil
+	}
+	k := testMerkleSplit(len(leaves))
+	if index < k {
+		return append(testMerklePath(index, leaves[:k]), testMerkleRoot(leaves[k:]))
+	}
+	return append(testMerklePath(index-k, leaves[k:]), testMerkleRoot(leaves[:k]))
+}
+
+// testCheckpoint returns a checkpoint for treeSize and rootHash signed by key.
+func testCheckpoint(t *testing.T, key *ecdsa.PrivateKey, treeSize int, rootHash []byte) string {
+	text := fmt.Sprintf("rekor.example.com - 1234\n%d\n%s\n", treeSize, base64.StdEncoding.EncodeToString(rootHash))
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+	keyHash := sha256.Sum256(der)
+	textHash := sha256.Sum256([]byte(text))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, textHash[:])
+	require.NoError(t, err)
+	return text + "\n— rekor.example.com " + base64.StdEncoding.EncodeToString(append(keyHash[:4], sig...)) + "\n"
+}
+
+// testInclusionProof returns an inclusion proof for leaves[index] in leaves, with a checkpoint signed by key.
+func testInclusionProof(t *testing.T, key *ecdsa.PrivateKey, index int, leaves [][]byte) UntrustedRekorInclusionProof {
+	root := testMerkleRoot(leaves)
+	hashes := []string{}
+	for _, h := range testMerklePath(index, leaves) {
+		hashes = append(hashes, hex.EncodeToString(h))
+	}
+	return UntrustedRekorInclusionProof{
+		UntrustedLogIndex:   int64(index),
+		UntrustedRootHash:   hex.EncodeToString(root),
+		UntrustedTreeSize:   int64(len(leaves)),
+		UntrustedHashes:     hashes,
+		UntrustedCheckpoint: testCheckpoint(t, key, len(leaves), root),
+	}
+}
+
+func TestUntrustedRekorInclusionProofUnmarshalJSON(t *testing.T) {
+	// Success
+	validInput := []byte(`{"logIndex":1,"rootHash":"abcd","treeSize":2,"hashes":["01","02"],"checkpoint":"cp"}`)
+	var p UntrustedRekorInclusionProof
+	err := json.Unmarshal(validInput, &p)
+	require.NoError(t, err)
+	assert.Equal(t, UntrustedRekorInclusionProof{
+		UntrustedLogIndex:   1,
+		UntrustedRootHash:   "abcd",
+		UntrustedTreeSize:   2,
+		UntrustedHashes:     []string{"01", "02"},
+		UntrustedCheckpoint: "cp",
+	}, p)
+
+	// Round trip
+	out, err := json.Marshal(p)
+	require.NoError(t, err)
+	var p2 UntrustedRekorInclusionProof
+	err = json.Unmarshal(out, &p2)
+	require.NoError(t, err)
+	assert.Equal(t, p, p2)
+
+	// Various ways to corrupt the JSON
+	for _, input := range []string{
+		`1`,
+		`{}`,
+		`{"logIndex":1,"rootHash":"abcd","treeSize":2,"hashes":["01","02"]}`,
+		`{"logIndex":1,"rootHash":"abcd","treeSize":2,"hashes":["01","02"],"checkpoint":"cp","unknown":1}`,
+		`{"logIndex":"1","rootHash":"abcd","treeSize":2,"hashes":["01","02"],"checkpoint":"cp"}`,
+		`{"logIndex":1,"rootHash":"abcd","treeSize":2,"hashes":"01","checkpoint":"cp"}`,
+	} {
+		var p UntrustedRekorInclusionProof
+		err := json.Unmarshal([]byte(input), &p)
+		assert.Error(t, err, input)
+		assert.IsType(t, InvalidSignatureError{}, err, input)
+	}
+}
+
+func TestVerifyRekorInclusionProof(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	leaves := [][]byte{}
+	for i := 0; i < 13; i++ {
+		leaves = append(leaves, []byte(fmt.Sprintf("entry %d", i)))
+	}
+
+	// Success, for all leaves of trees of various sizes
+	for size := 1; size <= len(leaves); size++ {
+		for index := 0; index < size; index++ {
+			proof, err := json.Marshal(testInclusionProof(t, key, index, leaves[:size]))
+			require.NoError(t, err)
+			err = VerifyRekorInclusionProof(&key.PublicKey, proof, leaves[index])
+			assert.NoError(t, err, "%d/%d", index, size)
+		}
+	}
+
+	// Multiple checkpoint signatures, only one by the Rekor key
+	validProof := testInclusionProof(t, key, 5, leaves)
+	otherCheckpoint := testCheckpoint(t, otherKey, len(leaves), testMerkleRoot(leaves))
+	// sep and otherSep are the offsets of the (single) signature lines
+	sep := strings.Index(validProof.UntrustedCheckpoint, "\n\n") + 2
+	otherSep := strings.Index(otherCheckpoint, "\n\n") + 2
+	proof := validProof
+	proof.UntrustedCheckpoint = validProof.UntrustedCheckpoint[:sep] + otherCheckpoint[otherSep:] + validProof.UntrustedCheckpoint[sep:]
+	proofBytes, err := json.Marshal(proof)
+	require.NoError(t, err)
+	err = VerifyRekorInclusionProof(&key.PublicKey, proofBytes, leaves[5])
+	assert.NoError(t, err)
+
+	for _, c := range []struct {
+		name     string
+		fn       func(p *UntrustedRekorInclusionProof)
+		leaf     []byte
+		verifier *ecdsa.PublicKey
+	}{
+		{"Wrong leaf", func(p *UntrustedRekorInclusionProof) {}, leaves[4], nil},
+		{"Wrong key", func(p *UntrustedRekorInclusionProof) {}, nil, &otherKey.PublicKey},
+		{"Wrong index", func(p *UntrustedRekorInclusionProof) { p.UntrustedLogIndex = 4 }, nil, nil},
+		{"Negative index", func(p *UntrustedRekorInclusionProof) { p.UntrustedLogIndex = -1 }, nil, nil},
+		{"Index outside of the tree", func(p *UntrustedRekorInclusionProof) { p.UntrustedLogIndex = 13 }, nil, nil},
+		{"Tree size mismatch", func(p *UntrustedRekorInclusionProof) { p.UntrustedTreeSize = 12 }, nil, nil},
+		{"Negative tree size", func(p *UntrustedRekorInclusionProof) { p.UntrustedTreeSize = -1 }, nil, nil},
+		{"Root hash mismatch", func(p *UntrustedRekorInclusionProof) {
+			p.UntrustedRootHash = hex.EncodeToString(testMerkleRoot(leaves[:12]))
+		}, nil, nil},
+		{"Invalid root hash", func(p *UntrustedRekorInclusionProof) { p.UntrustedRootHash = "not hex" }, nil, nil},
+		{"Invalid hash", func(p *UntrustedRekorInclusionProof) { p.UntrustedHashes[0] = "not hex" }, nil, nil},
+		{"Modified hash", func(p *UntrustedRekorInclusionProof) {
+			p.UntrustedHashes[1] = hex.EncodeToString(merkleLeafHash([]byte("modified")))
+		}, nil, nil},
+		{"Proof too short", func(p *UntrustedRekorInclusionProof) {
+			p.UntrustedHashes = p.UntrustedHashes[:len(p.UntrustedHashes)-1]
+		}, nil, nil},
+		{"Proof too long", func(p *UntrustedRekorInclusionProof) {
+			p.UntrustedHashes = append(p.UntrustedHashes, p.UntrustedHashes[0])
+		}, nil, nil},
+		{"Checkpoint without signatures", func(p *UntrustedRekorInclusionProof) { p.UntrustedCheckpoint = "origin\n13\nabcd\n" }, nil, nil},
+		{"Checkpoint with an invalid signature line", func(p *UntrustedRekorInclusionProof) {
+			p.UntrustedCheckpoint = p.UntrustedCheckpoint[:sep] + "invalid\n"
+		}, nil, nil},
+		{"Checkpoint with a signature line without a signature", func(p *UntrustedRekorInclusionProof) {
+			p.UntrustedCheckpoint = p.UntrustedCheckpoint[:sep] + "— name\n"
+		}, nil, nil},
+		{"Checkpoint with invalid base64", func(p *UntrustedRekorInclusionProof) {
+			p.UntrustedCheckpoint = p.UntrustedCheckpoint[:sep] + "— name !!!\n"
+		}, nil, nil},
+		{"Modified checkpoint", func(p *UntrustedRekorInclusionProof) {
+			p.UntrustedCheckpoint = "modified" + p.UntrustedCheckpoint
+		}, nil, nil},
+		{"Checkpoint for a different tree", func(p *UntrustedRekorInclusionProof) {
+			p.UntrustedCheckpoint = testCheckpoint(t, key, 12, testMerkleRoot(leaves[:12]))
+		}, nil, nil},
+		{"Checkpoint with an invalid tree size", func(p *UntrustedRekorInclusionProof) {
+			p.UntrustedCheckpoint = testCheckpoint(t, key, -1, testMerkleRoot(leaves))
+		}, nil, nil},
+	} {
+		proof := validProof
+		proof.UntrustedHashes = append([]string{}, validProof.UntrustedHashes...)
+		c.fn(&proof)
+		proofBytes, err := json.Marshal(proof)
+		require.NoError(t, err, c.name)
+		leaf := leaves[5]
+		if c.leaf != nil {
+			leaf = c.leaf
+		}
+		verifier := &key.PublicKey
+		if c.verifier != nil {
+			verifier = c.verifier
+		}
+		err = VerifyRekorInclusionProof(verifier, proofBytes, leaf)
+		assert.Error(t, err, c.name)
+		assert.IsType(t, InvalidSignatureError{}, err, c.name)
+	}
+
+	// Invalid JSON
+	err = VerifyRekorInclusionProof(&key.PublicKey, []byte("not JSON"), leaves[5])
+	assert.Error(t, err)
+}
@@ -13,3 +13,15 @@ import (
 func VerifyRekorSET(publicKey *ecdsa.PublicKey, unverifiedRekorSET []byte, unverifiedKeyOrCertBytes []byte, unverifiedBase64Signature string, unverifiedPayloadBytes []byte) (time.Time, error) {
 	return time.Time{}, NewInvalidSignatureError("rekor disabled at compile-time")
 }
+
+// VerifiedRekorSETEntry contains the data of a Rekor log entry, as recorded in a verified SET.
+type VerifiedRekorSETEntry struct {
+	IntegratedTime time.Time // The bundle upload time
+	LogIndex       int64
+	Body           []byte // The log entry body, as included in the log; see VerifyRekorInclusionProof
+}
+
+// VerifyRekorSETEntry is like VerifyRekorSET, but it returns all of the relevant log entry data on success.
+func VerifyRekorSETEntry(publicKey *ecdsa.PublicKey, unverifiedRekorSET []byte, unverifiedKeyOrCertBytes []byte, unverifiedBase64Signature string, unverifiedPayloadBytes []byte) (VerifiedRekorSETEntry, error) {
+	return VerifiedRekorSETEntry{}, NewInvalidSignatureError("rekor disabled at compile-time")
+}
@@ -194,6 +194,17 @@ func TestVerifyRekorSET(t *testing.T) {
 	tm, err := VerifyRekorSET(cosignRekorKeyECDSA, cosignSETBytes, cosignCertBytes, string(cosignSigBase64), cosignPayloadBytes)
 	require.NoError(t, err)
 	assert.Equal(t, time.Unix(1670870899, 0), tm)
+	entry, err := VerifyRekorSETEntry(cosignRekorKeyECDSA, cosignSETBytes, cosignCertBytes, string(cosignSigBase64), cosignPayloadBytes)
+	require.NoError(t, err)
+	assert.Equal(t, time.Unix(1670870899, 0), entry.IntegratedTime)
+	assert.Equal(t, int64(8949589), entry.LogIndex)
+	var set UntrustedRekorSET
+	err = json.Unmarshal(cosignSETBytes, &set)
+	require.NoError(t, err)
+	var setPayload UntrustedRekorPayload
+	err = json.Unmarshal(set.UntrustedPayload, &setPayload)
+	require.NoError(t, err)
+	assert.Equal(t, setPayload.Body, entry.Body)
 
 	// For extra paranoia, test that we return a zero time on error.
 
@@ -400,4 +411,9 @@ func TestVerifyRekorSET(t *testing.T) {
 		assert.Error(t, err)
 		assert.Zero(t, tm)
 	}
+
+	// VerifyRekorSETEntry returns a zero value on error
+	entry, err = VerifyRekorSETEntry(cosignRekorKeyECDSA, cosignSETBytes, cosignCertBytes, string(cosignSigBase64), []byte("this payload does not match"))
+	assert.Error(t, err)
+	assert.Zero(t, entry)
 }
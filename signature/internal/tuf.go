@@ -0,0 +1,403 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/secure-systems-lab/go-securesystemslib/cjson"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"golang.org/x/exp/slices"
+)
+
+// maxTUFRootRotations is the maximum number of root metadata versions we are willing to process in a single update.
+const maxTUFRootRotations = 256
+
+// TUFFetcher returns the contents of a file of a TUF repository, identified by its path relative to the repository root
+// (e.g. "2.root.json" or "targets/rekor.pub").
+// It must return an error satisfying errors.Is(err, fs.ErrNotExist) if the file does not exist.
+type TUFFetcher func(name string) ([]byte, error)
+
+// VerifiedTUFRepository is the verified state of the top-level metadata of a TUF repository.
+type VerifiedTUFRepository struct {
+	// Root is the newest verified root metadata, which can be used as a trusted root for future updates.
+	Root               []byte
+	consistentSnapshot bool
+	targets            map[string]tufTargetFile
+	fetch              TUFFetcher
+}
+
+// The TUF metadata formats. We only parse the fields we need, ignoring everything else
+// (notably we don’t support delegations), and the metadata is only trusted after verifying signatures.
+
+type untrustedTUFSignedMetadata struct {
+	UntrustedSigned     json.RawMessage         `json:"signed"`
+	UntrustedSignatures []untrustedTUFSignature `json:"signatures"`
+}
+
+type untrustedTUFSignature struct {
+	UntrustedKeyID string `json:"keyid"`
+	UntrustedSig   string `json:"sig"`
+}
+
+type tufCommon struct {
+	Type    string    `json:"_type"`
+	Version int64     `json:"version"`
+	Expires time.Time `json:"expires"`
+}
+
+type tufKey struct {
+	KeyType string `json:"keytype"`
+	Scheme  string `json:"scheme"`
+	KeyVal  struct {
+		Public string `json:"public"`
+	} `json:"keyval"`
+}
+
+type tufRole struct {
+	KeyIDs    []string `json:"keyids"`
+	Threshold int      `json:"threshold"`
+}
+
+type tufRoot struct {
+	tufCommon
+	ConsistentSnapshot bool               `json:"consistent_snapshot"`
+	Keys               map[string]tufKey  `json:"keys"`
+	Roles              map[string]tufRole `json:"roles"`
+}
+
+type tufMetaFile struct {
+	Version int64             `json:"version"`
+	Length  int64             `json:"length,omitempty"`
+	Hashes  map[string]string `json:"hashes,omitempty"`
+}
+
+// tufTimestampOrSnapshot is the format of both the timestamp and the snapshot metadata.
+type tufTimestampOrSnapshot struct {
+	tufCommon
+	Meta map[string]tufMetaFile `json:"meta"`
+}
+
+type tufTargetFile struct {
+	Length int64             `json:"length"`
+	Hashes map[string]string `json:"hashes"`
+	Custom json.RawMessage   `json:"custom,omitempty"`
+}
+
+type tufTargets struct {
+	tufCommon
+	Targets map[string]tufTargetFile `json:"targets"`
+}
+
+// VerifyTUFRepository starts with trustedRoot, a trusted root metadata of a TUF repository (e.g. pinned by the user),
+// updates it to the newest root metadata available from fetch, and verifies the timestamp, snapshot and targets metadata
+// as of now.
+func VerifyTUFRepository(trustedRoot []byte, fetch TUFFetcher, now time.Time) (*VerifiedTUFRepository, error) {
+	var trustedMetadata untrustedTUFSignedMetadata
+	if err := json.Unmarshal(trustedRoot, &trustedMetadata); err != nil {
+		return nil, fmt.Errorf("parsing trusted TUF root metadata: %w", err)
+	}
+	var root tufRoot
+	if err := parseTUFSigned(trustedMetadata.UntrustedSigned, "root", &root.tufCommon, &root); err != nil {
+		return nil, err
+	}
+	rootBytes := trustedRoot
+
+	// == Update the root metadata
+	for i := 0; ; i++ {
+		if i == maxTUFRootRotations {
+			return nil, NewInvalidSignatureError(fmt.Sprintf("too many TUF root metadata versions, more than %d", maxTUFRootRotations))
+		}
+		name := fmt.Sprintf("%d.root.json", root.Version+1)
+		untrustedNextBytes, err := fetch(name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				break
+			}
+			return nil, fmt.Errorf("fetching TUF metadata %s: %w", name, err)
+		}
+		// The new root must be signed by both the old and the new root role keys.
+		signed, err := verifyTUFMetadata(&root, "root", name, untrustedNextBytes)
+		if err != nil {
+			return nil, err
+		}
+		var next tufRoot
+		if err := parseTUFSigned(signed, "root", &next.tufCommon, &next); err != nil {
+			return nil, err
+		}
+		if _, err := verifyTUFMetadata(&next, "root", name, untrustedNextBytes); err != nil {
+			return nil, err
+		}
+		if next.Version != root.Version+1 {
+			return nil, NewInvalidSignatureError(fmt.Sprintf("TUF metadata %s has unexpected version %d", name, next.Version))
+		}
+		root = next
+		rootBytes = untrustedNextBytes
+	}
+	if !now.Before(root.Expires) {
+		return nil, NewInvalidSignatureError(fmt.Sprintf("TUF root metadata version %d expired at %s", root.Version, root.Expires))
+	}
+
+	// == Timestamp
+	var timestamp tufTimestampOrSnapshot
+	if err := fetchTUFMetadata(&root, fetch, "timestamp", "timestamp.json", nil, now, &timestamp.tufCommon, &timestamp); err != nil {
+		return nil, err
+	}
+	snapshotMeta, ok := timestamp.Meta["snapshot.json"]
+	if !ok {
+		return nil, NewInvalidSignatureError("TUF timestamp metadata does not refer to snapshot.json")
+	}
+
+	// == Snapshot
+	var snapshot tufTimestampOrSnapshot
+	if err := fetchTUFMetadata(&root, fetch, "snapshot", "snapshot.json", &snapshotMeta, now, &snapshot.tufCommon, &snapshot); err != nil {
+		return nil, err
+	}
+	targetsMeta, ok := snapshot.Meta["targets.json"]
+	if !ok {
+		return nil, NewInvalidSignatureError("TUF snapshot metadata does not refer to targets.json")
+	}
+
+	// == Targets
+	var targets tufTargets
+	if err := fetchTUFMetadata(&root, fetch, "targets", "targets.json", &targetsMeta, now, &targets.tufCommon, &targets); err != nil {
+		return nil, err
+	}
+
+	return &VerifiedTUFRepository{
+		Root:               rootBytes,
+		consistentSnapshot: root.ConsistentSnapshot,
+		targets:            targets.Targets,
+		fetch:              fetch,
+	}, nil
+}
+
+// fetchTUFMetadata fetches, verifies and parses metadata for role from fileName, into dest with common fields in destCommon.
+// If meta is not nil, it describes the expected version, length and hashes of the file.
+func fetchTUFMetadata(root *tufRoot, fetch TUFFetcher, role, fileName string, meta *tufMetaFile, now time.Time,
+	destCommon *tufCommon, dest any) error {
+	name := fileName
+	if meta != nil && root.ConsistentSnapshot {
+		name = fmt.Sprintf("%d.%s", meta.Version, fileName)
+	}
+	untrustedBytes, err := fetch(name)
+	if err != nil {
+		return fmt.Errorf("fetching TUF metadata %s: %w", name, err)
+	}
+	if meta != nil {
+		if err := verifyTUFFileHashes(name, meta.Length, meta.Hashes, untrustedBytes, false); err != nil {
+			return err
+		}
+	}
+	signed, err := verifyTUFMetadata(root, role, name, untrustedBytes)
+	if err != nil {
+		return err
+	}
+	if err := parseTUFSigned(signed, role, destCommon, dest); err != nil {
+		return err
+	}
+	if meta != nil && destCommon.Version != meta.Version {
+		return NewInvalidSignatureError(fmt.Sprintf("TUF metadata %s has version %d, expected %d", name, destCommon.Version, meta.Version))
+	}
+	if !now.Before(destCommon.Expires) {
+		return NewInvalidSignatureError(fmt.Sprintf("TUF metadata %s expired at %s", name, destCommon.Expires))
+	}
+	return nil
+}
+
+// parseTUFSigned parses signed, the "signed" part of TUF metadata for role, into dest, with common fields in destCommon.
+func parseTUFSigned(signed json.RawMessage, role string, destCommon *tufCommon, dest any) error {
+	if err := json.Unmarshal(signed, dest); err != nil {
+		return NewInvalidSignatureError(fmt.Sprintf("parsing TUF %s metadata: %v", role, err))
+	}
+	if destCommon.Type != role {
+		return NewInvalidSignatureError(fmt.Sprintf("TUF metadata has type %q, expected %q", destCommon.Type, role))
+	}
+	return nil
+}
+
+// verifyTUFMetadata verifies that untrustedMetadata, read from name, is signed by a threshold of keys of role in root,
+// and returns the signed data.
+func verifyTUFMetadata(root *tufRoot, roleName, name string, untrustedMetadata []byte) (json.RawMessage, error) {
+	var m untrustedTUFSignedMetadata
+	if err := json.Unmarshal(untrustedMetadata, &m); err != nil {
+		return nil, NewInvalidSignatureError(fmt.Sprintf("parsing TUF metadata %s: %v", name, err))
+	}
+	role, ok := root.Roles[roleName]
+	if !ok {
+		return nil, NewInvalidSignatureError(fmt.Sprintf("TUF root metadata does not define the %s role", roleName))
+	}
+	if role.Threshold < 1 {
+		return nil, NewInvalidSignatureError(fmt.Sprintf("TUF root metadata contains invalid threshold %d for the %s role", role.Threshold, roleName))
+	}
+	canonical, err := cjson.EncodeCanonical(m.UntrustedSigned)
+	if err != nil {
+		return nil, NewInvalidSignatureError(fmt.Sprintf("canonicalizing TUF metadata %s: %v", name, err))
+	}
+	validKeys := map[string]struct{}{}
+	for _, sig := range m.UntrustedSignatures {
+		if !slices.Contains(role.KeyIDs, sig.UntrustedKeyID) {
+			continue
+		}
+		key, ok := root.Keys[sig.UntrustedKeyID]
+		if !ok {
+			continue
+		}
+		sigBytes, err := hex.DecodeString(sig.UntrustedSig)
+		if err != nil {
+			continue
+		}
+		if verifyTUFSignature(key, canonical, sigBytes) {
+			validKeys[sig.UntrustedKeyID] = struct{}{}
+		}
+	}
+	if len(validKeys) < role.Threshold {
+		return nil, NewInvalidSignatureError(fmt.Sprintf("TUF metadata %s has %d valid signatures by %s keys, %d required",
+			name, len(validKeys), roleName, role.Threshold))
+	}
+	return m.UntrustedSigned, nil
+}
+
+// verifyTUFSignature returns true if sig is a valid signature of data by key.
+func verifyTUFSignature(key tufKey, data, sig []byte) bool {
+	switch key.Scheme {
+	case "ecdsa-sha2-nistp256":
+		publicKeyPEM := []byte(key.KeyVal.Public)
+		if !bytes.HasPrefix(publicKeyPEM, []byte("-----BEGIN")) {
+			// Older metadata (e.g. in the sigstore TUF repository) contains hex-encoded PEM.
+			decoded, err := hex.DecodeString(key.KeyVal.Public)
+			if err != nil {
+				return false
+			}
+			publicKeyPEM = decoded
+		}
+		publicKey, err := cryptoutils.UnmarshalPEMToPublicKey(publicKeyPEM)
+		if err != nil {
+			return false
+		}
+		ecdsaKey, ok := publicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return false
+		}
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(ecdsaKey, digest[:], sig)
+	case "ed25519":
+		publicKey, err := hex.DecodeString(key.KeyVal.Public)
+		if err != nil || len(publicKey) != ed25519.PublicKeySize {
+			return false
+		}
+		return ed25519.Verify(ed25519.PublicKey(publicKey), data, sig)
+	default:
+		return false
+	}
+}
+
+// tufHashAlgorithms are the hash algorithms we support for verifying TUF files, in order of preference.
+var tufHashAlgorithms = []struct {
+	name    string
+	newHash func() hash.Hash
+}{
+	{"sha256", sha256.New},
+	{"sha512", sha512.New},
+}
+
+// verifyTUFFileHashes verifies that data, read from name, matches length and hashes, if set.
+// If required, both length and hashes must be set.
+func verifyTUFFileHashes(name string, length int64, hashes map[string]string, data []byte, required bool) error {
+	if length != 0 || required {
+		if int64(len(data)) != length {
+			return NewInvalidSignatureError(fmt.Sprintf("TUF file %s has length %d, expected %d", name, len(data), length))
+		}
+	}
+	if len(hashes) == 0 && !required {
+		return nil
+	}
+	verified := false
+	for _, alg := range tufHashAlgorithms {
+		expected, ok := hashes[alg.name]
+		if !ok {
+			continue
+		}
+		h := alg.newHash()
+		h.Write(data)
+		if hex.EncodeToString(h.Sum(nil)) != expected {
+			return NewInvalidSignatureError(fmt.Sprintf("TUF file %s does not match the expected %s hash", name, alg.name))
+		}
+		verified = true
+	}
+	if !verified {
+		return NewInvalidSignatureError(fmt.Sprintf("TUF file %s has no supported hashes", name))
+	}
+	return nil
+}
+
+// Target returns the verified contents of the target with name.
+func (r *VerifiedTUFRepository) Target(name string) ([]byte, error) {
+	target, ok := r.targets[name]
+	if !ok {
+		return nil, fmt.Errorf("TUF target %s not found", name)
+	}
+	fileName := path.Join("targets", name)
+	if r.consistentSnapshot {
+		for _, alg := range tufHashAlgorithms {
+			if h, ok := target.Hashes[alg.name]; ok {
+				dir, base := path.Split(name)
+				fileName = path.Join("targets", dir, h+"."+base)
+				break
+			}
+		}
+	}
+	data, err := r.fetch(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("fetching TUF target %s: %w", name, err)
+	}
+	if err := verifyTUFFileHashes(fileName, target.Length, target.Hashes, data, true); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// SigstoreTargets returns the verified contents of all targets marked for usage (e.g. "Fulcio" or "Rekor")
+// in the custom metadata used by the sigstore TUF repository, regardless of their status.
+func (r *VerifiedTUFRepository) SigstoreTargets(usage string) ([][]byte, error) {
+	names := make([]string, 0, len(r.targets))
+	for name := range r.targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	res := [][]byte{}
+	for _, name := range names {
+		custom := r.targets[name].Custom
+		if custom == nil {
+			continue
+		}
+		var m struct {
+			Sigstore struct {
+				Usage string `json:"usage"`
+			} `json:"sigstore"`
+		}
+		if err := json.Unmarshal(custom, &m); err != nil {
+			continue // Not the format we are looking for.
+		}
+		if m.Sigstore.Usage != usage {
+			continue
+		}
+		data, err := r.Target(name)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, data)
+	}
+	return res, nil
+}
@@ -0,0 +1,432 @@
+package internal
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/secure-systems-lab/go-securesystemslib/cjson"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTUFKey is a key used to sign metadata of a testTUFRepo.
+type testTUFKey struct {
+	id   string
+	key  tufKey
+	sign func(data []byte) []byte
+}
+
+// newTestTUFKey returns a new ECDSA or ed25519 key.
+func newTestTUFKey(t *testing.T, useECDSA bool) testTUFKey {
+	var res testTUFKey
+	if useECDSA {
+		privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		publicKeyPEM, err := cryptoutils.MarshalPublicKeyToPEM(&privateKey.PublicKey)
+		require.NoError(t, err)
+		res.key = tufKey{KeyType: "ecdsa-sha2-nistp256", Scheme: "ecdsa-sha2-nistp256"}
+		res.key.KeyVal.Public = string(publicKeyPEM)
+		res.sign = func(data []byte) []byte {
+			digest := sha256.Sum256(data)
+			sig, err := ecdsa.SignASN1(rand.Reader, privateKey, digest[:])
+			require.NoError(t, err)
+			return sig
+		}
+	} else {
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		res.key = tufKey{KeyType: "ed25519", Scheme: "ed25519"}
+		res.key.KeyVal.Public = hex.EncodeToString(publicKey)
+		res.sign = func(data []byte) []byte {
+			return ed25519.Sign(privateKey, data)
+		}
+	}
+	keyJSON, err := json.Marshal(res.key)
+	require.NoError(t, err)
+	keyID := sha256.Sum256(keyJSON)
+	res.id = hex.EncodeToString(keyID[:])
+	return res
+}
+
+// testTUFRepo is a TUF repository for tests, with all files stored in memory.
+type testTUFRepo struct {
+	t       *testing.T
+	files   map[string][]byte
+	root    tufRoot
+	keys    map[string][]testTUFKey // Indexed by role
+	expires time.Time
+	// The versions of the most recently published metadata
+	targetsVersion, snapshotVersion, timestampVersion int64
+}
+
+// newTestTUFRepo returns a new repository with a 1.root.json, and no other metadata.
+func newTestTUFRepo(t *testing.T, consistentSnapshot bool) *testTUFRepo {
+	r := &testTUFRepo{
+		t:       t,
+		files:   map[string][]byte{},
+		keys:    map[string][]testTUFKey{},
+		expires: time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second),
+	}
+	r.root = tufRoot{
+		tufCommon:          tufCommon{Type: "root", Version: 1, Expires: r.expires},
+		ConsistentSnapshot: consistentSnapshot,
+		Keys:               map[string]tufKey{},
+		Roles:              map[string]tufRole{},
+	}
+	r.setRoleKeys("root", 1, newTestTUFKey(t, true), newTestTUFKey(t, false))
+	r.setRoleKeys("targets", 1, newTestTUFKey(t, false))
+	r.setRoleKeys("snapshot", 1, newTestTUFKey(t, true))
+	r.setRoleKeys("timestamp", 1, newTestTUFKey(t, true))
+	r.files["1.root.json"] = r.sign(r.root, r.keys["root"]...)
+	return r
+}
+
+// setRoleKeys sets the keys and threshold of role in r.root, without signing the root metadata.
+func (r *testTUFRepo) setRoleKeys(role string, threshold int, keys ...testTUFKey) {
+	r.keys[role] = keys
+	ids := []string{}
+	for _, k := range keys {
+		r.root.Keys[k.id] = k.key
+		ids = append(ids, k.id)
+	}
+	r.root.Roles[role] = tufRole{KeyIDs: ids, Threshold: threshold}
+}
+
+// rotateRoot publishes a new version of the root metadata, with a new set of root keys,
+// signed by both the old and the new keys.
+func (r *testTUFRepo) rotateRoot(newKeys ...testTUFKey) {
+	oldKeys := r.keys["root"]
+	r.root.Version++
+	r.setRoleKeys("root", len(newKeys), newKeys...)
+	r.files[fmt.Sprintf("%d.root.json", r.root.Version)] = r.sign(r.root, append(oldKeys, newKeys...)...)
+}
+
+// sign returns signed metadata with signed, signed by keys.
+func (r *testTUFRepo) sign(signed any, keys ...testTUFKey) []byte {
+	signedJSON, err := json.Marshal(signed)
+	require.NoError(r.t, err)
+	canonical, err := cjson.EncodeCanonical(json.RawMessage(signedJSON))
+	require.NoError(r.t, err)
+	sigs := []untrustedTUFSignature{}
+	for _, k := range keys {
+		sigs = append(sigs, untrustedTUFSignature{UntrustedKeyID: k.id, UntrustedSig: hex.EncodeToString(k.sign(canonical))})
+	}
+	res, err := json.Marshal(untrustedTUFSignedMetadata{UntrustedSigned: signedJSON, UntrustedSignatures: sigs})
+	require.NoError(r.t, err)
+	return res
+}
+
+// testTUFMetaFile returns metadata describing data with version.
+func testTUFMetaFile(version int64, data []byte) tufMetaFile {
+	h := sha256.Sum256(data)
+	return tufMetaFile{Version: version, Length: int64(len(data)), Hashes: map[string]string{"sha256": hex.EncodeToString(h[:])}}
+}
+
+// publish publishes targets, with contents in targetData and custom metadata in custom, and new snapshot and timestamp metadata.
+func (r *testTUFRepo) publish(targetData map[string][]byte, custom map[string]string) {
+	targets := tufTargets{
+		tufCommon: tufCommon{Type: "targets", Version: r.targetsVersion + 1, Expires: r.expires},
+		Targets:   map[string]tufTargetFile{},
+	}
+	for name, data := range targetData {
+		sha256Hash := sha256.Sum256(data)
+		sha512Hash := sha512.Sum512(data)
+		target := tufTargetFile{
+			Length: int64(len(data)),
+			Hashes: map[string]string{
+				"sha256": hex.EncodeToString(sha256Hash[:]),
+				"sha512": hex.EncodeToString(sha512Hash[:]),
+			},
+		}
+		if c, ok := custom[name]; ok {
+			target.Custom = json.RawMessage(c)
+		}
+		targets.Targets[name] = target
+		if r.root.ConsistentSnapshot {
+			r.files["targets/"+target.Hashes["sha256"]+"."+name] = data
+		} else {
+			r.files["targets/"+name] = data
+		}
+	}
+	r.targetsVersion = targets.Version
+	r.publishMetadata("targets", targets.Version, r.sign(targets, r.keys["targets"]...))
+
+	snapshot := tufTimestampOrSnapshot{
+		tufCommon: tufCommon{Type: "snapshot", Version: r.snapshotVersion + 1, Expires: r.expires},
+		Meta:      map[string]tufMetaFile{"targets.json": {Version: targets.Version}},
+	}
+	r.snapshotVersion = snapshot.Version
+	snapshotBytes := r.sign(snapshot, r.keys["snapshot"]...)
+	r.publishMetadata("snapshot", snapshot.Version, snapshotBytes)
+
+	timestamp := tufTimestampOrSnapshot{
+		tufCommon: tufCommon{Type: "timestamp", Version: r.timestampVersion + 1, Expires: r.expires},
+		Meta:      map[string]tufMetaFile{"snapshot.json": testTUFMetaFile(snapshot.Version, snapshotBytes)},
+	}
+	r.timestampVersion = timestamp.Version
+	r.files["timestamp.json"] = r.sign(timestamp, r.keys["timestamp"]...)
+}
+
+// publishMetadata stores data as metadata for role with version.
+func (r *testTUFRepo) publishMetadata(role string, version int64, data []byte) {
+	if r.root.ConsistentSnapshot {
+		r.files[fmt.Sprintf("%d.%s.json", version, role)] = data
+	} else {
+		r.files[role+".json"] = data
+	}
+}
+
+// fetch is a TUFFetcher for r.
+func (r *testTUFRepo) fetch(name string) ([]byte, error) {
+	data, ok := r.files[name]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+	}
+	return data, nil
+}
+
+func TestVerifyTUFRepository(t *testing.T) {
+	rekorCustom := `{"sigstore":{"usage":"Rekor","status":"Active"}}`
+	fulcioCustom := `{"sigstore":{"usage":"Fulcio","status":"Expired"}}`
+	targetData := map[string][]byte{
+		"rekor.pub":   []byte("rekor key"),
+		"fulcio.crt":  []byte("fulcio CA"),
+		"fulcio2.crt": []byte("fulcio CA 2"),
+		"other":       []byte("other"),
+	}
+	custom := map[string]string{
+		"rekor.pub":   rekorCustom,
+		"fulcio.crt":  fulcioCustom,
+		"fulcio2.crt": fulcioCustom,
+		"other":       `"not an object"`,
+	}
+
+	for _, consistent := range []bool{false, true} {
+		repo := newTestTUFRepo(t, consistent)
+		repo.publish(targetData, custom)
+		trustedRoot := repo.files["1.root.json"]
+
+		// Success without root rotations
+		res, err := VerifyTUFRepository(trustedRoot, repo.fetch, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, trustedRoot, res.Root)
+		data, err := res.Target("rekor.pub")
+		require.NoError(t, err)
+		assert.Equal(t, []byte("rekor key"), data)
+		_, err = res.Target("missing")
+		assert.Error(t, err)
+		targets, err := res.SigstoreTargets("Fulcio")
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{[]byte("fulcio CA"), []byte("fulcio CA 2")}, targets)
+		targets, err = res.SigstoreTargets("Rekor")
+		require.NoError(t, err)
+		assert.Equal(t, [][]byte{[]byte("rekor key")}, targets)
+		targets, err = res.SigstoreTargets("unknown")
+		require.NoError(t, err)
+		assert.Empty(t, targets)
+
+		// Success with root rotations; the previously published metadata is signed by keys which were not rotated.
+		repo.rotateRoot(newTestTUFKey(t, true))
+		repo.rotateRoot(newTestTUFKey(t, false), newTestTUFKey(t, true))
+		res, err = VerifyTUFRepository(trustedRoot, repo.fetch, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, repo.files["3.root.json"], res.Root)
+		// … and the result can be used as a trusted root later
+		res, err = VerifyTUFRepository(res.Root, repo.fetch, time.Now())
+		require.NoError(t, err)
+		assert.Equal(t, repo.files["3.root.json"], res.Root)
+
+		// Metadata expired
+		_, err = VerifyTUFRepository(trustedRoot, repo.fetch, time.Now().Add(48*time.Hour))
+		assert.Error(t, err)
+		assert.IsType(t, InvalidSignatureError{}, err)
+
+		// A modified target
+		for name := range repo.files {
+			if strings.HasSuffix(name, "rekor.pub") {
+				repo.files[name] = []byte("modified")
+			}
+		}
+		res, err = VerifyTUFRepository(trustedRoot, repo.fetch, time.Now())
+		require.NoError(t, err)
+		_, err = res.Target("rekor.pub")
+		assert.Error(t, err)
+		assert.IsType(t, InvalidSignatureError{}, err)
+		_, err = res.SigstoreTargets("Rekor")
+		assert.Error(t, err)
+	}
+
+	// Invalid trusted root
+	_, err := VerifyTUFRepository([]byte("not JSON"), func(string) ([]byte, error) { return nil, fs.ErrNotExist }, time.Now())
+	assert.Error(t, err)
+	repo := newTestTUFRepo(t, false)
+	repo.publish(targetData, custom)
+	timestamp := repo.files["timestamp.json"]
+	_, err = VerifyTUFRepository(timestamp, repo.fetch, time.Now())
+	assert.Error(t, err)
+
+	// Various kinds of invalid repositories
+	for _, c := range []struct {
+		name string
+		fn   func(r *testTUFRepo)
+	}{
+		{"Root rotation not signed by the old key", func(r *testTUFRepo) {
+			r.root.Version++
+			r.setRoleKeys("root", 1, newTestTUFKey(t, true))
+			r.files["2.root.json"] = r.sign(r.root, r.keys["root"]...)
+		}},
+		{"Root rotation not signed by the new key", func(r *testTUFRepo) {
+			oldKeys := r.keys["root"]
+			r.root.Version++
+			r.setRoleKeys("root", 1, newTestTUFKey(t, true))
+			r.files["2.root.json"] = r.sign(r.root, oldKeys...)
+		}},
+		{"Root rotation with an unexpected version", func(r *testTUFRepo) {
+			r.root.Version += 2
+			r.files["2.root.json"] = r.sign(r.root, r.keys["root"]...)
+		}},
+		{"Root rotation with a different type", func(r *testTUFRepo) {
+			r.root.Version++
+			r.root.Type = "targets"
+			r.files["2.root.json"] = r.sign(r.root, r.keys["root"]...)
+		}},
+		{"Root rotation not JSON", func(r *testTUFRepo) { r.files["2.root.json"] = []byte("not JSON") }},
+		{"Expired root", func(r *testTUFRepo) {
+			r.root.Version++
+			r.root.Expires = time.Now().Add(-time.Hour)
+			r.files["2.root.json"] = r.sign(r.root, r.keys["root"]...)
+		}},
+		{"Root threshold not met", func(r *testTUFRepo) {
+			keys := r.keys["root"]
+			r.root.Version++
+			r.setRoleKeys("root", 2, keys...)
+			r.files["2.root.json"] = r.sign(r.root, keys[0])
+		}},
+		{"Signatures by the same key are counted only once", func(r *testTUFRepo) {
+			keys := r.keys["root"]
+			r.root.Version++
+			r.setRoleKeys("root", 2, keys...)
+			r.files["2.root.json"] = r.sign(r.root, keys[0], keys[0])
+		}},
+		{"Invalid threshold", func(r *testTUFRepo) {
+			keys := r.keys["root"]
+			r.root.Version++
+			r.setRoleKeys("root", 0, keys...)
+			r.files["2.root.json"] = r.sign(r.root, keys...)
+		}},
+		{"Timestamp missing", func(r *testTUFRepo) { delete(r.files, "timestamp.json") }},
+		{"Timestamp signed by a wrong key", func(r *testTUFRepo) {
+			r.keys["timestamp"] = []testTUFKey{newTestTUFKey(t, true)}
+			r.publish(targetData, custom)
+		}},
+		{"Timestamp signed by a key of a different role", func(r *testTUFRepo) {
+			r.keys["timestamp"] = r.keys["snapshot"]
+			r.publish(targetData, custom)
+		}},
+		{"Snapshot signed by a wrong key", func(r *testTUFRepo) {
+			r.keys["snapshot"] = []testTUFKey{newTestTUFKey(t, false)}
+			r.publish(targetData, custom)
+		}},
+		{"Targets signed by a wrong key", func(r *testTUFRepo) {
+			r.keys["targets"] = []testTUFKey{newTestTUFKey(t, false)}
+			r.publish(targetData, custom)
+		}},
+		{"Snapshot does not match timestamp", func(r *testTUFRepo) {
+			snapshot := tufTimestampOrSnapshot{
+				tufCommon: tufCommon{Type: "snapshot", Version: r.snapshotVersion, Expires: r.expires},
+				Meta:      map[string]tufMetaFile{},
+			}
+			r.files["snapshot.json"] = r.sign(snapshot, r.keys["snapshot"]...)
+		}},
+		{"Targets version does not match snapshot", func(r *testTUFRepo) {
+			targets := tufTargets{tufCommon: tufCommon{Type: "targets", Version: r.targetsVersion + 1, Expires: r.expires}}
+			r.files["targets.json"] = r.sign(targets, r.keys["targets"]...)
+		}},
+		{"Targets expired", func(r *testTUFRepo) {
+			targets := tufTargets{tufCommon: tufCommon{Type: "targets", Version: r.targetsVersion, Expires: time.Now().Add(-time.Hour)}}
+			r.files["targets.json"] = r.sign(targets, r.keys["targets"]...)
+		}},
+		{"Timestamp does not refer to snapshot", func(r *testTUFRepo) {
+			timestamp := tufTimestampOrSnapshot{
+				tufCommon: tufCommon{Type: "timestamp", Version: r.timestampVersion + 1, Expires: r.expires},
+				Meta:      map[string]tufMetaFile{},
+			}
+			r.files["timestamp.json"] = r.sign(timestamp, r.keys["timestamp"]...)
+		}},
+		{"Metadata with an invalid signature", func(r *testTUFRepo) {
+			var m untrustedTUFSignedMetadata
+			require.NoError(t, json.Unmarshal(r.files["timestamp.json"], &m))
+			m.UntrustedSignatures[0].UntrustedSig = "not hex"
+			data, err := json.Marshal(m)
+			require.NoError(t, err)
+			r.files["timestamp.json"] = data
+		}},
+	} {
+		repo := newTestTUFRepo(t, false)
+		repo.publish(targetData, custom)
+		trustedRoot := repo.files["1.root.json"]
+		c.fn(repo)
+		_, err := VerifyTUFRepository(trustedRoot, repo.fetch, time.Now())
+		assert.Error(t, err, c.name)
+	}
+
+	// Fetch failures other than missing files
+	repo = newTestTUFRepo(t, false)
+	repo.publish(targetData, custom)
+	_, err = VerifyTUFRepository(repo.files["1.root.json"], func(string) ([]byte, error) {
+		return nil, fmt.Errorf("network failure")
+	}, time.Now())
+	assert.Error(t, err)
+
+	// Too many root rotations
+	repo = newTestTUFRepo(t, false)
+	for i := 0; i < maxTUFRootRotations; i++ {
+		repo.rotateRoot(repo.keys["root"]...)
+	}
+	repo.publish(targetData, custom)
+	_, err = VerifyTUFRepository(repo.files["1.root.json"], repo.fetch, time.Now())
+	assert.Error(t, err)
+}
+
+func TestVerifyTUFSignature(t *testing.T) {
+	data := []byte("data")
+	for _, useECDSA := range []bool{true, false} {
+		key := newTestTUFKey(t, useECDSA)
+		sig := key.sign(data)
+		assert.True(t, verifyTUFSignature(key.key, data, sig))
+		assert.False(t, verifyTUFSignature(key.key, []byte("other"), sig))
+		assert.False(t, verifyTUFSignature(newTestTUFKey(t, useECDSA).key, data, sig))
+		brokenKey := key.key
+		brokenKey.KeyVal.Public = "not hex"
+		assert.False(t, verifyTUFSignature(brokenKey, data, sig))
+	}
+
+	// Hex-encoded PEM
+	key := newTestTUFKey(t, true)
+	sig := key.sign(data)
+	key.key.KeyVal.Public = hex.EncodeToString([]byte(key.key.KeyVal.Public))
+	assert.True(t, verifyTUFSignature(key.key, data, sig))
+
+	// ECDSA scheme with an ed25519 key
+	edKey := newTestTUFKey(t, false)
+	k := key.key
+	k.KeyVal.Public = edKey.key.KeyVal.Public
+	assert.False(t, verifyTUFSignature(k, data, sig))
+
+	// Unknown scheme
+	k = key.key
+	k.Scheme = "rsassa-pss-sha256"
+	assert.False(t, verifyTUFSignature(k, data, sig))
+}
@@ -0,0 +1,191 @@
+// Note: Consider the API unstable until the code supports at least three different image formats or transports.
+
+package signature
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containers/storage/pkg/homedir"
+	"github.com/containers/storage/pkg/ioutils"
+	"golang.org/x/exp/slices"
+	// Keyring management does not do any cryptography beyond parsing and re-serializing public keys;
+	// use the same implementation as mechanism_openpgp.go.
+	//lint:ignore SA1019 See mechanism_openpgp.go
+	"golang.org/x/crypto/openpgp" //nolint:staticcheck
+)
+
+// gpgKeyringFileName is the name of the keyring file within a GPGKeyring directory.
+// This is the legacy (GnuPG < 2.1) public keyring format, which is read by NewOpenPGPSigningMechanism.
+const gpgKeyringFileName = "pubring.gpg"
+
+// GPGKeyring manages a keyring of trusted GPG/OpenPGP public keys for simple signing, without invoking any gpg binaries.
+//
+// The keys are stored in the pubring.gpg file of a directory, in a format which can be used
+// as a "keyPath" of a "signedBy" policy requirement, or by NewOpenPGPSigningMechanism
+// (and, if the directory has no newer pubring.kbx, by GnuPG) when $GNUPGHOME points to the directory.
+type GPGKeyring struct {
+	dir string
+}
+
+// GPGKeyInfo describes a public key in a GPGKeyring.
+type GPGKeyInfo struct {
+	// Fingerprint is the fingerprint of the key, as used for key identities elsewhere in this package.
+	Fingerprint string
+	// UserIDs are the user IDs of the key, e.g. "Name <email@example.com>".
+	UserIDs []string
+	// Created is the creation time of the key.
+	Created time.Time
+	// Expires is the expiration time of the key, or nil if the key does not expire.
+	Expires *time.Time
+}
+
+// NewGPGKeyring returns a GPGKeyring stored in dir.
+// If dir is "", the user’s default GPG configuration directory ($GNUPGHOME / ~/.gnupg) is used.
+// The directory does not need to exist until keys are imported.
+func NewGPGKeyring(dir string) *GPGKeyring {
+	if dir == "" {
+		dir = os.Getenv("GNUPGHOME")
+		if dir == "" {
+			dir = filepath.Join(homedir.Get(), ".gnupg")
+		}
+	}
+	return &GPGKeyring{dir: dir}
+}
+
+// Path returns the path of the keyring file, e.g. for use as a "keyPath" in policy.json.
+func (k *GPGKeyring) Path() string {
+	return filepath.Join(k.dir, gpgKeyringFileName)
+}
+
+// readEntities returns the keys in k, or an empty list if the keyring does not exist yet.
+func (k *GPGKeyring) readEntities() (openpgp.EntityList, error) {
+	data, err := os.ReadFile(k.Path())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return openpgp.EntityList{}, nil
+		}
+		return nil, err
+	}
+	keyring, err := openpgp.ReadKeyRing(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing keyring %s: %w", k.Path(), err)
+	}
+	return keyring, nil
+}
+
+// writeEntities atomically replaces the contents of k with the public parts of entities.
+func (k *GPGKeyring) writeEntities(entities openpgp.EntityList) error {
+	var buf bytes.Buffer
+	for _, e := range entities {
+		if err := e.Serialize(&buf); err != nil {
+			return fmt.Errorf("serializing key %s: %w", openpgpKeyIdentity(e.PrimaryKey), err)
+		}
+	}
+	if err := os.MkdirAll(k.dir, 0o700); err != nil {
+		return err
+	}
+	return ioutils.AtomicWriteFile(k.Path(), buf.Bytes(), 0o644)
+}
+
+// ImportKeys imports public keys from blob, in binary or ASCII-armored form, into the keyring,
+// and returns their fingerprints.
+// Keys already present in the keyring are replaced. If blob contains private keys, only their public parts are imported.
+func (k *GPGKeyring) ImportKeys(blob []byte) ([]string, error) {
+	imported, err := openpgp.ReadKeyRing(bytes.NewReader(blob))
+	if err != nil {
+		armored, e2 := openpgp.ReadArmoredKeyRing(bytes.NewReader(blob))
+		if e2 != nil {
+			return nil, err // The original error, as in openpgpSigningMechanism.importKeysFromBytes
+		}
+		imported = armored
+	}
+	if len(imported) == 0 {
+		return nil, errors.New("no keys found")
+	}
+
+	existing, err := k.readEntities()
+	if err != nil {
+		return nil, err
+	}
+	fingerprints := []string{}
+	for _, e := range imported {
+		fingerprint := openpgpKeyIdentity(e.PrimaryKey)
+		fingerprints = append(fingerprints, fingerprint)
+		replaced := false
+		for i := range existing {
+			if openpgpKeyIdentity(existing[i].PrimaryKey) == fingerprint {
+				existing[i] = e
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			existing = append(existing, e)
+		}
+	}
+	if err := k.writeEntities(existing); err != nil {
+		return nil, err
+	}
+	return fingerprints, nil
+}
+
+// ListKeys returns the keys in the keyring.
+func (k *GPGKeyring) ListKeys() ([]GPGKeyInfo, error) {
+	entities, err := k.readEntities()
+	if err != nil {
+		return nil, err
+	}
+	res := make([]GPGKeyInfo, 0, len(entities))
+	for _, e := range entities {
+		info := GPGKeyInfo{
+			Fingerprint: openpgpKeyIdentity(e.PrimaryKey),
+			UserIDs:     []string{},
+			Created:     e.PrimaryKey.CreationTime,
+		}
+		for name := range e.Identities {
+			info.UserIDs = append(info.UserIDs, name)
+		}
+		slices.Sort(info.UserIDs)
+		// The expiration time is recorded in identity self-signatures; use the primary identity, if any.
+		var primary *openpgp.Identity // = nil
+		for _, name := range info.UserIDs {
+			identity := e.Identities[name]
+			if primary == nil || (identity.SelfSignature != nil && identity.SelfSignature.IsPrimaryId != nil && *identity.SelfSignature.IsPrimaryId) {
+				primary = identity
+			}
+		}
+		if primary != nil && primary.SelfSignature != nil && primary.SelfSignature.KeyLifetimeSecs != nil &&
+			*primary.SelfSignature.KeyLifetimeSecs != 0 {
+			expires := e.PrimaryKey.CreationTime.Add(time.Duration(*primary.SelfSignature.KeyLifetimeSecs) * time.Second)
+			info.Expires = &expires
+		}
+		res = append(res, info)
+	}
+	return res, nil
+}
+
+// RemoveKey removes the key with fingerprint from the keyring.
+// It fails if there is no such key.
+func (k *GPGKeyring) RemoveKey(fingerprint string) error {
+	entities, err := k.readEntities()
+	if err != nil {
+		return err
+	}
+	fingerprint = strings.ToUpper(fingerprint)
+	remaining := openpgp.EntityList{}
+	for _, e := range entities {
+		if openpgpKeyIdentity(e.PrimaryKey) != fingerprint {
+			remaining = append(remaining, e)
+		}
+	}
+	if len(remaining) == len(entities) {
+		return fmt.Errorf("key %s not found in %s", fingerprint, k.Path())
+	}
+	return k.writeEntities(remaining)
+}
@@ -0,0 +1,177 @@
+package signature
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	//lint:ignore SA1019 See mechanism_openpgp.go
+	"golang.org/x/crypto/openpgp" //nolint:staticcheck
+	//lint:ignore SA1019 See mechanism_openpgp.go
+	"golang.org/x/crypto/openpgp/armor" //nolint:staticcheck
+)
+
+func TestNewGPGKeyring(t *testing.T) {
+	dir := t.TempDir()
+	k := NewGPGKeyring(dir)
+	assert.Equal(t, filepath.Join(dir, "pubring.gpg"), k.Path())
+
+	t.Setenv("GNUPGHOME", dir)
+	k = NewGPGKeyring("")
+	assert.Equal(t, filepath.Join(dir, "pubring.gpg"), k.Path())
+}
+
+func TestGPGKeyringImportKeys(t *testing.T) {
+	k := NewGPGKeyring(filepath.Join(t.TempDir(), "nonexistent", "dir"))
+
+	// An empty keyring
+	keys, err := k.ListKeys()
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	key1, err := os.ReadFile("fixtures/public-key-1.gpg")
+	require.NoError(t, err)
+	fingerprints, err := k.ImportKeys(key1)
+	require.NoError(t, err)
+	require.Len(t, fingerprints, 1)
+	key1Fingerprint := fingerprints[0]
+
+	key2, err := os.ReadFile("fixtures/public-key-2.gpg")
+	require.NoError(t, err)
+	fingerprints, err = k.ImportKeys(key2)
+	require.NoError(t, err)
+	require.Len(t, fingerprints, 1)
+	key2Fingerprint := fingerprints[0]
+	assert.NotEqual(t, key1Fingerprint, key2Fingerprint)
+
+	// Re-importing an existing key does not create a duplicate
+	fingerprints, err = k.ImportKeys(key1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{key1Fingerprint}, fingerprints)
+	keys, err = k.ListKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, key1Fingerprint, keys[0].Fingerprint)
+	assert.Equal(t, key2Fingerprint, keys[1].Fingerprint)
+
+	// The keyring can be used by the signature verification code
+	_, keyIdentities, err := newEphemeralOpenPGPSigningMechanism([][]byte{mustReadFile(t, k.Path())})
+	require.NoError(t, err)
+	assert.Equal(t, []string{key1Fingerprint, key2Fingerprint}, keyIdentities)
+
+	// ASCII-armored input, including a private key
+	entity, err := openpgp.NewEntity("Test User", "", "test@example.com", nil)
+	require.NoError(t, err)
+	var armored bytes.Buffer
+	w, err := armor.Encode(&armored, openpgp.PrivateKeyType, nil)
+	require.NoError(t, err)
+	err = entity.SerializePrivate(w, nil)
+	require.NoError(t, err)
+	err = w.Close()
+	require.NoError(t, err)
+	fingerprints, err = k.ImportKeys(armored.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, []string{openpgpKeyIdentity(entity.PrimaryKey)}, fingerprints)
+	// Only the public part is stored
+	stored, err := openpgp.ReadKeyRing(bytes.NewReader(mustReadFile(t, k.Path())))
+	require.NoError(t, err)
+	require.Len(t, stored, 3)
+	for _, e := range stored {
+		assert.Nil(t, e.PrivateKey)
+	}
+
+	// Invalid input
+	for _, blob := range [][]byte{nil, []byte("this is not a key")} {
+		_, err := k.ImportKeys(blob)
+		assert.Error(t, err)
+	}
+	// The keyring is not modified on failure
+	keys, err = k.ListKeys()
+	require.NoError(t, err)
+	assert.Len(t, keys, 3)
+}
+
+func TestGPGKeyringListKeys(t *testing.T) {
+	k := NewGPGKeyring(t.TempDir())
+
+	now := time.Now().Truncate(time.Second)
+	entity, err := openpgp.NewEntity("Test User", "", "test@example.com", nil)
+	require.NoError(t, err)
+	lifetime := uint32(3600)
+	for _, identity := range entity.Identities {
+		identity.SelfSignature.KeyLifetimeSecs = &lifetime
+		err := identity.SelfSignature.SignUserId(identity.UserId.Id, entity.PrimaryKey, entity.PrivateKey, nil)
+		require.NoError(t, err)
+	}
+	var blob bytes.Buffer
+	err = entity.Serialize(&blob)
+	require.NoError(t, err)
+	_, err = k.ImportKeys(blob.Bytes())
+	require.NoError(t, err)
+	_, err = k.ImportKeys(mustReadFile(t, "fixtures/public-key.gpg"))
+	require.NoError(t, err)
+
+	keys, err := k.ListKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, openpgpKeyIdentity(entity.PrimaryKey), keys[0].Fingerprint)
+	assert.Equal(t, []string{"Test User <test@example.com>"}, keys[0].UserIDs)
+	assert.False(t, keys[0].Created.Before(now))
+	require.NotNil(t, keys[0].Expires)
+	assert.Equal(t, keys[0].Created.Add(time.Hour), *keys[0].Expires)
+	assert.Equal(t, TestKeyFingerprint, keys[1].Fingerprint)
+	assert.NotEmpty(t, keys[1].UserIDs)
+	assert.Nil(t, keys[1].Expires)
+
+	// An invalid keyring
+	err = os.WriteFile(k.Path(), []byte("this is not a keyring"), 0o644)
+	require.NoError(t, err)
+	_, err = k.ListKeys()
+	assert.Error(t, err)
+}
+
+func TestGPGKeyringRemoveKey(t *testing.T) {
+	k := NewGPGKeyring(t.TempDir())
+	_, err := k.ImportKeys(mustReadFile(t, "fixtures/public-key-1.gpg"))
+	require.NoError(t, err)
+	fingerprints, err := k.ImportKeys(mustReadFile(t, "fixtures/public-key-2.gpg"))
+	require.NoError(t, err)
+	require.Len(t, fingerprints, 1)
+	keys, err := k.ListKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+
+	err = k.RemoveKey(keys[0].Fingerprint)
+	require.NoError(t, err)
+	keys, err = k.ListKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.Equal(t, fingerprints[0], keys[0].Fingerprint)
+
+	// A key which is not present
+	err = k.RemoveKey(TestOtherFingerprint1)
+	assert.Error(t, err)
+
+	// Fingerprints are case-insensitive
+	err = k.RemoveKey(strings.ToLower(fingerprints[0]))
+	require.NoError(t, err)
+	keys, err = k.ListKeys()
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+
+	// A nonexistent keyring
+	err = NewGPGKeyring(filepath.Join(t.TempDir(), "nonexistent")).RemoveKey(TestKeyFingerprint)
+	assert.Error(t, err)
+}
+
+// mustReadFile returns the contents of path, which must be readable.
+func mustReadFile(t *testing.T, path string) []byte {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return data
+}
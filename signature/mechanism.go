@@ -37,6 +37,17 @@ type SigningMechanism interface {
 	UntrustedSignatureContents(untrustedSignature []byte) (untrustedContents []byte, shortKeyIdentifier string, err error)
 }
 
+// DetachedSigningMechanism is an extension of SigningMechanism, implemented by mechanisms
+// which support detached signatures.
+type DetachedSigningMechanism interface {
+	SigningMechanism
+	// SignDetached creates a detached signature of input using keyIdentity.
+	// Fails with a SigningNotSupportedError if the mechanism does not support signing.
+	SignDetached(input []byte, keyIdentity string) ([]byte, error)
+	// VerifyDetached verifies that unverifiedSignature is a detached signature of contents, and returns the signer's identity.
+	VerifyDetached(unverifiedSignature []byte, contents []byte) (keyIdentity string, err error)
+}
+
 // signingMechanismWithPassphrase is an internal extension of SigningMechanism.
 type signingMechanismWithPassphrase interface {
 	SigningMechanism
@@ -68,6 +79,33 @@ func NewEphemeralGPGSigningMechanism(blob []byte) (SigningMechanism, []string, e
 	return newEphemeralGPGSigningMechanism([][]byte{blob})
 }
 
+// NewOpenPGPSigningMechanism returns a new GPG/OpenPGP signing mechanism implemented in Go,
+// for the user’s default GPG configuration ($GNUPGHOME / ~/.gnupg), regardless of build tags.
+// Keys are read from the legacy pubring.gpg and secring.gpg files; signing is only possible
+// if secring.gpg contains the relevant private key.
+// Prefer NewGPGSigningMechanism unless gpgme is not available, e.g. in static binaries.
+// The caller must call .Close() on the returned SigningMechanism.
+func NewOpenPGPSigningMechanism() (DetachedSigningMechanism, error) {
+	m, err := newOpenPGPSigningMechanismInDirectory("")
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// NewEphemeralOpenPGPSigningMechanism returns a new GPG/OpenPGP signing mechanism implemented in Go,
+// regardless of build tags, which recognizes _only_ keys from the supplied blob, and returns the identities
+// of these keys.
+// If the blob contains private keys, they can be used for signing.
+// The caller must call .Close() on the returned SigningMechanism.
+func NewEphemeralOpenPGPSigningMechanism(blob []byte) (DetachedSigningMechanism, []string, error) {
+	m, keyIdentities, err := newEphemeralOpenPGPSigningMechanism([][]byte{blob})
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, keyIdentities, nil
+}
+
 // gpgUntrustedSignatureContents returns UNTRUSTED contents of the signature WITHOUT ANY VERIFICATION,
 // along with a short identifier of the key used for signing.
 // WARNING: The short key identifier (which corresponds to "Key ID" for OpenPGP keys)
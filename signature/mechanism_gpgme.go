@@ -19,6 +19,8 @@ type gpgmeSigningMechanism struct {
 	ephemeralDir string // If not "", a directory to be removed on Close()
 }
 
+var _ DetachedSigningMechanism = (*gpgmeSigningMechanism)(nil)
+
 // newGPGSigningMechanismInDirectory returns a new GPG/OpenPGP signing mechanism, using optionalDir if not empty.
 // The caller must call .Close() on the returned SigningMechanism.
 func newGPGSigningMechanismInDirectory(optionalDir string) (signingMechanismWithPassphrase, error) {
@@ -125,6 +127,11 @@ func (m *gpgmeSigningMechanism) SupportsSigning() error {
 // Sign creates a (non-detached) signature of input using keyIdentity and passphrase.
 // Fails with a SigningNotSupportedError if the mechanism does not support signing.
 func (m *gpgmeSigningMechanism) SignWithPassphrase(input []byte, keyIdentity string, passphrase string) ([]byte, error) {
+	return m.sign(input, keyIdentity, passphrase, gpgme.SigModeNormal)
+}
+
+// sign creates a signature of input using keyIdentity and passphrase, using mode.
+func (m *gpgmeSigningMechanism) sign(input []byte, keyIdentity string, passphrase string, mode gpgme.SigMode) ([]byte, error) {
 	key, err := m.ctx.GetKey(keyIdentity, true)
 	if err != nil {
 		return nil, err
@@ -158,7 +165,7 @@ func (m *gpgmeSigningMechanism) SignWithPassphrase(input []byte, keyIdentity str
 		}
 	}
 
-	if err = m.ctx.Sign([]*gpgme.Key{key}, inputData, sigData, gpgme.SigModeNormal); err != nil {
+	if err = m.ctx.Sign([]*gpgme.Key{key}, inputData, sigData, mode); err != nil {
 		return nil, err
 	}
 	return sigBuffer.Bytes(), nil
@@ -185,16 +192,48 @@ func (m *gpgmeSigningMechanism) Verify(unverifiedSignature []byte) (contents []b
 	if err != nil {
 		return nil, "", err
 	}
+	keyIdentity, err = gpgmeSignatureIdentity(sigs)
+	if err != nil {
+		return nil, "", err
+	}
+	return signedBuffer.Bytes(), keyIdentity, nil
+}
+
+// SignDetached creates a detached signature of input using keyIdentity.
+// Fails with a SigningNotSupportedError if the mechanism does not support signing.
+func (m *gpgmeSigningMechanism) SignDetached(input []byte, keyIdentity string) ([]byte, error) {
+	return m.sign(input, keyIdentity, "", gpgme.SigModeDetach)
+}
+
+// VerifyDetached verifies that unverifiedSignature is a detached signature of contents, and returns the signer's identity.
+func (m *gpgmeSigningMechanism) VerifyDetached(unverifiedSignature []byte, contents []byte) (keyIdentity string, err error) {
+	unverifiedSignatureData, err := gpgme.NewDataBytes(unverifiedSignature)
+	if err != nil {
+		return "", err
+	}
+	contentsData, err := gpgme.NewDataBytes(contents)
+	if err != nil {
+		return "", err
+	}
+	_, sigs, err := m.ctx.Verify(unverifiedSignatureData, contentsData, nil)
+	if err != nil {
+		return "", err
+	}
+	return gpgmeSignatureIdentity(sigs)
+}
+
+// gpgmeSignatureIdentity returns the signer's identity if sigs is a single valid signature.
+func gpgmeSignatureIdentity(sigs []gpgme.Signature) (string, error) {
 	if len(sigs) != 1 {
-		return nil, "", internal.NewInvalidSignatureError(fmt.Sprintf("Unexpected GPG signature count %d", len(sigs)))
+		return "", internal.NewInvalidSignatureError(fmt.Sprintf("Unexpected GPG signature count %d", len(sigs)))
 	}
 	sig := sigs[0]
 	// This is sig.Summary == gpgme.SigSumValid except for key trust, which we handle ourselves
 	if sig.Status != nil || sig.Validity == gpgme.ValidityNever || sig.ValidityReason != nil || sig.WrongKeyUsage {
 		// FIXME: Better error reporting eventually
-		return nil, "", internal.NewInvalidSignatureError(fmt.Sprintf("Invalid GPG signature: %#v", sig))
+		return "", internal.NewInvalidSignatureError(fmt.Sprintf("Invalid GPG signature: %#v", sig))
 	}
-	return signedBuffer.Bytes(), sig.Fingerprint, nil
+	return sig.Fingerprint, nil
 }
 
 // UntrustedSignatureContents returns UNTRUSTED contents of the signature WITHOUT ANY VERIFICATION,
@@ -0,0 +1,26 @@
+//go:build containers_image_openpgp
+// +build containers_image_openpgp
+
+package signature
+
+// newGPGSigningMechanismInDirectory returns a new GPG/OpenPGP signing mechanism, using optionalDir if not empty.
+// The caller must call .Close() on the returned SigningMechanism.
+func newGPGSigningMechanismInDirectory(optionalDir string) (signingMechanismWithPassphrase, error) {
+	m, err := newOpenPGPSigningMechanismInDirectory(optionalDir)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// newEphemeralGPGSigningMechanism returns a new GPG/OpenPGP signing mechanism which
+// recognizes _only_ public keys from the supplied blobs, and returns the identities
+// of these keys.
+// The caller must call .Close() on the returned SigningMechanism.
+func newEphemeralGPGSigningMechanism(blobs [][]byte) (signingMechanismWithPassphrase, []string, error) {
+	m, keyIdentities, err := newEphemeralOpenPGPSigningMechanism(blobs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, keyIdentities, nil
+}
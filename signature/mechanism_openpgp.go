@@ -1,6 +1,3 @@
-//go:build containers_image_openpgp
-// +build containers_image_openpgp
-
 package signature
 
 import (
@@ -15,24 +12,30 @@ import (
 
 	"github.com/containers/image/v5/signature/internal"
 	"github.com/containers/storage/pkg/homedir"
+	"golang.org/x/exp/slices"
 	// This is a fallback code; the primary recommendation is to use the gpgme mechanism
 	// implementation, which is out-of-process and more appropriate for handling long-term private key material
 	// than any Go implementation.
-	// For this verify-only fallback, we haven't reviewed any of the
+	// For this fallback, we haven't reviewed any of the
 	// existing alternatives to choose; so, for now, continue to
 	// use this frozen deprecated implementation.
 	//lint:ignore SA1019 See above
 	"golang.org/x/crypto/openpgp" //nolint:staticcheck
+	//lint:ignore SA1019 See above
+	"golang.org/x/crypto/openpgp/packet" //nolint:staticcheck
 )
 
 // A GPG/OpenPGP signing mechanism, implemented using x/crypto/openpgp.
 type openpgpSigningMechanism struct {
-	keyring openpgp.EntityList
+	keyring     openpgp.EntityList
+	signingKeys openpgp.EntityList // The subset of keys with private key material
 }
 
-// newGPGSigningMechanismInDirectory returns a new GPG/OpenPGP signing mechanism, using optionalDir if not empty.
+var _ DetachedSigningMechanism = (*openpgpSigningMechanism)(nil)
+
+// newOpenPGPSigningMechanismInDirectory returns a new GPG/OpenPGP signing mechanism implemented in Go, using optionalDir if not empty.
 // The caller must call .Close() on the returned SigningMechanism.
-func newGPGSigningMechanismInDirectory(optionalDir string) (signingMechanismWithPassphrase, error) {
+func newOpenPGPSigningMechanismInDirectory(optionalDir string) (*openpgpSigningMechanism, error) {
 	m := &openpgpSigningMechanism{
 		keyring: openpgp.EntityList{},
 	}
@@ -45,25 +48,29 @@ func newGPGSigningMechanismInDirectory(optionalDir string) (signingMechanismWith
 		}
 	}
 
-	pubring, err := os.ReadFile(path.Join(gpgHome, "pubring.gpg"))
-	if err != nil {
-		if !os.IsNotExist(err) {
-			return nil, err
-		}
-	} else {
-		_, err := m.importKeysFromBytes(pubring)
+	// Only the legacy (GnuPG < 2.1) keyring formats are supported; newer versions of GnuPG
+	// store private keys in a format we can not read, so signing requires secring.gpg.
+	for _, file := range []string{"pubring.gpg", "secring.gpg"} {
+		keyring, err := os.ReadFile(path.Join(gpgHome, file))
 		if err != nil {
-			return nil, err
+			if !os.IsNotExist(err) {
+				return nil, err
+			}
+		} else {
+			_, err := m.importKeysFromBytes(keyring)
+			if err != nil {
+				return nil, err
+			}
 		}
 	}
 	return m, nil
 }
 
-// newEphemeralGPGSigningMechanism returns a new GPG/OpenPGP signing mechanism which
-// recognizes _only_ public keys from the supplied blob, and returns the identities
+// newEphemeralOpenPGPSigningMechanism returns a new GPG/OpenPGP signing mechanism implemented in Go, which
+// recognizes _only_ keys from the supplied blobs, and returns the identities
 // of these keys.
 // The caller must call .Close() on the returned SigningMechanism.
-func newEphemeralGPGSigningMechanism(blobs [][]byte) (signingMechanismWithPassphrase, []string, error) {
+func newEphemeralOpenPGPSigningMechanism(blobs [][]byte) (*openpgpSigningMechanism, []string, error) {
 	m := &openpgpSigningMechanism{
 		keyring: openpgp.EntityList{},
 	}
@@ -83,7 +90,7 @@ func (m *openpgpSigningMechanism) Close() error {
 	return nil
 }
 
-// importKeysFromBytes imports public keys from the supplied blob and returns their identities.
+// importKeysFromBytes imports public (and, if included, private) keys from the supplied blob and returns their identities.
 // The blob is assumed to have an appropriate format (the caller is expected to know which one).
 func (m *openpgpSigningMechanism) importKeysFromBytes(blob []byte) ([]string, error) {
 	keyring, err := openpgp.ReadKeyRing(bytes.NewReader(blob))
@@ -104,21 +111,95 @@ func (m *openpgpSigningMechanism) importKeysFromBytes(blob []byte) ([]string, er
 			continue
 		}
 		// Uppercase the fingerprint to be compatible with gpgme
-		keyIdentities = append(keyIdentities, strings.ToUpper(fmt.Sprintf("%x", entity.PrimaryKey.Fingerprint)))
-		m.keyring = append(m.keyring, entity)
+		keyIdentities = append(keyIdentities, openpgpKeyIdentity(entity.PrimaryKey))
+		// The same key may be imported more than once, e.g. from both pubring.gpg and secring.gpg;
+		// keep a single entity per key, preferring the one with private key material.
+		if i := findOpenPGPEntity(m.keyring, entity); i == -1 {
+			m.keyring = append(m.keyring, entity)
+		} else if m.keyring[i].PrivateKey == nil && entity.PrivateKey != nil {
+			m.keyring[i] = entity
+		}
+		if entity.PrivateKey != nil && findOpenPGPEntity(m.signingKeys, entity) == -1 {
+			m.signingKeys = append(m.signingKeys, entity)
+		}
 	}
 	return keyIdentities, nil
 }
 
+// findOpenPGPEntity returns the index of an entity in list with the same primary key as entity, or -1.
+func findOpenPGPEntity(list openpgp.EntityList, entity *openpgp.Entity) int {
+	return slices.IndexFunc(list, func(e *openpgp.Entity) bool {
+		return e.PrimaryKey.Fingerprint == entity.PrimaryKey.Fingerprint
+	})
+}
+
+// openpgpKeyIdentity returns the key identity of key.
+func openpgpKeyIdentity(key *packet.PublicKey) string {
+	// Uppercase the fingerprint to be compatible with gpgme
+	return strings.ToUpper(fmt.Sprintf("%x", key.Fingerprint))
+}
+
 // SupportsSigning returns nil if the mechanism supports signing, or a SigningNotSupportedError.
 func (m *openpgpSigningMechanism) SupportsSigning() error {
-	return SigningNotSupportedError("signing is not supported in github.com/containers/image built with the containers_image_openpgp build tag")
+	if len(m.signingKeys) == 0 {
+		return SigningNotSupportedError("signing is not supported by the Go OpenPGP mechanism without any private keys")
+	}
+	return nil
 }
 
-// Sign creates a (non-detached) signature of input using keyIdentity.
+// signingEntity returns the entity with a private key for keyIdentity, decrypted using passphrase if necessary.
+func (m *openpgpSigningMechanism) signingEntity(keyIdentity string, passphrase string) (*openpgp.Entity, error) {
+	if err := m.SupportsSigning(); err != nil {
+		return nil, err
+	}
+	var entity *openpgp.Entity
+	for _, e := range m.signingKeys {
+		if openpgpKeyIdentity(e.PrimaryKey) == strings.ToUpper(keyIdentity) {
+			entity = e
+			break
+		}
+	}
+	if entity == nil {
+		return nil, fmt.Errorf("private key %q not found", keyIdentity)
+	}
+	privateKeys := []*packet.PrivateKey{entity.PrivateKey}
+	for _, subkey := range entity.Subkeys {
+		if subkey.PrivateKey != nil {
+			privateKeys = append(privateKeys, subkey.PrivateKey)
+		}
+	}
+	for _, pk := range privateKeys {
+		if pk.Encrypted {
+			if passphrase == "" {
+				return nil, fmt.Errorf("private key %q is encrypted, and no passphrase was provided", keyIdentity)
+			}
+			if err := pk.Decrypt([]byte(passphrase)); err != nil {
+				return nil, fmt.Errorf("decrypting private key %q: %w", keyIdentity, err)
+			}
+		}
+	}
+	return entity, nil
+}
+
+// Sign creates a (non-detached) signature of input using keyIdentity and passphrase.
 // Fails with a SigningNotSupportedError if the mechanism does not support signing.
 func (m *openpgpSigningMechanism) SignWithPassphrase(input []byte, keyIdentity string, passphrase string) ([]byte, error) {
-	return nil, SigningNotSupportedError("signing is not supported in github.com/containers/image built with the containers_image_openpgp build tag")
+	entity, err := m.signingEntity(keyIdentity, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	var sigBuffer bytes.Buffer
+	w, err := openpgp.Sign(&sigBuffer, entity, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(input); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return sigBuffer.Bytes(), nil
 }
 
 // Sign creates a (non-detached) signature of input using keyIdentity.
@@ -127,6 +208,20 @@ func (m *openpgpSigningMechanism) Sign(input []byte, keyIdentity string) ([]byte
 	return m.SignWithPassphrase(input, keyIdentity, "")
 }
 
+// SignDetached creates a detached signature of input using keyIdentity.
+// Fails with a SigningNotSupportedError if the mechanism does not support signing.
+func (m *openpgpSigningMechanism) SignDetached(input []byte, keyIdentity string) ([]byte, error) {
+	entity, err := m.signingEntity(keyIdentity, "")
+	if err != nil {
+		return nil, err
+	}
+	var sigBuffer bytes.Buffer
+	if err := openpgp.DetachSign(&sigBuffer, entity, bytes.NewReader(input), nil); err != nil {
+		return nil, err
+	}
+	return sigBuffer.Bytes(), nil
+}
+
 // Verify parses unverifiedSignature and returns the content and the signer's identity
 func (m *openpgpSigningMechanism) Verify(unverifiedSignature []byte) (contents []byte, keyIdentity string, err error) {
 	md, err := openpgp.ReadMessage(bytes.NewReader(unverifiedSignature), m.keyring, nil, nil)
@@ -165,8 +260,34 @@ func (m *openpgpSigningMechanism) Verify(unverifiedSignature []byte) (contents [
 		return nil, "", internal.NewInvalidSignatureError("Unexpected openpgp.MessageDetails: neither Signature nor SignatureV3 is set")
 	}
 
-	// Uppercase the fingerprint to be compatible with gpgme
-	return content, strings.ToUpper(fmt.Sprintf("%x", md.SignedBy.PublicKey.Fingerprint)), nil
+	return content, openpgpKeyIdentity(md.SignedBy.PublicKey), nil
+}
+
+// VerifyDetached verifies that unverifiedSignature is a detached signature of contents, and returns the signer's identity.
+func (m *openpgpSigningMechanism) VerifyDetached(unverifiedSignature []byte, contents []byte) (keyIdentity string, err error) {
+	signer, err := openpgp.CheckDetachedSignature(m.keyring, bytes.NewReader(contents), bytes.NewReader(unverifiedSignature))
+	if err != nil {
+		return "", err
+	}
+	// openpgp.CheckDetachedSignature does not check signature expiration, so do that separately.
+	packets := packet.NewReader(bytes.NewReader(unverifiedSignature))
+	for {
+		p, err := packets.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// Coverage: openpgp.CheckDetachedSignature has already successfully parsed the packets.
+			return "", err
+		}
+		if sig, ok := p.(*packet.Signature); ok && sig.SigLifetimeSecs != nil {
+			expiry := sig.CreationTime.Add(time.Duration(*sig.SigLifetimeSecs) * time.Second)
+			if time.Now().After(expiry) {
+				return "", internal.NewInvalidSignatureError(fmt.Sprintf("Signature expired on %s", expiry))
+			}
+		}
+	}
+	return openpgpKeyIdentity(signer.PrimaryKey), nil
 }
 
 // UntrustedSignatureContents returns UNTRUSTED contents of the signature WITHOUT ANY VERIFICATION,
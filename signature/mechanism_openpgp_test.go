@@ -1,29 +1,123 @@
-//go:build containers_image_openpgp
-// +build containers_image_openpgp
-
 package signature
 
 import (
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	//lint:ignore SA1019 See mechanism_openpgp.go
+	"golang.org/x/crypto/openpgp" //nolint:staticcheck
 )
 
 func TestOpenpgpSigningMechanismSupportsSigning(t *testing.T) {
-	mech, _, err := NewEphemeralGPGSigningMechanism([]byte{})
+	mech, _, err := NewEphemeralOpenPGPSigningMechanism([]byte{})
 	require.NoError(t, err)
 	defer mech.Close()
 	err = mech.SupportsSigning()
 	assert.Error(t, err)
 	assert.IsType(t, SigningNotSupportedError(""), err)
+
+	secring, err := os.ReadFile("./fixtures/secring.gpg")
+	require.NoError(t, err)
+	mech, keyIdentities, err := NewEphemeralOpenPGPSigningMechanism(secring)
+	require.NoError(t, err)
+	defer mech.Close()
+	assert.Contains(t, keyIdentities, TestKeyFingerprint)
+	err = mech.SupportsSigning()
+	assert.NoError(t, err)
+}
+
+func TestNewOpenPGPSigningMechanismInDirectory(t *testing.T) {
+	// Keys in both pubring.gpg and secring.gpg are imported only once
+	mech, err := newOpenPGPSigningMechanismInDirectory(testGPGHomeDirectory)
+	require.NoError(t, err)
+	defer mech.Close()
+	for _, list := range []openpgp.EntityList{mech.keyring, mech.signingKeys} {
+		fingerprints := map[string]int{}
+		for _, entity := range list {
+			fingerprints[openpgpKeyIdentity(entity.PrimaryKey)]++
+		}
+		assert.Len(t, fingerprints, len(list))
+		assert.Equal(t, 1, fingerprints[TestKeyFingerprint])
+		assert.Equal(t, 1, fingerprints[TestKeyFingerprintWithPassphrase])
+	}
+	for _, entity := range mech.keyring {
+		if openpgpKeyIdentity(entity.PrimaryKey) == TestKeyFingerprint {
+			assert.NotNil(t, entity.PrivateKey)
+		}
+	}
 }
 
 func TestOpenpgpSigningMechanismSign(t *testing.T) {
-	mech, _, err := NewEphemeralGPGSigningMechanism([]byte{})
+	mech, _, err := NewEphemeralOpenPGPSigningMechanism([]byte{})
 	require.NoError(t, err)
 	defer mech.Close()
 	_, err = mech.Sign([]byte{}, TestKeyFingerprint)
 	assert.Error(t, err)
 	assert.IsType(t, SigningNotSupportedError(""), err)
+
+	dirMech, err := newOpenPGPSigningMechanismInDirectory(testGPGHomeDirectory)
+	require.NoError(t, err)
+	defer dirMech.Close()
+
+	// Successful signing
+	content := []byte("content")
+	signature, err := dirMech.Sign(content, TestKeyFingerprint)
+	require.NoError(t, err)
+	signedContent, signingFingerprint, err := dirMech.Verify(signature)
+	require.NoError(t, err)
+	assert.Equal(t, content, signedContent)
+	assert.Equal(t, TestKeyFingerprint, signingFingerprint)
+
+	// Successful signing with a passphrase
+	signature, err = dirMech.SignWithPassphrase(content, TestKeyFingerprintWithPassphrase, TestPassphrase)
+	require.NoError(t, err)
+	signedContent, signingFingerprint, err = dirMech.Verify(signature)
+	require.NoError(t, err)
+	assert.Equal(t, content, signedContent)
+	assert.Equal(t, TestKeyFingerprintWithPassphrase, signingFingerprint)
+
+	// Unknown key
+	_, err = dirMech.Sign(content, "this fingerprint doesn't exist")
+	assert.Error(t, err)
+	// A public key only
+	_, err = dirMech.Sign(content, TestOtherFingerprint1)
+	assert.Error(t, err)
+}
+
+func TestOpenpgpSigningMechanismDetached(t *testing.T) {
+	mech, err := newOpenPGPSigningMechanismInDirectory(testGPGHomeDirectory)
+	require.NoError(t, err)
+	defer mech.Close()
+
+	content := []byte("content")
+	signature, err := mech.SignDetached(content, TestKeyFingerprint)
+	require.NoError(t, err)
+	signingFingerprint, err := mech.VerifyDetached(signature, content)
+	require.NoError(t, err)
+	assert.Equal(t, TestKeyFingerprint, signingFingerprint)
+
+	// Modified contents
+	_, err = mech.VerifyDetached(signature, []byte("modified content"))
+	assert.Error(t, err)
+	// A non-detached signature
+	signature, err = mech.Sign(content, TestKeyFingerprint)
+	require.NoError(t, err)
+	_, err = mech.VerifyDetached(signature, content)
+	assert.Error(t, err)
+	// Invalid signature
+	_, err = mech.VerifyDetached([]byte("invalid signature"), content)
+	assert.Error(t, err)
+
+	// Unknown key
+	empty, _, err := NewEphemeralOpenPGPSigningMechanism([]byte{})
+	require.NoError(t, err)
+	defer empty.Close()
+	signature, err = mech.SignDetached(content, TestKeyFingerprint)
+	require.NoError(t, err)
+	_, err = empty.VerifyDetached(signature, content)
+	assert.Error(t, err)
+	_, err = empty.SignDetached(content, TestKeyFingerprint)
+	assert.Error(t, err)
 }
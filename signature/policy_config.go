@@ -19,12 +19,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/signature/internal"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage/pkg/homedir"
+	"github.com/containers/storage/pkg/ioutils"
 	"github.com/containers/storage/pkg/regexp"
 )
 
@@ -97,6 +99,134 @@ func NewPolicyFromBytes(data []byte) (*Policy, error) {
 	return &p, nil
 }
 
+// NewPolicy returns a policy with the specified default requirements, and no transport-specific scopes;
+// use SetScopeRequirements to add them.
+func NewPolicy(defaultRequirements PolicyRequirements) (*Policy, error) {
+	if err := validatePolicyRequirements(defaultRequirements); err != nil {
+		return nil, err
+	}
+	return &Policy{
+		Default:    defaultRequirements,
+		Transports: map[string]PolicyTransportScopes{},
+	}, nil
+}
+
+// SetScopeRequirements sets the requirements for scope within transportName, replacing any existing requirements
+// for that scope. Use scope "" to set the default requirements for the transport.
+func (p *Policy) SetScopeRequirements(transportName, scope string, requirements PolicyRequirements) error {
+	if transportName == "" {
+		return InvalidPolicyFormatError("transport name must not be empty")
+	}
+	if err := validatePolicyScope(transports.Get(transportName), scope); err != nil {
+		return err
+	}
+	if err := validatePolicyRequirements(requirements); err != nil {
+		return err
+	}
+	if p.Transports == nil {
+		p.Transports = map[string]PolicyTransportScopes{}
+	}
+	if p.Transports[transportName] == nil {
+		p.Transports[transportName] = PolicyTransportScopes{}
+	}
+	p.Transports[transportName][scope] = requirements
+	return nil
+}
+
+// RemoveScope removes the requirements for scope within transportName, if any.
+func (p *Policy) RemoveScope(transportName, scope string) {
+	scopes, ok := p.Transports[transportName]
+	if !ok {
+		return
+	}
+	delete(scopes, scope)
+	if len(scopes) == 0 {
+		delete(p.Transports, transportName)
+	}
+}
+
+// Validate returns an error if p is not a valid policy, i.e. if it could not be parsed from its policy.json representation.
+func (p *Policy) Validate() error {
+	if err := validatePolicyRequirements(p.Default); err != nil {
+		return fmt.Errorf("default policy: %w", err)
+	}
+	for transportName, scopes := range p.Transports {
+		if transportName == "" {
+			return InvalidPolicyFormatError("transport name must not be empty")
+		}
+		transport := transports.Get(transportName)
+		for scope, requirements := range scopes {
+			if err := validatePolicyScope(transport, scope); err != nil {
+				return fmt.Errorf("transport %q: %w", transportName, err)
+			}
+			if err := validatePolicyRequirements(requirements); err != nil {
+				return fmt.Errorf("transport %q, scope %q: %w", transportName, scope, err)
+			}
+		}
+	}
+	return nil
+}
+
+// ToBytes returns p in the policy.json format, after validating it.
+// Use this function instead of calling json.Marshal directly.
+func (p *Policy) ToBytes() ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	tmp := *p
+	if tmp.Transports == nil {
+		tmp.Transports = map[string]PolicyTransportScopes{}
+	}
+	res, err := json.MarshalIndent(tmp, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	res = append(res, '\n')
+	// Ensure that the policy round-trips; refuse to produce something we would not be able to read back.
+	if _, err := NewPolicyFromBytes(res); err != nil {
+		return nil, fmt.Errorf("Internal error: generated policy is not valid: %w", err)
+	}
+	return res, nil
+}
+
+// WriteToFile validates p, and atomically writes it to fileName in the policy.json format.
+func (p *Policy) WriteToFile(fileName string) error {
+	contents, err := p.ToBytes()
+	if err != nil {
+		return err
+	}
+	return ioutils.AtomicWriteFile(fileName, contents, 0o644)
+}
+
+// validatePolicyScope returns an error if scope is not valid for transport, which may be nil if the transport is not known.
+func validatePolicyScope(transport types.ImageTransport, scope string) error {
+	if isPolicyScopePattern(scope) {
+		if _, err := compilePolicyScopePattern(scope); err != nil {
+			return InvalidPolicyFormatError(err.Error())
+		}
+		return nil
+	}
+	if scope != "" && transport != nil {
+		if err := transport.ValidatePolicyConfigurationScope(scope); err != nil {
+			return InvalidPolicyFormatError(fmt.Sprintf("invalid scope %q: %v", scope, err))
+		}
+	}
+	return nil
+}
+
+// validatePolicyRequirements returns an error if requirements is not a valid list of requirements.
+func validatePolicyRequirements(requirements PolicyRequirements) error {
+	if len(requirements) == 0 {
+		return InvalidPolicyFormatError("List of verification policy requirements must not be empty")
+	}
+	for i, req := range requirements {
+		if req == nil {
+			return InvalidPolicyFormatError(fmt.Sprintf("policy requirement %d is nil", i+1))
+		}
+	}
+	return nil
+}
+
 // Compile-time check that Policy implements json.Unmarshaler.
 var _ json.Unmarshaler = (*Policy)(nil)
 
@@ -186,10 +316,8 @@ func (m *policyTransportScopesWithTransport) UnmarshalJSON(data []byte) error {
 		if _, ok := tmpMap[key]; ok {
 			return nil
 		}
-		if key != "" && m.transport != nil {
-			if err := m.transport.ValidatePolicyConfigurationScope(key); err != nil {
-				return nil
-			}
+		if err := validatePolicyScope(m.transport, key); err != nil {
+			return nil
 		}
 		ptr := &PolicyRequirements{} // This allocates a new instance on each call.
 		tmpMap[key] = ptr
@@ -245,6 +373,14 @@ func newPolicyRequirementFromJSON(data []byte) (PolicyRequirement, error) {
 		res = &prSignedBaseLayer{}
 	case prTypeSigstoreSigned:
 		res = &prSigstoreSigned{}
+	case prTypeDigestList:
+		res = &prDigestList{}
+	case prTypeMaxImageAge:
+		res = &prMaxImageAge{}
+	case prTypeSLSAProvenance:
+		res = &prSLSAProvenance{}
+	case prTypeSignedByThreshold:
+		res = &prSignedByThreshold{}
 	default:
 		return nil, InvalidPolicyFormatError(fmt.Sprintf("Unknown policy requirement type \"%s\"", typeField.Type))
 	}
@@ -314,8 +450,75 @@ func (pr *prReject) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// PRSignedByOption is a way to pass optional values to NewPRSignedByKeyPath and similar functions.
+type PRSignedByOption func(*prSignedBy) error
+
+// PRSignedByWithMaxSignatureAge specifies the maximum age of accepted signatures.
+// Signatures without a signing timestamp are rejected if this is used.
+func PRSignedByWithMaxSignatureAge(maxAge time.Duration) PRSignedByOption {
+	return func(pr *prSignedBy) error {
+		if pr.MaxSignatureAge != "" {
+			return InvalidPolicyFormatError("maxSignatureAge already specified")
+		}
+		if maxAge <= 0 {
+			return InvalidPolicyFormatError(fmt.Sprintf("invalid maxSignatureAge %s: must be positive", maxAge))
+		}
+		pr.MaxSignatureAge = maxAge.String()
+		return nil
+	}
+}
+
+// PRSignedByWithRevokedKeyFingerprints specifies fingerprints of revoked keys; signatures by these keys are rejected.
+func PRSignedByWithRevokedKeyFingerprints(fingerprints []string) PRSignedByOption {
+	return func(pr *prSignedBy) error {
+		if pr.RevokedKeyFingerprints != nil {
+			return InvalidPolicyFormatError("revokedKeyFingerprints already specified")
+		}
+		pr.RevokedKeyFingerprints = fingerprints
+		return nil
+	}
+}
+
+// PRSignedByWithRevokedKeyFingerprintsPath specifies a path to a file listing fingerprints of revoked keys, one per line.
+func PRSignedByWithRevokedKeyFingerprintsPath(path string) PRSignedByOption {
+	return func(pr *prSignedBy) error {
+		if pr.RevokedKeyFingerprintsPath != "" {
+			return InvalidPolicyFormatError("revokedKeyFingerprintsPath already specified")
+		}
+		pr.RevokedKeyFingerprintsPath = path
+		return nil
+	}
+}
+
+// PRSignedByWithRevocationFailureMode specifies what happens when the file specified by PRSignedByWithRevokedKeyFingerprintsPath
+// can’t be read.
+func PRSignedByWithRevocationFailureMode(mode revocationFailureMode) PRSignedByOption {
+	return func(pr *prSignedBy) error {
+		if pr.RevocationFailureMode != "" {
+			return InvalidPolicyFormatError("revocationFailureMode already specified")
+		}
+		if !mode.IsValid() {
+			return InvalidPolicyFormatError(fmt.Sprintf("invalid revocationFailureMode %q", mode))
+		}
+		pr.RevocationFailureMode = mode
+		return nil
+	}
+}
+
+// parsePolicyDuration parses value of a duration field named fieldName, e.g. prSignedBy.MaxSignatureAge.
+func parsePolicyDuration(fieldName, value string) (time.Duration, error) {
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, InvalidPolicyFormatError(fmt.Sprintf("invalid %s %q: %v", fieldName, value, err))
+	}
+	if d <= 0 {
+		return 0, InvalidPolicyFormatError(fmt.Sprintf("invalid %s %q: must be positive", fieldName, value))
+	}
+	return d, nil
+}
+
 // newPRSignedBy returns a new prSignedBy if parameters are valid.
-func newPRSignedBy(keyType sbKeyType, keyPath string, keyPaths []string, keyData []byte, signedIdentity PolicyReferenceMatch) (*prSignedBy, error) {
+func newPRSignedBy(keyType sbKeyType, keyPath string, keyPaths []string, keyData []byte, signedIdentity PolicyReferenceMatch, options ...PRSignedByOption) (*prSignedBy, error) {
 	if !keyType.IsValid() {
 		return nil, InvalidPolicyFormatError(fmt.Sprintf("invalid keyType \"%s\"", keyType))
 	}
@@ -335,44 +538,53 @@ func newPRSignedBy(keyType sbKeyType, keyPath string, keyPaths []string, keyData
 	if signedIdentity == nil {
 		return nil, InvalidPolicyFormatError("signedIdentity not specified")
 	}
-	return &prSignedBy{
+	res := &prSignedBy{
 		prCommon:       prCommon{Type: prTypeSignedBy},
 		KeyType:        keyType,
 		KeyPath:        keyPath,
 		KeyPaths:       keyPaths,
 		KeyData:        keyData,
 		SignedIdentity: signedIdentity,
-	}, nil
+	}
+	for _, o := range options {
+		if err := o(res); err != nil {
+			return nil, err
+		}
+	}
+	if res.RevocationFailureMode != "" && res.RevokedKeyFingerprintsPath == "" {
+		return nil, InvalidPolicyFormatError("revocationFailureMode requires revokedKeyFingerprintsPath")
+	}
+	return res, nil
 }
 
 // newPRSignedByKeyPath is NewPRSignedByKeyPath, except it returns the private type.
-func newPRSignedByKeyPath(keyType sbKeyType, keyPath string, signedIdentity PolicyReferenceMatch) (*prSignedBy, error) {
-	return newPRSignedBy(keyType, keyPath, nil, nil, signedIdentity)
+func newPRSignedByKeyPath(keyType sbKeyType, keyPath string, signedIdentity PolicyReferenceMatch, options ...PRSignedByOption) (*prSignedBy, error) {
+	return newPRSignedBy(keyType, keyPath, nil, nil, signedIdentity, options...)
 }
 
 // NewPRSignedByKeyPath returns a new "signedBy" PolicyRequirement using a KeyPath
-func NewPRSignedByKeyPath(keyType sbKeyType, keyPath string, signedIdentity PolicyReferenceMatch) (PolicyRequirement, error) {
-	return newPRSignedByKeyPath(keyType, keyPath, signedIdentity)
+func NewPRSignedByKeyPath(keyType sbKeyType, keyPath string, signedIdentity PolicyReferenceMatch, options ...PRSignedByOption) (PolicyRequirement, error) {
+	return newPRSignedByKeyPath(keyType, keyPath, signedIdentity, options...)
 }
 
 // newPRSignedByKeyPaths is NewPRSignedByKeyPaths, except it returns the private type.
-func newPRSignedByKeyPaths(keyType sbKeyType, keyPaths []string, signedIdentity PolicyReferenceMatch) (*prSignedBy, error) {
-	return newPRSignedBy(keyType, "", keyPaths, nil, signedIdentity)
+func newPRSignedByKeyPaths(keyType sbKeyType, keyPaths []string, signedIdentity PolicyReferenceMatch, options ...PRSignedByOption) (*prSignedBy, error) {
+	return newPRSignedBy(keyType, "", keyPaths, nil, signedIdentity, options...)
 }
 
 // NewPRSignedByKeyPaths returns a new "signedBy" PolicyRequirement using KeyPaths
-func NewPRSignedByKeyPaths(keyType sbKeyType, keyPaths []string, signedIdentity PolicyReferenceMatch) (PolicyRequirement, error) {
-	return newPRSignedByKeyPaths(keyType, keyPaths, signedIdentity)
+func NewPRSignedByKeyPaths(keyType sbKeyType, keyPaths []string, signedIdentity PolicyReferenceMatch, options ...PRSignedByOption) (PolicyRequirement, error) {
+	return newPRSignedByKeyPaths(keyType, keyPaths, signedIdentity, options...)
 }
 
 // newPRSignedByKeyData is NewPRSignedByKeyData, except it returns the private type.
-func newPRSignedByKeyData(keyType sbKeyType, keyData []byte, signedIdentity PolicyReferenceMatch) (*prSignedBy, error) {
-	return newPRSignedBy(keyType, "", nil, keyData, signedIdentity)
+func newPRSignedByKeyData(keyType sbKeyType, keyData []byte, signedIdentity PolicyReferenceMatch, options ...PRSignedByOption) (*prSignedBy, error) {
+	return newPRSignedBy(keyType, "", nil, keyData, signedIdentity, options...)
 }
 
 // NewPRSignedByKeyData returns a new "signedBy" PolicyRequirement using a KeyData
-func NewPRSignedByKeyData(keyType sbKeyType, keyData []byte, signedIdentity PolicyReferenceMatch) (PolicyRequirement, error) {
-	return newPRSignedByKeyData(keyType, keyData, signedIdentity)
+func NewPRSignedByKeyData(keyType sbKeyType, keyData []byte, signedIdentity PolicyReferenceMatch, options ...PRSignedByOption) (PolicyRequirement, error) {
+	return newPRSignedByKeyData(keyType, keyData, signedIdentity, options...)
 }
 
 // Compile-time check that prSignedBy implements json.Unmarshaler.
@@ -384,6 +596,9 @@ func (pr *prSignedBy) UnmarshalJSON(data []byte) error {
 	var tmp prSignedBy
 	var gotKeyPath, gotKeyPaths, gotKeyData = false, false, false
 	var signedIdentity json.RawMessage
+	var maxSignatureAge string
+	var gotMaxSignatureAge = false
+	var gotRevokedKeyFingerprints, gotRevokedKeyFingerprintsPath, gotRevocationFailureMode = false, false, false
 	if err := internal.ParanoidUnmarshalJSONObject(data, func(key string) any {
 		switch key {
 		case "type":
@@ -401,6 +616,18 @@ func (pr *prSignedBy) UnmarshalJSON(data []byte) error {
 			return &tmp.KeyData
 		case "signedIdentity":
 			return &signedIdentity
+		case "maxSignatureAge":
+			gotMaxSignatureAge = true
+			return &maxSignatureAge
+		case "revokedKeyFingerprints":
+			gotRevokedKeyFingerprints = true
+			return &tmp.RevokedKeyFingerprints
+		case "revokedKeyFingerprintsPath":
+			gotRevokedKeyFingerprintsPath = true
+			return &tmp.RevokedKeyFingerprintsPath
+		case "revocationFailureMode":
+			gotRevocationFailureMode = true
+			return &tmp.RevocationFailureMode
 		default:
 			return nil
 		}
@@ -421,15 +648,33 @@ func (pr *prSignedBy) UnmarshalJSON(data []byte) error {
 		tmp.SignedIdentity = si
 	}
 
+	var options []PRSignedByOption
+	if gotMaxSignatureAge {
+		maxAge, err := parsePolicyDuration("maxSignatureAge", maxSignatureAge)
+		if err != nil {
+			return err
+		}
+		options = append(options, PRSignedByWithMaxSignatureAge(maxAge))
+	}
+	if gotRevokedKeyFingerprints {
+		options = append(options, PRSignedByWithRevokedKeyFingerprints(tmp.RevokedKeyFingerprints))
+	}
+	if gotRevokedKeyFingerprintsPath {
+		options = append(options, PRSignedByWithRevokedKeyFingerprintsPath(tmp.RevokedKeyFingerprintsPath))
+	}
+	if gotRevocationFailureMode {
+		options = append(options, PRSignedByWithRevocationFailureMode(tmp.RevocationFailureMode))
+	}
+
 	var res *prSignedBy
 	var err error
 	switch {
 	case gotKeyPath && !gotKeyPaths && !gotKeyData:
-		res, err = newPRSignedByKeyPath(tmp.KeyType, tmp.KeyPath, tmp.SignedIdentity)
+		res, err = newPRSignedByKeyPath(tmp.KeyType, tmp.KeyPath, tmp.SignedIdentity, options...)
 	case !gotKeyPath && gotKeyPaths && !gotKeyData:
-		res, err = newPRSignedByKeyPaths(tmp.KeyType, tmp.KeyPaths, tmp.SignedIdentity)
+		res, err = newPRSignedByKeyPaths(tmp.KeyType, tmp.KeyPaths, tmp.SignedIdentity, options...)
 	case !gotKeyPath && !gotKeyPaths && gotKeyData:
-		res, err = newPRSignedByKeyData(tmp.KeyType, tmp.KeyData, tmp.SignedIdentity)
+		res, err = newPRSignedByKeyData(tmp.KeyType, tmp.KeyData, tmp.SignedIdentity, options...)
 	case !gotKeyPath && !gotKeyPaths && !gotKeyData:
 		return InvalidPolicyFormatError("Exactly one of keyPath, keyPaths and keyData must be specified, none of them present")
 	default:
@@ -471,6 +716,33 @@ func (kt *sbKeyType) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// IsValid returns true iff m is a recognized value
+func (m revocationFailureMode) IsValid() bool {
+	switch m {
+	case RevocationFailureModeHardFail, RevocationFailureModeSoftFail:
+		return true
+	default:
+		return false
+	}
+}
+
+// Compile-time check that revocationFailureMode implements json.Unmarshaler.
+var _ json.Unmarshaler = (*revocationFailureMode)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (m *revocationFailureMode) UnmarshalJSON(data []byte) error {
+	*m = revocationFailureMode("")
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if !revocationFailureMode(s).IsValid() {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unrecognized revocationFailureMode value \"%s\"", s))
+	}
+	*m = revocationFailureMode(s)
+	return nil
+}
+
 // newPRSignedBaseLayer is NewPRSignedBaseLayer, except it returns the private type.
 func newPRSignedBaseLayer(baseLayerIdentity PolicyReferenceMatch) (*prSignedBaseLayer, error) {
 	if baseLayerIdentity == nil {
@@ -0,0 +1,175 @@
+package signature
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/containers/image/v5/signature/internal"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// PRDigestListOption is a way to pass values to NewPRDigestList
+type PRDigestListOption func(*prDigestList) error
+
+// PRDigestListWithDigests specifies a value for the "digests" field when calling NewPRDigestList.
+func PRDigestListWithDigests(digests []digest.Digest) PRDigestListOption {
+	return func(pr *prDigestList) error {
+		if pr.Digests != nil {
+			return errors.New(`"digests" already specified`)
+		}
+		pr.Digests = digests
+		return nil
+	}
+}
+
+// PRDigestListWithDigestsPath specifies a value for the "digestsPath" field when calling NewPRDigestList.
+func PRDigestListWithDigestsPath(digestsPath string) PRDigestListOption {
+	return func(pr *prDigestList) error {
+		if pr.DigestsPath != "" {
+			return errors.New(`"digestsPath" already specified`)
+		}
+		pr.DigestsPath = digestsPath
+		return nil
+	}
+}
+
+// PRDigestListWithDigestsURL specifies a value for the "digestsURL" field when calling NewPRDigestList.
+func PRDigestListWithDigestsURL(digestsURL string) PRDigestListOption {
+	return func(pr *prDigestList) error {
+		if pr.DigestsURL != "" {
+			return errors.New(`"digestsURL" already specified`)
+		}
+		pr.DigestsURL = digestsURL
+		return nil
+	}
+}
+
+// newPRDigestList is NewPRDigestList, except it returns the private type.
+func newPRDigestList(mode dlMode, options ...PRDigestListOption) (*prDigestList, error) {
+	if !mode.IsValid() {
+		return nil, InvalidPolicyFormatError(fmt.Sprintf("invalid mode \"%s\"", mode))
+	}
+	res := prDigestList{
+		prCommon: prCommon{Type: prTypeDigestList},
+		Mode:     mode,
+	}
+	for _, o := range options {
+		if err := o(&res); err != nil {
+			return nil, err
+		}
+	}
+
+	if res.Digests == nil && res.DigestsPath == "" && res.DigestsURL == "" {
+		return nil, InvalidPolicyFormatError("at least one of digests, digestsPath and digestsURL must be specified")
+	}
+	for _, d := range res.Digests {
+		if err := d.Validate(); err != nil {
+			return nil, InvalidPolicyFormatError(fmt.Sprintf("invalid digest %q: %v", d, err))
+		}
+	}
+	if res.DigestsURL != "" {
+		u, err := url.Parse(res.DigestsURL)
+		if err != nil {
+			return nil, InvalidPolicyFormatError(fmt.Sprintf("invalid digestsURL %q: %v", res.DigestsURL, err))
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, InvalidPolicyFormatError(fmt.Sprintf("invalid digestsURL %q: only http:// and https:// URLs are supported", res.DigestsURL))
+		}
+	}
+	return &res, nil
+}
+
+// NewPRDigestList returns a new "digestList" PolicyRequirement based on mode and options.
+func NewPRDigestList(mode dlMode, options ...PRDigestListOption) (PolicyRequirement, error) {
+	return newPRDigestList(mode, options...)
+}
+
+// Compile-time check that prDigestList implements json.Unmarshaler.
+var _ json.Unmarshaler = (*prDigestList)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pr *prDigestList) UnmarshalJSON(data []byte) error {
+	*pr = prDigestList{}
+	var tmp prDigestList
+	var gotDigests, gotDigestsPath, gotDigestsURL bool
+	if err := internal.ParanoidUnmarshalJSONObject(data, func(key string) any {
+		switch key {
+		case "type":
+			return &tmp.Type
+		case "mode":
+			return &tmp.Mode
+		case "digests":
+			gotDigests = true
+			return &tmp.Digests
+		case "digestsPath":
+			gotDigestsPath = true
+			return &tmp.DigestsPath
+		case "digestsURL":
+			gotDigestsURL = true
+			return &tmp.DigestsURL
+		default:
+			return nil
+		}
+	}); err != nil {
+		return err
+	}
+
+	if tmp.Type != prTypeDigestList {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unexpected policy requirement type \"%s\"", tmp.Type))
+	}
+
+	var opts []PRDigestListOption
+	if gotDigests {
+		if tmp.Digests == nil { // An explicit null
+			return InvalidPolicyFormatError("digests must be an array")
+		}
+		opts = append(opts, PRDigestListWithDigests(tmp.Digests))
+	}
+	if gotDigestsPath {
+		if tmp.DigestsPath == "" {
+			return InvalidPolicyFormatError("digestsPath must not be empty")
+		}
+		opts = append(opts, PRDigestListWithDigestsPath(tmp.DigestsPath))
+	}
+	if gotDigestsURL {
+		if tmp.DigestsURL == "" {
+			return InvalidPolicyFormatError("digestsURL must not be empty")
+		}
+		opts = append(opts, PRDigestListWithDigestsURL(tmp.DigestsURL))
+	}
+	res, err := newPRDigestList(tmp.Mode, opts...)
+	if err != nil {
+		return err
+	}
+	*pr = *res
+	return nil
+}
+
+// IsValid returns true iff m is a recognized value
+func (m dlMode) IsValid() bool {
+	switch m {
+	case DLModeAllow, DLModeDeny:
+		return true
+	default:
+		return false
+	}
+}
+
+// Compile-time check that dlMode implements json.Unmarshaler.
+var _ json.Unmarshaler = (*dlMode)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (m *dlMode) UnmarshalJSON(data []byte) error {
+	*m = dlMode("")
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if !dlMode(s).IsValid() {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unrecognized mode value \"%s\"", s))
+	}
+	*m = dlMode(s)
+	return nil
+}
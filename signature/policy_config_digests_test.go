@@ -0,0 +1,199 @@
+package signature
+
+import (
+	"encoding/json"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testDigestListDigest = digest.Digest("sha256:0000000000000000000000000000000000000000000000000000000000000000")
+
+// xNewPRDigestList is like NewPRDigestList, except it must not fail.
+func xNewPRDigestList(mode dlMode, options ...PRDigestListOption) PolicyRequirement {
+	pr, err := NewPRDigestList(mode, options...)
+	if err != nil {
+		panic("xNewPRDigestList failed")
+	}
+	return pr
+}
+
+func TestNewPRDigestList(t *testing.T) {
+	const testPath = "/foo/bar"
+	const testURL = "https://example.com/digests"
+	testDigests := []digest.Digest{testDigestListDigest}
+
+	// Success
+	for _, c := range []struct {
+		mode     dlMode
+		options  []PRDigestListOption
+		expected prDigestList
+	}{
+		{
+			mode:    DLModeAllow,
+			options: []PRDigestListOption{PRDigestListWithDigests(testDigests)},
+			expected: prDigestList{
+				prCommon: prCommon{prTypeDigestList},
+				Mode:     DLModeAllow,
+				Digests:  testDigests,
+			},
+		},
+		{
+			mode:    DLModeDeny,
+			options: []PRDigestListOption{PRDigestListWithDigests([]digest.Digest{})},
+			expected: prDigestList{
+				prCommon: prCommon{prTypeDigestList},
+				Mode:     DLModeDeny,
+				Digests:  []digest.Digest{},
+			},
+		},
+		{
+			mode: DLModeDeny,
+			options: []PRDigestListOption{
+				PRDigestListWithDigests(testDigests),
+				PRDigestListWithDigestsPath(testPath),
+				PRDigestListWithDigestsURL(testURL),
+			},
+			expected: prDigestList{
+				prCommon:    prCommon{prTypeDigestList},
+				Mode:        DLModeDeny,
+				Digests:     testDigests,
+				DigestsPath: testPath,
+				DigestsURL:  testURL,
+			},
+		},
+	} {
+		pr, err := newPRDigestList(c.mode, c.options...)
+		require.NoError(t, err)
+		assert.Equal(t, &c.expected, pr)
+	}
+
+	// Failure cases
+	for _, c := range []struct {
+		mode    dlMode
+		options []PRDigestListOption
+	}{
+		{ // Invalid mode
+			mode:    dlMode(""),
+			options: []PRDigestListOption{PRDigestListWithDigests(testDigests)},
+		},
+		{ // Invalid mode
+			mode:    dlMode("this is invalid"),
+			options: []PRDigestListOption{PRDigestListWithDigests(testDigests)},
+		},
+		{ // No digest source
+			mode: DLModeAllow,
+		},
+		{ // Invalid digest
+			mode:    DLModeAllow,
+			options: []PRDigestListOption{PRDigestListWithDigests([]digest.Digest{"this is invalid"})},
+		},
+		{ // Unsupported URL scheme
+			mode:    DLModeAllow,
+			options: []PRDigestListOption{PRDigestListWithDigestsURL("file:///etc/digests")},
+		},
+		{ // Invalid URL
+			mode:    DLModeAllow,
+			options: []PRDigestListOption{PRDigestListWithDigestsURL("https://[this is invalid")},
+		},
+		{ // Duplicate options
+			mode:    DLModeAllow,
+			options: []PRDigestListOption{PRDigestListWithDigests(testDigests), PRDigestListWithDigests(testDigests)},
+		},
+		{
+			mode:    DLModeAllow,
+			options: []PRDigestListOption{PRDigestListWithDigestsPath(testPath), PRDigestListWithDigestsPath(testPath)},
+		},
+		{
+			mode:    DLModeAllow,
+			options: []PRDigestListOption{PRDigestListWithDigestsURL(testURL), PRDigestListWithDigestsURL(testURL)},
+		},
+	} {
+		_, err := newPRDigestList(c.mode, c.options...)
+		assert.Error(t, err)
+	}
+}
+
+func TestPRDigestListUnmarshalJSON(t *testing.T) {
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prDigestList{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRDigestList(DLModeDeny, PRDigestListWithDigests([]digest.Digest{testDigestListDigest}))
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		breakFns: []func(mSA){
+			// The "type" field is missing
+			func(v mSA) { delete(v, "type") },
+			// Wrong "type" field
+			func(v mSA) { v["type"] = 1 },
+			func(v mSA) { v["type"] = "this is invalid" },
+			// Extra top-level sub-object
+			func(v mSA) { v["unexpected"] = 1 },
+			// The "mode" field is missing
+			func(v mSA) { delete(v, "mode") },
+			// Invalid "mode" field
+			func(v mSA) { v["mode"] = 1 },
+			func(v mSA) { v["mode"] = "this is invalid" },
+			// All of "digests", "digestsPath" and "digestsURL" are missing
+			func(v mSA) { delete(v, "digests") },
+			// Invalid "digests" field
+			func(v mSA) { v["digests"] = 1 },
+			func(v mSA) { v["digests"] = nil },
+			func(v mSA) { v["digests"] = []string{"this is invalid"} },
+			// Invalid "digestsPath" field
+			func(v mSA) { v["digestsPath"] = 1 },
+			func(v mSA) { v["digestsPath"] = "" },
+			// Invalid "digestsURL" field
+			func(v mSA) { v["digestsURL"] = 1 },
+			func(v mSA) { v["digestsURL"] = "" },
+			func(v mSA) { v["digestsURL"] = "file:///etc/digests" },
+		},
+		duplicateFields: []string{"type", "mode", "digests"},
+	}.run(t)
+	// Test the digestsPath- and digestsURL-specific aspects
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prDigestList{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRDigestList(DLModeAllow,
+				PRDigestListWithDigestsPath("/foo/bar"),
+				PRDigestListWithDigestsURL("https://example.com/digests"))
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		duplicateFields: []string{"type", "mode", "digestsPath", "digestsURL"},
+	}.run(t)
+}
+
+func TestDLModeIsValid(t *testing.T) {
+	// Valid values
+	for _, m := range []dlMode{DLModeAllow, DLModeDeny} {
+		assert.True(t, m.IsValid())
+	}
+
+	// Invalid values
+	for _, s := range []string{"", "this is invalid"} {
+		assert.False(t, dlMode(s).IsValid())
+	}
+}
+
+func TestDLModeUnmarshalJSON(t *testing.T) {
+	var m dlMode
+
+	testInvalidJSONInput(t, &m)
+
+	// Valid values.
+	for _, v := range []dlMode{DLModeAllow, DLModeDeny} {
+		m = dlMode("")
+		err := json.Unmarshal([]byte(`"`+string(v)+`"`), &m)
+		assert.NoError(t, err)
+		assert.Equal(t, v, m)
+	}
+
+	// Invalid values
+	for _, v := range []string{`""`, `"this is invalid"`} {
+		m = dlMode("")
+		err := json.Unmarshal([]byte(v), &m)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,96 @@
+package signature
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/containers/image/v5/signature/internal"
+)
+
+// PRMaxImageAgeOption is a way to pass optional values to NewPRMaxImageAge
+type PRMaxImageAgeOption func(*prMaxImageAge) error
+
+// PRMaxImageAgeWithCreatedAnnotation specifies a value for the "createdAnnotation" field when calling NewPRMaxImageAge.
+func PRMaxImageAgeWithCreatedAnnotation(annotation string) PRMaxImageAgeOption {
+	return func(pr *prMaxImageAge) error {
+		if pr.CreatedAnnotation != "" {
+			return errors.New(`"createdAnnotation" already specified`)
+		}
+		if annotation == "" {
+			return InvalidPolicyFormatError("createdAnnotation must not be empty")
+		}
+		pr.CreatedAnnotation = annotation
+		return nil
+	}
+}
+
+// newPRMaxImageAge is NewPRMaxImageAge, except it returns the private type.
+func newPRMaxImageAge(maxAge time.Duration, options ...PRMaxImageAgeOption) (*prMaxImageAge, error) {
+	if maxAge <= 0 {
+		return nil, InvalidPolicyFormatError(fmt.Sprintf("invalid maxAge %s: must be positive", maxAge))
+	}
+	res := prMaxImageAge{
+		prCommon: prCommon{Type: prTypeMaxImageAge},
+		MaxAge:   maxAge.String(),
+	}
+	for _, o := range options {
+		if err := o(&res); err != nil {
+			return nil, err
+		}
+	}
+	return &res, nil
+}
+
+// NewPRMaxImageAge returns a new "maxImageAge" PolicyRequirement, accepting images created at most maxAge ago.
+func NewPRMaxImageAge(maxAge time.Duration, options ...PRMaxImageAgeOption) (PolicyRequirement, error) {
+	return newPRMaxImageAge(maxAge, options...)
+}
+
+// Compile-time check that prMaxImageAge implements json.Unmarshaler.
+var _ json.Unmarshaler = (*prMaxImageAge)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pr *prMaxImageAge) UnmarshalJSON(data []byte) error {
+	*pr = prMaxImageAge{}
+	var tmp prMaxImageAge
+	var gotMaxAge, gotCreatedAnnotation bool
+	if err := internal.ParanoidUnmarshalJSONObject(data, func(key string) any {
+		switch key {
+		case "type":
+			return &tmp.Type
+		case "maxAge":
+			gotMaxAge = true
+			return &tmp.MaxAge
+		case "createdAnnotation":
+			gotCreatedAnnotation = true
+			return &tmp.CreatedAnnotation
+		default:
+			return nil
+		}
+	}); err != nil {
+		return err
+	}
+
+	if tmp.Type != prTypeMaxImageAge {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unexpected policy requirement type \"%s\"", tmp.Type))
+	}
+	if !gotMaxAge {
+		return InvalidPolicyFormatError("maxAge not specified")
+	}
+	maxAge, err := parsePolicyDuration("maxAge", tmp.MaxAge)
+	if err != nil {
+		return err
+	}
+	var opts []PRMaxImageAgeOption
+	if gotCreatedAnnotation {
+		opts = append(opts, PRMaxImageAgeWithCreatedAnnotation(tmp.CreatedAnnotation))
+	}
+	res, err := newPRMaxImageAge(maxAge, opts...)
+	if err != nil {
+		return err
+	}
+	*pr = *res
+	return nil
+}
@@ -0,0 +1,78 @@
+package signature
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPRMaxImageAge(t *testing.T) {
+	// Success
+	pr, err := newPRMaxImageAge(2160 * time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, &prMaxImageAge{
+		prCommon: prCommon{prTypeMaxImageAge},
+		MaxAge:   "2160h0m0s",
+	}, pr)
+	pr, err = newPRMaxImageAge(time.Hour, PRMaxImageAgeWithCreatedAnnotation("org.opencontainers.image.created"))
+	require.NoError(t, err)
+	assert.Equal(t, &prMaxImageAge{
+		prCommon:          prCommon{prTypeMaxImageAge},
+		MaxAge:            "1h0m0s",
+		CreatedAnnotation: "org.opencontainers.image.created",
+	}, pr)
+
+	// Invalid maxAge
+	for _, d := range []time.Duration{0, -time.Hour} {
+		_, err = newPRMaxImageAge(d)
+		assert.Error(t, err)
+	}
+	// Invalid createdAnnotation
+	_, err = newPRMaxImageAge(time.Hour, PRMaxImageAgeWithCreatedAnnotation(""))
+	assert.Error(t, err)
+	// Duplicate createdAnnotation
+	_, err = newPRMaxImageAge(time.Hour, PRMaxImageAgeWithCreatedAnnotation("a"), PRMaxImageAgeWithCreatedAnnotation("b"))
+	assert.Error(t, err)
+}
+
+func TestPRMaxImageAgeUnmarshalJSON(t *testing.T) {
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prMaxImageAge{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRMaxImageAge(2160*time.Hour, PRMaxImageAgeWithCreatedAnnotation("org.opencontainers.image.created"))
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		breakFns: []func(mSA){
+			// The "type" field is missing
+			func(v mSA) { delete(v, "type") },
+			// Wrong "type" field
+			func(v mSA) { v["type"] = 1 },
+			func(v mSA) { v["type"] = "this is invalid" },
+			// Extra top-level sub-object
+			func(v mSA) { v["unexpected"] = 1 },
+			// The "maxAge" field is missing
+			func(v mSA) { delete(v, "maxAge") },
+			// Invalid "maxAge" field
+			func(v mSA) { v["maxAge"] = 1 },
+			func(v mSA) { v["maxAge"] = "" },
+			func(v mSA) { v["maxAge"] = "this is invalid" },
+			func(v mSA) { v["maxAge"] = "-1h" },
+			// Invalid "createdAnnotation" field
+			func(v mSA) { v["createdAnnotation"] = 1 },
+			func(v mSA) { v["createdAnnotation"] = "" },
+		},
+		duplicateFields: []string{"type", "maxAge", "createdAnnotation"},
+	}.run(t)
+
+	// "createdAnnotation" is optional, and durations are normalized
+	var pr prMaxImageAge
+	err := json.Unmarshal([]byte(`{"type":"maxImageAge","maxAge":"90m"}`), &pr)
+	require.NoError(t, err)
+	assert.Equal(t, prMaxImageAge{
+		prCommon: prCommon{prTypeMaxImageAge},
+		MaxAge:   "1h30m0s",
+	}, pr)
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
 
 	"github.com/containers/image/v5/signature/internal"
 )
@@ -44,6 +45,17 @@ func PRSigstoreSignedWithFulcio(fulcio PRSigstoreSignedFulcio) PRSigstoreSignedO
 	}
 }
 
+// PRSigstoreSignedWithTUF specifies a value for the "tuf" field when calling NewPRSigstoreSigned.
+func PRSigstoreSignedWithTUF(tuf PRSigstoreSignedTUF) PRSigstoreSignedOption {
+	return func(pr *prSigstoreSigned) error {
+		if pr.TUF != nil {
+			return errors.New(`"tuf" already specified`)
+		}
+		pr.TUF = tuf
+		return nil
+	}
+}
+
 // PRSigstoreSignedWithRekorPublicKeyPath specifies a value for the "rekorPublicKeyPath" field when calling NewPRSigstoreSigned.
 func PRSigstoreSignedWithRekorPublicKeyPath(rekorPublicKeyPath string) PRSigstoreSignedOption {
 	return func(pr *prSigstoreSigned) error {
@@ -66,6 +78,17 @@ func PRSigstoreSignedWithRekorPublicKeyData(rekorPublicKeyData []byte) PRSigstor
 	}
 }
 
+// PRSigstoreSignedWithRequireRekorInclusionProof sets the "requireRekorInclusionProof" field when calling NewPRSigstoreSigned.
+func PRSigstoreSignedWithRequireRekorInclusionProof() PRSigstoreSignedOption {
+	return func(pr *prSigstoreSigned) error {
+		if pr.RequireRekorInclusionProof {
+			return errors.New(`"requireRekorInclusionProof" already specified`)
+		}
+		pr.RequireRekorInclusionProof = true
+		return nil
+	}
+}
+
 // PRSigstoreSignedWithSignedIdentity specifies a value for the "signedIdentity" field when calling NewPRSigstoreSigned.
 func PRSigstoreSignedWithSignedIdentity(signedIdentity PolicyReferenceMatch) PRSigstoreSignedOption {
 	return func(pr *prSigstoreSigned) error {
@@ -105,8 +128,22 @@ func newPRSigstoreSigned(options ...PRSigstoreSignedOption) (*prSigstoreSigned,
 	if res.RekorPublicKeyPath != "" && res.RekorPublicKeyData != nil {
 		return nil, InvalidPolicyFormatError("rekorPublickeyType and rekorPublickeyData cannot be used simultaneously")
 	}
-	if res.Fulcio != nil && res.RekorPublicKeyPath == "" && res.RekorPublicKeyData == nil {
-		return nil, InvalidPolicyFormatError("At least one of RekorPublickeyPath and RekorPublickeyData must be specified if fulcio is used")
+	if res.TUF != nil {
+		if res.RekorPublicKeyPath != "" || res.RekorPublicKeyData != nil {
+			return nil, InvalidPolicyFormatError("tuf cannot be used together with rekorPublicKeyPath or rekorPublicKeyData")
+		}
+		if res.Fulcio != nil && res.Fulcio.specifiesCA() {
+			return nil, InvalidPolicyFormatError("tuf cannot be used together with fulcio caPath or caData")
+		}
+	} else if res.Fulcio != nil && !res.Fulcio.specifiesCA() {
+		return nil, InvalidPolicyFormatError("At least one of caPath and caData must be specified if tuf is not used")
+	}
+	hasRekorPublicKey := res.RekorPublicKeyPath != "" || res.RekorPublicKeyData != nil || res.TUF != nil
+	if res.Fulcio != nil && !hasRekorPublicKey {
+		return nil, InvalidPolicyFormatError("At least one of RekorPublickeyPath, RekorPublickeyData and tuf must be specified if fulcio is used")
+	}
+	if res.RequireRekorInclusionProof && !hasRekorPublicKey {
+		return nil, InvalidPolicyFormatError("At least one of RekorPublickeyPath, RekorPublickeyData and tuf must be specified if requireRekorInclusionProof is used")
 	}
 
 	if res.SignedIdentity == nil {
@@ -144,8 +181,9 @@ var _ json.Unmarshaler = (*prSigstoreSigned)(nil)
 func (pr *prSigstoreSigned) UnmarshalJSON(data []byte) error {
 	*pr = prSigstoreSigned{}
 	var tmp prSigstoreSigned
-	var gotKeyPath, gotKeyData, gotFulcio, gotRekorPublicKeyPath, gotRekorPublicKeyData bool
+	var gotKeyPath, gotKeyData, gotFulcio, gotTUF, gotRekorPublicKeyPath, gotRekorPublicKeyData bool
 	var fulcio prSigstoreSignedFulcio
+	var tuf prSigstoreSignedTUF
 	var signedIdentity json.RawMessage
 	if err := internal.ParanoidUnmarshalJSONObject(data, func(key string) any {
 		switch key {
@@ -160,12 +198,17 @@ func (pr *prSigstoreSigned) UnmarshalJSON(data []byte) error {
 		case "fulcio":
 			gotFulcio = true
 			return &fulcio
+		case "tuf":
+			gotTUF = true
+			return &tuf
 		case "rekorPublicKeyPath":
 			gotRekorPublicKeyPath = true
 			return &tmp.RekorPublicKeyPath
 		case "rekorPublicKeyData":
 			gotRekorPublicKeyData = true
 			return &tmp.RekorPublicKeyData
+		case "requireRekorInclusionProof":
+			return &tmp.RequireRekorInclusionProof
 		case "signedIdentity":
 			return &signedIdentity
 		default:
@@ -198,12 +241,18 @@ func (pr *prSigstoreSigned) UnmarshalJSON(data []byte) error {
 	if gotFulcio {
 		opts = append(opts, PRSigstoreSignedWithFulcio(&fulcio))
 	}
+	if gotTUF {
+		opts = append(opts, PRSigstoreSignedWithTUF(&tuf))
+	}
 	if gotRekorPublicKeyPath {
 		opts = append(opts, PRSigstoreSignedWithRekorPublicKeyPath(tmp.RekorPublicKeyPath))
 	}
 	if gotRekorPublicKeyData {
 		opts = append(opts, PRSigstoreSignedWithRekorPublicKeyData(tmp.RekorPublicKeyData))
 	}
+	if tmp.RequireRekorInclusionProof {
+		opts = append(opts, PRSigstoreSignedWithRequireRekorInclusionProof())
+	}
 	opts = append(opts, PRSigstoreSignedWithSignedIdentity(tmp.SignedIdentity))
 
 	res, err := newPRSigstoreSigned(opts...)
@@ -250,6 +299,17 @@ func PRSigstoreSignedFulcioWithOIDCIssuer(oidcIssuer string) PRSigstoreSignedFul
 	}
 }
 
+// PRSigstoreSignedFulcioWithOIDCIssuerRegexp specifies a value for the "oidcIssuerRegexp" field when calling NewPRSigstoreSignedFulcio
+func PRSigstoreSignedFulcioWithOIDCIssuerRegexp(oidcIssuerRegexp string) PRSigstoreSignedFulcioOption {
+	return func(f *prSigstoreSignedFulcio) error {
+		if f.OIDCIssuerRegexp != "" {
+			return errors.New(`"oidcIssuerRegexp" already specified`)
+		}
+		f.OIDCIssuerRegexp = oidcIssuerRegexp
+		return nil
+	}
+}
+
 // PRSigstoreSignedFulcioWithSubjectEmail specifies a value for the "subjectEmail" field when calling NewPRSigstoreSignedFulcio
 func PRSigstoreSignedFulcioWithSubjectEmail(subjectEmail string) PRSigstoreSignedFulcioOption {
 	return func(f *prSigstoreSignedFulcio) error {
@@ -261,6 +321,75 @@ func PRSigstoreSignedFulcioWithSubjectEmail(subjectEmail string) PRSigstoreSigne
 	}
 }
 
+// PRSigstoreSignedFulcioWithSubjectEmailRegexp specifies a value for the "subjectEmailRegexp" field when calling NewPRSigstoreSignedFulcio
+func PRSigstoreSignedFulcioWithSubjectEmailRegexp(subjectEmailRegexp string) PRSigstoreSignedFulcioOption {
+	return func(f *prSigstoreSignedFulcio) error {
+		if f.SubjectEmailRegexp != "" {
+			return errors.New(`"subjectEmailRegexp" already specified`)
+		}
+		f.SubjectEmailRegexp = subjectEmailRegexp
+		return nil
+	}
+}
+
+// PRSigstoreSignedFulcioWithSubjectURI specifies a value for the "subjectURI" field when calling NewPRSigstoreSignedFulcio
+func PRSigstoreSignedFulcioWithSubjectURI(subjectURI string) PRSigstoreSignedFulcioOption {
+	return func(f *prSigstoreSignedFulcio) error {
+		if f.SubjectURI != "" {
+			return errors.New(`"subjectURI" already specified`)
+		}
+		f.SubjectURI = subjectURI
+		return nil
+	}
+}
+
+// PRSigstoreSignedFulcioWithSubjectURIRegexp specifies a value for the "subjectURIRegexp" field when calling NewPRSigstoreSignedFulcio
+func PRSigstoreSignedFulcioWithSubjectURIRegexp(subjectURIRegexp string) PRSigstoreSignedFulcioOption {
+	return func(f *prSigstoreSignedFulcio) error {
+		if f.SubjectURIRegexp != "" {
+			return errors.New(`"subjectURIRegexp" already specified`)
+		}
+		f.SubjectURIRegexp = subjectURIRegexp
+		return nil
+	}
+}
+
+// PRSigstoreSignedFulcioWithCRLPaths specifies a value for the "crlPaths" field when calling NewPRSigstoreSignedFulcio
+func PRSigstoreSignedFulcioWithCRLPaths(crlPaths []string) PRSigstoreSignedFulcioOption {
+	return func(f *prSigstoreSignedFulcio) error {
+		if f.CRLPaths != nil {
+			return errors.New(`"crlPaths" already specified`)
+		}
+		f.CRLPaths = crlPaths
+		return nil
+	}
+}
+
+// PRSigstoreSignedFulcioWithOCSP sets the "ocsp" field when calling NewPRSigstoreSignedFulcio
+func PRSigstoreSignedFulcioWithOCSP() PRSigstoreSignedFulcioOption {
+	return func(f *prSigstoreSignedFulcio) error {
+		if f.OCSP {
+			return errors.New(`"ocsp" already specified`)
+		}
+		f.OCSP = true
+		return nil
+	}
+}
+
+// PRSigstoreSignedFulcioWithRevocationFailureMode specifies a value for the "revocationFailureMode" field when calling NewPRSigstoreSignedFulcio
+func PRSigstoreSignedFulcioWithRevocationFailureMode(mode revocationFailureMode) PRSigstoreSignedFulcioOption {
+	return func(f *prSigstoreSignedFulcio) error {
+		if f.RevocationFailureMode != "" {
+			return errors.New(`"revocationFailureMode" already specified`)
+		}
+		if !mode.IsValid() {
+			return InvalidPolicyFormatError(fmt.Sprintf("invalid revocationFailureMode %q", mode))
+		}
+		f.RevocationFailureMode = mode
+		return nil
+	}
+}
+
 // newPRSigstoreSignedFulcio is NewPRSigstoreSignedFulcio, except it returns the private type
 func newPRSigstoreSignedFulcio(options ...PRSigstoreSignedFulcioOption) (*prSigstoreSignedFulcio, error) {
 	res := prSigstoreSignedFulcio{}
@@ -273,15 +402,41 @@ func newPRSigstoreSignedFulcio(options ...PRSigstoreSignedFulcioOption) (*prSigs
 	if res.CAPath != "" && res.CAData != nil {
 		return nil, InvalidPolicyFormatError("caPath and caData cannot be used simultaneously")
 	}
-	if res.CAPath == "" && res.CAData == nil {
-		return nil, InvalidPolicyFormatError("At least one of caPath and caData must be specified")
+	if res.OIDCIssuer != "" && res.OIDCIssuerRegexp != "" {
+		return nil, InvalidPolicyFormatError("oidcIssuer and oidcIssuerRegexp cannot be used simultaneously")
 	}
-	if res.OIDCIssuer == "" {
+	if res.OIDCIssuer == "" && res.OIDCIssuerRegexp == "" {
 		return nil, InvalidPolicyFormatError("oidcIssuer not specified")
 	}
-	if res.SubjectEmail == "" {
+	subjects := 0
+	for _, s := range []string{res.SubjectEmail, res.SubjectEmailRegexp, res.SubjectURI, res.SubjectURIRegexp} {
+		if s != "" {
+			subjects++
+		}
+	}
+	if subjects == 0 {
 		return nil, InvalidPolicyFormatError("subjectEmail not specified")
 	}
+	if subjects > 1 {
+		return nil, InvalidPolicyFormatError("exactly one of subjectEmail, subjectEmailRegexp, subjectURI and subjectURIRegexp must be specified")
+	}
+	for _, re := range []struct{ field, value string }{
+		{"oidcIssuerRegexp", res.OIDCIssuerRegexp},
+		{"subjectEmailRegexp", res.SubjectEmailRegexp},
+		{"subjectURIRegexp", res.SubjectURIRegexp},
+	} {
+		if re.value != "" {
+			if _, err := compileFulcioRegexp(re.value); err != nil {
+				return nil, InvalidPolicyFormatError(fmt.Sprintf("invalid %s: %v", re.field, err))
+			}
+		}
+	}
+	if res.CRLPaths != nil && len(res.CRLPaths) == 0 {
+		return nil, InvalidPolicyFormatError("crlPaths must not be empty")
+	}
+	if res.RevocationFailureMode != "" && res.CRLPaths == nil && !res.OCSP {
+		return nil, InvalidPolicyFormatError("revocationFailureMode requires crlPaths or ocsp")
+	}
 
 	return &res, nil
 }
@@ -297,7 +452,8 @@ var _ json.Unmarshaler = (*prSigstoreSignedFulcio)(nil)
 func (f *prSigstoreSignedFulcio) UnmarshalJSON(data []byte) error {
 	*f = prSigstoreSignedFulcio{}
 	var tmp prSigstoreSignedFulcio
-	var gotCAPath, gotCAData, gotOIDCIssuer, gotSubjectEmail bool // = false...
+	var gotCAPath, gotCAData, gotOIDCIssuer, gotOIDCIssuerRegexp, gotSubjectEmail, gotSubjectEmailRegexp, gotSubjectURI, gotSubjectURIRegexp bool // = false...
+	var gotCRLPaths, gotRevocationFailureMode bool                                                                                                // = false...
 	if err := internal.ParanoidUnmarshalJSONObject(data, func(key string) any {
 		switch key {
 		case "caPath":
@@ -309,9 +465,29 @@ func (f *prSigstoreSignedFulcio) UnmarshalJSON(data []byte) error {
 		case "oidcIssuer":
 			gotOIDCIssuer = true
 			return &tmp.OIDCIssuer
+		case "oidcIssuerRegexp":
+			gotOIDCIssuerRegexp = true
+			return &tmp.OIDCIssuerRegexp
 		case "subjectEmail":
 			gotSubjectEmail = true
 			return &tmp.SubjectEmail
+		case "subjectEmailRegexp":
+			gotSubjectEmailRegexp = true
+			return &tmp.SubjectEmailRegexp
+		case "subjectURI":
+			gotSubjectURI = true
+			return &tmp.SubjectURI
+		case "subjectURIRegexp":
+			gotSubjectURIRegexp = true
+			return &tmp.SubjectURIRegexp
+		case "crlPaths":
+			gotCRLPaths = true
+			return &tmp.CRLPaths
+		case "ocsp":
+			return &tmp.OCSP
+		case "revocationFailureMode":
+			gotRevocationFailureMode = true
+			return &tmp.RevocationFailureMode
 		default:
 			return nil
 		}
@@ -329,9 +505,30 @@ func (f *prSigstoreSignedFulcio) UnmarshalJSON(data []byte) error {
 	if gotOIDCIssuer {
 		opts = append(opts, PRSigstoreSignedFulcioWithOIDCIssuer(tmp.OIDCIssuer))
 	}
+	if gotOIDCIssuerRegexp {
+		opts = append(opts, PRSigstoreSignedFulcioWithOIDCIssuerRegexp(tmp.OIDCIssuerRegexp))
+	}
 	if gotSubjectEmail {
 		opts = append(opts, PRSigstoreSignedFulcioWithSubjectEmail(tmp.SubjectEmail))
 	}
+	if gotSubjectEmailRegexp {
+		opts = append(opts, PRSigstoreSignedFulcioWithSubjectEmailRegexp(tmp.SubjectEmailRegexp))
+	}
+	if gotSubjectURI {
+		opts = append(opts, PRSigstoreSignedFulcioWithSubjectURI(tmp.SubjectURI))
+	}
+	if gotSubjectURIRegexp {
+		opts = append(opts, PRSigstoreSignedFulcioWithSubjectURIRegexp(tmp.SubjectURIRegexp))
+	}
+	if gotCRLPaths {
+		opts = append(opts, PRSigstoreSignedFulcioWithCRLPaths(tmp.CRLPaths))
+	}
+	if tmp.OCSP {
+		opts = append(opts, PRSigstoreSignedFulcioWithOCSP())
+	}
+	if gotRevocationFailureMode {
+		opts = append(opts, PRSigstoreSignedFulcioWithRevocationFailureMode(tmp.RevocationFailureMode))
+	}
 
 	res, err := newPRSigstoreSignedFulcio(opts...)
 	if err != nil {
@@ -341,3 +538,140 @@ func (f *prSigstoreSignedFulcio) UnmarshalJSON(data []byte) error {
 	*f = *res
 	return nil
 }
+
+// PRSigstoreSignedTUFOption is a way to pass values to NewPRSigstoreSignedTUF
+type PRSigstoreSignedTUFOption func(*prSigstoreSignedTUF) error
+
+// PRSigstoreSignedTUFWithRootPath specifies a value for the "rootPath" field when calling NewPRSigstoreSignedTUF
+func PRSigstoreSignedTUFWithRootPath(rootPath string) PRSigstoreSignedTUFOption {
+	return func(t *prSigstoreSignedTUF) error {
+		if t.RootPath != "" {
+			return errors.New(`"rootPath" already specified`)
+		}
+		t.RootPath = rootPath
+		return nil
+	}
+}
+
+// PRSigstoreSignedTUFWithRootData specifies a value for the "rootData" field when calling NewPRSigstoreSignedTUF
+func PRSigstoreSignedTUFWithRootData(rootData []byte) PRSigstoreSignedTUFOption {
+	return func(t *prSigstoreSignedTUF) error {
+		if t.RootData != nil {
+			return errors.New(`"rootData" already specified`)
+		}
+		t.RootData = rootData
+		return nil
+	}
+}
+
+// PRSigstoreSignedTUFWithMetadataDir specifies a value for the "metadataDir" field when calling NewPRSigstoreSignedTUF
+func PRSigstoreSignedTUFWithMetadataDir(metadataDir string) PRSigstoreSignedTUFOption {
+	return func(t *prSigstoreSignedTUF) error {
+		if t.MetadataDir != "" {
+			return errors.New(`"metadataDir" already specified`)
+		}
+		t.MetadataDir = metadataDir
+		return nil
+	}
+}
+
+// PRSigstoreSignedTUFWithMirrorURL specifies a value for the "mirrorURL" field when calling NewPRSigstoreSignedTUF
+func PRSigstoreSignedTUFWithMirrorURL(mirrorURL string) PRSigstoreSignedTUFOption {
+	return func(t *prSigstoreSignedTUF) error {
+		if t.MirrorURL != "" {
+			return errors.New(`"mirrorURL" already specified`)
+		}
+		t.MirrorURL = mirrorURL
+		return nil
+	}
+}
+
+// newPRSigstoreSignedTUF is NewPRSigstoreSignedTUF, except it returns the private type
+func newPRSigstoreSignedTUF(options ...PRSigstoreSignedTUFOption) (*prSigstoreSignedTUF, error) {
+	res := prSigstoreSignedTUF{}
+	for _, o := range options {
+		if err := o(&res); err != nil {
+			return nil, err
+		}
+	}
+
+	if res.RootPath != "" && res.RootData != nil {
+		return nil, InvalidPolicyFormatError("rootPath and rootData cannot be used simultaneously")
+	}
+	if res.RootPath == "" && res.RootData == nil {
+		return nil, InvalidPolicyFormatError("At least one of rootPath and rootData must be specified")
+	}
+	if res.MetadataDir != "" && res.MirrorURL != "" {
+		return nil, InvalidPolicyFormatError("metadataDir and mirrorURL cannot be used simultaneously")
+	}
+	if res.MetadataDir == "" && res.MirrorURL == "" {
+		return nil, InvalidPolicyFormatError("At least one of metadataDir and mirrorURL must be specified")
+	}
+	if res.MirrorURL != "" {
+		u, err := url.Parse(res.MirrorURL)
+		if err != nil {
+			return nil, InvalidPolicyFormatError(fmt.Sprintf("invalid mirrorURL %q: %v", res.MirrorURL, err))
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, InvalidPolicyFormatError(fmt.Sprintf("invalid mirrorURL %q: only http:// and https:// URLs are supported", res.MirrorURL))
+		}
+	}
+
+	return &res, nil
+}
+
+// NewPRSigstoreSignedTUF returns a PRSigstoreSignedTUF based on options.
+func NewPRSigstoreSignedTUF(options ...PRSigstoreSignedTUFOption) (PRSigstoreSignedTUF, error) {
+	return newPRSigstoreSignedTUF(options...)
+}
+
+// Compile-time check that prSigstoreSignedTUF implements json.Unmarshaler.
+var _ json.Unmarshaler = (*prSigstoreSignedTUF)(nil)
+
+func (t *prSigstoreSignedTUF) UnmarshalJSON(data []byte) error {
+	*t = prSigstoreSignedTUF{}
+	var tmp prSigstoreSignedTUF
+	var gotRootPath, gotRootData, gotMetadataDir, gotMirrorURL bool // = false...
+	if err := internal.ParanoidUnmarshalJSONObject(data, func(key string) any {
+		switch key {
+		case "rootPath":
+			gotRootPath = true
+			return &tmp.RootPath
+		case "rootData":
+			gotRootData = true
+			return &tmp.RootData
+		case "metadataDir":
+			gotMetadataDir = true
+			return &tmp.MetadataDir
+		case "mirrorURL":
+			gotMirrorURL = true
+			return &tmp.MirrorURL
+		default:
+			return nil
+		}
+	}); err != nil {
+		return err
+	}
+
+	var opts []PRSigstoreSignedTUFOption
+	if gotRootPath {
+		opts = append(opts, PRSigstoreSignedTUFWithRootPath(tmp.RootPath))
+	}
+	if gotRootData {
+		opts = append(opts, PRSigstoreSignedTUFWithRootData(tmp.RootData))
+	}
+	if gotMetadataDir {
+		opts = append(opts, PRSigstoreSignedTUFWithMetadataDir(tmp.MetadataDir))
+	}
+	if gotMirrorURL {
+		opts = append(opts, PRSigstoreSignedTUFWithMirrorURL(tmp.MirrorURL))
+	}
+
+	res, err := newPRSigstoreSignedTUF(opts...)
+	if err != nil {
+		return err
+	}
+
+	*t = *res
+	return nil
+}
@@ -30,6 +30,16 @@ func TestNewPRSigstoreSigned(t *testing.T) {
 	const testRekorKeyPath = "/foo/baz"
 	testRekorKeyData := []byte("def")
 	testIdentity := NewPRMMatchRepoDigestOrExact()
+	testFulcioWithoutCA, err := NewPRSigstoreSignedFulcio(
+		PRSigstoreSignedFulcioWithOIDCIssuer("https://github.com/login/oauth"),
+		PRSigstoreSignedFulcioWithSubjectEmail("mitr@redhat.com"),
+	)
+	require.NoError(t, err)
+	testTUF, err := NewPRSigstoreSignedTUF(
+		PRSigstoreSignedTUFWithRootPath("/foo/root.json"),
+		PRSigstoreSignedTUFWithMetadataDir("/foo/tuf"),
+	)
+	require.NoError(t, err)
 
 	// Success: combinatoric combinations of key source and Rekor uses
 	for _, c := range []struct {
@@ -102,19 +112,66 @@ func TestNewPRSigstoreSigned(t *testing.T) {
 					RekorPublicKeyData: testRekorKeyData,
 				},
 			},
+			{
+				rekorOptions: []PRSigstoreSignedOption{
+					PRSigstoreSignedWithRekorPublicKeyPath(testRekorKeyPath),
+					PRSigstoreSignedWithRequireRekorInclusionProof(),
+				},
+				rekorExpected: prSigstoreSigned{
+					RekorPublicKeyPath:         testRekorKeyPath,
+					RequireRekorInclusionProof: true,
+				},
+			},
+			{
+				rekorOptions: []PRSigstoreSignedOption{
+					PRSigstoreSignedWithTUF(testTUF),
+				},
+				rekorExpected: prSigstoreSigned{
+					TUF: testTUF,
+				},
+			},
+			{
+				rekorOptions: []PRSigstoreSignedOption{
+					PRSigstoreSignedWithTUF(testTUF),
+					PRSigstoreSignedWithRequireRekorInclusionProof(),
+				},
+				rekorExpected: prSigstoreSigned{
+					TUF:                        testTUF,
+					RequireRekorInclusionProof: true,
+				},
+			},
 		} {
 			// Special-case this rejected combination:
 			if c.requiresRekor && len(c2.rekorOptions) == 0 {
 				continue
 			}
+			// TUF can’t be combined with explicit Fulcio CA certificates
+			if c.expected.Fulcio != nil && c2.rekorExpected.TUF != nil {
+				continue
+			}
 			pr, err := newPRSigstoreSigned(append(c.options, c2.rekorOptions...)...)
 			require.NoError(t, err)
 			expected := c.expected // A shallow copy
+			expected.TUF = c2.rekorExpected.TUF
 			expected.RekorPublicKeyPath = c2.rekorExpected.RekorPublicKeyPath
 			expected.RekorPublicKeyData = c2.rekorExpected.RekorPublicKeyData
+			expected.RequireRekorInclusionProof = c2.rekorExpected.RequireRekorInclusionProof
 			assert.Equal(t, &expected, pr)
 		}
 	}
+	// Success: Fulcio with CA certificates from TUF
+	pr, err := newPRSigstoreSigned(
+		PRSigstoreSignedWithFulcio(testFulcioWithoutCA),
+		PRSigstoreSignedWithTUF(testTUF),
+		PRSigstoreSignedWithSignedIdentity(testIdentity),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, &prSigstoreSigned{
+		prCommon:       prCommon{prTypeSigstoreSigned},
+		Fulcio:         testFulcioWithoutCA,
+		TUF:            testTUF,
+		SignedIdentity: testIdentity,
+	}, pr)
 
 	testFulcio2, err := NewPRSigstoreSignedFulcio(
 		PRSigstoreSignedFulcioWithCAPath("fixtures/fulcio_v1.crt.pem"),
@@ -161,6 +218,34 @@ func TestNewPRSigstoreSigned(t *testing.T) {
 			PRSigstoreSignedWithFulcio(testFulcio),
 			PRSigstoreSignedWithSignedIdentity(testIdentity),
 		},
+		{ // fulcio without CA certificates and without TUF
+			PRSigstoreSignedWithFulcio(testFulcioWithoutCA),
+			PRSigstoreSignedWithRekorPublicKeyPath(testRekorKeyPath),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // fulcio with CA certificates and TUF
+			PRSigstoreSignedWithFulcio(testFulcio),
+			PRSigstoreSignedWithTUF(testTUF),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Both tuf and rekorPublicKeyPath specified
+			PRSigstoreSignedWithFulcio(testFulcioWithoutCA),
+			PRSigstoreSignedWithTUF(testTUF),
+			PRSigstoreSignedWithRekorPublicKeyPath(testRekorKeyPath),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Both tuf and rekorPublicKeyData specified
+			PRSigstoreSignedWithKeyPath(testKeyPath),
+			PRSigstoreSignedWithTUF(testTUF),
+			PRSigstoreSignedWithRekorPublicKeyData(testRekorKeyData),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Duplicate tuf
+			PRSigstoreSignedWithFulcio(testFulcioWithoutCA),
+			PRSigstoreSignedWithTUF(testTUF),
+			PRSigstoreSignedWithTUF(testTUF),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
 		{ // Both rekorKeyPath and rekorKeyData specified
 			PRSigstoreSignedWithKeyPath(testKeyPath),
 			PRSigstoreSignedWithRekorPublicKeyPath(testRekorKeyPath),
@@ -179,6 +264,18 @@ func TestNewPRSigstoreSigned(t *testing.T) {
 			PRSigstoreSignedWithRekorPublicKeyData([]byte("def")),
 			PRSigstoreSignedWithSignedIdentity(testIdentity),
 		},
+		{ // requireRekorInclusionProof without Rekor
+			PRSigstoreSignedWithKeyPath(testKeyPath),
+			PRSigstoreSignedWithRequireRekorInclusionProof(),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
+		{ // Duplicate requireRekorInclusionProof
+			PRSigstoreSignedWithKeyPath(testKeyPath),
+			PRSigstoreSignedWithRekorPublicKeyPath(testRekorKeyPath),
+			PRSigstoreSignedWithRequireRekorInclusionProof(),
+			PRSigstoreSignedWithRequireRekorInclusionProof(),
+			PRSigstoreSignedWithSignedIdentity(testIdentity),
+		},
 		{ // Missing signedIdentity
 			PRSigstoreSignedWithKeyPath(testKeyPath),
 		},
@@ -280,6 +377,10 @@ func TestPRSigstoreSignedUnmarshalJSON(t *testing.T) {
 			// Invalid "rekorPublicKeyData" field
 			func(v mSA) { v["rekorPublicKeyData"] = 1 },
 			func(v mSA) { v["rekorPublicKeyData"] = "this is invalid base64" },
+			// Invalid "requireRekorInclusionProof" field
+			func(v mSA) { v["requireRekorInclusionProof"] = 1 },
+			// "requireRekorInclusionProof" without a Rekor public key
+			func(v mSA) { v["requireRekorInclusionProof"] = true },
 			// Invalid "signedIdentity" field
 			func(v mSA) { v["signedIdentity"] = "this is invalid" },
 			// "signedIdentity" an explicit nil
@@ -316,6 +417,40 @@ func TestPRSigstoreSignedUnmarshalJSON(t *testing.T) {
 		otherJSONParser: newPolicyRequirementFromJSON,
 		duplicateFields: []string{"type", "fulcio", "rekorPublicKeyPath", "signedIdentity"},
 	}.run(t)
+	// Test tuf duplicate fields
+	testFulcioWithoutCA, err := NewPRSigstoreSignedFulcio(
+		PRSigstoreSignedFulcioWithOIDCIssuer("https://github.com/login/oauth"),
+		PRSigstoreSignedFulcioWithSubjectEmail("mitr@redhat.com"),
+	)
+	require.NoError(t, err)
+	testTUF, err := NewPRSigstoreSignedTUF(
+		PRSigstoreSignedTUFWithRootPath("/foo/root.json"),
+		PRSigstoreSignedTUFWithMirrorURL("https://tuf.example.com"),
+	)
+	require.NoError(t, err)
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSigstoreSigned{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSigstoreSigned(
+				PRSigstoreSignedWithFulcio(testFulcioWithoutCA),
+				PRSigstoreSignedWithTUF(testTUF),
+				PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepoDigestOrExact()),
+			)
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		breakFns: []func(mSA){
+			// Invalid "tuf" field
+			func(v mSA) { v["tuf"] = 1 },
+			func(v mSA) { v["tuf"] = mSA{} },
+			// "tuf" is explicit nil
+			func(v mSA) { v["tuf"] = nil },
+			// "tuf" is missing, so fulcio has neither CA certificates nor a Rekor key
+			func(v mSA) { delete(v, "tuf") },
+			// Both "tuf" and "rekorPublicKeyPath" are present
+			func(v mSA) { v["rekorPublicKeyPath"] = "/foo/rekor" },
+		},
+		duplicateFields: []string{"type", "fulcio", "tuf", "signedIdentity"},
+	}.run(t)
 	// Test rekorPublicKeyData duplicate fields
 	policyJSONUmarshallerTests[PolicyRequirement]{
 		newDest: func() json.Unmarshaler { return &prSigstoreSigned{} },
@@ -329,6 +464,20 @@ func TestPRSigstoreSignedUnmarshalJSON(t *testing.T) {
 		otherJSONParser: newPolicyRequirementFromJSON,
 		duplicateFields: []string{"type", "keyPath", "rekorPublicKeyData", "signedIdentity"},
 	}.run(t)
+	// Test requireRekorInclusionProof duplicate fields
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSigstoreSigned{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSigstoreSigned(
+				PRSigstoreSignedWithKeyPath("/foo/bar"),
+				PRSigstoreSignedWithRekorPublicKeyPath("/foo/rekor"),
+				PRSigstoreSignedWithRequireRekorInclusionProof(),
+				PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepoDigestOrExact()),
+			)
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		duplicateFields: []string{"type", "keyPath", "rekorPublicKeyPath", "requireRekorInclusionProof", "signedIdentity"},
+	}.run(t)
 
 	var pr prSigstoreSigned
 
@@ -339,6 +488,8 @@ func TestPRSigstoreSignedUnmarshalJSON(t *testing.T) {
 	allowedModificationFns := []func(mSA){
 		// Delete the signedIdentity field
 		func(v mSA) { delete(v, "signedIdentity") },
+		// An explicit false "requireRekorInclusionProof"
+		func(v mSA) { v["requireRekorInclusionProof"] = false },
 	}
 	for _, fn := range allowedModificationFns {
 		err := tryUnmarshalModifiedSigstoreSigned(t, &pr, validJSON, fn)
@@ -364,6 +515,10 @@ func TestNewPRSigstoreSignedFulcio(t *testing.T) {
 	testCAData := []byte("abc")
 	const testOIDCIssuer = "https://example.com"
 	const testSubjectEmail = "test@example.com"
+	const testOIDCIssuerRegexp = `https://example\.(com|org)`
+	const testSubjectEmailRegexp = `.*@example\.com`
+	const testSubjectURI = "https://github.com/org/repo/.github/workflows/release.yml@refs/heads/main"
+	const testSubjectURIRegexp = `https://github\.com/org/repo/\.github/workflows/.*`
 
 	// Success:
 	for _, c := range []struct {
@@ -394,6 +549,70 @@ func TestNewPRSigstoreSignedFulcio(t *testing.T) {
 				SubjectEmail: testSubjectEmail,
 			},
 		},
+		{ // Neither caPath nor caData specified; this is only accepted by NewPRSigstoreSigned if TUF is used.
+			options: []PRSigstoreSignedFulcioOption{
+				PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+				PRSigstoreSignedFulcioWithSubjectEmail(testSubjectEmail),
+			},
+			expected: prSigstoreSignedFulcio{
+				OIDCIssuer:   testOIDCIssuer,
+				SubjectEmail: testSubjectEmail,
+			},
+		},
+		{
+			options: []PRSigstoreSignedFulcioOption{
+				PRSigstoreSignedFulcioWithCAPath(testCAPath),
+				PRSigstoreSignedFulcioWithOIDCIssuerRegexp(testOIDCIssuerRegexp),
+				PRSigstoreSignedFulcioWithSubjectEmailRegexp(testSubjectEmailRegexp),
+			},
+			expected: prSigstoreSignedFulcio{
+				CAPath:             testCAPath,
+				OIDCIssuerRegexp:   testOIDCIssuerRegexp,
+				SubjectEmailRegexp: testSubjectEmailRegexp,
+			},
+		},
+		{
+			options: []PRSigstoreSignedFulcioOption{
+				PRSigstoreSignedFulcioWithCAPath(testCAPath),
+				PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+				PRSigstoreSignedFulcioWithSubjectURI(testSubjectURI),
+			},
+			expected: prSigstoreSignedFulcio{
+				CAPath:     testCAPath,
+				OIDCIssuer: testOIDCIssuer,
+				SubjectURI: testSubjectURI,
+			},
+		},
+		{
+			options: []PRSigstoreSignedFulcioOption{
+				PRSigstoreSignedFulcioWithCAPath(testCAPath),
+				PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+				PRSigstoreSignedFulcioWithSubjectURIRegexp(testSubjectURIRegexp),
+			},
+			expected: prSigstoreSignedFulcio{
+				CAPath:           testCAPath,
+				OIDCIssuer:       testOIDCIssuer,
+				SubjectURIRegexp: testSubjectURIRegexp,
+			},
+		},
+		{
+			options: []PRSigstoreSignedFulcioOption{
+				PRSigstoreSignedFulcioWithCAPath(testCAPath),
+				PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+				PRSigstoreSignedFulcioWithSubjectEmail(testSubjectEmail),
+				PRSigstoreSignedFulcioWithCRLPaths([]string{"/crl1", "/crl2"}),
+				PRSigstoreSignedFulcioWithOCSP(),
+				PRSigstoreSignedFulcioWithRevocationFailureMode(RevocationFailureModeSoftFail),
+			},
+			expected: prSigstoreSignedFulcio{
+				CAPath:                testCAPath,
+				OIDCIssuer:            testOIDCIssuer,
+				SubjectEmail:          testSubjectEmail,
+				CRLPaths:              []string{"/crl1", "/crl2"},
+				OCSP:                  true,
+				RevocationFailureMode: RevocationFailureModeSoftFail,
+			},
+		},
 	} {
 		pr, err := newPRSigstoreSignedFulcio(c.options...)
 		require.NoError(t, err)
@@ -401,10 +620,6 @@ func TestNewPRSigstoreSignedFulcio(t *testing.T) {
 	}
 
 	for _, c := range [][]PRSigstoreSignedFulcioOption{
-		{ // Neither caPath nor caData specified
-			PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
-			PRSigstoreSignedFulcioWithSubjectEmail(testSubjectEmail),
-		},
 		{ // Both caPath and caData specified
 			PRSigstoreSignedFulcioWithCAPath(testCAPath),
 			PRSigstoreSignedFulcioWithCAData(testCAData),
@@ -443,6 +658,104 @@ func TestNewPRSigstoreSignedFulcio(t *testing.T) {
 			PRSigstoreSignedFulcioWithSubjectEmail(testSubjectEmail),
 			PRSigstoreSignedFulcioWithSubjectEmail("1" + testSubjectEmail),
 		},
+		{ // Both oidcIssuer and oidcIssuerRegexp specified
+			PRSigstoreSignedFulcioWithCAPath(testCAPath),
+			PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+			PRSigstoreSignedFulcioWithOIDCIssuerRegexp(testOIDCIssuerRegexp),
+			PRSigstoreSignedFulcioWithSubjectEmail(testSubjectEmail),
+		},
+		{ // Duplicate oidcIssuerRegexp
+			PRSigstoreSignedFulcioWithCAPath(testCAPath),
+			PRSigstoreSignedFulcioWithOIDCIssuerRegexp(testOIDCIssuerRegexp),
+			PRSigstoreSignedFulcioWithOIDCIssuerRegexp(testOIDCIssuerRegexp + "1"),
+			PRSigstoreSignedFulcioWithSubjectEmail(testSubjectEmail),
+		},
+		{ // Invalid oidcIssuerRegexp
+			PRSigstoreSignedFulcioWithCAPath(testCAPath),
+			PRSigstoreSignedFulcioWithOIDCIssuerRegexp("("),
+			PRSigstoreSignedFulcioWithSubjectEmail(testSubjectEmail),
+		},
+		{ // Both subjectEmail and subjectURI specified
+			PRSigstoreSignedFulcioWithCAPath(testCAPath),
+			PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+			PRSigstoreSignedFulcioWithSubjectEmail(testSubjectEmail),
+			PRSigstoreSignedFulcioWithSubjectURI(testSubjectURI),
+		},
+		{ // Both subjectEmailRegexp and subjectURIRegexp specified
+			PRSigstoreSignedFulcioWithCAPath(testCAPath),
+			PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+			PRSigstoreSignedFulcioWithSubjectEmailRegexp(testSubjectEmailRegexp),
+			PRSigstoreSignedFulcioWithSubjectURIRegexp(testSubjectURIRegexp),
+		},
+		{ // Duplicate subjectEmailRegexp
+			PRSigstoreSignedFulcioWithCAPath(testCAPath),
+			PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+			PRSigstoreSignedFulcioWithSubjectEmailRegexp(testSubjectEmailRegexp),
+			PRSigstoreSignedFulcioWithSubjectEmailRegexp(testSubjectEmailRegexp + "1"),
+		},
+		{ // Duplicate subjectURI
+			PRSigstoreSignedFulcioWithCAPath(testCAPath),
+			PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+			PRSigstoreSignedFulcioWithSubjectURI(testSubjectURI),
+			PRSigstoreSignedFulcioWithSubjectURI(testSubjectURI + "1"),
+		},
+		{ // Duplicate subjectURIRegexp
+			PRSigstoreSignedFulcioWithCAPath(testCAPath),
+			PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+			PRSigstoreSignedFulcioWithSubjectURIRegexp(testSubjectURIRegexp),
+			PRSigstoreSignedFulcioWithSubjectURIRegexp(testSubjectURIRegexp + "1"),
+		},
+		{ // Invalid subjectEmailRegexp
+			PRSigstoreSignedFulcioWithCAPath(testCAPath),
+			PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+			PRSigstoreSignedFulcioWithSubjectEmailRegexp("["),
+		},
+		{ // Invalid subjectURIRegexp
+			PRSigstoreSignedFulcioWithCAPath(testCAPath),
+			PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+			PRSigstoreSignedFulcioWithSubjectURIRegexp("["),
+		},
+		{ // Duplicate crlPaths
+			PRSigstoreSignedFulcioWithCAPath(testCAPath),
+			PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+			PRSigstoreSignedFulcioWithSubjectEmail(testSubjectEmail),
+			PRSigstoreSignedFulcioWithCRLPaths([]string{"/crl1"}),
+			PRSigstoreSignedFulcioWithCRLPaths([]string{"/crl2"}),
+		},
+		{ // Empty crlPaths
+			PRSigstoreSignedFulcioWithCAPath(testCAPath),
+			PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+			PRSigstoreSignedFulcioWithSubjectEmail(testSubjectEmail),
+			PRSigstoreSignedFulcioWithCRLPaths([]string{}),
+		},
+		{ // Duplicate ocsp
+			PRSigstoreSignedFulcioWithCAPath(testCAPath),
+			PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+			PRSigstoreSignedFulcioWithSubjectEmail(testSubjectEmail),
+			PRSigstoreSignedFulcioWithOCSP(),
+			PRSigstoreSignedFulcioWithOCSP(),
+		},
+		{ // Duplicate revocationFailureMode
+			PRSigstoreSignedFulcioWithCAPath(testCAPath),
+			PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+			PRSigstoreSignedFulcioWithSubjectEmail(testSubjectEmail),
+			PRSigstoreSignedFulcioWithOCSP(),
+			PRSigstoreSignedFulcioWithRevocationFailureMode(RevocationFailureModeSoftFail),
+			PRSigstoreSignedFulcioWithRevocationFailureMode(RevocationFailureModeHardFail),
+		},
+		{ // Invalid revocationFailureMode
+			PRSigstoreSignedFulcioWithCAPath(testCAPath),
+			PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+			PRSigstoreSignedFulcioWithSubjectEmail(testSubjectEmail),
+			PRSigstoreSignedFulcioWithOCSP(),
+			PRSigstoreSignedFulcioWithRevocationFailureMode("this is invalid"),
+		},
+		{ // revocationFailureMode without crlPaths or ocsp
+			PRSigstoreSignedFulcioWithCAPath(testCAPath),
+			PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+			PRSigstoreSignedFulcioWithSubjectEmail(testSubjectEmail),
+			PRSigstoreSignedFulcioWithRevocationFailureMode(RevocationFailureModeHardFail),
+		},
 	} {
 		_, err := newPRSigstoreSignedFulcio(c...)
 		logrus.Errorf("%#v", err)
@@ -464,8 +777,6 @@ func TestPRSigstoreSignedFulcioUnmarshalJSON(t *testing.T) {
 		breakFns: []func(mSA){
 			// Extra top-level sub-object
 			func(v mSA) { v["unexpected"] = 1 },
-			// Both of "caPath" and "caData" are missing
-			func(v mSA) { delete(v, "caPath") },
 			// Both "caPath" and "caData" is present
 			func(v mSA) { v["caData"] = "" },
 			// Invalid "caPath" field
@@ -499,4 +810,232 @@ func TestPRSigstoreSignedFulcioUnmarshalJSON(t *testing.T) {
 		},
 		duplicateFields: []string{"caData", "oidcIssuer", "subjectEmail"},
 	}.run(t)
+	// Test regexp and URI specifics
+	policyJSONUmarshallerTests[PRSigstoreSignedFulcio]{
+		newDest: func() json.Unmarshaler { return &prSigstoreSignedFulcio{} },
+		newValidObject: func() (PRSigstoreSignedFulcio, error) {
+			return NewPRSigstoreSignedFulcio(
+				PRSigstoreSignedFulcioWithCAPath("fixtures/fulcio_v1.crt.pem"),
+				PRSigstoreSignedFulcioWithOIDCIssuerRegexp(`https://token\.actions\.githubusercontent\.com`),
+				PRSigstoreSignedFulcioWithSubjectURIRegexp(`https://github\.com/org/repo/.*`),
+			)
+		},
+		otherJSONParser: nil,
+		breakFns: []func(mSA){
+			// Invalid "oidcIssuerRegexp" field
+			func(v mSA) { v["oidcIssuerRegexp"] = 1 },
+			func(v mSA) { v["oidcIssuerRegexp"] = "(" },
+			// Both "oidcIssuer" and "oidcIssuerRegexp" are present
+			func(v mSA) { v["oidcIssuer"] = "https://example.com" },
+			// Invalid "subjectURIRegexp" field
+			func(v mSA) { v["subjectURIRegexp"] = 1 },
+			func(v mSA) { v["subjectURIRegexp"] = "[" },
+			// Multiple subject criteria
+			func(v mSA) { v["subjectURI"] = "https://github.com/org/repo" },
+			func(v mSA) { v["subjectEmailRegexp"] = ".*" },
+			// No subject criteria
+			func(v mSA) { delete(v, "subjectURIRegexp") },
+		},
+		duplicateFields: []string{"caPath", "oidcIssuerRegexp", "subjectURIRegexp"},
+	}.run(t)
+	policyJSONUmarshallerTests[PRSigstoreSignedFulcio]{
+		newDest: func() json.Unmarshaler { return &prSigstoreSignedFulcio{} },
+		newValidObject: func() (PRSigstoreSignedFulcio, error) {
+			return NewPRSigstoreSignedFulcio(
+				PRSigstoreSignedFulcioWithCAPath("fixtures/fulcio_v1.crt.pem"),
+				PRSigstoreSignedFulcioWithOIDCIssuer("https://github.com/login/oauth"),
+				PRSigstoreSignedFulcioWithSubjectEmailRegexp(`.*@redhat\.com`),
+			)
+		},
+		otherJSONParser: nil,
+		breakFns: []func(mSA){
+			// Invalid "subjectEmailRegexp" field
+			func(v mSA) { v["subjectEmailRegexp"] = 1 },
+			func(v mSA) { v["subjectEmailRegexp"] = "[" },
+		},
+		duplicateFields: []string{"caPath", "oidcIssuer", "subjectEmailRegexp"},
+	}.run(t)
+	policyJSONUmarshallerTests[PRSigstoreSignedFulcio]{
+		newDest: func() json.Unmarshaler { return &prSigstoreSignedFulcio{} },
+		newValidObject: func() (PRSigstoreSignedFulcio, error) {
+			return NewPRSigstoreSignedFulcio(
+				PRSigstoreSignedFulcioWithCAPath("fixtures/fulcio_v1.crt.pem"),
+				PRSigstoreSignedFulcioWithOIDCIssuer("https://token.actions.githubusercontent.com"),
+				PRSigstoreSignedFulcioWithSubjectURI("https://github.com/org/repo/.github/workflows/release.yml@refs/heads/main"),
+			)
+		},
+		otherJSONParser: nil,
+		breakFns: []func(mSA){
+			// Invalid "subjectURI" field
+			func(v mSA) { v["subjectURI"] = 1 },
+		},
+		duplicateFields: []string{"caPath", "oidcIssuer", "subjectURI"},
+	}.run(t)
+	// Test revocation specifics
+	policyJSONUmarshallerTests[PRSigstoreSignedFulcio]{
+		newDest: func() json.Unmarshaler { return &prSigstoreSignedFulcio{} },
+		newValidObject: func() (PRSigstoreSignedFulcio, error) {
+			return NewPRSigstoreSignedFulcio(
+				PRSigstoreSignedFulcioWithCAPath("fixtures/fulcio_v1.crt.pem"),
+				PRSigstoreSignedFulcioWithOIDCIssuer("https://github.com/login/oauth"),
+				PRSigstoreSignedFulcioWithSubjectEmail("mitr@redhat.com"),
+				PRSigstoreSignedFulcioWithCRLPaths([]string{"/crl1", "/crl2"}),
+				PRSigstoreSignedFulcioWithOCSP(),
+				PRSigstoreSignedFulcioWithRevocationFailureMode(RevocationFailureModeSoftFail),
+			)
+		},
+		otherJSONParser: nil,
+		breakFns: []func(mSA){
+			// Invalid "crlPaths" field
+			func(v mSA) { v["crlPaths"] = 1 },
+			func(v mSA) { v["crlPaths"] = []int{1} },
+			func(v mSA) { v["crlPaths"] = []string{} },
+			// Invalid "ocsp" field
+			func(v mSA) { v["ocsp"] = 1 },
+			// Invalid "revocationFailureMode" field
+			func(v mSA) { v["revocationFailureMode"] = 1 },
+			func(v mSA) { v["revocationFailureMode"] = "this is invalid" },
+			// "revocationFailureMode" without "crlPaths" or "ocsp"
+			func(v mSA) { delete(v, "crlPaths"); delete(v, "ocsp") },
+		},
+		duplicateFields: []string{"caPath", "oidcIssuer", "subjectEmail", "crlPaths", "ocsp", "revocationFailureMode"},
+	}.run(t)
+}
+
+func TestNewPRSigstoreSignedTUF(t *testing.T) {
+	const testRootPath = "/foo/root.json"
+	testRootData := []byte("abc")
+	const testMetadataDir = "/foo/tuf"
+	const testMirrorURL = "https://tuf.example.com"
+
+	// Success:
+	for _, c := range []struct {
+		options  []PRSigstoreSignedTUFOption
+		expected prSigstoreSignedTUF
+	}{
+		{
+			options: []PRSigstoreSignedTUFOption{
+				PRSigstoreSignedTUFWithRootPath(testRootPath),
+				PRSigstoreSignedTUFWithMetadataDir(testMetadataDir),
+			},
+			expected: prSigstoreSignedTUF{
+				RootPath:    testRootPath,
+				MetadataDir: testMetadataDir,
+			},
+		},
+		{
+			options: []PRSigstoreSignedTUFOption{
+				PRSigstoreSignedTUFWithRootData(testRootData),
+				PRSigstoreSignedTUFWithMirrorURL(testMirrorURL),
+			},
+			expected: prSigstoreSignedTUF{
+				RootData:  testRootData,
+				MirrorURL: testMirrorURL,
+			},
+		},
+	} {
+		pr, err := newPRSigstoreSignedTUF(c.options...)
+		require.NoError(t, err)
+		assert.Equal(t, &c.expected, pr)
+	}
+
+	for _, c := range [][]PRSigstoreSignedTUFOption{
+		{ // Neither rootPath nor rootData specified
+			PRSigstoreSignedTUFWithMetadataDir(testMetadataDir),
+		},
+		{ // Both rootPath and rootData specified
+			PRSigstoreSignedTUFWithRootPath(testRootPath),
+			PRSigstoreSignedTUFWithRootData(testRootData),
+			PRSigstoreSignedTUFWithMetadataDir(testMetadataDir),
+		},
+		{ // Duplicate rootPath
+			PRSigstoreSignedTUFWithRootPath(testRootPath),
+			PRSigstoreSignedTUFWithRootPath(testRootPath + "1"),
+			PRSigstoreSignedTUFWithMetadataDir(testMetadataDir),
+		},
+		{ // Duplicate rootData
+			PRSigstoreSignedTUFWithRootData(testRootData),
+			PRSigstoreSignedTUFWithRootData([]byte("def")),
+			PRSigstoreSignedTUFWithMetadataDir(testMetadataDir),
+		},
+		{ // Neither metadataDir nor mirrorURL specified
+			PRSigstoreSignedTUFWithRootPath(testRootPath),
+		},
+		{ // Both metadataDir and mirrorURL specified
+			PRSigstoreSignedTUFWithRootPath(testRootPath),
+			PRSigstoreSignedTUFWithMetadataDir(testMetadataDir),
+			PRSigstoreSignedTUFWithMirrorURL(testMirrorURL),
+		},
+		{ // Duplicate metadataDir
+			PRSigstoreSignedTUFWithRootPath(testRootPath),
+			PRSigstoreSignedTUFWithMetadataDir(testMetadataDir),
+			PRSigstoreSignedTUFWithMetadataDir(testMetadataDir + "1"),
+		},
+		{ // Duplicate mirrorURL
+			PRSigstoreSignedTUFWithRootPath(testRootPath),
+			PRSigstoreSignedTUFWithMirrorURL(testMirrorURL),
+			PRSigstoreSignedTUFWithMirrorURL(testMirrorURL + "/1"),
+		},
+		{ // Invalid mirrorURL
+			PRSigstoreSignedTUFWithRootPath(testRootPath),
+			PRSigstoreSignedTUFWithMirrorURL("://"),
+		},
+		{ // mirrorURL with an unsupported scheme
+			PRSigstoreSignedTUFWithRootPath(testRootPath),
+			PRSigstoreSignedTUFWithMirrorURL("file:///foo/tuf"),
+		},
+	} {
+		_, err := newPRSigstoreSignedTUF(c...)
+		assert.Error(t, err)
+	}
+}
+
+func TestPRSigstoreSignedTUFUnmarshalJSON(t *testing.T) {
+	policyJSONUmarshallerTests[PRSigstoreSignedTUF]{
+		newDest: func() json.Unmarshaler { return &prSigstoreSignedTUF{} },
+		newValidObject: func() (PRSigstoreSignedTUF, error) {
+			return NewPRSigstoreSignedTUF(
+				PRSigstoreSignedTUFWithRootPath("/foo/root.json"),
+				PRSigstoreSignedTUFWithMetadataDir("/foo/tuf"),
+			)
+		},
+		otherJSONParser: nil,
+		breakFns: []func(mSA){
+			// Extra top-level sub-object
+			func(v mSA) { v["unexpected"] = 1 },
+			// Both of "rootPath" and "rootData" are missing
+			func(v mSA) { delete(v, "rootPath") },
+			// Both "rootPath" and "rootData" are present
+			func(v mSA) { v["rootData"] = "" },
+			// Invalid "rootPath" field
+			func(v mSA) { v["rootPath"] = 1 },
+			// Both of "metadataDir" and "mirrorURL" are missing
+			func(v mSA) { delete(v, "metadataDir") },
+			// Both "metadataDir" and "mirrorURL" are present
+			func(v mSA) { v["mirrorURL"] = "https://tuf.example.com" },
+			// Invalid "metadataDir" field
+			func(v mSA) { v["metadataDir"] = 1 },
+		},
+		duplicateFields: []string{"rootPath", "metadataDir"},
+	}.run(t)
+	// Test rootData and mirrorURL specifics
+	policyJSONUmarshallerTests[PRSigstoreSignedTUF]{
+		newDest: func() json.Unmarshaler { return &prSigstoreSignedTUF{} },
+		newValidObject: func() (PRSigstoreSignedTUF, error) {
+			return NewPRSigstoreSignedTUF(
+				PRSigstoreSignedTUFWithRootData([]byte("abc")),
+				PRSigstoreSignedTUFWithMirrorURL("https://tuf.example.com"),
+			)
+		},
+		otherJSONParser: nil,
+		breakFns: []func(mSA){
+			// Invalid "rootData" field
+			func(v mSA) { v["rootData"] = 1 },
+			func(v mSA) { v["rootData"] = "this is invalid base64" },
+			// Invalid "mirrorURL" field
+			func(v mSA) { v["mirrorURL"] = 1 },
+			func(v mSA) { v["mirrorURL"] = "file:///foo/tuf" },
+		},
+		duplicateFields: []string{"rootData", "mirrorURL"},
+	}.run(t)
 }
@@ -0,0 +1,160 @@
+package signature
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/signature/internal"
+)
+
+// PRSLSAProvenanceOption is a way to pass values to NewPRSLSAProvenance
+type PRSLSAProvenanceOption func(*prSLSAProvenance) error
+
+// PRSLSAProvenanceWithKeyPath specifies a value for the "keyPath" field when calling NewPRSLSAProvenance.
+func PRSLSAProvenanceWithKeyPath(keyPath string) PRSLSAProvenanceOption {
+	return func(pr *prSLSAProvenance) error {
+		if pr.KeyPath != "" {
+			return errors.New(`"keyPath" already specified`)
+		}
+		pr.KeyPath = keyPath
+		return nil
+	}
+}
+
+// PRSLSAProvenanceWithKeyData specifies a value for the "keyData" field when calling NewPRSLSAProvenance.
+func PRSLSAProvenanceWithKeyData(keyData []byte) PRSLSAProvenanceOption {
+	return func(pr *prSLSAProvenance) error {
+		if pr.KeyData != nil {
+			return errors.New(`"keyData" already specified`)
+		}
+		pr.KeyData = keyData
+		return nil
+	}
+}
+
+// PRSLSAProvenanceWithBuilderID specifies a value for the "builderID" field when calling NewPRSLSAProvenance.
+func PRSLSAProvenanceWithBuilderID(builderID string) PRSLSAProvenanceOption {
+	return func(pr *prSLSAProvenance) error {
+		if pr.BuilderID != "" {
+			return errors.New(`"builderID" already specified`)
+		}
+		if builderID == "" {
+			return InvalidPolicyFormatError("builderID must not be empty")
+		}
+		pr.BuilderID = builderID
+		return nil
+	}
+}
+
+// PRSLSAProvenanceWithSourceRepository specifies a value for the "sourceRepository" field when calling NewPRSLSAProvenance.
+func PRSLSAProvenanceWithSourceRepository(sourceRepository string) PRSLSAProvenanceOption {
+	return func(pr *prSLSAProvenance) error {
+		if pr.SourceRepository != "" {
+			return errors.New(`"sourceRepository" already specified`)
+		}
+		if sourceRepository == "" {
+			return InvalidPolicyFormatError("sourceRepository must not be empty")
+		}
+		pr.SourceRepository = sourceRepository
+		return nil
+	}
+}
+
+// PRSLSAProvenanceWithSourceBranch specifies a value for the "sourceBranch" field when calling NewPRSLSAProvenance.
+func PRSLSAProvenanceWithSourceBranch(sourceBranch string) PRSLSAProvenanceOption {
+	return func(pr *prSLSAProvenance) error {
+		if pr.SourceBranch != "" {
+			return errors.New(`"sourceBranch" already specified`)
+		}
+		if sourceBranch == "" {
+			return InvalidPolicyFormatError("sourceBranch must not be empty")
+		}
+		pr.SourceBranch = sourceBranch
+		return nil
+	}
+}
+
+// newPRSLSAProvenance is NewPRSLSAProvenance, except it returns the private type.
+func newPRSLSAProvenance(options ...PRSLSAProvenanceOption) (*prSLSAProvenance, error) {
+	res := prSLSAProvenance{
+		prCommon: prCommon{Type: prTypeSLSAProvenance},
+	}
+	for _, o := range options {
+		if err := o(&res); err != nil {
+			return nil, err
+		}
+	}
+
+	if (res.KeyPath != "") == (res.KeyData != nil) {
+		return nil, InvalidPolicyFormatError("exactly one of keyPath and keyData must be specified")
+	}
+	return &res, nil
+}
+
+// NewPRSLSAProvenance returns a new "slsaProvenance" PolicyRequirement based on options.
+func NewPRSLSAProvenance(options ...PRSLSAProvenanceOption) (PolicyRequirement, error) {
+	return newPRSLSAProvenance(options...)
+}
+
+// Compile-time check that prSLSAProvenance implements json.Unmarshaler.
+var _ json.Unmarshaler = (*prSLSAProvenance)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pr *prSLSAProvenance) UnmarshalJSON(data []byte) error {
+	*pr = prSLSAProvenance{}
+	var tmp prSLSAProvenance
+	var gotKeyPath, gotKeyData, gotBuilderID, gotSourceRepository, gotSourceBranch bool
+	if err := internal.ParanoidUnmarshalJSONObject(data, func(key string) any {
+		switch key {
+		case "type":
+			return &tmp.Type
+		case "keyPath":
+			gotKeyPath = true
+			return &tmp.KeyPath
+		case "keyData":
+			gotKeyData = true
+			return &tmp.KeyData
+		case "builderID":
+			gotBuilderID = true
+			return &tmp.BuilderID
+		case "sourceRepository":
+			gotSourceRepository = true
+			return &tmp.SourceRepository
+		case "sourceBranch":
+			gotSourceBranch = true
+			return &tmp.SourceBranch
+		default:
+			return nil
+		}
+	}); err != nil {
+		return err
+	}
+
+	if tmp.Type != prTypeSLSAProvenance {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unexpected policy requirement type \"%s\"", tmp.Type))
+	}
+
+	var opts []PRSLSAProvenanceOption
+	if gotKeyPath {
+		opts = append(opts, PRSLSAProvenanceWithKeyPath(tmp.KeyPath))
+	}
+	if gotKeyData {
+		opts = append(opts, PRSLSAProvenanceWithKeyData(tmp.KeyData))
+	}
+	if gotBuilderID {
+		opts = append(opts, PRSLSAProvenanceWithBuilderID(tmp.BuilderID))
+	}
+	if gotSourceRepository {
+		opts = append(opts, PRSLSAProvenanceWithSourceRepository(tmp.SourceRepository))
+	}
+	if gotSourceBranch {
+		opts = append(opts, PRSLSAProvenanceWithSourceBranch(tmp.SourceBranch))
+	}
+	res, err := newPRSLSAProvenance(opts...)
+	if err != nil {
+		return err
+	}
+	*pr = *res
+	return nil
+}
@@ -0,0 +1,126 @@
+package signature
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewPRSLSAProvenance(t *testing.T) {
+	const testKeyPath = "/foo/bar"
+	testKeyData := []byte("abc")
+
+	// Success
+	pr, err := newPRSLSAProvenance(PRSLSAProvenanceWithKeyPath(testKeyPath))
+	require.NoError(t, err)
+	assert.Equal(t, &prSLSAProvenance{
+		prCommon: prCommon{prTypeSLSAProvenance},
+		KeyPath:  testKeyPath,
+	}, pr)
+	pr, err = newPRSLSAProvenance(
+		PRSLSAProvenanceWithKeyData(testKeyData),
+		PRSLSAProvenanceWithBuilderID("https://example.com/builder"),
+		PRSLSAProvenanceWithSourceRepository("git+https://example.com/repo"),
+		PRSLSAProvenanceWithSourceBranch("main"),
+	)
+	require.NoError(t, err)
+	assert.Equal(t, &prSLSAProvenance{
+		prCommon:         prCommon{prTypeSLSAProvenance},
+		KeyData:          testKeyData,
+		BuilderID:        "https://example.com/builder",
+		SourceRepository: "git+https://example.com/repo",
+		SourceBranch:     "main",
+	}, pr)
+
+	for _, c := range [][]PRSLSAProvenanceOption{
+		{}, // Neither keyPath nor keyData specified
+		{ // Both keyPath and keyData specified
+			PRSLSAProvenanceWithKeyPath(testKeyPath),
+			PRSLSAProvenanceWithKeyData(testKeyData),
+		},
+		// Duplicate options
+		{
+			PRSLSAProvenanceWithKeyPath(testKeyPath),
+			PRSLSAProvenanceWithKeyPath(testKeyPath + "1"),
+		},
+		{
+			PRSLSAProvenanceWithKeyData(testKeyData),
+			PRSLSAProvenanceWithKeyData([]byte("def")),
+		},
+		{
+			PRSLSAProvenanceWithKeyPath(testKeyPath),
+			PRSLSAProvenanceWithBuilderID("a"),
+			PRSLSAProvenanceWithBuilderID("b"),
+		},
+		{
+			PRSLSAProvenanceWithKeyPath(testKeyPath),
+			PRSLSAProvenanceWithSourceRepository("a"),
+			PRSLSAProvenanceWithSourceRepository("b"),
+		},
+		{
+			PRSLSAProvenanceWithKeyPath(testKeyPath),
+			PRSLSAProvenanceWithSourceBranch("a"),
+			PRSLSAProvenanceWithSourceBranch("b"),
+		},
+		// Empty constraints
+		{PRSLSAProvenanceWithKeyPath(testKeyPath), PRSLSAProvenanceWithBuilderID("")},
+		{PRSLSAProvenanceWithKeyPath(testKeyPath), PRSLSAProvenanceWithSourceRepository("")},
+		{PRSLSAProvenanceWithKeyPath(testKeyPath), PRSLSAProvenanceWithSourceBranch("")},
+	} {
+		_, err = newPRSLSAProvenance(c...)
+		assert.Error(t, err)
+	}
+}
+
+func TestPRSLSAProvenanceUnmarshalJSON(t *testing.T) {
+	keyDataTests := policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSLSAProvenance{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSLSAProvenance(
+				PRSLSAProvenanceWithKeyData([]byte("abc")),
+				PRSLSAProvenanceWithBuilderID("https://example.com/builder"),
+				PRSLSAProvenanceWithSourceRepository("git+https://example.com/repo"),
+				PRSLSAProvenanceWithSourceBranch("main"),
+			)
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		breakFns: []func(mSA){
+			// The "type" field is missing
+			func(v mSA) { delete(v, "type") },
+			// Wrong "type" field
+			func(v mSA) { v["type"] = 1 },
+			func(v mSA) { v["type"] = "this is invalid" },
+			// Extra top-level sub-object
+			func(v mSA) { v["unexpected"] = 1 },
+			// Both "keyPath" and "keyData" is missing
+			func(v mSA) { delete(v, "keyData") },
+			// Both "keyPath" and "keyData" is present
+			func(v mSA) { v["keyPath"] = "/foo/bar" },
+			// Invalid "keyData" field
+			func(v mSA) { v["keyData"] = 1 },
+			func(v mSA) { v["keyData"] = "this is invalid base64" },
+			// Invalid constraint fields
+			func(v mSA) { v["builderID"] = 1 },
+			func(v mSA) { v["builderID"] = "" },
+			func(v mSA) { v["sourceRepository"] = 1 },
+			func(v mSA) { v["sourceRepository"] = "" },
+			func(v mSA) { v["sourceBranch"] = 1 },
+			func(v mSA) { v["sourceBranch"] = "" },
+		},
+		duplicateFields: []string{"type", "keyData", "builderID", "sourceRepository", "sourceBranch"},
+	}
+	keyDataTests.run(t)
+	// Test keyPath-specific aspects
+	keyPathTests := keyDataTests
+	keyPathTests.newValidObject = func() (PolicyRequirement, error) {
+		return NewPRSLSAProvenance(PRSLSAProvenanceWithKeyPath("/foo/bar"))
+	}
+	keyPathTests.breakFns = []func(mSA){
+		// Invalid "keyPath" field
+		func(v mSA) { v["keyPath"] = 1 },
+	}
+	keyPathTests.duplicateFields = []string{"type", "keyPath"}
+	keyPathTests.run(t)
+}
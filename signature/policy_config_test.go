@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/containers/image/v5/directory"
 	"github.com/containers/image/v5/docker"
@@ -15,6 +16,7 @@ import (
 	// this import is needed  where we use the "atomic" transport in TestPolicyUnmarshalJSON
 	_ "github.com/containers/image/v5/openshift"
 	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -116,6 +118,24 @@ var policyFixtureContents = &Policy{
 					PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
 				),
 			},
+			"example.com/digests/deny-example": {
+				xNewPRDigestList(DLModeDeny,
+					PRDigestListWithDigests([]digest.Digest{"sha256:0000000000000000000000000000000000000000000000000000000000000000"}),
+					PRDigestListWithDigestsPath("/etc/containers/denied-digests"),
+				),
+				NewPRInsecureAcceptAnything(),
+			},
+			"example.com/threshold/dual-control-example": {
+				xNewPRSignedByThreshold(2, PolicyRequirements{
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys,
+						"/keys/release-team-gpg-keyring",
+						NewPRMMatchRepoDigestOrExact()),
+					xNewPRSigstoreSigned(
+						PRSigstoreSignedWithKeyPath("/keys/security-team-public-key"),
+						PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+					),
+				}),
+			},
 		},
 	},
 }
@@ -257,6 +277,152 @@ func TestNewPolicyFromBytes(t *testing.T) {
 	assert.IsType(t, InvalidPolicyFormatError(""), err)
 }
 
+func TestNewPolicy(t *testing.T) {
+	// Success
+	policy, err := NewPolicy(PolicyRequirements{NewPRReject()})
+	require.NoError(t, err)
+	assert.Equal(t, &Policy{
+		Default:    PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{},
+	}, policy)
+
+	// Invalid default requirements
+	for _, reqs := range []PolicyRequirements{nil, {}, {nil}} {
+		_, err := NewPolicy(reqs)
+		assert.Error(t, err)
+	}
+}
+
+func TestPolicySetScopeRequirements(t *testing.T) {
+	policy, err := NewPolicy(PolicyRequirements{NewPRReject()})
+	require.NoError(t, err)
+	signedBy := xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "/keys/gpg-keyring", NewPRMMatchRepoDigestOrExact())
+
+	for _, c := range []struct{ transport, scope string }{
+		{"docker", ""},
+		{"docker", "example.com"},
+		{"docker", "*.example.com"},
+		{"docker", "example.com/ns/*"},
+		{"dir", "/some/path"},
+		{"this-transport-is-unknown", "anything"},
+	} {
+		err := policy.SetScopeRequirements(c.transport, c.scope, PolicyRequirements{signedBy})
+		require.NoError(t, err, c)
+	}
+	assert.Equal(t, map[string]PolicyTransportScopes{
+		"docker": {
+			"":                 {signedBy},
+			"example.com":      {signedBy},
+			"*.example.com":    {signedBy},
+			"example.com/ns/*": {signedBy},
+		},
+		"dir":                       {"/some/path": {signedBy}},
+		"this-transport-is-unknown": {"anything": {signedBy}},
+	}, policy.Transports)
+	// Replacing an existing scope
+	err = policy.SetScopeRequirements("docker", "example.com", PolicyRequirements{NewPRInsecureAcceptAnything()})
+	require.NoError(t, err)
+	assert.Equal(t, PolicyRequirements{NewPRInsecureAcceptAnything()}, policy.Transports["docker"]["example.com"])
+
+	// Failures
+	for _, c := range []struct {
+		transport, scope string
+		reqs             PolicyRequirements
+	}{
+		{"", "", PolicyRequirements{signedBy}},                 // Empty transport
+		{"dir", "relative/path", PolicyRequirements{signedBy}}, // Invalid scope
+		{"docker", "^(", PolicyRequirements{signedBy}},         // Invalid pattern
+		{"docker", "example.org", nil},                         // Invalid requirements
+		{"docker", "example.org", PolicyRequirements{}},
+		{"docker", "example.org", PolicyRequirements{nil}},
+	} {
+		err := policy.SetScopeRequirements(c.transport, c.scope, c.reqs)
+		assert.Error(t, err, c)
+	}
+	_, ok := policy.Transports["docker"]["example.org"]
+	assert.False(t, ok)
+
+	// A Policy created without NewPolicy
+	policy = &Policy{Default: PolicyRequirements{NewPRReject()}}
+	err = policy.SetScopeRequirements("docker", "example.com", PolicyRequirements{signedBy})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]PolicyTransportScopes{"docker": {"example.com": {signedBy}}}, policy.Transports)
+}
+
+func TestPolicyRemoveScope(t *testing.T) {
+	policy, err := NewPolicy(PolicyRequirements{NewPRReject()})
+	require.NoError(t, err)
+	for _, scope := range []string{"example.com", "example.org"} {
+		err := policy.SetScopeRequirements("docker", scope, PolicyRequirements{NewPRInsecureAcceptAnything()})
+		require.NoError(t, err)
+	}
+
+	policy.RemoveScope("docker", "example.com")
+	assert.Equal(t, map[string]PolicyTransportScopes{
+		"docker": {"example.org": {NewPRInsecureAcceptAnything()}},
+	}, policy.Transports)
+	// Removing nonexistent scopes and transports does nothing
+	policy.RemoveScope("docker", "example.com")
+	policy.RemoveScope("dir", "/some/path")
+	assert.Equal(t, map[string]PolicyTransportScopes{
+		"docker": {"example.org": {NewPRInsecureAcceptAnything()}},
+	}, policy.Transports)
+	// Removing the last scope removes the transport
+	policy.RemoveScope("docker", "example.org")
+	assert.Equal(t, map[string]PolicyTransportScopes{}, policy.Transports)
+}
+
+func TestPolicyValidate(t *testing.T) {
+	err := policyFixtureContents.Validate()
+	assert.NoError(t, err)
+
+	for _, policy := range []*Policy{
+		{},
+		{Default: PolicyRequirements{}},
+		{Default: PolicyRequirements{NewPRReject()}, Transports: map[string]PolicyTransportScopes{"": {"": {NewPRReject()}}}},
+		{Default: PolicyRequirements{NewPRReject()}, Transports: map[string]PolicyTransportScopes{"dir": {"relative/path": {NewPRReject()}}}},
+		{Default: PolicyRequirements{NewPRReject()}, Transports: map[string]PolicyTransportScopes{"docker": {"example.com": {}}}},
+		{Default: PolicyRequirements{NewPRReject()}, Transports: map[string]PolicyTransportScopes{"docker": {"example.com": {nil}}}},
+	} {
+		err := policy.Validate()
+		assert.Error(t, err)
+	}
+}
+
+func TestPolicyToBytes(t *testing.T) {
+	// The fixture round-trips
+	policyBytes, err := policyFixtureContents.ToBytes()
+	require.NoError(t, err)
+	policy, err := NewPolicyFromBytes(policyBytes)
+	require.NoError(t, err)
+	assert.Equal(t, policyFixtureContents, policy)
+
+	// A policy without transports
+	policyBytes, err = (&Policy{Default: PolicyRequirements{NewPRReject()}}).ToBytes()
+	require.NoError(t, err)
+	assert.Equal(t, "{\n    \"default\": [\n        {\n            \"type\": \"reject\"\n        }\n    ],\n    \"transports\": {}\n}\n", string(policyBytes))
+
+	// Invalid policy
+	_, err = (&Policy{}).ToBytes()
+	assert.Error(t, err)
+}
+
+func TestPolicyWriteToFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	err := policyFixtureContents.WriteToFile(path)
+	require.NoError(t, err)
+	policy, err := NewPolicyFromFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, policyFixtureContents, policy)
+
+	// Invalid policy
+	err = (&Policy{}).WriteToFile(filepath.Join(t.TempDir(), "invalid.json"))
+	assert.Error(t, err)
+	// Unwritable destination
+	err = policyFixtureContents.WriteToFile("/dev/null/this/does/not/exist")
+	assert.Error(t, err)
+}
+
 // FIXME? There is quite a bit of duplication below. Factor some of it out?
 
 // jsonUnmarshalFromObject is like json.Unmarshal(), but the input is an arbitrary object
@@ -581,10 +747,26 @@ func TestPolicyTransportScopesWithTransportUnmarshalJSON(t *testing.T) {
 		func(v mSA) {})
 	assert.Error(t, err)
 
+	// Invalid regular expression scope
+	err = tryUnmarshalModifiedPTS(t, &pts, docker.Transport, validJSON,
+		func(v mSA) { v["^("] = v[""] })
+	assert.Error(t, err)
+
+	// Pattern scopes are not validated by the transport
+	err = tryUnmarshalModifiedPTS(t, &pts, directory.Transport, validJSON,
+		func(v mSA) { maps.Clear(v); v["/srv/*/images"] = validJSON })
+	assert.Error(t, err) // validJSON is not a valid PolicyRequirements
+	err = tryUnmarshalModifiedPTS(t, &pts, directory.Transport, []byte(`{"":[{"type":"reject"}]}`),
+		func(v mSA) { v["/srv/*/images"] = v[""]; v[`^/srv/[a-z]+`] = v[""] })
+	assert.NoError(t, err)
+
 	// Various allowed modifications to the policy
 	allowedModificationFns := []func(mSA){
 		// The "" scope is missing
 		func(v mSA) { delete(v, "") },
+		// Glob and regular expression scopes
+		func(v mSA) { v["*.example.com/prod/*"] = v[""] },
+		func(v mSA) { v[`^example\.com/[a-z]+`] = v[""] },
 		// The policy is completely empty
 		func(v mSA) { maps.Clear(v) },
 	}
@@ -776,6 +958,59 @@ func TestNewPRSignedBy(t *testing.T) {
 	// Invalid signedIdentity
 	_, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, nil, nil, nil)
 	assert.Error(t, err)
+
+	// Options
+	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, nil, nil, testIdentity, PRSignedByWithMaxSignatureAge(90*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, &prSignedBy{
+		prCommon:        prCommon{prTypeSignedBy},
+		KeyType:         SBKeyTypeGPGKeys,
+		KeyPath:         testPath,
+		SignedIdentity:  testIdentity,
+		MaxSignatureAge: "1h30m0s",
+	}, pr)
+	// Invalid maxSignatureAge
+	for _, d := range []time.Duration{0, -time.Hour} {
+		_, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, nil, nil, testIdentity, PRSignedByWithMaxSignatureAge(d))
+		assert.Error(t, err)
+	}
+	// Duplicate maxSignatureAge
+	_, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, nil, nil, testIdentity,
+		PRSignedByWithMaxSignatureAge(time.Hour), PRSignedByWithMaxSignatureAge(time.Hour))
+	assert.Error(t, err)
+
+	// Revocation options
+	pr, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, nil, nil, testIdentity,
+		PRSignedByWithRevokedKeyFingerprints([]string{TestOtherFingerprint1}),
+		PRSignedByWithRevokedKeyFingerprintsPath("/revoked"),
+		PRSignedByWithRevocationFailureMode(RevocationFailureModeSoftFail))
+	require.NoError(t, err)
+	assert.Equal(t, &prSignedBy{
+		prCommon:                   prCommon{prTypeSignedBy},
+		KeyType:                    SBKeyTypeGPGKeys,
+		KeyPath:                    testPath,
+		SignedIdentity:             testIdentity,
+		RevokedKeyFingerprints:     []string{TestOtherFingerprint1},
+		RevokedKeyFingerprintsPath: "/revoked",
+		RevocationFailureMode:      RevocationFailureModeSoftFail,
+	}, pr)
+	for _, opts := range [][]PRSignedByOption{
+		// Duplicate options
+		{PRSignedByWithRevokedKeyFingerprints([]string{}), PRSignedByWithRevokedKeyFingerprints([]string{})},
+		{PRSignedByWithRevokedKeyFingerprintsPath("/1"), PRSignedByWithRevokedKeyFingerprintsPath("/2")},
+		{
+			PRSignedByWithRevokedKeyFingerprintsPath("/revoked"),
+			PRSignedByWithRevocationFailureMode(RevocationFailureModeSoftFail),
+			PRSignedByWithRevocationFailureMode(RevocationFailureModeSoftFail),
+		},
+		// Invalid revocationFailureMode
+		{PRSignedByWithRevokedKeyFingerprintsPath("/revoked"), PRSignedByWithRevocationFailureMode("this is invalid")},
+		// revocationFailureMode without revokedKeyFingerprintsPath
+		{PRSignedByWithRevokedKeyFingerprints([]string{TestOtherFingerprint1}), PRSignedByWithRevocationFailureMode(RevocationFailureModeHardFail)},
+	} {
+		_, err = newPRSignedBy(SBKeyTypeGPGKeys, testPath, nil, nil, testIdentity, opts...)
+		assert.Error(t, err)
+	}
 }
 
 func TestNewPRSignedByKeyPath(t *testing.T) {
@@ -881,6 +1116,49 @@ func TestPRSignedByUnmarshalJSON(t *testing.T) {
 		otherJSONParser: newPolicyRequirementFromJSON,
 		duplicateFields: []string{"type", "keyType", "keyPaths", "signedIdentity"},
 	}.run(t)
+	// Test the maxSignatureAge-specific aspects
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSignedBy{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSignedByKeyPath(SBKeyTypeGPGKeys, "/foo/bar", NewPRMMatchRepoDigestOrExact(),
+				PRSignedByWithMaxSignatureAge(720*time.Hour))
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		breakFns: []func(mSA){
+			// Invalid "maxSignatureAge" field
+			func(v mSA) { v["maxSignatureAge"] = 1 },
+			func(v mSA) { v["maxSignatureAge"] = "" },
+			func(v mSA) { v["maxSignatureAge"] = "this is invalid" },
+			func(v mSA) { v["maxSignatureAge"] = "0s" },
+			func(v mSA) { v["maxSignatureAge"] = "-1h" },
+		},
+		duplicateFields: []string{"type", "keyType", "keyPath", "signedIdentity", "maxSignatureAge"},
+	}.run(t)
+	// Test the revocation-specific aspects
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSignedBy{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSignedByKeyPath(SBKeyTypeGPGKeys, "/foo/bar", NewPRMMatchRepoDigestOrExact(),
+				PRSignedByWithRevokedKeyFingerprints([]string{TestOtherFingerprint1, TestOtherFingerprint2}),
+				PRSignedByWithRevokedKeyFingerprintsPath("/revoked"),
+				PRSignedByWithRevocationFailureMode(RevocationFailureModeSoftFail))
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		breakFns: []func(mSA){
+			// Invalid "revokedKeyFingerprints" field
+			func(v mSA) { v["revokedKeyFingerprints"] = 1 },
+			func(v mSA) { v["revokedKeyFingerprints"] = []int{1} },
+			// Invalid "revokedKeyFingerprintsPath" field
+			func(v mSA) { v["revokedKeyFingerprintsPath"] = 1 },
+			// Invalid "revocationFailureMode" field
+			func(v mSA) { v["revocationFailureMode"] = 1 },
+			func(v mSA) { v["revocationFailureMode"] = "this is invalid" },
+			// "revocationFailureMode" without "revokedKeyFingerprintsPath"
+			func(v mSA) { delete(v, "revokedKeyFingerprintsPath") },
+		},
+		duplicateFields: []string{"type", "keyType", "keyPath", "signedIdentity", "revokedKeyFingerprints",
+			"revokedKeyFingerprintsPath", "revocationFailureMode"},
+	}.run(t)
 
 	var pr prSignedBy
 
@@ -955,6 +1233,45 @@ func TestSBKeyTypeUnmarshalJSON(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestRevocationFailureModeIsValid(t *testing.T) {
+	// Valid values
+	for _, m := range []revocationFailureMode{
+		RevocationFailureModeHardFail,
+		RevocationFailureModeSoftFail,
+	} {
+		assert.True(t, m.IsValid())
+	}
+
+	// Invalid values
+	for _, s := range []string{"", "this is invalid"} {
+		assert.False(t, revocationFailureMode(s).IsValid())
+	}
+}
+
+func TestRevocationFailureModeUnmarshalJSON(t *testing.T) {
+	var m revocationFailureMode
+
+	testInvalidJSONInput(t, &m)
+
+	// Valid values.
+	for _, v := range []revocationFailureMode{
+		RevocationFailureModeHardFail,
+		RevocationFailureModeSoftFail,
+	} {
+		m = revocationFailureMode("")
+		err := json.Unmarshal([]byte(`"`+string(v)+`"`), &m)
+		assert.NoError(t, err)
+		assert.Equal(t, v, m)
+	}
+
+	// Invalid values
+	for _, input := range []string{`""`, `"this is invalid"`} {
+		m = revocationFailureMode("")
+		err := json.Unmarshal([]byte(input), &m)
+		assert.Error(t, err, input)
+	}
+}
+
 // NewPRSignedBaseLayer is like NewPRSignedBaseLayer, except it must not fail.
 func xNewPRSignedBaseLayer(baseLayerIdentity PolicyReferenceMatch) PolicyRequirement {
 	pr, err := NewPRSignedBaseLayer(baseLayerIdentity)
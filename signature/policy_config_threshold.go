@@ -0,0 +1,146 @@
+package signature
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/image/v5/signature/internal"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"golang.org/x/exp/slices"
+)
+
+// newPRSignedByThreshold is NewPRSignedByThreshold, except it returns the private type.
+func newPRSignedByThreshold(threshold int, signers PolicyRequirements) (*prSignedByThreshold, error) {
+	if len(signers) == 0 {
+		return nil, InvalidPolicyFormatError("signers must not be empty")
+	}
+	for i, signer := range signers {
+		switch signer.(type) {
+		case *prSignedBy, *prSigstoreSigned:
+		default:
+			return nil, InvalidPolicyFormatError(fmt.Sprintf("signer %d is not a signedBy or sigstoreSigned requirement", i+1))
+		}
+	}
+	if threshold < 1 || threshold > len(signers) {
+		return nil, InvalidPolicyFormatError(fmt.Sprintf("invalid threshold %d: must be between 1 and the number of signers, %d", threshold, len(signers)))
+	}
+	keyUsers := map[string]int{} // thresholdSignerKeys value -> index of the signer using it
+	for i, signer := range signers {
+		for _, key := range thresholdSignerKeys(signer) {
+			if other, ok := keyUsers[key]; ok && other != i {
+				return nil, InvalidPolicyFormatError(fmt.Sprintf("signers %d and %d use the same key material (%s)", other+1, i+1, key))
+			}
+			keyUsers[key] = i
+		}
+	}
+	return &prSignedByThreshold{
+		prCommon:  prCommon{Type: prTypeSignedByThreshold},
+		Threshold: threshold,
+		Signers:   signers,
+	}, nil
+}
+
+// thresholdSignerKeys returns values identifying the key material used by signer, for detecting signers which share keys:
+// the sources of the keys, and the fingerprints of keys which can be read now.
+// Key files which can't be read or parsed now are ignored; evaluation still counts only signatures by distinct keys.
+func thresholdSignerKeys(signer PolicyRequirement) []string {
+	res := []string{}
+	switch s := signer.(type) {
+	case *prSignedBy:
+		paths := slices.Clone(s.KeyPaths)
+		if s.KeyPath != "" {
+			paths = append(paths, s.KeyPath)
+		}
+		keyrings := [][]byte{}
+		for _, path := range paths {
+			res = append(res, "file "+filepath.Clean(path))
+			if data, err := os.ReadFile(path); err == nil {
+				keyrings = append(keyrings, data)
+			}
+		}
+		if s.KeyData != nil {
+			keyrings = append(keyrings, s.KeyData)
+		}
+		for _, keyring := range keyrings {
+			mech, fingerprints, err := newEphemeralGPGSigningMechanism([][]byte{keyring})
+			if err != nil {
+				continue
+			}
+			mech.Close()
+			for _, fingerprint := range fingerprints {
+				res = append(res, "key "+strings.ToLower(fingerprint))
+			}
+		}
+	case *prSigstoreSigned:
+		if s.KeyPath != "" {
+			res = append(res, "file "+filepath.Clean(s.KeyPath))
+		}
+		if publicKeyPEM, err := loadBytesFromDataOrPath("key", s.KeyData, s.KeyPath); err == nil && publicKeyPEM != nil {
+			if publicKey, err := cryptoutils.UnmarshalPEMToPublicKey(publicKeyPEM); err == nil {
+				if fingerprint, err := publicKeyFingerprint(publicKey); err == nil {
+					res = append(res, "key "+fingerprint)
+				}
+			}
+		}
+		if f, ok := s.Fulcio.(*prSigstoreSignedFulcio); ok && f.OIDCIssuer != "" {
+			for _, subject := range []string{f.SubjectEmail, f.SubjectURI} {
+				if subject != "" {
+					res = append(res, fmt.Sprintf("Fulcio identity %s from %s", subject, f.OIDCIssuer))
+				}
+			}
+		}
+	}
+	return res
+}
+
+// NewPRSignedByThreshold returns a new "signedByThreshold" PolicyRequirement, accepting images accepted by
+// at least threshold of signers. Each of signers must be a "signedBy" or "sigstoreSigned" requirement, and the signers
+// must not share keys; each signer counts only if it accepts a signature by a key not used for another counted signer.
+func NewPRSignedByThreshold(threshold int, signers PolicyRequirements) (PolicyRequirement, error) {
+	return newPRSignedByThreshold(threshold, signers)
+}
+
+// Compile-time check that prSignedByThreshold implements json.Unmarshaler.
+var _ json.Unmarshaler = (*prSignedByThreshold)(nil)
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (pr *prSignedByThreshold) UnmarshalJSON(data []byte) error {
+	*pr = prSignedByThreshold{}
+	var tmp prSignedByThreshold
+	var gotThreshold, gotSigners bool
+	if err := internal.ParanoidUnmarshalJSONObject(data, func(key string) any {
+		switch key {
+		case "type":
+			return &tmp.Type
+		case "threshold":
+			gotThreshold = true
+			return &tmp.Threshold
+		case "signers":
+			gotSigners = true
+			return &tmp.Signers
+		default:
+			return nil
+		}
+	}); err != nil {
+		return err
+	}
+
+	if tmp.Type != prTypeSignedByThreshold {
+		return InvalidPolicyFormatError(fmt.Sprintf("Unexpected policy requirement type \"%s\"", tmp.Type))
+	}
+	if !gotThreshold {
+		return InvalidPolicyFormatError("threshold not specified")
+	}
+	if !gotSigners {
+		return InvalidPolicyFormatError("signers not specified")
+	}
+	res, err := newPRSignedByThreshold(tmp.Threshold, tmp.Signers)
+	if err != nil {
+		return err
+	}
+	*pr = *res
+	return nil
+}
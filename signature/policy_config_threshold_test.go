@@ -0,0 +1,143 @@
+package signature
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// xNewPRSignedByThreshold is like NewPRSignedByThreshold, except it must not fail.
+func xNewPRSignedByThreshold(threshold int, signers PolicyRequirements) PolicyRequirement {
+	pr, err := NewPRSignedByThreshold(threshold, signers)
+	if err != nil {
+		panic("xNewPRSignedByThreshold failed")
+	}
+	return pr
+}
+
+func TestNewPRSignedByThreshold(t *testing.T) {
+	signers := PolicyRequirements{
+		xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "/keys/gpg-keyring", NewPRMMatchRepoDigestOrExact()),
+		xNewPRSigstoreSigned(PRSigstoreSignedWithKeyPath("/keys/public-key"), PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository())),
+	}
+
+	// Success
+	for _, threshold := range []int{1, 2} {
+		pr, err := newPRSignedByThreshold(threshold, signers)
+		require.NoError(t, err)
+		assert.Equal(t, &prSignedByThreshold{
+			prCommon:  prCommon{prTypeSignedByThreshold},
+			Threshold: threshold,
+			Signers:   signers,
+		}, pr)
+	}
+
+	// Invalid threshold
+	for _, threshold := range []int{-1, 0, 3} {
+		_, err := newPRSignedByThreshold(threshold, signers)
+		assert.Error(t, err)
+	}
+	// No signers
+	for _, s := range []PolicyRequirements{nil, {}} {
+		_, err := newPRSignedByThreshold(1, s)
+		assert.Error(t, err)
+	}
+	// Signers which don’t represent an identity
+	for _, s := range []PolicyRequirement{
+		NewPRInsecureAcceptAnything(),
+		NewPRReject(),
+		xNewPRSignedByThreshold(1, signers),
+	} {
+		_, err := newPRSignedByThreshold(1, PolicyRequirements{signers[0], s})
+		assert.Error(t, err)
+	}
+
+	// Signers sharing key material
+	gpgKey, err := os.ReadFile("fixtures/public-key.gpg")
+	require.NoError(t, err)
+	sigstoreKey, err := os.ReadFile("fixtures/cosign.pub")
+	require.NoError(t, err)
+	fulcio1, err := NewPRSigstoreSignedFulcio(PRSigstoreSignedFulcioWithCAPath("fixtures/fulcio_v1.crt.pem"),
+		PRSigstoreSignedFulcioWithOIDCIssuer("https://github.com/login/oauth"), PRSigstoreSignedFulcioWithSubjectEmail("mitr@redhat.com"))
+	require.NoError(t, err)
+	fulcio2, err := NewPRSigstoreSignedFulcio(PRSigstoreSignedFulcioWithCAData([]byte("other CA")),
+		PRSigstoreSignedFulcioWithOIDCIssuer("https://github.com/login/oauth"), PRSigstoreSignedFulcioWithSubjectEmail("mitr@redhat.com"))
+	require.NoError(t, err)
+	for _, c := range []PolicyRequirements{
+		{signers[0], signers[0]},
+		{signers[1], signers[1]},
+		{ // The same file
+			xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "/keys/gpg-keyring", NewPRMMatchRepoDigestOrExact()),
+			xNewPRSignedByKeyPaths(SBKeyTypeGPGKeys, []string{"/keys/other-keyring", "/keys/../keys/gpg-keyring"}, NewPRMMatchRepository()),
+		},
+		{ // The same GPG key, in a file and inline
+			xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchRepoDigestOrExact()),
+			xNewPRSignedByKeyData(SBKeyTypeGPGKeys, gpgKey, NewPRMMatchRepository()),
+		},
+		{ // A GPG key also included in a larger keyring
+			xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key-2.gpg", NewPRMMatchRepoDigestOrExact()),
+			xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/pubring.gpg", NewPRMMatchRepository()),
+		},
+		{ // The same sigstore key, in a file and inline
+			xNewPRSigstoreSigned(PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"), PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository())),
+			xNewPRSigstoreSigned(PRSigstoreSignedWithKeyData(sigstoreKey), PRSigstoreSignedWithSignedIdentity(NewPRMMatchExact())),
+		},
+		{ // The same Fulcio identity
+			xNewPRSigstoreSigned(PRSigstoreSignedWithFulcio(fulcio1), PRSigstoreSignedWithRekorPublicKeyPath("fixtures/rekor.pub"),
+				PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository())),
+			xNewPRSigstoreSigned(PRSigstoreSignedWithFulcio(fulcio2), PRSigstoreSignedWithRekorPublicKeyPath("fixtures/rekor.pub"),
+				PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository())),
+		},
+	} {
+		_, err := newPRSignedByThreshold(1, c)
+		assert.Error(t, err)
+	}
+	// Different keys
+	_, err = newPRSignedByThreshold(2, PolicyRequirements{
+		xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key-1.gpg", NewPRMMatchRepoDigestOrExact()),
+		xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key-2.gpg", NewPRMMatchRepoDigestOrExact()),
+		xNewPRSigstoreSigned(PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"), PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository())),
+		xNewPRSigstoreSigned(PRSigstoreSignedWithKeyPath("fixtures/cosign2.pub"), PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository())),
+	})
+	assert.NoError(t, err)
+}
+
+func TestPRSignedByThresholdUnmarshalJSON(t *testing.T) {
+	policyJSONUmarshallerTests[PolicyRequirement]{
+		newDest: func() json.Unmarshaler { return &prSignedByThreshold{} },
+		newValidObject: func() (PolicyRequirement, error) {
+			return NewPRSignedByThreshold(2, PolicyRequirements{
+				xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "/keys/gpg-keyring", NewPRMMatchRepoDigestOrExact()),
+				xNewPRSigstoreSigned(PRSigstoreSignedWithKeyPath("/keys/public-key"), PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository())),
+			})
+		},
+		otherJSONParser: newPolicyRequirementFromJSON,
+		breakFns: []func(mSA){
+			// The "type" field is missing
+			func(v mSA) { delete(v, "type") },
+			// Wrong "type" field
+			func(v mSA) { v["type"] = 1 },
+			func(v mSA) { v["type"] = "this is invalid" },
+			// Extra top-level sub-object
+			func(v mSA) { v["unexpected"] = 1 },
+			// The "threshold" field is missing
+			func(v mSA) { delete(v, "threshold") },
+			// Invalid "threshold" field
+			func(v mSA) { v["threshold"] = "1" },
+			func(v mSA) { v["threshold"] = 1.5 },
+			func(v mSA) { v["threshold"] = 0 },
+			func(v mSA) { v["threshold"] = 3 },
+			// The "signers" field is missing
+			func(v mSA) { delete(v, "signers") },
+			// Invalid "signers" field
+			func(v mSA) { v["signers"] = 1 },
+			func(v mSA) { v["signers"] = []any{} },
+			func(v mSA) { v["signers"] = []any{1, 2} },
+			func(v mSA) { v["signers"] = []any{mSA{"type": "insecureAcceptAnything"}, mSA{"type": "reject"}} },
+		},
+		duplicateFields: []string{"type", "threshold", "signers"},
+	}.run(t)
+}
@@ -10,9 +10,10 @@ import (
 	"fmt"
 
 	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/tracing"
 	"github.com/containers/image/v5/internal/unparsedimage"
+	"github.com/containers/image/v5/pkg/logging"
 	"github.com/containers/image/v5/types"
-	"github.com/sirupsen/logrus"
 )
 
 // PolicyRequirementError is an explanatory text for rejecting a signature or an image.
@@ -81,6 +82,11 @@ type PolicyReferenceMatch interface {
 type PolicyContext struct {
 	Policy *Policy
 	state  policyContextState // Internal consistency checking
+
+	tracing       bool                            // Set by SetTracing
+	lastTrace     *PolicyEvaluationTrace          // Or nil; see LastTrace
+	logger        types.Logger                    // Set by SetLogger
+	scopePatterns map[string][]policyScopePattern // Glob and regular expression scopes of Policy, by transport name
 }
 
 // policyContextState is used internally to verify the users are not misusing a PolicyContext.
@@ -107,7 +113,11 @@ func (pc *PolicyContext) changeState(expected, new policyContextState) error {
 // The policy must not be modified while the context exists. FIXME: make a deep copy?
 // If this function succeeds, the caller should call PolicyContext.Destroy() when done.
 func NewPolicyContext(policy *Policy) (*PolicyContext, error) {
-	pc := &PolicyContext{Policy: policy, state: pcInitializing}
+	scopePatterns, err := compilePolicyScopePatterns(policy)
+	if err != nil {
+		return nil, err
+	}
+	pc := &PolicyContext{Policy: policy, state: pcInitializing, logger: logging.For(nil), scopePatterns: scopePatterns}
 	// FIXME: initialize
 	if err := pc.changeState(pcInitializing, pcReady); err != nil {
 		// Huh?! This should never fail, we didn't give the pointer to anybody.
@@ -117,6 +127,12 @@ func NewPolicyContext(policy *Policy) (*PolicyContext, error) {
 	return pc, nil
 }
 
+// SetLogger sets the logger used for messages about policy evaluation; by default, the standard logrus logger is used.
+// Note that messages logged by individual policy requirements still use the standard logrus logger.
+func (pc *PolicyContext) SetLogger(logger types.Logger) {
+	pc.logger = logger
+}
+
 // Destroy should be called when the user of the context is done with it.
 func (pc *PolicyContext) Destroy() error {
 	if err := pc.changeState(pcReady, pcDestroying); err != nil {
@@ -132,35 +148,61 @@ func policyIdentityLogName(ref types.ImageReference) string {
 	return ref.Transport().Name() + ":" + ref.PolicyConfigurationIdentity()
 }
 
+// policyScope describes which part of a policy was selected for an image.
+// ONLY use this for diagnostics, not for any decisions!
+type policyScope struct {
+	transport   string
+	scope       string // Within transport; not meaningful if usedDefault
+	usedDefault bool
+}
+
 // requirementsForImageRef selects the appropriate requirements for ref.
 func (pc *PolicyContext) requirementsForImageRef(ref types.ImageReference) PolicyRequirements {
+	reqs, _ := pc.requirementsAndScopeForImageRef(ref)
+	return reqs
+}
+
+// requirementsAndScopeForImageRef selects the appropriate requirements for ref, and returns a description of the selected scope.
+func (pc *PolicyContext) requirementsAndScopeForImageRef(ref types.ImageReference) (PolicyRequirements, policyScope) {
 	// Do we have a PolicyTransportScopes for this transport?
 	transportName := ref.Transport().Name()
+	scope := policyScope{transport: transportName}
 	if transportScopes, ok := pc.Policy.Transports[transportName]; ok {
 		// Look for a full match.
 		identity := ref.PolicyConfigurationIdentity()
 		if req, ok := transportScopes[identity]; ok {
-			logrus.Debugf(` Using transport "%s" policy section %s`, transportName, identity)
-			return req
+			pc.logger.Debugf(` Using transport "%s" policy section %s`, transportName, identity)
+			scope.scope = identity
+			return req, scope
 		}
 
 		// Look for a match of the possible parent namespaces.
-		for _, name := range ref.PolicyConfigurationNamespaces() {
+		namespaces := ref.PolicyConfigurationNamespaces()
+		for _, name := range namespaces {
 			if req, ok := transportScopes[name]; ok {
-				logrus.Debugf(` Using transport "%s" specific policy section %s`, transportName, name)
-				return req
+				pc.logger.Debugf(` Using transport "%s" specific policy section %s`, transportName, name)
+				scope.scope = name
+				return req, scope
 			}
 		}
 
+		// Look for a match of glob and regular expression scopes.
+		if name, req, ok := matchPolicyScopePatterns(pc.scopePatterns[transportName], transportScopes, identity, namespaces); ok {
+			pc.logger.Debugf(` Using transport "%s" pattern policy section %s`, transportName, name)
+			scope.scope = name
+			return req, scope
+		}
+
 		// Look for a default match for the transport.
 		if req, ok := transportScopes[""]; ok {
-			logrus.Debugf(` Using transport "%s" policy section ""`, transportName)
-			return req
+			pc.logger.Debugf(` Using transport "%s" policy section ""`, transportName)
+			return req, scope
 		}
 	}
 
-	logrus.Debugf(" Using default policy section")
-	return pc.Policy.Default
+	pc.logger.Debugf(" Using default policy section")
+	scope.usedDefault = true
+	return pc.Policy.Default, scope
 }
 
 // GetSignaturesWithAcceptedAuthor returns those signatures from an image
@@ -189,12 +231,16 @@ func (pc *PolicyContext) GetSignaturesWithAcceptedAuthor(ctx context.Context, pu
 
 	image := unparsedimage.FromPublic(publicImage)
 
-	logrus.Debugf("GetSignaturesWithAcceptedAuthor for image %s", policyIdentityLogName(image.Reference()))
-	reqs := pc.requirementsForImageRef(image.Reference())
+	pc.logger.Debugf("GetSignaturesWithAcceptedAuthor for image %s", policyIdentityLogName(image.Reference()))
+	reqs, scope := pc.requirementsAndScopeForImageRef(image.Reference())
+	trace := pc.newTrace(image.Reference(), reqs, scope)
 
 	// FIXME: Use image.UntrustedSignatures, use that to improve error messages (needs tests!)
 	unverifiedSignatures, err := image.Signatures(ctx)
 	if err != nil {
+		if trace != nil {
+			trace.Error = err.Error()
+		}
 		return nil, err
 	}
 
@@ -203,51 +249,64 @@ func (pc *PolicyContext) GetSignaturesWithAcceptedAuthor(ctx context.Context, pu
 		var acceptedSig *Signature // non-nil if accepted
 		rejected := false
 		// FIXME? Say more about the contents of the signature, i.e. parse it even before verification?!
-		logrus.Debugf("Evaluating signature %d:", sigNumber)
+		pc.logger.Debugf("Evaluating signature %d:", sigNumber)
 	interpretingReqs:
 		for reqNumber, req := range reqs {
 			// FIXME: Log the requirement itself? For now, we use just the number.
 			// FIXME: supply state
-			switch res, as, err := req.isSignatureAuthorAccepted(ctx, image, sig); res {
+			res, as, err := req.isSignatureAuthorAccepted(ctx, image, sig)
+			if trace != nil {
+				reqTrace := &trace.Requirements[reqNumber]
+				reqTrace.Evaluated = true
+				result := sigTraceUnknown
+				switch res {
+				case sarAccepted:
+					result = sigTraceAccepted
+				case sarRejected:
+					result = sigTraceRejected
+				}
+				reqTrace.Signatures = append(reqTrace.Signatures, PolicySignatureTrace{Index: sigNumber, Result: result, Error: errorString(err)})
+			}
+			switch res {
 			case sarAccepted:
 				if as == nil { // Coverage: this should never happen
-					logrus.Debugf(" Requirement %d: internal inconsistency: sarAccepted but no parsed contents", reqNumber)
+					pc.logger.Debugf(" Requirement %d: internal inconsistency: sarAccepted but no parsed contents", reqNumber)
 					rejected = true
 					break interpretingReqs
 				}
-				logrus.Debugf(" Requirement %d: signature accepted", reqNumber)
+				pc.logger.Debugf(" Requirement %d: signature accepted", reqNumber)
 				if acceptedSig == nil {
 					acceptedSig = as
 				} else if *as != *acceptedSig { // Coverage: this should never happen
 					// Huh?! Two ways of verifying the same signature blob resulted in two different parses of its already accepted contents?
-					logrus.Debugf(" Requirement %d: internal inconsistency: sarAccepted but different parsed contents", reqNumber)
+					pc.logger.Debugf(" Requirement %d: internal inconsistency: sarAccepted but different parsed contents", reqNumber)
 					rejected = true
 					acceptedSig = nil
 					break interpretingReqs
 				}
 			case sarRejected:
-				logrus.Debugf(" Requirement %d: signature rejected: %s", reqNumber, err.Error())
+				pc.logger.Debugf(" Requirement %d: signature rejected: %s", reqNumber, err.Error())
 				rejected = true
 				break interpretingReqs
 			case sarUnknown:
 				if err != nil { // Coverage: this should never happen
-					logrus.Debugf(" Requirement %d: internal inconsistency: sarUnknown but an error message %s", reqNumber, err.Error())
+					pc.logger.Debugf(" Requirement %d: internal inconsistency: sarUnknown but an error message %s", reqNumber, err.Error())
 					rejected = true
 					break interpretingReqs
 				}
-				logrus.Debugf(" Requirement %d: signature state unknown, continuing", reqNumber)
+				pc.logger.Debugf(" Requirement %d: signature state unknown, continuing", reqNumber)
 			default: // Coverage: this should never happen
-				logrus.Debugf(" Requirement %d: internal inconsistency: unknown result %#v", reqNumber, string(res))
+				pc.logger.Debugf(" Requirement %d: internal inconsistency: unknown result %#v", reqNumber, string(res))
 				rejected = true
 				break interpretingReqs
 			}
 		}
 		// This also handles the (invalid) case of empty reqs, by rejecting the signature.
 		if acceptedSig != nil && !rejected {
-			logrus.Debugf(" Overall: OK, signature accepted")
+			pc.logger.Debugf(" Overall: OK, signature accepted")
 			res = append(res, acceptedSig)
 		} else {
-			logrus.Debugf(" Overall: Signature not accepted")
+			pc.logger.Debugf(" Overall: Signature not accepted")
 		}
 	}
 	return res, nil
@@ -258,7 +317,33 @@ func (pc *PolicyContext) GetSignaturesWithAcceptedAuthor(ctx context.Context, pu
 // succeeded but the result was rejection.
 // WARNING: This validates signatures and the manifest, but does not download or validate the
 // layers. Users must validate that the layers match their expected digests.
-func (pc *PolicyContext) IsRunningImageAllowed(ctx context.Context, publicImage types.UnparsedImage) (res bool, finalErr error) {
+func (pc *PolicyContext) IsRunningImageAllowed(ctx context.Context, publicImage types.UnparsedImage) (bool, error) {
+	return pc.isRunningImageAllowed(ctx, publicImage, nil)
+}
+
+// IsRunningImageAllowedWithDetails is like IsRunningImageAllowed, but if the image is allowed,
+// it also returns details about how the policy requirements were satisfied (e.g. the keys and signer identities
+// of the accepted signatures). The details are nil if the image is not allowed.
+// WARNING: This validates signatures and the manifest, but does not download or validate the
+// layers. Users must validate that the layers match their expected digests.
+func (pc *PolicyContext) IsRunningImageAllowedWithDetails(ctx context.Context, publicImage types.UnparsedImage) (bool, *ImageAcceptanceDetails, error) {
+	details := &ImageAcceptanceDetails{}
+	allowed, err := pc.isRunningImageAllowed(ctx, publicImage, details)
+	if !allowed {
+		return false, nil, err
+	}
+	return true, details, nil
+}
+
+// isRunningImageAllowed implements IsRunningImageAllowed and IsRunningImageAllowedWithDetails.
+// If details is not nil, it is filled with details about the evaluation; that is only meaningful if the image is allowed.
+func (pc *PolicyContext) isRunningImageAllowed(ctx context.Context, publicImage types.UnparsedImage, details *ImageAcceptanceDetails) (res bool, finalErr error) {
+	ctx, span := tracing.Start(ctx, "signature.IsRunningImageAllowed")
+	defer func() {
+		span.SetAttributes(tracing.AttributeAllowed.Bool(res))
+		tracing.End(span, finalErr)
+	}()
+
 	if err := pc.changeState(pcReady, pcInUse); err != nil {
 		return false, err
 	}
@@ -271,23 +356,66 @@ func (pc *PolicyContext) IsRunningImageAllowed(ctx context.Context, publicImage
 
 	image := unparsedimage.FromPublic(publicImage)
 
-	logrus.Debugf("IsRunningImageAllowed for image %s", policyIdentityLogName(image.Reference()))
-	reqs := pc.requirementsForImageRef(image.Reference())
+	pc.logger.Debugf("IsRunningImageAllowed for image %s", policyIdentityLogName(image.Reference()))
+	span.SetAttributes(tracing.AttributeImage.String(policyIdentityLogName(image.Reference())))
+	reqs, scope := pc.requirementsAndScopeForImageRef(image.Reference())
+	trace := pc.newTrace(image.Reference(), reqs, scope)
+	if details != nil {
+		*details = ImageAcceptanceDetails{
+			Transport:         scope.transport,
+			Scope:             scope.scope,
+			UsedDefaultPolicy: scope.usedDefault,
+			Requirements:      make([]RequirementAcceptanceDetails, len(reqs)),
+		}
+		for i, req := range reqs {
+			details.Requirements[i].Type = policyRequirementTypeName(req)
+		}
+	}
 
 	if len(reqs) == 0 {
-		return false, PolicyRequirementError("List of verification policy requirements must not be empty")
+		var err error = PolicyRequirementError("List of verification policy requirements must not be empty")
+		if scope.usedDefault {
+			err = PolicyScopeNotFoundError{err: err}
+		}
+		if trace != nil {
+			trace.Error = err.Error()
+		}
+		return false, err
 	}
 
 	for reqNumber, req := range reqs {
+		var reqTrace *PolicyRequirementTrace // = nil
+		if trace != nil {
+			reqTrace = &trace.Requirements[reqNumber]
+			reqTrace.Evaluated = true
+		}
+		var reqDetails *RequirementAcceptanceDetails // = nil
+		if details != nil {
+			reqDetails = &details.Requirements[reqNumber]
+		}
 		// FIXME: supply state
-		allowed, err := req.isRunningImageAllowed(ctx, image)
+		reqCtx := contextWithAcceptanceDetails(contextWithRequirementTrace(ctx, reqTrace), reqDetails)
+		reqCtx, reqSpan := tracing.Start(reqCtx, "signature.PolicyRequirement", tracing.AttributeRequirement.String(policyRequirementTypeName(req)))
+		allowed, err := req.isRunningImageAllowed(reqCtx, image)
+		reqSpan.SetAttributes(tracing.AttributeAllowed.Bool(allowed))
+		tracing.End(reqSpan, err)
 		if !allowed {
-			logrus.Debugf("Requirement %d: denied, done", reqNumber)
+			pc.logger.Debugf("Requirement %d: denied, done", reqNumber)
+			if trace != nil {
+				reqTrace.Error = errorString(err)
+				trace.Error = errorString(err)
+			}
 			return false, err
 		}
-		logrus.Debugf(" Requirement %d: allowed", reqNumber)
+		if reqTrace != nil {
+			reqTrace.Allowed = true
+		}
+		pc.logger.Debugf(" Requirement %d: allowed", reqNumber)
 	}
 	// We have tested that len(reqs) != 0, so at least one req must have explicitly allowed this image.
-	logrus.Debugf("Overall: allowed")
+	pc.logger.Debugf("Overall: allowed")
+	if trace != nil {
+		trace.Allowed = true
+	}
 	return true, nil
 }
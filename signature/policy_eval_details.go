@@ -0,0 +1,105 @@
+package signature
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
+// ImageAcceptanceDetails describes why PolicyContext.IsRunningImageAllowedWithDetails allowed an image,
+// e.g. so that admission controllers can log or expose who vouched for a running image.
+type ImageAcceptanceDetails struct {
+	// Transport is the name of the transport of the image.
+	Transport string
+	// Scope is the scope within the transport’s section of the policy which was used, "" for the transport’s default scope.
+	// Not meaningful if UsedDefaultPolicy.
+	Scope string
+	// UsedDefaultPolicy is true if there was no matching scope and the top-level "default" requirements were used.
+	UsedDefaultPolicy bool
+	// Requirements contains one entry for each requirement of the used scope, in policy order.
+	// All of them were satisfied.
+	Requirements []RequirementAcceptanceDetails
+}
+
+// RequirementAcceptanceDetails describes how a single PolicyRequirement was satisfied.
+type RequirementAcceptanceDetails struct {
+	// Type is the type of the requirement, as used in policy.json (e.g. "signedBy").
+	Type string
+	// Signatures contains the signatures which satisfied the requirement.
+	// It is empty for requirements which are not based on signatures, e.g. "insecureAcceptAnything".
+	// For "signedByThreshold", it contains a signature for each accepted signer.
+	Signatures []AcceptedSignatureDetails
+}
+
+// AcceptedSignatureDetails describes a signature which satisfied a PolicyRequirement.
+// All values have been verified, they are not just claims made by the signature.
+type AcceptedSignatureDetails struct {
+	// Index is the index of the signature in the image’s list of signatures.
+	Index int
+	// Format is the format of the signature, "simple-signing" or "sigstore-json".
+	Format string
+	// DockerReference is the image identity recorded in the signature.
+	DockerReference string
+	// DockerManifestDigest is the manifest digest recorded in the signature.
+	DockerManifestDigest digest.Digest
+	// KeyFingerprint identifies the key which created the signature.
+	// For simple signing, this is the fingerprint of the GPG key;
+	// for sigstore, this is the hex-encoded SHA-256 digest of the DER-encoded (PKIX) public key.
+	KeyFingerprint string
+	// SignerIdentity is the identity (email address or URI) of a signer authenticated by Fulcio, or "" if Fulcio was not used.
+	SignerIdentity string
+	// OIDCIssuer is the OIDC issuer which authenticated SignerIdentity, or "" if Fulcio was not used.
+	OIDCIssuer string
+	// RekorLogIndex is the index of the signature in a Rekor transparency log, or nil if Rekor was not used.
+	RekorLogIndex *int64
+}
+
+// acceptanceDetailsKey is the context key for a *RequirementAcceptanceDetails collecting accepted signatures.
+type acceptanceDetailsKey struct{}
+
+// contextWithAcceptanceDetails returns a context which causes recordAcceptedSignature to record into details, if details is not nil.
+func contextWithAcceptanceDetails(ctx context.Context, details *RequirementAcceptanceDetails) context.Context {
+	if details == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, acceptanceDetailsKey{}, details)
+}
+
+// allAcceptedSignaturesKey is the context key marking that signature-based requirements should record all accepted signatures.
+type allAcceptedSignaturesKey struct{}
+
+// contextRecordingAllAcceptedSignatures returns a context which causes signature-based requirements to record all accepted
+// signatures into details, instead of stopping after the first accepted one.
+func contextRecordingAllAcceptedSignatures(ctx context.Context, details *RequirementAcceptanceDetails) context.Context {
+	return context.WithValue(contextWithAcceptanceDetails(ctx, details), allAcceptedSignaturesKey{}, true)
+}
+
+// recordingAllAcceptedSignatures returns true if ctx was set up using contextRecordingAllAcceptedSignatures.
+func recordingAllAcceptedSignatures(ctx context.Context) bool {
+	res, _ := ctx.Value(allAcceptedSignaturesKey{}).(bool)
+	return res
+}
+
+// recordAcceptedSignature records an accepted signature, if ctx was set up using contextWithAcceptanceDetails.
+func recordAcceptedSignature(ctx context.Context, sig AcceptedSignatureDetails) {
+	details, ok := ctx.Value(acceptanceDetailsKey{}).(*RequirementAcceptanceDetails)
+	if !ok {
+		return
+	}
+	details.Signatures = append(details.Signatures, sig)
+}
+
+// publicKeyFingerprint returns the value of AcceptedSignatureDetails.KeyFingerprint for a sigstore publicKey.
+func publicKeyFingerprint(publicKey crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("marshaling public key: %w", err)
+	}
+	hash := sha256.Sum256(der)
+	return hex.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,186 @@
+package signature
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// manifestDigestOfDir returns the digest of the manifest in dir.
+func manifestDigestOfDir(t *testing.T, dir string) string {
+	m, err := os.ReadFile(dir + "/manifest.json")
+	require.NoError(t, err)
+	d, err := manifest.Digest(m)
+	require.NoError(t, err)
+	return d.String()
+}
+
+// publicKeyFingerprintOfFile returns publicKeyFingerprint of the PEM-encoded public key in path.
+func publicKeyFingerprintOfFile(t *testing.T, path string) string {
+	pem, err := os.ReadFile(path)
+	require.NoError(t, err)
+	pk, err := cryptoutils.UnmarshalPEMToPublicKey(pem)
+	require.NoError(t, err)
+	res, err := publicKeyFingerprint(pk)
+	require.NoError(t, err)
+	return res
+}
+
+func TestPolicyContextIsRunningImageAllowedWithDetails(t *testing.T) {
+	fulcio, err := NewPRSigstoreSignedFulcio(
+		PRSigstoreSignedFulcioWithCAPath("fixtures/fulcio_v1.crt.pem"),
+		PRSigstoreSignedFulcioWithOIDCIssuer("https://github.com/login/oauth"),
+		PRSigstoreSignedFulcioWithSubjectEmail("mitr@redhat.com"),
+	)
+	require.NoError(t, err)
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"docker.io/testing/manifest:latest": {
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchExact()),
+				},
+				"docker.io/testing/manifest:rejected": {
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchRepository()),
+					NewPRReject(),
+				},
+				"docker.io/testing": {
+					NewPRInsecureAcceptAnything(),
+				},
+				"192.168.64.2:5000/cosign-signed/key-1": {
+					xNewPRSigstoreSigned(
+						PRSigstoreSignedWithKeyPath("fixtures/cosign2.pub"),
+						PRSigstoreSignedWithRekorPublicKeyPath("fixtures/rekor.pub"),
+						PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+					),
+				},
+				"192.168.64.2:5000/cosign-signed/fulcio-rekor-1": {
+					xNewPRSigstoreSigned(
+						PRSigstoreSignedWithFulcio(fulcio),
+						PRSigstoreSignedWithRekorPublicKeyPath("fixtures/rekor.pub"),
+						PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()),
+					),
+				},
+				"192.168.64.2:5000/cosign-signed-single-sample": {
+					xNewPRSignedByThreshold(1, PolicyRequirements{
+						xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchRepository()),
+						xNewPRSigstoreSigned(PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+							PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository())),
+					}),
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer func() {
+		err := pc.Destroy()
+		require.NoError(t, err)
+	}()
+
+	// Simple signing, 1 invalid, 1 valid signature (in this order)
+	res, details, err := pc.IsRunningImageAllowedWithDetails(context.Background(),
+		pcImageMock(t, "fixtures/dir-img-mixed", "testing/manifest:latest"))
+	assertRunningAllowed(t, res, err)
+	assert.Equal(t, &ImageAcceptanceDetails{
+		Transport: "docker",
+		Scope:     "docker.io/testing/manifest:latest",
+		Requirements: []RequirementAcceptanceDetails{{
+			Type: "signedBy",
+			Signatures: []AcceptedSignatureDetails{{
+				Index:                1,
+				Format:               "simple-signing",
+				DockerReference:      "testing/manifest:latest",
+				DockerManifestDigest: TestImageManifestDigest,
+				KeyFingerprint:       TestKeyFingerprint,
+			}},
+		}},
+	}, details)
+
+	// Rejected images have no details
+	res, details, err = pc.IsRunningImageAllowedWithDetails(context.Background(),
+		pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:rejected"))
+	assertRunningRejectedPolicyRequirement(t, res, err)
+	assert.Nil(t, details)
+
+	// A requirement not based on signatures
+	res, details, err = pc.IsRunningImageAllowedWithDetails(context.Background(),
+		pcImageMock(t, "fixtures/dir-img-unsigned", "testing/manifest:other"))
+	assertRunningAllowed(t, res, err)
+	assert.Equal(t, &ImageAcceptanceDetails{
+		Transport:    "docker",
+		Scope:        "docker.io/testing",
+		Requirements: []RequirementAcceptanceDetails{{Type: "insecureAcceptAnything"}},
+	}, details)
+
+	// The default policy
+	res, details, err = pc.IsRunningImageAllowedWithDetails(context.Background(),
+		pcImageMock(t, "fixtures/dir-img-valid", "example.com/other:latest"))
+	assertRunningRejectedPolicyRequirement(t, res, err)
+	assert.Nil(t, details)
+
+	// Sigstore, a public key with Rekor
+	res, details, err = pc.IsRunningImageAllowedWithDetails(context.Background(),
+		pcImageMock(t, "fixtures/dir-img-cosign-key-rekor-valid", "192.168.64.2:5000/cosign-signed/key-1:latest"))
+	assertRunningAllowed(t, res, err)
+	require.NotNil(t, details)
+	require.Len(t, details.Requirements, 1)
+	assert.Equal(t, "sigstoreSigned", details.Requirements[0].Type)
+	require.Len(t, details.Requirements[0].Signatures, 1)
+	sig := details.Requirements[0].Signatures[0]
+	assert.Equal(t, 0, sig.Index)
+	assert.Equal(t, "sigstore-json", sig.Format)
+	assert.Equal(t, "192.168.64.2:5000/cosign-signed/key-1", sig.DockerReference)
+	assert.Equal(t, manifestDigestOfDir(t, "fixtures/dir-img-cosign-key-rekor-valid"), sig.DockerManifestDigest.String())
+	assert.Equal(t, publicKeyFingerprintOfFile(t, "fixtures/cosign2.pub"), sig.KeyFingerprint)
+	assert.Empty(t, sig.SignerIdentity)
+	assert.Empty(t, sig.OIDCIssuer)
+	require.NotNil(t, sig.RekorLogIndex)
+	assert.Equal(t, int64(11608800), *sig.RekorLogIndex)
+
+	// Sigstore, Fulcio with Rekor
+	res, details, err = pc.IsRunningImageAllowedWithDetails(context.Background(),
+		pcImageMock(t, "fixtures/dir-img-cosign-fulcio-rekor-valid", "192.168.64.2:5000/cosign-signed/fulcio-rekor-1:latest"))
+	assertRunningAllowed(t, res, err)
+	require.NotNil(t, details)
+	require.Len(t, details.Requirements, 1)
+	require.Len(t, details.Requirements[0].Signatures, 1)
+	sig = details.Requirements[0].Signatures[0]
+	assert.Equal(t, "192.168.64.2:5000/cosign-signed/fulcio-rekor-1", sig.DockerReference)
+	assert.Len(t, sig.KeyFingerprint, 64)
+	assert.Equal(t, "mitr@redhat.com", sig.SignerIdentity)
+	assert.Equal(t, "https://github.com/login/oauth", sig.OIDCIssuer)
+	require.NotNil(t, sig.RekorLogIndex)
+	assert.Equal(t, int64(11605770), *sig.RekorLogIndex)
+
+	// A threshold requirement records the signatures of the accepted signers
+	res, details, err = pc.IsRunningImageAllowedWithDetails(context.Background(),
+		pcImageMock(t, "fixtures/dir-img-cosign-valid", "192.168.64.2:5000/cosign-signed-single-sample:latest"))
+	assertRunningAllowed(t, res, err)
+	require.NotNil(t, details)
+	require.Len(t, details.Requirements, 1)
+	assert.Equal(t, "signedByThreshold", details.Requirements[0].Type)
+	require.Len(t, details.Requirements[0].Signatures, 1)
+	sig = details.Requirements[0].Signatures[0]
+	assert.Equal(t, publicKeyFingerprintOfFile(t, "fixtures/cosign.pub"), sig.KeyFingerprint)
+	assert.Nil(t, sig.RekorLogIndex)
+
+	// IsRunningImageAllowed does not collect details, but works the same way
+	res, err = pc.IsRunningImageAllowed(context.Background(),
+		pcImageMock(t, "fixtures/dir-img-mixed", "testing/manifest:latest"))
+	assertRunningAllowed(t, res, err)
+}
+
+func TestPublicKeyFingerprint(t *testing.T) {
+	fingerprint := publicKeyFingerprintOfFile(t, "fixtures/cosign.pub")
+	assert.Len(t, fingerprint, 64)
+	assert.NotEqual(t, fingerprint, publicKeyFingerprintOfFile(t, "fixtures/cosign2.pub"))
+
+	// A value which is not a public key
+	_, err := publicKeyFingerprint("not a public key")
+	assert.Error(t, err)
+}
@@ -0,0 +1,139 @@
+// Policy evaluation for prDigestList.
+
+package signature
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/transports"
+	digest "github.com/opencontainers/go-digest"
+	"golang.org/x/exp/slices"
+)
+
+// parseDigestList parses the contents of a prDigestList.DigestsPath / DigestsURL file.
+func parseDigestList(contents []byte, source string) ([]digest.Digest, error) {
+	res := []digest.Digest{}
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		d, err := digest.Parse(line)
+		if err != nil {
+			return nil, fmt.Errorf("parsing digest list %s, line %d: %w", source, lineNumber, err)
+		}
+		res = append(res, d)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading digest list %s: %w", source, err)
+	}
+	return res, nil
+}
+
+// listedDigests returns all digests listed by pr.
+func (pr *prDigestList) listedDigests(ctx context.Context) ([]digest.Digest, error) {
+	res := slices.Clone(pr.Digests)
+	if pr.DigestsPath != "" {
+		contents, err := os.ReadFile(pr.DigestsPath)
+		if err != nil {
+			return nil, err
+		}
+		digests, err := parseDigestList(contents, pr.DigestsPath)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, digests...)
+	}
+	if pr.DigestsURL != "" {
+		contents, err := fetchRemotePolicyURL(ctx, http.DefaultClient, pr.DigestsURL)
+		if err != nil {
+			return nil, err
+		}
+		digests, err := parseDigestList(contents, pr.DigestsURL)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, digests...)
+	}
+	return res, nil
+}
+
+// imageDigests returns the manifest digest of image, and its config digest, if any.
+func imageDigests(ctx context.Context, image private.UnparsedImage) ([]digest.Digest, error) {
+	m, mimeType, err := image.Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	manifestDigest, err := manifest.Digest(m)
+	if err != nil {
+		return nil, err
+	}
+	res := []digest.Digest{manifestDigest}
+	if !manifest.MIMETypeIsMultiImage(mimeType) {
+		parsed, err := manifest.FromBlob(m, mimeType)
+		if err != nil {
+			return nil, err
+		}
+		if configDigest := parsed.ConfigInfo().Digest; configDigest != "" {
+			res = append(res, configDigest)
+		}
+	}
+	return res, nil
+}
+
+// checkImage returns nil if image is allowed by pr, or an error explaining why it is not.
+func (pr *prDigestList) checkImage(ctx context.Context, image private.UnparsedImage) error {
+	listed, err := pr.listedDigests(ctx)
+	if err != nil {
+		return err
+	}
+	digests, err := imageDigests(ctx, image)
+	if err != nil {
+		return err
+	}
+	for _, d := range digests {
+		if slices.Contains(listed, d) {
+			switch pr.Mode {
+			case DLModeAllow:
+				return nil
+			case DLModeDeny:
+				return PolicyRequirementError(fmt.Sprintf("Image %s with digest %s is rejected by policy.", transports.ImageName(image.Reference()), d))
+			}
+		}
+	}
+	switch pr.Mode {
+	case DLModeAllow:
+		return PolicyRequirementError(fmt.Sprintf("Image %s does not have an allowed digest.", transports.ImageName(image.Reference())))
+	case DLModeDeny:
+		return nil
+	default:
+		// This should never happen, newPRDigestList ensures Mode.IsValid()
+		return fmt.Errorf(`Unknown "mode" value "%s"`, string(pr.Mode))
+	}
+}
+
+func (pr *prDigestList) isSignatureAuthorAccepted(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	// This requirement does not consider signatures at all, but reject them if the image itself is rejected.
+	if err := pr.checkImage(ctx, image); err != nil {
+		return sarRejected, nil, err
+	}
+	return sarUnknown, nil, nil
+}
+
+func (pr *prDigestList) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage) (bool, error) {
+	if err := pr.checkImage(ctx, image); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,125 @@
+package signature
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testImageConfigDigest is the config digest of fixtures/dir-img-valid.
+const testImageConfigDigest = digest.Digest("sha256:b5b2b2c507a0944348e0303114d8d93aaaa081732b86451d9bce1f432a537bc7")
+
+func TestParseDigestList(t *testing.T) {
+	// Success
+	res, err := parseDigestList([]byte("# A comment\n\n"+
+		TestImageManifestDigest.String()+"\n"+
+		"  "+testImageConfigDigest.String()+"  \n"+
+		"# "+testDigestListDigest.String()), "test")
+	require.NoError(t, err)
+	assert.Equal(t, []digest.Digest{TestImageManifestDigest, testImageConfigDigest}, res)
+
+	res, err = parseDigestList([]byte{}, "test")
+	require.NoError(t, err)
+	assert.Equal(t, []digest.Digest{}, res)
+
+	// Invalid digest
+	_, err = parseDigestList([]byte(testImageConfigDigest.String()+"\nthis is invalid\n"), "test")
+	assert.ErrorContains(t, err, "line 2")
+}
+
+func TestPRDigestListIsRunningImageAllowed(t *testing.T) {
+	// Use a real reference, so that transports.ImageName works in error messages.
+	testImageRef, err := directory.NewReference("fixtures/dir-img-valid")
+	require.NoError(t, err)
+	testImage := dirImageMockWithRef(t, "fixtures/dir-img-valid", testImageRef)
+	testImageSig, err := os.ReadFile("fixtures/dir-img-valid/signature-1")
+	require.NoError(t, err)
+
+	listPath := filepath.Join(t.TempDir(), "digests")
+	err = os.WriteFile(listPath, []byte("# Known bad images\n"+testImageConfigDigest.String()+"\n"), 0o600)
+	require.NoError(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/digests":
+			_, _ = w.Write([]byte(TestImageManifestDigest.String() + "\n"))
+		case "/empty":
+		case "/invalid":
+			_, _ = w.Write([]byte("this is invalid\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	for _, c := range []struct {
+		name    string
+		options []PRDigestListOption
+		listed  bool
+	}{
+		{"manifest digest", []PRDigestListOption{PRDigestListWithDigests([]digest.Digest{TestImageManifestDigest})}, true},
+		{"config digest", []PRDigestListOption{PRDigestListWithDigests([]digest.Digest{testDigestListDigest, testImageConfigDigest})}, true},
+		{"other digest", []PRDigestListOption{PRDigestListWithDigests([]digest.Digest{testDigestListDigest})}, false},
+		{"empty list", []PRDigestListOption{PRDigestListWithDigests([]digest.Digest{})}, false},
+		{"digestsPath", []PRDigestListOption{PRDigestListWithDigestsPath(listPath)}, true},
+		{"digestsURL", []PRDigestListOption{PRDigestListWithDigestsURL(server.URL + "/digests")}, true},
+		{"empty digestsURL", []PRDigestListOption{PRDigestListWithDigestsURL(server.URL + "/empty")}, false},
+		{"all sources", []PRDigestListOption{
+			PRDigestListWithDigests([]digest.Digest{testDigestListDigest}),
+			PRDigestListWithDigestsPath(listPath),
+			PRDigestListWithDigestsURL(server.URL + "/empty"),
+		}, true},
+	} {
+		allow, err := NewPRDigestList(DLModeAllow, c.options...)
+		require.NoError(t, err, c.name)
+		deny, err := NewPRDigestList(DLModeDeny, c.options...)
+		require.NoError(t, err, c.name)
+
+		allowRes, allowErr := allow.isRunningImageAllowed(context.Background(), testImage)
+		allowSAR, allowSig, allowSARErr := allow.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+		denyRes, denyErr := deny.isRunningImageAllowed(context.Background(), testImage)
+		denySAR, denySig, denySARErr := deny.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+		if c.listed {
+			assertRunningAllowed(t, allowRes, allowErr)
+			assertSARUnknown(t, allowSAR, allowSig, allowSARErr)
+			assertRunningRejectedPolicyRequirement(t, denyRes, denyErr)
+			assertSARRejectedPolicyRequirement(t, denySAR, denySig, denySARErr)
+		} else {
+			assertRunningRejectedPolicyRequirement(t, allowRes, allowErr)
+			assertSARRejectedPolicyRequirement(t, allowSAR, allowSig, allowSARErr)
+			assertRunningAllowed(t, denyRes, denyErr)
+			assertSARUnknown(t, denySAR, denySig, denySARErr)
+		}
+	}
+
+	// Errors loading the list, or reading the image, reject the image in both modes
+	noManifestImage := dirImageMockWithRef(t, "fixtures/dir-img-no-manifest", testImageRef)
+	for _, c := range []struct {
+		name    string
+		options []PRDigestListOption
+	}{
+		{"missing digestsPath", []PRDigestListOption{PRDigestListWithDigestsPath("/this/does/not/exist")}},
+		{"digestsURL not found", []PRDigestListOption{PRDigestListWithDigestsURL(server.URL + "/notfound")}},
+		{"invalid digestsURL contents", []PRDigestListOption{PRDigestListWithDigestsURL(server.URL + "/invalid")}},
+	} {
+		for _, mode := range []dlMode{DLModeAllow, DLModeDeny} {
+			pr, err := NewPRDigestList(mode, c.options...)
+			require.NoError(t, err, c.name)
+			res, err := pr.isRunningImageAllowed(context.Background(), testImage)
+			assertRunningRejected(t, res, err)
+		}
+	}
+	for _, mode := range []dlMode{DLModeAllow, DLModeDeny} {
+		pr, err := NewPRDigestList(mode, PRDigestListWithDigests([]digest.Digest{testDigestListDigest}))
+		require.NoError(t, err)
+		res, err := pr.isRunningImageAllowed(context.Background(), noManifestImage)
+		assertRunningRejected(t, res, err)
+	}
+}
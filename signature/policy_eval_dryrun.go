@@ -0,0 +1,180 @@
+package signature
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// DryRunImage describes an image to be evaluated by EvaluatePolicyDryRun, using only data supplied by the caller.
+type DryRunImage struct {
+	// Reference is the reference of the image; it determines which policy requirements apply.
+	// It is never used to access the image.
+	Reference types.ImageReference
+	// Manifest is the image’s manifest, if available.
+	// If it is nil, requirements which need to examine the manifest (e.g. to verify signatures) reject the image.
+	Manifest []byte
+	// ManifestMIMEType is the MIME type of Manifest; if empty, it is guessed from Manifest.
+	ManifestMIMEType string
+	// ConfigBlob is the image’s config blob, if available; it must match the config digest in Manifest.
+	// If it is nil, requirements which need to examine the config (e.g. "maxImageAge") reject the image.
+	ConfigBlob []byte
+	// Signatures contains the image’s signatures, in the format used by the dir: transport for signature files
+	// (i.e. simple signing signatures as-is, and other formats marked by a header).
+	Signatures [][]byte
+}
+
+// DryRunResult is the result of evaluating a policy for a single DryRunImage.
+type DryRunResult struct {
+	// Image is a description of the image identity, in the transport:identity format.
+	Image string
+	// Allowed is true if the policy would allow running the image.
+	Allowed bool
+	// Error is the reason the image was rejected, or nil if it was allowed.
+	Error error
+	// Trace describes which scope and requirements of the policy were used, and how they evaluated the image.
+	Trace *PolicyEvaluationTrace
+}
+
+// EvaluatePolicyDryRun evaluates policy for each of images, and reports whether each image would be allowed to run, and why.
+// It never accesses the images or any registries; the requirements only see the data in DryRunImage.
+// This is intended for validating policy changes before deploying them.
+// An error is returned only if the policy itself can’t be used; per-image failures are reported in DryRunResult.Error.
+// WARNING: As with PolicyContext.IsRunningImageAllowed, the layers of the images are not validated.
+func EvaluatePolicyDryRun(ctx context.Context, policy *Policy, images []DryRunImage) (res []DryRunResult, finalErr error) {
+	pc, err := NewPolicyContext(policy)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := pc.Destroy(); err != nil && finalErr == nil {
+			res = nil
+			finalErr = err
+		}
+	}()
+	pc.SetTracing(true)
+
+	res = make([]DryRunResult, 0, len(images))
+	for _, img := range images {
+		if img.Reference == nil {
+			return nil, errors.New("dry-run image without a reference")
+		}
+		result := DryRunResult{Image: policyIdentityLogName(img.Reference)}
+		image, err := newDryRunUnparsedImage(img)
+		if err != nil {
+			result.Error = err
+		} else {
+			result.Allowed, result.Error = pc.IsRunningImageAllowed(ctx, image)
+			result.Trace = pc.LastTrace()
+		}
+		res = append(res, result)
+	}
+	return res, nil
+}
+
+// dryRunUnparsedImage is a private.UnparsedImage which only uses data supplied in a DryRunImage.
+type dryRunUnparsedImage struct {
+	ref              types.ImageReference
+	manifest         []byte
+	manifestMIMEType string
+	configBlob       []byte
+	signatures       []signature.Signature
+}
+
+// newDryRunUnparsedImage returns a dryRunUnparsedImage for img.
+func newDryRunUnparsedImage(img DryRunImage) (*dryRunUnparsedImage, error) {
+	sigs := make([]signature.Signature, 0, len(img.Signatures))
+	for i, blob := range img.Signatures {
+		sig, err := signature.FromBlob(blob)
+		if err != nil {
+			return nil, fmt.Errorf("parsing signature %d of %s: %w", i+1, transports.ImageName(img.Reference), err)
+		}
+		sigs = append(sigs, sig)
+	}
+	mimeType := img.ManifestMIMEType
+	if mimeType == "" && img.Manifest != nil {
+		mimeType = manifest.GuessMIMEType(img.Manifest)
+	}
+	return &dryRunUnparsedImage{
+		ref:              img.Reference,
+		manifest:         img.Manifest,
+		manifestMIMEType: mimeType,
+		configBlob:       img.ConfigBlob,
+		signatures:       sigs,
+	}, nil
+}
+
+// Reference returns the reference used to set up this source, _as specified by the user_
+// (not as the image itself, or its underlying storage, claims).  This can be used e.g. to determine which public keys are trusted for this image.
+func (i *dryRunUnparsedImage) Reference() types.ImageReference {
+	return i.ref
+}
+
+// Manifest is like ImageSource.GetManifest, but the result is cached; it is OK to call this however often you need.
+func (i *dryRunUnparsedImage) Manifest(ctx context.Context) ([]byte, string, error) {
+	if i.manifest == nil {
+		return nil, "", fmt.Errorf("manifest of %s was not provided for the dry run", transports.ImageName(i.ref))
+	}
+	return i.manifest, i.manifestMIMEType, nil
+}
+
+// Signatures is like ImageSource.GetSignatures, but the result is cached; it is OK to call this however often you need.
+func (i *dryRunUnparsedImage) Signatures(ctx context.Context) ([][]byte, error) {
+	simpleSigs := [][]byte{}
+	for _, sig := range i.signatures {
+		if sig, ok := sig.(signature.SimpleSigning); ok {
+			simpleSigs = append(simpleSigs, sig.UntrustedSignature())
+		}
+	}
+	return simpleSigs, nil
+}
+
+// UntrustedSignatures is like ImageSource.GetSignaturesWithFormat, but the result is cached; it is OK to call this however often you need.
+func (i *dryRunUnparsedImage) UntrustedSignatures(ctx context.Context) ([]signature.Signature, error) {
+	return i.signatures, nil
+}
+
+// UntrustedConfigBlob returns the config blob of a single image instance, as referenced by Manifest(), or nil if the manifest
+// does not refer to a separate config blob (e.g. for schema1 manifests and manifest lists).
+// The blob is verified to match the digest in the manifest, but the manifest itself may not have been verified yet.
+// The result is cached; it is OK to call this however often you need.
+func (i *dryRunUnparsedImage) UntrustedConfigBlob(ctx context.Context) ([]byte, error) {
+	m, mt, err := i.Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.MIMETypeIsMultiImage(mt) {
+		return nil, nil
+	}
+	parsed, err := manifest.FromBlob(m, mt)
+	if err != nil {
+		return nil, err
+	}
+	info := parsed.ConfigInfo()
+	if info.Digest == "" {
+		return nil, nil
+	}
+	if i.configBlob == nil {
+		return nil, fmt.Errorf("config of %s was not provided for the dry run", transports.ImageName(i.ref))
+	}
+	if computedDigest := digest.FromBytes(i.configBlob); computedDigest != info.Digest {
+		return nil, fmt.Errorf("config digest %s does not match expected %s", computedDigest, info.Digest)
+	}
+	return i.configBlob, nil
+}
+
+// UntrustedAttestations returns the image's attestations if the underlying ImageSource implements AttestationAccessor,
+// or an empty list otherwise. The result is cached; it is OK to call this however often you need.
+func (i *dryRunUnparsedImage) UntrustedAttestations(ctx context.Context) ([]signature.Sigstore, error) {
+	return []signature.Sigstore{}, nil
+}
+
+// A compile-time check that dryRunUnparsedImage implements private.UnparsedImage.
+var _ private.UnparsedImage = (*dryRunUnparsedImage)(nil)
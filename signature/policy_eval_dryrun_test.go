@@ -0,0 +1,141 @@
+package signature
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluatePolicyDryRun(t *testing.T) {
+	maxAge, err := NewPRMaxImageAge(time.Hour)
+	require.NoError(t, err)
+	policy := &Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"docker.io/testing/manifest:latest": {
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchExact()),
+				},
+				"docker.io/testing/aged": {
+					maxAge,
+				},
+				"docker.io/testing": {
+					NewPRInsecureAcceptAnything(),
+				},
+			},
+		},
+	}
+	// The references are mocks which fail if anything tries to access the image.
+	ref := func(s string) types.ImageReference {
+		named, err := reference.ParseNormalizedNamed(s)
+		require.NoError(t, err)
+		return pcImageReferenceMock{transportName: "docker", ref: named}
+	}
+	validManifest, err := os.ReadFile("fixtures/dir-img-valid/manifest.json")
+	require.NoError(t, err)
+	validSig, err := os.ReadFile("fixtures/dir-img-valid/signature-1")
+	require.NoError(t, err)
+	now := time.Now()
+	aged := agedImageMock(t, &now, nil, nil)
+	agedManifest, agedManifestMIMEType, err := aged.Manifest(context.Background())
+	require.NoError(t, err)
+	agedConfig, err := aged.UntrustedConfigBlob(context.Background())
+	require.NoError(t, err)
+
+	res, err := EvaluatePolicyDryRun(context.Background(), policy, []DryRunImage{
+		{ // 0: A valid signature
+			Reference:  ref("testing/manifest:latest"),
+			Manifest:   validManifest,
+			Signatures: [][]byte{validSig},
+		},
+		{ // 1: No signatures
+			Reference: ref("testing/manifest:latest"),
+			Manifest:  validManifest,
+		},
+		{ // 2: No manifest
+			Reference:  ref("testing/manifest:latest"),
+			Signatures: [][]byte{validSig},
+		},
+		{ // 3: A requirement which does not need any data
+			Reference: ref("testing/other:latest"),
+		},
+		{ // 4: The default policy
+			Reference: ref("example.com/other:latest"),
+		},
+		{ // 5: A requirement using the config
+			Reference:        ref("testing/aged:latest"),
+			Manifest:         agedManifest,
+			ManifestMIMEType: agedManifestMIMEType,
+			ConfigBlob:       agedConfig,
+		},
+		{ // 6: Missing config
+			Reference: ref("testing/aged:latest"),
+			Manifest:  agedManifest,
+		},
+		{ // 7: Config not matching the manifest
+			Reference:  ref("testing/aged:latest"),
+			Manifest:   agedManifest,
+			ConfigBlob: []byte("{}"),
+		},
+		{ // 8: An invalid signature blob
+			Reference:  ref("testing/manifest:latest"),
+			Manifest:   validManifest,
+			Signatures: [][]byte{{0x00}},
+		},
+	})
+	require.NoError(t, err)
+	require.Len(t, res, 9)
+
+	assertRunningAllowed(t, res[0].Allowed, res[0].Error)
+	assert.Equal(t, "docker:docker.io/testing/manifest:latest", res[0].Image)
+	require.NotNil(t, res[0].Trace)
+	assert.Equal(t, "docker.io/testing/manifest:latest", res[0].Trace.Scope)
+	require.Len(t, res[0].Trace.Requirements, 1)
+	assert.Equal(t, "signedBy", res[0].Trace.Requirements[0].Type)
+	assert.Equal(t, []PolicySignatureTrace{{Index: 0, Result: sigTraceAccepted}}, res[0].Trace.Requirements[0].Signatures)
+
+	assertRunningRejectedPolicyRequirement(t, res[1].Allowed, res[1].Error)
+	for _, i := range []int{1, 2} {
+		assert.False(t, res[i].Allowed, i)
+		require.Error(t, res[i].Error, i)
+		require.NotNil(t, res[i].Trace)
+		assert.Equal(t, "docker.io/testing/manifest:latest", res[i].Trace.Scope)
+		assert.Equal(t, res[i].Error.Error(), res[i].Trace.Error)
+	}
+
+	assertRunningAllowed(t, res[3].Allowed, res[3].Error)
+	require.NotNil(t, res[3].Trace)
+	assert.Equal(t, "docker.io/testing", res[3].Trace.Scope)
+
+	assertRunningRejectedPolicyRequirement(t, res[4].Allowed, res[4].Error)
+	require.NotNil(t, res[4].Trace)
+	assert.True(t, res[4].Trace.UsedDefaultPolicy)
+
+	assertRunningAllowed(t, res[5].Allowed, res[5].Error)
+	require.NotNil(t, res[5].Trace)
+	assert.Equal(t, "docker.io/testing/aged", res[5].Trace.Scope)
+	for _, i := range []int{6, 7} {
+		assert.False(t, res[i].Allowed, i)
+		assert.Error(t, res[i].Error, i)
+		assert.NotNil(t, res[i].Trace, i)
+	}
+
+	assert.False(t, res[8].Allowed)
+	assert.Error(t, res[8].Error)
+	assert.Nil(t, res[8].Trace)
+
+	// No images
+	res, err = EvaluatePolicyDryRun(context.Background(), policy, nil)
+	require.NoError(t, err)
+	assert.Empty(t, res)
+
+	// An image without a reference
+	_, err = EvaluatePolicyDryRun(context.Background(), policy, []DryRunImage{{}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,127 @@
+package signature
+
+import (
+	"errors"
+
+	"github.com/containers/image/v5/signature/internal"
+)
+
+// The errors below classify why PolicyContext rejected an image, so that callers can branch on the failure class
+// (using errors.As) and produce actionable messages; the underlying error, typically a PolicyRequirementError,
+// remains available using errors.Unwrap.
+
+// UntrustedSignatureError is returned if an image has signatures, but none of them is trusted by the policy
+// (e.g. the signatures are invalid, made by an unexpected key, or for a different image).
+type UntrustedSignatureError struct {
+	err error
+}
+
+func (e UntrustedSignatureError) Error() string {
+	return e.err.Error()
+}
+
+func (e UntrustedSignatureError) Unwrap() error {
+	return e.err
+}
+
+// ExpiredCertificateError is returned if a signature was made using a certificate which was not valid at the time of signing.
+type ExpiredCertificateError struct {
+	err error
+}
+
+func (e ExpiredCertificateError) Error() string {
+	return e.err.Error()
+}
+
+func (e ExpiredCertificateError) Unwrap() error {
+	return e.err
+}
+
+// IdentityMismatchError is returned if a signature is valid, but it was made by an unexpected signer identity
+// (e.g. a Fulcio certificate for a different email address), or claims an unexpected image identity.
+type IdentityMismatchError struct {
+	err error
+}
+
+func (e IdentityMismatchError) Error() string {
+	return e.err.Error()
+}
+
+func (e IdentityMismatchError) Unwrap() error {
+	return e.err
+}
+
+// MissingSignatureError is returned if the policy requires a signature, but the image has no relevant signatures.
+type MissingSignatureError struct {
+	err error
+}
+
+func (e MissingSignatureError) Error() string {
+	return e.err.Error()
+}
+
+func (e MissingSignatureError) Unwrap() error {
+	return e.err
+}
+
+// PolicyScopeNotFoundError is returned if no policy scope applies to an image, and the policy has no default requirements.
+type PolicyScopeNotFoundError struct {
+	err error
+}
+
+func (e PolicyScopeNotFoundError) Error() string {
+	return e.err.Error()
+}
+
+func (e PolicyScopeNotFoundError) Unwrap() error {
+	return e.err
+}
+
+// isClassifiedAs returns true if err is, or wraps, an error of type T.
+func isClassifiedAs[T error](err error) bool {
+	var target T
+	return errors.As(err, &target)
+}
+
+// classifySignatureRejection returns err, the reason for rejecting a signature, classified as one of
+// UntrustedSignatureError, ExpiredCertificateError, IdentityMismatchError or MissingSignatureError.
+// Errors which are not caused by the contents of the signature (e.g. I/O errors) are returned unchanged.
+func classifySignatureRejection(err error) error {
+	switch {
+	case isClassifiedAs[UntrustedSignatureError](err), isClassifiedAs[ExpiredCertificateError](err),
+		isClassifiedAs[IdentityMismatchError](err), isClassifiedAs[MissingSignatureError](err):
+		return err
+	case isClassifiedAs[PolicyRequirementError](err), isClassifiedAs[internal.InvalidSignatureError](err):
+		return UntrustedSignatureError{err: err}
+	default:
+		return err
+	}
+}
+
+// classifySignatureRejections returns summary, which describes the rejections of several signatures or signers
+// with reasons in rejections, classified as the common class of all rejections, or as UntrustedSignatureError.
+func classifySignatureRejections(rejections []error, summary error) error {
+	for _, wrap := range []struct {
+		matches func(error) bool
+		wrap    func(error) error
+	}{
+		{isClassifiedAs[MissingSignatureError], func(err error) error { return MissingSignatureError{err: err} }},
+		{isClassifiedAs[ExpiredCertificateError], func(err error) error { return ExpiredCertificateError{err: err} }},
+		{isClassifiedAs[IdentityMismatchError], func(err error) error { return IdentityMismatchError{err: err} }},
+	} {
+		if len(rejections) != 0 && allMatch(rejections, wrap.matches) {
+			return wrap.wrap(summary)
+		}
+	}
+	return UntrustedSignatureError{err: summary}
+}
+
+// allMatch returns true if fn returns true for all of errs.
+func allMatch(errs []error, fn func(error) bool) bool {
+	for _, err := range errs {
+		if !fn(err) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,99 @@
+package signature
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/containers/image/v5/signature/internal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifySignatureRejection(t *testing.T) {
+	ioErr := errors.New("I/O error")
+	prErr := PolicyRequirementError("rejected")
+	invalidSigErr := internal.NewInvalidSignatureError("invalid")
+	identityErr := IdentityMismatchError{err: prErr}
+	expiredErr := ExpiredCertificateError{err: invalidSigErr}
+	missingErr := MissingSignatureError{err: prErr}
+
+	for _, c := range []struct {
+		input, expected error
+	}{
+		{ioErr, ioErr},
+		{prErr, UntrustedSignatureError{err: prErr}},
+		{invalidSigErr, UntrustedSignatureError{err: invalidSigErr}},
+		{identityErr, identityErr},
+		{expiredErr, expiredErr},
+		{missingErr, missingErr},
+	} {
+		assert.Equal(t, c.expected, classifySignatureRejection(c.input), c.input.Error())
+	}
+
+	summary := PolicyRequirementError("summary")
+	for _, c := range []struct {
+		rejections []error
+		expected   error
+	}{
+		{[]error{identityErr, identityErr}, IdentityMismatchError{err: summary}},
+		{[]error{expiredErr, expiredErr}, ExpiredCertificateError{err: summary}},
+		{[]error{missingErr, missingErr}, MissingSignatureError{err: summary}},
+		{[]error{identityErr, expiredErr}, UntrustedSignatureError{err: summary}},
+		{[]error{identityErr, prErr}, UntrustedSignatureError{err: summary}},
+		{[]error{ioErr, ioErr}, UntrustedSignatureError{err: summary}},
+		{[]error{}, UntrustedSignatureError{err: summary}},
+	} {
+		res := classifySignatureRejections(c.rejections, summary)
+		assert.Equal(t, c.expected, res)
+		assert.Equal(t, "summary", res.Error())
+		var unwrapped PolicyRequirementError
+		assert.ErrorAs(t, res, &unwrapped)
+	}
+}
+
+func TestPolicyContextIsRunningImageAllowedErrorClasses(t *testing.T) {
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"docker.io/testing/manifest:latest": {
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchExact()),
+				},
+				"docker.io/testing/manifest:invalidEmptyRequirements": {},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer func() {
+		err := pc.Destroy()
+		require.NoError(t, err)
+	}()
+
+	// No signatures
+	img := pcImageMock(t, "fixtures/dir-img-unsigned", "testing/manifest:latest")
+	res, err := pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningRejectedPolicyRequirement(t, res, err)
+	var missingErr MissingSignatureError
+	assert.ErrorAs(t, err, &missingErr)
+
+	// Only invalid signatures
+	img = pcImageMock(t, "fixtures/dir-img-modified-manifest", "testing/manifest:latest")
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningRejectedPolicyRequirement(t, res, err)
+	var untrustedErr UntrustedSignatureError
+	assert.ErrorAs(t, err, &untrustedErr)
+
+	// No scope applies, and the default policy is empty
+	img = pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:other")
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningRejectedPolicyRequirement(t, res, err)
+	var scopeErr PolicyScopeNotFoundError
+	assert.ErrorAs(t, err, &scopeErr)
+
+	// A matching scope with empty requirements is a policy error, not a missing scope
+	img = pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:invalidEmptyRequirements")
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningRejectedPolicyRequirement(t, res, err)
+	assert.False(t, errors.As(err, &scopeErr))
+}
@@ -0,0 +1,81 @@
+// Policy evaluation for prMaxImageAge.
+
+package signature
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+)
+
+// imageCreated returns the creation time of image, as claimed by the image itself.
+func (pr *prMaxImageAge) imageCreated(ctx context.Context, image private.UnparsedImage) (time.Time, error) {
+	m, mimeType, err := image.Manifest(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if manifest.MIMETypeIsMultiImage(mimeType) {
+		return time.Time{}, PolicyRequirementError(fmt.Sprintf("Image %s is a manifest list, which has no creation time", transports.ImageName(image.Reference())))
+	}
+	parsed, err := manifest.FromBlob(m, mimeType)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if pr.CreatedAnnotation != "" {
+		if oci, ok := parsed.(*manifest.OCI1); ok {
+			if value, ok := oci.Annotations[pr.CreatedAnnotation]; ok {
+				return parseImageCreatedAnnotation(pr.CreatedAnnotation, value)
+			}
+		}
+	}
+	info, err := parsed.Inspect(func(types.BlobInfo) ([]byte, error) {
+		return image.UntrustedConfigBlob(ctx)
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if pr.CreatedAnnotation != "" {
+		if value, ok := info.Labels[pr.CreatedAnnotation]; ok {
+			return parseImageCreatedAnnotation(pr.CreatedAnnotation, value)
+		}
+	}
+	if info.Created == nil || info.Created.IsZero() {
+		return time.Time{}, PolicyRequirementError(fmt.Sprintf("Image %s does not record its creation time", transports.ImageName(image.Reference())))
+	}
+	return *info.Created, nil
+}
+
+// parseImageCreatedAnnotation parses value of a creation time annotation or label called name.
+func parseImageCreatedAnnotation(name, value string) (time.Time, error) {
+	res, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, PolicyRequirementError(fmt.Sprintf("Invalid value %q of %s: %v", value, name, err))
+	}
+	return res, nil
+}
+
+func (pr *prMaxImageAge) isSignatureAuthorAccepted(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	return sarUnknown, nil, nil
+}
+
+func (pr *prMaxImageAge) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage) (bool, error) {
+	maxAge, err := parsePolicyDuration("maxAge", pr.MaxAge)
+	if err != nil {
+		return false, err
+	}
+	created, err := pr.imageCreated(ctx, image)
+	if err != nil {
+		return false, err
+	}
+	if age := time.Since(created); age > maxAge {
+		return false, PolicyRequirementError(fmt.Sprintf("Image %s created at %s is older than the maximum image age %s",
+			transports.ImageName(image.Reference()), created.UTC(), maxAge))
+	}
+	return true, nil
+}
@@ -0,0 +1,146 @@
+package signature
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/internal/private"
+	digest "github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/require"
+)
+
+// agedImageMock returns a private.UnparsedImage for an OCI image in a new directory, with the specified
+// config creation time and labels, and manifest annotations.
+func agedImageMock(t *testing.T, created *time.Time, labels, annotations map[string]string) private.UnparsedImage {
+	dir := t.TempDir()
+	config, err := json.Marshal(imgspecv1.Image{
+		Created:  created,
+		Platform: imgspecv1.Platform{OS: "linux", Architecture: "amd64"},
+		Config:   imgspecv1.ImageConfig{Labels: labels},
+		RootFS:   imgspecv1.RootFS{Type: "layers"},
+	})
+	require.NoError(t, err)
+	configDigest := digest.FromBytes(config)
+	err = os.WriteFile(filepath.Join(dir, configDigest.Encoded()), config, 0o600)
+	require.NoError(t, err)
+	manifest, err := json.Marshal(imgspecv1.Manifest{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		MediaType: imgspecv1.MediaTypeImageManifest,
+		Config: imgspecv1.Descriptor{
+			MediaType: imgspecv1.MediaTypeImageConfig,
+			Digest:    configDigest,
+			Size:      int64(len(config)),
+		},
+		Layers:      []imgspecv1.Descriptor{},
+		Annotations: annotations,
+	})
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "manifest.json"), manifest, 0o600)
+	require.NoError(t, err)
+
+	ref, err := directory.NewReference(dir)
+	require.NoError(t, err)
+	return dirImageMockWithRef(t, dir, ref)
+}
+
+func TestPRMaxImageAgeIsSignatureAuthorAccepted(t *testing.T) {
+	pr, err := NewPRMaxImageAge(time.Hour)
+	require.NoError(t, err)
+	// Pass nil signature to, kind of, test that the return value does not depend on it.
+	sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), nameOnlyImageMock{}, nil)
+	assertSARUnknown(t, sar, parsedSig, err)
+}
+
+func TestPRMaxImageAgeIsRunningImageAllowed(t *testing.T) {
+	const testAnnotation = "org.opencontainers.image.created"
+	recent := time.Now().Add(-time.Hour)
+	old := time.Now().Add(-1000 * time.Hour)
+	recentString := recent.Format(time.RFC3339)
+	oldString := old.Format(time.RFC3339)
+
+	for _, c := range []struct {
+		name                string
+		created             *time.Time
+		labels, annotations map[string]string
+		options             []PRMaxImageAgeOption
+		allowed             bool
+	}{
+		{name: "recent image", created: &recent, allowed: true},
+		{name: "old image", created: &old, allowed: false},
+		{name: "no creation time", created: nil, allowed: false},
+		{
+			name:    "annotation not used if not configured",
+			created: &old, annotations: map[string]string{testAnnotation: recentString},
+			allowed: false,
+		},
+		{
+			name:    "recent annotation",
+			created: &old, annotations: map[string]string{testAnnotation: recentString},
+			options: []PRMaxImageAgeOption{PRMaxImageAgeWithCreatedAnnotation(testAnnotation)},
+			allowed: true,
+		},
+		{
+			name:    "old annotation",
+			created: &recent, annotations: map[string]string{testAnnotation: oldString},
+			options: []PRMaxImageAgeOption{PRMaxImageAgeWithCreatedAnnotation(testAnnotation)},
+			allowed: false,
+		},
+		{
+			name:    "annotation preferred over label",
+			created: &old, labels: map[string]string{testAnnotation: oldString}, annotations: map[string]string{testAnnotation: recentString},
+			options: []PRMaxImageAgeOption{PRMaxImageAgeWithCreatedAnnotation(testAnnotation)},
+			allowed: true,
+		},
+		{
+			name:    "recent label",
+			created: &old, labels: map[string]string{testAnnotation: recentString},
+			options: []PRMaxImageAgeOption{PRMaxImageAgeWithCreatedAnnotation(testAnnotation)},
+			allowed: true,
+		},
+		{
+			name:    "missing annotation falls back to created",
+			created: &recent,
+			options: []PRMaxImageAgeOption{PRMaxImageAgeWithCreatedAnnotation(testAnnotation)},
+			allowed: true,
+		},
+		{
+			name:    "invalid annotation",
+			created: &recent, annotations: map[string]string{testAnnotation: "this is invalid"},
+			options: []PRMaxImageAgeOption{PRMaxImageAgeWithCreatedAnnotation(testAnnotation)},
+			allowed: false,
+		},
+	} {
+		pr, err := NewPRMaxImageAge(100*time.Hour, c.options...)
+		require.NoError(t, err, c.name)
+		image := agedImageMock(t, c.created, c.labels, c.annotations)
+		res, err := pr.isRunningImageAllowed(context.Background(), image)
+		if c.allowed {
+			assertRunningAllowed(t, res, err)
+		} else {
+			assertRunningRejectedPolicyRequirement(t, res, err)
+		}
+	}
+
+	pr, err := NewPRMaxImageAge(100 * time.Hour)
+	require.NoError(t, err)
+	// Error reading the manifest
+	image := dirImageMock(t, "fixtures/dir-img-no-manifest", "testing/manifest:latest")
+	res, err := pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningRejected(t, res, err)
+	// Error reading the config
+	image = dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	res, err = pr.isRunningImageAllowed(context.Background(), image)
+	assertRunningRejected(t, res, err)
+
+	// Invalid maxAge. Do not use NewPRMaxImageAge, because it would reject this.
+	invalidPR := &prMaxImageAge{prCommon: prCommon{Type: prTypeMaxImageAge}, MaxAge: "this is invalid"}
+	res, err = invalidPR.isRunningImageAllowed(context.Background(), agedImageMock(t, &recent, nil, nil))
+	assertRunningRejected(t, res, err)
+}
@@ -8,22 +8,31 @@ import (
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/containers/image/v5/internal/private"
+	internalSig "github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/manifest"
 	digest "github.com/opencontainers/go-digest"
+	"github.com/sirupsen/logrus"
 	"golang.org/x/exp/slices"
 )
 
 func (pr *prSignedBy) isSignatureAuthorAccepted(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	res, signature, _, err := pr.verifySignature(ctx, image, sig)
+	return res, signature, err
+}
+
+// verifySignature is isSignatureAuthorAccepted, which also returns the identity of the signing key of an accepted signature.
+func (pr *prSignedBy) verifySignature(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, string, error) {
 	switch pr.KeyType {
 	case SBKeyTypeGPGKeys:
 	case SBKeyTypeSignedByGPGKeys, SBKeyTypeX509Certificates, SBKeyTypeSignedByX509CAs:
 		// FIXME? Reject this at policy parsing time already?
-		return sarRejected, nil, fmt.Errorf(`Unimplemented "keyType" value "%s"`, string(pr.KeyType))
+		return sarRejected, nil, "", fmt.Errorf(`Unimplemented "keyType" value "%s"`, string(pr.KeyType))
 	default:
 		// This should never happen, newPRSignedBy ensures KeyType.IsValid()
-		return sarRejected, nil, fmt.Errorf(`Unknown "keyType" value "%s"`, string(pr.KeyType))
+		return sarRejected, nil, "", fmt.Errorf(`Unknown "keyType" value "%s"`, string(pr.KeyType))
 	}
 
 	// FIXME: move this to per-context initialization
@@ -33,7 +42,7 @@ func (pr *prSignedBy) isSignatureAuthorAccepted(ctx context.Context, image priva
 		keySources++
 		d, err := os.ReadFile(pr.KeyPath)
 		if err != nil {
-			return sarRejected, nil, err
+			return sarRejected, nil, "", err
 		}
 		data = [][]byte{d}
 	}
@@ -43,7 +52,7 @@ func (pr *prSignedBy) isSignatureAuthorAccepted(ctx context.Context, image priva
 		for _, path := range pr.KeyPaths {
 			d, err := os.ReadFile(path)
 			if err != nil {
-				return sarRejected, nil, err
+				return sarRejected, nil, "", err
 			}
 			data = append(data, d)
 		}
@@ -53,22 +62,49 @@ func (pr *prSignedBy) isSignatureAuthorAccepted(ctx context.Context, image priva
 		data = [][]byte{pr.KeyData}
 	}
 	if keySources != 1 {
-		return sarRejected, nil, errors.New(`Internal inconsistency: not exactly one of "keyPath", "keyPaths" and "keyData" specified`)
+		return sarRejected, nil, "", errors.New(`Internal inconsistency: not exactly one of "keyPath", "keyPaths" and "keyData" specified`)
 	}
 
 	// FIXME: move this to per-context initialization
 	mech, trustedIdentities, err := newEphemeralGPGSigningMechanism(data)
 	if err != nil {
-		return sarRejected, nil, err
+		return sarRejected, nil, "", err
 	}
 	defer mech.Close()
 	if len(trustedIdentities) == 0 {
-		return sarRejected, nil, PolicyRequirementError("No public keys imported")
+		return sarRejected, nil, "", PolicyRequirementError("No public keys imported")
+	}
+
+	revokedKeys, err := pr.revokedKeyFingerprints()
+	if err != nil {
+		return sarRejected, nil, "", err
+	}
+
+	var validateSignedTimestamp func(*time.Time) error // = nil
+	if pr.MaxSignatureAge != "" {
+		maxAge, err := parsePolicyDuration("maxSignatureAge", pr.MaxSignatureAge)
+		if err != nil {
+			return sarRejected, nil, "", err
+		}
+		validateSignedTimestamp = func(timestamp *time.Time) error {
+			if timestamp == nil {
+				return PolicyRequirementError("Signature has no signing timestamp, but a maximum signature age is required")
+			}
+			if time.Since(*timestamp) > maxAge {
+				return PolicyRequirementError(fmt.Sprintf("Signature created at %s is older than the maximum signature age %s", timestamp.UTC(), maxAge))
+			}
+			return nil
+		}
 	}
 
+	var acceptedKeyIdentity string
 	signature, err := verifyAndExtractSignature(mech, sig, signatureAcceptanceRules{
 		validateKeyIdentity: func(keyIdentity string) error {
+			if slices.ContainsFunc(revokedKeys, func(revoked string) bool { return strings.EqualFold(revoked, keyIdentity) }) {
+				return PolicyRequirementError(fmt.Sprintf("Signature by key %s is not accepted, the key has been revoked", keyIdentity))
+			}
 			if slices.Contains(trustedIdentities, keyIdentity) {
+				acceptedKeyIdentity = keyIdentity
 				return nil
 			}
 			// Coverage: We use a private GPG home directory and only import trusted keys, so this should
@@ -77,7 +113,7 @@ func (pr *prSignedBy) isSignatureAuthorAccepted(ctx context.Context, image priva
 		},
 		validateSignedDockerReference: func(ref string) error {
 			if !pr.SignedIdentity.matchesDockerReference(image, ref) {
-				return PolicyRequirementError(fmt.Sprintf("Signature for identity %s is not accepted", ref))
+				return IdentityMismatchError{err: PolicyRequirementError(fmt.Sprintf("Signature for identity %s is not accepted", ref))}
 			}
 			return nil
 		},
@@ -95,12 +131,36 @@ func (pr *prSignedBy) isSignatureAuthorAccepted(ctx context.Context, image priva
 			}
 			return nil
 		},
+		validateSignedTimestamp: validateSignedTimestamp,
 	})
 	if err != nil {
-		return sarRejected, nil, err
+		return sarRejected, nil, "", err
 	}
 
-	return sarAccepted, signature, nil
+	return sarAccepted, signature, acceptedKeyIdentity, nil
+}
+
+// revokedKeyFingerprints returns the fingerprints of keys revoked by pr.RevokedKeyFingerprints and pr.RevokedKeyFingerprintsPath.
+func (pr *prSignedBy) revokedKeyFingerprints() ([]string, error) {
+	res := slices.Clone(pr.RevokedKeyFingerprints)
+	if pr.RevokedKeyFingerprintsPath != "" {
+		data, err := os.ReadFile(pr.RevokedKeyFingerprintsPath)
+		if err != nil {
+			if pr.RevocationFailureMode != RevocationFailureModeSoftFail {
+				return nil, fmt.Errorf("reading revoked key fingerprints: %w", err)
+			}
+			logrus.Warnf("Ignoring revoked key fingerprints because of soft-fail revocation checking: %v", err)
+			return res, nil
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			res = append(res, line)
+		}
+	}
+	return res, nil
 }
 
 func (pr *prSignedBy) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage) (bool, error) {
@@ -111,12 +171,25 @@ func (pr *prSignedBy) isRunningImageAllowed(ctx context.Context, image private.U
 		return false, err
 	}
 	var rejections []error
-	for _, s := range sigs {
+	accepted := false // Only used if recordingAllAcceptedSignatures(ctx)
+	for sigNumber, s := range sigs {
 		var reason error
-		switch res, _, err := pr.isSignatureAuthorAccepted(ctx, image, s); res {
+		switch res, signature, keyIdentity, err := pr.verifySignature(ctx, image, s); res {
 		case sarAccepted:
-			// One accepted signature is enough.
-			return true, nil
+			traceSignature(ctx, sigNumber, sigTraceAccepted, nil)
+			recordAcceptedSignature(ctx, AcceptedSignatureDetails{
+				Index:                sigNumber,
+				Format:               string(internalSig.SimpleSigningFormat),
+				DockerReference:      signature.DockerReference,
+				DockerManifestDigest: signature.DockerManifestDigest,
+				KeyFingerprint:       keyIdentity,
+			})
+			if !recordingAllAcceptedSignatures(ctx) {
+				// One accepted signature is enough.
+				return true, nil
+			}
+			accepted = true
+			continue
 		case sarRejected:
 			reason = err
 		case sarUnknown:
@@ -125,21 +198,25 @@ func (pr *prSignedBy) isRunningImageAllowed(ctx context.Context, image private.U
 		default:
 			reason = fmt.Errorf(`Internal error: Unexpected signature verification result "%s"`, string(res))
 		}
+		traceSignature(ctx, sigNumber, sigTraceRejected, reason)
 		rejections = append(rejections, reason)
 	}
+	if accepted {
+		return true, nil
+	}
 	var summary error
 	switch len(rejections) {
 	case 0:
-		summary = PolicyRequirementError("A signature was required, but no signature exists")
+		summary = MissingSignatureError{err: PolicyRequirementError("A signature was required, but no signature exists")}
 	case 1:
-		summary = rejections[0]
+		summary = classifySignatureRejection(rejections[0])
 	default:
 		var msgs []string
 		for _, e := range rejections {
 			msgs = append(msgs, e.Error())
 		}
-		summary = PolicyRequirementError(fmt.Sprintf("None of the signatures were accepted, reasons: %s",
-			strings.Join(msgs, "; ")))
+		summary = classifySignatureRejections(rejections, PolicyRequirementError(fmt.Sprintf("None of the signatures were accepted, reasons: %s",
+			strings.Join(msgs, "; "))))
 	}
 	return false, summary
 }
@@ -4,7 +4,9 @@ import (
 	"context"
 	"os"
 	"path"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/containers/image/v5/directory"
 	"github.com/containers/image/v5/docker/reference"
@@ -207,6 +209,82 @@ func TestPRSignedByIsSignatureAuthorAccepted(t *testing.T) {
 	require.NoError(t, err)
 	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), image, sig)
 	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+
+	// maxSignatureAge
+	sigInfo, err := GetUntrustedSignatureInformationWithoutVerifying(testImageSig)
+	require.NoError(t, err)
+	require.NotNil(t, sigInfo.UntrustedTimestamp)
+	age := time.Since(*sigInfo.UntrustedTimestamp)
+	// A signature younger than maxSignatureAge
+	pr, err = NewPRSignedByKeyPath(ktGPG, "fixtures/public-key.gpg", prm, PRSignedByWithMaxSignatureAge(age+time.Hour))
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARAccepted(t, sar, parsedSig, err, Signature{
+		DockerManifestDigest: TestImageManifestDigest,
+		DockerReference:      "testing/manifest:latest",
+	})
+	// A signature older than maxSignatureAge
+	pr, err = NewPRSignedByKeyPath(ktGPG, "fixtures/public-key.gpg", prm, PRSignedByWithMaxSignatureAge(age-time.Hour))
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+	// A signature without a timestamp
+	sig, err = os.ReadFile("fixtures/no-optional-fields.signature")
+	require.NoError(t, err)
+	pr, err = NewPRSignedByKeyPath(ktGPG, "fixtures/public-key.gpg", NewPRMMatchRepository(), PRSignedByWithMaxSignatureAge(age+time.Hour))
+	require.NoError(t, err)
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, sig)
+	assertSARRejectedPolicyRequirement(t, sar, parsedSig, err)
+	// Invalid maxSignatureAge. Do not use NewPRSignedBy*, because it would reject this.
+	pr = &prSignedBy{KeyType: ktGPG, KeyPath: "fixtures/public-key.gpg", SignedIdentity: prm, MaxSignatureAge: "this is invalid"}
+	sar, parsedSig, err = pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+	assertSARRejected(t, sar, parsedSig, err)
+
+	// Revoked keys
+	revokedFile := path.Join(t.TempDir(), "revoked")
+	err = os.WriteFile(revokedFile, []byte("# A comment\n\n"+TestOtherFingerprint1+"\n  "+strings.ToLower(TestKeyFingerprint)+"  \n"), 0o644)
+	require.NoError(t, err)
+	otherRevokedFile := path.Join(t.TempDir(), "revoked")
+	err = os.WriteFile(otherRevokedFile, []byte(TestOtherFingerprint1+"\n"), 0o644)
+	require.NoError(t, err)
+	for _, c := range []struct {
+		opts     []PRSignedByOption
+		accepted bool
+	}{
+		{[]PRSignedByOption{PRSignedByWithRevokedKeyFingerprints([]string{TestOtherFingerprint1})}, true},
+		{[]PRSignedByOption{PRSignedByWithRevokedKeyFingerprints([]string{TestOtherFingerprint1, TestKeyFingerprint})}, false},
+		{[]PRSignedByOption{PRSignedByWithRevokedKeyFingerprints([]string{strings.ToLower(TestKeyFingerprint)})}, false},
+		{[]PRSignedByOption{PRSignedByWithRevokedKeyFingerprintsPath(otherRevokedFile)}, true},
+		{[]PRSignedByOption{PRSignedByWithRevokedKeyFingerprintsPath(revokedFile)}, false},
+		// A missing file
+		{[]PRSignedByOption{PRSignedByWithRevokedKeyFingerprintsPath("/this/does/not/exist")}, false},
+		{[]PRSignedByOption{
+			PRSignedByWithRevokedKeyFingerprintsPath("/this/does/not/exist"),
+			PRSignedByWithRevocationFailureMode(RevocationFailureModeHardFail),
+		}, false},
+		{[]PRSignedByOption{
+			PRSignedByWithRevokedKeyFingerprintsPath("/this/does/not/exist"),
+			PRSignedByWithRevocationFailureMode(RevocationFailureModeSoftFail),
+		}, true},
+		// Soft-fail mode still uses the inline list
+		{[]PRSignedByOption{
+			PRSignedByWithRevokedKeyFingerprints([]string{TestKeyFingerprint}),
+			PRSignedByWithRevokedKeyFingerprintsPath("/this/does/not/exist"),
+			PRSignedByWithRevocationFailureMode(RevocationFailureModeSoftFail),
+		}, false},
+	} {
+		pr, err := NewPRSignedByKeyPath(ktGPG, "fixtures/public-key.gpg", prm, c.opts...)
+		require.NoError(t, err)
+		sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), testImage, testImageSig)
+		if c.accepted {
+			assertSARAccepted(t, sar, parsedSig, err, Signature{
+				DockerManifestDigest: TestImageManifestDigest,
+				DockerReference:      "testing/manifest:latest",
+			})
+		} else {
+			assertSARRejected(t, sar, parsedSig, err)
+		}
+	}
 }
 
 // createInvalidSigDir creates a directory suitable for dirImageMock, in which image.Signatures()
@@ -249,6 +327,8 @@ func TestPRSignedByIsRunningImageAllowed(t *testing.T) {
 	require.NoError(t, err)
 	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
 	assertRunningRejectedPolicyRequirement(t, allowed, err)
+	var missingErr MissingSignatureError
+	assert.ErrorAs(t, err, &missingErr)
 
 	// 1 invalid signature: use dir-img-valid, but a non-matching Docker reference
 	image = dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:notlatest")
@@ -256,6 +336,8 @@ func TestPRSignedByIsRunningImageAllowed(t *testing.T) {
 	require.NoError(t, err)
 	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
 	assertRunningRejectedPolicyRequirement(t, allowed, err)
+	var identityErr IdentityMismatchError
+	assert.ErrorAs(t, err, &identityErr)
 
 	// 2 valid signatures
 	image = dirImageMock(t, "fixtures/dir-img-valid-2", "testing/manifest:latest")
@@ -277,4 +359,5 @@ func TestPRSignedByIsRunningImageAllowed(t *testing.T) {
 	require.NoError(t, err)
 	allowed, err = pr.isRunningImageAllowed(context.Background(), image)
 	assertRunningRejectedPolicyRequirement(t, allowed, err)
+	assert.ErrorAs(t, err, &identityErr)
 }
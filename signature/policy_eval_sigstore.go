@@ -3,13 +3,16 @@
 package signature
 
 import (
+	"bytes"
 	"context"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"os"
+	"regexp"
 	"strings"
 
 	"github.com/containers/image/v5/internal/private"
@@ -18,6 +21,7 @@ import (
 	"github.com/containers/image/v5/signature/internal"
 	digest "github.com/opencontainers/go-digest"
 	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/sirupsen/logrus"
 )
 
 // loadBytesFromDataOrPath ensures there is at most one of ${prefix}Data and ${prefix}Path set,
@@ -39,24 +43,69 @@ func loadBytesFromDataOrPath(prefix string, data []byte, path string) ([]byte, e
 	}
 }
 
-// prepareTrustRoot creates a fulcioTrustRoot from the input data.
+// specifiesCA returns true if the CA certificates are specified explicitly.
+func (f *prSigstoreSignedFulcio) specifiesCA() bool {
+	return f.CAPath != "" || f.CAData != nil
+}
+
+// prepareTrustRoot creates a fulcioTrustRoot from the input data, using tufCACertificates if the CA certificates
+// are not specified explicitly.
 // (This also prevents external implementations of this interface, ensuring that prSigstoreSignedFulcio is the only one.)
-func (f *prSigstoreSignedFulcio) prepareTrustRoot() (*fulcioTrustRoot, error) {
+func (f *prSigstoreSignedFulcio) prepareTrustRoot(tufCACertificates *x509.CertPool) (*fulcioTrustRoot, error) {
 	caCertBytes, err := loadBytesFromDataOrPath("fulcioCA", f.CAData, f.CAPath)
 	if err != nil {
 		return nil, err
 	}
-	if caCertBytes == nil {
+	var certs *x509.CertPool
+	switch {
+	case caCertBytes != nil && tufCACertificates != nil: // newPRSigstoreSigned rejects such combinations.
+		return nil, errors.New(`Internal inconsistency: Fulcio specified with both "caPath"/"caData" and TUF`)
+	case caCertBytes != nil:
+		certs = x509.NewCertPool()
+		if ok := certs.AppendCertsFromPEM(caCertBytes); !ok {
+			return nil, errors.New("error loading Fulcio CA certificates")
+		}
+	case tufCACertificates != nil:
+		certs = tufCACertificates
+	default:
 		return nil, errors.New(`Internal inconsistency: Fulcio specified with neither "caPath" nor "caData"`)
 	}
-	certs := x509.NewCertPool()
-	if ok := certs.AppendCertsFromPEM(caCertBytes); !ok {
-		return nil, errors.New("error loading Fulcio CA certificates")
-	}
 	fulcio := fulcioTrustRoot{
 		caCertificates: certs,
 		oidcIssuer:     f.OIDCIssuer,
 		subjectEmail:   f.SubjectEmail,
+		subjectURI:     f.SubjectURI,
+	}
+	for _, re := range []struct {
+		field string
+		value string
+		dest  **regexp.Regexp
+	}{
+		{"oidcIssuerRegexp", f.OIDCIssuerRegexp, &fulcio.oidcIssuerRegexp},
+		{"subjectEmailRegexp", f.SubjectEmailRegexp, &fulcio.subjectEmailRegexp},
+		{"subjectURIRegexp", f.SubjectURIRegexp, &fulcio.subjectURIRegexp},
+	} {
+		if re.value == "" {
+			continue
+		}
+		compiled, err := compileFulcioRegexp(re.value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %q: %w", re.field, err)
+		}
+		*re.dest = compiled
+	}
+	fulcio.ocsp = f.OCSP
+	fulcio.revocationSoftFail = f.RevocationFailureMode == RevocationFailureModeSoftFail
+	for _, path := range f.CRLPaths {
+		crls, err := loadCRLs(path)
+		if err != nil {
+			if !fulcio.revocationSoftFail {
+				return nil, err
+			}
+			logrus.Warnf("Ignoring certificate revocation list %s because of soft-fail revocation checking: %v", path, err)
+			continue
+		}
+		fulcio.crls = append(fulcio.crls, crls...)
 	}
 	if err := fulcio.validate(); err != nil {
 		return nil, err
@@ -64,14 +113,62 @@ func (f *prSigstoreSignedFulcio) prepareTrustRoot() (*fulcioTrustRoot, error) {
 	return &fulcio, nil
 }
 
+// loadCRLs returns the certificate revocation lists stored at path, in either PEM or DER format.
+func loadCRLs(path string) ([]*x509.RevocationList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		crl, err := x509.ParseRevocationList(data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing certificate revocation list %s: %w", path, err)
+		}
+		return []*x509.RevocationList{crl}, nil
+	}
+	res := []*x509.RevocationList{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "X509 CRL" {
+			continue
+		}
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing certificate revocation list %s: %w", path, err)
+		}
+		res = append(res, crl)
+	}
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no certificate revocation lists found in %s", path)
+	}
+	return res, nil
+}
+
+// parseRekorPublicKey parses a PEM-encoded Rekor public key.
+func parseRekorPublicKey(publicKeyPEM []byte) (*ecdsa.PublicKey, error) {
+	pk, err := cryptoutils.UnmarshalPEMToPublicKey(publicKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("parsing Rekor public key: %w", err)
+	}
+	pkECDSA, ok := pk.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("Rekor public key is not using ECDSA")
+	}
+	return pkECDSA, nil
+}
+
 // sigstoreSignedTrustRoot contains an already parsed version of the prSigstoreSigned policy
 type sigstoreSignedTrustRoot struct {
-	publicKey      crypto.PublicKey
-	fulcio         *fulcioTrustRoot
-	rekorPublicKey *ecdsa.PublicKey
+	publicKey       crypto.PublicKey
+	fulcio          *fulcioTrustRoot
+	rekorPublicKeys []*ecdsa.PublicKey // Any of the keys is accepted; empty if Rekor is not used
 }
 
-func (pr *prSigstoreSigned) prepareTrustRoot() (*sigstoreSignedTrustRoot, error) {
+func (pr *prSigstoreSigned) prepareTrustRoot(ctx context.Context) (*sigstoreSignedTrustRoot, error) {
 	res := sigstoreSignedTrustRoot{}
 
 	publicKeyPEM, err := loadBytesFromDataOrPath("key", pr.KeyData, pr.KeyPath)
@@ -86,8 +183,23 @@ func (pr *prSigstoreSigned) prepareTrustRoot() (*sigstoreSignedTrustRoot, error)
 		res.publicKey = pk
 	}
 
+	var tufCACertificates *x509.CertPool
+	if pr.TUF != nil {
+		tuf, err := pr.TUF.prepareTrustRoot(ctx)
+		if err != nil {
+			return nil, err
+		}
+		res.rekorPublicKeys = tuf.rekorPublicKeys
+		if pr.Fulcio != nil {
+			if tuf.fulcioCACertificates == nil {
+				return nil, errors.New("no Fulcio CA certificates found in the TUF repository")
+			}
+			tufCACertificates = tuf.fulcioCACertificates
+		}
+	}
+
 	if pr.Fulcio != nil {
-		f, err := pr.Fulcio.prepareTrustRoot()
+		f, err := pr.Fulcio.prepareTrustRoot(tufCACertificates)
 		if err != nil {
 			return nil, err
 		}
@@ -99,53 +211,91 @@ func (pr *prSigstoreSigned) prepareTrustRoot() (*sigstoreSignedTrustRoot, error)
 		return nil, err
 	}
 	if rekorPublicKeyPEM != nil {
-		pk, err := cryptoutils.UnmarshalPEMToPublicKey(rekorPublicKeyPEM)
+		pk, err := parseRekorPublicKey(rekorPublicKeyPEM)
 		if err != nil {
-			return nil, fmt.Errorf("parsing Rekor public key: %w", err)
-		}
-		pkECDSA, ok := pk.(*ecdsa.PublicKey)
-		if !ok {
-			return nil, fmt.Errorf("Rekor public key is not using ECDSA")
-
+			return nil, err
 		}
-		res.rekorPublicKey = pkECDSA
+		res.rekorPublicKeys = append(res.rekorPublicKeys, pk)
 	}
 
 	return &res, nil
 }
 
+// verifyRekorSETEntry is internal.VerifyRekorSETEntry, accepting a SET signed by any of rekorPublicKeys.
+func verifyRekorSETEntry(rekorPublicKeys []*ecdsa.PublicKey, untrustedSETBytes []byte, untrustedKeyOrCertBytes []byte,
+	untrustedBase64Signature string, untrustedPayloadBytes []byte) (internal.VerifiedRekorSETEntry, error) {
+	if len(rekorPublicKeys) == 0 {
+		return internal.VerifiedRekorSETEntry{}, errors.New("Internal inconsistency: verifying a Rekor SET without any Rekor public keys")
+	}
+	var err error
+	for _, key := range rekorPublicKeys {
+		var entry internal.VerifiedRekorSETEntry
+		entry, err = internal.VerifyRekorSETEntry(key, untrustedSETBytes, untrustedKeyOrCertBytes, untrustedBase64Signature, untrustedPayloadBytes)
+		if err == nil {
+			return entry, nil
+		}
+	}
+	return internal.VerifiedRekorSETEntry{}, err
+}
+
 func (pr *prSigstoreSigned) isSignatureAuthorAccepted(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
 	// We don’t know of a single user of this API, and we might return unexpected values in Signature.
 	// For now, just punt.
 	return sarRejected, nil, errors.New("isSignatureAuthorAccepted is not implemented for sigstore")
 }
 
-func (pr *prSigstoreSigned) isSignatureAccepted(ctx context.Context, image private.UnparsedImage, sig signature.Sigstore) (signatureAcceptanceResult, error) {
+// verifyRekorInclusionProof verifies the Rekor inclusion proof in untrustedAnnotations, if any, for the already verified rekorEntry.
+// It fails if the proof is missing and pr.RequireRekorInclusionProof.
+func (pr *prSigstoreSigned) verifyRekorInclusionProof(trustRoot *sigstoreSignedTrustRoot, untrustedAnnotations map[string]string,
+	rekorEntry internal.VerifiedRekorSETEntry) error {
+	untrustedProof, ok := untrustedAnnotations[signature.SigstoreRekorInclusionProofAnnotationKey]
+	if !ok {
+		if pr.RequireRekorInclusionProof {
+			return fmt.Errorf("missing %s annotation", signature.SigstoreRekorInclusionProofAnnotationKey)
+		}
+		return nil
+	}
+	if len(trustRoot.rekorPublicKeys) == 0 {
+		return errors.New("Internal inconsistency: verifying a Rekor inclusion proof without any Rekor public keys")
+	}
+	var err error
+	for _, key := range trustRoot.rekorPublicKeys {
+		if err = internal.VerifyRekorInclusionProof(key, []byte(untrustedProof), rekorEntry.Body); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// isSignatureAccepted returns whether sig is accepted by pr, and if so, details about the signature.
+// AcceptedSignatureDetails.Index is not set.
+func (pr *prSigstoreSigned) isSignatureAccepted(ctx context.Context, image private.UnparsedImage, sig signature.Sigstore) (signatureAcceptanceResult, *AcceptedSignatureDetails, error) {
 	// FIXME: move this to per-context initialization
-	trustRoot, err := pr.prepareTrustRoot()
+	trustRoot, err := pr.prepareTrustRoot(ctx)
 	if err != nil {
-		return sarRejected, err
+		return sarRejected, nil, err
 	}
 
 	untrustedAnnotations := sig.UntrustedAnnotations()
 	untrustedBase64Signature, ok := untrustedAnnotations[signature.SigstoreSignatureAnnotationKey]
 	if !ok {
-		return sarRejected, fmt.Errorf("missing %s annotation", signature.SigstoreSignatureAnnotationKey)
+		return sarRejected, nil, fmt.Errorf("missing %s annotation", signature.SigstoreSignatureAnnotationKey)
 	}
 	untrustedPayload := sig.UntrustedPayload()
 
+	details := AcceptedSignatureDetails{Format: string(signature.SigstoreFormat)}
 	var publicKey crypto.PublicKey
 	switch {
 	case trustRoot.publicKey != nil && trustRoot.fulcio != nil: // newPRSigstoreSigned rejects such combinations.
-		return sarRejected, errors.New("Internal inconsistency: Both a public key and Fulcio CA specified")
+		return sarRejected, nil, errors.New("Internal inconsistency: Both a public key and Fulcio CA specified")
 	case trustRoot.publicKey == nil && trustRoot.fulcio == nil: // newPRSigstoreSigned rejects such combinations.
-		return sarRejected, errors.New("Internal inconsistency: Neither a public key nor a Fulcio CA specified")
+		return sarRejected, nil, errors.New("Internal inconsistency: Neither a public key nor a Fulcio CA specified")
 
 	case trustRoot.publicKey != nil:
-		if trustRoot.rekorPublicKey != nil {
+		if len(trustRoot.rekorPublicKeys) != 0 {
 			untrustedSET, ok := untrustedAnnotations[signature.SigstoreSETAnnotationKey]
 			if !ok { // For user convenience; passing an empty []byte to VerifyRekorSet should work.
-				return sarRejected, fmt.Errorf("missing %s annotation", signature.SigstoreSETAnnotationKey)
+				return sarRejected, nil, fmt.Errorf("missing %s annotation", signature.SigstoreSETAnnotationKey)
 			}
 			// We could use publicKeyPEM directly, but let’s re-marshal to avoid inconsistencies.
 			// FIXME: We could just generate DER instead of the full PEM text
@@ -153,49 +303,61 @@ func (pr *prSigstoreSigned) isSignatureAccepted(ctx context.Context, image priva
 			if err != nil {
 				// Coverage: The key was loaded from a PEM format, so it’s unclear how this could fail.
 				// (PEM is not essential, MarshalPublicKeyToPEM can only fail if marshaling to ASN1.DER fails.)
-				return sarRejected, fmt.Errorf("re-marshaling public key to PEM: %w", err)
+				return sarRejected, nil, fmt.Errorf("re-marshaling public key to PEM: %w", err)
 
 			}
 			// We don’t care about the Rekor timestamp, just about log presence.
-			if _, err := internal.VerifyRekorSET(trustRoot.rekorPublicKey, []byte(untrustedSET), recreatedPublicKeyPEM, untrustedBase64Signature, untrustedPayload); err != nil {
-				return sarRejected, err
+			rekorEntry, err := verifyRekorSETEntry(trustRoot.rekorPublicKeys, []byte(untrustedSET), recreatedPublicKeyPEM, untrustedBase64Signature, untrustedPayload)
+			if err != nil {
+				return sarRejected, nil, err
 			}
+			if err := pr.verifyRekorInclusionProof(trustRoot, untrustedAnnotations, rekorEntry); err != nil {
+				return sarRejected, nil, err
+			}
+			details.RekorLogIndex = &rekorEntry.LogIndex
 		}
 		publicKey = trustRoot.publicKey
 
 	case trustRoot.fulcio != nil:
-		if trustRoot.rekorPublicKey == nil { // newPRSigstoreSigned rejects such combinations.
-			return sarRejected, errors.New("Internal inconsistency: Fulcio CA specified without a Rekor public key")
+		if len(trustRoot.rekorPublicKeys) == 0 { // newPRSigstoreSigned rejects such combinations.
+			return sarRejected, nil, errors.New("Internal inconsistency: Fulcio CA specified without a Rekor public key")
 		}
 		untrustedSET, ok := untrustedAnnotations[signature.SigstoreSETAnnotationKey]
 		if !ok { // For user convenience; passing an empty []byte to VerifyRekorSet should correctly reject it anyway.
-			return sarRejected, fmt.Errorf("missing %s annotation", signature.SigstoreSETAnnotationKey)
+			return sarRejected, nil, fmt.Errorf("missing %s annotation", signature.SigstoreSETAnnotationKey)
 		}
 		untrustedCert, ok := untrustedAnnotations[signature.SigstoreCertificateAnnotationKey]
 		if !ok { // For user convenience; passing an empty []byte to VerifyRekorSet should correctly reject it anyway.
-			return sarRejected, fmt.Errorf("missing %s annotation", signature.SigstoreCertificateAnnotationKey)
+			return sarRejected, nil, fmt.Errorf("missing %s annotation", signature.SigstoreCertificateAnnotationKey)
 		}
 		var untrustedIntermediateChainBytes []byte
 		if untrustedIntermediateChain, ok := untrustedAnnotations[signature.SigstoreIntermediateCertificateChainAnnotationKey]; ok {
 			untrustedIntermediateChainBytes = []byte(untrustedIntermediateChain)
 		}
-		pk, err := verifyRekorFulcio(trustRoot.rekorPublicKey, trustRoot.fulcio,
+		pk, identity, rekorEntry, err := verifyRekorFulcio(trustRoot.rekorPublicKeys, trustRoot.fulcio,
 			[]byte(untrustedSET), []byte(untrustedCert), untrustedIntermediateChainBytes, untrustedBase64Signature, untrustedPayload)
 		if err != nil {
-			return sarRejected, err
+			return sarRejected, nil, err
+		}
+		if err := pr.verifyRekorInclusionProof(trustRoot, untrustedAnnotations, rekorEntry); err != nil {
+			return sarRejected, nil, err
 		}
 		publicKey = pk
+		details.SignerIdentity = identity.subject
+		details.OIDCIssuer = identity.oidcIssuer
+		details.RekorLogIndex = &rekorEntry.LogIndex
 	}
 
 	if publicKey == nil {
 		// Coverage: This should never happen, we have already excluded the possibility in the switch above.
-		return sarRejected, fmt.Errorf("Internal inconsistency: publicKey not set before verifying sigstore payload")
+		return sarRejected, nil, fmt.Errorf("Internal inconsistency: publicKey not set before verifying sigstore payload")
 	}
 	signature, err := internal.VerifySigstorePayload(publicKey, untrustedPayload, untrustedBase64Signature, internal.SigstorePayloadAcceptanceRules{
 		ValidateSignedDockerReference: func(ref string) error {
 			if !pr.SignedIdentity.matchesDockerReference(image, ref) {
-				return PolicyRequirementError(fmt.Sprintf("Signature for identity %s is not accepted", ref))
+				return IdentityMismatchError{err: PolicyRequirementError(fmt.Sprintf("Signature for identity %s is not accepted", ref))}
 			}
+			details.DockerReference = ref
 			return nil
 		},
 		ValidateSignedDockerManifestDigest: func(digest digest.Digest) error {
@@ -210,17 +372,24 @@ func (pr *prSigstoreSigned) isSignatureAccepted(ctx context.Context, image priva
 			if !digestMatches {
 				return PolicyRequirementError(fmt.Sprintf("Signature for digest %s does not match", digest))
 			}
+			details.DockerManifestDigest = digest
 			return nil
 		},
 	})
 	if err != nil {
-		return sarRejected, err
+		return sarRejected, nil, err
 	}
 	if signature == nil { // A paranoid sanity check that VerifySigstorePayload has returned consistent values
-		return sarRejected, errors.New("internal error: VerifySigstorePayload succeeded but returned no data") // Coverage: This should never happen.
+		return sarRejected, nil, errors.New("internal error: VerifySigstorePayload succeeded but returned no data") // Coverage: This should never happen.
+	}
+
+	fingerprint, err := publicKeyFingerprint(publicKey)
+	if err != nil {
+		return sarRejected, nil, err
 	}
+	details.KeyFingerprint = fingerprint
 
-	return sarAccepted, nil
+	return sarAccepted, &details, nil
 }
 
 func (pr *prSigstoreSigned) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage) (bool, error) {
@@ -229,24 +398,34 @@ func (pr *prSigstoreSigned) isRunningImageAllowed(ctx context.Context, image pri
 		return false, err
 	}
 	var rejections []error
+	accepted := false // Only used if recordingAllAcceptedSignatures(ctx)
 	foundNonSigstoreSignatures := 0
 	foundSigstoreNonAttachments := 0
-	for _, s := range sigs {
+	for sigNumber, s := range sigs {
 		sigstoreSig, ok := s.(signature.Sigstore)
 		if !ok {
 			foundNonSigstoreSignatures++
+			traceSignature(ctx, sigNumber, sigTraceIgnored, nil)
 			continue
 		}
 		if sigstoreSig.UntrustedMIMEType() != signature.SigstoreSignatureMIMEType {
 			foundSigstoreNonAttachments++
+			traceSignature(ctx, sigNumber, sigTraceIgnored, nil)
 			continue
 		}
 
 		var reason error
-		switch res, err := pr.isSignatureAccepted(ctx, image, sigstoreSig); res {
+		switch res, details, err := pr.isSignatureAccepted(ctx, image, sigstoreSig); res {
 		case sarAccepted:
-			// One accepted signature is enough.
-			return true, nil
+			traceSignature(ctx, sigNumber, sigTraceAccepted, nil)
+			details.Index = sigNumber
+			recordAcceptedSignature(ctx, *details)
+			if !recordingAllAcceptedSignatures(ctx) {
+				// One accepted signature is enough.
+				return true, nil
+			}
+			accepted = true
+			continue
 		case sarRejected:
 			reason = err
 		case sarUnknown:
@@ -255,27 +434,31 @@ func (pr *prSigstoreSigned) isRunningImageAllowed(ctx context.Context, image pri
 		default:
 			reason = fmt.Errorf(`Internal error: Unexpected signature verification result "%s"`, string(res))
 		}
+		traceSignature(ctx, sigNumber, sigTraceRejected, reason)
 		rejections = append(rejections, reason)
 	}
+	if accepted {
+		return true, nil
+	}
 	var summary error
 	switch len(rejections) {
 	case 0:
 		if foundNonSigstoreSignatures == 0 && foundSigstoreNonAttachments == 0 {
 			// A nice message for the most common case.
-			summary = PolicyRequirementError("A signature was required, but no signature exists")
+			summary = MissingSignatureError{err: PolicyRequirementError("A signature was required, but no signature exists")}
 		} else {
-			summary = PolicyRequirementError(fmt.Sprintf("A signature was required, but no signature exists (%d non-sigstore signatures, %d sigstore non-signature attachments)",
-				foundNonSigstoreSignatures, foundSigstoreNonAttachments))
+			summary = MissingSignatureError{err: PolicyRequirementError(fmt.Sprintf("A signature was required, but no signature exists (%d non-sigstore signatures, %d sigstore non-signature attachments)",
+				foundNonSigstoreSignatures, foundSigstoreNonAttachments))}
 		}
 	case 1:
-		summary = rejections[0]
+		summary = classifySignatureRejection(rejections[0])
 	default:
 		var msgs []string
 		for _, e := range rejections {
 			msgs = append(msgs, e.Error())
 		}
-		summary = PolicyRequirementError(fmt.Sprintf("None of the signatures were accepted, reasons: %s",
-			strings.Join(msgs, "; ")))
+		summary = classifySignatureRejections(rejections, PolicyRequirementError(fmt.Sprintf("None of the signatures were accepted, reasons: %s",
+			strings.Join(msgs, "; "))))
 	}
 	return false, summary
 }
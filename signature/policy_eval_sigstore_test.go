@@ -7,9 +7,12 @@ package signature
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/base64"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/containers/image/v5/internal/signature"
 	"github.com/sirupsen/logrus"
@@ -39,13 +42,34 @@ func TestPRSigstoreSignedFulcioPrepareTrustRoot(t *testing.T) {
 	} {
 		f, err := newPRSigstoreSignedFulcio(c...)
 		require.NoError(t, err)
-		res, err := f.prepareTrustRoot()
+		res, err := f.prepareTrustRoot(nil)
 		require.NoError(t, err)
 		assert.NotNil(t, res.caCertificates) // Doing a better test seems hard; we would need to compare .Subjects with a DER encoding.
 		assert.Equal(t, testOIDCIssuer, res.oidcIssuer)
 		assert.Equal(t, testSubjectEmail, res.subjectEmail)
 	}
 
+	// Success with CA certificates from TUF
+	tufCACertificates := x509.NewCertPool()
+	require.True(t, tufCACertificates.AppendCertsFromPEM(testCAData))
+	f, err := newPRSigstoreSignedFulcio(
+		PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+		PRSigstoreSignedFulcioWithSubjectEmail(testSubjectEmail),
+	)
+	require.NoError(t, err)
+	res, err := f.prepareTrustRoot(tufCACertificates)
+	require.NoError(t, err)
+	assert.Same(t, tufCACertificates, res.caCertificates)
+	// … but not with both explicit and TUF CA certificates
+	f, err = newPRSigstoreSignedFulcio(
+		PRSigstoreSignedFulcioWithCAPath(testCAPath),
+		PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+		PRSigstoreSignedFulcioWithSubjectEmail(testSubjectEmail),
+	)
+	require.NoError(t, err)
+	_, err = f.prepareTrustRoot(tufCACertificates)
+	assert.Error(t, err)
+
 	// Failure
 	for _, f := range []prSigstoreSignedFulcio{ // Use a prSigstoreSignedFulcio because these configurations should be rejected by NewPRSigstoreSignedFulcio.
 		{ // Neither CAPath nor CAData specified
@@ -82,9 +106,50 @@ func TestPRSigstoreSignedFulcioPrepareTrustRoot(t *testing.T) {
 			OIDCIssuer: testOIDCIssuer,
 		},
 	} {
-		_, err := f.prepareTrustRoot()
+		_, err := f.prepareTrustRoot(nil)
 		assert.Error(t, err)
 	}
+
+	// Revocation settings
+	now := time.Now()
+	ca := newRevocationTestCA(t, "CA", now)
+	crlPath := filepath.Join(t.TempDir(), "crl")
+	err = os.WriteFile(crlPath, ca.crl(t, now, now.Add(time.Hour), 1), 0o644)
+	require.NoError(t, err)
+	for _, c := range []struct {
+		mode     revocationFailureMode
+		crlPaths []string
+		numCRLs  int // -1 if prepareTrustRoot should fail
+	}{
+		{"", []string{crlPath}, 1},
+		{RevocationFailureModeHardFail, []string{crlPath, crlPath}, 2},
+		{RevocationFailureModeHardFail, []string{crlPath, "fixtures/this/does/not/exist"}, -1},
+		{RevocationFailureModeHardFail, []string{"fixtures/image.signature"}, -1},
+		{RevocationFailureModeSoftFail, []string{crlPath, "fixtures/this/does/not/exist"}, 1},
+		{RevocationFailureModeSoftFail, []string{"fixtures/image.signature"}, 0},
+	} {
+		opts := []PRSigstoreSignedFulcioOption{
+			PRSigstoreSignedFulcioWithCAPath(testCAPath),
+			PRSigstoreSignedFulcioWithOIDCIssuer(testOIDCIssuer),
+			PRSigstoreSignedFulcioWithSubjectEmail(testSubjectEmail),
+			PRSigstoreSignedFulcioWithCRLPaths(c.crlPaths),
+			PRSigstoreSignedFulcioWithOCSP(),
+		}
+		if c.mode != "" {
+			opts = append(opts, PRSigstoreSignedFulcioWithRevocationFailureMode(c.mode))
+		}
+		f, err := newPRSigstoreSignedFulcio(opts...)
+		require.NoError(t, err)
+		res, err := f.prepareTrustRoot(nil)
+		if c.numCRLs == -1 {
+			assert.Error(t, err, "%#v", c)
+			continue
+		}
+		require.NoError(t, err, "%#v", c)
+		assert.Len(t, res.crls, c.numCRLs)
+		assert.True(t, res.ocsp)
+		assert.Equal(t, c.mode == RevocationFailureModeSoftFail, res.revocationSoftFail)
+	}
 }
 
 func TestPRSigstoreSignedPrepareTrustRoot(t *testing.T) {
@@ -116,11 +181,11 @@ func TestPRSigstoreSignedPrepareTrustRoot(t *testing.T) {
 	} {
 		pr, err := newPRSigstoreSigned(c...)
 		require.NoError(t, err)
-		res, err := pr.prepareTrustRoot()
+		res, err := pr.prepareTrustRoot(context.Background())
 		require.NoError(t, err)
 		assert.NotNil(t, res.publicKey)
 		assert.Nil(t, res.fulcio)
-		assert.Nil(t, res.rekorPublicKey)
+		assert.Empty(t, res.rekorPublicKeys)
 	}
 	// Success with Fulcio
 	pr, err := newPRSigstoreSigned(
@@ -129,11 +194,11 @@ func TestPRSigstoreSignedPrepareTrustRoot(t *testing.T) {
 		testIdentityOption,
 	)
 	require.NoError(t, err)
-	res, err := pr.prepareTrustRoot()
+	res, err := pr.prepareTrustRoot(context.Background())
 	require.NoError(t, err)
 	assert.Nil(t, res.publicKey)
 	assert.NotNil(t, res.fulcio)
-	assert.NotNil(t, res.rekorPublicKey)
+	assert.Len(t, res.rekorPublicKeys, 1)
 	// Success with Rekor public key
 	for _, c := range [][]PRSigstoreSignedOption{
 		{
@@ -149,11 +214,11 @@ func TestPRSigstoreSignedPrepareTrustRoot(t *testing.T) {
 	} {
 		pr, err := newPRSigstoreSigned(c...)
 		require.NoError(t, err)
-		res, err := pr.prepareTrustRoot()
+		res, err := pr.prepareTrustRoot(context.Background())
 		require.NoError(t, err)
 		assert.NotNil(t, res.publicKey)
 		assert.Nil(t, res.fulcio)
-		assert.NotNil(t, res.rekorPublicKey)
+		assert.Len(t, res.rekorPublicKeys, 1)
 	}
 
 	// Failure
@@ -202,7 +267,7 @@ func TestPRSigstoreSignedPrepareTrustRoot(t *testing.T) {
 			SignedIdentity:     testIdentity,
 		},
 	} {
-		_, err = pr.prepareTrustRoot()
+		_, err = pr.prepareTrustRoot(context.Background())
 		assert.Error(t, err)
 	}
 }
@@ -280,7 +345,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 		SignedIdentity: prm,
 	}
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
-	sar, err := pr.isSignatureAccepted(context.Background(), nil, testKeyImageSig)
+	sar, _, err := pr.isSignatureAccepted(context.Background(), nil, testKeyImageSig)
 	assertRejected(sar, err)
 
 	// Signature has no cryptographic signature
@@ -290,7 +355,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 	)
 	require.NoError(t, err)
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
-	sar, err = pr.isSignatureAccepted(context.Background(), nil,
+	sar, _, err = pr.isSignatureAccepted(context.Background(), nil,
 		signature.SigstoreFromComponents(testKeyImageSig.UntrustedMIMEType(), testKeyImageSig.UntrustedPayload(), nil))
 	assertRejected(sar, err)
 
@@ -299,7 +364,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 		SignedIdentity: prm,
 	}
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
-	sar, err = pr.isSignatureAccepted(context.Background(), nil, testKeyImageSig)
+	sar, _, err = pr.isSignatureAccepted(context.Background(), nil, testKeyImageSig)
 	assertRejected(sar, err)
 
 	// Both a public key and Fulcio is specified
@@ -315,7 +380,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 		SignedIdentity: prm,
 	}
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
-	sar, err = pr.isSignatureAccepted(context.Background(), nil, testKeyImageSig)
+	sar, _, err = pr.isSignatureAccepted(context.Background(), nil, testKeyImageSig)
 	assertRejected(sar, err)
 
 	// Successful key+Rekor use
@@ -325,17 +390,36 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(prm),
 	)
 	require.NoError(t, err)
-	sar, err = pr.isSignatureAccepted(context.Background(), testKeyRekorImage, testKeyRekorImageSig)
+	sar, _, err = pr.isSignatureAccepted(context.Background(), testKeyRekorImage, testKeyRekorImageSig)
 	assertAccepted(sar, err)
 
+	// key+Rekor, an invalid Rekor inclusion proof
+	// Actual inclusion proof logic is unit-tested elsewhere; we have no fixture with a valid proof.
+	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
+	sar, _, err = pr.isSignatureAccepted(context.Background(), nil,
+		sigstoreSignatureWithModifiedAnnotation(testKeyRekorImageSig, signature.SigstoreRekorInclusionProofAnnotationKey,
+			"this is not a valid inclusion proof"))
+	assertRejected(sar, err)
+	// key+Rekor, a missing Rekor inclusion proof is rejected if required
+	prRequiringProof, err := newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPath("fixtures/cosign2.pub"),
+		PRSigstoreSignedWithRekorPublicKeyPath("fixtures/rekor.pub"),
+		PRSigstoreSignedWithRequireRekorInclusionProof(),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
+	sar, _, err = prRequiringProof.isSignatureAccepted(context.Background(), nil, testKeyRekorImageSig)
+	assertRejected(sar, err)
+
 	// key+Rekor, missing Rekor SET annotation
-	sar, err = pr.isSignatureAccepted(context.Background(), nil,
+	sar, _, err = pr.isSignatureAccepted(context.Background(), nil,
 		sigstoreSignatureWithoutAnnotation(t, testKeyRekorImageSig, signature.SigstoreSETAnnotationKey))
 	assertRejected(sar, err)
 	// Actual Rekor logic is unit-tested elsewhere, but smoke-test the basics:
 	// key+Rekor: Invalid Rekor SET
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
-	sar, err = pr.isSignatureAccepted(context.Background(), nil,
+	sar, _, err = pr.isSignatureAccepted(context.Background(), nil,
 		sigstoreSignatureWithModifiedAnnotation(testKeyRekorImageSig, signature.SigstoreSETAnnotationKey,
 			"this is not a valid SET"))
 	assertRejected(sar, err)
@@ -347,7 +431,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 	)
 	require.NoError(t, err)
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
-	sar, err = pr2.isSignatureAccepted(context.Background(), nil, testKeyRekorImageSig)
+	sar, _, err = pr2.isSignatureAccepted(context.Background(), nil, testKeyRekorImageSig)
 	assertRejected(sar, err)
 
 	// Successful Fulcio certificate use
@@ -363,7 +447,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(prm),
 	)
 	require.NoError(t, err)
-	sar, err = pr.isSignatureAccepted(context.Background(), testFulcioRekorImage,
+	sar, _, err = pr.isSignatureAccepted(context.Background(), testFulcioRekorImage,
 		testFulcioRekorImageSig)
 	assertAccepted(sar, err)
 
@@ -373,23 +457,23 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 		SignedIdentity: prm,
 	}
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
-	sar, err = pr2.isSignatureAccepted(context.Background(), nil,
+	sar, _, err = pr2.isSignatureAccepted(context.Background(), nil,
 		sigstoreSignatureWithoutAnnotation(t, testFulcioRekorImageSig, signature.SigstoreSETAnnotationKey))
 	assertRejected(sar, err)
 	// Fulcio, missing Rekor SET annotation
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
-	sar, err = pr.isSignatureAccepted(context.Background(), nil,
+	sar, _, err = pr.isSignatureAccepted(context.Background(), nil,
 		sigstoreSignatureWithoutAnnotation(t, testFulcioRekorImageSig, signature.SigstoreSETAnnotationKey))
 	assertRejected(sar, err)
 	// Fulcio, missing certificate annotation
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
-	sar, err = pr.isSignatureAccepted(context.Background(), nil,
+	sar, _, err = pr.isSignatureAccepted(context.Background(), nil,
 		sigstoreSignatureWithoutAnnotation(t, testFulcioRekorImageSig, signature.SigstoreCertificateAnnotationKey))
 	assertRejected(sar, err)
 	// Fulcio: missing certificate chain annotation causes the Cosign-issued signature to be rejected
 	// because there is no path to the trusted CA
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
-	sar, err = pr.isSignatureAccepted(context.Background(), nil,
+	sar, _, err = pr.isSignatureAccepted(context.Background(), nil,
 		sigstoreSignatureWithoutAnnotation(t, testFulcioRekorImageSig, signature.SigstoreIntermediateCertificateChainAnnotationKey))
 	assertRejected(sar, err)
 	// … but a signature without the intermediate annotation is fine if the issuer is directly trusted
@@ -406,13 +490,13 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(prm),
 	)
 	require.NoError(t, err)
-	sar, err = pr2.isSignatureAccepted(context.Background(), testFulcioRekorImage,
+	sar, _, err = pr2.isSignatureAccepted(context.Background(), testFulcioRekorImage,
 		sigstoreSignatureWithoutAnnotation(t, testFulcioRekorImageSig, signature.SigstoreIntermediateCertificateChainAnnotationKey))
 	assertAccepted(sar, err)
 	// Actual Fulcio and Rekor logic is unit-tested elsewhere, but smoke-test the basics:
 	// Fulcio: Invalid Fulcio certificate
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
-	sar, err = pr.isSignatureAccepted(context.Background(), nil,
+	sar, _, err = pr.isSignatureAccepted(context.Background(), nil,
 		sigstoreSignatureWithModifiedAnnotation(testFulcioRekorImageSig, signature.SigstoreCertificateAnnotationKey,
 			"this is not a valid certificate"))
 	assertRejected(sar, err)
@@ -430,11 +514,28 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 	)
 	require.NoError(t, err)
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
-	sar, err = pr2.isSignatureAccepted(context.Background(), nil, testFulcioRekorImageSig)
+	sar, _, err = pr2.isSignatureAccepted(context.Background(), nil, testFulcioRekorImageSig)
+	assertRejected(sar, err)
+	// Fulcio: Invalid Rekor inclusion proof
+	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
+	sar, _, err = pr.isSignatureAccepted(context.Background(), nil,
+		sigstoreSignatureWithModifiedAnnotation(testFulcioRekorImageSig, signature.SigstoreRekorInclusionProofAnnotationKey,
+			"this is not a valid inclusion proof"))
+	assertRejected(sar, err)
+	// Fulcio: a missing Rekor inclusion proof is rejected if required
+	pr2, err = newPRSigstoreSigned(
+		PRSigstoreSignedWithFulcio(fulcio),
+		PRSigstoreSignedWithRekorPublicKeyPath("fixtures/rekor.pub"),
+		PRSigstoreSignedWithRequireRekorInclusionProof(),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
+	sar, _, err = pr2.isSignatureAccepted(context.Background(), nil, testFulcioRekorImageSig)
 	assertRejected(sar, err)
 	// Fulcio: Invalid Rekor SET
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
-	sar, err = pr.isSignatureAccepted(context.Background(), nil,
+	sar, _, err = pr.isSignatureAccepted(context.Background(), nil,
 		sigstoreSignatureWithModifiedAnnotation(testFulcioRekorImageSig, signature.SigstoreSETAnnotationKey,
 			"this is not a valid SET"))
 	assertRejected(sar, err)
@@ -446,7 +547,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 	)
 	require.NoError(t, err)
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
-	sar, err = pr2.isSignatureAccepted(context.Background(), nil, testFulcioRekorImageSig)
+	sar, _, err = pr2.isSignatureAccepted(context.Background(), nil, testFulcioRekorImageSig)
 	assertRejected(sar, err)
 
 	// Successful validation, with KeyData and KeyPath
@@ -455,7 +556,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(prm),
 	)
 	require.NoError(t, err)
-	sar, err = pr.isSignatureAccepted(context.Background(), testKeyImage, testKeyImageSig)
+	sar, _, err = pr.isSignatureAccepted(context.Background(), testKeyImage, testKeyImageSig)
 	assertAccepted(sar, err)
 
 	pr, err = newPRSigstoreSigned(
@@ -463,7 +564,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(prm),
 	)
 	require.NoError(t, err)
-	sar, err = pr.isSignatureAccepted(context.Background(), testKeyImage, testKeyImageSig)
+	sar, _, err = pr.isSignatureAccepted(context.Background(), testKeyImage, testKeyImageSig)
 	assertAccepted(sar, err)
 
 	// A signature which does not verify
@@ -473,7 +574,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 	)
 	require.NoError(t, err)
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
-	sar, err = pr.isSignatureAccepted(context.Background(), nil,
+	sar, _, err = pr.isSignatureAccepted(context.Background(), nil,
 		signature.SigstoreFromComponents(testKeyImageSig.UntrustedMIMEType(), testKeyImageSig.UntrustedPayload(), map[string]string{
 			signature.SigstoreSignatureAnnotationKey: base64.StdEncoding.EncodeToString([]byte("invalid signature")),
 		}))
@@ -486,7 +587,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 	)
 	require.NoError(t, err)
 	// Pass a nil pointer to, kind of, test that the return value does not depend on the image.
-	sar, err = pr.isSignatureAccepted(context.Background(), nil, sigstoreSignatureFromFile(t, "fixtures/unknown-cosign-key.signature"))
+	sar, _, err = pr.isSignatureAccepted(context.Background(), nil, sigstoreSignatureFromFile(t, "fixtures/unknown-cosign-key.signature"))
 	assertRejected(sar, err)
 
 	// A valid signature with a rejected identity.
@@ -497,7 +598,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(nonmatchingPRM),
 	)
 	require.NoError(t, err)
-	sar, err = pr.isSignatureAccepted(context.Background(), testKeyImage, testKeyImageSig)
+	sar, _, err = pr.isSignatureAccepted(context.Background(), testKeyImage, testKeyImageSig)
 	assertRejected(sar, err)
 
 	// Error reading image manifest
@@ -507,7 +608,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(prm),
 	)
 	require.NoError(t, err)
-	sar, err = pr.isSignatureAccepted(context.Background(), image, sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-no-manifest/signature-1"))
+	sar, _, err = pr.isSignatureAccepted(context.Background(), image, sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-no-manifest/signature-1"))
 	assertRejected(sar, err)
 
 	// Error computing manifest digest
@@ -517,7 +618,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(prm),
 	)
 	require.NoError(t, err)
-	sar, err = pr.isSignatureAccepted(context.Background(), image, sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-manifest-digest-error/signature-1"))
+	sar, _, err = pr.isSignatureAccepted(context.Background(), image, sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-manifest-digest-error/signature-1"))
 	assertRejected(sar, err)
 
 	// A valid signature with a non-matching manifest
@@ -527,7 +628,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(prm),
 	)
 	require.NoError(t, err)
-	sar, err = pr.isSignatureAccepted(context.Background(), image, sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-modified-manifest/signature-1"))
+	sar, _, err = pr.isSignatureAccepted(context.Background(), image, sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-modified-manifest/signature-1"))
 	assertRejected(sar, err)
 
 	// Minimally check that the prmMatchExact also works as expected:
@@ -538,7 +639,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(NewPRMMatchExact()),
 	)
 	require.NoError(t, err)
-	sar, err = pr.isSignatureAccepted(context.Background(), image, sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-valid-with-tag/signature-1"))
+	sar, _, err = pr.isSignatureAccepted(context.Background(), image, sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-valid-with-tag/signature-1"))
 	assertAccepted(sar, err)
 	// - Signatures with a non-matching tag are rejected
 	image = dirImageMock(t, "fixtures/dir-img-cosign-valid-with-tag", "192.168.64.2:5000/skopeo-signed:othertag")
@@ -547,7 +648,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(NewPRMMatchExact()),
 	)
 	require.NoError(t, err)
-	sar, err = pr.isSignatureAccepted(context.Background(), image, sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-valid-with-tag/signature-1"))
+	sar, _, err = pr.isSignatureAccepted(context.Background(), image, sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-valid-with-tag/signature-1"))
 	assertRejected(sar, err)
 	// - Cosign-created signatures are rejected
 	pr, err = newPRSigstoreSigned(
@@ -555,7 +656,7 @@ func TestPRrSigstoreSignedIsSignatureAccepted(t *testing.T) {
 		PRSigstoreSignedWithSignedIdentity(NewPRMMatchExact()),
 	)
 	require.NoError(t, err)
-	sar, err = pr.isSignatureAccepted(context.Background(), testKeyImage, testKeyImageSig)
+	sar, _, err = pr.isSignatureAccepted(context.Background(), testKeyImage, testKeyImageSig)
 	assertRejected(sar, err)
 }
 
@@ -0,0 +1,114 @@
+// Policy evaluation for prSigstoreSignedTUF.
+
+package signature
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/signature/internal"
+)
+
+// tufTrustRoot contains the sigstore trust root obtained from a TUF repository.
+type tufTrustRoot struct {
+	fulcioCACertificates *x509.CertPool // nil if the repository does not contain any Fulcio certificates
+	rekorPublicKeys      []*ecdsa.PublicKey
+}
+
+// prepareTrustRoot verifies the TUF repository and returns the sigstore trust root it provides.
+// (This also prevents external implementations of this interface, ensuring that prSigstoreSignedTUF is the only one.)
+func (t *prSigstoreSignedTUF) prepareTrustRoot(ctx context.Context) (*tufTrustRoot, error) {
+	trustedRoot, err := loadBytesFromDataOrPath("tufRoot", t.RootData, t.RootPath)
+	if err != nil {
+		return nil, err
+	}
+	if trustedRoot == nil {
+		return nil, errors.New(`Internal inconsistency: TUF specified with neither "rootPath" nor "rootData"`)
+	}
+	var fetch internal.TUFFetcher
+	switch {
+	case t.MetadataDir != "" && t.MirrorURL != "": // newPRSigstoreSignedTUF rejects such combinations.
+		return nil, errors.New(`Internal inconsistency: TUF specified with both "metadataDir" and "mirrorURL"`)
+	case t.MetadataDir != "":
+		fetch = func(name string) ([]byte, error) {
+			return os.ReadFile(filepath.Join(t.MetadataDir, filepath.FromSlash(path.Clean("/"+name))))
+		}
+	case t.MirrorURL != "":
+		fetch = func(name string) ([]byte, error) {
+			return fetchTUFFile(ctx, http.DefaultClient, strings.TrimSuffix(t.MirrorURL, "/")+"/"+name)
+		}
+	default:
+		return nil, errors.New(`Internal inconsistency: TUF specified with neither "metadataDir" nor "mirrorURL"`)
+	}
+
+	repo, err := internal.VerifyTUFRepository(trustedRoot, fetch, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("verifying TUF repository: %w", err)
+	}
+
+	res := tufTrustRoot{}
+	fulcioTargets, err := repo.SigstoreTargets("Fulcio")
+	if err != nil {
+		return nil, err
+	}
+	if len(fulcioTargets) != 0 {
+		res.fulcioCACertificates = x509.NewCertPool()
+		for _, target := range fulcioTargets {
+			if ok := res.fulcioCACertificates.AppendCertsFromPEM(target); !ok {
+				return nil, errors.New("error loading Fulcio CA certificates from the TUF repository")
+			}
+		}
+	}
+	rekorTargets, err := repo.SigstoreTargets("Rekor")
+	if err != nil {
+		return nil, err
+	}
+	if len(rekorTargets) == 0 {
+		return nil, errors.New("no Rekor public keys found in the TUF repository")
+	}
+	for _, target := range rekorTargets {
+		pk, err := parseRekorPublicKey(target)
+		if err != nil {
+			return nil, fmt.Errorf("loading Rekor public key from the TUF repository: %w", err)
+		}
+		res.rekorPublicKeys = append(res.rekorPublicKeys, pk)
+	}
+	return &res, nil
+}
+
+// fetchTUFFile fetches a file of a TUF repository from url.
+// It returns an error satisfying errors.Is(err, fs.ErrNotExist) if the server reports the file does not exist.
+func fetchTUFFile(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusForbidden: // Some static file servers return 403 for missing files.
+		return nil, fmt.Errorf("fetching %s: %w", url, fs.ErrNotExist)
+	default:
+		return nil, fmt.Errorf("fetching %s: status %d (%s)", url, res.StatusCode, http.StatusText(res.StatusCode))
+	}
+	body, err := iolimits.ReadAtMost(res.Body, iolimits.MaxTUFFileBodySize)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", url, err)
+	}
+	return body, nil
+}
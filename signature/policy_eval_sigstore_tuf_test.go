@@ -0,0 +1,310 @@
+//go:build !containers_image_fulcio_stub
+// +build !containers_image_fulcio_stub
+
+package signature
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/secure-systems-lab/go-securesystemslib/cjson"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testTUFTarget is a target file of a TUF repository created by writeTestTUFRepository.
+type testTUFTarget struct {
+	data  []byte
+	usage string // The sigstore usage, or "" if not set
+}
+
+// writeTestTUFRepository creates a TUF repository in dir, with a single ed25519 key used for all roles,
+// containing targets, and returns its root metadata.
+func writeTestTUFRepository(t *testing.T, dir string, targets map[string]testTUFTarget) []byte {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keyID := sha256.Sum256(publicKey)
+	keyIDHex := hex.EncodeToString(keyID[:])
+	expires := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+
+	// sign writes signed metadata with signed to fileName, and returns the written data.
+	sign := func(fileName string, signed any) []byte {
+		signedJSON, err := json.Marshal(signed)
+		require.NoError(t, err)
+		canonical, err := cjson.EncodeCanonical(json.RawMessage(signedJSON))
+		require.NoError(t, err)
+		data, err := json.Marshal(map[string]any{
+			"signed": json.RawMessage(signedJSON),
+			"signatures": []map[string]string{
+				{"keyid": keyIDHex, "sig": hex.EncodeToString(ed25519.Sign(privateKey, canonical))},
+			},
+		})
+		require.NoError(t, err)
+		err = os.WriteFile(filepath.Join(dir, fileName), data, 0o644)
+		require.NoError(t, err)
+		return data
+	}
+
+	roles := map[string]any{}
+	for _, role := range []string{"root", "targets", "snapshot", "timestamp"} {
+		roles[role] = map[string]any{"keyids": []string{keyIDHex}, "threshold": 1}
+	}
+	root := sign("1.root.json", map[string]any{
+		"_type":               "root",
+		"spec_version":        "1.0",
+		"version":             1,
+		"expires":             expires,
+		"consistent_snapshot": false,
+		"keys": map[string]any{
+			keyIDHex: map[string]any{
+				"keytype": "ed25519",
+				"scheme":  "ed25519",
+				"keyval":  map[string]string{"public": hex.EncodeToString(publicKey)},
+			},
+		},
+		"roles": roles,
+	})
+
+	err = os.Mkdir(filepath.Join(dir, "targets"), 0o755)
+	require.NoError(t, err)
+	targetsMeta := map[string]any{}
+	for name, target := range targets {
+		err := os.WriteFile(filepath.Join(dir, "targets", name), target.data, 0o644)
+		require.NoError(t, err)
+		digest := sha256.Sum256(target.data)
+		meta := map[string]any{
+			"length": len(target.data),
+			"hashes": map[string]string{"sha256": hex.EncodeToString(digest[:])},
+		}
+		if target.usage != "" {
+			meta["custom"] = map[string]any{"sigstore": map[string]string{"usage": target.usage, "status": "Active"}}
+		}
+		targetsMeta[name] = meta
+	}
+	sign("targets.json", map[string]any{"_type": "targets", "version": 1, "expires": expires, "targets": targetsMeta})
+	snapshot := sign("snapshot.json", map[string]any{"_type": "snapshot", "version": 1, "expires": expires,
+		"meta": map[string]any{"targets.json": map[string]any{"version": 1}}})
+	snapshotDigest := sha256.Sum256(snapshot)
+	sign("timestamp.json", map[string]any{"_type": "timestamp", "version": 1, "expires": expires,
+		"meta": map[string]any{"snapshot.json": map[string]any{
+			"version": 1,
+			"length":  len(snapshot),
+			"hashes":  map[string]string{"sha256": hex.EncodeToString(snapshotDigest[:])},
+		}}})
+	return root
+}
+
+// testRekorPublicKeyPEM returns a PEM-encoded random ECDSA public key.
+func testRekorPublicKeyPEM(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	res, err := cryptoutils.MarshalPublicKeyToPEM(&key.PublicKey)
+	require.NoError(t, err)
+	return res
+}
+
+func TestPRSigstoreSignedTUFPrepareTrustRoot(t *testing.T) {
+	caData, err := os.ReadFile("fixtures/fulcio_v1.crt.pem")
+	require.NoError(t, err)
+	rekorData, err := os.ReadFile("fixtures/rekor.pub")
+	require.NoError(t, err)
+	rsaKeyData, err := os.ReadFile("fixtures/some-rsa-key.pub")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	root := writeTestTUFRepository(t, dir, map[string]testTUFTarget{
+		"fulcio_v1.crt.pem": {caData, "Fulcio"},
+		"rekor-old.pub":     {testRekorPublicKeyPEM(t), "Rekor"},
+		"rekor.pub":         {rekorData, "Rekor"},
+		"unrelated":         {[]byte("unrelated"), ""},
+	})
+	rootPath := filepath.Join(t.TempDir(), "root.json")
+	err = os.WriteFile(rootPath, root, 0o644)
+	require.NoError(t, err)
+	server := httptest.NewServer(http.FileServer(http.Dir(dir)))
+	defer server.Close()
+
+	// Success
+	for _, c := range [][]PRSigstoreSignedTUFOption{
+		{PRSigstoreSignedTUFWithRootPath(rootPath), PRSigstoreSignedTUFWithMetadataDir(dir)},
+		{PRSigstoreSignedTUFWithRootData(root), PRSigstoreSignedTUFWithMetadataDir(dir)},
+		{PRSigstoreSignedTUFWithRootData(root), PRSigstoreSignedTUFWithMirrorURL(server.URL)},
+		{PRSigstoreSignedTUFWithRootData(root), PRSigstoreSignedTUFWithMirrorURL(server.URL + "/")},
+	} {
+		tuf, err := newPRSigstoreSignedTUF(c...)
+		require.NoError(t, err)
+		res, err := tuf.prepareTrustRoot(context.Background())
+		require.NoError(t, err)
+		assert.NotNil(t, res.fulcioCACertificates)
+		assert.Len(t, res.rekorPublicKeys, 2)
+	}
+
+	// A repository without Fulcio certificates
+	noFulcioDir := t.TempDir()
+	noFulcioRoot := writeTestTUFRepository(t, noFulcioDir, map[string]testTUFTarget{
+		"rekor.pub": {rekorData, "Rekor"},
+	})
+	tuf := &prSigstoreSignedTUF{RootData: noFulcioRoot, MetadataDir: noFulcioDir}
+	res, err := tuf.prepareTrustRoot(context.Background())
+	require.NoError(t, err)
+	assert.Nil(t, res.fulcioCACertificates)
+	assert.Len(t, res.rekorPublicKeys, 1)
+
+	// Failure
+	for _, c := range []struct {
+		name    string
+		targets map[string]testTUFTarget
+	}{
+		{"No Rekor keys", map[string]testTUFTarget{"fulcio_v1.crt.pem": {caData, "Fulcio"}}},
+		{"Invalid Rekor key", map[string]testTUFTarget{"rekor.pub": {[]byte("invalid"), "Rekor"}}},
+		{"Rekor key is not ECDSA", map[string]testTUFTarget{"rekor.pub": {rsaKeyData, "Rekor"}}},
+		{"Invalid Fulcio certificate", map[string]testTUFTarget{
+			"fulcio.crt.pem": {[]byte("invalid"), "Fulcio"},
+			"rekor.pub":      {rekorData, "Rekor"},
+		}},
+	} {
+		dir := t.TempDir()
+		root := writeTestTUFRepository(t, dir, c.targets)
+		tuf := &prSigstoreSignedTUF{RootData: root, MetadataDir: dir}
+		_, err := tuf.prepareTrustRoot(context.Background())
+		assert.Error(t, err, c.name)
+	}
+	for _, tuf := range []prSigstoreSignedTUF{ // Use a prSigstoreSignedTUF because some of these configurations should be rejected by NewPRSigstoreSignedTUF.
+		{ // Neither RootPath nor RootData specified
+			MetadataDir: dir,
+		},
+		{ // Both RootPath and RootData specified
+			RootPath:    rootPath,
+			RootData:    root,
+			MetadataDir: dir,
+		},
+		{ // Unusable RootPath
+			RootPath:    "fixtures/this/does/not/exist",
+			MetadataDir: dir,
+		},
+		{ // Invalid root
+			RootData:    []byte("invalid"),
+			MetadataDir: dir,
+		},
+		{ // Root of a different repository
+			RootData:    noFulcioRoot,
+			MetadataDir: dir,
+		},
+		{ // Neither MetadataDir nor MirrorURL specified
+			RootData: root,
+		},
+		{ // Both MetadataDir and MirrorURL specified
+			RootData:    root,
+			MetadataDir: dir,
+			MirrorURL:   server.URL,
+		},
+		{ // Unusable MetadataDir
+			RootData:    root,
+			MetadataDir: "fixtures/this/does/not/exist",
+		},
+		{ // MirrorURL without a repository
+			RootData:  root,
+			MirrorURL: server.URL + "/does-not-exist",
+		},
+	} {
+		_, err := tuf.prepareTrustRoot(context.Background())
+		assert.Error(t, err, "%#v", tuf)
+	}
+}
+
+func TestPRSigstoreSignedIsSignatureAcceptedWithTUF(t *testing.T) {
+	prm := NewPRMMatchRepository() // We prefer to test with a Cosign-created signature to ensure interoperability, and that doesn’t work with matchExact.
+	testKeyRekorImage := dirImageMock(t, "fixtures/dir-img-cosign-key-rekor-valid", "192.168.64.2:5000/cosign-signed/key-1")
+	testKeyRekorImageSig := sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-key-rekor-valid/signature-1")
+	testFulcioRekorImage := dirImageMock(t, "fixtures/dir-img-cosign-fulcio-rekor-valid", "192.168.64.2:5000/cosign-signed/fulcio-rekor-1")
+	testFulcioRekorImageSig := sigstoreSignatureFromFile(t, "fixtures/dir-img-cosign-fulcio-rekor-valid/signature-1")
+	caData, err := os.ReadFile("fixtures/fulcio_v1.crt.pem")
+	require.NoError(t, err)
+	rekorData, err := os.ReadFile("fixtures/rekor.pub")
+	require.NoError(t, err)
+	fulcio, err := NewPRSigstoreSignedFulcio(
+		PRSigstoreSignedFulcioWithOIDCIssuer("https://github.com/login/oauth"),
+		PRSigstoreSignedFulcioWithSubjectEmail("mitr@redhat.com"),
+	)
+	require.NoError(t, err)
+
+	// The trusted keys have been rotated; the old ones are still trusted.
+	dir := t.TempDir()
+	root := writeTestTUFRepository(t, dir, map[string]testTUFTarget{
+		"fulcio_v1.crt.pem": {caData, "Fulcio"},
+		"rekor.pub":         {rekorData, "Rekor"},
+		"rekor-new.pub":     {testRekorPublicKeyPEM(t), "Rekor"},
+	})
+	tuf, err := NewPRSigstoreSignedTUF(PRSigstoreSignedTUFWithRootData(root), PRSigstoreSignedTUFWithMetadataDir(dir))
+	require.NoError(t, err)
+
+	// Successful Fulcio certificate use
+	pr, err := newPRSigstoreSigned(
+		PRSigstoreSignedWithFulcio(fulcio),
+		PRSigstoreSignedWithTUF(tuf),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	sar, _, err := pr.isSignatureAccepted(context.Background(), testFulcioRekorImage, testFulcioRekorImageSig)
+	assert.Equal(t, sarAccepted, sar)
+	assert.NoError(t, err)
+
+	// Successful key+Rekor use
+	pr, err = newPRSigstoreSigned(
+		PRSigstoreSignedWithKeyPath("fixtures/cosign2.pub"),
+		PRSigstoreSignedWithTUF(tuf),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	sar, _, err = pr.isSignatureAccepted(context.Background(), testKeyRekorImage, testKeyRekorImageSig)
+	assert.Equal(t, sarAccepted, sar)
+	assert.NoError(t, err)
+
+	// The Rekor key has been rotated, and the old one is no longer trusted
+	dir = t.TempDir()
+	root = writeTestTUFRepository(t, dir, map[string]testTUFTarget{
+		"fulcio_v1.crt.pem": {caData, "Fulcio"},
+		"rekor-new.pub":     {testRekorPublicKeyPEM(t), "Rekor"},
+	})
+	tuf, err = NewPRSigstoreSignedTUF(PRSigstoreSignedTUFWithRootData(root), PRSigstoreSignedTUFWithMetadataDir(dir))
+	require.NoError(t, err)
+	pr, err = newPRSigstoreSigned(
+		PRSigstoreSignedWithFulcio(fulcio),
+		PRSigstoreSignedWithTUF(tuf),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	sar, _, err = pr.isSignatureAccepted(context.Background(), testFulcioRekorImage, testFulcioRekorImageSig)
+	assert.Equal(t, sarRejected, sar)
+	assert.Error(t, err)
+
+	// The repository does not contain Fulcio certificates
+	dir = t.TempDir()
+	root = writeTestTUFRepository(t, dir, map[string]testTUFTarget{
+		"rekor.pub": {rekorData, "Rekor"},
+	})
+	tuf, err = NewPRSigstoreSignedTUF(PRSigstoreSignedTUFWithRootData(root), PRSigstoreSignedTUFWithMetadataDir(dir))
+	require.NoError(t, err)
+	pr, err = newPRSigstoreSigned(
+		PRSigstoreSignedWithFulcio(fulcio),
+		PRSigstoreSignedWithTUF(tuf),
+		PRSigstoreSignedWithSignedIdentity(prm),
+	)
+	require.NoError(t, err)
+	sar, _, err = pr.isSignatureAccepted(context.Background(), testFulcioRekorImage, testFulcioRekorImageSig)
+	assert.Equal(t, sarRejected, sar)
+	assert.Error(t, err)
+}
@@ -0,0 +1,213 @@
+// Policy evaluation for prSLSAProvenance.
+
+package signature
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature/internal"
+	"github.com/containers/image/v5/transports"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+)
+
+const (
+	slsaProvenanceV02PredicateType = "https://slsa.dev/provenance/v0.2"
+	slsaProvenanceV1PredicateType  = "https://slsa.dev/provenance/v1"
+)
+
+// slsaProvenanceV02 is the subset of a SLSA v0.2 provenance predicate we use.
+type slsaProvenanceV02 struct {
+	Builder struct {
+		ID string `json:"id"`
+	} `json:"builder"`
+	Invocation struct {
+		ConfigSource struct {
+			URI string `json:"uri"`
+		} `json:"configSource"`
+	} `json:"invocation"`
+}
+
+// slsaProvenanceV1 is the subset of a SLSA v1 provenance predicate we use.
+type slsaProvenanceV1 struct {
+	BuildDefinition struct {
+		ResolvedDependencies []struct {
+			URI string `json:"uri"`
+		} `json:"resolvedDependencies"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+	} `json:"runDetails"`
+}
+
+// untrustedSLSAProvenance contains the values of a SLSA provenance predicate, independent of the predicate version.
+type untrustedSLSAProvenance struct {
+	builderID string
+	sourceURI string // e.g. "git+https://github.com/containers/image@refs/heads/main"; may be empty
+}
+
+// parseSLSAProvenance parses an in-toto predicate of predicateType.
+func parseSLSAProvenance(predicateType string, predicate []byte) (*untrustedSLSAProvenance, error) {
+	switch predicateType {
+	case slsaProvenanceV02PredicateType:
+		var p slsaProvenanceV02
+		if err := json.Unmarshal(predicate, &p); err != nil {
+			return nil, internal.NewInvalidSignatureError(fmt.Sprintf("parsing SLSA provenance: %v", err))
+		}
+		return &untrustedSLSAProvenance{
+			builderID: p.Builder.ID,
+			sourceURI: p.Invocation.ConfigSource.URI,
+		}, nil
+	case slsaProvenanceV1PredicateType:
+		var p slsaProvenanceV1
+		if err := json.Unmarshal(predicate, &p); err != nil {
+			return nil, internal.NewInvalidSignatureError(fmt.Sprintf("parsing SLSA provenance: %v", err))
+		}
+		res := untrustedSLSAProvenance{builderID: p.RunDetails.Builder.ID}
+		if len(p.BuildDefinition.ResolvedDependencies) > 0 {
+			res.sourceURI = p.BuildDefinition.ResolvedDependencies[0].URI
+		}
+		return &res, nil
+	default:
+		return nil, internal.NewInvalidSignatureError(fmt.Sprintf("unsupported predicate type %q", predicateType))
+	}
+}
+
+// splitSLSASourceURI splits a source URI, e.g. "git+https://github.com/containers/image@refs/heads/main",
+// into the repository and ref parts. The ref is empty if uri does not contain one.
+func splitSLSASourceURI(uri string) (string, string) {
+	if i := strings.LastIndex(uri, "@"); i != -1 && strings.HasPrefix(uri[i+1:], "refs/") {
+		return uri[:i], uri[i+1:]
+	}
+	return uri, ""
+}
+
+// matchesConstraints returns nil if provenance matches the constraints of pr, or a PolicyRequirementError.
+func (pr *prSLSAProvenance) matchesConstraints(provenance *untrustedSLSAProvenance) error {
+	if pr.BuilderID != "" && provenance.builderID != pr.BuilderID {
+		return PolicyRequirementError(fmt.Sprintf("Provenance builder ID %q does not match required %q", provenance.builderID, pr.BuilderID))
+	}
+	if pr.SourceRepository != "" || pr.SourceBranch != "" {
+		repo, ref := splitSLSASourceURI(provenance.sourceURI)
+		if pr.SourceRepository != "" && repo != pr.SourceRepository {
+			return PolicyRequirementError(fmt.Sprintf("Provenance source repository %q does not match required %q", repo, pr.SourceRepository))
+		}
+		if pr.SourceBranch != "" && ref != "refs/heads/"+pr.SourceBranch {
+			return PolicyRequirementError(fmt.Sprintf("Provenance source ref %q does not match required branch %q", ref, pr.SourceBranch))
+		}
+	}
+	return nil
+}
+
+// statementMatchesManifest returns true if one of the subjects of statement refers to the manifest m.
+func statementMatchesManifest(statement *internal.UntrustedInTotoStatement, m []byte) (bool, error) {
+	for _, subject := range statement.Subject {
+		for algorithm, value := range subject.Digest {
+			d := digest.NewDigestFromEncoded(digest.Algorithm(algorithm), value)
+			if d.Validate() != nil {
+				continue // Ignore algorithms we don't support
+			}
+			matches, err := manifest.MatchesDigest(m, d)
+			if err != nil {
+				return false, err
+			}
+			if matches {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// checkAttestation verifies that attestation is a valid SLSA provenance attestation for manifest m, signed by publicKey,
+// and matching the constraints of pr.
+func (pr *prSLSAProvenance) checkAttestation(publicKey crypto.PublicKey, m []byte, attestation signature.Sigstore) error {
+	payload, err := internal.VerifyDSSEEnvelope(publicKey, attestation.UntrustedPayload(), internal.InTotoPayloadType)
+	if err != nil {
+		return err
+	}
+	statement, err := internal.ParseInTotoStatement(payload)
+	if err != nil {
+		return err
+	}
+	if statement.PredicateType != slsaProvenanceV02PredicateType && statement.PredicateType != slsaProvenanceV1PredicateType {
+		return PolicyRequirementError(fmt.Sprintf("Attestation predicate type %q is not SLSA provenance", statement.PredicateType))
+	}
+	matches, err := statementMatchesManifest(statement, m)
+	if err != nil {
+		return err
+	}
+	if !matches {
+		return PolicyRequirementError("Attestation subject does not match the image manifest")
+	}
+	provenance, err := parseSLSAProvenance(statement.PredicateType, statement.Predicate)
+	if err != nil {
+		return err
+	}
+	return pr.matchesConstraints(provenance)
+}
+
+func (pr *prSLSAProvenance) isSignatureAuthorAccepted(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	return sarUnknown, nil, nil
+}
+
+func (pr *prSLSAProvenance) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage) (bool, error) {
+	publicKeyPEM, err := loadBytesFromDataOrPath("key", pr.KeyData, pr.KeyPath)
+	if err != nil {
+		return false, err
+	}
+	if publicKeyPEM == nil {
+		return false, errors.New(`Internal inconsistency: neither "keyPath" nor "keyData" specified`)
+	}
+	publicKey, err := cryptoutils.UnmarshalPEMToPublicKey(publicKeyPEM)
+	if err != nil {
+		return false, fmt.Errorf("parsing public key: %w", err)
+	}
+
+	m, _, err := image.Manifest(ctx)
+	if err != nil {
+		return false, err
+	}
+	attestations, err := image.UntrustedAttestations(ctx)
+	if err != nil {
+		return false, err
+	}
+	var rejections []error
+	for _, attestation := range attestations {
+		if attestation.UntrustedMIMEType() != signature.SigstoreDSSEMIMEType {
+			continue
+		}
+		if err := pr.checkAttestation(publicKey, m, attestation); err != nil {
+			rejections = append(rejections, err)
+			continue
+		}
+		return true, nil
+	}
+
+	var summary error
+	switch len(rejections) {
+	case 0:
+		summary = PolicyRequirementError(fmt.Sprintf("A provenance attestation is required for image %s, but none was found",
+			transports.ImageName(image.Reference())))
+	case 1:
+		summary = rejections[0]
+	default:
+		var msgs []string
+		for _, e := range rejections {
+			msgs = append(msgs, e.Error())
+		}
+		summary = PolicyRequirementError(fmt.Sprintf("None of the provenance attestations were accepted, reasons: %s",
+			strings.Join(msgs, "; ")))
+	}
+	return false, summary
+}
@@ -0,0 +1,255 @@
+package signature
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/containers/image/v5/directory"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/signature/internal"
+	digest "github.com/opencontainers/go-digest"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	sigstoreSignature "github.com/sigstore/sigstore/pkg/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// attestedImageMock is a private.UnparsedImage with a fixed set of attestations.
+type attestedImageMock struct {
+	private.UnparsedImage
+	attestations []signature.Sigstore
+}
+
+func (m attestedImageMock) UntrustedAttestations(ctx context.Context) ([]signature.Sigstore, error) {
+	return m.attestations, nil
+}
+
+// slsaAttestation returns a DSSE attestation of a SLSA provenance statement for subjectDigest, signed by signer.
+func slsaAttestation(t *testing.T, signer sigstoreSignature.Signer, subjectDigest digest.Digest, predicateType string, predicate any) signature.Sigstore {
+	predicateJSON, err := json.Marshal(predicate)
+	require.NoError(t, err)
+	statement, err := json.Marshal(internal.UntrustedInTotoStatement{
+		Type: "https://in-toto.io/Statement/v0.1",
+		Subject: []internal.UntrustedInTotoSubject{{
+			Name:   "example.com/image",
+			Digest: map[string]string{subjectDigest.Algorithm().String(): subjectDigest.Encoded()},
+		}},
+		PredicateType: predicateType,
+		Predicate:     predicateJSON,
+	})
+	require.NoError(t, err)
+	sig, err := signer.SignMessage(bytes.NewReader(internal.DSSEPreAuthenticationEncoding(internal.InTotoPayloadType, statement)))
+	require.NoError(t, err)
+	envelope, err := json.Marshal(internal.DSSEEnvelope{
+		PayloadType: internal.InTotoPayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(statement),
+		Signatures:  []internal.DSSESignature{{Sig: base64.StdEncoding.EncodeToString(sig)}},
+	})
+	require.NoError(t, err)
+	return signature.SigstoreFromComponents(signature.SigstoreDSSEMIMEType, envelope, nil)
+}
+
+func TestSplitSLSASourceURI(t *testing.T) {
+	for _, c := range []struct{ input, repo, ref string }{
+		{"git+https://github.com/containers/image@refs/heads/main", "git+https://github.com/containers/image", "refs/heads/main"},
+		{"git+https://github.com/containers/image", "git+https://github.com/containers/image", ""},
+		{"git+ssh://git@github.com/containers/image", "git+ssh://git@github.com/containers/image", ""},
+		{"git+ssh://git@github.com/containers/image@refs/tags/v1", "git+ssh://git@github.com/containers/image", "refs/tags/v1"},
+		{"", "", ""},
+	} {
+		repo, ref := splitSLSASourceURI(c.input)
+		assert.Equal(t, c.repo, repo, c.input)
+		assert.Equal(t, c.ref, ref, c.input)
+	}
+}
+
+func TestPRSLSAProvenanceIsSignatureAuthorAccepted(t *testing.T) {
+	pr, err := NewPRSLSAProvenance(PRSLSAProvenanceWithKeyData([]byte("abc")))
+	require.NoError(t, err)
+	// Pass nil signature to, kind of, test that the return value does not depend on it.
+	sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), nameOnlyImageMock{}, nil)
+	assertSARUnknown(t, sar, parsedSig, err)
+}
+
+func TestPRSLSAProvenanceIsRunningImageAllowed(t *testing.T) {
+	const (
+		testBuilderID  = "https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_container_slsa3.yml@refs/tags/v1.9.0"
+		testRepository = "git+https://github.com/containers/image"
+	)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	signer, err := sigstoreSignature.LoadECDSASigner(key, crypto.SHA256)
+	require.NoError(t, err)
+	keyPEM, err := cryptoutils.MarshalPublicKeyToPEM(&key.PublicKey)
+	require.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherSigner, err := sigstoreSignature.LoadECDSASigner(otherKey, crypto.SHA256)
+	require.NoError(t, err)
+
+	manifestBlob, err := os.ReadFile("fixtures/dir-img-valid/manifest.json")
+	require.NoError(t, err)
+	manifestDigest := digest.FromBytes(manifestBlob)
+	dirRef, err := directory.NewReference("fixtures/dir-img-valid")
+	require.NoError(t, err)
+	image := dirImageMockWithRef(t, "fixtures/dir-img-valid", dirRef)
+
+	v02Predicate := func(builderID, sourceURI string) any {
+		return map[string]any{
+			"builder":    map[string]any{"id": builderID},
+			"invocation": map[string]any{"configSource": map[string]any{"uri": sourceURI}},
+		}
+	}
+	v1Predicate := func(builderID, sourceURI string) any {
+		return map[string]any{
+			"buildDefinition": map[string]any{"resolvedDependencies": []any{map[string]any{"uri": sourceURI}}},
+			"runDetails":      map[string]any{"builder": map[string]any{"id": builderID}},
+		}
+	}
+	validV02 := slsaAttestation(t, signer, manifestDigest, slsaProvenanceV02PredicateType,
+		v02Predicate(testBuilderID, testRepository+"@refs/heads/main"))
+	validV1 := slsaAttestation(t, signer, manifestDigest, slsaProvenanceV1PredicateType,
+		v1Predicate(testBuilderID, testRepository+"@refs/heads/main"))
+	allConstraints := []PRSLSAProvenanceOption{
+		PRSLSAProvenanceWithBuilderID(testBuilderID),
+		PRSLSAProvenanceWithSourceRepository(testRepository),
+		PRSLSAProvenanceWithSourceBranch("main"),
+	}
+
+	for _, c := range []struct {
+		name         string
+		attestations []signature.Sigstore
+		options      []PRSLSAProvenanceOption
+		allowed      bool
+	}{
+		{name: "v0.2 provenance", attestations: []signature.Sigstore{validV02}, options: allConstraints, allowed: true},
+		{name: "v1 provenance", attestations: []signature.Sigstore{validV1}, options: allConstraints, allowed: true},
+		{name: "no constraints", attestations: []signature.Sigstore{validV02}, allowed: true},
+		{name: "no attestations", attestations: []signature.Sigstore{}, allowed: false},
+		{
+			name: "non-DSSE attestations are ignored",
+			attestations: []signature.Sigstore{
+				signature.SigstoreFromComponents(signature.SigstoreSignatureMIMEType, []byte("{}"), nil),
+			},
+			allowed: false,
+		},
+		{
+			name:         "signed by another key",
+			attestations: []signature.Sigstore{slsaAttestation(t, otherSigner, manifestDigest, slsaProvenanceV02PredicateType, v02Predicate(testBuilderID, testRepository))},
+			allowed:      false,
+		},
+		{
+			name: "one of several attestations accepted",
+			attestations: []signature.Sigstore{
+				slsaAttestation(t, otherSigner, manifestDigest, slsaProvenanceV02PredicateType, v02Predicate(testBuilderID, testRepository)),
+				validV1,
+			},
+			options: allConstraints,
+			allowed: true,
+		},
+		{
+			name: "none of several attestations accepted",
+			attestations: []signature.Sigstore{
+				slsaAttestation(t, otherSigner, manifestDigest, slsaProvenanceV02PredicateType, v02Predicate(testBuilderID, testRepository)),
+				slsaAttestation(t, signer, manifestDigest, slsaProvenanceV02PredicateType, v02Predicate("https://example.com/other", testRepository)),
+			},
+			options: allConstraints,
+			allowed: false,
+		},
+		{
+			name:         "subject mismatch",
+			attestations: []signature.Sigstore{slsaAttestation(t, signer, digest.FromString("other"), slsaProvenanceV02PredicateType, v02Predicate(testBuilderID, testRepository))},
+			allowed:      false,
+		},
+		{
+			name:         "not SLSA provenance",
+			attestations: []signature.Sigstore{slsaAttestation(t, signer, manifestDigest, "https://example.com/predicate", v02Predicate(testBuilderID, testRepository))},
+			allowed:      false,
+		},
+		{
+			name:         "invalid predicate",
+			attestations: []signature.Sigstore{slsaAttestation(t, signer, manifestDigest, slsaProvenanceV02PredicateType, []string{"this is invalid"})},
+			allowed:      false,
+		},
+		{
+			name:         "builder ID mismatch",
+			attestations: []signature.Sigstore{validV02},
+			options:      []PRSLSAProvenanceOption{PRSLSAProvenanceWithBuilderID("https://example.com/other")},
+			allowed:      false,
+		},
+		{
+			name:         "source repository mismatch",
+			attestations: []signature.Sigstore{validV1},
+			options:      []PRSLSAProvenanceOption{PRSLSAProvenanceWithSourceRepository("git+https://github.com/containers/storage")},
+			allowed:      false,
+		},
+		{
+			name:         "source branch mismatch",
+			attestations: []signature.Sigstore{validV02},
+			options:      []PRSLSAProvenanceOption{PRSLSAProvenanceWithSourceBranch("release")},
+			allowed:      false,
+		},
+		{
+			name: "source branch missing",
+			attestations: []signature.Sigstore{slsaAttestation(t, signer, manifestDigest, slsaProvenanceV02PredicateType,
+				v02Predicate(testBuilderID, testRepository))},
+			options: []PRSLSAProvenanceOption{PRSLSAProvenanceWithSourceBranch("main")},
+			allowed: false,
+		},
+	} {
+		pr, err := NewPRSLSAProvenance(append([]PRSLSAProvenanceOption{PRSLSAProvenanceWithKeyData(keyPEM)}, c.options...)...)
+		require.NoError(t, err, c.name)
+		res, err := pr.isRunningImageAllowed(context.Background(), attestedImageMock{UnparsedImage: image, attestations: c.attestations})
+		if c.allowed {
+			assertRunningAllowed(t, res, err)
+		} else {
+			assertRunningRejected(t, res, err)
+		}
+	}
+
+	// Failures to reject with a PolicyRequirementError, specifically
+	pr, err := NewPRSLSAProvenance(PRSLSAProvenanceWithKeyData(keyPEM), PRSLSAProvenanceWithBuilderID("https://example.com/other"))
+	require.NoError(t, err)
+	for _, attestations := range [][]signature.Sigstore{{}, {validV02}, {validV02, validV1}} {
+		res, err := pr.isRunningImageAllowed(context.Background(), attestedImageMock{UnparsedImage: image, attestations: attestations})
+		assertRunningRejectedPolicyRequirement(t, res, err)
+	}
+
+	// Key loaded from a path
+	keyPath := t.TempDir() + "/key.pub"
+	err = os.WriteFile(keyPath, keyPEM, 0o600)
+	require.NoError(t, err)
+	pr, err = NewPRSLSAProvenance(PRSLSAProvenanceWithKeyPath(keyPath))
+	require.NoError(t, err)
+	res, err := pr.isRunningImageAllowed(context.Background(), attestedImageMock{UnparsedImage: image, attestations: []signature.Sigstore{validV1}})
+	assertRunningAllowed(t, res, err)
+
+	// Error reading the manifest
+	pr, err = NewPRSLSAProvenance(PRSLSAProvenanceWithKeyData(keyPEM))
+	require.NoError(t, err)
+	res, err = pr.isRunningImageAllowed(context.Background(), attestedImageMock{
+		UnparsedImage: dirImageMock(t, "fixtures/dir-img-no-manifest", "testing/manifest:latest"),
+		attestations:  []signature.Sigstore{validV1},
+	})
+	assertRunningRejected(t, res, err)
+
+	// Invalid key sources. Do not use NewPRSLSAProvenance, because it would reject these.
+	for _, invalidPR := range []*prSLSAProvenance{
+		{prCommon: prCommon{Type: prTypeSLSAProvenance}},
+		{prCommon: prCommon{Type: prTypeSLSAProvenance}, KeyPath: "/this/does/not/exist"},
+		{prCommon: prCommon{Type: prTypeSLSAProvenance}, KeyData: []byte("this is not a key")},
+		{prCommon: prCommon{Type: prTypeSLSAProvenance}, KeyPath: keyPath, KeyData: keyPEM},
+	} {
+		res, err := invalidPR.isRunningImageAllowed(context.Background(), attestedImageMock{UnparsedImage: image, attestations: []signature.Sigstore{validV1}})
+		assertRunningRejected(t, res, err)
+	}
+}
@@ -1,6 +1,7 @@
 package signature
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"testing"
@@ -10,8 +11,10 @@ import (
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/internal/testing/mocks"
+	"github.com/containers/image/v5/pkg/logging"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
+	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -65,6 +68,15 @@ func TestPolicyContextNewDestroy(t *testing.T) {
 	require.NoError(t, err)
 	err = pc.Destroy()
 	assert.NoError(t, err)
+
+	// Invalid pattern scopes are rejected
+	_, err = NewPolicyContext(&Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {"^(": PolicyRequirements{NewPRInsecureAcceptAnything()}},
+		},
+	})
+	assert.Error(t, err)
 }
 
 // pcImageReferenceMock is a mock of types.ImageReference which returns itself in DockerReference
@@ -99,6 +111,27 @@ func (ref pcImageReferenceMock) PolicyConfigurationNamespaces() []string {
 	return policyconfiguration.DockerReferenceNamespaces(ref.ref)
 }
 
+func TestPolicyContextSetLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := logrus.New()
+	l.SetOutput(&buf)
+	l.SetLevel(logrus.DebugLevel)
+
+	pc, err := NewPolicyContext(&Policy{Default: PolicyRequirements{NewPRInsecureAcceptAnything()}})
+	require.NoError(t, err)
+	defer func() {
+		err := pc.Destroy()
+		require.NoError(t, err)
+	}()
+	pc.SetLogger(logging.Logrus(logrus.NewEntry(l)))
+
+	img := pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	res, err := pc.IsRunningImageAllowed(context.Background(), img)
+	require.NoError(t, err)
+	assert.True(t, res)
+	assert.Contains(t, buf.String(), "Using default policy section")
+}
+
 func TestPolicyContextRequirementsForImageRefNotRegisteredTransport(t *testing.T) {
 	transports.Delete("docker")
 	assert.Nil(t, transports.Get("docker"))
@@ -203,6 +236,58 @@ func TestPolicyContextRequirementsForImageRef(t *testing.T) {
 	}
 }
 
+func TestPolicyContextRequirementsForImageRefPatterns(t *testing.T) {
+	ktGPG := SBKeyTypeGPGKeys
+	prm := NewPRMMatchRepoDigestOrExact()
+
+	policy := &Policy{
+		Default:    PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{"docker": {}},
+	}
+	for _, scope := range []string{
+		"",
+		"exact.example.com/prod/repo:tag",
+		"*.example.info",
+		"*.example.com/prod/*",
+		"*.example.com/*",
+		`^regexp\.example\.org/[a-z]+:v[0-9]+`,
+		`^.*:debug`,
+	} {
+		policy.Transports["docker"][scope] = PolicyRequirements{xNewPRSignedByKeyData(ktGPG, []byte(scope), prm)}
+	}
+
+	pc, err := NewPolicyContext(policy)
+	require.NoError(t, err)
+
+	for _, c := range []struct{ input, matched string }{
+		// Exact matches take precedence over patterns
+		{"exact.example.com/prod/repo:tag", "exact.example.com/prod/repo:tag"},
+		// More specific globs take precedence
+		{"exact.example.com/prod/other:tag", "*.example.com/prod/*"},
+		{"a.example.com/prod/repo:tag", "*.example.com/prod/*"},
+		// Globs match namespaces as well
+		{"a.example.com/prod/ns/repo:tag", "*.example.com/prod/*"},
+		{"a.example.com/dev/repo:tag", "*.example.com/*"},
+		{"a.example.com/repo:tag", "*.example.com/*"},
+		// Namespaces, including wildcard host namespaces, take precedence over patterns
+		{"a.example.info/repo:debug", "*.example.info"},
+		// Regular expressions must match the whole identity
+		{"regexp.example.org/repo:v1", `^regexp\.example\.org/[a-z]+:v[0-9]+`},
+		{"regexp.example.org/repo:v1-rc", ""},
+		{"other.example.net/repo:debug", `^.*:debug`},
+		// Default
+		{"other.example.net/repo:latest", ""},
+	} {
+		expected := policy.Transports["docker"][c.matched]
+		ref, err := reference.ParseNormalizedNamed(c.input)
+		require.NoError(t, err)
+		reqs, scope := pc.requirementsAndScopeForImageRef(pcImageReferenceMock{transportName: "docker", ref: ref})
+		assert.False(t, scope.usedDefault, c.input)
+		assert.Equal(t, c.matched, scope.scope, c.input)
+		assert.True(t, &(reqs[0]) == &(expected[0]), c.input)
+	}
+}
+
 // pcImageMock returns a private.UnparsedImage for a directory, claiming a specified dockerReference and implementing PolicyConfigurationIdentity/PolicyConfigurationNamespaces.
 func pcImageMock(t *testing.T, dir, dockerReference string) private.UnparsedImage {
 	ref, err := reference.ParseNormalizedNamed(dockerReference)
@@ -467,7 +552,8 @@ func assertSARRejected(t *testing.T, sar signatureAcceptanceResult, parsedSig *S
 // and that the returned error is a PolicyRequirementError..
 func assertSARRejectedPolicyRequirement(t *testing.T, sar signatureAcceptanceResult, parsedSig *Signature, err error) {
 	assertSARRejected(t, sar, parsedSig, err)
-	assert.IsType(t, PolicyRequirementError(""), err)
+	var prError PolicyRequirementError
+	assert.ErrorAs(t, err, &prError)
 }
 
 // assertSARRejected verifies that isSignatureAuthorAccepted returns a consistent sarUnknown result.
@@ -495,5 +581,6 @@ func assertRunningRejected(t *testing.T, allowed bool, err error) {
 // and that the returned error is a PolicyRequirementError.
 func assertRunningRejectedPolicyRequirement(t *testing.T, allowed bool, err error) {
 	assertRunningRejected(t, allowed, err)
-	assert.IsType(t, PolicyRequirementError(""), err)
+	var prError PolicyRequirementError
+	assert.ErrorAs(t, err, &prError)
 }
@@ -0,0 +1,95 @@
+// Policy evaluation for prSignedByThreshold.
+
+package signature
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/internal/private"
+)
+
+func (pr *prSignedByThreshold) isSignatureAuthorAccepted(ctx context.Context, image private.UnparsedImage, sig []byte) (signatureAcceptanceResult, *Signature, error) {
+	// A single signature can’t satisfy a threshold in general, so don’t claim to accept or reject it.
+	return sarUnknown, nil, nil
+}
+
+func (pr *prSignedByThreshold) isRunningImageAllowed(ctx context.Context, image private.UnparsedImage) (bool, error) {
+	if pr.Threshold < 1 || pr.Threshold > len(pr.Signers) { // newPRSignedByThreshold rejects such values.
+		return false, fmt.Errorf("Internal inconsistency: threshold %d with %d signers", pr.Threshold, len(pr.Signers))
+	}
+	// The signers would all record the same signatures in a single requirement trace; record only the summary.
+	signerCtx := contextWithoutRequirementTrace(ctx)
+	candidates := make([][]AcceptedSignatureDetails, len(pr.Signers))
+	var rejections []string
+	var rejectionErrs []error
+	for i, signer := range pr.Signers {
+		details := RequirementAcceptanceDetails{}
+		allowed, err := signer.isRunningImageAllowed(contextRecordingAllAcceptedSignatures(signerCtx, &details), image)
+		if allowed {
+			candidates[i] = details.Signatures
+			continue
+		}
+		rejections = append(rejections, fmt.Sprintf("signer %d: %v", i+1, err))
+		rejectionErrs = append(rejectionErrs, err)
+	}
+	// A single signature, or several signatures by the same key, must not count for more than one signer.
+	accepted := assignDistinctSigningKeys(candidates)
+	if len(accepted) >= pr.Threshold {
+		for _, sig := range accepted {
+			recordAcceptedSignature(ctx, sig)
+		}
+		return true, nil
+	}
+	if acceptingSigners := len(pr.Signers) - len(rejections); acceptingSigners > len(accepted) {
+		rejections = append(rejections, fmt.Sprintf("%d signers accepted signatures, but only by %d distinct keys", acceptingSigners, len(accepted)))
+	}
+	return false, classifySignatureRejections(rejectionErrs, PolicyRequirementError(fmt.Sprintf("Signatures from %d of %d signers are required, but only %d were accepted; reasons: %s",
+		pr.Threshold, len(pr.Signers), len(accepted), strings.Join(rejections, "; "))))
+}
+
+// signingKeyIdentity returns a value identifying the signer of sig: the identity authenticated by Fulcio, if any, or the signing key.
+func signingKeyIdentity(sig AcceptedSignatureDetails) string {
+	if sig.SignerIdentity != "" {
+		return "fulcio:" + sig.OIDCIssuer + "\x00" + sig.SignerIdentity
+	}
+	return "key:" + strings.ToLower(sig.KeyFingerprint)
+}
+
+// assignDistinctSigningKeys chooses at most one of candidates[i] for each signer i, so that no two signers use signatures
+// with the same signingKeyIdentity (and therefore also not the same signature), and the number of signers with a chosen
+// signature is as large as possible. It returns the chosen signatures, in signer order.
+func assignDistinctSigningKeys(candidates [][]AcceptedSignatureDetails) []AcceptedSignatureDetails {
+	chosen := make([]*AcceptedSignatureDetails, len(candidates))
+	keyOwners := map[string]int{} // signingKeyIdentity -> index of the signer using it
+	// assign finds a signature for signer, possibly reassigning other signers (in a bipartite matching augmenting path).
+	var assign func(signer int, visited map[string]struct{}) bool
+	assign = func(signer int, visited map[string]struct{}) bool {
+		for i := range candidates[signer] {
+			candidate := &candidates[signer][i]
+			key := signingKeyIdentity(*candidate)
+			if _, ok := visited[key]; ok {
+				continue
+			}
+			visited[key] = struct{}{}
+			owner, used := keyOwners[key]
+			if !used || assign(owner, visited) {
+				keyOwners[key] = signer
+				chosen[signer] = candidate
+				return true
+			}
+		}
+		return false
+	}
+	for signer := range candidates {
+		assign(signer, map[string]struct{}{})
+	}
+	res := []AcceptedSignatureDetails{}
+	for _, sig := range chosen {
+		if sig != nil {
+			res = append(res, *sig)
+		}
+	}
+	return res
+}
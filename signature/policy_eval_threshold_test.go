@@ -0,0 +1,178 @@
+package signature
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPRSignedByThresholdIsSignatureAuthorAccepted(t *testing.T) {
+	pr := xNewPRSignedByThreshold(1, PolicyRequirements{
+		xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchExact()),
+	})
+	// Pass nil signature to, kind of, test that the return value does not depend on it.
+	sar, parsedSig, err := pr.isSignatureAuthorAccepted(context.Background(), nameOnlyImageMock{}, nil)
+	assertSARUnknown(t, sar, parsedSig, err)
+}
+
+// mixedSignaturesImageDir returns a directory containing the dir-img-cosign-valid image, with an added
+// simple signing signature, or "" if signing is not supported.
+func mixedSignaturesImageDir(t *testing.T) string {
+	mech, err := newGPGSigningMechanismInDirectory(testGPGHomeDirectory)
+	require.NoError(t, err)
+	defer mech.Close()
+	if err := mech.SupportsSigning(); err != nil {
+		return ""
+	}
+
+	dir := t.TempDir()
+	for _, file := range []string{"manifest.json", "signature-1"} {
+		contents, err := os.ReadFile(filepath.Join("fixtures/dir-img-cosign-valid", file))
+		require.NoError(t, err)
+		err = os.WriteFile(filepath.Join(dir, file), contents, 0o600)
+		require.NoError(t, err)
+	}
+	manifest, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	require.NoError(t, err)
+	sig, err := SignDockerManifest(manifest, "192.168.64.2:5000/cosign-signed-single-sample", mech, TestKeyFingerprint)
+	require.NoError(t, err)
+	blob, err := signature.Blob(signature.SimpleSigningFromBlob(sig))
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "signature-2"), blob, 0o600)
+	require.NoError(t, err)
+	return dir
+}
+
+func TestPRSignedByThresholdIsRunningImageAllowed(t *testing.T) {
+	gpgSigner := xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchRepository())
+	otherGPGSigner := xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key-2.gpg", NewPRMMatchRepository())
+	sigstoreSigner := xNewPRSigstoreSigned(PRSigstoreSignedWithKeyPath("fixtures/cosign.pub"),
+		PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()))
+	otherSigstoreSigner := xNewPRSigstoreSigned(PRSigstoreSignedWithKeyPath("fixtures/cosign2.pub"),
+		PRSigstoreSignedWithSignedIdentity(NewPRMMatchRepository()))
+
+	simpleImage := dirImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest")
+	sigstoreImage := dirImageMock(t, "fixtures/dir-img-cosign-valid", "192.168.64.2:5000/cosign-signed-single-sample")
+	for _, c := range []struct {
+		name      string
+		image     private.UnparsedImage
+		threshold int
+		signers   PolicyRequirements
+		allowed   bool
+	}{
+		{"1 of 1", simpleImage, 1, PolicyRequirements{gpgSigner}, true},
+		{"1 of 2", simpleImage, 1, PolicyRequirements{otherGPGSigner, gpgSigner}, true},
+		{"2 of 2, one missing", simpleImage, 2, PolicyRequirements{gpgSigner, otherGPGSigner}, false},
+		{"1 of 2, none present", simpleImage, 1, PolicyRequirements{otherGPGSigner, sigstoreSigner}, false},
+		{"sigstore 1 of 2", sigstoreImage, 1, PolicyRequirements{gpgSigner, sigstoreSigner}, true},
+		{"sigstore 2 of 3", sigstoreImage, 2, PolicyRequirements{gpgSigner, sigstoreSigner, otherSigstoreSigner}, false},
+	} {
+		pr := xNewPRSignedByThreshold(c.threshold, c.signers)
+		res, err := pr.isRunningImageAllowed(context.Background(), c.image)
+		if c.allowed {
+			assertRunningAllowed(t, res, err)
+		} else {
+			assertRunningRejectedPolicyRequirement(t, res, err)
+		}
+	}
+
+	// Signatures of both formats on a single image
+	if dir := mixedSignaturesImageDir(t); dir != "" {
+		image := dirImageMock(t, dir, "192.168.64.2:5000/cosign-signed-single-sample")
+		pr := xNewPRSignedByThreshold(2, PolicyRequirements{gpgSigner, otherGPGSigner, sigstoreSigner})
+		res, err := pr.isRunningImageAllowed(context.Background(), image)
+		assertRunningAllowed(t, res, err)
+		pr = xNewPRSignedByThreshold(3, PolicyRequirements{gpgSigner, otherGPGSigner, sigstoreSigner})
+		res, err = pr.isRunningImageAllowed(context.Background(), image)
+		assertRunningRejectedPolicyRequirement(t, res, err)
+	}
+
+	// A single signature does not count for several signers using the same key. Do not use NewPRSignedByThreshold,
+	// because it would reject these signers.
+	gpgKey, err := os.ReadFile("fixtures/public-key.gpg")
+	require.NoError(t, err)
+	for _, signers := range []PolicyRequirements{
+		{gpgSigner, gpgSigner},
+		{gpgSigner, xNewPRSignedByKeyData(SBKeyTypeGPGKeys, gpgKey, NewPRMMatchRepository())},
+	} {
+		sharedKeysPR := &prSignedByThreshold{
+			prCommon:  prCommon{Type: prTypeSignedByThreshold},
+			Threshold: 2,
+			Signers:   signers,
+		}
+		res, err := sharedKeysPR.isRunningImageAllowed(context.Background(), simpleImage)
+		assertRunningRejectedPolicyRequirement(t, res, err)
+	}
+
+	// Invalid threshold. Do not use NewPRSignedByThreshold, because it would reject this.
+	invalidPR := &prSignedByThreshold{
+		prCommon:  prCommon{Type: prTypeSignedByThreshold},
+		Threshold: 2,
+		Signers:   PolicyRequirements{gpgSigner},
+	}
+	res, err := invalidPR.isRunningImageAllowed(context.Background(), simpleImage)
+	assertRunningRejected(t, res, err)
+}
+
+func TestAssignDistinctSigningKeys(t *testing.T) {
+	sig := func(index int, key string) AcceptedSignatureDetails {
+		return AcceptedSignatureDetails{Index: index, KeyFingerprint: key}
+	}
+	fulcioSig := func(index int, key, identity string) AcceptedSignatureDetails {
+		return AcceptedSignatureDetails{Index: index, KeyFingerprint: key, SignerIdentity: identity, OIDCIssuer: "https://issuer.example.com"}
+	}
+	for _, c := range []struct {
+		name       string
+		candidates [][]AcceptedSignatureDetails
+		expected   []AcceptedSignatureDetails
+	}{
+		{"no signers", nil, []AcceptedSignatureDetails{}},
+		{"no accepted signatures", [][]AcceptedSignatureDetails{nil, nil}, []AcceptedSignatureDetails{}},
+		{"distinct keys", [][]AcceptedSignatureDetails{{sig(0, "A")}, {sig(1, "B")}}, []AcceptedSignatureDetails{sig(0, "A"), sig(1, "B")}},
+		{"same signature", [][]AcceptedSignatureDetails{{sig(0, "A")}, {sig(0, "A")}}, []AcceptedSignatureDetails{sig(0, "A")}},
+		{"same key, different signatures", [][]AcceptedSignatureDetails{{sig(0, "A")}, {sig(1, "a")}}, []AcceptedSignatureDetails{sig(0, "A")}},
+		{ // The first signer must give up key A for the second one to be counted
+			"reassignment",
+			[][]AcceptedSignatureDetails{{sig(0, "A"), sig(1, "B")}, {sig(0, "A")}},
+			[]AcceptedSignatureDetails{sig(1, "B"), sig(0, "A")},
+		},
+		{
+			"same Fulcio identity, different keys",
+			[][]AcceptedSignatureDetails{{fulcioSig(0, "A", "user@example.com")}, {fulcioSig(1, "B", "user@example.com")}},
+			[]AcceptedSignatureDetails{fulcioSig(0, "A", "user@example.com")},
+		},
+	} {
+		res := assignDistinctSigningKeys(c.candidates)
+		assert.Equal(t, c.expected, res, c.name)
+	}
+}
+
+func TestPRSignedByThresholdTracing(t *testing.T) {
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{xNewPRSignedByThreshold(1, PolicyRequirements{
+			xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchRepository()),
+		})},
+	})
+	require.NoError(t, err)
+	defer func() {
+		err := pc.Destroy()
+		require.NoError(t, err)
+	}()
+	pc.SetTracing(true)
+
+	res, err := pc.IsRunningImageAllowed(context.Background(), pcImageMock(t, "fixtures/dir-img-valid", "testing/manifest:latest"))
+	assertRunningAllowed(t, res, err)
+	trace := pc.LastTrace()
+	require.NotNil(t, trace)
+	require.Len(t, trace.Requirements, 1)
+	assert.Equal(t, "signedByThreshold", trace.Requirements[0].Type)
+	assert.True(t, trace.Requirements[0].Allowed)
+	// Signatures are not recorded by the individual signers.
+	assert.Empty(t, trace.Requirements[0].Signatures)
+}
@@ -0,0 +1,163 @@
+package signature
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/v5/types"
+)
+
+// PolicyEvaluationTrace is a structured record of a single policy evaluation,
+// intended to help users understand why an image was accepted or rejected.
+// ONLY use this for diagnostics, not for any decisions!
+type PolicyEvaluationTrace struct {
+	// Image is a description of the image identity, in the transport:identity format.
+	Image string
+	// Transport is the name of the transport of the image.
+	Transport string
+	// Scope is the scope within the transport’s section of the policy which was used, "" for the transport’s default scope.
+	// Not meaningful if UsedDefaultPolicy.
+	Scope string
+	// UsedDefaultPolicy is true if there was no matching scope and the top-level "default" requirements were used.
+	UsedDefaultPolicy bool
+	// Requirements contains one entry for each requirement of the used scope, in policy order.
+	Requirements []PolicyRequirementTrace
+	// Allowed is the overall result of IsRunningImageAllowed; it is always false for GetSignaturesWithAcceptedAuthor.
+	Allowed bool
+	// Error is the error returned by the evaluation, if any.
+	Error string
+}
+
+// PolicyRequirementTrace records the evaluation of a single PolicyRequirement.
+type PolicyRequirementTrace struct {
+	// Type is the type of the requirement, as used in policy.json (e.g. "signedBy").
+	Type string
+	// Evaluated is false if the requirement was not evaluated because an earlier requirement already rejected the image.
+	// (For GetSignaturesWithAcceptedAuthor, this is set if the requirement was evaluated for at least one signature.)
+	Evaluated bool
+	// Allowed is the result of IsRunningImageAllowed for this requirement; it is always false for GetSignaturesWithAcceptedAuthor.
+	Allowed bool
+	// Error is the reason for rejection, if the requirement rejected the image.
+	Error string
+	// Signatures contains one entry for each signature examined by this requirement.
+	Signatures []PolicySignatureTrace
+}
+
+// PolicySignatureTrace records the result of examining a single signature.
+type PolicySignatureTrace struct {
+	// Index is the index of the signature in the image’s list of signatures.
+	Index int
+	// Result is "accepted", "rejected", "unknown" (the requirement does not deal with signatures), or "ignored"
+	// (the signature was not of a kind relevant for the requirement).
+	Result string
+	// Error is the reason for rejection, if any.
+	Error string
+}
+
+const (
+	sigTraceAccepted = "accepted"
+	sigTraceRejected = "rejected"
+	sigTraceUnknown  = "unknown"
+	sigTraceIgnored  = "ignored"
+)
+
+// SetTracing enables or disables recording a PolicyEvaluationTrace for subsequent
+// IsRunningImageAllowed and GetSignaturesWithAcceptedAuthor calls.
+// The trace of the most recent call is available through LastTrace.
+func (pc *PolicyContext) SetTracing(enabled bool) {
+	pc.tracing = enabled
+	if !enabled {
+		pc.lastTrace = nil
+	}
+}
+
+// LastTrace returns the trace of the most recent IsRunningImageAllowed or GetSignaturesWithAcceptedAuthor call,
+// or nil if tracing was not enabled for that call.
+func (pc *PolicyContext) LastTrace() *PolicyEvaluationTrace {
+	return pc.lastTrace
+}
+
+// newTrace returns a new trace for an evaluation of reqs, and records it as pc.lastTrace, if tracing is enabled.
+// Otherwise it returns nil.
+func (pc *PolicyContext) newTrace(ref types.ImageReference, reqs PolicyRequirements, scope policyScope) *PolicyEvaluationTrace {
+	pc.lastTrace = nil
+	if !pc.tracing {
+		return nil
+	}
+	trace := &PolicyEvaluationTrace{
+		Image:             policyIdentityLogName(ref),
+		Transport:         scope.transport,
+		Scope:             scope.scope,
+		UsedDefaultPolicy: scope.usedDefault,
+		Requirements:      make([]PolicyRequirementTrace, len(reqs)),
+	}
+	for i, req := range reqs {
+		trace.Requirements[i].Type = policyRequirementTypeName(req)
+	}
+	pc.lastTrace = trace
+	return trace
+}
+
+// policyRequirementTypeName returns the policy.json type of req.
+func policyRequirementTypeName(req PolicyRequirement) string {
+	switch req := req.(type) {
+	case *prInsecureAcceptAnything:
+		return string(req.Type)
+	case *prReject:
+		return string(req.Type)
+	case *prSignedBy:
+		return string(req.Type)
+	case *prSignedBaseLayer:
+		return string(req.Type)
+	case *prSigstoreSigned:
+		return string(req.Type)
+	case *prDigestList:
+		return string(req.Type)
+	case *prMaxImageAge:
+		return string(req.Type)
+	case *prSLSAProvenance:
+		return string(req.Type)
+	case *prSignedByThreshold:
+		return string(req.Type)
+	default: // Coverage: This should never happen, the PolicyRequirement implementations are private.
+		return fmt.Sprintf("%T", req)
+	}
+}
+
+// errorString returns err.Error(), or "" if err is nil.
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// signatureTraceKey is the context key for a *PolicyRequirementTrace collecting signature results.
+type signatureTraceKey struct{}
+
+// contextWithRequirementTrace returns a context which causes traceSignature to record into trace, if trace is not nil.
+func contextWithRequirementTrace(ctx context.Context, trace *PolicyRequirementTrace) context.Context {
+	if trace == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, signatureTraceKey{}, trace)
+}
+
+// contextWithoutRequirementTrace returns a context which causes traceSignature not to record anything,
+// e.g. for requirements evaluated as a part of another requirement.
+func contextWithoutRequirementTrace(ctx context.Context) context.Context {
+	return context.WithValue(ctx, signatureTraceKey{}, nil)
+}
+
+// traceSignature records the result of examining signature number index, if ctx was set up using contextWithRequirementTrace.
+func traceSignature(ctx context.Context, index int, result string, err error) {
+	trace, ok := ctx.Value(signatureTraceKey{}).(*PolicyRequirementTrace)
+	if !ok {
+		return
+	}
+	trace.Signatures = append(trace.Signatures, PolicySignatureTrace{
+		Index:  index,
+		Result: result,
+		Error:  errorString(err),
+	})
+}
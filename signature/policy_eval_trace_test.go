@@ -0,0 +1,118 @@
+package signature
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPolicyContextTracing(t *testing.T) {
+	pc, err := NewPolicyContext(&Policy{
+		Default: PolicyRequirements{NewPRReject()},
+		Transports: map[string]PolicyTransportScopes{
+			"docker": {
+				"docker.io/testing/manifest:latest": {
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchExact()),
+				},
+				"docker.io/testing/manifest:allowDeny": {
+					xNewPRSignedByKeyPath(SBKeyTypeGPGKeys, "fixtures/public-key.gpg", NewPRMMatchRepository()),
+					NewPRReject(),
+				},
+				"docker.io/testing": {
+					NewPRInsecureAcceptAnything(),
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+	defer func() {
+		err := pc.Destroy()
+		require.NoError(t, err)
+	}()
+
+	// No trace is recorded by default
+	img := pcImageMock(t, "fixtures/dir-img-mixed", "testing/manifest:latest")
+	res, err := pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningAllowed(t, res, err)
+	assert.Nil(t, pc.LastTrace())
+
+	pc.SetTracing(true)
+
+	// 1 invalid, 1 valid signature (in this order)
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningAllowed(t, res, err)
+	trace := pc.LastTrace()
+	require.NotNil(t, trace)
+	assert.Equal(t, "docker", trace.Transport)
+	assert.Equal(t, "docker.io/testing/manifest:latest", trace.Scope)
+	assert.False(t, trace.UsedDefaultPolicy)
+	assert.True(t, trace.Allowed)
+	assert.Empty(t, trace.Error)
+	require.Len(t, trace.Requirements, 1)
+	req := trace.Requirements[0]
+	assert.Equal(t, "signedBy", req.Type)
+	assert.True(t, req.Evaluated)
+	assert.True(t, req.Allowed)
+	require.Len(t, req.Signatures, 2)
+	assert.Equal(t, 0, req.Signatures[0].Index)
+	assert.Equal(t, sigTraceRejected, req.Signatures[0].Result)
+	assert.NotEmpty(t, req.Signatures[0].Error)
+	assert.Equal(t, PolicySignatureTrace{Index: 1, Result: sigTraceAccepted}, req.Signatures[1])
+
+	// Allow + deny results
+	img = pcImageMock(t, "fixtures/dir-img-mixed", "testing/manifest:allowDeny")
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningRejectedPolicyRequirement(t, res, err)
+	trace = pc.LastTrace()
+	require.NotNil(t, trace)
+	assert.False(t, trace.Allowed)
+	assert.Equal(t, err.Error(), trace.Error)
+	require.Len(t, trace.Requirements, 2)
+	assert.True(t, trace.Requirements[0].Allowed)
+	assert.Equal(t, "reject", trace.Requirements[1].Type)
+	assert.True(t, trace.Requirements[1].Evaluated)
+	assert.False(t, trace.Requirements[1].Allowed)
+	assert.Equal(t, err.Error(), trace.Requirements[1].Error)
+
+	// A namespace scope
+	img = pcImageMock(t, "fixtures/dir-img-unsigned", "testing/manifest:other")
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningAllowed(t, res, err)
+	trace = pc.LastTrace()
+	require.NotNil(t, trace)
+	assert.Equal(t, "docker.io/testing", trace.Scope)
+	require.Len(t, trace.Requirements, 1)
+	assert.Equal(t, "insecureAcceptAnything", trace.Requirements[0].Type)
+
+	// The default policy
+	img = pcImageMock(t, "fixtures/dir-img-valid", "other/image:latest")
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningRejectedPolicyRequirement(t, res, err)
+	trace = pc.LastTrace()
+	require.NotNil(t, trace)
+	assert.True(t, trace.UsedDefaultPolicy)
+	require.Len(t, trace.Requirements, 1)
+	assert.Equal(t, "reject", trace.Requirements[0].Type)
+
+	// GetSignaturesWithAcceptedAuthor
+	img = pcImageMock(t, "fixtures/dir-img-mixed", "testing/manifest:latest")
+	sigs, err := pc.GetSignaturesWithAcceptedAuthor(context.Background(), img)
+	require.NoError(t, err)
+	assert.Len(t, sigs, 1)
+	trace = pc.LastTrace()
+	require.NotNil(t, trace)
+	require.Len(t, trace.Requirements, 1)
+	assert.True(t, trace.Requirements[0].Evaluated)
+	require.Len(t, trace.Requirements[0].Signatures, 2)
+	assert.Equal(t, sigTraceRejected, trace.Requirements[0].Signatures[0].Result)
+	assert.Equal(t, sigTraceAccepted, trace.Requirements[0].Signatures[1].Result)
+
+	// Disabling tracing drops the trace
+	pc.SetTracing(false)
+	assert.Nil(t, pc.LastTrace())
+	res, err = pc.IsRunningImageAllowed(context.Background(), img)
+	assertRunningAllowed(t, res, err)
+	assert.Nil(t, pc.LastTrace())
+}
@@ -9,11 +9,35 @@ import (
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
 )
 
+// imageDockerReferenceIdentity returns the Docker reference identity of ref, or nil if it has none.
+// For transports without a Docker reference which refer to images by a transport-specific name (e.g. oci:),
+// the name is used if it is a fully explicit Docker reference, e.g. oci:/path/to/layout:example.com/repo:tag.
+// Short names are not expanded, so e.g. oci:/path/to/layout:busybox:latest has no Docker reference identity.
+func imageDockerReferenceIdentity(ref types.ImageReference) reference.Named {
+	if res := ref.DockerReference(); res != nil {
+		return res
+	}
+	accessor, ok := ref.(private.ImageNameAccessor)
+	if !ok {
+		return nil
+	}
+	name := accessor.ImageName()
+	if name == "" {
+		return nil
+	}
+	res, err := reference.ParseNamed(name) // Fails if name is not in the fully explicit form.
+	if err != nil || reference.IsNameOnly(res) {
+		return nil
+	}
+	return res
+}
+
 // parseImageAndDockerReference converts an image and a reference string into two parsed entities, failing on any error and handling unidentified images.
 func parseImageAndDockerReference(image private.UnparsedImage, s2 string) (reference.Named, reference.Named, error) {
-	r1 := image.Reference().DockerReference()
+	r1 := imageDockerReferenceIdentity(image.Reference())
 	if r1 == nil {
 		return nil, nil, PolicyRequirementError(fmt.Sprintf("Docker reference match attempted on image %s with no known Docker reference identity",
 			transports.ImageName(image.Reference())))
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"testing"
 
+	"github.com/containers/image/v5/directory"
 	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/image/v5/internal/testing/mocks"
+	ocilayout "github.com/containers/image/v5/oci/layout"
 	"github.com/containers/image/v5/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -52,6 +54,81 @@ func TestParseImageAndDockerReference(t *testing.T) {
 	}
 }
 
+func TestImageDockerReferenceIdentity(t *testing.T) {
+	// A Docker reference is used if available
+	ref, err := reference.ParseNormalizedNamed(fullRHELRef)
+	require.NoError(t, err)
+	assert.Equal(t, ref, imageDockerReferenceIdentity(refImageReferenceMock{ref: ref}))
+	assert.Nil(t, imageDockerReferenceIdentity(refImageReferenceMock{ref: nil}))
+
+	// Transport-specific image names
+	dir := t.TempDir()
+	for _, c := range []struct{ name, expected string }{
+		{fullRHELRef, fullRHELRef},
+		{untaggedRHELRef + digestSuffix, untaggedRHELRef + digestSuffix},
+		{"", ""},                  // No name
+		{untaggedRHELRef, ""},     // Name-only
+		{"busybox:latest", ""},    // Not fully explicit
+		{"docker.io/busybox", ""}, // Not fully explicit
+		{"this is not valid", ""}, // Not a Docker reference at all
+	} {
+		ociRef, err := ocilayout.NewReference(dir, c.name)
+		if err != nil {
+			continue // Some of the invalid values may be rejected by the transport
+		}
+		res := imageDockerReferenceIdentity(ociRef)
+		if c.expected == "" {
+			assert.Nil(t, res, c.name)
+		} else {
+			require.NotNil(t, res, c.name)
+			assert.Equal(t, c.expected, res.String(), c.name)
+		}
+	}
+
+	// Transports with neither
+	dirRef, err := directory.NewReference(dir)
+	require.NoError(t, err)
+	assert.Nil(t, imageDockerReferenceIdentity(dirRef))
+}
+
+// imageReferenceImageMock is a mock of private.UnparsedImage which returns a specified Reference().
+type imageReferenceImageMock struct {
+	mocks.ForbiddenUnparsedImage
+	ref types.ImageReference
+}
+
+func (i imageReferenceImageMock) Reference() types.ImageReference {
+	return i.ref
+}
+
+func TestMatchesDockerReferenceWithImageName(t *testing.T) {
+	dir := t.TempDir()
+	ociRef, err := ocilayout.NewReference(dir, fullRHELRef)
+	require.NoError(t, err)
+	image := imageReferenceImageMock{ref: ociRef}
+	for _, c := range []struct {
+		prm    PolicyReferenceMatch
+		sigRef string
+		result bool
+	}{
+		{NewPRMMatchExact(), fullRHELRef, true},
+		{NewPRMMatchExact(), untaggedRHELRef + ":other", false},
+		{NewPRMMatchRepoDigestOrExact(), fullRHELRef, true},
+		{NewPRMMatchRepoDigestOrExact(), untaggedRHELRef + ":other", false},
+		{NewPRMMatchRepository(), untaggedRHELRef + ":other", true},
+		{NewPRMMatchRepository(), "example.com/other:7.2.3", false},
+	} {
+		res := c.prm.matchesDockerReference(image, c.sigRef)
+		assert.Equal(t, c.result, res, fmt.Sprintf("%#v vs. %s", c.prm, c.sigRef))
+	}
+
+	// An image name which is not a fully explicit reference is not used
+	ociRef, err = ocilayout.NewReference(dir, "rhel:7.2.3")
+	require.NoError(t, err)
+	res := NewPRMMatchRepository().matchesDockerReference(imageReferenceImageMock{ref: ociRef}, "docker.io/library/rhel:7.2.3")
+	assert.False(t, res)
+}
+
 // refImageMock is a mock of private.UnparsedImage which returns itself in Reference().DockerReference.
 type refImageMock struct {
 	mocks.ForbiddenUnparsedImage
@@ -0,0 +1,353 @@
+// policy_remote.go handles loading policies from remote sources (HTTPS servers and OCI artifacts),
+// with local caching and optional verification of a signature over the policy.
+
+package signature
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/containers/image/v5/internal/iolimits"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/signature/internal"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	"github.com/containers/storage/pkg/ioutils"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	sigstoreSignature "github.com/sigstore/sigstore/pkg/signature"
+)
+
+const (
+	// PolicyMediaType is the media type of a layer containing a policy.json file in an OCI artifact.
+	PolicyMediaType = "application/vnd.containers.policy.v1+json"
+	// PolicySignatureMediaType is the media type of a layer containing a signature of the policy in an OCI artifact,
+	// in the format described in RemotePolicyOptions.PublicKeyData.
+	PolicySignatureMediaType = "application/vnd.containers.policy.signature.v1+base64"
+)
+
+// RemotePolicyOptions configures how a policy is fetched by NewPolicyFromURL and NewPolicyFromImage.
+type RemotePolicyOptions struct {
+	// CacheDir, if not "", is a directory used to cache the fetched policy (and its signature, if any).
+	// It is created if it does not exist.
+	CacheDir string
+	// TTL is the duration for which a cached policy is used without contacting the remote source.
+	// If 0, the remote source is contacted every time.
+	TTL time.Duration
+	// OfflineFallback, if true, allows using a cached policy older than TTL if the remote source can not be contacted.
+	OfflineFallback bool
+	// PublicKeyData, if not nil, is a PEM-encoded public key, and the policy is only accepted if it has a valid
+	// signature by that key. The signature is a base64-encoded signature of the SHA-256 digest of the raw
+	// policy file, as created e.g. by (cosign sign-blob).
+	// Signatures are verified also when using a cached policy.
+	PublicKeyData []byte
+	// SignatureURL is the URL of the signature used by NewPolicyFromURL; if "", the policy URL with a ".sig" suffix is used.
+	SignatureURL string
+	// HTTPClient is used by NewPolicyFromURL; if nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+	// Logger, if not nil, receives log messages; otherwise NewPolicyFromImage uses the logger of its SystemContext,
+	// and NewPolicyFromURL uses the standard logrus logger.
+	Logger types.Logger
+}
+
+// remotePolicyData is the raw contents of a policy, and its signature if any, obtained from a remote source or a cache.
+type remotePolicyData struct {
+	policy    []byte
+	signature []byte // nil if not available
+}
+
+// NewPolicyFromURL returns a policy fetched from policyURL, typically using HTTPS, as configured by options.
+func NewPolicyFromURL(ctx context.Context, policyURL string, options *RemotePolicyOptions) (*Policy, error) {
+	if options == nil {
+		options = &RemotePolicyOptions{}
+	}
+	return newPolicyFromRemoteSource(policyURL, options, logging.For(nil), func() (*remotePolicyData, error) {
+		client := options.HTTPClient
+		if client == nil {
+			client = http.DefaultClient
+		}
+		policy, err := fetchRemotePolicyURL(ctx, client, policyURL)
+		if err != nil {
+			return nil, err
+		}
+		res := remotePolicyData{policy: policy}
+		if options.PublicKeyData != nil {
+			sigURL := options.SignatureURL
+			if sigURL == "" {
+				sigURL = policyURL + ".sig"
+			}
+			sig, err := fetchRemotePolicyURL(ctx, client, sigURL)
+			if err != nil {
+				return nil, err
+			}
+			res.signature = sig
+		}
+		return &res, nil
+	})
+}
+
+// fetchRemotePolicyURL returns the body of url.
+func fetchRemotePolicyURL(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: status %d (%s)", url, res.StatusCode, http.StatusText(res.StatusCode))
+	}
+	body, err := iolimits.ReadAtMost(res.Body, iolimits.MaxPolicyBodySize)
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", url, err)
+	}
+	return body, nil
+}
+
+// NewPolicyFromImage returns a policy stored in an OCI artifact at ref, as configured by options.
+// The artifact must contain exactly one layer with media type PolicyMediaType, and if options.PublicKeyData is set,
+// a layer with media type PolicySignatureMediaType.
+func NewPolicyFromImage(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, options *RemotePolicyOptions) (*Policy, error) {
+	if options == nil {
+		options = &RemotePolicyOptions{}
+	}
+	return newPolicyFromRemoteSource(transports.ImageName(ref), options, logging.For(sys), func() (*remotePolicyData, error) {
+		return fetchRemotePolicyImage(ctx, sys, ref, options.PublicKeyData != nil)
+	})
+}
+
+// fetchRemotePolicyImage returns the policy, and its signature if needSignature, stored in an OCI artifact at ref.
+func fetchRemotePolicyImage(ctx context.Context, sys *types.SystemContext, ref types.ImageReference, needSignature bool) (*remotePolicyData, error) {
+	src, err := ref.NewImageSource(ctx, sys)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	manifestBlob, mimeType, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.NormalizedMIMEType(mimeType) != imgspecv1.MediaTypeImageManifest {
+		return nil, fmt.Errorf("policy artifact %s has unexpected manifest type %q", transports.ImageName(ref), mimeType)
+	}
+	m, err := manifest.OCI1FromManifest(manifestBlob)
+	if err != nil {
+		return nil, err
+	}
+
+	res := remotePolicyData{}
+	for _, layer := range m.Layers {
+		var dest *[]byte
+		switch layer.MediaType {
+		case PolicyMediaType:
+			dest = &res.policy
+		case PolicySignatureMediaType:
+			if !needSignature {
+				continue
+			}
+			dest = &res.signature
+		default:
+			continue
+		}
+		if *dest != nil {
+			return nil, fmt.Errorf("policy artifact %s contains more than one %q layer", transports.ImageName(ref), layer.MediaType)
+		}
+		blob, err := fetchRemotePolicyBlob(ctx, src, types.BlobInfo{Digest: layer.Digest, Size: layer.Size})
+		if err != nil {
+			return nil, err
+		}
+		*dest = blob
+	}
+	if res.policy == nil {
+		return nil, fmt.Errorf("policy artifact %s does not contain a %q layer", transports.ImageName(ref), PolicyMediaType)
+	}
+	if needSignature && res.signature == nil {
+		return nil, fmt.Errorf("policy artifact %s does not contain a %q layer", transports.ImageName(ref), PolicySignatureMediaType)
+	}
+	return &res, nil
+}
+
+// fetchRemotePolicyBlob returns the contents of blob from src, after verifying its digest.
+func fetchRemotePolicyBlob(ctx context.Context, src types.ImageSource, blob types.BlobInfo) ([]byte, error) {
+	if err := blob.Digest.Validate(); err != nil {
+		return nil, err
+	}
+	stream, _, err := src.GetBlob(ctx, blob, none.NoCache)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	contents, err := iolimits.ReadAtMost(stream, iolimits.MaxPolicyBodySize)
+	if err != nil {
+		return nil, fmt.Errorf("reading blob %s: %w", blob.Digest.String(), err)
+	}
+	if actual := blob.Digest.Algorithm().FromBytes(contents); actual != blob.Digest {
+		return nil, fmt.Errorf("blob %s has unexpected digest %s", blob.Digest.String(), actual.String())
+	}
+	return contents, nil
+}
+
+// newPolicyFromRemoteSource returns a policy from source, using fetch to obtain it if there is no usable cached copy,
+// as configured by options; messages are logged using defaultLogger unless options.Logger is set.
+func newPolicyFromRemoteSource(source string, options *RemotePolicyOptions, defaultLogger types.Logger, fetch func() (*remotePolicyData, error)) (*Policy, error) {
+	logger := defaultLogger
+	if options.Logger != nil {
+		logger = options.Logger
+	}
+	var publicKey crypto.PublicKey
+	if options.PublicKeyData != nil {
+		pk, err := cryptoutils.UnmarshalPEMToPublicKey(options.PublicKeyData)
+		if err != nil {
+			return nil, fmt.Errorf("parsing policy public key: %w", err)
+		}
+		publicKey = pk
+	}
+
+	var cache *remotePolicyCache
+	if options.CacheDir != "" {
+		cache = newRemotePolicyCache(options.CacheDir, source)
+		if data, age, err := cache.load(); err != nil {
+			logger.Debugf("Ignoring cached policy for %s: %v", source, err)
+		} else if data != nil && age < options.TTL {
+			policy, err := parseRemotePolicy(data, publicKey)
+			if err == nil {
+				logger.Debugf("Using cached policy for %s", source)
+				return policy, nil
+			}
+			logger.Debugf("Ignoring cached policy for %s: %v", source, err)
+		}
+	}
+
+	data, err := fetch()
+	if err != nil {
+		if cache != nil && options.OfflineFallback {
+			if cached, _, cacheErr := cache.load(); cacheErr == nil && cached != nil {
+				if policy, policyErr := parseRemotePolicy(cached, publicKey); policyErr == nil {
+					logger.Warnf("Using cached policy for %s, fetching it failed: %v", source, err)
+					return policy, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("fetching policy from %s: %w", source, err)
+	}
+	policy, err := parseRemotePolicy(data, publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy from %s: %w", source, err)
+	}
+	if cache != nil {
+		if err := cache.store(data); err != nil {
+			logger.Warnf("Error caching policy for %s: %v", source, err)
+		}
+	}
+	return policy, nil
+}
+
+// parseRemotePolicy verifies data using publicKey, if not nil, and returns the contained policy.
+func parseRemotePolicy(data *remotePolicyData, publicKey crypto.PublicKey) (*Policy, error) {
+	if publicKey != nil {
+		if data.signature == nil {
+			return nil, errors.New("policy signature is missing")
+		}
+		if err := verifyRemotePolicySignature(publicKey, data.policy, data.signature); err != nil {
+			return nil, err
+		}
+	}
+	return NewPolicyFromBytes(data.policy)
+}
+
+// verifyRemotePolicySignature verifies that unverifiedBase64Signature is a signature of unverifiedPolicy by publicKey.
+func verifyRemotePolicySignature(publicKey crypto.PublicKey, unverifiedPolicy, unverifiedBase64Signature []byte) error {
+	verifier, err := sigstoreSignature.LoadVerifier(publicKey, crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("creating verifier: %w", err)
+	}
+	unverifiedSignature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(unverifiedBase64Signature)))
+	if err != nil {
+		return internal.NewInvalidSignatureError(fmt.Sprintf("base64 decoding policy signature: %v", err))
+	}
+	if err := verifier.VerifySignature(bytes.NewReader(unverifiedSignature), bytes.NewReader(unverifiedPolicy)); err != nil {
+		return internal.NewInvalidSignatureError(fmt.Sprintf("cryptographic verification of policy signature failed: %v", err))
+	}
+	return nil
+}
+
+// remotePolicyCache is a cached copy of a policy from a single remote source.
+type remotePolicyCache struct {
+	policyPath    string
+	signaturePath string
+}
+
+// newRemotePolicyCache returns a remotePolicyCache for source in dir.
+func newRemotePolicyCache(dir, source string) *remotePolicyCache {
+	sum := sha256.Sum256([]byte(source))
+	base := filepath.Join(dir, hex.EncodeToString(sum[:]))
+	return &remotePolicyCache{
+		policyPath:    base + ".json",
+		signaturePath: base + ".sig",
+	}
+}
+
+// load returns the cached data and its age, or nil if there is no cached data.
+func (c *remotePolicyCache) load() (*remotePolicyData, time.Duration, error) {
+	f, err := os.Open(c.policyPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	policy, err := io.ReadAll(f)
+	if err != nil {
+		return nil, 0, err
+	}
+	res := remotePolicyData{policy: policy}
+	sig, err := os.ReadFile(c.signaturePath)
+	switch {
+	case err == nil:
+		res.signature = sig
+	case !errors.Is(err, fs.ErrNotExist):
+		return nil, 0, err
+	}
+	return &res, time.Since(fi.ModTime()), nil
+}
+
+// store records data in the cache.
+func (c *remotePolicyCache) store(data *remotePolicyData) error {
+	if err := os.MkdirAll(filepath.Dir(c.policyPath), 0o700); err != nil {
+		return err
+	}
+	// Write the signature first, so that a concurrent reader never sees a new policy with a stale signature
+	// (it can see an old policy with a new signature, which fails verification, and is then refetched).
+	if data.signature != nil {
+		if err := ioutils.AtomicWriteFile(c.signaturePath, data.signature, 0o600); err != nil {
+			return err
+		}
+	} else if err := os.Remove(c.signaturePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return ioutils.AtomicWriteFile(c.policyPath, data.policy, 0o600)
+}
@@ -0,0 +1,309 @@
+package signature
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/directory"
+	digest "github.com/opencontainers/go-digest"
+	imgspecs "github.com/opencontainers/image-spec/specs-go"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	sigstoreSignature "github.com/sigstore/sigstore/pkg/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	remotePolicyAccept = `{"default":[{"type":"insecureAcceptAnything"}]}`
+	remotePolicyReject = `{"default":[{"type":"reject"}]}`
+)
+
+// newRemotePolicyKey returns a PEM-encoded public key, and a function signing data using the corresponding private key.
+func newRemotePolicyKey(t *testing.T) ([]byte, func([]byte) []byte) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	publicKeyPEM, err := cryptoutils.MarshalPublicKeyToPEM(privateKey.Public())
+	require.NoError(t, err)
+	signer, err := sigstoreSignature.LoadECDSASignerVerifier(privateKey, crypto.SHA256)
+	require.NoError(t, err)
+	return publicKeyPEM, func(data []byte) []byte {
+		sig, err := signer.SignMessage(bytes.NewReader(data))
+		require.NoError(t, err)
+		return []byte(base64.StdEncoding.EncodeToString(sig))
+	}
+}
+
+// remotePolicyServer is a HTTP server serving a policy and its signature.
+type remotePolicyServer struct {
+	policy, signature atomic.Pointer[[]byte]
+	requests          atomic.Int32
+	fail              atomic.Bool
+}
+
+func newRemotePolicyServer(t *testing.T, policy, signature []byte) (*remotePolicyServer, string) {
+	s := &remotePolicyServer{}
+	s.set(policy, signature)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		if s.fail.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var data *[]byte
+		switch r.URL.Path {
+		case "/policy.json":
+			data = s.policy.Load()
+		case "/policy.json.sig":
+			data = s.signature.Load()
+		}
+		if data == nil || *data == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, err := w.Write(*data)
+		assert.NoError(t, err)
+	}))
+	t.Cleanup(server.Close)
+	return s, server.URL + "/policy.json"
+}
+
+func (s *remotePolicyServer) set(policy, signature []byte) {
+	s.policy.Store(&policy)
+	s.signature.Store(&signature)
+}
+
+func TestNewPolicyFromURL(t *testing.T) {
+	ctx := context.Background()
+	publicKey, sign := newRemotePolicyKey(t)
+	otherPublicKey, otherSign := newRemotePolicyKey(t)
+
+	// Unsigned policy
+	_, url := newRemotePolicyServer(t, []byte(remotePolicyAccept), nil)
+	policy, err := NewPolicyFromURL(ctx, url, nil)
+	require.NoError(t, err)
+	assert.Equal(t, &Policy{Default: PolicyRequirements{NewPRInsecureAcceptAnything()}, Transports: map[string]PolicyTransportScopes{}}, policy)
+
+	// Signed policy
+	_, url = newRemotePolicyServer(t, []byte(remotePolicyAccept), sign([]byte(remotePolicyAccept)))
+	policy, err = NewPolicyFromURL(ctx, url, &RemotePolicyOptions{PublicKeyData: publicKey})
+	require.NoError(t, err)
+	assert.Equal(t, &Policy{Default: PolicyRequirements{NewPRInsecureAcceptAnything()}, Transports: map[string]PolicyTransportScopes{}}, policy)
+	// Signed by a different key
+	_, err = NewPolicyFromURL(ctx, url, &RemotePolicyOptions{PublicKeyData: otherPublicKey})
+	assert.Error(t, err)
+	// Explicit signature URL
+	_, otherURL := newRemotePolicyServer(t, []byte(remotePolicyReject), otherSign([]byte(remotePolicyAccept)))
+	policy, err = NewPolicyFromURL(ctx, url, &RemotePolicyOptions{PublicKeyData: otherPublicKey, SignatureURL: otherURL + ".sig"})
+	require.NoError(t, err)
+	assert.Equal(t, &Policy{Default: PolicyRequirements{NewPRInsecureAcceptAnything()}, Transports: map[string]PolicyTransportScopes{}}, policy)
+	// Invalid public key
+	_, err = NewPolicyFromURL(ctx, url, &RemotePolicyOptions{PublicKeyData: []byte("this is invalid")})
+	assert.Error(t, err)
+
+	// Signature does not match the policy
+	_, url = newRemotePolicyServer(t, []byte(remotePolicyAccept), sign([]byte(remotePolicyReject)))
+	_, err = NewPolicyFromURL(ctx, url, &RemotePolicyOptions{PublicKeyData: publicKey})
+	assert.Error(t, err)
+	// Signature is missing
+	_, url = newRemotePolicyServer(t, []byte(remotePolicyAccept), nil)
+	_, err = NewPolicyFromURL(ctx, url, &RemotePolicyOptions{PublicKeyData: publicKey})
+	assert.Error(t, err)
+	// Signature is not valid base64
+	_, url = newRemotePolicyServer(t, []byte(remotePolicyAccept), []byte("&"))
+	_, err = NewPolicyFromURL(ctx, url, &RemotePolicyOptions{PublicKeyData: publicKey})
+	assert.Error(t, err)
+	// Invalid policy
+	_, url = newRemotePolicyServer(t, []byte("{"), nil)
+	_, err = NewPolicyFromURL(ctx, url, nil)
+	assert.Error(t, err)
+	// Policy is missing
+	_, url = newRemotePolicyServer(t, nil, nil)
+	_, err = NewPolicyFromURL(ctx, url, nil)
+	assert.Error(t, err)
+}
+
+func TestNewPolicyFromURLCache(t *testing.T) {
+	ctx := context.Background()
+	publicKey, sign := newRemotePolicyKey(t)
+
+	server, url := newRemotePolicyServer(t, []byte(remotePolicyAccept), sign([]byte(remotePolicyAccept)))
+	cacheDir := t.TempDir()
+	options := RemotePolicyOptions{CacheDir: filepath.Join(cacheDir, "subdir"), TTL: time.Hour, PublicKeyData: publicKey}
+	acceptPolicy := &Policy{Default: PolicyRequirements{NewPRInsecureAcceptAnything()}, Transports: map[string]PolicyTransportScopes{}}
+	rejectPolicy := &Policy{Default: PolicyRequirements{NewPRReject()}, Transports: map[string]PolicyTransportScopes{}}
+
+	policy, err := NewPolicyFromURL(ctx, url, &options)
+	require.NoError(t, err)
+	assert.Equal(t, acceptPolicy, policy)
+	assert.Equal(t, int32(2), server.requests.Load())
+
+	// Within the TTL, the cached copy is used
+	server.set([]byte(remotePolicyReject), sign([]byte(remotePolicyReject)))
+	policy, err = NewPolicyFromURL(ctx, url, &options)
+	require.NoError(t, err)
+	assert.Equal(t, acceptPolicy, policy)
+	assert.Equal(t, int32(2), server.requests.Load())
+
+	// A cached copy with an invalid signature is not used
+	cache := newRemotePolicyCache(options.CacheDir, url)
+	err = os.WriteFile(cache.policyPath, []byte(remotePolicyReject), 0o600)
+	require.NoError(t, err)
+	server.set([]byte(remotePolicyAccept), sign([]byte(remotePolicyAccept)))
+	policy, err = NewPolicyFromURL(ctx, url, &options)
+	require.NoError(t, err)
+	assert.Equal(t, acceptPolicy, policy)
+	assert.Equal(t, int32(4), server.requests.Load())
+
+	// After the TTL expires, the policy is refetched
+	server.set([]byte(remotePolicyReject), sign([]byte(remotePolicyReject)))
+	expired := time.Now().Add(-2 * time.Hour)
+	err = os.Chtimes(cache.policyPath, expired, expired)
+	require.NoError(t, err)
+	policy, err = NewPolicyFromURL(ctx, url, &options)
+	require.NoError(t, err)
+	assert.Equal(t, rejectPolicy, policy)
+	assert.Equal(t, int32(6), server.requests.Load())
+
+	// If the server fails, an expired cached copy is only used with OfflineFallback
+	err = os.Chtimes(cache.policyPath, expired, expired)
+	require.NoError(t, err)
+	server.fail.Store(true)
+	_, err = NewPolicyFromURL(ctx, url, &options)
+	assert.Error(t, err)
+	offlineOptions := options
+	offlineOptions.OfflineFallback = true
+	policy, err = NewPolicyFromURL(ctx, url, &offlineOptions)
+	require.NoError(t, err)
+	assert.Equal(t, rejectPolicy, policy)
+	// … and only if it is correctly signed
+	err = os.WriteFile(cache.signaturePath, sign([]byte(remotePolicyAccept)), 0o600)
+	require.NoError(t, err)
+	_, err = NewPolicyFromURL(ctx, url, &offlineOptions)
+	assert.Error(t, err)
+
+	// A TTL of 0 never uses the cache
+	server.fail.Store(false)
+	server.set([]byte(remotePolicyAccept), nil)
+	requests := server.requests.Load()
+	for i := 0; i < 2; i++ {
+		policy, err = NewPolicyFromURL(ctx, url, &RemotePolicyOptions{CacheDir: options.CacheDir})
+		require.NoError(t, err)
+		assert.Equal(t, acceptPolicy, policy)
+	}
+	assert.Equal(t, requests+2, server.requests.Load())
+	_, err = os.Stat(cache.signaturePath)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+// writeRemotePolicyImage creates an OCI artifact in dir, containing layers with the specified media types and contents.
+func writeRemotePolicyImage(t *testing.T, dir string, manifestMIMEType string, layers map[string][]byte) {
+	err := os.WriteFile(filepath.Join(dir, "version"), []byte("Directory Transport Version: 1.1\n"), 0o644)
+	require.NoError(t, err)
+	m := imgspecv1.Manifest{
+		Versioned: imgspecs.Versioned{SchemaVersion: 2},
+		MediaType: manifestMIMEType,
+		Config:    imgspecv1.DescriptorEmptyJSON,
+	}
+	for mediaType, contents := range layers {
+		d := digest.FromBytes(contents)
+		err := os.WriteFile(filepath.Join(dir, d.Encoded()), contents, 0o644)
+		require.NoError(t, err)
+		m.Layers = append(m.Layers, imgspecv1.Descriptor{MediaType: mediaType, Digest: d, Size: int64(len(contents))})
+	}
+	manifestBlob, err := json.Marshal(m)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir, "manifest.json"), manifestBlob, 0o644)
+	require.NoError(t, err)
+}
+
+func TestNewPolicyFromImage(t *testing.T) {
+	ctx := context.Background()
+	publicKey, sign := newRemotePolicyKey(t)
+	acceptPolicy := &Policy{Default: PolicyRequirements{NewPRInsecureAcceptAnything()}, Transports: map[string]PolicyTransportScopes{}}
+
+	for _, c := range []struct {
+		name             string
+		manifestMIMEType string
+		layers           map[string][]byte
+		publicKey        []byte
+		success          bool
+	}{
+		{
+			name:             "unsigned",
+			manifestMIMEType: imgspecv1.MediaTypeImageManifest,
+			layers:           map[string][]byte{PolicyMediaType: []byte(remotePolicyAccept), "text/plain": []byte("ignored")},
+			success:          true,
+		},
+		{
+			name:             "signed",
+			manifestMIMEType: imgspecv1.MediaTypeImageManifest,
+			layers: map[string][]byte{
+				PolicyMediaType:          []byte(remotePolicyAccept),
+				PolicySignatureMediaType: sign([]byte(remotePolicyAccept)),
+			},
+			publicKey: publicKey,
+			success:   true,
+		},
+		{
+			name:             "invalid signature",
+			manifestMIMEType: imgspecv1.MediaTypeImageManifest,
+			layers: map[string][]byte{
+				PolicyMediaType:          []byte(remotePolicyAccept),
+				PolicySignatureMediaType: sign([]byte(remotePolicyReject)),
+			},
+			publicKey: publicKey,
+		},
+		{
+			name:             "missing signature",
+			manifestMIMEType: imgspecv1.MediaTypeImageManifest,
+			layers:           map[string][]byte{PolicyMediaType: []byte(remotePolicyAccept)},
+			publicKey:        publicKey,
+		},
+		{
+			name:             "missing policy",
+			manifestMIMEType: imgspecv1.MediaTypeImageManifest,
+			layers:           map[string][]byte{"text/plain": []byte(remotePolicyAccept)},
+		},
+		{
+			name:             "not an OCI manifest",
+			manifestMIMEType: "application/vnd.docker.distribution.manifest.v2+json",
+			layers:           map[string][]byte{PolicyMediaType: []byte(remotePolicyAccept)},
+		},
+	} {
+		dir := t.TempDir()
+		writeRemotePolicyImage(t, dir, c.manifestMIMEType, c.layers)
+		ref, err := directory.NewReference(dir)
+		require.NoError(t, err)
+		policy, err := NewPolicyFromImage(ctx, nil, ref, &RemotePolicyOptions{PublicKeyData: c.publicKey})
+		if c.success {
+			require.NoError(t, err, c.name)
+			assert.Equal(t, acceptPolicy, policy, c.name)
+		} else {
+			assert.Error(t, err, c.name)
+		}
+	}
+
+	// A blob which does not match its digest is rejected
+	dir := t.TempDir()
+	writeRemotePolicyImage(t, dir, imgspecv1.MediaTypeImageManifest, map[string][]byte{PolicyMediaType: []byte(remotePolicyAccept)})
+	err := os.WriteFile(filepath.Join(dir, digest.FromString(remotePolicyAccept).Encoded()), []byte(remotePolicyReject), 0o644)
+	require.NoError(t, err)
+	ref, err := directory.NewReference(dir)
+	require.NoError(t, err)
+	_, err = NewPolicyFromImage(ctx, nil, ref, nil)
+	assert.Error(t, err)
+}
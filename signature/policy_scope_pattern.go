@@ -0,0 +1,130 @@
+package signature
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// policyScopeRegexpPrefix marks a scope key in PolicyTransportScopes as a regular expression.
+const policyScopeRegexpPrefix = "^"
+
+// isPolicyScopeRegexp returns true if scope is a regular expression scope.
+func isPolicyScopeRegexp(scope string) bool {
+	return strings.HasPrefix(scope, policyScopeRegexpPrefix)
+}
+
+// isPolicyScopeGlob returns true if scope is a glob scope.
+// The "*.example.com" form, which matches all subdomains, is handled by transports as an ordinary namespace, not as a glob.
+func isPolicyScopeGlob(scope string) bool {
+	if isPolicyScopeRegexp(scope) || !strings.Contains(scope, "*") {
+		return false
+	}
+	return !strings.HasPrefix(scope, "*.") || strings.Contains(scope[len("*."):], "*")
+}
+
+// isPolicyScopePattern returns true if scope is a glob or regular expression scope.
+func isPolicyScopePattern(scope string) bool {
+	return isPolicyScopeRegexp(scope) || isPolicyScopeGlob(scope)
+}
+
+// compilePolicyScopePattern returns a regular expression matching values accepted by scope,
+// which must satisfy isPolicyScopePattern.
+func compilePolicyScopePattern(scope string) (*regexp.Regexp, error) {
+	if isPolicyScopeRegexp(scope) {
+		re, err := regexp.Compile(policyScopeRegexpPrefix + "(?:" + strings.TrimPrefix(scope, policyScopeRegexpPrefix) + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression scope %q: %w", scope, err)
+		}
+		return re, nil
+	}
+	parts := strings.Split(scope, "*")
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return regexp.Compile("^" + strings.Join(parts, "[^/]*") + "$")
+}
+
+// policyScopePattern is a compiled glob or regular expression scope.
+type policyScopePattern struct {
+	scope  string
+	re     *regexp.Regexp
+	isGlob bool
+}
+
+// compilePolicyScopePatterns returns the compiled glob and regular expression scopes of each transport in policy,
+// in the order in which they should be tried (see sortedPolicyScopePatterns),
+// or an error if any of them is invalid.
+// Policies parsed from JSON are always valid, but policies may also be constructed directly.
+func compilePolicyScopePatterns(policy *Policy) (map[string][]policyScopePattern, error) {
+	res := map[string][]policyScopePattern{}
+	for transportName, scopes := range policy.Transports {
+		patterns := []policyScopePattern{}
+		for _, scope := range sortedPolicyScopePatterns(scopes) {
+			re, err := compilePolicyScopePattern(scope)
+			if err != nil {
+				return nil, InvalidPolicyFormatError(fmt.Sprintf("transport %q: %v", transportName, err))
+			}
+			patterns = append(patterns, policyScopePattern{scope: scope, re: re, isGlob: isPolicyScopeGlob(scope)})
+		}
+		if len(patterns) != 0 {
+			res[transportName] = patterns
+		}
+	}
+	return res, nil
+}
+
+// policyScopeGlobSpecificity returns a measure of how specific a glob scope is, for ordering purposes;
+// larger values are more specific.
+func policyScopeGlobSpecificity(scope string) int {
+	return len(scope) - strings.Count(scope, "*")
+}
+
+// sortedPolicyScopePatterns returns the pattern scopes in scopes, in the order in which they should be tried:
+// glob scopes first, most specific (i.e. with the most non-wildcard characters) first,
+// then regular expression scopes; ties are broken by comparing the scopes as strings.
+func sortedPolicyScopePatterns(scopes PolicyTransportScopes) []string {
+	globs := []string{}
+	regexps := []string{}
+	for scope := range scopes {
+		switch {
+		case isPolicyScopeGlob(scope):
+			globs = append(globs, scope)
+		case isPolicyScopeRegexp(scope):
+			regexps = append(regexps, scope)
+		}
+	}
+	sort.Slice(globs, func(i, j int) bool {
+		si, sj := policyScopeGlobSpecificity(globs[i]), policyScopeGlobSpecificity(globs[j])
+		if si != sj {
+			return si > sj
+		}
+		return globs[i] < globs[j]
+	})
+	sort.Strings(regexps)
+	return append(globs, regexps...)
+}
+
+// matchPolicyScopePatterns returns the first of patterns, compiled from scopes, which matches an image
+// with the specified PolicyConfigurationIdentity and PolicyConfigurationNamespaces, if any, and its requirements in scopes.
+// Glob scopes match the identity or any of the namespaces; regular expression scopes must match the whole identity.
+func matchPolicyScopePatterns(patterns []policyScopePattern, scopes PolicyTransportScopes, identity string, namespaces []string) (string, PolicyRequirements, bool) {
+	for _, pattern := range patterns {
+		req, ok := scopes[pattern.scope]
+		if !ok {
+			continue // The scope was removed from the policy after NewPolicyContext; it can't be selected any more.
+		}
+		if pattern.re.MatchString(identity) {
+			return pattern.scope, req, true
+		}
+		if pattern.isGlob {
+			for _, ns := range namespaces {
+				if !strings.HasPrefix(ns, "*.") && pattern.re.MatchString(ns) {
+					return pattern.scope, req, true
+				}
+			}
+		}
+	}
+	return "", nil, false
+}
@@ -0,0 +1,117 @@
+package signature
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPolicyScopePattern(t *testing.T) {
+	for _, c := range []struct {
+		scope          string
+		glob, isRegexp bool
+	}{
+		{"", false, false},
+		{"example.com/ns/repo", false, false},
+		{"*.example.com", false, false},
+		{"*.example.com/prod/*", true, false},
+		{"example.com/*/repo", true, false},
+		{"example.com/prod-*", true, false},
+		{"^example\\.com/.*", false, true},
+		{"^example\\.com/*", false, true},
+	} {
+		assert.Equal(t, c.glob, isPolicyScopeGlob(c.scope), c.scope)
+		assert.Equal(t, c.isRegexp, isPolicyScopeRegexp(c.scope), c.scope)
+		assert.Equal(t, c.glob || c.isRegexp, isPolicyScopePattern(c.scope), c.scope)
+	}
+}
+
+func TestCompilePolicyScopePattern(t *testing.T) {
+	for _, c := range []struct {
+		scope      string
+		matches    []string
+		nonMatches []string
+	}{
+		{
+			scope:      "*.example.com/prod/*",
+			matches:    []string{"a.example.com/prod/repo:tag", "a.b.example.com/prod/repo"},
+			nonMatches: []string{"example.com/prod/repo", "a.example.com/dev/repo", "a.example.com/prod/ns/repo", "a.example.com.evil/prod/repo"},
+		},
+		{
+			scope:      "example.com/prod-*",
+			matches:    []string{"example.com/prod-1", "example.com/prod-"},
+			nonMatches: []string{"example.com/prod", "example.com/prod-1/repo", "example.com/prod-1xexample.com/prod-"},
+		},
+		{
+			scope:      `^example\.com/(prod|staging)/[a-z]+:v[0-9]+`,
+			matches:    []string{"example.com/prod/app:v1", "example.com/staging/web:v22"},
+			nonMatches: []string{"example.com/prod/app:latest", "example.com/prod/app:v1x", "xexample.com/prod/app:v1"},
+		},
+		{
+			scope:      `^a|b`, // The alternative must not escape the anchors
+			matches:    []string{"a", "b"},
+			nonMatches: []string{"ab", "xb", "ax"},
+		},
+	} {
+		re, err := compilePolicyScopePattern(c.scope)
+		require.NoError(t, err, c.scope)
+		for _, m := range c.matches {
+			assert.True(t, re.MatchString(m), "%s should match %s", c.scope, m)
+		}
+		for _, m := range c.nonMatches {
+			assert.False(t, re.MatchString(m), "%s should not match %s", c.scope, m)
+		}
+	}
+
+	_, err := compilePolicyScopePattern("^(")
+	assert.Error(t, err)
+}
+
+func TestSortedPolicyScopePatterns(t *testing.T) {
+	scopes := PolicyTransportScopes{}
+	for _, scope := range []string{
+		"", "example.com", "*.example.com",
+		"^z", "^a",
+		"*.example.com/*", "*.example.com/prod/*", "example.com/prod/*", "b/*", "a/*",
+	} {
+		scopes[scope] = PolicyRequirements{NewPRReject()}
+	}
+	assert.Equal(t, []string{
+		"*.example.com/prod/*", // Same specificity as the next one; ties are broken by string comparison
+		"example.com/prod/*",
+		"*.example.com/*",
+		"a/*",
+		"b/*",
+		"^a",
+		"^z",
+	}, sortedPolicyScopePatterns(scopes))
+}
+
+func TestMatchPolicyScopePatterns(t *testing.T) {
+	accept := PolicyRequirements{NewPRInsecureAcceptAnything()}
+	scopes := PolicyTransportScopes{
+		"example.com/*":       accept,
+		"^example\\.com/a/.*": accept,
+	}
+	patterns, err := compilePolicyScopePatterns(&Policy{Transports: map[string]PolicyTransportScopes{"docker": scopes}})
+	require.NoError(t, err)
+	require.Len(t, patterns["docker"], 2)
+	scope, req, ok := matchPolicyScopePatterns(patterns["docker"], scopes, "example.com/a/b:tag", []string{"example.com/a/b", "example.com/a", "example.com"})
+	require.True(t, ok)
+	assert.Equal(t, "example.com/*", scope) // Glob scopes are tried first
+	assert.Equal(t, accept, req)
+
+	_, _, ok = matchPolicyScopePatterns(patterns["docker"], scopes, "other.com/a:tag", []string{"other.com/a", "other.com"})
+	assert.False(t, ok)
+
+	// A pattern scope removed from the policy is not used
+	delete(scopes, "example.com/*")
+	scope, _, ok = matchPolicyScopePatterns(patterns["docker"], scopes, "example.com/a/b:tag", []string{"example.com/a/b", "example.com/a", "example.com"})
+	require.True(t, ok)
+	assert.Equal(t, "^example\\.com/a/.*", scope)
+
+	// Invalid pattern scopes are rejected
+	_, err = compilePolicyScopePatterns(&Policy{Transports: map[string]PolicyTransportScopes{"docker": {"^(": accept}}})
+	assert.Error(t, err)
+}
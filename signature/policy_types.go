@@ -6,6 +6,13 @@
 
 package signature
 
+import (
+	"context"
+	"crypto/x509"
+
+	digest "github.com/opencontainers/go-digest"
+)
+
 // NOTE: Keep this in sync with docs/containers-policy.json.5.md!
 
 // Policy defines requirements for considering a signature, or an image, valid.
@@ -47,6 +54,10 @@ const (
 	prTypeSignedBy               prTypeIdentifier = "signedBy"
 	prTypeSignedBaseLayer        prTypeIdentifier = "signedBaseLayer"
 	prTypeSigstoreSigned         prTypeIdentifier = "sigstoreSigned"
+	prTypeDigestList             prTypeIdentifier = "digestList"
+	prTypeMaxImageAge            prTypeIdentifier = "maxImageAge"
+	prTypeSLSAProvenance         prTypeIdentifier = "slsaProvenance"
+	prTypeSignedByThreshold      prTypeIdentifier = "signedByThreshold"
 )
 
 // prInsecureAcceptAnything is a PolicyRequirement with type = prTypeInsecureAcceptAnything:
@@ -82,8 +93,33 @@ type prSignedBy struct {
 	// SignedIdentity specifies what image identity the signature must be claiming about the image.
 	// Defaults to "matchRepoDigestOrExact" if not specified.
 	SignedIdentity PolicyReferenceMatch `json:"signedIdentity"`
+
+	// MaxSignatureAge, if not empty, is the maximum age of accepted signatures, in the time.ParseDuration format (e.g. "720h").
+	// Signatures without a signing timestamp are rejected if this is set.
+	MaxSignatureAge string `json:"maxSignatureAge,omitempty"`
+
+	// RevokedKeyFingerprints, if not empty, lists fingerprints of revoked keys; signatures by these keys are rejected
+	// even if the keys are included in KeyPath/KeyPaths/KeyData.
+	RevokedKeyFingerprints []string `json:"revokedKeyFingerprints,omitempty"`
+	// RevokedKeyFingerprintsPath, if not empty, is a pathname to a local file listing fingerprints of revoked keys, one per line,
+	// in addition to RevokedKeyFingerprints. Empty lines and lines starting with '#' are ignored.
+	RevokedKeyFingerprintsPath string `json:"revokedKeyFingerprintsPath,omitempty"`
+	// RevocationFailureMode specifies what happens when RevokedKeyFingerprintsPath can’t be read.
+	// Defaults to "hardFail" if not specified.
+	RevocationFailureMode revocationFailureMode `json:"revocationFailureMode,omitempty"`
 }
 
+// revocationFailureMode are the allowed values for prSignedBy.RevocationFailureMode and prSigstoreSignedFulcio.RevocationFailureMode
+type revocationFailureMode string
+
+const (
+	// RevocationFailureModeHardFail rejects signatures if the revocation status of the signing key or certificate can’t be determined.
+	RevocationFailureModeHardFail revocationFailureMode = "hardFail"
+	// RevocationFailureModeSoftFail accepts signatures, logging a warning, if the revocation status of the signing key or certificate
+	// can’t be determined. Signatures by keys or certificates known to be revoked are always rejected.
+	RevocationFailureModeSoftFail revocationFailureMode = "softFail"
+)
+
 // sbKeyType are the allowed values for prSignedBy.KeyType
 type sbKeyType string
 
@@ -118,17 +154,27 @@ type prSigstoreSigned struct {
 	// FIXME: Multiple public keys?
 
 	// Fulcio specifies which Fulcio-generated certificates are accepted. Exactly one of KeyPath, KeyData, Fulcio must be specified.
-	// If Fulcio is specified, one of RekorPublicKeyPath or RekorPublicKeyData must be specified as well.
+	// If Fulcio is specified, one of RekorPublicKeyPath, RekorPublicKeyData or TUF must be specified as well.
 	Fulcio PRSigstoreSignedFulcio `json:"fulcio,omitempty"`
 
+	// TUF specifies a TUF repository (e.g. the sigstore public-good instance) which provides the Fulcio CA certificates
+	// and Rekor public keys, so that they can be rotated without changing the policy.
+	// If TUF is specified, RekorPublicKeyPath, RekorPublicKeyData, and the CA fields of Fulcio must not be specified.
+	TUF PRSigstoreSignedTUF `json:"tuf,omitempty"`
+
 	// RekorPublicKeyPath is a pathname to local file containing a public key of a Rekor server which must record acceptable signatures.
-	// If Fulcio is used, one of RekorPublicKeyPath or RekorPublicKeyData must be specified as well; otherwise it is optional
+	// If Fulcio is used, one of RekorPublicKeyPath, RekorPublicKeyData or TUF must be specified as well; otherwise it is optional
 	// (and Rekor inclusion is not required if a Rekor public key is not specified).
 	RekorPublicKeyPath string `json:"rekorPublicKeyPath,omitempty"`
 	// RekorPublicKeyPath contain a base64-encoded public key of a Rekor server which must record acceptable signatures.
-	// If Fulcio is used, one of RekorPublicKeyPath or RekorPublicKeyData must be specified as well; otherwise it is optional
+	// If Fulcio is used, one of RekorPublicKeyPath, RekorPublicKeyData or TUF must be specified as well; otherwise it is optional
 	// (and Rekor inclusion is not required if a Rekor public key is not specified).
 	RekorPublicKeyData []byte `json:"rekorPublicKeyData,omitempty"`
+	// RequireRekorInclusionProof requires signatures to carry a Rekor inclusion proof (in addition to the SET),
+	// which is verified offline against a checkpoint signed by the Rekor public key.
+	// If false, an inclusion proof is verified only if it is present.
+	// One of RekorPublicKeyPath, RekorPublicKeyData or TUF must be specified if this is true.
+	RequireRekorInclusionProof bool `json:"requireRekorInclusionProof,omitempty"`
 
 	// SignedIdentity specifies what image identity the signature must be claiming about the image.
 	// Defaults to "matchRepoDigestOrExact" if not specified.
@@ -139,21 +185,149 @@ type prSigstoreSigned struct {
 // PRSigstoreSignedFulcio contains Fulcio configuration options for a "sigstoreSigned" PolicyRequirement.
 // This is a public type with a single private implementation.
 type PRSigstoreSignedFulcio interface {
-	// toFulcioTrustRoot creates a fulcioTrustRoot from the input data.
+	// toFulcioTrustRoot creates a fulcioTrustRoot from the input data, using tufCACertificates if the CA certificates
+	// are not specified explicitly.
 	// (This also prevents external implementations of this interface, ensuring that prSigstoreSignedFulcio is the only one.)
-	prepareTrustRoot() (*fulcioTrustRoot, error)
+	prepareTrustRoot(tufCACertificates *x509.CertPool) (*fulcioTrustRoot, error)
+	// specifiesCA returns true if the CA certificates are specified explicitly.
+	specifiesCA() bool
 }
 
 // prSigstoreSignedFulcio collects Fulcio configuration options for prSigstoreSigned
 type prSigstoreSignedFulcio struct {
-	// CAPath a path to a file containing accepted CA root certificates, in PEM format. Exactly one of CAPath and CAData must be specified.
+	// CAPath a path to a file containing accepted CA root certificates, in PEM format.
+	// Exactly one of CAPath and CAData must be specified, unless the CA certificates are obtained via prSigstoreSigned.TUF.
 	CAPath string `json:"caPath,omitempty"`
-	// CAData contains accepted CA root certificates in PEM format, all of that base64-encoded. Exactly one of CAPath and CAData must be specified.
+	// CAData contains accepted CA root certificates in PEM format, all of that base64-encoded.
+	// Exactly one of CAPath and CAData must be specified, unless the CA certificates are obtained via prSigstoreSigned.TUF.
 	CAData []byte `json:"caData,omitempty"`
 	// OIDCIssuer specifies the expected OIDC issuer, recorded by Fulcio into the generated certificates.
+	// Exactly one of OIDCIssuer and OIDCIssuerRegexp must be specified.
 	OIDCIssuer string `json:"oidcIssuer,omitempty"`
+	// OIDCIssuerRegexp is a regular expression which must match the whole OIDC issuer recorded by Fulcio into the generated certificates.
+	// Exactly one of OIDCIssuer and OIDCIssuerRegexp must be specified.
+	OIDCIssuerRegexp string `json:"oidcIssuerRegexp,omitempty"`
 	// SubjectEmail specifies the expected email address of the authenticated OIDC identity, recorded by Fulcio into the generated certificates.
+	// Exactly one of SubjectEmail, SubjectEmailRegexp, SubjectURI and SubjectURIRegexp must be specified.
 	SubjectEmail string `json:"subjectEmail,omitempty"`
+	// SubjectEmailRegexp is a regular expression which must match the whole email address of the authenticated OIDC identity.
+	// Exactly one of SubjectEmail, SubjectEmailRegexp, SubjectURI and SubjectURIRegexp must be specified.
+	SubjectEmailRegexp string `json:"subjectEmailRegexp,omitempty"`
+	// SubjectURI specifies the expected URI of the authenticated OIDC identity (e.g. a CI workflow), recorded by Fulcio into the generated certificates.
+	// Exactly one of SubjectEmail, SubjectEmailRegexp, SubjectURI and SubjectURIRegexp must be specified.
+	SubjectURI string `json:"subjectURI,omitempty"`
+	// SubjectURIRegexp is a regular expression which must match the whole URI of the authenticated OIDC identity.
+	// Exactly one of SubjectEmail, SubjectEmailRegexp, SubjectURI and SubjectURIRegexp must be specified.
+	SubjectURIRegexp string `json:"subjectURIRegexp,omitempty"`
+
+	// CRLPaths, if not empty, is a set of paths to files containing certificate revocation lists (in PEM or DER format)
+	// issued by the CA or by intermediate certificates; certificates listed in a CRL are rejected.
+	CRLPaths []string `json:"crlPaths,omitempty"`
+	// OCSP, if true, requires checking the revocation status of certificates with the OCSP responders listed in the certificates.
+	OCSP bool `json:"ocsp,omitempty"`
+	// RevocationFailureMode specifies what happens when the revocation status of a certificate can’t be determined
+	// using CRLPaths or OCSP. Defaults to "hardFail" if not specified.
+	RevocationFailureMode revocationFailureMode `json:"revocationFailureMode,omitempty"`
+}
+
+// PRSigstoreSignedTUF contains TUF configuration options for a "sigstoreSigned" PolicyRequirement.
+// This is a public type with a single private implementation.
+type PRSigstoreSignedTUF interface {
+	// prepareTrustRoot verifies the TUF repository and returns the sigstore trust root it provides.
+	// (This also prevents external implementations of this interface, ensuring that prSigstoreSignedTUF is the only one.)
+	prepareTrustRoot(ctx context.Context) (*tufTrustRoot, error)
+}
+
+// prSigstoreSignedTUF collects TUF configuration options for prSigstoreSigned
+type prSigstoreSignedTUF struct {
+	// RootPath is a path to a file containing a trusted (pinned) TUF root metadata.
+	// Newer root metadata versions are accepted if they are signed according to the TUF specification.
+	// Exactly one of RootPath and RootData must be specified.
+	RootPath string `json:"rootPath,omitempty"`
+	// RootData contains a trusted (pinned) TUF root metadata, base64-encoded. Exactly one of RootPath and RootData must be specified.
+	RootData []byte `json:"rootData,omitempty"`
+	// MetadataDir is a path to a local directory containing a (possibly offline) snapshot of the TUF repository,
+	// using the repository layout (e.g. "timestamp.json", "2.root.json", "targets/…").
+	// Exactly one of MetadataDir and MirrorURL must be specified.
+	MetadataDir string `json:"metadataDir,omitempty"`
+	// MirrorURL is a http:// or https:// URL of the TUF repository.
+	// Exactly one of MetadataDir and MirrorURL must be specified.
+	MirrorURL string `json:"mirrorURL,omitempty"`
+}
+
+// prDigestList is a PolicyRequirement with type = prTypeDigestList: the image is accepted or rejected based only on
+// its manifest or config digest, without considering any signatures.
+type prDigestList struct {
+	prCommon
+
+	// Mode specifies whether the listed digests are the only ones allowed, or the ones that are rejected.
+	// Acceptable values are “allow” | “deny”
+	Mode dlMode `json:"mode"`
+
+	// Digests is a list of manifest or config digests. At least one of Digests, DigestsPath and DigestsURL must be specified.
+	Digests []digest.Digest `json:"digests,omitempty"`
+	// DigestsPath is a pathname to a local file containing manifest or config digests, one per line.
+	// Empty lines and lines starting with # are ignored.
+	// At least one of Digests, DigestsPath and DigestsURL must be specified.
+	DigestsPath string `json:"digestsPath,omitempty"`
+	// DigestsURL is a http:// or https:// URL of a file in the same format as DigestsPath.
+	// It is fetched every time the requirement is evaluated, so that changes to the list take effect immediately.
+	// At least one of Digests, DigestsPath and DigestsURL must be specified.
+	DigestsURL string `json:"digestsURL,omitempty"`
+}
+
+// dlMode are the allowed values for prDigestList.Mode
+type dlMode string
+
+const (
+	// DLModeAllow accepts only images with one of the listed digests.
+	DLModeAllow dlMode = "allow"
+	// DLModeDeny rejects images with any of the listed digests.
+	DLModeDeny dlMode = "deny"
+)
+
+// prMaxImageAge is a PolicyRequirement with type = prTypeMaxImageAge: the image must have been created recently enough,
+// according to its own metadata.
+type prMaxImageAge struct {
+	prCommon
+
+	// MaxAge is the maximum age of accepted images, in the time.ParseDuration format (e.g. "2160h").
+	MaxAge string `json:"maxAge"`
+
+	// CreatedAnnotation, if not empty, is the name of a manifest annotation or a config label containing the creation time
+	// of the image in RFC 3339 format (e.g. "org.opencontainers.image.created"). If the image has such an annotation or label,
+	// it is used instead of the "created" field of the image config.
+	CreatedAnnotation string `json:"createdAnnotation,omitempty"`
+}
+
+// prSLSAProvenance is a PolicyRequirement with type = prTypeSLSAProvenance: the image must have a signed in-toto attestation
+// containing SLSA provenance which matches the specified constraints.
+type prSLSAProvenance struct {
+	prCommon
+
+	// KeyPath is a pathname to a local file containing the trusted key. Exactly one of KeyPath and KeyData must be specified.
+	KeyPath string `json:"keyPath,omitempty"`
+	// KeyData contains the trusted key, base64-encoded. Exactly one of KeyPath and KeyData must be specified.
+	KeyData []byte `json:"keyData,omitempty"`
+
+	// BuilderID, if not empty, is the required ID of the builder which built the image.
+	BuilderID string `json:"builderID,omitempty"`
+	// SourceRepository, if not empty, is the required URI of the source repository the image was built from
+	// (e.g. "git+https://github.com/containers/image").
+	SourceRepository string `json:"sourceRepository,omitempty"`
+	// SourceBranch, if not empty, is the required branch of the source repository the image was built from (e.g. "main").
+	SourceBranch string `json:"sourceBranch,omitempty"`
+}
+
+// prSignedByThreshold is a PolicyRequirement with type = prTypeSignedByThreshold: the image must be signed
+// by at least Threshold of Signers.
+type prSignedByThreshold struct {
+	prCommon
+
+	// Threshold is the minimum number of Signers which must accept the image.
+	Threshold int `json:"threshold"`
+	// Signers contains prSignedBy or prSigstoreSigned requirements, each typically representing a single signing identity.
+	Signers PolicyRequirements `json:"signers"`
 }
 
 // PolicyReferenceMatch specifies a set of image identities accepted in PolicyRequirement.
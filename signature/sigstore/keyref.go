@@ -0,0 +1,57 @@
+package sigstore
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/containers/image/v5/signature/sigstore/internal"
+	"github.com/sigstore/sigstore/pkg/signature/kms"
+)
+
+// pkcs11URIScheme is the prefix of RFC 7512 PKCS#11 URIs.
+const pkcs11URIScheme = "pkcs11:"
+
+// WithKeyReference uses a private key referenced by keyRef to create signatures, so that the private key
+// never needs to be available as a local file.
+//
+// keyRef can be:
+//   - An RFC 7512 PKCS#11 URI (pkcs11:…), referring to a key in a hardware token or a HSM.
+//     The URI must identify the PKCS#11 module (using module-path or module-name), the key (using id or object),
+//     and, if necessary, the PIN (using pin-value or pin-source). Only ECDSA and RSA keys are supported.
+//     Using PKCS#11 requires cgo.
+//   - A key reference for a sigstore KMS provider, e.g. awskms://…, gcpkms://…, azurekms://… or hashivault://….
+//     The caller must register the relevant providers by importing the corresponding packages
+//     (e.g. github.com/sigstore/sigstore/pkg/signature/kms/aws); this package does not depend on any of them.
+func WithKeyReference(ctx context.Context, keyRef string) Option {
+	return func(s *internal.SigstoreSigner) error {
+		if s.PrivateKey != nil {
+			return fmt.Errorf("multiple private key sources specified when preparing to create sigstore signatures")
+		}
+
+		if strings.HasPrefix(keyRef, pkcs11URIScheme) {
+			privateKey, err := newPKCS11Signer(keyRef)
+			if err != nil {
+				return fmt.Errorf("initializing PKCS#11 private key: %w", err)
+			}
+			if err := setPrivateKey(s, privateKey); err != nil {
+				privateKey.Close()
+				return err
+			}
+			s.PrivateKeyCloser = privateKey.Close
+			return nil
+		}
+
+		privateKey, err := kms.Get(ctx, keyRef, crypto.SHA256)
+		if err != nil {
+			var notFound *kms.ProviderNotFoundError
+			if errors.As(err, &notFound) {
+				return fmt.Errorf("unsupported private key reference %q; KMS providers must be registered by the caller: %w", keyRef, err)
+			}
+			return fmt.Errorf("initializing KMS private key %q: %w", keyRef, err)
+		}
+		return setPrivateKey(s, privateKey)
+	}
+}
@@ -0,0 +1,62 @@
+package sigstore
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/signature"
+	internalSigner "github.com/containers/image/v5/internal/signer"
+	"github.com/containers/image/v5/signature/internal"
+	"github.com/opencontainers/go-digest"
+	"github.com/sigstore/sigstore/pkg/signature/kms/fake"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithKeyReference(t *testing.T) {
+	testManifest := []byte("{}")
+	testDockerReference, err := reference.ParseNormalizedNamed("example.com/foo:notlatest")
+	require.NoError(t, err)
+
+	// A KMS key, using the fake provider
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ctx := context.WithValue(context.Background(), fake.KmsCtxKey{}, privateKey)
+	signer, err := NewSigner(WithKeyReference(ctx, fake.ReferenceScheme+"key"))
+	require.NoError(t, err)
+	defer signer.Close()
+	sig0, err := internalSigner.SignImageManifest(ctx, signer, testManifest, testDockerReference)
+	require.NoError(t, err)
+	sig, ok := sig0.(signature.Sigstore)
+	require.True(t, ok)
+	_, err = internal.VerifySigstorePayload(privateKey.Public(), sig.UntrustedPayload(),
+		sig.UntrustedAnnotations()[signature.SigstoreSignatureAnnotationKey],
+		internal.SigstorePayloadAcceptanceRules{
+			ValidateSignedDockerReference:      func(ref string) error { return nil },
+			ValidateSignedDockerManifestDigest: func(digest digest.Digest) error { return nil },
+		})
+	assert.NoError(t, err)
+
+	// An unknown KMS provider
+	_, err = NewSigner(WithKeyReference(ctx, "unknownkms://key"))
+	assert.ErrorContains(t, err, "KMS providers must be registered")
+
+	// Invalid PKCS#11 URIs
+	for _, uri := range []string{
+		"pkcs11:object=key;id=%zz",                // Invalid escaping
+		"pkcs11:object=key",                       // No module
+		"pkcs11:token=t?module-path=/dev/null",    // No key
+		"pkcs11:object=key?module-path=/dev/null", // Not a PKCS#11 module
+	} {
+		_, err = NewSigner(WithKeyReference(ctx, uri))
+		assert.Error(t, err, uri)
+	}
+
+	// Multiple private key sources are rejected
+	_, err = NewSigner(WithKeyReference(ctx, fake.ReferenceScheme+"key"), WithKeyReference(ctx, fake.ReferenceScheme+"key"))
+	assert.Error(t, err)
+}
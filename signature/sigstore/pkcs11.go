@@ -0,0 +1,321 @@
+//go:build cgo && !containers_image_pkcs11_stub
+// +build cgo,!containers_image_pkcs11_stub
+
+package sigstore
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"sync"
+
+	"github.com/miekg/pkcs11"
+	sigstoreSignature "github.com/sigstore/sigstore/pkg/signature"
+	pkcs11uri "github.com/stefanberger/go-pkcs11uri"
+)
+
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	// sha256DigestInfoPrefix is the DER-encoded DigestInfo prefix for SHA-256 digests, as used by RSASSA-PKCS1-v1_5 (RFC 8017).
+	sha256DigestInfoPrefix = []byte{0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20}
+)
+
+// pkcs11Signer is a sigstoreSignature.Signer using a private key in a PKCS#11 token.
+type pkcs11Signer struct {
+	mutex      sync.Mutex // Protects all fields below; PKCS#11 sessions must not be used concurrently.
+	ctx        *pkcs11.Ctx
+	session    pkcs11.SessionHandle
+	loggedIn   bool
+	privateKey pkcs11.ObjectHandle
+	keyType    uint
+	publicKey  crypto.PublicKey
+}
+
+// newPKCS11Signer returns a signer for the private key identified by the PKCS#11 URI keyURI.
+// The caller must call Close() on the returned signer.
+func newPKCS11Signer(keyURI string) (res *pkcs11Signer, retErr error) {
+	uri := pkcs11uri.New()
+	// The key reference is provided by the caller, who is trusted to choose the module; this matches the behavior
+	// of other PKCS#11 consumers like cosign.
+	uri.SetAllowAnyModule(true)
+	if err := uri.Parse(keyURI); err != nil {
+		return nil, fmt.Errorf("parsing PKCS#11 URI: %w", err)
+	}
+	module, err := uri.GetModule()
+	if err != nil {
+		return nil, fmt.Errorf("PKCS#11 URI does not identify a usable module: %w", err)
+	}
+	keyID, hasKeyID := uri.GetPathAttribute("id", false)
+	keyLabel, hasKeyLabel := uri.GetPathAttribute("object", false)
+	if !hasKeyID && !hasKeyLabel {
+		return nil, errors.New(`PKCS#11 URI contains neither an "id" nor an "object" attribute`)
+	}
+	pin := ""
+	if uri.HasPIN() {
+		pin, err = uri.GetPIN()
+		if err != nil {
+			return nil, fmt.Errorf("reading PKCS#11 PIN: %w", err)
+		}
+	}
+
+	ctx := pkcs11.New(module)
+	if ctx == nil {
+		return nil, fmt.Errorf("loading PKCS#11 module %q failed", module)
+	}
+	s := &pkcs11Signer{ctx: ctx}
+	if err := ctx.Initialize(); err != nil {
+		var p11Err pkcs11.Error
+		if !errors.As(err, &p11Err) || p11Err != pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED {
+			ctx.Destroy()
+			return nil, fmt.Errorf("initializing PKCS#11 module %q: %w", module, err)
+		}
+	}
+	defer func() {
+		if retErr != nil {
+			s.Close()
+		}
+	}()
+
+	slot, err := s.findSlot(uri)
+	if err != nil {
+		return nil, err
+	}
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	if err != nil {
+		return nil, fmt.Errorf("opening PKCS#11 session: %w", err)
+	}
+	s.session = session
+	if pin != "" {
+		if err := ctx.Login(session, pkcs11.CKU_USER, pin); err != nil {
+			return nil, fmt.Errorf("logging in to PKCS#11 token: %w", err)
+		}
+		s.loggedIn = true
+	}
+
+	s.privateKey, err = s.findObject(pkcs11.CKO_PRIVATE_KEY, keyID, keyLabel)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := s.findObject(pkcs11.CKO_PUBLIC_KEY, keyID, keyLabel)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.loadPublicKey(publicKey); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// findSlot returns the slot identified by uri: by slot-id, or by a token label, or the only slot with a token.
+func (s *pkcs11Signer) findSlot(uri *pkcs11uri.Pkcs11URI) (uint, error) {
+	if slotID, ok := uri.GetPathAttribute("slot-id", false); ok {
+		slot, err := strconv.ParseUint(slotID, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid PKCS#11 slot-id %q: %w", slotID, err)
+		}
+		return uint(slot), nil
+	}
+	slots, err := s.ctx.GetSlotList(true)
+	if err != nil {
+		return 0, fmt.Errorf("listing PKCS#11 slots: %w", err)
+	}
+	tokenLabel, hasTokenLabel := uri.GetPathAttribute("token", false)
+	if !hasTokenLabel {
+		if len(slots) != 1 {
+			return 0, fmt.Errorf(`PKCS#11 URI does not contain a "token" or "slot-id" attribute, and there are %d tokens available`, len(slots))
+		}
+		return slots[0], nil
+	}
+	for _, slot := range slots {
+		ti, err := s.ctx.GetTokenInfo(slot)
+		if err == nil && ti.Label == tokenLabel {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("PKCS#11 token %q not found", tokenLabel)
+}
+
+// findObject returns the only object of class with the specified keyID and/or label.
+func (s *pkcs11Signer) findObject(class uint, keyID, label string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_CLASS, class)}
+	if keyID != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_ID, keyID))
+	}
+	if label != "" {
+		template = append(template, pkcs11.NewAttribute(pkcs11.CKA_LABEL, label))
+	}
+	if err := s.ctx.FindObjectsInit(s.session, template); err != nil {
+		return 0, fmt.Errorf("searching for PKCS#11 objects: %w", err)
+	}
+	objects, _, err := s.ctx.FindObjects(s.session, 2)
+	if finalErr := s.ctx.FindObjectsFinal(s.session); err == nil && finalErr != nil {
+		err = finalErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("searching for PKCS#11 objects: %w", err)
+	}
+	kind := "public"
+	if class == pkcs11.CKO_PRIVATE_KEY {
+		kind = "private"
+	}
+	switch len(objects) {
+	case 0:
+		return 0, fmt.Errorf("PKCS#11 %s key not found", kind)
+	case 1:
+		return objects[0], nil
+	default:
+		return 0, fmt.Errorf("PKCS#11 URI matches more than one %s key", kind)
+	}
+}
+
+// loadPublicKey initializes s.keyType and s.publicKey from the PKCS#11 public key object.
+func (s *pkcs11Signer) loadPublicKey(object pkcs11.ObjectHandle) error {
+	attrs, err := s.ctx.GetAttributeValue(s.session, object, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, nil)})
+	if err != nil {
+		return fmt.Errorf("reading PKCS#11 key type: %w", err)
+	}
+	// CK_KEY_TYPE values are native-endian CK_ULONG values; compare them using the encoding used by pkcs11.NewAttribute.
+	var keyType uint
+	switch {
+	case bytes.Equal(attrs[0].Value, pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_EC).Value):
+		keyType = pkcs11.CKK_EC
+		attrs, err := s.ctx.GetAttributeValue(s.session, object, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil),
+		})
+		if err != nil {
+			return fmt.Errorf("reading PKCS#11 ECDSA public key: %w", err)
+		}
+		publicKey, err := pkcs11ECDSAPublicKey(attrs[0].Value, attrs[1].Value)
+		if err != nil {
+			return err
+		}
+		s.publicKey = publicKey
+	case bytes.Equal(attrs[0].Value, pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA).Value):
+		keyType = pkcs11.CKK_RSA
+		attrs, err := s.ctx.GetAttributeValue(s.session, object, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+			pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+		})
+		if err != nil {
+			return fmt.Errorf("reading PKCS#11 RSA public key: %w", err)
+		}
+		exponent := new(big.Int).SetBytes(attrs[1].Value)
+		if !exponent.IsInt64() || exponent.Int64() > int64(^uint32(0)>>1) {
+			return errors.New("PKCS#11 RSA public exponent is too large")
+		}
+		s.publicKey = &rsa.PublicKey{N: new(big.Int).SetBytes(attrs[0].Value), E: int(exponent.Int64())}
+	default:
+		return fmt.Errorf("unsupported PKCS#11 key type %x", attrs[0].Value)
+	}
+	s.keyType = keyType
+	return nil
+}
+
+// pkcs11ECDSAPublicKey returns an ECDSA public key from the CKA_EC_PARAMS and CKA_EC_POINT attribute values.
+func pkcs11ECDSAPublicKey(ecParams, ecPoint []byte) (crypto.PublicKey, error) {
+	// CKA_EC_POINT is a DER-encoded OCTET STRING containing the point; some tokens return the raw point instead.
+	var point []byte
+	if rest, err := asn1.Unmarshal(ecPoint, &point); err != nil || len(rest) != 0 {
+		point = ecPoint
+	}
+	// Let crypto/x509 validate the curve and the point, by building a SubjectPublicKeyInfo.
+	spki, err := asn1.Marshal(struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPublicKeyECDSA,
+			Parameters: asn1.RawValue{FullBytes: ecParams},
+		},
+		PublicKey: asn1.BitString{Bytes: point, BitLength: 8 * len(point)},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("encoding PKCS#11 ECDSA public key: %w", err)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(spki)
+	if err != nil {
+		return nil, fmt.Errorf("parsing PKCS#11 ECDSA public key: %w", err)
+	}
+	return publicKey, nil
+}
+
+// PublicKey returns the public key corresponding to the private key.
+func (s *pkcs11Signer) PublicKey(opts ...sigstoreSignature.PublicKeyOption) (crypto.PublicKey, error) {
+	return s.publicKey, nil
+}
+
+// SignMessage signs the SHA-256 digest of message.
+func (s *pkcs11Signer) SignMessage(message io.Reader, opts ...sigstoreSignature.SignOption) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, message); err != nil {
+		return nil, err
+	}
+	digest := h.Sum(nil)
+
+	var mechanism *pkcs11.Mechanism
+	var input []byte
+	switch s.keyType {
+	case pkcs11.CKK_EC:
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_ECDSA, nil)
+		input = digest
+	case pkcs11.CKK_RSA:
+		mechanism = pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)
+		input = append(append([]byte{}, sha256DigestInfoPrefix...), digest...)
+	default:
+		return nil, fmt.Errorf("internal error: unexpected PKCS#11 key type %d", s.keyType)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ctx == nil {
+		return nil, errors.New("PKCS#11 signer used after Close()")
+	}
+	if err := s.ctx.SignInit(s.session, []*pkcs11.Mechanism{mechanism}, s.privateKey); err != nil {
+		return nil, fmt.Errorf("initializing PKCS#11 signing: %w", err)
+	}
+	sig, err := s.ctx.Sign(s.session, input)
+	if err != nil {
+		return nil, fmt.Errorf("signing using PKCS#11: %w", err)
+	}
+	if s.keyType == pkcs11.CKK_EC {
+		// CKM_ECDSA returns r||s; sigstore (and x509) expect an ASN.1 ECDSA-Sig-Value.
+		if len(sig) == 0 || len(sig)%2 != 0 {
+			return nil, fmt.Errorf("unexpected PKCS#11 ECDSA signature length %d", len(sig))
+		}
+		half := len(sig) / 2
+		return asn1.Marshal(struct{ R, S *big.Int }{
+			R: new(big.Int).SetBytes(sig[:half]),
+			S: new(big.Int).SetBytes(sig[half:]),
+		})
+	}
+	return sig, nil
+}
+
+// Close releases the PKCS#11 session and module.
+func (s *pkcs11Signer) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ctx == nil {
+		return nil
+	}
+	if s.session != 0 {
+		if s.loggedIn {
+			_ = s.ctx.Logout(s.session)
+		}
+		_ = s.ctx.CloseSession(s.session)
+	}
+	err := s.ctx.Finalize()
+	s.ctx.Destroy()
+	s.ctx = nil
+	return err
+}
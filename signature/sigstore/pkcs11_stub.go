@@ -0,0 +1,36 @@
+//go:build !cgo || containers_image_pkcs11_stub
+// +build !cgo containers_image_pkcs11_stub
+
+package sigstore
+
+import (
+	"crypto"
+	"errors"
+	"io"
+
+	sigstoreSignature "github.com/sigstore/sigstore/pkg/signature"
+)
+
+// pkcs11Signer is a sigstoreSignature.Signer using a private key in a PKCS#11 token.
+type pkcs11Signer struct{}
+
+// newPKCS11Signer returns a signer for the private key identified by the PKCS#11 URI keyURI.
+// The caller must call Close() on the returned signer.
+func newPKCS11Signer(keyURI string) (*pkcs11Signer, error) {
+	return nil, errors.New("PKCS#11 support disabled at compile time")
+}
+
+// PublicKey returns the public key corresponding to the private key.
+func (s *pkcs11Signer) PublicKey(opts ...sigstoreSignature.PublicKeyOption) (crypto.PublicKey, error) {
+	return nil, errors.New("PKCS#11 support disabled at compile time")
+}
+
+// SignMessage signs the SHA-256 digest of message.
+func (s *pkcs11Signer) SignMessage(message io.Reader, opts ...sigstoreSignature.SignOption) ([]byte, error) {
+	return nil, errors.New("PKCS#11 support disabled at compile time")
+}
+
+// Close releases the PKCS#11 session and module.
+func (s *pkcs11Signer) Close() error {
+	return nil
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/containers/image/v5/signature/signer"
 	"github.com/containers/image/v5/signature/sigstore/internal"
 	"github.com/sigstore/sigstore/pkg/cryptoutils"
+	sigstoreSignature "github.com/sigstore/sigstore/pkg/signature"
 )
 
 type Option = internal.Option
@@ -31,28 +32,50 @@ func WithPrivateKeyFile(file string, passphrase []byte) Option {
 		if err != nil {
 			return fmt.Errorf("initializing private key: %w", err)
 		}
-		publicKey, err := signerVerifier.PublicKey()
-		if err != nil {
-			return fmt.Errorf("getting public key from private key: %w", err)
+		return setPrivateKey(s, signerVerifier)
+	}
+}
+
+// WithSigner uses privateKey to create signatures.
+// This allows using private keys which are not available as local files, e.g. keys in a KMS
+// (see github.com/sigstore/sigstore/pkg/signature/kms) or in a hardware token.
+func WithSigner(privateKey sigstoreSignature.Signer) Option {
+	return func(s *internal.SigstoreSigner) error {
+		if s.PrivateKey != nil {
+			return fmt.Errorf("multiple private key sources specified when preparing to create sigstore signatures")
 		}
-		publicKeyPEM, err := cryptoutils.MarshalPublicKeyToPEM(publicKey)
-		if err != nil {
-			return fmt.Errorf("converting public key to PEM: %w", err)
+		if privateKey == nil {
+			return errors.New("no private key provided")
 		}
-		s.PrivateKey = signerVerifier
-		s.SigningKeyOrCert = publicKeyPEM
-		return nil
+		return setPrivateKey(s, privateKey)
+	}
+}
+
+// setPrivateKey sets up s to sign using privateKey.
+func setPrivateKey(s *internal.SigstoreSigner, privateKey sigstoreSignature.Signer) error {
+	publicKey, err := privateKey.PublicKey()
+	if err != nil {
+		return fmt.Errorf("getting public key from private key: %w", err)
+	}
+	publicKeyPEM, err := cryptoutils.MarshalPublicKeyToPEM(publicKey)
+	if err != nil {
+		return fmt.Errorf("converting public key to PEM: %w", err)
 	}
+	s.PrivateKey = privateKey
+	s.SigningKeyOrCert = publicKeyPEM
+	return nil
 }
 
 func NewSigner(opts ...Option) (*signer.Signer, error) {
 	s := internal.SigstoreSigner{}
 	for _, o := range opts {
 		if err := o(&s); err != nil {
+			s.Close()
 			return nil, err
 		}
 	}
 	if s.PrivateKey == nil {
+		s.Close()
 		return nil, errors.New("no private key source provided (neither a private key nor Fulcio) when preparing to create sigstore signatures")
 	}
 
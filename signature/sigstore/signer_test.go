@@ -0,0 +1,72 @@
+package sigstore
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/signature"
+	internalSigner "github.com/containers/image/v5/internal/signer"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/signature/internal"
+	"github.com/opencontainers/go-digest"
+	sigstoreSignature "github.com/sigstore/sigstore/pkg/signature"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithSigner(t *testing.T) {
+	testManifest := []byte("{}")
+	testDockerReference, err := reference.ParseNormalizedNamed("example.com/foo:notlatest")
+	require.NoError(t, err)
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	sv, err := sigstoreSignature.LoadECDSASignerVerifier(privateKey, crypto.SHA256)
+	require.NoError(t, err)
+
+	signer, err := NewSigner(WithSigner(sv))
+	require.NoError(t, err)
+	sig0, err := internalSigner.SignImageManifest(context.Background(), signer, testManifest, testDockerReference)
+	require.NoError(t, err)
+	sig, ok := sig0.(signature.Sigstore)
+	require.True(t, ok)
+
+	_, err = internal.VerifySigstorePayload(privateKey.Public(), sig.UntrustedPayload(),
+		sig.UntrustedAnnotations()[signature.SigstoreSignatureAnnotationKey],
+		internal.SigstorePayloadAcceptanceRules{
+			ValidateSignedDockerReference: func(ref string) error {
+				assert.Equal(t, "example.com/foo:notlatest", ref)
+				return nil
+			},
+			ValidateSignedDockerManifestDigest: func(digest digest.Digest) error {
+				matches, err := manifest.MatchesDigest(testManifest, digest)
+				require.NoError(t, err)
+				assert.True(t, matches)
+				return nil
+			},
+		})
+	assert.NoError(t, err)
+
+	// A nil signer is rejected
+	_, err = NewSigner(WithSigner(nil))
+	assert.Error(t, err)
+
+	// Multiple private key sources are rejected
+	passphrase := []byte("some passphrase")
+	keyPair, err := GenerateKeyPair(passphrase)
+	require.NoError(t, err)
+	privateKeyFile := filepath.Join(t.TempDir(), "private.key")
+	err = os.WriteFile(privateKeyFile, keyPair.PrivateKey, 0600)
+	require.NoError(t, err)
+	_, err = NewSigner(WithSigner(sv), WithPrivateKeyFile(privateKeyFile, passphrase))
+	assert.Error(t, err)
+	_, err = NewSigner(WithPrivateKeyFile(privateKeyFile, passphrase), WithSigner(sv))
+	assert.Error(t, err)
+}
@@ -39,6 +39,7 @@ type untrustedSignature struct {
 	// So, this is explicitly an int64, and we reject fractional values. If we did need more precise timestamps eventually,
 	// we would add another field, UntrustedTimestampNS int64.
 	untrustedTimestamp *int64
+	untrustedExpiry    *int64 // Like untrustedTimestamp, in seconds since the UNIX epoch
 }
 
 // UntrustedSignatureInformation is information available in an untrusted signature.
@@ -54,6 +55,7 @@ type UntrustedSignatureInformation struct {
 	UntrustedDockerReference      string // FIXME: more precise type?
 	UntrustedCreatorID            *string
 	UntrustedTimestamp            *time.Time
+	UntrustedExpiry               *time.Time
 	UntrustedShortKeyIdentifier   string
 }
 
@@ -93,6 +95,9 @@ func (s untrustedSignature) MarshalJSON() ([]byte, error) {
 	if s.untrustedTimestamp != nil {
 		optional["timestamp"] = *s.untrustedTimestamp
 	}
+	if s.untrustedExpiry != nil {
+		optional["expires"] = *s.untrustedExpiry
+	}
 	signature := map[string]any{
 		"critical": critical,
 		"optional": optional,
@@ -126,8 +131,8 @@ func (s *untrustedSignature) strictUnmarshalJSON(data []byte) error {
 	}
 
 	var creatorID string
-	var timestamp float64
-	var gotCreatorID, gotTimestamp = false, false
+	var timestamp, expiry float64
+	var gotCreatorID, gotTimestamp, gotExpiry = false, false, false
 	if err := internal.ParanoidUnmarshalJSONObject(optional, func(key string) any {
 		switch key {
 		case "creator":
@@ -136,6 +141,9 @@ func (s *untrustedSignature) strictUnmarshalJSON(data []byte) error {
 		case "timestamp":
 			gotTimestamp = true
 			return &timestamp
+		case "expires":
+			gotExpiry = true
+			return &expiry
 		default:
 			var ignore any
 			return &ignore
@@ -153,6 +161,13 @@ func (s *untrustedSignature) strictUnmarshalJSON(data []byte) error {
 		}
 		s.untrustedTimestamp = &intTimestamp
 	}
+	if gotExpiry {
+		intExpiry := int64(expiry)
+		if float64(intExpiry) != expiry {
+			return internal.NewInvalidSignatureError("Field optional.expires is not an integer")
+		}
+		s.untrustedExpiry = &intExpiry
+	}
 
 	var t string
 	var image, identity json.RawMessage
@@ -212,6 +227,7 @@ type signatureAcceptanceRules struct {
 	validateKeyIdentity                func(string) error
 	validateSignedDockerReference      func(string) error
 	validateSignedDockerManifestDigest func(digest.Digest) error
+	validateSignedTimestamp            func(*time.Time) error // May be nil; called with nil if the signature has no timestamp
 }
 
 // verifyAndExtractSignature verifies that unverifiedSignature has been signed, and that its principal components
@@ -235,6 +251,22 @@ func verifyAndExtractSignature(mech SigningMechanism, unverifiedSignature []byte
 	if err := rules.validateSignedDockerReference(unmatchedSignature.untrustedDockerReference); err != nil {
 		return nil, err
 	}
+	if unmatchedSignature.untrustedExpiry != nil {
+		expiry := time.Unix(*unmatchedSignature.untrustedExpiry, 0)
+		if time.Now().After(expiry) {
+			return nil, internal.NewInvalidSignatureError(fmt.Sprintf("Signature expired on %s", expiry))
+		}
+	}
+	if rules.validateSignedTimestamp != nil {
+		var timestamp *time.Time // = nil
+		if unmatchedSignature.untrustedTimestamp != nil {
+			ts := time.Unix(*unmatchedSignature.untrustedTimestamp, 0)
+			timestamp = &ts
+		}
+		if err := rules.validateSignedTimestamp(timestamp); err != nil {
+			return nil, err
+		}
+	}
 	// signatureAcceptanceRules have accepted this value.
 	return &Signature{
 		DockerManifestDigest: unmatchedSignature.untrustedDockerManifestDigest,
@@ -268,16 +300,21 @@ func GetUntrustedSignatureInformationWithoutVerifying(untrustedSignatureBytes []
 		return nil, internal.NewInvalidSignatureError(err.Error())
 	}
 
-	var timestamp *time.Time // = nil
+	var timestamp, expiry *time.Time // = nil
 	if untrustedDecodedContents.untrustedTimestamp != nil {
 		ts := time.Unix(*untrustedDecodedContents.untrustedTimestamp, 0)
 		timestamp = &ts
 	}
+	if untrustedDecodedContents.untrustedExpiry != nil {
+		e := time.Unix(*untrustedDecodedContents.untrustedExpiry, 0)
+		expiry = &e
+	}
 	return &UntrustedSignatureInformation{
 		UntrustedDockerManifestDigest: untrustedDecodedContents.untrustedDockerManifestDigest,
 		UntrustedDockerReference:      untrustedDecodedContents.untrustedDockerReference,
 		UntrustedCreatorID:            untrustedDecodedContents.untrustedCreatorID,
 		UntrustedTimestamp:            timestamp,
+		UntrustedExpiry:               expiry,
 		UntrustedShortKeyIdentifier:   shortKeyIdentifier,
 	}, nil
 }
@@ -41,6 +41,7 @@ func TestMarshalJSON(t *testing.T) {
 	// Use intermediate variables for these values so that we can take their addresses.
 	creatorID := "CREATOR"
 	timestamp := int64(1484683104)
+	expiry := int64(1484769504)
 	for _, c := range []struct {
 		input    untrustedSignature
 		expected string
@@ -54,6 +55,15 @@ func TestMarshalJSON(t *testing.T) {
 			},
 			"{\"critical\":{\"identity\":{\"docker-reference\":\"reference#@!\"},\"image\":{\"docker-manifest-digest\":\"digest!@#\"},\"type\":\"atomic container signature\"},\"optional\":{\"creator\":\"CREATOR\",\"timestamp\":1484683104}}",
 		},
+		{
+			untrustedSignature{
+				untrustedDockerManifestDigest: "digest!@#",
+				untrustedDockerReference:      "reference#@!",
+				untrustedTimestamp:            &timestamp,
+				untrustedExpiry:               &expiry,
+			},
+			"{\"critical\":{\"identity\":{\"docker-reference\":\"reference#@!\"},\"image\":{\"docker-manifest-digest\":\"digest!@#\"},\"type\":\"atomic container signature\"},\"optional\":{\"expires\":1484769504,\"timestamp\":1484683104}}",
+		},
 		{
 			untrustedSignature{
 				untrustedDockerManifestDigest: "digest!@#",
@@ -177,6 +187,9 @@ func TestUnmarshalJSON(t *testing.T) {
 		// Invalid "timestamp"
 		func(v mSA) { x(v, "optional")["timestamp"] = "unexpected" },
 		func(v mSA) { x(v, "optional")["timestamp"] = 0.5 }, // Fractional input
+		// Invalid "expires"
+		func(v mSA) { x(v, "optional")["expires"] = "unexpected" },
+		func(v mSA) { x(v, "optional")["expires"] = 0.5 }, // Fractional input
 	}
 	for _, fn := range breakFns {
 		testJSON := modifiedJSON(t, validJSON, fn)
@@ -247,6 +260,42 @@ func TestSign(t *testing.T) {
 	assert.Equal(t, sig.untrustedDockerManifestDigest, verified.DockerManifestDigest)
 	assert.Equal(t, sig.untrustedDockerReference, verified.DockerReference)
 
+	acceptAllRules := signatureAcceptanceRules{
+		validateKeyIdentity:                func(string) error { return nil },
+		validateSignedDockerReference:      func(string) error { return nil },
+		validateSignedDockerManifestDigest: func(digest.Digest) error { return nil },
+	}
+	// An unexpired signature
+	expiry := time.Now().Add(time.Hour).Unix()
+	expiringSig := sig
+	expiringSig.untrustedExpiry = &expiry
+	signature, err = expiringSig.sign(mech, TestKeyFingerprint, "")
+	require.NoError(t, err)
+	_, err = verifyAndExtractSignature(mech, signature, acceptAllRules)
+	assert.NoError(t, err)
+	// An expired signature
+	expiry = time.Now().Add(-time.Hour).Unix()
+	signature, err = expiringSig.sign(mech, TestKeyFingerprint, "")
+	require.NoError(t, err)
+	_, err = verifyAndExtractSignature(mech, signature, acceptAllRules)
+	assert.ErrorContains(t, err, "Signature expired")
+
+	// validateSignedTimestamp is called with the signing timestamp
+	var recordedTimestamp *time.Time
+	timestampRules := acceptAllRules
+	timestampRules.validateSignedTimestamp = func(timestamp *time.Time) error {
+		recordedTimestamp = timestamp
+		return errors.New("timestamp rejected")
+	}
+	_, err = verifyAndExtractSignature(mech, signature, timestampRules)
+	assert.ErrorContains(t, err, "Signature expired") // Expiry is checked first
+	signature, err = sig.sign(mech, TestKeyFingerprint, "")
+	require.NoError(t, err)
+	_, err = verifyAndExtractSignature(mech, signature, timestampRules)
+	assert.ErrorContains(t, err, "timestamp rejected")
+	require.NotNil(t, recordedTimestamp)
+	assert.Equal(t, *sig.untrustedTimestamp, recordedTimestamp.Unix())
+
 	// Error creating blob to sign
 	_, err = untrustedSignature{}.sign(mech, TestKeyFingerprint, "")
 	assert.Error(t, err)
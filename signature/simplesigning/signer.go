@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/containers/image/v5/docker/reference"
 	internalSig "github.com/containers/image/v5/internal/signature"
@@ -17,7 +18,8 @@ import (
 type simpleSigner struct {
 	mech           signature.SigningMechanism
 	keyFingerprint string
-	passphrase     string // "" if not provided.
+	passphrase     string        // "" if not provided.
+	validity       time.Duration // 0 if the signatures should not expire.
 }
 
 type Option func(*simpleSigner) error
@@ -43,6 +45,18 @@ func WithPassphrase(passphrase string) Option {
 	}
 }
 
+// WithValidityPeriod returns an Option for NewSigner, specifying that the created signatures expire
+// after the provided duration since they were created.
+func WithValidityPeriod(validity time.Duration) Option {
+	return func(s *simpleSigner) error {
+		if validity <= 0 {
+			return fmt.Errorf("invalid signature validity period %s: must be positive", validity)
+		}
+		s.validity = validity
+		return nil
+	}
+}
+
 // NewSigner returns a signature.Signer which creates “simple signing” signatures using the user’s default
 // GPG configuration ($GNUPGHOME / ~/.gnupg).
 //
@@ -91,9 +105,13 @@ func (s *simpleSigner) SignImageManifest(ctx context.Context, m []byte, dockerRe
 	if reference.IsNameOnly(dockerReference) {
 		return nil, fmt.Errorf("reference %s can’t be signed, it has neither a tag nor a digest", dockerReference.String())
 	}
-	simpleSig, err := signature.SignDockerManifestWithOptions(m, dockerReference.String(), s.mech, s.keyFingerprint, &signature.SignOptions{
+	options := signature.SignOptions{
 		Passphrase: s.passphrase,
-	})
+	}
+	if s.validity != 0 {
+		options.Expiry = time.Now().Add(s.validity)
+	}
+	simpleSig, err := signature.SignDockerManifestWithOptions(m, dockerReference.String(), s.mech, s.keyFingerprint, &options)
 	if err != nil {
 		return nil, err
 	}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/containers/image/v5/docker/reference"
 	internalSig "github.com/containers/image/v5/internal/signature"
@@ -51,6 +52,12 @@ func TestNewSigner(t *testing.T) {
 	_, err = NewSigner(WithKeyFingerprint(testKeyFingerprintWithPassphrase), WithPassphrase("\n"))
 	assert.Error(t, err)
 
+	// Invalid validity periods
+	for _, d := range []time.Duration{0, -time.Hour} {
+		_, err = NewSigner(WithKeyFingerprint(testKeyFingerprint), WithValidityPeriod(d))
+		assert.Error(t, err)
+	}
+
 	// WithKeyFingerprint is missing
 	_, err = NewSigner(WithPassphrase("something"))
 	assert.Error(t, err)
@@ -176,6 +183,11 @@ func TestSimpleSignerSignImageManifest(t *testing.T) {
 			fingerprint: testKeyFingerprintWithPassphrase,
 			opts:        []Option{WithPassphrase(testPassphrase)},
 		},
+		{
+			name:        "With validity period",
+			fingerprint: testKeyFingerprint,
+			opts:        []Option{WithValidityPeriod(time.Hour)},
+		},
 	} {
 		s, err := NewSigner(append([]Option{WithKeyFingerprint(c.fingerprint)}, c.opts...)...)
 		require.NoError(t, err, c.name)
@@ -189,7 +201,7 @@ func TestSimpleSignerSignImageManifest(t *testing.T) {
 		// FIXME FIXME: gpgme_op_sign with a passphrase succeeds, but somehow confuses the GPGME internal state
 		// so that gpgme_op_verify below never completes (it polls on an already closed FD).
 		// That’s probably a GPGME bug, and needs investigating and fixing, but it isn’t related to this “signer” implementation.
-		if len(c.opts) == 0 {
+		if c.fingerprint == testKeyFingerprint {
 			mech, err := signature.NewGPGSigningMechanism()
 			require.NoError(t, err)
 			defer mech.Close()
@@ -199,6 +211,15 @@ func TestSimpleSignerSignImageManifest(t *testing.T) {
 			assert.Equal(t, testImageSignatureReference.String(), verified.DockerReference)
 			assert.Equal(t, testImageManifestDigest, verified.DockerManifestDigest)
 		}
+
+		info, err := signature.GetUntrustedSignatureInformationWithoutVerifying(simpleSig.UntrustedSignature())
+		require.NoError(t, err, c.name)
+		if c.name == "With validity period" {
+			require.NotNil(t, info.UntrustedExpiry)
+			assert.WithinDuration(t, time.Now().Add(time.Hour), *info.UntrustedExpiry, time.Minute)
+		} else {
+			assert.Nil(t, info.UntrustedExpiry)
+		}
 	}
 
 	invalidManifest, err := os.ReadFile("../fixtures/v2s1-invalid-signatures.manifest.json")
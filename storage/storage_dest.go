@@ -26,6 +26,7 @@ import (
 	"github.com/containers/image/v5/internal/tmpdir"
 	"github.com/containers/image/v5/manifest"
 	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/pkg/logging"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage"
 	graphdriver "github.com/containers/storage/drivers"
@@ -34,7 +35,6 @@ import (
 	"github.com/containers/storage/pkg/ioutils"
 	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
-	"github.com/sirupsen/logrus"
 	"golang.org/x/exp/slices"
 )
 
@@ -56,6 +56,7 @@ type storageImageDestination struct {
 	stubs.AlwaysSupportsSignatures
 
 	imageRef        storageReference
+	logger          types.Logger             // Logger for messages about this destination
 	directory       string                   // Temporary directory where we store blobs until Commit() time
 	nextTempFileID  atomic.Int32             // A counter that we use for computing filenames to assign to blobs
 	manifest        []byte                   // Manifest contents, temporary
@@ -64,6 +65,9 @@ type storageImageDestination struct {
 	signatureses    map[digest.Digest][]byte // Instance signature contents, temporary
 	SignatureSizes  []int                    `json:"signature-sizes,omitempty"`  // List of sizes of each signature slice
 	SignaturesSizes map[digest.Digest][]int  `json:"signatures-sizes,omitempty"` // Sizes of each manifest's signature slice
+	LazyLayers      []digest.Digest          `json:"lazy-layers,omitempty"`      // Layer blobs stored instead of being applied, see types.SystemContext.ContainersStorageLazyLayers
+	IncompleteSince string                   `json:"incomplete-since,omitempty"` // Set, to a createdFlagValue, while a newly created image is being committed
+	lazyLayers      bool                     // True if layer blobs should be stored instead of being applied
 
 	// A storage destination may be used concurrently.  Accesses are
 	// serialized via a mutex.  Please refer to the individual comments
@@ -75,6 +79,14 @@ type storageImageDestination struct {
 	// `queueOrCommit()` for further details on how the single-caller
 	// guarantee is implemented.
 	indexToStorageID map[int]*string
+	// Layers created by `commitLayer()`, in order; protected in the same way as indexToStorageID.
+	appliedLayers []appliedLayer
+	// If set, a channel to report progress of applying layers to.
+	commitProgress chan<- types.ProgressProperties
+	// True if Commit() has succeeded.
+	committed bool
+	// The ID of the image created or updated by a successful Commit().
+	committedImageID string
 	// All accesses to below data are protected by `lock` which is made
 	// *explicit* in the code.
 	uncompressedOrTocDigest map[digest.Digest]digest.Digest                       // Mapping from layer blobsums to their corresponding DiffIDs or TOC IDs.
@@ -86,6 +98,12 @@ type storageImageDestination struct {
 	diffOutputs             map[digest.Digest]*graphdriver.DriverWithDifferOutput // Mapping from digest to differ output
 }
 
+// appliedLayer is a layer created by a storageImageDestination.
+type appliedLayer struct {
+	id   string        // The ID of the layer
+	blob digest.Digest // The digest of the blob the layer was created from
+}
+
 // addedLayerInfo records data about a layer to use in this image.
 type addedLayerInfo struct {
 	digest     digest.Digest
@@ -118,7 +136,9 @@ func newImageDestination(sys *types.SystemContext, imageRef storageReference) (*
 		}),
 
 		imageRef:                imageRef,
+		logger:                  logging.For(sys),
 		directory:               directory,
+		lazyLayers:              sys != nil && sys.ContainersStorageLazyLayers,
 		signatureses:            make(map[digest.Digest][]byte),
 		uncompressedOrTocDigest: make(map[digest.Digest]digest.Digest),
 		blobAdditionalLayer:     make(map[digest.Digest]storage.AdditionalLayer),
@@ -170,7 +190,7 @@ func (s *storageImageDestination) PutBlobWithOptions(ctx context.Context, stream
 		return info, err
 	}
 
-	if options.IsConfig || options.LayerIndex == nil {
+	if options.IsConfig || options.LayerIndex == nil || s.lazyLayers {
 		return info, nil
 	}
 
@@ -264,6 +284,12 @@ func (f *zstdFetcher) GetBlobAt(chunks []chunked.ImageSourceChunk) (chan io.Read
 
 }
 
+// SupportsPutBlobPartial returns true if PutBlobPartial is supported.
+func (s *storageImageDestination) SupportsPutBlobPartial() bool {
+	// Partial pulls apply the layer directly; that's not possible if layers are stored with the image.
+	return !s.lazyLayers
+}
+
 // PutBlobPartial attempts to create a blob using the data that is already present
 // at the destination. chunkAccessor is accessed in a non-sequential way to retrieve the missing chunks.
 // It is available only if SupportsPutBlobPartial().
@@ -288,8 +314,15 @@ func (s *storageImageDestination) PutBlobPartial(ctx context.Context, chunkAcces
 
 	blobDigest := srcInfo.Digest
 
+	// Record the TOC digest, so that the layer can be found, and reused, by its TOC digest, even if a later pull uses a
+	// differently-compressed blob.
+	tocDigest := out.TOCDigest
+	if tocDigest == "" {
+		tocDigest = blobDigest
+	}
+
 	s.lock.Lock()
-	s.uncompressedOrTocDigest[blobDigest] = blobDigest
+	s.uncompressedOrTocDigest[blobDigest] = tocDigest
 	s.fileSizes[blobDigest] = 0
 	s.filenames[blobDigest] = ""
 	s.diffOutputs[blobDigest] = out
@@ -310,6 +343,27 @@ func (s *storageImageDestination) TryReusingBlobWithOptions(ctx context.Context,
 	if !impl.OriginalBlobMatchesRequiredCompression(options) {
 		return false, private.ReusedBlob{}, nil
 	}
+	if s.lazyLayers {
+		// Layers are not applied, so only layer blobs already written to this destination, or stored for other images
+		// with lazy layers, can be reused.
+		s.lock.Lock()
+		size, ok := s.fileSizes[blobinfo.Digest]
+		s.lock.Unlock()
+		if ok {
+			return true, private.ReusedBlob{Digest: blobinfo.Digest, Size: size}, nil
+		}
+		if options.LayerIndex == nil {
+			return false, private.ReusedBlob{}, nil
+		}
+		fi, err := os.Stat(lazyLayerPath(s.imageRef.transport.store, blobinfo.Digest))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return false, private.ReusedBlob{}, nil
+			}
+			return false, private.ReusedBlob{}, err
+		}
+		return true, private.ReusedBlob{Digest: blobinfo.Digest, Size: fi.Size()}, nil
+	}
 	reused, info, err := s.tryReusingBlobAsPending(blobinfo.Digest, blobinfo.Size, &options)
 	if err != nil || !reused || options.LayerIndex == nil {
 		return reused, info, err
@@ -416,23 +470,29 @@ func (s *storageImageDestination) tryReusingBlobAsPending(digest digest.Digest,
 		}
 	}
 
-	tocDigest := digest
 	if options.TOCDigest != nil {
-		tocDigest = *options.TOCDigest
-	}
-
-	// Check if we have a chunked layer in storage with the same TOC digest.
-	layers, err = s.imageRef.transport.store.LayersByTOCDigest(tocDigest)
-	if err != nil && !errors.Is(err, storage.ErrLayerUnknown) {
-		return false, private.ReusedBlob{}, fmt.Errorf(`looking for layers with TOC digest %q: %w`, tocDigest, err)
-	}
-	if len(layers) > 0 {
-		// Save this for completeness.
-		s.uncompressedOrTocDigest[digest] = layers[0].TOCDigest
-		return true, private.ReusedBlob{
-			Digest: layers[0].TOCDigest,
-			Size:   layers[0].UncompressedSize,
-		}, nil
+		// Check if we have a chunked layer in storage with the same TOC digest; this matches the same contents
+		// even if the blob was compressed differently.
+		layers, err = s.imageRef.transport.store.LayersByTOCDigest(*options.TOCDigest)
+		if err != nil && !errors.Is(err, storage.ErrLayerUnknown) {
+			return false, private.ReusedBlob{}, fmt.Errorf(`looking for layers with TOC digest %q: %w`, *options.TOCDigest, err)
+		}
+		if len(layers) > 0 {
+			if size != -1 {
+				s.uncompressedOrTocDigest[digest] = layers[0].TOCDigest
+				return true, private.ReusedBlob{
+					Digest: digest,
+					Size:   size,
+				}, nil
+			}
+			if options.CanSubstitute && layers[0].UncompressedDigest != "" {
+				s.uncompressedOrTocDigest[layers[0].UncompressedDigest] = layers[0].UncompressedDigest
+				return true, private.ReusedBlob{
+					Digest: layers[0].UncompressedDigest,
+					Size:   layers[0].UncompressedSize,
+				}, nil
+			}
+		}
 	}
 
 	// Nope, we don't have it.
@@ -459,7 +519,7 @@ func (s *storageImageDestination) computeID(m manifest.Manifest) string {
 			blobSum := m.FSLayers[i].BlobSum
 			diffID, ok := s.uncompressedOrTocDigest[blobSum]
 			if !ok {
-				logrus.Infof("error looking up diffID for layer %q", blobSum.String())
+				s.logger.Infof("error looking up diffID for layer %q", blobSum.String())
 				return ""
 			}
 			diffIDs = append([]digest.Digest{diffID}, diffIDs...)
@@ -608,7 +668,7 @@ func (s *storageImageDestination) commitLayer(index int, info addedLayerInfo, si
 		// that relies on using a blob digest that has never been seen by the store had better call
 		// TryReusingBlob; not calling PutBlob already violates the documented API, so there’s only
 		// so far we are going to accommodate that (if we should be doing that at all).
-		logrus.Debugf("looking for diffID or TOC digest for blob %+v", info.digest)
+		s.logger.Debugf("looking for diffID or TOC digest for blob %+v", info.digest)
 		// Use tryReusingBlobAsPending, not the top-level TryReusingBlobWithOptions, to prevent recursion via queueOrCommit.
 		has, _, err := s.tryReusingBlobAsPending(info.digest, size, &private.TryReusingBlobOptions{
 			Cache:         none.NoCache,
@@ -641,7 +701,7 @@ func (s *storageImageDestination) commitLayer(index int, info addedLayerInfo, si
 	s.lock.Unlock()
 	if ok {
 		if s.manifest == nil {
-			logrus.Debugf("Skipping commit for TOC=%q, manifest not yet available", id)
+			s.logger.Debugf("Skipping commit for TOC=%q, manifest not yet available", id)
 			return true, nil
 		}
 
@@ -664,7 +724,9 @@ func (s *storageImageDestination) commitLayer(index int, info addedLayerInfo, si
 			return false, fmt.Errorf("index %d out of range for configOCI.RootFS.DiffIDs", index)
 		}
 
-		layer, err := s.imageRef.transport.store.CreateLayer(id, lastLayer, nil, "", false, nil)
+		layer, err := s.imageRef.transport.store.CreateLayer(id, lastLayer, nil, "", false, &storage.LayerOptions{
+			Flags: createdFlags(),
+		})
 		if err != nil {
 			return false, err
 		}
@@ -672,15 +734,17 @@ func (s *storageImageDestination) commitLayer(index int, info addedLayerInfo, si
 		// let the storage layer know what was the original uncompressed layer.
 		flags := make(map[string]interface{})
 		flags[expectedLayerDiffIDFlag] = configOCI.RootFS.DiffIDs[index]
-		logrus.Debugf("Setting uncompressed digest to %q for layer %q", configOCI.RootFS.DiffIDs[index], id)
+		s.logger.Debugf("Setting uncompressed digest to %q for layer %q", configOCI.RootFS.DiffIDs[index], id)
 		options := &graphdriver.ApplyDiffWithDifferOpts{
 			Flags: flags,
 		}
 
+		s.reportCommitProgress(types.ProgressEventApplying, info.digest, size)
 		if err := s.imageRef.transport.store.ApplyDiffFromStagingDirectory(layer.ID, diffOutput.Target, diffOutput, options); err != nil {
 			_ = s.imageRef.transport.store.Delete(layer.ID)
 			return false, err
 		}
+		s.recordAppliedLayer(layer.ID, info.digest, size)
 
 		s.indexToStorageID[index] = &layer.ID
 		return false, nil
@@ -690,10 +754,14 @@ func (s *storageImageDestination) commitLayer(index int, info addedLayerInfo, si
 	al, ok := s.blobAdditionalLayer[info.digest]
 	s.lock.Unlock()
 	if ok {
+		s.reportCommitProgress(types.ProgressEventApplying, info.digest, size)
 		layer, err := al.PutAs(id, lastLayer, nil)
 		if err != nil && !errors.Is(err, storage.ErrDuplicateID) {
 			return false, fmt.Errorf("failed to put layer from digest and labels: %w", err)
 		}
+		if err == nil {
+			s.recordAppliedLayer(layer.ID, info.digest, size)
+		}
 		lastLayer = layer.ID
 		s.indexToStorageID[index] = &lastLayer
 		return false, nil
@@ -704,6 +772,7 @@ func (s *storageImageDestination) commitLayer(index int, info addedLayerInfo, si
 	s.lock.Lock()
 	filename, ok := s.filenames[info.digest]
 	s.lock.Unlock()
+	uncompressedDigest := diffIDOrTOCDigest
 	if !ok {
 		// Try to find the layer with contents matching that blobsum.
 		layer := ""
@@ -714,6 +783,13 @@ func (s *storageImageDestination) commitLayer(index int, info addedLayerInfo, si
 			layers, err2 = s.imageRef.transport.store.LayersByCompressedDigest(info.digest)
 			if err2 == nil && len(layers) > 0 {
 				layer = layers[0].ID
+			} else {
+				layers, err2 = s.imageRef.transport.store.LayersByTOCDigest(diffIDOrTOCDigest)
+				if err2 == nil && len(layers) > 0 {
+					layer = layers[0].ID
+					// diffIDOrTOCDigest is a TOC digest, not the uncompressed digest of the diff.
+					uncompressedDigest = layers[0].UncompressedDigest
+				}
 			}
 		}
 		if layer == "" {
@@ -761,13 +837,18 @@ func (s *storageImageDestination) commitLayer(index int, info addedLayerInfo, si
 	defer file.Close()
 	// Build the new layer using the diff, regardless of where it came from.
 	// TODO: This can take quite some time, and should ideally be cancellable using ctx.Done().
+	s.reportCommitProgress(types.ProgressEventApplying, info.digest, size)
 	layer, _, err := s.imageRef.transport.store.PutLayer(id, lastLayer, nil, "", false, &storage.LayerOptions{
 		OriginalDigest:     info.digest,
-		UncompressedDigest: diffIDOrTOCDigest,
+		UncompressedDigest: uncompressedDigest,
+		Flags:              createdFlags(),
 	}, file)
 	if err != nil && !errors.Is(err, storage.ErrDuplicateID) {
 		return false, fmt.Errorf("adding layer with blob %q: %w", info.digest, err)
 	}
+	if err == nil {
+		s.recordAppliedLayer(layer.ID, info.digest, size)
+	}
 
 	s.indexToStorageID[index] = &layer.ID
 	return false, nil
@@ -815,6 +896,25 @@ func (s *storageImageDestination) Commit(ctx context.Context, unparsedToplevel t
 	}
 	layerBlobs := man.LayerInfos()
 
+	if s.lazyLayers {
+		// Don't apply any layers, store the layer blobs in files shared by all images with lazy layers instead.
+		lock, err := lockLazyLayers(s.imageRef.transport.store)
+		if err != nil {
+			return err
+		}
+		// Keep the blobs locked until the image referring to them is created, so that RemoveUnusedLazyLayers doesn't remove them.
+		defer lock.Unlock()
+		s.LazyLayers = []digest.Digest{}
+		for _, blob := range layerBlobs {
+			// If there is no file, the blob was reused from the stored blobs.
+			if err := storeLazyLayer(s.imageRef.transport.store, blob.Digest, s.filenames[blob.Digest]); err != nil {
+				return err
+			}
+			s.LazyLayers = append(s.LazyLayers, blob.Digest)
+		}
+		layerBlobs = nil
+	}
+
 	// Extract, commit, or find the layers.
 	for i, blob := range layerBlobs {
 		if stopQueue, err := s.commitLayer(i, addedLayerInfo{
@@ -839,7 +939,7 @@ func (s *storageImageDestination) Commit(ctx context.Context, unparsedToplevel t
 	// was originally created, in case we're just copying it.  If not, no harm done.
 	options := &storage.ImageOptions{}
 	if inspect, err := man.Inspect(s.getConfigBlob); err == nil && inspect.Created != nil {
-		logrus.Debugf("setting image creation date to %s", inspect.Created)
+		s.logger.Debugf("setting image creation date to %s", inspect.Created)
 		options.CreationDate = *inspect.Created
 	}
 
@@ -849,7 +949,7 @@ func (s *storageImageDestination) Commit(ctx context.Context, unparsedToplevel t
 	for blob := range s.filenames {
 		dataBlobs.Add(blob)
 	}
-	for _, layerBlob := range layerBlobs {
+	for _, layerBlob := range man.LayerInfos() {
 		dataBlobs.Delete(layerBlob.Digest)
 	}
 	for _, blob := range dataBlobs.Values() {
@@ -905,25 +1005,38 @@ func (s *storageImageDestination) Commit(ctx context.Context, unparsedToplevel t
 		})
 	}
 
-	// Set up to save our metadata.
+	// Set up to save our metadata.  A newly created image is marked as incomplete until the commit finishes.
 	metadata, err := json.Marshal(s)
 	if err != nil {
 		return fmt.Errorf("encoding metadata for image: %w", err)
 	}
-	if len(metadata) != 0 {
-		options.Metadata = string(metadata)
+	s.IncompleteSince = createdFlagValue()
+	incompleteMetadata, err := json.Marshal(s)
+	s.IncompleteSince = ""
+	if err != nil {
+		return fmt.Errorf("encoding metadata for image: %w", err)
 	}
+	options.Metadata = string(incompleteMetadata)
 
 	// Create the image record, pointing to the most-recently added layer.
 	intendedID := s.imageRef.id
 	if intendedID == "" {
 		intendedID = s.computeID(man)
+		if s.lazyLayers && intendedID != "" {
+			// Use a different ID than the image with applied layers would use, so that ApplyLazyLayers
+			// can create that image without modifying this one.
+			intendedID = digest.Canonical.FromString(LazyLayersFlag + ":" + intendedID).Encoded()
+		}
+	}
+	if s.lazyLayers {
+		options.Flags = map[string]interface{}{LazyLayersFlag: true}
 	}
 	oldNames := []string{}
 	img, err := s.imageRef.transport.store.CreateImage(intendedID, nil, lastLayer, "", options)
+	createdImage := err == nil
 	if err != nil {
 		if !errors.Is(err, storage.ErrDuplicateID) {
-			logrus.Debugf("error creating image: %q", err)
+			s.logger.Debugf("error creating image: %q", err)
 			return fmt.Errorf("creating image %q: %w", intendedID, err)
 		}
 		img, err = s.imageRef.transport.store.Image(intendedID)
@@ -931,10 +1044,10 @@ func (s *storageImageDestination) Commit(ctx context.Context, unparsedToplevel t
 			return fmt.Errorf("reading image %q: %w", intendedID, err)
 		}
 		if img.TopLayer != lastLayer {
-			logrus.Debugf("error creating image: image with ID %q exists, but uses different layers", intendedID)
+			s.logger.Debugf("error creating image: image with ID %q exists, but uses different layers", intendedID)
 			return fmt.Errorf("image with ID %q already exists, but uses a different top layer: %w", intendedID, storage.ErrDuplicateID)
 		}
-		logrus.Debugf("reusing image ID %q", img.ID)
+		s.logger.Debugf("reusing image ID %q", img.ID)
 		oldNames = append(oldNames, img.Names...)
 		// set the data items and metadata on the already-present image
 		// FIXME: this _replaces_ any "signatures" blobs and their
@@ -943,19 +1056,20 @@ func (s *storageImageDestination) Commit(ctx context.Context, unparsedToplevel t
 		// to merge them since they all apply to the same image
 		for _, data := range options.BigData {
 			if err := s.imageRef.transport.store.SetImageBigData(img.ID, data.Key, data.Data, manifest.Digest); err != nil {
-				logrus.Debugf("error saving big data %q for image %q: %v", data.Key, img.ID, err)
+				s.logger.Debugf("error saving big data %q for image %q: %v", data.Key, img.ID, err)
 				return fmt.Errorf("saving big data %q for image %q: %w", data.Key, img.ID, err)
 			}
 		}
-		if options.Metadata != "" {
-			if err := s.imageRef.transport.store.SetMetadata(img.ID, options.Metadata); err != nil {
-				logrus.Debugf("error saving metadata for image %q: %v", img.ID, err)
+		// The image existed before, so it is never marked as incomplete.
+		if len(metadata) != 0 {
+			if err := s.imageRef.transport.store.SetMetadata(img.ID, string(metadata)); err != nil {
+				s.logger.Debugf("error saving metadata for image %q: %v", img.ID, err)
 				return fmt.Errorf("saving metadata for image %q: %w", img.ID, err)
 			}
-			logrus.Debugf("saved image metadata %q", options.Metadata)
+			s.logger.Debugf("saved image metadata %q", string(metadata))
 		}
 	} else {
-		logrus.Debugf("created new image ID %q with metadata %q", img.ID, options.Metadata)
+		s.logger.Debugf("created new image ID %q with metadata %q", img.ID, options.Metadata)
 	}
 
 	// Clean up the unfinished image on any error.
@@ -963,9 +1077,9 @@ func (s *storageImageDestination) Commit(ctx context.Context, unparsedToplevel t
 	commitSucceeded := false
 	defer func() {
 		if !commitSucceeded {
-			logrus.Errorf("Updating image %q (old names %v) failed, deleting it", img.ID, oldNames)
+			s.logger.Errorf("Updating image %q (old names %v) failed, deleting it", img.ID, oldNames)
 			if _, err := s.imageRef.transport.store.DeleteImage(img.ID, true); err != nil {
-				logrus.Errorf("Error deleting incomplete image %q: %v", img.ID, err)
+				s.logger.Errorf("Error deleting incomplete image %q: %v", img.ID, err)
 			}
 		}
 	}()
@@ -976,13 +1090,76 @@ func (s *storageImageDestination) Commit(ctx context.Context, unparsedToplevel t
 		if err := s.imageRef.transport.store.AddNames(img.ID, []string{name.String()}); err != nil {
 			return fmt.Errorf("adding names %v to image %q: %w", name, img.ID, err)
 		}
-		logrus.Debugf("added name %q to image %q", name, img.ID)
+		s.logger.Debugf("added name %q to image %q", name, img.ID)
+	}
+
+	if createdImage {
+		if err := s.imageRef.transport.store.SetMetadata(img.ID, string(metadata)); err != nil {
+			return fmt.Errorf("saving metadata for image %q: %w", img.ID, err)
+		}
 	}
 
 	commitSucceeded = true
+	s.committed = true
+	s.committedImageID = img.ID
 	return nil
 }
 
+// reportCommitProgress sends event for the layer created from blobDigest to s.commitProgress, if set.
+func (s *storageImageDestination) reportCommitProgress(event types.ProgressEvent, blobDigest digest.Digest, size int64) {
+	if s.commitProgress != nil {
+		s.commitProgress <- types.ProgressProperties{
+			Event:    event,
+			Artifact: types.BlobInfo{Digest: blobDigest, Size: size},
+		}
+	}
+}
+
+// recordAppliedLayer records that layerID was created from blobDigest, so that it can be removed by Rollback,
+// and reports that the layer has been applied.
+func (s *storageImageDestination) recordAppliedLayer(layerID string, blobDigest digest.Digest, size int64) {
+	s.appliedLayers = append(s.appliedLayers, appliedLayer{id: layerID, blob: blobDigest})
+	s.reportCommitProgress(types.ProgressEventApplied, blobDigest, size)
+}
+
+// SetCommitProgress sets a channel to send types.ProgressEventApplying, types.ProgressEventApplied and
+// types.ProgressEventRolledBack events to.  It must be called before any blobs are written.
+func (s *storageImageDestination) SetCommitProgress(channel chan<- types.ProgressProperties) {
+	s.commitProgress = channel
+}
+
+// Rollback removes the layers applied by this destination, as far as they are not used by any other image.
+// It is intended to be called when copying an image fails; it must not be called after a successful Commit.
+func (s *storageImageDestination) Rollback(ctx context.Context) error {
+	if s.committed {
+		return errors.New("Internal error: storageImageDestination.Rollback() called after a successful Commit()")
+	}
+	var retErr error
+	// Remove the layers in reverse order, so that children are removed before their parents.
+	for i := len(s.appliedLayers) - 1; i >= 0; i-- {
+		layer := s.appliedLayers[i]
+		if err := s.imageRef.transport.store.DeleteLayer(layer.id); err != nil {
+			if errors.Is(err, storage.ErrLayerUnknown) || errors.Is(err, storage.ErrNotALayer) || errors.Is(err, storage.ErrLayerHasChildren) ||
+				errors.Is(err, storage.ErrLayerUsedByImage) || errors.Is(err, storage.ErrLayerUsedByContainer) {
+				// Someone else has started using the layer (or removed it) in the meantime; leave it alone.
+				s.logger.Debugf("Not removing layer %q: %v", layer.id, err)
+				continue
+			}
+			if retErr == nil {
+				retErr = fmt.Errorf("removing layer %q: %w", layer.id, err)
+			}
+			continue
+		}
+		s.logger.Debugf("Removed layer %q", layer.id)
+		s.reportCommitProgress(types.ProgressEventRolledBack, layer.blob, -1)
+	}
+	s.appliedLayers = nil
+	for index := range s.indexToStorageID {
+		delete(s.indexToStorageID, index)
+	}
+	return retErr
+}
+
 // PutManifest writes the manifest to the destination.
 func (s *storageImageDestination) PutManifest(ctx context.Context, manifestBlob []byte, instanceDigest *digest.Digest) error {
 	digest, err := manifest.Digest(manifestBlob)
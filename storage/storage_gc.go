@@ -0,0 +1,186 @@
+//go:build !containers_image_storage_stub
+// +build !containers_image_storage_stub
+
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/storage"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
+)
+
+// createdFlag is set on layers created by this transport; its value is the time the layer was created, in RFC 3339 format.
+// Images which are being committed are marked similarly, using storageImageDestination.IncompleteSince in their metadata.
+const createdFlag = "containers-image-created"
+
+// createdFlagValue returns a value of createdFlag for an item created now.
+func createdFlagValue() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+// createdFlags returns flags marking a layer as created by this transport now.
+func createdFlags() map[string]interface{} {
+	return map[string]interface{}{createdFlag: createdFlagValue()}
+}
+
+// createdBefore returns true if value is a createdFlagValue of an item created before t.
+func createdBefore(value interface{}, t time.Time) bool {
+	s, ok := value.(string)
+	if !ok || s == "" {
+		return false
+	}
+	created, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return false
+	}
+	return created.Before(t)
+}
+
+// imageIncompleteBefore returns true if img is an image created by this transport before t, which was never completely committed.
+func imageIncompleteBefore(img *storage.Image, t time.Time) bool {
+	if img.Metadata == "" {
+		return false
+	}
+	var metadata struct {
+		IncompleteSince string `json:"incomplete-since,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(img.Metadata), &metadata); err != nil {
+		return false
+	}
+	return createdBefore(metadata.IncompleteSince, t)
+}
+
+// Incomplete describes images and layers created by this transport which were never used by a successfully committed image,
+// e.g. because the process copying an image crashed.
+type Incomplete struct {
+	Images []string // IDs of images which were not completely written
+	Layers []string // IDs of layers not used by any other image, layer or container, ordered so that children precede their parents
+}
+
+// FindIncomplete returns the images and layers in store which were created by this transport before cutoff,
+// and never used by a successfully committed image.
+//
+// cutoff should be older than the start of any copy which might still be in progress; layers created by such copies
+// are not yet used by any image, and would be reported.
+func FindIncomplete(store storage.Store, cutoff time.Time) (*Incomplete, error) {
+	res := &Incomplete{
+		Images: []string{},
+		Layers: []string{},
+	}
+
+	images, err := store.Images()
+	if err != nil {
+		return nil, fmt.Errorf("listing images: %w", err)
+	}
+	inUse := set.New[string]() // Top layers of images which are not incomplete.
+	for _, img := range images {
+		if imageIncompleteBefore(&img, cutoff) {
+			res.Images = append(res.Images, img.ID)
+			continue
+		}
+		if img.TopLayer != "" {
+			inUse.Add(img.TopLayer)
+		}
+		for _, layerID := range img.MappedTopLayers {
+			inUse.Add(layerID)
+		}
+	}
+	containers, err := store.Containers()
+	if err != nil {
+		return nil, fmt.Errorf("listing containers: %w", err)
+	}
+	for _, c := range containers {
+		inUse.Add(c.LayerID)
+	}
+
+	layers, err := store.Layers()
+	if err != nil {
+		return nil, fmt.Errorf("listing layers: %w", err)
+	}
+	byID := map[string]storage.Layer{}
+	for _, layer := range layers {
+		byID[layer.ID] = layer
+	}
+	// Any parent of a layer in use, or of a layer which is not incomplete, must be kept.
+	keep := set.New[string]()
+	var markKept func(layerID string)
+	markKept = func(layerID string) {
+		for layerID != "" && !keep.Contains(layerID) {
+			keep.Add(layerID)
+			layerID = byID[layerID].Parent
+		}
+	}
+	for _, layer := range layers {
+		if inUse.Contains(layer.ID) || !createdBefore(layer.Flags[createdFlag], cutoff) {
+			markKept(layer.ID)
+		}
+	}
+	depth := map[string]int{}
+	for _, layer := range layers {
+		if keep.Contains(layer.ID) {
+			continue
+		}
+		res.Layers = append(res.Layers, layer.ID)
+		d := 0
+		for parent := layer.Parent; parent != ""; parent = byID[parent].Parent {
+			d++
+		}
+		depth[layer.ID] = d
+	}
+	slices.SortStableFunc(res.Layers, func(a, b string) int {
+		return depth[b] - depth[a]
+	})
+	return res, nil
+}
+
+// RemoveIncomplete removes the images and layers found by FindIncomplete(store, cutoff), and returns them;
+// removing an image also removes layers used only by that image.
+// Items which started being used in the meantime are not removed, and not included in the result.
+func RemoveIncomplete(store storage.Store, cutoff time.Time) (*Incomplete, error) {
+	incomplete, err := FindIncomplete(store, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	res := &Incomplete{
+		Images: []string{},
+		Layers: []string{},
+	}
+	for _, id := range incomplete.Images {
+		// This also removes layers used only by the image.
+		layers, err := store.DeleteImage(id, true)
+		if err != nil {
+			if errors.Is(err, storage.ErrImageUnknown) || errors.Is(err, storage.ErrImageUsedByContainer) {
+				logrus.Debugf("Not removing incomplete image %q: %v", id, err)
+				continue
+			}
+			return res, fmt.Errorf("removing incomplete image %q: %w", id, err)
+		}
+		res.Images = append(res.Images, id)
+		res.Layers = append(res.Layers, layers...)
+	}
+	if len(res.Images) != len(incomplete.Images) {
+		// Some images were kept, so some of their layers may have to be kept as well.
+		incomplete, err = FindIncomplete(store, cutoff)
+		if err != nil {
+			return res, err
+		}
+	}
+	for _, id := range incomplete.Layers {
+		if err := store.DeleteLayer(id); err != nil {
+			if errors.Is(err, storage.ErrLayerUnknown) || errors.Is(err, storage.ErrNotALayer) || errors.Is(err, storage.ErrLayerHasChildren) ||
+				errors.Is(err, storage.ErrLayerUsedByImage) || errors.Is(err, storage.ErrLayerUsedByContainer) {
+				logrus.Debugf("Not removing incomplete layer %q: %v", id, err)
+				continue
+			}
+			return res, fmt.Errorf("removing incomplete layer %q: %w", id, err)
+		}
+		res.Layers = append(res.Layers, id)
+	}
+	return res, nil
+}
@@ -0,0 +1,89 @@
+//go:build !containers_image_storage_stub
+// +build !containers_image_storage_stub
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/storage/pkg/archive"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncomplete(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	store := newStore(t)
+	cache := memory.New()
+
+	layer1 := makeLayer(t, archive.Gzip)
+	layer2 := makeLayer(t, archive.Gzip)
+	configBytes := []byte(`{"config":{"labels":{}},"created":"2006-01-02T15:04:05Z"}`)
+	config := testBlob{
+		compressedDigest: digest.SHA256.FromBytes(configBytes),
+		uncompressedSize: int64(len(configBytes)),
+		compressedSize:   int64(len(configBytes)),
+		data:             configBytes,
+	}
+
+	ref, err := Transport.ParseReference("test")
+	require.NoError(t, err)
+	createImage(t, ref, cache, []testBlob{layer1}, &config)
+	img, err := Transport.GetStoreImage(store, ref)
+	require.NoError(t, err)
+
+	// A committed image is not incomplete.
+	incomplete, err := FindIncomplete(store, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, &Incomplete{Images: []string{}, Layers: []string{}}, incomplete)
+
+	// Simulate a copy which failed after applying a layer.
+	idRef, err := Transport.ParseReference("@" + img.ID)
+	require.NoError(t, err)
+	dest, unparsedToplevel := createUncommittedImageDest(t, idRef, cache, []testBlob{layer1, layer2}, &config)
+	err = dest.Commit(context.Background(), unparsedToplevel)
+	require.Error(t, err)
+	err = dest.Close()
+	require.NoError(t, err)
+	layers, err := store.Layers()
+	require.NoError(t, err)
+	require.Len(t, layers, 2)
+	danglingLayer := layers[0].ID
+	if danglingLayer == img.TopLayer {
+		danglingLayer = layers[1].ID
+	}
+
+	incomplete, err = FindIncomplete(store, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, &Incomplete{Images: []string{}, Layers: []string{danglingLayer}}, incomplete)
+	// Recently created items are not reported.
+	incomplete, err = FindIncomplete(store, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, &Incomplete{Images: []string{}, Layers: []string{}}, incomplete)
+
+	// Simulate a copy which crashed after creating an image.
+	incompleteImg, err := store.CreateImage("", nil, danglingLayer, fmt.Sprintf(`{"incomplete-since":%q}`, createdFlagValue()), nil)
+	require.NoError(t, err)
+	incomplete, err = FindIncomplete(store, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, &Incomplete{Images: []string{incompleteImg.ID}, Layers: []string{danglingLayer}}, incomplete)
+
+	removed, err := RemoveIncomplete(store, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, &Incomplete{Images: []string{incompleteImg.ID}, Layers: []string{danglingLayer}}, removed)
+	layers, err = store.Layers()
+	require.NoError(t, err)
+	require.Len(t, layers, 1)
+	assert.Equal(t, img.TopLayer, layers[0].ID)
+	_, err = store.Image(img.ID)
+	assert.NoError(t, err)
+	incomplete, err = FindIncomplete(store, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, &Incomplete{Images: []string{}, Layers: []string{}}, incomplete)
+}
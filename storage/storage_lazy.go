@@ -0,0 +1,341 @@
+//go:build !containers_image_storage_stub
+// +build !containers_image_storage_stub
+
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	"github.com/containers/storage"
+	"github.com/containers/storage/pkg/lockfile"
+	digest "github.com/opencontainers/go-digest"
+)
+
+// LazyLayersFlag is set on images written using types.SystemContext.ContainersStorageLazyLayers.
+// Such images have no layers until ApplyLazyLayers is called, so they must not be used to create containers.
+const LazyLayersFlag = "containers-image-lazy-layers"
+
+// lazyLayersDir returns the directory where layer blobs of images with lazy layers are stored for store.
+// The blobs are shared by all images with lazy layers.
+func lazyLayersDir(store storage.Store) string {
+	return filepath.Join(store.GraphRoot(), "lazy-layers")
+}
+
+// lazyLayerPath returns the path of a lazy layer blob with digest d in store.
+func lazyLayerPath(store storage.Store, d digest.Digest) string {
+	return filepath.Join(lazyLayersDir(store), d.Algorithm().String(), d.Encoded())
+}
+
+// lockLazyLayers locks the lazy layer blobs in store against concurrent modification, and returns the locked lock.
+func lockLazyLayers(store storage.Store) (*lockfile.LockFile, error) {
+	dir := lazyLayersDir(store)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	lock, err := lockfile.GetLockFile(filepath.Join(dir, "lock"))
+	if err != nil {
+		return nil, fmt.Errorf("creating lock for lazy layer blobs: %w", err)
+	}
+	lock.Lock()
+	return lock, nil
+}
+
+// storeLazyLayer makes the layer blob with digest d, which was written to filename, a lazy layer blob in store.
+// If the blob is already stored, filename is not used, and may be "".
+// The caller must hold the lock returned by lockLazyLayers.
+func storeLazyLayer(store storage.Store, d digest.Digest, filename string) error {
+	path := lazyLayerPath(store, d)
+	if _, err := os.Lstat(path); err == nil {
+		return nil
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if filename == "" {
+		return fmt.Errorf("lazy layer blob %q is not available", d)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if err := os.Link(filename, path); err == nil {
+		return nil
+	}
+	// The file is probably on a different filesystem; copy it instead.
+	src, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+	if _, err := io.Copy(tmp, src); err != nil {
+		return fmt.Errorf("storing lazy layer blob %q: %w", d, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("storing lazy layer blob %q: %w", d, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("storing lazy layer blob %q: %w", d, err)
+	}
+	succeeded = true
+	return nil
+}
+
+// lazyImageSource returns an image source for ref, which must be a reference of this transport.
+func lazyImageSource(sys *types.SystemContext, ref types.ImageReference) (*storageImageSource, error) {
+	sref, ok := ref.(*storageReference)
+	if !ok {
+		return nil, fmt.Errorf("trying to use a non-%s: reference %q", Transport.Name(), transports.ImageName(ref))
+	}
+	return newImageSource(sys, *sref)
+}
+
+// LazyLayers returns the layers of an image written using types.SystemContext.ContainersStorageLazyLayers which have not been
+// applied yet, starting from the base layer; it returns an empty slice if the image's layers have been applied.
+//
+// The layer blobs can be read using the image's ImageSource, which allows callers which can mount layers directly
+// (e.g. using composefs) to use the image without applying its layers.  The blobs are stored once for all images
+// with lazy layers, and are not removed with the images; see RemoveUnusedLazyLayers.
+func LazyLayers(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) ([]types.BlobInfo, error) {
+	src, err := lazyImageSource(sys, ref)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	if len(src.LazyLayers) == 0 {
+		return []types.BlobInfo{}, nil
+	}
+	manifestBlob, manifestType, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	man, err := manifest.FromBlob(manifestBlob, manifestType)
+	if err != nil {
+		return nil, fmt.Errorf("parsing image manifest for %q: %w", src.image.ID, err)
+	}
+	res := []types.BlobInfo{}
+	for _, layer := range man.LayerInfos() {
+		res = append(res, layer.BlobInfo)
+	}
+	return res, nil
+}
+
+// ApplyLazyLayers applies the layers of an image written using types.SystemContext.ContainersStorageLazyLayers,
+// so that it can be used like any other image; it does nothing if the image's layers have already been applied.
+//
+// The layers are applied to a new image, with a different ID, which gets the manifests and signatures of the original image.
+// Only then are the names of the original image moved to the new image, and the original image removed;
+// so if applying the layers fails, the original image is left unmodified.
+func ApplyLazyLayers(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) (retErr error) {
+	src, err := lazyImageSource(sys, ref)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if len(src.LazyLayers) == 0 {
+		return nil
+	}
+	img := src.image
+	store := src.imageRef.transport.store
+	manifestBlob, manifestType, err := src.GetManifest(ctx, nil)
+	if err != nil {
+		return err
+	}
+	man, err := manifest.FromBlob(manifestBlob, manifestType)
+	if err != nil {
+		return fmt.Errorf("parsing image manifest for %q: %w", img.ID, err)
+	}
+
+	// Write the same image again, to a new image, using a destination which applies the layers.
+	destSys := types.SystemContext{}
+	if sys != nil {
+		destSys = *sys
+	}
+	destSys.ContainersStorageLazyLayers = false
+	destRef := src.imageRef
+	destRef.named = nil
+	destRef.id = ""
+	dest, err := newImageDestination(&destSys, destRef)
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if retErr != nil && !committed {
+			if err := dest.Rollback(ctx); err != nil {
+				logging.For(sys).Debugf("Error rolling back applied layers of image %q: %v", img.ID, err)
+			}
+		}
+		if err := dest.Close(); err != nil && retErr == nil {
+			retErr = err
+		}
+	}()
+	if err := putBlobFromSource(ctx, src, dest, man.ConfigInfo(), private.PutBlobOptions{Cache: none.NoCache, IsConfig: true}); err != nil {
+		return err
+	}
+	// Layers are applied as they are written.
+	for i, layer := range man.LayerInfos() {
+		index := i
+		if err := putBlobFromSource(ctx, src, dest, layer.BlobInfo, private.PutBlobOptions{
+			Cache:      none.NoCache,
+			EmptyLayer: layer.EmptyLayer,
+			LayerIndex: &index,
+		}); err != nil {
+			return err
+		}
+	}
+	if err := dest.PutManifest(ctx, manifestBlob, nil); err != nil {
+		return err
+	}
+	dest.SignatureSizes = src.SignatureSizes
+	dest.SignaturesSizes = src.SignaturesSizes
+	if err := dest.Commit(ctx, image.UnparsedInstance(src, nil)); err != nil {
+		return fmt.Errorf("creating image with applied layers of %q: %w", img.ID, err)
+	}
+	committed = true
+	appliedID := dest.committedImageID
+
+	// Copy the data items of the image which the destination does not write (e.g. the top-level manifest and signatures).
+	keys, err := store.ListImageBigData(img.ID)
+	if err != nil {
+		return fmt.Errorf("listing data items of image %q: %w", img.ID, err)
+	}
+	existingKeys, err := store.ListImageBigData(appliedID)
+	if err != nil {
+		return fmt.Errorf("listing data items of image %q: %w", appliedID, err)
+	}
+	existing := set.NewWithValues(existingKeys...)
+	for _, key := range keys {
+		if existing.Contains(key) {
+			continue
+		}
+		data, err := store.ImageBigData(img.ID, key)
+		if err != nil {
+			return fmt.Errorf("reading data item %q of image %q: %w", key, img.ID, err)
+		}
+		if err := store.SetImageBigData(appliedID, key, data, manifest.Digest); err != nil {
+			return fmt.Errorf("saving data item %q of image %q: %w", key, appliedID, err)
+		}
+	}
+
+	// Moving the names is atomic; until then, the original image is still used.
+	if len(img.Names) > 0 {
+		if err := store.AddNames(appliedID, img.Names); err != nil {
+			return fmt.Errorf("moving names %v from image %q to image %q: %w", img.Names, img.ID, appliedID, err)
+		}
+	}
+	if _, err := store.DeleteImage(img.ID, true); err != nil {
+		return fmt.Errorf("removing image %q, replaced by image %q with applied layers: %w", img.ID, appliedID, err)
+	}
+	if _, err := RemoveUnusedLazyLayers(store); err != nil {
+		logging.For(sys).Debugf("Error removing unused lazy layer blobs: %v", err)
+	}
+	return nil
+}
+
+// imageLazyLayers returns the lazy layer blobs used by img.
+func imageLazyLayers(img *storage.Image) []digest.Digest {
+	if img.Flags[LazyLayersFlag] != true || img.Metadata == "" {
+		return nil
+	}
+	var metadata struct {
+		LazyLayers []digest.Digest `json:"lazy-layers,omitempty"`
+	}
+	if err := json.Unmarshal([]byte(img.Metadata), &metadata); err != nil {
+		return nil
+	}
+	return metadata.LazyLayers
+}
+
+// RemoveUnusedLazyLayers removes the lazy layer blobs in store which are not used by any image written using
+// types.SystemContext.ContainersStorageLazyLayers, e.g. after such images were removed, and returns their digests.
+func RemoveUnusedLazyLayers(store storage.Store) ([]digest.Digest, error) {
+	lock, err := lockLazyLayers(store)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Unlock()
+
+	images, err := store.Images()
+	if err != nil {
+		return nil, fmt.Errorf("listing images: %w", err)
+	}
+	inUse := set.New[digest.Digest]()
+	for _, img := range images {
+		for _, d := range imageLazyLayers(&img) {
+			inUse.Add(d)
+		}
+	}
+
+	res := []digest.Digest{}
+	dir := lazyLayersDir(store)
+	algorithms, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, algorithm := range algorithms {
+		if !algorithm.IsDir() {
+			continue // The lock
+		}
+		entries, err := os.ReadDir(filepath.Join(dir, algorithm.Name()))
+		if err != nil {
+			return res, err
+		}
+		for _, entry := range entries {
+			path := filepath.Join(dir, algorithm.Name(), entry.Name())
+			if strings.HasPrefix(entry.Name(), ".tmp-") {
+				// A left-over from an interrupted storeLazyLayer; they only exist while the lock is held.
+				if err := os.Remove(path); err != nil {
+					return res, err
+				}
+				continue
+			}
+			d := digest.NewDigestFromEncoded(digest.Algorithm(algorithm.Name()), entry.Name())
+			if inUse.Contains(d) {
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				return res, fmt.Errorf("removing lazy layer blob %q: %w", d, err)
+			}
+			res = append(res, d)
+		}
+	}
+	return res, nil
+}
+
+// putBlobFromSource writes the blob described by info from src to dest.
+func putBlobFromSource(ctx context.Context, src *storageImageSource, dest *storageImageDestination, info types.BlobInfo, options private.PutBlobOptions) error {
+	stream, size, err := src.GetBlob(ctx, info, none.NoCache)
+	if err != nil {
+		return fmt.Errorf("reading blob %q: %w", info.Digest, err)
+	}
+	defer stream.Close()
+	if _, err := dest.PutBlobWithOptions(ctx, stream, types.BlobInfo{Digest: info.Digest, Size: size}, options); err != nil {
+		return fmt.Errorf("writing blob %q: %w", info.Digest, err)
+	}
+	return nil
+}
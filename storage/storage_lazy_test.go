@@ -0,0 +1,145 @@
+//go:build !containers_image_storage_stub
+// +build !containers_image_storage_stub
+
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/blobinfocache/memory"
+	"github.com/containers/image/v5/types"
+	"github.com/containers/storage"
+	"github.com/containers/storage/pkg/archive"
+	"github.com/opencontainers/go-digest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLazyLayers(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	store := newStore(t)
+	cache := memory.New()
+	ctx := context.Background()
+
+	layer1 := makeLayer(t, archive.Gzip)
+	layer2 := makeLayer(t, archive.Gzip)
+	writeLazyImage := func(name string, configBytes []byte) types.ImageReference {
+		config := testBlob{
+			compressedDigest: digest.SHA256.FromBytes(configBytes),
+			uncompressedSize: int64(len(configBytes)),
+			compressedSize:   int64(len(configBytes)),
+			data:             configBytes,
+		}
+		ref, err := Transport.ParseReference(name)
+		require.NoError(t, err)
+		dest, err := ref.NewImageDestination(ctx, &types.SystemContext{ContainersStorageLazyLayers: true})
+		require.NoError(t, err)
+		defer dest.Close()
+		layerDescriptors := []manifest.Schema2Descriptor{
+			layer1.storeBlob(t, dest, cache, manifest.DockerV2Schema2LayerMediaType),
+			layer2.storeBlob(t, dest, cache, manifest.DockerV2Schema2LayerMediaType),
+		}
+		configDescriptor := config.storeBlob(t, dest, cache, manifest.DockerV2Schema2ConfigMediaType)
+		man := manifest.Schema2FromComponents(configDescriptor, layerDescriptors)
+		manifestBytes, err := man.Serialize()
+		require.NoError(t, err)
+		err = dest.PutManifest(ctx, manifestBytes, nil)
+		require.NoError(t, err)
+		err = dest.Commit(ctx, &unparsedImage{manifestBytes: manifestBytes, manifestType: man.MediaType})
+		require.NoError(t, err)
+		return ref
+	}
+	ref := writeLazyImage("test", []byte(`{"config":{"labels":{}},"created":"2006-01-02T15:04:05Z"}`))
+	otherRef := writeLazyImage("other", []byte(`{"config":{"labels":{}},"created":"2007-01-02T15:04:05Z"}`))
+
+	// No layers were applied, but the layer blobs can be read; they are stored once for both images.
+	layers, err := store.Layers()
+	require.NoError(t, err)
+	assert.Empty(t, layers)
+	lazy, err := LazyLayers(ctx, nil, ref)
+	require.NoError(t, err)
+	assert.Equal(t, []types.BlobInfo{
+		{Digest: layer1.compressedDigest, Size: layer1.compressedSize, MediaType: manifest.DockerV2Schema2LayerMediaType},
+		{Digest: layer2.compressedDigest, Size: layer2.compressedSize, MediaType: manifest.DockerV2Schema2LayerMediaType},
+	}, lazy)
+	src, err := ref.NewImageSource(ctx, nil)
+	require.NoError(t, err)
+	defer src.Close()
+	rc, _, err := src.GetBlob(ctx, lazy[1], cache)
+	require.NoError(t, err)
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	require.NoError(t, err)
+	assert.Equal(t, layer2.data, data)
+	blobs, err := os.ReadDir(filepath.Join(lazyLayersDir(store), "sha256"))
+	require.NoError(t, err)
+	assert.Len(t, blobs, 2)
+	lazyImg, err := Transport.GetStoreImage(store, ref)
+	require.NoError(t, err)
+	assert.Equal(t, "", lazyImg.TopLayer)
+	assert.Equal(t, true, lazyImg.Flags[LazyLayersFlag])
+	bigData, err := store.ListImageBigData(lazyImg.ID)
+	require.NoError(t, err)
+	assert.NotContains(t, bigData, layer1.compressedDigest.String())
+	assert.NotContains(t, bigData, layer2.compressedDigest.String())
+
+	// If applying the layers fails, the image is not modified.
+	blob2Path := lazyLayerPath(store, layer2.compressedDigest)
+	err = os.Rename(blob2Path, blob2Path+".moved")
+	require.NoError(t, err)
+	err = ApplyLazyLayers(ctx, nil, ref)
+	assert.Error(t, err)
+	err = os.Rename(blob2Path+".moved", blob2Path)
+	require.NoError(t, err)
+	layers, err = store.Layers()
+	require.NoError(t, err)
+	assert.Empty(t, layers)
+	img, err := Transport.GetStoreImage(store, ref)
+	require.NoError(t, err)
+	assert.Equal(t, lazyImg.ID, img.ID)
+	assert.Equal(t, lazyImg.Names, img.Names)
+
+	// Applying the layers moves the names to a new image, and removes the original image.
+	err = ApplyLazyLayers(ctx, nil, ref)
+	require.NoError(t, err)
+	layers, err = store.Layers()
+	require.NoError(t, err)
+	assert.Len(t, layers, 2)
+	lazy, err = LazyLayers(ctx, nil, ref)
+	require.NoError(t, err)
+	assert.Empty(t, lazy)
+	img, err = Transport.GetStoreImage(store, ref)
+	require.NoError(t, err)
+	assert.NotEqual(t, lazyImg.ID, img.ID)
+	assert.Equal(t, lazyImg.Names, img.Names)
+	assert.NotEqual(t, "", img.TopLayer)
+	assert.Nil(t, img.Flags[LazyLayersFlag])
+	_, err = store.Image(lazyImg.ID)
+	assert.ErrorIs(t, err, storage.ErrImageUnknown)
+	// The blobs are still used by the other image.
+	blobs, err = os.ReadDir(filepath.Join(lazyLayersDir(store), "sha256"))
+	require.NoError(t, err)
+	assert.Len(t, blobs, 2)
+
+	// Applying the layers again does nothing.
+	err = ApplyLazyLayers(ctx, nil, ref)
+	require.NoError(t, err)
+
+	// Blobs are removed when no image uses them.
+	otherImg, err := Transport.GetStoreImage(store, otherRef)
+	require.NoError(t, err)
+	_, err = store.DeleteImage(otherImg.ID, true)
+	require.NoError(t, err)
+	removed, err := RemoveUnusedLazyLayers(store)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []digest.Digest{layer1.compressedDigest, layer2.compressedDigest}, removed)
+	blobs, err = os.ReadDir(filepath.Join(lazyLayersDir(store), "sha256"))
+	require.NoError(t, err)
+	assert.Empty(t, blobs)
+}
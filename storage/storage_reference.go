@@ -5,16 +5,20 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/errclass"
 	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/logging"
 	"github.com/containers/image/v5/transports"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage"
 	digest "github.com/opencontainers/go-digest"
-	"github.com/sirupsen/logrus"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"golang.org/x/exp/slices"
 )
 
@@ -146,8 +150,8 @@ func (s *storageReference) resolveImage(sys *types.SystemContext) (*storage.Imag
 		}
 	}
 	if s.id == "" {
-		logrus.Debugf("reference %q does not resolve to an image ID", s.StringWithinTransport())
-		return nil, fmt.Errorf("reference %q does not resolve to an image ID: %w", s.StringWithinTransport(), ErrNoSuchImage)
+		logging.For(sys).Debugf("reference %q does not resolve to an image ID", s.StringWithinTransport())
+		return nil, errclass.Wrap(fmt.Errorf("reference %q does not resolve to an image ID: %w", s.StringWithinTransport(), ErrNoSuchImage), types.ErrNotFound)
 	}
 	if loadedImage == nil {
 		img, err := s.transport.store.Image(s.id)
@@ -158,8 +162,8 @@ func (s *storageReference) resolveImage(sys *types.SystemContext) (*storage.Imag
 	}
 	if s.named != nil {
 		if !imageMatchesRepo(loadedImage, s.named) {
-			logrus.Errorf("no image matching reference %q found", s.StringWithinTransport())
-			return nil, ErrNoSuchImage
+			logging.For(sys).Errorf("no image matching reference %q found", s.StringWithinTransport())
+			return nil, errclass.Wrap(ErrNoSuchImage, types.ErrNotFound)
 		}
 	}
 	// Default to having the image digest that we hand back match the most recently
@@ -264,6 +268,32 @@ func (s storageReference) NewImage(ctx context.Context, sys *types.SystemContext
 	return newImage(ctx, sys, s)
 }
 
+// ListTags returns the tags of images in the store which are in the same repository as the reference.
+// This implements transports.TagLister.
+func (s storageReference) ListTags(ctx context.Context, sys *types.SystemContext) ([]string, error) {
+	if s.named == nil {
+		return nil, fmt.Errorf("listing tags of %s: the reference does not specify a repository", s.StringWithinTransport())
+	}
+	images, err := s.transport.store.Images()
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, image := range images {
+		for _, name := range image.Names {
+			named, err := reference.ParseNormalizedNamed(name)
+			if err != nil {
+				continue
+			}
+			if tagged, ok := named.(reference.NamedTagged); ok && tagged.Name() == s.named.Name() && !slices.Contains(res, tagged.Tag()) {
+				res = append(res, tagged.Tag())
+			}
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
 func (s storageReference) DeleteImage(ctx context.Context, sys *types.SystemContext) error {
 	img, err := s.resolveImage(sys)
 	if err != nil {
@@ -271,14 +301,44 @@ func (s storageReference) DeleteImage(ctx context.Context, sys *types.SystemCont
 	}
 	layers, err := s.transport.store.DeleteImage(img.ID, true)
 	if err == nil {
-		logrus.Debugf("deleted image %q", img.ID)
+		logging.For(sys).Debugf("deleted image %q", img.ID)
 		for _, layer := range layers {
-			logrus.Debugf("deleted layer %q", layer)
+			logging.For(sys).Debugf("deleted layer %q", layer)
 		}
 	}
 	return err
 }
 
+// SupportsDeleteImage returns true, DeleteImage is implemented.
+// This implements transports.DeletionSupportReporter.
+func (s storageReference) SupportsDeleteImage() bool {
+	return true
+}
+
+// ImageExists returns true if the reference resolves to an image in the store.
+// The returned descriptor, if any, does not include a MediaType.
+// This implements transports.ExistenceChecker.
+func (s storageReference) ImageExists(ctx context.Context, sys *types.SystemContext) (bool, *imgspecv1.Descriptor, error) {
+	img, err := s.resolveImage(sys)
+	if err != nil {
+		if errors.Is(err, ErrNoSuchImage) || errors.Is(err, storage.ErrImageUnknown) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+	if img.Digest == "" {
+		return true, nil, nil
+	}
+	size, err := s.transport.store.ImageBigDataSize(img.ID, manifestBigDataKey(img.Digest))
+	if err != nil && img.BigDataDigests[storage.ImageDigestBigDataKey] == img.Digest {
+		size, err = s.transport.store.ImageBigDataSize(img.ID, storage.ImageDigestBigDataKey)
+	}
+	if err != nil {
+		return true, nil, nil
+	}
+	return true, &imgspecv1.Descriptor{Digest: img.Digest, Size: size}, nil
+}
+
 func (s storageReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
 	return newImageSource(sys, s)
 }
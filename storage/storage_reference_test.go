@@ -4,6 +4,7 @@
 package storage
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"testing"
@@ -151,6 +152,78 @@ func TestStorageReferencePolicyConfigurationNamespaces(t *testing.T) {
 
 // NewImage, NewImageSource, NewImageDestination, DeleteImage tested in storage_test.go
 
+func TestStorageReferenceListTags(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	store := newStore(t)
+	cache := memory.New()
+
+	id := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	ref, err := Transport.ParseStoreReference(store, "test:b@"+id)
+	require.NoError(t, err)
+	createImage(t, ref, cache, []testBlob{makeLayer(t, archive.Gzip)}, nil)
+	err = store.AddNames(id, []string{"docker.io/library/test:a", "docker.io/library/other:c"})
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		input    string
+		expected []string // nil on error
+	}{
+		{"test", []string{"a", "b"}},
+		{"test:b", []string{"a", "b"}},
+		{"other:latest", []string{"c"}},
+		{"nottest", []string{}},
+		{"@" + id, nil},
+	} {
+		ref, err := Transport.ParseStoreReference(store, c.input)
+		require.NoError(t, err, c.input)
+		tags, err := ref.ListTags(context.Background(), nil)
+		if c.expected == nil {
+			assert.Error(t, err, c.input)
+		} else {
+			require.NoError(t, err, c.input)
+			assert.Equal(t, c.expected, tags, c.input)
+		}
+	}
+}
+
+func TestStorageReferenceImageExists(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	store := newStore(t)
+	cache := memory.New()
+
+	id := "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"
+	ref, err := Transport.ParseStoreReference(store, "test:b@"+id)
+	require.NoError(t, err)
+	createImage(t, ref, cache, []testBlob{makeLayer(t, archive.Gzip)}, nil)
+	img, err := store.Image(id)
+	require.NoError(t, err)
+
+	for _, c := range []struct {
+		input  string
+		exists bool
+	}{
+		{"test:b", true},
+		{"@" + id, true},
+		{"test:other", false},
+		{"@" + strings.Repeat("b", 64), false},
+	} {
+		ref, err := Transport.ParseStoreReference(store, c.input)
+		require.NoError(t, err, c.input)
+		exists, desc, err := ref.ImageExists(context.Background(), nil)
+		require.NoError(t, err, c.input)
+		assert.Equal(t, c.exists, exists, c.input)
+		if c.exists {
+			require.NotNil(t, desc, c.input)
+			assert.Equal(t, img.Digest, desc.Digest, c.input)
+			assert.NotZero(t, desc.Size, c.input)
+		} else {
+			assert.Nil(t, desc, c.input)
+		}
+	}
+}
+
 func TestResolveReference(t *testing.T) {
 	// This is, so far, only a minimal smoke test
 
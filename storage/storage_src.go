@@ -14,19 +14,21 @@ import (
 	"sync"
 
 	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/errclass"
 	"github.com/containers/image/v5/internal/image"
 	"github.com/containers/image/v5/internal/imagesource/impl"
 	"github.com/containers/image/v5/internal/imagesource/stubs"
 	"github.com/containers/image/v5/internal/signature"
 	"github.com/containers/image/v5/internal/tmpdir"
 	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/logging"
 	"github.com/containers/image/v5/types"
 	"github.com/containers/storage"
 	"github.com/containers/storage/pkg/archive"
 	"github.com/containers/storage/pkg/ioutils"
 	digest "github.com/opencontainers/go-digest"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
-	"github.com/sirupsen/logrus"
+	"golang.org/x/exp/slices"
 )
 
 // getBlobMutexProtected is a struct to hold the state of the getBlobMutex mutex.
@@ -45,6 +47,7 @@ type storageImageSource struct {
 	stubs.NoGetBlobAtInitialize
 
 	imageRef              storageReference
+	logger                types.Logger // Logger for messages about this source
 	image                 *storage.Image
 	systemContext         *types.SystemContext // SystemContext used in GetBlob() to create temporary files
 	cachedManifest        []byte               // A cached copy of the manifest, if already known, or nil
@@ -52,6 +55,7 @@ type storageImageSource struct {
 	getBlobMutexProtected getBlobMutexProtected
 	SignatureSizes        []int                   `json:"signature-sizes,omitempty"`  // List of sizes of each signature slice
 	SignaturesSizes       map[digest.Digest][]int `json:"signatures-sizes,omitempty"` // List of sizes of each signature slice
+	LazyLayers            []digest.Digest         `json:"lazy-layers,omitempty"`      // Layer blobs stored instead of being applied
 }
 
 const expectedLayerDiffIDFlag = "expected-layer-diffid"
@@ -72,6 +76,7 @@ func newImageSource(sys *types.SystemContext, imageRef storageReference) (*stora
 		NoGetBlobAtInitialize: stubs.NoGetBlobAt(imageRef),
 
 		imageRef:        imageRef,
+		logger:          logging.For(sys),
 		systemContext:   sys,
 		image:           img,
 		SignatureSizes:  []int{},
@@ -135,14 +140,33 @@ func (s *storageImageSource) GetBlob(ctx context.Context, info types.BlobInfo, c
 		layers, _ = s.imageRef.transport.store.LayersByUncompressedDigest(digest)
 	}
 
-	// If it's not a layer, then it must be a data item.
+	// If it's not a layer, then it must be a lazy layer blob, or a data item.
 	if len(layers) == 0 {
+		if slices.Contains(s.LazyLayers, digest) {
+			f, err := os.Open(lazyLayerPath(s.imageRef.transport.store, digest))
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					err = errclass.Wrap(err, types.ErrBlobUnknown)
+				}
+				return nil, 0, err
+			}
+			fi, err := f.Stat()
+			if err != nil {
+				f.Close()
+				return nil, 0, err
+			}
+			s.logger.Debugf("exporting lazy layer blob %q", digest.String())
+			return f, fi.Size(), nil
+		}
 		b, err := s.imageRef.transport.store.ImageBigData(s.image.ID, digest.String())
 		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				err = errclass.Wrap(err, types.ErrBlobUnknown)
+			}
 			return nil, 0, err
 		}
 		r := bytes.NewReader(b)
-		logrus.Debugf("exporting opaque data as blob %q", digest.String())
+		s.logger.Debugf("exporting opaque data as blob %q", digest.String())
 		return io.NopCloser(r), int64(r.Len()), nil
 	}
 
@@ -221,7 +245,7 @@ func (s *storageImageSource) getBlobAndLayerID(digest digest.Digest, layers []st
 	} else {
 		n = layer.UncompressedSize
 	}
-	logrus.Debugf("exporting filesystem layer %q without compression for blob %q", layer.ID, digest)
+	s.logger.Debugf("exporting filesystem layer %q without compression for blob %q", layer.ID, digest)
 	rc, err = s.imageRef.transport.store.Diff("", layer.ID, diffOptions)
 	if err != nil {
 		return nil, -1, "", err
@@ -281,6 +305,10 @@ func (s *storageImageSource) LayerInfosForCopy(ctx context.Context, instanceDige
 	if err != nil {
 		return nil, fmt.Errorf("parsing image manifest for %q: %w", s.image.ID, err)
 	}
+	if len(s.LazyLayers) > 0 {
+		// The original layer blobs are stored with the image, so the manifest describes them correctly.
+		return nil, nil
+	}
 
 	uncompressedLayerType := ""
 	switch manifestType {
@@ -20,6 +20,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/containers/image/v5/internal/blobinfocache"
 	imanifest "github.com/containers/image/v5/internal/manifest"
 	"github.com/containers/image/v5/internal/private"
 	"github.com/containers/image/v5/manifest"
@@ -37,12 +38,13 @@ import (
 )
 
 var (
-	_ types.ImageDestination   = &storageImageDestination{}
-	_ private.ImageDestination = (*storageImageDestination)(nil)
-	_ types.ImageSource        = &storageImageSource{}
-	_ private.ImageSource      = (*storageImageSource)(nil)
-	_ types.ImageReference     = &storageReference{}
-	_ types.ImageTransport     = &storageTransport{}
+	_ types.ImageDestination                     = &storageImageDestination{}
+	_ private.ImageDestination                   = (*storageImageDestination)(nil)
+	_ private.ImageDestinationWithCommitProgress = (*storageImageDestination)(nil)
+	_ types.ImageSource                          = &storageImageSource{}
+	_ private.ImageSource                        = (*storageImageSource)(nil)
+	_ types.ImageReference                       = &storageReference{}
+	_ types.ImageTransport                       = &storageTransport{}
 )
 
 const (
@@ -455,7 +457,8 @@ func TestWriteRead(t *testing.T) {
 		err = dest.Close()
 		require.NoError(t, err)
 
-		img, err := ref.NewImage(context.Background(), nil)
+		// Some of the manifests are schema1, which must be explicitly enabled to be parsed.
+		img, err := ref.NewImage(context.Background(), &types.SystemContext{DockerSchema1Mode: types.DockerSchema1ConvertOnly})
 		require.NoError(t, err)
 		imageConfigInfo := img.ConfigInfo()
 		if imageConfigInfo.Digest != "" {
@@ -704,6 +707,110 @@ func TestDuplicateBlob(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestTryReusingBlobByTOCDigest(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	newStore(t)
+	cache := memory.New()
+
+	ref, err := Transport.ParseReference("test")
+	require.NoError(t, err)
+
+	layer := makeLayer(t, archive.Gzip)
+	configBytes := []byte(`{"config":{"labels":{}},"created":"2006-01-02T15:04:05Z"}`)
+	config := testBlob{
+		compressedDigest: digest.SHA256.FromBytes(configBytes),
+		uncompressedSize: int64(len(configBytes)),
+		compressedSize:   int64(len(configBytes)),
+		data:             configBytes,
+	}
+	createImage(t, ref, cache, []testBlob{layer}, &config)
+
+	dest, err := ref.NewImageDestination(context.Background(), nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	privateDest, ok := dest.(private.ImageDestination)
+	require.True(t, ok)
+
+	// A blob with an unknown digest, and an unknown TOC digest, is not reused.
+	unknownDigest := digest.FromString("unknown blob")
+	unknownTOCDigest := digest.FromString("unknown TOC")
+	reused, _, err := privateDest.TryReusingBlobWithOptions(context.Background(), types.BlobInfo{Digest: unknownDigest, Size: -1},
+		private.TryReusingBlobOptions{Cache: blobinfocache.FromBlobInfoCache(cache), CanSubstitute: true, TOCDigest: &unknownTOCDigest})
+	require.NoError(t, err)
+	assert.False(t, reused)
+
+	// The layer was not stored by its TOC digest, so using its digest as a TOC digest does not match it.
+	reused, _, err = privateDest.TryReusingBlobWithOptions(context.Background(), types.BlobInfo{Digest: unknownDigest, Size: -1},
+		private.TryReusingBlobOptions{Cache: blobinfocache.FromBlobInfoCache(cache), CanSubstitute: true, TOCDigest: &layer.compressedDigest})
+	require.NoError(t, err)
+	assert.False(t, reused)
+
+	// Reusing by the compressed digest still works, and reports the requested blob.
+	reused, blob, err := privateDest.TryReusingBlobWithOptions(context.Background(), types.BlobInfo{Digest: layer.compressedDigest, Size: -1},
+		private.TryReusingBlobOptions{Cache: blobinfocache.FromBlobInfoCache(cache), CanSubstitute: true, TOCDigest: &unknownTOCDigest})
+	require.NoError(t, err)
+	assert.True(t, reused)
+	assert.Equal(t, private.ReusedBlob{Digest: layer.compressedDigest, Size: layer.compressedSize}, blob)
+}
+
+func TestRollback(t *testing.T) {
+	ensureTestCanCreateImages(t)
+
+	store := newStore(t)
+	cache := memory.New()
+
+	layer1 := makeLayer(t, archive.Gzip)
+	layer2 := makeLayer(t, archive.Gzip)
+	configBytes := []byte(`{"config":{"labels":{}},"created":"2006-01-02T15:04:05Z"}`)
+	config := testBlob{
+		compressedDigest: digest.SHA256.FromBytes(configBytes),
+		uncompressedSize: int64(len(configBytes)),
+		compressedSize:   int64(len(configBytes)),
+		data:             configBytes,
+	}
+
+	ref, err := Transport.ParseReference("test")
+	require.NoError(t, err)
+	createImage(t, ref, cache, []testBlob{layer1}, &config)
+	img, err := Transport.GetStoreImage(store, ref)
+	require.NoError(t, err)
+	layersBefore, err := store.Layers()
+	require.NoError(t, err)
+
+	// Writing a different image with the same ID fails in Commit, after layers are applied.
+	idRef, err := Transport.ParseReference("@" + img.ID)
+	require.NoError(t, err)
+	dest, unparsedToplevel := createUncommittedImageDest(t, idRef, cache, []testBlob{layer1, layer2}, &config)
+	defer dest.Close()
+	progressDest, ok := dest.(private.ImageDestinationWithCommitProgress)
+	require.True(t, ok)
+	progress := make(chan types.ProgressProperties, 10)
+	progressDest.SetCommitProgress(progress)
+	err = dest.Commit(context.Background(), unparsedToplevel)
+	require.Error(t, err)
+	layersAfterCommit, err := store.Layers()
+	require.NoError(t, err)
+	// layer1 is reused, only layer2 is applied.
+	assert.Len(t, layersAfterCommit, len(layersBefore)+1)
+
+	err = progressDest.Rollback(context.Background())
+	require.NoError(t, err)
+	layersAfterRollback, err := store.Layers()
+	require.NoError(t, err)
+	// The new layers were removed, the original image is intact.
+	assert.Len(t, layersAfterRollback, len(layersBefore))
+	_, err = store.Layer(img.TopLayer)
+	assert.NoError(t, err)
+
+	close(progress)
+	events := []types.ProgressEvent{}
+	for p := range progress {
+		events = append(events, p.Event)
+	}
+	assert.Equal(t, []types.ProgressEvent{types.ProgressEventApplying, types.ProgressEventApplied, types.ProgressEventRolledBack}, events)
+}
+
 type unparsedImage struct {
 	imageReference types.ImageReference
 	manifestBytes  []byte
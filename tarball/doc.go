@@ -1,6 +1,11 @@
 // Package tarball provides a way to generate images using one or more layer
 // tarballs and an optional template configuration.
 //
+// Layers may be uncompressed, or compressed using gzip or zstd.  References
+// also implement LayerUpdater, to set the media types and annotations of
+// individual layers, and ConfigMerger, to add environment variables and labels
+// to the configuration.
+//
 // An example:
 //
 //	package main
@@ -11,6 +11,7 @@ import (
 	"github.com/containers/image/v5/types"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"golang.org/x/exp/maps"
+	"golang.org/x/exp/slices"
 )
 
 // ConfigUpdater is an interface that ImageReferences for "tarball" images also
@@ -21,11 +22,33 @@ type ConfigUpdater interface {
 	ConfigUpdate(config imgspecv1.Image, annotations map[string]string) error
 }
 
+// LayerUpdater is an interface that ImageReferences for "tarball" images also
+// implement.  It can be used to set the media type and annotations of
+// individual layers, identified by the index of their file in the reference.
+type LayerUpdater interface {
+	LayerUpdate(index int, mediaType string, annotations map[string]string) error
+}
+
+// ConfigMerger is an interface that ImageReferences for "tarball" images also
+// implement.  It can be used to add environment variables and labels to the
+// configuration, without replacing the rest of it; ConfigUpdate, if used,
+// must be called first.
+type ConfigMerger interface {
+	ConfigMerge(env []string, labels map[string]string) error
+}
+
 type tarballReference struct {
 	config      imgspecv1.Image
 	annotations map[string]string
 	filenames   []string
 	stdin       []byte
+	layers      []tarballLayerOptions // nil, or one for each of filenames
+}
+
+// tarballLayerOptions are the options set for a single layer using LayerUpdate.
+type tarballLayerOptions struct {
+	mediaType   string // or "" to choose one based on the compression of the file
+	annotations map[string]string
 }
 
 // ConfigUpdate updates the image's default configuration and adds annotations
@@ -39,6 +62,51 @@ func (r *tarballReference) ConfigUpdate(config imgspecv1.Image, annotations map[
 	return nil
 }
 
+// LayerUpdate sets the media type, if not "", of the layer created from the
+// file at index in the reference, instead of one based on the compression of
+// the file, and adds annotations to its descriptor.
+func (r *tarballReference) LayerUpdate(index int, mediaType string, annotations map[string]string) error {
+	if index < 0 || index >= len(r.filenames) {
+		return fmt.Errorf("layer index %d out of range, the reference has %d files", index, len(r.filenames))
+	}
+	if r.layers == nil {
+		r.layers = make([]tarballLayerOptions, len(r.filenames))
+	}
+	layer := &r.layers[index]
+	if mediaType != "" {
+		layer.mediaType = mediaType
+	}
+	if layer.annotations == nil {
+		layer.annotations = make(map[string]string)
+	}
+	maps.Copy(layer.annotations, annotations)
+	return nil
+}
+
+// ConfigMerge adds env, in the "NAME=value" format, to the environment variables
+// of the image's configuration, replacing variables with the same name, and
+// adds labels to its labels.
+func (r *tarballReference) ConfigMerge(env []string, labels map[string]string) error {
+	for _, v := range env {
+		name, _, ok := strings.Cut(v, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("invalid environment variable %q, expected NAME=value", v)
+		}
+		r.config.Config.Env = slices.DeleteFunc(r.config.Config.Env, func(existing string) bool {
+			existingName, _, _ := strings.Cut(existing, "=")
+			return existingName == name
+		})
+		r.config.Config.Env = append(r.config.Config.Env, v)
+	}
+	if len(labels) > 0 {
+		if r.config.Config.Labels == nil {
+			r.config.Config.Labels = make(map[string]string)
+		}
+		maps.Copy(r.config.Config.Labels, labels)
+	}
+	return nil
+}
+
 func (r *tarballReference) Transport() types.ImageTransport {
 	return Transport
 }
@@ -51,6 +119,12 @@ func (r *tarballReference) DockerReference() reference.Named {
 	return nil
 }
 
+// MetadataRequiresLayerAccess returns true because all layer files are read, to compute their digests, when creating an ImageSource.
+// This implements private.MetadataAccessCostReporter.
+func (r *tarballReference) MetadataRequiresLayerAccess() bool {
+	return true
+}
+
 func (r *tarballReference) PolicyConfigurationIdentity() string {
 	return ""
 }
@@ -77,6 +151,12 @@ func (r *tarballReference) DeleteImage(ctx context.Context, sys *types.SystemCon
 	return nil
 }
 
+// SupportsDeleteImage returns true, DeleteImage is implemented.
+// This implements transports.DeletionSupportReporter.
+func (r *tarballReference) SupportsDeleteImage() bool {
+	return true
+}
+
 func (r *tarballReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
 	return nil, fmt.Errorf(`"tarball:" locations can only be read from, not written to`)
 }
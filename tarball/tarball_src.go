@@ -13,8 +13,9 @@ import (
 
 	"github.com/containers/image/v5/internal/imagesource/impl"
 	"github.com/containers/image/v5/internal/imagesource/stubs"
+	"github.com/containers/image/v5/pkg/compression"
+	compressiontypes "github.com/containers/image/v5/pkg/compression/types"
 	"github.com/containers/image/v5/types"
-	"github.com/klauspost/pgzip"
 	digest "github.com/opencontainers/go-digest"
 	imgspecs "github.com/opencontainers/image-spec/specs-go"
 	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
@@ -53,7 +54,7 @@ func (r *tarballReference) NewImageSource(ctx context.Context, sys *types.System
 	created := time.Time{}
 	history := []imgspecv1.History{}
 	layerDescriptors := []imgspecv1.Descriptor{}
-	for _, filename := range r.filenames {
+	for i, filename := range r.filenames {
 		var reader io.Reader
 		var blobTime time.Time
 		var blob tarballBlob
@@ -82,24 +83,44 @@ func (r *tarballReference) NewImageSource(ctx context.Context, sys *types.System
 			}
 		}
 
-		// Default to assuming the layer is compressed.
-		layerType := imgspecv1.MediaTypeImageLayerGzip
-
 		// Set up to digest the file as it is.
 		blobIDdigester := digest.Canonical.Digester()
 		reader = io.TeeReader(reader, blobIDdigester.Hash())
 
 		// Set up to digest the file after we maybe decompress it.
 		diffIDdigester := digest.Canonical.Digester()
-		uncompressed, err := pgzip.NewReader(reader)
-		if err == nil {
-			// It is compressed, so the diffID is the digest of the uncompressed version
-			reader = io.TeeReader(uncompressed, diffIDdigester.Hash())
-		} else {
+		algorithm, decompressor, reader, err := compression.DetectCompressionFormat(reader)
+		if err != nil {
+			return nil, fmt.Errorf("error reading %q: %w", filename, err)
+		}
+		var layerType string
+		var uncompressed io.ReadCloser
+		if decompressor == nil {
 			// It is not compressed, so the diffID and the blobID are going to be the same
 			diffIDdigester = blobIDdigester
 			layerType = imgspecv1.MediaTypeImageLayer
-			uncompressed = nil
+		} else {
+			switch algorithm.Name() {
+			case compressiontypes.GzipAlgorithmName:
+				layerType = imgspecv1.MediaTypeImageLayerGzip
+			case compressiontypes.ZstdAlgorithmName:
+				layerType = imgspecv1.MediaTypeImageLayerZstd
+			default:
+				return nil, fmt.Errorf("%q is compressed using %s, which is not supported in OCI images", filename, algorithm.Name())
+			}
+			// It is compressed, so the diffID is the digest of the uncompressed version
+			uncompressed, err = decompressor(reader)
+			if err != nil {
+				return nil, fmt.Errorf("error decompressing %q: %w", filename, err)
+			}
+			reader = io.TeeReader(uncompressed, diffIDdigester.Hash())
+		}
+		var layerOptions tarballLayerOptions
+		if r.layers != nil {
+			layerOptions = r.layers[i]
+		}
+		if layerOptions.mediaType != "" {
+			layerType = layerOptions.mediaType
 		}
 		// TODO: This can take quite some time, and should ideally be cancellable using ctx.Done().
 		if _, err := io.Copy(io.Discard, reader); err != nil {
@@ -126,9 +147,10 @@ func (r *tarballReference) NewImageSource(ctx context.Context, sys *types.System
 		}
 
 		layerDescriptors = append(layerDescriptors, imgspecv1.Descriptor{
-			Digest:    blobID,
-			Size:      blob.size,
-			MediaType: layerType,
+			Digest:      blobID,
+			Size:        blob.size,
+			MediaType:   layerType,
+			Annotations: maps.Clone(layerOptions.annotations),
 		})
 	}
 
@@ -1,5 +1,110 @@
 package tarball
 
-import "github.com/containers/image/v5/internal/private"
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/manifest"
+	"github.com/containers/image/v5/pkg/compression"
+	digest "github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
 
 var _ private.ImageSource = (*tarballImageSource)(nil)
+
+// writeLayerFile writes contents, compressed using algo if not nil, to a file in dir, and returns its path.
+func writeLayerFile(t *testing.T, dir, name string, contents []byte, algo *compression.Algorithm) string {
+	var buf bytes.Buffer
+	if algo == nil {
+		buf.Write(contents)
+	} else {
+		w, err := compression.CompressStream(&buf, *algo, nil)
+		require.NoError(t, err)
+		_, err = w.Write(contents)
+		require.NoError(t, err)
+		err = w.Close()
+		require.NoError(t, err)
+	}
+	path := filepath.Join(dir, name)
+	err := os.WriteFile(path, buf.Bytes(), 0o644)
+	require.NoError(t, err)
+	return path
+}
+
+func TestNewImageSourceLayers(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	contents := [][]byte{[]byte("plain layer"), []byte("gzip layer"), []byte("zstd layer")}
+	files := []string{
+		writeLayerFile(t, dir, "plain.tar", contents[0], nil),
+		writeLayerFile(t, dir, "gzip.tar.gz", contents[1], &compression.Gzip),
+		writeLayerFile(t, dir, "zstd.tar.zst", contents[2], &compression.Zstd),
+	}
+	ref, err := NewReference(files, nil)
+	require.NoError(t, err)
+
+	err = ref.(ConfigUpdater).ConfigUpdate(imgspecv1.Image{
+		Config: imgspecv1.ImageConfig{
+			Env:    []string{"A=1", "B=2"},
+			Labels: map[string]string{"a": "1"},
+		},
+	}, nil)
+	require.NoError(t, err)
+	merger, ok := ref.(ConfigMerger)
+	require.True(t, ok)
+	err = merger.ConfigMerge([]string{"B=3", "C=4"}, map[string]string{"b": "2"})
+	require.NoError(t, err)
+	err = merger.ConfigMerge([]string{"invalid"}, nil)
+	assert.Error(t, err)
+
+	updater, ok := ref.(LayerUpdater)
+	require.True(t, ok)
+	err = updater.LayerUpdate(0, "application/vnd.example.layer", map[string]string{"a": "1"})
+	require.NoError(t, err)
+	err = updater.LayerUpdate(2, "", map[string]string{"b": "2"})
+	require.NoError(t, err)
+	err = updater.LayerUpdate(3, "", nil)
+	assert.Error(t, err)
+
+	src, err := ref.NewImageSource(ctx, nil)
+	require.NoError(t, err)
+	defer src.Close()
+	manifestBytes, _, err := src.GetManifest(ctx, nil)
+	require.NoError(t, err)
+	var m imgspecv1.Manifest
+	err = json.Unmarshal(manifestBytes, &m)
+	require.NoError(t, err)
+	require.Len(t, m.Layers, 3)
+	for i, c := range []struct {
+		mediaType   string
+		annotations map[string]string
+	}{
+		{"application/vnd.example.layer", map[string]string{"a": "1"}},
+		{imgspecv1.MediaTypeImageLayerGzip, nil},
+		{imgspecv1.MediaTypeImageLayerZstd, map[string]string{"b": "2"}},
+	} {
+		assert.Equal(t, c.mediaType, m.Layers[i].MediaType, i)
+		assert.Equal(t, c.annotations, m.Layers[i].Annotations, i)
+	}
+
+	configReader, _, err := src.GetBlob(ctx, manifest.BlobInfoFromOCI1Descriptor(m.Config), nil)
+	require.NoError(t, err)
+	defer configReader.Close()
+	var config imgspecv1.Image
+	err = json.NewDecoder(configReader).Decode(&config)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"A=1", "B=3", "C=4"}, config.Config.Env)
+	assert.Equal(t, map[string]string{"a": "1", "b": "2"}, config.Config.Labels)
+	diffIDs := []digest.Digest{}
+	for _, c := range contents {
+		diffIDs = append(diffIDs, digest.FromBytes(c))
+	}
+	assert.Equal(t, diffIDs, config.RootFS.DiffIDs)
+}
@@ -1,10 +1,7 @@
 package alltransports
 
 import (
-	"fmt"
-	"strings"
-
-	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/transports/transportset"
 	"github.com/containers/image/v5/types"
 
 	// Register all known transports.
@@ -15,6 +12,9 @@ import (
 	_ "github.com/containers/image/v5/docker/archive"
 	_ "github.com/containers/image/v5/oci/archive"
 	_ "github.com/containers/image/v5/oci/layout"
+	_ "github.com/containers/image/v5/oci/ocihttp"
+	_ "github.com/containers/image/v5/oci/s3"
+	_ "github.com/containers/image/v5/oci/ssh"
 	_ "github.com/containers/image/v5/openshift"
 	_ "github.com/containers/image/v5/sif"
 	_ "github.com/containers/image/v5/tarball"
@@ -23,27 +23,31 @@ import (
 	// The storage transport is registered by storage*.go
 )
 
+// registeredTransports is used by ParseImageName and TransportFromImageName.
+var registeredTransports = func() *transportset.Set {
+	s, err := transportset.New(transportset.WithRegisteredTransports())
+	if err != nil {
+		panic(err) // Can't happen, these options never fail.
+	}
+	return s
+}()
+
 // ParseImageName converts a URL-like image name to a types.ImageReference.
+// Transports disabled using transports.Disable are refused.
+// Transport plugins are only used if they have been registered, see plugin.Register and plugin.Discover;
+// to look up plugins for all unknown transport names, use transportset.WithTransportPlugins.
+//
+// To use only some transports, without linking in the others, use the transportset package instead.
 func ParseImageName(imgName string) (types.ImageReference, error) {
-	// Keep this in sync with TransportFromImageName!
-	transportName, withinTransport, valid := strings.Cut(imgName, ":")
-	if !valid {
-		return nil, fmt.Errorf(`Invalid image name "%s", expected colon-separated transport:reference`, imgName)
-	}
-	transport := transports.Get(transportName)
-	if transport == nil {
-		return nil, fmt.Errorf(`Invalid image name "%s", unknown transport "%s"`, imgName, transportName)
-	}
-	return transport.ParseReference(withinTransport)
+	return registeredTransports.ParseImageName(imgName)
 }
 
 // TransportFromImageName converts an URL-like name to a types.ImageTransport or nil when
-// the transport is unknown or when the input is invalid.
+// the transport is unknown, disabled, or when the input is invalid.
 func TransportFromImageName(imageName string) types.ImageTransport {
-	// Keep this in sync with ParseImageName!
-	transportName, _, valid := strings.Cut(imageName, ":")
-	if valid {
-		return transports.Get(transportName)
+	transport, err := registeredTransports.TransportFromImageName(imageName)
+	if err != nil {
+		return nil // Can't happen, registeredTransports does not use transport plugins.
 	}
-	return nil
+	return transport
 }
@@ -1,6 +1,8 @@
 package alltransports
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/containers/image/v5/directory"
@@ -36,6 +38,9 @@ func TestImageNameHandling(t *testing.T) {
 		{"oci", "/etc:someimage:mytag", "/etc:someimage:mytag"},
 		{"oci-archive", "/etc:someimage", "/etc:someimage"},
 		{"oci-archive", "/etc:someimage:mytag", "/etc:someimage:mytag"},
+		{"ocihttp", "https://example.com/a:someimage", "https://example.com/a:someimage"},
+		{"s3", "//bucket/prefix:someimage", "//bucket/prefix:someimage"},
+		{"ssh", "oci://example.com/srv/layout:someimage", "oci://example.com/srv/layout:someimage"},
 		// "atomic" not tested here because it depends on per-user configuration for the default cluster.
 		// "containers-storage" not tested here because it needs to initialize various directories on the fs.
 	} {
@@ -61,3 +66,28 @@ func TestTransportFromImageName(t *testing.T) {
 	invalidName := TransportFromImageName("unknown")
 	assert.Equal(t, invalidName, nil)
 }
+
+func TestDisabledTransports(t *testing.T) {
+	transports.Disable("dir")
+	defer transports.Enable("dir")
+	_, err := ParseImageName("dir:/etc")
+	assert.Error(t, err)
+	assert.Nil(t, TransportFromImageName("dir:/etc"))
+
+	transports.Enable("dir")
+	_, err = ParseImageName("dir:/etc")
+	assert.NoError(t, err)
+}
+
+func TestTransportPluginsNotDiscovered(t *testing.T) {
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ran")
+	err := os.WriteFile(filepath.Join(dir, "test-plugin"), []byte("#!/bin/sh\ntouch "+marker+"\nexit 1\n"), 0o755)
+	require.NoError(t, err)
+	t.Setenv("CONTAINERS_IMAGE_TRANSPORT_PLUGINS_PATH", dir)
+
+	_, err = ParseImageName("test-plugin:ref")
+	assert.Error(t, err)
+	assert.Nil(t, TransportFromImageName("test-plugin:ref"))
+	assert.NoFileExists(t, marker)
+}
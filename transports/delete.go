@@ -0,0 +1,20 @@
+package transports
+
+import (
+	"github.com/containers/image/v5/types"
+)
+
+// DeletionSupportReporter is an optional interface of types.ImageReference, for transports which can report
+// whether types.ImageReference.DeleteImage is supported, before attempting it.
+type DeletionSupportReporter interface {
+	// SupportsDeleteImage returns true if DeleteImage is implemented for the reference.
+	// DeleteImage may still fail, e.g. if the image does not exist or the user is not authorized to delete it.
+	SupportsDeleteImage() bool
+}
+
+// SupportsDeleteImage returns true if ref is known to support DeleteImage, as reported by DeletionSupportReporter.
+// It returns false for transports which don't implement DeletionSupportReporter.
+func SupportsDeleteImage(ref types.ImageReference) bool {
+	reporter, ok := ref.(DeletionSupportReporter)
+	return ok && reporter.SupportsDeleteImage()
+}
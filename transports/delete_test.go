@@ -0,0 +1,23 @@
+package transports
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// deletionReportingReference is a testReference implementing DeletionSupportReporter.
+type deletionReportingReference struct {
+	testReference
+	supported bool
+}
+
+func (ref deletionReportingReference) SupportsDeleteImage() bool {
+	return ref.supported
+}
+
+func TestSupportsDeleteImage(t *testing.T) {
+	assert.False(t, SupportsDeleteImage(testReference{}))
+	assert.False(t, SupportsDeleteImage(deletionReportingReference{supported: false}))
+	assert.True(t, SupportsDeleteImage(deletionReportingReference{supported: true}))
+}
@@ -0,0 +1,18 @@
+package transports
+
+import (
+	"context"
+
+	"github.com/containers/image/v5/types"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ExistenceChecker is an optional interface of types.ImageReference, for transports which can check whether an image exists
+// more cheaply than by reading its manifest (e.g. using a HEAD request, or a lookup in an index).
+// Most callers should use c/image/image.Exists instead of calling this directly.
+type ExistenceChecker interface {
+	// ImageExists returns true if the image the reference refers to exists, and false if it does not.
+	// If the image exists, and the transport knows its manifest descriptor, it is also returned; otherwise the returned descriptor is nil.
+	// Fields of the descriptor which are not known (e.g. MediaType) are left empty.
+	ImageExists(ctx context.Context, sys *types.SystemContext) (bool, *imgspecv1.Descriptor, error)
+}
@@ -0,0 +1,315 @@
+// Package plugin implements transports provided by external executables (“transport plugins”),
+// so that transports can be added without modifying this library.
+//
+// A transport plugin is an executable, registered using Register, or found by Discover in the plugin directories
+// ($CONTAINERS_IMAGE_TRANSPORT_PLUGINS_PATH, a colon-separated list, or /usr/local/libexec/containers/image/transports
+// and /usr/libexec/containers/image/transports by default); the name of the executable is the name of the transport.
+// Executables in the plugin directories are only used by callers which opt in, using Discover or Lookup,
+// or transportset.WithTransportPlugins; alltransports.ParseImageName only uses plugins which have already been registered.
+//
+// Every operation runs the executable as
+//
+//	executable operation request
+//
+// with $CONTAINERS_IMAGE_TRANSPORT_PLUGIN_PROTOCOL set to the protocol version (currently "1").
+// request is a JSON object; data for the operation (a blob, a manifest, or signatures) is provided on standard input.
+// On success, the plugin exits with status 0 and writes a JSON object to standard output,
+// or the blob data for the get-blob operation.
+// On failure, the plugin exits with a non-zero status and writes an error message to standard error.
+//
+// All requests, except for parse-reference and validate-policy-scope, contain a "reference" field,
+// a value returned by parse-reference.  "session" fields contain the value returned by open-source or open-destination,
+// which may be "" if the plugin does not need it.  "instanceDigest" fields are omitted when not applicable.
+// []byte values (manifests and signatures) are base64-encoded, as usual for JSON.
+// The operations are:
+//
+//   - parse-reference {"reference"} → {"reference", "dockerReference", "policyIdentity", "policyNamespaces"}:
+//     Validates a reference, and returns its canonical form, the Docker reference it corresponds to (or ""),
+//     and its identity and namespaces for signature verification policy.
+//   - validate-policy-scope {"scope"} → {}: Fails if scope is not a valid policy scope for the transport.
+//   - delete-image {"reference"} → {}
+//   - open-source {"reference"} → {"session"}
+//   - get-manifest {"reference", "session", "instanceDigest"} → {"manifest", "mimeType"}
+//   - get-blob {"reference", "session", "digest", "size"} → the blob, on standard output.
+//     "size" is the expected size of the blob, or -1 if unknown.
+//   - get-signatures {"reference", "session", "instanceDigest"} → {"signatures"}
+//   - close-source {"reference", "session"} → {}
+//   - open-destination {"reference"} → {"session", "supportedManifestMIMETypes", "desiredLayerCompression"}:
+//     "supportedManifestMIMETypes" may be empty to accept all manifest types;
+//     "desiredLayerCompression" is one of "preserve" (the default), "compress", "decompress".
+//   - has-blob {"reference", "session", "digest"} → {"present", "size"}
+//   - put-blob {"reference", "session", "digest", "size"}, the blob on standard input → {"digest", "size"}:
+//     "digest" and "size" in the request may be "" and -1 if unknown; the plugin must fail if the blob does not match known values.
+//     The blob must not be stored if the plugin is killed before reading the blob to the end.
+//   - put-manifest {"reference", "session", "instanceDigest"}, the manifest on standard input → {}
+//   - put-signatures {"reference", "session", "instanceDigest"}, {"signatures"} on standard input → {}
+//   - commit {"reference", "session"} → {}
+//   - close-destination {"reference", "session"} → {}
+//
+// Plugins should ignore unknown fields in requests, and must fail on unknown operations.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+)
+
+const (
+	// protocolVersion is the version of the protocol implemented by this package.
+	protocolVersion = "1"
+	// protocolEnvVar is the environment variable used to pass protocolVersion to plugins.
+	protocolEnvVar = "CONTAINERS_IMAGE_TRANSPORT_PLUGIN_PROTOCOL"
+	// pluginPathEnvVar is the environment variable which, if set, overrides defaultPluginDirectories.
+	pluginPathEnvVar = "CONTAINERS_IMAGE_TRANSPORT_PLUGINS_PATH"
+	// maxErrorMessageSize is the maximum size of plugin error messages used in errors.
+	maxErrorMessageSize = 4096
+)
+
+// defaultPluginDirectories are the directories searched for plugins by Discover, in order, unless pluginPathEnvVar is set.
+var defaultPluginDirectories = []string{
+	"/usr/local/libexec/containers/image/transports",
+	"/usr/libexec/containers/image/transports",
+}
+
+// validTransportName matches transport names which can be provided by plugins.
+var validTransportName = regexp.MustCompile(`^[a-z0-9]+(?:[._-][a-z0-9]+)*$`)
+
+// registrationLock serializes registration of plugins, so that concurrent Discover calls don't register a transport twice.
+var registrationLock sync.Mutex
+
+// Register registers executable as a transport plugin for a transport with the specified name.
+func Register(name, executable string) error {
+	if !validTransportName.MatchString(name) {
+		return fmt.Errorf("invalid transport name %q", name)
+	}
+	registrationLock.Lock()
+	defer registrationLock.Unlock()
+	if transports.Get(name) != nil {
+		return fmt.Errorf("transport %q is already registered", name)
+	}
+	transports.Register(&pluginTransport{name: name, executable: executable})
+	return nil
+}
+
+// Discover returns the transport with the specified name, registering a transport plugin with that name
+// from the plugin directories if such a transport is not registered yet.
+// It returns (nil, nil) if there is no such transport.
+func Discover(name string) (types.ImageTransport, error) {
+	if t := transports.Get(name); t != nil {
+		return t, nil
+	}
+	return Lookup(name)
+}
+
+// Lookup returns the transport plugin with the specified name, registered using Register or found in the plugin directories
+// (and registered by this call).
+// It returns (nil, nil) if there is no such transport plugin, including when a transport with that name is not a plugin.
+func Lookup(name string) (types.ImageTransport, error) {
+	if !validTransportName.MatchString(name) {
+		return nil, nil
+	}
+	registrationLock.Lock()
+	defer registrationLock.Unlock()
+	if t := transports.Get(name); t != nil { // Possibly registered by a concurrent caller
+		if _, ok := t.(*pluginTransport); !ok {
+			return nil, nil
+		}
+		return t, nil
+	}
+	for _, dir := range pluginDirectories() {
+		executable := filepath.Join(dir, name)
+		fi, err := os.Stat(executable)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("looking for transport plugin %q: %w", name, err)
+		}
+		if !fi.Mode().IsRegular() || fi.Mode().Perm()&0o111 == 0 {
+			logging.For(nil).Debugf("Ignoring %q, not an executable file", executable)
+			continue
+		}
+		logging.For(nil).Debugf("Using transport plugin %q", executable)
+		t := &pluginTransport{name: name, executable: executable}
+		transports.Register(t)
+		return t, nil
+	}
+	return nil, nil
+}
+
+// pluginDirectories returns the directories to search for plugins, in order.
+func pluginDirectories() []string {
+	if path, ok := os.LookupEnv(pluginPathEnvVar); ok {
+		res := []string{}
+		for _, dir := range filepath.SplitList(path) {
+			if dir != "" {
+				res = append(res, dir)
+			}
+		}
+		return res
+	}
+	return defaultPluginDirectories
+}
+
+// limitedBuffer is an io.Writer which retains only the first maxErrorMessageSize bytes written to it.
+type limitedBuffer struct {
+	buf bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := maxErrorMessageSize - b.buf.Len(); remaining > 0 {
+		if len(p) > remaining {
+			b.buf.Write(p[:remaining])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// command returns an exec.Cmd running operation with request.
+func (t *pluginTransport) command(ctx context.Context, logger types.Logger, operation string, request any) (*exec.Cmd, *limitedBuffer, error) {
+	requestBytes, err := json.Marshal(request)
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd := exec.CommandContext(ctx, t.executable, operation, string(requestBytes))
+	cmd.Env = append(os.Environ(), protocolEnvVar+"="+protocolVersion)
+	stderr := &limitedBuffer{}
+	cmd.Stderr = stderr
+	logger.Debugf("Running transport plugin %s %s", t.executable, operation)
+	return cmd, stderr, nil
+}
+
+// operationError returns an error for a failure of operation with err, using the error message in stderr, if any.
+func (t *pluginTransport) operationError(operation string, stderr *limitedBuffer, err error) error {
+	if msg := strings.TrimSpace(stderr.buf.String()); msg != "" {
+		return fmt.Errorf("%s transport plugin %s failed: %s (%w)", t.name, operation, msg, err)
+	}
+	return fmt.Errorf("%s transport plugin %s failed: %w", t.name, operation, err)
+}
+
+// readErrorReader is an io.Reader which records errors returned by the underlying reader.
+type readErrorReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *readErrorReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+// call runs operation with request, logging using logger, providing stdin, if not nil, as input, and parses the output into response.
+// If reading stdin fails, the plugin is killed, and the read error is returned.
+func (t *pluginTransport) call(ctx context.Context, logger types.Logger, operation string, request any, stdin io.Reader, response any) error {
+	cmd, stderr, err := t.command(ctx, logger, operation, request)
+	if err != nil {
+		return err
+	}
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	var stdinPipe io.WriteCloser
+	if stdin != nil {
+		stdinPipe, err = cmd.StdinPipe()
+		if err != nil {
+			return err
+		}
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting %s transport plugin: %w", t.name, err)
+	}
+	if stdin != nil {
+		input := &readErrorReader{r: stdin}
+		_, err := io.Copy(stdinPipe, input)
+		if input.err != nil {
+			// Make sure the plugin does not see EOF and accept incomplete data.
+			_ = cmd.Process.Kill()
+			stdinPipe.Close()
+			_ = cmd.Wait()
+			return input.err
+		}
+		stdinPipe.Close()
+		if err != nil {
+			// Most likely, the plugin has failed without reading all of the input; report the plugin's error, if any.
+			if waitErr := cmd.Wait(); waitErr != nil {
+				return t.operationError(operation, stderr, waitErr)
+			}
+			return fmt.Errorf("writing input to %s transport plugin %s: %w", t.name, operation, err)
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		return t.operationError(operation, stderr, err)
+	}
+	if err := json.Unmarshal(stdout.Bytes(), response); err != nil {
+		return fmt.Errorf("parsing output of %s transport plugin %s: %w", t.name, operation, err)
+	}
+	return nil
+}
+
+// pluginOutputReader is an io.ReadCloser for the output of a plugin, which fails if the plugin fails.
+type pluginOutputReader struct {
+	t         *pluginTransport
+	operation string
+	cmd       *exec.Cmd
+	stdout    io.ReadCloser
+	stderr    *limitedBuffer
+	done      bool
+}
+
+// stream runs operation with request, logging using logger, and returns its output.
+// The caller must close the returned stream.
+func (t *pluginTransport) stream(ctx context.Context, logger types.Logger, operation string, request any) (io.ReadCloser, error) {
+	cmd, stderr, err := t.command(ctx, logger, operation, request)
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting %s transport plugin: %w", t.name, err)
+	}
+	return &pluginOutputReader{t: t, operation: operation, cmd: cmd, stdout: stdout, stderr: stderr}, nil
+}
+
+func (r *pluginOutputReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, io.EOF
+	}
+	n, err := r.stdout.Read(p)
+	if err == io.EOF {
+		r.done = true
+		if waitErr := r.cmd.Wait(); waitErr != nil {
+			return n, r.t.operationError(r.operation, r.stderr, waitErr)
+		}
+	}
+	return n, err
+}
+
+func (r *pluginOutputReader) Close() error {
+	if !r.done {
+		r.done = true
+		_ = r.cmd.Process.Kill()
+		_ = r.cmd.Wait()
+	}
+	return nil
+}
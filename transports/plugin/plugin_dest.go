@@ -0,0 +1,204 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/containers/image/v5/internal/imagedestination/impl"
+	"github.com/containers/image/v5/internal/imagedestination/stubs"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/putblobdigest"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// openDestinationResponse is the response of the open-destination operation.
+type openDestinationResponse struct {
+	Session                    string   `json:"session"`
+	SupportedManifestMIMETypes []string `json:"supportedManifestMIMETypes"`
+	DesiredLayerCompression    string   `json:"desiredLayerCompression"`
+}
+
+// hasBlobResponse is the response of the has-blob operation.
+type hasBlobResponse struct {
+	Present bool  `json:"present"`
+	Size    int64 `json:"size"`
+}
+
+// putBlobResponse is the response of the put-blob operation.
+type putBlobResponse struct {
+	Digest digest.Digest `json:"digest"`
+	Size   int64         `json:"size"`
+}
+
+type pluginImageDestination struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	stubs.NoPutBlobPartialInitialize
+	stubs.AlwaysSupportsSignatures
+
+	ref     pluginReference
+	session string
+	logger  types.Logger
+}
+
+// newImageDestination returns an ImageDestination for writing an image using a transport plugin.
+func newImageDestination(ctx context.Context, sys *types.SystemContext, ref pluginReference) (private.ImageDestination, error) {
+	logger := logging.For(sys)
+	var res openDestinationResponse
+	if err := ref.transport.call(ctx, logger, "open-destination", referenceRequest{Reference: ref.ref}, nil, &res); err != nil {
+		return nil, err
+	}
+	var desiredLayerCompression types.LayerCompression
+	switch res.DesiredLayerCompression {
+	case "", "preserve":
+		desiredLayerCompression = types.PreserveOriginal
+	case "compress":
+		desiredLayerCompression = types.Compress
+	case "decompress":
+		desiredLayerCompression = types.Decompress
+	default:
+		_ = ref.transport.call(ctx, logger, "close-destination", sessionRequest{Reference: ref.ref, Session: res.Session}, nil, &emptyResponse{})
+		return nil, fmt.Errorf("%s transport plugin returned an unknown layer compression %q", ref.transport.name, res.DesiredLayerCompression)
+	}
+
+	d := &pluginImageDestination{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			SupportedManifestMIMETypes:     res.SupportedManifestMIMETypes,
+			DesiredLayerCompression:        desiredLayerCompression,
+			AcceptsForeignLayerURLs:        false,
+			MustMatchRuntimeOS:             false,
+			IgnoresEmbeddedDockerReference: false,
+			HasThreadSafePutBlob:           true,
+		}),
+		NoPutBlobPartialInitialize: stubs.NoPutBlobPartial(ref),
+
+		ref:     ref,
+		session: res.Session,
+		logger:  logger,
+	}
+	d.Compat = impl.AddCompat(d)
+	return d, nil
+}
+
+// Reference returns the reference used to set up this destination.  Note that this should directly correspond to user's intent,
+// e.g. it should use the public hostname instead of the result of resolving CNAMEs or following redirects.
+func (d *pluginImageDestination) Reference() types.ImageReference {
+	return d.ref
+}
+
+// Close removes resources associated with an initialized ImageDestination, if any.
+func (d *pluginImageDestination) Close() error {
+	return d.ref.transport.call(context.Background(), d.logger, "close-destination", sessionRequest{Reference: d.ref.ref, Session: d.session}, nil, &emptyResponse{})
+}
+
+// PutBlobWithOptions writes contents of stream and returns data representing the result.
+// inputInfo.Digest can be optionally provided if known; if provided, and stream is read to the end without error, the digest MUST match the stream contents.
+// inputInfo.Size is the expected length of stream, if known.
+// inputInfo.MediaType describes the blob format, if known.
+// WARNING: The contents of stream are being verified on the fly.  Until stream.Read() returns io.EOF, the contents of the data SHOULD NOT be available
+// to any other readers for download using the supplied digest.
+// If stream.Read() at any time, ESPECIALLY at end of input, returns an error, PutBlobWithOptions MUST 1) fail, and 2) delete any data stored so far.
+func (d *pluginImageDestination) PutBlobWithOptions(ctx context.Context, stream io.Reader, inputInfo types.BlobInfo, options private.PutBlobOptions) (private.UploadedBlob, error) {
+	digester, stream := putblobdigest.DigestIfCanonicalUnknown(stream, inputInfo)
+	var res putBlobResponse
+	if err := d.ref.transport.call(ctx, d.logger, "put-blob", blobRequest{
+		Reference: d.ref.ref,
+		Session:   d.session,
+		Digest:    inputInfo.Digest,
+		Size:      inputInfo.Size,
+	}, stream, &res); err != nil {
+		return private.UploadedBlob{}, err
+	}
+	blobDigest := digester.Digest()
+	if res.Digest != blobDigest {
+		return private.UploadedBlob{}, fmt.Errorf("%s transport plugin stored blob %s as %q", d.ref.transport.name, blobDigest, res.Digest)
+	}
+	if inputInfo.Size != -1 && res.Size != inputInfo.Size {
+		return private.UploadedBlob{}, fmt.Errorf("Size mismatch when copying %s, expected %d, got %d", blobDigest, inputInfo.Size, res.Size)
+	}
+	return private.UploadedBlob{Digest: blobDigest, Size: res.Size}, nil
+}
+
+// TryReusingBlobWithOptions checks whether the transport already contains, or can efficiently reuse, a blob, and if so, applies it to the current destination
+// (e.g. if the blob is a filesystem layer, this signifies that the changes it describes need to be applied again when composing a filesystem tree).
+// info.Digest must not be empty.
+// If the blob has been successfully reused, returns (true, info, nil).
+// If the transport can not reuse the requested blob, TryReusingBlob returns (false, {}, nil); it returns a non-nil error only on an unexpected failure.
+func (d *pluginImageDestination) TryReusingBlobWithOptions(ctx context.Context, info types.BlobInfo, options private.TryReusingBlobOptions) (bool, private.ReusedBlob, error) {
+	if !impl.OriginalBlobMatchesRequiredCompression(options) {
+		return false, private.ReusedBlob{}, nil
+	}
+	if info.Digest == "" {
+		return false, private.ReusedBlob{}, fmt.Errorf("Can not check for a blob with unknown digest")
+	}
+	var res hasBlobResponse
+	if err := d.ref.transport.call(ctx, d.logger, "has-blob", blobRequest{
+		Reference: d.ref.ref,
+		Session:   d.session,
+		Digest:    info.Digest,
+		Size:      info.Size,
+	}, nil, &res); err != nil {
+		return false, private.ReusedBlob{}, err
+	}
+	if !res.Present {
+		return false, private.ReusedBlob{}, nil
+	}
+	return true, private.ReusedBlob{Digest: info.Digest, Size: res.Size}, nil
+}
+
+// PutManifest writes manifest to the destination.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to write the manifest for (when
+// the primary manifest is a manifest list); this should always be nil if the primary manifest is not a manifest list.
+// It is expected but not enforced that the instanceDigest, when specified, matches the digest of `manifest` as generated
+// by `manifest.Digest()`.
+// FIXME? This should also receive a MIME type if known, to differentiate between schema versions.
+// If the destination is in principle available, refuses this manifest type (e.g. it does not recognize the schema),
+// but may accept a different manifest type, the returned error must be an ManifestTypeRejectedError.
+func (d *pluginImageDestination) PutManifest(ctx context.Context, manifest []byte, instanceDigest *digest.Digest) error {
+	return d.ref.transport.call(ctx, d.logger, "put-manifest", instanceRequest{
+		Reference:      d.ref.ref,
+		Session:        d.session,
+		InstanceDigest: instanceDigestString(instanceDigest),
+	}, bytes.NewReader(manifest), &emptyResponse{})
+}
+
+// PutSignaturesWithFormat writes a set of signatures to the destination.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to write or overwrite the signatures for
+// (when the primary manifest is a manifest list); this should always be nil if the primary manifest is not a manifest list.
+// MUST be called after PutManifest (signatures may reference manifest contents).
+func (d *pluginImageDestination) PutSignaturesWithFormat(ctx context.Context, signatures []signature.Signature, instanceDigest *digest.Digest) error {
+	data := signaturesData{Signatures: make([][]byte, 0, len(signatures))}
+	for _, sig := range signatures {
+		blob, err := signature.Blob(sig)
+		if err != nil {
+			return err
+		}
+		data.Signatures = append(data.Signatures, blob)
+	}
+	input, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return d.ref.transport.call(ctx, d.logger, "put-signatures", instanceRequest{
+		Reference:      d.ref.ref,
+		Session:        d.session,
+		InstanceDigest: instanceDigestString(instanceDigest),
+	}, bytes.NewReader(input), &emptyResponse{})
+}
+
+// Commit marks the process of storing the image as successful and asks for the image to be persisted.
+// unparsedToplevel contains data about the top-level manifest of the source (which may be a single-arch image or a manifest list
+// if PutManifest was only called for the single-arch image with instanceDigest == nil), primarily to allow lookups by the
+// original manifest list digest, if desired.
+// WARNING: This does not have any transactional semantics:
+// - Uploaded data MAY be visible to others before Commit() is called
+// - Uploaded data MAY be removed or MAY remain around if Close() is called without Commit() (i.e. rollback is allowed but not guaranteed)
+func (d *pluginImageDestination) Commit(ctx context.Context, unparsedToplevel types.UnparsedImage) error {
+	return d.ref.transport.call(ctx, d.logger, "commit", sessionRequest{Reference: d.ref.ref, Session: d.session}, nil, &emptyResponse{})
+}
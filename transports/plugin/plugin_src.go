@@ -0,0 +1,134 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/containers/image/v5/internal/imagesource/impl"
+	"github.com/containers/image/v5/internal/imagesource/stubs"
+	"github.com/containers/image/v5/internal/manifest"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// sessionResponse is the response of the open-source operation.
+type sessionResponse struct {
+	Session string `json:"session"`
+}
+
+// getManifestResponse is the response of the get-manifest operation.
+type getManifestResponse struct {
+	Manifest []byte `json:"manifest"`
+	MIMEType string `json:"mimeType"`
+}
+
+// signaturesData is the response of the get-signatures operation, and the input of the put-signatures operation.
+type signaturesData struct {
+	Signatures [][]byte `json:"signatures"`
+}
+
+type pluginImageSource struct {
+	impl.Compat
+	impl.PropertyMethodsInitialize
+	impl.DoesNotAffectLayerInfosForCopy
+	stubs.NoGetBlobAtInitialize
+
+	ref     pluginReference
+	session string
+	logger  types.Logger
+}
+
+// newImageSource returns an ImageSource for reading an image using a transport plugin.
+func newImageSource(ctx context.Context, sys *types.SystemContext, ref pluginReference) (private.ImageSource, error) {
+	logger := logging.For(sys)
+	var res sessionResponse
+	if err := ref.transport.call(ctx, logger, "open-source", referenceRequest{Reference: ref.ref}, nil, &res); err != nil {
+		return nil, err
+	}
+	s := &pluginImageSource{
+		PropertyMethodsInitialize: impl.PropertyMethods(impl.Properties{
+			HasThreadSafeGetBlob: true,
+		}),
+		NoGetBlobAtInitialize: stubs.NoGetBlobAt(ref),
+
+		ref:     ref,
+		session: res.Session,
+		logger:  logger,
+	}
+	s.Compat = impl.AddCompat(s)
+	return s, nil
+}
+
+// Reference returns the reference used to set up this source, _as specified by the user_
+// (not as the image itself, or its underlying storage, claims).  This can be used e.g. to determine which public keys are trusted for this image.
+func (s *pluginImageSource) Reference() types.ImageReference {
+	return s.ref
+}
+
+// Close removes resources associated with an initialized ImageSource, if any.
+func (s *pluginImageSource) Close() error {
+	return s.ref.transport.call(context.Background(), s.logger, "close-source", sessionRequest{Reference: s.ref.ref, Session: s.session}, nil, &emptyResponse{})
+}
+
+// GetManifest returns the image's manifest along with its MIME type (which may be empty when it can't be determined but the manifest is available).
+// It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve (when the primary manifest is a manifest list);
+// this never happens if the primary manifest is not a manifest list (e.g. if the source never returns manifest lists).
+func (s *pluginImageSource) GetManifest(ctx context.Context, instanceDigest *digest.Digest) ([]byte, string, error) {
+	var res getManifestResponse
+	if err := s.ref.transport.call(ctx, s.logger, "get-manifest", instanceRequest{
+		Reference:      s.ref.ref,
+		Session:        s.session,
+		InstanceDigest: instanceDigestString(instanceDigest),
+	}, nil, &res); err != nil {
+		return nil, "", err
+	}
+	if res.MIMEType == "" {
+		res.MIMEType = manifest.GuessMIMEType(res.Manifest)
+	}
+	return res.Manifest, res.MIMEType, nil
+}
+
+// GetBlob returns a stream for the specified blob, and the blob’s size (or -1 if unknown).
+// The Digest field in BlobInfo is guaranteed to be provided, Size may be -1 and MediaType may be optionally provided.
+// May update BlobInfoCache, preferably after it knows for certain that a blob truly exists at a specific location.
+func (s *pluginImageSource) GetBlob(ctx context.Context, info types.BlobInfo, cache types.BlobInfoCache) (io.ReadCloser, int64, error) {
+	stream, err := s.ref.transport.stream(ctx, s.logger, "get-blob", blobRequest{
+		Reference: s.ref.ref,
+		Session:   s.session,
+		Digest:    info.Digest,
+		Size:      info.Size,
+	})
+	if err != nil {
+		return nil, -1, err
+	}
+	return stream, -1, nil
+}
+
+// GetSignaturesWithFormat returns the image's signatures.  It may use a remote (= slow) service.
+// If instanceDigest is not nil, it contains a digest of the specific manifest instance to retrieve signatures for
+// (when the primary manifest is a manifest list); this never happens if the primary manifest is not a manifest list
+// (e.g. if the source never returns manifest lists).
+func (s *pluginImageSource) GetSignaturesWithFormat(ctx context.Context, instanceDigest *digest.Digest) ([]signature.Signature, error) {
+	var res signaturesData
+	if err := s.ref.transport.call(ctx, s.logger, "get-signatures", instanceRequest{
+		Reference:      s.ref.ref,
+		Session:        s.session,
+		InstanceDigest: instanceDigestString(instanceDigest),
+	}, nil, &res); err != nil {
+		return nil, err
+	}
+	signatures := make([]signature.Signature, 0, len(res.Signatures))
+	for i, blob := range res.Signatures {
+		sig, err := signature.FromBlob(blob)
+		if err != nil {
+			return nil, fmt.Errorf("parsing signature %d: %w", i, err)
+		}
+		signatures = append(signatures, sig)
+	}
+	return signatures, nil
+}
@@ -0,0 +1,350 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"testing/iotest"
+
+	"github.com/containers/image/v5/internal/imagedestination"
+	"github.com/containers/image/v5/internal/imagesource"
+	"github.com/containers/image/v5/internal/private"
+	"github.com/containers/image/v5/internal/signature"
+	"github.com/containers/image/v5/pkg/blobinfocache/none"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+	imgspecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPluginStoreEnvVar, if set, makes the test binary act as a transport plugin storing images in the specified directory.
+const testPluginStoreEnvVar = "CONTAINERS_IMAGE_TEST_PLUGIN_STORE"
+
+func TestMain(m *testing.M) {
+	if store, ok := os.LookupEnv(testPluginStoreEnvVar); ok {
+		if err := testPlugin(store, os.Args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+var testPluginReference = regexp.MustCompile(`^[a-z]+$`)
+
+// testPlugin implements a transport plugin, storing images in subdirectories of store.
+func testPlugin(store string, args []string) error {
+	if os.Getenv(protocolEnvVar) != protocolVersion {
+		return errors.New("unexpected protocol version")
+	}
+	if len(args) != 2 {
+		return errors.New("usage: plugin operation request")
+	}
+	operation := args[0]
+	var req struct {
+		Reference      string        `json:"reference"`
+		Session        string        `json:"session"`
+		Scope          string        `json:"scope"`
+		InstanceDigest string        `json:"instanceDigest"`
+		Digest         digest.Digest `json:"digest"`
+		Size           int64         `json:"size"`
+	}
+	if err := json.Unmarshal([]byte(args[1]), &req); err != nil {
+		return err
+	}
+	if operation != "parse-reference" && operation != "validate-policy-scope" && !testPluginReference.MatchString(req.Reference) {
+		return fmt.Errorf("invalid reference %q", req.Reference)
+	}
+	dir := filepath.Join(store, req.Reference)
+	switch operation {
+	case "parse-reference", "validate-policy-scope", "delete-image", "open-source", "open-destination":
+	default:
+		if req.Session == "" {
+			return errors.New("missing session")
+		}
+	}
+	manifestPath := filepath.Join(dir, "manifest"+req.InstanceDigest)
+	signaturesPath := filepath.Join(dir, "signatures"+req.InstanceDigest)
+	var res any = struct{}{}
+	switch operation {
+	case "parse-reference":
+		if !testPluginReference.MatchString(req.Reference) {
+			return fmt.Errorf("invalid reference %q", req.Reference)
+		}
+		res = parseReferenceResponse{
+			Reference:        req.Reference,
+			DockerReference:  "example.com/" + req.Reference + ":latest",
+			PolicyIdentity:   req.Reference,
+			PolicyNamespaces: []string{},
+		}
+	case "validate-policy-scope":
+		if !testPluginReference.MatchString(req.Scope) {
+			return fmt.Errorf("invalid scope %q", req.Scope)
+		}
+	case "delete-image":
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	case "open-source":
+		if _, err := os.Stat(dir); err != nil {
+			return err
+		}
+		res = sessionResponse{Session: "source-session"}
+	case "get-manifest":
+		m, err := os.ReadFile(manifestPath)
+		if err != nil {
+			return err
+		}
+		res = getManifestResponse{Manifest: m}
+	case "get-blob":
+		f, err := os.Open(filepath.Join(dir, req.Digest.Encoded()))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(os.Stdout, f)
+		return err
+	case "get-signatures":
+		var data signaturesData
+		sigs, err := os.ReadFile(signaturesPath)
+		if err == nil {
+			err = json.Unmarshal(sigs, &data)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		res = data
+	case "open-destination":
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		res = openDestinationResponse{Session: "destination-session", DesiredLayerCompression: "compress"}
+	case "has-blob":
+		fi, err := os.Stat(filepath.Join(dir, req.Digest.Encoded()))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err == nil {
+			res = hasBlobResponse{Present: true, Size: fi.Size()}
+		} else {
+			res = hasBlobResponse{}
+		}
+	case "put-blob":
+		blob, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		d := digest.FromBytes(blob)
+		if req.Digest != "" && req.Digest != d {
+			return fmt.Errorf("digest mismatch, expected %s, got %s", req.Digest, d)
+		}
+		if err := os.WriteFile(filepath.Join(dir, d.Encoded()), blob, 0o644); err != nil {
+			return err
+		}
+		res = putBlobResponse{Digest: d, Size: int64(len(blob))}
+	case "put-manifest", "put-signatures":
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		path := manifestPath
+		if operation == "put-signatures" {
+			path = signaturesPath
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return err
+		}
+	case "commit":
+		if err := os.WriteFile(filepath.Join(dir, "committed"), nil, 0o644); err != nil {
+			return err
+		}
+	case "close-source", "close-destination":
+	default:
+		return fmt.Errorf("unknown operation %q", operation)
+	}
+	return json.NewEncoder(os.Stdout).Encode(res)
+}
+
+// registerTestPlugin registers the test binary as a transport plugin with the specified name, storing images in a temporary directory,
+// and returns the directory.
+func registerTestPlugin(t *testing.T, name string) string {
+	executable, err := os.Executable()
+	require.NoError(t, err)
+	store := t.TempDir()
+	t.Setenv(testPluginStoreEnvVar, store)
+	err = Register(name, executable)
+	require.NoError(t, err)
+	t.Cleanup(func() { transports.Delete(name) })
+	return store
+}
+
+func TestRegister(t *testing.T) {
+	registerTestPlugin(t, "test-register")
+	transport := transports.Get("test-register")
+	require.NotNil(t, transport)
+	assert.Equal(t, "test-register", transport.Name())
+
+	lookedUp, err := Lookup("test-register")
+	require.NoError(t, err)
+	assert.Equal(t, transport, lookedUp)
+	// Lookup ignores transports which are not plugins
+	transports.Register(transports.NewStubTransport("test-register-stub"))
+	defer transports.Delete("test-register-stub")
+	lookedUp, err = Lookup("test-register-stub")
+	require.NoError(t, err)
+	assert.Nil(t, lookedUp)
+
+	// Already registered
+	err = Register("test-register", "/does/not/exist")
+	assert.Error(t, err)
+	// Invalid names
+	for _, name := range []string{"", "Test", "a/b", "..", "-a", "a:b"} {
+		err := Register(name, "/does/not/exist")
+		assert.Error(t, err, name)
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	executable, err := os.Executable()
+	require.NoError(t, err)
+	dir1 := t.TempDir()
+	dir2 := t.TempDir()
+	err = os.Symlink(executable, filepath.Join(dir2, "test-discover"))
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(dir1, "test-discover"), []byte("not executable"), 0o644)
+	require.NoError(t, err)
+	err = os.Mkdir(filepath.Join(dir1, "test-discover-dir"), 0o755)
+	require.NoError(t, err)
+	t.Setenv(pluginPathEnvVar, dir1+string(filepath.ListSeparator)+dir2)
+	t.Setenv(testPluginStoreEnvVar, t.TempDir())
+	t.Cleanup(func() { transports.Delete("test-discover") })
+
+	transport, err := Discover("test-discover")
+	require.NoError(t, err)
+	require.NotNil(t, transport)
+	assert.Equal(t, "test-discover", transport.Name())
+	assert.Equal(t, filepath.Join(dir2, "test-discover"), transport.(*pluginTransport).executable)
+	assert.Equal(t, transport, transports.Get("test-discover"))
+	transport2, err := Discover("test-discover")
+	require.NoError(t, err)
+	assert.Equal(t, transport, transport2)
+	ref, err := transport.ParseReference("image")
+	require.NoError(t, err)
+	assert.Equal(t, "image", ref.StringWithinTransport())
+
+	for _, name := range []string{"test-missing", "test-discover-dir", "../" + filepath.Base(dir2) + "/test-discover", ""} {
+		transport, err := Discover(name)
+		require.NoError(t, err, name)
+		assert.Nil(t, transport, name)
+	}
+
+	t.Setenv(pluginPathEnvVar, "")
+	assert.Equal(t, []string{}, pluginDirectories())
+	os.Unsetenv(pluginPathEnvVar)
+	assert.Equal(t, defaultPluginDirectories, pluginDirectories())
+}
+
+func TestPluginTransport(t *testing.T) {
+	store := registerTestPlugin(t, "test-transport")
+	transport := transports.Get("test-transport")
+	require.NotNil(t, transport)
+
+	ref, err := transport.ParseReference("image")
+	require.NoError(t, err)
+	assert.Equal(t, transport, ref.Transport())
+	assert.Equal(t, "image", ref.StringWithinTransport())
+	require.NotNil(t, ref.DockerReference())
+	assert.Equal(t, "example.com/image:latest", ref.DockerReference().String())
+	assert.Equal(t, "image", ref.PolicyConfigurationIdentity())
+	assert.Equal(t, []string{}, ref.PolicyConfigurationNamespaces())
+
+	_, err = transport.ParseReference("Invalid")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `invalid reference "Invalid"`)
+
+	err = transport.ValidatePolicyConfigurationScope("scope")
+	assert.NoError(t, err)
+	err = transport.ValidatePolicyConfigurationScope("/invalid")
+	assert.Error(t, err)
+
+	// Writing an image
+	ctx := context.Background()
+	blob := []byte("blob contents")
+	blobDigest := digest.FromBytes(blob)
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"` + imgspecv1.MediaTypeImageManifest + `"}`)
+	sig := signature.SigstoreFromComponents("text/plain", []byte("payload"), map[string]string{"annotation": "value"})
+
+	dest, err := ref.NewImageDestination(ctx, nil)
+	require.NoError(t, err)
+	defer dest.Close()
+	assert.Equal(t, types.Compress, dest.DesiredLayerCompression())
+	privateDest := imagedestination.FromPublic(dest)
+
+	_, err = privateDest.PutBlobWithOptions(ctx, io.MultiReader(bytes.NewReader(blob[:4]), iotest.ErrReader(errors.New("read failed"))),
+		types.BlobInfo{Digest: blobDigest, Size: -1}, private.PutBlobOptions{Cache: none.NoCache})
+	assert.ErrorContains(t, err, "read failed")
+	reused, _, err := privateDest.TryReusingBlobWithOptions(ctx, types.BlobInfo{Digest: blobDigest, Size: -1}, private.TryReusingBlobOptions{Cache: none.NoCache})
+	require.NoError(t, err)
+	assert.False(t, reused)
+	_, err = privateDest.PutBlobWithOptions(ctx, bytes.NewReader([]byte("other contents")),
+		types.BlobInfo{Digest: blobDigest, Size: -1}, private.PutBlobOptions{Cache: none.NoCache})
+	assert.ErrorContains(t, err, "digest mismatch")
+
+	uploaded, err := privateDest.PutBlobWithOptions(ctx, bytes.NewReader(blob), types.BlobInfo{Digest: "", Size: -1}, private.PutBlobOptions{Cache: none.NoCache})
+	require.NoError(t, err)
+	assert.Equal(t, private.UploadedBlob{Digest: blobDigest, Size: int64(len(blob))}, uploaded)
+	reused, reusedBlob, err := privateDest.TryReusingBlobWithOptions(ctx, types.BlobInfo{Digest: blobDigest, Size: -1}, private.TryReusingBlobOptions{Cache: none.NoCache})
+	require.NoError(t, err)
+	assert.True(t, reused)
+	assert.Equal(t, private.ReusedBlob{Digest: blobDigest, Size: int64(len(blob))}, reusedBlob)
+	err = privateDest.PutManifest(ctx, manifest, nil)
+	require.NoError(t, err)
+	err = privateDest.PutSignaturesWithFormat(ctx, []signature.Signature{sig}, nil)
+	require.NoError(t, err)
+	err = privateDest.Commit(ctx, nil)
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(store, "image", "committed"))
+	require.NoError(t, err)
+
+	// Reading it back
+	src, err := ref.NewImageSource(ctx, nil)
+	require.NoError(t, err)
+	defer src.Close()
+	privateSrc := imagesource.FromPublic(src)
+	m, mimeType, err := privateSrc.GetManifest(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, manifest, m)
+	assert.Equal(t, imgspecv1.MediaTypeImageManifest, mimeType)
+	stream, _, err := privateSrc.GetBlob(ctx, types.BlobInfo{Digest: blobDigest, Size: -1}, none.NoCache)
+	require.NoError(t, err)
+	contents, err := io.ReadAll(stream)
+	require.NoError(t, err)
+	stream.Close()
+	assert.Equal(t, blob, contents)
+	sigs, err := privateSrc.GetSignaturesWithFormat(ctx, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []signature.Signature{sig}, sigs)
+
+	// Plugin failures while reading a blob are reported
+	stream, _, err = privateSrc.GetBlob(ctx, types.BlobInfo{Digest: digest.FromBytes([]byte("missing")), Size: -1}, none.NoCache)
+	require.NoError(t, err)
+	_, err = io.ReadAll(stream)
+	assert.ErrorContains(t, err, "no such file or directory")
+	stream.Close()
+
+	// Deleting it
+	err = ref.DeleteImage(ctx, nil)
+	require.NoError(t, err)
+	_, err = ref.NewImageSource(ctx, nil)
+	assert.Error(t, err)
+}
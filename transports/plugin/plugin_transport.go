@@ -0,0 +1,181 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/image/v5/docker/reference"
+	"github.com/containers/image/v5/internal/image"
+	"github.com/containers/image/v5/pkg/logging"
+	"github.com/containers/image/v5/types"
+	"github.com/opencontainers/go-digest"
+)
+
+// referenceRequest is the request of operations which only need a reference.
+type referenceRequest struct {
+	Reference string `json:"reference"`
+}
+
+// sessionRequest is the request of operations which only need a reference and a session.
+type sessionRequest struct {
+	Reference string `json:"reference"`
+	Session   string `json:"session"`
+}
+
+// instanceRequest is the request of operations on a manifest instance.
+type instanceRequest struct {
+	Reference      string `json:"reference"`
+	Session        string `json:"session"`
+	InstanceDigest string `json:"instanceDigest,omitempty"`
+}
+
+// blobRequest is the request of operations on a blob.
+type blobRequest struct {
+	Reference string        `json:"reference"`
+	Session   string        `json:"session"`
+	Digest    digest.Digest `json:"digest"`
+	Size      int64         `json:"size"`
+}
+
+// parseReferenceResponse is the response of the parse-reference operation.
+type parseReferenceResponse struct {
+	Reference        string   `json:"reference"`
+	DockerReference  string   `json:"dockerReference"`
+	PolicyIdentity   string   `json:"policyIdentity"`
+	PolicyNamespaces []string `json:"policyNamespaces"`
+}
+
+// emptyResponse is the response of operations which don't return any data.
+type emptyResponse struct{}
+
+// pluginTransport is an ImageTransport implemented by a plugin.
+type pluginTransport struct {
+	name       string
+	executable string
+}
+
+func (t *pluginTransport) Name() string {
+	return t.name
+}
+
+// ParseReference converts a string, which should not start with the ImageTransport.Name prefix, into an ImageReference.
+func (t *pluginTransport) ParseReference(ref string) (types.ImageReference, error) {
+	var res parseReferenceResponse
+	if err := t.call(context.Background(), logging.For(nil), "parse-reference", referenceRequest{Reference: ref}, nil, &res); err != nil {
+		return nil, err
+	}
+	if res.Reference == "" {
+		return nil, fmt.Errorf("%s transport plugin returned an empty reference for %q", t.name, ref)
+	}
+	var dockerRef reference.Named
+	if res.DockerReference != "" {
+		named, err := reference.ParseNormalizedNamed(res.DockerReference)
+		if err != nil {
+			return nil, fmt.Errorf("%s transport plugin returned an invalid Docker reference %q: %w", t.name, res.DockerReference, err)
+		}
+		if reference.IsNameOnly(named) {
+			return nil, fmt.Errorf("%s transport plugin returned a Docker reference %q without a tag or digest", t.name, res.DockerReference)
+		}
+		dockerRef = named
+	}
+	return pluginReference{
+		transport:        t,
+		ref:              res.Reference,
+		dockerRef:        dockerRef,
+		policyIdentity:   res.PolicyIdentity,
+		policyNamespaces: res.PolicyNamespaces,
+	}, nil
+}
+
+// ValidatePolicyConfigurationScope checks that scope is a valid name for a signature.PolicyTransportScopes keys
+// (i.e. a valid PolicyConfigurationIdentity() or PolicyConfigurationNamespaces() return value).
+// It is acceptable to allow an invalid value which will never be matched, it can "only" cause user confusion.
+// scope passed to this function will not be "", that value is always allowed.
+func (t *pluginTransport) ValidatePolicyConfigurationScope(scope string) error {
+	return t.call(context.Background(), logging.For(nil), "validate-policy-scope", struct {
+		Scope string `json:"scope"`
+	}{Scope: scope}, nil, &emptyResponse{})
+}
+
+// pluginReference is an ImageReference for images accessed using a transport plugin.
+type pluginReference struct {
+	transport        *pluginTransport
+	ref              string // As returned by the plugin's parse-reference operation
+	dockerRef        reference.Named
+	policyIdentity   string
+	policyNamespaces []string
+}
+
+func (ref pluginReference) Transport() types.ImageTransport {
+	return ref.transport
+}
+
+// StringWithinTransport returns a string representation of the reference, which MUST be such that
+// reference.Transport().ParseReference(reference.StringWithinTransport()) returns an equivalent reference.
+// NOTE: The returned string is not promised to be equal to the original input to ParseReference;
+// e.g. default attribute values omitted by the user may be filled in the return value, or vice versa.
+// WARNING: Do not use the return value in the UI to describe an image, it does not contain the Transport().Name() prefix.
+func (ref pluginReference) StringWithinTransport() string {
+	return ref.ref
+}
+
+// DockerReference returns a Docker reference associated with this reference
+// (fully explicit, i.e. !reference.IsNameOnly, but reflecting user intent,
+// not e.g. after redirect or alias processing), or nil if unknown/not applicable.
+func (ref pluginReference) DockerReference() reference.Named {
+	return ref.dockerRef
+}
+
+// PolicyConfigurationIdentity returns a string representation of the reference, suitable for policy lookup.
+// This MUST reflect user intent, not e.g. after processing of third-party redirects or aliases;
+// The value SHOULD be fully explicit about its semantics, with no hidden defaults, AND canonical
+// (i.e. various references with exactly the same semantics should return the same configuration identity)
+// It is fine for the return value to be equal to StringWithinTransport(), and it is desirable but
+// not required/guaranteed that it will be a valid input to Transport().ParseReference().
+// Returns "" if configuration identities for these references are not supported.
+func (ref pluginReference) PolicyConfigurationIdentity() string {
+	return ref.policyIdentity
+}
+
+// PolicyConfigurationNamespaces returns a list of other policy configuration namespaces to search
+// for if explicit configuration for PolicyConfigurationIdentity() is not set.  The list will be processed
+// in order, terminating on first match, and an implicit "" is always checked at the end.
+// It is STRONGLY recommended for the first element, if any, to be a prefix of PolicyConfigurationIdentity(),
+// and each following element to be a prefix of the element preceding it.
+func (ref pluginReference) PolicyConfigurationNamespaces() []string {
+	return ref.policyNamespaces
+}
+
+// NewImage returns a types.ImageCloser for this reference, possibly specialized for this ImageTransport.
+// The caller must call .Close() on the returned ImageCloser.
+// NOTE: If any kind of signature verification should happen, build an UnparsedImage from the value returned by NewImageSource,
+// verify that UnparsedImage, and convert it into a real Image via image.FromUnparsedImage.
+// WARNING: This may not do the right thing for a manifest list, see image.FromSource for details.
+func (ref pluginReference) NewImage(ctx context.Context, sys *types.SystemContext) (types.ImageCloser, error) {
+	return image.FromReference(ctx, sys, ref)
+}
+
+// NewImageSource returns a types.ImageSource for this reference.
+// The caller must call .Close() on the returned ImageSource.
+func (ref pluginReference) NewImageSource(ctx context.Context, sys *types.SystemContext) (types.ImageSource, error) {
+	return newImageSource(ctx, sys, ref)
+}
+
+// NewImageDestination returns a types.ImageDestination for this reference.
+// The caller must call .Close() on the returned ImageDestination.
+func (ref pluginReference) NewImageDestination(ctx context.Context, sys *types.SystemContext) (types.ImageDestination, error) {
+	return newImageDestination(ctx, sys, ref)
+}
+
+// DeleteImage deletes the named image from the registry, if supported.
+func (ref pluginReference) DeleteImage(ctx context.Context, sys *types.SystemContext) error {
+	return ref.transport.call(ctx, logging.For(sys), "delete-image", referenceRequest{Reference: ref.ref}, nil, &emptyResponse{})
+}
+
+// instanceDigestString returns instanceDigest as a string for instanceRequest, or "" if it is nil.
+func instanceDigestString(instanceDigest *digest.Digest) string {
+	if instanceDigest == nil {
+		return ""
+	}
+	return instanceDigest.String()
+}
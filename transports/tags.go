@@ -0,0 +1,37 @@
+package transports
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/containers/image/v5/types"
+)
+
+// TagLister is an optional interface of types.ImageReference, for transports which can list
+// the tags of the repository a reference refers to.
+type TagLister interface {
+	// ListTags returns the tags of the repository the reference refers to, or for transports which store images
+	// with arbitrary names in a collection (e.g. an OCI layout), the names of the images in that collection.
+	// The tag or digest of the reference itself, if any, is ignored.
+	ListTags(ctx context.Context, sys *types.SystemContext) ([]string, error)
+}
+
+// ErrTagListingNotSupported is returned by ListTags if the transport of a reference does not support listing tags.
+var ErrTagListingNotSupported = errors.New("listing tags is not supported")
+
+// SupportsTagListing returns true if ref supports ListTags.
+func SupportsTagListing(ref types.ImageReference) bool {
+	_, ok := ref.(TagLister)
+	return ok
+}
+
+// ListTags returns the tags of the repository ref refers to, as documented in TagLister.ListTags.
+// If the transport of ref does not support listing tags, it returns an error wrapping ErrTagListingNotSupported.
+func ListTags(ctx context.Context, sys *types.SystemContext, ref types.ImageReference) ([]string, error) {
+	lister, ok := ref.(TagLister)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", ImageName(ref), ErrTagListingNotSupported)
+	}
+	return lister.ListTags(ctx, sys)
+}
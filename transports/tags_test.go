@@ -0,0 +1,46 @@
+package transports
+
+import (
+	"context"
+	"testing"
+
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testReference is a minimal types.ImageReference; calling methods other than Transport and StringWithinTransport panics.
+type testReference struct {
+	types.ImageReference
+}
+
+func (ref testReference) Transport() types.ImageTransport {
+	return NewStubTransport("test-tags")
+}
+
+func (ref testReference) StringWithinTransport() string {
+	return "ref"
+}
+
+// tagListingReference is a testReference implementing TagLister.
+type tagListingReference struct {
+	testReference
+	tags []string
+}
+
+func (ref tagListingReference) ListTags(ctx context.Context, sys *types.SystemContext) ([]string, error) {
+	return ref.tags, nil
+}
+
+func TestListTags(t *testing.T) {
+	ref := testReference{}
+	assert.False(t, SupportsTagListing(ref))
+	_, err := ListTags(context.Background(), nil, ref)
+	assert.ErrorIs(t, err, ErrTagListingNotSupported)
+
+	lister := tagListingReference{tags: []string{"a", "b"}}
+	assert.True(t, SupportsTagListing(lister))
+	tags, err := ListTags(context.Background(), nil, lister)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, tags)
+}
@@ -61,6 +61,38 @@ func Register(t types.ImageTransport) {
 	kt.Add(t)
 }
 
+// disabledTransports contains the names of transports disabled using Disable.
+var disabledTransports = struct {
+	mutex sync.Mutex
+	names *set.Set[string]
+}{names: set.New[string]()}
+
+// Disable disables the transports with the specified names, whether they are registered or not:
+// ParseImageName and TransportFromImageName in the alltransports package refuse them, and ListNames does not include them.
+// Get continues to return disabled transports, e.g. so that signature verification policies which refer to them remain valid.
+func Disable(names ...string) {
+	disabledTransports.mutex.Lock()
+	defer disabledTransports.mutex.Unlock()
+	disabledTransports.names.AddSlice(names)
+}
+
+// Enable enables the transports with the specified names, if they were disabled using Disable.
+func Enable(names ...string) {
+	disabledTransports.mutex.Lock()
+	defer disabledTransports.mutex.Unlock()
+	for _, name := range names {
+		disabledTransports.names.Delete(name)
+	}
+}
+
+// IsEnabled returns true if the transport with the specified name is not disabled using Disable.
+// It does not check whether the transport is registered.
+func IsEnabled(name string) bool {
+	disabledTransports.mutex.Lock()
+	defer disabledTransports.mutex.Unlock()
+	return !disabledTransports.names.Contains(name)
+}
+
 // ImageName converts a types.ImageReference into an URL-like image name, which MUST be such that
 // ParseImageName(ImageName(reference)) returns an equivalent reference.
 //
@@ -74,14 +106,14 @@ func ImageName(ref types.ImageReference) string {
 
 var deprecatedTransports = set.NewWithValues("atomic")
 
-// ListNames returns a list of non deprecated transport names.
+// ListNames returns a list of non deprecated, enabled transport names.
 // Deprecated transports can be used, but are not presented to users.
 func ListNames() []string {
 	kt.mu.Lock()
 	defer kt.mu.Unlock()
 	var names []string
 	for _, transport := range kt.transports {
-		if !deprecatedTransports.Contains(transport.Name()) {
+		if !deprecatedTransports.Contains(transport.Name()) && IsEnabled(transport.Name()) {
 			names = append(names, transport.Name())
 		}
 	}
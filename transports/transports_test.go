@@ -0,0 +1,27 @@
+package transports
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisable(t *testing.T) {
+	const name = "test-disable"
+	Register(NewStubTransport(name))
+	defer Delete(name)
+
+	assert.True(t, IsEnabled(name))
+	assert.Contains(t, ListNames(), name)
+
+	Disable(name, "test-not-registered")
+	assert.False(t, IsEnabled(name))
+	assert.False(t, IsEnabled("test-not-registered"))
+	assert.NotContains(t, ListNames(), name)
+	assert.NotNil(t, Get(name)) // Disabled transports are still returned by Get
+
+	Enable(name, "test-not-registered")
+	assert.True(t, IsEnabled(name))
+	assert.True(t, IsEnabled("test-not-registered"))
+	assert.Contains(t, ListNames(), name)
+}
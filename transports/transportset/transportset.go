@@ -0,0 +1,160 @@
+// Package transportset parses image names using a set of transports chosen by the caller.
+//
+// Unlike the alltransports package, which links in all transports (and their dependencies, e.g. containers/storage),
+// and requires build tags to exclude some of them, this package only uses the transports passed to New,
+// so programs can link in only the transports they need, and choose the transports to use at runtime, e.g. from configuration.
+package transportset
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/containers/image/v5/internal/set"
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/transports/plugin"
+	"github.com/containers/image/v5/types"
+)
+
+// Set is a set of transports used to parse image names.
+type Set struct {
+	transports map[string]types.ImageTransport // Transports added using WithTransports
+	registered bool                            // Use transports registered in the transports package
+	plugins    bool                            // Use transport plugins
+	excluded   *set.Set[string]                // Names of transports excluded using WithoutTransports
+}
+
+type Option func(*Set) error
+
+// WithTransports returns an Option for New, adding the specified transports to the set.
+func WithTransports(ts ...types.ImageTransport) Option {
+	return func(s *Set) error {
+		for _, t := range ts {
+			name := t.Name()
+			if _, ok := s.transports[name]; ok {
+				return fmt.Errorf("duplicate transport name %q", name)
+			}
+			s.transports[name] = t
+		}
+		return nil
+	}
+}
+
+// WithRegisteredTransports returns an Option for New, adding all transports registered in the transports package,
+// now or in the future, to the set; transports disabled using transports.Disable are not used.
+// Transports added using WithTransports take precedence over registered transports with the same name.
+func WithRegisteredTransports() Option {
+	return func(s *Set) error {
+		s.registered = true
+		return nil
+	}
+}
+
+// WithTransportPlugins returns an Option for New, adding transport plugins (see the plugin package) to the set;
+// transports disabled using transports.Disable are not used.
+// Note that this runs executables found in the plugin directories when parsing image names using transports which are not
+// otherwise known; only use it if the plugin directories are trusted, and image names are not provided by untrusted parties.
+func WithTransportPlugins() Option {
+	return func(s *Set) error {
+		s.plugins = true
+		return nil
+	}
+}
+
+// WithoutTransports returns an Option for New, excluding transports with the specified names from the set,
+// however they were added.
+func WithoutTransports(names ...string) Option {
+	return func(s *Set) error {
+		s.excluded.AddSlice(names)
+		return nil
+	}
+}
+
+// New returns a set of transports specified by opts.
+func New(opts ...Option) (*Set, error) {
+	s := &Set{
+		transports: map[string]types.ImageTransport{},
+		excluded:   set.New[string](),
+	}
+	for _, o := range opts {
+		if err := o(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Get returns the transport with the specified name, or nil if it is not in the set.
+func (s *Set) Get(name string) (types.ImageTransport, error) {
+	if s.excluded.Contains(name) {
+		return nil, nil
+	}
+	if t, ok := s.transports[name]; ok {
+		return t, nil
+	}
+	if !transports.IsEnabled(name) {
+		return nil, nil
+	}
+	if s.registered {
+		if t := transports.Get(name); t != nil {
+			return t, nil
+		}
+	}
+	if s.plugins {
+		return plugin.Lookup(name)
+	}
+	return nil, nil
+}
+
+// ParseImageName converts a URL-like image name to a types.ImageReference.
+func (s *Set) ParseImageName(imgName string) (types.ImageReference, error) {
+	// Keep this in sync with TransportFromImageName!
+	transportName, withinTransport, valid := strings.Cut(imgName, ":")
+	if !valid {
+		return nil, fmt.Errorf(`Invalid image name "%s", expected colon-separated transport:reference`, imgName)
+	}
+	transport, err := s.Get(transportName)
+	if err != nil {
+		return nil, err
+	}
+	if transport == nil {
+		return nil, fmt.Errorf(`Invalid image name "%s", unknown transport "%s"`, imgName, transportName)
+	}
+	return transport.ParseReference(withinTransport)
+}
+
+// TransportFromImageName converts an URL-like name to a types.ImageTransport, or nil when
+// the transport is unknown or when the input is invalid.
+// It fails if looking up a transport plugin fails.
+func (s *Set) TransportFromImageName(imageName string) (types.ImageTransport, error) {
+	// Keep this in sync with ParseImageName!
+	transportName, _, valid := strings.Cut(imageName, ":")
+	if !valid {
+		return nil, nil
+	}
+	return s.Get(transportName)
+}
+
+// ListNames returns a sorted list of names of transports in the set, excluding deprecated transports
+// and transport plugins which have not been used yet.
+func (s *Set) ListNames() []string {
+	names := set.New[string]()
+	for name := range s.transports {
+		names.Add(name)
+	}
+	if s.registered || s.plugins {
+		for _, name := range transports.ListNames() {
+			if t, err := s.Get(name); err == nil && t != nil {
+				names.Add(name)
+			}
+		}
+	}
+	res := []string{}
+	for _, name := range names.Values() {
+		if !s.excluded.Contains(name) {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
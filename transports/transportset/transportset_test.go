@@ -0,0 +1,88 @@
+package transportset
+
+import (
+	"testing"
+
+	"github.com/containers/image/v5/transports"
+	"github.com/containers/image/v5/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	_, err := New(WithTransports(transports.NewStubTransport("a"), transports.NewStubTransport("a")))
+	assert.Error(t, err)
+}
+
+func TestSet(t *testing.T) {
+	explicit := transports.NewStubTransport("test-explicit")
+	shadowing := transports.NewStubTransport("test-registered-shadowed")
+	for _, name := range []string{"test-registered", "test-registered-shadowed", "test-registered-excluded", "test-registered-disabled"} {
+		transports.Register(transports.NewStubTransport(name))
+		defer transports.Delete(name)
+	}
+	transports.Disable("test-registered-disabled")
+	defer transports.Enable("test-registered-disabled")
+
+	// Only explicitly listed transports
+	s, err := New(WithTransports(explicit))
+	require.NoError(t, err)
+	for _, c := range []struct {
+		name     string
+		expected types.ImageTransport
+	}{
+		{"test-explicit", explicit},
+		{"test-registered", nil},
+		{"docker", nil},
+		{"", nil},
+	} {
+		transport, err := s.Get(c.name)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, c.expected, transport, c.name)
+	}
+	assert.Equal(t, []string{"test-explicit"}, s.ListNames())
+
+	// Explicit and registered transports
+	s, err = New(WithTransports(explicit, shadowing), WithRegisteredTransports(), WithoutTransports("test-registered-excluded"))
+	require.NoError(t, err)
+	for _, c := range []struct {
+		name     string
+		expected types.ImageTransport
+	}{
+		{"test-explicit", explicit},
+		{"test-registered", transports.Get("test-registered")},
+		{"test-registered-shadowed", shadowing},
+		{"test-registered-excluded", nil},
+		{"test-registered-disabled", nil},
+		{"test-unknown", nil},
+	} {
+		transport, err := s.Get(c.name)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, c.expected, transport, c.name)
+	}
+	names := s.ListNames()
+	assert.Subset(t, names, []string{"test-explicit", "test-registered", "test-registered-shadowed"})
+	assert.NotContains(t, names, "test-registered-excluded")
+	assert.NotContains(t, names, "test-registered-disabled")
+
+	// ParseImageName and TransportFromImageName
+	_, err = s.ParseImageName("test-registered:ref")
+	assert.ErrorContains(t, err, "not supported in this build") // i.e. the stub transport was used
+	for _, name := range []string{"", "test-registered", ":ref", "test-unknown:ref", "test-registered-disabled:ref"} {
+		_, err := s.ParseImageName(name)
+		assert.Error(t, err, name)
+		assert.NotContains(t, err.Error(), "not supported in this build", name)
+	}
+	for _, c := range []struct {
+		name     string
+		expected types.ImageTransport
+	}{
+		{"test-explicit:ref", explicit},
+		{"test-registered-excluded:ref", nil},
+		{"test-explicit", nil},
+	} {
+		transport, err := s.TransportFromImageName(c.name)
+		require.NoError(t, err, c.name)
+		assert.Equal(t, c.expected, transport, c.name)
+	}
+}
@@ -2,6 +2,8 @@ package types
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"time"
 
@@ -362,6 +364,32 @@ func (e ManifestTypeRejectedError) Error() string {
 	return e.Err.Error()
 }
 
+// SizeLimitExceededError is returned when data read from a source, e.g. a manifest, is larger than the applicable limit,
+// e.g. SystemContext.MaxManifestSize.
+type SizeLimitExceededError struct {
+	Limit int64 // The limit, in bytes
+}
+
+func (e SizeLimitExceededError) Error() string {
+	return fmt.Sprintf("exceeded maximum allowed size of %d bytes", e.Limit)
+}
+
+// Errors returned by transports may be classified using errors.Is against the following values, so that callers
+// can decide e.g. whether to retry an operation, or how to describe a failure to users, without parsing error text.
+// The returned errors are typically more specific (e.g. include details reported by a registry), and are not equal to these values.
+var (
+	// ErrNotFound is used when the requested image, manifest or blob does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrUnauthorized is used when the operation was rejected because of missing, invalid or insufficient credentials.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrTooManyRequests is used when the server is rate limiting requests.
+	ErrTooManyRequests = errors.New("too many requests")
+	// ErrBlobUnknown is used when a specific blob does not exist. Errors classified as ErrBlobUnknown are also classified as ErrNotFound.
+	ErrBlobUnknown = errors.New("blob unknown")
+	// ErrManifestInvalid is used when a manifest was rejected as invalid, e.g. by a registry when uploading it.
+	ErrManifestInvalid = errors.New("manifest invalid")
+)
+
 // UnparsedImage is an Image-to-be; until it is verified and accepted, it only caries its identity and caches manifest and signature blobs.
 // Thus, an UnparsedImage can be created from an ImageSource simply by fetching blobs without interpreting them,
 // allowing cryptographic signature verification to happen first, before even fetching the manifest, or parsing anything else.
@@ -450,10 +478,30 @@ type ManifestUpdateOptions struct {
 	LayerInfos              []BlobInfo // Complete BlobInfos (size+digest+urls+annotations) which should replace the originals, in order (the root layer first, and then successive layered layers). BlobInfos' MediaType fields are ignored.
 	EmbeddedDockerReference reference.Named
 	ManifestMIMEType        string
+	// If not nil, replaces the manifest-level annotations (after any conversion to ManifestMIMEType).
+	// Only OCI manifests support annotations; updating a manifest of a different format fails.
+	Annotations map[string]string
+	// ConfigStrictness controls how fields of the image configuration not defined by any supported format
+	// (e.g. vendor extensions) are handled if the configuration needs to be rebuilt, e.g. when converting between manifest formats.
+	// This is not a request to modify the image by itself.
+	ConfigStrictness ConfigStrictness
 	// The values below are NOT requests to modify the image; they provide optional context which may or may not be used.
 	InformationOnly ManifestUpdateInformation
 }
 
+// ConfigStrictness controls how fields of an image configuration which are not defined by the OCI or Docker
+// configuration formats are handled when the configuration is rebuilt.
+type ConfigStrictness byte
+
+const (
+	// ConfigStrictnessDropUnknownFields silently drops unknown fields; this is the default.
+	ConfigStrictnessDropUnknownFields ConfigStrictness = iota
+	// ConfigStrictnessPreserveUnknownFields copies unknown fields into the rebuilt configuration unchanged.
+	ConfigStrictnessPreserveUnknownFields
+	// ConfigStrictnessRejectUnknownFields fails if the configuration contains unknown fields, instead of rebuilding it.
+	ConfigStrictnessRejectUnknownFields
+)
+
 // ManifestUpdateInformation is a component of ManifestUpdateOptions, named here
 // only to make writing struct literals possible.
 type ManifestUpdateInformation struct {
@@ -497,6 +545,22 @@ type DockerAuthConfig struct {
 	// token is set, password should not be set.
 	// Ref: https://docs.docker.com/registry/spec/auth/oauth/
 	IdentityToken string
+	// ExpiresAt, if not zero, is the time after which the credentials are no longer valid,
+	// e.g. for short-lived tokens issued by cloud providers.
+	// See SystemContext.DockerCredentialsRefresh.
+	ExpiresAt time.Time
+	// ClientCertificatePath and ClientKeyPath, if not "", are absolute paths to a PEM-encoded TLS client certificate
+	// and its private key, used for mutual TLS authentication with the registry in addition to any certificates
+	// configured in a certs.d directory.
+	ClientCertificatePath string
+	ClientKeyPath         string
+}
+
+// S3Credentials contains credentials for accessing an S3-compatible object storage service.
+type S3Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string // Only used with temporary credentials.
 }
 
 // OptionalBool is a boolean with an additional undefined value, which is meant
@@ -553,6 +617,104 @@ const (
 	ShortNameModeEnforcing
 )
 
+// DockerSchema1Mode defines whether, and how, deprecated Docker schema1 manifests are handled.
+//
+// Schema1 manifests embed unverified image metadata and a Docker reference, and their signatures are
+// not meaningfully verifiable; new consumers should not need them at all.
+type DockerSchema1Mode int
+
+const (
+	// DockerSchema1Refuse refuses to parse schema1 manifests as images, and to write them to destinations.
+	// This is the default.
+	DockerSchema1Refuse DockerSchema1Mode = iota
+	// DockerSchema1ConvertOnly allows parsing schema1 images, so that they can be inspected and converted
+	// (e.g. by copy.Image) to schema2 or OCI; writing schema1 manifests to destinations is still refused.
+	// This is intended for migration tooling.
+	DockerSchema1ConvertOnly
+	// DockerSchema1Allow allows parsing schema1 images, and writing schema1 manifests to destinations.
+	DockerSchema1Allow
+)
+
+// Logger receives log messages from this library; see SystemContext.Logger.
+// Implementations must be safe for concurrent use.
+//
+// The methods correspond to the logrus methods with the same names; pkg/logging.Logrus adapts a logrus logger.
+type Logger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+	Errorf(format string, args ...any)
+	// WithFields returns a Logger which attaches fields, in addition to any fields attached by the receiver, to all messages.
+	WithFields(fields LogFields) Logger
+}
+
+// LogFields are structured data attached to log messages.
+// Keys used by this library include the LogField… constants.
+type LogFields map[string]any
+
+const (
+	// LogFieldTransport is the name of the transport (e.g. "docker") a message relates to.
+	LogFieldTransport = "transport"
+	// LogFieldRegistry is the host[:port] of the registry a message relates to.
+	LogFieldRegistry = "registry"
+	// LogFieldDigest is the digest of the blob or manifest a message relates to.
+	LogFieldDigest = "digest"
+	// LogFieldAttempt is the 1-based number of the attempt of a retried operation a message relates to.
+	LogFieldAttempt = "attempt"
+)
+
+// Metrics receives metrics about operations of this library; see SystemContext.Metrics.
+// The metrics are counters, in the style of Prometheus, with names and labels described by the Metric… and MetricLabel… constants.
+// Implementations must be safe for concurrent use, and must not modify or retain the labels maps.
+type Metrics interface {
+	// AddCounter adds delta, which is never negative, to the counter name with labels.
+	AddCounter(name string, labels MetricLabels, delta int64)
+}
+
+// MetricLabels are the labels of a metric, keyed by the MetricLabel… constants.
+type MetricLabels map[string]string
+
+const (
+	// MetricBytesPulled counts the bytes of blobs read from registries. Labels: MetricLabelRegistry.
+	MetricBytesPulled = "containers_image_bytes_pulled_total"
+	// MetricBytesPushed counts the bytes of blobs uploaded to registries. Labels: MetricLabelRegistry.
+	MetricBytesPushed = "containers_image_bytes_pushed_total"
+	// MetricLayersCopied counts the layers successfully copied by the copy package.
+	// Labels: MetricLabelTransport (of the destination), MetricLabelResult: "reused" (the destination already had the blob),
+	// "partial" (only parts of the blob were read from the source), or "copied".
+	MetricLayersCopied = "containers_image_layers_copied_total"
+	// MetricRequestRetries counts retries of requests to registries. Labels: MetricLabelRegistry,
+	// MetricLabelReason: "too_many_requests", "insufficient_scope" or "refreshed_token".
+	MetricRequestRetries = "containers_image_request_retries_total"
+	// MetricTokenFetches counts requests for bearer tokens from registry authentication servers.
+	// Labels: MetricLabelRegistry, MetricLabelResult: "success" or "failure".
+	MetricTokenFetches = "containers_image_token_fetches_total"
+	// MetricMirrorFallbacks counts failures to pull from a registry mirror, after which the next mirror or the primary location is tried.
+	// Labels: MetricLabelRegistry (of the primary location), MetricLabelMirror.
+	MetricMirrorFallbacks = "containers_image_mirror_fallbacks_total"
+)
+
+const (
+	// MetricLabelRegistry is the host[:port] of the registry a metric relates to.
+	MetricLabelRegistry = "registry"
+	// MetricLabelMirror is the host[:port] of the registry mirror a metric relates to.
+	MetricLabelMirror = "mirror"
+	// MetricLabelTransport is the name of the transport (e.g. "docker") a metric relates to.
+	MetricLabelTransport = "transport"
+	// MetricLabelResult is the outcome of the operation a metric relates to; the values depend on the metric.
+	MetricLabelResult = "result"
+	// MetricLabelReason is the reason for the operation a metric relates to; the values depend on the metric.
+	MetricLabelReason = "reason"
+)
+
+// RegistryRateLimiter limits the rate of HTTP requests sent to registries; see SystemContext.RegistryRateLimiter, and pkg/ratelimit for an implementation.
+// Implementations must be safe for concurrent use; a single value is typically shared by all operations in a process.
+type RegistryRateLimiter interface {
+	// Wait blocks until a request to registry (a host[:port] value, e.g. "registry-1.docker.io" for docker.io) may be sent.
+	// It returns an error, and the request is not sent, if ctx is done before that.
+	Wait(ctx context.Context, registry string) error
+}
+
 // SystemContext allows parameterizing access to implicitly-accessed resources,
 // like configuration files in /etc and users' login state in their home directory.
 // Various components can share the same field only if their semantics is exactly
@@ -598,18 +760,67 @@ type SystemContext struct {
 	// This must not be set if AuthFilePath is set.
 	// Only credentials and credential helpers in this file apre processed, not any other configuration in this file.
 	DockerCompatAuthFilePath string
+	// If not nil, a 32-byte key used to encrypt (using AES-256-GCM) the registry authentication file when it is written,
+	// and to decrypt encrypted authentication files when they are read.
+	// If the file is not encrypted, reading it fails; it is encrypted when credentials are next stored.
+	// Other authentication files (e.g. Docker’s config.json) are never encrypted. This must not be set if DockerCompatAuthFilePath is set.
+	AuthFileEncryptionKey []byte
+	// If not "", the description of a "user" key in the Linux kernel keyrings of the user (e.g. added using
+	// `keyctl padd user <description> @u`), containing a key used like AuthFileEncryptionKey.
+	// This must not be set if AuthFileEncryptionKey or DockerCompatAuthFilePath is set.
+	AuthFileEncryptionKeyringKey string
 	// If not "", overrides the use of platform.GOARCH when choosing an image or verifying architecture match.
 	ArchitectureChoice string
 	// If not "", overrides the use of platform.GOOS when choosing an image or verifying OS match.
 	OSChoice string
 	// If not "", overrides the use of detected ARM platform variant when choosing an image or verifying variant match.
 	VariantChoice string
+	// If not "", the OS version (e.g. "10.0.17763.1879" for Windows) to prefer when choosing an image from a manifest list.
+	// Instances with the same major.minor.build prefix as this value are preferred over instances which don’t specify an OS version,
+	// and those are preferred over instances with a different OS version. On Windows, the version of the host is used by default.
+	OSVersionChoice string
 	// If not "", overrides the system's default directory containing a blob info cache.
 	BlobInfoCacheDir string
 	// Additional tags when creating or copying a docker-archive.
 	DockerArchiveAdditionalTags []reference.NamedTagged
 	// If not "", overrides the temporary directory to use for storing big files
 	BigFilesTemporaryDir string
+	// If true, layers which list external URLs ("foreign" layers) are only read from the source itself,
+	// and never downloaded from those URLs.
+	// Note that this is currently only used by the docker and oci transports.
+	DisableForeignLayerURLs bool
+	// If not nil, receives log messages instead of the standard logrus logger; see pkg/logging for adapters, including one to discard all messages.
+	// Note that this is currently only used by the copy package, the docker, containers-storage, oci, oci-archive, ocihttp, s3 and ssh transports,
+	// transport plugins, and the functions of pkg/docker/config and pkg/tlsclientconfig which accept a SystemContext; other messages, including
+	// those of functions which don't accept a SystemContext, are still logged using the standard logrus logger.
+	// See also signature.PolicyContext.SetLogger.
+	Logger Logger
+	// If not nil, receives metrics about operations; see the Metric… constants for the metrics which are reported, and by what code.
+	Metrics Metrics
+	// If not nil, consulted before each HTTP request to a registry (including requests for bearer tokens on behalf of that registry).
+	// Note that this is currently only used by the docker transport.
+	RegistryRateLimiter RegistryRateLimiter
+	// If not 0, the maximum size, in bytes, of a manifest, an image config, or a signature, read from a source; larger data is rejected
+	// with a SizeLimitExceededError. The defaults are 4 MiB each.
+	// Note that this is currently only used by the docker, ocihttp, s3 and ssh transports, and when reading image configs from any source.
+	MaxManifestSize  int64
+	MaxConfigSize    int64
+	MaxSignatureSize int64
+	// If not "", the algorithm used for blob digests computed when writing to a destination which does not receive a digest
+	// in an acceptable algorithm; one of digest.SHA256 (the default), digest.SHA384, digest.SHA512.
+	// Note that this is currently only used by the docker, oci and dir transports.
+	DigestAlgorithm digest.Algorithm
+	// If not nil, the only digest algorithms accepted for blobs read from a source; the default is digest.SHA256, digest.SHA384 and digest.SHA512.
+	// With TLSFIPSMode, algorithms not approved for FIPS 140 are never accepted.
+	AcceptedDigestAlgorithms []digest.Algorithm
+	// If not 0, the minimum TLS version (e.g. tls.VersionTLS12) used when connecting to registries and other servers.
+	TLSMinVersion uint16
+	// If not nil, the only TLS cipher suites (e.g. tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256) used when connecting to registries and other servers.
+	// TLS 1.3 cipher suites can not be configured.
+	TLSCipherSuites []uint16
+	// If true, only TLS 1.2 with cipher suites and key exchange curves approved for FIPS 140 is used when connecting to registries and other servers.
+	// Note that this only restricts the protocol parameters; whether the cryptographic implementation is FIPS-validated depends on how the program is built.
+	TLSFIPSMode bool
 
 	// === OCI.Transport overrides ===
 	// If not "", a directory containing a CA certificate (ending with ".crt"),
@@ -620,8 +831,23 @@ type SystemContext struct {
 	OCIInsecureSkipTLSVerify bool
 	// If not "", use a shared directory for storing blobs rather than within OCI layouts
 	OCISharedBlobDirPath string
+	// If OCISharedBlobDirPath is set, controls whether blobs written to, or reused from, the shared directory
+	// are also linked into the blobs directory of the OCI layout, so that the layout is self-contained.
+	OCISharedBlobDirLinkMode OCISharedBlobLinkMode
+	// If not 0, the maximum time to wait for other processes to release the locks of an OCI layout
+	// (which protect the index and unreferenced blobs of the layout against concurrent updates);
+	// by default, wait indefinitely.
+	OCILayoutLockTimeout time.Duration
 	// Allow UnCompress image layer for OCI image layer
 	OCIAcceptUncompressedLayers bool
+	// If not nil, oci-archive archives are compressed using this algorithm when writing them; by default, they are not compressed.
+	// Compressed archives are decompressed automatically when reading them.
+	// compression.ZstdChunked is not supported.
+	OCIArchiveCompressionFormat *compression.Algorithm
+	// If not 0, oci-archive archives are split into volumes of at most this many bytes when writing them,
+	// stored in files named after the archive with a numeric suffix (e.g. "archive.tar.001"), along with a description
+	// of the volumes (e.g. "archive.tar.volumes.json"). Such archives are reassembled automatically when reading them.
+	OCIArchiveVolumeSize int64
 
 	// === docker.Transport overrides ===
 	// If not "", a directory containing a CA certificate (ending with ".crt"),
@@ -631,13 +857,36 @@ type SystemContext struct {
 	// If not "", overrides the system’s default path for a directory containing host[:port] subdirectories with the same structure as DockerCertPath above.
 	// Ignored if DockerCertPath is non-empty.
 	DockerPerHostCertDirPath string
+	// If not "", the address of a SPIFFE Workload API endpoint (e.g. a SPIRE agent socket, "unix:///path" or "tcp://ip:port"),
+	// used to obtain automatically renewed X.509-SVIDs as client certificates when talking to container registries.
+	// Such certificates are used instead of any client certificates in DockerCertPath or DockerPerHostCertDirPath (with a warning);
+	// it can not be used with client certificates specified in credentials (DockerAuthConfig.ClientCertificatePath, or in auth files).
+	DockerSPIFFEEndpointSocket string
 	// Allow contacting container registries over HTTP, or HTTPS with failed TLS verification. Note that this does not affect other TLS connections.
 	DockerInsecureSkipTLSVerify OptionalBool
+	// If not nil, overrides the registries.conf pinned-public-keys setting: TLS connections to container registries are only accepted
+	// if the server’s certificate chain contains one of these public keys (see tlsclientconfig.PublicKeyPin), even if the chain is otherwise trusted.
+	// An empty, non-nil, value disables pinning.
+	DockerPinnedPublicKeys []string
 	// if nil, the library tries to parse ~/.docker/config.json to retrieve credentials
 	// Ignored if DockerBearerRegistryToken is non-empty.
 	DockerAuthConfig *DockerAuthConfig
 	// if not "", the library uses this registry token to authenticate to the registry
 	DockerBearerRegistryToken string
+	// If true, identity tokens rotated by a registry’s OAuth2 token endpoint while refreshing access tokens
+	// replace the credentials they were obtained with, as pkg/docker/config.SetIdentityToken would.
+	// This only happens if the credentials were read from the auth file SetIdentityToken writes to;
+	// in particular, it is ignored if DockerAuthConfig is set.
+	DockerPersistRotatedIdentityTokens bool
+	// If not nil, called when credentials with a non-zero DockerAuthConfig.ExpiresAt have expired or are about to expire,
+	// to obtain replacement credentials before they are used for further requests.
+	// key is the repository or registry the credentials were looked up for, as in pkg/docker/config.GetCredentials.
+	// The callback may be called concurrently for different registries, but not for a single registry connection.
+	// If it fails, or returns credentials which are also about to expire, it is not called again for a while.
+	DockerCredentialsRefresh func(ctx context.Context, key string, expiring DockerAuthConfig) (DockerAuthConfig, error)
+	// If true, identical concurrent requests for manifests and bearer tokens, made within this process with the same credentials and TLS configuration
+	// (possibly by unrelated image sources, e.g. many goroutines pulling the same tag), are only sent once, and the result is shared.
+	DockerDeduplicateRequests bool
 	// if not "", an User-Agent header is added to each request when contacting a registry.
 	DockerRegistryUserAgent string
 	// if true, a V1 ping attempt isn't done to give users a better error. Default is false.
@@ -646,8 +895,26 @@ type SystemContext struct {
 	DockerDisableV1Ping bool
 	// If true, dockerImageDestination.SupportedManifestMIMETypes will omit the Schema1 media types from the supported list
 	DockerDisableDestSchema1MIMETypes bool
+	// Controls whether deprecated Docker schema1 manifests are parsed and written; see DockerSchema1Mode.
+	// The default (DockerSchema1Refuse) refuses them; set DockerSchema1ConvertOnly to convert them to a modern format.
+	// For copy.Image, this is read from SourceCtx when parsing the source image, and from DestinationCtx when writing.
+	DockerSchema1Mode DockerSchema1Mode
+	// If not nil, maps nonstandard manifest MIME types returned by registries (e.g. vendor-specific ones) to the standard
+	// manifest MIME types with the same semantics, which are then used for parsing the manifest and for copy conversion decisions.
+	// A "" value means that the MIME type is guessed from the contents of the manifest instead.
+	// The manifest contents, and therefore its digest, are not modified.
+	DockerManifestMIMETypeAliases map[string]string
 	// If true, the physical pull source of docker transport images logged as info level
 	DockerLogMirrorChoice bool
+	// If not OptionalBoolUndefined, overrides the registries.d use-sigstore-attachments setting, i.e. whether sigstore
+	// attachments (e.g. cosign signatures stored in "sha256-<digest>.sig" tags) are read from and written to registries.
+	DockerUseSigstoreAttachments OptionalBool
+	// If not OptionalBoolUndefined, overrides the registries.d discover-sigstore-signatures setting, i.e. whether sigstore
+	// signatures are read from registries where the use of sigstore attachments is not configured.
+	DockerDiscoverSigstoreSignatures OptionalBool
+	// If not OptionalBoolUndefined, overrides the registries.d use-sigstore-referrers setting, i.e. whether sigstore
+	// signatures are stored as OCI referrers instead of in "sha256-<digest>.sig" tags, where sigstore attachments are used.
+	DockerUseSigstoreReferrers OptionalBool
 	// Directory to use for OSTree temporary files
 	OSTreeTmpDirPath string
 	// If true, all blobs will have precomputed digests to ensure layers are not uploaded that already exist on the registry.
@@ -655,6 +922,9 @@ type SystemContext struct {
 	// when the digest for a blob is unknown.
 	DockerRegistryPushPrecomputeDigests bool
 
+	// If true, blobs are always downloaded from the registry, without consulting content routers registered using docker.RegisterContentRouter.
+	DockerDisableContentRouters bool
+
 	// === docker/daemon.Transport overrides ===
 	// A directory containing a CA certificate (ending with ".crt"),
 	// a client certificate (ending with ".cert") and a client certificate key
@@ -665,11 +935,66 @@ type SystemContext struct {
 	// Used to skip TLS verification, off by default. To take effect DockerDaemonCertPath needs to be specified as well.
 	DockerDaemonInsecureSkipTLSVerify bool
 
+	// === s3.Transport overrides ===
+	// If not "", the URL of an S3-compatible object storage service (e.g. MinIO, or https://storage.googleapis.com),
+	// with buckets addressed using path-style URLs.  Otherwise, Amazon S3 is used.
+	S3Endpoint string
+	// If not "", the region of the bucket.  Otherwise, $AWS_REGION, $AWS_DEFAULT_REGION or the region of the AWS shared configuration profile
+	// is used if set, or "us-east-1".
+	S3Region string
+	// If not nil, the credentials to use.  Otherwise, the credentials are looked up the way AWS tools do: using $AWS_ACCESS_KEY_ID,
+	// $AWS_SECRET_ACCESS_KEY and $AWS_SESSION_TOKEN, the AWS shared credentials and configuration files (using $AWS_PROFILE),
+	// the container credentials provider, or the role of the EC2 instance; if no credentials are available, requests are not authenticated.
+	S3Credentials *S3Credentials
+	// If not "", the server-side encryption to request when writing objects: "AES256" or "aws:kms".
+	S3ServerSideEncryption string
+	// The AWS KMS key to use with S3ServerSideEncryption "aws:kms".  If "", the default key is used.
+	S3ServerSideEncryptionKMSKeyID string
+
+	// === ocihttp.Transport overrides ===
+	// If not "", a directory containing a CA certificate (ending with ".crt"),
+	// a client certificate (ending with ".cert") and a client certificate key
+	// (ending with ".key") used when talking to the web server.
+	OCIHTTPCertPath string
+	// Allow contacting web servers over HTTPS with failed TLS verification. Note that this does not affect other TLS connections.
+	OCIHTTPInsecureSkipTLSVerify bool
+
+	// === ssh.Transport overrides ===
+	// If not "", a private key file used to authenticate to the remote host.  Otherwise, keys available from an SSH agent
+	// ($SSH_AUTH_SOCK) and the default key files in ~/.ssh are used.
+	SSHIdentityFile string
+	// If not "", the known_hosts file used to verify host keys.  Otherwise, ~/.ssh/known_hosts is used.
+	SSHKnownHostsFile string
+	// Allow contacting remote hosts without verifying their host keys.
+	SSHInsecureSkipHostKeyVerify bool
+	// If not "", a [user@]host[:port] bastion host through which the remote host is contacted.
+	SSHJumpHost string
+	// The maximum number of concurrent sessions (i.e. remote commands) on a single connection.  If 0, a default of 8 is used,
+	// which is below the default MaxSessions value of OpenSSH servers.
+	SSHMaxSessions int
+
+	// === containerd.Transport overrides ===
+	// The address of the containerd API socket. If not set (aka ""), containerd's default address is assumed.
+	ContainerdAddress string
+	// The containerd namespace to read and write images in. If not set (aka ""), the "default" namespace is used.
+	ContainerdNamespace string
+
 	// === dir.Transport overrides ===
 	// DirForceCompress compresses the image layers if set to true
 	DirForceCompress bool
 	// DirForceDecompress decompresses the image layers if set to true
 	DirForceDecompress bool
+	// DirLayoutVersion selects the layout written by the dir transport: "" (the default) or "1.1" for the original layout,
+	// "2.0" for a layout which also records the compression of blobs, the original reference and the creation time
+	// in a metadata file, and which compresses layers unless DirForceDecompress is set.
+	DirLayoutVersion string
+
+	// === containers-storage transport overrides ===
+	// ContainersStorageLazyLayers, if true, makes the containers-storage transport store layer blobs as files
+	// instead of applying them to layers; they are applied on first use, by storage.ApplyLazyLayers,
+	// or used directly by callers which can mount compressed layers.  Until then, the image has no layers, and it is marked
+	// with the storage.LazyLayersFlag flag.
+	ContainersStorageLazyLayers bool
 
 	// CompressionFormat is the format to use for the compression of the blobs
 	CompressionFormat *compression.Algorithm
@@ -677,6 +1002,20 @@ type SystemContext struct {
 	CompressionLevel *int
 }
 
+// OCISharedBlobLinkMode determines how blobs in a shared OCI blob directory are made available within individual OCI layouts.
+type OCISharedBlobLinkMode int
+
+const (
+	// OCISharedBlobLinkNone stores blobs only in the shared directory; this is the default.
+	OCISharedBlobLinkNone OCISharedBlobLinkMode = iota
+	// OCISharedBlobLinkHardlink hard-links blobs from the shared directory into the layout.
+	// The shared directory and the layout must be on the same filesystem.
+	OCISharedBlobLinkHardlink
+	// OCISharedBlobLinkReflink creates copy-on-write clones (“reflinks”) of blobs from the shared directory in the layout.
+	// This is only supported on Linux, on filesystems that support cloning files.
+	OCISharedBlobLinkReflink
+)
+
 // ProgressEvent is the type of events a progress reader can produce
 // Warning: new event types may be added any time.
 type ProgressEvent uint
@@ -696,6 +1035,17 @@ const (
 	// ProgressEventSkipped is fired when the artifact has been skipped because
 	// its already available at the destination
 	ProgressEventSkipped
+
+	// ProgressEventApplying is fired when the destination starts applying a layer,
+	// e.g. extracting it into local storage, after its data has been transferred
+	ProgressEventApplying
+
+	// ProgressEventApplied is fired when the destination has finished applying a layer
+	ProgressEventApplied
+
+	// ProgressEventRolledBack is fired when the destination removes a layer it has applied
+	// because the copy failed
+	ProgressEventRolledBack
 )
 
 // ProgressProperties is used to pass information from the copy code to a monitor which